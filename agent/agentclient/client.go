@@ -60,7 +60,7 @@ func (c *HTTPClient) GetTag(tag string) (core.Digest, error) {
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("read body: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(string(b))
+	d, err := core.ParseDigest(string(b))
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("parse digest: %s", err)
 	}
@@ -0,0 +1,143 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ImageDiff describes the blobs an image adds on top of a base image, and
+// how many of their bytes the agent does not have yet.
+type ImageDiff struct {
+	Digest     core.Digest `json:"digest"`
+	BaseDigest core.Digest `json:"base_digest"`
+
+	// Blobs lists the config and layers of the image which are not part of
+	// the base image.
+	Blobs []ImageDiffBlob `json:"blobs"`
+
+	// Bytes is the total size of Blobs.
+	Bytes int64 `json:"bytes"`
+
+	// MissingBytes is the total size of Blobs not cached on the agent, i.e.
+	// the cost of pulling the image.
+	MissingBytes int64 `json:"missing_bytes"`
+
+	// Prefetching is set if the agent is downloading the missing blobs.
+	Prefetching bool `json:"prefetching"`
+}
+
+// ImageDiffBlob is a blob of an ImageDiff.
+type ImageDiffBlob struct {
+	Digest core.Digest `json:"digest"`
+	Size   int64       `json:"size"`
+	Cached bool        `json:"cached"`
+}
+
+// getImageDiffHandler reports the blobs of an image which are not part of a
+// previously pulled base image, and optionally prefetches the missing ones.
+func (s *Server) getImageDiffHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	base := httputil.GetQueryArg(r, "base", "")
+	if base == "" {
+		return handler.Errorf("query arg `base` is required").Status(http.StatusBadRequest)
+	}
+	prefetch, err := strconv.ParseBool(httputil.GetQueryArg(r, "prefetch", "false"))
+	if err != nil {
+		return handler.Errorf("parse query arg `prefetch`: %s", err).Status(http.StatusBadRequest)
+	}
+
+	namespace, d, blobs, err := s.resolveImageTag(r, tag)
+	if err != nil {
+		return err
+	}
+	_, baseDigest, baseBlobs, err := s.resolveImageTag(r, base)
+	if err != nil {
+		return err
+	}
+	inBase := make(map[core.Digest]bool, len(baseBlobs))
+	for _, blob := range baseBlobs {
+		inBase[blob.digest] = true
+	}
+
+	diff := ImageDiff{Digest: d, BaseDigest: baseDigest, Blobs: []ImageDiffBlob{}}
+	var missing []core.Digest
+	for _, blob := range blobs {
+		// Manifests have already been downloaded to resolve the image.
+		if blob.manifest || inBase[blob.digest] {
+			continue
+		}
+		_, err := s.cads.Cache().GetFileStat(blob.digest.Name())
+		cached := err == nil
+		diff.Blobs = append(diff.Blobs, ImageDiffBlob{blob.digest, blob.size, cached})
+		diff.Bytes += blob.size
+		if !cached {
+			diff.MissingBytes += blob.size
+			missing = append(missing, blob.digest)
+		}
+	}
+	if prefetch && len(missing) > 0 {
+		diff.Prefetching = true
+		s.stats.Counter("image_diff_prefetches").Inc(1)
+		go func() {
+			if err := s.downloadBlobs(namespace, missing); err != nil {
+				log.With("tag", tag).Errorf("Error prefetching image diff: %s", err)
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// resolveImageTag resolves tag to its manifest digest and blobs. The namespace
+// defaults to the repo of tag unless set in the request.
+func (s *Server) resolveImageTag(
+	r *http.Request, tag string) (namespace string, d core.Digest, blobs []imageBlob, err error) {
+
+	parts := strings.Split(tag, ":")
+	if len(parts) != 2 {
+		return "", core.Digest{}, nil, handler.Errorf(
+			"failed to parse docker image tag %q", tag).Status(http.StatusBadRequest)
+	}
+	namespace = httputil.GetQueryArg(r, "namespace", parts[0])
+
+	d, err = s.tags.Get(tag)
+	if err != nil {
+		if err == tagclient.ErrTagNotFound {
+			return "", core.Digest{}, nil, handler.Errorf("tag %s not found", tag).Status(http.StatusNotFound)
+		}
+		return "", core.Digest{}, nil, handler.Errorf("get tag: %s", err)
+	}
+	_, blobs, err = s.resolveImageBlobs(namespace, d)
+	if err != nil {
+		return "", core.Digest{}, nil, err
+	}
+	return namespace, d, blobs, nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getImageDiff(addr, tag, query string) (*ImageDiff, error) {
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/x/images/%s/diff?%s", addr, url.PathEscape(tag), query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var diff ImageDiff
+	if err := json.NewDecoder(resp.Body).Decode(&diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+type imageDiffFixture struct {
+	repo         string
+	base, tag    string
+	baseManifest core.Digest
+	manifest     core.Digest
+	config       *core.BlobFixture
+	shared       *core.BlobFixture
+	layer        *core.BlobFixture
+}
+
+// newImageDiffFixture caches a base image and the manifest of a new image on
+// the agent. The new image shares a layer with the base image, and adds a new
+// config and layer.
+func newImageDiffFixture(t *testing.T, mocks *serverMocks) *imageDiffFixture {
+	f := &imageDiffFixture{
+		repo:   "uber/kraken",
+		config: core.NewBlobFixture(),
+		shared: core.NewBlobFixture(),
+		layer:  core.NewBlobFixture(),
+	}
+	f.base = f.repo + ":v1"
+	f.tag = f.repo + ":v2"
+
+	baseConfig := core.NewBlobFixture()
+	baseLayer := core.NewBlobFixture()
+	var baseManifestRaw, manifestRaw []byte
+	f.baseManifest, baseManifestRaw = dockerutil.ManifestFixture(
+		baseConfig.Digest, baseLayer.Digest, f.shared.Digest)
+	f.manifest, manifestRaw = dockerutil.ManifestFixture(
+		f.config.Digest, f.shared.Digest, f.layer.Digest)
+
+	for d, content := range map[core.Digest][]byte{
+		f.baseManifest:    baseManifestRaw,
+		baseConfig.Digest: baseConfig.Content,
+		baseLayer.Digest:  baseLayer.Content,
+		f.shared.Digest:   f.shared.Content,
+		f.manifest:        manifestRaw,
+		f.config.Digest:   f.config.Content,
+	} {
+		require.NoError(t, store.RunDownload(mocks.cads, d, content))
+	}
+
+	mocks.tags.EXPECT().Get(f.tag).Return(f.manifest, nil)
+	mocks.tags.EXPECT().Get(f.base).Return(f.baseManifest, nil)
+
+	return f
+}
+
+func TestGetImageDiffHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	f := newImageDiffFixture(t, mocks)
+
+	_, addr := mocks.startServer(Config{})
+
+	diff, err := getImageDiff(addr, f.tag, "base="+url.QueryEscape(f.base))
+	require.NoError(err)
+
+	// Sizes are taken from the manifest fixture.
+	require.Equal(&ImageDiff{
+		Digest:     f.manifest,
+		BaseDigest: f.baseManifest,
+		Blobs: []ImageDiffBlob{
+			{Digest: f.config.Digest, Size: 2940, Cached: true},
+			{Digest: f.layer.Digest, Size: 2345077, Cached: false},
+		},
+		Bytes:        2940 + 2345077,
+		MissingBytes: 2345077,
+	}, diff)
+}
+
+func TestGetImageDiffHandlerPrefetch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	f := newImageDiffFixture(t, mocks)
+
+	done := make(chan struct{})
+	mocks.sched.EXPECT().Download(f.repo, f.layer.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) error {
+			defer close(done)
+			return store.RunDownload(mocks.cads, d, f.layer.Content)
+		})
+
+	_, addr := mocks.startServer(Config{})
+
+	diff, err := getImageDiff(addr, f.tag, "prefetch=true&base="+url.QueryEscape(f.base))
+	require.NoError(err)
+	require.True(diff.Prefetching)
+
+	<-done
+}
+
+func TestGetImageDiffHandlerMissingBase(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := getImageDiff(addr, "uber/kraken:v2", "")
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+const (
+	_ociLayoutVersion = "1.0.0"
+	_ociIndexRefName  = "org.opencontainers.image.ref.name"
+
+	// Annotation used by containerd to name imported images.
+	_containerdImageName = "io.containerd.image.name"
+)
+
+type ociLayout struct {
+	ImageLayoutVersion string `json:"imageLayoutVersion"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// exportOCILayoutHandler streams the manifest, config and layers of a tag as
+// an OCI image layout tarball. Blobs missing from the local cache are
+// downloaded before the tarball is written, so that download errors are
+// reported with a status code rather than a truncated tarball.
+func (s *Server) exportOCILayoutHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(tag, ":")
+	if len(parts) != 2 {
+		return handler.Errorf("failed to parse docker image tag").Status(http.StatusBadRequest)
+	}
+	repo, version := parts[0], parts[1]
+	namespace := httputil.GetQueryArg(r, "namespace", repo)
+
+	d, err := s.tags.Get(tag)
+	if err != nil {
+		if err == tagclient.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("get tag: %s", err)
+	}
+	mediaType, blobs, err := s.resolveImageBlobs(namespace, d)
+	if err != nil {
+		return err
+	}
+	if err := s.downloadBlobs(namespace, digests(blobs)); err != nil {
+		return err
+	}
+	manifest, err := s.cads.Cache().GetFileStat(d.Name())
+	if err != nil {
+		return handler.Errorf("stat manifest: %s", err)
+	}
+	index := ociIndex{
+		SchemaVersion: 2,
+		Manifests: []ociDescriptor{{
+			MediaType: mediaType,
+			Digest:    d.String(),
+			Size:      manifest.Size(),
+			Annotations: map[string]string{
+				_ociIndexRefName:     version,
+				_containerdImageName: tag,
+			},
+		}},
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	tw := tar.NewWriter(w)
+	if err := writeTarJSON(tw, "oci-layout", ociLayout{_ociLayoutVersion}); err != nil {
+		return err
+	}
+	if err := writeTarJSON(tw, "index.json", index); err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		if err := s.writeTarBlob(tw, blob.digest); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tar: %s", err)
+	}
+	s.stats.Counter("oci_layout_exports").Inc(1)
+	return nil
+}
+
+// imageBlob is a blob of an image, as referenced by its manifest.
+type imageBlob struct {
+	digest   core.Digest
+	size     int64
+	manifest bool
+}
+
+func digests(blobs []imageBlob) []core.Digest {
+	ds := make([]core.Digest, len(blobs))
+	for i, blob := range blobs {
+		ds[i] = blob.digest
+	}
+	return ds
+}
+
+// resolveImageBlobs returns the media type of manifest d, and d and all blobs
+// it references. Manifests referenced by manifest lists are resolved
+// recursively.
+func (s *Server) resolveImageBlobs(
+	namespace string, d core.Digest) (mediaType string, blobs []imageBlob, err error) {
+
+	f, err := s.getBlob(namespace, d)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	manifest, _, err := dockerutil.ParseManifest(f)
+	if err != nil {
+		return "", nil, handler.Errorf("parse manifest %s: %s", d, err).Status(http.StatusBadRequest)
+	}
+	mediaType, _, err = manifest.Payload()
+	if err != nil {
+		return "", nil, handler.Errorf("manifest payload: %s", err)
+	}
+	seen := map[core.Digest]bool{d: true}
+	blobs = []imageBlob{{d, f.Size(), true}}
+	for _, desc := range manifest.References() {
+		ref, err := core.ParseSHA256Digest(string(desc.Digest))
+		if err != nil {
+			return "", nil, handler.Errorf("parse reference: %s", err).Status(http.StatusBadRequest)
+		}
+		refs := []imageBlob{{ref, desc.Size, false}}
+		if desc.MediaType == schema2.MediaTypeManifest ||
+			desc.MediaType == manifestlist.MediaTypeManifestList {
+			_, refs, err = s.resolveImageBlobs(namespace, ref)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		for _, ref := range refs {
+			if !seen[ref.digest] {
+				seen[ref.digest] = true
+				blobs = append(blobs, ref)
+			}
+		}
+	}
+	return mediaType, blobs, nil
+}
+
+// downloadBlobs concurrently ensures all of blobs are in the local cache.
+func (s *Server) downloadBlobs(namespace string, blobs []core.Digest) error {
+	var mu sync.Mutex
+	var errs []error
+
+	var wg sync.WaitGroup
+	for _, d := range blobs {
+		wg.Add(1)
+		go func(d core.Digest) {
+			defer wg.Done()
+			f, err := s.getBlob(namespace, d)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				return
+			}
+			f.Close()
+		}(d)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		// Report the status of the first failure, e.g. 404 for missing layers.
+		if herr, ok := errs[0].(*handler.Error); ok {
+			return handler.Errorf("download blobs: %s", errutil.Join(errs)).Status(herr.GetStatus())
+		}
+		return handler.Errorf("download blobs: %s", errutil.Join(errs))
+	}
+	return nil
+}
+
+func (s *Server) writeTarBlob(tw *tar.Writer, d core.Digest) error {
+	f, err := s.cads.Cache().GetFileReader(d.Name())
+	if err != nil {
+		return fmt.Errorf("get cache file %s: %s", d, err)
+	}
+	defer f.Close()
+	hdr := &tar.Header{
+		Name:    "blobs/" + d.Algo() + "/" + d.Hex(),
+		Mode:    0644,
+		Size:    f.Size(),
+		ModTime: time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write tar header: %s", err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("copy blob %s: %s", d, err)
+	}
+	return nil
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return handler.Errorf("json marshal %s: %s", name, err)
+	}
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(b)),
+		ModTime: time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write tar header: %s", err)
+	}
+	if _, err := tw.Write(b); err != nil {
+		return fmt.Errorf("write %s: %s", name, err)
+	}
+	return nil
+}
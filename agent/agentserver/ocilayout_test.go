@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func readTar(t *testing.T, r io.Reader) map[string][]byte {
+	files := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = b
+	}
+}
+
+func TestExportOCILayoutHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	repo := "uber/kraken"
+	tag := repo + ":v1"
+
+	config := core.NewBlobFixture()
+	layer1 := core.NewBlobFixture()
+	layer2 := core.NewBlobFixture()
+	manifest, manifestRaw := dockerutil.ManifestFixture(config.Digest, layer1.Digest, layer2.Digest)
+
+	// The config is already cached, all other blobs are downloaded.
+	require.NoError(store.RunDownload(mocks.cads, config.Digest, config.Content))
+
+	mocks.tags.EXPECT().Get(tag).Return(manifest, nil)
+	contents := map[core.Digest][]byte{
+		manifest:      manifestRaw,
+		layer1.Digest: layer1.Content,
+		layer2.Digest: layer2.Content,
+		config.Digest: config.Content,
+	}
+	for _, d := range []core.Digest{manifest, layer1.Digest, layer2.Digest} {
+		mocks.sched.EXPECT().Download(repo, d).DoAndReturn(
+			func(namespace string, d core.Digest) error {
+				return store.RunDownload(mocks.cads, d, contents[d])
+			})
+	}
+
+	_, addr := mocks.startServer(Config{})
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/x/images/%s/oci-layout", addr, url.PathEscape(tag)))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	files := readTar(t, resp.Body)
+	require.Len(files, 2+len(contents))
+	require.JSONEq(`{"imageLayoutVersion": "1.0.0"}`, string(files["oci-layout"]))
+
+	var index ociIndex
+	require.NoError(json.Unmarshal(files["index.json"], &index))
+	require.Equal([]ociDescriptor{{
+		MediaType: "application/vnd.docker.distribution.manifest.v2+json",
+		Digest:    manifest.String(),
+		Size:      int64(len(manifestRaw)),
+		Annotations: map[string]string{
+			"org.opencontainers.image.ref.name": "v1",
+			"io.containerd.image.name":          tag,
+		},
+	}}, index.Manifests)
+
+	for d, content := range contents {
+		require.Equal(content, files["blobs/sha256/"+d.Hex()])
+	}
+}
+
+func TestExportOCILayoutHandlerMissingLayer(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	repo := "uber/kraken"
+	tag := repo + ":v1"
+
+	config := core.NewBlobFixture()
+	layer1 := core.NewBlobFixture()
+	layer2 := core.NewBlobFixture()
+	manifest, manifestRaw := dockerutil.ManifestFixture(config.Digest, layer1.Digest, layer2.Digest)
+
+	require.NoError(store.RunDownload(mocks.cads, manifest, manifestRaw))
+	require.NoError(store.RunDownload(mocks.cads, config.Digest, config.Content))
+	require.NoError(store.RunDownload(mocks.cads, layer1.Digest, layer1.Content))
+
+	mocks.tags.EXPECT().Get(tag).Return(manifest, nil)
+	mocks.sched.EXPECT().Download(repo, layer2.Digest).Return(scheduler.ErrTorrentNotFound)
+	mocks.sched.EXPECT().Download(gomock.Any(), gomock.Any()).Times(0)
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/x/images/%s/oci-layout", addr, url.PathEscape(tag)))
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestExportOCILayoutHandlerInvalidTag(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/x/images/notag/oci-layout", addr))
+	require.True(t, httputil.IsStatus(err, 400))
+}
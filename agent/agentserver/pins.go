@@ -0,0 +1,93 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// pinBlobHandler protects a cached blob from eviction. If the blob is not
+// cached and the `namespace` query arg is set, it is downloaded first.
+func (s *Server) pinBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	namespace := httputil.GetQueryArg(r, "namespace", "")
+
+	err = s.cads.PinCacheFile(d.Name())
+	if os.IsNotExist(err) || s.cads.InDownloadError(err) {
+		if namespace == "" {
+			return handler.Errorf(
+				"blob not cached, set namespace to download it").Status(http.StatusNotFound)
+		}
+		if err := s.sched.Download(namespace, d); err != nil {
+			if err == scheduler.ErrTorrentNotFound {
+				return handler.ErrorStatus(http.StatusNotFound)
+			}
+			return handler.Errorf("download torrent: %s", err)
+		}
+		err = s.cads.PinCacheFile(d.Name())
+	}
+	if err != nil {
+		return handler.Errorf("pin: %s", err)
+	}
+	log.With("digest", d, "remote_addr", r.RemoteAddr).Info("Pinned blob")
+	return nil
+}
+
+// unpinBlobHandler allows a pinned blob to be evicted again.
+func (s *Server) unpinBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	if err := s.cads.UnpinCacheFile(d.Name()); err != nil {
+		if os.IsNotExist(err) || s.cads.InDownloadError(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("unpin: %s", err)
+	}
+	log.With("digest", d, "remote_addr", r.RemoteAddr).Info("Unpinned blob")
+	return nil
+}
+
+// listPinsHandler returns a JSON list of the digests of all pinned blobs.
+func (s *Server) listPinsHandler(w http.ResponseWriter, r *http.Request) error {
+	names, err := s.cads.ListPinnedCacheFiles()
+	if err != nil {
+		return handler.Errorf("list pins: %s", err)
+	}
+	digests := []core.Digest{}
+	for _, name := range names {
+		d, err := core.NewDigestFromName(name)
+		if err != nil {
+			log.With("name", name).Errorf("Error parsing pinned blob name: %s", err)
+			continue
+		}
+		digests = append(digests, d)
+	}
+	if err := json.NewEncoder(w).Encode(digests); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/lease"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func listPins(t *testing.T, addr string) []core.Digest {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/pins", addr))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var digests []core.Digest
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&digests))
+	return digests
+}
+
+func TestPinCachedBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(store.RunDownload(mocks.cads, blob.Digest, blob.Content))
+
+	_, addr := mocks.startServer(Config{})
+
+	require.Empty(listPins(t, addr))
+
+	_, err := httputil.Post(fmt.Sprintf("http://%s/pins/%s", addr, blob.Digest))
+	require.NoError(err)
+
+	require.Equal([]core.Digest{blob.Digest}, listPins(t, addr))
+
+	// Pinned blobs cannot be deleted.
+	require.Error(mocks.cads.Cache().DeleteFile(blob.Digest.Name()))
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/pins/%s", addr, blob.Digest))
+	require.NoError(err)
+
+	require.Empty(listPins(t, addr))
+	require.NoError(mocks.cads.Cache().DeleteFile(blob.Digest.Name()))
+}
+
+func TestPinDownloadsBlobWithNamespace(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().Download(namespace, blob.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) error {
+			return store.RunDownload(mocks.cads, d, blob.Content)
+		})
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Post(fmt.Sprintf(
+		"http://%s/pins/%s?namespace=%s", addr, blob.Digest, url.QueryEscape(namespace)))
+	require.NoError(err)
+
+	require.Equal([]core.Digest{blob.Digest}, listPins(t, addr))
+}
+
+func TestPinNotFound(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	d := core.DigestFixture()
+
+	mocks.sched.EXPECT().Download(namespace, d).Return(scheduler.ErrTorrentNotFound)
+
+	_, addr := mocks.startServer(Config{})
+
+	for _, u := range []string{
+		fmt.Sprintf("http://%s/pins/%s", addr, d),
+		fmt.Sprintf("http://%s/pins/%s?namespace=%s", addr, d, url.QueryEscape(namespace)),
+	} {
+		_, err := httputil.Post(u)
+		require.True(t, httputil.IsStatus(err, http.StatusNotFound))
+	}
+
+	_, err := httputil.Delete(fmt.Sprintf("http://%s/pins/%s", addr, d))
+	require.True(t, httputil.IsStatus(err, http.StatusNotFound))
+}
+
+func TestLeaseDownloadsAndProtectsBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := core.TagFixture()
+	blob := core.NewBlobFixture()
+
+	mocks.sched.EXPECT().Download(namespace, blob.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) error {
+			return store.RunDownload(mocks.cads, d, blob.Content)
+		})
+
+	leases, err := lease.NewManager(lease.Config{}, tally.NoopScope, mocks.cads, mocks.sched.Download)
+	require.NoError(err)
+	defer leases.Close()
+
+	_, addr := mocks.startServer(Config{}, WithLeases(leases))
+
+	b, err := json.Marshal(lease.Request{
+		Namespace: namespace,
+		Digests:   []core.Digest{blob.Digest},
+		Deadline:  time.Now().Add(time.Hour),
+	})
+	require.NoError(err)
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/leases", addr),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var l lease.Lease
+	require.NoError(json.NewDecoder(resp.Body).Decode(&l))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		l, err := leases.Get(l.ID)
+		return err == nil && l.Digests[0].State == lease.StateAvailable
+	}))
+
+	// Leased blobs cannot be deleted.
+	require.Error(mocks.cads.Cache().DeleteFile(blob.Digest.Name()))
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/leases/%s", addr, l.ID))
+	require.NoError(err)
+
+	require.NoError(mocks.cads.Cache().DeleteFile(blob.Digest.Name()))
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// publishBlobHandler stores a blob produced on this agent and publishes its
+// metainfo to trackers, such that other agents download the blob from this
+// agent through p2p without it ever reaching origins. Trackers only accept
+// blobs of agent-only namespaces.
+func (s *Server) publishBlobHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := parseDigest(r)
+	if err != nil {
+		return err
+	}
+	if r.ContentLength < 0 {
+		return handler.Errorf("content length required").Status(http.StatusLengthRequired)
+	}
+	if err := s.writeBlob(d, r.Body, r.ContentLength); err != nil {
+		return err
+	}
+	mi, err := s.getOrGenerateMetaInfo(d)
+	if err != nil {
+		return handler.Errorf("generate metainfo: %s", err)
+	}
+	if err := s.mic.Publish(namespace, mi); err != nil {
+		if httputil.IsForbidden(err) {
+			return handler.Errorf(
+				"namespace %s is not agent-only", namespace).Status(http.StatusForbidden)
+		}
+		return handler.Errorf("publish metainfo: %s", err)
+	}
+	// The torrent is complete, so this returns once it is added to the
+	// scheduler, which then announces it as seeding.
+	if err := s.sched.Download(namespace, d); err != nil {
+		return handler.Errorf("seed torrent: %s", err)
+	}
+	return nil
+}
+
+// writeBlob writes length bytes of blob d from r into the cache, unless d is
+// already cached.
+func (s *Server) writeBlob(d core.Digest, r io.Reader, length int64) error {
+	if err := s.cads.CreateDownloadFile(d.Name(), length); err != nil {
+		if s.cads.InCacheError(err) {
+			return nil
+		}
+		if s.cads.InDownloadError(err) {
+			return handler.Errorf("blob is being downloaded").Status(http.StatusConflict)
+		}
+		return handler.Errorf("create download file: %s", err)
+	}
+	if err := s.copyToDownloadFile(d, r, length); err != nil {
+		s.cads.Download().DeleteFile(d.Name())
+		return err
+	}
+	if err := s.cads.MoveDownloadFileToCache(d.Name()); err != nil {
+		if os.IsExist(err) {
+			return nil
+		}
+		s.cads.Download().DeleteFile(d.Name())
+		if store.IsDigestMismatch(err) {
+			return handler.Errorf("verify blob: %s", err).Status(http.StatusBadRequest)
+		}
+		return handler.Errorf("move download file to cache: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) copyToDownloadFile(d core.Digest, r io.Reader, length int64) error {
+	f, err := s.cads.GetDownloadFileReadWriter(d.Name())
+	if err != nil {
+		return handler.Errorf("get download file: %s", err)
+	}
+	defer f.Close()
+	n, err := io.Copy(f, io.LimitReader(r, length))
+	if err != nil {
+		return handler.Errorf("copy blob: %s", err)
+	}
+	if n != length {
+		return handler.Errorf(
+			"blob is %d bytes, expected %d", n, length).Status(http.StatusBadRequest)
+	}
+	return nil
+}
+
+// getOrGenerateMetaInfo returns the metainfo of cached blob d, generating it
+// with the configured piece length if d has none yet.
+func (s *Server) getOrGenerateMetaInfo(d core.Digest) (*core.MetaInfo, error) {
+	var tm metadata.TorrentMeta
+	if err := s.cads.Cache().GetMetadata(d.Name(), &tm); err == nil {
+		return tm.MetaInfo, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("get metainfo: %s", err)
+	}
+	f, err := s.cads.Cache().GetFileReader(d.Name())
+	if err != nil {
+		return nil, fmt.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+	mi, err := core.NewMetaInfo(d, f, int64(s.config.PublishPieceLength))
+	if err != nil {
+		return nil, fmt.Errorf("new metainfo: %s", err)
+	}
+	tm.MetaInfo = mi
+	// Keeps the metainfo of a concurrent publish or download, if any.
+	if err := s.cads.Cache().GetOrSetMetadata(d.Name(), &tm); err != nil {
+		return nil, fmt.Errorf("get or set metainfo: %s", err)
+	}
+	return tm.MetaInfo, nil
+}
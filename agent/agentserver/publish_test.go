@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentserver
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func publish(addr, namespace string, d core.Digest, content []byte) error {
+	_, err := httputil.Put(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", addr, url.PathEscape(namespace), d),
+		httputil.SendBody(bytes.NewReader(content)))
+	return err
+}
+
+func TestPublishBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := "scratch/cache"
+	blob := core.SizedBlobFixture(64, 16)
+
+	mocks.mic.EXPECT().Publish(namespace, gomock.Any()).DoAndReturn(
+		func(namespace string, mi *core.MetaInfo) error {
+			require.Equal(blob.Digest, mi.Digest())
+			require.Equal(int64(16), mi.PieceLength())
+			require.Equal(int64(len(blob.Content)), mi.Length())
+			return nil
+		})
+	mocks.sched.EXPECT().Download(namespace, blob.Digest).Return(nil)
+
+	_, addr := mocks.startServer(Config{PublishPieceLength: 16 * datasize.B})
+
+	require.NoError(publish(addr, namespace, blob.Digest, blob.Content))
+
+	f, err := mocks.cads.Cache().GetFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+
+	var tm metadata.TorrentMeta
+	require.NoError(mocks.cads.Cache().GetMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.Digest, tm.MetaInfo.Digest())
+}
+
+func TestPublishBlobAlreadyCachedKeepsMetaInfo(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	namespace := "scratch/cache"
+	blob := core.SizedBlobFixture(64, 32)
+
+	require.NoError(mocks.cads.CreateDownloadFile(blob.Digest.Hex(), int64(len(blob.Content))))
+	w, err := mocks.cads.GetDownloadFileReadWriter(blob.Digest.Hex())
+	require.NoError(err)
+	_, err = w.Write(blob.Content)
+	require.NoError(err)
+	w.Close()
+	require.NoError(mocks.cads.MoveDownloadFileToCache(blob.Digest.Hex()))
+	_, err = mocks.cads.Cache().SetMetadata(
+		blob.Digest.Hex(), metadata.NewTorrentMeta(blob.MetaInfo))
+	require.NoError(err)
+
+	mocks.mic.EXPECT().Publish(namespace, blob.MetaInfo).Return(nil)
+	mocks.sched.EXPECT().Download(namespace, blob.Digest).Return(nil)
+
+	_, addr := mocks.startServer(Config{})
+
+	require.NoError(publish(addr, namespace, blob.Digest, blob.Content))
+}
+
+func TestPublishBlobDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	_, addr := mocks.startServer(Config{})
+
+	err := publish(addr, "scratch/cache", blob.Digest, []byte("some other content"))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	_, err = mocks.cads.Any().GetFileStat(blob.Digest.Hex())
+	require.Error(err)
+}
+
+func TestPublishBlobNamespaceNotAgentOnly(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	mocks.mic.EXPECT().Publish("repo", gomock.Any()).Return(
+		httputil.StatusError{Status: http.StatusForbidden})
+
+	_, addr := mocks.startServer(Config{})
+
+	err := publish(addr, "repo", blob.Digest, blob.Content)
+	require.True(httputil.IsForbidden(err))
+}
@@ -19,7 +19,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
 	"os"
 	"strings"
 	"sync"
@@ -27,14 +26,22 @@ import (
 
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/buildinfo"
 	"github.com/uber/kraken/lib/containerruntime"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/lease"
 	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/lib/pullstats"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/go-chi/chi"
 	"github.com/uber-go/tally"
 )
@@ -43,6 +50,20 @@ import (
 type Config struct {
 	// How long a successful readiness check is valid for. If 0, disable caching successful readiness.
 	readinessCacheTTL time.Duration `yaml:"readiness_cache_ttl"`
+
+	// PublishPieceLength is the piece length of blobs published by this agent
+	// for agent-only namespaces.
+	PublishPieceLength datasize.ByteSize `yaml:"publish_piece_length"`
+
+	// Authz restricts endpoints, e.g. /x/config/flags/, to client identities.
+	Authz middleware.AuthzConfig `yaml:"authz"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.PublishPieceLength == 0 {
+		c.PublishPieceLength = 4 * datasize.MB
+	}
+	return c
 }
 
 // Server defines the agent HTTP server.
@@ -53,10 +74,21 @@ type Server struct {
 	sched            scheduler.ReloadableScheduler
 	tags             tagclient.Client
 	ac               announceclient.Client
+	mic              metainfoclient.Client
 	containerRuntime containerruntime.Factory
+	pulls            *pullstats.Recorder
+	leases           *lease.Manager
 	lastReady        time.Time
 }
 
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithLeases exposes m under /leases.
+func WithLeases(m *lease.Manager) Option {
+	return func(s *Server) { s.leases = m }
+}
+
 // New creates a new Server.
 func New(
 	config Config,
@@ -65,21 +97,32 @@ func New(
 	sched scheduler.ReloadableScheduler,
 	tags tagclient.Client,
 	ac announceclient.Client,
-	containerRuntime containerruntime.Factory) *Server {
+	mic metainfoclient.Client,
+	containerRuntime containerruntime.Factory,
+	pulls *pullstats.Recorder,
+	opts ...Option) *Server {
+
+	config = config.applyDefaults()
 
 	stats = stats.Tagged(map[string]string{
 		"module": "agentserver",
 	})
 
-	return &Server{
+	s := &Server{
 		config:           config,
 		stats:            stats,
 		cads:             cads,
 		sched:            sched,
 		tags:             tags,
 		ac:               ac,
+		mic:              mic,
 		containerRuntime: containerRuntime,
+		pulls:            pulls,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Handler returns the HTTP handler.
@@ -88,16 +131,30 @@ func (s *Server) Handler() http.Handler {
 
 	r.Use(middleware.StatusCounter(s.stats))
 	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Recovery(s.stats))
+	// Flag overrides are restricted to identities allowed by authz rules.
+	r.Use(middleware.Authorize(s.config.Authz, s.stats, "/x/config/flags/"))
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
 	r.Get("/readiness", handler.Wrap(s.readinessCheckHandler))
+	r.Get("/version", buildinfo.Handler(buildinfo.Agent))
 
 	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
 
 	r.Get("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
+	r.Put("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.publishBlobHandler))
 
 	r.Delete("/blobs/{digest}", handler.Wrap(s.deleteBlobHandler))
 
+	r.Get("/pins", handler.Wrap(s.listPinsHandler))
+	r.Post("/pins/{digest}", handler.Wrap(s.pinBlobHandler))
+	r.Delete("/pins/{digest}", handler.Wrap(s.unpinBlobHandler))
+
+	if s.leases != nil {
+		r.Mount("/leases", s.leases.Handler())
+	}
+
 	// Preheat/preload endpoints.
 	r.Get("/preload/tags/{tag}", handler.Wrap(s.preloadTagHandler))
 
@@ -105,9 +162,15 @@ func (s *Server) Handler() http.Handler {
 	r.Patch("/x/config/scheduler", handler.Wrap(s.patchSchedulerConfigHandler))
 
 	r.Get("/x/blacklist", handler.Wrap(s.getBlacklistHandler))
+	r.Delete("/x/blacklist/{infohash}/{peerid}", handler.Wrap(s.deleteBlacklistHandler))
 
-	// Serves /debug/pprof endpoints.
-	r.Mount("/", http.DefaultServeMux)
+	r.Get("/x/pulls/recent", handler.Wrap(s.getRecentPullsHandler))
+
+	r.Get("/x/images/{tag}/oci-layout", handler.Wrap(s.exportOCILayoutHandler))
+	r.Get("/x/images/{tag}/diff", handler.Wrap(s.getImageDiffHandler))
+
+	r.Mount("/x/config/flags", featureflag.Handler())
+	r.Mount("/x/config/tracing", tracing.Handler())
 
 	return r
 }
@@ -139,27 +202,41 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return err
 	}
-	f, err := s.cads.Cache().GetFileReader(d.Hex())
+	f, err := s.getBlob(namespace, d)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("copy file: %s", err)
+	}
+	return nil
+}
+
+// getBlob returns a reader of blob d from the local cache, downloading it
+// through p2p if it is not cached.
+func (s *Server) getBlob(namespace string, d core.Digest) (store.FileReader, error) {
+	f, err := s.cads.Cache().GetFileReader(d.Name())
 	if err != nil {
 		if os.IsNotExist(err) || s.cads.InDownloadError(err) {
+			s.cads.RecordCacheAccess(d.Name(), false)
 			if err := s.sched.Download(namespace, d); err != nil {
 				if err == scheduler.ErrTorrentNotFound {
-					return handler.ErrorStatus(http.StatusNotFound)
+					return nil, handler.ErrorStatus(http.StatusNotFound)
 				}
-				return handler.Errorf("download torrent: %s", err)
+				return nil, handler.Errorf("download torrent: %s", err)
 			}
-			f, err = s.cads.Cache().GetFileReader(d.Hex())
+			f, err = s.cads.Cache().GetFileReader(d.Name())
 			if err != nil {
-				return handler.Errorf("store: %s", err)
+				return nil, handler.Errorf("store: %s", err)
 			}
 		} else {
-			return handler.Errorf("store: %s", err)
+			return nil, handler.Errorf("store: %s", err)
 		}
+	} else {
+		s.cads.RecordCacheAccess(d.Name(), true)
 	}
-	if _, err := io.Copy(w, f); err != nil {
-		return fmt.Errorf("copy file: %s", err)
-	}
-	return nil
+	return f, nil
 }
 
 func (s *Server) deleteBlobHandler(w http.ResponseWriter, r *http.Request) error {
@@ -278,6 +355,42 @@ func (s *Server) getBlacklistHandler(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+// getRecentPullsHandler returns the phase timings of recent image pulls.
+func (s *Server) getRecentPullsHandler(w http.ResponseWriter, r *http.Request) error {
+	pulls := s.pulls.Recent()
+	if err := json.NewEncoder(w).Encode(&pulls); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// deleteBlacklistHandler manually unblacklists a connection.
+func (s *Server) deleteBlacklistHandler(w http.ResponseWriter, r *http.Request) error {
+	rawHash, err := httputil.ParseParam(r, "infohash")
+	if err != nil {
+		return err
+	}
+	h, err := core.NewInfoHashFromHex(rawHash)
+	if err != nil {
+		return handler.Errorf("parse infohash: %s", err).Status(http.StatusBadRequest)
+	}
+	rawPeerID, err := httputil.ParseParam(r, "peerid")
+	if err != nil {
+		return err
+	}
+	peerID, err := core.NewPeerID(rawPeerID)
+	if err != nil {
+		return handler.Errorf("parse peer id: %s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.sched.Unblacklist(peerID, h); err != nil {
+		if err == connstate.ErrNotBlacklisted {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("unblacklist: %s", err)
+	}
+	return nil
+}
+
 func parseDigest(r *http.Request) (core.Digest, error) {
 	raw, err := httputil.ParseParam(r, "digest")
 	if err != nil {
@@ -286,7 +399,7 @@ func parseDigest(r *http.Request) (core.Digest, error) {
 	// TODO(codyg): Accept only a fully formed digest.
 	d, err := core.NewSHA256DigestFromHex(raw)
 	if err != nil {
-		d, err = core.ParseSHA256Digest(raw)
+		d, err = core.ParseDigest(raw)
 		if err != nil {
 			return core.Digest{}, handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
 		}
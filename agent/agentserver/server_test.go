@@ -28,6 +28,7 @@ import (
 	"github.com/uber/kraken/agent/agentclient"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/pullstats"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
@@ -37,9 +38,11 @@ import (
 	mockdockerdaemon "github.com/uber/kraken/mocks/lib/containerruntime/dockerdaemon"
 	mockscheduler "github.com/uber/kraken/mocks/lib/torrent/scheduler"
 	mockannounceclient "github.com/uber/kraken/mocks/tracker/announceclient"
+	mockmetainfoclient "github.com/uber/kraken/mocks/tracker/metainfoclient"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
@@ -52,7 +55,9 @@ type serverMocks struct {
 	dockerCli        *mockdockerdaemon.MockDockerClient
 	containerdCli    *mockcontainerd.MockClient
 	ac               *mockannounceclient.MockClient
+	mic              *mockmetainfoclient.MockClient
 	containerRuntime *mockcontainerruntime.MockFactory
+	pulls            *pullstats.Recorder
 	cleanup          *testutil.Cleanup
 }
 
@@ -72,14 +77,18 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 	dockerCli := mockdockerdaemon.NewMockDockerClient(ctrl)
 	containerdCli := mockcontainerd.NewMockClient(ctrl)
 	ac := mockannounceclient.NewMockClient(ctrl)
+	mic := mockmetainfoclient.NewMockClient(ctrl)
 	containerruntime := mockcontainerruntime.NewMockFactory(ctrl)
+	pulls := pullstats.New(pullstats.Config{}, tally.NoopScope, clock.NewMock())
 	return &serverMocks{
-		cads, sched, tags, dockerCli, containerdCli, ac,
-		containerruntime, &cleanup}, cleanup.Run
+		cads, sched, tags, dockerCli, containerdCli, ac, mic,
+		containerruntime, pulls, &cleanup}, cleanup.Run
 }
 
-func (m *serverMocks) startServer(c Config) (*Server, string) {
-	s := New(c, tally.NoopScope, m.cads, m.sched, m.tags, m.ac, m.containerRuntime)
+func (m *serverMocks) startServer(c Config, opts ...Option) (*Server, string) {
+	s := New(
+		c, tally.NoopScope, m.cads, m.sched, m.tags, m.ac, m.mic, m.containerRuntime, m.pulls,
+		opts...)
 	addr, stop := testutil.StartServer(s.Handler())
 	m.cleanup.Add(stop)
 	return s, addr
@@ -401,6 +410,24 @@ func TestPatchSchedulerConfigHandler(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestFlagOverridesRequireAuthorization(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/x/config/flags", addr))
+	require.NoError(err)
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s/x/config/flags/some_flag?enabled=true", addr))
+	require.True(httputil.IsForbidden(err))
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/x/config/flags/some_flag", addr))
+	require.True(httputil.IsForbidden(err))
+}
+
 func TestGetBlacklistHandler(t *testing.T) {
 	require := require.New(t)
 
@@ -424,6 +451,68 @@ func TestGetBlacklistHandler(t *testing.T) {
 	require.Equal(blacklist, result)
 }
 
+func TestGetRecentPullsHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.pulls.RecordTag("repo:tag", time.Second, nil)
+	mocks.pulls.RecordBlob("repo", map[pullstats.Phase]time.Duration{
+		pullstats.PhaseP2PDownload: 2 * time.Second,
+	}, nil)
+
+	_, addr := mocks.startServer(Config{})
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/pulls/recent", addr))
+	require.NoError(err)
+
+	var result []pullstats.Pull
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(result, 1)
+	require.Equal("repo", result[0].Repo)
+	require.Equal("tag", result[0].Tag)
+	require.Equal(1, result[0].Blobs)
+	require.Equal(map[pullstats.Phase]time.Duration{
+		pullstats.PhaseTagResolution: time.Second,
+		pullstats.PhaseP2PDownload:   2 * time.Second,
+	}, result[0].Phases)
+}
+
+func TestDeleteBlacklistHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	peerID := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	mocks.sched.EXPECT().Unblacklist(peerID, h).Return(nil)
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Delete(fmt.Sprintf("http://%s/x/blacklist/%s/%s", addr, h, peerID))
+	require.NoError(err)
+}
+
+func TestDeleteBlacklistHandlerNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	peerID := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	mocks.sched.EXPECT().Unblacklist(peerID, h).Return(connstate.ErrNotBlacklisted)
+
+	_, addr := mocks.startServer(Config{})
+
+	_, err := httputil.Delete(fmt.Sprintf("http://%s/x/blacklist/%s/%s", addr, h, peerID))
+	require.True(httputil.IsNotFound(err))
+}
+
 func TestDeleteBlobHandler(t *testing.T) {
 	require := require.New(t)
 
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//	http://www.apache.org/licenses/LICENSE-2.0
+//     http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -14,27 +14,46 @@
 package cmd
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
+	"syscall"
 	"time"
 
 	"github.com/uber/kraken/agent/agentserver"
+	"github.com/uber/kraken/agent/inventory"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/containerruntime"
 	"github.com/uber/kraken/lib/containerruntime/dockerdaemon"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/encryption"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/lease"
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/lib/nat"
+	"github.com/uber/kraken/lib/pullstats"
+	"github.com/uber/kraken/lib/remoteconfig"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/netutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
@@ -49,6 +68,7 @@ type Flags struct {
 	Zone              string
 	KrakenCluster     string
 	SecretsFile       string
+	ConfigOverlayFile string
 }
 
 // ParseFlags parses agent CLI flags.
@@ -70,6 +90,9 @@ func ParseFlags() *Flags {
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
 		&flags.SecretsFile, "secrets", "", "path to a secrets YAML file to load into configuration")
+	flag.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file, e.g. with per-cluster settings, to merge on top of configuration")
 	flag.Parse()
 	return &flags
 }
@@ -120,11 +143,16 @@ func Run(flags *Flags, opts ...Option) {
 	if overrides.config != nil {
 		config = *overrides.config
 	} else {
-		if err := configutil.Load(flags.ConfigFile, &config); err != nil {
+		if err := configutil.Load(
+			flags.ConfigFile, &config,
+			configutil.WithOverlay(flags.ConfigOverlayFile),
+			configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 			panic(err)
 		}
 		if flags.SecretsFile != "" {
-			if err := configutil.Load(flags.SecretsFile, &config); err != nil {
+			if err := configutil.Load(
+				flags.SecretsFile, &config,
+				configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 				panic(err)
 			}
 		}
@@ -138,17 +166,43 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var closer io.Closer
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		var err error
+		stats, closer, err = metrics.New(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
-		stats = s
-		defer closer.Close()
 	}
+	flusher := metrics.NewFlusher(stats, closer)
+	defer flusher.Flush(metrics.ShutdownExit)
+	flusher.FlushOnSignals(syscall.SIGTERM, syscall.SIGINT)
 
 	go metrics.EmitVersion(stats)
 
+	debugServer, err := debugserver.New(config.Debug, stats)
+	if err != nil {
+		log.Fatalf("Failed to init debug server: %s", err)
+	}
+	go debugServer.EmitWatermarks()
+	if config.Debug.Addr != "" {
+		go func() { flusher.Fatal(debugServer.ListenAndServe()) }()
+	}
+
+	tracingCloser, err := tracing.Init(config.Tracing, "kraken-agent")
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %s", err)
+	}
+	defer tracingCloser.Close()
+
+	if err := middleware.InitRecovery(config.Recovery, "kraken-agent"); err != nil {
+		log.Fatalf("Failed to init recovery: %s", err)
+	}
+
+	if err := featureflag.Init(config.FeatureFlags, "kraken-agent"); err != nil {
+		log.Fatalf("Failed to init feature flags: %s", err)
+	}
+
 	if flags.PeerIP == "" {
 		localIP, err := netutil.GetLocalIP()
 		if err != nil {
@@ -163,17 +217,36 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Failed to create peer context: %s", err)
 	}
 
+	// Peers behind NAT announce their externally reachable address, while the
+	// scheduler keeps listening on the local address.
+	announcePctx := pctx
+	if config.NAT.Mode != "" {
+		mapper, err := nat.New(config.NAT)
+		if err != nil {
+			log.Fatalf("Error creating nat mapper: %s", err)
+		}
+		addr, err := mapper.Map(flags.PeerPort)
+		if err != nil {
+			log.Errorf("Error traversing nat, announcing local address instead: %s", err)
+		} else {
+			log.Infof("Announcing external address %s for local port %d", addr, flags.PeerPort)
+			announcePctx.IP = addr.IP
+			announcePctx.Port = addr.Port
+		}
+	}
+	announcePctx.Addrs = config.AnnounceAddrs
+
 	cads, err := store.NewCADownloadStore(config.CADownloadStore, stats)
 	if err != nil {
 		log.Fatalf("Failed to create local store: %s", err)
 	}
 
-	netevents, err := networkevent.NewProducer(config.NetworkEvent)
+	netevents, err := networkevent.NewProducer(config.NetworkEvent, networkevent.WithStats(stats))
 	if err != nil {
 		log.Fatalf("Failed to create network event producer: %s", err)
 	}
 
-	trackers, err := config.Tracker.Build()
+	trackers, err := config.Tracker.Build(hashring.WithLocalZone(pctx.Zone))
 	if err != nil {
 		log.Fatalf("Error building tracker upstream: %s", err)
 	}
@@ -184,23 +257,68 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building client tls config: %s", err)
 	}
 
-	announceClient := announceclient.New(pctx, trackers, tls)
+	var blacklistStore connstate.BlacklistStore = connstate.NoopBlacklistStore{}
+	if config.LocalDB.Source != "" {
+		localDB, err := localdb.New(config.LocalDB)
+		if err != nil {
+			log.Fatalf("Error creating local db: %s", err)
+		}
+		blacklistStore = connstate.NewAsyncBlacklistStore(connstate.NewSQLBlacklistStore(localDB))
+	}
+
+	pulls := pullstats.New(config.PullStats, stats, clock.New())
+
+	announceClient := announceclient.New(
+		announcePctx, trackers, tls, announceclient.WithConfig(config.AnnounceClient))
 	sched, err := scheduler.NewAgentScheduler(
-		config.Scheduler, stats, pctx, cads, netevents, trackers, announceClient, tls)
+		config.Scheduler, stats, pctx, cads, netevents, trackers, announceClient,
+		blacklistStore, tls, pulls)
 	if err != nil {
 		log.Fatalf("Error creating scheduler: %s", err)
 	}
 
-	buildIndexes, err := config.BuildIndex.Build()
+	if config.RemoteConfig.URL != "" {
+		poller, err := remoteconfig.New(config.RemoteConfig, "agent", stats)
+		if err != nil {
+			log.Fatalf("Error creating remote config poller: %s", err)
+		}
+		featureflag.Global().SetRemote(poller)
+		poller.Subscribe("scheduler", func(section json.RawMessage) error {
+			c := config.Scheduler
+			if err := remoteconfig.Merge(section, &c); err != nil {
+				return err
+			}
+			sched.Reload(c)
+			return nil
+		})
+		poller.Subscribe("tracing", tracing.GlobalSampling().ApplyRemote)
+		go poller.Run()
+	}
+
+	buildIndexes, err := config.BuildIndex.Build(upstream.WithPassiveLocalZone(pctx.Zone))
 	if err != nil {
 		log.Fatalf("Error building build-index upstream: %s", err)
 	}
 
 	tagClient := tagclient.NewClusterClient(buildIndexes, tls)
 
-	transferer := transfer.NewReadOnlyTransferer(stats, cads, tagClient, sched)
+	var transfererOpts []transfer.ReadOnlyOption
+	if config.Registry.VerifyCachedBlobs {
+		transfererOpts = append(transfererOpts, transfer.WithCacheVerification())
+	}
+	var transferer transfer.ImageTransferer = transfer.NewReadOnlyTransferer(
+		stats, cads, tagClient, sched, pulls, transfererOpts...)
 
-	registry, err := config.Registry.Build(config.Registry.ReadOnlyParameters(transferer, cads, stats))
+	if config.Encryption.Enabled() {
+		keys, err := encryption.NewKeyring(config.Encryption)
+		if err != nil {
+			log.Fatalf("Error creating encryption keyring: %s", err)
+		}
+		transferer = transfer.NewEncryptingTransferer(transferer, stats, keys)
+	}
+
+	registry, err := config.Registry.BuildServer(
+		config.Registry.ReadOnlyParameters(transferer, cads, stats))
 	if err != nil {
 		log.Fatalf("Failed to init registry: %s", err)
 	}
@@ -217,22 +335,34 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Failed to create container runtime factory: %s", err)
 	}
 
+	leases, err := lease.NewManager(config.Leases, stats, cads, sched.Download)
+	if err != nil {
+		log.Fatalf("Error creating lease manager: %s", err)
+	}
+
 	agentServer := agentserver.New(
-		config.AgentServer, stats, cads, sched, tagClient, announceClient, containerRuntimeFactory)
+		config.AgentServer, stats, cads, sched, tagClient, announceClient,
+		metainfoclient.New(trackers, tls), containerRuntimeFactory, pulls,
+		agentserver.WithLeases(leases))
 	addr := fmt.Sprintf(":%d", flags.AgentServerPort)
 	log.Infof("Starting agent server on %s", addr)
 	go func() {
-		log.Fatal(http.ListenAndServe(addr, agentServer.Handler()))
+		flusher.Fatal(http.ListenAndServe(addr, agentServer.Handler()))
 	}()
 
 	log.Info("Starting registry...")
 	go func() {
-		log.Fatal(registry.ListenAndServe())
+		flusher.Fatal(registry.ListenAndServe())
 	}()
 
 	go heartbeat(stats)
 
-	log.Fatal(nginx.Run(config.Nginx, map[string]interface{}{
+	if config.Inventory.Enabled {
+		reporter := inventory.NewReporter(config.Inventory, stats, pctx.PeerID, cads, tagClient)
+		go reporter.Run()
+	}
+
+	flusher.Fatal(nginx.Run(config.Nginx, map[string]interface{}{
 		"allowed_cidrs": config.AllowedCidrs,
 		"port":          flags.AgentRegistryPort,
 		"registry_server": nginx.GetServer(
@@ -15,16 +15,28 @@ package cmd
 
 import (
 	"github.com/uber/kraken/agent/agentserver"
+	"github.com/uber/kraken/agent/inventory"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/containerruntime"
 	"github.com/uber/kraken/lib/containerruntime/dockerdaemon"
+	"github.com/uber/kraken/lib/debugserver"
 	"github.com/uber/kraken/lib/dockerregistry"
+	"github.com/uber/kraken/lib/encryption"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/lease"
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/lib/nat"
+	"github.com/uber/kraken/lib/pullstats"
+	"github.com/uber/kraken/lib/remoteconfig"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
 	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -34,12 +46,14 @@ import (
 type Config struct {
 	ZapLogging       zap.Config                     `yaml:"zap"`
 	Metrics          metrics.Config                 `yaml:"metrics"`
+	Tracing          tracing.Config                 `yaml:"tracing"`
 	CADownloadStore  store.CADownloadStoreConfig    `yaml:"store"`
 	Registry         dockerregistry.Config          `yaml:"registry"`
 	Scheduler        scheduler.Config               `yaml:"scheduler"`
 	PeerIDFactory    core.PeerIDFactory             `yaml:"peer_id_factory"`
 	NetworkEvent     networkevent.Config            `yaml:"network_event"`
 	Tracker          upstream.PassiveHashRingConfig `yaml:"tracker"`
+	AnnounceClient   announceclient.Config          `yaml:"announceclient"`
 	BuildIndex       upstream.PassiveConfig         `yaml:"build_index"`
 	AgentServer      agentserver.Config             `yaml:"agentserver"`
 	RegistryBackup   string                         `yaml:"registry_backup"`
@@ -47,6 +61,39 @@ type Config struct {
 	TLS              httputil.TLSConfig             `yaml:"tls"`
 	AllowedCidrs     []string                       `yaml:"allowed_cidrs"`
 	ContainerRuntime containerruntime.Config        `yaml:"container_runtime"`
+	Inventory        inventory.Config               `yaml:"inventory"`
+	RemoteConfig     remoteconfig.Config            `yaml:"remote_config"`
+	PullStats        pullstats.Config               `yaml:"pull_stats"`
+
+	// LocalDB is optional. If configured, scheduler connection blacklist
+	// entries are persisted across restarts.
+	LocalDB localdb.Config `yaml:"localdb"`
+
+	// Recovery configures crash bundles written when a handler panics.
+	Recovery middleware.RecoveryConfig `yaml:"recovery"`
+
+	// FeatureFlags configures flags gating new behaviors. Flags can be
+	// overridden at runtime through /x/config/flags.
+	FeatureFlags featureflag.Config `yaml:"feature_flags"`
+
+	// NAT configures NAT traversal for agents whose peer port is not
+	// reachable at their local address.
+	NAT nat.Config `yaml:"nat"`
+
+	// AnnounceAddrs are additional host:port addresses the agent announces,
+	// e.g. its IPv6 address or the addresses of other network interfaces,
+	// which peers dial if the peer ip is unreachable.
+	AnnounceAddrs []string `yaml:"announce_addrs"`
+
+	// Debug configures the localhost-only listener serving pprof and expvar.
+	Debug debugserver.Config `yaml:"debug"`
+
+	// Leases configures leases, which keep blobs available until a deadline.
+	Leases lease.Config `yaml:"leases"`
+
+	// Encryption configures namespaces whose blobs are decrypted when served
+	// to the local registry.
+	Encryption encryption.Config `yaml:"encryption"`
 
 	// Deprecated
 	DockerDaemon dockerdaemon.Config `yaml:"docker_daemon"`
@@ -0,0 +1,31 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package inventory
+
+import "time"
+
+// Config defines Reporter configuration.
+type Config struct {
+	// Enabled turns on periodic inventory reports to build-index.
+	Enabled bool `yaml:"enabled"`
+
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Interval == 0 {
+		c.Interval = 5 * time.Minute
+	}
+	return c
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package inventory
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// CacheLister lists the blobs cached on an agent.
+type CacheLister interface {
+	ListCacheFiles() ([]string, error)
+}
+
+// Reporter periodically reports a summary of the blobs cached on an agent to
+// build-index, which is used to compute image distribution status.
+type Reporter struct {
+	config    Config
+	stats     tally.Scope
+	agent     string
+	cache     CacheLister
+	tagClient tagclient.Client
+}
+
+// NewReporter creates a new Reporter for the agent identified by peerID.
+func NewReporter(
+	config Config,
+	stats tally.Scope,
+	peerID core.PeerID,
+	cache CacheLister,
+	tagClient tagclient.Client) *Reporter {
+
+	stats = stats.Tagged(map[string]string{
+		"module": "inventoryreporter",
+	})
+
+	return &Reporter{
+		config:    config.applyDefaults(),
+		stats:     stats,
+		agent:     peerID.String(),
+		cache:     cache,
+		tagClient: tagClient,
+	}
+}
+
+// Run reports inventory every configured interval. Blocks forever.
+func (r *Reporter) Run() {
+	for {
+		if err := r.Report(); err != nil {
+			log.Errorf("Error reporting inventory: %s", err)
+			r.stats.Counter("report_errors").Inc(1)
+		}
+		time.Sleep(r.config.Interval)
+	}
+}
+
+// Report sends a single inventory summary to build-index.
+func (r *Reporter) Report() error {
+	names, err := r.cache.ListCacheFiles()
+	if err != nil {
+		return fmt.Errorf("list cache files: %s", err)
+	}
+	var summary tagmodels.InventorySummary
+	for _, name := range names {
+		d, err := core.NewDigestFromName(name)
+		if err != nil {
+			// Ignore non-blob files.
+			continue
+		}
+		summary.Digests = append(summary.Digests, d)
+	}
+	if err := r.tagClient.ReportInventory(r.agent, summary); err != nil {
+		return fmt.Errorf("report inventory: %s", err)
+	}
+	r.stats.Gauge("cached_blobs").Update(float64(len(summary.Digests)))
+	return nil
+}
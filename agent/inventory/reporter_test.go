@@ -0,0 +1,59 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package inventory
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestReporterReportsCachedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(cads.CreateDownloadFile(blob.Digest.Hex(), blob.Length()))
+	w, err := cads.GetDownloadFileReadWriter(blob.Digest.Hex())
+	require.NoError(err)
+	_, err = io.Copy(w, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.NoError(w.Close())
+	require.NoError(cads.MoveDownloadFileToCache(blob.Digest.Hex()))
+
+	tagClient := mocktagclient.NewMockClient(ctrl)
+
+	peerID := core.PeerIDFixture()
+	r := NewReporter(Config{}, tally.NoopScope, peerID, cads, tagClient)
+
+	tagClient.EXPECT().ReportInventory(
+		peerID.String(),
+		tagmodels.InventorySummary{Digests: []core.Digest{blob.Digest}}).Return(nil)
+
+	require.NoError(r.Report())
+}
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//	http://www.apache.org/licenses/LICENSE-2.0
+//     http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -15,14 +15,22 @@ package cmd
 
 import (
 	"flag"
+	"io"
+	"syscall"
 
+	"github.com/uber/kraken/build-index/inventory"
+	"github.com/uber/kraken/build-index/tagacl"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagevents"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/maintenance"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
@@ -32,19 +40,23 @@ import (
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/log"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 )
 
 // Flags defines build-index CLI flags.
 type Flags struct {
-	Port          int
-	ConfigFile    string
-	KrakenCluster string
-	SecretsFile   string
+	Port              int
+	ConfigFile        string
+	Zone              string
+	KrakenCluster     string
+	SecretsFile       string
+	ConfigOverlayFile string
 }
 
 // ParseFlags parses build-index CLI flags.
@@ -54,10 +66,15 @@ func ParseFlags() *Flags {
 		&flags.Port, "port", 0, "tag server port")
 	flag.StringVar(
 		&flags.ConfigFile, "config", "", "configuration file path")
+	flag.StringVar(
+		&flags.Zone, "zone", "", "zone/datacenter name")
 	flag.StringVar(
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
 		&flags.SecretsFile, "secrets", "", "path to a secrets YAML file to load into configuration")
+	flag.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file, e.g. with per-cluster settings, to merge on top of configuration")
 	flag.Parse()
 	return &flags
 }
@@ -102,11 +119,16 @@ func Run(flags *Flags, opts ...Option) {
 	if overrides.config != nil {
 		config = *overrides.config
 	} else {
-		if err := configutil.Load(flags.ConfigFile, &config); err != nil {
+		if err := configutil.Load(
+			flags.ConfigFile, &config,
+			configutil.WithOverlay(flags.ConfigOverlayFile),
+			configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 			panic(err)
 		}
 		if flags.SecretsFile != "" {
-			if err := configutil.Load(flags.SecretsFile, &config); err != nil {
+			if err := configutil.Load(
+				flags.SecretsFile, &config,
+				configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 				panic(err)
 			}
 		}
@@ -120,17 +142,34 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var closer io.Closer
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		var err error
+		stats, closer, err = metrics.New(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
-		stats = s
-		defer closer.Close()
 	}
+	flusher := metrics.NewFlusher(stats, closer)
+	defer flusher.Flush(metrics.ShutdownExit)
+	flusher.FlushOnSignals(syscall.SIGTERM, syscall.SIGINT)
 
 	go metrics.EmitVersion(stats)
 
+	tracingCloser, err := tracing.Init(config.Tracing, "kraken-build-index")
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %s", err)
+	}
+	defer tracingCloser.Close()
+
+	if err := middleware.InitRecovery(config.Recovery, "kraken-build-index"); err != nil {
+		log.Fatalf("Failed to init recovery: %s", err)
+	}
+
+	if err := featureflag.Init(config.FeatureFlags, "kraken-build-index"); err != nil {
+		log.Fatalf("Failed to init feature flags: %s", err)
+	}
+
 	ss, err := store.NewSimpleStore(config.Store, stats)
 	if err != nil {
 		log.Fatalf("Error creating simple store: %s", err)
@@ -146,13 +185,23 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building client tls config: %s", err)
 	}
 
-	origins, err := config.Origin.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
+	originRouter, err := blobclient.NewRouter(config.OriginRoute)
+	if err != nil {
+		log.Fatalf("Error creating origin router: %s", err)
+	}
+	originOpts := []blobclient.Option{blobclient.WithTLS(tls), blobclient.WithRouter(originRouter)}
+
+	origins, err := config.Origin.Build(
+		upstream.WithHealthCheck(blobclient.NewHealthChecker(originOpts...)),
+		upstream.WithStats(stats.SubScope("origin")),
+		upstream.WithLocalZone(flags.Zone))
 	if err != nil {
 		log.Fatalf("Error building origin host list: %s", err)
 	}
 
-	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originClient := blobclient.NewClusterClient(r)
+	r := blobclient.NewClientResolver(blobclient.NewProvider(originOpts...), origins)
+	originClient := blobclient.NewClusterClient(
+		r, blobclient.WithLocalZone(flags.Zone, config.Origin.Zones))
 
 	localOriginDNS, err := config.Origin.StableAddr()
 	if err != nil {
@@ -164,7 +213,9 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating local db: %s", err)
 	}
 
-	cluster, err := config.Cluster.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
+	cluster, err := config.Cluster.Build(
+		upstream.WithHealthCheck(healthcheck.Default(tls)),
+		upstream.WithStats(stats.SubScope("cluster")))
 	if err != nil {
 		log.Fatalf("Error building cluster host list: %s", err)
 	}
@@ -195,22 +246,39 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating tag replication manager: %s", err)
 	}
 
+	writeBackExecutor, err := writeback.NewExecutor(
+		config.WriteBackExecutor, stats, ss, backends)
+	if err != nil {
+		log.Fatalf("Error creating write-back executor: %s", err)
+	}
+
 	writeBackManager, err := persistedretry.NewManager(
 		config.WriteBack,
 		stats,
 		writeback.NewStore(localDB),
-		writeback.NewExecutor(stats, ss, backends))
+		writeBackExecutor)
 	if err != nil {
 		log.Fatalf("Error creating write-back manager: %s", err)
 	}
 
-	tagStore := tagstore.New(config.TagStore, stats, ss, backends, writeBackManager)
+	tagStore := tagstore.New(
+		config.TagStore, stats, ss, backends, writeBackManager, tagstore.WithDigestIndex(localDB))
 
 	depResolver, err := tagtype.NewMap(config.TagTypes, originClient)
 	if err != nil {
 		log.Fatalf("Error creating tag type manager: %s", err)
 	}
 
+	notifier, err := tagevents.New(config.TagEvents, stats)
+	if err != nil {
+		log.Fatalf("Error creating tag event notifier: %s", err)
+	}
+
+	acl, err := tagacl.New(config.TagACL, config.TagServer.Authz.Identity, stats)
+	if err != nil {
+		log.Fatalf("Error creating tag ACL: %s", err)
+	}
+
 	server := tagserver.New(
 		config.TagServer,
 		stats,
@@ -222,13 +290,19 @@ func Run(flags *Flags, opts ...Option) {
 		remotes,
 		tagReplicationManager,
 		tagclient.NewProvider(tls),
-		depResolver)
+		depResolver,
+		inventory.NewRegistry(config.Inventory, clock.New()),
+		notifier,
+		tagserver.WithMaintenance(
+			maintenance.New(config.Maintenance, stats, tagReplicationManager, writeBackManager)),
+		tagserver.WithACL(acl),
+		tagserver.WithCluster(cluster))
 	go func() {
-		log.Fatal(server.ListenAndServe())
+		flusher.Fatal(server.ListenAndServe())
 	}()
 
 	log.Info("Starting nginx...")
-	log.Fatal(nginx.Run(
+	flusher.Fatal(nginx.Run(
 		config.Nginx,
 		map[string]interface{}{
 			"port":   flags.Port,
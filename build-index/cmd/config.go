@@ -14,17 +14,26 @@
 package cmd
 
 import (
+	"github.com/uber/kraken/build-index/inventory"
+	"github.com/uber/kraken/build-index/tagacl"
+	"github.com/uber/kraken/build-index/tagevents"
 	"github.com/uber/kraken/build-index/tagserver"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/maintenance"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -34,6 +43,7 @@ import (
 type Config struct {
 	ZapLogging     zap.Config                   `yaml:"zap"`
 	Metrics        metrics.Config               `yaml:"metrics"`
+	Tracing        tracing.Config               `yaml:"tracing"`
   BackendManager backend.ManagerConfig   `yaml:"backend_manager"`
 	Backends       []backend.Config             `yaml:"backends"`
 	Auth           backend.AuthConfig           `yaml:"auth"`
@@ -42,11 +52,32 @@ type Config struct {
 	TagReplication persistedretry.Config        `yaml:"tag_replication"`
 	TagTypes       []tagtype.Config             `yaml:"tag_types"`
 	Origin         upstream.ActiveConfig        `yaml:"origin"`
+	OriginRoute    blobclient.RouteConfig       `yaml:"origin_route"`
 	LocalDB        localdb.Config               `yaml:"localdb"`
 	Cluster        upstream.ActiveConfig        `yaml:"cluster"`
 	TagStore       tagstore.Config              `yaml:"tag_store"`
+	Inventory      inventory.Config             `yaml:"inventory"`
+	TagEvents      tagevents.Config             `yaml:"tag_events"`
 	Store          store.SimpleStoreConfig      `yaml:"store"`
 	WriteBack      persistedretry.Config        `yaml:"writeback"`
 	Nginx          nginx.Config                 `yaml:"nginx"`
 	TLS            httputil.TLSConfig           `yaml:"tls"`
+
+	// WriteBackExecutor configures throttling and coalescing of write-back
+	// uploads to the storage backend.
+	WriteBackExecutor writeback.Config `yaml:"writeback_executor"`
+
+	// Recovery configures crash bundles written when a handler panics.
+	Recovery middleware.RecoveryConfig `yaml:"recovery"`
+
+	// FeatureFlags configures flags gating new behaviors. Flags can be
+	// overridden at runtime through /x/config/flags.
+	FeatureFlags featureflag.Config `yaml:"feature_flags"`
+
+	// Maintenance configures read-only mode, which can be toggled at runtime
+	// through /x/maintenance.
+	Maintenance maintenance.Config `yaml:"maintenance"`
+
+	// TagACL restricts which clients may write tags of which namespaces.
+	TagACL tagacl.Config `yaml:"tag_acl"`
 }
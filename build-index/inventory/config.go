@@ -0,0 +1,30 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package inventory
+
+import "time"
+
+// Config defines Registry configuration.
+type Config struct {
+	// AgentTTL is the duration after which agents which have not reported
+	// their inventory are no longer considered registered.
+	AgentTTL time.Duration `yaml:"agent_ttl"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.AgentTTL == 0 {
+		c.AgentTTL = 15 * time.Minute
+	}
+	return c
+}
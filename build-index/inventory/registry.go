@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package inventory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber/kraken/core"
+)
+
+// Registry tracks the blobs cached on each agent, as reported by agents'
+// inventory summaries.
+type Registry interface {
+	Report(agent string, digests []core.Digest)
+	Coverage(layers core.DigestList) (agents int, complete int)
+}
+
+type agentInventory struct {
+	digests    map[core.Digest]struct{}
+	reportedAt time.Time
+}
+
+type registry struct {
+	sync.Mutex
+	config Config
+	clk    clock.Clock
+	agents map[string]*agentInventory
+}
+
+// NewRegistry creates a new in-memory Registry.
+func NewRegistry(config Config, clk clock.Clock) Registry {
+	return &registry{
+		config: config.applyDefaults(),
+		clk:    clk,
+		agents: make(map[string]*agentInventory),
+	}
+}
+
+// Report replaces the inventory of agent with digests.
+func (r *registry) Report(agent string, digests []core.Digest) {
+	inv := &agentInventory{
+		digests:    make(map[core.Digest]struct{}, len(digests)),
+		reportedAt: r.clk.Now(),
+	}
+	for _, d := range digests {
+		inv.digests[d] = struct{}{}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	r.agents[agent] = inv
+}
+
+// Coverage returns the number of registered agents, and the number of
+// registered agents which have all layers cached. Agents which have not
+// reported within the configured TTL are expired.
+func (r *registry) Coverage(layers core.DigestList) (agents int, complete int) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := r.clk.Now()
+	for agent, inv := range r.agents {
+		if now.Sub(inv.reportedAt) > r.config.AgentTTL {
+			delete(r.agents, agent)
+			continue
+		}
+		agents++
+		if inv.hasAll(layers) {
+			complete++
+		}
+	}
+	return agents, complete
+}
+
+func (inv *agentInventory) hasAll(layers core.DigestList) bool {
+	for _, d := range layers {
+		if _, ok := inv.digests[d]; !ok {
+			return false
+		}
+	}
+	return true
+}
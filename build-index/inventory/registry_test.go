@@ -0,0 +1,79 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/core"
+)
+
+func TestRegistryCoverage(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry(Config{}, clock.NewMock())
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+	d3 := core.DigestFixture()
+
+	r.Report("agent1", []core.Digest{d1, d2, d3})
+	r.Report("agent2", []core.Digest{d1})
+	r.Report("agent3", nil)
+
+	agents, complete := r.Coverage(core.DigestList{d1, d2})
+	require.Equal(3, agents)
+	require.Equal(1, complete)
+
+	agents, complete = r.Coverage(core.DigestList{d1})
+	require.Equal(3, agents)
+	require.Equal(2, complete)
+}
+
+func TestRegistryReportReplacesInventory(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry(Config{}, clock.NewMock())
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	r.Report("agent1", []core.Digest{d1})
+	r.Report("agent1", []core.Digest{d2})
+
+	agents, complete := r.Coverage(core.DigestList{d1})
+	require.Equal(1, agents)
+	require.Equal(0, complete)
+}
+
+func TestRegistryExpiresAgents(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	r := NewRegistry(Config{AgentTTL: time.Minute}, clk)
+
+	d := core.DigestFixture()
+
+	r.Report("agent1", []core.Digest{d})
+	clk.Add(30 * time.Second)
+	r.Report("agent2", []core.Digest{d})
+	clk.Add(45 * time.Second)
+
+	agents, complete := r.Coverage(core.DigestList{d})
+	require.Equal(1, agents)
+	require.Equal(1, complete)
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagacl
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+// ErrDenied is returned when a client may not write a tag.
+var ErrDenied = errors.New("tag write denied")
+
+// Config defines which clients may write tags of which namespaces.
+type Config struct {
+	// Rules are matched against tags in order, and the first rule whose
+	// namespace matches a tag applies. Tags which match no rule may be written
+	// by anyone.
+	Rules []Rule `yaml:"rules"`
+
+	// AuditLog configures the log of denied writes.
+	AuditLog log.Config `yaml:"audit_log"`
+}
+
+// Rule restricts writes of tags matching Namespace to clients which present
+// one of Identities in their certificate, or one of Tokens as a bearer token.
+type Rule struct {
+	// Namespace is a regular expression, matched against tags the same way
+	// backend namespaces are.
+	Namespace string `yaml:"namespace"`
+
+	// Identities lists allowed client identities. An identity ending in "*"
+	// matches any identity with the preceding prefix.
+	Identities []string `yaml:"identities"`
+
+	// Tokens lists allowed bearer tokens.
+	Tokens []string `yaml:"tokens"`
+}
+
+type rule struct {
+	Rule
+	regexp *regexp.Regexp
+}
+
+func (r *rule) allowsIdentity(ids []string) bool {
+	for _, id := range ids {
+		for _, a := range r.Identities {
+			if strings.HasSuffix(a, "*") {
+				if strings.HasPrefix(id, strings.TrimSuffix(a, "*")) {
+					return true
+				}
+			} else if id == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *rule) allowsToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, t := range r.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ACL checks tag writes against the configured rules.
+type ACL struct {
+	rules    []*rule
+	verifier *httputil.IdentityVerifier
+	stats    tally.Scope
+	audit    *zap.SugaredLogger
+}
+
+// New creates a new ACL. Client certificates are verified according to
+// identity.
+func New(config Config, identity httputil.IdentityConfig, stats tally.Scope) (*ACL, error) {
+	var rules []*rule
+	for _, r := range config.Rules {
+		re, err := regexp.Compile(r.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: regexp: %s", r.Namespace, err)
+		}
+		rules = append(rules, &rule{r, re})
+	}
+	verifier, err := httputil.NewIdentityVerifier(identity)
+	if err != nil {
+		return nil, fmt.Errorf("identity verifier: %s", err)
+	}
+	logger, err := log.New(config.AuditLog, map[string]interface{}{"module": "tagacl"})
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %s", err)
+	}
+	stats = stats.Tagged(map[string]string{
+		"module": "tagacl",
+	})
+	return &ACL{rules, verifier, stats, logger.Sugar()}, nil
+}
+
+// Disabled returns an ACL which allows all writes.
+func Disabled() *ACL {
+	return &ACL{stats: tally.NoopScope, audit: zap.NewNop().Sugar()}
+}
+
+func (a *ACL) match(tag string) *rule {
+	for _, r := range a.rules {
+		if r.regexp.MatchString(tag) {
+			return r
+		}
+	}
+	return nil
+}
+
+// CheckWrite returns ErrDenied if the client of r may not write any of tags.
+// op describes the write, e.g. "put" or "replicate", in the audit log.
+func (a *ACL) CheckWrite(r *http.Request, op string, tags ...string) error {
+	if len(a.rules) == 0 {
+		return nil
+	}
+	var ids []string
+	var idsLoaded bool
+	token := bearerToken(r)
+	for _, tag := range tags {
+		rule := a.match(tag)
+		if rule == nil || rule.allowsToken(token) {
+			continue
+		}
+		if !idsLoaded {
+			// Requests without a client certificate may still present a token.
+			ids, _ = a.verifier.PeerIdentities(r)
+			idsLoaded = true
+		}
+		if rule.allowsIdentity(ids) {
+			continue
+		}
+		a.stats.Tagged(map[string]string{"op": op}).Counter("denied").Inc(1)
+		a.audit.With(
+			"op", op,
+			"tag", tag,
+			"namespace", rule.Namespace,
+			"identities", ids,
+			"token", token != "",
+			"remote_addr", r.RemoteAddr,
+			"path", r.URL.Path,
+		).Warn("Denied tag write")
+		return ErrDenied
+	}
+	return nil
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(h, "Bearer ")
+}
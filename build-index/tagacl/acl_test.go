@@ -0,0 +1,122 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagacl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func newACL(t *testing.T, identity httputil.IdentityConfig, rules ...Rule) *ACL {
+	acl, err := New(
+		Config{Rules: rules, AuditLog: log.Config{Disable: true}}, identity, tally.NoopScope)
+	require.NoError(t, err)
+	return acl
+}
+
+func TestNewInvalidNamespace(t *testing.T) {
+	_, err := New(
+		Config{Rules: []Rule{{Namespace: "foo/("}}}, httputil.IdentityConfig{}, tally.NoopScope)
+	require.Error(t, err)
+}
+
+func TestCheckWrite(t *testing.T) {
+	ca := httputil.NewCAFixture()
+	identity, cleanup := ca.IdentityConfig()
+	defer cleanup()
+
+	acl := newACL(t, identity, Rule{
+		Namespace:  "team-a/.*",
+		Identities: []string{"spiffe://kraken/build-index/*", "spiffe://ci/team-a"},
+		Tokens:     []string{"secret-a"},
+	}, Rule{
+		Namespace: ".*-protected/.*",
+		Tokens:    []string{"secret-p"},
+	})
+
+	tests := []struct {
+		desc     string
+		identity string
+		token    string
+		tags     []string
+		allowed  bool
+	}{
+		{"unmatched tag", "", "", []string{"team-b/repo:latest"}, true},
+		{"exact identity", "spiffe://ci/team-a", "", []string{"team-a/repo:latest"}, true},
+		{"wildcard identity", "spiffe://kraken/build-index/dca1", "", []string{"team-a/repo:latest"}, true},
+		{"token", "", "secret-a", []string{"team-a/repo:latest"}, true},
+		{"no credentials", "", "", []string{"team-a/repo:latest"}, false},
+		{"wrong identity", "spiffe://ci/team-b", "", []string{"team-a/repo:latest"}, false},
+		{"wrong token", "", "secret-p", []string{"team-a/repo:latest"}, false},
+		{"second rule", "", "secret-p", []string{"x-protected/repo:latest"}, true},
+		{"first matching rule wins", "", "secret-p", []string{"team-a/x-protected/repo:latest"}, false},
+		{"any denied alias", "", "secret-a", []string{"team-a/repo:latest", "x-protected/repo:latest"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/tags/x/digest/y", nil)
+			if test.identity != "" {
+				r.Header.Set(
+					httputil.ClientCertHeader,
+					httputil.EncodeClientCertHeader(ca.ClientCert(test.identity)))
+			}
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			err := acl.CheckWrite(r, "put", test.tags...)
+			if test.allowed {
+				require.NoError(t, err)
+			} else {
+				require.Equal(t, ErrDenied, err)
+			}
+		})
+	}
+}
+
+func TestCheckWriteRejectsUnverifiedIdentity(t *testing.T) {
+	identity, cleanup := httputil.NewCAFixture().IdentityConfig()
+	defer cleanup()
+
+	acl := newACL(t, identity, Rule{
+		Namespace:  "team-a/.*",
+		Identities: []string{"spiffe://ci/team-a"},
+	})
+
+	forged := httputil.NewCAFixture().ClientCert("spiffe://ci/team-a")
+	r := httptest.NewRequest("PUT", "/tags/x/digest/y", nil)
+	r.Header.Set(httputil.ClientCertHeader, httputil.EncodeClientCertHeader(forged))
+	require.Equal(t, ErrDenied, acl.CheckWrite(r, "put", "team-a/repo:latest"))
+}
+
+func TestDisabledAllowsAllWrites(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/tags/x/digest/y", nil)
+	require.NoError(t, Disabled().CheckWrite(r, "put", "team-a/repo:latest"))
+}
+
+func TestBearerToken(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/", nil)
+	require.Equal(t, "", bearerToken(r))
+	r.Header.Set("Authorization", "Basic Zm9vOmJhcg==")
+	require.Equal(t, "", bearerToken(r))
+	r.Header = http.Header{}
+	r.Header.Set("Authorization", "Bearer abc")
+	require.Equal(t, "abc", bearerToken(r))
+}
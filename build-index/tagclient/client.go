@@ -28,12 +28,14 @@ import (
 	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/utils/httputil"
 )
 
 // Client errors.
 var (
 	ErrTagNotFound = errors.New("tag not found")
+	ErrTagConflict = errors.New("tag conflict")
 )
 
 // Client wraps tagserver endpoints.
@@ -41,6 +43,9 @@ type Client interface {
 	CheckReadiness() error
 	Put(tag string, d core.Digest) error
 	PutAndReplicate(tag string, d core.Digest) error
+	PutIfMatch(tag string, expected, d core.Digest) error
+	PutGroup(tags []string, d core.Digest) error
+	PutGroupAndReplicate(tags []string, d core.Digest) error
 	Get(tag string) (core.Digest, error)
 	Has(tag string) (bool, error)
 	List(prefix string) ([]string, error)
@@ -49,10 +54,19 @@ type Client interface {
 	ListRepositoryWithPagination(repo string, filter ListFilter) (tagmodels.ListResponse, error)
 	Replicate(tag string) error
 	Origin() (string, error)
+	ReportInventory(agent string, summary tagmodels.InventorySummary) error
+	DistributionStatus(tag string) (tagmodels.DistributionStatus, error)
+	ReplicationStatus(tag string) (tagmodels.ReplicationStatus, error)
 
 	DuplicateReplicate(
 		tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error
 	DuplicatePut(tag string, d core.Digest, delay time.Duration) error
+	DuplicateReplicateGroup(
+		tags []string, d core.Digest, dependencies core.DigestList, delay time.Duration) error
+	DuplicatePutGroup(tags []string, d core.Digest, delay time.Duration) error
+	ConditionalPut(tag string, expected, d core.Digest) error
+	InvalidateCache(tag string) error
+	DuplicateReportInventory(agent string, summary tagmodels.InventorySummary) error
 }
 
 type singleClient struct {
@@ -95,6 +109,73 @@ func (c *singleClient) PutAndReplicate(tag string, d core.Digest) error {
 	return err
 }
 
+// PutIfMatch sets tag to d only if tag currently points to expected. If
+// expected is empty, tag must not exist yet. Returns ErrTagConflict if tag was
+// concurrently modified.
+func (c *singleClient) PutIfMatch(tag string, expected, d core.Digest) error {
+	return c.putIfMatch(
+		fmt.Sprintf("http://%s/tags/%s/digest/%s", c.addr, url.PathEscape(tag), d.String()),
+		expected)
+}
+
+// ConditionalPut performs a conditional put on the addressed build-index node
+// itself, which must be the leader of tag. Used by build-index nodes to forward
+// conditional puts to the leader.
+func (c *singleClient) ConditionalPut(tag string, expected, d core.Digest) error {
+	return c.putIfMatch(
+		fmt.Sprintf(
+			"http://%s/internal/conditional/tags/%s/digest/%s",
+			c.addr, url.PathEscape(tag), d.String()),
+		expected)
+}
+
+func (c *singleClient) putIfMatch(u string, expected core.Digest) error {
+	header := map[string]string{"If-None-Match": "*"}
+	if expected != (core.Digest{}) {
+		header = map[string]string{"If-Match": fmt.Sprintf("%q", expected.String())}
+	}
+	_, err := httputil.Put(
+		u,
+		httputil.SendHeaders(header),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	if httputil.IsPreconditionFailed(err) {
+		return ErrTagConflict
+	}
+	return err
+}
+
+// PutGroup sets all of tags to d atomically: either all tags are written or
+// none are. Dependencies are resolved from the first tag.
+func (c *singleClient) PutGroup(tags []string, d core.Digest) error {
+	return c.putGroup(tags, d, false)
+}
+
+// PutGroupAndReplicate is PutGroup, additionally replicating the group to the
+// remotes of the first tag.
+func (c *singleClient) PutGroupAndReplicate(tags []string, d core.Digest) error {
+	return c.putGroup(tags, d, true)
+}
+
+func (c *singleClient) putGroup(tags []string, d core.Digest, replicate bool) error {
+	if len(tags) == 0 {
+		return errors.New("no tags")
+	}
+	q := url.Values{}
+	for _, alias := range tags[1:] {
+		q.Add("alias", alias)
+	}
+	if replicate {
+		q.Set("replicate", "true")
+	}
+	_, err := httputil.Put(
+		fmt.Sprintf(
+			"http://%s/tags/%s/digest/%s?%s", c.addr, url.PathEscape(tags[0]), d.String(), q.Encode()),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
 func (c *singleClient) Get(tag string) (core.Digest, error) {
 	resp, err := httputil.Get(
 		fmt.Sprintf("http://%s/tags/%s", c.addr, url.PathEscape(tag)),
@@ -111,7 +192,7 @@ func (c *singleClient) Get(tag string) (core.Digest, error) {
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("read body: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(string(b))
+	d, err := core.ParseDigest(string(b))
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("new digest: %s", err)
 	}
@@ -235,19 +316,32 @@ func (c *singleClient) Replicate(tag string) error {
 type DuplicateReplicateRequest struct {
 	Dependencies core.DigestList `json:"dependencies"`
 	Delay        time.Duration   `json:"delay"`
+
+	// Aliases are replicated as a group with the tag in the request path.
+	Aliases []string `json:"aliases,omitempty"`
 }
 
 func (c *singleClient) DuplicateReplicate(
 	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
 
-	b, err := json.Marshal(DuplicateReplicateRequest{dependencies, delay})
+	return c.DuplicateReplicateGroup([]string{tag}, d, dependencies, delay)
+}
+
+func (c *singleClient) DuplicateReplicateGroup(
+	tags []string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
+
+	b, err := json.Marshal(DuplicateReplicateRequest{
+		Dependencies: dependencies,
+		Delay:        delay,
+		Aliases:      tags[1:],
+	})
 	if err != nil {
 		return fmt.Errorf("json marshal: %s", err)
 	}
 	_, err = httputil.Post(
 		fmt.Sprintf(
 			"http://%s/internal/duplicate/remotes/tags/%s/digest/%s",
-			c.addr, url.PathEscape(tag), d.String()),
+			c.addr, url.PathEscape(tags[0]), d.String()),
 		httputil.SendBody(bytes.NewReader(b)),
 		httputil.SendTimeout(10*time.Second),
 		httputil.SendRetry(),
@@ -258,17 +352,24 @@ func (c *singleClient) DuplicateReplicate(
 // DuplicatePutRequest defines a DuplicatePut request body.
 type DuplicatePutRequest struct {
 	Delay time.Duration `json:"delay"`
+
+	// Aliases are written as a group with the tag in the request path.
+	Aliases []string `json:"aliases,omitempty"`
 }
 
 func (c *singleClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
-	b, err := json.Marshal(DuplicatePutRequest{delay})
+	return c.DuplicatePutGroup([]string{tag}, d, delay)
+}
+
+func (c *singleClient) DuplicatePutGroup(tags []string, d core.Digest, delay time.Duration) error {
+	b, err := json.Marshal(DuplicatePutRequest{Delay: delay, Aliases: tags[1:]})
 	if err != nil {
 		return fmt.Errorf("json marshal: %s", err)
 	}
 	_, err = httputil.Put(
 		fmt.Sprintf(
 			"http://%s/internal/duplicate/tags/%s/digest/%s",
-			c.addr, url.PathEscape(tag), d.String()),
+			c.addr, url.PathEscape(tags[0]), d.String()),
 		httputil.SendBody(bytes.NewReader(b)),
 		httputil.SendTimeout(10*time.Second),
 		httputil.SendRetry(),
@@ -276,6 +377,14 @@ func (c *singleClient) DuplicatePut(tag string, d core.Digest, delay time.Durati
 	return err
 }
 
+func (c *singleClient) InvalidateCache(tag string) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf("http://%s/internal/cache/tags/%s", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(5*time.Second),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
 func (c *singleClient) Origin() (string, error) {
 	resp, err := httputil.Get(
 		fmt.Sprintf("http://%s/origin", c.addr),
@@ -292,6 +401,69 @@ func (c *singleClient) Origin() (string, error) {
 	return string(b), nil
 }
 
+func (c *singleClient) ReportInventory(agent string, summary tagmodels.InventorySummary) error {
+	return c.putInventory("inventory/agents", agent, summary)
+}
+
+func (c *singleClient) DuplicateReportInventory(
+	agent string, summary tagmodels.InventorySummary) error {
+
+	return c.putInventory("internal/duplicate/inventory/agents", agent, summary)
+}
+
+func (c *singleClient) putInventory(
+	path string, agent string, summary tagmodels.InventorySummary) error {
+
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/%s/%s", c.addr, path, url.PathEscape(agent)),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls))
+	return err
+}
+
+func (c *singleClient) DistributionStatus(tag string) (tagmodels.DistributionStatus, error) {
+	var status tagmodels.DistributionStatus
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/tags/%s/distribution", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return status, ErrTagNotFound
+		}
+		return status, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("json decode: %s", err)
+	}
+	return status, nil
+}
+
+func (c *singleClient) ReplicationStatus(tag string) (tagmodels.ReplicationStatus, error) {
+	var status tagmodels.ReplicationStatus
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/tags/%s/replication", c.addr, url.PathEscape(tag)),
+		httputil.SendTimeout(30*time.Second),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return status, ErrTagNotFound
+		}
+		return status, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("json decode: %s", err)
+	}
+	return status, nil
+}
+
 type clusterClient struct {
 	hosts healthcheck.List
 	tls   *tls.Config
@@ -304,12 +476,12 @@ func NewClusterClient(hosts healthcheck.List, config *tls.Config) Client {
 }
 
 func (cc *clusterClient) do(request func(c Client) error) error {
-	addrs := cc.hosts.Resolve().Sample(3)
+	addrs := hostlist.Sample(cc.hosts, 3)
 	if len(addrs) == 0 {
 		return errors.New("cluster client: no hosts could be resolved")
 	}
 	var err error
-	for addr := range addrs {
+	for _, addr := range addrs {
 		err = request(NewSingleClient(addr, cc.tls))
 		if httputil.IsNetworkError(err) {
 			cc.hosts.Failed(addr)
@@ -320,16 +492,13 @@ func (cc *clusterClient) do(request func(c Client) error) error {
 	return err
 }
 
-// doOnce tries the request on only one randomly chosen client without any retries if it fails.
+// doOnce tries the request on only the most preferred client without any retries if it fails.
 func (cc *clusterClient) doOnce(request func(c Client) error) error {
-	addrs := cc.hosts.Resolve().Sample(1)
+	addrs := hostlist.Sample(cc.hosts, 1)
 	if len(addrs) == 0 {
 		return errors.New("cluster client: no hosts could be resolved")
 	}
-	// read the only sampled addr
-	var addr string
-	for addr = range addrs {
-	}
+	addr := addrs[0]
 	err := request(NewSingleClient(addr, cc.tls))
 	if httputil.IsNetworkError(err) {
 		cc.hosts.Failed(addr)
@@ -355,6 +524,18 @@ func (cc *clusterClient) PutAndReplicate(tag string, d core.Digest) error {
 	return cc.do(func(c Client) error { return c.PutAndReplicate(tag, d) })
 }
 
+func (cc *clusterClient) PutIfMatch(tag string, expected, d core.Digest) error {
+	return cc.do(func(c Client) error { return c.PutIfMatch(tag, expected, d) })
+}
+
+func (cc *clusterClient) PutGroup(tags []string, d core.Digest) error {
+	return cc.do(func(c Client) error { return c.PutGroup(tags, d) })
+}
+
+func (cc *clusterClient) PutGroupAndReplicate(tags []string, d core.Digest) error {
+	return cc.do(func(c Client) error { return c.PutGroupAndReplicate(tags, d) })
+}
+
 func (cc *clusterClient) Get(tag string) (d core.Digest, err error) {
 	err = cc.do(func(c Client) error {
 		d, err = c.Get(tag)
@@ -419,6 +600,32 @@ func (cc *clusterClient) Origin() (origin string, err error) {
 	return
 }
 
+func (cc *clusterClient) ReportInventory(
+	agent string, summary tagmodels.InventorySummary) error {
+
+	return cc.do(func(c Client) error { return c.ReportInventory(agent, summary) })
+}
+
+func (cc *clusterClient) DistributionStatus(
+	tag string) (status tagmodels.DistributionStatus, err error) {
+
+	err = cc.do(func(c Client) error {
+		status, err = c.DistributionStatus(tag)
+		return err
+	})
+	return
+}
+
+func (cc *clusterClient) ReplicationStatus(
+	tag string) (status tagmodels.ReplicationStatus, err error) {
+
+	err = cc.do(func(c Client) error {
+		status, err = c.ReplicationStatus(tag)
+		return err
+	})
+	return
+}
+
 func (cc *clusterClient) DuplicateReplicate(
 	tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
 
@@ -428,3 +635,27 @@ func (cc *clusterClient) DuplicateReplicate(
 func (cc *clusterClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
 	return errors.New("duplicate put not supported on cluster client")
 }
+
+func (cc *clusterClient) DuplicateReplicateGroup(
+	tags []string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
+
+	return errors.New("duplicate replicate group not supported on cluster client")
+}
+
+func (cc *clusterClient) DuplicatePutGroup(tags []string, d core.Digest, delay time.Duration) error {
+	return errors.New("duplicate put group not supported on cluster client")
+}
+
+func (cc *clusterClient) ConditionalPut(tag string, expected, d core.Digest) error {
+	return errors.New("conditional put not supported on cluster client")
+}
+
+func (cc *clusterClient) InvalidateCache(tag string) error {
+	return errors.New("invalidate cache not supported on cluster client")
+}
+
+func (cc *clusterClient) DuplicateReportInventory(
+	agent string, summary tagmodels.InventorySummary) error {
+
+	return errors.New("duplicate report inventory not supported on cluster client")
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevents
+
+import "time"
+
+// Config defines tag event notification configuration.
+type Config struct {
+	// QueueSize is the number of events buffered before new events are
+	// dropped.
+	QueueSize int `yaml:"queue_size"`
+
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Kafka    []KafkaConfig   `yaml:"kafka"`
+}
+
+// WebhookConfig defines an HTTP webhook sink.
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+
+	// Secret, if set, is used to sign event bodies with HMAC-SHA256. The
+	// signature is sent in the X-Kraken-Signature header.
+	Secret string `yaml:"secret"`
+
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c WebhookConfig) applyDefaults() WebhookConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	return c
+}
+
+// KafkaConfig defines a Kafka topic sink. Events are produced through a
+// Kafka REST Proxy.
+type KafkaConfig struct {
+	RestProxyURL string        `yaml:"rest_proxy_url"`
+	Topic        string        `yaml:"topic"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+func (c KafkaConfig) applyDefaults() KafkaConfig {
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	return c
+}
+
+func (c Config) applyDefaults() Config {
+	if c.QueueSize == 0 {
+		c.QueueSize = 1000
+	}
+	return c
+}
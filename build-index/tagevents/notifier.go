@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevents
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// Event types.
+const (
+	TypePut       = "put"
+	TypeReplicate = "replicate"
+)
+
+// Event describes a change to a tag.
+type Event struct {
+	Type         string          `json:"type"`
+	Tag          string          `json:"tag"`
+	Digest       core.Digest     `json:"digest"`
+	Dependencies core.DigestList `json:"dependencies"`
+	Time         time.Time       `json:"time"`
+}
+
+// NewEvent creates a new Event of type typ.
+func NewEvent(typ, tag string, d core.Digest, deps core.DigestList) Event {
+	return Event{
+		Type:         typ,
+		Tag:          tag,
+		Digest:       d,
+		Dependencies: deps,
+		Time:         time.Now(),
+	}
+}
+
+// Notifier publishes tag events to external sinks.
+type Notifier interface {
+	Notify(e Event)
+}
+
+// sink delivers a single event to some external system.
+type sink interface {
+	name() string
+	send(e Event) error
+}
+
+type notifier struct {
+	stats  tally.Scope
+	sinks  []sink
+	events chan Event
+}
+
+// New creates a new Notifier which asynchronously delivers events to all sinks
+// configured in config. Events are dropped if the queue is full, such that a
+// slow sink never blocks tag writes.
+func New(config Config, stats tally.Scope) (Notifier, error) {
+	config = config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "tagevents",
+	})
+
+	var sinks []sink
+	for _, c := range config.Webhooks {
+		if c.URL == "" {
+			return nil, errors.New("webhook url required")
+		}
+		sinks = append(sinks, newWebhookSink(c))
+	}
+	for _, c := range config.Kafka {
+		if c.RestProxyURL == "" || c.Topic == "" {
+			return nil, errors.New("kafka rest_proxy_url and topic required")
+		}
+		sinks = append(sinks, newKafkaSink(c))
+	}
+	if len(sinks) == 0 {
+		return NoopNotifier{}, nil
+	}
+	n := &notifier{
+		stats:  stats,
+		sinks:  sinks,
+		events: make(chan Event, config.QueueSize),
+	}
+	go n.loop()
+	return n, nil
+}
+
+// Notify enqueues e for delivery.
+func (n *notifier) Notify(e Event) {
+	select {
+	case n.events <- e:
+	default:
+		n.stats.Counter("dropped").Inc(1)
+	}
+}
+
+func (n *notifier) loop() {
+	for e := range n.events {
+		for _, s := range n.sinks {
+			stats := n.stats.Tagged(map[string]string{"sink": s.name()})
+			if err := s.send(e); err != nil {
+				stats.Counter("send_errors").Inc(1)
+				log.With("tag", e.Tag, "sink", s.name()).Errorf(
+					"Error sending tag event: %s", err)
+				continue
+			}
+			stats.Counter("sent").Inc(1)
+		}
+	}
+}
+
+// NoopNotifier discards all events.
+type NoopNotifier struct{}
+
+// Notify is a no-op.
+func (NoopNotifier) Notify(Event) {}
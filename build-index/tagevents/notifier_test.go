@@ -0,0 +1,153 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevents
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type request struct {
+	path    string
+	headers http.Header
+	body    []byte
+}
+
+func startRecorder() (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests <- request{r.URL.Path, r.Header, b}
+	}))
+	return s, requests
+}
+
+func receive(t *testing.T, requests chan request) request {
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return request{}
+}
+
+func TestNewWithoutSinksReturnsNoop(t *testing.T) {
+	n, err := New(Config{}, tally.NoopScope)
+	require.NoError(t, err)
+	require.Equal(t, NoopNotifier{}, n)
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	_, err := New(Config{Webhooks: []WebhookConfig{{}}}, tally.NoopScope)
+	require.Error(t, err)
+
+	_, err = New(Config{Kafka: []KafkaConfig{{RestProxyURL: "http://localhost"}}}, tally.NoopScope)
+	require.Error(t, err)
+}
+
+func TestWebhookSignsEvents(t *testing.T) {
+	require := require.New(t)
+
+	s, requests := startRecorder()
+	defer s.Close()
+
+	secret := "some-secret"
+	n, err := New(Config{
+		Webhooks: []WebhookConfig{{URL: s.URL + "/hook", Secret: secret}},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	d := core.DigestFixture()
+	deps := core.DigestList{d, core.DigestFixture()}
+	n.Notify(NewEvent(TypePut, "repo:tag", d, deps))
+
+	r := receive(t, requests)
+	require.Equal("/hook", r.path)
+	require.Equal(TypePut, r.headers.Get("X-Kraken-Event"))
+	require.Equal("sha256="+Sign([]byte(secret), r.body), r.headers.Get("X-Kraken-Signature"))
+
+	var e Event
+	require.NoError(json.Unmarshal(r.body, &e))
+	require.Equal(TypePut, e.Type)
+	require.Equal("repo:tag", e.Tag)
+	require.Equal(d, e.Digest)
+	require.Equal(deps, e.Dependencies)
+}
+
+func TestWebhookWithoutSecretIsUnsigned(t *testing.T) {
+	require := require.New(t)
+
+	s, requests := startRecorder()
+	defer s.Close()
+
+	n, err := New(Config{Webhooks: []WebhookConfig{{URL: s.URL}}}, tally.NoopScope)
+	require.NoError(err)
+
+	n.Notify(NewEvent(TypeReplicate, "repo:tag", core.DigestFixture(), nil))
+
+	r := receive(t, requests)
+	require.Equal(TypeReplicate, r.headers.Get("X-Kraken-Event"))
+	require.Empty(r.headers.Get("X-Kraken-Signature"))
+}
+
+func TestKafkaProducesToTopic(t *testing.T) {
+	require := require.New(t)
+
+	s, requests := startRecorder()
+	defer s.Close()
+
+	n, err := New(Config{
+		Kafka: []KafkaConfig{{RestProxyURL: s.URL, Topic: "kraken-tags"}},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	d := core.DigestFixture()
+	n.Notify(NewEvent(TypePut, "repo:tag", d, core.DigestList{d}))
+
+	r := receive(t, requests)
+	require.Equal("/topics/kraken-tags", r.path)
+	require.Equal("application/vnd.kafka.json.v2+json", r.headers.Get("Content-Type"))
+
+	var req kafkaProduceRequest
+	require.NoError(json.Unmarshal(r.body, &req))
+	require.Len(req.Records, 1)
+	require.Equal("repo:tag", req.Records[0].Key)
+	require.Equal(d, req.Records[0].Value.Digest)
+}
+
+func TestNotifyDropsEventsWhenQueueFull(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	n := &notifier{
+		stats:  stats,
+		events: make(chan Event, 1),
+	}
+	e := NewEvent(TypePut, "repo:tag", core.DigestFixture(), nil)
+	n.Notify(e)
+	n.Notify(e)
+
+	require.Len(n.events, 1)
+	require.Equal(int64(1), stats.Snapshot().Counters()["dropped+"].Value())
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagevents
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+type webhookSink struct {
+	config WebhookConfig
+}
+
+func newWebhookSink(config WebhookConfig) *webhookSink {
+	return &webhookSink{config.applyDefaults()}
+}
+
+func (s *webhookSink) name() string { return "webhook" }
+
+func (s *webhookSink) send(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	headers := map[string]string{
+		"Content-Type":   "application/json",
+		"X-Kraken-Event": e.Type,
+	}
+	if s.config.Secret != "" {
+		headers["X-Kraken-Signature"] = "sha256=" + Sign([]byte(s.config.Secret), b)
+	}
+	_, err = httputil.Post(
+		s.config.URL,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeaders(headers),
+		httputil.SendTimeout(s.config.Timeout))
+	return err
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body keyed by secret, as sent
+// in the X-Kraken-Signature header of webhook requests.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type kafkaSink struct {
+	config KafkaConfig
+}
+
+func newKafkaSink(config KafkaConfig) *kafkaSink {
+	return &kafkaSink{config.applyDefaults()}
+}
+
+func (s *kafkaSink) name() string { return "kafka" }
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Event  `json:"value"`
+}
+
+type kafkaProduceRequest struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+func (s *kafkaSink) send(e Event) error {
+	// Keying records by tag keeps events for the same tag in one partition,
+	// preserving their order.
+	b, err := json.Marshal(kafkaProduceRequest{
+		Records: []kafkaRecord{{Key: e.Tag, Value: e}},
+	})
+	if err != nil {
+		return fmt.Errorf("json: %s", err)
+	}
+	_, err = httputil.Post(
+		fmt.Sprintf("%s/topics/%s", strings.TrimRight(s.config.RestProxyURL, "/"), s.config.Topic),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeader("Content-Type", "application/vnd.kafka.json.v2+json"),
+		httputil.SendTimeout(s.config.Timeout))
+	return err
+}
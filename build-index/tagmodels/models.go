@@ -17,6 +17,8 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+
+	"github.com/uber/kraken/core"
 )
 
 const (
@@ -57,3 +59,88 @@ func (resp ListResponse) GetOffset() (string, error) {
 	}
 	return offset, nil
 }
+
+// InventorySummary models an agent's report of the blobs in its cache.
+// StreamContentType is the Accept header value which makes list endpoints
+// stream ListStreamEntry values as newline delimited JSON, instead of
+// responding with a single ListResponse.
+const StreamContentType = "application/x-ndjson"
+
+// ListStreamEntry is a line of a streamed list response. The last line of a
+// stream which failed midway holds Error instead of Name.
+type ListStreamEntry struct {
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type InventorySummary struct {
+	Digests []core.Digest `json:"digests"`
+}
+
+// DistributionStatus models tagserver response to distribution status
+// requests, reporting how many registered agents have all layers of a tag
+// cached.
+type DistributionStatus struct {
+	Tag            string      `json:"tag"`
+	Digest         core.Digest `json:"digest"`
+	Layers         int         `json:"layers"`
+	Agents         int         `json:"agents"`
+	CompleteAgents int         `json:"complete_agents"`
+}
+
+// BulkReplicateRequest models requests to replicate all tags under Prefix
+// whose names match the optional Pattern, a path.Match glob, to their
+// remotes. If Remote is set, only tasks to that remote are enqueued.
+type BulkReplicateRequest struct {
+	Prefix  string `json:"prefix"`
+	Pattern string `json:"pattern,omitempty"`
+	Remote  string `json:"remote,omitempty"`
+}
+
+// BulkReplicateStatus models tagserver response to bulk replication status
+// requests, reporting the progress of the latest bulk replication job.
+type BulkReplicateStatus struct {
+	BulkReplicateRequest
+
+	Running  bool   `json:"running"`
+	Tags     int    `json:"tags"`
+	Tasks    int    `json:"tasks"`
+	Failures int    `json:"failures"`
+	Denied   int    `json:"denied"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Replication states of a tag on a remote.
+const (
+	ReplicationPending = "pending"
+	ReplicationDone    = "done"
+)
+
+// ReplicationStatus models tagserver response to replication status
+// requests, reporting whether each remote of a tag points it to Digest.
+type ReplicationStatus struct {
+	Tag     string                    `json:"tag"`
+	Digest  core.Digest               `json:"digest"`
+	Remotes []RemoteReplicationStatus `json:"remotes"`
+}
+
+// RemoteReplicationStatus reports the replication of a tag to a single
+// remote. Failures counts failed attempts of the replication task queued on
+// the build-index which served the request.
+type RemoteReplicationStatus struct {
+	Remote   string `json:"remote"`
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	Denied   int    `json:"denied"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Done returns whether every remote points the tag to its digest.
+func (s ReplicationStatus) Done() bool {
+	for _, r := range s.Remotes {
+		if r.State != ReplicationDone {
+			return false
+		}
+	}
+	return true
+}
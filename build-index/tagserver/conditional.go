@@ -0,0 +1,141 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"hash/fnv"
+	"net/http"
+	"sort"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// conditionalCandidates returns the build-index nodes which may perform
+// conditional puts of tag, ordered by rendezvous hashing over the cluster. The
+// first candidate is the leader of tag, and the rest are tried in order when
+// the leader cannot be reached, such that all nodes fail over to the same node.
+func (s *Server) conditionalCandidates(tag string) []string {
+	if s.cluster == nil {
+		return nil
+	}
+	type candidate struct {
+		addr  string
+		score uint64
+	}
+	var candidates []candidate
+	for addr := range s.cluster.Resolve() {
+		h := fnv.New64a()
+		h.Write([]byte(addr))
+		h.Write([]byte{0})
+		h.Write([]byte(tag))
+		candidates = append(candidates, candidate{addr, h.Sum64()})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].addr < candidates[j].addr
+	})
+	addrs := make([]string, len(candidates))
+	for i, c := range candidates {
+		addrs[i] = c.addr
+	}
+	return addrs
+}
+
+// conditionalLeader returns the build-index node which performs all
+// conditional puts of tag, chosen by rendezvous hashing over the cluster, such
+// that concurrent conditional puts of a tag through different nodes are
+// serialized on one node. Returns false if this node is the leader, or if no
+// cluster is configured.
+func (s *Server) conditionalLeader(tag string) (string, bool) {
+	candidates := s.conditionalCandidates(tag)
+	if len(candidates) == 0 || !s.neighbors.Resolve().Has(candidates[0]) {
+		// Addresses of the cluster which are not neighbors are this node.
+		return "", false
+	}
+	return candidates[0], true
+}
+
+// putTagIfMatch writes tag only if it currently points to expected. The write
+// is forwarded to the leader of tag unless this node is the leader. If the
+// leader cannot be reached, the write is forwarded to the next candidate
+// instead.
+func (s *Server) putTagIfMatch(
+	tag string, d core.Digest, deps core.DigestList, expected core.Digest) error {
+
+	neighbors := s.neighbors.Resolve()
+	candidates := s.conditionalCandidates(tag)
+	for i, addr := range candidates {
+		if !neighbors.Has(addr) {
+			// Addresses of the cluster which are not neighbors are this node.
+			return s.putTag(tag, d, deps, &expected)
+		}
+		err := s.provider.Provide(addr).ConditionalPut(tag, expected, d)
+		if err == tagclient.ErrTagConflict {
+			return handler.Errorf(
+				"tag %s does not match expected digest", tag).Status(http.StatusPreconditionFailed)
+		} else if httputil.IsNetworkError(err) && i < len(candidates)-1 {
+			log.With("tag", tag, "leader", addr).Warnf(
+				"Error forwarding conditional put, trying next candidate: %s", err)
+			s.stats.Counter("conditional_leader_failovers").Inc(1)
+			if l, ok := s.cluster.(healthcheck.List); ok {
+				l.Failed(addr)
+			}
+			continue
+		} else if err != nil {
+			return handler.Errorf("forward conditional put to leader %s: %s", addr, err)
+		}
+		return nil
+	}
+	return s.putTag(tag, d, deps, &expected)
+}
+
+// conditionalPutTagHandler performs a conditional put forwarded by another
+// build-index node, without forwarding it again, such that nodes with
+// diverging views of the cluster cannot forward puts in a loop.
+func (s *Server) conditionalPutTagHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	expected, _, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+	if expected == nil {
+		return handler.Errorf("precondition required").Status(http.StatusPreconditionRequired)
+	}
+	if err := s.acl.CheckWrite(r, "conditional_put", tag); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusForbidden)
+	}
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		return handler.Errorf("resolve dependencies: %s", err)
+	}
+	if err := s.putTag(tag, d, deps, expected); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
@@ -16,6 +16,7 @@ package tagserver
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/utils/listener"
 )
 
@@ -24,6 +25,13 @@ type Config struct {
 	Listener                  listener.Config `yaml:"listener"`
 	DuplicateReplicateStagger time.Duration   `yaml:"duplicate_replicate_stagger"`
 	DuplicatePutStagger       time.Duration   `yaml:"duplicate_put_stagger"`
+
+	// BulkReplicateTagsPerSec limits the rate at which bulk replication jobs
+	// enqueue tags for replication.
+	BulkReplicateTagsPerSec float64 `yaml:"bulk_replicate_tags_per_sec"`
+
+	// Authz restricts endpoints, e.g. /internal/, to client identities.
+	Authz middleware.AuthzConfig `yaml:"authz"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -33,5 +41,8 @@ func (c Config) applyDefaults() Config {
 	if c.DuplicatePutStagger == 0 {
 		c.DuplicatePutStagger = 20 * time.Minute
 	}
+	if c.BulkReplicateTagsPerSec == 0 {
+		c.BulkReplicateTagsPerSec = 20
+	}
 	return c
 }
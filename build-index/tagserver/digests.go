@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// listTagsByDigestHandler returns a JSON list of the tags which point at the
+// given digest.
+func (s *Server) listTagsByDigestHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	tags, err := s.store.ListByDigest(d)
+	if err != nil {
+		if err == tagstore.ErrDigestIndexDisabled {
+			return handler.Errorf("%s", err).Status(http.StatusNotImplemented)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// reindexDigestsHandler starts a background job which adds all tags under the
+// `prefix` query arg to the digest index. Only one job may run at a time.
+func (s *Server) reindexDigestsHandler(w http.ResponseWriter, r *http.Request) error {
+	prefix := httputil.GetQueryArg(r, "prefix", "")
+	if prefix == "" {
+		return handler.Errorf("query arg `prefix` required").Status(http.StatusBadRequest)
+	}
+	if !s.reindexing.CAS(false, true) {
+		return handler.Errorf("reindex already running").Status(http.StatusConflict)
+	}
+	go func() {
+		defer s.reindexing.Store(false)
+
+		log.With("prefix", prefix).Info("Reindexing digests")
+		n, err := s.store.Reindex(prefix)
+		if err != nil {
+			s.stats.Counter("reindex_errors").Inc(1)
+			log.With("prefix", prefix, "indexed", n).Errorf("Error reindexing digests: %s", err)
+			return
+		}
+		log.With("prefix", prefix, "indexed", n).Info("Reindexed digests")
+	}()
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
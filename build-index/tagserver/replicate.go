@@ -0,0 +1,207 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/persistedretry/tagreplication"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+
+	"golang.org/x/time/rate"
+)
+
+// bulkReplicateHandler starts a background job which enqueues replication of
+// all tags under a prefix to their remotes, e.g. to backfill a newly added
+// remote. Only one job may run at a time. Request model
+// tagmodels.BulkReplicateRequest.
+func (s *Server) bulkReplicateHandler(w http.ResponseWriter, r *http.Request) error {
+	var req tagmodels.BulkReplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	if req.Prefix == "" {
+		return handler.Errorf("prefix required").Status(http.StatusBadRequest)
+	}
+	if req.Pattern != "" {
+		if _, err := path.Match(req.Pattern, ""); err != nil {
+			return handler.Errorf("invalid pattern: %s", err).Status(http.StatusBadRequest)
+		}
+	}
+	if err := s.acl.CheckWrite(r, "replicate", req.Prefix); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusForbidden)
+	}
+	client, err := s.backends.GetClient(req.Prefix)
+	if err != nil {
+		return handler.Errorf("backend manager: %s", err)
+	}
+
+	s.bulkReplicateMu.Lock()
+	defer s.bulkReplicateMu.Unlock()
+
+	if s.bulkReplicateStatus != nil && s.bulkReplicateStatus.Running {
+		return handler.Errorf("bulk replication already running").Status(http.StatusConflict)
+	}
+	status := &tagmodels.BulkReplicateStatus{BulkReplicateRequest: req, Running: true}
+	s.bulkReplicateStatus = status
+
+	// Tags under prefix may belong to namespaces with stricter rules than
+	// prefix, so each tag is checked against the credentials of r again.
+	go s.bulkReplicate(r.Clone(context.Background()), client, status)
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// getBulkReplicateHandler reports the progress of the latest bulk replication
+// job. Response model tagmodels.BulkReplicateStatus.
+func (s *Server) getBulkReplicateHandler(w http.ResponseWriter, r *http.Request) error {
+	s.bulkReplicateMu.Lock()
+	var status tagmodels.BulkReplicateStatus
+	ok := s.bulkReplicateStatus != nil
+	if ok {
+		status = *s.bulkReplicateStatus
+	}
+	s.bulkReplicateMu.Unlock()
+
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// bulkReplicate enqueues replication of the tags listed under the prefix of
+// status, updating status as it goes. Tags which the ACL denies r to write are
+// skipped.
+func (s *Server) bulkReplicate(
+	r *http.Request, client backend.Client, status *tagmodels.BulkReplicateStatus) {
+	req := status.BulkReplicateRequest
+	logger := log.With("prefix", req.Prefix, "pattern", req.Pattern, "remote", req.Remote)
+	logger.Info("Starting bulk replication")
+
+	limiter := rate.NewLimiter(rate.Limit(s.config.BulkReplicateTagsPerSec), 1)
+
+	err := s.listAll(client, req.Prefix, func(tag string) {
+		if req.Pattern != "" {
+			if ok, _ := path.Match(req.Pattern, tag); !ok {
+				return
+			}
+		}
+		if err := s.acl.CheckWrite(r, "replicate", tag); err != nil {
+			s.bulkReplicateMu.Lock()
+			status.Tags++
+			status.Denied++
+			s.bulkReplicateMu.Unlock()
+			return
+		}
+		if err := limiter.Wait(context.Background()); err != nil {
+			logger.Errorf("Error waiting for bulk replication limiter: %s", err)
+		}
+		n, err := s.enqueueReplication(tag, req.Remote)
+		if err != nil {
+			s.stats.Counter("bulk_replicate_failures").Inc(1)
+			log.With("tag", tag).Errorf("Error enqueuing bulk replication: %s", err)
+		}
+		s.stats.Counter("bulk_replicate_tasks").Inc(int64(n))
+
+		s.bulkReplicateMu.Lock()
+		status.Tags++
+		status.Tasks += n
+		if err != nil {
+			status.Failures++
+		}
+		s.bulkReplicateMu.Unlock()
+	})
+
+	s.bulkReplicateMu.Lock()
+	status.Running = false
+	if err != nil {
+		status.Error = err.Error()
+	}
+	logger = logger.With(
+		"tags", status.Tags, "tasks", status.Tasks, "failures", status.Failures, "denied", status.Denied)
+	s.bulkReplicateMu.Unlock()
+
+	if err != nil {
+		logger.Errorf("Error listing tags for bulk replication: %s", err)
+		return
+	}
+	logger.Info("Finished bulk replication")
+}
+
+// listAll calls f for every name under prefix, following continuation tokens.
+func (s *Server) listAll(client backend.Client, prefix string, f func(name string)) error {
+	var token string
+	for {
+		result, err := client.List(
+			prefix, backend.ListWithPagination(), backend.ListWithContinuationToken(token))
+		if err != nil {
+			return fmt.Errorf("list: %s", err)
+		}
+		for _, name := range result.Names {
+			f(name)
+		}
+		token = result.ContinuationToken
+		if token == "" {
+			return nil
+		}
+	}
+}
+
+// enqueueReplication adds tasks replicating tag to its remotes, or only to
+// remote if set. Returns the number of tasks added. Unlike replicateTag, tasks
+// are not duplicated to neighbors, since bulk replication can be repeated.
+func (s *Server) enqueueReplication(tag, remote string) (int, error) {
+	destinations := s.remotes.Match(tag)
+	if remote != "" {
+		if !s.remotes.Valid(tag, remote) {
+			return 0, nil
+		}
+		destinations = []string{remote}
+	}
+	if len(destinations) == 0 {
+		return 0, nil
+	}
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("storage: %s", err)
+	}
+	deps, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		return 0, fmt.Errorf("resolve dependencies: %s", err)
+	}
+	var n int
+	for _, dest := range destinations {
+		task := tagreplication.NewTask(tag, d, deps, dest, 0)
+		if err := s.tagReplicationManager.Add(task); err != nil {
+			return n, fmt.Errorf("add replicate task: %s", err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -22,20 +22,28 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/uber/kraken/build-index/inventory"
+	"github.com/uber/kraken/build-index/tagacl"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagevents"
 	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/build-index/tagstore"
 	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/buildinfo"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/maintenance"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/listener"
@@ -44,6 +52,7 @@ import (
 	"github.com/go-chi/chi"
 	chimiddleware "github.com/go-chi/chi/middleware"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 )
 
 // Server provides tag operations for the build-index.
@@ -56,6 +65,10 @@ type Server struct {
 	neighbors         hostlist.List
 	store             tagstore.Store
 
+	// For choosing the leader of conditional puts. Nil if conditional puts are
+	// performed on the node which receives them.
+	cluster hostlist.List
+
 	// For async new tag replication.
 	remotes               tagreplication.Remotes
 	tagReplicationManager persistedretry.Manager
@@ -63,6 +76,46 @@ type Server struct {
 
 	// For checking if a tag has all dependent blobs.
 	depResolver tagtype.DependencyResolver
+
+	// For reporting tag distribution status across agents.
+	inventory inventory.Registry
+
+	// For publishing tag change events to external systems.
+	notifier tagevents.Notifier
+
+	// For rejecting writes during maintenance.
+	maintenance *maintenance.Mode
+
+	// For rejecting writes from clients not allowed to write a namespace.
+	acl *tagacl.ACL
+
+	// Whether a digest reindex job is running.
+	reindexing atomic.Bool
+
+	// Status of the latest bulk replication job.
+	bulkReplicateMu     sync.Mutex
+	bulkReplicateStatus *tagmodels.BulkReplicateStatus
+}
+
+// Option defines an optional Server parameter.
+type Option func(*Server)
+
+// WithMaintenance configures a Server to reject writes while m is in read-only
+// mode.
+func WithMaintenance(m *maintenance.Mode) Option {
+	return func(s *Server) { s.maintenance = m }
+}
+
+// WithCluster configures a Server to forward conditional puts of each tag to
+// a single leader chosen from cluster, which must contain this node and all
+// neighbors.
+func WithCluster(cluster hostlist.List) Option {
+	return func(s *Server) { s.cluster = cluster }
+}
+
+// WithACL configures a Server to reject tag writes which acl denies.
+func WithACL(acl *tagacl.ACL) Option {
+	return func(s *Server) { s.acl = acl }
 }
 
 // New creates a new Server.
@@ -77,7 +130,10 @@ func New(
 	remotes tagreplication.Remotes,
 	tagReplicationManager persistedretry.Manager,
 	provider tagclient.Provider,
-	depResolver tagtype.DependencyResolver) *Server {
+	depResolver tagtype.DependencyResolver,
+	inventory inventory.Registry,
+	notifier tagevents.Notifier,
+	opts ...Option) *Server {
 
 	config = config.applyDefaults()
 
@@ -85,7 +141,7 @@ func New(
 		"module": "tagserver",
 	})
 
-	return &Server{
+	s := &Server{
 		config:                config,
 		stats:                 stats,
 		backends:              backends,
@@ -97,7 +153,15 @@ func New(
 		tagReplicationManager: tagReplicationManager,
 		provider:              provider,
 		depResolver:           depResolver,
+		inventory:             inventory,
+		notifier:              notifier,
+		maintenance:           maintenance.Disabled(),
+		acl:                   tagacl.Disabled(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Handler returns an http.Handler for s.
@@ -106,19 +170,33 @@ func (s *Server) Handler() http.Handler {
 
 	r.Use(middleware.StatusCounter(s.stats))
 	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Recovery(s.stats))
+	// Flag overrides are restricted to identities allowed by authz rules.
+	r.Use(middleware.Authorize(s.config.Authz, s.stats, "/x/config/flags/"))
+	r.Use(s.maintenance.Middleware)
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
 	r.Get("/readiness", handler.Wrap(s.readinessCheckHandler))
+	r.Get("/version", buildinfo.Handler(buildinfo.BuildIndex))
 
 	r.Put("/tags/{tag}/digest/{digest}", handler.Wrap(s.putTagHandler))
 	r.Head("/tags/{tag}", handler.Wrap(s.hasTagHandler))
 	r.Get("/tags/{tag}", handler.Wrap(s.getTagHandler))
+	r.Get("/tags/{tag}/distribution", handler.Wrap(s.getDistributionStatusHandler))
+	r.Get("/tags/{tag}/replication", handler.Wrap(s.getReplicationStatusHandler))
+
+	r.Get("/digests/{digest}/tags", handler.Wrap(s.listTagsByDigestHandler))
+
+	r.Put("/inventory/agents/{agent}", handler.Wrap(s.reportInventoryHandler))
 
 	r.Get("/repositories/{repo}/tags", handler.Wrap(s.listRepositoryHandler))
 
 	r.Get("/list/*", handler.Wrap(s.listHandler))
 
 	r.Post("/remotes/tags/{tag}", handler.Wrap(s.replicateTagHandler))
+	r.Post("/remotes/replicate", handler.Wrap(s.bulkReplicateHandler))
+	r.Get("/remotes/replicate", handler.Wrap(s.getBulkReplicateHandler))
 
 	r.Get("/origin", handler.Wrap(s.getOriginHandler))
 
@@ -130,6 +208,22 @@ func (s *Server) Handler() http.Handler {
 		"/internal/duplicate/tags/{tag}/digest/{digest}",
 		handler.Wrap(s.duplicatePutTagHandler))
 
+	r.Put(
+		"/internal/conditional/tags/{tag}/digest/{digest}",
+		handler.Wrap(s.conditionalPutTagHandler))
+
+	r.Put(
+		"/internal/duplicate/inventory/agents/{agent}",
+		handler.Wrap(s.duplicateReportInventoryHandler))
+
+	r.Delete("/internal/cache/tags/{tag}", handler.Wrap(s.invalidateTagCacheHandler))
+
+	r.Mount("/x/config/flags", featureflag.Handler())
+	r.Mount("/x/config/tracing", tracing.Handler())
+	r.Mount(maintenance.Path, s.maintenance.Handler())
+
+	r.Post("/x/digests/reindex", handler.Wrap(s.reindexDigestsHandler))
+
 	r.Mount("/debug", chimiddleware.Profiler())
 
 	return r
@@ -172,17 +266,39 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return handler.Errorf("parse query arg `replicate`: %s", err)
 	}
+	expected, conflict, err := parseIfMatch(r)
+	if err != nil {
+		return err
+	}
+	tags := tagGroup(tag, r.URL.Query()["alias"])
+	if len(tags) > 1 && expected != nil {
+		return handler.Errorf(
+			"conditional writes are not supported with aliases").Status(http.StatusBadRequest)
+	}
+	if err := s.acl.CheckWrite(r, "put", tags...); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusForbidden)
+	}
 
 	deps, err := s.depResolver.Resolve(tag, d)
 	if err != nil {
 		return fmt.Errorf("resolve dependencies: %s", err)
 	}
-	if err := s.putTag(tag, d, deps); err != nil {
+	if len(tags) > 1 {
+		err = s.putTagGroup(tags, d, deps)
+	} else if expected != nil {
+		err = s.putTagIfMatch(tag, d, deps, *expected)
+		if herr, ok := err.(*handler.Error); ok && herr.GetStatus() == http.StatusPreconditionFailed {
+			err = herr.Status(conflict)
+		}
+	} else {
+		err = s.putTag(tag, d, deps, nil)
+	}
+	if err != nil {
 		return err
 	}
 
 	if replicate {
-		if err := s.replicateTag(tag, d, deps); err != nil {
+		if err := s.replicateTagGroup(tags, d, deps); err != nil {
 			return err
 		}
 	}
@@ -190,6 +306,20 @@ func (s *Server) putTagHandler(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// tagGroup returns tag followed by its distinct aliases.
+func tagGroup(tag string, aliases []string) []string {
+	tags := []string{tag}
+	seen := map[string]bool{tag: true}
+	for _, alias := range aliases {
+		if alias == "" || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		tags = append(tags, alias)
+	}
+	return tags
+}
+
 func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
@@ -206,7 +336,16 @@ func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request)
 	}
 	delay := req.Delay
 
-	if err := s.store.Put(tag, d, delay); err != nil {
+	tags := tagGroup(tag, req.Aliases)
+	if err := s.acl.CheckWrite(r, "duplicate_put", tags...); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusForbidden)
+	}
+	if len(tags) > 1 {
+		err = s.store.PutGroup(tags, d, delay)
+	} else {
+		err = s.store.Put(tag, d, delay)
+	}
+	if err != nil {
 		return handler.Errorf("storage: %s", err)
 	}
 
@@ -214,6 +353,16 @@ func (s *Server) duplicatePutTagHandler(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
+func (s *Server) invalidateTagCacheHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+	s.store.Invalidate(tag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
 func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
@@ -228,6 +377,7 @@ func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) error {
 		return handler.Errorf("storage: %s", err)
 	}
 
+	w.Header().Set("ETag", fmt.Sprintf("%q", d.String()))
 	if _, err := io.WriteString(w, d.String()); err != nil {
 		return handler.Errorf("write digest: %s", err)
 	}
@@ -268,6 +418,10 @@ func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if wantsStream(r) {
+		return s.streamList(w, r, client, prefix, opts, nil)
+	}
+
 	result, err := client.List(prefix, opts...)
 	if err != nil {
 		return handler.Errorf("error listing from backend: %s", err)
@@ -303,20 +457,21 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
-	result, err := client.List(path.Join(repo, "_manifests/tags"), opts...)
+	prefix := path.Join(repo, "_manifests/tags")
+	if wantsStream(r) {
+		return s.streamList(w, r, client, prefix, opts, repoTag)
+	}
+
+	result, err := client.List(prefix, opts...)
 	if err != nil {
 		return handler.Errorf("error listing from backend: %s", err)
 	}
 
 	var tags []string
 	for _, name := range result.Names {
-		// Strip repo prefix.
-		parts := strings.Split(name, ":")
-		if len(parts) != 2 {
-			log.With("name", name).Warn("Repo list skipping name, expected repo:tag format")
-			continue
+		if tag, ok := repoTag(name); ok {
+			tags = append(tags, tag)
 		}
-		tags = append(tags, parts[1])
 	}
 
 	resp, err := buildPaginationResponse(r.URL, result.ContinuationToken, tags)
@@ -329,11 +484,24 @@ func (s *Server) listRepositoryHandler(w http.ResponseWriter, r *http.Request) e
 	return nil
 }
 
+// repoTag strips the repo prefix from a repo:tag name.
+func repoTag(name string) (string, bool) {
+	parts := strings.Split(name, ":")
+	if len(parts) != 2 {
+		log.With("name", name).Warn("Repo list skipping name, expected repo:tag format")
+		return "", false
+	}
+	return parts[1], true
+}
+
 func (s *Server) replicateTagHandler(w http.ResponseWriter, r *http.Request) error {
 	tag, err := httputil.ParseParam(r, "tag")
 	if err != nil {
 		return err
 	}
+	if err := s.acl.CheckWrite(r, "replicate", tag); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusForbidden)
+	}
 
 	d, err := s.store.Get(tag)
 	if err != nil {
@@ -367,10 +535,14 @@ func (s *Server) duplicateReplicateTagHandler(w http.ResponseWriter, r *http.Req
 		return handler.Errorf("decode body: %s", err)
 	}
 
+	tags := tagGroup(tag, req.Aliases)
+	if err := s.acl.CheckWrite(r, "duplicate_replicate", tags...); err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusForbidden)
+	}
 	destinations := s.remotes.Match(tag)
 
 	for _, dest := range destinations {
-		task := tagreplication.NewTask(tag, d, req.Dependencies, dest, req.Delay)
+		task := tagreplication.NewGroupTask(tags, d, req.Dependencies, dest, req.Delay)
 		if err := s.tagReplicationManager.Add(task); err != nil {
 			return handler.Errorf("add replicate task: %s", err)
 		}
@@ -379,6 +551,122 @@ func (s *Server) duplicateReplicateTagHandler(w http.ResponseWriter, r *http.Req
 	return nil
 }
 
+// getDistributionStatusHandler reports how many registered agents have all
+// layers of a tag cached. Response model tagmodels.DistributionStatus.
+func (s *Server) getDistributionStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	layers, err := s.depResolver.Resolve(tag, d)
+	if err != nil {
+		return handler.Errorf("resolve dependencies: %s", err)
+	}
+	agents, complete := s.inventory.Coverage(layers)
+
+	status := tagmodels.DistributionStatus{
+		Tag:            tag,
+		Digest:         d,
+		Layers:         len(layers),
+		Agents:         agents,
+		CompleteAgents: complete,
+	}
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getReplicationStatusHandler reports whether each remote of a tag points it
+// to the local digest. Response model tagmodels.ReplicationStatus.
+func (s *Server) getReplicationStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	tag, err := httputil.ParseParam(r, "tag")
+	if err != nil {
+		return err
+	}
+
+	d, err := s.store.Get(tag)
+	if err != nil {
+		if err == tagstore.ErrTagNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("storage: %s", err)
+	}
+	tasks, err := s.tagReplicationManager.Find(tagreplication.NewTagQuery(tag))
+	if err != nil {
+		return handler.Errorf("find replicate tasks: %s", err)
+	}
+	failures := make(map[string]int)
+	for _, t := range tasks {
+		task := t.(*tagreplication.Task)
+		failures[task.Destination] = task.Failures
+	}
+
+	status := tagmodels.ReplicationStatus{Tag: tag, Digest: d}
+	for _, dest := range s.remotes.Match(tag) {
+		rs := tagmodels.RemoteReplicationStatus{
+			Remote:   dest,
+			State:    tagmodels.ReplicationPending,
+			Failures: failures[dest],
+		}
+		remote, err := s.provider.Provide(dest).Get(tag)
+		if err == nil && remote == d {
+			rs.State = tagmodels.ReplicationDone
+		} else if err != nil && err != tagclient.ErrTagNotFound {
+			rs.Error = err.Error()
+		}
+		status.Remotes = append(status.Remotes, rs)
+	}
+	if err := json.NewEncoder(w).Encode(&status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) reportInventoryHandler(w http.ResponseWriter, r *http.Request) error {
+	agent, err := httputil.ParseParam(r, "agent")
+	if err != nil {
+		return err
+	}
+	var summary tagmodels.InventorySummary
+	if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	s.inventory.Report(agent, summary.Digests)
+
+	for addr := range s.neighbors.Resolve() {
+		if err := s.provider.Provide(addr).DuplicateReportInventory(agent, summary); err != nil {
+			log.Errorf("Error duplicating inventory report to %s: %s", addr, err)
+			s.stats.Counter("duplicate_inventory_failures").Inc(1)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) duplicateReportInventoryHandler(w http.ResponseWriter, r *http.Request) error {
+	agent, err := httputil.ParseParam(r, "agent")
+	if err != nil {
+		return err
+	}
+	var summary tagmodels.InventorySummary
+	if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	s.inventory.Report(agent, summary.Digests)
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
 func (s *Server) getOriginHandler(w http.ResponseWriter, r *http.Request) error {
 	if _, err := io.WriteString(w, s.localOriginDNS); err != nil {
 		return handler.Errorf("write local origin dns: %s", err)
@@ -386,7 +674,43 @@ func (s *Server) getOriginHandler(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
-func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
+// parseIfMatch parses the optional precondition on the current digest of the
+// tag. The precondition is read from the `If-Match` header, which holds the
+// expected digest (optionally quoted, as returned in the ETag of getTag), or
+// from `If-None-Match: *`, which requires the tag to not exist yet. The
+// `if_match` query arg is accepted as well, with the special value "none"
+// meaning the tag must not exist. Returns nil if the write is unconditional.
+// Also returns the status of failed preconditions: 412 for the headers, and
+// 409 for the query arg, which older clients expect.
+func parseIfMatch(r *http.Request) (*core.Digest, int, error) {
+	if r.Header.Get("If-None-Match") == "*" {
+		return &core.Digest{}, http.StatusPreconditionFailed, nil
+	}
+	if v := r.Header.Get("If-Match"); v != "" {
+		d, err := core.ParseDigest(strings.Trim(v, `"`))
+		if err != nil {
+			return nil, 0, handler.Errorf(
+				"parse header `If-Match`: %s", err).Status(http.StatusBadRequest)
+		}
+		return &d, http.StatusPreconditionFailed, nil
+	}
+	v := httputil.GetQueryArg(r, "if_match", "")
+	switch v {
+	case "":
+		return nil, 0, nil
+	case "none":
+		return &core.Digest{}, http.StatusConflict, nil
+	}
+	d, err := core.ParseDigest(v)
+	if err != nil {
+		return nil, 0, handler.Errorf(
+			"parse query arg `if_match`: %s", err).Status(http.StatusBadRequest)
+	}
+	return &d, http.StatusConflict, nil
+}
+
+// checkDependencies returns an error if any of deps is missing from origin.
+func (s *Server) checkDependencies(tag string, deps core.DigestList) error {
 	for _, dep := range deps {
 		if _, err := s.localOriginClient.Stat(tag, dep); err == blobclient.ErrBlobNotFound {
 			return handler.Errorf("cannot upload tag, missing dependency %s", dep)
@@ -394,11 +718,50 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 			return handler.Errorf("check blob: %s", err)
 		}
 	}
+	return nil
+}
 
-	if err := s.store.Put(tag, d, 0); err != nil {
+// putTag writes tag and duplicates the write to neighbors. If expected is
+// non-nil, the write only succeeds if tag currently points to *expected.
+func (s *Server) putTag(
+	tag string, d core.Digest, deps core.DigestList, expected *core.Digest) error {
+
+	if err := s.checkDependencies(tag, deps); err != nil {
+		return err
+	}
+
+	if expected != nil {
+		if err := s.store.PutIfMatch(tag, *expected, d, 0); err != nil {
+			if err == tagstore.ErrTagConflict {
+				return handler.Errorf(
+					"tag %s does not match expected digest", tag).Status(http.StatusPreconditionFailed)
+			}
+			return handler.Errorf("storage: %s", err)
+		}
+	} else if err := s.store.Put(tag, d, 0); err != nil {
 		return handler.Errorf("storage: %s", err)
 	}
 
+	s.duplicatePut([]string{tag}, d, deps)
+	return nil
+}
+
+// putTagGroup atomically writes all of tags and duplicates the group write to
+// neighbors.
+func (s *Server) putTagGroup(tags []string, d core.Digest, deps core.DigestList) error {
+	if err := s.checkDependencies(tags[0], deps); err != nil {
+		return err
+	}
+	if err := s.store.PutGroup(tags, d, 0); err != nil {
+		return handler.Errorf("storage: %s", err)
+	}
+	s.duplicatePut(tags, d, deps)
+	return nil
+}
+
+// duplicatePut duplicates a write of tags to neighbors, and notifies
+// listeners of each written tag.
+func (s *Server) duplicatePut(tags []string, d core.Digest, deps core.DigestList) {
 	neighbors := s.neighbors.Resolve()
 
 	var delay time.Duration
@@ -406,7 +769,20 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	for addr := range neighbors {
 		delay += s.config.DuplicatePutStagger
 		client := s.provider.Provide(addr)
-		if err := client.DuplicatePut(tag, d, delay); err != nil {
+		// Neighbors may have a stale digest cached if tag was overwritten.
+		for _, tag := range tags {
+			if err := client.InvalidateCache(tag); err != nil {
+				log.Errorf("Error invalidating tag cache on %s: %s", addr, err)
+				s.stats.Counter("invalidate_cache_failures").Inc(1)
+			}
+		}
+		var err error
+		if len(tags) > 1 {
+			err = client.DuplicatePutGroup(tags, d, delay)
+		} else {
+			err = client.DuplicatePut(tags[0], d, delay)
+		}
+		if err != nil {
 			log.Errorf("Error duplicating put task to %s: %s", addr, err)
 		} else {
 			successes++
@@ -415,17 +791,25 @@ func (s *Server) putTag(tag string, d core.Digest, deps core.DigestList) error {
 	if len(neighbors) != 0 && successes == 0 {
 		s.stats.Counter("duplicate_put_failures").Inc(1)
 	}
-	return nil
+	for _, tag := range tags {
+		s.notifier.Notify(tagevents.NewEvent(tagevents.TypePut, tag, d, deps))
+	}
 }
 
 func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) error {
-	destinations := s.remotes.Match(tag)
+	return s.replicateTagGroup([]string{tag}, d, deps)
+}
+
+// replicateTagGroup replicates tags as a group to the remotes of the first
+// tag, such that remotes write the whole group atomically.
+func (s *Server) replicateTagGroup(tags []string, d core.Digest, deps core.DigestList) error {
+	destinations := s.remotes.Match(tags[0])
 	if len(destinations) == 0 {
 		return nil
 	}
 
 	for _, dest := range destinations {
-		task := tagreplication.NewTask(tag, d, deps, dest, 0)
+		task := tagreplication.NewGroupTask(tags, d, deps, dest, 0)
 		if err := s.tagReplicationManager.Add(task); err != nil {
 			return handler.Errorf("add replicate task: %s", err)
 		}
@@ -438,7 +822,13 @@ func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) e
 	for addr := range neighbors { // Loops in random order.
 		delay += s.config.DuplicateReplicateStagger
 		client := s.provider.Provide(addr)
-		if err := client.DuplicateReplicate(tag, d, deps, delay); err != nil {
+		var err error
+		if len(tags) > 1 {
+			err = client.DuplicateReplicateGroup(tags, d, deps, delay)
+		} else {
+			err = client.DuplicateReplicate(tags[0], d, deps, delay)
+		}
+		if err != nil {
 			log.Errorf("Error duplicating replicate task to %s: %s", addr, err)
 		} else {
 			successes++
@@ -447,6 +837,9 @@ func (s *Server) replicateTag(tag string, d core.Digest, deps core.DigestList) e
 	if len(neighbors) != 0 && successes == 0 {
 		s.stats.Counter("duplicate_replicate_failures").Inc(1)
 	}
+	for _, tag := range tags {
+		s.notifier.Notify(tagevents.NewEvent(tagevents.TypeReplicate, tag, d, deps))
+	}
 	return nil
 }
 
@@ -14,8 +14,11 @@
 package tagserver
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -24,23 +27,35 @@ import (
 	"testing"
 	"time"
 
+	"github.com/uber/kraken/build-index/inventory"
+	"github.com/uber/kraken/build-index/tagacl"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagevents"
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/build-index/tagstore"
+	"github.com/uber/kraken/build-index/tagtype"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/ingest"
+	"github.com/uber/kraken/lib/maintenance"
+	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/tagreplication"
 	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/mocks/build-index/tagevents"
 	"github.com/uber/kraken/mocks/build-index/tagstore"
 	"github.com/uber/kraken/mocks/build-index/tagtype"
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/mocks/lib/persistedretry"
 	"github.com/uber/kraken/mocks/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/randutil"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
@@ -65,6 +80,8 @@ type serverMocks struct {
 	originClient          *mockblobclient.MockClusterClient
 	store                 *mocktagstore.MockStore
 	neighbors             hostlist.List
+	inventory             inventory.Registry
+	notifier              tagevents.Notifier
 }
 
 func newServerMocks(t *testing.T) (*serverMocks, func()) {
@@ -107,6 +124,8 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 		depResolver:           depResolver,
 		store:                 store,
 		neighbors:             hostlist.Fixture(_testNeighbor),
+		inventory:             inventory.NewRegistry(inventory.Config{}, clock.NewMock()),
+		notifier:              tagevents.NoopNotifier{},
 	}, cleanup.Run
 }
 
@@ -114,7 +133,17 @@ func (m *serverMocks) client() *mocktagclient.MockClient {
 	return mocktagclient.NewMockClient(m.ctrl)
 }
 
-func (m *serverMocks) handler() http.Handler {
+func (m *serverMocks) handler(opts ...Option) http.Handler {
+	return m.server(opts...).Handler()
+}
+
+func (m *serverMocks) server(opts ...Option) *Server {
+	return m.serverWithResolver(m.depResolver, opts...)
+}
+
+func (m *serverMocks) serverWithResolver(
+	depResolver tagtype.DependencyResolver, opts ...Option) *Server {
+
 	return New(
 		m.config,
 		tally.NoopScope,
@@ -126,7 +155,10 @@ func (m *serverMocks) handler() http.Handler {
 		m.remotes,
 		m.tagReplicationManager,
 		m.provider,
-		m.depResolver).Handler()
+		depResolver,
+		m.inventory,
+		m.notifier,
+		opts...)
 }
 
 func newClusterClient(addr string) tagclient.Client {
@@ -232,109 +264,71 @@ func TestPut(t *testing.T) {
 	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
 	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
 	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
 	neighborClient.EXPECT().DuplicatePut(
 		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
 
 	require.NoError(client.Put(tag, digest))
 }
 
-func TestPutInvalidParam(t *testing.T) {
-	tag := core.TagFixture()
+func TestPutDerivedTagWithDockerTagTypes(t *testing.T) {
+	tag := ingest.DerivedTag("gzip_to_zstd", core.DigestFixture())
 	digest := core.DigestFixture()
 
-	tests := []struct {
-		desc   string
-		path   string
-		status int
-	}{
-		{
-			"empty tag",
-			fmt.Sprintf("tags//digest/%s", digest),
-			http.StatusBadRequest,
-		}, {
-			"invalid digest",
-			fmt.Sprintf("tags/%s/digest/foo", url.PathEscape(tag)),
-			http.StatusBadRequest,
-		}, {
-			"invalid replicate param",
-			fmt.Sprintf("tags/%s/digest/%s?replicate=bar", url.PathEscape(tag), digest),
-			http.StatusInternalServerError,
-		},
+	// Derived blobs are layers, not manifests.
+	layer := func(namespace string, d core.Digest, dst io.Writer) error {
+		_, err := dst.Write(randutil.Blob(64))
+		return err
 	}
-	for _, test := range tests {
-		t.Run(test.desc, func(t *testing.T) {
-			require := require.New(t)
-
-			mocks, cleanup := newServerMocks(t)
-			defer cleanup()
-
-			addr, stop := testutil.StartServer(mocks.handler())
-			defer stop()
 
-			_, err := httputil.Put(fmt.Sprintf("http://%s/%s", addr, test.path))
-			require.Error(err)
-			require.True(httputil.IsStatus(err, test.status))
-		})
-	}
-}
+	t.Run("catch-all docker type", func(t *testing.T) {
+		require := require.New(t)
 
-func TestDuplicatePut(t *testing.T) {
-	require := require.New(t)
+		mocks, cleanup := newServerMocks(t)
+		defer cleanup()
 
-	mocks, cleanup := newServerMocks(t)
-	defer cleanup()
+		resolver, err := tagtype.NewMap([]tagtype.Config{
+			{Namespace: ".*", Type: "docker"},
+		}, mocks.originClient)
+		require.NoError(err)
 
-	addr, stop := testutil.StartServer(mocks.handler())
-	defer stop()
+		addr, stop := testutil.StartServer(mocks.serverWithResolver(resolver).Handler())
+		defer stop()
 
-	client := tagclient.NewSingleClient(addr, nil)
+		mocks.originClient.EXPECT().DownloadBlob(tag, digest, gomock.Any()).DoAndReturn(layer)
 
-	tag := core.TagFixture()
-	digest := core.DigestFixture()
-	delay := 5 * time.Minute
+		require.Error(newClusterClient(addr).Put(tag, digest))
+	})
 
-	mocks.store.EXPECT().Put(tag, digest, delay).Return(nil)
+	t.Run("default type for derived tags", func(t *testing.T) {
+		require := require.New(t)
 
-	require.NoError(client.DuplicatePut(tag, digest, delay))
-}
+		mocks, cleanup := newServerMocks(t)
+		defer cleanup()
 
-func TestDuplicatePutInvalidParam(t *testing.T) {
-	tag := core.TagFixture()
-	digest := core.DigestFixture()
+		resolver, err := tagtype.NewMap([]tagtype.Config{
+			{Namespace: "^kraken-derived/.*", Type: "default"},
+			{Namespace: ".*", Type: "docker"},
+		}, mocks.originClient)
+		require.NoError(err)
 
-	tests := []struct {
-		desc   string
-		path   string
-		status int
-	}{
-		{
-			"empty tag",
-			fmt.Sprintf("internal/duplicate/tags//digest/%s", digest),
-			http.StatusBadRequest,
-		}, {
-			"invalid digest",
-			fmt.Sprintf("internal/duplicate/tags/%s/digest/foo", url.PathEscape(tag)),
-			http.StatusBadRequest,
-		},
-	}
-	for _, test := range tests {
-		t.Run(test.desc, func(t *testing.T) {
-			require := require.New(t)
+		addr, stop := testutil.StartServer(mocks.serverWithResolver(resolver).Handler())
+		defer stop()
 
-			mocks, cleanup := newServerMocks(t)
-			defer cleanup()
+		neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-			addr, stop := testutil.StartServer(mocks.handler())
-			defer stop()
+		mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+		mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+		neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+		neighborClient.EXPECT().DuplicatePut(
+			tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
 
-			_, err := httputil.Put(fmt.Sprintf("http://%s/%s", addr, test.path))
-			require.Error(err)
-			require.True(httputil.IsStatus(err, test.status))
-		})
-	}
+		require.NoError(newClusterClient(addr).Put(tag, digest))
+	})
 }
 
-func TestGet(t *testing.T) {
+func TestPutIfMatch(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -346,16 +340,22 @@ func TestGet(t *testing.T) {
 	client := newClusterClient(addr)
 
 	tag := core.TagFixture()
+	expected := core.DigestFixture()
 	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(tag, expected, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
 
-	result, err := client.Get(tag)
-	require.NoError(err)
-	require.Equal(digest, result)
+	require.NoError(client.PutIfMatch(tag, expected, digest))
 }
 
-func TestGetTagNotFound(t *testing.T) {
+func TestGetAndPutIfMatchSHA512(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -367,137 +367,170 @@ func TestGetTagNotFound(t *testing.T) {
 	client := newClusterClient(addr)
 
 	tag := core.TagFixture()
+	expected := core.SizedBlobFixtureForAlgo(64, 64, core.SHA512).Digest
+	digest := core.SizedBlobFixtureForAlgo(64, 64, core.SHA512).Digest
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+	mocks.store.EXPECT().Get(tag).Return(expected, nil)
 
-	_, err := client.Get(tag)
-	require.Equal(tagclient.ErrTagNotFound, err)
+	result, err := client.Get(tag)
+	require.NoError(err)
+	require.Equal(expected, result)
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(tag, expected, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
+
+	require.NoError(client.PutIfMatch(tag, expected, digest))
 }
 
-func TestHas(t *testing.T) {
+// tagWithLeader returns a tag whose conditional puts are led by leader in
+// cluster.
+func tagWithLeader(s *Server, leader string) string {
+	for {
+		tag := core.TagFixture()
+		addr, ok := s.conditionalLeader(tag)
+		if (leader == "" && !ok) || (ok && addr == leader) {
+			return tag
+		}
+	}
+}
+
+func TestPutIfMatchForwardsToLeader(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
 	defer cleanup()
 
-	addr, stop := testutil.StartServer(mocks.handler())
+	opt := WithCluster(hostlist.Fixture("self:3000", _testNeighbor))
+
+	addr, stop := testutil.StartServer(mocks.handler(opt))
 	defer stop()
 
 	client := newClusterClient(addr)
 
-	tag := core.TagFixture()
+	tag := tagWithLeader(mocks.server(opt), _testNeighbor)
+	expected := core.DigestFixture()
 	digest := core.DigestFixture()
+	leaderClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-	mocks.backendClient.EXPECT().Stat(tag, tag).Return(core.NewBlobInfo(int64(len(digest.String()))), nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(leaderClient)
+	leaderClient.EXPECT().ConditionalPut(tag, expected, digest).Return(nil)
 
-	ok, err := client.Has(tag)
-	require.NoError(err)
-	require.True(ok)
+	require.NoError(client.PutIfMatch(tag, expected, digest))
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(leaderClient)
+	leaderClient.EXPECT().ConditionalPut(
+		tag, expected, digest).Return(tagclient.ErrTagConflict)
+
+	require.Equal(tagclient.ErrTagConflict, client.PutIfMatch(tag, expected, digest))
 }
 
-func TestHasNotFound(t *testing.T) {
+func TestPutIfMatchFailsOverToNextCandidateWhenLeaderUnreachable(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
 	defer cleanup()
 
-	addr, stop := testutil.StartServer(mocks.handler())
+	opt := WithCluster(hostlist.Fixture("self:3000", _testNeighbor))
+
+	addr, stop := testutil.StartServer(mocks.handler(opt))
 	defer stop()
 
 	client := newClusterClient(addr)
 
-	tag := core.TagFixture()
+	// With two nodes, the next candidate after the neighbor is this node.
+	tag := tagWithLeader(mocks.server(opt), _testNeighbor)
+	expected := core.DigestFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-	mocks.backendClient.EXPECT().Stat(tag, tag).Return(nil, backenderrors.ErrBlobNotFound)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient).Times(2)
+	neighborClient.EXPECT().ConditionalPut(
+		tag, expected, digest).Return(httputil.NetworkError{})
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(tag, expected, digest, time.Duration(0)).Return(nil)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
 
-	ok, err := client.Has(tag)
-	require.NoError(err)
-	require.False(ok)
+	require.NoError(client.PutIfMatch(tag, expected, digest))
 }
 
-func TestListRepository(t *testing.T) {
+func TestPutIfMatchOnLeader(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
 	defer cleanup()
 
-	addr, stop := testutil.StartServer(mocks.handler())
+	opt := WithCluster(hostlist.Fixture("self:3000", _testNeighbor))
+
+	addr, stop := testutil.StartServer(mocks.handler(opt))
 	defer stop()
 
 	client := newClusterClient(addr)
 
-	maxKeys := 3
-	repo := "namespace-foo/repo-bar"
-	tags := []string{"latest"}
-	names := []string{fmt.Sprintf("%s:%s", repo, tags[0])}
-	for i := 1; i < maxKeys*3; i++ {
-		tags = append(tags, fmt.Sprintf("00%s", strconv.Itoa(i)))
-		names = append(names, fmt.Sprintf("%s:%s", repo, tags[i]))
-	}
-
-	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags").Return(&backend.ListResult{
-		Names:             names[:maxKeys],
-		ContinuationToken: "first",
-	}, nil)
-
-	// Func values are deeply equal if both are nil; otherwise they are not deeply
-	// equal. So gomock.Any().
-	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags",
-		gomock.Any()).Return(&backend.ListResult{
-		Names:             names[maxKeys : maxKeys*2],
-		ContinuationToken: "second",
-	}, nil)
+	tag := tagWithLeader(mocks.server(opt), "")
+	expected := core.DigestFixture()
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags",
-		gomock.Any()).Return(&backend.ListResult{
-		Names: names[maxKeys*2:],
-	}, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(tag, expected, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
 
-	result, err := client.ListRepository(repo)
-	require.NoError(err)
-	require.Equal(tags, result)
+	require.NoError(client.PutIfMatch(tag, expected, digest))
 }
 
-func TestList(t *testing.T) {
+func TestConditionalPutIsNotForwarded(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
 	defer cleanup()
 
-	addr, stop := testutil.StartServer(mocks.handler())
+	opt := WithCluster(hostlist.Fixture("self:3000", _testNeighbor))
+
+	addr, stop := testutil.StartServer(mocks.handler(opt))
 	defer stop()
 
-	client := newClusterClient(addr)
+	client := tagclient.NewSingleClient(addr, nil)
 
-	maxKeys := 3
-	prefix := "namespace-foo/repo-bar/_manifests/tags"
-	names := []string{"latest"}
-	for i := 1; i < maxKeys*3; i++ {
-		names = append(names, fmt.Sprintf("00%s", strconv.Itoa(i)))
-	}
+	// Even if this node does not consider itself the leader, forwarded puts
+	// are performed locally.
+	tag := tagWithLeader(mocks.server(opt), _testNeighbor)
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
 
-	mocks.backendClient.EXPECT().List(prefix).Return(&backend.ListResult{
-		Names:             names[:maxKeys],
-		ContinuationToken: "first",
-	}, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(
+		tag, core.Digest{}, digest, time.Duration(0)).Return(tagstore.ErrTagConflict)
 
-	mocks.backendClient.EXPECT().List(prefix,
-		gomock.Any()).Return(&backend.ListResult{
-		Names:             names[maxKeys : maxKeys*2],
-		ContinuationToken: "second",
-	}, nil)
+	require.Equal(tagclient.ErrTagConflict, client.ConditionalPut(tag, core.Digest{}, digest))
 
-	mocks.backendClient.EXPECT().List(prefix,
-		gomock.Any()).Return(&backend.ListResult{
-		Names: names[maxKeys*2:],
-	}, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(tag, core.Digest{}, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
 
-	result, err := client.List(prefix)
-	require.NoError(err)
-	require.Equal(names, result)
+	require.NoError(client.ConditionalPut(tag, core.Digest{}, digest))
 }
 
-func TestListEmptyPrefix(t *testing.T) {
+func TestPutIfMatchConflict(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -508,18 +541,18 @@ func TestListEmptyPrefix(t *testing.T) {
 
 	client := newClusterClient(addr)
 
-	names := []string{"a", "b", "c"}
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
 
-	mocks.backendClient.EXPECT().List("").Return(&backend.ListResult{
-		Names: names,
-	}, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(
+		tag, core.Digest{}, digest, time.Duration(0)).Return(tagstore.ErrTagConflict)
 
-	result, err := client.List("")
-	require.NoError(err)
-	require.Equal(names, result)
+	require.Equal(tagclient.ErrTagConflict, client.PutIfMatch(tag, core.Digest{}, digest))
 }
 
-func TestPutAndReplicate(t *testing.T) {
+func TestPutIfMatchHeaderPreconditionFailed(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -528,61 +561,102 @@ func TestPutAndReplicate(t *testing.T) {
 	addr, stop := testutil.StartServer(mocks.handler())
 	defer stop()
 
-	client := newClusterClient(addr)
-
 	tag := core.TagFixture()
+	expected := core.DigestFixture()
 	digest := core.DigestFixture()
-	deps := core.DigestList{digest}
-	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
-	task := tagreplication.NewTask(tag, digest, deps, _testRemote, 0)
-	replicaClient := mocks.client()
 
-	gomock.InOrder(
-		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil),
-		mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil),
-		mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil),
-		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
-		neighborClient.EXPECT().DuplicatePut(
-			tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil),
-		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
-		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
-		replicaClient.EXPECT().DuplicateReplicate(
-			tag, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil),
-	)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutIfMatch(
+		tag, expected, digest, time.Duration(0)).Return(tagstore.ErrTagConflict)
 
-	require.NoError(client.PutAndReplicate(tag, digest))
+	_, err := httputil.Put(
+		fmt.Sprintf("http://%s/tags/%s/digest/%s", addr, url.PathEscape(tag), digest),
+		httputil.SendHeader("If-Match", fmt.Sprintf("%q", expected)))
+	require.True(httputil.IsPreconditionFailed(err))
 }
 
-func TestReplicate(t *testing.T) {
-	require := require.New(t)
+func TestPutIfMatchQueryArgConflict(t *testing.T) {
+	tag := core.TagFixture()
+	expected := core.DigestFixture()
+	digest := core.DigestFixture()
 
-	mocks, cleanup := newServerMocks(t)
-	defer cleanup()
+	for _, tc := range []struct {
+		desc     string
+		ifMatch  string
+		expected core.Digest
+	}{
+		{"digest", expected.String(), expected},
+		{"none", "none", core.Digest{}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			require := require.New(t)
 
-	addr, stop := testutil.StartServer(mocks.handler())
-	defer stop()
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
 
-	client := newClusterClient(addr)
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+			mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+			mocks.store.EXPECT().PutIfMatch(
+				tag, tc.expected, digest, time.Duration(0)).Return(tagstore.ErrTagConflict)
 
+			// Older clients expect 409 rather than 412.
+			_, err := httputil.Put(fmt.Sprintf(
+				"http://%s/tags/%s/digest/%s?if_match=%s",
+				addr, url.PathEscape(tag), digest, url.QueryEscape(tc.ifMatch)))
+			require.True(httputil.IsConflict(err))
+		})
+	}
+}
+
+func TestPutInvalidParam(t *testing.T) {
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
-	deps := core.DigestList{digest}
-	task := tagreplication.NewTask(tag, digest, deps, _testRemote, 0)
-	replicaClient := mocks.client()
 
-	gomock.InOrder(
-		mocks.store.EXPECT().Get(tag).Return(digest, nil),
-		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil),
-		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
-		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
-		replicaClient.EXPECT().DuplicateReplicate(
-			tag, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil),
-	)
+	tests := []struct {
+		desc   string
+		path   string
+		status int
+	}{
+		{
+			"empty tag",
+			fmt.Sprintf("tags//digest/%s", digest),
+			http.StatusBadRequest,
+		}, {
+			"invalid digest",
+			fmt.Sprintf("tags/%s/digest/foo", url.PathEscape(tag)),
+			http.StatusBadRequest,
+		}, {
+			"invalid replicate param",
+			fmt.Sprintf("tags/%s/digest/%s?replicate=bar", url.PathEscape(tag), digest),
+			http.StatusInternalServerError,
+		}, {
+			"invalid if_match param",
+			fmt.Sprintf("tags/%s/digest/%s?if_match=bar", url.PathEscape(tag), digest),
+			http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
 
-	require.NoError(client.Replicate(tag))
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := httputil.Put(fmt.Sprintf("http://%s/%s", addr, test.path))
+			require.Error(err)
+			require.True(httputil.IsStatus(err, test.status))
+		})
+	}
 }
 
-func TestReplicateNotFound(t *testing.T) {
+func TestDuplicatePut(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -591,20 +665,18 @@ func TestReplicateNotFound(t *testing.T) {
 	addr, stop := testutil.StartServer(mocks.handler())
 	defer stop()
 
-	client := newClusterClient(addr)
+	client := tagclient.NewSingleClient(addr, nil)
 
 	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	delay := 5 * time.Minute
 
-	gomock.InOrder(
-		mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound),
-	)
+	mocks.store.EXPECT().Put(tag, digest, delay).Return(nil)
 
-	err := client.Replicate(tag)
-	require.Error(err)
-	require.True(httputil.IsNotFound(err))
+	require.NoError(client.DuplicatePut(tag, digest, delay))
 }
 
-func TestDuplicateReplicate(t *testing.T) {
+func TestDuplicatePutGroup(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -615,18 +687,34 @@ func TestDuplicateReplicate(t *testing.T) {
 
 	client := tagclient.NewSingleClient(addr, nil)
 
-	tag := core.TagFixture()
+	tags := []string{core.TagFixture(), core.TagFixture()}
 	digest := core.DigestFixture()
-	dependencies := core.DigestListFixture(3)
 	delay := 5 * time.Minute
-	task := tagreplication.NewTask(tag, digest, dependencies, _testRemote, delay)
 
-	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil)
+	mocks.store.EXPECT().PutGroup(tags, digest, delay).Return(nil)
 
-	require.NoError(client.DuplicateReplicate(tag, digest, dependencies, delay))
+	require.NoError(client.DuplicatePutGroup(tags, digest, delay))
 }
 
-func TestDuplicateReplicateInvalidParam(t *testing.T) {
+func TestInvalidateCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().Invalidate(tag)
+
+	require.NoError(client.InvalidateCache(tag))
+}
+
+func TestDuplicatePutInvalidParam(t *testing.T) {
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
 
@@ -637,12 +725,12 @@ func TestDuplicateReplicateInvalidParam(t *testing.T) {
 	}{
 		{
 			"empty tag",
-			fmt.Sprintf("internal/duplicate/remotes/tags//digest/%s", digest),
+			fmt.Sprintf("internal/duplicate/tags//digest/%s", digest),
 			http.StatusBadRequest,
 		}, {
 			"invalid digest",
-			fmt.Sprintf("internal/duplicate/remotes/tags/%s/digest/foo", url.PathEscape(tag)),
-			http.StatusInternalServerError,
+			fmt.Sprintf("internal/duplicate/tags/%s/digest/foo", url.PathEscape(tag)),
+			http.StatusBadRequest,
 		},
 	}
 	for _, test := range tests {
@@ -655,23 +743,78 @@ func TestDuplicateReplicateInvalidParam(t *testing.T) {
 			addr, stop := testutil.StartServer(mocks.handler())
 			defer stop()
 
-			_, err := httputil.Post(fmt.Sprintf("http://%s/%s", addr, test.path))
+			_, err := httputil.Put(fmt.Sprintf("http://%s/%s", addr, test.path))
 			require.Error(err)
 			require.True(httputil.IsStatus(err, test.status))
 		})
 	}
 }
 
-func TestNoopReplicate(t *testing.T) {
+func TestGet(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
 	defer cleanup()
 
-	emptyRemotes, err := tagreplication.RemotesConfig{}.Build()
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+
+	result, err := client.Get(tag)
 	require.NoError(err)
+	require.Equal(digest, result)
+}
 
-	mocks.remotes = emptyRemotes
+func TestGetSetsETag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/tags/%s", addr, url.PathEscape(tag)))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(fmt.Sprintf("%q", digest), resp.Header.Get("ETag"))
+}
+
+func TestGetTagNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+
+	_, err := client.Get(tag)
+	require.Equal(tagclient.ErrTagNotFound, err)
+}
+
+func TestHas(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
 
 	addr, stop := testutil.StartServer(mocks.handler())
 	defer stop()
@@ -680,19 +823,35 @@ func TestNoopReplicate(t *testing.T) {
 
 	tag := core.TagFixture()
 	digest := core.DigestFixture()
-	deps := core.DigestList{digest}
 
-	gomock.InOrder(
-		mocks.store.EXPECT().Get(tag).Return(digest, nil),
-		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil),
-	)
+	mocks.backendClient.EXPECT().Stat(tag, tag).Return(core.NewBlobInfo(int64(len(digest.String()))), nil)
 
-	// No replication tasks added or duplicated because no remotes are configured.
+	ok, err := client.Has(tag)
+	require.NoError(err)
+	require.True(ok)
+}
 
-	require.NoError(client.Replicate(tag))
+func TestHasNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.backendClient.EXPECT().Stat(tag, tag).Return(nil, backenderrors.ErrBlobNotFound)
+
+	ok, err := client.Has(tag)
+	require.NoError(err)
+	require.False(ok)
 }
 
-func TestOrigin(t *testing.T) {
+func TestListRepository(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newServerMocks(t)
@@ -703,7 +862,1088 @@ func TestOrigin(t *testing.T) {
 
 	client := newClusterClient(addr)
 
-	result, err := client.Origin()
+	maxKeys := 3
+	repo := "namespace-foo/repo-bar"
+	tags := []string{"latest"}
+	names := []string{fmt.Sprintf("%s:%s", repo, tags[0])}
+	for i := 1; i < maxKeys*3; i++ {
+		tags = append(tags, fmt.Sprintf("00%s", strconv.Itoa(i)))
+		names = append(names, fmt.Sprintf("%s:%s", repo, tags[i]))
+	}
+
+	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags").Return(&backend.ListResult{
+		Names:             names[:maxKeys],
+		ContinuationToken: "first",
+	}, nil)
+
+	// Func values are deeply equal if both are nil; otherwise they are not deeply
+	// equal. So gomock.Any().
+	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags",
+		gomock.Any()).Return(&backend.ListResult{
+		Names:             names[maxKeys : maxKeys*2],
+		ContinuationToken: "second",
+	}, nil)
+
+	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags",
+		gomock.Any()).Return(&backend.ListResult{
+		Names: names[maxKeys*2:],
+	}, nil)
+
+	result, err := client.ListRepository(repo)
 	require.NoError(err)
-	require.Equal(_testOrigin, result)
+	require.Equal(tags, result)
+}
+
+func TestList(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	maxKeys := 3
+	prefix := "namespace-foo/repo-bar/_manifests/tags"
+	names := []string{"latest"}
+	for i := 1; i < maxKeys*3; i++ {
+		names = append(names, fmt.Sprintf("00%s", strconv.Itoa(i)))
+	}
+
+	mocks.backendClient.EXPECT().List(prefix).Return(&backend.ListResult{
+		Names:             names[:maxKeys],
+		ContinuationToken: "first",
+	}, nil)
+
+	mocks.backendClient.EXPECT().List(prefix,
+		gomock.Any()).Return(&backend.ListResult{
+		Names:             names[maxKeys : maxKeys*2],
+		ContinuationToken: "second",
+	}, nil)
+
+	mocks.backendClient.EXPECT().List(prefix,
+		gomock.Any()).Return(&backend.ListResult{
+		Names: names[maxKeys*2:],
+	}, nil)
+
+	result, err := client.List(prefix)
+	require.NoError(err)
+	require.Equal(names, result)
+}
+
+func readStream(t *testing.T, resp *http.Response) []tagmodels.ListStreamEntry {
+	defer resp.Body.Close()
+	require.Equal(t, tagmodels.StreamContentType, resp.Header.Get("Content-Type"))
+	var entries []tagmodels.ListStreamEntry
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var e tagmodels.ListStreamEntry
+		require.NoError(t, dec.Decode(&e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestListStream(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	prefix := "namespace-foo/repo-bar/_manifests/tags"
+
+	gomock.InOrder(
+		mocks.backendClient.EXPECT().List(
+			prefix, gomock.Any(), gomock.Any(), gomock.Any()).Return(&backend.ListResult{
+			Names:             []string{"a", "b"},
+			ContinuationToken: "first",
+		}, nil),
+		mocks.backendClient.EXPECT().List(
+			prefix, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(
+			&backend.ListResult{Names: []string{"c"}}, nil),
+	)
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/list/%s?limit=2", addr, prefix),
+		httputil.SendHeaders(map[string]string{"Accept": tagmodels.StreamContentType}))
+	require.NoError(err)
+	require.Equal([]tagmodels.ListStreamEntry{
+		{Name: "a"}, {Name: "b"}, {Name: "c"},
+	}, readStream(t, resp))
+}
+
+func TestListRepositoryStream(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	repo := "namespace-foo/repo-bar"
+
+	mocks.backendClient.EXPECT().List(repo+"/_manifests/tags", gomock.Any()).Return(&backend.ListResult{
+		Names: []string{repo + ":latest", "malformed", repo + ":v1"},
+	}, nil)
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/repositories/%s/tags", addr, url.PathEscape(repo)),
+		httputil.SendHeaders(map[string]string{"Accept": tagmodels.StreamContentType}))
+	require.NoError(err)
+	require.Equal([]tagmodels.ListStreamEntry{
+		{Name: "latest"}, {Name: "v1"},
+	}, readStream(t, resp))
+}
+
+func TestListStreamBackendError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	prefix := "namespace-foo/repo-bar"
+	headers := httputil.SendHeaders(map[string]string{"Accept": tagmodels.StreamContentType})
+
+	// Errors before any page was written fail the request.
+	mocks.backendClient.EXPECT().List(prefix, gomock.Any()).Return(nil, errors.New("some error"))
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/list/%s", addr, prefix), headers)
+	require.True(httputil.IsStatus(err, http.StatusInternalServerError))
+
+	// Errors midway are reported in the stream.
+	gomock.InOrder(
+		mocks.backendClient.EXPECT().List(prefix, gomock.Any()).Return(&backend.ListResult{
+			Names:             []string{"a"},
+			ContinuationToken: "first",
+		}, nil),
+		mocks.backendClient.EXPECT().List(prefix, gomock.Any(), gomock.Any()).Return(
+			nil, errors.New("some error")),
+	)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/list/%s", addr, prefix), headers)
+	require.NoError(err)
+	require.Equal([]tagmodels.ListStreamEntry{
+		{Name: "a"}, {Error: "some error"},
+	}, readStream(t, resp))
+}
+
+func TestListEmptyPrefix(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	names := []string{"a", "b", "c"}
+
+	mocks.backendClient.EXPECT().List("").Return(&backend.ListResult{
+		Names: names,
+	}, nil)
+
+	result, err := client.List("")
+	require.NoError(err)
+	require.Equal(names, result)
+}
+
+func TestPutGroup(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tags := []string{core.TagFixture(), core.TagFixture(), core.TagFixture()}
+	digest := core.DigestFixture()
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.depResolver.EXPECT().Resolve(tags[0], digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tags[0], digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().PutGroup(tags, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	for _, tag := range tags {
+		neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	}
+	neighborClient.EXPECT().DuplicatePutGroup(
+		tags, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
+
+	// Duplicate aliases are ignored.
+	require.NoError(client.PutGroup(append(tags, tags[1]), digest))
+}
+
+func TestPutGroupWithIfMatchIsRejected(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	tag := core.TagFixture()
+	_, err := httputil.Put(
+		fmt.Sprintf(
+			"http://%s/tags/%s/digest/%s?alias=%s",
+			addr, url.PathEscape(tag), core.DigestFixture(), url.QueryEscape(core.TagFixture())),
+		httputil.SendHeaders(map[string]string{"If-None-Match": "*"}))
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestPutGroupAndReplicate(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tags := []string{core.TagFixture(), core.TagFixture()}
+	digest := core.DigestFixture()
+	deps := core.DigestList{digest}
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+	task := tagreplication.NewGroupTask(tags, digest, deps, _testRemote, 0)
+	replicaClient := mocks.client()
+
+	gomock.InOrder(
+		mocks.depResolver.EXPECT().Resolve(tags[0], digest).Return(deps, nil),
+		mocks.originClient.EXPECT().Stat(tags[0], digest).Return(core.NewBlobInfo(256), nil),
+		mocks.store.EXPECT().PutGroup(tags, digest, time.Duration(0)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
+		neighborClient.EXPECT().InvalidateCache(tags[0]).Return(nil),
+		neighborClient.EXPECT().InvalidateCache(tags[1]).Return(nil),
+		neighborClient.EXPECT().DuplicatePutGroup(
+			tags, digest, mocks.config.DuplicateReplicateStagger).Return(nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
+		replicaClient.EXPECT().DuplicateReplicateGroup(
+			tags, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil),
+	)
+
+	require.NoError(client.PutGroupAndReplicate(tags, digest))
+}
+
+func TestPutAndReplicate(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deps := core.DigestList{digest}
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+	task := tagreplication.NewTask(tag, digest, deps, _testRemote, 0)
+	replicaClient := mocks.client()
+
+	gomock.InOrder(
+		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil),
+		mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil),
+		mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient),
+		neighborClient.EXPECT().InvalidateCache(tag).Return(nil),
+		neighborClient.EXPECT().DuplicatePut(
+			tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
+		replicaClient.EXPECT().DuplicateReplicate(
+			tag, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil),
+	)
+
+	require.NoError(client.PutAndReplicate(tag, digest))
+}
+
+func TestPutAndReplicateNotifiesTagEvents(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	notifier := mocktagevents.NewMockNotifier(mocks.ctrl)
+	mocks.notifier = notifier
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deps := core.DigestList{digest}
+	neighborClient := mocktagclient.NewMockClient(mocks.ctrl)
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient).Times(2)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(
+		tag, digest, mocks.config.DuplicateReplicateStagger).Return(nil)
+	mocks.tagReplicationManager.EXPECT().Add(gomock.Any()).Return(nil)
+	neighborClient.EXPECT().DuplicateReplicate(
+		tag, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil)
+
+	var events []tagevents.Event
+	notifier.EXPECT().Notify(gomock.Any()).Do(func(e tagevents.Event) {
+		events = append(events, e)
+	}).Times(2)
+
+	require.NoError(client.PutAndReplicate(tag, digest))
+
+	require.Len(events, 2)
+	for i, typ := range []string{tagevents.TypePut, tagevents.TypeReplicate} {
+		require.Equal(typ, events[i].Type)
+		require.Equal(tag, events[i].Tag)
+		require.Equal(digest, events[i].Digest)
+		require.Equal(deps, events[i].Dependencies)
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deps := core.DigestList{digest}
+	task := tagreplication.NewTask(tag, digest, deps, _testRemote, 0)
+	replicaClient := mocks.client()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(digest, nil),
+		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil),
+		mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil),
+		mocks.provider.EXPECT().Provide(_testNeighbor).Return(replicaClient),
+		replicaClient.EXPECT().DuplicateReplicate(
+			tag, digest, deps, mocks.config.DuplicateReplicateStagger).Return(nil),
+	)
+
+	require.NoError(client.Replicate(tag))
+}
+
+func TestReplicateNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound),
+	)
+
+	err := client.Replicate(tag)
+	require.Error(err)
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestDuplicateReplicate(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	dependencies := core.DigestListFixture(3)
+	delay := 5 * time.Minute
+	task := tagreplication.NewTask(tag, digest, dependencies, _testRemote, delay)
+
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil)
+
+	require.NoError(client.DuplicateReplicate(tag, digest, dependencies, delay))
+}
+
+func TestDuplicateReplicateInvalidParam(t *testing.T) {
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	tests := []struct {
+		desc   string
+		path   string
+		status int
+	}{
+		{
+			"empty tag",
+			fmt.Sprintf("internal/duplicate/remotes/tags//digest/%s", digest),
+			http.StatusBadRequest,
+		}, {
+			"invalid digest",
+			fmt.Sprintf("internal/duplicate/remotes/tags/%s/digest/foo", url.PathEscape(tag)),
+			http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := httputil.Post(fmt.Sprintf("http://%s/%s", addr, test.path))
+			require.Error(err)
+			require.True(httputil.IsStatus(err, test.status))
+		})
+	}
+}
+
+func TestNoopReplicate(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	emptyRemotes, err := tagreplication.RemotesConfig{}.Build()
+	require.NoError(err)
+
+	mocks.remotes = emptyRemotes
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	deps := core.DigestList{digest}
+
+	gomock.InOrder(
+		mocks.store.EXPECT().Get(tag).Return(digest, nil),
+		mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil),
+	)
+
+	// No replication tasks added or duplicated because no remotes are configured.
+
+	require.NoError(client.Replicate(tag))
+}
+
+func TestOrigin(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	result, err := client.Origin()
+	require.NoError(err)
+	require.Equal(_testOrigin, result)
+}
+
+func TestReportInventoryAndDistributionStatus(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+	layer := core.DigestFixture()
+	deps := core.DigestList{layer, digest}
+
+	neighborClient := mocks.client()
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient).Times(2)
+	neighborClient.EXPECT().DuplicateReportInventory(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	require.NoError(client.ReportInventory(
+		"agent1", tagmodels.InventorySummary{Digests: []core.Digest{layer, digest}}))
+	require.NoError(client.ReportInventory(
+		"agent2", tagmodels.InventorySummary{Digests: []core.Digest{digest}}))
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil)
+
+	status, err := client.DistributionStatus(tag)
+	require.NoError(err)
+	require.Equal(tagmodels.DistributionStatus{
+		Tag:            tag,
+		Digest:         digest,
+		Layers:         2,
+		Agents:         2,
+		CompleteAgents: 1,
+	}, status)
+}
+
+func TestDistributionStatusNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+
+	_, err := client.DistributionStatus(tag)
+	require.Equal(tagclient.ErrTagNotFound, err)
+}
+
+func TestReplicationStatus(t *testing.T) {
+	tests := []struct {
+		desc     string
+		tasks    []persistedretry.Task
+		stale    bool
+		err      error
+		expected tagmodels.RemoteReplicationStatus
+	}{
+		{
+			"remote has tag",
+			nil,
+			false,
+			nil,
+			tagmodels.RemoteReplicationStatus{
+				Remote: _testRemote,
+				State:  tagmodels.ReplicationDone,
+			},
+		}, {
+			"remote missing tag",
+			[]persistedretry.Task{&tagreplication.Task{Destination: _testRemote, Failures: 2}},
+			false,
+			tagclient.ErrTagNotFound,
+			tagmodels.RemoteReplicationStatus{
+				Remote:   _testRemote,
+				State:    tagmodels.ReplicationPending,
+				Failures: 2,
+			},
+		}, {
+			"remote has stale digest",
+			nil,
+			true,
+			nil,
+			tagmodels.RemoteReplicationStatus{
+				Remote: _testRemote,
+				State:  tagmodels.ReplicationPending,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			client := newClusterClient(addr)
+
+			tag := core.TagFixture()
+			digest := core.DigestFixture()
+			remote := digest
+			if test.stale {
+				remote = core.DigestFixture()
+			}
+			remoteClient := mocks.client()
+
+			mocks.store.EXPECT().Get(tag).Return(digest, nil)
+			mocks.tagReplicationManager.EXPECT().Find(
+				tagreplication.NewTagQuery(tag)).Return(test.tasks, nil)
+			mocks.provider.EXPECT().Provide(_testRemote).Return(remoteClient)
+			remoteClient.EXPECT().Get(tag).Return(remote, test.err)
+
+			status, err := client.ReplicationStatus(tag)
+			require.NoError(err)
+			require.Equal(tagmodels.ReplicationStatus{
+				Tag:     tag,
+				Digest:  digest,
+				Remotes: []tagmodels.RemoteReplicationStatus{test.expected},
+			}, status)
+		})
+	}
+}
+
+func TestReplicationStatusNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+
+	mocks.store.EXPECT().Get(tag).Return(core.Digest{}, tagstore.ErrTagNotFound)
+
+	_, err := client.ReplicationStatus(tag)
+	require.Equal(tagclient.ErrTagNotFound, err)
+}
+
+func TestDuplicateReportInventory(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	d := core.DigestFixture()
+
+	require.NoError(client.DuplicateReportInventory(
+		"agent1", tagmodels.InventorySummary{Digests: []core.Digest{d}}))
+
+	agents, complete := mocks.inventory.Coverage(core.DigestList{d})
+	require.Equal(1, agents)
+	require.Equal(1, complete)
+}
+
+func TestDuplicateReplicateGroup(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	tags := []string{core.TagFixture(), core.TagFixture()}
+	digest := core.DigestFixture()
+	dependencies := core.DigestListFixture(3)
+	delay := 5 * time.Minute
+	task := tagreplication.NewGroupTask(tags, digest, dependencies, _testRemote, delay)
+
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(task)).Return(nil)
+
+	require.NoError(client.DuplicateReplicateGroup(tags, digest, dependencies, delay))
+}
+
+func TestReadOnlyModeRejectsWrites(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.tagReplicationManager.EXPECT().Pause()
+
+	mode := maintenance.New(maintenance.Config{ReadOnly: true}, tally.NoopScope, mocks.tagReplicationManager)
+
+	addr, stop := testutil.StartServer(mocks.handler(WithMaintenance(mode)))
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	err := client.Put(tag, digest)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+
+	result, err := client.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+
+	mocks.tagReplicationManager.EXPECT().Resume()
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s%s?read_only=false", addr, maintenance.Path))
+	require.NoError(err)
+	require.False(mode.ReadOnly())
+}
+
+func TestACLRejectsWrites(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	acl, err := tagacl.New(tagacl.Config{
+		Rules:    []tagacl.Rule{{Namespace: "namespace-foo/.*", Tokens: []string{"secret"}}},
+		AuditLog: log.Config{Disable: true},
+	}, httputil.IdentityConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	addr, stop := testutil.StartServer(mocks.handler(WithACL(acl)))
+	defer stop()
+
+	client := newClusterClient(addr)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	err = client.Put(tag, digest)
+	require.True(httputil.IsStatus(err, http.StatusForbidden))
+
+	_, err = httputil.Post(fmt.Sprintf("http://%s/remotes/tags/%s", addr, url.PathEscape(tag)))
+	require.True(httputil.IsStatus(err, http.StatusForbidden))
+
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(core.DigestList{digest}, nil)
+	mocks.originClient.EXPECT().Stat(tag, digest).Return(core.NewBlobInfo(256), nil)
+	mocks.store.EXPECT().Put(tag, digest, time.Duration(0)).Return(nil)
+	neighborClient := mocks.client()
+	mocks.provider.EXPECT().Provide(_testNeighbor).Return(neighborClient)
+	neighborClient.EXPECT().InvalidateCache(tag).Return(nil)
+	neighborClient.EXPECT().DuplicatePut(tag, digest, gomock.Any()).Return(nil)
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/tags/%s/digest/%s", addr, url.PathEscape(tag), digest),
+		httputil.SendHeaders(map[string]string{"Authorization": "Bearer secret"}))
+	require.NoError(err)
+}
+
+func TestACLRejectsInternalWrites(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	acl, err := tagacl.New(tagacl.Config{
+		Rules:    []tagacl.Rule{{Namespace: "namespace-foo/.*", Tokens: []string{"secret"}}},
+		AuditLog: log.Config{Disable: true},
+	}, httputil.IdentityConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	addr, stop := testutil.StartServer(mocks.handler(WithACL(acl)))
+	defer stop()
+
+	client := tagclient.NewSingleClient(addr, nil)
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	err = client.DuplicatePut(tag, digest, 0)
+	require.True(httputil.IsStatus(err, http.StatusForbidden))
+
+	err = client.DuplicatePutGroup([]string{"other:tag", tag}, digest, 0)
+	require.True(httputil.IsStatus(err, http.StatusForbidden))
+
+	err = client.DuplicateReplicate(tag, digest, core.DigestList{digest}, 0)
+	require.True(httputil.IsStatus(err, http.StatusForbidden))
+
+	err = client.ConditionalPut(tag, core.Digest{}, digest)
+	require.True(httputil.IsStatus(err, http.StatusForbidden))
+}
+
+func TestListTagsByDigest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	digest := core.DigestFixture()
+	tags := []string{"repo:a", "repo:b"}
+
+	mocks.store.EXPECT().ListByDigest(digest).Return(tags, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/digests/%s/tags", addr, digest))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result []string
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(tags, result)
+}
+
+func TestListTagsByDigestIndexDisabled(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	digest := core.DigestFixture()
+
+	mocks.store.EXPECT().ListByDigest(digest).Return(nil, tagstore.ErrDigestIndexDisabled)
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/digests/%s/tags", addr, digest))
+	require.True(t, httputil.IsStatus(err, http.StatusNotImplemented))
+}
+
+func TestReindexDigests(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	done := make(chan struct{})
+	release := make(chan struct{})
+	mocks.store.EXPECT().Reindex("repo").DoAndReturn(func(string) (int, error) {
+		<-release
+		close(done)
+		return 2, nil
+	})
+
+	u := fmt.Sprintf("http://%s/x/digests/reindex?prefix=repo", addr)
+
+	resp, err := httputil.Post(u, httputil.SendAcceptedCodes(http.StatusAccepted))
+	require.NoError(err)
+	require.Equal(http.StatusAccepted, resp.StatusCode)
+
+	// Only one reindex job runs at a time.
+	_, err = httputil.Post(u)
+	require.True(httputil.IsStatus(err, http.StatusConflict))
+
+	close(release)
+	<-done
+
+	_, err = httputil.Post(fmt.Sprintf("http://%s/x/digests/reindex", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func bulkReplicateStatus(t *testing.T, addr string) tagmodels.BulkReplicateStatus {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/remotes/replicate", addr))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var status tagmodels.BulkReplicateStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	return status
+}
+
+func TestBulkReplicate(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.BulkReplicateTagsPerSec = 1000
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	u := fmt.Sprintf("http://%s/remotes/replicate", addr)
+
+	// No job has run yet.
+	_, err := httputil.Get(u)
+	require.True(httputil.IsNotFound(err))
+
+	tag1 := "repo/a:v1"
+	tag2 := "repo/b:v1.2"
+	digest1 := core.DigestFixture()
+	digest2 := core.DigestFixture()
+	deps := core.DigestList{core.DigestFixture()}
+
+	listing := make(chan struct{})
+	release := make(chan struct{})
+
+	mocks.backendClient.EXPECT().List("repo/", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(string, ...backend.ListOption) (*backend.ListResult, error) {
+			close(listing)
+			<-release
+			return &backend.ListResult{
+				Names:             []string{tag1, "repo/a:v2"},
+				ContinuationToken: "next",
+			}, nil
+		})
+	mocks.backendClient.EXPECT().List("repo/", gomock.Any(), gomock.Any()).Return(
+		&backend.ListResult{Names: []string{tag2}}, nil)
+
+	mocks.store.EXPECT().Get(tag1).Return(digest1, nil)
+	mocks.depResolver.EXPECT().Resolve(tag1, digest1).Return(deps, nil)
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(
+		tagreplication.NewTask(tag1, digest1, deps, _testRemote, 0))).Return(nil)
+
+	mocks.store.EXPECT().Get(tag2).Return(digest2, nil)
+	mocks.depResolver.EXPECT().Resolve(tag2, digest2).Return(deps, nil)
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(
+		tagreplication.NewTask(tag2, digest2, deps, _testRemote, 0))).Return(nil)
+
+	body, err := json.Marshal(tagmodels.BulkReplicateRequest{
+		Prefix:  "repo/",
+		Pattern: "repo/*:v1*",
+	})
+	require.NoError(err)
+
+	resp, err := httputil.Post(u,
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendAcceptedCodes(http.StatusAccepted))
+	require.NoError(err)
+	require.Equal(http.StatusAccepted, resp.StatusCode)
+
+	<-listing
+
+	// Only one bulk replication job runs at a time.
+	_, err = httputil.Post(u, httputil.SendBody(bytes.NewReader(body)))
+	require.True(httputil.IsStatus(err, http.StatusConflict))
+
+	require.True(bulkReplicateStatus(t, addr).Running)
+
+	close(release)
+
+	require.Eventually(func() bool {
+		return !bulkReplicateStatus(t, addr).Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := bulkReplicateStatus(t, addr)
+	require.Equal(2, status.Tags)
+	require.Equal(2, status.Tasks)
+	require.Equal(0, status.Failures)
+	require.Empty(status.Error)
+}
+
+func TestBulkReplicateToRemote(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.BulkReplicateTagsPerSec = 1000
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	mocks.backendClient.EXPECT().List("repo/", gomock.Any(), gomock.Any()).Return(
+		&backend.ListResult{Names: []string{"repo/a:v1"}}, nil)
+
+	// Tags which do not replicate to the requested remote are skipped.
+	body, err := json.Marshal(tagmodels.BulkReplicateRequest{
+		Prefix: "repo/",
+		Remote: "some-other-remote",
+	})
+	require.NoError(err)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/remotes/replicate", addr),
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendAcceptedCodes(http.StatusAccepted))
+	require.NoError(err)
+
+	require.Eventually(func() bool {
+		return !bulkReplicateStatus(t, addr).Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := bulkReplicateStatus(t, addr)
+	require.Equal(1, status.Tags)
+	require.Equal(0, status.Tasks)
+}
+
+func TestBulkReplicateSkipsTagsDeniedByACL(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	mocks.config.BulkReplicateTagsPerSec = 1000
+
+	// Writes under repo/ are open, but repo/restricted needs a token.
+	acl, err := tagacl.New(tagacl.Config{
+		Rules:    []tagacl.Rule{{Namespace: "repo/restricted.*", Tokens: []string{"secret"}}},
+		AuditLog: log.Config{Disable: true},
+	}, httputil.IdentityConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	addr, stop := testutil.StartServer(mocks.handler(WithACL(acl)))
+	defer stop()
+
+	tag := "repo/a:v1"
+	restricted := "repo/restricted:v1"
+	digest := core.DigestFixture()
+	deps := core.DigestList{core.DigestFixture()}
+
+	mocks.backendClient.EXPECT().List("repo/", gomock.Any(), gomock.Any()).Return(
+		&backend.ListResult{Names: []string{tag, restricted}}, nil)
+
+	mocks.store.EXPECT().Get(tag).Return(digest, nil)
+	mocks.depResolver.EXPECT().Resolve(tag, digest).Return(deps, nil)
+	mocks.tagReplicationManager.EXPECT().Add(tagreplication.MatchTask(
+		tagreplication.NewTask(tag, digest, deps, _testRemote, 0))).Return(nil)
+
+	body, err := json.Marshal(tagmodels.BulkReplicateRequest{Prefix: "repo/"})
+	require.NoError(err)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/remotes/replicate", addr),
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendAcceptedCodes(http.StatusAccepted))
+	require.NoError(err)
+
+	require.Eventually(func() bool {
+		return !bulkReplicateStatus(t, addr).Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := bulkReplicateStatus(t, addr)
+	require.Equal(2, status.Tags)
+	require.Equal(1, status.Tasks)
+	require.Equal(1, status.Denied)
+	require.Equal(0, status.Failures)
+}
+
+func TestBulkReplicateBadRequests(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	for _, body := range []string{
+		"not json",
+		`{}`,
+		`{"prefix": "repo/", "pattern": "["}`,
+	} {
+		t.Run(body, func(t *testing.T) {
+			_, err := httputil.Post(
+				fmt.Sprintf("http://%s/remotes/replicate", addr),
+				httputil.SendBody(strings.NewReader(body)))
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
 }
@@ -0,0 +1,107 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// wantsStream returns whether the client of r accepts streamed list responses.
+func wantsStream(r *http.Request) bool {
+	for _, v := range r.Header["Accept"] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.TrimSpace(strings.Split(t, ";")[0]) == tagmodels.StreamContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamList writes every name under prefix as newline delimited JSON, one
+// backend page at a time, until the listing is exhausted or the client goes
+// away. The limit and offset query args set the page size and starting point.
+// If transform is set, names are rewritten by it and skipped if it returns
+// false.
+func (s *Server) streamList(
+	w http.ResponseWriter,
+	r *http.Request,
+	client backend.Client,
+	prefix string,
+	opts []backend.ListOption,
+	transform func(string) (string, bool)) error {
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	ctx := r.Context()
+
+	opts = append(opts, backend.ListWithPagination())
+	pageOpts := opts
+
+	var started bool
+	for {
+		result, err := client.List(prefix, pageOpts...)
+		if err != nil {
+			if !started {
+				return handler.Errorf("error listing from backend: %s", err)
+			}
+			// Headers were already sent, so the failure can only be reported
+			// in the stream itself.
+			s.stats.Counter("list_stream_errors").Inc(1)
+			log.With("prefix", prefix).Errorf("Error streaming list from backend: %s", err)
+			enc.Encode(tagmodels.ListStreamEntry{Error: err.Error()})
+			return nil
+		}
+		if !started {
+			w.Header().Set("Content-Type", tagmodels.StreamContentType)
+			// Disables response buffering in nginx.
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		for _, name := range result.Names {
+			if transform != nil {
+				var ok bool
+				if name, ok = transform(name); !ok {
+					continue
+				}
+			}
+			if err := enc.Encode(tagmodels.ListStreamEntry{Name: name}); err != nil {
+				s.stats.Counter("list_stream_canceled").Inc(1)
+				return nil
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if result.ContinuationToken == "" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.stats.Counter("list_stream_canceled").Inc(1)
+			return nil
+		default:
+		}
+		pageOpts = append(
+			opts[:len(opts):len(opts)], backend.ListWithContinuationToken(result.ContinuationToken))
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber/kraken/core"
+)
+
+type cacheEntry struct {
+	tag       string
+	digest    core.Digest
+	expiresAt time.Time
+}
+
+// tagCache is a thread-safe LRU cache of tag to digest mappings, where each
+// entry expires after a fixed TTL.
+type tagCache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	clk     clock.Clock
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+func newTagCache(size int, ttl time.Duration, clk clock.Clock) *tagCache {
+	return &tagCache{
+		size:    size,
+		ttl:     ttl,
+		clk:     clk,
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached digest of tag, if present and not expired.
+func (c *tagCache) get(tag string) (core.Digest, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[tag]
+	if !ok {
+		return core.Digest{}, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !c.clk.Now().Before(entry.expiresAt) {
+		c.remove(e)
+		return core.Digest{}, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.digest, true
+}
+
+// put adds or overwrites the cached digest of tag, evicting the least
+// recently used entry if the cache is full.
+func (c *tagCache) put(tag string, d core.Digest) {
+	c.Lock()
+	defer c.Unlock()
+
+	expiresAt := c.clk.Now().Add(c.ttl)
+	if e, ok := c.entries[tag]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.digest = d
+		entry.expiresAt = expiresAt
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.entries[tag] = c.ll.PushFront(&cacheEntry{tag, d, expiresAt})
+	if c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+// invalidate removes tag from the cache.
+func (c *tagCache) invalidate(tag string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if e, ok := c.entries[tag]; ok {
+		c.remove(e)
+	}
+}
+
+func (c *tagCache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.entries, e.Value.(*cacheEntry).tag)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/core"
+)
+
+func TestTagCacheExpiresAfterTTL(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	c := newTagCache(10, time.Minute, clk)
+
+	tag := core.TagFixture()
+	d := core.DigestFixture()
+
+	c.put(tag, d)
+
+	result, ok := c.get(tag)
+	require.True(ok)
+	require.Equal(d, result)
+
+	clk.Add(time.Minute)
+
+	_, ok = c.get(tag)
+	require.False(ok)
+}
+
+func TestTagCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	require := require.New(t)
+
+	c := newTagCache(2, time.Minute, clock.NewMock())
+
+	tag1 := core.TagFixture()
+	tag2 := core.TagFixture()
+	tag3 := core.TagFixture()
+
+	c.put(tag1, core.DigestFixture())
+	c.put(tag2, core.DigestFixture())
+
+	// Touch tag1 so tag2 is evicted instead.
+	_, ok := c.get(tag1)
+	require.True(ok)
+
+	c.put(tag3, core.DigestFixture())
+
+	_, ok = c.get(tag1)
+	require.True(ok)
+	_, ok = c.get(tag2)
+	require.False(ok)
+	_, ok = c.get(tag3)
+	require.True(ok)
+}
+
+func TestTagCacheInvalidate(t *testing.T) {
+	require := require.New(t)
+
+	c := newTagCache(10, time.Minute, clock.NewMock())
+
+	tag := core.TagFixture()
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	c.put(tag, d1)
+	c.put(tag, d2)
+
+	result, ok := c.get(tag)
+	require.True(ok)
+	require.Equal(d2, result)
+
+	c.invalidate(tag)
+
+	_, ok = c.get(tag)
+	require.False(ok)
+}
@@ -13,7 +13,28 @@
 // limitations under the License.
 package tagstore
 
+import "time"
+
 // Config defines tag store configuration.
 type Config struct {
-	WriteThrough bool `yaml:"write_through"`
+	WriteThrough bool        `yaml:"write_through"`
+	Cache        CacheConfig `yaml:"cache"`
+}
+
+// CacheConfig defines the in-memory tag cache configuration. Cached tags
+// expire after TTL, and are invalidated early when overwritten on a neighbor.
+type CacheConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Size    int           `yaml:"size"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Cache.Size == 0 {
+		c.Cache.Size = 10000
+	}
+	if c.Cache.TTL == 0 {
+		c.Cache.TTL = 5 * time.Minute
+	}
+	return c
 }
@@ -0,0 +1,45 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagstore
+
+import (
+	"github.com/uber/kraken/core"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// digestIndex maps digests to the tags which point at them. Persisted in the
+// local database, so each build-index only indexes tags written through it,
+// or its neighbors, until reindexed.
+type digestIndex struct {
+	db *sqlx.DB
+}
+
+func (i *digestIndex) put(tag string, d core.Digest) error {
+	_, err := i.db.Exec(`INSERT OR REPLACE INTO tag_digest (tag, digest) VALUES (?, ?)`, tag, d.String())
+	return err
+}
+
+func (i *digestIndex) delete(tag string) error {
+	_, err := i.db.Exec(`DELETE FROM tag_digest WHERE tag=?`, tag)
+	return err
+}
+
+func (i *digestIndex) tags(d core.Digest) ([]string, error) {
+	tags := []string{}
+	if err := i.db.Select(&tags, `SELECT tag FROM tag_digest WHERE digest=? ORDER BY tag`, d.String()); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
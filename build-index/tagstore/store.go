@@ -17,10 +17,13 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
@@ -28,36 +31,76 @@ import (
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/uber-go/tally"
 )
 
 // Store errors.
 var (
-	ErrTagNotFound = errors.New("tag not found")
+	ErrTagNotFound         = errors.New("tag not found")
+	ErrTagConflict         = errors.New("tag conflict")
+	ErrDigestIndexDisabled = errors.New("digest index disabled")
 )
 
+// _numTagLocks is the number of stripes used to serialize writes to the same
+// tag.
+const _numTagLocks = 256
+
 // FileStore defines operations required for storing tags on disk.
 type FileStore interface {
 	CreateCacheFile(name string, r io.Reader) error
 	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
 	GetCacheFileReader(name string) (store.FileReader, error)
+	DeleteCacheFile(name string) error
+	DeleteCacheFileMetadata(name string, md metadata.Metadata) error
 }
 
 // Store defines tag storage operations.
 type Store interface {
 	Put(tag string, d core.Digest, writeBackDelay time.Duration) error
+	PutIfMatch(tag string, expected, d core.Digest, writeBackDelay time.Duration) error
+	PutGroup(tags []string, d core.Digest, writeBackDelay time.Duration) error
 	Get(tag string) (core.Digest, error)
+	Invalidate(tag string)
+
+	// ListByDigest returns the tags which point at d, according to the digest
+	// index.
+	ListByDigest(d core.Digest) ([]string, error)
+
+	// Reindex adds all tags under prefix in the backend to the digest index,
+	// and returns the number of tags indexed.
+	Reindex(prefix string) (int, error)
+}
+
+// Option defines an optional Store parameter.
+type Option func(*tagStore)
+
+// WithDigestIndex maintains an index from digests to tags in db, such that
+// tags can be listed by digest.
+func WithDigestIndex(db *sqlx.DB) Option {
+	return func(s *tagStore) { s.index = &digestIndex{db} }
 }
 
 // tagStore encapsulates two-level tag storage:
 // 1. On-disk file store: persists tags for availability / write-back purposes.
 // 2. Remote storage: durable tag storage.
+//
+// If enabled, resolved tags are additionally cached in memory.
 type tagStore struct {
 	config           Config
+	stats            tally.Scope
+	cache            *tagCache
 	fs               FileStore
 	backends         *backend.Manager
 	writeBackManager persistedretry.Manager
+	index            *digestIndex
+	tagLocks         [_numTagLocks]sync.Mutex
+
+	// groupMu is held exclusively while PutGroup makes a group of tags
+	// visible, and shared while Get resolves tags locally.
+	groupMu sync.RWMutex
 }
 
 // New creates a new Store.
@@ -66,21 +109,164 @@ func New(
 	stats tally.Scope,
 	fs FileStore,
 	backends *backend.Manager,
-	writeBackManager persistedretry.Manager) Store {
+	writeBackManager persistedretry.Manager,
+	opts ...Option) Store {
+
+	config = config.applyDefaults()
 
 	stats = stats.Tagged(map[string]string{
 		"module": "tagstore",
 	})
 
-	return &tagStore{
+	var cache *tagCache
+	if config.Cache.Enabled {
+		cache = newTagCache(config.Cache.Size, config.Cache.TTL, clock.New())
+	}
+
+	s := &tagStore{
 		config:           config,
+		stats:            stats,
+		cache:            cache,
 		fs:               fs,
 		backends:         backends,
 		writeBackManager: writeBackManager,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration) error {
+	l := s.tagLock(tag)
+	l.Lock()
+	defer l.Unlock()
+
+	return s.put(tag, d, writeBackDelay, s.config.WriteThrough)
+}
+
+// PutIfMatch sets tag to d only if tag currently points to expected. If
+// expected is empty, tag must not exist yet. Returns ErrTagConflict if the
+// current digest of tag does not match.
+//
+// The current digest is resolved from the backend first, since it is shared by
+// all build-index nodes, bypassing the in-memory cache. The write reaches the
+// backend before PutIfMatch returns, regardless of write-through, such that
+// the next check sees it even if it runs on another node. The tag lock only
+// serializes conditional puts on this node: callers must route all
+// conditional puts of a tag to a single node.
+func (s *tagStore) PutIfMatch(
+	tag string, expected, d core.Digest, writeBackDelay time.Duration) error {
+
+	l := s.tagLock(tag)
+	l.Lock()
+	defer l.Unlock()
+
+	cur, err := s.resolveLatest(tag)
+	if err == ErrTagNotFound {
+		cur = core.Digest{}
+	} else if err != nil {
+		return fmt.Errorf("resolve current digest: %s", err)
+	}
+	if cur != expected {
+		s.stats.Counter("conflicts").Inc(1)
+		return ErrTagConflict
+	}
+	return s.put(tag, d, writeBackDelay, true)
+}
+
+// PutGroup sets all of tags to d, such that either every tag is written or,
+// if any write fails, none are. Gets on this node observe either the entire
+// group or none of it. Write-back of the group only begins once every tag is
+// on disk.
+func (s *tagStore) PutGroup(tags []string, d core.Digest, writeBackDelay time.Duration) error {
+	for _, l := range s.tagGroupLocks(tags) {
+		l.Lock()
+		defer l.Unlock()
+	}
+
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	var written []string
+	prev := make(map[string]core.Digest)
+	for _, tag := range tags {
+		cur, err := s.resolveFromDisk(tag)
+		if err == nil {
+			prev[tag] = cur
+		} else if err != ErrTagNotFound {
+			s.rollback(written, prev)
+			return fmt.Errorf("resolve %s from disk: %s", tag, err)
+		}
+		written = append(written, tag)
+		if err := s.writeTagToDisk(tag, d); err != nil {
+			s.rollback(written, prev)
+			return fmt.Errorf("write %s to disk: %s", tag, err)
+		}
+		if _, err := s.fs.SetCacheFileMetadata(tag, metadata.NewPersist(true)); err != nil {
+			s.rollback(written, prev)
+			return fmt.Errorf("set persist metadata: %s", err)
+		}
+	}
+
+	for i, tag := range tags {
+		task := writeback.NewTask(tag, tag, writeBackDelay)
+		var err error
+		if s.config.WriteThrough {
+			err = s.writeBackManager.SyncExec(task)
+		} else {
+			err = s.writeBackManager.Add(task)
+		}
+		if err != nil {
+			s.rollback(written, prev)
+			if s.config.WriteThrough {
+				// Restores the previous digests of tags which were already
+				// written to the backend.
+				for _, t := range tags[:i] {
+					if _, ok := prev[t]; !ok {
+						continue
+					}
+					if err := s.writeBackManager.Add(writeback.NewTask(t, t, 0)); err != nil {
+						s.stats.Counter("group_rollback_errors").Inc(1)
+					}
+				}
+			}
+			return fmt.Errorf("write-back %s: %s", tag, err)
+		}
+	}
+
+	for _, tag := range tags {
+		if s.cache != nil {
+			s.cache.put(tag, d)
+		}
+		s.updateIndex(tag, d)
+	}
+	s.stats.Counter("group_puts").Inc(1)
+	return nil
+}
+
+// rollback restores each of written tags to its digest in prev, removing tags
+// which did not previously exist.
+func (s *tagStore) rollback(written []string, prev map[string]core.Digest) {
+	for _, tag := range written {
+		var err error
+		if d, ok := prev[tag]; ok {
+			err = s.writeTagToDisk(tag, d)
+		} else {
+			err = s.deleteTagFromDisk(tag)
+		}
+		if err != nil {
+			s.stats.Counter("group_rollback_errors").Inc(1)
+		}
+		if s.cache != nil {
+			s.cache.invalidate(tag)
+		}
+	}
+}
+
+// put writes tag to disk and schedules its write-back. If sync is set, the
+// write-back is executed before put returns.
+func (s *tagStore) put(tag string, d core.Digest, writeBackDelay time.Duration, sync bool) error {
 	if err := s.writeTagToDisk(tag, d); err != nil {
 		return fmt.Errorf("write tag to disk: %s", err)
 	}
@@ -89,7 +275,7 @@ func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration)
 	}
 
 	task := writeback.NewTask(tag, tag, writeBackDelay)
-	if s.config.WriteThrough {
+	if sync {
 		if err := s.writeBackManager.SyncExec(task); err != nil {
 			return fmt.Errorf("sync exec write-back task: %s", err)
 		}
@@ -98,19 +284,137 @@ func (s *tagStore) Put(tag string, d core.Digest, writeBackDelay time.Duration)
 			return fmt.Errorf("add write-back task: %s", err)
 		}
 	}
+	if s.cache != nil {
+		s.cache.put(tag, d)
+	}
+	s.updateIndex(tag, d)
 	return nil
 }
 
 func (s *tagStore) Get(tag string) (d core.Digest, err error) {
-	for _, resolve := range []func(tag string) (core.Digest, error){
-		s.resolveFromDisk,
-		s.resolveFromBackend,
-	} {
-		d, err = resolve(tag)
-		if err == ErrTagNotFound {
-			continue
+	d, err = s.getLocal(tag)
+	if err == ErrTagNotFound {
+		d, err = s.resolveFromBackend(tag)
+		if err == nil && s.cache != nil {
+			s.cache.put(tag, d)
+		}
+	}
+	return d, err
+}
+
+// getLocal resolves tag from the in-memory cache or disk.
+func (s *tagStore) getLocal(tag string) (core.Digest, error) {
+	s.groupMu.RLock()
+	defer s.groupMu.RUnlock()
+
+	if s.cache != nil {
+		if d, ok := s.cache.get(tag); ok {
+			s.stats.Counter("cache_hits").Inc(1)
+			return d, nil
+		}
+		s.stats.Counter("cache_misses").Inc(1)
+	}
+	d, err := s.resolveFromDisk(tag)
+	if err == nil && s.cache != nil {
+		s.cache.put(tag, d)
+	}
+	return d, err
+}
+
+// Invalidate evicts tag from the in-memory cache, such that the next Get
+// resolves it from disk or the backend.
+func (s *tagStore) Invalidate(tag string) {
+	if s.cache != nil {
+		s.cache.invalidate(tag)
+	}
+}
+
+// ListByDigest returns the tags which point at d.
+func (s *tagStore) ListByDigest(d core.Digest) ([]string, error) {
+	if s.index == nil {
+		return nil, ErrDigestIndexDisabled
+	}
+	return s.index.tags(d)
+}
+
+// Reindex resolves every tag under prefix from the backend and indexes it.
+// Tags which no longer exist are removed from the index.
+func (s *tagStore) Reindex(prefix string) (int, error) {
+	if s.index == nil {
+		return 0, ErrDigestIndexDisabled
+	}
+	client, err := s.backends.GetClient(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("backend manager: %s", err)
+	}
+	var n int
+	var token string
+	for {
+		result, err := client.List(
+			prefix, backend.ListWithPagination(), backend.ListWithContinuationToken(token))
+		if err != nil {
+			return n, fmt.Errorf("list: %s", err)
 		}
-		break
+		for _, tag := range result.Names {
+			d, err := s.resolveFromBackend(tag)
+			if err == ErrTagNotFound {
+				err = s.index.delete(tag)
+			} else if err == nil {
+				err = s.index.put(tag, d)
+				n++
+			}
+			if err != nil {
+				s.stats.Counter("index_errors").Inc(1)
+				log.With("tag", tag).Errorf("Error reindexing tag: %s", err)
+			}
+		}
+		token = result.ContinuationToken
+		if token == "" {
+			return n, nil
+		}
+	}
+}
+
+// updateIndex records that tag points at d. Index errors do not fail writes,
+// since the index can be rebuilt with Reindex.
+func (s *tagStore) updateIndex(tag string, d core.Digest) {
+	if s.index == nil {
+		return
+	}
+	if err := s.index.put(tag, d); err != nil {
+		s.stats.Counter("index_errors").Inc(1)
+		log.With("tag", tag).Errorf("Error indexing tag: %s", err)
+	}
+}
+
+func (s *tagStore) tagLock(tag string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(tag))
+	return &s.tagLocks[h.Sum32()%_numTagLocks]
+}
+
+// tagGroupLocks returns the distinct locks of tags, in a consistent order such
+// that concurrent PutGroup calls cannot deadlock.
+func (s *tagStore) tagGroupLocks(tags []string) []*sync.Mutex {
+	idx := make(map[uint32]bool)
+	for _, tag := range tags {
+		h := fnv.New32a()
+		h.Write([]byte(tag))
+		idx[h.Sum32()%_numTagLocks] = true
+	}
+	var locks []*sync.Mutex
+	for i := range s.tagLocks {
+		if idx[uint32(i)] {
+			locks = append(locks, &s.tagLocks[i])
+		}
+	}
+	return locks
+}
+
+func (s *tagStore) resolveLatest(tag string) (core.Digest, error) {
+	d, err := s.resolveFromBackend(tag)
+	if err == ErrTagNotFound {
+		return s.resolveFromDisk(tag)
 	}
 	return d, err
 }
@@ -123,6 +427,17 @@ func (s *tagStore) writeTagToDisk(tag string, d core.Digest) error {
 	return nil
 }
 
+func (s *tagStore) deleteTagFromDisk(tag string) error {
+	err := s.fs.DeleteCacheFileMetadata(tag, &metadata.Persist{})
+	if err == nil {
+		err = s.fs.DeleteCacheFile(tag)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (s *tagStore) resolveFromDisk(tag string) (core.Digest, error) {
 	f, err := s.fs.GetCacheFileReader(tag)
 	if err != nil {
@@ -136,7 +451,7 @@ func (s *tagStore) resolveFromDisk(tag string) (core.Digest, error) {
 	if _, err := io.Copy(&b, f); err != nil {
 		return core.Digest{}, fmt.Errorf("copy from fs: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	d, err := core.ParseDigest(b.String())
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("parse fs digest: %s", err)
 	}
@@ -155,7 +470,7 @@ func (s *tagStore) resolveFromBackend(tag string) (core.Digest, error) {
 		}
 		return core.Digest{}, fmt.Errorf("backend client: %s", err)
 	}
-	d, err := core.ParseSHA256Digest(b.String())
+	d, err := core.ParseDigest(b.String())
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("parse backend digest: %s", err)
 	}
@@ -14,6 +14,7 @@
 package tagstore_test
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -25,6 +26,7 @@ import (
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/mocks/lib/persistedretry"
 	"github.com/uber/kraken/utils/mockutil"
@@ -123,6 +125,67 @@ func TestPutAndGetFromDiskWriteThrough(t *testing.T) {
 	require.Equal(digest, result)
 }
 
+func TestPutGroup(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{Cache: CacheConfig{Enabled: true}})
+
+	tags := []string{core.TagFixture(), core.TagFixture()}
+	digest := core.DigestFixture()
+
+	for _, tag := range tags {
+		mocks.writeBackManager.EXPECT().Add(
+			writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+	}
+
+	require.NoError(store.PutGroup(tags, digest, 0))
+
+	for _, tag := range tags {
+		result, err := store.Get(tag)
+		require.NoError(err)
+		require.Equal(digest, result)
+	}
+}
+
+func TestPutGroupRollsBackOnWriteBackFailure(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	existing := core.TagFixture()
+	created := core.TagFixture()
+	prev := core.DigestFixture()
+	digest := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(existing, existing, 0))).Return(nil)
+	require.NoError(store.Put(existing, prev, 0))
+
+	gomock.InOrder(
+		mocks.writeBackManager.EXPECT().Add(
+			writeback.MatchTask(writeback.NewTask(existing, existing, 0))).Return(nil),
+		mocks.writeBackManager.EXPECT().Add(
+			writeback.MatchTask(writeback.NewTask(created, created, 0))).Return(errors.New("some error")),
+	)
+
+	require.Error(store.PutGroup([]string{existing, created}, digest, 0))
+
+	result, err := store.Get(existing)
+	require.NoError(err)
+	require.Equal(prev, result)
+
+	mocks.backendClient.EXPECT().Download(
+		created, created, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	_, err = store.Get(created)
+	require.Equal(ErrTagNotFound, err)
+}
+
 func TestGetFromBackendNotFound(t *testing.T) {
 	require := require.New(t)
 
@@ -182,3 +245,187 @@ func TestGetFromBackendInvalidValue(t *testing.T) {
 	_, err := store.Get(tag)
 	require.Error(err)
 }
+
+func TestGetFromBackendCached(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{Cache: CacheConfig{Enabled: true}})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag,
+		mockutil.MatchWriter([]byte(digest.String()))).Return(nil).Times(2)
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Get(tag)
+		require.NoError(err)
+		require.Equal(digest, result)
+	}
+
+	store.Invalidate(tag)
+
+	result, err := store.Get(tag)
+	require.NoError(err)
+	require.Equal(digest, result)
+}
+
+func TestPutIfMatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	old := core.DigestFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(old.String()))).Return(nil)
+	mocks.writeBackManager.EXPECT().SyncExec(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+
+	require.NoError(store.PutIfMatch(tag, old, digest, 0))
+}
+
+func TestPutIfMatchConflict(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	cur := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, mockutil.MatchWriter([]byte(cur.String()))).Return(nil)
+
+	require.Equal(
+		ErrTagConflict,
+		store.PutIfMatch(tag, core.DigestFixture(), core.DigestFixture(), 0))
+}
+
+func TestPutIfMatchEmptyExpectedRequiresMissingTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	tag := core.TagFixture()
+	digest := core.DigestFixture()
+
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.writeBackManager.EXPECT().SyncExec(
+		writeback.MatchTask(writeback.NewTask(tag, tag, 0))).Return(nil)
+
+	require.NoError(store.PutIfMatch(tag, core.Digest{}, digest, 0))
+
+	// The tag now exists on disk, so a second create must conflict.
+	mocks.backendClient.EXPECT().Download(
+		tag, tag, gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+
+	require.Equal(
+		ErrTagConflict, store.PutIfMatch(tag, core.Digest{}, core.DigestFixture(), 0))
+}
+
+func TestListByDigest(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	db, dbCleanup := localdb.Fixture()
+	defer dbCleanup()
+
+	store := New(
+		Config{}, tally.NoopScope, mocks.ss, mocks.backends, mocks.writeBackManager, WithDigestIndex(db))
+
+	tags := []string{"repo:a", "repo:b", "repo:c"}
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil).AnyTimes()
+
+	require.NoError(store.Put(tags[0], d1, 0))
+	require.NoError(store.Put(tags[1], d1, 0))
+	require.NoError(store.PutGroup([]string{tags[2]}, d2, 0))
+
+	// Moving a tag to another digest removes it from the old digest.
+	require.NoError(store.Put(tags[1], d2, 0))
+
+	result, err := store.ListByDigest(d1)
+	require.NoError(err)
+	require.Equal([]string{tags[0]}, result)
+
+	result, err = store.ListByDigest(d2)
+	require.NoError(err)
+	require.Equal([]string{tags[1], tags[2]}, result)
+
+	result, err = store.ListByDigest(core.DigestFixture())
+	require.NoError(err)
+	require.Empty(result)
+}
+
+func TestListByDigestDisabled(t *testing.T) {
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new(Config{})
+
+	_, err := store.ListByDigest(core.DigestFixture())
+	require.Equal(t, ErrDigestIndexDisabled, err)
+
+	_, err = store.Reindex("repo")
+	require.Equal(t, ErrDigestIndexDisabled, err)
+}
+
+func TestReindex(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	db, dbCleanup := localdb.Fixture()
+	defer dbCleanup()
+
+	store := New(
+		Config{}, tally.NoopScope, mocks.ss, mocks.backends, mocks.writeBackManager, WithDigestIndex(db))
+
+	d := core.DigestFixture()
+
+	// Indexed locally, but since deleted from the backend.
+	mocks.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+	require.NoError(store.Put("repo:deleted", d, 0))
+
+	gomock.InOrder(
+		mocks.backendClient.EXPECT().List("repo", gomock.Any(), gomock.Any()).Return(
+			&backend.ListResult{Names: []string{"repo:a", "repo:deleted"}, ContinuationToken: "next"}, nil),
+		mocks.backendClient.EXPECT().List("repo", gomock.Any(), gomock.Any()).Return(
+			&backend.ListResult{Names: []string{"repo:b"}}, nil),
+	)
+	mocks.backendClient.EXPECT().Download(
+		"repo:a", "repo:a", mockutil.MatchWriter([]byte(d.String()))).Return(nil)
+	mocks.backendClient.EXPECT().Download(
+		"repo:deleted", "repo:deleted", gomock.Any()).Return(backenderrors.ErrBlobNotFound)
+	mocks.backendClient.EXPECT().Download(
+		"repo:b", "repo:b", mockutil.MatchWriter([]byte(d.String()))).Return(nil)
+
+	n, err := store.Reindex("repo")
+	require.NoError(err)
+	require.Equal(2, n)
+
+	result, err := store.ListByDigest(d)
+	require.NoError(err)
+	require.Equal([]string{"repo:a", "repo:b"}, result)
+}
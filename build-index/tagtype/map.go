@@ -25,9 +25,12 @@ import (
 var errNamespaceNotFound = errors.New("no matches for namespace")
 
 // Config defines the namespace and the type of resolver associated with it.
+// Types are registered with Register. Options are passed to the factory of
+// the type.
 type Config struct {
-	Namespace string `yaml:"namespace"`
-	Type      string `yaml:"type"`
+	Namespace string                 `yaml:"namespace"`
+	Type      string                 `yaml:"type"`
+	Options   map[string]interface{} `yaml:"options"`
 }
 
 // DependencyResolver returns a list of blob dependencies for a tag->digest mapping.
@@ -56,16 +59,15 @@ func NewMap(configs []Config, originClient blobclient.ClusterClient) (*Map, erro
 		if err != nil {
 			return nil, fmt.Errorf("regexp: %s", err)
 		}
-		var sr *subResolver
-		switch config.Type {
-		case "docker":
-			sr = &subResolver{re, &dockerResolver{originClient}}
-		case "default":
-			sr = &subResolver{re, &defaultResolver{}}
-		default:
-			return nil, fmt.Errorf("type %s is undefined", config.Type)
+		factory, err := getFactory(config.Type)
+		if err != nil {
+			return nil, err
+		}
+		resolver, err := factory.Create(config.Options, originClient)
+		if err != nil {
+			return nil, fmt.Errorf("create %s resolver: %s", config.Type, err)
 		}
-		subResolvers = append(subResolvers, sr)
+		subResolvers = append(subResolvers, &subResolver{re, resolver})
 	}
 	return &Map{subResolvers}, nil
 }
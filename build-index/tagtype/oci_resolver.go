@@ -0,0 +1,118 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagtype
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// ociOptions defines the options of the oci tag type.
+type ociOptions struct {
+	// ArtifactTypes restricts tags to manifests of these artifact types, e.g.
+	// application/vnd.cncf.helm.config.v1+json. The artifact type of a
+	// manifest is its artifactType, or else the media type of its config.
+	// Indexes are always accepted. Any artifact type is accepted if empty.
+	ArtifactTypes []string `yaml:"artifact_types"`
+}
+
+type ociFactory struct{}
+
+func (ociFactory) Create(
+	options map[string]interface{}, originClient blobclient.ClusterClient) (DependencyResolver, error) {
+
+	var o ociOptions
+	if err := DecodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	return &ociResolver{originClient, stringset.FromSlice(o.ArtifactTypes)}, nil
+}
+
+// ociDescriptor references a blob from an OCI manifest.
+type ociDescriptor struct {
+	MediaType string      `json:"mediaType"`
+	Digest    core.Digest `json:"digest"`
+}
+
+// ociManifest is the union of the OCI image manifest, artifact manifest and
+// image index fields which reference blobs. Docker v2 manifests and manifest
+// lists share the same layout.
+type ociManifest struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	MediaType     string           `json:"mediaType"`
+	ArtifactType  string           `json:"artifactType"`
+	Config        *ociDescriptor   `json:"config"`
+	Layers        []*ociDescriptor `json:"layers"`
+	Blobs         []*ociDescriptor `json:"blobs"`
+	Manifests     []*ociDescriptor `json:"manifests"`
+}
+
+func (m *ociManifest) isIndex() bool {
+	return len(m.Manifests) > 0
+}
+
+func (m *ociManifest) artifactType() string {
+	if m.ArtifactType == "" && m.Config != nil {
+		return m.Config.MediaType
+	}
+	return m.ArtifactType
+}
+
+// ociResolver resolves the dependencies of OCI artifacts, such as helm charts,
+// WASM modules or ML models, from the descriptors of their manifests.
+type ociResolver struct {
+	originClient  blobclient.ClusterClient
+	artifactTypes stringset.Set
+}
+
+// Resolve returns the config, layers and blobs of the manifest of tag, or the
+// manifests of an index, followed by the manifest itself.
+func (r *ociResolver) Resolve(tag string, d core.Digest) (core.DigestList, error) {
+	var buf bytes.Buffer
+	if err := r.originClient.DownloadBlob(tag, d, &buf); err != nil {
+		return nil, fmt.Errorf("download blob: %s", err)
+	}
+	var m ociManifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %s", err)
+	}
+	if m.SchemaVersion != 2 {
+		return nil, fmt.Errorf("unsupported manifest schema version: %d", m.SchemaVersion)
+	}
+	if !m.isIndex() && len(r.artifactTypes) > 0 && !r.artifactTypes.Has(m.artifactType()) {
+		return nil, fmt.Errorf("unsupported artifact type %q", m.artifactType())
+	}
+
+	var descs []*ociDescriptor
+	if m.Config != nil {
+		descs = append(descs, m.Config)
+	}
+	descs = append(descs, m.Layers...)
+	descs = append(descs, m.Blobs...)
+	descs = append(descs, m.Manifests...)
+
+	var deps core.DigestList
+	for _, desc := range descs {
+		if desc.Digest.Hex() == "" {
+			return nil, fmt.Errorf("descriptor of type %q has no digest", desc.MediaType)
+		}
+		deps = append(deps, desc.Digest)
+	}
+	return append(deps, d), nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagtype
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/utils/mockutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+const _helmConfigType = "application/vnd.cncf.helm.config.v1+json"
+
+func ociDescriptorFixture(mediaType string, d core.Digest) map[string]interface{} {
+	return map[string]interface{}{"mediaType": mediaType, "digest": d.String(), "size": 1}
+}
+
+// ociBlobFixture returns the digest and content of a JSON manifest.
+func ociBlobFixture(manifest map[string]interface{}) (core.Digest, []byte) {
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		panic(err)
+	}
+	d, err := core.NewDigester().FromBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return d, b
+}
+
+func newOCIMap(t *testing.T, options map[string]interface{}) (*Map, *mockblobclient.MockClusterClient, func()) {
+	ctrl := gomock.NewController(t)
+	originClient := mockblobclient.NewMockClusterClient(ctrl)
+	m, err := NewMap([]Config{{Namespace: ".*", Type: "oci", Options: options}}, originClient)
+	require.NoError(t, err)
+	return m, originClient, ctrl.Finish
+}
+
+func TestOCIResolverHelmChart(t *testing.T) {
+	require := require.New(t)
+
+	m, originClient, cleanup := newOCIMap(t, map[string]interface{}{
+		"artifact_types": []string{_helmConfigType},
+	})
+	defer cleanup()
+
+	config := core.DigestFixture()
+	chart := core.DigestFixture()
+	manifest, b := ociBlobFixture(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config":        ociDescriptorFixture(_helmConfigType, config),
+		"layers": []interface{}{
+			ociDescriptorFixture("application/vnd.cncf.helm.chart.content.v1.tar+gzip", chart),
+		},
+	})
+
+	tag := "charts/nginx:1.0.0"
+	originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+	deps, err := m.Resolve(tag, manifest)
+	require.NoError(err)
+	require.Equal(core.DigestList{config, chart, manifest}, deps)
+}
+
+func TestOCIResolverArtifactManifest(t *testing.T) {
+	require := require.New(t)
+
+	m, originClient, cleanup := newOCIMap(t, map[string]interface{}{
+		"artifact_types": []string{"application/vnd.example.model"},
+	})
+	defer cleanup()
+
+	weights := core.DigestFixture()
+	tokenizer := core.DigestFixture()
+	manifest, b := ociBlobFixture(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.artifact.manifest.v1+json",
+		"artifactType":  "application/vnd.example.model",
+		"blobs": []interface{}{
+			ociDescriptorFixture("application/octet-stream", weights),
+			ociDescriptorFixture("application/json", tokenizer),
+		},
+	})
+
+	tag := "models/llm:v3"
+	originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+	deps, err := m.Resolve(tag, manifest)
+	require.NoError(err)
+	require.Equal(core.DigestList{weights, tokenizer, manifest}, deps)
+}
+
+func TestOCIResolverIndex(t *testing.T) {
+	require := require.New(t)
+
+	m, originClient, cleanup := newOCIMap(t, map[string]interface{}{
+		"artifact_types": []string{_helmConfigType},
+	})
+	defer cleanup()
+
+	amd64 := core.DigestFixture()
+	arm64 := core.DigestFixture()
+	index, b := ociBlobFixture(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.index.v1+json",
+		"manifests": []interface{}{
+			ociDescriptorFixture("application/vnd.oci.image.manifest.v1+json", amd64),
+			ociDescriptorFixture("application/vnd.oci.image.manifest.v1+json", arm64),
+		},
+	})
+
+	tag := "wasm/module:v1"
+	originClient.EXPECT().DownloadBlob(tag, index, mockutil.MatchWriter(b)).Return(nil)
+
+	deps, err := m.Resolve(tag, index)
+	require.NoError(err)
+	require.Equal(core.DigestList{amd64, arm64, index}, deps)
+}
+
+func TestOCIResolverErrors(t *testing.T) {
+	tests := []struct {
+		desc     string
+		manifest map[string]interface{}
+	}{
+		{
+			"unsupported artifact type",
+			map[string]interface{}{
+				"schemaVersion": 2,
+				"config":        ociDescriptorFixture("application/vnd.oci.image.config.v1+json", core.DigestFixture()),
+			},
+		}, {
+			"unsupported schema version",
+			map[string]interface{}{
+				"schemaVersion": 1,
+				"config":        ociDescriptorFixture(_helmConfigType, core.DigestFixture()),
+			},
+		}, {
+			"missing digest",
+			map[string]interface{}{
+				"schemaVersion": 2,
+				"config":        map[string]interface{}{"mediaType": _helmConfigType},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			m, originClient, cleanup := newOCIMap(t, map[string]interface{}{
+				"artifact_types": []string{_helmConfigType},
+			})
+			defer cleanup()
+
+			manifest, b := ociBlobFixture(test.manifest)
+
+			tag := "charts/nginx:1.0.0"
+			originClient.EXPECT().DownloadBlob(tag, manifest, mockutil.MatchWriter(b)).Return(nil)
+
+			_, err := m.Resolve(tag, manifest)
+			require.Error(err)
+		})
+	}
+}
+
+func TestOCIResolverInvalidOptions(t *testing.T) {
+	_, err := NewMap([]Config{{
+		Namespace: ".*",
+		Type:      "oci",
+		Options:   map[string]interface{}{"artifact_type": "typo"},
+	}}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagtype
+
+import (
+	"fmt"
+
+	"github.com/uber/kraken/origin/blobclient"
+	"gopkg.in/yaml.v2"
+)
+
+var _factories = make(map[string]ResolverFactory)
+
+func init() {
+	Register("default", defaultFactory{})
+	Register("docker", dockerFactory{})
+	Register("oci", ociFactory{})
+}
+
+// ResolverFactory creates DependencyResolvers for a tag type. options holds
+// the options of the tag type config, and may be decoded with DecodeOptions.
+type ResolverFactory interface {
+	Create(options map[string]interface{}, originClient blobclient.ClusterClient) (DependencyResolver, error)
+}
+
+// Register registers factory as the resolver of tags of type name. Resolvers
+// for custom artifact formats should be registered before NewMap is called,
+// usually from an init function. Registering a name twice replaces the
+// previous factory.
+func Register(name string, factory ResolverFactory) {
+	_factories[name] = factory
+}
+
+// getFactory returns the resolver factory registered for name.
+func getFactory(name string) (ResolverFactory, error) {
+	factory, ok := _factories[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s is undefined", name)
+	}
+	return factory, nil
+}
+
+// DecodeOptions decodes tag type options into v, which should be a pointer to
+// a struct with yaml tags.
+func DecodeOptions(options map[string]interface{}, v interface{}) error {
+	b, err := yaml.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("marshal options: %s", err)
+	}
+	if err := yaml.UnmarshalStrict(b, v); err != nil {
+		return fmt.Errorf("unmarshal options: %s", err)
+	}
+	return nil
+}
+
+type defaultFactory struct{}
+
+func (defaultFactory) Create(
+	options map[string]interface{}, originClient blobclient.ClusterClient) (DependencyResolver, error) {
+
+	return &defaultResolver{}, nil
+}
+
+type dockerFactory struct{}
+
+func (dockerFactory) Create(
+	options map[string]interface{}, originClient blobclient.ClusterClient) (DependencyResolver, error) {
+
+	return &dockerResolver{originClient}, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tagtype
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+
+	"github.com/stretchr/testify/require"
+)
+
+// staticResolver resolves every tag to a fixed list of digests.
+type staticResolver struct {
+	deps core.DigestList
+}
+
+func (r staticResolver) Resolve(tag string, d core.Digest) (core.DigestList, error) {
+	return append(r.deps, d), nil
+}
+
+type staticOptions struct {
+	Deps []string `yaml:"deps"`
+}
+
+type staticFactory struct{}
+
+func (staticFactory) Create(
+	options map[string]interface{}, originClient blobclient.ClusterClient) (DependencyResolver, error) {
+
+	var o staticOptions
+	if err := DecodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	var r staticResolver
+	for _, raw := range o.Deps {
+		d, err := core.ParseSHA256Digest(raw)
+		if err != nil {
+			return nil, err
+		}
+		r.deps = append(r.deps, d)
+	}
+	return r, nil
+}
+
+func TestRegisteredResolver(t *testing.T) {
+	require := require.New(t)
+
+	Register("static", staticFactory{})
+	defer delete(_factories, "static")
+
+	dep := core.DigestFixture()
+
+	m, err := NewMap([]Config{{
+		Namespace: ".*",
+		Type:      "static",
+		Options:   map[string]interface{}{"deps": []string{dep.String()}},
+	}}, nil)
+	require.NoError(err)
+
+	d := core.DigestFixture()
+	deps, err := m.Resolve("wasm/module:v1", d)
+	require.NoError(err)
+	require.Equal(core.DigestList{dep, d}, deps)
+}
+
+func TestRegisteredResolverInvalidOptions(t *testing.T) {
+	require := require.New(t)
+
+	Register("static", staticFactory{})
+	defer delete(_factories, "static")
+
+	_, err := NewMap([]Config{{
+		Namespace: ".*",
+		Type:      "static",
+		Options:   map[string]interface{}{"unknown": true},
+	}}, nil)
+	require.Error(err)
+}
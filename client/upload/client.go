@@ -0,0 +1,146 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package upload provides a client for publishing blobs and tags to Kraken
+// programmatically, without building images or running docker push.
+package upload
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/origin/blobclient"
+)
+
+// Client uploads blobs to the origin cluster and tags them in the build-index.
+type Client struct {
+	config  Config
+	origins blobclient.ClusterClient
+	tags    tagclient.Client
+}
+
+// New creates a new Client for the origin cluster and build-indexes in config.
+func New(config Config) (*Client, error) {
+	config = config.applyDefaults()
+
+	if _, err := core.NewDigesterForAlgo(config.DigestAlgorithm); err != nil {
+		return nil, err
+	}
+	tls, err := config.TLS.BuildClient()
+	if err != nil {
+		return nil, fmt.Errorf("build tls config: %s", err)
+	}
+	originOpts := []blobclient.Option{
+		blobclient.WithTLS(tls),
+		blobclient.WithChunkSize(config.ChunkSize),
+		blobclient.WithChunkRetries(config.ChunkRetries, config.ChunkRetryInterval),
+	}
+	origins, err := config.Origin.Build(
+		upstream.WithHealthCheck(blobclient.NewHealthChecker(originOpts...)))
+	if err != nil {
+		return nil, fmt.Errorf("build origin hosts: %s", err)
+	}
+	buildIndexes, err := config.BuildIndex.Build(
+		upstream.WithHealthCheck(healthcheck.Default(tls)))
+	if err != nil {
+		return nil, fmt.Errorf("build build-index hosts: %s", err)
+	}
+	r := blobclient.NewClientResolver(blobclient.NewProvider(originOpts...), origins)
+	return NewWithClients(
+		config,
+		blobclient.NewClusterClient(r),
+		tagclient.NewClusterClient(buildIndexes, tls)), nil
+}
+
+// NewWithClients creates a new Client which uploads through existing origin
+// and build-index clients.
+func NewWithClients(
+	config Config, origins blobclient.ClusterClient, tags tagclient.Client) *Client {
+
+	return &Client{config.applyDefaults(), origins, tags}
+}
+
+// UploadBlob uploads blob to namespace and returns its digest. Blobs which
+// already exist in the origin cluster are not uploaded again.
+func (c *Client) UploadBlob(namespace string, blob io.ReadSeeker) (core.Digest, error) {
+	digester, err := core.NewDigesterForAlgo(c.config.DigestAlgorithm)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	d, err := digester.FromReader(blob)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("compute digest: %s", err)
+	}
+	if _, err := c.origins.Stat(namespace, d); err == nil {
+		return d, nil
+	} else if err != blobclient.ErrBlobNotFound {
+		return core.Digest{}, fmt.Errorf("stat: %s", err)
+	}
+	if _, err := blob.Seek(0, io.SeekStart); err != nil {
+		return core.Digest{}, fmt.Errorf("seek: %s", err)
+	}
+	if err := c.origins.UploadBlob(namespace, d, blob); err != nil {
+		return core.Digest{}, fmt.Errorf("upload: %s", err)
+	}
+	return d, nil
+}
+
+// UploadBlobStream uploads blob to namespace as d without buffering it, e.g.
+// when blob is piped from another service which already knows its digest. The
+// upload fails with blobclient.ErrDigestMismatch if blob does not hash to d.
+func (c *Client) UploadBlobStream(namespace string, d core.Digest, blob io.Reader) error {
+	if _, err := c.origins.Stat(namespace, d); err == nil {
+		return nil
+	} else if err != blobclient.ErrBlobNotFound {
+		return fmt.Errorf("stat: %s", err)
+	}
+	if err := c.origins.UploadBlobStream(namespace, d, blob); err != nil {
+		return fmt.Errorf("upload: %s", err)
+	}
+	return nil
+}
+
+// UploadFile uploads the file at path to namespace and returns its digest.
+func (c *Client) UploadFile(namespace, path string) (core.Digest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("open: %s", err)
+	}
+	defer f.Close()
+	return c.UploadBlob(namespace, f)
+}
+
+// PutTag points tag at d. The blob of d must have been uploaded first.
+func (c *Client) PutTag(tag string, d core.Digest) error {
+	if c.config.Replicate {
+		return c.tags.PutAndReplicate(tag, d)
+	}
+	return c.tags.Put(tag, d)
+}
+
+// Publish uploads blob to namespace and points tag at it.
+func (c *Client) Publish(namespace, tag string, blob io.ReadSeeker) (core.Digest, error) {
+	d, err := c.UploadBlob(namespace, blob)
+	if err != nil {
+		return core.Digest{}, err
+	}
+	if err := c.PutTag(tag, d); err != nil {
+		return core.Digest{}, fmt.Errorf("put tag: %s", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/origin/blobclient"
+)
+
+const _testNamespace = "artifacts/build"
+
+type clientMocks struct {
+	origins *mockblobclient.MockClusterClient
+	tags    *mocktagclient.MockClient
+}
+
+func newClientMocks(ctrl *gomock.Controller) *clientMocks {
+	return &clientMocks{
+		origins: mockblobclient.NewMockClusterClient(ctrl),
+		tags:    mocktagclient.NewMockClient(ctrl),
+	}
+}
+
+func (m *clientMocks) new(config Config) *Client {
+	return NewWithClients(config, m.origins, m.tags)
+}
+
+func TestPublish(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+	tag := "artifacts/build:latest"
+
+	var uploaded []byte
+	gomock.InOrder(
+		mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound),
+		mocks.origins.EXPECT().UploadBlob(_testNamespace, blob.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, r io.Reader) error {
+				var err error
+				uploaded, err = ioutil.ReadAll(r)
+				return err
+			}),
+		mocks.tags.EXPECT().Put(tag, blob.Digest).Return(nil),
+	)
+
+	d, err := client.Publish(_testNamespace, tag, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+	require.Equal(blob.Content, uploaded)
+}
+
+func TestPublishReplicates(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{Replicate: true})
+
+	blob := core.NewBlobFixture()
+	tag := "artifacts/build:latest"
+
+	mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(core.NewBlobInfo(256), nil)
+	mocks.tags.EXPECT().PutAndReplicate(tag, blob.Digest).Return(nil)
+
+	_, err := client.Publish(_testNamespace, tag, bytes.NewReader(blob.Content))
+	require.NoError(err)
+}
+
+func TestUploadBlobSkipsExistingBlobs(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(core.NewBlobInfo(256), nil)
+
+	d, err := client.UploadBlob(_testNamespace, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+}
+
+func TestUploadBlobWithDigestAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{DigestAlgorithm: core.SHA512})
+
+	blob := core.SizedBlobFixtureForAlgo(256, 8, core.SHA512)
+
+	mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
+	mocks.origins.EXPECT().UploadBlob(_testNamespace, blob.Digest, gomock.Any()).Return(nil)
+
+	d, err := client.UploadBlob(_testNamespace, bytes.NewReader(blob.Content))
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+}
+
+func TestUploadBlobStream(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	var uploaded []byte
+	gomock.InOrder(
+		mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound),
+		mocks.origins.EXPECT().UploadBlobStream(_testNamespace, blob.Digest, gomock.Any()).DoAndReturn(
+			func(namespace string, d core.Digest, r io.Reader) error {
+				var err error
+				uploaded, err = ioutil.ReadAll(r)
+				return err
+			}),
+	)
+
+	require.NoError(client.UploadBlobStream(
+		_testNamespace, blob.Digest, ioutil.NopCloser(bytes.NewReader(blob.Content))))
+	require.Equal(blob.Content, uploaded)
+}
+
+func TestUploadFile(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	f, err := ioutil.TempFile("", "")
+	require.NoError(err)
+	defer os.Remove(f.Name())
+	_, err = f.Write(blob.Content)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
+	mocks.origins.EXPECT().UploadBlob(_testNamespace, blob.Digest, gomock.Any()).Return(nil)
+
+	d, err := client.UploadFile(_testNamespace, f.Name())
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+}
+
+func TestPublishDoesNotTagFailedUploads(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mocks := newClientMocks(ctrl)
+	client := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	mocks.origins.EXPECT().Stat(_testNamespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
+	mocks.origins.EXPECT().UploadBlob(
+		_testNamespace, blob.Digest, gomock.Any()).Return(errors.New("some error"))
+
+	_, err := client.Publish(_testNamespace, "artifacts/build:latest", bytes.NewReader(blob.Content))
+	require.Error(err)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package upload
+
+import (
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/memsize"
+)
+
+// Config defines Client configuration.
+type Config struct {
+	Origin     upstream.ActiveConfig `yaml:"origin"`
+	BuildIndex upstream.ActiveConfig `yaml:"build_index"`
+	TLS        httputil.TLSConfig    `yaml:"tls"`
+
+	// ChunkSize is the size of each chunk blobs are uploaded in.
+	ChunkSize uint64 `yaml:"chunk_size"`
+
+	// ChunkRetries is the number of times a chunk which failed to upload is
+	// resent before the upload fails.
+	ChunkRetries int `yaml:"chunk_retries"`
+
+	// ChunkRetryInterval is the time waited before resending a failed chunk.
+	ChunkRetryInterval time.Duration `yaml:"chunk_retry_interval"`
+
+	// Replicate enables replication of tags to remote build-indexes.
+	Replicate bool `yaml:"replicate"`
+
+	// DigestAlgorithm is the algorithm blobs are digested with. Origins must
+	// allow the algorithm for the namespaces blobs are uploaded to. Defaults
+	// to sha256.
+	DigestAlgorithm string `yaml:"digest_algorithm"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.ChunkSize == 0 {
+		c.ChunkSize = 32 * memsize.MB
+	}
+	if c.ChunkRetries == 0 {
+		c.ChunkRetries = 3
+	}
+	if c.ChunkRetryInterval == 0 {
+		c.ChunkRetryInterval = time.Second
+	}
+	if c.DigestAlgorithm == "" {
+		c.DigestAlgorithm = core.SHA256
+	}
+	return c
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package core
+
+import (
+	"hash"
+
+	"github.com/zeebo/blake3"
+)
+
+// BLAKE3 is the 256-bit blake3 digest algorithm.
+const BLAKE3 = "blake3"
+
+func init() {
+	RegisterDigestAlgorithm(BLAKE3, 32, func() hash.Hash { return blake3.New() })
+}
@@ -40,7 +40,8 @@ func (l *DigestList) Scan(src interface{}) error {
 	return json.Unmarshal(src.([]byte), l)
 }
 
-// Digest can be represented in a string like "<algorithm>:<hex_digest_string>"
+// Digest can be represented in a string like "<algorithm>:<hex_digest_string>",
+// where the algorithm is sha256 by default or any other supported algorithm.
 // Example:
 // 	 sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
 type Digest struct {
@@ -62,6 +63,40 @@ func NewSHA256DigestFromHex(hex string) (Digest, error) {
 	}, nil
 }
 
+// NewDigestFromHex constructs a Digest of algo from a hash in hexadecimal
+// format. Returns error if algo is unsupported or hex is not a valid hash of
+// algo.
+func NewDigestFromHex(algo, hex string) (Digest, error) {
+	if err := validateHex(algo, hex); err != nil {
+		return Digest{}, err
+	}
+	return Digest{
+		algo: algo,
+		hex:  hex,
+		raw:  fmt.Sprintf("%s:%s", algo, hex),
+	}, nil
+}
+
+// ParseDigest parses a raw "<algo>:<hex>" digest of any supported algorithm.
+func ParseDigest(raw string) (Digest, error) {
+	if raw == "" {
+		return Digest{}, errors.New("invalid digest: empty")
+	}
+	parts := strings.Split(raw, ":")
+	if len(parts) != 2 {
+		return Digest{}, errors.New("invalid digest: expected '<algo>:<hex>'")
+	}
+	return NewDigestFromHex(parts[0], parts[1])
+}
+
+// NewDigestFromName constructs a Digest from its Name.
+func NewDigestFromName(name string) (Digest, error) {
+	if i := strings.LastIndex(name, _nameAlgoSeparator); i >= 0 {
+		return NewDigestFromHex(name[i+1:], name[:i])
+	}
+	return NewSHA256DigestFromHex(name)
+}
+
 // ParseSHA256Digest parses a raw "<algo>:<hex>" sha256 digest. Returns error if the
 // algo is not sha256 or the hex is not a valid sha256.
 func ParseSHA256Digest(raw string) (Digest, error) {
@@ -107,7 +142,7 @@ func (d *Digest) UnmarshalJSON(str []byte) error {
 	if err := json.Unmarshal(str, &raw); err != nil {
 		return err
 	}
-	digest, err := ParseSHA256Digest(raw)
+	digest, err := ParseDigest(raw)
 	if err != nil {
 		return err
 	}
@@ -139,6 +174,21 @@ func (d Digest) Hex() string {
 	return d.hex
 }
 
+// _nameAlgoSeparator separates the hex and algo of digest names. Hex digests
+// never contain it.
+const _nameAlgoSeparator = "."
+
+// Name returns the name of blobs of the digest in stores and backends. Names
+// of sha256 digests are their hex, while names of other digests are suffixed
+// with their algo, e.g. "<hex>.sha512", such that names still start with the
+// hex and shard evenly.
+func (d Digest) Name() string {
+	if d.algo == SHA256 {
+		return d.hex
+	}
+	return d.hex + _nameAlgoSeparator + d.algo
+}
+
 // ShardID returns the shard id of the digest.
 func (d Digest) ShardID() string {
 	return d.hex[:4]
@@ -154,3 +204,23 @@ func ValidateSHA256(s string) error {
 	}
 	return nil
 }
+
+func validateHex(algo, s string) error {
+	if algo == SHA256 {
+		if err := ValidateSHA256(s); err != nil {
+			return fmt.Errorf("invalid sha256: %s", err)
+		}
+		return nil
+	}
+	a, err := getDigestAlgorithm(algo)
+	if err != nil {
+		return fmt.Errorf("invalid digest algo: %s", err)
+	}
+	if len(s) != 2*a.size {
+		return fmt.Errorf("invalid %s: expected %d characters, got %d from %q", algo, 2*a.size, len(s), s)
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return fmt.Errorf("invalid %s: hex: %s", algo, err)
+	}
+	return nil
+}
@@ -16,6 +16,7 @@ package core
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -96,6 +97,70 @@ func TestParseSHA256DigestErrors(t *testing.T) {
 	}
 }
 
+func TestParseDigest(t *testing.T) {
+	require := require.New(t)
+
+	hex := strings.Repeat("ab", 64)
+	d, err := ParseDigest("sha512:" + hex)
+	require.NoError(err)
+	require.Equal(SHA512, d.Algo())
+	require.Equal(hex, d.Hex())
+	require.Equal("sha512:"+hex, d.String())
+	require.Equal("abab", d.ShardID())
+}
+
+func TestParseDigestErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+	}{
+		{"empty", ""},
+		{"no algo", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"unsupported algo", "sha1:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"wrong length", "sha512:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"invalid hex", "sha512:" + strings.Repeat("zz", 64)},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := ParseDigest(test.input)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestDigestName(t *testing.T) {
+	sha256 := DigestFixture()
+	sha512, err := NewDigestFromHex(SHA512, strings.Repeat("ab", 64))
+	require.NoError(t, err)
+
+	tests := []struct {
+		desc     string
+		digest   Digest
+		expected string
+	}{
+		{"sha256", sha256, sha256.Hex()},
+		{"sha512", sha512, sha512.Hex() + ".sha512"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			require.Equal(test.expected, test.digest.Name())
+
+			result, err := NewDigestFromName(test.digest.Name())
+			require.NoError(err)
+			require.Equal(test.digest, result)
+		})
+	}
+}
+
+func TestNewDigestFromNameErrors(t *testing.T) {
+	for _, name := range []string{"", "invalid", DigestFixture().Hex() + ".sha512"} {
+		_, err := NewDigestFromName(name)
+		require.Error(t, err)
+	}
+}
+
 func TestDigestStringConversion(t *testing.T) {
 	d := DigestFixture()
 	result, err := ParseSHA256Digest(d.String())
@@ -15,31 +15,86 @@ package core
 
 import (
 	"crypto"
+	_ "crypto/sha512" // For computing sha512 digests.
 	"encoding/hex"
+	"fmt"
 	"hash"
 	"io"
+	"sort"
 )
 
+// Digest algorithms supported out of the box.
 const (
-	// SHA256 is the only algorithm supported.
+	// SHA256 is the default algorithm.
 	SHA256 = "sha256"
+	SHA512 = "sha512"
 )
 
+type digestAlgorithm struct {
+	size    int
+	newHash func() hash.Hash
+}
+
+var _digestAlgorithms = map[string]digestAlgorithm{
+	SHA256: {crypto.SHA256.Size(), crypto.SHA256.New},
+	SHA512: {crypto.SHA512.Size(), crypto.SHA512.New},
+}
+
+// RegisterDigestAlgorithm registers a digest algorithm under algo, whose
+// hashes are size bytes long. Algorithms registered in init functions, e.g.
+// blake3, may be used wherever digests are parsed.
+func RegisterDigestAlgorithm(algo string, size int, newHash func() hash.Hash) {
+	_digestAlgorithms[algo] = digestAlgorithm{size, newHash}
+}
+
+// DigestAlgorithms returns the names of all supported digest algorithms.
+func DigestAlgorithms() []string {
+	var algos []string
+	for algo := range _digestAlgorithms {
+		algos = append(algos, algo)
+	}
+	sort.Strings(algos)
+	return algos
+}
+
+func getDigestAlgorithm(algo string) (digestAlgorithm, error) {
+	a, ok := _digestAlgorithms[algo]
+	if !ok {
+		return digestAlgorithm{}, fmt.Errorf("unsupported digest algorithm %q", algo)
+	}
+	return a, nil
+}
+
 // Digester calculates the digest of data stream.
 type Digester struct {
+	algo string
 	hash hash.Hash
 }
 
-// NewDigester instantiates and returns a new Digester object.
+// NewDigester instantiates and returns a new sha256 Digester object.
 func NewDigester() *Digester {
 	return &Digester{
+		algo: SHA256,
 		hash: crypto.SHA256.New(),
 	}
 }
 
+// NewDigesterForAlgo returns a new Digester which calculates digests using
+// algo.
+func NewDigesterForAlgo(algo string) (*Digester, error) {
+	a, err := getDigestAlgorithm(algo)
+	if err != nil {
+		return nil, err
+	}
+	return &Digester{
+		algo: algo,
+		hash: a.newHash(),
+	}, nil
+}
+
 // Digest returns the digest of existing data.
 func (d *Digester) Digest() Digest {
-	digest, err := NewSHA256DigestFromHex(hex.EncodeToString(d.hash.Sum(nil)))
+	digest, err := NewDigestFromHex(d.algo, hex.EncodeToString(d.hash.Sum(nil)))
 	if err != nil {
 		// This should never fail.
 		panic(err)
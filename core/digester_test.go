@@ -79,3 +79,39 @@ func TestTeeReader(t *testing.T) {
 	require.NoError(ValidateSHA256(hexDigest))
 	require.Equal(_expectedHex, hexDigest)
 }
+
+func TestNewDigesterForAlgo(t *testing.T) {
+	require := require.New(t)
+
+	d, err := NewDigesterForAlgo(SHA512)
+	require.NoError(err)
+	digest, err := d.FromBytes([]byte(_testStr))
+	require.NoError(err)
+	require.Equal(SHA512, digest.Algo())
+	require.Equal(
+		"ee26b0dd4af7e749aa1a8ee3c10ae9923f618980772e473f8819a5d4940e0db2"+
+			"7ac185f8a0e1d5f84f88bc887fd67b143732c304cc5fa9ad8e6f57f50028a8ff",
+		digest.Hex())
+}
+
+func TestNewDigesterForAlgoUnsupported(t *testing.T) {
+	_, err := NewDigesterForAlgo("md5")
+	require.Error(t, err)
+}
+
+func TestNewDigesterForBLAKE3(t *testing.T) {
+	require := require.New(t)
+
+	d, err := NewDigesterForAlgo(BLAKE3)
+	require.NoError(err)
+	digest, err := d.FromBytes([]byte(_testStr))
+	require.NoError(err)
+	require.Equal(BLAKE3, digest.Algo())
+	require.Equal(
+		"4878ca0425c739fa427f7eda20fe845f6b2e46ba5fe2a14df5b1e32f50603215",
+		digest.Hex())
+
+	parsed, err := ParseDigest(digest.String())
+	require.NoError(err)
+	require.Equal(digest, parsed)
+}
@@ -60,6 +60,29 @@ func SizedBlobFixture(size uint64, pieceLength uint64) *BlobFixture {
 	}
 }
 
+// SizedBlobFixtureForAlgo creates a randomly generated BlobFixture of given
+// size with given piece lengths, whose digest is calculated using algo.
+func SizedBlobFixtureForAlgo(size uint64, pieceLength uint64, algo string) *BlobFixture {
+	b := randutil.Text(size)
+	digester, err := NewDigesterForAlgo(algo)
+	if err != nil {
+		panic(err)
+	}
+	d, err := digester.FromBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	mi, err := NewMetaInfo(d, bytes.NewReader(b), int64(pieceLength))
+	if err != nil {
+		panic(err)
+	}
+	return &BlobFixture{
+		Content:  b,
+		Digest:   d,
+		MetaInfo: mi,
+	}
+}
+
 // NewBlobFixture creates a randomly generated BlobFixture.
 func NewBlobFixture() *BlobFixture {
 	return SizedBlobFixture(256, 8)
@@ -60,7 +60,7 @@ func NewMetaInfo(d Digest, blob io.Reader, pieceLength int64) (*MetaInfo, error)
 	info := info{
 		PieceLength: pieceLength,
 		PieceSums:   pieceSums,
-		Name:        d.Hex(),
+		Name:        d.Name(),
 		Length:      length,
 	}
 	h, err := info.Hash()
@@ -139,7 +139,7 @@ func DeserializeMetaInfo(data []byte) (*MetaInfo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("compute info hash: %s", err)
 	}
-	d, err := NewSHA256DigestFromHex(j.Info.Name)
+	d, err := NewDigestFromName(j.Info.Name)
 	if err != nil {
 		return nil, fmt.Errorf("parse name: %s", err)
 	}
@@ -26,6 +26,10 @@ type PeerContext struct {
 	IP   string `json:"ip"`
 	Port int    `json:"port"`
 
+	// Addrs are additional host:port addresses the peer announces, which
+	// remote peers dial if IP and Port are unreachable.
+	Addrs []string `json:"addrs,omitempty"`
+
 	// PeerID the peer will identify itself as.
 	PeerID PeerID `json:"peer_id"`
 
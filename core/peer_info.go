@@ -13,7 +13,11 @@
 // limitations under the License.
 package core
 
-import "sort"
+import (
+	"net"
+	"sort"
+	"strconv"
+)
 
 // PeerInfo defines peer metadata scoped to a torrent.
 type PeerInfo struct {
@@ -22,6 +26,10 @@ type PeerInfo struct {
 	Port     int    `json:"port"`
 	Origin   bool   `json:"origin"`
 	Complete bool   `json:"complete"`
+
+	// Addrs are additional host:port addresses the peer is reachable at, e.g.
+	// its IPv6 address or the addresses of other network interfaces.
+	Addrs []string `json:"addrs,omitempty"`
 }
 
 // NewPeerInfo creates a new PeerInfo.
@@ -43,7 +51,23 @@ func NewPeerInfo(
 
 // PeerInfoFromContext derives PeerInfo from a PeerContext.
 func PeerInfoFromContext(pctx PeerContext, complete bool) *PeerInfo {
-	return NewPeerInfo(pctx.PeerID, pctx.IP, pctx.Port, pctx.Origin, complete)
+	p := NewPeerInfo(pctx.PeerID, pctx.IP, pctx.Port, pctx.Origin, complete)
+	p.Addrs = pctx.Addrs
+	return p
+}
+
+// DialAddrs returns all addresses of p, starting with its announced ip and
+// port, without duplicates.
+func (p *PeerInfo) DialAddrs() []string {
+	addrs := []string{net.JoinHostPort(p.IP, strconv.Itoa(p.Port))}
+	seen := map[string]bool{addrs[0]: true}
+	for _, addr := range p.Addrs {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
 }
 
 // PeerInfos groups PeerInfo structs for sorting.
@@ -30,3 +30,17 @@ func TestSortedByPeerID(t *testing.T) {
 	require.True(sorted[0].PeerID.LessThan(sorted[1].PeerID))
 	require.True(sorted[1].PeerID.LessThan(sorted[2].PeerID))
 }
+
+func TestPeerInfoDialAddrs(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPeerInfo(PeerIDFixture(), "10.0.0.1", 8000, false, false)
+	require.Equal([]string{"10.0.0.1:8000"}, p.DialAddrs())
+
+	p.Addrs = []string{"[fd00::1]:8000", "10.0.0.1:8000", "192.168.0.1:8000"}
+	require.Equal(
+		[]string{"10.0.0.1:8000", "[fd00::1]:8000", "192.168.0.1:8000"}, p.DialAddrs())
+
+	p = NewPeerInfo(PeerIDFixture(), "fd00::2", 8000, false, false)
+	require.Equal([]string{"[fd00::2]:8000"}, p.DialAddrs())
+}
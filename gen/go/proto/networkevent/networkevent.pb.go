@@ -0,0 +1,139 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Code generated by protoc-gen-go.
+// source: proto/networkevent/networkevent.proto
+// DO NOT EDIT!
+
+/*
+Package networkevent is a generated protocol buffer package.
+
+It is generated from these files:
+	proto/networkevent/networkevent.proto
+
+It has these top-level messages:
+	Event
+*/
+package networkevent
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// Names of network events.
+type EventName int32
+
+const (
+	EventName_UNKNOWN           EventName = 0
+	EventName_ADD_TORRENT       EventName = 1
+	EventName_ADD_ACTIVE_CONN   EventName = 2
+	EventName_DROP_ACTIVE_CONN  EventName = 3
+	EventName_BLACKLIST_CONN    EventName = 4
+	EventName_REQUEST_PIECE     EventName = 5
+	EventName_RECEIVE_PIECE     EventName = 6
+	EventName_TORRENT_COMPLETE  EventName = 7
+	EventName_TORRENT_CANCELLED EventName = 8
+)
+
+var EventName_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "ADD_TORRENT",
+	2: "ADD_ACTIVE_CONN",
+	3: "DROP_ACTIVE_CONN",
+	4: "BLACKLIST_CONN",
+	5: "REQUEST_PIECE",
+	6: "RECEIVE_PIECE",
+	7: "TORRENT_COMPLETE",
+	8: "TORRENT_CANCELLED",
+}
+var EventName_value = map[string]int32{
+	"UNKNOWN":           0,
+	"ADD_TORRENT":       1,
+	"ADD_ACTIVE_CONN":   2,
+	"DROP_ACTIVE_CONN":  3,
+	"BLACKLIST_CONN":    4,
+	"REQUEST_PIECE":     5,
+	"RECEIVE_PIECE":     6,
+	"TORRENT_COMPLETE":  7,
+	"TORRENT_CANCELLED": 8,
+}
+
+func (x EventName) String() string {
+	return proto.EnumName(EventName_name, int32(x))
+}
+func (EventName) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+// A network event emitted by a peer. Fields after self are only set for the
+// events they apply to.
+type Event struct {
+	Name    EventName `protobuf:"varint,1,opt,name=name,enum=networkevent.EventName" json:"name,omitempty"`
+	Torrent string    `protobuf:"bytes,2,opt,name=torrent" json:"torrent,omitempty"`
+	Self    string    `protobuf:"bytes,3,opt,name=self" json:"self,omitempty"`
+	// Time of the event in nanoseconds since the unix epoch.
+	TimestampNanos int64  `protobuf:"varint,4,opt,name=timestampNanos" json:"timestampNanos,omitempty"`
+	Peer           string `protobuf:"bytes,5,opt,name=peer" json:"peer,omitempty"`
+	Piece          int32  `protobuf:"varint,6,opt,name=piece" json:"piece,omitempty"`
+	Bitfield       []bool `protobuf:"varint,7,rep,packed,name=bitfield" json:"bitfield,omitempty"`
+	DurationMs     int64  `protobuf:"varint,8,opt,name=durationMs" json:"durationMs,omitempty"`
+	ConnCapacity   int32  `protobuf:"varint,9,opt,name=connCapacity" json:"connCapacity,omitempty"`
+}
+
+func (m *Event) Reset()                    { *m = Event{} }
+func (m *Event) String() string            { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()               {}
+func (*Event) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func init() {
+	proto.RegisterType((*Event)(nil), "networkevent.Event")
+	proto.RegisterEnum("networkevent.EventName", EventName_name, EventName_value)
+}
+
+func init() { proto.RegisterFile("proto/networkevent/networkevent.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 361 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0xd1, 0x8e, 0x93, 0x40,
+	0x14, 0x86, 0xa5, 0x40, 0xa1, 0x67, 0xd7, 0x2e, 0x7b, 0x5c, 0xe3, 0xc4, 0x0b, 0x43, 0x36, 0xd1,
+	0x10, 0x4d, 0xd6, 0x44, 0x9f, 0x00, 0x87, 0xb9, 0x68, 0x96, 0x1d, 0xea, 0x2c, 0xab, 0x97, 0x84,
+	0xb6, 0xd3, 0x84, 0x58, 0x06, 0x02, 0xa3, 0xc6, 0xf7, 0xf0, 0x6d, 0x7c, 0x39, 0xc3, 0xa0, 0x4d,
+	0xd9, 0xbb, 0xff, 0xff, 0xe6, 0xfc, 0xe7, 0xcf, 0xe4, 0xc0, 0xeb, 0xb6, 0x6b, 0x74, 0xf3, 0x5e,
+	0x49, 0xfd, 0xb3, 0xe9, 0xbe, 0xc9, 0x1f, 0x52, 0xe9, 0x89, 0xb9, 0x31, 0xef, 0x78, 0x7e, 0xca,
+	0xae, 0x7f, 0xcf, 0xc0, 0x65, 0x83, 0xc2, 0x77, 0xe0, 0xa8, 0xb2, 0x96, 0xc4, 0x0a, 0xad, 0x68,
+	0xf9, 0xe1, 0xc5, 0xcd, 0x24, 0x6a, 0x46, 0x78, 0x59, 0x4b, 0x61, 0x86, 0x90, 0x80, 0xa7, 0x9b,
+	0xae, 0x93, 0x4a, 0x93, 0x59, 0x68, 0x45, 0x0b, 0xf1, 0xdf, 0x22, 0x82, 0xd3, 0xcb, 0xc3, 0x9e,
+	0xd8, 0x06, 0x1b, 0x8d, 0x6f, 0x60, 0xa9, 0xab, 0x5a, 0xf6, 0xba, 0xac, 0x5b, 0x5e, 0xaa, 0xa6,
+	0x27, 0x4e, 0x68, 0x45, 0xb6, 0x78, 0x44, 0x87, 0x6c, 0x2b, 0x65, 0x47, 0xdc, 0x31, 0x3b, 0x68,
+	0xbc, 0x02, 0xb7, 0xad, 0xe4, 0x56, 0x92, 0x79, 0x68, 0x45, 0xae, 0x18, 0x0d, 0xbe, 0x04, 0x7f,
+	0x53, 0xe9, 0x7d, 0x25, 0x0f, 0x3b, 0xe2, 0x85, 0x76, 0xe4, 0x8b, 0xa3, 0xc7, 0x57, 0x00, 0xbb,
+	0xef, 0x5d, 0xa9, 0xab, 0x46, 0xdd, 0xf5, 0xc4, 0x37, 0x4d, 0x27, 0x04, 0xaf, 0xe1, 0x7c, 0xdb,
+	0x28, 0x45, 0xcb, 0xb6, 0xdc, 0x56, 0xfa, 0x17, 0x59, 0x98, 0xc5, 0x13, 0xf6, 0xf6, 0x8f, 0x05,
+	0x8b, 0xe3, 0x9f, 0xf1, 0x0c, 0xbc, 0x07, 0x7e, 0xcb, 0xb3, 0xaf, 0x3c, 0x78, 0x82, 0x17, 0x70,
+	0x16, 0x27, 0x49, 0x91, 0x67, 0x42, 0x30, 0x9e, 0x07, 0x16, 0x3e, 0x83, 0x8b, 0x01, 0xc4, 0x34,
+	0x5f, 0x7d, 0x61, 0x05, 0xcd, 0x38, 0x0f, 0x66, 0x78, 0x05, 0x41, 0x22, 0xb2, 0xf5, 0x84, 0xda,
+	0x88, 0xb0, 0xfc, 0x94, 0xc6, 0xf4, 0x36, 0x5d, 0xdd, 0xe7, 0x23, 0x73, 0xf0, 0x12, 0x9e, 0x0a,
+	0xf6, 0xf9, 0x81, 0xdd, 0xe7, 0xc5, 0x7a, 0xc5, 0x28, 0x0b, 0xdc, 0x11, 0x51, 0x36, 0x04, 0x47,
+	0x34, 0x1f, 0xf6, 0xfd, 0x6b, 0x2c, 0x68, 0x76, 0xb7, 0x4e, 0x59, 0xce, 0x02, 0x0f, 0x9f, 0xc3,
+	0xe5, 0x91, 0xc6, 0x9c, 0xb2, 0x34, 0x65, 0x49, 0xe0, 0x6f, 0xe6, 0xe6, 0xd2, 0x1f, 0xff, 0x0e,
+	0x00, 0x3a, 0xc0, 0x45, 0x4e, 0x12, 0x02, 0x00, 0x00,
+}
@@ -29,6 +29,8 @@ It has these top-level messages:
 	CancelPieceMessage
 	ErrorMessage
 	CompleteMessage
+	PeerAddress
+	PeerExchangeMessage
 	Message
 */
 package p2p
@@ -76,6 +78,7 @@ const (
 	Message_CANCEL_PIECE  Message_Type = 4
 	Message_ERROR         Message_Type = 5
 	Message_COMPLETE      Message_Type = 6
+	Message_PEER_EXCHANGE Message_Type = 7
 )
 
 var Message_Type_name = map[int32]string{
@@ -86,6 +89,7 @@ var Message_Type_name = map[int32]string{
 	4: "CANCEL_PIECE",
 	5: "ERROR",
 	6: "COMPLETE",
+	7: "PEER_EXCHANGE",
 }
 var Message_Type_value = map[string]int32{
 	"BITFIELD":      0,
@@ -95,12 +99,13 @@ var Message_Type_value = map[string]int32{
 	"CANCEL_PIECE":  4,
 	"ERROR":         5,
 	"COMPLETE":      6,
+	"PEER_EXCHANGE": 7,
 }
 
 func (x Message_Type) String() string {
 	return proto.EnumName(Message_Type_name, int32(x))
 }
-func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{7, 0} }
+func (Message_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{9, 0} }
 
 // Binary set of all pieces that peer has downloaded so far. Also serves as a
 // handshaking message, which each peer sends once at the beginning of the
@@ -206,6 +211,38 @@ func (m *CompleteMessage) String() string            { return proto.CompactTextS
 func (*CompleteMessage) ProtoMessage()               {}
 func (*CompleteMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
 
+// Address of a peer which the sender is connected to.
+type PeerAddress struct {
+	PeerID   string `protobuf:"bytes,2,opt,name=peerID" json:"peerID,omitempty"`
+	Ip       string `protobuf:"bytes,3,opt,name=ip" json:"ip,omitempty"`
+	Port     int32  `protobuf:"varint,4,opt,name=port" json:"port,omitempty"`
+	Origin   bool   `protobuf:"varint,5,opt,name=origin" json:"origin,omitempty"`
+	Complete bool   `protobuf:"varint,6,opt,name=complete" json:"complete,omitempty"`
+}
+
+func (m *PeerAddress) Reset()                    { *m = PeerAddress{} }
+func (m *PeerAddress) String() string            { return proto.CompactTextString(m) }
+func (*PeerAddress) ProtoMessage()               {}
+func (*PeerAddress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+// Shares the addresses of peers which the sender is currently connected to for
+// the same torrent, so that swarms can find new peers without the tracker.
+type PeerExchangeMessage struct {
+	Peers []*PeerAddress `protobuf:"bytes,2,rep,name=peers" json:"peers,omitempty"`
+}
+
+func (m *PeerExchangeMessage) Reset()                    { *m = PeerExchangeMessage{} }
+func (m *PeerExchangeMessage) String() string            { return proto.CompactTextString(m) }
+func (*PeerExchangeMessage) ProtoMessage()               {}
+func (*PeerExchangeMessage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *PeerExchangeMessage) GetPeers() []*PeerAddress {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
 type Message struct {
 	Version       string                `protobuf:"bytes,1,opt,name=version" json:"version,omitempty"`
 	Type          Message_Type          `protobuf:"varint,2,opt,name=type,enum=p2p.Message_Type" json:"type,omitempty"`
@@ -216,12 +253,13 @@ type Message struct {
 	CancelPiece   *CancelPieceMessage   `protobuf:"bytes,7,opt,name=cancelPiece" json:"cancelPiece,omitempty"`
 	Error         *ErrorMessage         `protobuf:"bytes,8,opt,name=error" json:"error,omitempty"`
 	Complete      *CompleteMessage      `protobuf:"bytes,9,opt,name=complete" json:"complete,omitempty"`
+	PeerExchange  *PeerExchangeMessage  `protobuf:"bytes,10,opt,name=peerExchange" json:"peerExchange,omitempty"`
 }
 
 func (m *Message) Reset()                    { *m = Message{} }
 func (m *Message) String() string            { return proto.CompactTextString(m) }
 func (*Message) ProtoMessage()               {}
-func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+func (*Message) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
 
 func (m *Message) GetBitfield() *BitfieldMessage {
 	if m != nil {
@@ -272,6 +310,13 @@ func (m *Message) GetComplete() *CompleteMessage {
 	return nil
 }
 
+func (m *Message) GetPeerExchange() *PeerExchangeMessage {
+	if m != nil {
+		return m.PeerExchange
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*BitfieldMessage)(nil), "p2p.BitfieldMessage")
 	proto.RegisterType((*PieceRequestMessage)(nil), "p2p.PieceRequestMessage")
@@ -280,6 +325,8 @@ func init() {
 	proto.RegisterType((*CancelPieceMessage)(nil), "p2p.CancelPieceMessage")
 	proto.RegisterType((*ErrorMessage)(nil), "p2p.ErrorMessage")
 	proto.RegisterType((*CompleteMessage)(nil), "p2p.CompleteMessage")
+	proto.RegisterType((*PeerAddress)(nil), "p2p.PeerAddress")
+	proto.RegisterType((*PeerExchangeMessage)(nil), "p2p.PeerExchangeMessage")
 	proto.RegisterType((*Message)(nil), "p2p.Message")
 	proto.RegisterEnum("p2p.ErrorMessage_ErrorCode", ErrorMessage_ErrorCode_name, ErrorMessage_ErrorCode_value)
 	proto.RegisterEnum("p2p.Message_Type", Message_Type_name, Message_Type_value)
@@ -288,46 +335,53 @@ func init() {
 func init() { proto.RegisterFile("proto/p2p/p2p.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 647 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x54, 0x4f, 0x6f, 0xd3, 0x4e,
-	0x10, 0x6d, 0x12, 0x3b, 0x7f, 0x26, 0x69, 0xeb, 0x6c, 0xa3, 0xdf, 0xcf, 0x14, 0x0e, 0x95, 0x45,
-	0x45, 0x85, 0xa0, 0xad, 0xcc, 0x05, 0x10, 0x12, 0x4a, 0x1c, 0x57, 0x44, 0x4a, 0x9b, 0xb0, 0xa4,
-	0x07, 0xc4, 0xa1, 0x72, 0x9d, 0x49, 0x6b, 0x91, 0x7a, 0x8d, 0xed, 0x56, 0xcd, 0xd7, 0xe0, 0x43,
-	0x21, 0xf1, 0xad, 0xd0, 0x4e, 0xec, 0xc4, 0x6e, 0x02, 0xe2, 0xc0, 0x21, 0x92, 0xdf, 0xf3, 0x7b,
-	0xb3, 0xb3, 0x33, 0x2f, 0x86, 0x9d, 0x20, 0x14, 0xb1, 0x38, 0x0a, 0xcc, 0x40, 0xfe, 0x0e, 0x09,
-	0xb1, 0x52, 0x60, 0x06, 0xc6, 0x8f, 0x22, 0x6c, 0x77, 0xbc, 0x78, 0xe2, 0xe1, 0x74, 0x7c, 0x8a,
-	0x51, 0xe4, 0x5c, 0x21, 0xdb, 0x85, 0xaa, 0xe7, 0x4f, 0xc4, 0x07, 0x27, 0xba, 0xd6, 0x8b, 0x7b,
-	0x85, 0x83, 0x1a, 0x5f, 0x60, 0xc6, 0x40, 0xf1, 0x9d, 0x1b, 0xd4, 0x4b, 0xc4, 0xd3, 0x33, 0xfb,
-	0x0f, 0xca, 0x01, 0x62, 0xd8, 0xeb, 0xea, 0x0a, 0xb1, 0x09, 0x62, 0x4f, 0x61, 0xf3, 0x32, 0x29,
-	0xdd, 0x99, 0xc5, 0x18, 0xe9, 0xea, 0x5e, 0xe1, 0xa0, 0xc1, 0xf3, 0x24, 0x7b, 0x02, 0x35, 0x59,
-	0x25, 0x0a, 0x1c, 0x17, 0xf5, 0x32, 0x15, 0x58, 0x12, 0xec, 0x02, 0x76, 0x42, 0xbc, 0x11, 0x31,
-	0x76, 0x72, 0x95, 0x2a, 0x7b, 0xa5, 0x83, 0xba, 0xf9, 0xf2, 0x50, 0xde, 0xe6, 0x41, 0xfb, 0x87,
-	0x7c, 0x55, 0x6f, 0xfb, 0x71, 0x38, 0xe3, 0xeb, 0x2a, 0xed, 0x9e, 0x80, 0xfe, 0x3b, 0x03, 0xd3,
-	0xa0, 0xf4, 0x15, 0x67, 0x7a, 0x81, 0x9a, 0x92, 0x8f, 0xac, 0x05, 0xea, 0x9d, 0x33, 0xbd, 0x45,
-	0x9a, 0x4b, 0x83, 0xcf, 0xc1, 0xdb, 0xe2, 0xeb, 0x82, 0xf1, 0x05, 0x76, 0x86, 0x1e, 0xba, 0xc8,
-	0xf1, 0xdb, 0x2d, 0x46, 0x71, 0x3a, 0xcb, 0x16, 0xa8, 0x9e, 0x3f, 0xc6, 0x7b, 0x32, 0xa8, 0x7c,
-	0x0e, 0xe4, 0xc4, 0xc4, 0x64, 0x12, 0x61, 0x4c, 0x73, 0x54, 0x79, 0x82, 0x24, 0x3f, 0x45, 0xff,
-	0x2a, 0xbe, 0xa6, 0x49, 0xaa, 0x3c, 0x41, 0x46, 0x94, 0x14, 0x1f, 0x3a, 0xb3, 0xa9, 0x70, 0xc6,
-	0xff, 0xb4, 0xb8, 0xe4, 0xc7, 0xde, 0x15, 0x46, 0x31, 0xed, 0xa7, 0xc6, 0x13, 0x64, 0xbc, 0x80,
-	0x56, 0xdb, 0xf7, 0xc5, 0xad, 0xef, 0x22, 0x1d, 0xfe, 0xc7, 0x53, 0x8d, 0xe7, 0xc0, 0x2c, 0xc7,
-	0x77, 0x71, 0xfa, 0x17, 0xda, 0xef, 0x05, 0x68, 0xd8, 0x61, 0x28, 0xc2, 0x8c, 0x0c, 0x25, 0x4e,
-	0xe2, 0x36, 0x07, 0x4b, 0x73, 0x29, 0x7b, 0xbd, 0x23, 0x50, 0x5c, 0x31, 0x46, 0xba, 0xc4, 0x96,
-	0xf9, 0x98, 0x22, 0x90, 0x2d, 0x36, 0x07, 0x96, 0x18, 0x23, 0x27, 0xa1, 0xb1, 0x0f, 0xb5, 0x05,
-	0xc5, 0x74, 0x68, 0x0d, 0x7b, 0xb6, 0x65, 0x5f, 0x70, 0xfb, 0xe3, 0xb9, 0xfd, 0x69, 0x74, 0x71,
-	0xd2, 0xee, 0xf5, 0xed, 0xae, 0xb6, 0x61, 0x34, 0x61, 0xdb, 0x12, 0x37, 0xc1, 0x14, 0xe3, 0xb4,
-	0x7b, 0xe3, 0xa7, 0x02, 0x95, 0xb4, 0x45, 0x1d, 0x2a, 0x77, 0x18, 0x46, 0x9e, 0xf0, 0x93, 0x3c,
-	0xa4, 0x90, 0xed, 0x83, 0x12, 0xcf, 0x82, 0x79, 0x24, 0xb6, 0xcc, 0x26, 0x35, 0x94, 0xf6, 0x32,
-	0x9a, 0x05, 0xc8, 0xe9, 0x35, 0x3b, 0x86, 0x6a, 0x1a, 0x7c, 0xba, 0x50, 0xdd, 0x6c, 0xad, 0x8b,
-	0x2f, 0x5f, 0xa8, 0xd8, 0x3b, 0x68, 0x04, 0x99, 0x48, 0xd1, 0x8d, 0xeb, 0xa6, 0x4e, 0xae, 0x35,
-	0x59, 0xe3, 0x39, 0xf5, 0xc2, 0x9d, 0x64, 0x86, 0x96, 0x9b, 0x73, 0xe7, 0xc3, 0xc4, 0x73, 0x6a,
-	0xf6, 0x1e, 0x36, 0x9d, 0xec, 0xf2, 0xe9, 0x9f, 0x59, 0x37, 0x1f, 0x91, 0x7d, 0x5d, 0x2c, 0x78,
-	0x5e, 0xcf, 0xde, 0x40, 0xdd, 0x5d, 0xe6, 0x41, 0xaf, 0x90, 0xfd, 0x7f, 0xb2, 0xaf, 0xe6, 0x84,
-	0x67, 0xb5, 0xec, 0x59, 0x9a, 0x86, 0x2a, 0x99, 0x9a, 0x2b, 0x2b, 0x4e, 0x03, 0x72, 0x0c, 0x55,
-	0x37, 0x59, 0x99, 0x5e, 0xcb, 0x8c, 0xf4, 0xc1, 0x1e, 0xf9, 0x42, 0x65, 0xdc, 0x83, 0x22, 0x57,
-	0xc2, 0x1a, 0x50, 0xed, 0xf4, 0x46, 0x27, 0x3d, 0xbb, 0xdf, 0xd5, 0x36, 0x58, 0x13, 0x36, 0x73,
-	0xa1, 0xd0, 0x0a, 0x4b, 0x6a, 0xd8, 0xfe, 0xdc, 0x1f, 0xb4, 0xbb, 0x5a, 0x51, 0x52, 0xed, 0xb3,
-	0xb3, 0xc1, 0xb9, 0x24, 0xe5, 0x2b, 0xad, 0xc4, 0x34, 0x68, 0x58, 0xed, 0x33, 0xcb, 0xee, 0x27,
-	0x8c, 0xc2, 0x6a, 0xa0, 0xda, 0x9c, 0x0f, 0xb8, 0xa6, 0xca, 0x33, 0xac, 0xc1, 0xe9, 0xb0, 0x6f,
-	0x8f, 0x6c, 0xad, 0x7c, 0x59, 0xa6, 0x8f, 0xee, 0xab, 0x5f, 0x01, 0x00, 0x00, 0xff, 0xff, 0xfd,
-	0x11, 0xd8, 0xe6, 0x8b, 0x05, 0x00, 0x00,
+	// 757 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x55, 0x4d, 0x6f, 0xda, 0x48,
+	0x18, 0x0e, 0x06, 0xf3, 0xf1, 0x42, 0x12, 0x33, 0xa0, 0x5d, 0x6f, 0x76, 0x0f, 0x91, 0xb5, 0xd9,
+	0x8d, 0x56, 0xbb, 0x49, 0xe4, 0xbd, 0xb4, 0x55, 0xab, 0xca, 0x98, 0x49, 0x83, 0x44, 0x80, 0x4e,
+	0x89, 0xd4, 0xaa, 0x07, 0xe4, 0xd8, 0x03, 0xb1, 0x4a, 0x6c, 0xd7, 0x76, 0xa2, 0x70, 0xe8, 0x2f,
+	0xe8, 0xad, 0xd7, 0xfe, 0x9f, 0xfe, 0xae, 0x6a, 0x5e, 0x6c, 0xb0, 0x43, 0x5a, 0xf5, 0xd0, 0x03,
+	0x92, 0x9f, 0x67, 0xde, 0xaf, 0x79, 0xe6, 0x79, 0x05, 0xb4, 0x82, 0xd0, 0x8f, 0xfd, 0xe3, 0x40,
+	0x0f, 0xc4, 0xef, 0x08, 0x11, 0x29, 0x06, 0x7a, 0xa0, 0x7d, 0x91, 0x60, 0xb7, 0xe3, 0xc6, 0x53,
+	0x97, 0xcf, 0x9d, 0x73, 0x1e, 0x45, 0xd6, 0x8c, 0x93, 0x3d, 0xa8, 0xba, 0xde, 0xd4, 0x3f, 0xb3,
+	0xa2, 0x2b, 0x55, 0xda, 0x2f, 0x1c, 0xd6, 0xd8, 0x0a, 0x13, 0x02, 0x25, 0xcf, 0xba, 0xe6, 0x6a,
+	0x11, 0x79, 0xfc, 0x26, 0xbf, 0x40, 0x39, 0xe0, 0x3c, 0xec, 0x75, 0xd5, 0x12, 0xb2, 0x09, 0x22,
+	0x7f, 0xc2, 0xf6, 0x65, 0x52, 0xba, 0xb3, 0x88, 0x79, 0xa4, 0xca, 0xfb, 0x85, 0xc3, 0x06, 0xcb,
+	0x93, 0xe4, 0x0f, 0xa8, 0x89, 0x2a, 0x51, 0x60, 0xd9, 0x5c, 0x2d, 0x63, 0x81, 0x35, 0x41, 0x26,
+	0xd0, 0x0a, 0xf9, 0xb5, 0x1f, 0xf3, 0x4e, 0xae, 0x52, 0x65, 0xbf, 0x78, 0x58, 0xd7, 0xff, 0x3b,
+	0x12, 0xb7, 0xb9, 0x37, 0xfe, 0x11, 0xdb, 0x8c, 0xa7, 0x5e, 0x1c, 0x2e, 0xd8, 0x43, 0x95, 0xf6,
+	0x4e, 0x41, 0xfd, 0x56, 0x02, 0x51, 0xa0, 0xf8, 0x8e, 0x2f, 0xd4, 0x02, 0x0e, 0x25, 0x3e, 0x49,
+	0x1b, 0xe4, 0x5b, 0x6b, 0x7e, 0xc3, 0x51, 0x97, 0x06, 0x5b, 0x82, 0x27, 0xd2, 0xa3, 0x82, 0xf6,
+	0x16, 0x5a, 0x23, 0x97, 0xdb, 0x9c, 0xf1, 0xf7, 0x37, 0x3c, 0x8a, 0x53, 0x2d, 0xdb, 0x20, 0xbb,
+	0x9e, 0xc3, 0xef, 0x30, 0x41, 0x66, 0x4b, 0x20, 0x14, 0xf3, 0xa7, 0xd3, 0x88, 0xc7, 0xa8, 0xa3,
+	0xcc, 0x12, 0x24, 0xf8, 0x39, 0xf7, 0x66, 0xf1, 0x15, 0x2a, 0x29, 0xb3, 0x04, 0x69, 0x51, 0x52,
+	0x7c, 0x64, 0x2d, 0xe6, 0xbe, 0xe5, 0xfc, 0xd4, 0xe2, 0x82, 0x77, 0xdc, 0x19, 0x8f, 0x62, 0x7c,
+	0x9f, 0x1a, 0x4b, 0x90, 0xf6, 0x2f, 0xb4, 0x0d, 0xcf, 0xf3, 0x6f, 0x3c, 0x9b, 0x63, 0xf3, 0xef,
+	0x76, 0xd5, 0xfe, 0x01, 0x62, 0x5a, 0x9e, 0xcd, 0xe7, 0x3f, 0x10, 0xfb, 0xa9, 0x00, 0x0d, 0x1a,
+	0x86, 0x7e, 0x98, 0x09, 0xe3, 0x02, 0x27, 0x76, 0x5b, 0x82, 0x75, 0x72, 0x31, 0x7b, 0xbd, 0x63,
+	0x28, 0xd9, 0xbe, 0xc3, 0xf1, 0x12, 0x3b, 0xfa, 0xef, 0x68, 0x81, 0x6c, 0xb1, 0x25, 0x30, 0x7d,
+	0x87, 0x33, 0x0c, 0xd4, 0x0e, 0xa0, 0xb6, 0xa2, 0x88, 0x0a, 0xed, 0x51, 0x8f, 0x9a, 0x74, 0xc2,
+	0xe8, 0xcb, 0x0b, 0xfa, 0x6a, 0x3c, 0x39, 0x35, 0x7a, 0x7d, 0xda, 0x55, 0xb6, 0xb4, 0x26, 0xec,
+	0x9a, 0xfe, 0x75, 0x30, 0xe7, 0x71, 0x3a, 0xbd, 0xf6, 0x01, 0xea, 0x23, 0xce, 0x43, 0xc3, 0x71,
+	0x42, 0x1e, 0x45, 0x19, 0x9f, 0x4b, 0x39, 0x9f, 0xef, 0x80, 0xe4, 0x06, 0xc9, 0x46, 0x48, 0x6e,
+	0x20, 0x76, 0x24, 0xf0, 0xc3, 0x38, 0x91, 0x19, 0xbf, 0xf1, 0x51, 0x42, 0x77, 0xe6, 0x7a, 0x28,
+	0x72, 0x95, 0x25, 0x48, 0xec, 0x9a, 0x9d, 0x74, 0x45, 0xf3, 0x57, 0xd9, 0x0a, 0x6b, 0xcf, 0xa0,
+	0x25, 0xda, 0xd3, 0x3b, 0xfb, 0xca, 0xf2, 0x66, 0x2b, 0x4d, 0xff, 0x02, 0x59, 0x34, 0x8e, 0x54,
+	0x09, 0x97, 0x40, 0x41, 0x05, 0x32, 0x73, 0xb2, 0xe5, 0xb1, 0xf6, 0x59, 0x86, 0x4a, 0x9a, 0xa3,
+	0x42, 0xe5, 0x96, 0x87, 0x91, 0xeb, 0x7b, 0x89, 0x9b, 0x53, 0x48, 0x0e, 0xa0, 0x14, 0x2f, 0x82,
+	0xa5, 0xa1, 0x77, 0xf4, 0x26, 0x16, 0x4b, 0x95, 0x1c, 0x2f, 0x02, 0xce, 0xf0, 0x98, 0x9c, 0x40,
+	0x35, 0x5d, 0x5b, 0xbc, 0x69, 0x5d, 0x6f, 0x3f, 0xb4, 0x7c, 0x6c, 0x15, 0x45, 0x9e, 0x42, 0x23,
+	0xc8, 0x2c, 0x04, 0xaa, 0x51, 0xd7, 0xd5, 0xe5, 0xb4, 0x9b, 0x9b, 0xc2, 0x72, 0xd1, 0xab, 0xec,
+	0xc4, 0xf1, 0xaa, 0x7c, 0x3f, 0x3b, 0xbf, 0x0a, 0x2c, 0x17, 0x4d, 0x9e, 0xc3, 0xb6, 0x95, 0xb5,
+	0x2e, 0x4a, 0x5b, 0xd7, 0x7f, 0xc3, 0xf4, 0x87, 0x4c, 0xcd, 0xf2, 0xf1, 0xe4, 0x31, 0xd4, 0xed,
+	0xb5, 0x9b, 0xd5, 0x0a, 0xa6, 0xff, 0x8a, 0xe9, 0x9b, 0x2e, 0x67, 0xd9, 0x58, 0xf2, 0x77, 0xea,
+	0xe5, 0x2a, 0x26, 0x35, 0x37, 0x0c, 0x9a, 0xda, 0xfb, 0x24, 0xf3, 0xf4, 0xb5, 0x8c, 0xa4, 0xf7,
+	0x5c, 0xb8, 0x36, 0x04, 0x8a, 0x92, 0x31, 0x84, 0x0a, 0x59, 0x51, 0x36, 0x9d, 0xc2, 0x72, 0xd1,
+	0xda, 0xc7, 0x02, 0x94, 0xc4, 0x8b, 0x92, 0x06, 0x54, 0x3b, 0xbd, 0xf1, 0x69, 0x8f, 0xf6, 0xbb,
+	0xca, 0x16, 0x69, 0xc2, 0x76, 0x6e, 0x23, 0x94, 0xc2, 0x9a, 0x1a, 0x19, 0x6f, 0xfa, 0x43, 0xa3,
+	0xab, 0x48, 0x82, 0x32, 0x06, 0x83, 0xe1, 0x85, 0x20, 0xc5, 0x91, 0x52, 0x24, 0x0a, 0x34, 0x4c,
+	0x63, 0x60, 0xd2, 0x7e, 0xc2, 0x94, 0x48, 0x0d, 0x64, 0xca, 0xd8, 0x90, 0x29, 0xb2, 0xe8, 0x61,
+	0x0e, 0xcf, 0x47, 0x7d, 0x3a, 0xa6, 0x4a, 0x19, 0x0b, 0x52, 0xca, 0x26, 0xf4, 0xb5, 0x79, 0x66,
+	0x0c, 0x5e, 0x50, 0xa5, 0x72, 0x59, 0xc6, 0x3f, 0xa1, 0xff, 0xbf, 0x0e, 0x00, 0x25, 0x57, 0x26,
+	0xc1, 0x9b, 0x06, 0x00, 0x00,
 }
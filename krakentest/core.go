@@ -0,0 +1,60 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package krakentest provides fixtures for writing tests against Kraken
+// components, such as blobs, stores, hash rings, agent schedulers and trackers.
+// Unlike the package-local fixtures it wraps, its API is kept stable for use
+// by external integration tests.
+package krakentest
+
+import "github.com/uber/kraken/core"
+
+// Digest returns a random digest.
+func Digest() core.Digest {
+	return core.DigestFixture()
+}
+
+// Namespace returns a random namespace.
+func Namespace() string {
+	return core.NamespaceFixture()
+}
+
+// Tag returns a random tag.
+func Tag() string {
+	return core.TagFixture()
+}
+
+// Blob returns a small random blob with its digest and metainfo.
+func Blob() *core.BlobFixture {
+	return core.NewBlobFixture()
+}
+
+// SizedBlob returns a random blob of the given size and piece length.
+func SizedBlob(size, pieceLength uint64) *core.BlobFixture {
+	return core.SizedBlobFixture(size, pieceLength)
+}
+
+// PeerContext returns a random agent peer context.
+func PeerContext() core.PeerContext {
+	return core.PeerContextFixture()
+}
+
+// PeerInfo returns a random agent peer info.
+func PeerInfo() *core.PeerInfo {
+	return core.PeerInfoFixture()
+}
+
+// OriginPeerInfo returns a random origin peer info.
+func OriginPeerInfo() *core.PeerInfo {
+	return core.OriginPeerInfoFixture()
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package krakentest
+
+import (
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+)
+
+// HashRing returns a ring of addrs which replicates each digest to up to
+// maxReplica hosts. All hosts are considered healthy.
+func HashRing(maxReplica int, addrs ...string) hashring.Ring {
+	return hashring.New(
+		hashring.Config{MaxReplica: maxReplica},
+		hostlist.Fixture(addrs...),
+		healthcheck.IdentityFilter{})
+}
+
+// PassiveRing returns a passive ring of addrs which never filters unhealthy
+// hosts.
+func PassiveRing(addrs ...string) hashring.PassiveRing {
+	return hashring.NoopPassiveRing(hostlist.Fixture(addrs...))
+}
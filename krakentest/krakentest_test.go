@@ -0,0 +1,56 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package krakentest
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRing(t *testing.T) {
+	require := require.New(t)
+
+	ring := HashRing(2, "a:80", "b:80", "c:80")
+
+	require.Len(ring.Locations(Digest()), 2)
+}
+
+func TestAgentDownloadsBlobSeededByAnotherAgent(t *testing.T) {
+	require := require.New(t)
+
+	tracker, stop := StartTracker()
+	defer stop()
+
+	seeder, stop := StartAgent(SchedulerConfig(), tracker.Addr)
+	defer stop()
+
+	leecher, stop := StartAgent(SchedulerConfig(), tracker.Addr)
+	defer stop()
+
+	namespace := Namespace()
+	blob := SizedBlob(256, 8)
+	tracker.AddMetaInfo(blob.MetaInfo)
+
+	require.NoError(seeder.Seed(namespace, blob))
+	require.NoError(leecher.Scheduler.Download(namespace, blob.Digest))
+
+	f, err := leecher.Store.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer f.Close()
+	result, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(blob.Content, result)
+}
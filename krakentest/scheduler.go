@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package krakentest
+
+import (
+	"fmt"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+// SchedulerConfig returns a scheduler config with short timeouts suitable for
+// tests.
+func SchedulerConfig() scheduler.Config {
+	return scheduler.ConfigFixture()
+}
+
+// Agent is a running agent scheduler along with its storage.
+type Agent struct {
+	Context   core.PeerContext
+	Scheduler scheduler.ReloadableScheduler
+	Store     *store.CADownloadStore
+
+	torrentArchive *agentstorage.TorrentArchive
+}
+
+// StartAgent starts an agent scheduler which announces to and fetches
+// metainfo from the tracker at trackerAddr. Returns the agent and a closure
+// for stopping it and removing its storage.
+func StartAgent(config scheduler.Config, trackerAddr string) (*Agent, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	cads, c := store.CADownloadStoreFixture()
+	cleanup.Add(c)
+
+	pctx := core.PeerContext{
+		PeerID: core.PeerIDFixture(),
+		Zone:   "zone1",
+		IP:     "localhost",
+		Port:   testutil.FreePort(),
+	}
+	trackers := hashring.NoopPassiveRing(hostlist.Fixture(trackerAddr))
+
+	sched, err := scheduler.NewAgentScheduler(
+		config,
+		tally.NoopScope,
+		pctx,
+		cads,
+		networkevent.NewTestProducer(),
+		trackers,
+		announceclient.New(pctx, trackers, nil),
+		connstate.NoopBlacklistStore{},
+		nil,
+		nil)
+	if err != nil {
+		panic(err)
+	}
+	cleanup.Add(sched.Stop)
+
+	return &Agent{
+		Context:   pctx,
+		Scheduler: sched,
+		Store:     cads,
+		torrentArchive: agentstorage.NewTorrentArchive(
+			tally.NoopScope, cads, metainfoclient.New(trackers, nil)),
+	}, cleanup.Run
+}
+
+// Seed writes blob into the agent's storage and starts seeding it. The
+// metainfo of blob must be available from the agent's tracker.
+func (a *Agent) Seed(namespace string, blob *core.BlobFixture) error {
+	t, err := a.torrentArchive.CreateTorrent(namespace, blob.Digest)
+	if err != nil {
+		return fmt.Errorf("create torrent: %s", err)
+	}
+	for i := 0; i < t.NumPieces(); i++ {
+		start := int64(i) * blob.MetaInfo.PieceLength()
+		end := start + t.PieceLength(i)
+		if err := t.WritePiece(piecereader.NewBuffer(blob.Content[start:end]), i); err != nil {
+			return fmt.Errorf("write piece %d: %s", i, err)
+		}
+	}
+	return a.Scheduler.Download(namespace, blob.Digest)
+}
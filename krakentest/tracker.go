@@ -0,0 +1,101 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package krakentest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/originstore"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/tracker/trackerserver"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+// Tracker is a running tracker server whose peer and metainfo state is kept
+// in memory and may be seeded directly by tests, without an origin cluster.
+type Tracker struct {
+	Addr  string
+	Peers peerstore.Store
+
+	metaInfo *metaInfoStore
+}
+
+// StartTracker starts a tracker server with empty state. Returns the tracker
+// and a closure for stopping it.
+func StartTracker() (*Tracker, func()) {
+	peers := peerstore.NewTestStore()
+	mis := &metaInfoStore{metaInfo: make(map[core.Digest]*core.MetaInfo)}
+	server := trackerserver.New(
+		trackerserver.Config{AnnounceInterval: 250 * time.Millisecond},
+		tally.NoopScope,
+		peerhandoutpolicy.DefaultPriorityPolicyFixture(),
+		peers,
+		originstore.NewNoopStore(),
+		nil,
+		mis)
+	addr, stop := testutil.StartServer(server.Handler())
+	return &Tracker{Addr: addr, Peers: peers, metaInfo: mis}, stop
+}
+
+// AddMetaInfo makes mi available to agents requesting metainfo from the
+// tracker.
+func (t *Tracker) AddMetaInfo(mi *core.MetaInfo) {
+	t.metaInfo.add(mi)
+}
+
+// AddPeer registers p as a peer of the torrent of h, as if p had announced.
+func (t *Tracker) AddPeer(h core.InfoHash, p *core.PeerInfo) error {
+	return t.Peers.UpdatePeer(h, p)
+}
+
+// metaInfoStore is an in-memory originstore.MetaInfoStore.
+type metaInfoStore struct {
+	sync.Mutex
+	metaInfo map[core.Digest]*core.MetaInfo
+}
+
+func (s *metaInfoStore) add(mi *core.MetaInfo) {
+	s.Lock()
+	defer s.Unlock()
+	s.metaInfo[mi.Digest()] = mi
+}
+
+func (s *metaInfoStore) GetMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+	s.Lock()
+	defer s.Unlock()
+	mi, ok := s.metaInfo[d]
+	if !ok {
+		return nil, handler.ErrorStatus(http.StatusNotFound)
+	}
+	return mi, nil
+}
+
+func (s *metaInfoStore) PeekMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	s.Lock()
+	defer s.Unlock()
+	mi, ok := s.metaInfo[d]
+	if !ok {
+		return nil, originstore.ErrMetaInfoUnavailable
+	}
+	return mi, nil
+}
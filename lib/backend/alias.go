@@ -0,0 +1,218 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+
+	"github.com/uber-go/tally"
+)
+
+// Alias modes.
+const (
+	// AliasWriteNew writes to the new namespace, and reads from the new
+	// namespace before falling back to the old one.
+	AliasWriteNew = "write_new"
+
+	// AliasReadOld writes to the new namespace, and reads from the old
+	// namespace before falling back to the new one.
+	AliasReadOld = "read_old"
+
+	// AliasBoth writes to both namespaces, and reads from the new namespace
+	// before falling back to the old one.
+	AliasBoth = "both"
+)
+
+// AliasConfig maps a deprecated namespace to its new name.
+type AliasConfig struct {
+	// Namespace is a regular expression matching the old namespace.
+	Namespace string `yaml:"namespace"`
+
+	// Target is the new namespace. It may reference groups captured by
+	// Namespace, e.g. "new-team/$1".
+	Target string `yaml:"target"`
+
+	// Mode determines which namespaces are read and written. Defaults to
+	// write_new.
+	Mode string `yaml:"mode"`
+}
+
+func (c AliasConfig) applyDefaults() AliasConfig {
+	if c.Mode == "" {
+		c.Mode = AliasWriteNew
+	}
+	return c
+}
+
+type alias struct {
+	regexp *regexp.Regexp
+	target string
+	mode   string
+	stats  tally.Scope
+}
+
+func newAlias(config AliasConfig, stats tally.Scope) (*alias, error) {
+	config = config.applyDefaults()
+	switch config.Mode {
+	case AliasWriteNew, AliasReadOld, AliasBoth:
+	default:
+		return nil, fmt.Errorf("invalid mode: %q", config.Mode)
+	}
+	if config.Target == "" {
+		return nil, fmt.Errorf("no target for namespace %s", config.Namespace)
+	}
+	re, err := regexp.Compile(config.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("regexp: %s", err)
+	}
+	return &alias{
+		regexp: re,
+		target: config.Target,
+		mode:   config.Mode,
+		stats: stats.Tagged(map[string]string{
+			"alias": config.Namespace,
+		}),
+	}, nil
+}
+
+// resolve returns the new name of namespace.
+func (a *alias) resolve(namespace string) string {
+	return a.regexp.ReplaceAllString(namespace, a.target)
+}
+
+// aliasClient is a Client for a deprecated namespace, which routes operations
+// to the clients of the old and new namespaces according to the alias mode.
+type aliasClient struct {
+	alias     *alias
+	oldClient Client
+	newClient Client
+}
+
+func (c *aliasClient) hit(op string) {
+	c.alias.stats.Tagged(map[string]string{"op": op}).Counter("alias_hits").Inc(1)
+}
+
+// readOrder returns the namespaces and clients to read from, in order.
+func (c *aliasClient) readOrder(namespace string) ([]string, []Client) {
+	namespaces := []string{c.alias.resolve(namespace), namespace}
+	clients := []Client{c.newClient, c.oldClient}
+	if c.alias.mode == AliasReadOld {
+		namespaces[0], namespaces[1] = namespaces[1], namespaces[0]
+		clients[0], clients[1] = clients[1], clients[0]
+	}
+	return namespaces, clients
+}
+
+// read calls f for each namespace in read order, until a namespace which
+// does not return backenderrors.ErrBlobNotFound.
+func (c *aliasClient) read(op, namespace string, f func(Client, string) error) error {
+	c.hit(op)
+	namespaces, clients := c.readOrder(namespace)
+	err := backenderrors.ErrBlobNotFound
+	for i := range namespaces {
+		if clients[i] == nil {
+			continue
+		}
+		if err == backenderrors.ErrBlobNotFound && i > 0 && clients[0] != nil {
+			c.alias.stats.Counter("alias_fallbacks").Inc(1)
+		}
+		if err = f(clients[i], namespaces[i]); err != backenderrors.ErrBlobNotFound {
+			return err
+		}
+	}
+	return err
+}
+
+// Stat returns blob info for name.
+func (c *aliasClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	var info *core.BlobInfo
+	err := c.read("stat", namespace, func(client Client, ns string) error {
+		var err error
+		info, err = client.Stat(ns, name)
+		return err
+	})
+	return info, err
+}
+
+// Download downloads name into dst.
+func (c *aliasClient) Download(namespace, name string, dst io.Writer) error {
+	return c.read("download", namespace, func(client Client, ns string) error {
+		return client.Download(ns, name, dst)
+	})
+}
+
+// DownloadRange downloads length bytes of name starting at offset into dst.
+func (c *aliasClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	return c.read("download_range", namespace, func(client Client, ns string) error {
+		r, ok := GetRangeDownloader(client)
+		if !ok {
+			return errRangeUnsupported
+		}
+		return r.DownloadRange(ns, name, offset, length, dst)
+	})
+}
+
+// Upload uploads src into name.
+func (c *aliasClient) Upload(namespace, name string, src io.Reader) error {
+	c.hit("upload")
+	if c.alias.mode == AliasBoth && c.oldClient != nil {
+		rs, ok := src.(io.ReadSeeker)
+		if !ok {
+			b, err := ioutil.ReadAll(src)
+			if err != nil {
+				return fmt.Errorf("read: %s", err)
+			}
+			rs = bytes.NewReader(b)
+		}
+		if err := c.oldClient.Upload(namespace, name, rs); err != nil {
+			return fmt.Errorf("upload to old namespace: %s", err)
+		}
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seek: %s", err)
+		}
+		src = rs
+	}
+	return c.newClient.Upload(c.alias.resolve(namespace), name, src)
+}
+
+// Delete removes name from the new namespace, and from the old namespace if it
+// still has a backend.
+func (c *aliasClient) Delete(namespace, name string) error {
+	c.hit("delete")
+	if c.oldClient != nil {
+		if err := c.oldClient.Delete(namespace, name); err != nil {
+			return fmt.Errorf("delete from old namespace: %s", err)
+		}
+	}
+	return c.newClient.Delete(c.alias.resolve(namespace), name)
+}
+
+// List lists names with prefix from the namespace which is read first.
+func (c *aliasClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
+	c.hit("list")
+	namespaces, clients := c.readOrder(prefix)
+	if clients[0] == nil {
+		return clients[1].List(namespaces[1], opts...)
+	}
+	return clients[0].List(namespaces[0], opts...)
+}
@@ -65,4 +65,9 @@ type Client interface {
 
 	// List lists entries whose names start with prefix.
 	List(prefix string, opts ...ListOption) (*ListResult, error)
+
+	// Delete removes name. Deleting a blob which does not exist is not an
+	// error. Unless enabled with allow_delete in the backend config, Delete
+	// returns ErrDeleteDisabled without reaching the backend.
+	Delete(namespace, name string) error
 }
@@ -28,6 +28,10 @@ type Config struct {
 	Bandwidth bandwidth.Config `yaml:"bandwidth"`
 	// Whether the service readiness endpoint will check the backend's readiness.
 	MustReady bool             `yaml:"must_ready"`
+
+	// AllowDelete allows blobs to be deleted from the backend. Disabled by
+	// default, so nothing is ever removed from remote storage by accident.
+	AllowDelete bool `yaml:"allow_delete"`
 }
 
 func (c Config) applyDefaults() Config {
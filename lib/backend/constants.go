@@ -25,6 +25,8 @@ const (
 	DefaultBufferGuard datasize.ByteSize = 10 * datasize.MB
 	DefaultConcurrency int               = 10
 	DefaultListMaxKeys int               = 250
+
+	DefaultMaxIdleConnsPerHost int = 100
 )
 
 var (
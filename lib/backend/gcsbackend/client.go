@@ -160,6 +160,20 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return err
 }
 
+// DownloadRange downloads length bytes of name starting at offset from a
+// configured bucket and writes the data to dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+
+	_, err = c.gcs.DownloadRange(path, offset, length, dst)
+	return err
+}
+
 // Upload uploads src to a configured bucket.
 func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	path, err := c.pather.BlobPath(name)
@@ -167,10 +181,28 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 		return fmt.Errorf("blob path: %s", err)
 	}
 
+	if r, ok := src.(backend.SizedReaderAt); ok &&
+		c.config.ResumableUpload && r.Size() > c.config.UploadChunkSize {
+
+		return c.uploadResumable(path, r)
+	}
+
 	_, err = c.gcs.Upload(path, src)
 	return err
 }
 
+// Delete removes name from the configured bucket.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	if err := c.gcs.Delete(path); err != nil && !isObjectNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 // List lists names that start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
@@ -255,12 +287,27 @@ func (g *GCSImpl) Download(objectName string, w io.Writer) (int64, error) {
 	return r, nil
 }
 
+func (g *GCSImpl) DownloadRange(
+	objectName string, offset, length int64, w io.Writer) (int64, error) {
+
+	rc, err := g.bucket.Object(objectName).NewRangeReader(g.ctx, offset, length)
+	if err != nil {
+		if isObjectNotFound(err) {
+			return 0, backenderrors.ErrBlobNotFound
+		}
+		return 0, err
+	}
+	defer rc.Close()
+
+	return io.Copy(w, rc)
+}
+
 func (g *GCSImpl) Upload(objectName string, r io.Reader) (int64, error) {
 	wc := g.bucket.Object(objectName).NewWriter(g.ctx)
 	wc.ChunkSize = int(g.config.UploadChunkSize)
 
-	w, err := io.CopyN(wc, r, int64(g.config.UploadChunkSize))
-	if err != nil && err != io.EOF {
+	w, err := io.Copy(wc, r)
+	if err != nil {
 		return 0, err
 	}
 
@@ -271,6 +318,20 @@ func (g *GCSImpl) Upload(objectName string, r io.Reader) (int64, error) {
 	return w, nil
 }
 
+func (g *GCSImpl) Delete(objectName string) error {
+	return g.bucket.Object(objectName).Delete(g.ctx)
+}
+
+// Compose concatenates srcs into objectName.
+func (g *GCSImpl) Compose(objectName string, srcs []string) error {
+	handles := make([]*storage.ObjectHandle, len(srcs))
+	for i, src := range srcs {
+		handles[i] = g.bucket.Object(src)
+	}
+	_, err := g.bucket.Object(objectName).ComposerFrom(handles...).Run(g.ctx)
+	return err
+}
+
 func (g *GCSImpl) GetObjectIterator(prefix string) iterator.Pageable {
 	var query storage.Query
 
@@ -15,6 +15,7 @@ package gcsbackend
 
 import (
 	"bytes"
+	"crypto/md5"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -128,6 +129,27 @@ func TestClientDownload(t *testing.T) {
 	require.Equal(data, []byte(w))
 }
 
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+	data := randutil.Text(32)
+
+	mocks.gcs.EXPECT().DownloadRange(
+		"/root/test",
+		int64(64),
+		int64(32),
+		mockutil.MatchWriter(data),
+	).Return(int64(len(data)), nil)
+
+	w := make(rwutil.PlainWriter, len(data))
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 64, 32, w))
+	require.Equal(data, []byte(w))
+}
+
 func TestClientUpload(t *testing.T) {
 	require := require.New(t)
 
@@ -147,6 +169,50 @@ func TestClientUpload(t *testing.T) {
 	require.NoError(client.Upload(core.NamespaceFixture(), "test", dataReader))
 }
 
+func TestClientUploadResumableComposesParts(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.config.ResumableUpload = true
+	mocks.config.UploadChunkSize = 16
+	client := mocks.new()
+
+	data := randutil.Text(40)
+	dir := client.uploadDir("/root/test")
+	parts := []string{dir + "/part-00001", dir + "/part-00002", dir + "/part-00003"}
+
+	// The first part was uploaded by an interrupted attempt.
+	sum := md5.Sum(data[:16])
+	mocks.gcs.EXPECT().ObjectAttrs(parts[0]).Return(
+		&storage.ObjectAttrs{Size: 16, MD5: sum[:]}, nil)
+	for _, name := range parts[1:] {
+		mocks.gcs.EXPECT().ObjectAttrs(name).Return(nil, storage.ErrObjectNotExist)
+	}
+	mocks.gcs.EXPECT().Upload(parts[1], mockutil.MatchReader(data[16:32])).Return(int64(16), nil)
+	mocks.gcs.EXPECT().Upload(parts[2], mockutil.MatchReader(data[32:])).Return(int64(8), nil)
+	mocks.gcs.EXPECT().Compose("/root/test", parts).Return(nil)
+	for _, name := range parts {
+		mocks.gcs.EXPECT().Delete(name).Return(nil)
+	}
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+}
+
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	mocks.gcs.EXPECT().Delete("/root/test").Return(storage.ErrObjectNotExist)
+
+	require.NoError(client.Delete(core.NamespaceFixture(), "test"))
+}
+
 func Alphabets(t *testing.T, maxIterate int) *AlphaIterator {
 	it := &AlphaIterator{assert: require.New(t), maxIterate: maxIterate}
 	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
@@ -0,0 +1,104 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package gcsbackend
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/log"
+)
+
+// _maxComposeSources is the maximum number of objects composed at once.
+const _maxComposeSources = 32
+
+// uploadDir returns the directory holding the temporary objects of resumable
+// uploads of objectName. It is derived from objectName only, such that retries
+// find the parts of previous attempts.
+func (c *Client) uploadDir(objectName string) string {
+	h := sha256.Sum256([]byte(objectName))
+	return path.Join(c.config.RootDirectory, "_uploads", hex.EncodeToString(h[:]))
+}
+
+// uploadResumable uploads src to objectName as a parallel composite upload.
+// Parts of UploadChunkSize are uploaded as temporary objects, with
+// UploadConcurrency parts in flight, and then composed into objectName. Part
+// objects left by an interrupted upload are reused if their size and MD5 match
+// src. Temporary objects are deleted once the upload succeeds. Abandoned part
+// objects should be expired with a bucket lifecycle rule.
+func (c *Client) uploadResumable(objectName string, src backend.SizedReaderAt) error {
+	dir := c.uploadDir(objectName)
+	parts := backend.SplitParts(src.Size(), c.config.UploadChunkSize)
+	names := make([]string, len(parts))
+	for i, p := range parts {
+		names[i] = path.Join(dir, fmt.Sprintf("part-%05d", p.Number))
+	}
+
+	err := backend.UploadParts(parts, c.config.UploadConcurrency, func(p backend.Part) error {
+		name := names[p.Number-1]
+		h := md5.New()
+		if _, err := io.Copy(h, p.Reader(src)); err != nil {
+			return fmt.Errorf("read part %d: %s", p.Number, err)
+		}
+		if attrs, err := c.gcs.ObjectAttrs(name); err == nil &&
+			attrs.Size == p.Size && bytes.Equal(attrs.MD5, h.Sum(nil)) {
+
+			c.stats.Counter("upload_parts_reused").Inc(1)
+			return nil
+		}
+		if _, err := c.gcs.Upload(name, p.Reader(src)); err != nil {
+			return fmt.Errorf("upload part %d: %s", p.Number, err)
+		}
+		c.stats.Counter("upload_parts").Inc(1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	temp := append([]string(nil), names...)
+	srcs := names
+	for level := 0; len(srcs) > _maxComposeSources; level++ {
+		var next []string
+		for i := 0; i < len(srcs); i += _maxComposeSources {
+			end := i + _maxComposeSources
+			if end > len(srcs) {
+				end = len(srcs)
+			}
+			name := path.Join(dir, fmt.Sprintf("compose-%d-%05d", level, i/_maxComposeSources))
+			if err := c.gcs.Compose(name, srcs[i:end]); err != nil {
+				return fmt.Errorf("compose %s: %s", name, err)
+			}
+			next = append(next, name)
+			temp = append(temp, name)
+		}
+		srcs = next
+	}
+	if err := c.gcs.Compose(objectName, srcs); err != nil {
+		return fmt.Errorf("compose: %s", err)
+	}
+
+	for _, name := range temp {
+		if err := c.gcs.Delete(name); err != nil && !isObjectNotFound(err) {
+			log.With("object", name).Errorf("Error deleting temporary upload object: %s", err)
+		}
+	}
+	return nil
+}
@@ -29,6 +29,17 @@ type Config struct {
 	RootDirectory   string `yaml:"root_directory"`   // GCS root directory for docker images
 	UploadChunkSize int64  `yaml:"upload_part_size"` // part size gcs manager uses for upload
 
+	// UploadConcurrency is the number of parts uploaded in parallel by
+	// resumable uploads.
+	UploadConcurrency int `yaml:"upload_concurrency"`
+
+	// ResumableUpload uploads sources larger than UploadChunkSize which
+	// support random access, such as cache files, as parallel composite
+	// uploads: parts are uploaded as temporary objects which are composed
+	// into the blob. Part objects are kept on failure, and retries reuse
+	// parts which were already uploaded intact.
+	ResumableUpload bool `yaml:"resumable_upload"`
+
 	// ListMaxKeys sets the max keys returned per page.
 	ListMaxKeys int `yaml:"list_max_keys"`
 
@@ -55,6 +66,9 @@ func (c *Config) applyDefaults() {
 	if c.UploadChunkSize == 0 {
 		c.UploadChunkSize = backend.DefaultPartSize
 	}
+	if c.UploadConcurrency == 0 {
+		c.UploadConcurrency = backend.DefaultConcurrency
+	}
 	if c.BufferGuard == 0 {
 		c.BufferGuard = backend.DefaultBufferGuard
 	}
@@ -24,7 +24,10 @@ import (
 type GCS interface {
 	ObjectAttrs(objectName string) (*storage.ObjectAttrs, error)
 	Download(objectName string, w io.Writer) (int64, error)
+	DownloadRange(objectName string, offset, length int64, w io.Writer) (int64, error)
 	Upload(objectName string, r io.Reader) (int64, error)
 	GetObjectIterator(prefix string) iterator.Pageable
 	NextPage(pager *iterator.Pager) ([]string, string, error)
+	Delete(objectName string) error
+	Compose(objectName string, srcs []string) error
 }
@@ -131,6 +131,15 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return c.webhdfs.Rename(uploadPath, blobPath)
 }
 
+// Delete removes name.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	return c.webhdfs.Delete(path)
+}
+
 var (
 	_ignoreRegex = regexp.MustCompile(
 		"^.+/repositories/.+/(_layers|_uploads|_manifests/(revisions|tags/.+/index)).*")
@@ -39,6 +39,7 @@ type Client interface {
 	Open(path string, dst io.Writer) error
 	GetFileStatus(path string) (FileStatus, error)
 	ListFileStatus(path string) ([]FileStatus, error)
+	Delete(path string) error
 }
 
 type allNameNodesFailedError struct {
@@ -318,6 +319,31 @@ func (c *client) ListFileStatus(path string) ([]FileStatus, error) {
 	return nil, allNameNodesFailedError{nnErr}
 }
 
+func (c *client) Delete(path string) error {
+	v := c.values()
+	v.Set("op", "DELETE")
+	v.Set("recursive", "false")
+
+	var resp *http.Response
+	var nnErr error
+	for _, nn := range c.namenodes {
+		resp, nnErr = httputil.Delete(
+			getURL(nn, path, v),
+			httputil.SendRetry(httputil.RetryBackoff(c.nameNodeBackOff())))
+		if nnErr != nil {
+			if retryable(nnErr) {
+				continue
+			}
+			return nnErr
+		}
+		// The response body reports false if path did not exist, which is
+		// not an error.
+		resp.Body.Close()
+		return nil
+	}
+	return allNameNodesFailedError{nnErr}
+}
+
 func (c *client) values() url.Values {
 	v := url.Values{}
 	if c.username != "" {
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"time"
 
 	"github.com/uber-go/tally"
@@ -59,26 +60,40 @@ func (f *factory) Create(
 type Config struct {
 	UploadURL       string                            `yaml:"upload_url"`   // http upload post url
 	DownloadURL     string                            `yaml:"download_url"` // http download get url
+	DeleteURL       string                            `yaml:"delete_url"`   // http delete url, optional
 	DownloadTimeout time.Duration                     `yaml:"download_timeout"`
 	DownloadBackOff httputil.ExponentialBackOffConfig `yaml:"download_backoff"`
+
+	// MaxIdleConnsPerHost limits the idle connections kept to the download
+	// host for reuse by subsequent downloads.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
 }
 
 // Client implements downloading/uploading object from/to S3
 type Client struct {
-	config Config
-	stats  tally.Scope
+	config    Config
+	stats     tally.Scope
+	transport http.RoundTripper
 }
 
 func (c Config) applyDefaults() Config {
 	if c.DownloadTimeout == 0 {
 		c.DownloadTimeout = 180 * time.Second
 	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = backend.DefaultMaxIdleConnsPerHost
+	}
 	return c
 }
 
 // NewClient creates a new http Client.
 func NewClient(config Config, stats tally.Scope) (*Client, error) {
-	return &Client{config: config.applyDefaults(), stats: stats}, nil
+	config = config.applyDefaults()
+	return &Client{
+		config:    config,
+		stats:     stats,
+		transport: httputil.NewPooledTransport(config.MaxIdleConnsPerHost),
+	}, nil
 }
 
 // Stat always succeeds.
@@ -98,7 +113,8 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	resp, err := httputil.Get(
 		b.String(),
 		httputil.SendTimeout(c.config.DownloadTimeout),
-		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())))
+		httputil.SendRetry(httputil.RetryBackoff(c.config.DownloadBackOff.Build())),
+		httputil.SendTransport(c.transport))
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return backenderrors.ErrBlobNotFound
@@ -117,6 +133,23 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// Delete deletes name through the configured delete url. Not supported if no
+// delete url is configured.
+func (c *Client) Delete(namespace, name string) error {
+	if c.config.DeleteURL == "" {
+		return errors.New("not supported")
+	}
+	var b bytes.Buffer
+	if _, err := fmt.Fprintf(&b, c.config.DeleteURL, name); err != nil {
+		return fmt.Errorf("format url: %s", err)
+	}
+	_, err := httputil.Delete(b.String(), httputil.SendTransport(c.transport))
+	if err != nil && !httputil.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 // List is not supported.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
@@ -28,8 +28,19 @@ import (
 // Manager errors.
 var (
 	ErrNamespaceNotFound = errors.New("no matches for namespace")
+	ErrDeleteDisabled    = errors.New("delete is disabled for namespace")
 )
 
+// deleteDisabledClient is a Client which refuses to delete blobs.
+type deleteDisabledClient struct {
+	Client
+}
+
+// Delete always returns ErrDeleteDisabled.
+func (c deleteDisabledClient) Delete(namespace, name string) error {
+	return ErrDeleteDisabled
+}
+
 type backend struct {
 	regexp    *regexp.Regexp
 	client    Client
@@ -51,11 +62,16 @@ func newBackend(namespace string, c Client, mustReady bool) (*backend, error) {
 // Manager manages backend clients for namespace regular expressions.
 type Manager struct {
 	backends []*backend
+	aliases  []*alias
 }
 
 // ManagerConfig is config for backend manager.
 type ManagerConfig struct {
 	Log log.Config `yaml:"log"`
+
+	// Aliases map deprecated namespaces to new ones, so clients which still
+	// use the old names keep working.
+	Aliases []AliasConfig `yaml:"aliases"`
 }
 
 // NewManager creates a new backend Manager.
@@ -86,6 +102,9 @@ func NewManager(managerConfig ManagerConfig, configs []Config, auth AuthConfig,
 		if err != nil {
 			return nil, fmt.Errorf("create backend client: %s", err)
 		}
+		if !config.AllowDelete {
+			c = deleteDisabledClient{c}
+		}
 
 		if config.Bandwidth.Enable {
 			l, err := bandwidth.NewLimiter(config.Bandwidth)
@@ -100,7 +119,16 @@ func NewManager(managerConfig ManagerConfig, configs []Config, auth AuthConfig,
 		}
 		backends = append(backends, b)
 	}
-	return &Manager{backends}, nil
+
+	var aliases []*alias
+	for _, config := range managerConfig.Aliases {
+		a, err := newAlias(config, stats)
+		if err != nil {
+			return nil, fmt.Errorf("new alias for namespace %s: %s", config.Namespace, err)
+		}
+		aliases = append(aliases, a)
+	}
+	return &Manager{backends, aliases}, nil
 }
 
 // AdjustBandwidth adjusts bandwidth limits across all throttled clients to the
@@ -141,11 +169,31 @@ func (m *Manager) Register(namespace string, c Client, mustReady bool) error {
 }
 
 // GetClient matches namespace to the configured Client. Returns ErrNamespaceNotFound
-// if no clients match namespace.
+// if no clients match namespace. If namespace is an alias, the returned Client
+// routes operations to the clients of both the old and the new namespace.
 func (m *Manager) GetClient(namespace string) (Client, error) {
 	if namespace == NoopNamespace {
 		return NoopClient{}, nil
 	}
+	for _, a := range m.aliases {
+		if !a.regexp.MatchString(namespace) {
+			continue
+		}
+		newClient, err := m.getClient(a.resolve(namespace))
+		if err != nil {
+			return nil, err
+		}
+		// The old namespace may no longer have a backend.
+		oldClient, err := m.getClient(namespace)
+		if err != nil && err != ErrNamespaceNotFound {
+			return nil, err
+		}
+		return &aliasClient{a, oldClient, newClient}, nil
+	}
+	return m.getClient(namespace)
+}
+
+func (m *Manager) getClient(namespace string) (Client, error) {
 	for _, b := range m.backends {
 		if b.regexp.MatchString(namespace) {
 			return b.client, nil
@@ -14,7 +14,9 @@
 package backend_test
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
 	"testing"
 
 	"github.com/uber-go/tally"
@@ -25,7 +27,9 @@ import (
 	"github.com/uber/kraken/lib/backend/testfs"
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/utils/bandwidth"
+	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/stringset"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
@@ -87,18 +91,22 @@ func TestManagerNamespaceOrdering(t *testing.T) {
 	fooAddr := "testfs-foo"
 	defaultAddr := "testfs-default"
 
+	// Deletes are allowed so the clients are not wrapped.
 	configStr := `
 - namespace: foo/bar/.*
+  allow_delete: true
   backend:
       testfs:
           addr: testfs-foo-bar
           name_path: identity
 - namespace: foo/.*
+  allow_delete: true
   backend:
       testfs:
           addr: testfs-foo
           name_path: identity
 - namespace: .*
+  allow_delete: true
   backend:
       testfs:
           addr: testfs-default
@@ -161,6 +169,77 @@ func TestManagerBandwidth(t *testing.T) {
 	checkBandwidth(5, 25)
 }
 
+func TestManagerRangeDownloaderUnsupported(t *testing.T) {
+	require := require.New(t)
+
+	m, err := NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: ".*",
+			Bandwidth: bandwidth.Config{
+				EgressBitsPerSec:  10,
+				IngressBitsPerSec: 50,
+				TokenSize:         1,
+				Enable:            true,
+			},
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: "test-addr", NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	c, err := m.GetClient("foo")
+	require.NoError(err)
+
+	// Throttled clients only support ranges if the wrapped client does.
+	_, ok := GetRangeDownloader(c)
+	require.False(ok)
+}
+
+func TestManagerDeleteDisabledByDefault(t *testing.T) {
+	require := require.New(t)
+
+	s := testfs.NewServer()
+	defer s.Cleanup()
+
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	m, err := NewManager(
+		ManagerConfig{},
+		[]Config{{
+			Namespace: "disabled/.*",
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: addr, NamePath: namepath.Identity},
+			},
+		}, {
+			Namespace:   "enabled/.*",
+			AllowDelete: true,
+			Backend: map[string]interface{}{
+				"testfs": testfs.Config{Addr: addr, NamePath: namepath.Identity},
+			},
+		}}, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	for _, ns := range []string{"disabled/repo", "enabled/repo"} {
+		c, err := m.GetClient(ns)
+		require.NoError(err)
+		require.NoError(c.Upload(ns, blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+
+	c, err := m.GetClient("disabled/repo")
+	require.NoError(err)
+	require.Equal(ErrDeleteDisabled, c.Delete("disabled/repo", blob.Digest.Hex()))
+
+	c, err = m.GetClient("enabled/repo")
+	require.NoError(err)
+	require.NoError(c.Delete("enabled/repo", blob.Digest.Hex()))
+	_, err = c.Stat("enabled/repo", blob.Digest.Hex())
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+}
+
 func TestManagerCheckReadiness(t *testing.T) {
 	n1 := "foo/*"
 	n2 := "bar/*"
@@ -238,3 +317,129 @@ func TestManagerCheckReadiness(t *testing.T) {
 		})
 	}
 }
+
+func aliasManagerFixture(
+	t *testing.T, ctrl *gomock.Controller, mode string, stats tally.Scope) (
+	*Manager, *mockbackend.MockClient, *mockbackend.MockClient) {
+
+	m, err := NewManager(ManagerConfig{
+		Aliases: []AliasConfig{{
+			Namespace: "^old-team/(.*)$",
+			Target:    "new-team/$1",
+			Mode:      mode,
+		}},
+	}, nil, AuthConfig{}, stats)
+	require.NoError(t, err)
+
+	oldClient := mockbackend.NewMockClient(ctrl)
+	newClient := mockbackend.NewMockClient(ctrl)
+	require.NoError(t, m.Register("old-team/.*", oldClient, false))
+	require.NoError(t, m.Register("new-team/.*", newClient, false))
+
+	return m, oldClient, newClient
+}
+
+func TestManagerAliasWriteNew(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stats := tally.NewTestScope("", nil)
+	m, oldClient, newClient := aliasManagerFixture(t, ctrl, "", stats)
+
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+
+	c, err := m.GetClient("old-team/repo")
+	require.NoError(err)
+
+	newClient.EXPECT().Upload("new-team/repo", name, mockutil.MatchReader(blob.Content)).Return(nil)
+	require.NoError(c.Upload("old-team/repo", name, bytes.NewReader(blob.Content)))
+
+	gomock.InOrder(
+		newClient.EXPECT().Download("new-team/repo", name, gomock.Any()).Return(
+			backenderrors.ErrBlobNotFound),
+		oldClient.EXPECT().Download("old-team/repo", name, gomock.Any()).Return(nil),
+	)
+	require.NoError(c.Download("old-team/repo", name, ioutil.Discard))
+
+	counters := stats.Snapshot().Counters()
+	require.Equal(int64(1), counters["alias_hits+alias=^old-team/(.*)$,op=upload"].Value())
+	require.Equal(int64(1), counters["alias_hits+alias=^old-team/(.*)$,op=download"].Value())
+	require.Equal(int64(1), counters["alias_fallbacks+alias=^old-team/(.*)$"].Value())
+}
+
+func TestManagerAliasReadOld(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m, oldClient, newClient := aliasManagerFixture(t, ctrl, AliasReadOld, tally.NoopScope)
+
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+
+	c, err := m.GetClient("old-team/repo")
+	require.NoError(err)
+
+	newClient.EXPECT().Upload("new-team/repo", name, mockutil.MatchReader(blob.Content)).Return(nil)
+	require.NoError(c.Upload("old-team/repo", name, bytes.NewReader(blob.Content)))
+
+	gomock.InOrder(
+		oldClient.EXPECT().Stat("old-team/repo", name).Return(nil, backenderrors.ErrBlobNotFound),
+		newClient.EXPECT().Stat("new-team/repo", name).Return(blob.Info(), nil),
+	)
+	info, err := c.Stat("old-team/repo", name)
+	require.NoError(err)
+	require.Equal(blob.Info(), info)
+}
+
+func TestManagerAliasBoth(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m, oldClient, newClient := aliasManagerFixture(t, ctrl, AliasBoth, tally.NoopScope)
+
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+
+	c, err := m.GetClient("old-team/repo")
+	require.NoError(err)
+
+	oldClient.EXPECT().Upload("old-team/repo", name, mockutil.MatchReader(blob.Content)).Return(nil)
+	newClient.EXPECT().Upload("new-team/repo", name, mockutil.MatchReader(blob.Content)).Return(nil)
+	require.NoError(c.Upload("old-team/repo", name, bytes.NewReader(blob.Content)))
+}
+
+func TestManagerAliasWithoutOldBackend(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m, err := NewManager(ManagerConfig{
+		Aliases: []AliasConfig{{Namespace: "^old-team/(.*)$", Target: "new-team/$1"}},
+	}, nil, AuthConfig{}, tally.NoopScope)
+	require.NoError(err)
+
+	newClient := mockbackend.NewMockClient(ctrl)
+	require.NoError(m.Register("new-team/.*", newClient, false))
+
+	c, err := m.GetClient("old-team/repo")
+	require.NoError(err)
+
+	newClient.EXPECT().Stat("new-team/repo", "foo").Return(nil, backenderrors.ErrBlobNotFound)
+	_, err = c.Stat("old-team/repo", "foo")
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+}
+
+func TestManagerAliasInvalidMode(t *testing.T) {
+	_, err := NewManager(ManagerConfig{
+		Aliases: []AliasConfig{{Namespace: "old", Target: "new", Mode: "invalid"}},
+	}, nil, AuthConfig{}, tally.NoopScope)
+	require.Error(t, err)
+}
@@ -44,6 +44,11 @@ func (c NoopClient) Download(namespace, name string, dst io.Writer) error {
 	return backenderrors.ErrBlobNotFound
 }
 
+// Delete always returns nil.
+func (c NoopClient) Delete(namespace, name string) error {
+	return nil
+}
+
 // List always returns nil.
 func (c NoopClient) List(prefix string, opts ...ListOption) (*ListResult, error) {
 	return nil, nil
@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"io"
+	"sync"
+
+	"github.com/uber/kraken/lib/store"
+)
+
+// SizedReaderAt is an upload source which supports random access, such as a
+// cache file. Backends which support resumable uploads upload parts of such
+// sources concurrently.
+type SizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+// Ensure that cache files can be uploaded in parts.
+var _ SizedReaderAt = (store.FileReader)(nil)
+
+// Part is a byte range of an upload source, numbered from 1.
+type Part struct {
+	Number int
+	Offset int64
+	Size   int64
+}
+
+// Reader returns a reader of p's range in src.
+func (p Part) Reader(src io.ReaderAt) *io.SectionReader {
+	return io.NewSectionReader(src, p.Offset, p.Size)
+}
+
+// SplitParts splits size bytes into parts of partSize. The last part may be
+// smaller. A zero size yields a single empty part.
+func SplitParts(size, partSize int64) []Part {
+	var parts []Part
+	for offset := int64(0); offset < size || len(parts) == 0; offset += partSize {
+		n := partSize
+		if size-offset < n {
+			n = size - offset
+		}
+		parts = append(parts, Part{Number: len(parts) + 1, Offset: offset, Size: n})
+	}
+	return parts
+}
+
+// UploadParts calls upload for each of parts, with at most concurrency calls
+// in flight. Stops starting new calls after the first error, which is
+// returned once all calls in flight have finished.
+func UploadParts(parts []Part, concurrency int, upload func(Part) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		uploadErr error
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, p := range parts {
+		mu.Lock()
+		failed := uploadErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(p Part) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := upload(p); err != nil {
+				mu.Lock()
+				if uploadErr == nil {
+					uploadErr = err
+				}
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	return uploadErr
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/uber/kraken/lib/backend"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitParts(t *testing.T) {
+	tests := []struct {
+		desc     string
+		size     int64
+		partSize int64
+		expected []Part
+	}{
+		{"empty", 0, 4, []Part{{1, 0, 0}}},
+		{"smaller than part", 3, 4, []Part{{1, 0, 3}}},
+		{"exact multiple", 8, 4, []Part{{1, 0, 4}, {2, 4, 4}}},
+		{"short last part", 10, 4, []Part{{1, 0, 4}, {2, 4, 4}, {3, 8, 2}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, SplitParts(test.size, test.partSize))
+		})
+	}
+}
+
+func TestUploadPartsUploadsAllParts(t *testing.T) {
+	require := require.New(t)
+
+	parts := SplitParts(100, 7)
+
+	var mu sync.Mutex
+	uploaded := make(map[int]bool)
+	require.NoError(UploadParts(parts, 3, func(p Part) error {
+		mu.Lock()
+		defer mu.Unlock()
+		uploaded[p.Number] = true
+		return nil
+	}))
+	require.Len(uploaded, len(parts))
+}
+
+func TestUploadPartsReturnsFirstError(t *testing.T) {
+	require := require.New(t)
+
+	err := errors.New("some error")
+	require.Equal(err, UploadParts(SplitParts(100, 7), 1, func(p Part) error {
+		if p.Number == 2 {
+			return err
+		}
+		return nil
+	}))
+}
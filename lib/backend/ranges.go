@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"errors"
+	"io"
+)
+
+var errRangeUnsupported = errors.New("backend client does not support ranged downloads")
+
+// RangeDownloader is implemented by clients which can download a byte range
+// of a blob, allowing large blobs to be downloaded in concurrent parts.
+type RangeDownloader interface {
+	// DownloadRange downloads length bytes of name starting at offset into
+	// dst. Implementations should return backenderrors.ErrBlobNotFound when
+	// the blob was not found.
+	DownloadRange(namespace, name string, offset, length int64, dst io.Writer) error
+}
+
+// GetRangeDownloader returns client as a RangeDownloader if client, and every
+// client it wraps, supports ranged downloads.
+func GetRangeDownloader(client Client) (RangeDownloader, bool) {
+	switch c := client.(type) {
+	case *ThrottledClient:
+		if _, ok := GetRangeDownloader(c.Client); !ok {
+			return nil, false
+		}
+		return c, true
+	case *aliasClient:
+		for _, inner := range []Client{c.oldClient, c.newClient} {
+			if inner == nil {
+				continue
+			}
+			if _, ok := GetRangeDownloader(inner); !ok {
+				return nil, false
+			}
+		}
+		return c, true
+	}
+	r, ok := client.(RangeDownloader)
+	return r, ok
+}
@@ -158,6 +158,11 @@ func (c *BlobClient) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// Delete is not supported.
+func (c *BlobClient) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
 // List is not supported for blobs.
 func (c *BlobClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registrybackend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend"
+	"go.uber.org/zap"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	_registrypullthroughblob = "registry_pullthrough_blob"
+	_registrypullthroughtag  = "registry_pullthrough_tag"
+)
+
+func init() {
+	backend.Register(_registrypullthroughblob, &pullThroughBlobClientFactory{})
+	backend.Register(_registrypullthroughtag, &pullThroughTagClientFactory{})
+}
+
+// PullThroughConfig defines a set of upstream registries which are selected
+// by the first path component of the requested repository. For example, with
+// an upstream keyed by "gcr.io", repository "gcr.io/foo/bar" is fetched as
+// "foo/bar" from that upstream's address, using that upstream's security
+// options.
+type PullThroughConfig struct {
+	Upstreams map[string]Config `yaml:"upstreams"`
+
+	// Default is the upstream key used for repositories whose first path
+	// component does not match any upstream, e.g. "library/alpine" when
+	// Default is "docker.io". If empty, such repositories are rejected.
+	Default string `yaml:"default"`
+}
+
+func unmarshalPullThroughConfig(confRaw interface{}) (PullThroughConfig, error) {
+	var config PullThroughConfig
+	confBytes, err := yaml.Marshal(confRaw)
+	if err != nil {
+		return config, errors.New("marshal registry pull-through config")
+	}
+	if err := yaml.Unmarshal(confBytes, &config); err != nil {
+		return config, errors.New("unmarshal registry pull-through config")
+	}
+	return config, nil
+}
+
+// splitUpstream splits repo into its upstream key and the repository path
+// relative to that upstream.
+func splitUpstream(config PullThroughConfig, repo string) (string, string, error) {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 2 {
+		if _, ok := config.Upstreams[parts[0]]; ok {
+			return parts[0], parts[1], nil
+		}
+	}
+	if config.Default == "" {
+		return "", "", fmt.Errorf("no upstream registry configured for %s", repo)
+	}
+	return config.Default, repo, nil
+}
+
+type pullThroughBlobClientFactory struct{}
+
+func (f *pullThroughBlobClientFactory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	config, err := unmarshalPullThroughConfig(confRaw)
+	if err != nil {
+		return nil, err
+	}
+	return NewPullThroughBlobClient(config, stats)
+}
+
+// PullThroughBlobClient is a read-only blob client which proxies requests to
+// one of several upstream registries.
+type PullThroughBlobClient struct {
+	config  PullThroughConfig
+	clients map[string]*BlobClient
+}
+
+// NewPullThroughBlobClient creates a new PullThroughBlobClient.
+func NewPullThroughBlobClient(
+	config PullThroughConfig, stats tally.Scope) (*PullThroughBlobClient, error) {
+
+	if config.Default != "" {
+		if _, ok := config.Upstreams[config.Default]; !ok {
+			return nil, fmt.Errorf("default upstream %s not configured", config.Default)
+		}
+	}
+	clients := make(map[string]*BlobClient)
+	for name, upstream := range config.Upstreams {
+		c, err := NewBlobClient(upstream, stats.Tagged(map[string]string{"upstream": name}))
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %s", name, err)
+		}
+		clients[name] = c
+	}
+	return &PullThroughBlobClient{config, clients}, nil
+}
+
+func (c *PullThroughBlobClient) resolve(namespace string) (*BlobClient, string, error) {
+	upstream, repo, err := splitUpstream(c.config, namespace)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.clients[upstream], repo, nil
+}
+
+// Stat returns blob info for name from the upstream matching namespace.
+func (c *PullThroughBlobClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	client, repo, err := c.resolve(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return client.Stat(repo, name)
+}
+
+// Download downloads name from the upstream matching namespace into dst.
+func (c *PullThroughBlobClient) Download(namespace, name string, dst io.Writer) error {
+	client, repo, err := c.resolve(namespace)
+	if err != nil {
+		return err
+	}
+	return client.Download(repo, name, dst)
+}
+
+// Upload is not supported.
+func (c *PullThroughBlobClient) Upload(namespace, name string, src io.Reader) error {
+	return errors.New("not supported")
+}
+
+// Delete is not supported.
+func (c *PullThroughBlobClient) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
+// List is not supported.
+func (c *PullThroughBlobClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	return nil, errors.New("not supported")
+}
+
+type pullThroughTagClientFactory struct{}
+
+func (f *pullThroughTagClientFactory) Create(
+	confRaw interface{}, masterAuthConfig backend.AuthConfig, stats tally.Scope, _ *zap.SugaredLogger) (backend.Client, error) {
+
+	config, err := unmarshalPullThroughConfig(confRaw)
+	if err != nil {
+		return nil, err
+	}
+	return NewPullThroughTagClient(config, stats)
+}
+
+// PullThroughTagClient is a read-only tag client which resolves tags against
+// one of several upstream registries.
+type PullThroughTagClient struct {
+	config  PullThroughConfig
+	clients map[string]*TagClient
+}
+
+// NewPullThroughTagClient creates a new PullThroughTagClient.
+func NewPullThroughTagClient(
+	config PullThroughConfig, stats tally.Scope) (*PullThroughTagClient, error) {
+
+	if config.Default != "" {
+		if _, ok := config.Upstreams[config.Default]; !ok {
+			return nil, fmt.Errorf("default upstream %s not configured", config.Default)
+		}
+	}
+	clients := make(map[string]*TagClient)
+	for name, upstream := range config.Upstreams {
+		c, err := NewTagClient(upstream, stats.Tagged(map[string]string{"upstream": name}))
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %s", name, err)
+		}
+		clients[name] = c
+	}
+	return &PullThroughTagClient{config, clients}, nil
+}
+
+// resolve maps a "repo:tag" name to the upstream client and the name relative
+// to that upstream.
+func (c *PullThroughTagClient) resolve(name string) (*TagClient, string, error) {
+	upstream, rest, err := splitUpstream(c.config, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.clients[upstream], rest, nil
+}
+
+// Stat returns blob info for the manifest of tag name.
+func (c *PullThroughTagClient) Stat(namespace, name string) (*core.BlobInfo, error) {
+	client, rest, err := c.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return client.Stat(namespace, rest)
+}
+
+// Download writes the manifest digest of tag name into dst.
+func (c *PullThroughTagClient) Download(namespace, name string, dst io.Writer) error {
+	client, rest, err := c.resolve(name)
+	if err != nil {
+		return err
+	}
+	return client.Download(namespace, rest, dst)
+}
+
+// Upload is not supported.
+func (c *PullThroughTagClient) Upload(namespace, name string, src io.Reader) error {
+	return errors.New("not supported")
+}
+
+// Delete is not supported.
+func (c *PullThroughTagClient) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
+// List is not supported.
+func (c *PullThroughTagClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
+	return nil, errors.New("not supported")
+}
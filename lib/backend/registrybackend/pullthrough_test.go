@@ -0,0 +1,159 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registrybackend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/memsize"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+	"go.uber.org/zap"
+)
+
+func TestPullThroughClientFactories(t *testing.T) {
+	require := require.New(t)
+
+	config := PullThroughConfig{
+		Upstreams: map[string]Config{"docker.io": {Address: "localhost:5000"}},
+		Default:   "docker.io",
+	}
+	_, err := (&pullThroughBlobClientFactory{}).Create(
+		config, nil, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+	_, err = (&pullThroughTagClientFactory{}).Create(
+		config, nil, tally.NoopScope, zap.NewNop().Sugar())
+	require.NoError(err)
+}
+
+func TestPullThroughInvalidDefault(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewPullThroughBlobClient(PullThroughConfig{Default: "gcr.io"}, tally.NoopScope)
+	require.Error(err)
+}
+
+func TestSplitUpstream(t *testing.T) {
+	config := PullThroughConfig{
+		Upstreams: map[string]Config{"docker.io": {}, "gcr.io": {}},
+		Default:   "docker.io",
+	}
+	tests := []struct {
+		repo     string
+		upstream string
+		rest     string
+	}{
+		{"gcr.io/foo/bar", "gcr.io", "foo/bar"},
+		{"docker.io/library/alpine:3", "docker.io", "library/alpine:3"},
+		{"library/alpine", "docker.io", "library/alpine"},
+		{"alpine:3", "docker.io", "alpine:3"},
+	}
+	for _, test := range tests {
+		t.Run(test.repo, func(t *testing.T) {
+			require := require.New(t)
+
+			upstream, rest, err := splitUpstream(config, test.repo)
+			require.NoError(err)
+			require.Equal(test.upstream, upstream)
+			require.Equal(test.rest, rest)
+		})
+	}
+}
+
+func TestSplitUpstreamNoDefault(t *testing.T) {
+	require := require.New(t)
+
+	config := PullThroughConfig{Upstreams: map[string]Config{"gcr.io": {}}}
+	_, _, err := splitUpstream(config, "library/alpine")
+	require.Error(err)
+}
+
+func TestPullThroughBlobDownload(t *testing.T) {
+	require := require.New(t)
+
+	blob := randutil.Blob(32 * memsize.KB)
+
+	r := chi.NewRouter()
+	r.Get("/v2/foo/bar/blobs/{blob}", func(w http.ResponseWriter, req *http.Request) {
+		_, err := io.Copy(w, bytes.NewReader(blob))
+		require.NoError(err)
+	})
+	r.Head("/v2/foo/bar/blobs/{blob}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(blob)))
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	client, err := NewPullThroughBlobClient(PullThroughConfig{
+		Upstreams: map[string]Config{"gcr.io": newTestConfig(addr)},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	info, err := client.Stat("gcr.io/foo/bar", "data")
+	require.NoError(err)
+	require.Equal(int64(len(blob)), info.Size)
+
+	var b bytes.Buffer
+	require.NoError(client.Download("gcr.io/foo/bar", "data", &b))
+	require.Equal(blob, b.Bytes())
+
+	_, err = client.Stat("quay.io/foo/bar", "data")
+	require.Error(err)
+}
+
+func TestPullThroughTagDownload(t *testing.T) {
+	require := require.New(t)
+
+	imageConfig := core.NewBlobFixture()
+	layer := core.NewBlobFixture()
+	digest, manifest := dockerutil.ManifestFixture(
+		imageConfig.Digest, layer.Digest, layer.Digest)
+
+	r := chi.NewRouter()
+	r.Get("/v2/library/alpine/manifests/{tag}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(manifest)))
+		_, err := io.Copy(w, bytes.NewReader(manifest))
+		require.NoError(err)
+	})
+	r.Head("/v2/library/alpine/manifests/{tag}", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(manifest)))
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	client, err := NewPullThroughTagClient(PullThroughConfig{
+		Upstreams: map[string]Config{"docker.io": newTestConfig(addr)},
+		Default:   "docker.io",
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	for _, tag := range []string{"docker.io/library/alpine:3", "library/alpine:3"} {
+		info, err := client.Stat(tag, tag)
+		require.NoError(err)
+		require.Equal(int64(len(manifest)), info.Size)
+
+		var b bytes.Buffer
+		require.NoError(client.Download(tag, tag, &b))
+		require.Equal(digest.String(), b.String())
+	}
+}
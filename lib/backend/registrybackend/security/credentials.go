@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package security
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+)
+
+const tokenUsername = "<token>"
+
+// _credentialsRefreshMargin is how long before expiry cached credentials are
+// refreshed, such that requests never use credentials about to expire.
+const _credentialsRefreshMargin = time.Minute
+
+// credentialStore provides credentials for token and basic auth. Credentials
+// from credential helpers are cached until they expire, and refresh tokens
+// issued by token services are kept for subsequent token requests.
+type credentialStore struct {
+	address string
+	config  Config
+	helper  credentialHelper
+
+	mu            sync.Mutex // Protects the following fields:
+	cached        *credentials
+	refreshTokens map[string]string // Keyed by realm and service.
+}
+
+func newCredentialStore(address string, config Config) (*credentialStore, error) {
+	helper, err := newCredentialHelper(config.RemoteCredentialsStore)
+	if err != nil {
+		return nil, err
+	}
+	return &credentialStore{
+		address:       address,
+		config:        config,
+		helper:        helper,
+		refreshTokens: make(map[string]string),
+	}, nil
+}
+
+func (c *credentialStore) Basic(*url.URL) (string, string) {
+	if creds := c.credentialsFromHelper(); creds.username != "" && creds.username != tokenUsername {
+		return creds.username, creds.secret
+	}
+	basic := c.config.BasicAuth
+	if basic == nil {
+		return "", ""
+	}
+	return basic.Username, basic.Password
+}
+
+func (c *credentialStore) RefreshToken(realm *url.URL, service string) string {
+	c.mu.Lock()
+	token, ok := c.refreshTokens[refreshTokenKey(realm, service)]
+	c.mu.Unlock()
+	if ok {
+		return token
+	}
+	if creds := c.credentialsFromHelper(); creds.username == tokenUsername {
+		return creds.secret
+	}
+	basic := c.config.BasicAuth
+	if basic == nil {
+		return ""
+	}
+	return basic.IdentityToken
+}
+
+func (c *credentialStore) SetRefreshToken(realm *url.URL, service, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshTokens[refreshTokenKey(realm, service)] = token
+}
+
+func refreshTokenKey(realm *url.URL, service string) string {
+	return realm.String() + " " + service
+}
+
+// invalidate drops cached credentials and refresh tokens, e.g. after the
+// registry rejected them.
+func (c *credentialStore) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cached = nil
+	c.refreshTokens = make(map[string]string)
+}
+
+// credentialsFromHelper returns credentials from the configured credential
+// helper, cached until they expire. If the helper fails, credentials which
+// have not expired yet are used.
+func (c *credentialStore) credentialsFromHelper() credentials {
+	if c.helper == nil {
+		// No credential helper configured, caller will use static credentials
+		// from configuration.
+		return credentials{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.cached != nil && now.Add(_credentialsRefreshMargin).Before(c.cached.expiry) {
+		return *c.cached
+	}
+	creds, err := c.helper.get(c.address)
+	if err != nil {
+		log.Errorf("get credentials from helper %s for %q: %s", c.config.RemoteCredentialsStore, c.address, err)
+		if c.cached != nil && now.Before(c.cached.expiry) {
+			return *c.cached
+		}
+		return credentials{}
+	}
+	if creds.expiry.IsZero() {
+		creds.expiry = now.Add(c.config.CredentialsTTL)
+	}
+	c.cached = &creds
+	return creds
+}
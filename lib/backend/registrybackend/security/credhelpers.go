@@ -0,0 +1,189 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package security
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
+	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
+	"github.com/docker/docker-credential-helpers/client"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+const credentialHelperPrefix = "docker-credential-"
+
+// Built-in credential helpers, selected via credsStore. Any other credsStore
+// value runs the docker-credential-<credsStore> program.
+const (
+	_ecrHelper = "ecr-login"
+	_gcrHelper = "gcr-login"
+	_acrHelper = "acr-login"
+)
+
+// credentials are registry credentials, valid until expiry. A zero expiry
+// means the validity is unknown.
+type credentials struct {
+	username string
+	secret   string
+	expiry   time.Time
+}
+
+// credentialHelper fetches registry credentials, e.g. from a cloud provider.
+type credentialHelper interface {
+	get(address string) (credentials, error)
+}
+
+func newCredentialHelper(store string) (credentialHelper, error) {
+	switch store {
+	case "":
+		return nil, nil
+	case _ecrHelper:
+		return ecrHelper{}, nil
+	case _gcrHelper:
+		return gcrHelper{_gcrTokenURL}, nil
+	case _acrHelper:
+		return acrHelper{_acrTokenURL, "https"}, nil
+	default:
+		return programHelper{credentialHelperPrefix + store}, nil
+	}
+}
+
+// ecrHelper gets credentials of Amazon ECR registries from the AWS
+// environment.
+type ecrHelper struct{}
+
+// _ecrTokenValidity is a conservative validity of ECR tokens, which expire
+// after 12 hours.
+const _ecrTokenValidity = 6 * time.Hour
+
+func (ecrHelper) get(address string) (credentials, error) {
+	helper := ecr.ECRHelper{ClientFactory: api.DefaultClientFactory{}}
+	username, password, err := helper.Get(address)
+	if err != nil {
+		return credentials{}, fmt.Errorf("ecr: %s", err)
+	}
+	return credentials{username, password, time.Now().Add(_ecrTokenValidity)}, nil
+}
+
+// gcrHelper gets access tokens for Google Container Registry and Artifact
+// Registry from the GCE metadata server, using the default service account
+// of the instance.
+type gcrHelper struct {
+	tokenURL string
+}
+
+const _gcrTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+func (h gcrHelper) get(address string) (credentials, error) {
+	resp, err := httputil.Get(
+		h.tokenURL,
+		httputil.SendHeaders(map[string]string{"Metadata-Flavor": "Google"}),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		return credentials{}, fmt.Errorf("gcr metadata token: %s", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return credentials{}, fmt.Errorf("decode gcr metadata token: %s", err)
+	}
+	return credentials{
+		username: "oauth2accesstoken",
+		secret:   token.AccessToken,
+		expiry:   time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// acrHelper gets refresh tokens for Azure Container Registry by exchanging
+// an Azure AD token of the managed identity of the instance.
+type acrHelper struct {
+	tokenURL string
+	scheme   string // Scheme of the registry exchange endpoint.
+}
+
+const (
+	_acrTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token" +
+		"?api-version=2018-02-01&resource=https%3A%2F%2Fmanagement.azure.com%2F"
+
+	// _acrUsername is the username ACR expects with refresh tokens.
+	_acrUsername = "00000000-0000-0000-0000-000000000000"
+
+	// _acrTokenValidity is a conservative validity of ACR refresh tokens,
+	// which expire after 3 hours.
+	_acrTokenValidity = time.Hour
+)
+
+func (h acrHelper) get(address string) (credentials, error) {
+	resp, err := httputil.Get(
+		h.tokenURL,
+		httputil.SendHeaders(map[string]string{"Metadata": "true"}),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		return credentials{}, fmt.Errorf("azure ad token: %s", err)
+	}
+	defer resp.Body.Close()
+	var aad struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&aad); err != nil {
+		return credentials{}, fmt.Errorf("decode azure ad token: %s", err)
+	}
+
+	host := address
+	if u, err := url.Parse("//" + address); err == nil {
+		host = u.Hostname()
+	}
+	form := url.Values{}
+	form.Set("grant_type", "access_token")
+	form.Set("service", host)
+	form.Set("access_token", aad.AccessToken)
+	resp, err = httputil.Post(
+		fmt.Sprintf("%s://%s/oauth2/exchange", h.scheme, address),
+		httputil.SendBody(strings.NewReader(form.Encode())),
+		httputil.SendHeaders(map[string]string{"Content-Type": "application/x-www-form-urlencoded"}),
+		httputil.SendTimeout(10*time.Second))
+	if err != nil {
+		return credentials{}, fmt.Errorf("acr token exchange: %s", err)
+	}
+	defer resp.Body.Close()
+	var exchange struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&exchange); err != nil {
+		return credentials{}, fmt.Errorf("decode acr token exchange: %s", err)
+	}
+	return credentials{_acrUsername, exchange.RefreshToken, time.Now().Add(_acrTokenValidity)}, nil
+}
+
+// programHelper runs a docker credential helper program.
+type programHelper struct {
+	program string
+}
+
+func (h programHelper) get(address string) (credentials, error) {
+	creds, err := client.Get(client.NewShellProgramFunc(h.program), address)
+	if err != nil {
+		return credentials{}, err
+	}
+	return credentials{username: creds.Username, secret: creds.Secret}, nil
+}
@@ -16,26 +16,21 @@ package security
 import (
 	"fmt"
 	"net/http"
-	"net/url"
 	"sync"
+	"time"
 
-	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login"
-	"github.com/awslabs/amazon-ecr-credential-helper/ecr-login/api"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/docker/distribution/registry/client/auth"
 	"github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/docker/distribution/registry/client/transport"
-	"github.com/docker/docker-credential-helpers/client"
 	"github.com/docker/engine-api/types"
 )
 
 const (
-	basePingQuery          = "http://%s/v2/"
-	registryVersionHeader  = "Docker-Distribution-Api-Version"
-	tokenUsername          = "<token>"
-	credentialHelperPrefix = "docker-credential-"
+	basePingQuery         = "http://%s/v2/"
+	registryVersionHeader = "Docker-Distribution-Api-Version"
 )
 
 var v2Version = auth.APIVersion{
@@ -43,12 +38,36 @@ var v2Version = auth.APIVersion{
 	Version: "2.0",
 }
 
+// _challengeTTL is how long auth challenges of a registry are cached before
+// the registry is pinged again. Challenges are also refreshed whenever a
+// request is rejected as unauthorized.
+const _challengeTTL = time.Hour
+
 // Config contains tls and basic auth configuration.
 type Config struct {
 	TLS                    httputil.TLSConfig `yaml:"tls"`
 	BasicAuth              *types.AuthConfig  `yaml:"basic"`
 	RemoteCredentialsStore string             `yaml:"credsStore"`
 	EnableHTTPFallback     bool               `yaml:"enableHTTPFallback"`
+
+	// CredentialsTTL is how long credentials returned by credential helpers
+	// are cached, unless the helper reports when they expire. Defaults to 5m.
+	CredentialsTTL time.Duration `yaml:"credsTTL"`
+
+	// ScopeActions are the actions requested for repository scoped tokens.
+	// Defaults to pull only, since registry backends are read-only and
+	// read-only credentials may be refused tokens with push access.
+	ScopeActions []string `yaml:"scopeActions"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.CredentialsTTL == 0 {
+		c.CredentialsTTL = 5 * time.Minute
+	}
+	if len(c.ScopeActions) == 0 {
+		c.ScopeActions = []string{"pull"}
+	}
+	return c
 }
 
 // Authenticator creates send options to authenticate requests to registry
@@ -63,27 +82,36 @@ type authenticator struct {
 	address          string
 	config           Config
 	roundTripper     http.RoundTripper
-	credentialStore  auth.CredentialStore
+	credentialStore  *credentialStore
 	challengeManager challenge.Manager
 	tokenHandlers    sync.Map
+
+	challengeMu      sync.Mutex // Protects the following fields:
+	challengeUpdated time.Time
 }
 
 // NewAuthenticator returns a new authenticator for the given docker registry
 // address, TLS, and credentials configuration. It supports both basic auth and
-// token based authentication challenges. If TLS is disabled, no authentication
-// is attempted.
+// token based authentication challenges, including anonymous tokens for
+// registries which require tokens for public images. If TLS is disabled, no
+// authentication is attempted.
 func NewAuthenticator(address string, config Config) (Authenticator, error) {
+	config = config.applyDefaults()
 	rt := http.DefaultTransport.(*http.Transport).Clone()
 	tlsClientConfig, err := config.TLS.BuildClient()
 	if err != nil {
 		return nil, fmt.Errorf("build tls config for %q: %s", address, err)
 	}
 	rt.TLSClientConfig = tlsClientConfig
+	store, err := newCredentialStore(address, config)
+	if err != nil {
+		return nil, err
+	}
 	return &authenticator{
 		address:          address,
 		config:           config,
 		roundTripper:     rt,
-		credentialStore:  newCredentialStore(address, config),
+		credentialStore:  store,
 		challengeManager: challenge.NewSimpleManager(),
 	}, nil
 }
@@ -103,21 +131,15 @@ func (a *authenticator) Authenticate(repo string) ([]httputil.SendOption, error)
 		opts = append(opts, httputil.DisableHTTPFallback())
 	}
 
-	if !a.shouldAuth() {
-		opts = append(opts, httputil.SendTLSTransport(a.roundTripper))
-		return opts, nil
-	}
-	if err := a.updateChallenge(); err != nil {
+	if err := a.ensureChallenge(); err != nil {
 		return nil, fmt.Errorf("could not update auth challenge: %s", err)
 	}
-	opts = append(opts, httputil.SendTLSTransport(a.transport(repo)))
+	opts = append(opts, httputil.SendTLSTransport(&refreshingTransport{a, repo}))
 	return opts, nil
 }
 
-func (a *authenticator) shouldAuth() bool {
-	return a.config.BasicAuth != nil || a.config.RemoteCredentialsStore != ""
-}
-
+// transport returns a transport which authorizes requests according to the
+// challenges of the registry. Tokens are cached per repo until they expire.
 func (a *authenticator) transport(repo string) http.RoundTripper {
 	basicHandler := auth.NewBasicHandler(a.credentialStore)
 	bearerHandler, _ := a.tokenHandlers.LoadOrStore(repo, auth.NewTokenHandlerWithOptions(auth.TokenHandlerOptions{
@@ -126,7 +148,7 @@ func (a *authenticator) transport(repo string) http.RoundTripper {
 		Scopes: []auth.Scope{
 			auth.RepositoryScope{
 				Repository: repo,
-				Actions:    []string{"pull", "push"},
+				Actions:    a.config.ScopeActions,
 			},
 		},
 		ClientID: "docker",
@@ -134,16 +156,54 @@ func (a *authenticator) transport(repo string) http.RoundTripper {
 	return transport.NewTransport(a.roundTripper, auth.NewAuthorizer(a.challengeManager, basicHandler, bearerHandler.(auth.AuthenticationHandler)))
 }
 
+// ensureChallenge pings the registry for its auth challenges unless they were
+// updated within _challengeTTL.
+func (a *authenticator) ensureChallenge() error {
+	a.challengeMu.Lock()
+	defer a.challengeMu.Unlock()
+
+	if !a.challengeUpdated.IsZero() && time.Since(a.challengeUpdated) < _challengeTTL {
+		return nil
+	}
+	if err := a.updateChallenge(); err != nil {
+		return err
+	}
+	a.challengeUpdated = time.Now()
+	return nil
+}
+
+// invalidate drops the cached token of repo, and forces the challenges of
+// the registry to be updated on the next request.
+func (a *authenticator) invalidate(repo string) {
+	a.tokenHandlers.Delete(repo)
+	a.credentialStore.invalidate()
+
+	a.challengeMu.Lock()
+	a.challengeUpdated = time.Time{}
+	a.challengeMu.Unlock()
+}
+
+// updateChallenge pings the registry for its auth challenges. Registries
+// which do not reject the ping as unauthorized do not require auth.
 func (a *authenticator) updateChallenge() error {
+	fallback := httputil.DisableHTTPFallback()
+	if a.config.EnableHTTPFallback {
+		fallback = httputil.EnableHTTPFallback()
+	}
 	resp, err := httputil.Send(
 		"GET",
 		fmt.Sprintf(basePingQuery, a.address),
 		httputil.SendTLSTransport(a.roundTripper),
-		httputil.SendAcceptedCodes(http.StatusOK, http.StatusUnauthorized),
+		fallback,
+		httputil.SendAcceptedCodes(http.StatusOK, http.StatusUnauthorized, http.StatusNotFound),
 	)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil
+	}
 	versions := auth.APIVersions(resp, registryVersionHeader)
 	for _, version := range versions {
 		if version == v2Version {
@@ -156,62 +216,38 @@ func (a *authenticator) updateChallenge() error {
 	return fmt.Errorf("registry is not v2")
 }
 
-type credentialStore struct {
-	address string
-	config  Config
-}
-
-func newCredentialStore(address string, config Config) *credentialStore {
-	return &credentialStore{
-		address: address,
-		config:  config,
-	}
+// refreshingTransport authorizes requests to repo, and retries requests
+// rejected as unauthorized once with fresh challenges, tokens and
+// credentials, e.g. when a token was revoked before it expired or the
+// registry changed its token service.
+type refreshingTransport struct {
+	a    *authenticator
+	repo string
 }
 
-func (c credentialStore) Basic(*url.URL) (string, string) {
-	if username, password := c.credentialsFromHelper(); username != "" && username != tokenUsername {
-		return username, password
+func (t *refreshingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.a.transport(t.repo).RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
 	}
-	basic := c.config.BasicAuth
-	if basic == nil {
-		return "", ""
+	if req.Body != nil && req.GetBody == nil {
+		// Body was consumed and cannot be replayed.
+		return resp, nil
 	}
-	return basic.Username, basic.Password
-}
+	resp.Body.Close()
 
-func (c credentialStore) RefreshToken(*url.URL, string) string {
-	if username, token := c.credentialsFromHelper(); username == tokenUsername {
-		return token
+	log.With("registry", t.a.address, "repo", t.repo).Info("Request unauthorized, refreshing registry auth")
+	t.a.invalidate(t.repo)
+	if err := t.a.ensureChallenge(); err != nil {
+		return nil, fmt.Errorf("update auth challenge: %s", err)
 	}
-	basic := c.config.BasicAuth
-	if basic == nil {
-		return ""
-	}
-	return basic.IdentityToken
-}
-
-func (c credentialStore) credentialsFromHelper() (string, string) {
-	switch c.config.RemoteCredentialsStore {
-	case "":
-		// No credential helper configured, caller will use static credentials
-		// from configuration.
-		return "", ""
-	case "ecr-login":
-		client := ecr.ECRHelper{ClientFactory: api.DefaultClientFactory{}}
-		username, password, err := client.Get(c.address)
-		if err != nil {
-			log.Errorf("get credentials from helper ECR for %q: %s", c.address, err)
-		}
-		return username, password
-	default:
-		helper := credentialHelperPrefix + c.config.RemoteCredentialsStore
-		creds, err := client.Get(client.NewShellProgramFunc(helper), c.address)
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
 		if err != nil {
-			log.Errorf("get credentials from helper %s for %q: %s", c.config.RemoteCredentialsStore, c.address, err)
-			return "", ""
+			return nil, fmt.Errorf("get body: %s", err)
 		}
-		return creds.Username, creds.Secret
+		retry.Body = body
 	}
+	return t.a.transport(t.repo).RoundTrip(retry)
 }
-
-func (c credentialStore) SetRefreshToken(*url.URL, string, string) {}
@@ -0,0 +1,348 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/docker/engine-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenRegistry is a fake registry which requires bearer tokens issued by its
+// own token service.
+type tokenRegistry struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	pings    int
+	issued   int
+	scopes   []string
+	users    []string
+	revoked  map[string]bool
+	password string // Required password if not empty.
+}
+
+func newTokenRegistry() *tokenRegistry {
+	r := &tokenRegistry{revoked: make(map[string]bool)}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *tokenRegistry) addr() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func (r *tokenRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge := fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, r.URL)
+	switch {
+	case req.URL.Path == "/token":
+		user, password, _ := req.BasicAuth()
+		if r.password != "" && password != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.issued++
+		r.scopes = append(r.scopes, req.URL.Query().Get("scope"))
+		r.users = append(r.users, user)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"token":      fmt.Sprintf("token-%d", r.issued),
+			"expires_in": 3600,
+		})
+	case req.URL.Path == "/v2/":
+		r.pings++
+		w.Header().Set(registryVersionHeader, "registry/2.0")
+		w.Header().Set("WWW-Authenticate", challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+	default:
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if token == "" || r.revoked[token] {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, token)
+	}
+}
+
+func (r *tokenRegistry) revoke(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[token] = true
+}
+
+func (r *tokenRegistry) stats() (pings, issued int, scopes, users []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pings, r.issued, append([]string(nil), r.scopes...), append([]string(nil), r.users...)
+}
+
+func get(t *testing.T, a Authenticator, addr, repo string) string {
+	opts, err := a.Authenticate(repo)
+	require.NoError(t, err)
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/v2/%s/manifests/latest", addr, repo), opts...)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestAuthenticatorAnonymousToken(t *testing.T) {
+	require := require.New(t)
+
+	registry := newTokenRegistry()
+	defer registry.Close()
+
+	a, err := NewAuthenticator(registry.addr(), Config{EnableHTTPFallback: true})
+	require.NoError(err)
+
+	require.Equal("token-1", get(t, a, registry.addr(), "library/alpine"))
+	require.Equal("token-1", get(t, a, registry.addr(), "library/alpine"))
+
+	pings, issued, scopes, users := registry.stats()
+	require.Equal(1, pings, "challenge should be cached")
+	require.Equal(1, issued, "token should be cached")
+	require.Equal([]string{"repository:library/alpine:pull"}, scopes)
+	require.Equal([]string{""}, users)
+}
+
+func TestAuthenticatorTokensAreScopedToRepo(t *testing.T) {
+	require := require.New(t)
+
+	registry := newTokenRegistry()
+	defer registry.Close()
+
+	a, err := NewAuthenticator(registry.addr(), Config{
+		EnableHTTPFallback: true,
+		ScopeActions:       []string{"pull", "push"},
+	})
+	require.NoError(err)
+
+	require.Equal("token-1", get(t, a, registry.addr(), "foo"))
+	require.Equal("token-2", get(t, a, registry.addr(), "bar"))
+
+	_, _, scopes, _ := registry.stats()
+	require.Equal([]string{"repository:foo:pull,push", "repository:bar:pull,push"}, scopes)
+}
+
+func TestAuthenticatorRefreshesRevokedToken(t *testing.T) {
+	require := require.New(t)
+
+	registry := newTokenRegistry()
+	defer registry.Close()
+
+	a, err := NewAuthenticator(registry.addr(), Config{EnableHTTPFallback: true})
+	require.NoError(err)
+
+	require.Equal("token-1", get(t, a, registry.addr(), "foo"))
+
+	registry.revoke("token-1")
+
+	require.Equal("token-2", get(t, a, registry.addr(), "foo"))
+
+	pings, issued, _, _ := registry.stats()
+	require.Equal(2, pings)
+	require.Equal(2, issued)
+}
+
+func TestAuthenticatorBasicCredentials(t *testing.T) {
+	require := require.New(t)
+
+	registry := newTokenRegistry()
+	registry.password = "secret"
+	defer registry.Close()
+
+	a, err := NewAuthenticator(registry.addr(), Config{
+		EnableHTTPFallback: true,
+		BasicAuth:          &types.AuthConfig{Username: "user", Password: "secret"},
+	})
+	require.NoError(err)
+
+	require.Equal("token-1", get(t, a, registry.addr(), "foo"))
+
+	_, _, _, users := registry.stats()
+	require.Equal([]string{"user"}, users)
+}
+
+func TestAuthenticatorWithoutAuth(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		require.Empty(r.Header.Get("Authorization"))
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	a, err := NewAuthenticator(addr, Config{EnableHTTPFallback: true})
+	require.NoError(err)
+
+	require.Equal("ok", get(t, a, addr, "foo"))
+}
+
+type fakeHelper struct {
+	calls  int
+	creds  credentials
+	err    error
+	expiry time.Duration
+}
+
+func (h *fakeHelper) get(address string) (credentials, error) {
+	h.calls++
+	if h.err != nil {
+		return credentials{}, h.err
+	}
+	c := h.creds
+	if h.expiry != 0 {
+		c.expiry = time.Now().Add(h.expiry)
+	}
+	return c, nil
+}
+
+func TestCredentialStoreCachesHelperCredentials(t *testing.T) {
+	tests := []struct {
+		desc          string
+		expiry        time.Duration
+		ttl           time.Duration
+		expectedCalls int
+	}{
+		{"helper expiry", time.Hour, time.Minute, 1},
+		{"helper expiry within refresh margin", 30 * time.Second, time.Hour, 3},
+		{"config ttl", 0, time.Hour, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			helper := &fakeHelper{creds: credentials{username: "user", secret: "pass"}, expiry: test.expiry}
+			store := &credentialStore{
+				config:        Config{CredentialsTTL: test.ttl},
+				helper:        helper,
+				refreshTokens: make(map[string]string),
+			}
+			for i := 0; i < 3; i++ {
+				username, password := store.Basic(nil)
+				require.Equal("user", username)
+				require.Equal("pass", password)
+			}
+			require.Equal(test.expectedCalls, helper.calls)
+
+			store.invalidate()
+			store.Basic(nil)
+			require.Equal(test.expectedCalls+1, helper.calls)
+		})
+	}
+}
+
+func TestCredentialStoreUsesCachedCredentialsOnHelperError(t *testing.T) {
+	require := require.New(t)
+
+	helper := &fakeHelper{creds: credentials{username: "user", secret: "pass"}}
+	store := &credentialStore{
+		config:        Config{CredentialsTTL: time.Hour},
+		helper:        helper,
+		refreshTokens: make(map[string]string),
+	}
+	// Force a refresh on every call while keeping credentials valid.
+	store.credentialsFromHelper()
+	store.cached.expiry = time.Now().Add(30 * time.Second)
+
+	helper.err = errors.New("some error")
+	username, password := store.Basic(nil)
+	require.Equal("user", username)
+	require.Equal("pass", password)
+	require.Equal(2, helper.calls)
+}
+
+func TestGCRHelper(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal("Google", r.Header.Get("Metadata-Flavor"))
+		fmt.Fprint(w, `{"access_token": "gcr-token", "expires_in": 3599, "token_type": "Bearer"}`)
+	}))
+	defer server.Close()
+
+	creds, err := gcrHelper{server.URL}.get("gcr.io")
+	require.NoError(err)
+	require.Equal("oauth2accesstoken", creds.username)
+	require.Equal("gcr-token", creds.secret)
+	require.WithinDuration(time.Now().Add(time.Hour), creds.expiry, 5*time.Second)
+}
+
+func TestACRHelper(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			require.Equal("true", r.Header.Get("Metadata"))
+			fmt.Fprint(w, `{"access_token": "aad-token", "expires_in": "3599"}`)
+		case "/oauth2/exchange":
+			require.NoError(r.ParseForm())
+			require.Equal("access_token", r.PostForm.Get("grant_type"))
+			require.Equal("aad-token", r.PostForm.Get("access_token"))
+			require.Equal("127.0.0.1", r.PostForm.Get("service"))
+			fmt.Fprint(w, `{"refresh_token": "acr-refresh-token"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	creds, err := acrHelper{server.URL + "/metadata/identity/oauth2/token", "http"}.get(addr)
+	require.NoError(err)
+	require.Equal(_acrUsername, creds.username)
+	require.Equal("acr-refresh-token", creds.secret)
+}
+
+func TestNewCredentialHelper(t *testing.T) {
+	tests := []struct {
+		store    string
+		expected credentialHelper
+	}{
+		{"", nil},
+		{"ecr-login", ecrHelper{}},
+		{"gcr-login", gcrHelper{_gcrTokenURL}},
+		{"acr-login", acrHelper{_acrTokenURL, "https"}},
+		{"gcr", programHelper{"docker-credential-gcr"}},
+	}
+	for _, test := range tests {
+		t.Run(test.store, func(t *testing.T) {
+			helper, err := newCredentialHelper(test.store)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, helper)
+		})
+	}
+}
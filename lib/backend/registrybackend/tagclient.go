@@ -159,6 +159,11 @@ func (c *TagClient) Upload(namespace, name string, src io.Reader) error {
 	return errors.New("not supported")
 }
 
+// Delete is not supported.
+func (c *TagClient) Delete(namespace, name string) error {
+	return errors.New("not supported")
+}
+
 // List is not supported as users can list directly from registry.
 func (c *TagClient) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	return nil, errors.New("not supported")
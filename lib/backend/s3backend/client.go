@@ -17,6 +17,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"path"
 
 	"github.com/uber-go/tally"
@@ -24,6 +25,7 @@ import (
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/backend/namepath"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/rwutil"
 
@@ -115,7 +117,12 @@ func NewClient(
 	creds := credentials.NewStaticCredentials(
 		auth.S3.AccessKeyID, auth.S3.AccessSecretKey, auth.S3.SessionToken)
 
-	awsConfig := aws.NewConfig().WithRegion(config.Region).WithCredentials(creds)
+	awsConfig := aws.NewConfig().
+		WithRegion(config.Region).
+		WithCredentials(creds).
+		WithHTTPClient(&http.Client{
+			Transport: httputil.NewPooledTransport(config.MaxIdleConnsPerHost),
+		})
 
 	if config.Endpoint != "" {
 		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
@@ -174,6 +181,24 @@ func (c *Client) Stat(namespace, name string) (*core.BlobInfo, error) {
 // Download downloads the content from a configured bucket and writes the
 // data to dst.
 func (c *Client) Download(namespace, name string, dst io.Writer) error {
+	return c.download(name, nil, dst)
+}
+
+// DownloadRange downloads length bytes of name starting at offset from a
+// configured bucket and writes the data to dst.
+func (c *Client) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	if length <= 0 {
+		return nil
+	}
+	rng := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	return c.download(name, aws.String(rng), dst)
+}
+
+// download downloads name, or only the byte range rng of name if rng is set,
+// into dst.
+func (c *Client) download(name string, rng *string, dst io.Writer) error {
 	path, err := c.pather.BlobPath(name)
 	if err != nil {
 		return fmt.Errorf("blob path: %s", err)
@@ -190,6 +215,7 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(c.config.Bucket),
 		Key:    aws.String(path),
+		Range:  rng,
 	}
 	if _, err := c.s3.Download(writerAt, input); err != nil {
 		if isNotFound(err) {
@@ -213,6 +239,11 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	if err != nil {
 		return fmt.Errorf("blob path: %s", err)
 	}
+	if r, ok := src.(backend.SizedReaderAt); ok &&
+		c.config.ResumableUpload && r.Size() > c.config.UploadPartSize {
+
+		return c.uploadResumable(path, r)
+	}
 	input := &s3manager.UploadInput{
 		Bucket: aws.String(c.config.Bucket),
 		Key:    aws.String(path),
@@ -224,6 +255,22 @@ func (c *Client) Upload(namespace, name string, src io.Reader) error {
 	return err
 }
 
+// Delete removes name from the configured bucket.
+func (c *Client) Delete(namespace, name string) error {
+	path, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("blob path: %s", err)
+	}
+	_, err = c.s3.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 func isNotFound(err error) bool {
 	awsErr, ok := err.(awserr.Error)
 	return ok && (awsErr.Code() == s3.ErrCodeNoSuchKey || awsErr.Code() == "NotFound")
@@ -15,6 +15,9 @@ package s3backend
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
 	"testing"
 
 	"github.com/uber-go/tally"
@@ -154,6 +157,30 @@ func TestClientDownloadWithBuffer(t *testing.T) {
 	require.Equal(data, []byte(w))
 }
 
+func TestClientDownloadRange(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	data := randutil.Text(32)
+
+	mocks.s3.EXPECT().Download(
+		mockutil.MatchWriterAt(data),
+		&s3.GetObjectInput{
+			Bucket: aws.String("test-bucket"),
+			Key:    aws.String("/root/test"),
+			Range:  aws.String("bytes=64-95"),
+		},
+	).Return(int64(len(data)), nil)
+
+	w := make(rwutil.PlainWriter, len(data))
+	require.NoError(client.DownloadRange(core.NamespaceFixture(), "test", 64, 32, w))
+	require.Equal(data, []byte(w))
+}
+
 func TestClientUpload(t *testing.T) {
 	require := require.New(t)
 
@@ -176,6 +203,105 @@ func TestClientUpload(t *testing.T) {
 	require.NoError(client.Upload(core.NamespaceFixture(), "test", data))
 }
 
+// uploadPart returns the ETag "etag-<part number>" for any part.
+func uploadPart(in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return &s3.UploadPartOutput{
+		ETag: aws.String(fmt.Sprintf("etag-%d", aws.Int64Value(in.PartNumber))),
+	}, nil
+}
+
+func TestClientUploadResumableCreatesMultipartUpload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.config.ResumableUpload = true
+	mocks.config.UploadPartSize = 16
+	client := mocks.new()
+
+	data := randutil.Text(40)
+
+	mocks.s3.EXPECT().ListMultipartUploads(gomock.Any()).Return(&s3.ListMultipartUploadsOutput{}, nil)
+	mocks.s3.EXPECT().CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil)
+	mocks.s3.EXPECT().UploadPart(gomock.Any()).DoAndReturn(uploadPart).Times(3)
+	mocks.s3.EXPECT().CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("test-bucket"),
+		Key:      aws.String("/root/test"),
+		UploadId: aws.String("upload"),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{
+			{ETag: aws.String("etag-1"), PartNumber: aws.Int64(1)},
+			{ETag: aws.String("etag-2"), PartNumber: aws.Int64(2)},
+			{ETag: aws.String("etag-3"), PartNumber: aws.Int64(3)},
+		}},
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+}
+
+func TestClientUploadResumableReusesUploadedParts(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	mocks.config.ResumableUpload = true
+	mocks.config.UploadPartSize = 16
+	client := mocks.new()
+
+	data := randutil.Text(40)
+	sum := md5.Sum(data[:16])
+	etag := fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+
+	mocks.s3.EXPECT().ListMultipartUploads(gomock.Any()).Return(&s3.ListMultipartUploadsOutput{
+		Uploads: []*s3.MultipartUpload{
+			{Key: aws.String("/root/test/other"), UploadId: aws.String("other")},
+			{Key: aws.String("/root/test"), UploadId: aws.String("upload")},
+		},
+	}, nil)
+	mocks.s3.EXPECT().ListPartsPages(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(in *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool) error {
+			require.Equal("upload", aws.StringValue(in.UploadId))
+			fn(&s3.ListPartsOutput{Parts: []*s3.Part{
+				{PartNumber: aws.Int64(1), ETag: aws.String(etag), Size: aws.Int64(16)},
+				{PartNumber: aws.Int64(2), ETag: aws.String("\"corrupt\""), Size: aws.Int64(16)},
+			}}, true)
+			return nil
+		})
+	mocks.s3.EXPECT().UploadPart(gomock.Any()).DoAndReturn(uploadPart).Times(2)
+	mocks.s3.EXPECT().CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("test-bucket"),
+		Key:      aws.String("/root/test"),
+		UploadId: aws.String("upload"),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{
+			{ETag: aws.String(etag), PartNumber: aws.Int64(1)},
+			{ETag: aws.String("etag-2"), PartNumber: aws.Int64(2)},
+			{ETag: aws.String("etag-3"), PartNumber: aws.Int64(3)},
+		}},
+	}).Return(&s3.CompleteMultipartUploadOutput{}, nil)
+
+	require.NoError(client.Upload(core.NamespaceFixture(), "test", bytes.NewReader(data)))
+}
+
+func TestClientDelete(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newClientMocks(t)
+	defer cleanup()
+
+	client := mocks.new()
+
+	mocks.s3.EXPECT().DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("/root/test"),
+	}).Return(&s3.DeleteObjectOutput{}, nil)
+
+	require.NoError(client.Delete(core.NamespaceFixture(), "test"))
+}
+
 func TestClientList(t *testing.T) {
 	require := require.New(t)
 
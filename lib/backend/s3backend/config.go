@@ -36,6 +36,17 @@ type Config struct {
 	UploadConcurrency   int `yaml:"upload_concurrency"`   // # of concurrent go-routines s3 manager uses for upload
 	DownloadConcurrency int `yaml:"download_concurrency"` // # of concurrent go-routines s3 manager uses for download
 
+	// ResumableUpload uploads sources larger than UploadPartSize which support
+	// random access, such as cache files, as multipart uploads which are kept
+	// on failure. Retries resume the interrupted upload, reusing parts which
+	// were already uploaded intact. Requires permission to list multipart
+	// uploads and their parts.
+	ResumableUpload bool `yaml:"resumable_upload"`
+
+	// MaxIdleConnsPerHost limits the idle connections kept to S3 for reuse by
+	// subsequent requests.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+
 	// ListMaxKeys sets the max keys returned per page.
 	ListMaxKeys int `yaml:"list_max_keys"`
 
@@ -79,4 +90,7 @@ func (c *Config) applyDefaults() {
 	if c.ListMaxKeys == 0 {
 		c.ListMaxKeys = backend.DefaultListMaxKeys
 	}
+	if c.MaxIdleConnsPerHost == 0 {
+		c.MaxIdleConnsPerHost = backend.DefaultMaxIdleConnsPerHost
+	}
 }
@@ -0,0 +1,167 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package s3backend
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// _maxParts is the maximum number of parts of an S3 multipart upload.
+const _maxParts = 10000
+
+type uploadedPart struct {
+	etag string
+	size int64
+}
+
+// uploadResumable uploads src to key in parts of UploadPartSize, with
+// UploadConcurrency parts in flight. If a previous multipart upload of key was
+// interrupted, it is resumed, and parts whose size and MD5 match src are not
+// uploaded again. On failure, the multipart upload is left for the next
+// attempt to resume. Abandoned multipart uploads should be expired with a
+// bucket lifecycle rule.
+func (c *Client) uploadResumable(key string, src backend.SizedReaderAt) error {
+	partSize := c.config.UploadPartSize
+	if n := (src.Size() + partSize - 1) / partSize; n > _maxParts {
+		partSize = (src.Size() + _maxParts - 1) / _maxParts
+	}
+
+	uploadID, uploaded, err := c.findMultipartUpload(key)
+	if err != nil {
+		return fmt.Errorf("find multipart upload: %s", err)
+	}
+	if uploadID == "" {
+		out, err := c.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(c.config.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("create multipart upload: %s", err)
+		}
+		uploadID = aws.StringValue(out.UploadId)
+	} else {
+		log.With("key", key, "upload_id", uploadID).Infof(
+			"Resuming multipart upload with %d uploaded parts", len(uploaded))
+	}
+
+	parts := backend.SplitParts(src.Size(), partSize)
+	completed := make([]*s3.CompletedPart, len(parts))
+	err = backend.UploadParts(parts, c.config.UploadConcurrency, func(p backend.Part) error {
+		h := md5.New()
+		if _, err := io.Copy(h, p.Reader(src)); err != nil {
+			return fmt.Errorf("read part %d: %s", p.Number, err)
+		}
+		sum := h.Sum(nil)
+		etag := fmt.Sprintf("%q", hex.EncodeToString(sum))
+
+		if u, ok := uploaded[int64(p.Number)]; ok && u.size == p.Size && u.etag == etag {
+			c.stats.Counter("upload_parts_reused").Inc(1)
+		} else {
+			out, err := c.s3.UploadPart(&s3.UploadPartInput{
+				Bucket:        aws.String(c.config.Bucket),
+				Key:           aws.String(key),
+				UploadId:      aws.String(uploadID),
+				PartNumber:    aws.Int64(int64(p.Number)),
+				Body:          p.Reader(src),
+				ContentLength: aws.Int64(p.Size),
+				ContentMD5:    aws.String(base64.StdEncoding.EncodeToString(sum)),
+			})
+			if err != nil {
+				return fmt.Errorf("upload part %d: %s", p.Number, err)
+			}
+			etag = aws.StringValue(out.ETag)
+			c.stats.Counter("upload_parts").Inc(1)
+		}
+		completed[p.Number-1] = &s3.CompletedPart{
+			ETag:       aws.String(etag),
+			PartNumber: aws.Int64(int64(p.Number)),
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(c.config.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %s", err)
+	}
+	return nil
+}
+
+// findMultipartUpload returns the id and uploaded parts of the most recently
+// initiated multipart upload of key which is still in progress. Returns an
+// empty id if there is none.
+func (c *Client) findMultipartUpload(key string) (string, map[int64]uploadedPart, error) {
+	out, err := c.s3.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(c.config.Bucket),
+		Prefix: aws.String(key),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("list multipart uploads: %s", err)
+	}
+	var uploads []*s3.MultipartUpload
+	for _, u := range out.Uploads {
+		if aws.StringValue(u.Key) == key {
+			uploads = append(uploads, u)
+		}
+	}
+	if len(uploads) == 0 {
+		return "", nil, nil
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return aws.TimeValue(uploads[i].Initiated).After(aws.TimeValue(uploads[j].Initiated))
+	})
+	uploadID := aws.StringValue(uploads[0].UploadId)
+
+	uploaded := make(map[int64]uploadedPart)
+	err = c.s3.ListPartsPages(&s3.ListPartsInput{
+		Bucket:   aws.String(c.config.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(page *s3.ListPartsOutput, last bool) bool {
+		for _, p := range page.Parts {
+			uploaded[aws.Int64Value(p.PartNumber)] = uploadedPart{
+				etag: aws.StringValue(p.ETag),
+				size: aws.Int64Value(p.Size),
+			}
+		}
+		return true
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchUpload {
+			// The upload was completed or aborted in the meantime.
+			return "", nil, nil
+		}
+		return "", nil, fmt.Errorf("list parts: %s", err)
+	}
+	return uploadID, uploaded, nil
+}
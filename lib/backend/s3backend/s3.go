@@ -35,6 +35,21 @@ type S3 interface {
 		options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
 
 	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+
+	CreateMultipartUpload(
+		input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+
+	UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+
+	CompleteMultipartUpload(
+		input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+
+	ListMultipartUploads(
+		input *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error)
+
+	ListPartsPages(input *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool) error
 }
 
 type join struct {
@@ -261,6 +261,15 @@ func (c *Client) Upload(namespace string, name string, src io.Reader) error {
 	return nil
 }
 
+// Delete removes the data from both backends.
+func (c *Client) Delete(namespace string, name string) error {
+	// delete from both, fail if delete fails for any
+	if err := c.active.Delete(namespace, name); err != nil {
+		return err
+	}
+	return c.shadow.Delete(namespace, name)
+}
+
 // List lists names with start with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	res, err := c.active.List(prefix, opts...)
@@ -223,6 +223,24 @@ func (c *Client) Upload(_, name string, src io.Reader) error {
 	return nil
 }
 
+// Delete removes the tag from the database.
+func (c *Client) Delete(_, name string) error {
+	repo, tag, err := decomposeDockerTag(name)
+	if err != nil {
+		return fmt.Errorf("tag path: %s. Err was %s", name, err)
+	}
+
+	res := c.db.
+		Where(Tag{Repository: repo, Tag: tag}).
+		Delete(Tag{})
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	return nil
+}
+
 // List lists names with start with prefix.
 func (c *Client) List(prefix string, _ ...backend.ListOption) (*backend.ListResult, error) {
 
@@ -134,6 +134,17 @@ func (c *Client) Download(namespace, name string, dst io.Writer) error {
 	return nil
 }
 
+// Delete removes name.
+func (c *Client) Delete(namespace, name string) error {
+	p, err := c.pather.BlobPath(name)
+	if err != nil {
+		return fmt.Errorf("pather: %s", err)
+	}
+	_, err = httputil.Delete(
+		fmt.Sprintf("http://%s/files/%s", c.config.Addr, p))
+	return err
+}
+
 // List lists names starting with prefix.
 func (c *Client) List(prefix string, opts ...backend.ListOption) (*backend.ListResult, error) {
 	options := backend.DefaultListOptions()
@@ -53,6 +53,13 @@ func TestServerBlob(t *testing.T) {
 	info, err := c.Stat(ns, blob.Digest.Hex())
 	require.NoError(err)
 	require.Equal(int64(len(blob.Content)), info.Size)
+
+	require.NoError(c.Delete(ns, blob.Digest.Hex()))
+	_, err = c.Stat(ns, blob.Digest.Hex())
+	require.Equal(backenderrors.ErrBlobNotFound, err)
+
+	// Deleting a missing blob is not an error.
+	require.NoError(c.Delete(ns, blob.Digest.Hex()))
 }
 
 func TestServerTag(t *testing.T) {
@@ -65,6 +65,22 @@ func (c *ThrottledClient) Download(namespace, name string, dst io.Writer) error
 	return c.Client.Download(namespace, name, dst)
 }
 
+// DownloadRange downloads length bytes of name starting at offset into dst.
+// The wrapped client must implement RangeDownloader.
+func (c *ThrottledClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	r, ok := GetRangeDownloader(c.Client)
+	if !ok {
+		return errRangeUnsupported
+	}
+	if err := c.bandwidth.ReserveIngress(length); err != nil {
+		log.With("name", name).Errorf("Error reserving ingress: %s", err)
+		// Ignore error.
+	}
+	return r.DownloadRange(namespace, name, offset, length, dst)
+}
+
 func (c *ThrottledClient) adjustBandwidth(denominator int) error {
 	return c.bandwidth.Adjust(denominator)
 }
@@ -13,11 +13,69 @@
 // limitations under the License.
 package blobrefresh
 
-import "github.com/c2h5oh/datasize"
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/c2h5oh/datasize"
+)
 
 // Config defines Refresher configuration.
 type Config struct {
 	// Limits the size of blobs which origin will accept. A 0 size limit means
 	// blob size is unbounded.
 	SizeLimit datasize.ByteSize `yaml:"size_limit"`
+
+	// ParallelDownloads downloads large blobs of matching namespaces in
+	// concurrent byte ranges, for backends which support ranged downloads.
+	// The first matching rule applies.
+	ParallelDownloads []ParallelDownloadConfig `yaml:"parallel_downloads"`
+}
+
+// ParallelDownloadConfig defines ranged downloads for namespaces matching a
+// regular expression.
+type ParallelDownloadConfig struct {
+	Namespace string `yaml:"namespace"`
+
+	// MinSize is the smallest blob downloaded in parts. Smaller blobs are
+	// downloaded in a single stream.
+	MinSize datasize.ByteSize `yaml:"min_size"`
+
+	// PartSize is the length of each downloaded byte range.
+	PartSize datasize.ByteSize `yaml:"part_size"`
+
+	// Concurrency is the maximum number of parts downloaded at once.
+	Concurrency int `yaml:"concurrency"`
+}
+
+func (c ParallelDownloadConfig) applyDefaults() ParallelDownloadConfig {
+	if c.MinSize == 0 {
+		c.MinSize = datasize.GB
+	}
+	if c.PartSize == 0 {
+		c.PartSize = 64 * datasize.MB
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = 8
+	}
+	return c
+}
+
+type parallelDownloadPolicy struct {
+	namespace *regexp.Regexp
+	config    ParallelDownloadConfig
+}
+
+func newParallelDownloadPolicies(
+	configs []ParallelDownloadConfig) ([]parallelDownloadPolicy, error) {
+
+	var policies []parallelDownloadPolicy
+	for _, c := range configs {
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %s", c.Namespace, err)
+		}
+		policies = append(policies, parallelDownloadPolicy{re, c.applyDefaults()})
+	}
+	return policies, nil
 }
@@ -14,21 +14,28 @@
 package blobrefresh
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/dedup"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/c2h5oh/datasize"
 	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Refresher errors.
@@ -38,6 +45,28 @@ var (
 	ErrWorkersBusy = errors.New("no workers available")
 )
 
+// SwarmFetchFlag is the feature flag which enables downloading blobs from the
+// peer swarm per namespace.
+const SwarmFetchFlag = "swarm_fetch"
+
+// SwarmFetcher downloads blobs from the peer swarm of agents, which is cheaper
+// than downloading them from the backend when agents already hold the data.
+type SwarmFetcher interface {
+	// Fetch downloads d into the cache of the Refresher's CAStore. Fetch
+	// should return an error quickly if the swarm of d has no seeders, and
+	// must give up within a bounded time.
+	Fetch(namespace string, d core.Digest) error
+}
+
+// Option allows setting optional Refresher parameters.
+type Option func(*Refresher)
+
+// WithSwarmFetcher configures the Refresher to download blobs from the peer
+// swarm before falling back to the backend.
+func WithSwarmFetcher(f SwarmFetcher) Option {
+	return func(r *Refresher) { r.swarm = f }
+}
+
 // PostHook runs after the blob has been downloaded within the context of the
 // deduplicated request.
 type PostHook interface {
@@ -54,6 +83,8 @@ type Refresher struct {
 	cas               *store.CAStore
 	backends          *backend.Manager
 	metaInfoGenerator *metainfogen.Generator
+	parallel          []parallelDownloadPolicy
+	swarm             SwarmFetcher
 }
 
 // New creates a new Refresher.
@@ -62,7 +93,13 @@ func New(
 	stats tally.Scope,
 	cas *store.CAStore,
 	backends *backend.Manager,
-	metaInfoGenerator *metainfogen.Generator) *Refresher {
+	metaInfoGenerator *metainfogen.Generator,
+	opts ...Option) (*Refresher, error) {
+
+	parallel, err := newParallelDownloadPolicies(config.ParallelDownloads)
+	if err != nil {
+		return nil, fmt.Errorf("parallel downloads config: %s", err)
+	}
 
 	stats = stats.Tagged(map[string]string{
 		"module": "blobrefresh",
@@ -71,15 +108,30 @@ func New(
 	requests := dedup.NewRequestCache(dedup.RequestCacheConfig{}, clock.New())
 	requests.SetNotFound(func(err error) bool { return err == backenderrors.ErrBlobNotFound })
 
-	return &Refresher{config, stats, requests, cas, backends, metaInfoGenerator}
+	r := &Refresher{
+		config:            config,
+		stats:             stats,
+		requests:          requests,
+		cas:               cas,
+		backends:          backends,
+		metaInfoGenerator: metaInfoGenerator,
+		parallel:          parallel,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
 }
 
 // Refresh kicks off a background goroutine to download the blob for d from the
 // remote backend configured for namespace and generates metainfo for the blob.
 // Returns ErrPending if an existing download for the blob is already running.
 // Returns ErrNotFound if the blob is not found. Returns ErrWorkersBusy if no
-// goroutines are available to run the download.
-func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook) error {
+// goroutines are available to run the download. The download is traced as a
+// child of the span in ctx, but is not cancelled by ctx.
+func (r *Refresher) Refresh(
+	ctx context.Context, namespace string, d core.Digest, hooks ...PostHook) error {
+
 	client, err := r.backends.GetClient(namespace)
 	if err != nil {
 		return fmt.Errorf("backend manager: %s", err)
@@ -88,7 +140,7 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 	// Always check whether the blob is actually available and valid before
 	// returning a potential pending error. This ensures that the majority of
 	// errors are propogated quickly and syncronously.
-	info, err := client.Stat(namespace, d.Hex())
+	info, err := client.Stat(namespace, d.Name())
 	if err != nil {
 		if err == backenderrors.ErrBlobNotFound {
 			return ErrNotFound
@@ -100,20 +152,38 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 		return fmt.Errorf("%s blob exceeds size limit of %s", size, r.config.SizeLimit)
 	}
 
-	id := namespace + ":" + d.Hex()
-	err = r.requests.Start(id, func() error {
+	id := namespace + ":" + d.Name()
+	parent := tracing.Detach(ctx)
+	err = r.requests.Start(id, func() (err error) {
+		ctx, span := tracing.Tracer().Start(parent, "blobrefresh.refresh",
+			trace.WithAttributes(
+				attribute.String("namespace", namespace),
+				attribute.String("digest", d.String()),
+				attribute.Int64("size", info.Size)))
+		defer func() { tracing.EndSpan(span, err) }()
+
 		start := time.Now()
-		if err := r.download(client, namespace, d); err != nil {
-			return err
+		if r.fetchFromSwarm(ctx, namespace, d) {
+			t := time.Since(start)
+			r.stats.Timer("download_swarm_blob").Record(t)
+			log.With(
+				"namespace", namespace,
+				"name", d.Name(),
+				"download_time", t).Info("Downloaded blob from peer swarm")
+		} else {
+			start = time.Now()
+			if err := r.download(ctx, client, namespace, d, info.Size); err != nil {
+				return err
+			}
+			t := time.Since(start)
+			r.stats.Timer("download_remote_blob").Record(t)
+			log.With(
+				"namespace", namespace,
+				"name", d.Name(),
+				"download_time", t).Info("Downloaded remote blob")
 		}
-		t := time.Since(start)
-		r.stats.Timer("download_remote_blob").Record(t)
-		log.With(
-			"namespace", namespace,
-			"name", d.Hex(),
-			"download_time", t).Info("Downloaded remote blob")
-
-		if err := r.metaInfoGenerator.Generate(d); err != nil {
+
+		if err := r.metaInfoGenerator.Generate(namespace, d); err != nil {
 			return fmt.Errorf("generate metainfo: %s", err)
 		}
 		r.stats.Counter("downloads").Inc(1)
@@ -134,9 +204,133 @@ func (r *Refresher) Refresh(namespace string, d core.Digest, hooks ...PostHook)
 	}
 }
 
-func (r *Refresher) download(client backend.Client, namespace string, d core.Digest) error {
-	name := d.Hex()
+// fetchFromSwarm attempts to download d from the peer swarm into the cache.
+// Returns false if the blob must be downloaded from the backend instead.
+func (r *Refresher) fetchFromSwarm(ctx context.Context, namespace string, d core.Digest) bool {
+	if r.swarm == nil || !featureflag.EnabledFor(SwarmFetchFlag, namespace) {
+		return false
+	}
+	_, span := tracing.Tracer().Start(ctx, "swarm.download",
+		trace.WithAttributes(
+			attribute.String("namespace", namespace),
+			attribute.String("digest", d.String())))
+
+	err := r.swarm.Fetch(namespace, d)
+	tracing.EndSpan(span, err)
+	if err != nil {
+		log.With("namespace", namespace, "name", d.Name()).Infof(
+			"Falling back to backend download: swarm fetch: %s", err)
+		r.stats.Counter("swarm_fallbacks").Inc(1)
+		return false
+	}
+	r.stats.Counter("swarm_downloads").Inc(1)
+	return true
+}
+
+func (r *Refresher) download(
+	ctx context.Context,
+	client backend.Client,
+	namespace string,
+	d core.Digest,
+	size int64) (err error) {
+
+	_, span := tracing.Tracer().Start(ctx, "backend.download",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("namespace", namespace),
+			attribute.String("digest", d.String())))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	name := d.Name()
+	if c, ok := r.parallelDownloadConfig(namespace, size); ok {
+		if rd, ok := backend.GetRangeDownloader(client); ok {
+			span.SetAttributes(attribute.Bool("parallel", true))
+			return r.cas.WriteCacheFile(name, func(w store.FileReadWriter) error {
+				return r.downloadParts(rd, namespace, name, size, c, w)
+			})
+		}
+	}
 	return r.cas.WriteCacheFile(name, func(w store.FileReadWriter) error {
 		return client.Download(namespace, name, w)
 	})
 }
+
+// parallelDownloadConfig returns the ranged download config for a blob of
+// size in namespace, if the blob should be downloaded in parts.
+func (r *Refresher) parallelDownloadConfig(
+	namespace string, size int64) (ParallelDownloadConfig, bool) {
+
+	for _, p := range r.parallel {
+		if p.namespace.MatchString(namespace) {
+			return p.config, size >= int64(p.config.MinSize)
+		}
+	}
+	return ParallelDownloadConfig{}, false
+}
+
+// downloadParts downloads name in concurrent byte ranges into w. Each part
+// must be exactly as long as requested. The digest of the assembled file is
+// verified when it is moved into the cache.
+func (r *Refresher) downloadParts(
+	rd backend.RangeDownloader,
+	namespace, name string,
+	size int64,
+	c ParallelDownloadConfig,
+	w io.WriterAt) error {
+
+	parts := backend.SplitParts(size, int64(c.PartSize))
+	err := backend.UploadParts(parts, c.Concurrency, func(p backend.Part) error {
+		pw := &partWriter{w: w, offset: p.Offset, size: p.Size}
+		if err := rd.DownloadRange(namespace, name, p.Offset, p.Size, pw); err != nil {
+			return fmt.Errorf("part %d: %s", p.Number, err)
+		}
+		if pw.n != p.Size {
+			return fmt.Errorf("part %d: downloaded %d bytes, expected %d", p.Number, pw.n, p.Size)
+		}
+		r.stats.Counter("download_parts").Inc(1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.stats.Counter("parallel_downloads").Inc(1)
+	return nil
+}
+
+// partWriter writes a single part of a blob at its offset in w. Sequential
+// writes are appended to the part, and WriteAt offsets are relative to the
+// start of the part, so backends can write ranges concurrently.
+type partWriter struct {
+	w      io.WriterAt
+	offset int64
+	size   int64
+
+	mu  sync.Mutex
+	pos int64
+	n   int64
+}
+
+func (p *partWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, err := p.writeAt(b, p.pos)
+	p.pos += int64(n)
+	return n, err
+}
+
+func (p *partWriter) WriteAt(b []byte, off int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.writeAt(b, off)
+}
+
+func (p *partWriter) writeAt(b []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(b)) > p.size {
+		return 0, fmt.Errorf("write of %d bytes at %d exceeds part size %d", len(b), off, p.size)
+	}
+	n, err := p.w.WriteAt(b, p.offset+off)
+	p.n += int64(n)
+	return n, err
+}
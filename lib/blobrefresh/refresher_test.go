@@ -14,6 +14,10 @@
 package blobrefresh
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -21,6 +25,7 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
@@ -31,6 +36,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 )
 
 const _testPieceLength = 10
@@ -58,7 +64,11 @@ func newRefresherMocks(t *testing.T) (*refresherMocks, func()) {
 }
 
 func (m *refresherMocks) new() *Refresher {
-	return New(m.config, tally.NoopScope, m.cas, m.backends, metainfogen.Fixture(m.cas, _testPieceLength))
+	r, err := New(m.config, tally.NoopScope, m.cas, m.backends, metainfogen.Fixture(m.cas, _testPieceLength))
+	if err != nil {
+		panic(err)
+	}
+	return r
 }
 
 func (m *refresherMocks) newClient(namespace string) *mockbackend.MockClient {
@@ -83,7 +93,7 @@ func TestRefresh(t *testing.T) {
 	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
 	client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
 
-	require.NoError(refresher.Refresh(namespace, blob.Digest))
+	require.NoError(refresher.Refresh(context.Background(), namespace, blob.Digest))
 
 	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
 		_, err := mocks.cas.GetCacheFileStat(blob.Digest.Hex())
@@ -117,7 +127,7 @@ func TestRefreshSizeLimitError(t *testing.T) {
 
 	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
 
-	require.Error(refresher.Refresh(namespace, blob.Digest))
+	require.Error(refresher.Refresh(context.Background(), namespace, blob.Digest))
 }
 
 func TestRefreshSizeLimitWithValidSize(t *testing.T) {
@@ -138,10 +148,276 @@ func TestRefreshSizeLimitWithValidSize(t *testing.T) {
 	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
 	client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
 
-	require.NoError(refresher.Refresh(namespace, blob.Digest))
+	require.NoError(refresher.Refresh(context.Background(), namespace, blob.Digest))
 
 	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
 		_, err := mocks.cas.GetCacheFileStat(blob.Digest.Hex())
 		return !os.IsNotExist(err)
 	}))
 }
+
+// rangeClient serves ranged downloads of content.
+type rangeClient struct {
+	*mockbackend.MockClient
+	content []byte
+	short   bool
+	parts   atomic.Int32
+}
+
+func (c *rangeClient) DownloadRange(
+	namespace, name string, offset, length int64, dst io.Writer) error {
+
+	c.parts.Inc()
+	b := c.content[offset : offset+length]
+	if c.short {
+		b = b[:len(b)-1]
+	}
+	_, err := dst.Write(b)
+	return err
+}
+
+func (m *refresherMocks) newRangeClient(namespace string, content []byte) *rangeClient {
+	client := &rangeClient{MockClient: mockbackend.NewMockClient(m.ctrl), content: content}
+	m.backends.Register(namespace, client, false)
+	return client
+}
+
+func TestRefreshParallelDownload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.ParallelDownloads = []ParallelDownloadConfig{{
+		Namespace:   ".*",
+		MinSize:     50,
+		PartSize:    16,
+		Concurrency: 3,
+	}}
+
+	refresher := mocks.new()
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+	client := mocks.newRangeClient(namespace, blob.Content)
+
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+
+	require.NoError(refresher.Refresh(context.Background(), namespace, blob.Digest))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		_, err := mocks.cas.GetCacheFileStat(blob.Digest.Hex())
+		return !os.IsNotExist(err)
+	}))
+
+	f, err := mocks.cas.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	result, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(string(blob.Content), string(result))
+	require.Equal(int32(7), client.parts.Load())
+}
+
+func TestRefreshParallelDownloadBelowMinSize(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.ParallelDownloads = []ParallelDownloadConfig{{
+		Namespace: ".*",
+		MinSize:   101,
+		PartSize:  16,
+	}}
+
+	refresher := mocks.new()
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+	client := mocks.newRangeClient(namespace, blob.Content)
+
+	client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	require.NoError(refresher.download(
+		context.Background(), client, namespace, blob.Digest, int64(len(blob.Content))))
+	require.Equal(int32(0), client.parts.Load())
+}
+
+func TestRefreshParallelDownloadUnsupportedBackend(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.ParallelDownloads = []ParallelDownloadConfig{{Namespace: ".*", MinSize: 1}}
+
+	refresher := mocks.new()
+
+	namespace := core.TagFixture()
+	client := mocks.newClient(namespace)
+
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+
+	client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	require.NoError(refresher.download(
+		context.Background(), client, namespace, blob.Digest, int64(len(blob.Content))))
+}
+
+func TestRefreshParallelDownloadShortPartError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.ParallelDownloads = []ParallelDownloadConfig{{
+		Namespace: ".*",
+		MinSize:   1,
+		PartSize:  16,
+	}}
+
+	refresher := mocks.new()
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+	client := mocks.newRangeClient(namespace, blob.Content)
+	client.short = true
+
+	err := refresher.download(
+		context.Background(), client, namespace, blob.Digest, int64(len(blob.Content)))
+	require.Error(err)
+	require.Contains(err.Error(), "bytes, expected")
+
+	_, err = mocks.cas.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestNewInvalidParallelDownloadNamespace(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	mocks.config.ParallelDownloads = []ParallelDownloadConfig{{Namespace: "("}}
+
+	_, err := New(
+		mocks.config, tally.NoopScope, mocks.cas, mocks.backends, metainfogen.Fixture(mocks.cas, _testPieceLength))
+	require.Error(err)
+}
+
+// fakeSwarmFetcher writes content from the peer swarm into cas, or fails with
+// err.
+type fakeSwarmFetcher struct {
+	cas     *store.CAStore
+	content []byte
+	err     error
+}
+
+func (f fakeSwarmFetcher) Fetch(namespace string, d core.Digest) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.cas.CreateCacheFile(d.Hex(), bytes.NewReader(f.content))
+}
+
+func TestRefreshFromSwarm(t *testing.T) {
+	require := require.New(t)
+
+	featureflag.Global().Override(SwarmFetchFlag, true)
+	defer featureflag.Global().ClearOverride(SwarmFetchFlag)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+
+	refresher, err := New(
+		mocks.config, tally.NoopScope, mocks.cas, mocks.backends, metainfogen.Fixture(mocks.cas, _testPieceLength),
+		WithSwarmFetcher(fakeSwarmFetcher{cas: mocks.cas, content: blob.Content}))
+	require.NoError(err)
+
+	namespace := core.TagFixture()
+	client := mocks.newClient(namespace)
+
+	// The backend is only used to check the blob exists.
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+
+	require.NoError(refresher.Refresh(context.Background(), namespace, blob.Digest))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		var tm metadata.TorrentMeta
+		return mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm) == nil
+	}))
+
+	f, err := mocks.cas.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	result, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(string(blob.Content), string(result))
+}
+
+func TestRefreshSkipsSwarmUnlessFlagEnabled(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newRefresherMocks(t)
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+
+	refresher, err := New(
+		mocks.config, tally.NoopScope, mocks.cas, mocks.backends, metainfogen.Fixture(mocks.cas, _testPieceLength),
+		WithSwarmFetcher(fakeSwarmFetcher{err: errors.New("swarm fetch not expected")}))
+	require.NoError(err)
+
+	namespace := core.TagFixture()
+	client := mocks.newClient(namespace)
+
+	client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+	client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+	require.NoError(refresher.Refresh(context.Background(), namespace, blob.Digest))
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		var tm metadata.TorrentMeta
+		return mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm) == nil
+	}))
+}
+
+func TestRefreshFallsBackToBackendWhenSwarmFails(t *testing.T) {
+	featureflag.Global().Override(SwarmFetchFlag, true)
+	defer featureflag.Global().ClearOverride(SwarmFetchFlag)
+
+	for _, swarm := range []fakeSwarmFetcher{
+		{err: errors.New("no seeders")},
+		// Corrupt swarm downloads are rejected by digest verification.
+		{content: []byte("corrupt")},
+	} {
+		t.Run("", func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newRefresherMocks(t)
+			defer cleanup()
+
+			blob := core.SizedBlobFixture(100, uint64(_testPieceLength))
+
+			swarm.cas = mocks.cas
+			refresher, err := New(
+				mocks.config, tally.NoopScope, mocks.cas, mocks.backends,
+				metainfogen.Fixture(mocks.cas, _testPieceLength), WithSwarmFetcher(swarm))
+			require.NoError(err)
+
+			namespace := core.TagFixture()
+			client := mocks.newClient(namespace)
+
+			client.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil)
+			client.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
+
+			require.NoError(refresher.Refresh(context.Background(), namespace, blob.Digest))
+
+			require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+				var tm metadata.TorrentMeta
+				return mocks.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm) == nil
+			}))
+		})
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package buildinfo describes the build of the running binary and the
+// protocol capabilities it provides and requires, such that mixed-version
+// clusters can be checked for incompatible components.
+package buildinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+)
+
+// Version and GitSHA are set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/uber/kraken/lib/buildinfo.Version=v0.1.4"
+var (
+	Version = "unknown"
+	GitSHA  = "unknown"
+)
+
+// Components.
+const (
+	Agent      = "agent"
+	Origin     = "origin"
+	Tracker    = "tracker"
+	BuildIndex = "build-index"
+	Proxy      = "proxy"
+)
+
+// Protocol capabilities served by one component to another.
+const (
+	// P2P is the peer to peer wire protocol between agents and origins.
+	P2P = "p2p"
+
+	// Announce is the tracker announce API.
+	Announce = "announce"
+
+	// Metainfo is the tracker metainfo API.
+	Metainfo = "metainfo"
+
+	// Blob is the origin blob API.
+	Blob = "blob"
+
+	// Tags is the build-index tag API.
+	Tags = "tags"
+)
+
+type capabilities struct {
+	provides map[string]int
+	requires map[string]int
+}
+
+// _matrix declares which capability versions each component provides and
+// requires. When a protocol changes in a way older peers cannot handle, bump
+// the provided version of the capability, and bump the required version on
+// the components which depend on the change.
+var _matrix = map[string]capabilities{
+	Agent: {
+		provides: map[string]int{P2P: 1},
+		requires: map[string]int{P2P: 1, Announce: 2, Metainfo: 1, Tags: 1},
+	},
+	Origin: {
+		provides: map[string]int{P2P: 1, Blob: 1},
+		requires: map[string]int{P2P: 1, Announce: 2, Blob: 1},
+	},
+	Tracker: {
+		provides: map[string]int{Announce: 2, Metainfo: 1},
+		requires: map[string]int{Blob: 1},
+	},
+	BuildIndex: {
+		provides: map[string]int{Tags: 1},
+		requires: map[string]int{Blob: 1, Tags: 1},
+	},
+	Proxy: {
+		requires: map[string]int{Blob: 1, Tags: 1},
+	},
+}
+
+// Info describes the build of a component.
+type Info struct {
+	Component string         `json:"component"`
+	Version   string         `json:"version"`
+	GitSHA    string         `json:"git_sha"`
+	GoVersion string         `json:"go_version"`
+	Provides  map[string]int `json:"provides"`
+	Requires  map[string]int `json:"requires"`
+}
+
+// Get returns the Info of the running binary, which runs component.
+func Get(component string) Info {
+	c := _matrix[component]
+	return Info{
+		Component: component,
+		Version:   Version,
+		GitSHA:    GitSHA,
+		GoVersion: runtime.Version(),
+		Provides:  c.provides,
+		Requires:  c.requires,
+	}
+}
+
+// Handler returns an http handler which serves the Info of component as json.
+func Handler(component string) http.HandlerFunc {
+	info := Get(component)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// Incompatibility is a client which requires a newer version of a capability
+// than a server provides.
+type Incompatibility struct {
+	Client     string
+	Server     string
+	Capability string
+	Required   int
+	Provided   int
+}
+
+func (i Incompatibility) String() string {
+	return fmt.Sprintf(
+		"%s requires %s v%d but %s only provides v%d",
+		i.Client, i.Capability, i.Required, i.Server, i.Provided)
+}
+
+// Check returns every pair of instances in infos, keyed by an arbitrary
+// instance label, where one requires a newer capability version than the
+// other provides. Instances which do not provide a capability at all are not
+// considered servers of that capability.
+func Check(infos map[string]Info) []Incompatibility {
+	var labels []string
+	for label := range infos {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	var result []Incompatibility
+	for _, client := range labels {
+		var caps []string
+		for c := range infos[client].Requires {
+			caps = append(caps, c)
+		}
+		sort.Strings(caps)
+
+		for _, c := range caps {
+			required := infos[client].Requires[c]
+			for _, server := range labels {
+				provided, ok := infos[server].Provides[c]
+				if !ok || provided >= required {
+					continue
+				}
+				result = append(result, Incompatibility{
+					Client:     client,
+					Server:     server,
+					Capability: c,
+					Required:   required,
+					Provided:   provided,
+				})
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	require := require.New(t)
+
+	w := httptest.NewRecorder()
+	Handler(Tracker).ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+
+	require.Equal(http.StatusOK, w.Code)
+	var info Info
+	require.NoError(json.NewDecoder(w.Body).Decode(&info))
+	require.Equal(Get(Tracker), info)
+	require.Equal(Tracker, info.Component)
+	require.Equal(Version, info.Version)
+	require.NotEmpty(info.Provides)
+}
+
+func TestCheckCurrentBuildIsCompatible(t *testing.T) {
+	infos := make(map[string]Info)
+	for component := range _matrix {
+		infos[component] = Get(component)
+	}
+	require.Empty(t, Check(infos))
+}
+
+func TestCheckFlagsIncompatibleComponents(t *testing.T) {
+	require := require.New(t)
+
+	oldTracker := Get(Tracker)
+	oldTracker.Provides = map[string]int{Announce: 1, Metainfo: 1}
+
+	infos := map[string]Info{
+		"agent a":   Get(Agent),
+		"tracker b": oldTracker,
+		"tracker c": Get(Tracker),
+	}
+
+	require.Equal([]Incompatibility{{
+		Client:     "agent a",
+		Server:     "tracker b",
+		Capability: Announce,
+		Required:   2,
+		Provided:   1,
+	}}, Check(infos))
+}
+
+func TestCheckIgnoresComponentsNotProvidingCapability(t *testing.T) {
+	infos := map[string]Info{
+		"agent a":   Get(Agent),
+		"proxy b":   Get(Proxy),
+		"origin c":  Get(Origin),
+		"unknown d": {},
+	}
+	require.Empty(t, Check(infos))
+}
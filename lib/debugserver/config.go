@@ -0,0 +1,40 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import "time"
+
+// Config defines the debug listener configuration.
+type Config struct {
+	// Addr is the address of the debug listener, which serves pprof and
+	// expvar endpoints. It must be a loopback address, e.g. localhost:15006.
+	// If empty, debug endpoints are not served.
+	Addr string `yaml:"addr"`
+
+	// Username and Password enable basic auth on all debug endpoints if
+	// Password is set.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// WatermarkInterval is the interval in which goroutine, file descriptor
+	// and heap usage is sampled and emitted.
+	WatermarkInterval time.Duration `yaml:"watermark_interval"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.WatermarkInterval == 0 {
+		c.WatermarkInterval = 10 * time.Second
+	}
+	return c
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// Server serves debugging endpoints, such as pprof and expvar, on a dedicated
+// listener which is only reachable from the local host. These endpoints must
+// never be mounted on public service ports.
+type Server struct {
+	config     Config
+	stats      tally.Scope
+	watermarks *watermarks
+}
+
+// New creates a new Server.
+func New(config Config, stats tally.Scope) (*Server, error) {
+	config = config.applyDefaults()
+
+	if config.Addr != "" {
+		if err := checkLoopback(config.Addr); err != nil {
+			return nil, fmt.Errorf("addr: %s", err)
+		}
+	}
+
+	stats = stats.Tagged(map[string]string{
+		"module": "debugserver",
+	})
+
+	return &Server{
+		config:     config,
+		stats:      stats,
+		watermarks: newWatermarks(stats),
+	}, nil
+}
+
+// checkLoopback returns an error if addr may be reachable from other hosts.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address", addr)
+	}
+	return nil
+}
+
+// Handler returns an http.Handler for s.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/watermarks", s.getWatermarksHandler)
+	return s.authenticate(mux)
+}
+
+// authenticate requires basic auth on all requests to next if a password is
+// configured.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	if s.config.Password == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(s.config.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(s.config.Password)) != 1 {
+
+			s.stats.Counter("unauthorized").Inc(1)
+			w.Header().Set("WWW-Authenticate", `Basic realm="kraken-debug"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getWatermarksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.watermarks.snapshot()); err != nil {
+		http.Error(w, fmt.Sprintf("json encode: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// ListenAndServe is a blocking call which serves debug endpoints on the
+// configured address.
+func (s *Server) ListenAndServe() error {
+	if s.config.Addr == "" {
+		return fmt.Errorf("no debug listener address configured")
+	}
+	log.Infof("Starting debug server on %s", s.config.Addr)
+	return http.ListenAndServe(s.config.Addr, s.Handler())
+}
+
+// EmitWatermarks periodically samples and emits runtime resource usage. Never
+// returns.
+func (s *Server) EmitWatermarks() {
+	for {
+		s.watermarks.sample()
+		<-time.After(s.config.WatermarkInterval)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestNewRejectsNonLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		ok   bool
+	}{
+		{"", true},
+		{"localhost:15006", true},
+		{"127.0.0.1:15006", true},
+		{"[::1]:15006", true},
+		{":15006", false},
+		{"0.0.0.0:15006", false},
+		{"10.0.0.1:15006", false},
+		{"example.com:15006", false},
+		{"localhost", false},
+	}
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			_, err := New(Config{Addr: test.addr}, tally.NoopScope)
+			if test.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestHandlerServesDebugEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{}, tally.NoopScope)
+	require.NoError(err)
+	s.watermarks.sample()
+
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	for _, path := range []string{
+		"/debug/pprof/",
+		"/debug/pprof/goroutine",
+		"/debug/pprof/cmdline",
+		"/debug/vars",
+	} {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(err)
+		resp.Body.Close()
+		require.Equal(http.StatusOK, resp.StatusCode, path)
+	}
+
+	resp, err := http.Get(server.URL + "/debug/watermarks")
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	var w Watermarks
+	require.NoError(json.NewDecoder(resp.Body).Decode(&w))
+	require.True(w.Goroutines.Current > 0)
+	require.True(w.HeapInuseBytes.High > 0)
+}
+
+func TestHandlerRequiresBasicAuth(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{Username: "kraken", Password: "secret"}, tally.NoopScope)
+	require.NoError(err)
+
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	tests := []struct {
+		desc               string
+		username, password string
+		expected           int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong password", "kraken", "wrong", http.StatusUnauthorized},
+		{"wrong username", "other", "secret", http.StatusUnauthorized},
+		{"valid credentials", "kraken", "secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			req, err := http.NewRequest("GET", server.URL+"/debug/pprof/", nil)
+			require.NoError(err)
+			if test.username != "" {
+				req.SetBasicAuth(test.username, test.password)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(err)
+			resp.Body.Close()
+			require.Equal(test.expected, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import (
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/uber-go/tally"
+)
+
+// Watermark is the current and highest observed value of a resource.
+type Watermark struct {
+	Current int64 `json:"current"`
+	High    int64 `json:"high_watermark"`
+}
+
+func (w *Watermark) update(v int64) {
+	w.Current = v
+	if v > w.High {
+		w.High = v
+	}
+}
+
+// Watermarks groups resource usage watermarks of the process.
+type Watermarks struct {
+	Goroutines     Watermark `json:"goroutines"`
+	OpenFDs        Watermark `json:"open_fds"`
+	HeapInuseBytes Watermark `json:"heap_inuse_bytes"`
+}
+
+// watermarks samples resource usage and tracks its high watermarks since the
+// process started.
+type watermarks struct {
+	stats tally.Scope
+
+	// Overridden in tests.
+	numGoroutines func() int
+	numFDs        func() (int, error)
+	heapInuse     func() uint64
+
+	mu      sync.Mutex
+	current Watermarks
+}
+
+func newWatermarks(stats tally.Scope) *watermarks {
+	return &watermarks{
+		stats:         stats,
+		numGoroutines: runtime.NumGoroutine,
+		numFDs:        numFDs,
+		heapInuse:     heapInuse,
+	}
+}
+
+func (w *watermarks) sample() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.current.Goroutines.update(int64(w.numGoroutines()))
+	w.emit("goroutines", w.current.Goroutines)
+
+	// File descriptors are only counted where /proc is available.
+	if n, err := w.numFDs(); err == nil {
+		w.current.OpenFDs.update(int64(n))
+		w.emit("open_fds", w.current.OpenFDs)
+	}
+
+	w.current.HeapInuseBytes.update(int64(w.heapInuse()))
+	w.emit("heap_inuse_bytes", w.current.HeapInuseBytes)
+}
+
+func (w *watermarks) emit(name string, m Watermark) {
+	w.stats.Gauge(name).Update(float64(m.Current))
+	w.stats.Gauge(name + "_high_watermark").Update(float64(m.High))
+}
+
+func (w *watermarks) snapshot() Watermarks {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.current
+}
+
+func numFDs() (int, error) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	// Exclude the descriptor used for reading the directory itself.
+	return len(names) - 1, nil
+}
+
+func heapInuse() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package debugserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestWatermarksTrackHighWatermarks(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	w := newWatermarks(stats)
+
+	var goroutines, fds int
+	var heap uint64
+	w.numGoroutines = func() int { return goroutines }
+	w.numFDs = func() (int, error) { return fds, nil }
+	w.heapInuse = func() uint64 { return heap }
+
+	goroutines, fds, heap = 10, 5, 100
+	w.sample()
+	goroutines, fds, heap = 30, 3, 50
+	w.sample()
+	goroutines, fds, heap = 20, 8, 70
+	w.sample()
+
+	require.Equal(Watermarks{
+		Goroutines:     Watermark{Current: 20, High: 30},
+		OpenFDs:        Watermark{Current: 8, High: 8},
+		HeapInuseBytes: Watermark{Current: 70, High: 100},
+	}, w.snapshot())
+
+	gauges := stats.Snapshot().Gauges()
+	require.Equal(float64(20), gauges["goroutines+"].Value())
+	require.Equal(float64(30), gauges["goroutines_high_watermark+"].Value())
+	require.Equal(float64(100), gauges["heap_inuse_bytes_high_watermark+"].Value())
+}
+
+func TestWatermarksSkipOpenFDsWhenUnavailable(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	w := newWatermarks(stats)
+	w.numFDs = func() (int, error) { return 0, errors.New("no procfs") }
+
+	w.sample()
+
+	require.Equal(Watermark{}, w.snapshot().OpenFDs)
+	_, ok := stats.Snapshot().Gauges()["open_fds+"]
+	require.False(ok)
+}
@@ -43,13 +43,25 @@ func newBlobs(bs BlobStore, transferer transfer.ImageTransferer) *blobs {
 	return &blobs{bs, transferer}
 }
 
-// getDigest returns blob digest given a blob path.
-func (b *blobs) getDigest(path string) ([]byte, error) {
+// getDigest returns blob digest given a layer link path. The registry only
+// reads layer links of other repos when mounting a blob from them into the
+// repo of the request, in which case the blob is mounted via the transferer.
+func (b *blobs) getDigest(ctx context.Context, path string) ([]byte, error) {
 	digest, err := GetLayerDigest(path)
 	if err != nil {
 		return nil, err
 	}
 
+	from, err := GetRepo(path)
+	if err != nil {
+		return nil, err
+	}
+	if to, err := parseRepo(ctx); err == nil && to != from {
+		if err := b.transferer.Mount(from, to, digest); err != nil {
+			return nil, fmt.Errorf("transferer mount: %w", err)
+		}
+	}
+
 	return []byte(digest.String()), nil
 }
 
@@ -82,7 +94,17 @@ func (b *blobs) reader(ctx context.Context, path string, offset int64) (io.ReadC
 	return b.getCacheReaderHelper(ctx, path, offset)
 }
 
+// getContent reads the blob at path. If the blob is corrupt, it was removed
+// from the cache by the transferer, and reading it again downloads it again.
 func (b *blobs) getContent(ctx context.Context, path string) ([]byte, error) {
+	content, err := b.readContent(ctx, path)
+	if errors.Is(err, transfer.ErrBlobCorrupt) {
+		content, err = b.readContent(ctx, path)
+	}
+	return content, err
+}
+
+func (b *blobs) readContent(ctx context.Context, path string) ([]byte, error) {
 	r, err := b.getCacheReaderHelper(ctx, path, 0)
 	if err != nil {
 		return nil, err
@@ -30,6 +30,15 @@ const (
 // Config defines registry configuration.
 type Config struct {
 	Docker configuration.Configuration `yaml:"docker"`
+
+	// PreAnnounce makes read-only registries start downloading the layers of
+	// a manifest as soon as the manifest is resolved, rather than when Docker
+	// requests each layer.
+	PreAnnounce bool `yaml:"pre_announce"`
+
+	// VerifyCachedBlobs makes read-only registries verify the digest of cached
+	// blobs while serving them. Corrupt blobs are removed and downloaded again.
+	VerifyCachedBlobs bool `yaml:"verify_cached_blobs"`
 }
 
 // ReadWriteParameters builds parameters for a read-write driver.
@@ -64,6 +73,12 @@ func (c Config) ReadOnlyParameters(
 
 // Build builds a new docker registry.
 func (c Config) Build(parameters configuration.Parameters) (*registry.Registry, error) {
+	c.setStorage(parameters)
+	return registry.NewRegistry(context.Background(), &c.Docker)
+}
+
+// setStorage configures the kraken storage driver with parameters.
+func (c *Config) setStorage(parameters configuration.Parameters) {
 	c.Docker.Storage = configuration.Storage{
 		Name: parameters,
 		// Redirect is enabled by default in docker registry.
@@ -72,5 +87,4 @@ func (c Config) Build(parameters configuration.Parameters) (*registry.Registry,
 			"disable": true,
 		},
 	}
-	return registry.NewRegistry(context.Background(), &c.Docker)
 }
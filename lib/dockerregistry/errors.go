@@ -0,0 +1,160 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/tracker/metainfoclient"
+
+	"github.com/docker/distribution/registry/api/errcode"
+)
+
+const _errGroup = "kraken"
+
+// Registry error codes of pull failures which docker registry would otherwise
+// report as unknown errors, such that clients, e.g. kubelet events, show an
+// actionable cause.
+var (
+	ErrorCodeTrackerUnavailable = errcode.Register(_errGroup, errcode.ErrorDescriptor{
+		Value:          "TRACKER_UNAVAILABLE",
+		Message:        "trackers are unreachable",
+		Description:    "None of the trackers responsible for a blob could be reached.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	})
+	ErrorCodeMetaInfoTimeout = errcode.Register(_errGroup, errcode.ErrorDescriptor{
+		Value:          "METAINFO_TIMEOUT",
+		Message:        "timed out waiting for origins to prepare blob",
+		Description:    "Origins did not finish generating the metainfo of a blob in time.",
+		HTTPStatusCode: http.StatusGatewayTimeout,
+	})
+	ErrorCodeNoPeers = errcode.Register(_errGroup, errcode.ErrorDescriptor{
+		Value:          "NO_PEERS",
+		Message:        "no peers or origins are serving blob",
+		Description:    "A blob download timed out without any peer or origin to download from.",
+		HTTPStatusCode: http.StatusServiceUnavailable,
+	})
+	ErrorCodeDownloadTimeout = errcode.Register(_errGroup, errcode.ErrorDescriptor{
+		Value:          "DOWNLOAD_TIMEOUT",
+		Message:        "blob download stalled",
+		Description:    "A blob download made no progress for too long.",
+		HTTPStatusCode: http.StatusGatewayTimeout,
+	})
+	ErrorCodeDigestMismatch = errcode.Register(_errGroup, errcode.ErrorDescriptor{
+		Value:          "DIGEST_MISMATCH",
+		Message:        "downloaded blob does not match digest",
+		Description:    "The content of a downloaded blob failed digest verification.",
+		HTTPStatusCode: http.StatusBadGateway,
+	})
+)
+
+// pullErrorCode maps err to the registry error code of its failure mode.
+func pullErrorCode(err error) (errcode.ErrorCode, bool) {
+	switch {
+	case errors.Is(err, metainfoclient.ErrTrackersUnavailable):
+		return ErrorCodeTrackerUnavailable, true
+	case errors.Is(err, metainfoclient.ErrMetaInfoTimeout):
+		return ErrorCodeMetaInfoTimeout, true
+	case errors.Is(err, scheduler.ErrTorrentNoPeers):
+		return ErrorCodeNoPeers, true
+	case errors.Is(err, scheduler.ErrTorrentTimeout):
+		return ErrorCodeDownloadTimeout, true
+	case errors.Is(err, scheduler.ErrTorrentCorrupt):
+		return ErrorCodeDigestMismatch, true
+	}
+	return 0, false
+}
+
+type pullFailureKey struct{}
+
+// pullFailure holds the first classified driver error of a request.
+type pullFailure struct {
+	sync.Mutex
+	err *errcode.Error
+}
+
+// recordPullFailure records err on the request of ctx if it maps to a
+// registry error code.
+func recordPullFailure(ctx context.Context, err error) {
+	f, ok := ctx.Value(pullFailureKey{}).(*pullFailure)
+	if !ok {
+		return
+	}
+	code, ok := pullErrorCode(err)
+	if !ok {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.err == nil {
+		e := code.WithMessage(fmt.Sprintf("%s: %s", code.Message(), err))
+		f.err = &e
+	}
+}
+
+func (f *pullFailure) get() (errcode.Error, bool) {
+	f.Lock()
+	defer f.Unlock()
+	if f.err == nil {
+		return errcode.Error{}, false
+	}
+	return *f.err, true
+}
+
+// reportPullFailures replaces the error responses of h with the registry error
+// code of the failure recorded by the storage driver, if any.
+func reportPullFailures(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := &pullFailure{}
+		r = r.WithContext(context.WithValue(r.Context(), pullFailureKey{}, f))
+		h.ServeHTTP(&pullFailureWriter{ResponseWriter: w, failure: f}, r)
+	})
+}
+
+type pullFailureWriter struct {
+	http.ResponseWriter
+	failure  *pullFailure
+	replaced bool
+}
+
+func (w *pullFailureWriter) WriteHeader(status int) {
+	if status >= http.StatusBadRequest {
+		if err, ok := w.failure.get(); ok {
+			w.replaced = true
+			w.Header().Del("Content-Length")
+			errcode.ServeJSON(w.ResponseWriter, err)
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *pullFailureWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		// Discard the generic error written by docker registry.
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *pullFailureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -15,12 +15,15 @@ package dockerregistry
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 	"time"
 
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/log"
 )
 
@@ -34,10 +37,11 @@ const (
 
 type manifests struct {
 	transferer transfer.ImageTransferer
+	prefetch   bool
 }
 
-func newManifests(transferer transfer.ImageTransferer) *manifests {
-	return &manifests{transferer}
+func newManifests(transferer transfer.ImageTransferer, prefetch bool) *manifests {
+	return &manifests{transferer, prefetch}
 }
 
 // getDigest downloads and returns manifest digest.
@@ -79,9 +83,40 @@ func (t *manifests) getDigest(path string, subtype PathSubType) ([]byte, error)
 	}
 	defer blob.Close()
 
+	if t.prefetch {
+		t.prefetchReferences(repo, digest, blob)
+	}
+
 	return []byte(digest.String()), nil
 }
 
+// prefetchReferences starts downloads of the config and layers referenced by
+// manifest d, if the transferer supports prefetching. Docker requests each
+// layer only after processing the manifest, so this overlaps the tracker round
+// trips of all layers with manifest processing. Manifest lists are skipped,
+// since only one of their manifests will be pulled.
+func (t *manifests) prefetchReferences(repo string, d core.Digest, blob io.Reader) {
+	p, ok := t.transferer.(transfer.Prefetcher)
+	if !ok {
+		return
+	}
+	b, err := ioutil.ReadAll(blob)
+	if err != nil {
+		log.With("manifest", d).Errorf("Error reading manifest for prefetch: %s", err)
+		return
+	}
+	manifest, _, err := dockerutil.ParseManifestV2(b)
+	if err != nil {
+		return
+	}
+	refs, err := dockerutil.GetManifestReferences(manifest)
+	if err != nil {
+		log.With("manifest", d).Errorf("Error getting manifest references for prefetch: %s", err)
+		return
+	}
+	p.Prefetch(repo, refs)
+}
+
 func (t *manifests) putContent(path string, subtype PathSubType) error {
 	switch subtype {
 	case _tags:
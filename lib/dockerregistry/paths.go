@@ -92,12 +92,12 @@ func GetRepo(path string) (string, error) {
 
 // GetBlobDigest returns blob digest
 func GetBlobDigest(path string) (core.Digest, error) {
-	re := regexp.MustCompile("^.+/blobs/sha256/[0-9a-z]{2}/([0-9a-z]+)/data$")
+	re := regexp.MustCompile("^.+/blobs/([0-9a-z]+)/[0-9a-z]{2}/([0-9a-z]+)/data$")
 	matches := re.FindStringSubmatch(path)
-	if len(matches) < 2 {
+	if len(matches) < 3 {
 		return core.Digest{}, InvalidRegistryPathError{_blobs, path}
 	}
-	d, err := core.NewSHA256DigestFromHex(matches[1])
+	d, err := core.NewDigestFromHex(matches[1], matches[2])
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("new digest: %s", err)
 	}
@@ -106,12 +106,12 @@ func GetBlobDigest(path string) (core.Digest, error) {
 
 // GetLayerDigest returns digest of the layer
 func GetLayerDigest(path string) (core.Digest, error) {
-	re := regexp.MustCompile("^.+/_layers/sha256/([0-9a-z]+)/(?:link|data)$")
+	re := regexp.MustCompile("^.+/_layers/([0-9a-z]+)/([0-9a-z]+)/(?:link|data)$")
 	matches := re.FindStringSubmatch(path)
-	if len(matches) < 2 {
+	if len(matches) < 3 {
 		return core.Digest{}, InvalidRegistryPathError{_layers, path}
 	}
-	d, err := core.NewSHA256DigestFromHex(matches[1])
+	d, err := core.NewDigestFromHex(matches[1], matches[2])
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("new digest: %s", err)
 	}
@@ -120,12 +120,12 @@ func GetLayerDigest(path string) (core.Digest, error) {
 
 // GetManifestDigest returns manifest or tag digest
 func GetManifestDigest(path string) (core.Digest, error) {
-	re := regexp.MustCompile("^.+/_manifests/(?:revisions|tags/.+/index)/sha256/([0-9a-z]+)/link$")
+	re := regexp.MustCompile("^.+/_manifests/(?:revisions|tags/.+/index)/([0-9a-z]+)/([0-9a-z]+)/link$")
 	matches := re.FindStringSubmatch(path)
-	if len(matches) < 2 {
+	if len(matches) < 3 {
 		return core.Digest{}, InvalidRegistryPathError{_manifests, path}
 	}
-	d, err := core.NewSHA256DigestFromHex(matches[1])
+	d, err := core.NewDigestFromHex(matches[1], matches[2])
 	if err != nil {
 		return core.Digest{}, fmt.Errorf("new digest: %s", err)
 	}
@@ -134,7 +134,7 @@ func GetManifestDigest(path string) (core.Digest, error) {
 
 // GetManifestTag returns tag name
 func GetManifestTag(path string) (string, bool, error) {
-	re := regexp.MustCompile("^.+/_manifests/tags/([^/]+)/(current|index/sha256/[0-9a-z]+)/link$")
+	re := regexp.MustCompile("^.+/_manifests/tags/([^/]+)/(current|index/[0-9a-z]+/[0-9a-z]+)/link$")
 	matches := re.FindStringSubmatch(path)
 	if len(matches) < 3 {
 		return "", false, InvalidRegistryPathError{_manifests, path}
@@ -178,7 +178,7 @@ func matchManifestsPath(path string) (bool, PathSubType) {
 
 // matchBlobsPath returns true if it if a valid /blobs path and returns a subtype
 func matchBlobsPath(path string) (bool, PathSubType) {
-	re := regexp.MustCompile("^.+/blobs/sha256/[0-9a-z]{2}/[0-9a-z]+/data$")
+	re := regexp.MustCompile("^.+/blobs/[0-9a-z]+/[0-9a-z]{2}/[0-9a-z]+/data$")
 	ok := re.Match([]byte(path))
 	if !ok {
 		return false, _invalidPathSubType
@@ -188,7 +188,7 @@ func matchBlobsPath(path string) (bool, PathSubType) {
 
 // matchLayersPath returns true if it is a valid /_layers path and returns a subtype
 func matchLayersPath(path string) (bool, PathSubType) {
-	re := regexp.MustCompile("^.+/_layers/sha256/[0-9a-z]+/(link|data)$")
+	re := regexp.MustCompile("^.+/_layers/[0-9a-z]+/[0-9a-z]+/(link|data)$")
 	matches := re.FindStringSubmatch(path)
 	if len(matches) < 2 {
 		return false, _invalidPathSubType
@@ -25,11 +25,16 @@ import (
 const _testDigestHex = "ff3a5c916c92643ff77519ffa742d3ec61b7f591b6b7504599d95a4a41134e28"
 
 func TestBlobsPath(t *testing.T) {
-	d := core.DigestFixture()
+	for _, algo := range []string{core.SHA256, core.SHA512} {
+		t.Run(algo, func(t *testing.T) {
+			d := core.SizedBlobFixtureForAlgo(64, 64, algo).Digest
 
-	result, err := GetBlobDigest(fmt.Sprintf("/v2/blobs/sha256/%s/%s/data", d.Hex()[:2], d.Hex()))
-	require.NoError(t, err)
-	require.Equal(t, d, result)
+			result, err := GetBlobDigest(
+				fmt.Sprintf("/v2/blobs/%s/%s/%s/data", algo, d.Hex()[:2], d.Hex()))
+			require.NoError(t, err)
+			require.Equal(t, d, result)
+		})
+	}
 }
 
 func TestBlobsPathNoMatch(t *testing.T) {
@@ -125,20 +130,23 @@ func TestLayersPath(t *testing.T) {
 
 func TestLayersPathGetDigest(t *testing.T) {
 	d := core.DigestFixture()
+	sha512 := core.SizedBlobFixtureForAlgo(64, 64, core.SHA512).Digest
 
 	testCases := []struct {
-		name  string
-		input string
+		name     string
+		input    string
+		expected core.Digest
 	}{
-		{"valid data path", fmt.Sprintf("kraken/_layers/sha256/%s/data", d.Hex())},
-		{"valid link path", fmt.Sprintf("kraken/_layers/sha256/%s/link", d.Hex())},
+		{"valid data path", fmt.Sprintf("kraken/_layers/sha256/%s/data", d.Hex()), d},
+		{"valid link path", fmt.Sprintf("kraken/_layers/sha256/%s/link", d.Hex()), d},
+		{"sha512 link path", fmt.Sprintf("kraken/_layers/sha512/%s/link", sha512.Hex()), sha512},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			result, err := GetLayerDigest(tc.input)
 			require.NoError(t, err)
-			require.Equal(t, d, result)
+			require.Equal(t, tc.expected, result)
 		})
 	}
 }
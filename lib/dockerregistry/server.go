@@ -0,0 +1,89 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/docker/distribution/configuration"
+	"github.com/docker/distribution/health"
+	"github.com/docker/distribution/registry/handlers"
+	"github.com/docker/distribution/registry/listener"
+	gorhandlers "github.com/gorilla/handlers"
+	"github.com/sirupsen/logrus"
+)
+
+// Server serves a docker registry. Unlike registry.Registry, it reports pull
+// failures, e.g. unreachable trackers, with distinct registry error codes
+// instead of generic unknown errors.
+type Server struct {
+	config  configuration.Configuration
+	handler http.Handler
+}
+
+// BuildServer builds a new docker registry Server. TLS is not supported, since
+// it is terminated by nginx.
+func (c Config) BuildServer(parameters configuration.Parameters) (*Server, error) {
+	if c.Docker.HTTP.TLS.Certificate != "" || c.Docker.HTTP.TLS.LetsEncrypt.CacheFile != "" {
+		return nil, errors.New("tls is not supported")
+	}
+	if c.Docker.Log.Level != "" {
+		level, err := logrus.ParseLevel(string(c.Docker.Log.Level))
+		if err != nil {
+			return nil, fmt.Errorf("parse log level: %s", err)
+		}
+		logrus.SetLevel(level)
+	}
+	c.setStorage(parameters)
+
+	app := handlers.NewApp(context.Background(), &c.Docker)
+	app.RegisterHealthChecks()
+
+	handler := health.Handler(reportPullFailures(app))
+	handler = alive("/", handler)
+	if !c.Docker.Log.AccessLog.Disabled {
+		handler = gorhandlers.CombinedLoggingHandler(os.Stdout, handler)
+	}
+	return &Server{c.Docker, handler}, nil
+}
+
+// Handler returns the HTTP handler of s.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ListenAndServe serves s on the configured address.
+func (s *Server) ListenAndServe() error {
+	l, err := listener.NewListener(s.config.HTTP.Net, s.config.HTTP.Addr)
+	if err != nil {
+		return fmt.Errorf("listen: %s", err)
+	}
+	return http.Serve(l, s.handler)
+}
+
+// alive responds 200 to requests of path, like registry.Registry does.
+func alive(path string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == path {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
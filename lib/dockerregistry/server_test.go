@@ -0,0 +1,131 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	mocktransfer "github.com/uber/kraken/mocks/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/tracker/metainfoclient"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestServerReportsPullFailures(t *testing.T) {
+	tests := []struct {
+		desc   string
+		err    error
+		code   errcode.ErrorCode
+		status int
+	}{
+		{
+			"trackers unavailable",
+			fmt.Errorf("download metainfo: %w", metainfoclient.ErrTrackersUnavailable),
+			ErrorCodeTrackerUnavailable,
+			http.StatusServiceUnavailable,
+		}, {
+			"metainfo timeout",
+			fmt.Errorf("download metainfo: %w", metainfoclient.ErrMetaInfoTimeout),
+			ErrorCodeMetaInfoTimeout,
+			http.StatusGatewayTimeout,
+		}, {
+			"no peers",
+			scheduler.ErrTorrentNoPeers,
+			ErrorCodeNoPeers,
+			http.StatusServiceUnavailable,
+		}, {
+			"download timeout",
+			scheduler.ErrTorrentTimeout,
+			ErrorCodeDownloadTimeout,
+			http.StatusGatewayTimeout,
+		}, {
+			"digest mismatch",
+			scheduler.ErrTorrentCorrupt,
+			ErrorCodeDigestMismatch,
+			http.StatusBadGateway,
+		}, {
+			"unknown",
+			errors.New("some error"),
+			errcode.ErrorCodeUnknown,
+			http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			cas, cleanup := store.CAStoreFixture()
+			defer cleanup()
+
+			transferer := mocktransfer.NewMockImageTransferer(ctrl)
+
+			s, err := Config{}.BuildServer(
+				Config{}.ReadOnlyParameters(transferer, cas, tally.NoopScope))
+			require.NoError(err)
+
+			server := httptest.NewServer(s.Handler())
+			defer server.Close()
+
+			d := core.DigestFixture()
+
+			transferer.EXPECT().Stat("repo", d).Return(
+				nil, fmt.Errorf("scheduler: %w", test.err)).MinTimes(1)
+
+			resp, err := http.Get(fmt.Sprintf("%s/v2/repo/blobs/%s", server.URL, d))
+			require.NoError(err)
+			defer resp.Body.Close()
+
+			require.Equal(test.status, resp.StatusCode)
+
+			var errs errcode.Errors
+			require.NoError(json.NewDecoder(resp.Body).Decode(&errs))
+			require.Len(errs, 1)
+			require.Equal(test.code, errs[0].(errcode.Error).Code)
+		})
+	}
+}
+
+func TestServerAlive(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	s, err := Config{}.BuildServer(
+		Config{}.ReadOnlyParameters(transfer.NewTestTransferer(cas), cas, tally.NoopScope))
+	require.NoError(err)
+
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+}
@@ -67,7 +67,10 @@ func (e InvalidRequestError) Error() string {
 	return fmt.Sprintf("invalid request: %s", e.path)
 }
 
-func toDriverError(err error, path string) error {
+// toDriverError converts not found errors to driver.PathNotFoundError, and
+// records failures which map to registry error codes on the request of ctx.
+func toDriverError(ctx context.Context, err error, path string) error {
+	recordPullFailure(ctx, err)
 	if errors.Is(err, os.ErrNotExist) ||
 		errors.Is(err, transfer.ErrBlobNotFound) ||
 		errors.Is(err, transfer.ErrTagNotFound) {
@@ -132,7 +135,7 @@ func NewReadWriteStorageDriver(
 		transferer: transferer,
 		blobs:      newBlobs(cas, transferer),
 		uploads:    newCASUploads(cas, transferer),
-		manifests:  newManifests(transferer),
+		manifests:  newManifests(transferer, false),
 		metrics:    metrics,
 	}
 }
@@ -149,7 +152,7 @@ func NewReadOnlyStorageDriver(
 		transferer: transferer,
 		blobs:      newBlobs(bs, transferer),
 		uploads:    disabledUploads{},
-		manifests:  newManifests(transferer),
+		manifests:  newManifests(transferer, config.PreAnnounce),
 		metrics:    metrics,
 	}
 }
@@ -175,14 +178,14 @@ func (d *KrakenStorageDriver) GetContent(ctx context.Context, path string) ([]by
 	case _uploads:
 		data, err = d.uploads.getContent(path, pathSubType)
 	case _layers:
-		data, err = d.blobs.getDigest(path)
+		data, err = d.blobs.getDigest(ctx, path)
 	case _blobs:
 		data, err = d.blobs.getContent(ctx, path)
 	default:
 		return nil, InvalidRequestError{path}
 	}
 	if err != nil {
-		return nil, toDriverError(err, path)
+		return nil, toDriverError(ctx, err, path)
 	}
 	return data, nil
 }
@@ -205,7 +208,7 @@ func (d *KrakenStorageDriver) Reader(ctx context.Context, path string, offset in
 		return nil, InvalidRequestError{path}
 	}
 	if err != nil {
-		return nil, toDriverError(err, path)
+		return nil, toDriverError(ctx, err, path)
 	}
 	return reader, nil
 }
@@ -232,7 +235,7 @@ func (d *KrakenStorageDriver) PutContent(ctx context.Context, path string, conte
 		return InvalidRequestError{path}
 	}
 	if err != nil {
-		return toDriverError(err, path)
+		return toDriverError(ctx, err, path)
 	}
 	return nil
 }
@@ -249,7 +252,7 @@ func (d *KrakenStorageDriver) Writer(ctx context.Context, path string, append bo
 	case _uploads:
 		w, err := d.uploads.writer(path, pathSubType)
 		if err != nil {
-			return nil, toDriverError(err, path)
+			return nil, toDriverError(ctx, err, path)
 		}
 		if append {
 			if _, err := w.Seek(0, io.SeekEnd); err != nil {
@@ -282,7 +285,7 @@ func (d *KrakenStorageDriver) Stat(ctx context.Context, path string) (driver.Fil
 		return nil, InvalidRequestError{path}
 	}
 	if err != nil {
-		return nil, toDriverError(err, path)
+		return nil, toDriverError(ctx, err, path)
 	}
 	return info, nil
 }
@@ -305,7 +308,7 @@ func (d *KrakenStorageDriver) List(ctx context.Context, path string) ([]string,
 		return nil, InvalidRequestError{path}
 	}
 	if err != nil {
-		return nil, toDriverError(err, path)
+		return nil, toDriverError(ctx, err, path)
 	}
 	return l, nil
 }
@@ -325,7 +328,7 @@ func (d *KrakenStorageDriver) Move(ctx context.Context, sourcePath string, destP
 		return InvalidRequestError{sourcePath + " to " + destPath}
 	}
 	if err != nil {
-		return toDriverError(err, sourcePath)
+		return toDriverError(ctx, err, sourcePath)
 	}
 	return nil
 }
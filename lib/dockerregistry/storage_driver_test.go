@@ -22,10 +22,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/uuid"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/pullstats"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/mocks/lib/torrent/scheduler"
 	"github.com/uber/kraken/utils/randutil"
 )
 
@@ -73,6 +81,159 @@ func TestStorageDriverGetContent(t *testing.T) {
 	}
 }
 
+func TestStorageDriverGetContentMountsLayerFromOtherRepo(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	sd, testImage := td.setup()
+
+	ctx := context.WithValue(context.Background(), "vars.name", "derived")
+
+	data, err := sd.GetContent(ctx, genLayerLinkPath(testImage.layer1.Digest.Hex()))
+	require.NoError(err)
+	require.Equal([]byte(testImage.layer1.Digest.String()), data)
+
+	missing := genLayerLinkPath(core.DigestFixture().Hex())
+	_, err = sd.GetContent(ctx, missing)
+	require.Equal(driver.PathNotFoundError{DriverName: "kraken", Path: missing}, err)
+}
+
+// corruptOnceTransferer fails the first read of each blob with
+// transfer.ErrBlobCorrupt.
+type corruptOnceTransferer struct {
+	transfer.ImageTransferer
+	corrupted map[core.Digest]bool
+}
+
+type corruptReader struct {
+	store.FileReader
+}
+
+func (r corruptReader) Read(p []byte) (int, error) {
+	return 0, transfer.ErrBlobCorrupt
+}
+
+func (t *corruptOnceTransferer) Download(namespace string, d core.Digest) (store.FileReader, error) {
+	f, err := t.ImageTransferer.Download(namespace, d)
+	if err != nil || t.corrupted[d] {
+		return f, err
+	}
+	t.corrupted[d] = true
+	return corruptReader{f}, nil
+}
+
+func TestStorageDriverGetContentRetriesCorruptBlob(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	_, testImage := td.setup()
+
+	transferer := &corruptOnceTransferer{td.transferer, make(map[core.Digest]bool)}
+	sd := NewReadOnlyStorageDriver(Config{}, td.cas, transferer, tally.NoopScope)
+
+	data, err := sd.GetContent(contextFixture(), genBlobDataPath(testImage.layer1.Digest.Hex()))
+	require.NoError(err)
+	require.Equal(testImage.layer1.Content, data)
+}
+
+type prefetchRecorder struct {
+	transfer.ImageTransferer
+	namespace string
+	digests   []core.Digest
+}
+
+func (r *prefetchRecorder) Prefetch(namespace string, ds []core.Digest) {
+	r.namespace = namespace
+	r.digests = append(r.digests, ds...)
+}
+
+func TestReadOnlyStorageDriverGetManifestPreAnnouncesReferences(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	_, testImage := td.setup()
+
+	prefetcher := &prefetchRecorder{ImageTransferer: td.transferer}
+	sd := NewReadOnlyStorageDriver(Config{PreAnnounce: true}, td.cas, prefetcher, tally.NoopScope)
+
+	_, err := sd.GetContent(contextFixture(), genManifestTagCurrentLinkPath(
+		testImage.repo, testImage.tag, testImage.manifest))
+	require.NoError(err)
+
+	require.Equal(testImage.repo, prefetcher.namespace)
+	require.Len(prefetcher.digests, 3)
+	require.Contains(prefetcher.digests, testImage.layer1.Digest)
+	require.Contains(prefetcher.digests, testImage.layer2.Digest)
+}
+
+func TestReadOnlyStorageDriverGetManifestWithoutPreAnnounce(t *testing.T) {
+	require := require.New(t)
+
+	td, cleanup := newTestDriver()
+	defer cleanup()
+
+	_, testImage := td.setup()
+
+	prefetcher := &prefetchRecorder{ImageTransferer: td.transferer}
+	sd := NewReadOnlyStorageDriver(Config{}, td.cas, prefetcher, tally.NoopScope)
+
+	_, err := sd.GetContent(contextFixture(), genManifestTagCurrentLinkPath(
+		testImage.repo, testImage.tag, testImage.manifest))
+	require.NoError(err)
+	require.Empty(prefetcher.digests)
+}
+
+func TestReadOnlyStorageDriverRoundTripSHA512(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	defer cleanup()
+
+	sched := mockscheduler.NewMockScheduler(ctrl)
+	transferer := transfer.NewReadOnlyTransferer(
+		tally.NoopScope, cads, mocktagclient.NewMockClient(ctrl), sched,
+		pullstats.New(pullstats.Config{}, tally.NoopScope, clock.NewMock()))
+
+	sd := NewReadOnlyStorageDriver(Config{}, cads, transferer, tally.NoopScope)
+
+	content := randutil.Text(64)
+	digester, err := core.NewDigesterForAlgo(core.SHA512)
+	require.NoError(err)
+	d, err := digester.FromBytes(content)
+	require.NoError(err)
+
+	sched.EXPECT().Download("dummy", d).DoAndReturn(func(namespace string, d core.Digest) error {
+		return store.RunDownload(cads, d, content)
+	})
+
+	p := fmt.Sprintf("/docker/registry/v2/blobs/sha512/%s/%s/data", d.Hex()[:2], d.Hex())
+
+	data, err := sd.GetContent(contextFixture(), p)
+	require.NoError(err)
+	require.Equal(content, data)
+
+	// The blob is served from the cache, without downloading it again.
+	fi, err := sd.Stat(contextFixture(), p)
+	require.NoError(err)
+	require.Equal(int64(len(content)), fi.Size())
+
+	r, err := sd.Reader(contextFixture(), p, 0)
+	require.NoError(err)
+	defer r.Close()
+	data, err = ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(content, data)
+}
+
 func TestStorageDriverReader(t *testing.T) {
 	td, cleanup := newTestDriver()
 	defer cleanup()
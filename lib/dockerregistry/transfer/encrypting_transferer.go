@@ -0,0 +1,239 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"fmt"
+
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/encryption"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/log"
+)
+
+var (
+	_ ImageTransferer   = (*EncryptingTransferer)(nil)
+	_ Prefetcher        = (*EncryptingTransferer)(nil)
+	_ OriginStater      = (*EncryptingTransferer)(nil)
+	_ WriteBackStater   = (*EncryptingTransferer)(nil)
+	_ ReplicationStater = (*EncryptingTransferer)(nil)
+)
+
+// EncryptingTransferer wraps an ImageTransferer such that blobs of encrypted
+// namespaces are transferred as envelopes, and only decrypted when they are
+// served. The envelope of a blob is a separate blob, whose digest is stored
+// under the tag returned by encryption.Tag.
+//
+// Blobs of encrypted namespaces without an envelope, such as manifests, are
+// transferred as is.
+type EncryptingTransferer struct {
+	ImageTransferer
+	stats tally.Scope
+	keys  *encryption.Keyring
+}
+
+// NewEncryptingTransferer creates a new EncryptingTransferer.
+func NewEncryptingTransferer(
+	t ImageTransferer, stats tally.Scope, keys *encryption.Keyring) *EncryptingTransferer {
+
+	stats = stats.Tagged(map[string]string{
+		"module": "encryptingtransferer",
+	})
+	return &EncryptingTransferer{t, stats, keys}
+}
+
+// envelope returns the digest of the envelope of d, and false if d has none.
+func (t *EncryptingTransferer) envelope(namespace string, d core.Digest) (core.Digest, bool, error) {
+	if !t.keys.Encrypted(namespace) {
+		return core.Digest{}, false, nil
+	}
+	e, err := t.ImageTransferer.GetTag(encryption.Tag(namespace, d))
+	if err == ErrTagNotFound {
+		return core.Digest{}, false, nil
+	} else if err != nil {
+		return core.Digest{}, false, fmt.Errorf("get envelope tag: %s", err)
+	}
+	return e, true, nil
+}
+
+// Stat returns the plaintext size of d.
+func (t *EncryptingTransferer) Stat(namespace string, d core.Digest) (*core.BlobInfo, error) {
+	return t.stat(t.ImageTransferer.Stat, namespace, d)
+}
+
+// OriginStat returns the plaintext size of d as stored on origins. Falls back
+// to Stat if the underlying ImageTransferer is not an OriginStater.
+func (t *EncryptingTransferer) OriginStat(namespace string, d core.Digest) (*core.BlobInfo, error) {
+	if s, ok := t.ImageTransferer.(OriginStater); ok {
+		return t.stat(s.OriginStat, namespace, d)
+	}
+	return t.Stat(namespace, d)
+}
+
+// WriteBackState returns whether origins have persisted d, or its envelope if
+// it has one, to the storage backend. Returns ErrBlobNotFound if the
+// underlying ImageTransferer is not a WriteBackStater.
+func (t *EncryptingTransferer) WriteBackState(
+	namespace string, d core.Digest) (blobclient.WriteBackState, error) {
+
+	s, ok := t.ImageTransferer.(WriteBackStater)
+	if !ok {
+		return "", ErrBlobNotFound
+	}
+	e, ok, err := t.envelope(namespace, d)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		d = e
+	}
+	return s.WriteBackState(namespace, d)
+}
+
+// ReplicationStatus returns the replication status of tag. Tags are not
+// encrypted, so this is passed through to the underlying ImageTransferer.
+func (t *EncryptingTransferer) ReplicationStatus(tag string) (tagmodels.ReplicationStatus, error) {
+	s, ok := t.ImageTransferer.(ReplicationStater)
+	if !ok {
+		return tagmodels.ReplicationStatus{}, ErrTagNotFound
+	}
+	return s.ReplicationStatus(tag)
+}
+
+// stat returns the plaintext size of d, statting its envelope with f.
+func (t *EncryptingTransferer) stat(
+	f func(string, core.Digest) (*core.BlobInfo, error),
+	namespace string,
+	d core.Digest) (*core.BlobInfo, error) {
+
+	e, ok, err := t.envelope(namespace, d)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return f(namespace, d)
+	}
+	bi, err := f(namespace, e)
+	if err != nil {
+		return nil, err
+	}
+	size, err := encryption.PlaintextSize(bi.Size)
+	if err != nil {
+		return nil, fmt.Errorf("envelope %s: %s", e, err)
+	}
+	return core.NewBlobInfo(size), nil
+}
+
+// Download downloads the envelope of d and returns a reader which decrypts
+// it. Reading the blob to its end fails with ErrBlobCorrupt if the plaintext
+// does not match d.
+func (t *EncryptingTransferer) Download(namespace string, d core.Digest) (store.FileReader, error) {
+	e, ok, err := t.envelope(namespace, d)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return t.ImageTransferer.Download(namespace, d)
+	}
+	f, err := t.ImageTransferer.Download(namespace, e)
+	if err != nil {
+		return nil, err
+	}
+	r, err := t.keys.Decrypt(namespace, f)
+	if err != nil {
+		f.Close()
+		t.stats.Counter("decrypt_errors").Inc(1)
+		return nil, fmt.Errorf("decrypt: %s", err)
+	}
+	return newVerifyingReader(r, d, func() {
+		t.stats.Counter("corrupt_blobs").Inc(1)
+		log.With("namespace", namespace, "digest", d, "envelope", e).Error(
+			"Decrypted blob does not match its digest")
+	}), nil
+}
+
+// Upload encrypts blob and uploads its envelope, if namespace is encrypted.
+func (t *EncryptingTransferer) Upload(namespace string, d core.Digest, blob store.FileReader) error {
+	if !t.keys.Encrypted(namespace) {
+		return t.ImageTransferer.Upload(namespace, d, blob)
+	}
+	if _, ok, err := t.envelope(namespace, d); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+	f, e, err := t.keys.EncryptToFile(namespace, blob)
+	if err != nil {
+		t.stats.Counter("encrypt_errors").Inc(1)
+		return fmt.Errorf("encrypt: %s", err)
+	}
+	defer f.Close()
+	if err := t.ImageTransferer.Upload(namespace, e, f); err != nil {
+		return err
+	}
+	// The envelope is only tagged once uploaded, such that a tagged envelope
+	// can always be downloaded.
+	if err := t.ImageTransferer.PutTag(encryption.Tag(namespace, d), e); err != nil {
+		return fmt.Errorf("put envelope tag: %s", err)
+	}
+	t.stats.Counter("encrypted_uploads").Inc(1)
+	return nil
+}
+
+// Mount re-encrypts d if from or to is encrypted. Blobs of encrypted
+// namespaces are never mounted into namespaces which are not encrypted, in
+// which case ErrBlobNotFound is returned and clients upload the blob instead.
+func (t *EncryptingTransferer) Mount(from, to string, d core.Digest) error {
+	if !t.keys.Encrypted(from) && !t.keys.Encrypted(to) {
+		return t.ImageTransferer.Mount(from, to, d)
+	}
+	if !t.keys.Encrypted(to) {
+		return ErrBlobNotFound
+	}
+	blob, err := t.Download(from, d)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	return t.Upload(to, d, blob)
+}
+
+// Prefetch prefetches the envelopes of ds, if the underlying ImageTransferer
+// is a Prefetcher.
+func (t *EncryptingTransferer) Prefetch(namespace string, ds []core.Digest) {
+	p, ok := t.ImageTransferer.(Prefetcher)
+	if !ok {
+		return
+	}
+	if !t.keys.Encrypted(namespace) {
+		p.Prefetch(namespace, ds)
+		return
+	}
+	var es []core.Digest
+	for _, d := range ds {
+		e, ok, err := t.envelope(namespace, d)
+		if err != nil {
+			log.With("namespace", namespace, "digest", d).Errorf("Error prefetching envelope: %s", err)
+			continue
+		}
+		if !ok {
+			e = d
+		}
+		es = append(es, e)
+	}
+	p.Prefetch(namespace, es)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/encryption"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+const _confidential = "confidential/model"
+
+func newEncryptingTransfererFixture() (*EncryptingTransferer, *store.CAStore, func()) {
+	var cleanup testutil.Cleanup
+
+	cas, c := store.CAStoreFixture()
+	cleanup.Add(c)
+
+	keys, c := encryption.KeyringFixture("^confidential/.*")
+	cleanup.Add(c)
+
+	return NewEncryptingTransferer(NewTestTransferer(cas), tally.NoopScope, keys), cas, cleanup.Run
+}
+
+func readBlob(t *testing.T, transferer ImageTransferer, namespace string, d core.Digest) ([]byte, error) {
+	f, err := transferer.Download(namespace, d)
+	require.NoError(t, err)
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+func TestEncryptingTransfererUploadsEnvelope(t *testing.T) {
+	require := require.New(t)
+
+	transferer, cas, cleanup := newEncryptingTransfererFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	require.NoError(transferer.Upload(_confidential, blob.Digest, store.NewBufferFileReader(blob.Content)))
+
+	_, err := cas.GetCacheFileStat(blob.Digest.Hex())
+	require.Error(err)
+
+	e, err := transferer.GetTag(encryption.Tag(_confidential, blob.Digest))
+	require.NoError(err)
+	envelope, err := readBlob(t, transferer, "public/model", e)
+	require.NoError(err)
+	require.NotContains(string(envelope), string(blob.Content))
+
+	bi, err := transferer.Stat(_confidential, blob.Digest)
+	require.NoError(err)
+	require.Equal(int64(len(blob.Content)), bi.Size)
+
+	b, err := readBlob(t, transferer, _confidential, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+
+	// Uploading the blob again keeps the existing envelope.
+	require.NoError(transferer.Upload(_confidential, blob.Digest, store.NewBufferFileReader(blob.Content)))
+	e2, err := transferer.GetTag(encryption.Tag(_confidential, blob.Digest))
+	require.NoError(err)
+	require.Equal(e, e2)
+}
+
+func TestEncryptingTransfererPassesThroughPlaintextBlobs(t *testing.T) {
+	require := require.New(t)
+
+	transferer, cas, cleanup := newEncryptingTransfererFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(transferer.Upload("public/model", blob.Digest, store.NewBufferFileReader(blob.Content)))
+
+	_, err := cas.GetCacheFileStat(blob.Digest.Hex())
+	require.NoError(err)
+
+	// Blobs without envelope, such as manifests, are served as is in
+	// encrypted namespaces.
+	for _, namespace := range []string{"public/model", _confidential} {
+		b, err := readBlob(t, transferer, namespace, blob.Digest)
+		require.NoError(err)
+		require.Equal(blob.Content, b)
+	}
+}
+
+func TestEncryptingTransfererDetectsSwappedEnvelope(t *testing.T) {
+	require := require.New(t)
+
+	transferer, _, cleanup := newEncryptingTransfererFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	other := core.NewBlobFixture()
+	for _, b := range []*core.BlobFixture{blob, other} {
+		require.NoError(transferer.Upload(_confidential, b.Digest, store.NewBufferFileReader(b.Content)))
+	}
+
+	e, err := transferer.GetTag(encryption.Tag(_confidential, other.Digest))
+	require.NoError(err)
+	require.NoError(transferer.PutTag(encryption.Tag(_confidential, blob.Digest), e))
+
+	_, err = readBlob(t, transferer, _confidential, blob.Digest)
+	require.Equal(ErrBlobCorrupt, err)
+}
+
+func TestEncryptingTransfererMount(t *testing.T) {
+	require := require.New(t)
+
+	transferer, _, cleanup := newEncryptingTransfererFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+	require.NoError(transferer.Upload("public/model", blob.Digest, store.NewBufferFileReader(blob.Content)))
+
+	require.NoError(transferer.Mount("public/model", _confidential, blob.Digest))
+	_, err := transferer.GetTag(encryption.Tag(_confidential, blob.Digest))
+	require.NoError(err)
+
+	secret := core.NewBlobFixture()
+	require.NoError(transferer.Upload(_confidential, secret.Digest, store.NewBufferFileReader(secret.Content)))
+
+	require.Equal(ErrBlobNotFound, transferer.Mount(_confidential, "public/model", secret.Digest))
+
+	require.NoError(transferer.Mount(_confidential, "confidential/other", secret.Digest))
+	b, err := readBlob(t, transferer, "confidential/other", secret.Digest)
+	require.NoError(err)
+	require.Equal(secret.Content, b)
+}
@@ -20,3 +20,7 @@ var ErrBlobNotFound = errors.New("blob not found")
 
 // ErrTagNotFound is returned when a tag is not found by transferer.
 var ErrTagNotFound = errors.New("tag not found")
+
+// ErrBlobCorrupt is returned when reading a cached blob whose content does not
+// match its digest.
+var ErrBlobCorrupt = errors.New("cached blob is corrupt")
@@ -17,15 +17,22 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/pullstats"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/scheduler"
-	"github.com/uber-go/tally"
+	"github.com/uber/kraken/utils/log"
+	"golang.org/x/sync/singleflight"
 )
 
-var _ ImageTransferer = (*ReadOnlyTransferer)(nil)
+var (
+	_ ImageTransferer = (*ReadOnlyTransferer)(nil)
+	_ Prefetcher      = (*ReadOnlyTransferer)(nil)
+)
 
 // ReadOnlyTransferer gets and posts manifest to tracker, and transfers blobs as torrent.
 type ReadOnlyTransferer struct {
@@ -33,6 +40,22 @@ type ReadOnlyTransferer struct {
 	cads  *store.CADownloadStore
 	tags  tagclient.Client
 	sched scheduler.Scheduler
+	pulls *pullstats.Recorder
+
+	// downloads deduplicates concurrent scheduler downloads of the same blob.
+	downloads singleflight.Group
+
+	verifyCache bool
+}
+
+// ReadOnlyOption allows setting optional ReadOnlyTransferer parameters.
+type ReadOnlyOption func(*ReadOnlyTransferer)
+
+// WithCacheVerification makes the ReadOnlyTransferer verify the digest of
+// cached blobs while they are read. Corrupt blobs fail the read with
+// ErrBlobCorrupt, and are removed and downloaded again.
+func WithCacheVerification() ReadOnlyOption {
+	return func(t *ReadOnlyTransferer) { t.verifyCache = true }
 }
 
 // NewReadOnlyTransferer creates a new ReadOnlyTransferer.
@@ -40,24 +63,36 @@ func NewReadOnlyTransferer(
 	stats tally.Scope,
 	cads *store.CADownloadStore,
 	tags tagclient.Client,
-	sched scheduler.Scheduler) *ReadOnlyTransferer {
+	sched scheduler.Scheduler,
+	pulls *pullstats.Recorder,
+	opts ...ReadOnlyOption) *ReadOnlyTransferer {
 
 	stats = stats.Tagged(map[string]string{
 		"module": "rotransferer",
 	})
 
-	return &ReadOnlyTransferer{stats, cads, tags, sched}
+	t := &ReadOnlyTransferer{
+		stats: stats,
+		cads:  cads,
+		tags:  tags,
+		sched: sched,
+		pulls: pulls,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 // Stat returns blob info from local cache, and triggers download if the blob is
 // not available locally.
 func (t *ReadOnlyTransferer) Stat(namespace string, d core.Digest) (*core.BlobInfo, error) {
-	fi, err := t.cads.Cache().GetFileStat(d.Hex())
+	fi, err := t.cads.Cache().GetFileStat(d.Name())
 	if os.IsNotExist(err) || t.cads.InDownloadError(err) {
-		if err := t.sched.Download(namespace, d); err != nil {
-			return nil, fmt.Errorf("scheduler: %s", err)
+		if err := t.download(namespace, d); err != nil {
+			return nil, fmt.Errorf("scheduler: %w", err)
 		}
-		fi, err = t.cads.Cache().GetFileStat(d.Hex())
+		fi, err = t.cads.Cache().GetFileStat(d.Name())
 		if err != nil {
 			return nil, fmt.Errorf("stat cache: %s", err)
 		}
@@ -69,29 +104,89 @@ func (t *ReadOnlyTransferer) Stat(namespace string, d core.Digest) (*core.BlobIn
 
 // Download downloads blobs as torrent.
 func (t *ReadOnlyTransferer) Download(namespace string, d core.Digest) (store.FileReader, error) {
-	f, err := t.cads.Cache().GetFileReader(d.Hex())
+	f, err := t.cads.Cache().GetFileReader(d.Name())
 	if os.IsNotExist(err) || t.cads.InDownloadError(err) {
-		if err := t.sched.Download(namespace, d); err != nil {
-			return nil, fmt.Errorf("scheduler: %s", err)
+		t.cads.RecordCacheAccess(d.Name(), false)
+		if err := t.download(namespace, d); err != nil {
+			return nil, fmt.Errorf("scheduler: %w", err)
 		}
-		f, err = t.cads.Cache().GetFileReader(d.Hex())
+		f, err = t.cads.Cache().GetFileReader(d.Name())
 		if err != nil {
 			return nil, fmt.Errorf("cache: %s", err)
 		}
 	} else if err != nil {
 		return nil, fmt.Errorf("cache: %s", err)
+	} else {
+		t.cads.RecordCacheAccess(d.Name(), true)
+		if t.verifyCache {
+			f = newVerifyingReader(f, d, func() { t.invalidate(namespace, d) })
+		}
 	}
 	return f, nil
 }
 
+// download downloads d as torrent. Concurrent downloads of d from the same
+// namespace block on a single scheduler download and share its result, since
+// namespaces may have different backends or access rules.
+func (t *ReadOnlyTransferer) download(namespace string, d core.Digest) error {
+	var leader bool
+	_, err, _ := t.downloads.Do(namespace+":"+d.Name(), func() (interface{}, error) {
+		leader = true
+		return nil, t.sched.Download(namespace, d)
+	})
+	if !leader {
+		t.stats.Counter("deduplicated_downloads").Inc(1)
+	}
+	return err
+}
+
+// invalidate removes the corrupt cached blob d and downloads it again, such
+// that retries of the failed read are served the correct blob.
+func (t *ReadOnlyTransferer) invalidate(namespace string, d core.Digest) {
+	t.stats.Counter("corrupt_blobs").Inc(1)
+	log.With("namespace", namespace, "digest", d).Error("Cached blob is corrupt, downloading it again")
+	if err := t.sched.RemoveTorrent(d); err != nil {
+		t.stats.Counter("corrupt_blob_remove_errors").Inc(1)
+		log.With("digest", d).Errorf("Error removing corrupt blob: %s", err)
+		return
+	}
+	go func() {
+		if err := t.download(namespace, d); err != nil {
+			log.With("namespace", namespace, "digest", d).Errorf(
+				"Error downloading corrupt blob again: %s", err)
+		}
+	}()
+}
+
+// Prefetch pre-announces the blobs ds which are not cached yet, such that
+// their downloads are under way by the time they are requested.
+func (t *ReadOnlyTransferer) Prefetch(namespace string, ds []core.Digest) {
+	for _, d := range ds {
+		if _, err := t.cads.Cache().GetFileStat(d.Name()); err == nil {
+			continue
+		}
+		t.stats.Counter("prefetches").Inc(1)
+		t.sched.PreAnnounce(namespace, d)
+	}
+}
+
 // Upload uploads blobs to a torrent network.
 func (t *ReadOnlyTransferer) Upload(namespace string, d core.Digest, blob store.FileReader) error {
 	return errors.New("unsupported operation")
 }
 
+// Mount is not supported.
+func (t *ReadOnlyTransferer) Mount(from, to string, d core.Digest) error {
+	return errors.New("unsupported operation")
+}
+
 // GetTag gets manifest digest for tag.
 func (t *ReadOnlyTransferer) GetTag(tag string) (core.Digest, error) {
+	start := time.Now()
 	d, err := t.tags.Get(tag)
+	if t.pulls != nil {
+		t.pulls.RecordTag(tag, time.Since(start), err)
+	}
 	if err != nil {
 		if err == tagclient.ErrTagNotFound {
 			t.stats.Counter("tag_not_found").Inc(1)
@@ -15,20 +15,25 @@ package transfer
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/pullstats"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
 	"github.com/uber/kraken/mocks/build-index/tagclient"
 	"github.com/uber/kraken/mocks/lib/torrent/scheduler"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
@@ -38,6 +43,7 @@ type agentTransfererMocks struct {
 	cads  *store.CADownloadStore
 	tags  *mocktagclient.MockClient
 	sched *mockscheduler.MockScheduler
+	pulls *pullstats.Recorder
 }
 
 func newReadOnlyTransfererMocks(t *testing.T) (*agentTransfererMocks, func()) {
@@ -53,11 +59,13 @@ func newReadOnlyTransfererMocks(t *testing.T) (*agentTransfererMocks, func()) {
 
 	sched := mockscheduler.NewMockScheduler(ctrl)
 
-	return &agentTransfererMocks{cads, tags, sched}, cleanup.Run
+	pulls := pullstats.New(pullstats.Config{}, tally.NoopScope, clock.NewMock())
+
+	return &agentTransfererMocks{cads, tags, sched, pulls}, cleanup.Run
 }
 
 func (m *agentTransfererMocks) new() *ReadOnlyTransferer {
-	return NewReadOnlyTransferer(tally.NoopScope, m.cads, m.tags, m.sched)
+	return NewReadOnlyTransferer(tally.NoopScope, m.cads, m.tags, m.sched, m.pulls)
 }
 
 func TestReadOnlyTransfererDownloadCachesBlob(t *testing.T) {
@@ -87,6 +95,25 @@ func TestReadOnlyTransfererDownloadCachesBlob(t *testing.T) {
 	}
 }
 
+func TestReadOnlyTransfererPrefetchSkipsCachedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadOnlyTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/repo-bar:latest"
+	cached := core.NewBlobFixture()
+	missing := core.NewBlobFixture()
+
+	require.NoError(store.RunDownload(mocks.cads, cached.Digest, cached.Content))
+
+	mocks.sched.EXPECT().PreAnnounce(namespace, missing.Digest)
+
+	transferer.Prefetch(namespace, []core.Digest{cached.Digest, missing.Digest})
+}
+
 func TestReadOnlyTransfererStat(t *testing.T) {
 	require := require.New(t)
 
@@ -128,6 +155,11 @@ func TestReadOnlyTransfererGetTag(t *testing.T) {
 	d, err := transferer.GetTag(tag)
 	require.NoError(err)
 	require.Equal(manifest, d)
+
+	pulls := mocks.pulls.Recent()
+	require.Len(pulls, 1)
+	require.Equal("docker/some-tag", pulls[0].Repo)
+	require.Contains(pulls[0].Phases, pullstats.PhaseTagResolution)
 }
 
 func TestReadOnlyTransfererGetTagNotFound(t *testing.T) {
@@ -177,11 +209,11 @@ func TestReadOnlyTransfererMultipleDownloadsOfSameBlob(t *testing.T) {
 			return err
 		}
 		return nil
-	}).Times(10)
+	})
 
 	// Multiple clients trying to download the same file which is already in
-	// the download state should queue up until the file has been committed to
-	// the cache.
+	// the download state should share a single scheduler download and queue
+	// up until the file has been committed to the cache.
 	var wg sync.WaitGroup
 	for i := 0; i < 10; i++ {
 		wg.Add(1)
@@ -201,3 +233,132 @@ func TestReadOnlyTransfererMultipleDownloadsOfSameBlob(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestReadOnlyTransfererDownloadRemovesCorruptCachedBlob(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadOnlyTransfererMocks(t)
+	defer cleanup()
+
+	// Skip verification on commit, such that a corrupt blob can be cached.
+	dir, err := ioutil.TempDir("", "ro_transferer_test")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	cads, err := store.NewCADownloadStore(store.CADownloadStoreConfig{
+		DownloadDir:          filepath.Join(dir, "download"),
+		CacheDir:             filepath.Join(dir, "cache"),
+		SkipHashVerification: true,
+	}, tally.NoopScope)
+	require.NoError(err)
+	defer cads.Close()
+
+	transferer := NewReadOnlyTransferer(
+		tally.NoopScope, cads, mocks.tags, mocks.sched, mocks.pulls, WithCacheVerification())
+
+	namespace := "docker/repo-bar:latest"
+	blob := core.NewBlobFixture()
+	corrupt := append([]byte{}, blob.Content...)
+	corrupt[0]++
+
+	require.NoError(store.RunDownload(cads, blob.Digest, corrupt))
+
+	downloaded := make(chan struct{})
+	mocks.sched.EXPECT().RemoveTorrent(blob.Digest).Return(nil)
+	mocks.sched.EXPECT().Download(namespace, blob.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) error {
+			close(downloaded)
+			return nil
+		})
+
+	result, err := transferer.Download(namespace, blob.Digest)
+	require.NoError(err)
+	_, err = ioutil.ReadAll(result)
+	require.Equal(ErrBlobCorrupt, err)
+
+	select {
+	case <-downloaded:
+	case <-time.After(5 * time.Second):
+		require.FailNow("corrupt blob was not downloaded again")
+	}
+}
+
+func TestReadOnlyTransfererConcurrentDownloadsShareError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadOnlyTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/repo-bar:latest"
+	blob := core.NewBlobFixture()
+
+	fail := make(chan struct{})
+
+	mocks.sched.EXPECT().Download(
+		namespace, blob.Digest).DoAndReturn(func(namespace string, d core.Digest) error {
+
+		<-fail
+		return scheduler.ErrTorrentNotFound
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := transferer.Stat(namespace, blob.Digest)
+			require.True(errors.Is(err, scheduler.ErrTorrentNotFound))
+		}()
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	close(fail)
+
+	wg.Wait()
+}
+
+func TestReadOnlyTransfererDeduplicatesDownloadsPerNamespace(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadOnlyTransfererMocks(t)
+	defer cleanup()
+
+	stats := tally.NewTestScope("", nil)
+	transferer := NewReadOnlyTransferer(stats, mocks.cads, mocks.tags, mocks.sched, mocks.pulls)
+
+	namespaces := []string{"docker/repo-foo:latest", "docker/repo-bar:latest"}
+	blob := core.NewBlobFixture()
+
+	release := make(chan struct{})
+	for _, namespace := range namespaces {
+		mocks.sched.EXPECT().Download(
+			namespace, blob.Digest).DoAndReturn(func(namespace string, d core.Digest) error {
+
+			<-release
+			return scheduler.ErrTorrentNotFound
+		})
+	}
+
+	var wg sync.WaitGroup
+	for _, namespace := range namespaces {
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(namespace string) {
+				defer wg.Done()
+				_, err := transferer.Stat(namespace, blob.Digest)
+				require.True(errors.Is(err, scheduler.ErrTorrentNotFound))
+			}(namespace)
+		}
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	close(release)
+
+	wg.Wait()
+
+	// Only callers which shared the download of another caller are counted.
+	require.Equal(int64(8), stats.Snapshot().Counters()["deduplicated_downloads+module=rotransferer"].Value())
+}
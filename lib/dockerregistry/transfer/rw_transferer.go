@@ -18,6 +18,7 @@ import (
 	"os"
 
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/origin/blobclient"
@@ -52,7 +53,7 @@ func NewReadWriteTransferer(
 
 // Stat returns blob info from origin cluster or local cache.
 func (t *ReadWriteTransferer) Stat(namespace string, d core.Digest) (*core.BlobInfo, error) {
-	fi, err := t.cas.GetCacheFileStat(d.Hex())
+	fi, err := t.cas.GetCacheFileStat(d.Name())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return t.originStat(namespace, d)
@@ -78,10 +79,48 @@ func (t *ReadWriteTransferer) originStat(namespace string, d core.Digest) (*core
 	return bi, nil
 }
 
+// OriginStat returns blob info from the origin cluster only. Unlike Stat,
+// errors other than ErrBlobNotFound are returned as is.
+func (t *ReadWriteTransferer) OriginStat(namespace string, d core.Digest) (*core.BlobInfo, error) {
+	bi, err := t.originCluster.Stat(namespace, d)
+	if err == blobclient.ErrBlobNotFound {
+		return nil, ErrBlobNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("origin stat: %s", err)
+	}
+	return bi, nil
+}
+
+// WriteBackState returns whether origins have persisted d to the storage
+// backend.
+func (t *ReadWriteTransferer) WriteBackState(
+	namespace string, d core.Digest) (blobclient.WriteBackState, error) {
+
+	state, err := t.originCluster.GetWriteBackState(namespace, d)
+	if err == blobclient.ErrBlobNotFound {
+		return "", ErrBlobNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("origin write-back state: %s", err)
+	}
+	return state, nil
+}
+
+// ReplicationStatus returns whether each remote build-index points tag to
+// its local digest.
+func (t *ReadWriteTransferer) ReplicationStatus(tag string) (tagmodels.ReplicationStatus, error) {
+	status, err := t.tags.ReplicationStatus(tag)
+	if err == tagclient.ErrTagNotFound {
+		return status, ErrTagNotFound
+	} else if err != nil {
+		return status, fmt.Errorf("tag replication status: %s", err)
+	}
+	return status, nil
+}
+
 // Download downloads the blob of name into the file store and returns a reader
 // to the newly downloaded file.
 func (t *ReadWriteTransferer) Download(namespace string, d core.Digest) (store.FileReader, error) {
-	blob, err := t.cas.GetCacheFileReader(d.Hex())
+	blob, err := t.cas.GetCacheFileReader(d.Name())
 	if err != nil {
 		if os.IsNotExist(err) {
 			return t.downloadFromOrigin(namespace, d)
@@ -92,7 +131,7 @@ func (t *ReadWriteTransferer) Download(namespace string, d core.Digest) (store.F
 }
 
 func (t *ReadWriteTransferer) downloadFromOrigin(namespace string, d core.Digest) (store.FileReader, error) {
-	tmp := fmt.Sprintf("%s.%s", d.Hex(), uuid.Generate().String())
+	tmp := fmt.Sprintf("%s.%s", d.Name(), uuid.Generate().String())
 	if err := t.cas.CreateUploadFile(tmp, 0); err != nil {
 		return nil, fmt.Errorf("create upload file: %s", err)
 	}
@@ -107,10 +146,10 @@ func (t *ReadWriteTransferer) downloadFromOrigin(namespace string, d core.Digest
 		}
 		return nil, fmt.Errorf("origin: %s", err)
 	}
-	if err := t.cas.MoveUploadFileToCache(tmp, d.Hex()); err != nil && !os.IsExist(err) {
+	if err := t.cas.MoveUploadFileToCache(tmp, d.Name()); err != nil && !os.IsExist(err) {
 		return nil, fmt.Errorf("move upload file to cache: %s", err)
 	}
-	blob, err := t.cas.GetCacheFileReader(d.Hex())
+	blob, err := t.cas.GetCacheFileReader(d.Name())
 	if err != nil {
 		return nil, fmt.Errorf("get cache file: %s", err)
 	}
@@ -124,6 +163,20 @@ func (t *ReadWriteTransferer) Upload(
 	return t.originCluster.UploadBlob(namespace, d, blob)
 }
 
+// Mount makes blob d, which was pushed under namespace from, available under
+// namespace to without the client uploading it again. Returns ErrBlobNotFound
+// if d does not exist under from. Origins skip the upload of blobs they
+// already have and only write them back under the new namespace, so d is only
+// downloaded from origins if it is not in the local cache.
+func (t *ReadWriteTransferer) Mount(from, to string, d core.Digest) error {
+	blob, err := t.Download(from, d)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	return t.originCluster.UploadBlob(to, d, blob)
+}
+
 // GetTag returns the manifest digest for tag.
 func (t *ReadWriteTransferer) GetTag(tag string) (core.Digest, error) {
 	d, err := t.tags.Get(tag)
@@ -20,10 +20,12 @@ import (
 	"testing"
 
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/mocks/build-index/tagclient"
 	"github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/dockerutil"
 	"github.com/uber/kraken/utils/mockutil"
 	"github.com/uber/kraken/utils/testutil"
@@ -83,6 +85,42 @@ func TestReadWriteTransfererDownloadCachesBlob(t *testing.T) {
 	}
 }
 
+func TestReadWriteTransfererMount(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	blob := core.NewBlobFixture()
+
+	gomock.InOrder(
+		mocks.originCluster.EXPECT().DownloadBlob(
+			"base", blob.Digest, mockutil.MatchWriter(blob.Content)).Return(nil),
+		mocks.originCluster.EXPECT().UploadBlob(
+			"derived", blob.Digest, mockutil.MatchReader(blob.Content)).Return(nil),
+	)
+
+	require.NoError(transferer.Mount("base", "derived", blob.Digest))
+}
+
+func TestReadWriteTransfererMountNotFound(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	d := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().DownloadBlob(
+		"base", d, gomock.Any()).Return(blobclient.ErrBlobNotFound)
+
+	require.Equal(ErrBlobNotFound, transferer.Mount("base", "derived", d))
+}
+
 func TestReadWriteTransfererGetTag(t *testing.T) {
 	require := require.New(t)
 
@@ -193,3 +231,76 @@ func TestReadWriteTransfererStatNotFoundOnAnyOriginError(t *testing.T) {
 	_, err := transferer.Stat(namespace, blob.Digest)
 	require.Equal(ErrBlobNotFound, err)
 }
+
+func TestReadWriteTransfererOriginStatSkipsCache(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/test-image"
+	blob := core.NewBlobFixture()
+
+	require.NoError(mocks.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	mocks.originCluster.EXPECT().Stat(namespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
+
+	_, err := transferer.OriginStat(namespace, blob.Digest)
+	require.Equal(ErrBlobNotFound, err)
+
+	mocks.originCluster.EXPECT().Stat(namespace, blob.Digest).Return(nil, errors.New("some error"))
+
+	_, err = transferer.OriginStat(namespace, blob.Digest)
+	require.Error(err)
+	require.NotEqual(ErrBlobNotFound, err)
+}
+
+func TestReadWriteTransfererWriteBackState(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	namespace := "docker/test-image"
+	d := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().GetWriteBackState(namespace, d).Return(blobclient.WriteBackDone, nil)
+
+	state, err := transferer.WriteBackState(namespace, d)
+	require.NoError(err)
+	require.Equal(blobclient.WriteBackDone, state)
+
+	mocks.originCluster.EXPECT().GetWriteBackState(namespace, d).Return(
+		blobclient.WriteBackState(""), blobclient.ErrBlobNotFound)
+
+	_, err = transferer.WriteBackState(namespace, d)
+	require.Equal(ErrBlobNotFound, err)
+}
+
+func TestReadWriteTransfererReplicationStatus(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newReadWriteTransfererMocks(t)
+	defer cleanup()
+
+	transferer := mocks.new()
+
+	tag := "docker/test-image:tag"
+	status := tagmodels.ReplicationStatus{Tag: tag, Digest: core.DigestFixture()}
+
+	mocks.tags.EXPECT().ReplicationStatus(tag).Return(status, nil)
+
+	result, err := transferer.ReplicationStatus(tag)
+	require.NoError(err)
+	require.Equal(status, result)
+
+	mocks.tags.EXPECT().ReplicationStatus(tag).Return(
+		tagmodels.ReplicationStatus{}, tagclient.ErrTagNotFound)
+
+	_, err = transferer.ReplicationStatus(tag)
+	require.Equal(ErrTagNotFound, err)
+}
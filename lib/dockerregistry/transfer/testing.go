@@ -45,7 +45,7 @@ func NewTestTransferer(cas *store.CAStore) ImageTransferer {
 
 // Stat returns blob info from local cache.
 func (t *testTransferer) Stat(namespace string, d core.Digest) (*core.BlobInfo, error) {
-	fi, err := t.cas.GetCacheFileStat(d.Hex())
+	fi, err := t.cas.GetCacheFileStat(d.Name())
 	if err != nil {
 		return nil, fmt.Errorf("stat cache file: %w", err)
 	}
@@ -53,11 +53,16 @@ func (t *testTransferer) Stat(namespace string, d core.Digest) (*core.BlobInfo,
 }
 
 func (t *testTransferer) Download(namespace string, d core.Digest) (store.FileReader, error) {
-	return t.cas.GetCacheFileReader(d.Hex())
+	return t.cas.GetCacheFileReader(d.Name())
+}
+
+func (t *testTransferer) Mount(from, to string, d core.Digest) error {
+	_, err := t.Stat(from, d)
+	return err
 }
 
 func (t *testTransferer) Upload(namespace string, d core.Digest, blob store.FileReader) error {
-	return t.cas.CreateCacheFile(d.Hex(), blob)
+	return t.cas.CreateCacheFile(d.Name(), blob)
 }
 
 func (t *testTransferer) GetTag(tag string) (core.Digest, error) {
@@ -14,8 +14,10 @@
 package transfer
 
 import (
+	"github.com/uber/kraken/build-index/tagmodels"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/origin/blobclient"
 )
 
 // ImageTransferer defines an interface that transfers images
@@ -23,8 +25,33 @@ type ImageTransferer interface {
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	Download(namespace string, d core.Digest) (store.FileReader, error)
 	Upload(namespace string, d core.Digest, blob store.FileReader) error
+	Mount(from, to string, d core.Digest) error
 
 	GetTag(tag string) (core.Digest, error)
 	PutTag(tag string, d core.Digest) error
 	ListTags(prefix string) ([]string, error)
 }
+
+// Prefetcher is implemented by ImageTransferers which can start downloading
+// blobs before they are requested.
+type Prefetcher interface {
+	Prefetch(namespace string, ds []core.Digest)
+}
+
+// OriginStater is implemented by ImageTransferers which can check whether
+// origins have a blob without consulting any local cache.
+type OriginStater interface {
+	OriginStat(namespace string, d core.Digest) (*core.BlobInfo, error)
+}
+
+// WriteBackStater is implemented by ImageTransferers which can check whether
+// origins have persisted a blob to the storage backend.
+type WriteBackStater interface {
+	WriteBackState(namespace string, d core.Digest) (blobclient.WriteBackState, error)
+}
+
+// ReplicationStater is implemented by ImageTransferers which can check
+// whether a tag has been replicated to remote clusters.
+type ReplicationStater interface {
+	ReplicationStatus(tag string) (tagmodels.ReplicationStatus, error)
+}
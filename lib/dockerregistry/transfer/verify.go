@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"io"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+)
+
+// verifyingReader hashes a cached blob while it is read sequentially from the
+// start, and fails the last read of the blob with ErrBlobCorrupt if the blob
+// does not match its digest. Seeking anywhere but the start, or to the current
+// position, stops verification.
+type verifyingReader struct {
+	store.FileReader
+	d         core.Digest
+	digester  *core.Digester
+	tee       io.Reader
+	pos       int64
+	verifying bool
+	onCorrupt func()
+}
+
+func newVerifyingReader(f store.FileReader, d core.Digest, onCorrupt func()) store.FileReader {
+	r := &verifyingReader{FileReader: f, d: d, onCorrupt: onCorrupt}
+	r.reset()
+	return r
+}
+
+func (r *verifyingReader) reset() {
+	digester, err := core.NewDigesterForAlgo(r.d.Algo())
+	if err != nil {
+		r.verifying = false
+		return
+	}
+	r.digester = digester
+	r.tee = digester.Tee(r.FileReader)
+	r.pos = 0
+	r.verifying = true
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	if !r.verifying {
+		return r.FileReader.Read(p)
+	}
+	n, err := r.tee.Read(p)
+	r.pos += int64(n)
+	// Readers which know the size of the blob may stop before io.EOF.
+	if err == io.EOF || r.pos == r.Size() {
+		r.verifying = false
+		if r.digester.Digest() != r.d {
+			r.onCorrupt()
+			return n, ErrBlobCorrupt
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.FileReader.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	if pos == 0 {
+		r.reset()
+	} else if pos != r.pos {
+		r.verifying = false
+	}
+	return pos, nil
+}
+
+// WriteTo copies through Read, such that io.Copy does not bypass verification.
+func (r *verifyingReader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, struct{ io.Reader }{r})
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	blob := core.NewBlobFixture()
+	corrupt := append([]byte{}, blob.Content...)
+	corrupt[0]++
+
+	tests := []struct {
+		desc    string
+		content []byte
+		read    func(r store.FileReader) error
+		corrupt bool
+	}{
+		{
+			"read all",
+			blob.Content,
+			func(r store.FileReader) error { _, err := ioutil.ReadAll(r); return err },
+			false,
+		}, {
+			"read all corrupt",
+			corrupt,
+			func(r store.FileReader) error { _, err := ioutil.ReadAll(r); return err },
+			true,
+		}, {
+			"copy corrupt",
+			corrupt,
+			func(r store.FileReader) error { _, err := io.Copy(ioutil.Discard, r); return err },
+			true,
+		}, {
+			"read size corrupt",
+			corrupt,
+			func(r store.FileReader) error {
+				// CopyN drops the error once it copied all bytes, as when
+				// serving a blob with http.ServeContent, so only onCorrupt
+				// reports the corruption.
+				if _, err := io.CopyN(ioutil.Discard, r, r.Size()); err != nil {
+					return err
+				}
+				return ErrBlobCorrupt
+			},
+			true,
+		}, {
+			"seek to start corrupt",
+			corrupt,
+			func(r store.FileReader) error {
+				if _, err := io.CopyN(ioutil.Discard, r, 10); err != nil {
+					return err
+				}
+				if _, err := r.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				_, err := ioutil.ReadAll(r)
+				return err
+			},
+			true,
+		}, {
+			"seek to middle corrupt",
+			corrupt,
+			func(r store.FileReader) error {
+				if _, err := r.Seek(10, io.SeekStart); err != nil {
+					return err
+				}
+				_, err := ioutil.ReadAll(r)
+				return err
+			},
+			false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			var corrupted int
+			r := newVerifyingReader(
+				store.NewBufferFileReader(test.content), blob.Digest, func() { corrupted++ })
+
+			err := test.read(r)
+			if test.corrupt {
+				require.Equal(ErrBlobCorrupt, err)
+				require.Equal(1, corrupted)
+			} else {
+				require.NoError(err)
+				require.Equal(0, corrupted)
+			}
+		})
+	}
+}
+
+func TestVerifyingReaderReturnsContent(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+
+	r := newVerifyingReader(
+		store.NewBufferFileReader(blob.Content), blob.Digest, func() {})
+
+	var b bytes.Buffer
+	_, err := io.Copy(&b, r)
+	require.NoError(err)
+	require.Equal(blob.Content, b.Bytes())
+}
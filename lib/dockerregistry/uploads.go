@@ -127,7 +127,7 @@ func (u *casUploads) putBlobContent(path string, content []byte) error {
 	if err != nil {
 		return fmt.Errorf("get digest: %s", err)
 	}
-	if err := u.cas.CreateCacheFile(d.Hex(), bytes.NewReader(content)); err != nil {
+	if err := u.cas.CreateCacheFile(d.Name(), bytes.NewReader(content)); err != nil {
 		return fmt.Errorf("create cache file: %w", err)
 	}
 	if err := u.transferer.Upload("TODO", d, store.NewBufferFileReader(content)); err != nil {
@@ -198,14 +198,18 @@ func (u *casUploads) move(uploadPath, blobPath string) error {
 	if err != nil {
 		return fmt.Errorf("get blob uuid: %s", err)
 	}
-	if err := u.cas.MoveUploadFileToCache(uuid, d.Hex()); err != nil {
+	repo, err := GetRepo(uploadPath)
+	if err != nil {
+		return fmt.Errorf("get repo: %s", err)
+	}
+	if err := u.cas.MoveUploadFileToCache(uuid, d.Name()); err != nil {
 		return fmt.Errorf("move upload file to cache: %w", err)
 	}
-	f, err := u.cas.GetCacheFileReader(d.Hex())
+	f, err := u.cas.GetCacheFileReader(d.Name())
 	if err != nil {
 		return fmt.Errorf("get cache file: %w", err)
 	}
-	if err := u.transferer.Upload("TODO", d, f); err != nil {
+	if err := u.transferer.Upload(repo, d, f); err != nil {
 		return fmt.Errorf("upload: %w", err)
 	}
 	return nil
@@ -0,0 +1,72 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package encryption
+
+import "os"
+
+// Config defines which namespaces are encrypted, and how their keys are
+// managed.
+type Config struct {
+	// Namespaces lists the namespaces whose blobs are encrypted. Namespaces
+	// not matching any entry are not encrypted.
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+
+	KMS KMSConfig `yaml:"kms"`
+
+	// TempDir is where blobs are encrypted to before they are uploaded.
+	// Defaults to the system temp directory.
+	TempDir string `yaml:"temp_dir"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.TempDir == "" {
+		c.TempDir = os.TempDir()
+	}
+	return c
+}
+
+// Enabled returns true if any namespace is encrypted.
+func (c Config) Enabled() bool {
+	return len(c.Namespaces) > 0
+}
+
+// NamespaceConfig maps namespaces to the key their blobs are encrypted with.
+type NamespaceConfig struct {
+	// Namespace is a regexp matching the namespaces.
+	Namespace string `yaml:"namespace"`
+
+	// KeyID identifies the namespace key in the KMS.
+	KeyID string `yaml:"key_id"`
+}
+
+// KMSConfig defines the key management service which holds namespace keys.
+type KMSConfig struct {
+	// Backend is either "local" or "aws".
+	Backend string         `yaml:"backend"`
+	Local   LocalKMSConfig `yaml:"local"`
+	AWS     AWSKMSConfig   `yaml:"aws"`
+}
+
+// LocalKMSConfig defines a KMS whose namespace keys are read from local files,
+// meant for development and testing.
+type LocalKMSConfig struct {
+	// Keys maps key ids to files containing base64 encoded 32 byte keys.
+	Keys map[string]string `yaml:"keys"`
+}
+
+// AWSKMSConfig defines a KMS backed by AWS KMS. Credentials are taken from the
+// default credential chain.
+type AWSKMSConfig struct {
+	Region string `yaml:"region"`
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package encryption
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/uber/kraken/lib/store"
+)
+
+// Envelopes start with a fixed size header holding the id of the namespace
+// key and the data key wrapped with it, followed by the blob split into chunks
+// which are sealed with the data key. Each chunk is authenticated along with
+// its index, whether it is the last chunk, and the header, such that chunks
+// cannot be reordered, truncated or moved to other envelopes.
+const (
+	magic       = "KRKE"
+	version     = 1
+	headerSize  = 1024
+	chunkSize   = 64 * 1024
+	tagSize     = 16
+	dataKeySize = 32
+)
+
+type header struct {
+	keyID   string
+	wrapped []byte
+}
+
+func (h header) marshal() ([]byte, error) {
+	b := make([]byte, headerSize)
+	copy(b, magic)
+	b[len(magic)] = version
+	off := len(magic) + 1
+	for _, field := range [][]byte{[]byte(h.keyID), h.wrapped} {
+		if off+2+len(field) > headerSize {
+			return nil, errors.New("header exceeds size limit")
+		}
+		binary.BigEndian.PutUint16(b[off:], uint16(len(field)))
+		off += 2
+		off += copy(b[off:], field)
+	}
+	return b, nil
+}
+
+func unmarshalHeader(b []byte) (header, error) {
+	if len(b) != headerSize || string(b[:len(magic)]) != magic {
+		return header{}, errors.New("not an envelope")
+	}
+	if b[len(magic)] != version {
+		return header{}, fmt.Errorf("unsupported envelope version %d", b[len(magic)])
+	}
+	off := len(magic) + 1
+	var fields [][]byte
+	for i := 0; i < 2; i++ {
+		if off+2 > headerSize {
+			return header{}, errors.New("truncated header")
+		}
+		n := int(binary.BigEndian.Uint16(b[off:]))
+		off += 2
+		if off+n > headerSize {
+			return header{}, errors.New("truncated header")
+		}
+		fields = append(fields, b[off:off+n])
+		off += n
+	}
+	return header{string(fields[0]), append([]byte(nil), fields[1]...)}, nil
+}
+
+// chunkNonce returns the nonce of chunk i. Data keys are never reused across
+// envelopes, so nonces only need to be unique within an envelope.
+func chunkNonce(i int64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, uint64(i))
+	if final {
+		nonce[8] = 1
+	}
+	return nonce
+}
+
+// encrypt writes the envelope of r to w. The last chunk holds the remainder of
+// r, and is empty if the size of r is a multiple of the chunk size.
+func encrypt(w io.Writer, r io.Reader, h header, dataKey []byte) error {
+	hb, err := h.marshal()
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return fmt.Errorf("aead: %s", err)
+	}
+	if _, err := w.Write(hb); err != nil {
+		return fmt.Errorf("write header: %s", err)
+	}
+	buf := make([]byte, chunkSize)
+	var sealed []byte
+	for i := int64(0); ; i++ {
+		n, err := io.ReadFull(r, buf)
+		final := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !final {
+			return fmt.Errorf("read blob: %s", err)
+		}
+		sealed = aead.Seal(sealed[:0], chunkNonce(i, final), buf[:n], hb)
+		if _, err := w.Write(sealed); err != nil {
+			return fmt.Errorf("write chunk: %s", err)
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// envelopeChunks returns the number of chunks and the plaintext size of an
+// envelope of size bytes.
+func envelopeChunks(size int64) (chunks int64, plaintext int64, err error) {
+	body := size - headerSize
+	if body < tagSize {
+		return 0, 0, fmt.Errorf("invalid envelope size %d", size)
+	}
+	full := body / (chunkSize + tagSize)
+	rem := body % (chunkSize + tagSize)
+	if rem < tagSize {
+		return 0, 0, fmt.Errorf("invalid envelope size %d", size)
+	}
+	return full + 1, full*chunkSize + rem - tagSize, nil
+}
+
+// PlaintextSize returns the size of the blob in an envelope of size bytes.
+func PlaintextSize(size int64) (int64, error) {
+	_, n, err := envelopeChunks(size)
+	return n, err
+}
+
+// reader decrypts an envelope. Chunks are decrypted on demand, so reads at
+// any offset only decrypt the chunks they cover.
+type reader struct {
+	f      store.FileReader
+	aead   cipher.AEAD
+	header []byte
+	chunks int64
+	size   int64
+
+	mu    sync.Mutex
+	chunk int64 // Index of the chunk in buf, -1 if none.
+	raw   []byte
+	buf   []byte
+
+	pos int64
+}
+
+func newReader(f store.FileReader, hb []byte, dataKey []byte) (*reader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("aead: %s", err)
+	}
+	chunks, size, err := envelopeChunks(f.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &reader{
+		f:      f,
+		aead:   aead,
+		header: hb,
+		chunks: chunks,
+		size:   size,
+		chunk:  -1,
+		raw:    make([]byte, chunkSize+tagSize),
+	}, nil
+}
+
+// load decrypts chunk i into buf.
+func (r *reader) load(i int64) error {
+	if r.chunk == i {
+		return nil
+	}
+	start := headerSize + i*(chunkSize+tagSize)
+	length := int64(chunkSize + tagSize)
+	final := i == r.chunks-1
+	if final {
+		length = r.f.Size() - start
+	}
+	raw := r.raw[:length]
+	if n, err := r.f.ReadAt(raw, start); n < len(raw) {
+		return fmt.Errorf("read chunk %d: %s", i, err)
+	}
+	plain, err := r.aead.Open(r.buf[:0], chunkNonce(i, final), raw, r.header)
+	if err != nil {
+		r.chunk = -1
+		return fmt.Errorf("decrypt chunk %d: %s", i, err)
+	}
+	r.buf = plain
+	r.chunk = i
+	return nil
+}
+
+func (r *reader) Size() int64 {
+	return r.size
+}
+
+func (r *reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for n < len(p) && off < r.size {
+		i := off / chunkSize
+		if err := r.load(i); err != nil {
+			return n, err
+		}
+		c := copy(p[n:], r.buf[off-i*chunkSize:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		// Authenticate the final chunk before reporting the end of the blob,
+		// even if it is empty, such that truncated envelopes fail.
+		if err := r.load(r.chunks - 1); err != nil {
+			return n, err
+		}
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.pos = pos
+	return pos, nil
+}
+
+// WriteTo copies through Read, such that io.Copy reads plaintext.
+func (r *reader) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, struct{ io.Reader }{r})
+}
+
+func (r *reader) Close() error {
+	return r.f.Close()
+}
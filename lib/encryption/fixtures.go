@@ -0,0 +1,53 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// KeyringFixture returns a Keyring which encrypts namespaces matching
+// namespace with a local key, and a function which cleans up its files.
+func KeyringFixture(namespace string) (*Keyring, func()) {
+	dir, err := ioutil.TempDir("", "encryption")
+	if err != nil {
+		panic(err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	path := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		panic(err)
+	}
+	k, err := NewKeyring(Config{
+		Namespaces: []NamespaceConfig{{Namespace: namespace, KeyID: "fixture"}},
+		KMS: KMSConfig{
+			Backend: "local",
+			Local:   LocalKMSConfig{Keys: map[string]string{"fixture": path}},
+		},
+		TempDir: dir,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return k, cleanup
+}
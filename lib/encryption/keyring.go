@@ -0,0 +1,178 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+)
+
+// tagPrefix is the repository prefix of the tags which map blobs of encrypted
+// namespaces to their envelopes.
+const tagPrefix = "_encrypted"
+
+// Tag returns the tag which maps blob d of namespace to the digest of its
+// envelope.
+func Tag(namespace string, d core.Digest) string {
+	return fmt.Sprintf("%s/%s:%s", tagPrefix, namespace, d.Hex())
+}
+
+type namespaceKey struct {
+	regexp *regexp.Regexp
+	keyID  string
+}
+
+// Keyring encrypts blobs of confidential namespaces into envelopes, and
+// decrypts them again. Each envelope is encrypted with a fresh data key, which
+// is stored in the envelope wrapped with the namespace key in the KMS.
+type Keyring struct {
+	config     Config
+	namespaces []namespaceKey
+	kms        KMS
+}
+
+// NewKeyring creates a new Keyring.
+func NewKeyring(config Config) (*Keyring, error) {
+	config = config.applyDefaults()
+	var namespaces []namespaceKey
+	for _, ns := range config.Namespaces {
+		re, err := regexp.Compile(ns.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", ns.Namespace, err)
+		}
+		if ns.KeyID == "" {
+			return nil, fmt.Errorf("namespace %s: key_id required", ns.Namespace)
+		}
+		namespaces = append(namespaces, namespaceKey{re, ns.KeyID})
+	}
+	kms, err := newKMS(config.KMS)
+	if err != nil {
+		return nil, fmt.Errorf("kms: %s", err)
+	}
+	return &Keyring{config, namespaces, kms}, nil
+}
+
+func (k *Keyring) keyID(namespace string) (string, bool) {
+	for _, ns := range k.namespaces {
+		if ns.regexp.MatchString(namespace) {
+			return ns.keyID, true
+		}
+	}
+	return "", false
+}
+
+// Encrypted returns true if blobs of namespace are encrypted.
+func (k *Keyring) Encrypted(namespace string) bool {
+	_, ok := k.keyID(namespace)
+	return ok
+}
+
+// Encrypt writes the envelope of blob r of namespace to w.
+func (k *Keyring) Encrypt(namespace string, w io.Writer, r io.Reader) error {
+	keyID, ok := k.keyID(namespace)
+	if !ok {
+		return fmt.Errorf("namespace %s is not encrypted", namespace)
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return fmt.Errorf("data key: %s", err)
+	}
+	wrapped, err := k.kms.Wrap(keyID, dataKey)
+	if err != nil {
+		return fmt.Errorf("wrap data key: %s", err)
+	}
+	return encrypt(w, r, header{keyID, wrapped}, dataKey)
+}
+
+// EncryptToFile writes the envelope of blob r of namespace to a temporary
+// file, and returns a reader of the envelope along with its digest. The file is
+// removed when the reader is closed.
+func (k *Keyring) EncryptToFile(namespace string, r io.Reader) (store.FileReader, core.Digest, error) {
+	f, err := ioutil.TempFile(k.config.TempDir, "envelope")
+	if err != nil {
+		return nil, core.Digest{}, fmt.Errorf("create temp file: %s", err)
+	}
+	envelope := &tempFile{f}
+	h := sha256.New()
+	if err := k.Encrypt(namespace, io.MultiWriter(f, h), r); err != nil {
+		envelope.Close()
+		return nil, core.Digest{}, err
+	}
+	d, err := core.NewSHA256DigestFromHex(hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		envelope.Close()
+		return nil, core.Digest{}, fmt.Errorf("digest: %s", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		envelope.Close()
+		return nil, core.Digest{}, fmt.Errorf("seek: %s", err)
+	}
+	return envelope, d, nil
+}
+
+// Decrypt returns a reader of the blob in envelope f of namespace. Closing the
+// reader closes f.
+func (k *Keyring) Decrypt(namespace string, f store.FileReader) (store.FileReader, error) {
+	if !k.Encrypted(namespace) {
+		return nil, fmt.Errorf("namespace %s is not encrypted", namespace)
+	}
+	hb := make([]byte, headerSize)
+	if n, err := f.ReadAt(hb, 0); n < headerSize {
+		return nil, fmt.Errorf("read header: %s", err)
+	}
+	h, err := unmarshalHeader(hb)
+	if err != nil {
+		return nil, err
+	}
+	// The header names the key the envelope was encrypted with, which may be
+	// a previous key of the namespace. The KMS decides whether this component
+	// may unwrap it.
+	dataKey, err := k.kms.Unwrap(h.keyID, h.wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %s", err)
+	}
+	return newReader(f, hb, dataKey)
+}
+
+// tempFile is a store.FileReader of a temporary file, which is removed on
+// Close.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Size() int64 {
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (f *tempFile) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, struct{ io.Reader }{f.File})
+}
+
+func (f *tempFile) Close() error {
+	defer os.Remove(f.Name())
+	return f.File.Close()
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encryptBlob(t *testing.T, k *Keyring, namespace string, blob []byte) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, k.Encrypt(namespace, &buf, bytes.NewReader(blob)))
+	return buf.Bytes()
+}
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	k, cleanup := KeyringFixture("^secret/.*")
+	defer cleanup()
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		require := require.New(t)
+
+		blob := randutil.Text(uint64(size))
+		envelope := encryptBlob(t, k, "secret/model", blob)
+		if size > chunkSize {
+			require.NotContains(string(envelope), string(blob[:chunkSize]))
+		}
+
+		n, err := PlaintextSize(int64(len(envelope)))
+		require.NoError(err)
+		require.Equal(int64(size), n)
+
+		r, err := k.Decrypt("secret/model", store.NewBufferFileReader(envelope))
+		require.NoError(err)
+		require.Equal(int64(size), r.Size())
+		b, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		require.Equal(blob, b)
+	}
+}
+
+func TestKeyringDecryptReadAt(t *testing.T) {
+	require := require.New(t)
+
+	k, cleanup := KeyringFixture("^secret/.*")
+	defer cleanup()
+
+	blob := randutil.Text(uint64(3*chunkSize + 17))
+	envelope := encryptBlob(t, k, "secret/model", blob)
+
+	r, err := k.Decrypt("secret/model", store.NewBufferFileReader(envelope))
+	require.NoError(err)
+
+	p := make([]byte, chunkSize+10)
+	n, err := r.ReadAt(p, chunkSize-5)
+	require.NoError(err)
+	require.Equal(len(p), n)
+	require.Equal(blob[chunkSize-5:2*chunkSize+5], p)
+
+	n, err = r.ReadAt(p, int64(len(blob))-7)
+	require.Equal(io.EOF, err)
+	require.Equal(blob[len(blob)-7:], p[:n])
+
+	_, err = r.Seek(2*chunkSize, io.SeekStart)
+	require.NoError(err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob[2*chunkSize:], b)
+}
+
+func TestKeyringDecryptTamperedEnvelope(t *testing.T) {
+	k, cleanup := KeyringFixture("^secret/.*")
+	defer cleanup()
+
+	blob := randutil.Text(uint64(2 * chunkSize))
+	envelope := encryptBlob(t, k, "secret/model", blob)
+
+	tests := []struct {
+		desc   string
+		tamper func(b []byte) []byte
+	}{
+		{"flipped bit", func(b []byte) []byte {
+			b[headerSize+chunkSize+tagSize+3]++
+			return b
+		}},
+		{"dropped final chunk", func(b []byte) []byte {
+			return b[:len(b)-tagSize]
+		}},
+		{"truncated chunk", func(b []byte) []byte {
+			return b[:headerSize+chunkSize+2*tagSize]
+		}},
+		{"swapped chunks", func(b []byte) []byte {
+			c := append([]byte(nil), b[headerSize:headerSize+chunkSize+tagSize]...)
+			copy(b[headerSize:], b[headerSize+chunkSize+tagSize:headerSize+2*(chunkSize+tagSize)])
+			copy(b[headerSize+chunkSize+tagSize:], c)
+			return b
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			b := test.tamper(append([]byte(nil), envelope...))
+			r, err := k.Decrypt("secret/model", store.NewBufferFileReader(b))
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestKeyringNamespaceNotEncrypted(t *testing.T) {
+	require := require.New(t)
+
+	k, cleanup := KeyringFixture("^secret/.*")
+	defer cleanup()
+
+	require.True(k.Encrypted("secret/model"))
+	require.False(k.Encrypted("public/model"))
+
+	require.Error(k.Encrypt("public/model", ioutil.Discard, bytes.NewReader([]byte("blob"))))
+
+	envelope := encryptBlob(t, k, "secret/model", []byte("blob"))
+	_, err := k.Decrypt("public/model", store.NewBufferFileReader(envelope))
+	require.Error(err)
+}
+
+func TestKeyringEncryptToFile(t *testing.T) {
+	require := require.New(t)
+
+	k, cleanup := KeyringFixture("^secret/.*")
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	f, d, err := k.EncryptToFile("secret/model", bytes.NewReader(blob.Content))
+	require.NoError(err)
+	defer f.Close()
+
+	envelope, err := ioutil.ReadAll(f)
+	require.NoError(err)
+	require.Equal(int64(len(envelope)), f.Size())
+	expected, err := core.NewDigester().FromBytes(envelope)
+	require.NoError(err)
+	require.Equal(expected, d)
+
+	r, err := k.Decrypt("secret/model", store.NewBufferFileReader(envelope))
+	require.NoError(err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+}
+
+func TestNewKeyringInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config Config
+	}{
+		{"invalid regexp", Config{
+			Namespaces: []NamespaceConfig{{Namespace: "(", KeyID: "k"}},
+			KMS:        KMSConfig{Backend: "local"},
+		}},
+		{"missing key id", Config{
+			Namespaces: []NamespaceConfig{{Namespace: ".*"}},
+			KMS:        KMSConfig{Backend: "local"},
+		}},
+		{"missing kms", Config{
+			Namespaces: []NamespaceConfig{{Namespace: ".*", KeyID: "k"}},
+		}},
+		{"unknown kms", Config{
+			Namespaces: []NamespaceConfig{{Namespace: ".*", KeyID: "k"}},
+			KMS:        KMSConfig{Backend: "vault"},
+		}},
+		{"missing key file", Config{
+			Namespaces: []NamespaceConfig{{Namespace: ".*", KeyID: "k"}},
+			KMS: KMSConfig{
+				Backend: "local",
+				Local:   LocalKMSConfig{Keys: map[string]string{"k": "/nonexistent"}},
+			},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewKeyring(test.config)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// KMS wraps and unwraps data keys with namespace keys, which never leave the
+// key management service.
+type KMS interface {
+	Wrap(keyID string, dataKey []byte) ([]byte, error)
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+func newKMS(config KMSConfig) (KMS, error) {
+	switch config.Backend {
+	case "local":
+		return newLocalKMS(config.Local)
+	case "aws":
+		return newAWSKMS(config.AWS)
+	case "":
+		return nil, errors.New("kms backend required")
+	default:
+		return nil, fmt.Errorf("unknown kms backend %q", config.Backend)
+	}
+}
+
+// localKMS wraps data keys with AES-GCM using keys read from local files.
+type localKMS struct {
+	keys map[string]cipher.AEAD
+}
+
+func newLocalKMS(config LocalKMSConfig) (*localKMS, error) {
+	keys := make(map[string]cipher.AEAD)
+	for id, path := range config.Keys {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read key %s: %s", id, err)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, fmt.Errorf("decode key %s: %s", id, err)
+		}
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %s must be %d bytes, got %d", id, dataKeySize, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", id, err)
+		}
+		keys[id] = aead
+	}
+	return &localKMS{keys}, nil
+}
+
+func (k *localKMS) key(keyID string) (cipher.AEAD, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", keyID)
+	}
+	return aead, nil
+}
+
+// Wrap returns the nonce followed by the sealed data key.
+func (k *localKMS) Wrap(keyID string, dataKey []byte) ([]byte, error) {
+	aead, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("nonce: %s", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func (k *localKMS) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := k.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, wrapped[:n], wrapped[n:], []byte(keyID))
+}
+
+// awsKMS wraps data keys with AWS KMS.
+type awsKMS struct {
+	api *kms.KMS
+}
+
+func newAWSKMS(config AWSKMSConfig) (*awsKMS, error) {
+	if config.Region == "" {
+		return nil, errors.New("aws kms region required")
+	}
+	api := kms.New(session.New(), aws.NewConfig().WithRegion(config.Region))
+	return &awsKMS{api}, nil
+}
+
+func (k *awsKMS) Wrap(keyID string, dataKey []byte) ([]byte, error) {
+	out, err := k.api.Encrypt(&kms.EncryptInput{
+		KeyId:     aws.String(keyID),
+		Plaintext: dataKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kms encrypt: %s", err)
+	}
+	return out.CiphertextBlob, nil
+}
+
+// Unwrap ignores keyID, since the wrapped key identifies its namespace key.
+func (k *awsKMS) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	out, err := k.api.Decrypt(&kms.DecryptInput{CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, fmt.Errorf("kms decrypt: %s", err)
+	}
+	return out.Plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
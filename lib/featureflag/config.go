@@ -0,0 +1,39 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package featureflag
+
+// Config defines feature flag configuration.
+type Config struct {
+	// Flags maps flag names to their configured state. Flags which are not
+	// configured are disabled.
+	Flags map[string]FlagConfig `yaml:"flags"`
+}
+
+// FlagConfig defines the state of a single flag.
+type FlagConfig struct {
+	// Enabled is the state of the flag for namespaces which do not match any
+	// of Namespaces.
+	Enabled bool `yaml:"enabled"`
+
+	// Namespaces overrides Enabled per namespace. The first matching rule
+	// applies.
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+}
+
+// NamespaceConfig defines the state of a flag for namespaces matching
+// Namespace.
+type NamespaceConfig struct {
+	Namespace string `yaml:"namespace" json:"namespace"`
+	Enabled   bool   `yaml:"enabled" json:"enabled"`
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package featureflag gates new behaviors behind config-driven flags, which
+// may be scoped per namespace and overridden at runtime.
+package featureflag
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+type namespaceRule struct {
+	config NamespaceConfig
+	regexp *regexp.Regexp
+}
+
+type flag struct {
+	enabled    bool
+	namespaces []namespaceRule
+}
+
+func compile(config Config) (map[string]*flag, error) {
+	flags := make(map[string]*flag, len(config.Flags))
+	for name, fc := range config.Flags {
+		f := &flag{enabled: fc.Enabled}
+		for _, nc := range fc.Namespaces {
+			re, err := regexp.Compile(nc.Namespace)
+			if err != nil {
+				return nil, fmt.Errorf("flag %s: invalid namespace %q: %s", name, nc.Namespace, err)
+			}
+			f.namespaces = append(f.namespaces, namespaceRule{nc, re})
+		}
+		flags[name] = f
+	}
+	return flags, nil
+}
+
+// Remote provides fleet-wide flag values, e.g. remote config flags, which
+// take precedence over configured flags.
+type Remote interface {
+	Flags() map[string]bool
+}
+
+type noopRemote struct{}
+
+func (noopRemote) Flags() map[string]bool { return nil }
+
+// Set holds the state of all flags of a component. Flags are resolved from,
+// in order of precedence, runtime overrides, the remote, and configuration.
+type Set struct {
+	component string
+
+	mu        sync.RWMutex
+	flags     map[string]*flag
+	overrides map[string]bool
+	remote    Remote
+}
+
+// New creates a new Set for component from config.
+func New(config Config, component string) (*Set, error) {
+	flags, err := compile(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{
+		component: component,
+		flags:     flags,
+		overrides: make(map[string]bool),
+		remote:    noopRemote{},
+	}, nil
+}
+
+// SetRemote configures s to resolve flags from r.
+func (s *Set) SetRemote(r Remote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remote = r
+}
+
+// Reload replaces the configured flags of s with config. Runtime overrides
+// are kept.
+func (s *Set) Reload(config Config) error {
+	flags, err := compile(config)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flags = flags
+	return nil
+}
+
+// Enabled returns whether name is enabled, ignoring namespace rules.
+func (s *Set) Enabled(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if enabled, ok := s.overrides[name]; ok {
+		return enabled
+	}
+	if enabled, ok := s.remote.Flags()[name]; ok {
+		return enabled
+	}
+	f, ok := s.flags[name]
+	return ok && f.enabled
+}
+
+// EnabledFor returns whether name is enabled for namespace. Runtime overrides
+// and remote flags apply to all namespaces.
+func (s *Set) EnabledFor(name, namespace string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if enabled, ok := s.overrides[name]; ok {
+		return enabled
+	}
+	if enabled, ok := s.remote.Flags()[name]; ok {
+		return enabled
+	}
+	f, ok := s.flags[name]
+	if !ok {
+		return false
+	}
+	for _, rule := range f.namespaces {
+		if rule.regexp.MatchString(namespace) {
+			return rule.config.Enabled
+		}
+	}
+	return f.enabled
+}
+
+// Override forces name to enabled until the override is cleared.
+func (s *Set) Override(name string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides[name] = enabled
+}
+
+// ClearOverride restores the configured state of name.
+func (s *Set) ClearOverride(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.overrides, name)
+}
+
+// State describes the current state of a flag.
+type State struct {
+	Name       string            `json:"name"`
+	Enabled    bool              `json:"enabled"`
+	Namespaces []NamespaceConfig `json:"namespaces,omitempty"`
+
+	// Remote is the remote value of the flag, if any.
+	Remote *bool `json:"remote,omitempty"`
+
+	// Override is the runtime override of the flag, if any.
+	Override *bool `json:"override,omitempty"`
+}
+
+// Snapshot returns the state of all configured or overridden flags, sorted by
+// name.
+func (s *Set) Snapshot() []State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	states := make(map[string]*State)
+	for name, f := range s.flags {
+		st := &State{Name: name, Enabled: f.enabled}
+		for _, rule := range f.namespaces {
+			st.Namespaces = append(st.Namespaces, rule.config)
+		}
+		states[name] = st
+	}
+	get := func(name string) *State {
+		st, ok := states[name]
+		if !ok {
+			st = &State{Name: name}
+			states[name] = st
+		}
+		return st
+	}
+	for name, enabled := range s.remote.Flags() {
+		enabled := enabled
+		get(name).Remote = &enabled
+	}
+	for name, enabled := range s.overrides {
+		enabled := enabled
+		get(name).Override = &enabled
+	}
+	result := make([]State, 0, len(states))
+	for _, st := range states {
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+var (
+	_globalMu sync.RWMutex
+	_global   = &Set{
+		flags:     make(map[string]*flag),
+		overrides: make(map[string]bool),
+		remote:    noopRemote{},
+	}
+)
+
+// Init configures the global Set of component, which is used by Enabled,
+// EnabledFor and Handler.
+func Init(config Config, component string) error {
+	s, err := New(config, component)
+	if err != nil {
+		return err
+	}
+	_globalMu.Lock()
+	defer _globalMu.Unlock()
+
+	_global = s
+	return nil
+}
+
+// Global returns the global Set.
+func Global() *Set {
+	_globalMu.RLock()
+	defer _globalMu.RUnlock()
+
+	return _global
+}
+
+// Enabled returns whether name is enabled in the global Set.
+func Enabled(name string) bool {
+	return Global().Enabled(name)
+}
+
+// EnabledFor returns whether name is enabled for namespace in the global Set.
+func EnabledFor(name, namespace string) bool {
+	return Global().EnabledFor(name, namespace)
+}
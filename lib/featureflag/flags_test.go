@@ -0,0 +1,161 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package featureflag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+func TestSetEnabled(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{Flags: map[string]FlagConfig{
+		"on":  {Enabled: true},
+		"off": {Enabled: false},
+	}}, "test")
+	require.NoError(err)
+
+	require.True(s.Enabled("on"))
+	require.False(s.Enabled("off"))
+	require.False(s.Enabled("unknown"))
+}
+
+func TestSetEnabledForNamespace(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{Flags: map[string]FlagConfig{
+		"f": {
+			Enabled: true,
+			Namespaces: []NamespaceConfig{
+				{Namespace: "canary/.*", Enabled: true},
+				{Namespace: "prod/.*", Enabled: false},
+			},
+		},
+	}}, "test")
+	require.NoError(err)
+
+	require.True(s.EnabledFor("f", "canary/foo"))
+	require.False(s.EnabledFor("f", "prod/foo"))
+	require.True(s.EnabledFor("f", "other"))
+	require.False(s.EnabledFor("unknown", "canary/foo"))
+}
+
+func TestNewInvalidNamespace(t *testing.T) {
+	_, err := New(Config{Flags: map[string]FlagConfig{
+		"f": {Namespaces: []NamespaceConfig{{Namespace: "("}}},
+	}}, "test")
+	require.Error(t, err)
+}
+
+func TestSetOverride(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{Flags: map[string]FlagConfig{
+		"f": {Namespaces: []NamespaceConfig{{Namespace: ".*", Enabled: true}}},
+	}}, "test")
+	require.NoError(err)
+
+	s.Override("f", false)
+	require.False(s.Enabled("f"))
+	require.False(s.EnabledFor("f", "foo"))
+
+	s.ClearOverride("f")
+	require.True(s.EnabledFor("f", "foo"))
+}
+
+type remoteFixture map[string]bool
+
+func (r remoteFixture) Flags() map[string]bool { return r }
+
+func TestSetRemoteTakesPrecedenceOverConfig(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{Flags: map[string]FlagConfig{
+		"f": {Namespaces: []NamespaceConfig{{Namespace: ".*", Enabled: false}}},
+	}}, "test")
+	require.NoError(err)
+
+	s.SetRemote(remoteFixture{"f": true})
+	require.True(s.Enabled("f"))
+	require.True(s.EnabledFor("f", "foo"))
+
+	s.Override("f", false)
+	require.False(s.EnabledFor("f", "foo"))
+
+	enabled, disabled := true, false
+	require.Equal([]State{{
+		Name:       "f",
+		Namespaces: []NamespaceConfig{{Namespace: ".*"}},
+		Remote:     &enabled,
+		Override:   &disabled,
+	}}, s.Snapshot())
+}
+
+func TestSetReloadKeepsOverrides(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{}, "test")
+	require.NoError(err)
+
+	s.Override("a", true)
+	require.NoError(s.Reload(Config{Flags: map[string]FlagConfig{"b": {Enabled: true}}}))
+
+	require.True(s.Enabled("a"))
+	require.True(s.Enabled("b"))
+}
+
+func TestHandler(t *testing.T) {
+	require := require.New(t)
+
+	s, err := New(Config{Flags: map[string]FlagConfig{
+		"b": {Enabled: true},
+	}}, "test")
+	require.NoError(err)
+
+	addr, stop := testutil.StartServer(newHandler(func() *Set { return s }))
+	defer stop()
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s/a?enabled=true", addr))
+	require.NoError(err)
+	require.True(s.Enabled("a"))
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s/a?enabled=maybe", addr))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var flags FlagsResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&flags))
+	enabled := true
+	require.Equal(FlagsResponse{
+		Component: "test",
+		Flags: []State{
+			{Name: "a", Override: &enabled},
+			{Name: "b", Enabled: true},
+		},
+	}, flags)
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/a", addr))
+	require.NoError(err)
+	require.False(s.Enabled("a"))
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package featureflag
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/go-chi/chi"
+)
+
+// FlagsResponse is the body returned when listing flags.
+type FlagsResponse struct {
+	Component string  `json:"component"`
+	Flags     []State `json:"flags"`
+}
+
+// Handler returns an http.Handler which exposes the global Set:
+//
+//	GET    /         lists all flags.
+//	PUT    /{flag}   overrides a flag to the value of the `enabled` query arg.
+//	DELETE /{flag}   clears the override of a flag.
+//
+// Overrides apply to all namespaces, taking precedence over namespace rules.
+// Servers must restrict the writes to authorized clients.
+func Handler() http.Handler {
+	return newHandler(Global)
+}
+
+func newHandler(set func() *Set) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		s := set()
+		resp := FlagsResponse{Component: s.component, Flags: s.Snapshot()}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			return handler.Errorf("json encode: %s", err)
+		}
+		return nil
+	}))
+
+	r.Put("/{flag}", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		name, err := httputil.ParseParam(r, "flag")
+		if err != nil {
+			return err
+		}
+		enabled, err := strconv.ParseBool(httputil.GetQueryArg(r, "enabled", ""))
+		if err != nil {
+			return handler.Errorf("parse query arg `enabled`: %s", err).Status(http.StatusBadRequest)
+		}
+		set().Override(name, enabled)
+		return nil
+	}))
+
+	r.Delete("/{flag}", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		name, err := httputil.ParseParam(r, "flag")
+		if err != nil {
+			return err
+		}
+		set().ClearOverride(name)
+		return nil
+	}))
+
+	return r
+}
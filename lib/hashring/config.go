@@ -13,7 +13,10 @@
 // limitations under the License.
 package hashring
 
-import "time"
+import (
+	"net"
+	"time"
+)
 
 // Config defines Ring configuration.
 type Config struct {
@@ -25,6 +28,23 @@ type Config struct {
 	// RefreshInterval is the interval at which membership / health information
 	// is refreshed during monitoring.
 	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	// DefaultWeight is the weight of hosts which have no entry in Weights.
+	DefaultWeight int `yaml:"default_weight"`
+
+	// Weights overrides the weight of individual hosts, keyed by address or
+	// hostname. The share of blobs a host owns is proportional to its weight,
+	// e.g. a host with weight 200 owns twice as many blobs as a host with weight
+	// 100, similar to assigning more virtual nodes to bigger machines. All
+	// clients of a ring must be configured with the same weights, else they
+	// will disagree on blob locations.
+	Weights map[string]int `yaml:"weights"`
+
+	// Zones maps addresses or hostnames to the zone they run in. When replicas
+	// of a blob span multiple zones, ReadLocations prefers replicas in the
+	// local zone of the client (see WithLocalZone) and falls back to remote
+	// zones. Ownership is unaffected by zones.
+	Zones Zones `yaml:"zones"`
 }
 
 func (c *Config) applyDefaults() {
@@ -34,4 +54,20 @@ func (c *Config) applyDefaults() {
 	if c.RefreshInterval == 0 {
 		c.RefreshInterval = 10 * time.Second
 	}
+	if c.DefaultWeight == 0 {
+		c.DefaultWeight = 100
+	}
+}
+
+// weight returns the configured weight of addr.
+func (c Config) weight(addr string) int {
+	if w, ok := c.Weights[addr]; ok {
+		return w
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if w, ok := c.Weights[host]; ok {
+			return w
+		}
+	}
+	return c.DefaultWeight
 }
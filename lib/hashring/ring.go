@@ -14,6 +14,7 @@
 package hashring
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -25,7 +26,9 @@ import (
 	"github.com/uber/kraken/utils/stringset"
 )
 
-const _defaultWeight = 100
+// _ownershipSamples is the number of shard ids sampled when computing ownership.
+// Shard ids are 4 hex characters, so every 16th shard id is sampled.
+const _ownershipSamples = 4096
 
 // Watcher allows clients to watch the ring for changes. Whenever membership
 // changes, each registered Watcher is notified with the latest hosts.
@@ -45,9 +48,11 @@ type Watcher interface {
 // to be healthy (see Locations).
 type Ring interface {
 	Locations(d core.Digest) []string
+	ReadLocations(d core.Digest) []string
 	Contains(addr string) bool
 	Monitor(stop <-chan struct{})
 	Refresh()
+	Ownership() map[string]hrw.Ownership
 }
 
 type ring struct {
@@ -60,7 +65,12 @@ type ring struct {
 	hash    *hrw.RendezvousHash
 	healthy stringset.Set
 
-	watchers []Watcher
+	ownershipMu sync.Mutex // Protects the following fields:
+	ownership   map[string]hrw.Ownership
+	ownershipOf *hrw.RendezvousHash // The hash which ownership was computed for.
+
+	watchers  []Watcher
+	localZone string
 }
 
 // Option allows setting custom parameters for ring.
@@ -71,6 +81,12 @@ func WithWatcher(w Watcher) Option {
 	return func(r *ring) { r.watchers = append(r.watchers, w) }
 }
 
+// WithLocalZone sets the zone the client of the ring runs in, which
+// ReadLocations uses to prefer replicas in the same zone.
+func WithLocalZone(zone string) Option {
+	return func(r *ring) { r.localZone = zone }
+}
+
 // New creates a new Ring whose members are defined by cluster.
 func New(
 	config Config, cluster hostlist.List, filter healthcheck.Filter, opts ...Option) Ring {
@@ -117,6 +133,14 @@ func (r *ring) Locations(d core.Digest) []string {
 	return locs
 }
 
+// ReadLocations returns the same replica set as Locations, reordered such that
+// replicas in the local zone come first. Should only be used for requests which
+// any replica can serve equally, e.g. reads, since writes rely on the ordering
+// of Locations.
+func (r *ring) ReadLocations(d core.Digest) []string {
+	return r.config.Zones.Prefer(r.localZone, r.Locations(d))
+}
+
 // Contains returns whether the ring contains addr.
 func (r *ring) Contains(addr string) bool {
 	r.mu.RLock()
@@ -125,6 +149,32 @@ func (r *ring) Contains(addr string) bool {
 	return r.addrs.Has(addr)
 }
 
+// Ownership returns the share of blobs owned by each address in r, regardless
+// of health. Ownership is estimated by sampling the shard id space, and is
+// cached until membership changes.
+func (r *ring) Ownership() map[string]hrw.Ownership {
+	r.mu.RLock()
+	hash := r.hash
+	r.mu.RUnlock()
+
+	r.ownershipMu.Lock()
+	defer r.ownershipMu.Unlock()
+
+	if r.ownershipOf != hash {
+		shardIDs := make([]string, _ownershipSamples)
+		for i := range shardIDs {
+			shardIDs[i] = fmt.Sprintf("%04x", i*(1<<16)/_ownershipSamples)
+		}
+		r.ownership = hash.Ownership(shardIDs, r.config.MaxReplica)
+		r.ownershipOf = hash
+	}
+	result := make(map[string]hrw.Ownership, len(r.ownership))
+	for addr, o := range r.ownership {
+		result[addr] = o
+	}
+	return result
+}
+
 // Monitor refreshes the ring at the configured interval. Blocks until the
 // provided stop channel is closed.
 func (r *ring) Monitor(stop <-chan struct{}) {
@@ -149,7 +199,7 @@ func (r *ring) Refresh() {
 		// Membership has changed -- update hash nodes.
 		hash = hrw.NewRendezvousHash(hrw.Murmur3Hash, hrw.UInt64ToFloat64)
 		for addr := range latest {
-			hash.AddNode(addr, _defaultWeight)
+			hash.AddNode(addr, r.config.weight(addr))
 		}
 		// Notify watchers.
 		for _, w := range r.watchers {
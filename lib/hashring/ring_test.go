@@ -273,3 +273,90 @@ func TestRingNotifiesWatchersOnMembershipChanges(t *testing.T) {
 	r.Refresh()
 	r.Refresh()
 }
+
+func TestRingLocationsDistributionWithWeights(t *testing.T) {
+	require := require.New(t)
+
+	x := "x:80"
+	y := "y:80"
+
+	r := New(
+		Config{MaxReplica: 1, Weights: map[string]int{"x": 300}},
+		hostlist.Fixture(x, y),
+		healthcheck.IdentityFilter{})
+
+	sampleSize := 4000
+
+	counts := make(map[string]int)
+	for i := 0; i < sampleSize; i++ {
+		counts[r.Locations(core.DigestFixture())[0]]++
+	}
+
+	require.InDelta(0.75, float64(counts[x])/float64(sampleSize), 0.05)
+	require.InDelta(0.25, float64(counts[y])/float64(sampleSize), 0.05)
+}
+
+func TestRingOwnership(t *testing.T) {
+	require := require.New(t)
+
+	x := "x:80"
+	y := "y:80"
+	z := "z:80"
+
+	r := New(
+		Config{MaxReplica: 2, Weights: map[string]int{"x:80": 200}},
+		hostlist.Fixture(x, y, z),
+		healthcheck.IdentityFilter{})
+
+	ownership := r.Ownership()
+	require.Len(ownership, 3)
+	require.Equal(200, ownership[x].Weight)
+	require.Equal(100, ownership[y].Weight)
+
+	var primary, replica float64
+	for _, o := range ownership {
+		primary += o.Primary
+		replica += o.Replica
+	}
+	require.InDelta(1.0, primary, 0.001)
+	require.InDelta(2.0, replica, 0.001)
+	require.InDelta(0.5, ownership[x].Primary, 0.05)
+	require.True(ownership[x].Replica > ownership[y].Replica)
+}
+
+func TestRingReadLocationsPrefersLocalZone(t *testing.T) {
+	require := require.New(t)
+
+	addrs := addrsFixture(3)
+	zones := Zones{addrs[0]: "zone1", addrs[1]: "zone2", addrs[2]: "zone2"}
+
+	r := New(
+		Config{MaxReplica: 3, Zones: zones},
+		hostlist.Fixture(addrs...),
+		healthcheck.IdentityFilter{},
+		WithLocalZone("zone2"))
+
+	for i := 0; i < 100; i++ {
+		d := core.DigestFixture()
+		locs := r.Locations(d)
+		readLocs := r.ReadLocations(d)
+		require.ElementsMatch(locs, readLocs)
+		require.Equal("zone2", zones.Of(readLocs[0]))
+		require.Equal("zone2", zones.Of(readLocs[1]))
+		require.Equal(addrs[0], readLocs[2])
+	}
+}
+
+func TestRingReadLocationsWithoutLocalZone(t *testing.T) {
+	require := require.New(t)
+
+	addrs := addrsFixture(3)
+
+	r := New(
+		Config{MaxReplica: 3, Zones: Zones{addrs[0]: "zone1"}},
+		hostlist.Fixture(addrs...),
+		healthcheck.IdentityFilter{})
+
+	d := core.DigestFixture()
+	require.Equal(r.Locations(d), r.ReadLocations(d))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hashring
+
+import "net"
+
+// Zones maps addresses or hostnames to the zone they run in.
+type Zones map[string]string
+
+// Of returns the zone of addr, looked up by address first and hostname second.
+// Returns empty string if the zone of addr is unknown.
+func (z Zones) Of(addr string) string {
+	if zone, ok := z[addr]; ok {
+		return zone
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return z[host]
+	}
+	return ""
+}
+
+// Prefer returns a copy of addrs where addrs in zone come before addrs in other
+// zones. The relative order of addrs within each group is preserved. If zone is
+// empty, addrs are returned in their original order.
+func (z Zones) Prefer(zone string, addrs []string) []string {
+	result := make([]string, 0, len(addrs))
+	var remote []string
+	for _, addr := range addrs {
+		if zone != "" && z.Of(addr) == zone {
+			result = append(result, addr)
+		} else {
+			remote = append(remote, addr)
+		}
+	}
+	return append(result, remote...)
+}
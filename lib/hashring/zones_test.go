@@ -0,0 +1,67 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hashring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZonesOf(t *testing.T) {
+	zones := Zones{
+		"a:80": "zone1",
+		"b":    "zone2",
+	}
+	tests := []struct {
+		addr     string
+		expected string
+	}{
+		{"a:80", "zone1"},
+		{"a:81", ""},
+		{"b:80", "zone2"},
+		{"c:80", ""},
+		{"b", "zone2"},
+	}
+	for _, test := range tests {
+		t.Run(test.addr, func(t *testing.T) {
+			require.Equal(t, test.expected, zones.Of(test.addr))
+		})
+	}
+}
+
+func TestZonesPrefer(t *testing.T) {
+	zones := Zones{
+		"a:80": "zone1",
+		"b:80": "zone2",
+		"c:80": "zone1",
+		"d:80": "zone2",
+	}
+	addrs := []string{"a:80", "b:80", "c:80", "d:80"}
+	tests := []struct {
+		desc     string
+		zone     string
+		expected []string
+	}{
+		{"zone1", "zone1", []string{"a:80", "c:80", "b:80", "d:80"}},
+		{"zone2", "zone2", []string{"b:80", "d:80", "a:80", "c:80"}},
+		{"unknown zone", "zone3", addrs},
+		{"empty zone", "", addrs},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, zones.Prefer(test.zone, addrs))
+		})
+	}
+}
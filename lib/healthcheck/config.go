@@ -14,6 +14,7 @@
 package healthcheck
 
 import (
+	"math/rand"
 	"time"
 )
 
@@ -29,6 +30,9 @@ type FilterConfig struct {
 
 	// Timeout of each individual health check.
 	Timeout time.Duration `yaml:"timeout"`
+
+	// Backoff configures how unhealthy hosts are checked less often.
+	Backoff BackoffConfig `yaml:"backoff"`
 }
 
 func (c *FilterConfig) applyDefaults() {
@@ -41,11 +45,58 @@ func (c *FilterConfig) applyDefaults() {
 	if c.Timeout == 0 {
 		c.Timeout = 3 * time.Second
 	}
+	c.Backoff.applyDefaults()
+}
+
+// BackoffConfig defines exponential backoff of health checks for unhealthy
+// hosts, such that hosts which are down are not hammered with checks.
+type BackoffConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Initial is the delay before an unhealthy host is checked again. The
+	// delay doubles with every further failed check.
+	Initial time.Duration `yaml:"initial"`
+
+	// Max caps the delay between checks of an unhealthy host.
+	Max time.Duration `yaml:"max"`
+
+	// Jitter randomizes each delay by up to +/- Jitter of its length. Negative
+	// values disable jitter.
+	Jitter float64 `yaml:"jitter"`
+}
+
+func (c *BackoffConfig) applyDefaults() {
+	if c.Initial == 0 {
+		c.Initial = 10 * time.Second
+	}
+	if c.Max == 0 {
+		c.Max = 5 * time.Minute
+	}
+	if c.Jitter == 0 {
+		c.Jitter = 0.2
+	}
+}
+
+// delay returns the jittered delay before the next check of a host which
+// failed n checks since it became unhealthy.
+func (c BackoffConfig) delay(n int) time.Duration {
+	d := c.Initial
+	for i := 1; i < n && d < c.Max; i++ {
+		d *= 2
+	}
+	if d > c.Max {
+		d = c.Max
+	}
+	return jitter(d, c.Jitter)
 }
 
 // MonitorConfig defines configuration for Monitor.
 type MonitorConfig struct {
 	Interval time.Duration `yaml:"interval"`
+
+	// Jitter randomizes each interval by up to +/- Jitter of its length, such
+	// that many clients started together do not check hosts in lockstep.
+	Jitter float64 `yaml:"jitter"`
 }
 
 func (c *MonitorConfig) applyDefaults() {
@@ -75,3 +126,11 @@ func (c *PassiveFilterConfig) applyDefaults() {
 		c.FailTimeout = 5 * time.Minute
 	}
 }
+
+// jitter randomizes d by up to +/- fraction of its length.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return d + time.Duration((2*rand.Float64()-1)*fraction*float64(d))
+}
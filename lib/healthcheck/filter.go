@@ -17,7 +17,11 @@ import (
 	"context"
 	"sync"
 
+	"github.com/uber/kraken/utils/log"
 	"github.com/uber/kraken/utils/stringset"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
 )
 
 // Filter filters out unhealthy hosts from a host list.
@@ -31,21 +35,54 @@ type filter struct {
 	state   *state
 }
 
+// FilterOption allows setting optional Filter parameters.
+type FilterOption func(*filter)
+
+// WithClock configures a Filter with a custom clock.
+func WithClock(clk clock.Clock) FilterOption {
+	return func(f *filter) { f.state.clk = clk }
+}
+
+// WithStateChangeHook configures a Filter to call hook whenever a host
+// transitions between healthy and unhealthy.
+func WithStateChangeHook(hook StateChangeHook) FilterOption {
+	return func(f *filter) { f.state.onChange = hook }
+}
+
+// LogStateChanges returns a StateChangeHook which logs state changes and counts
+// them in stats.
+func LogStateChanges(stats tally.Scope) StateChangeHook {
+	return func(addr string, healthy bool) {
+		if healthy {
+			log.With("addr", addr).Info("Host is healthy again")
+			stats.Tagged(map[string]string{"state": "healthy"}).Counter("host_state_changes").Inc(1)
+		} else {
+			log.With("addr", addr).Warn("Host is unhealthy")
+			stats.Tagged(map[string]string{"state": "unhealthy"}).Counter("host_state_changes").Inc(1)
+		}
+	}
+}
+
 // NewFilter creates a new Filter. Filter is stateful -- consecutive runs are required
 // to detect healthy / unhealthy hosts.
-func NewFilter(config FilterConfig, checker Checker) Filter {
+func NewFilter(config FilterConfig, checker Checker, opts ...FilterOption) Filter {
 	config.applyDefaults()
-	return &filter{
+	f := &filter{
 		config:  config,
 		checker: checker,
 		state:   newState(config),
 	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 // Run applies checker to addrs against the current filter state and returns the
 // healthy entries. New entries in addrs not found in the current state are
 // assumed as initially healthy. If addrs only contains a single entry, it is
-// always considered healthy.
+// always considered healthy. Unhealthy hosts which are backing off are not
+// checked until their next check is due.
 func (f *filter) Run(addrs stringset.Set) stringset.Set {
 	if len(addrs) == 1 {
 		return addrs.Copy()
@@ -58,6 +95,9 @@ func (f *filter) Run(addrs stringset.Set) stringset.Set {
 
 	var wg sync.WaitGroup
 	for addr := range addrs {
+		if !f.state.due(addr) {
+			continue
+		}
 		wg.Add(1)
 		go func(addr string) {
 			defer wg.Done()
@@ -73,6 +113,16 @@ func (f *filter) Run(addrs stringset.Set) stringset.Set {
 	return f.state.getHealthy()
 }
 
+// failed counts a failed request to addr towards the fails of its health
+// checks, and returns whether addr is unhealthy. Failures of hosts which
+// were never checked are ignored.
+func (f *filter) failed(addr string) bool {
+	if !f.state.tracked(addr) {
+		return false
+	}
+	return f.state.failed(addr)
+}
+
 func (f *filter) check(ctx context.Context, addr string) error {
 	errc := make(chan error, 1)
 	go func() { errc <- f.checker.Check(ctx, addr) }()
@@ -16,12 +16,14 @@ package healthcheck
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/uber/kraken/mocks/lib/healthcheck"
 	"github.com/uber/kraken/utils/stringset"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
@@ -109,3 +111,89 @@ func TestFilterNewHostsStartAsHealthy(t *testing.T) {
 	require.Equal(stringset.New(x, y), f.Run(stringset.New(x, y)))
 	require.Empty(f.Run(stringset.New(x, y)))
 }
+
+func TestFilterBackoffSkipsChecksOfUnhealthyHosts(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	checker := mockhealthcheck.NewMockChecker(ctrl)
+
+	x := "x:80"
+	y := "y:80"
+
+	clk := clock.NewMock()
+
+	f := NewFilter(FilterConfig{
+		Fails:  1,
+		Passes: 1,
+		Backoff: BackoffConfig{
+			Enabled: true,
+			Initial: 10 * time.Second,
+			Max:     time.Minute,
+			Jitter:  0.1,
+		},
+	}, checker, WithClock(clk))
+
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil)
+	checker.EXPECT().Check(gomock.Any(), y).Return(errors.New("some error"))
+
+	require.Equal(stringset.New(x), f.Run(stringset.New(x, y)))
+
+	// y is backing off for 10s +/- 1s.
+	clk.Add(5 * time.Second)
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil)
+
+	require.Equal(stringset.New(x), f.Run(stringset.New(x, y)))
+
+	clk.Add(6 * time.Second)
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil)
+	checker.EXPECT().Check(gomock.Any(), y).Return(errors.New("some error"))
+
+	require.Equal(stringset.New(x), f.Run(stringset.New(x, y)))
+
+	// Second failure doubles the backoff to 20s +/- 2s.
+	clk.Add(15 * time.Second)
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil)
+
+	require.Equal(stringset.New(x), f.Run(stringset.New(x, y)))
+
+	clk.Add(8 * time.Second)
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil)
+	checker.EXPECT().Check(gomock.Any(), y).Return(nil)
+
+	require.Equal(stringset.New(x, y), f.Run(stringset.New(x, y)))
+}
+
+func TestFilterStateChangeHook(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	checker := mockhealthcheck.NewMockChecker(ctrl)
+
+	x := "x:80"
+	y := "y:80"
+
+	var mu sync.Mutex
+	changes := make(map[string][]bool)
+	hook := func(addr string, healthy bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes[addr] = append(changes[addr], healthy)
+	}
+
+	f := NewFilter(FilterConfig{Fails: 1, Passes: 1}, checker, WithStateChangeHook(hook))
+
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil).Times(3)
+	checker.EXPECT().Check(gomock.Any(), y).Return(errors.New("some error")).Times(2)
+	checker.EXPECT().Check(gomock.Any(), y).Return(nil)
+
+	for i := 0; i < 3; i++ {
+		f.Run(stringset.New(x, y))
+	}
+
+	require.Equal(map[string][]bool{y: {false, true}}, changes)
+}
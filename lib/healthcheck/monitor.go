@@ -21,8 +21,8 @@ import (
 	"github.com/uber/kraken/utils/stringset"
 )
 
-// Monitor performs active health checks asynchronously. Can be used in
-// as a hostlist.List.
+// Monitor performs active health checks asynchronously. Can be used as a
+// List, where failed requests count towards the health checks.
 type Monitor struct {
 	config MonitorConfig
 	hosts  hostlist.List
@@ -34,7 +34,13 @@ type Monitor struct {
 	stop chan struct{}
 }
 
-var _ hostlist.List = (*Monitor)(nil)
+var _ List = (*Monitor)(nil)
+
+// passiveChecks is implemented by Filters which count failed requests towards
+// their health checks.
+type passiveChecks interface {
+	failed(addr string) bool
+}
 
 // NewMonitor monitors the health of hosts using filter.
 func NewMonitor(config MonitorConfig, hosts hostlist.List, filter Filter) *Monitor {
@@ -58,6 +64,25 @@ func (m *Monitor) Resolve() stringset.Set {
 	return m.healthy
 }
 
+// Failed marks a request to addr as failed. If the filter of m counts failed
+// requests towards its health checks, addr is removed from the healthy hosts
+// as soon as it reaches the configured fails, instead of on the next check.
+// Failed requests alone never remove the last healthy host.
+func (m *Monitor) Failed(addr string) {
+	pc, ok := m.filter.(passiveChecks)
+	if !ok || !pc.failed(addr) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.healthy.Has(addr) && len(m.healthy) > 1 {
+		healthy := m.healthy.Copy()
+		healthy.Remove(addr)
+		m.healthy = healthy
+	}
+}
+
 // Stop stops the monitor.
 func (m *Monitor) Stop() {
 	close(m.stop)
@@ -68,7 +93,7 @@ func (m *Monitor) loop() {
 		select {
 		case <-m.stop:
 			return
-		case <-time.After(m.config.Interval):
+		case <-time.After(jitter(m.config.Interval, m.config.Jitter)):
 			healthy := m.filter.Run(m.hosts.Resolve())
 			m.mu.Lock()
 			m.healthy = healthy
@@ -50,3 +50,54 @@ func TestActiveMonitor(t *testing.T) {
 
 	require.Equal(stringset.New(x), m.Resolve())
 }
+
+func TestActiveMonitorFailedRequestsCountTowardsChecks(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := "x:80"
+	y := "y:80"
+
+	checker := mockhealthcheck.NewMockChecker(ctrl)
+
+	filter := NewFilter(FilterConfig{Fails: 2, Passes: 1}, checker)
+
+	checker.EXPECT().Check(gomock.Any(), x).Return(nil)
+	checker.EXPECT().Check(gomock.Any(), y).Return(nil)
+
+	require.Equal(stringset.New(x, y), filter.Run(stringset.New(x, y)))
+
+	m := NewMonitor(MonitorConfig{Interval: time.Hour}, hostlist.Fixture(x, y), filter)
+	defer m.Stop()
+
+	m.Failed(x)
+	require.Equal(stringset.New(x, y), m.Resolve())
+
+	m.Failed(x)
+	require.Equal(stringset.New(y), m.Resolve())
+
+	// The last healthy host is never removed by failed requests.
+	m.Failed(y)
+	m.Failed(y)
+	require.Equal(stringset.New(y), m.Resolve())
+}
+
+func TestActiveMonitorIgnoresFailedRequestsOfUncheckedHosts(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	x := "x:80"
+	y := "y:80"
+
+	filter := NewFilter(FilterConfig{Fails: 1}, mockhealthcheck.NewMockChecker(ctrl))
+
+	m := NewMonitor(MonitorConfig{Interval: time.Hour}, hostlist.Fixture(x, y), filter)
+	defer m.Stop()
+
+	m.Failed(x)
+	require.Equal(stringset.New(x, y), m.Resolve())
+}
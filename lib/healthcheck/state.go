@@ -15,10 +15,17 @@ package healthcheck
 
 import (
 	"sync"
+	"time"
 
 	"github.com/uber/kraken/utils/stringset"
+
+	"github.com/andres-erbsen/clock"
 )
 
+// StateChangeHook is called whenever a host transitions between healthy and
+// unhealthy.
+type StateChangeHook func(addr string, healthy bool)
+
 // state tracks the health status of a set of hosts. In particular, it tracks
 // consecutive passes or fails which cause hosts to transition between healthy
 // and unhealthy.
@@ -26,18 +33,29 @@ import (
 // state is thread-safe.
 type state struct {
 	sync.Mutex
-	config  FilterConfig
-	all     stringset.Set
-	healthy stringset.Set
-	trend   map[string]int
+	config   FilterConfig
+	clk      clock.Clock
+	onChange StateChangeHook
+	all      stringset.Set
+	healthy  stringset.Set
+	trend    map[string]int
+
+	// backoffs tracks the number of failed checks since a host became
+	// unhealthy, and nextCheck when the host is due to be checked again.
+	backoffs  map[string]int
+	nextCheck map[string]time.Time
 }
 
 func newState(config FilterConfig) *state {
 	return &state{
-		config:  config,
-		all:     stringset.New(),
-		healthy: stringset.New(),
-		trend:   make(map[string]int),
+		config:    config,
+		clk:       clock.New(),
+		onChange:  func(string, bool) {},
+		all:       stringset.New(),
+		healthy:   stringset.New(),
+		trend:     make(map[string]int),
+		backoffs:  make(map[string]int),
+		nextCheck: make(map[string]time.Time),
 	}
 }
 
@@ -62,26 +80,60 @@ func (s *state) sync(addrs stringset.Set) {
 	}
 }
 
-// failed marks addr as failed.
-func (s *state) failed(addr string) {
+// due returns whether addr should be checked, i.e. it is not backing off.
+func (s *state) due(addr string) bool {
 	s.Lock()
 	defer s.Unlock()
 
+	next, ok := s.nextCheck[addr]
+	return !ok || !s.clk.Now().Before(next)
+}
+
+// tracked returns whether addr is part of the current state.
+func (s *state) tracked(addr string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.all.Has(addr)
+}
+
+// failed marks addr as failed, and returns whether addr is unhealthy.
+func (s *state) failed(addr string) bool {
+	s.Lock()
 	s.trend[addr] = max(min(s.trend[addr]-1, -1), -s.config.Fails)
-	if s.trend[addr] == -s.config.Fails {
+	unhealthy := s.trend[addr] == -s.config.Fails
+	changed := unhealthy && s.healthy.Has(addr)
+	if unhealthy {
 		s.healthy.Remove(addr)
+		if s.config.Backoff.Enabled {
+			s.backoffs[addr]++
+			s.nextCheck[addr] = s.clk.Now().Add(s.config.Backoff.delay(s.backoffs[addr]))
+		}
+	}
+	s.Unlock()
+
+	if changed {
+		s.onChange(addr, false)
 	}
+	return unhealthy
 }
 
 // passed marks addr as passed.
 func (s *state) passed(addr string) {
 	s.Lock()
-	defer s.Unlock()
-
 	s.trend[addr] = min(max(s.trend[addr]+1, 1), s.config.Passes)
-	if s.trend[addr] == s.config.Passes {
+	delete(s.backoffs, addr)
+	delete(s.nextCheck, addr)
+	healthy := s.trend[addr] == s.config.Passes
+	changed := healthy && !s.healthy.Has(addr)
+	if healthy {
 		s.healthy.Add(addr)
 	}
+	s.Unlock()
+
+	if changed {
+		s.onChange(addr, true)
+	}
 }
 
 // getHealthy returns the current healthy hosts.
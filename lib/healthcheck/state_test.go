@@ -15,6 +15,7 @@ package healthcheck
 
 import (
 	"testing"
+	"time"
 
 	"github.com/uber/kraken/utils/stringset"
 
@@ -107,3 +108,15 @@ func TestStateSync(t *testing.T) {
 
 	require.Equal(stringset.New(addr1), s.getHealthy())
 }
+
+func TestBackoffConfigDelay(t *testing.T) {
+	require := require.New(t)
+
+	c := BackoffConfig{Initial: time.Second, Max: 5 * time.Second, Jitter: -1}
+
+	require.Equal(time.Second, c.delay(1))
+	require.Equal(2*time.Second, c.delay(2))
+	require.Equal(4*time.Second, c.delay(3))
+	require.Equal(5*time.Second, c.delay(4))
+	require.Equal(5*time.Second, c.delay(100))
+}
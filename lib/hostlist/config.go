@@ -25,14 +25,22 @@ import (
 	"github.com/uber/kraken/utils/stringset"
 )
 
-// Config defines a list of hosts using either a DNS record or a static list of
-// addresses. If present, a DNS record always takes precedence over a static
-// list.
+// Config defines a list of hosts using either a DNS record, a DNS SRV record,
+// the endpoints of a Kubernetes service or a static list of addresses. Exactly
+// one source must be supplied.
 type Config struct {
 	// DNS record from which to resolve host names. Must include port suffix,
 	// which will be attached to each host within the record.
 	DNS string `yaml:"dns"`
 
+	// SRV record from which to resolve addresses, e.g.
+	// _p2p._tcp.origin.example.com. The port of each host is taken from its
+	// record.
+	SRV string `yaml:"srv"`
+
+	// Kubernetes watches the ready endpoints of a Kubernetes service.
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+
 	// Statically configured addresses. Must be in 'host:port' format.
 	Static []string `yaml:"static"`
 
@@ -48,11 +56,28 @@ func (c *Config) applyDefaults() {
 
 // getResolver parses the configuration for which resolver to use.
 func (c *Config) getResolver() (resolver, error) {
-	if c.DNS == "" && len(c.Static) == 0 {
-		return nil, errors.New("no dns record or static list supplied")
+	var sources int
+	for _, ok := range []bool{
+		c.DNS != "", c.SRV != "", c.Kubernetes.Service != "", len(c.Static) > 0,
+	} {
+		if ok {
+			sources++
+		}
 	}
-	if c.DNS != "" && len(c.Static) > 0 {
-		return nil, errors.New("both dns record and static list supplied")
+	if sources == 0 {
+		return nil, errors.New("no dns record, srv record, kubernetes service or static list supplied")
+	}
+	if sources > 1 {
+		return nil, errors.New(
+			"only one of dns record, srv record, kubernetes service or static list may be supplied")
+	}
+
+	if c.SRV != "" {
+		var nr net.Resolver
+		return &srvResolver{c.SRV, nr.LookupSRV}, nil
+	}
+	if c.Kubernetes.Service != "" {
+		return newKubernetesResolver(c.Kubernetes)
 	}
 
 	if len(c.Static) > 0 {
@@ -116,3 +141,28 @@ func (r *dnsResolver) resolve() (stringset.Set, error) {
 func (r *dnsResolver) String() string {
 	return fmt.Sprintf("%s:%d", r.dns, r.port)
 }
+
+type srvResolver struct {
+	srv    string
+	lookup func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func (r *srvResolver) resolve() (stringset.Set, error) {
+	_, records, err := r.lookup(context.Background(), "", "", r.srv)
+	if err != nil {
+		return nil, fmt.Errorf("resolve srv: %s", err)
+	}
+	addrs := make(stringset.Set)
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		addrs.Add(net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("srv record empty")
+	}
+	return addrs, nil
+}
+
+func (r *srvResolver) String() string {
+	return r.srv
+}
@@ -0,0 +1,390 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hostlist
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+const _serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Kubernetes APIs serving service endpoints.
+const (
+	KubernetesEndpointSlices = "endpointslices"
+	KubernetesEndpoints      = "endpoints"
+)
+
+// KubernetesConfig defines a list of hosts as the ready endpoints of a
+// Kubernetes service. Endpoints are watched through the Kubernetes API, such
+// that membership changes are picked up without restarts. By default, the
+// API server and credentials of the pod's service account are used.
+type KubernetesConfig struct {
+	// Service is the name of the service.
+	Service string `yaml:"service"`
+
+	// Namespace of the service. Defaults to the namespace of the pod.
+	Namespace string `yaml:"namespace"`
+
+	// Port is the name of the service port to use. Defaults to the first
+	// port of the service.
+	Port string `yaml:"port"`
+
+	// API is KubernetesEndpointSlices or KubernetesEndpoints, the latter for
+	// clusters which do not serve discovery.k8s.io/v1. Defaults to
+	// KubernetesEndpointSlices.
+	API string `yaml:"api"`
+
+	// APIServer is the URL of the Kubernetes API server. Defaults to the
+	// in-cluster API server.
+	APIServer string `yaml:"api_server"`
+
+	// TokenFile and CAFile default to the service account credentials. The
+	// token is re-read for every request, since service account tokens are
+	// rotated. Requests are not authenticated if TokenFile does not exist.
+	TokenFile string `yaml:"token_file"`
+	CAFile    string `yaml:"ca_file"`
+
+	// RetryInterval is how long to wait before watching again after a watch
+	// failed.
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+func (c KubernetesConfig) applyDefaults() KubernetesConfig {
+	if c.API == "" {
+		c.API = KubernetesEndpointSlices
+	}
+	if c.APIServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host != "" && port != "" {
+			c.APIServer = "https://" + net.JoinHostPort(host, port)
+		}
+	}
+	if c.TokenFile == "" {
+		c.TokenFile = path.Join(_serviceAccountDir, "token")
+	}
+	if c.CAFile == "" {
+		c.CAFile = path.Join(_serviceAccountDir, "ca.crt")
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = 5 * time.Second
+	}
+	return c
+}
+
+// kubernetesResolver resolves the addresses of the latest endpoints of a
+// service, which are updated in the background by watching the service.
+type kubernetesResolver struct {
+	config KubernetesConfig
+	client *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu              sync.Mutex
+	objects         map[string]stringset.Set // Endpoints object name -> addrs.
+	resourceVersion string
+}
+
+func newKubernetesResolver(config KubernetesConfig) (*kubernetesResolver, error) {
+	config = config.applyDefaults()
+
+	if config.API != KubernetesEndpointSlices && config.API != KubernetesEndpoints {
+		return nil, fmt.Errorf("unknown kubernetes api %q", config.API)
+	}
+	if config.APIServer == "" {
+		return nil, errors.New("kubernetes api_server required outside of a kubernetes cluster")
+	}
+	if config.Namespace == "" {
+		b, err := ioutil.ReadFile(path.Join(_serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes namespace required: %s", err)
+		}
+		config.Namespace = strings.TrimSpace(string(b))
+	}
+
+	tlsConfig := &tls.Config{}
+	if ca, err := ioutil.ReadFile(config.CAFile); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid kubernetes ca file %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read kubernetes ca file: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &kubernetesResolver{
+		config: config,
+		client: &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	// Fail fast if the endpoints cannot be listed.
+	if err := r.list(); err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.run()
+	return r, nil
+}
+
+func (r *kubernetesResolver) resolve() (stringset.Set, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	addrs := make(stringset.Set)
+	for _, s := range r.objects {
+		for addr := range s {
+			addrs.Add(addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("kubernetes service has no ready endpoints")
+	}
+	return addrs, nil
+}
+
+func (r *kubernetesResolver) String() string {
+	return fmt.Sprintf("kubernetes:%s/%s", r.config.Namespace, r.config.Service)
+}
+
+// stop stops watching the service.
+func (r *kubernetesResolver) stop() {
+	r.cancel()
+}
+
+// run watches the service until stopped, listing it again whenever a watch
+// ends.
+func (r *kubernetesResolver) run() {
+	for {
+		if err := r.watch(); err != nil && r.ctx.Err() == nil {
+			log.With("source", r).Errorf("Error watching kubernetes endpoints: %s", err)
+		}
+		for {
+			select {
+			case <-time.After(r.config.RetryInterval):
+			case <-r.ctx.Done():
+				return
+			}
+			err := r.list()
+			if err == nil {
+				break
+			}
+			log.With("source", r).Errorf("Error listing kubernetes endpoints: %s", err)
+		}
+	}
+}
+
+func (r *kubernetesResolver) url(watch bool) string {
+	var p string
+	q := url.Values{}
+	if r.config.API == KubernetesEndpointSlices {
+		p = fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices", r.config.Namespace)
+		q.Set("labelSelector", "kubernetes.io/service-name="+r.config.Service)
+	} else {
+		p = fmt.Sprintf("/api/v1/namespaces/%s/endpoints", r.config.Namespace)
+		q.Set("fieldSelector", "metadata.name="+r.config.Service)
+	}
+	if watch {
+		q.Set("watch", "true")
+		q.Set("allowWatchBookmarks", "true")
+		r.mu.Lock()
+		q.Set("resourceVersion", r.resourceVersion)
+		r.mu.Unlock()
+	}
+	return strings.TrimSuffix(r.config.APIServer, "/") + p + "?" + q.Encode()
+}
+
+func (r *kubernetesResolver) get(u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(r.ctx)
+	if token, err := ioutil.ReadFile(r.config.TokenFile); err == nil {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s %d: %s", u, resp.StatusCode, b)
+	}
+	return resp, nil
+}
+
+// list replaces the known endpoints with the current endpoints.
+func (r *kubernetesResolver) list() error {
+	resp, err := r.get(r.url(false))
+	if err != nil {
+		return fmt.Errorf("list: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var l k8sList
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return fmt.Errorf("decode list: %s", err)
+	}
+	objects := make(map[string]stringset.Set)
+	for _, o := range l.Items {
+		objects[o.Metadata.Name] = o.addrs(r.config.Port)
+	}
+
+	r.mu.Lock()
+	r.objects = objects
+	r.resourceVersion = l.Metadata.ResourceVersion
+	r.mu.Unlock()
+	return nil
+}
+
+// watch applies changes of the endpoints until the watch ends.
+func (r *kubernetesResolver) watch() error {
+	resp, err := r.get(r.url(true))
+	if err != nil {
+		return fmt.Errorf("watch: %s", err)
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var e k8sWatchEvent
+		if err := dec.Decode(&e); err != nil {
+			return fmt.Errorf("decode watch event: %s", err)
+		}
+		if e.Type == "ERROR" {
+			// E.g. the resource version is too old, which requires listing
+			// again.
+			return fmt.Errorf("watch error: %s", e.Object)
+		}
+		var o k8sObject
+		if err := json.Unmarshal(e.Object, &o); err != nil {
+			return fmt.Errorf("decode watch object: %s", err)
+		}
+		r.mu.Lock()
+		switch e.Type {
+		case "ADDED", "MODIFIED":
+			r.objects[o.Metadata.Name] = o.addrs(r.config.Port)
+		case "DELETED":
+			delete(r.objects, o.Metadata.Name)
+		}
+		if o.Metadata.ResourceVersion != "" {
+			r.resourceVersion = o.Metadata.ResourceVersion
+		}
+		r.mu.Unlock()
+	}
+}
+
+type k8sMetadata struct {
+	Name            string `json:"name"`
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+type k8sPort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// k8sObject holds the fields of EndpointSlice and Endpoints objects needed
+// to resolve addresses.
+type k8sObject struct {
+	Metadata k8sMetadata `json:"metadata"`
+
+	// EndpointSlice.
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []k8sPort `json:"ports"`
+
+	// Endpoints.
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []k8sPort `json:"ports"`
+	} `json:"subsets"`
+}
+
+type k8sList struct {
+	Metadata k8sMetadata `json:"metadata"`
+	Items    []k8sObject `json:"items"`
+}
+
+type k8sWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// addrs returns the ready addresses of o with the port named name.
+func (o k8sObject) addrs(name string) stringset.Set {
+	addrs := make(stringset.Set)
+	if port := findPort(o.Ports, name); port != 0 {
+		for _, e := range o.Endpoints {
+			// Endpoints with unknown readiness are ready.
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			for _, ip := range e.Addresses {
+				addrs.Add(net.JoinHostPort(ip, strconv.Itoa(port)))
+			}
+		}
+	}
+	for _, s := range o.Subsets {
+		// Not ready addresses are listed separately.
+		if port := findPort(s.Ports, name); port != 0 {
+			for _, a := range s.Addresses {
+				addrs.Add(net.JoinHostPort(a.IP, strconv.Itoa(port)))
+			}
+		}
+	}
+	return addrs
+}
+
+// findPort returns the port named name, or the first port if name is empty.
+// Returns 0 if there is no such port.
+func findPort(ports []k8sPort, name string) int {
+	for _, p := range ports {
+		if name == "" || p.Name == name {
+			return p.Port
+		}
+	}
+	return 0
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hostlist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/stringset"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+const _testEndpointSlice = `{
+	"metadata": {"name": "%s", "resourceVersion": "%d"},
+	"endpoints": [
+		{"addresses": ["%s"], "conditions": {"ready": true}},
+		{"addresses": ["10.0.0.99"], "conditions": {"ready": false}}
+	],
+	"ports": [{"name": "metrics", "port": 9090}, {"name": "http", "port": 80}]
+}`
+
+// fakeAPIServer serves a list of a single EndpointSlice and streams watch
+// events written to events.
+type fakeAPIServer struct {
+	t      *testing.T
+	token  string
+	events chan string
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	require := require.New(s.t)
+
+	require.Equal("/apis/discovery.k8s.io/v1/namespaces/kraken/endpointslices", r.URL.Path)
+	require.Equal("kubernetes.io/service-name=origin", r.URL.Query().Get("labelSelector"))
+	if s.token != "" {
+		require.Equal("Bearer "+s.token, r.Header.Get("Authorization"))
+	}
+
+	if r.URL.Query().Get("watch") != "true" {
+		fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [%s]}`,
+			fmt.Sprintf(_testEndpointSlice, "origin-a", 1, "10.0.0.1"))
+		return
+	}
+	require.Equal("1", r.URL.Query().Get("resourceVersion"))
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case e := <-s.events:
+			fmt.Fprintln(w, e)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func waitForAddrs(t *testing.T, r *kubernetesResolver, expected stringset.Set) {
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		addrs, _ := r.resolve()
+		return reflect.DeepEqual(addrs, expected)
+	}))
+}
+
+func TestKubernetesResolverWatchesEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "kubernetes")
+	require.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	tokenFile := path.Join(tmpdir, "token")
+	require.NoError(ioutil.WriteFile(tokenFile, []byte("some-token\n"), 0644))
+
+	api := &fakeAPIServer{t, "some-token", make(chan string)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	r, err := newKubernetesResolver(KubernetesConfig{
+		Service:   "origin",
+		Namespace: "kraken",
+		Port:      "http",
+		APIServer: server.URL,
+		TokenFile: tokenFile,
+	})
+	require.NoError(err)
+	defer r.stop()
+
+	addrs, err := r.resolve()
+	require.NoError(err)
+	require.Equal(stringset.New("10.0.0.1:80"), addrs)
+
+	api.events <- fmt.Sprintf(`{"type": "ADDED", "object": %s}`,
+		fmt.Sprintf(_testEndpointSlice, "origin-b", 2, "10.0.0.2"))
+	waitForAddrs(t, r, stringset.New("10.0.0.1:80", "10.0.0.2:80"))
+
+	api.events <- fmt.Sprintf(`{"type": "MODIFIED", "object": %s}`,
+		fmt.Sprintf(_testEndpointSlice, "origin-a", 3, "10.0.0.3"))
+	waitForAddrs(t, r, stringset.New("10.0.0.3:80", "10.0.0.2:80"))
+
+	api.events <- fmt.Sprintf(`{"type": "DELETED", "object": %s}`,
+		fmt.Sprintf(_testEndpointSlice, "origin-b", 4, "10.0.0.2"))
+	waitForAddrs(t, r, stringset.New("10.0.0.3:80"))
+}
+
+func TestKubernetesResolverEndpoints(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "true" {
+			<-r.Context().Done()
+			return
+		}
+		require.Equal("/api/v1/namespaces/kraken/endpoints", r.URL.Path)
+		require.Equal("metadata.name=origin", r.URL.Query().Get("fieldSelector"))
+		fmt.Fprint(w, `{"metadata": {"resourceVersion": "1"}, "items": [{
+			"metadata": {"name": "origin"},
+			"subsets": [{
+				"addresses": [{"ip": "10.0.0.1"}, {"ip": "10.0.0.2"}],
+				"notReadyAddresses": [{"ip": "10.0.0.3"}],
+				"ports": [{"name": "http", "port": 80}]
+			}]
+		}]}`)
+	}))
+	defer server.Close()
+
+	r, err := newKubernetesResolver(KubernetesConfig{
+		Service:   "origin",
+		Namespace: "kraken",
+		API:       KubernetesEndpoints,
+		APIServer: server.URL,
+		TokenFile: "/does/not/exist",
+		CAFile:    "/does/not/exist",
+	})
+	require.NoError(err)
+	defer r.stop()
+
+	addrs, err := r.resolve()
+	require.NoError(err)
+	require.Equal(stringset.New("10.0.0.1:80", "10.0.0.2:80"), addrs)
+}
+
+func TestKubernetesResolverListError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := newKubernetesResolver(KubernetesConfig{
+		Service:   "origin",
+		Namespace: "kraken",
+		APIServer: server.URL,
+		TokenFile: "/does/not/exist",
+		CAFile:    "/does/not/exist",
+	})
+	require.Error(t, err)
+}
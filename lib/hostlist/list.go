@@ -32,6 +32,21 @@ type List interface {
 	Resolve() stringset.Set
 }
 
+// Sampler is implemented by Lists which prefer some addresses over others.
+type Sampler interface {
+	// Sample returns up to n distinct addresses, most preferred first.
+	Sample(n int) []string
+}
+
+// Sample returns up to n addresses of l to try in order. If l is a Sampler,
+// its preferred addresses come first, else addresses are in random order.
+func Sample(l List, n int) []string {
+	if s, ok := l.(Sampler); ok {
+		return s.Sample(n)
+	}
+	return l.Resolve().Sample(n).ToSlice()
+}
+
 type list struct {
 	resolver resolver
 
@@ -14,6 +14,9 @@
 package hostlist
 
 import (
+	"context"
+	"errors"
+	"net"
 	"testing"
 
 	"github.com/uber/kraken/utils/stringset"
@@ -32,6 +35,31 @@ func TestListResolve(t *testing.T) {
 	require.ElementsMatch(addrs, l.Resolve().ToSlice())
 }
 
+type fixedSampler struct {
+	List
+	addrs []string
+}
+
+func (s fixedSampler) Sample(n int) []string {
+	if n > len(s.addrs) {
+		n = len(s.addrs)
+	}
+	return s.addrs[:n]
+}
+
+func TestSample(t *testing.T) {
+	require := require.New(t)
+
+	addrs := []string{"a:80", "b:80", "c:80"}
+
+	l, err := New(Config{Static: addrs})
+	require.NoError(err)
+
+	require.ElementsMatch(addrs, Sample(l, 3))
+	require.ElementsMatch([]string{"c:80", "a:80"}, Sample(fixedSampler{l, []string{"c:80", "a:80"}}, 3))
+	require.Equal([]string{"c:80"}, Sample(fixedSampler{l, []string{"c:80", "a:80"}}, 1))
+}
+
 func TestAttachPortIfMissing(t *testing.T) {
 	addrs, err := attachPortIfMissing(stringset.New("x", "y:5", "z"), 7)
 	require.NoError(t, err)
@@ -50,6 +78,10 @@ func TestInvalidConfig(t *testing.T) {
 	}{
 		{"dns missing port", Config{DNS: "some-dns"}},
 		{"static missing port", Config{Static: []string{"a:80", "b"}}},
+		{"no source", Config{}},
+		{"dns and static", Config{DNS: "some-dns:80", Static: []string{"a:80"}}},
+		{"srv and kubernetes", Config{
+			SRV: "_p2p._tcp.some-dns", Kubernetes: KubernetesConfig{Service: "origin"}}},
 	}
 	for _, test := range tests {
 		t.Run(test.desc, func(t *testing.T) {
@@ -58,3 +90,44 @@ func TestInvalidConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestSRVResolverResolve(t *testing.T) {
+	require := require.New(t)
+
+	r := &srvResolver{
+		srv: "_p2p._tcp.origin",
+		lookup: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+			require.Equal("_p2p._tcp.origin", name)
+			return "", []*net.SRV{
+				{Target: "origin1.", Port: 15001},
+				{Target: "origin2.", Port: 15002},
+			}, nil
+		},
+	}
+	addrs, err := r.resolve()
+	require.NoError(err)
+	require.Equal(stringset.New("origin1:15001", "origin2:15002"), addrs)
+}
+
+func TestSRVResolverResolveErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		records []*net.SRV
+		err     error
+	}{
+		{"lookup error", nil, errors.New("some error")},
+		{"empty record", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := &srvResolver{
+				srv: "_p2p._tcp.origin",
+				lookup: func(context.Context, string, string, string) (string, []*net.SRV, error) {
+					return "", test.records, test.err
+				},
+			}
+			_, err := r.resolve()
+			require.Error(t, err)
+		})
+	}
+}
@@ -215,3 +215,39 @@ func (rh *RendezvousHash) GetOrderedNodes(key string, n int) []*RendezvousHashNo
 	}
 	return nodes[:n]
 }
+
+// Ownership describes the share of keys owned by a node.
+type Ownership struct {
+	Weight int `json:"weight"`
+
+	// Primary is the fraction of keys for which the node has the highest score.
+	Primary float64 `json:"primary"`
+
+	// Replica is the fraction of keys for which the node is among the n
+	// highest scoring nodes.
+	Replica float64 `json:"replica"`
+}
+
+// Ownership estimates the share of keys owned by each node when each key is
+// owned by its n highest scoring nodes, using keys as a sample of the key space.
+func (rh *RendezvousHash) Ownership(keys []string, n int) map[string]Ownership {
+	primary := make(map[string]int)
+	replica := make(map[string]int)
+	for _, key := range keys {
+		for i, node := range rh.GetOrderedNodes(key, n) {
+			if i == 0 {
+				primary[node.Label]++
+			}
+			replica[node.Label]++
+		}
+	}
+	ownership := make(map[string]Ownership, len(rh.Nodes))
+	for _, node := range rh.Nodes {
+		ownership[node.Label] = Ownership{
+			Weight:  node.Weight,
+			Primary: float64(primary[node.Label]) / float64(len(keys)),
+			Replica: float64(replica[node.Label]) / float64(len(keys)),
+		}
+	}
+	return ownership
+}
@@ -272,3 +272,18 @@ func testRemovingCapacity(numKeys int, hash HashFactory, scoreFunc UIntToFloat,
 	// Make sure we still keep the target distribution after resharding.
 	assertKeyDistribution(t, rh, nodekeys, numKeys, 900.0, 0.1)
 }
+
+func TestOwnership(t *testing.T) {
+	rh := NewRendezvousHash(Murmur3Hash, UInt64ToFloat64)
+	rh.AddNode("a", 100)
+	rh.AddNode("b", 100)
+
+	keys := []string{"0000", "1000", "2000", "3000"}
+	ownership := rh.Ownership(keys, 2)
+	assert.Len(t, ownership, 2)
+	for _, o := range ownership {
+		assert.Equal(t, 100, o.Weight)
+		assert.Equal(t, 1.0, o.Replica)
+	}
+	assert.Equal(t, 1.0, ownership["a"].Primary+ownership["b"].Primary)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ingest
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+func init() {
+	Register("gzip_normalize", gzipNormalizer{})
+}
+
+// gzipNormalizer re-compresses gzip blobs with a fixed compression level and
+// an empty header, stripping file names and modification timestamps which
+// otherwise make identical layers produce different digests.
+type gzipNormalizer struct{}
+
+func (gzipNormalizer) Transform(src io.Reader, dst io.Writer) error {
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		if err == gzip.ErrHeader || err == io.EOF {
+			return ErrSkip
+		}
+		return fmt.Errorf("gzip reader: %s", err)
+	}
+	defer zr.Close()
+
+	zw, err := gzip.NewWriterLevel(dst, gzip.DefaultCompression)
+	if err != nil {
+		return fmt.Errorf("gzip writer: %s", err)
+	}
+	if _, err := io.Copy(zw, zr); err != nil {
+		return fmt.Errorf("copy: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("close gzip writer: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/uber/kraken/core"
+)
+
+// HooksFlag is the feature flag which enables ingest hooks per namespace.
+const HooksFlag = "ingest_hooks"
+
+// ErrSkip is returned by Transformers which do not apply to the given blob,
+// e.g. a gzip transformer receiving uncompressed data.
+var ErrSkip = errors.New("transformer does not apply to blob")
+
+// Transformer transforms blob content at ingest time. Transformers must be
+// deterministic, such that transforming the same blob twice yields the same
+// derived digest.
+type Transformer interface {
+	Transform(src io.Reader, dst io.Writer) error
+}
+
+var _transformers = make(map[string]Transformer)
+
+// Register registers a Transformer under name. Transformers registered in
+// init functions may be referenced from Config.
+func Register(name string, t Transformer) {
+	_transformers[name] = t
+}
+
+func getTransformer(name string) (Transformer, error) {
+	t, ok := _transformers[name]
+	if !ok {
+		return nil, fmt.Errorf("no transformer defined with name %s", name)
+	}
+	return t, nil
+}
+
+// RuleConfig enables transformers for namespaces matching a regexp.
+type RuleConfig struct {
+	Namespace    string   `yaml:"namespace"`
+	Transformers []string `yaml:"transformers"`
+}
+
+// Config defines ingest hook configuration.
+type Config struct {
+	Rules []RuleConfig `yaml:"rules"`
+}
+
+// Hook is a named Transformer.
+type Hook struct {
+	Name        string
+	Transformer Transformer
+}
+
+type rule struct {
+	regexp *regexp.Regexp
+	hooks  []Hook
+}
+
+// Hooks selects the ingest hooks which apply to a namespace.
+type Hooks struct {
+	rules []rule
+}
+
+// New creates a new Hooks.
+func New(config Config) (*Hooks, error) {
+	var rules []rule
+	for _, rc := range config.Rules {
+		re, err := regexp.Compile(rc.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("regexp %s: %s", rc.Namespace, err)
+		}
+		var hooks []Hook
+		for _, name := range rc.Transformers {
+			t, err := getTransformer(name)
+			if err != nil {
+				return nil, err
+			}
+			hooks = append(hooks, Hook{name, t})
+		}
+		rules = append(rules, rule{re, hooks})
+	}
+	return &Hooks{rules}, nil
+}
+
+// Match returns the hooks of the first rule matching namespace.
+func (h *Hooks) Match(namespace string) []Hook {
+	for _, r := range h.rules {
+		if r.regexp.MatchString(namespace) {
+			return r.hooks
+		}
+	}
+	return nil
+}
+
+// DerivedTag returns the build-index tag which maps d to the blob derived from
+// it by transformer.
+func DerivedTag(transformer string, d core.Digest) string {
+	return fmt.Sprintf("kraken-derived/%s:%s", transformer, d.Hex())
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ingest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/kraken/utils/randutil"
+)
+
+func TestHooksMatch(t *testing.T) {
+	require := require.New(t)
+
+	hooks, err := New(Config{Rules: []RuleConfig{
+		{Namespace: "zstd/.*", Transformers: []string{"gzip_normalize"}},
+		{Namespace: ".*"},
+	}})
+	require.NoError(err)
+
+	matched := hooks.Match("zstd/foo")
+	require.Len(matched, 1)
+	require.Equal("gzip_normalize", matched[0].Name)
+
+	require.Empty(hooks.Match("bar"))
+}
+
+func TestNewUnknownTransformer(t *testing.T) {
+	_, err := New(Config{Rules: []RuleConfig{
+		{Namespace: ".*", Transformers: []string{"unknown"}},
+	}})
+	require.Error(t, err)
+}
+
+func gzipBlob(t *testing.T, content []byte, name string, modTime time.Time) []byte {
+	var b bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&b, gzip.BestSpeed)
+	require.NoError(t, err)
+	zw.Name = name
+	zw.ModTime = modTime
+	_, err = zw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return b.Bytes()
+}
+
+func TestGzipNormalizeIsDeterministic(t *testing.T) {
+	require := require.New(t)
+
+	content := randutil.Text(4096)
+	blob1 := gzipBlob(t, content, "a", time.Unix(1, 0))
+	blob2 := gzipBlob(t, content, "b", time.Unix(2, 0))
+	require.NotEqual(blob1, blob2)
+
+	var out1, out2 bytes.Buffer
+	require.NoError(gzipNormalizer{}.Transform(bytes.NewReader(blob1), &out1))
+	require.NoError(gzipNormalizer{}.Transform(bytes.NewReader(blob2), &out2))
+	require.Equal(out1.Bytes(), out2.Bytes())
+
+	zr, err := gzip.NewReader(&out1)
+	require.NoError(err)
+	result, err := ioutil.ReadAll(zr)
+	require.NoError(err)
+	require.Equal(content, result)
+}
+
+func TestGzipNormalizeSkipsUncompressedBlobs(t *testing.T) {
+	var out bytes.Buffer
+	err := gzipNormalizer{}.Transform(bytes.NewReader(randutil.Text(64)), &out)
+	require.Equal(t, ErrSkip, err)
+}
+
+func TestGzipToZstdIsDeterministic(t *testing.T) {
+	require := require.New(t)
+
+	content := randutil.Text(4096)
+	blob1 := gzipBlob(t, content, "a", time.Unix(1, 0))
+	blob2 := gzipBlob(t, content, "b", time.Unix(2, 0))
+
+	var out1, out2 bytes.Buffer
+	require.NoError(zstdRecompressor{}.Transform(bytes.NewReader(blob1), &out1))
+	require.NoError(zstdRecompressor{}.Transform(bytes.NewReader(blob2), &out2))
+	require.Equal(out1.Bytes(), out2.Bytes())
+
+	zr, err := zstd.NewReader(&out1)
+	require.NoError(err)
+	defer zr.Close()
+	result, err := ioutil.ReadAll(zr)
+	require.NoError(err)
+	require.Equal(content, result)
+}
+
+func TestGzipToZstdSkipsUncompressedBlobs(t *testing.T) {
+	var out bytes.Buffer
+	err := zstdRecompressor{}.Transform(bytes.NewReader(randutil.Text(64)), &out)
+	require.Equal(t, ErrSkip, err)
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ingest
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func init() {
+	Register("gzip_to_zstd", zstdRecompressor{})
+}
+
+// zstdRecompressor re-compresses gzip blobs, e.g. image layers, with zstd.
+// The encoder runs single-threaded with a fixed level, such that the output
+// only depends on the uncompressed content.
+type zstdRecompressor struct{}
+
+func (zstdRecompressor) Transform(src io.Reader, dst io.Writer) error {
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		if err == gzip.ErrHeader || err == io.EOF {
+			return ErrSkip
+		}
+		return fmt.Errorf("gzip reader: %s", err)
+	}
+	defer zr.Close()
+
+	zw, err := zstd.NewWriter(
+		dst,
+		zstd.WithEncoderLevel(zstd.SpeedDefault),
+		zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return fmt.Errorf("zstd writer: %s", err)
+	}
+	if _, err := io.Copy(zw, zr); err != nil {
+		zw.Close()
+		return fmt.Errorf("copy: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("close zstd writer: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lease
+
+import "time"
+
+// Config defines Manager configuration.
+type Config struct {
+	// Path is the file in which leases are kept across restarts. If empty,
+	// leases are only kept in memory. Blobs stay protected until the deadline
+	// of their leases either way.
+	Path string `yaml:"path"`
+
+	// MaxDuration caps how far in the future lease deadlines may be.
+	MaxDuration time.Duration `yaml:"max_duration"`
+
+	// MaxDigests caps the number of digests of a single lease.
+	MaxDigests int `yaml:"max_digests"`
+
+	// MaxLeases caps the number of active leases, such that leases cannot
+	// protect an unbounded share of the cache from eviction.
+	MaxLeases int `yaml:"max_leases"`
+
+	// FetchConcurrency is the number of leased blobs fetched in parallel.
+	FetchConcurrency int `yaml:"fetch_concurrency"`
+
+	// RetryInterval is how often blobs which could not be fetched are
+	// fetched again, and how often expired leases are removed.
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.MaxDuration == 0 {
+		c.MaxDuration = 72 * time.Hour
+	}
+	if c.MaxDigests == 0 {
+		c.MaxDigests = 1000
+	}
+	if c.MaxLeases == 0 {
+		c.MaxLeases = 100
+	}
+	if c.FetchConcurrency == 0 {
+		c.FetchConcurrency = 4
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = 30 * time.Second
+	}
+	return c
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lease
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/go-chi/chi"
+)
+
+// Handler returns an http.Handler which exposes m:
+//
+//	GET    /       lists all leases.
+//	POST   /       acquires a lease for the JSON Request in the body.
+//	GET    /{id}   returns a lease.
+//	DELETE /{id}   releases a lease.
+func (m *Manager) Handler() http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "application/json")
+		return writeJSON(w, m.List())
+	}))
+
+	r.Post("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+		}
+		l, err := m.Acquire(req)
+		if err != nil {
+			if _, ok := err.(*RequestError); ok {
+				return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+			}
+			if err == ErrTooManyLeases {
+				return handler.Errorf("%s", err).Status(http.StatusTooManyRequests)
+			}
+			return handler.Errorf("acquire: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		return writeJSON(w, l)
+	}))
+
+	r.Get("/{id}", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := httputil.ParseParam(r, "id")
+		if err != nil {
+			return err
+		}
+		l, err := m.Get(id)
+		if err == ErrNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return writeJSON(w, l)
+	}))
+
+	r.Delete("/{id}", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		id, err := httputil.ParseParam(r, "id")
+		if err != nil {
+			return err
+		}
+		if err := m.Release(id); err == ErrNotFound {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return nil
+	}))
+
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lease
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	m := newManager(t, Config{}, newFakeStore(), clk)
+	defer m.Close()
+
+	addr, stop := testutil.StartServer(m.Handler())
+	defer stop()
+
+	d := core.DigestFixture()
+	b, err := json.Marshal(Request{
+		Namespace: "ns",
+		Digests:   []core.Digest{d},
+		Deadline:  clk.Now().Add(time.Hour),
+	})
+	require.NoError(err)
+
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/", addr),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var l Lease
+	require.NoError(json.NewDecoder(resp.Body).Decode(&l))
+	require.NotEmpty(l.ID)
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var leases []Lease
+	require.NoError(json.NewDecoder(resp.Body).Decode(&leases))
+	require.Len(leases, 1)
+	require.Equal(l.ID, leases[0].ID)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/%s", addr, l.ID))
+	require.NoError(err)
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/%s", addr, l.ID))
+	require.NoError(err)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/%s", addr, l.ID))
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestHandlerInvalidRequest(t *testing.T) {
+	m := newManager(t, Config{}, newFakeStore(), clock.NewMock())
+	defer m.Close()
+
+	addr, stop := testutil.StartServer(m.Handler())
+	defer stop()
+
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/", addr),
+		httputil.SendBody(bytes.NewReader([]byte(`{"digests": []}`))))
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestHandlerTooManyLeases(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	m := newManager(t, Config{MaxLeases: 1}, newFakeStore(), clk)
+	defer m.Close()
+
+	addr, stop := testutil.StartServer(m.Handler())
+	defer stop()
+
+	b, err := json.Marshal(Request{
+		Namespace: "ns",
+		Digests:   []core.Digest{core.DigestFixture()},
+		Deadline:  clk.Now().Add(time.Hour),
+	})
+	require.NoError(err)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/", addr),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	require.NoError(err)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/", addr),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+}
@@ -0,0 +1,487 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/docker/distribution/uuid"
+	"github.com/uber-go/tally"
+)
+
+// ErrNotFound is returned for unknown lease IDs.
+var ErrNotFound = errors.New("lease not found")
+
+// ErrTooManyLeases is returned when acquiring a lease would exceed the
+// configured max leases.
+var ErrTooManyLeases = errors.New("too many leases")
+
+// RequestError is returned for invalid lease requests.
+type RequestError struct {
+	msg string
+}
+
+func (e *RequestError) Error() string {
+	return e.msg
+}
+
+// Digest states.
+const (
+	// StatePending means the blob is not available yet, because it is being
+	// fetched or fetching it failed and will be retried.
+	StatePending = "pending"
+
+	// StateAvailable means the blob is available and protected from eviction
+	// until the deadline of the lease.
+	StateAvailable = "available"
+)
+
+// Request requests that blobs of namespace remain available until deadline.
+type Request struct {
+	Namespace string        `json:"namespace"`
+	Digests   []core.Digest `json:"digests"`
+	Deadline  time.Time     `json:"deadline"`
+}
+
+// DigestStatus is the state of a single blob of a lease.
+type DigestStatus struct {
+	Digest core.Digest `json:"digest"`
+	State  string      `json:"state"`
+
+	// Error is the last error fetching the blob, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Lease guarantees the availability of blobs until its deadline.
+type Lease struct {
+	ID        string         `json:"id"`
+	Namespace string         `json:"namespace"`
+	Deadline  time.Time      `json:"deadline"`
+	CreatedAt time.Time      `json:"created_at"`
+	Digests   []DigestStatus `json:"digests"`
+}
+
+func (l *Lease) copy() Lease {
+	c := *l
+	c.Digests = append([]DigestStatus(nil), l.Digests...)
+	return c
+}
+
+// Store holds the blobs of leases.
+type Store interface {
+	SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error)
+	DeleteCacheFileMetadata(name string, md metadata.Metadata) error
+}
+
+// FetchFunc makes blob d of namespace available in the store. It returns nil
+// once the blob is cached.
+type FetchFunc func(namespace string, d core.Digest) error
+
+// Manager manages leases. Blobs of a lease are fetched into the store and
+// then protected from eviction with lease metadata, which expires at the
+// latest deadline among the leases of the blob. Fetches are retried until
+// they succeed or the lease expires.
+type Manager struct {
+	config Config
+	stats  tally.Scope
+	clk    clock.Clock
+	store  Store
+	fetch  FetchFunc
+	sem    chan struct{}
+
+	mu       sync.Mutex
+	leases   map[string]*Lease
+	inflight map[string]bool // <lease id>/<digest> -> fetching.
+
+	kick     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Option allows setting optional Manager parameters.
+type Option func(*Manager)
+
+// WithClock configures a Manager with a custom clock.
+func WithClock(clk clock.Clock) Option {
+	return func(m *Manager) { m.clk = clk }
+}
+
+// NewManager creates a new Manager, restoring leases from the configured path.
+func NewManager(
+	config Config,
+	stats tally.Scope,
+	store Store,
+	fetch FetchFunc,
+	opts ...Option) (*Manager, error) {
+
+	config = config.applyDefaults()
+	stats = stats.Tagged(map[string]string{"module": "lease"})
+
+	m := &Manager{
+		config:   config,
+		stats:    stats,
+		clk:      clock.New(),
+		store:    store,
+		fetch:    fetch,
+		sem:      make(chan struct{}, config.FetchConcurrency),
+		leases:   make(map[string]*Lease),
+		inflight: make(map[string]bool),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.load(); err != nil {
+		return nil, fmt.Errorf("load leases: %s", err)
+	}
+
+	m.wg.Add(1)
+	go m.loop()
+	m.trigger()
+
+	return m, nil
+}
+
+// Close stops m. Leases are kept.
+func (m *Manager) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.wg.Wait()
+}
+
+// Acquire creates a new lease for r, and starts fetching its blobs.
+func (m *Manager) Acquire(r Request) (Lease, error) {
+	now := m.clk.Now()
+	if len(r.Digests) == 0 {
+		return Lease{}, &RequestError{"no digests"}
+	}
+	if len(r.Digests) > m.config.MaxDigests {
+		return Lease{}, &RequestError{
+			fmt.Sprintf("%d digests exceed limit of %d", len(r.Digests), m.config.MaxDigests)}
+	}
+	if !r.Deadline.After(now) {
+		return Lease{}, &RequestError{"deadline must be in the future"}
+	}
+	if r.Deadline.Sub(now) > m.config.MaxDuration {
+		return Lease{}, &RequestError{
+			fmt.Sprintf("deadline exceeds max duration of %s", m.config.MaxDuration)}
+	}
+
+	l := &Lease{
+		ID:        uuid.Generate().String(),
+		Namespace: r.Namespace,
+		Deadline:  r.Deadline,
+		CreatedAt: now,
+	}
+	seen := make(map[core.Digest]bool)
+	for _, d := range r.Digests {
+		if !seen[d] {
+			seen[d] = true
+			l.Digests = append(l.Digests, DigestStatus{Digest: d, State: StatePending})
+		}
+	}
+
+	m.mu.Lock()
+	if len(m.leases) >= m.config.MaxLeases {
+		m.mu.Unlock()
+		m.stats.Counter("rejected").Inc(1)
+		return Lease{}, ErrTooManyLeases
+	}
+	m.leases[l.ID] = l
+	err := m.save()
+	result := l.copy()
+	m.mu.Unlock()
+
+	if err != nil {
+		log.With("lease", l.ID).Errorf("Error saving leases: %s", err)
+	}
+	m.stats.Counter("acquired").Inc(1)
+	m.trigger()
+	return result, nil
+}
+
+// Get returns the lease of id.
+func (m *Manager) Get(id string) (Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.leases[id]
+	if !ok {
+		return Lease{}, ErrNotFound
+	}
+	return l.copy(), nil
+}
+
+// List returns all leases, ordered by deadline.
+func (m *Manager) List() []Lease {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Lease, 0, len(m.leases))
+	for _, l := range m.leases {
+		result = append(result, l.copy())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Deadline.Before(result[j].Deadline)
+	})
+	return result
+}
+
+// Release removes the lease of id before its deadline. Its blobs may be
+// evicted again, unless they are held by other leases.
+func (m *Manager) Release(id string) error {
+	m.mu.Lock()
+	l, ok := m.leases[id]
+	if !ok {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(m.leases, id)
+	err := m.save()
+	m.mu.Unlock()
+
+	if err != nil {
+		log.With("lease", id).Errorf("Error saving leases: %s", err)
+	}
+	m.stats.Counter("released").Inc(1)
+	m.unhold(l)
+	return nil
+}
+
+func (m *Manager) trigger() {
+	select {
+	case m.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) loop() {
+	defer m.wg.Done()
+
+	ticker := m.clk.Ticker(m.config.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.kick:
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+		m.refresh()
+	}
+}
+
+// refresh removes expired leases and starts fetching pending blobs.
+func (m *Manager) refresh() {
+	now := m.clk.Now()
+
+	m.mu.Lock()
+	var expired []*Lease
+	for id, l := range m.leases {
+		if !now.Before(l.Deadline) {
+			delete(m.leases, id)
+			expired = append(expired, l)
+		}
+	}
+	if len(expired) > 0 {
+		if err := m.save(); err != nil {
+			log.Errorf("Error saving leases: %s", err)
+		}
+	}
+	var pending int
+	for _, l := range m.leases {
+		for _, s := range l.Digests {
+			if s.State != StatePending {
+				continue
+			}
+			pending++
+			key := l.ID + "/" + s.Digest.String()
+			if m.inflight[key] {
+				continue
+			}
+			m.inflight[key] = true
+			m.wg.Add(1)
+			go m.hold(l.ID, l.Namespace, s.Digest, key)
+		}
+	}
+	m.stats.Gauge("leases").Update(float64(len(m.leases)))
+	m.stats.Gauge("pending_blobs").Update(float64(pending))
+	m.mu.Unlock()
+
+	for _, l := range expired {
+		m.stats.Counter("expired").Inc(1)
+		m.unhold(l)
+	}
+}
+
+// hold fetches d for the lease of id and protects it until the latest
+// deadline of its leases.
+func (m *Manager) hold(id, namespace string, d core.Digest, key string) {
+	defer m.wg.Done()
+	defer func() {
+		m.mu.Lock()
+		delete(m.inflight, key)
+		m.mu.Unlock()
+	}()
+
+	select {
+	case m.sem <- struct{}{}:
+	case <-m.stop:
+		return
+	}
+	defer func() { <-m.sem }()
+
+	err := m.protect(d)
+	if err != nil {
+		if err = m.fetch(namespace, d); err == nil {
+			err = m.protect(d)
+		}
+	}
+	if err != nil {
+		m.stats.Counter("fetch_errors").Inc(1)
+		log.With("lease", id, "digest", d).Infof("Leased blob not available yet: %s", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.leases[id]
+	if !ok {
+		return
+	}
+	for i := range l.Digests {
+		if l.Digests[i].Digest != d {
+			continue
+		}
+		if err != nil {
+			l.Digests[i].Error = err.Error()
+		} else {
+			l.Digests[i].State = StateAvailable
+			l.Digests[i].Error = ""
+		}
+	}
+}
+
+// protect sets the lease metadata of d to the latest deadline of its leases.
+// Returns an error if d is not cached.
+func (m *Manager) protect(d core.Digest) error {
+	deadline, ok := m.deadline(d)
+	if !ok {
+		return nil
+	}
+	_, err := m.store.SetCacheFileMetadata(d.Name(), metadata.NewLease(deadline))
+	return err
+}
+
+// unhold recomputes the lease metadata of the blobs of the removed lease l.
+func (m *Manager) unhold(l *Lease) {
+	for _, s := range l.Digests {
+		if s.State != StateAvailable {
+			continue
+		}
+		var err error
+		if _, ok := m.deadline(s.Digest); ok {
+			// Other leases may have shorter deadlines than l.
+			err = m.protect(s.Digest)
+		} else {
+			err = m.store.DeleteCacheFileMetadata(s.Digest.Name(), &metadata.Lease{})
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.With("lease", l.ID, "digest", s.Digest).Errorf(
+				"Error updating lease metadata: %s", err)
+		}
+	}
+}
+
+// deadline returns the latest deadline among leases of d.
+func (m *Manager) deadline(d core.Digest) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deadline time.Time
+	var ok bool
+	for _, l := range m.leases {
+		for _, s := range l.Digests {
+			if s.Digest == d && l.Deadline.After(deadline) {
+				deadline = l.Deadline
+				ok = true
+			}
+		}
+	}
+	return deadline, ok
+}
+
+// save writes all leases to the configured path. Must be called with m.mu
+// held.
+func (m *Manager) save() error {
+	if m.config.Path == "" {
+		return nil
+	}
+	leases := make([]*Lease, 0, len(m.leases))
+	for _, l := range m.leases {
+		leases = append(leases, l)
+	}
+	b, err := json.Marshal(leases)
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.Path), 0755); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+	tmp := m.config.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("write: %s", err)
+	}
+	return os.Rename(tmp, m.config.Path)
+}
+
+// load restores leases from the configured path. Blobs of restored leases are
+// held again, since they may have been evicted while the leases were not
+// tracked.
+func (m *Manager) load() error {
+	if m.config.Path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(m.config.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var leases []*Lease
+	if err := json.Unmarshal(b, &leases); err != nil {
+		return fmt.Errorf("json unmarshal: %s", err)
+	}
+	for _, l := range leases {
+		for i := range l.Digests {
+			l.Digests[i].State = StatePending
+		}
+		m.leases[l.ID] = l
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lease
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// fakeStore is an in-memory Store whose blobs are cached by fetch.
+type fakeStore struct {
+	sync.Mutex
+	cached map[string]bool
+	leases map[string]time.Time
+	fails  map[core.Digest]bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		cached: make(map[string]bool),
+		leases: make(map[string]time.Time),
+		fails:  make(map[core.Digest]bool),
+	}
+}
+
+func (s *fakeStore) SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if !s.cached[name] {
+		return false, os.ErrNotExist
+	}
+	s.leases[name] = md.(*metadata.Lease).Deadline
+	return true, nil
+}
+
+func (s *fakeStore) DeleteCacheFileMetadata(name string, md metadata.Metadata) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.leases[name]; !ok {
+		return os.ErrNotExist
+	}
+	delete(s.leases, name)
+	return nil
+}
+
+func (s *fakeStore) fetch(namespace string, d core.Digest) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fails[d] {
+		return errors.New("some error")
+	}
+	s.cached[d.Name()] = true
+	return nil
+}
+
+func (s *fakeStore) setFails(d core.Digest, fails bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.fails[d] = fails
+}
+
+func (s *fakeStore) lease(d core.Digest) (time.Time, bool) {
+	s.Lock()
+	defer s.Unlock()
+	t, ok := s.leases[d.Name()]
+	return t, ok
+}
+
+func waitForState(t *testing.T, m *Manager, id string, d core.Digest, state string) {
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		l, err := m.Get(id)
+		if err != nil {
+			return false
+		}
+		for _, s := range l.Digests {
+			if s.Digest == d {
+				return s.State == state
+			}
+		}
+		return false
+	}))
+}
+
+func newManager(
+	t *testing.T, config Config, store *fakeStore, clk clock.Clock) *Manager {
+
+	m, err := NewManager(config, tally.NoopScope, store, store.fetch, WithClock(clk))
+	require.NoError(t, err)
+	return m
+}
+
+func TestManagerAcquireFetchesAndProtectsBlobs(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	store := newFakeStore()
+	m := newManager(t, Config{}, store, clk)
+	defer m.Close()
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+	deadline := clk.Now().Add(time.Hour)
+
+	l, err := m.Acquire(Request{Namespace: "ns", Digests: []core.Digest{d1, d2, d1}, Deadline: deadline})
+	require.NoError(err)
+	require.Len(l.Digests, 2)
+
+	for _, d := range []core.Digest{d1, d2} {
+		waitForState(t, m, l.ID, d, StateAvailable)
+		leased, ok := store.lease(d)
+		require.True(ok)
+		require.True(deadline.Equal(leased))
+	}
+	require.Len(m.List(), 1)
+}
+
+func TestManagerRetriesFailedFetches(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	store := newFakeStore()
+	m := newManager(t, Config{RetryInterval: time.Minute}, store, clk)
+	defer m.Close()
+
+	d := core.DigestFixture()
+	store.setFails(d, true)
+
+	l, err := m.Acquire(Request{Digests: []core.Digest{d}, Deadline: clk.Now().Add(time.Hour)})
+	require.NoError(err)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		l, err := m.Get(l.ID)
+		return err == nil && l.Digests[0].Error != ""
+	}))
+	l, err = m.Get(l.ID)
+	require.NoError(err)
+	require.Equal(StatePending, l.Digests[0].State)
+
+	store.setFails(d, false)
+	clk.Add(time.Minute)
+	waitForState(t, m, l.ID, d, StateAvailable)
+}
+
+func TestManagerReleaseKeepsLatestDeadlineOfOtherLeases(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	store := newFakeStore()
+	m := newManager(t, Config{}, store, clk)
+	defer m.Close()
+
+	d := core.DigestFixture()
+	short := clk.Now().Add(time.Hour)
+	long := clk.Now().Add(2 * time.Hour)
+
+	l1, err := m.Acquire(Request{Digests: []core.Digest{d}, Deadline: short})
+	require.NoError(err)
+	waitForState(t, m, l1.ID, d, StateAvailable)
+
+	l2, err := m.Acquire(Request{Digests: []core.Digest{d}, Deadline: long})
+	require.NoError(err)
+	waitForState(t, m, l2.ID, d, StateAvailable)
+
+	leased, _ := store.lease(d)
+	require.True(long.Equal(leased))
+
+	require.NoError(m.Release(l2.ID))
+	leased, _ = store.lease(d)
+	require.True(short.Equal(leased))
+
+	require.NoError(m.Release(l1.ID))
+	_, ok := store.lease(d)
+	require.False(ok)
+
+	require.Equal(ErrNotFound, m.Release(l1.ID))
+}
+
+func TestManagerExpiresLeases(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	store := newFakeStore()
+	m := newManager(t, Config{RetryInterval: time.Minute}, store, clk)
+	defer m.Close()
+
+	d := core.DigestFixture()
+	l, err := m.Acquire(Request{Digests: []core.Digest{d}, Deadline: clk.Now().Add(time.Minute)})
+	require.NoError(err)
+	waitForState(t, m, l.ID, d, StateAvailable)
+
+	clk.Add(time.Minute)
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		_, err := m.Get(l.ID)
+		return err == ErrNotFound
+	}))
+	_, ok := store.lease(d)
+	require.False(ok)
+}
+
+func TestManagerAcquireInvalidRequests(t *testing.T) {
+	clk := clock.NewMock()
+	m := newManager(t, Config{MaxDigests: 1, MaxDuration: time.Hour}, newFakeStore(), clk)
+	defer m.Close()
+
+	tests := []struct {
+		desc    string
+		request Request
+	}{
+		{"no digests", Request{Deadline: clk.Now().Add(time.Minute)}},
+		{"too many digests", Request{
+			Digests:  []core.Digest{core.DigestFixture(), core.DigestFixture()},
+			Deadline: clk.Now().Add(time.Minute),
+		}},
+		{"past deadline", Request{Digests: []core.Digest{core.DigestFixture()}, Deadline: clk.Now()}},
+		{"deadline too far", Request{
+			Digests:  []core.Digest{core.DigestFixture()},
+			Deadline: clk.Now().Add(2 * time.Hour),
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := m.Acquire(test.request)
+			_, ok := err.(*RequestError)
+			require.True(t, ok)
+		})
+	}
+}
+
+func TestManagerAcquireRejectsLeasesBeyondMaxLeases(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	m := newManager(t, Config{MaxLeases: 1}, newFakeStore(), clk)
+	defer m.Close()
+
+	r := Request{Digests: []core.Digest{core.DigestFixture()}, Deadline: clk.Now().Add(time.Hour)}
+
+	l, err := m.Acquire(r)
+	require.NoError(err)
+
+	_, err = m.Acquire(r)
+	require.Equal(ErrTooManyLeases, err)
+
+	require.NoError(m.Release(l.ID))
+
+	_, err = m.Acquire(r)
+	require.NoError(err)
+}
+
+func TestManagerRestoresLeases(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "lease")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := Config{Path: filepath.Join(dir, "leases.json")}
+	clk := clock.NewMock()
+	store := newFakeStore()
+
+	m := newManager(t, config, store, clk)
+	d := core.DigestFixture()
+	l, err := m.Acquire(Request{Namespace: "ns", Digests: []core.Digest{d}, Deadline: clk.Now().Add(time.Hour)})
+	require.NoError(err)
+	waitForState(t, m, l.ID, d, StateAvailable)
+	m.Close()
+
+	m = newManager(t, config, store, clk)
+	defer m.Close()
+
+	restored, err := m.Get(l.ID)
+	require.NoError(err)
+	require.Equal("ns", restored.Namespace)
+	require.True(l.Deadline.Equal(restored.Deadline))
+	waitForState(t, m, l.ID, d, StateAvailable)
+}
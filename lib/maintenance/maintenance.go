@@ -0,0 +1,175 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package maintenance implements a read-only mode which servers can be put
+// into at runtime, e.g. to safely drain nodes during storage migrations.
+package maintenance
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/go-chi/chi"
+	"github.com/uber-go/tally"
+)
+
+// Path is where Handler is mounted. Requests to Path are never rejected, so
+// read-only mode can always be turned off.
+const Path = "/x/maintenance"
+
+// Config defines Mode configuration.
+type Config struct {
+	// ReadOnly starts the server in read-only mode.
+	ReadOnly bool `yaml:"read_only"`
+
+	// RetryAfter is returned to rejected writes in the Retry-After header.
+	RetryAfter time.Duration `yaml:"retry_after"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.RetryAfter == 0 {
+		c.RetryAfter = time.Minute
+	}
+	return c
+}
+
+// Pausable is background work which must be paused in read-only mode, such
+// as persistedretry.Manager.
+type Pausable interface {
+	Pause()
+	Resume()
+}
+
+// StatusResponse is the body returned by GET Path.
+type StatusResponse struct {
+	ReadOnly bool `json:"read_only"`
+}
+
+// Mode toggles read-only mode. In read-only mode, requests other than GET and
+// HEAD are rejected with 503, and all Pausables are paused.
+type Mode struct {
+	config    Config
+	stats     tally.Scope
+	pausables []Pausable
+
+	mu       sync.RWMutex
+	readOnly bool
+}
+
+// New creates a new Mode, pausing pausables if config starts in read-only
+// mode.
+func New(config Config, stats tally.Scope, pausables ...Pausable) *Mode {
+	config = config.applyDefaults()
+	m := &Mode{
+		config:    config,
+		stats:     stats.Tagged(map[string]string{"module": "maintenance"}),
+		pausables: pausables,
+	}
+	m.stats.Gauge("read_only").Update(0)
+	m.SetReadOnly(config.ReadOnly)
+	return m
+}
+
+// Disabled returns a Mode which is never read-only unless toggled.
+func Disabled() *Mode {
+	return New(Config{}, tally.NoopScope)
+}
+
+// ReadOnly returns whether m is in read-only mode.
+func (m *Mode) ReadOnly() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.readOnly
+}
+
+// SetReadOnly toggles read-only mode.
+func (m *Mode) SetReadOnly(readOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.readOnly == readOnly {
+		return
+	}
+	m.readOnly = readOnly
+	for _, p := range m.pausables {
+		if readOnly {
+			p.Pause()
+		} else {
+			p.Resume()
+		}
+	}
+	if readOnly {
+		m.stats.Gauge("read_only").Update(1)
+		log.Info("Entered read-only mode")
+	} else {
+		m.stats.Gauge("read_only").Update(0)
+		log.Info("Left read-only mode")
+	}
+}
+
+// Middleware rejects writes with 503 while m is in read-only mode.
+func (m *Mode) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.ReadOnly() && isWrite(r) {
+			m.stats.Counter("rejected_writes").Inc(1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(m.config.RetryAfter.Seconds())))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("read-only mode"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, Path)
+}
+
+// Handler returns an http.Handler which exposes m, to be mounted at Path:
+//
+//	GET /   returns whether read-only mode is on.
+//	PUT /   sets read-only mode to the value of the `read_only` query arg.
+func (m *Mode) Handler() http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if err := json.NewEncoder(w).Encode(StatusResponse{m.ReadOnly()}); err != nil {
+			return handler.Errorf("json encode: %s", err)
+		}
+		return nil
+	}))
+
+	r.Put("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		readOnly, err := strconv.ParseBool(httputil.GetQueryArg(r, "read_only", ""))
+		if err != nil {
+			return handler.Errorf("parse query arg `read_only`: %s", err).Status(http.StatusBadRequest)
+		}
+		m.SetReadOnly(readOnly)
+		return nil
+	}))
+
+	return r
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type testPausable struct {
+	paused bool
+}
+
+func (p *testPausable) Pause()  { p.paused = true }
+func (p *testPausable) Resume() { p.paused = false }
+
+func startServer(m *Mode) (addr string, stop func()) {
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/blobs", func(w http.ResponseWriter, r *http.Request) {})
+	r.Put("/blobs", func(w http.ResponseWriter, r *http.Request) {})
+	r.Mount(Path, m.Handler())
+	return testutil.StartServer(r)
+}
+
+func TestModeRejectsWritesWhenReadOnly(t *testing.T) {
+	require := require.New(t)
+
+	p := &testPausable{}
+	m := New(Config{}, tally.NoopScope, p)
+
+	addr, stop := startServer(m)
+	defer stop()
+
+	url := fmt.Sprintf("http://%s/blobs", addr)
+
+	_, err := httputil.Put(url)
+	require.NoError(err)
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s%s?read_only=true", addr, Path))
+	require.NoError(err)
+	require.True(m.ReadOnly())
+	require.True(p.paused)
+
+	_, err = httputil.Get(url)
+	require.NoError(err)
+
+	_, err = httputil.Put(url)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+	require.Equal("60", err.(httputil.StatusError).Header.Get("Retry-After"))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s%s", addr, Path))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var status StatusResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&status))
+	require.True(status.ReadOnly)
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s%s?read_only=false", addr, Path))
+	require.NoError(err)
+	require.False(p.paused)
+
+	_, err = httputil.Put(url)
+	require.NoError(err)
+}
+
+func TestNewStartsInReadOnlyMode(t *testing.T) {
+	p := &testPausable{}
+	m := New(Config{ReadOnly: true}, tally.NoopScope, p)
+	require.True(t, m.ReadOnly())
+	require.True(t, p.paused)
+}
+
+func TestHandlerInvalidArg(t *testing.T) {
+	addr, stop := startServer(Disabled())
+	defer stop()
+
+	_, err := httputil.Put(fmt.Sprintf("http://%s%s?read_only=maybe", addr, Path))
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
@@ -15,6 +15,8 @@ package metainfogen
 
 import (
 	"errors"
+	"fmt"
+	"regexp"
 	"sort"
 
 	"github.com/c2h5oh/datasize"
@@ -22,7 +24,76 @@ import (
 
 // Config defines Generator configuration.
 type Config struct {
+	// PieceLengths maps minimum file sizes to piece lengths.
 	PieceLengths map[datasize.ByteSize]datasize.ByteSize `yaml:"piece_lengths"`
+
+	// TargetPieceCount selects the smallest piece length, doubling from
+	// MinPieceLength (default 1MB), which splits each file into at most this
+	// many pieces. Piece lengths are capped at MaxPieceLength (default 64MB).
+	// Mutually exclusive with PieceLengths.
+	TargetPieceCount int               `yaml:"target_piece_count"`
+	MinPieceLength   datasize.ByteSize `yaml:"min_piece_length"`
+	MaxPieceLength   datasize.ByteSize `yaml:"max_piece_length"`
+
+	// Namespaces overrides the piece length selection for blobs of matching
+	// namespaces. The first matching rule applies.
+	Namespaces []NamespaceConfig `yaml:"namespaces"`
+
+	// RegenerateStale regenerates the metainfo of cached blobs whose piece
+	// length no longer matches the configuration when it is requested.
+	RegenerateStale bool `yaml:"regenerate_stale"`
+}
+
+// NamespaceConfig defines the piece length selection for namespaces
+// matching a regular expression.
+type NamespaceConfig struct {
+	Namespace        string                                  `yaml:"namespace"`
+	PieceLengths     map[datasize.ByteSize]datasize.ByteSize `yaml:"piece_lengths"`
+	TargetPieceCount int                                     `yaml:"target_piece_count"`
+	MinPieceLength   datasize.ByteSize                       `yaml:"min_piece_length"`
+	MaxPieceLength   datasize.ByteSize                       `yaml:"max_piece_length"`
+}
+
+// pieceLengthPolicy selects the piece length of a file.
+type pieceLengthPolicy interface {
+	get(fileSize int64) int64
+}
+
+func newPieceLengthPolicy(
+	pieceLengthByFileSize map[datasize.ByteSize]datasize.ByteSize,
+	targetPieceCount int,
+	minPieceLength datasize.ByteSize,
+	maxPieceLength datasize.ByteSize) (pieceLengthPolicy, error) {
+
+	if targetPieceCount == 0 {
+		return newPieceLengthConfig(pieceLengthByFileSize)
+	}
+	if len(pieceLengthByFileSize) > 0 {
+		return nil, errors.New("piece lengths and target piece count are mutually exclusive")
+	}
+	return newTargetPieceCountConfig(targetPieceCount, int64(minPieceLength), int64(maxPieceLength))
+}
+
+type namespacePolicy struct {
+	namespace *regexp.Regexp
+	policy    pieceLengthPolicy
+}
+
+func newNamespacePolicies(configs []NamespaceConfig) ([]namespacePolicy, error) {
+	var policies []namespacePolicy
+	for _, nc := range configs {
+		re, err := regexp.Compile(nc.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %s", nc.Namespace, err)
+		}
+		p, err := newPieceLengthPolicy(
+			nc.PieceLengths, nc.TargetPieceCount, nc.MinPieceLength, nc.MaxPieceLength)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %q: %s", nc.Namespace, err)
+		}
+		policies = append(policies, namespacePolicy{re, p})
+	}
+	return policies, nil
 }
 
 type rangeConfig struct {
@@ -30,21 +101,6 @@ type rangeConfig struct {
 	pieceLength int64
 }
 
-// pieceLengthConfig represents a sorted list joining file size to torrent piece
-// length for all files under said size, for example, these ranges:
-//
-//   [
-//     (0, 1mb),
-//     (2gb, 4mb),
-//     (4gb, 8mb),
-//   ]
-//
-// are interpreted as:
-//
-//   N < 2gb           : 1mb
-//   N >= 2gb, N < 4gb : 4mb
-//   N >= 4gb          : 8mb
-//
 type pieceLengthConfig struct {
 	ranges []rangeConfig
 }
@@ -78,3 +134,37 @@ func (c *pieceLengthConfig) get(fileSize int64) int64 {
 	}
 	return pieceLength
 }
+
+type targetPieceCountConfig struct {
+	count int64
+	min   int64
+	max   int64
+}
+
+func newTargetPieceCountConfig(count int, min, max int64) (*targetPieceCountConfig, error) {
+	if count < 0 {
+		return nil, errors.New("target piece count must be positive")
+	}
+	if min == 0 {
+		min = int64(datasize.MB)
+	}
+	if max == 0 {
+		max = int64(64 * datasize.MB)
+	}
+	if min > max {
+		return nil, fmt.Errorf("min piece length %d exceeds max piece length %d", min, max)
+	}
+	return &targetPieceCountConfig{int64(count), min, max}, nil
+}
+
+func (c *targetPieceCountConfig) get(fileSize int64) int64 {
+	target := (fileSize + c.count - 1) / c.count
+	pieceLength := c.min
+	for pieceLength < target && pieceLength < c.max {
+		pieceLength *= 2
+	}
+	if pieceLength > c.max {
+		pieceLength = c.max
+	}
+	return pieceLength
+}
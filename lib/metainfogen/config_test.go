@@ -36,3 +36,22 @@ func TestPieceLengthConfig(t *testing.T) {
 	require.Equal(int64(8*datasize.MB), plConfig.get(int64(4*datasize.GB)))
 	require.Equal(int64(8*datasize.MB), plConfig.get(int64(8*datasize.GB)))
 }
+
+func TestTargetPieceCountConfig(t *testing.T) {
+	require := require.New(t)
+
+	c, err := newTargetPieceCountConfig(
+		1000, int64(datasize.MB), int64(64*datasize.MB))
+	require.NoError(err)
+
+	// Small files are bounded by the min piece length.
+	require.Equal(int64(datasize.MB), c.get(0))
+	require.Equal(int64(datasize.MB), c.get(int64(100*datasize.MB)))
+
+	// Piece lengths double until the file has at most the target count.
+	require.Equal(int64(2*datasize.MB), c.get(int64(1001*datasize.MB)))
+	require.Equal(int64(16*datasize.MB), c.get(int64(10*datasize.GB)))
+
+	// Large files are bounded by the max piece length.
+	require.Equal(int64(64*datasize.MB), c.get(int64(1000*datasize.GB)))
+}
@@ -21,38 +21,73 @@ import (
 	"github.com/uber/kraken/lib/store/metadata"
 )
 
-// Generator wraps static piece length configuration in order to determinstically
+// Generator wraps piece length configuration in order to determinstically
 // generate metainfo.
 type Generator struct {
-	pieceLengthConfig *pieceLengthConfig
-	cas               *store.CAStore
+	config     Config
+	policy     pieceLengthPolicy
+	namespaces []namespacePolicy
+	cas        *store.CAStore
 }
 
 // New creates a new Generator.
 func New(config Config, cas *store.CAStore) (*Generator, error) {
-	plConfig, err := newPieceLengthConfig(config.PieceLengths)
+	policy, err := newPieceLengthPolicy(
+		config.PieceLengths, config.TargetPieceCount, config.MinPieceLength, config.MaxPieceLength)
 	if err != nil {
 		return nil, fmt.Errorf("piece length config: %s", err)
 	}
-	return &Generator{plConfig, cas}, nil
+	namespaces, err := newNamespacePolicies(config.Namespaces)
+	if err != nil {
+		return nil, fmt.Errorf("namespace piece length config: %s", err)
+	}
+	return &Generator{config, policy, namespaces, cas}, nil
+}
+
+// PieceLength returns the piece length configured for a blob of fileSize
+// bytes in namespace.
+func (g *Generator) PieceLength(namespace string, fileSize int64) int64 {
+	for _, np := range g.namespaces {
+		if np.namespace.MatchString(namespace) {
+			return np.policy.get(fileSize)
+		}
+	}
+	return g.policy.get(fileSize)
 }
 
-// Generate generates metainfo for the blob of d and writes it to disk.
-func (g *Generator) Generate(d core.Digest) error {
-	info, err := g.cas.GetCacheFileStat(d.Hex())
+// Stale returns true if mi should be regenerated because its piece length no
+// longer matches the configuration of namespace. Always false unless
+// regeneration is enabled.
+func (g *Generator) Stale(namespace string, mi *core.MetaInfo) bool {
+	if !g.config.RegenerateStale {
+		return false
+	}
+	return mi.PieceLength() != g.PieceLength(namespace, mi.Length())
+}
+
+// Generate generates metainfo for the blob of d in namespace and writes it
+// to disk, overwriting any existing metainfo.
+func (g *Generator) Generate(namespace string, d core.Digest) error {
+	info, err := g.cas.GetCacheFileStat(d.Name())
 	if err != nil {
 		return fmt.Errorf("cache stat: %s", err)
 	}
-	f, err := g.cas.GetCacheFileReader(d.Hex())
+	return g.GenerateWithPieceLength(d, g.PieceLength(namespace, info.Size()))
+}
+
+// GenerateWithPieceLength generates metainfo for the blob of d with a fixed
+// pieceLength and writes it to disk, overwriting any existing metainfo.
+func (g *Generator) GenerateWithPieceLength(d core.Digest, pieceLength int64) error {
+	f, err := g.cas.GetCacheFileReader(d.Name())
 	if err != nil {
 		return fmt.Errorf("get cache file: %s", err)
 	}
-	pieceLength := g.pieceLengthConfig.get(info.Size())
+	defer f.Close()
 	mi, err := core.NewMetaInfo(d, f, pieceLength)
 	if err != nil {
 		return fmt.Errorf("create metainfo: %s", err)
 	}
-	if _, err := g.cas.SetCacheFileMetadata(d.Hex(), metadata.NewTorrentMeta(mi)); err != nil {
+	if _, err := g.cas.SetCacheFileMetadata(d.Name(), metadata.NewTorrentMeta(mi)); err != nil {
 		return fmt.Errorf("set metainfo: %s", err)
 	}
 	return nil
@@ -44,9 +44,101 @@ func TestGenerate(t *testing.T) {
 
 	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
 
-	require.NoError(generator.Generate(blob.Digest))
+	require.NoError(generator.Generate("", blob.Digest))
 
 	var tm metadata.TorrentMeta
 	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
 	require.Equal(blob.MetaInfo, tm.MetaInfo)
 }
+
+func TestGenerateUsesNamespacePieceLength(t *testing.T) {
+	require := require.New(t)
+
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	generator, err := New(Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+		Namespaces: []NamespaceConfig{{
+			Namespace:    "models/.*",
+			PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 20},
+		}},
+	}, cas)
+	require.NoError(err)
+
+	blob := core.SizedBlobFixture(100, 20)
+
+	require.NoError(cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	require.NoError(generator.Generate("models/bert", blob.Digest))
+
+	var tm metadata.TorrentMeta
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(blob.MetaInfo, tm.MetaInfo)
+
+	require.NoError(generator.Generate("other", blob.Digest))
+
+	require.NoError(cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(int64(10), tm.MetaInfo.PieceLength())
+}
+
+func TestStale(t *testing.T) {
+	cas, cleanup := store.CAStoreFixture()
+	defer cleanup()
+
+	mi := core.SizedBlobFixture(100, 10).MetaInfo
+
+	tests := []struct {
+		desc       string
+		regenerate bool
+		namespace  string
+		expected   bool
+	}{
+		{"disabled", false, "models/bert", false},
+		{"matching piece length", true, "other", false},
+		{"changed piece length", true, "models/bert", true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			generator, err := New(Config{
+				PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 10},
+				Namespaces: []NamespaceConfig{{
+					Namespace:        "models/.*",
+					TargetPieceCount: 2,
+					MinPieceLength:   10,
+				}},
+				RegenerateStale: test.regenerate,
+			}, cas)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, generator.Stale(test.namespace, mi))
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config Config
+	}{
+		{"no piece lengths", Config{}},
+		{"piece lengths and target piece count", Config{
+			PieceLengths:     map[datasize.ByteSize]datasize.ByteSize{0: 10},
+			TargetPieceCount: 10,
+		}},
+		{"invalid namespace", Config{
+			TargetPieceCount: 10,
+			Namespaces:       []NamespaceConfig{{Namespace: "(", TargetPieceCount: 10}},
+		}},
+		{"min exceeds max", Config{
+			TargetPieceCount: 10,
+			MinPieceLength:   2 * datasize.MB,
+			MaxPieceLength:   datasize.MB,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := New(test.config, nil)
+			require.Error(t, err)
+		})
+	}
+}
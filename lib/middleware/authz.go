@@ -0,0 +1,137 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// AuthzConfig defines which client identities may call which endpoints.
+// Identities are the URI SANs, e.g. SPIFFE IDs, of verified client
+// certificates. If no rules are configured, all requests are allowed.
+type AuthzConfig struct {
+	Rules []AuthzRule `yaml:"rules"`
+
+	// Identity defines how client certificates are verified. Requests without
+	// a verifiable certificate are rejected from restricted endpoints.
+	Identity httputil.IdentityConfig `yaml:"identity"`
+}
+
+// AuthzRule restricts all endpoints under PathPrefix to identities in Allow.
+// A request is checked against the rule with the longest matching
+// PathPrefix. Requests which match no rule are allowed.
+type AuthzRule struct {
+	PathPrefix string `yaml:"path_prefix"`
+
+	// Allow lists allowed identities. An identity ending in "*" matches any
+	// identity with the preceding prefix, e.g. "spiffe://kraken/tracker/*".
+	Allow []string `yaml:"allow"`
+}
+
+// match returns the rule which applies to path, or nil if none applies.
+func (c AuthzConfig) match(path string) *AuthzRule {
+	var best *AuthzRule
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		if best == nil || len(rule.PathPrefix) > len(best.PathPrefix) {
+			best = rule
+		}
+	}
+	return best
+}
+
+func (r *AuthzRule) allows(ids []string) bool {
+	for _, id := range ids {
+		for _, a := range r.Allow {
+			if strings.HasSuffix(a, "*") {
+				if strings.HasPrefix(id, strings.TrimSuffix(a, "*")) {
+					return true
+				}
+			} else if id == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isProtectedWrite returns true if r mutates state under one of prefixes.
+func isProtectedWrite(r *http.Request, prefixes []string) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return false
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize rejects requests to endpoints restricted by config with 403
+// unless the client certificate carries an allowed identity. Requests without
+// a verified client certificate are rejected from restricted endpoints, and so
+// are all requests to restricted endpoints if config.Identity is invalid.
+//
+// Writes, i.e. requests other than GET and HEAD, under protectedWrites are
+// always restricted: if no rule matches them, they are denied.
+func Authorize(
+	config AuthzConfig, stats tally.Scope, protectedWrites ...string) func(next http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		if len(config.Rules) == 0 && len(protectedWrites) == 0 {
+			return next
+		}
+		verifier, verifierErr := httputil.NewIdentityVerifier(config.Identity)
+		if verifierErr != nil {
+			log.Errorf("Invalid authz identity config, denying restricted endpoints: %s", verifierErr)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule := config.match(r.URL.Path)
+			if rule == nil {
+				if !isProtectedWrite(r, protectedWrites) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				rule = &AuthzRule{}
+			}
+			var ids []string
+			err := verifierErr
+			if err == nil {
+				ids, err = verifier.PeerIdentities(r)
+			}
+			if err == nil && !rule.allows(ids) {
+				err = errors.New("identity not allowed")
+			}
+			if err != nil {
+				stats.Counter("authz_denied").Inc(1)
+				log.With("path", r.URL.Path, "identities", ids).Infof(
+					"Denied request to restricted endpoint: %s", err)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
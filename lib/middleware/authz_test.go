@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func withCertHeader(r *http.Request, cert *x509.Certificate) *http.Request {
+	r.Header.Set(httputil.ClientCertHeader, httputil.EncodeClientCertHeader(cert))
+	return r
+}
+
+func authzHandler(config AuthzConfig) http.Handler {
+	r := chi.NewRouter()
+	r.Use(Authorize(config, tally.NoopScope))
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {})
+	return r
+}
+
+func TestAuthorize(t *testing.T) {
+	ca := httputil.NewCAFixture()
+	identity, cleanup := ca.IdentityConfig()
+	defer cleanup()
+
+	config := AuthzConfig{Rules: []AuthzRule{{
+		PathPrefix: "/internal/",
+		Allow:      []string{"spiffe://kraken/origin"},
+	}, {
+		PathPrefix: "/internal/peercontext",
+		Allow:      []string{"spiffe://kraken/tracker/*"},
+	}}, Identity: identity}
+	tracker := ca.ClientCert("spiffe://kraken/tracker/dca1")
+	origin := ca.ClientCert("spiffe://kraken/origin")
+	forged := httputil.NewCAFixture().ClientCert("spiffe://kraken/origin")
+
+	tests := []struct {
+		desc     string
+		path     string
+		cert     *x509.Certificate
+		expected int
+	}{
+		{"unrestricted without cert", "/health", nil, http.StatusOK},
+		{"restricted without cert", "/internal/blobs", nil, http.StatusForbidden},
+		{"exact identity", "/internal/blobs", origin, http.StatusOK},
+		{"wrong identity", "/internal/blobs", tracker, http.StatusForbidden},
+		{"wildcard identity", "/internal/peercontext", tracker, http.StatusOK},
+		{"longest prefix wins", "/internal/peercontext", origin, http.StatusForbidden},
+		{"unknown ca", "/internal/blobs", forged, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.path, nil)
+			if test.cert != nil {
+				r = withCertHeader(r, test.cert)
+			}
+			w := httptest.NewRecorder()
+			authzHandler(config).ServeHTTP(w, r)
+			require.Equal(t, test.expected, w.Code)
+		})
+	}
+}
+
+func TestAuthorizeRejectsCertHeaderFromUntrustedAddress(t *testing.T) {
+	ca := httputil.NewCAFixture()
+	identity, cleanup := ca.IdentityConfig()
+	defer cleanup()
+	identity.TrustedProxies = []string{"unix"}
+
+	config := AuthzConfig{Rules: []AuthzRule{{
+		PathPrefix: "/internal/",
+		Allow:      []string{"spiffe://kraken/origin"},
+	}}, Identity: identity}
+
+	r := withCertHeader(
+		httptest.NewRequest("GET", "/internal/blobs", nil), ca.ClientCert("spiffe://kraken/origin"))
+	w := httptest.NewRecorder()
+	authzHandler(config).ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthorizeReadsTLSPeerCertificate(t *testing.T) {
+	config := AuthzConfig{Rules: []AuthzRule{{
+		PathPrefix: "/internal/",
+		Allow:      []string{"spiffe://kraken/origin"},
+	}}}
+	cert := httputil.NewCAFixture().ClientCert("spiffe://kraken/origin")
+	r := httptest.NewRequest("GET", "/internal/blobs", nil)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	w := httptest.NewRecorder()
+	authzHandler(config).ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthorizeRejectsMalformedCertHeader(t *testing.T) {
+	identity, cleanup := httputil.NewCAFixture().IdentityConfig()
+	defer cleanup()
+
+	config := AuthzConfig{Rules: []AuthzRule{{
+		PathPrefix: "/internal/",
+		Allow:      []string{"*"},
+	}}, Identity: identity}
+	r := httptest.NewRequest("GET", "/internal/blobs", nil)
+	r.Header.Set(httputil.ClientCertHeader, "garbage")
+	w := httptest.NewRecorder()
+	authzHandler(config).ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthorizeInvalidIdentityConfigFailsClosed(t *testing.T) {
+	config := AuthzConfig{Rules: []AuthzRule{{
+		PathPrefix: "/internal/",
+		Allow:      []string{"*"},
+	}}, Identity: httputil.IdentityConfig{TrustedProxies: []string{"bogus"}}}
+
+	w := httptest.NewRecorder()
+	authzHandler(config).ServeHTTP(w, httptest.NewRequest("GET", "/internal/blobs", nil))
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	authzHandler(config).ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthorizeProtectedWrites(t *testing.T) {
+	ca := httputil.NewCAFixture()
+	identity, cleanup := ca.IdentityConfig()
+	defer cleanup()
+
+	agent := ca.ClientCert("spiffe://kraken/agent")
+
+	handler := func(config AuthzConfig) http.Handler {
+		r := chi.NewRouter()
+		r.Use(Authorize(config, tally.NoopScope, "/x/"))
+		r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {})
+		return r
+	}
+
+	tests := []struct {
+		desc     string
+		config   AuthzConfig
+		method   string
+		path     string
+		expected int
+	}{
+		{"read without rules", AuthzConfig{}, "GET", "/x/config", http.StatusOK},
+		{"write without rules", AuthzConfig{}, "PUT", "/x/config", http.StatusForbidden},
+		{"unprotected write", AuthzConfig{}, "PUT", "/blobs", http.StatusOK},
+		{"allowed write", AuthzConfig{
+			Rules:    []AuthzRule{{PathPrefix: "/x/", Allow: []string{"spiffe://kraken/agent"}}},
+			Identity: identity,
+		}, "PUT", "/x/config", http.StatusOK},
+		{"denied write", AuthzConfig{
+			Rules:    []AuthzRule{{PathPrefix: "/x/", Allow: []string{"spiffe://kraken/origin"}}},
+			Identity: identity,
+		}, "DELETE", "/x/config", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			r := withCertHeader(httptest.NewRequest(test.method, test.path, nil), agent)
+			w := httptest.NewRecorder()
+			handler(test.config).ServeHTTP(w, r)
+			require.Equal(t, test.expected, w.Code)
+		})
+	}
+}
@@ -15,12 +15,20 @@ package middleware
 
 import (
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/utils/httputil"
+
 	"github.com/go-chi/chi"
 	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // tagEndpoint tags stats by endpoint path and method, ignoring any path variables.
@@ -99,3 +107,50 @@ func StatusCounter(stats tally.Scope) func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// Tracing starts a server span for each request, continuing any trace
+// propagated by the client. Spans are named by method and route pattern, and
+// carry the request path and namespace for sampling rules.
+func Tracing() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attrs := []attribute.KeyValue{semconv.HTTPTargetKey.String(r.URL.Path)}
+			if ns, ok := namespaceFromPath(r.URL.EscapedPath()); ok {
+				attrs = append(attrs, tracing.NamespaceKey.String(ns))
+			}
+			ctx, span := tracing.Tracer().Start(
+				httputil.ExtractContext(r), r.Method,
+				trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			recordw := &recordStatusWriter{w, false, http.StatusOK}
+			next.ServeHTTP(recordw, r.WithContext(ctx))
+
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				span.SetName(r.Method + " " + rctx.RoutePattern())
+			}
+			span.SetAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPStatusCodeKey.Int(recordw.code))
+			if recordw.code >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(recordw.code))
+			}
+		})
+	}
+}
+
+// namespaceFromPath returns the unescaped namespace of paths of the form
+// /namespace/{namespace}/...
+func namespaceFromPath(path string) (string, bool) {
+	parts := strings.Split(path, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "namespace" {
+			ns, err := url.PathUnescape(parts[i+1])
+			if err != nil || ns == "" {
+				return "", false
+			}
+			return ns, true
+		}
+	}
+	return "", false
+}
@@ -14,6 +14,7 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -26,6 +27,10 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestScopeByEndpoint(t *testing.T) {
@@ -155,3 +160,53 @@ func TestStatusCounter(t *testing.T) {
 		})
 	}
 }
+
+func TestTracingContinuesPropagatedTrace(t *testing.T) {
+	require := require.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	r := chi.NewRouter()
+	r.Use(Tracing())
+	r.Get("/foo/{foo}", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(500) })
+
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, err := httputil.Get(fmt.Sprintf("http://%s/foo/x", addr), httputil.SendContext(ctx))
+	require.Error(err)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(spans, 2)
+	server := spans[0]
+	require.Equal("GET /foo/{foo}", server.Name())
+	require.Equal(parent.SpanContext().TraceID(), server.SpanContext().TraceID())
+	require.Equal(parent.SpanContext().SpanID(), server.Parent().SpanID())
+}
+
+func TestNamespaceFromPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		namespace string
+		ok        bool
+	}{
+		{"/namespace/foo%2Fbar/blobs/abc", "foo/bar", true},
+		{"/namespace/foo", "foo", true},
+		{"/namespace/", "", false},
+		{"/blobs/abc", "", false},
+		{"/namespace", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			ns, ok := namespaceFromPath(test.path)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.namespace, ns)
+		})
+	}
+}
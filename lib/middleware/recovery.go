@@ -0,0 +1,263 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// RecoveryConfig defines configuration for recovering from handler panics.
+type RecoveryConfig struct {
+	// CrashDir is the directory crash bundles are written to when a handler
+	// panics. If empty, no bundles are written, but panics are still
+	// recovered.
+	CrashDir string `yaml:"crash_dir"`
+
+	// MaxBundles is the number of crash bundles kept in CrashDir. Older
+	// bundles are removed. Defaults to 20.
+	MaxBundles int `yaml:"max_bundles"`
+
+	// RecentRequests is the number of most recent requests included in each
+	// crash bundle. Defaults to 50.
+	RecentRequests int `yaml:"recent_requests"`
+}
+
+func (c RecoveryConfig) applyDefaults() RecoveryConfig {
+	if c.MaxBundles == 0 {
+		c.MaxBundles = 20
+	}
+	if c.RecentRequests == 0 {
+		c.RecentRequests = 50
+	}
+	return c
+}
+
+// Headers which are never written to crash bundles.
+var _redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// requestSummary is the request context recorded in crash bundles.
+type requestSummary struct {
+	Time       time.Time           `json:"time"`
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	RemoteAddr string              `json:"remote_addr"`
+	Header     map[string][]string `json:"header,omitempty"`
+}
+
+func summarize(r *http.Request, withHeader bool) requestSummary {
+	s := requestSummary{
+		Time:       time.Now(),
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		RemoteAddr: r.RemoteAddr,
+	}
+	if withHeader {
+		s.Header = make(map[string][]string)
+		for k, v := range r.Header {
+			if _redactedHeaders[http.CanonicalHeaderKey(k)] {
+				v = []string{"<redacted>"}
+			}
+			s.Header[k] = v
+		}
+	}
+	return s
+}
+
+// crashBundle is written to CrashDir when a handler panics.
+type crashBundle struct {
+	Time           time.Time        `json:"time"`
+	Component      string           `json:"component"`
+	Panic          string           `json:"panic"`
+	Stack          string           `json:"stack"`
+	Request        requestSummary   `json:"request"`
+	RecentRequests []requestSummary `json:"recent_requests"`
+}
+
+// crashRecorder keeps a ring of recent requests and writes crash bundles.
+type crashRecorder struct {
+	config    RecoveryConfig
+	component string
+
+	mu     sync.Mutex
+	recent []requestSummary
+	next   int
+}
+
+var (
+	_recorderMu sync.RWMutex
+	_recorder   = newCrashRecorder(RecoveryConfig{}, "")
+)
+
+func newCrashRecorder(config RecoveryConfig, component string) *crashRecorder {
+	config = config.applyDefaults()
+	return &crashRecorder{
+		config:    config,
+		component: component,
+		recent:    make([]requestSummary, 0, config.RecentRequests),
+	}
+}
+
+// InitRecovery configures where the Recovery middleware of component writes
+// crash bundles.
+func InitRecovery(config RecoveryConfig, component string) error {
+	if config.CrashDir != "" {
+		if err := os.MkdirAll(config.CrashDir, 0775); err != nil {
+			return fmt.Errorf("mkdir crash dir: %s", err)
+		}
+	}
+	_recorderMu.Lock()
+	defer _recorderMu.Unlock()
+	_recorder = newCrashRecorder(config, component)
+	return nil
+}
+
+func getRecorder() *crashRecorder {
+	_recorderMu.RLock()
+	defer _recorderMu.RUnlock()
+	return _recorder
+}
+
+func (c *crashRecorder) record(r *http.Request) {
+	s := summarize(r, false)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.recent) < c.config.RecentRequests {
+		c.recent = append(c.recent, s)
+		return
+	}
+	c.recent[c.next] = s
+	c.next = (c.next + 1) % len(c.recent)
+}
+
+// recentRequests returns the recorded requests, oldest first.
+func (c *crashRecorder) recentRequests() []requestSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make([]requestSummary, 0, len(c.recent))
+	result = append(result, c.recent[c.next:]...)
+	return append(result, c.recent[:c.next]...)
+}
+
+// writeBundle writes a crash bundle for the panic p raised while serving r,
+// and removes the oldest bundles above MaxBundles.
+func (c *crashRecorder) writeBundle(r *http.Request, p interface{}, stack []byte) (string, error) {
+	if c.config.CrashDir == "" {
+		return "", nil
+	}
+	now := time.Now()
+	b, err := json.MarshalIndent(crashBundle{
+		Time:           now,
+		Component:      c.component,
+		Panic:          fmt.Sprint(p),
+		Stack:          string(stack),
+		Request:        summarize(r, true),
+		RecentRequests: c.recentRequests(),
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal: %s", err)
+	}
+	f, err := ioutil.TempFile(
+		c.config.CrashDir, fmt.Sprintf("crash-%s-%s-*.json", c.component, now.UTC().Format("20060102T150405")))
+	if err != nil {
+		return "", fmt.Errorf("create: %s", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return "", fmt.Errorf("write: %s", err)
+	}
+	c.prune()
+	return f.Name(), nil
+}
+
+func (c *crashRecorder) prune() {
+	infos, err := ioutil.ReadDir(c.config.CrashDir)
+	if err != nil {
+		log.Errorf("Error listing crash dir: %s", err)
+		return
+	}
+	var bundles []os.FileInfo
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), "crash-") && strings.HasSuffix(info.Name(), ".json") {
+			bundles = append(bundles, info)
+		}
+	}
+	if len(bundles) <= c.config.MaxBundles {
+		return
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].ModTime().Before(bundles[j].ModTime())
+	})
+	for _, info := range bundles[:len(bundles)-c.config.MaxBundles] {
+		if err := os.Remove(filepath.Join(c.config.CrashDir, info.Name())); err != nil {
+			log.Errorf("Error removing crash bundle: %s", err)
+		}
+	}
+}
+
+// Recovery converts handler panics into 500 responses instead of crashing the
+// process. Each panic is counted, logged with its stack trace, and written to
+// a crash bundle along with the recent requests if configured by
+// InitRecovery.
+func Recovery(stats tally.Scope) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := getRecorder()
+			recorder.record(r)
+
+			recordw := &recordStatusWriter{w, false, http.StatusOK}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					// Deliberate abort of the response, let net/http handle it.
+					panic(p)
+				}
+				stack := debug.Stack()
+				tagEndpoint(stats, r).Counter("panics").Inc(1)
+				log.With("method", r.Method, "url", r.URL.String()).Errorf(
+					"Recovered from handler panic: %v\n%s", p, stack)
+				if path, err := recorder.writeBundle(r, p, stack); err != nil {
+					log.Errorf("Error writing crash bundle: %s", err)
+				} else if path != "" {
+					log.Errorf("Wrote crash bundle to %s", path)
+				}
+				if !recordw.wroteHeader {
+					http.Error(recordw, http.StatusText(http.StatusInternalServerError),
+						http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(recordw, r)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestRecoveryConvertsPanicsTo500(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(InitRecovery(RecoveryConfig{CrashDir: dir}, "test"))
+	defer InitRecovery(RecoveryConfig{}, "")
+
+	stats := tally.NewTestScope("", nil)
+
+	r := chi.NewRouter()
+	r.Use(Recovery(stats))
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/panic/{x}", func(w http.ResponseWriter, r *http.Request) {
+		panic("bad header")
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/ok", addr))
+	require.NoError(err)
+
+	_, err = httputil.Get(
+		fmt.Sprintf("http://%s/panic/foo", addr),
+		httputil.SendHeader("Authorization", "secret"))
+	require.True(httputil.IsStatus(err, http.StatusInternalServerError))
+
+	// The server is still up.
+	_, err = httputil.Get(fmt.Sprintf("http://%s/ok", addr))
+	require.NoError(err)
+
+	require.Equal(int64(1), stats.Snapshot().Counters()["panics+endpoint=panic,method=GET"].Value())
+
+	bundles, err := filepath.Glob(filepath.Join(dir, "crash-test-*.json"))
+	require.NoError(err)
+	require.Len(bundles, 1)
+
+	b, err := ioutil.ReadFile(bundles[0])
+	require.NoError(err)
+	var bundle crashBundle
+	require.NoError(json.Unmarshal(b, &bundle))
+	require.Equal("test", bundle.Component)
+	require.Equal("bad header", bundle.Panic)
+	require.Contains(bundle.Stack, "recovery_test.go")
+	require.Equal("/panic/foo", bundle.Request.URL)
+	require.Equal([]string{"<redacted>"}, bundle.Request.Header["Authorization"])
+	require.Len(bundle.RecentRequests, 2)
+	require.Equal("/ok", bundle.RecentRequests[0].URL)
+}
+
+func TestRecoveryPrunesOldBundles(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "crash")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(InitRecovery(RecoveryConfig{CrashDir: dir, MaxBundles: 2}, "test"))
+	defer InitRecovery(RecoveryConfig{}, "")
+
+	r := chi.NewRouter()
+	r.Use(Recovery(tally.NoopScope))
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+	addr, stop := testutil.StartServer(r)
+	defer stop()
+
+	for i := 0; i < 5; i++ {
+		_, err := httputil.Get(fmt.Sprintf("http://%s/panic", addr))
+		require.True(httputil.IsStatus(err, http.StatusInternalServerError))
+	}
+
+	bundles, err := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	require.NoError(err)
+	require.Len(bundles, 2)
+}
+
+func TestRecentRequestsRing(t *testing.T) {
+	require := require.New(t)
+
+	c := newCrashRecorder(RecoveryConfig{RecentRequests: 2}, "test")
+	for _, p := range []string{"/a", "/b", "/c"} {
+		r, err := http.NewRequest("GET", p, nil)
+		require.NoError(err)
+		c.record(r)
+	}
+	recent := c.recentRequests()
+	require.Len(recent, 2)
+	require.Equal("/b", recent[0].URL)
+	require.Equal("/c", recent[1].URL)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nat
+
+import "time"
+
+// Supported NAT traversal modes.
+const (
+	ModeSTUN = "stun"
+	ModeUPnP = "upnp"
+)
+
+// Config defines NAT traversal configuration. Agents running behind NAT use
+// NAT traversal to discover the address at which their peer port is
+// reachable, and announce that address to trackers instead of their local
+// address.
+type Config struct {
+	// Mode is the NAT traversal method, either "stun" or "upnp". NAT traversal
+	// is disabled if empty.
+	Mode string `yaml:"mode"`
+
+	// ExternalPort is the external port which is announced to trackers. With
+	// STUN, the port must be forwarded to the local peer port by the NAT
+	// device. With UPnP, the port is requested when creating the mapping.
+	// Defaults to the local peer port.
+	ExternalPort int `yaml:"external_port"`
+
+	STUN STUNConfig `yaml:"stun"`
+	UPnP UPnPConfig `yaml:"upnp"`
+}
+
+// STUNConfig defines STUN configuration. STUN only discovers the external IP
+// of the agent, hence the external port must be forwarded separately.
+type STUNConfig struct {
+	// Server is the address of the STUN server, in 'host:port' format.
+	Server string `yaml:"server"`
+
+	// Timeout is the timeout of each binding request.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Retries is the number of binding requests sent before giving up.
+	Retries int `yaml:"retries"`
+}
+
+func (c STUNConfig) applyDefaults() STUNConfig {
+	if c.Server == "" {
+		c.Server = "stun.l.google.com:19302"
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Second
+	}
+	if c.Retries == 0 {
+		c.Retries = 3
+	}
+	return c
+}
+
+// UPnPConfig defines UPnP configuration. The agent discovers an Internet
+// Gateway Device on the local network, which both reports the external IP and
+// forwards the external port to the local peer port.
+type UPnPConfig struct {
+	// Gateway is the URL of the root device description of the gateway. If
+	// empty, the gateway is discovered via SSDP.
+	Gateway string `yaml:"gateway"`
+
+	// DiscoveryTimeout is how long to wait for SSDP responses.
+	DiscoveryTimeout time.Duration `yaml:"discovery_timeout"`
+
+	// Timeout is the timeout of requests to the gateway.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// LeaseDuration is the lifetime of the port mapping. The mapping is renewed
+	// at half of its lifetime until it is removed.
+	LeaseDuration time.Duration `yaml:"lease_duration"`
+
+	// Description is the description of the port mapping shown by gateways.
+	Description string `yaml:"description"`
+}
+
+func (c UPnPConfig) applyDefaults() UPnPConfig {
+	if c.DiscoveryTimeout == 0 {
+		c.DiscoveryTimeout = 3 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.LeaseDuration == 0 {
+		c.LeaseDuration = time.Hour
+	}
+	if c.Description == "" {
+		c.Description = "kraken-agent"
+	}
+	return c
+}
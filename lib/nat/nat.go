@@ -0,0 +1,50 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nat
+
+import "fmt"
+
+// Addr is an externally reachable address.
+type Addr struct {
+	IP   string
+	Port int
+}
+
+func (a Addr) String() string {
+	return fmt.Sprintf("%s:%d", a.IP, a.Port)
+}
+
+// Mapper makes a local port reachable from outside the NAT.
+type Mapper interface {
+	// Map returns the external address at which localPort is reachable.
+	Map(localPort int) (Addr, error)
+
+	// Unmap releases any resources acquired by Map, such as port mappings on
+	// the gateway.
+	Unmap() error
+}
+
+// New creates a Mapper for the configured mode.
+func New(config Config) (Mapper, error) {
+	switch config.Mode {
+	case ModeSTUN:
+		return newSTUNMapper(config.STUN.applyDefaults(), config.ExternalPort), nil
+	case ModeUPnP:
+		return newUPnPMapper(config.UPnP.applyDefaults(), config.ExternalPort), nil
+	case "":
+		return nil, fmt.Errorf("nat traversal disabled")
+	default:
+		return nil, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+}
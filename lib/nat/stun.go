@@ -0,0 +1,187 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nat
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// STUN message constants, see RFC 5389.
+const (
+	_stunBindingRequest  = 0x0001
+	_stunBindingResponse = 0x0101
+	_stunMagicCookie     = 0x2112A442
+	_stunHeaderSize      = 20
+
+	_stunAttrMappedAddress    = 0x0001
+	_stunAttrXORMappedAddress = 0x0020
+
+	_stunFamilyIPv4 = 0x01
+	_stunFamilyIPv6 = 0x02
+)
+
+var errNoMappedAddress = errors.New("no mapped address in binding response")
+
+type stunMapper struct {
+	config       STUNConfig
+	externalPort int
+}
+
+func newSTUNMapper(config STUNConfig, externalPort int) *stunMapper {
+	return &stunMapper{config, externalPort}
+}
+
+// Map discovers the external IP via a STUN binding request. The external
+// port is not discovered, since STUN mappings only apply to UDP, and is
+// assumed to be forwarded to localPort.
+func (m *stunMapper) Map(localPort int) (Addr, error) {
+	ip, err := m.externalIP()
+	if err != nil {
+		return Addr{}, err
+	}
+	port := m.externalPort
+	if port == 0 {
+		port = localPort
+	}
+	return Addr{ip.String(), port}, nil
+}
+
+func (m *stunMapper) Unmap() error {
+	return nil
+}
+
+func (m *stunMapper) externalIP() (net.IP, error) {
+	conn, err := net.Dial("udp", m.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("dial stun server: %s", err)
+	}
+	defer conn.Close()
+
+	var txID [12]byte
+	if _, err := rand.Read(txID[:]); err != nil {
+		return nil, fmt.Errorf("generate transaction id: %s", err)
+	}
+	req := make([]byte, _stunHeaderSize)
+	binary.BigEndian.PutUint16(req[0:2], _stunBindingRequest)
+	binary.BigEndian.PutUint16(req[2:4], 0)
+	binary.BigEndian.PutUint32(req[4:8], _stunMagicCookie)
+	copy(req[8:20], txID[:])
+
+	buf := make([]byte, 1500)
+	for i := 0; i < m.config.Retries; i++ {
+		if _, err = conn.Write(req); err != nil {
+			return nil, fmt.Errorf("send binding request: %s", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(m.config.Timeout))
+		var n int
+		n, err = conn.Read(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				continue
+			}
+			return nil, fmt.Errorf("read binding response: %s", err)
+		}
+		return parseBindingResponse(buf[:n], txID)
+	}
+	return nil, fmt.Errorf("no binding response after %d attempts: %s", m.config.Retries, err)
+}
+
+// parseBindingResponse returns the mapped address contained in a binding
+// response to the request with txID.
+func parseBindingResponse(b []byte, txID [12]byte) (net.IP, error) {
+	if len(b) < _stunHeaderSize {
+		return nil, errors.New("binding response too short")
+	}
+	if t := binary.BigEndian.Uint16(b[0:2]); t != _stunBindingResponse {
+		return nil, fmt.Errorf("unexpected message type 0x%04x", t)
+	}
+	if binary.BigEndian.Uint32(b[4:8]) != _stunMagicCookie {
+		return nil, errors.New("invalid magic cookie")
+	}
+	if !bytes.Equal(b[8:20], txID[:]) {
+		return nil, errors.New("transaction id mismatch")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if _stunHeaderSize+length > len(b) {
+		return nil, errors.New("binding response truncated")
+	}
+	attrs := b[_stunHeaderSize : _stunHeaderSize+length]
+
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		t := binary.BigEndian.Uint16(attrs[0:2])
+		l := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+l > len(attrs) {
+			return nil, errors.New("attribute truncated")
+		}
+		v := attrs[4 : 4+l]
+		switch t {
+		case _stunAttrXORMappedAddress:
+			// XOR-MAPPED-ADDRESS takes precedence over MAPPED-ADDRESS.
+			return parseAddress(v, true, txID)
+		case _stunAttrMappedAddress:
+			ip, err := parseAddress(v, false, txID)
+			if err != nil {
+				return nil, err
+			}
+			mapped = ip
+		}
+		// Attributes are padded to a multiple of 4 bytes.
+		next := 4 + (l+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	if mapped == nil {
+		return nil, errNoMappedAddress
+	}
+	return mapped, nil
+}
+
+// parseAddress parses the value of a (XOR-)MAPPED-ADDRESS attribute.
+func parseAddress(v []byte, xor bool, txID [12]byte) (net.IP, error) {
+	if len(v) < 4 {
+		return nil, errors.New("address attribute too short")
+	}
+	var size int
+	switch v[1] {
+	case _stunFamilyIPv4:
+		size = net.IPv4len
+	case _stunFamilyIPv6:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unknown address family 0x%02x", v[1])
+	}
+	if len(v) < 4+size {
+		return nil, errors.New("address attribute truncated")
+	}
+	ip := make(net.IP, size)
+	copy(ip, v[4:4+size])
+	if xor {
+		key := make([]byte, 16)
+		binary.BigEndian.PutUint32(key[0:4], _stunMagicCookie)
+		copy(key[4:16], txID[:])
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return ip, nil
+}
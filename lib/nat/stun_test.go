@@ -0,0 +1,167 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startSTUNServer starts a STUN server which responds to binding requests
+// with the source address of the request, using attr to encode it.
+func startSTUNServer(t *testing.T, attr uint16) (addr string, stop func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, src, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < _stunHeaderSize {
+				continue
+			}
+			var txID [12]byte
+			copy(txID[:], buf[8:20])
+			udpAddr := src.(*net.UDPAddr)
+			conn.WriteTo(bindingResponseFixture(txID, attr, udpAddr.IP.To4(), udpAddr.Port), src)
+		}
+	}()
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func bindingResponseFixture(txID [12]byte, attr uint16, ip net.IP, port int) []byte {
+	v := make([]byte, 8)
+	v[1] = _stunFamilyIPv4
+	binary.BigEndian.PutUint16(v[2:4], uint16(port))
+	copy(v[4:8], ip)
+	if attr == _stunAttrXORMappedAddress {
+		binary.BigEndian.PutUint16(v[2:4], uint16(port)^uint16(_stunMagicCookie>>16))
+		var cookie [4]byte
+		binary.BigEndian.PutUint32(cookie[:], _stunMagicCookie)
+		for i := 0; i < 4; i++ {
+			v[4+i] ^= cookie[i]
+		}
+	}
+	b := make([]byte, _stunHeaderSize+4+len(v))
+	binary.BigEndian.PutUint16(b[0:2], _stunBindingResponse)
+	binary.BigEndian.PutUint16(b[2:4], uint16(4+len(v)))
+	binary.BigEndian.PutUint32(b[4:8], _stunMagicCookie)
+	copy(b[8:20], txID[:])
+	binary.BigEndian.PutUint16(b[20:22], attr)
+	binary.BigEndian.PutUint16(b[22:24], uint16(len(v)))
+	copy(b[24:], v)
+	return b
+}
+
+func TestSTUNMapperMap(t *testing.T) {
+	for _, attr := range []uint16{_stunAttrXORMappedAddress, _stunAttrMappedAddress} {
+		t.Run(fmt.Sprintf("attr 0x%04x", attr), func(t *testing.T) {
+			require := require.New(t)
+
+			addr, stop := startSTUNServer(t, attr)
+			defer stop()
+
+			m, err := New(Config{Mode: ModeSTUN, STUN: STUNConfig{Server: addr}})
+			require.NoError(err)
+			defer m.Unmap()
+
+			result, err := m.Map(8080)
+			require.NoError(err)
+			require.Equal(Addr{"127.0.0.1", 8080}, result)
+		})
+	}
+}
+
+func TestSTUNMapperMapWithExternalPort(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := startSTUNServer(t, _stunAttrXORMappedAddress)
+	defer stop()
+
+	m, err := New(Config{
+		Mode:         ModeSTUN,
+		ExternalPort: 9090,
+		STUN:         STUNConfig{Server: addr},
+	})
+	require.NoError(err)
+
+	result, err := m.Map(8080)
+	require.NoError(err)
+	require.Equal(Addr{"127.0.0.1", 9090}, result)
+}
+
+func TestSTUNMapperMapTimeout(t *testing.T) {
+	require := require.New(t)
+
+	// Server which never responds.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	defer conn.Close()
+
+	m, err := New(Config{
+		Mode: ModeSTUN,
+		STUN: STUNConfig{
+			Server:  conn.LocalAddr().String(),
+			Timeout: 50 * time.Millisecond,
+			Retries: 2,
+		},
+	})
+	require.NoError(err)
+
+	_, err = m.Map(8080)
+	require.Error(err)
+}
+
+func TestParseBindingResponseErrors(t *testing.T) {
+	var txID [12]byte
+	valid := bindingResponseFixture(txID, _stunAttrXORMappedAddress, net.IPv4(1, 2, 3, 4).To4(), 80)
+
+	wrongType := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint16(wrongType[0:2], 0x0111)
+
+	otherTxID := [12]byte{1}
+
+	tests := []struct {
+		desc string
+		b    []byte
+		txID [12]byte
+	}{
+		{"too short", valid[:10], txID},
+		{"wrong type", wrongType, txID},
+		{"transaction mismatch", valid, otherTxID},
+		{"truncated", valid[:len(valid)-2], txID},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := parseBindingResponse(test.b, test.txID)
+			require.Error(t, err)
+		})
+	}
+
+	ip, err := parseBindingResponse(valid, txID)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4", ip.String())
+}
+
+func TestNewUnknownMode(t *testing.T) {
+	_, err := New(Config{Mode: "foo"})
+	require.Error(t, err)
+}
@@ -0,0 +1,353 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+const (
+	_ssdpAddr      = "239.255.255.250:1900"
+	_gatewayDevice = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+)
+
+// gateway is the WAN connection service of an Internet Gateway Device.
+type gateway struct {
+	serviceType string
+	controlURL  string
+}
+
+type upnpMapper struct {
+	config       UPnPConfig
+	externalPort int
+
+	mu        sync.Mutex // Protects the following fields:
+	gw        *gateway
+	mapped    int // External port of the current mapping, 0 if none.
+	stop      chan struct{}
+	renewDone chan struct{}
+}
+
+func newUPnPMapper(config UPnPConfig, externalPort int) *upnpMapper {
+	return &upnpMapper{config: config, externalPort: externalPort}
+}
+
+// Map forwards an external TCP port on the gateway to localPort, and renews
+// the mapping in the background until Unmap is called.
+func (m *upnpMapper) Map(localPort int) (Addr, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.gw == nil {
+		location := m.config.Gateway
+		if location == "" {
+			var err error
+			location, err = discoverGateway(m.config.DiscoveryTimeout)
+			if err != nil {
+				return Addr{}, fmt.Errorf("discover gateway: %s", err)
+			}
+		}
+		gw, err := m.fetchGateway(location)
+		if err != nil {
+			return Addr{}, fmt.Errorf("fetch gateway description: %s", err)
+		}
+		m.gw = gw
+	}
+	ip, err := m.externalIP()
+	if err != nil {
+		return Addr{}, fmt.Errorf("get external ip: %s", err)
+	}
+	port := m.externalPort
+	if port == 0 {
+		port = localPort
+	}
+	if err := m.addPortMapping(port, localPort); err != nil {
+		return Addr{}, fmt.Errorf("add port mapping: %s", err)
+	}
+	m.mapped = port
+	if m.stop == nil {
+		m.stop = make(chan struct{})
+		m.renewDone = make(chan struct{})
+		go m.renew(localPort, m.stop, m.renewDone)
+	}
+	return Addr{ip, port}, nil
+}
+
+// Unmap stops renewing the mapping and deletes it from the gateway.
+func (m *upnpMapper) Unmap() error {
+	m.mu.Lock()
+	stop, done := m.stop, m.renewDone
+	m.stop, m.renewDone = nil, nil
+	m.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mapped == 0 {
+		return nil
+	}
+	port := m.mapped
+	m.mapped = 0
+	_, err := m.soap("DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", fmt.Sprint(port)},
+		{"NewProtocol", "TCP"},
+	})
+	return err
+}
+
+func (m *upnpMapper) renew(localPort int, stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(m.config.LeaseDuration / 2):
+			m.mu.Lock()
+			port := m.mapped
+			var err error
+			if port != 0 {
+				err = m.addPortMapping(port, localPort)
+			}
+			m.mu.Unlock()
+			if err != nil {
+				log.With("port", port).Errorf("Error renewing upnp port mapping: %s", err)
+			}
+		}
+	}
+}
+
+func (m *upnpMapper) addPortMapping(externalPort, localPort int) error {
+	localIP, err := m.localIP()
+	if err != nil {
+		return fmt.Errorf("local ip: %s", err)
+	}
+	_, err = m.soap("AddPortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", fmt.Sprint(externalPort)},
+		{"NewProtocol", "TCP"},
+		{"NewInternalPort", fmt.Sprint(localPort)},
+		{"NewInternalClient", localIP},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", m.config.Description},
+		{"NewLeaseDuration", fmt.Sprint(int(m.config.LeaseDuration.Seconds()))},
+	})
+	return err
+}
+
+func (m *upnpMapper) externalIP() (string, error) {
+	resp, err := m.soap("GetExternalIPAddress", nil)
+	if err != nil {
+		return "", err
+	}
+	ip, err := findElement(resp, "NewExternalIPAddress")
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("invalid external ip %q", ip)
+	}
+	return ip, nil
+}
+
+// localIP returns the IP of the interface which routes to the gateway.
+func (m *upnpMapper) localIP() (string, error) {
+	u, err := url.Parse(m.gw.controlURL)
+	if err != nil {
+		return "", err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// soap invokes action on the gateway with args and returns the response body.
+func (m *upnpMapper) soap(action string, args [][2]string) ([]byte, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, m.gw.serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		xml.EscapeText(&body, []byte(arg[1]))
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+
+	resp, err := httputil.Post(
+		m.gw.controlURL,
+		httputil.SendBody(&body),
+		httputil.SendHeaders(map[string]string{
+			"Content-Type": `text/xml; charset="utf-8"`,
+			"SOAPAction":   fmt.Sprintf(`"%s#%s"`, m.gw.serviceType, action),
+		}),
+		httputil.SendTimeout(m.config.Timeout))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", action, err)
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// deviceDescription is the subset of a UPnP device description required to
+// find the WAN connection service.
+type deviceDescription struct {
+	URLBase string `xml:"URLBase"`
+	Device  device `xml:"device"`
+}
+
+type device struct {
+	Services []service `xml:"serviceList>service"`
+	Devices  []device  `xml:"deviceList>device"`
+}
+
+type service struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+// findService recursively searches d for a WAN connection service.
+func (d device) findService() (service, bool) {
+	for _, s := range d.Services {
+		if strings.Contains(s.ServiceType, ":WANIPConnection:") ||
+			strings.Contains(s.ServiceType, ":WANPPPConnection:") {
+			return s, true
+		}
+	}
+	for _, child := range d.Devices {
+		if s, ok := child.findService(); ok {
+			return s, true
+		}
+	}
+	return service{}, false
+}
+
+func (m *upnpMapper) fetchGateway(location string) (*gateway, error) {
+	resp, err := httputil.Get(location, httputil.SendTimeout(m.config.Timeout))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var desc deviceDescription
+	if err := xml.NewDecoder(resp.Body).Decode(&desc); err != nil {
+		return nil, fmt.Errorf("decode: %s", err)
+	}
+	s, ok := desc.Device.findService()
+	if !ok {
+		return nil, errors.New("no wan connection service found")
+	}
+	base := location
+	if desc.URLBase != "" {
+		base = desc.URLBase
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %s", err)
+	}
+	controlURL, err := baseURL.Parse(s.ControlURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse control url: %s", err)
+	}
+	return &gateway{s.ServiceType, controlURL.String()}, nil
+}
+
+// discoverGateway searches the local network for an Internet Gateway Device
+// via SSDP, and returns the location of its device description.
+func discoverGateway(timeout time.Duration) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp4", _ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	req := strings.Join([]string{
+		"M-SEARCH * HTTP/1.1",
+		"HOST: " + _ssdpAddr,
+		"ST: " + _gatewayDevice,
+		`MAN: "ssdp:discover"`,
+		"MX: 2",
+		"", "",
+	}, "\r\n")
+	if _, err := conn.WriteTo([]byte(req), addr); err != nil {
+		return "", fmt.Errorf("send search: %s", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				return "", errors.New("no gateway found")
+			}
+			return "", err
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// findElement returns the text of the first element named name in b.
+func findElement(b []byte, name string) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("element %s not found", name)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == name {
+			var text string
+			if err := d.DecodeElement(&text, &start); err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(text), nil
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const _descriptionFixture = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <deviceList>
+          <device>
+            <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+            <serviceList>
+              <service>
+                <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+                <controlURL>/ctl/IPConn</controlURL>
+              </service>
+            </serviceList>
+          </device>
+        </deviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+// gatewayFixture is a fake Internet Gateway Device which records SOAP actions.
+type gatewayFixture struct {
+	mu      sync.Mutex
+	actions []string
+	bodies  []string
+}
+
+func (g *gatewayFixture) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, _descriptionFixture)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+		action = strings.Trim(action[strings.Index(action, "#")+1:], `"`)
+
+		g.mu.Lock()
+		g.actions = append(g.actions, action)
+		g.bodies = append(g.bodies, string(b))
+		g.mu.Unlock()
+
+		switch action {
+		case "GetExternalIPAddress":
+			fmt.Fprint(w, `<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>
+<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">
+<NewExternalIPAddress>203.0.113.7</NewExternalIPAddress>
+</u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+		case "AddPortMapping", "DeletePortMapping":
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	return mux
+}
+
+func (g *gatewayFixture) getActions() ([]string, []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.actions...), append([]string(nil), g.bodies...)
+}
+
+func TestUPnPMapperMapAndUnmap(t *testing.T) {
+	require := require.New(t)
+
+	g := &gatewayFixture{}
+	server := httptest.NewServer(g.handler())
+	defer server.Close()
+
+	m, err := New(Config{
+		Mode:         ModeUPnP,
+		ExternalPort: 9090,
+		UPnP:         UPnPConfig{Gateway: server.URL + "/rootDesc.xml"},
+	})
+	require.NoError(err)
+
+	addr, err := m.Map(8080)
+	require.NoError(err)
+	require.Equal(Addr{"203.0.113.7", 9090}, addr)
+
+	require.NoError(m.Unmap())
+
+	actions, bodies := g.getActions()
+	require.Equal([]string{"GetExternalIPAddress", "AddPortMapping", "DeletePortMapping"}, actions)
+	require.Contains(bodies[1], "<NewExternalPort>9090</NewExternalPort>")
+	require.Contains(bodies[1], "<NewInternalPort>8080</NewInternalPort>")
+	require.Contains(bodies[1], "<NewInternalClient>127.0.0.1</NewInternalClient>")
+	require.Contains(bodies[1], "<NewProtocol>TCP</NewProtocol>")
+	require.Contains(bodies[2], "<NewExternalPort>9090</NewExternalPort>")
+}
+
+func TestUPnPMapperRenewsMapping(t *testing.T) {
+	require := require.New(t)
+
+	g := &gatewayFixture{}
+	server := httptest.NewServer(g.handler())
+	defer server.Close()
+
+	m, err := New(Config{
+		Mode: ModeUPnP,
+		UPnP: UPnPConfig{
+			Gateway:       server.URL + "/rootDesc.xml",
+			LeaseDuration: 100 * time.Millisecond,
+		},
+	})
+	require.NoError(err)
+
+	addr, err := m.Map(8080)
+	require.NoError(err)
+	require.Equal(Addr{"203.0.113.7", 8080}, addr)
+
+	time.Sleep(175 * time.Millisecond)
+	require.NoError(m.Unmap())
+
+	actions, _ := g.getActions()
+	var adds int
+	for _, a := range actions {
+		if a == "AddPortMapping" {
+			adds++
+		}
+	}
+	require.True(adds >= 2, "expected mapping to be renewed, got actions %v", actions)
+	require.Equal("DeletePortMapping", actions[len(actions)-1])
+}
+
+func TestUPnPMapperGatewayWithoutWANService(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<root><device><serviceList></serviceList></device></root>`)
+	}))
+	defer server.Close()
+
+	m, err := New(Config{Mode: ModeUPnP, UPnP: UPnPConfig{Gateway: server.URL}})
+	require.NoError(err)
+
+	_, err = m.Map(8080)
+	require.Error(err)
+	require.NoError(m.Unmap())
+}
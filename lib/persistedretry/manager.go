@@ -14,6 +14,7 @@
 package persistedretry
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -34,8 +35,21 @@ type Manager interface {
 	SyncExec(Task) error
 	Close()
 	Find(query interface{}) ([]Task, error)
+
+	// Pause stops executing queued and retried tasks until Resume is called.
+	// Tasks which are already executing run to completion, and tasks added
+	// while paused are persisted and executed after Resume.
+	Pause()
+	Resume()
+
+	// Flush blocks until all queued tasks have been executed, or until ctx is
+	// done. Failed tasks are not retried by Flush.
+	Flush(ctx context.Context) error
 }
 
+// _flushPollInterval is how often Flush checks whether the queues are empty.
+const _flushPollInterval = 50 * time.Millisecond
+
 type manager struct {
 	config   Config
 	stats    tally.Scope
@@ -50,6 +64,12 @@ type manager struct {
 	closeOnce sync.Once
 	done      chan struct{}
 	closed    atomic.Bool
+
+	// queued counts tasks which were enqueued and have not finished executing.
+	queued atomic.Int64
+
+	pauseMu sync.Mutex
+	resumed chan struct{} // Non-nil while paused, closed on resume.
 }
 
 // NewManager creates a new Manager.
@@ -162,10 +182,76 @@ func (m *manager) Find(query interface{}) ([]Task, error) {
 	return m.store.Find(query)
 }
 
+// Pause pauses task execution.
+func (m *manager) Pause() {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+
+	if m.resumed == nil {
+		m.resumed = make(chan struct{})
+		m.stats.Gauge("paused").Update(1)
+		log.Info("Paused task execution")
+	}
+}
+
+// Resume resumes task execution.
+func (m *manager) Resume() {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+
+	if m.resumed != nil {
+		close(m.resumed)
+		m.resumed = nil
+		m.stats.Gauge("paused").Update(0)
+		log.Info("Resumed task execution")
+	}
+}
+
+// Flush waits for queued tasks to finish executing.
+func (m *manager) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(_flushPollInterval)
+	defer ticker.Stop()
+
+	for m.queued.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d tasks still queued: %s", m.queued.Load(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func (m *manager) paused() bool {
+	m.pauseMu.Lock()
+	defer m.pauseMu.Unlock()
+
+	return m.resumed != nil
+}
+
+// waitResumed blocks while m is paused. Returns false if m is closed.
+func (m *manager) waitResumed() bool {
+	m.pauseMu.Lock()
+	resumed := m.resumed
+	m.pauseMu.Unlock()
+
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
 func (m *manager) enqueue(t Task, tasks chan Task) error {
+	m.queued.Inc()
 	select {
 	case tasks <- t:
 	default:
+		m.queued.Dec()
 		// If task queue is full, fallback task to failure state so it can be
 		// picked up by a retry round.
 		if err := m.store.MarkFailed(t); err != nil {
@@ -193,10 +279,16 @@ func (m *manager) worker(tasks chan Task, limit time.Duration) {
 		case <-m.done:
 			return
 		case t := <-tasks:
+			if !m.waitResumed() {
+				// The task is still pending in the store and will be retried
+				// on restart.
+				return
+			}
 			if err := m.exec(t); err != nil {
 				m.stats.Counter("exec_failures").Inc(1)
 				log.With("task", t).Errorf("Failed to exec task: %s", err)
 			}
+			m.queued.Dec()
 			time.Sleep(limit)
 		}
 	}
@@ -217,6 +309,9 @@ func (m *manager) tickerLoop() {
 }
 
 func (m *manager) pollRetries() {
+	if m.paused() {
+		return
+	}
 	tasks, err := m.store.GetFailed()
 	if err != nil {
 		m.stats.Counter("get_failed_failure").Inc(1)
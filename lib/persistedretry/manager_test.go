@@ -14,6 +14,7 @@
 package persistedretry_test
 
 import (
+	"context"
 	"errors"
 	"runtime"
 	"testing"
@@ -22,6 +23,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 
 	. "github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/mocks/lib/persistedretry"
@@ -119,6 +121,139 @@ func TestManagerAddTaskSuccess(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 }
 
+func TestManagerPauseDefersExecutionUntilResume(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	task := mocks.task()
+
+	var resumed atomic.Bool
+
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil),
+		task.EXPECT().Ready().Return(true),
+		mocks.store.EXPECT().AddPending(task).Return(nil),
+		mocks.executor.EXPECT().Exec(task).DoAndReturn(func(Task) error {
+			require.True(resumed.Load())
+			return nil
+		}),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	m, err := mocks.new()
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	m.Pause()
+
+	require.NoError(m.Add(task))
+
+	time.Sleep(50 * time.Millisecond)
+
+	resumed.Store(true)
+	m.Resume()
+
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestManagerPauseSkipsRetries(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	mocks.store.EXPECT().GetPending().Return(nil, nil)
+
+	// Retries may be polled at most once before the manager is paused.
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).MaxTimes(1)
+
+	m, err := mocks.new()
+	require.NoError(err)
+	defer m.Close()
+
+	m.Pause()
+
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestManagerFlushWaitsForQueuedTasks(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	task := mocks.task()
+
+	var executed atomic.Bool
+
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil),
+		task.EXPECT().Ready().Return(true),
+		mocks.store.EXPECT().AddPending(task).Return(nil),
+		mocks.executor.EXPECT().Exec(task).DoAndReturn(func(Task) error {
+			time.Sleep(100 * time.Millisecond)
+			executed.Store(true)
+			return nil
+		}),
+		mocks.store.EXPECT().Remove(task).Return(nil),
+	)
+
+	m, err := mocks.new()
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	require.NoError(m.Add(task))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(m.Flush(ctx))
+	require.True(executed.Load())
+}
+
+func TestManagerFlushTimeout(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newManagerMocks(t)
+	defer cleanup()
+
+	task := mocks.task()
+
+	mocks.store.EXPECT().GetFailed().Return(nil, nil).AnyTimes()
+
+	gomock.InOrder(
+		mocks.store.EXPECT().GetPending().Return(nil, nil),
+		task.EXPECT().Ready().Return(true),
+		mocks.store.EXPECT().AddPending(task).Return(nil),
+	)
+
+	m, err := mocks.new()
+	require.NoError(err)
+	defer m.Close()
+
+	waitForWorkers()
+
+	// Paused tasks are never executed, so Flush must give up.
+	m.Pause()
+
+	require.NoError(m.Add(task))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	require.Error(m.Flush(ctx))
+}
+
 func TestManagerAddTaskClosed(t *testing.T) {
 	require := require.New(t)
 
@@ -56,7 +56,13 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 	start := time.Now()
 	remoteTagClient := e.tagClientProvider.Provide(t.Destination)
 
-	if ok, err := remoteTagClient.Has(t.Tag); err == nil && ok {
+	if len(t.Aliases) > 0 {
+		if remoteHasGroup(remoteTagClient, t) {
+			// Remote index already points every tag of the group to the
+			// digest. No-op.
+			return nil
+		}
+	} else if ok, err := remoteTagClient.Has(t.Tag); err == nil && ok {
 		// Remote index already has the tag, therefore dependencies have already
 		// been replicated, and the remote has also replicated the tag. No-op.
 		return nil
@@ -75,7 +81,11 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 	// Put tag and triggers replication on the remote client.
 	// Replication will call Exec n^2 times but some will return early
 	// if remote has the tag already.
-	if err := remoteTagClient.PutAndReplicate(t.Tag, t.Digest); err != nil {
+	if len(t.Aliases) > 0 {
+		if err := remoteTagClient.PutGroupAndReplicate(t.GroupTags(), t.Digest); err != nil {
+			return fmt.Errorf("put and replicate tag group: %s", err)
+		}
+	} else if err := remoteTagClient.PutAndReplicate(t.Tag, t.Digest); err != nil {
 		return fmt.Errorf("put and replicate tag: %s", err)
 	}
 
@@ -85,3 +95,16 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 
 	return nil
 }
+
+// remoteHasGroup returns whether every tag of the group of t already points to
+// the digest of t on the remote. Groups are compared by digest rather than
+// existence, since aliases such as "latest" usually exist already.
+func remoteHasGroup(remote tagclient.Client, t *Task) bool {
+	for _, tag := range t.GroupTags() {
+		d, err := remote.Get(tag)
+		if err != nil || d != t.Digest {
+			return false
+		}
+	}
+	return true
+}
@@ -16,6 +16,7 @@ package tagreplication
 import (
 	"testing"
 
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/mocks/build-index/tagclient"
 	"github.com/uber/kraken/mocks/origin/blobclient"
 
@@ -94,3 +95,48 @@ func TestExecutorNoopsWhenTagAlreadyReplicated(t *testing.T) {
 
 	require.NoError(executor.Exec(task))
 }
+
+func TestExecutorGroup(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := GroupTaskFixture()
+
+	gomock.InOrder(
+		mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient),
+		tagClient.EXPECT().Get(task.Tag).Return(task.Digest, nil),
+		tagClient.EXPECT().Get(task.Aliases[0]).Return(core.DigestFixture(), nil),
+		tagClient.EXPECT().Origin().Return(_testRemoteOrigin, nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[0], _testRemoteOrigin).Return(nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[1], _testRemoteOrigin).Return(nil),
+		mocks.originCluster.EXPECT().ReplicateToRemote(
+			task.Tag, task.Dependencies[2], _testRemoteOrigin).Return(nil),
+		tagClient.EXPECT().PutGroupAndReplicate(task.GroupTags(), task.Digest).Return(nil),
+	)
+
+	require.NoError(executor.Exec(task))
+}
+
+func TestExecutorGroupNoopsWhenAllTagsMatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.new()
+	tagClient := mocks.newTagClient()
+	task := GroupTaskFixture()
+
+	mocks.tagClientProvider.EXPECT().Provide(task.Destination).Return(tagClient)
+	for _, tag := range task.GroupTags() {
+		tagClient.EXPECT().Get(tag).Return(task.Digest, nil)
+	}
+
+	require.NoError(executor.Exec(task))
+}
@@ -27,3 +27,12 @@ func TaskFixture() *Task {
 	dest := fmt.Sprintf("build-index-%s", randutil.Hex(8))
 	return NewTask(tag, d, core.DigestListFixture(3), dest, 0)
 }
+
+// GroupTaskFixture creates a fixture of tagreplication.Task which replicates a
+// group of tags.
+func GroupTaskFixture() *Task {
+	tags := []string{core.TagFixture(), core.TagFixture(), core.TagFixture()}
+	d := core.DigestFixture()
+	dest := fmt.Sprintf("build-index-%s", randutil.Hex(8))
+	return NewGroupTask(tags, d, core.DigestListFixture(3), dest, 0)
+}
@@ -104,15 +104,35 @@ func (s *Store) Remove(r persistedretry.Task) error {
 	return s.delete(r)
 }
 
-// Find is not supported.
+// Find finds tasks matching query.
 func (s *Store) Find(query interface{}) ([]persistedretry.Task, error) {
-	return nil, errors.New("not supported")
+	var tasks []*Task
+	var err error
+	switch q := query.(type) {
+	case *TagQuery:
+		err = s.db.Select(&tasks, `
+			SELECT tag, aliases, digest, dependencies, destination, created_at, last_attempt, failures, delay
+			FROM replicate_tag_task
+			WHERE tag=?
+		`, q.tag)
+	default:
+		return nil, errors.New("unknown query type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []persistedretry.Task
+	for _, t := range tasks {
+		result = append(result, t)
+	}
+	return result, nil
 }
 
 func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 	query := fmt.Sprintf(`
 		INSERT INTO replicate_tag_task (
 			tag,
+			aliases,
 			digest,
 			dependencies,
 			destination,
@@ -122,6 +142,7 @@ func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 			status
 		) VALUES (
 			:tag,
+			:aliases,
 			:digest,
 			:dependencies,
 			:destination,
@@ -143,7 +164,7 @@ func (s *Store) addWithStatus(r persistedretry.Task, status string) error {
 func (s *Store) selectStatus(status string) ([]persistedretry.Task, error) {
 	var tasks []*Task
 	err := s.db.Select(&tasks, `
-		SELECT tag, digest, dependencies, destination, created_at, last_attempt, failures, delay
+		SELECT tag, aliases, digest, dependencies, destination, created_at, last_attempt, failures, delay
 		FROM replicate_tag_task
 		WHERE status=?`, status)
 	if err != nil {
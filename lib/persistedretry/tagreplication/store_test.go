@@ -165,6 +165,21 @@ func TestAddPending(t *testing.T) {
 	checkPending(t, store, task)
 }
 
+func TestAddPendingGroupTask(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+
+	task := GroupTaskFixture()
+
+	require.NoError(store.AddPending(task))
+
+	checkPending(t, store, task)
+}
+
 func TestAddPendingTwiceReturnsErrTaskExists(t *testing.T) {
 	require := require.New(t)
 
@@ -264,6 +279,25 @@ func TestRemove(t *testing.T) {
 	checkPending(t, store)
 }
 
+func TestFindByTag(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStoreMocks(t)
+	defer cleanup()
+
+	store := mocks.new()
+
+	task1 := TaskFixture()
+	task2 := TaskFixture()
+
+	require.NoError(store.AddPending(task1))
+	require.NoError(store.AddFailed(task2))
+
+	result, err := store.Find(NewTagQuery(task2.Tag))
+	require.NoError(err)
+	checkTasks(t, []*Task{task2}, result)
+}
+
 func TestDelay(t *testing.T) {
 	require := require.New(t)
 
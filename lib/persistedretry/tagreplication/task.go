@@ -14,16 +14,55 @@
 package tagreplication
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/uber/kraken/core"
 )
 
+// TagList is a list of tags.
+type TagList []string
+
+// Value marshals l and returns []byte as driver.Value.
+func (l TagList) Value() (driver.Value, error) {
+	if l == nil {
+		l = TagList{}
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return driver.Value([]byte{}), err
+	}
+	return driver.Value(b), nil
+}
+
+// Scan unmarshals []byte or string to a list of tags. Empty lists are
+// scanned as nil.
+func (l *TagList) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("unsupported type %T", src)
+	}
+	if err := json.Unmarshal(b, l); err != nil {
+		return err
+	}
+	if len(*l) == 0 {
+		*l = nil
+	}
+	return nil
+}
+
 // Task contains information to replicate a tag and its dependencies to a
 // remote destination.
 type Task struct {
 	Tag          string          `db:"tag"`
+	Aliases      TagList         `db:"aliases"`
 	Digest       core.Digest     `db:"digest"`
 	Dependencies core.DigestList `db:"dependencies"`
 	Destination  string          `db:"destination"`
@@ -51,6 +90,27 @@ func NewTask(
 	}
 }
 
+// NewGroupTask creates a new Task which replicates tags as a group, such that
+// the remote sets all of tags to d at once. The first tag identifies the task.
+func NewGroupTask(
+	tags []string,
+	d core.Digest,
+	dependencies core.DigestList,
+	destination string,
+	delay time.Duration) *Task {
+
+	t := NewTask(tags[0], d, dependencies, destination, delay)
+	if len(tags) > 1 {
+		t.Aliases = tags[1:]
+	}
+	return t
+}
+
+// GroupTags returns all tags replicated by t.
+func (t *Task) GroupTags() []string {
+	return append([]string{t.Tag}, t.Aliases...)
+}
+
 func (t *Task) String() string {
 	return fmt.Sprintf("tagreplication.Task(tag=%s, dest=%s)", t.Tag, t.Destination)
 }
@@ -0,0 +1,62 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package writeback
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/c2h5oh/datasize"
+)
+
+// Config defines Executor configuration.
+type Config struct {
+	// MaxConcurrentUploads caps the number of backend uploads in flight across
+	// all write-back workers. Tasks beyond the cap wait for a free slot. Zero
+	// leaves uploads bounded only by the number of workers.
+	MaxConcurrentUploads int `yaml:"max_concurrent_uploads"`
+
+	// UploadBitsPerSec limits the aggregate rate of backend uploads. Zero
+	// disables the limit.
+	UploadBitsPerSec uint64 `yaml:"upload_bits_per_sec"`
+
+	// UploadBurst is the number of bytes which may be uploaded at once after
+	// the executor has been idle. Defaults to one second of uploads.
+	UploadBurst datasize.ByteSize `yaml:"upload_burst"`
+
+	// CoalesceNamespaces lists regular expressions of namespaces which share
+	// a backend bucket. Concurrent tasks for the same name whose namespaces
+	// match the same expression are coalesced into a single upload. Tasks of
+	// the same namespace and name are always coalesced.
+	CoalesceNamespaces []string `yaml:"coalesce_namespaces"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.UploadBitsPerSec > 0 && c.UploadBurst == 0 {
+		c.UploadBurst = datasize.ByteSize(c.UploadBitsPerSec / 8)
+	}
+	return c
+}
+
+func (c Config) compileCoalesceNamespaces() ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, ns := range c.CoalesceNamespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			return nil, fmt.Errorf("coalesce namespace %q: %s", ns, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
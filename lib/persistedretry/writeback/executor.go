@@ -14,8 +14,12 @@
 package writeback
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber-go/tally"
@@ -24,6 +28,8 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/utils/log"
+
+	"golang.org/x/time/rate"
 )
 
 // FileStore defines store operations required for write-back.
@@ -34,22 +40,80 @@ type FileStore interface {
 
 // Executor executes write back tasks.
 type Executor struct {
+	config   Config
 	stats    tally.Scope
 	fs       FileStore
 	backends *backend.Manager
+
+	// coalesce holds namespaces which share a backend bucket.
+	coalesce []*regexp.Regexp
+
+	// slots bounds concurrent uploads. Nil if uploads are not bounded.
+	slots chan struct{}
+
+	// limiter grants one token per uploaded byte. Nil if uploads are not
+	// throttled.
+	limiter *rate.Limiter
+
+	// waiting is the number of uploads waiting for a slot.
+	waiting int64
+
+	mu       sync.Mutex
+	inflight map[uploadKey]*inflightUpload
+}
+
+// uploadKey identifies uploads which may be coalesced. Rule is the index of
+// the coalesce namespace matching the task, in which case namespace is
+// empty, or -1 if there is no such namespace.
+type uploadKey struct {
+	rule      int
+	namespace string
+	name      string
+}
+
+// inflightUpload holds the result of an upload for coalesced tasks.
+type inflightUpload struct {
+	done chan struct{}
+	err  error
 }
 
 // NewExecutor creates a new Executor.
 func NewExecutor(
+	config Config,
 	stats tally.Scope,
 	fs FileStore,
-	backends *backend.Manager) *Executor {
+	backends *backend.Manager) (*Executor, error) {
+
+	config = config.applyDefaults()
 
 	stats = stats.Tagged(map[string]string{
 		"module": "writebackexecutor",
 	})
 
-	return &Executor{stats, fs, backends}
+	coalesce, err := config.compileCoalesceNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Executor{
+		config:   config,
+		stats:    stats,
+		fs:       fs,
+		backends: backends,
+		coalesce: coalesce,
+		inflight: make(map[uploadKey]*inflightUpload),
+	}
+	if config.MaxConcurrentUploads > 0 {
+		e.slots = make(chan struct{}, config.MaxConcurrentUploads)
+	}
+	if config.UploadBitsPerSec > 0 {
+		if config.UploadBitsPerSec < 8 {
+			return nil, fmt.Errorf("upload_bits_per_sec must be at least 8")
+		}
+		e.limiter = rate.NewLimiter(
+			rate.Limit(config.UploadBitsPerSec/8), int(config.UploadBurst))
+	}
+	return e, nil
 }
 
 // Name returns the executor name.
@@ -61,7 +125,7 @@ func (e *Executor) Name() string {
 // that matches r's namespace.
 func (e *Executor) Exec(r persistedretry.Task) error {
 	t := r.(*Task)
-	if err := e.upload(t); err != nil {
+	if err := e.coalescedUpload(t); err != nil {
 		return err
 	}
 	err := e.fs.DeleteCacheFileMetadata(t.Name, &metadata.Persist{})
@@ -71,6 +135,81 @@ func (e *Executor) Exec(r persistedretry.Task) error {
 	return nil
 }
 
+// coalescedUpload uploads t, unless an upload of the same name to the same
+// bucket is already in flight, in which case it waits for that upload and
+// returns its result.
+func (e *Executor) coalescedUpload(t *Task) error {
+	key := e.uploadKey(t)
+
+	e.mu.Lock()
+	if u, ok := e.inflight[key]; ok {
+		e.mu.Unlock()
+		e.stats.Counter("coalesced_uploads").Inc(1)
+		<-u.done
+		return u.err
+	}
+	u := &inflightUpload{done: make(chan struct{})}
+	e.inflight[key] = u
+	e.mu.Unlock()
+
+	u.err = e.upload(t)
+
+	e.mu.Lock()
+	delete(e.inflight, key)
+	e.mu.Unlock()
+	close(u.done)
+
+	return u.err
+}
+
+func (e *Executor) uploadKey(t *Task) uploadKey {
+	for i, re := range e.coalesce {
+		if re.MatchString(t.Namespace) {
+			return uploadKey{rule: i, name: t.Name}
+		}
+	}
+	return uploadKey{rule: -1, namespace: t.Namespace, name: t.Name}
+}
+
+// acquireSlot blocks until fewer than the max concurrent uploads are in
+// flight. The returned function releases the slot.
+func (e *Executor) acquireSlot() func() {
+	if e.slots == nil {
+		return func() {}
+	}
+	e.stats.Gauge("queue_depth").Update(float64(atomic.AddInt64(&e.waiting, 1)))
+	e.slots <- struct{}{}
+	e.stats.Gauge("queue_depth").Update(float64(atomic.AddInt64(&e.waiting, -1)))
+	e.stats.Gauge("uploads_in_flight").Update(float64(len(e.slots)))
+	return func() {
+		<-e.slots
+		e.stats.Gauge("uploads_in_flight").Update(float64(len(e.slots)))
+	}
+}
+
+// throttle blocks until the upload bandwidth for size bytes is available.
+// Bandwidth is reserved for the whole file before the upload starts, so
+// backends keep uploading parts concurrently at full speed while the rate
+// of all uploads averages out to the configured limit.
+func (e *Executor) throttle(size int64) {
+	if e.limiter == nil {
+		return
+	}
+	start := time.Now()
+	for size > 0 {
+		chunk := size
+		if burst := int64(e.limiter.Burst()); chunk > burst {
+			chunk = burst
+		}
+		if err := e.limiter.WaitN(context.Background(), int(chunk)); err != nil {
+			log.Errorf("Error throttling writeback upload: %s", err)
+			break
+		}
+		size -= chunk
+	}
+	e.stats.Timer("throttle_wait").Record(time.Since(start))
+}
+
 func (e *Executor) upload(t *Task) error {
 	start := time.Now()
 
@@ -102,9 +241,18 @@ func (e *Executor) upload(t *Task) error {
 	}
 	defer f.Close()
 
+	release := e.acquireSlot()
+	defer release()
+
+	e.throttle(f.Size())
+
+	// Backends configured with resumable uploads upload cache files in
+	// concurrent parts, and retries of this task resume where the failed
+	// attempt left off.
 	if err := client.Upload(t.Namespace, t.Name, f); err != nil {
 		return fmt.Errorf("upload: %s", err)
 	}
+	e.stats.Counter("upload_bytes").Inc(f.Size())
 
 	// We don't want to time noops nor errors.
 	e.stats.Timer("upload").Record(time.Since(start))
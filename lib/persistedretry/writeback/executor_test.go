@@ -16,7 +16,9 @@ package writeback
 import (
 	"bytes"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
@@ -56,7 +58,15 @@ func newExecutorMocks(t *testing.T) (*executorMocks, func()) {
 }
 
 func (m *executorMocks) new() *Executor {
-	return NewExecutor(tally.NoopScope, m.cas, m.backends)
+	return m.newWithConfig(Config{}, tally.NoopScope)
+}
+
+func (m *executorMocks) newWithConfig(config Config, stats tally.Scope) *Executor {
+	e, err := NewExecutor(config, stats, m.cas, m.backends)
+	if err != nil {
+		panic(err)
+	}
+	return e
 }
 
 func (m *executorMocks) client(namespace string) *mockbackend.MockClient {
@@ -188,3 +198,150 @@ func TestExecUploadFailure(t *testing.T) {
 	// metadata is still present.
 	require.Error(mocks.cas.DeleteCacheFile(blob.Digest.Hex()))
 }
+
+func TestExecCoalescesUploadsOfSharedBucket(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	setupBlob(t, mocks.cas, blob)
+
+	task1 := NewTask("shared/a", blob.Digest.Hex(), 0)
+	task2 := NewTask("shared/b", blob.Digest.Hex(), 0)
+
+	client := mockbackend.NewMockClient(mocks.ctrl)
+	require.NoError(mocks.backends.Register("shared/.*", client, false))
+
+	uploading := make(chan struct{})
+	release := make(chan struct{})
+
+	client.EXPECT().Stat(task1.Namespace, blob.Digest.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
+	client.EXPECT().Upload(task1.Namespace, blob.Digest.Hex(), gomock.Any()).DoAndReturn(
+		func(namespace, name string, src interface{}) error {
+			close(uploading)
+			<-release
+			return nil
+		})
+
+	stats := tally.NewTestScope("", nil)
+	executor := mocks.newWithConfig(Config{CoalesceNamespaces: []string{"shared/.*"}}, stats)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		require.NoError(executor.Exec(task1))
+	}()
+	<-uploading
+	go func() {
+		defer wg.Done()
+		require.NoError(executor.Exec(task2))
+	}()
+
+	require.Eventually(func() bool {
+		c, ok := stats.Snapshot().Counters()["coalesced_uploads+module=writebackexecutor"]
+		return ok && c.Value() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(release)
+	wg.Wait()
+}
+
+func TestUploadKey(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.newWithConfig(Config{CoalesceNamespaces: []string{"shared/a"}}, tally.NoopScope)
+
+	require.Equal(executor.uploadKey(NewTask("shared/a", "x", 0)), executor.uploadKey(NewTask("shared/a", "x", 0)))
+	require.NotEqual(executor.uploadKey(NewTask("shared/a", "x", 0)), executor.uploadKey(NewTask("shared/b", "x", 0)))
+	require.NotEqual(executor.uploadKey(NewTask("shared/b", "x", 0)), executor.uploadKey(NewTask("shared/c", "x", 0)))
+	require.NotEqual(executor.uploadKey(NewTask("shared/a", "x", 0)), executor.uploadKey(NewTask("shared/a", "y", 0)))
+}
+
+func TestExecLimitsConcurrentUploads(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	blob1 := core.NewBlobFixture()
+	blob2 := core.NewBlobFixture()
+
+	setupBlob(t, mocks.cas, blob1)
+	setupBlob(t, mocks.cas, blob2)
+
+	namespace := core.TagFixture()
+	client := mocks.client(namespace)
+
+	uploading := make(chan string, 2)
+	release := make(chan struct{})
+
+	client.EXPECT().Stat(namespace, gomock.Any()).Return(nil, backenderrors.ErrBlobNotFound).Times(2)
+	client.EXPECT().Upload(namespace, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(namespace, name string, src interface{}) error {
+			uploading <- name
+			<-release
+			return nil
+		}).Times(2)
+
+	stats := tally.NewTestScope("", nil)
+	executor := mocks.newWithConfig(Config{MaxConcurrentUploads: 1}, stats)
+
+	var wg sync.WaitGroup
+	for _, blob := range []*core.BlobFixture{blob1, blob2} {
+		wg.Add(1)
+		go func(blob *core.BlobFixture) {
+			defer wg.Done()
+			require.NoError(executor.Exec(NewTask(namespace, blob.Digest.Hex(), 0)))
+		}(blob)
+	}
+
+	<-uploading
+	require.Eventually(func() bool {
+		g, ok := stats.Snapshot().Gauges()["queue_depth+module=writebackexecutor"]
+		return ok && g.Value() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(uploading, 0)
+
+	release <- struct{}{}
+	<-uploading
+	close(release)
+	wg.Wait()
+}
+
+func TestThrottle(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	executor := mocks.newWithConfig(Config{
+		UploadBitsPerSec: 8 * 10000,
+		UploadBurst:      1000,
+	}, tally.NoopScope)
+
+	// The first 1000 bytes are granted by the burst, the rest at 10000 bytes
+	// per second.
+	start := time.Now()
+	executor.throttle(6000)
+	require.True(time.Since(start) >= 400*time.Millisecond)
+}
+
+func TestNewExecutorInvalidConfig(t *testing.T) {
+	mocks, cleanup := newExecutorMocks(t)
+	defer cleanup()
+
+	for _, config := range []Config{
+		{CoalesceNamespaces: []string{"("}},
+		{UploadBitsPerSec: 4},
+	} {
+		_, err := NewExecutor(config, tally.NoopScope, mocks.cas, mocks.backends)
+		require.Error(t, err)
+	}
+}
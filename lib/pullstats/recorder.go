@@ -0,0 +1,227 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pullstats
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Phase is a step of an image pull.
+type Phase string
+
+// Pull phases.
+const (
+	// PhaseTagResolution is the time to resolve the image tag via build-index.
+	PhaseTagResolution Phase = "tag_resolution"
+
+	// PhaseMetaInfoFetch is the time to fetch blob metainfo from the tracker.
+	PhaseMetaInfoFetch Phase = "metainfo_fetch"
+
+	// PhaseP2PDownload is the time to download blob pieces from peers.
+	PhaseP2PDownload Phase = "p2p_download"
+
+	// PhaseDiskWrite is the time to verify and move downloaded blobs into the
+	// cache.
+	PhaseDiskWrite Phase = "disk_write"
+)
+
+// Config defines Recorder configuration.
+type Config struct {
+	// Size is the number of recent pulls retained.
+	Size int `yaml:"size"`
+
+	// IdleTimeout is the duration after which a pull with no new activity is
+	// considered finished. Blob downloads for a repo are attributed to the
+	// last unfinished pull of the repo.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Size == 0 {
+		c.Size = 100
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = 30 * time.Second
+	}
+	return c
+}
+
+// Pull summarizes the time spent in each phase of pulling an image. Phase
+// durations are summed across all blobs of the image.
+type Pull struct {
+	Repo      string                  `json:"repo"`
+	Tag       string                  `json:"tag,omitempty"`
+	StartedAt time.Time               `json:"started_at"`
+	Blobs     int                     `json:"blobs"`
+	Errors    int                     `json:"errors"`
+	Phases    map[Phase]time.Duration `json:"phases"`
+
+	lastActive time.Time
+}
+
+func (p *Pull) copy() Pull {
+	c := *p
+	c.Phases = make(map[Phase]time.Duration, len(p.Phases))
+	for phase, d := range p.Phases {
+		c.Phases[phase] = d
+	}
+	return c
+}
+
+// Recorder records per-phase timings of image pulls, both as metrics and as a
+// bounded history of recent pulls.
+type Recorder struct {
+	config Config
+	stats  tally.Scope
+	clk    clock.Clock
+
+	mu       sync.Mutex
+	active   map[string]*Pull // Keyed by repo.
+	finished []Pull           // Ring buffer of finished pulls.
+	next     int
+}
+
+// New creates a new Recorder.
+func New(config Config, stats tally.Scope, clk clock.Clock) *Recorder {
+	config = config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "pullstats",
+	})
+
+	return &Recorder{
+		config: config,
+		stats:  stats,
+		clk:    clk,
+		active: make(map[string]*Pull),
+	}
+}
+
+// RecordTag records the resolution of tag, which starts a new pull of the
+// tag's repo. tag is expected to be of the form "repo:tag".
+func (r *Recorder) RecordTag(tag string, d time.Duration, err error) {
+	r.recordTimer(PhaseTagResolution, d)
+
+	repo := tag
+	var name string
+	if i := strings.LastIndex(tag, ":"); i >= 0 {
+		repo, name = tag[:i], tag[i+1:]
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire()
+	if p, ok := r.active[repo]; ok {
+		r.finish(p)
+	}
+	p := r.newPull(repo)
+	p.Tag = name
+	p.Phases[PhaseTagResolution] = d
+	if err != nil {
+		p.Errors++
+	}
+}
+
+// RecordBlob records the phases of a single blob download in repo.
+func (r *Recorder) RecordBlob(repo string, phases map[Phase]time.Duration, err error) {
+	for phase, d := range phases {
+		r.recordTimer(phase, d)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire()
+	p, ok := r.active[repo]
+	if !ok {
+		p = r.newPull(repo)
+	}
+	p.lastActive = r.clk.Now()
+	p.Blobs++
+	for phase, d := range phases {
+		p.Phases[phase] += d
+	}
+	if err != nil {
+		p.Errors++
+	}
+}
+
+// Recent returns the most recent pulls, including unfinished ones, in order of
+// most recently started first.
+func (r *Recorder) Recent() []Pull {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire()
+
+	var pulls []Pull
+	for _, p := range r.active {
+		pulls = append(pulls, p.copy())
+	}
+	pulls = append(pulls, r.finished...)
+	sort.Slice(pulls, func(i, j int) bool {
+		return pulls[i].StartedAt.After(pulls[j].StartedAt)
+	})
+	if len(pulls) > r.config.Size {
+		pulls = pulls[:r.config.Size]
+	}
+	return pulls
+}
+
+func (r *Recorder) recordTimer(phase Phase, d time.Duration) {
+	r.stats.Tagged(map[string]string{
+		"phase": string(phase),
+	}).Timer("pull_phase_time").Record(d)
+}
+
+func (r *Recorder) newPull(repo string) *Pull {
+	now := r.clk.Now()
+	p := &Pull{
+		Repo:       repo,
+		StartedAt:  now,
+		Phases:     make(map[Phase]time.Duration),
+		lastActive: now,
+	}
+	r.active[repo] = p
+	return p
+}
+
+// expire finishes all active pulls which have been idle for longer than the
+// configured timeout.
+func (r *Recorder) expire() {
+	now := r.clk.Now()
+	for _, p := range r.active {
+		if now.Sub(p.lastActive) > r.config.IdleTimeout {
+			r.finish(p)
+		}
+	}
+}
+
+func (r *Recorder) finish(p *Pull) {
+	delete(r.active, p.Repo)
+	if len(r.finished) < r.config.Size {
+		r.finished = append(r.finished, p.copy())
+		r.next = len(r.finished) % r.config.Size
+		return
+	}
+	r.finished[r.next] = p.copy()
+	r.next = (r.next + 1) % r.config.Size
+}
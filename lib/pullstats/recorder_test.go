@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pullstats
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestRecorderAttributesBlobsToTagPull(t *testing.T) {
+	require := require.New(t)
+
+	r := New(Config{}, tally.NoopScope, clock.NewMock())
+
+	r.RecordTag("foo/bar:latest", time.Second, nil)
+	for i := 0; i < 2; i++ {
+		r.RecordBlob("foo/bar", map[Phase]time.Duration{
+			PhaseMetaInfoFetch: time.Second,
+			PhaseP2PDownload:   2 * time.Second,
+			PhaseDiskWrite:     time.Second,
+		}, nil)
+	}
+	r.RecordBlob("foo/bar", map[Phase]time.Duration{
+		PhaseMetaInfoFetch: time.Second,
+	}, errors.New("some error"))
+
+	pulls := r.Recent()
+	require.Len(pulls, 1)
+	require.Equal("foo/bar", pulls[0].Repo)
+	require.Equal("latest", pulls[0].Tag)
+	require.Equal(3, pulls[0].Blobs)
+	require.Equal(1, pulls[0].Errors)
+	require.Equal(map[Phase]time.Duration{
+		PhaseTagResolution: time.Second,
+		PhaseMetaInfoFetch: 3 * time.Second,
+		PhaseP2PDownload:   4 * time.Second,
+		PhaseDiskWrite:     2 * time.Second,
+	}, pulls[0].Phases)
+}
+
+func TestRecorderIdlePullsFinish(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	r := New(Config{IdleTimeout: time.Minute}, tally.NoopScope, clk)
+
+	r.RecordTag("foo/bar:v1", time.Second, nil)
+	clk.Add(2 * time.Minute)
+	r.RecordBlob("foo/bar", map[Phase]time.Duration{PhaseP2PDownload: time.Second}, nil)
+
+	pulls := r.Recent()
+	require.Len(pulls, 2)
+	require.Equal("", pulls[0].Tag)
+	require.Equal(1, pulls[0].Blobs)
+	require.Equal("v1", pulls[1].Tag)
+	require.Equal(0, pulls[1].Blobs)
+}
+
+func TestRecorderRetainsMostRecentPulls(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	r := New(Config{Size: 3}, tally.NoopScope, clk)
+
+	for i := 0; i < 10; i++ {
+		r.RecordTag(fmt.Sprintf("foo/bar:%d", i), time.Second, nil)
+		clk.Add(time.Second)
+	}
+
+	var tags []string
+	for _, p := range r.Recent() {
+		tags = append(tags, p.Tag)
+	}
+	require.Equal([]string{"9", "8", "7"}, tags)
+}
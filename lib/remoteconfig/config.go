@@ -0,0 +1,44 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package remoteconfig
+
+import "time"
+
+// Config defines Poller configuration.
+type Config struct {
+	// URL of the central config service. Remote overrides are disabled if
+	// empty.
+	URL string `yaml:"url"`
+
+	// PublicKey is the base64 encoded ed25519 key which payloads must be
+	// signed with.
+	PublicKey string `yaml:"public_key"`
+
+	// Cluster is the name of the cluster the poller runs in. Payloads
+	// addressed to a different cluster are rejected.
+	Cluster string `yaml:"cluster"`
+
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Interval == 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Second
+	}
+	return c
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package remoteconfig periodically fetches signed configuration overrides
+// from a central config service, such that rate limits, connection caps and
+// feature flags can be changed across a fleet without config pushes.
+package remoteconfig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// ErrInvalidSignature is returned when a payload signature does not match the
+// configured public key.
+var ErrInvalidSignature = errors.New("invalid payload signature")
+
+// ErrExpired is returned when a payload is past its expiry.
+var ErrExpired = errors.New("payload expired")
+
+// ErrMisaddressed is returned when a payload is addressed to a different
+// component or cluster.
+var ErrMisaddressed = errors.New("payload addressed to different component or cluster")
+
+// Overrides defines configuration overrides served by the config service.
+// Each section is a JSON object merged over the local configuration of the
+// component which subscribes to it.
+type Overrides struct {
+	Version  int64                      `json:"version"`
+	Sections map[string]json.RawMessage `json:"sections"`
+	Flags    map[string]bool            `json:"flags"`
+
+	// ExpiresAt, if set, is the time after which the overrides are rejected,
+	// such that old signed payloads cannot be replayed indefinitely.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Component and Cluster, if set, address the overrides to pollers of the
+	// given component and cluster. Payloads addressed elsewhere are rejected.
+	Component string `json:"component,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+}
+
+// SignedPayload is the response body of the config service. Payload is a JSON
+// encoded Overrides, and Signature is the ed25519 signature of Payload.
+type SignedPayload struct {
+	Payload   []byte `json:"payload"`
+	Signature []byte `json:"signature"`
+}
+
+// Sign signs o with key. Intended for tooling which publishes overrides.
+func Sign(key ed25519.PrivateKey, o Overrides) (SignedPayload, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return SignedPayload{}, fmt.Errorf("json marshal: %s", err)
+	}
+	return SignedPayload{b, ed25519.Sign(key, b)}, nil
+}
+
+// ApplyFunc applies a section of overrides. A nil section means the section
+// was removed and local configuration should be restored.
+type ApplyFunc func(section json.RawMessage) error
+
+// Merge decodes section over v, which should be a pointer to a copy of the
+// local configuration. A nil section leaves v unchanged.
+func Merge(section json.RawMessage, v interface{}) error {
+	if section == nil {
+		return nil
+	}
+	return json.Unmarshal(section, v)
+}
+
+// Poller periodically fetches overrides and applies changed sections to
+// subscribers.
+type Poller struct {
+	config    Config
+	component string
+	stats     tally.Scope
+	publicKey ed25519.PublicKey
+
+	mu          sync.RWMutex
+	version     int64
+	sections    map[string]json.RawMessage
+	flags       map[string]bool
+	subscribers map[string]ApplyFunc
+}
+
+// New creates a new Poller for component, e.g. "agent".
+func New(config Config, component string, stats tally.Scope) (*Poller, error) {
+	config = config.applyDefaults()
+
+	if config.URL == "" {
+		return nil, errors.New("no url configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(config.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode public key: %s", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size %d", len(key))
+	}
+
+	stats = stats.Tagged(map[string]string{
+		"module": "remoteconfig",
+	})
+
+	return &Poller{
+		config:      config,
+		component:   component,
+		stats:       stats,
+		publicKey:   ed25519.PublicKey(key),
+		sections:    make(map[string]json.RawMessage),
+		flags:       make(map[string]bool),
+		subscribers: make(map[string]ApplyFunc),
+	}, nil
+}
+
+// Subscribe registers f to be called whenever section changes. Must be called
+// before Run.
+func (p *Poller) Subscribe(section string, f ApplyFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers[section] = f
+}
+
+// Flag returns the current value of feature flag name, or def if the flag is
+// not set.
+func (p *Poller) Flag(name string, def bool) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	v, ok := p.flags[name]
+	if !ok {
+		return def
+	}
+	return v
+}
+
+// Flags returns a copy of all feature flags currently set.
+func (p *Poller) Flags() map[string]bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	flags := make(map[string]bool, len(p.flags))
+	for name, v := range p.flags {
+		flags[name] = v
+	}
+	return flags
+}
+
+// Run polls the config service every configured interval. Blocks forever.
+func (p *Poller) Run() {
+	for {
+		if err := p.Poll(); err != nil {
+			log.Errorf("Error polling remote config: %s", err)
+		}
+		time.Sleep(p.config.Interval)
+	}
+}
+
+// Poll fetches overrides once and applies them if their version is newer than
+// the last applied version.
+func (p *Poller) Poll() error {
+	o, err := p.fetch()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if o.Version <= p.version {
+		return nil
+	}
+
+	var errs []string
+	for section, f := range p.subscribers {
+		next := o.Sections[section]
+		if bytes.Equal(next, p.sections[section]) {
+			continue
+		}
+		if err := f(next); err != nil {
+			p.stats.Tagged(map[string]string{"section": section}).Counter("apply_errors").Inc(1)
+			errs = append(errs, fmt.Sprintf("%s: %s", section, err))
+			continue
+		}
+		p.sections[section] = next
+		log.With("section", section, "version", o.Version).Info("Applied remote config section")
+	}
+	if len(errs) > 0 {
+		// Sections which failed are retried on the next poll.
+		return fmt.Errorf("apply sections: %v", errs)
+	}
+
+	p.version = o.Version
+	p.flags = o.Flags
+	p.stats.Gauge("version").Update(float64(o.Version))
+	return nil
+}
+
+func (p *Poller) fetch() (Overrides, error) {
+	resp, err := httputil.Get(p.config.URL, httputil.SendTimeout(p.config.Timeout))
+	if err != nil {
+		p.stats.Counter("fetch_errors").Inc(1)
+		return Overrides{}, fmt.Errorf("get: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var signed SignedPayload
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		p.stats.Counter("fetch_errors").Inc(1)
+		return Overrides{}, fmt.Errorf("decode signed payload: %s", err)
+	}
+	if !ed25519.Verify(p.publicKey, signed.Payload, signed.Signature) {
+		p.stats.Counter("signature_errors").Inc(1)
+		return Overrides{}, ErrInvalidSignature
+	}
+	var o Overrides
+	if err := json.Unmarshal(signed.Payload, &o); err != nil {
+		return Overrides{}, fmt.Errorf("decode overrides: %s", err)
+	}
+	if !o.ExpiresAt.IsZero() && time.Now().After(o.ExpiresAt) {
+		p.stats.Counter("expired_payloads").Inc(1)
+		return Overrides{}, ErrExpired
+	}
+	if (o.Component != "" && o.Component != p.component) ||
+		(o.Cluster != "" && o.Cluster != p.config.Cluster) {
+		p.stats.Counter("misaddressed_payloads").Inc(1)
+		return Overrides{}, ErrMisaddressed
+	}
+	return o, nil
+}
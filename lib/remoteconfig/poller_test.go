@@ -0,0 +1,259 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package remoteconfig
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// configService serves signed payloads for testing.
+type configService struct {
+	sync.Mutex
+	payload SignedPayload
+}
+
+func (s *configService) set(p SignedPayload) {
+	s.Lock()
+	defer s.Unlock()
+	s.payload = p
+}
+
+func (s *configService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	json.NewEncoder(w).Encode(s.payload)
+}
+
+type pollerFixture struct {
+	poller  *Poller
+	service *configService
+	key     ed25519.PrivateKey
+}
+
+func newPollerFixture(t *testing.T) (*pollerFixture, func()) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	service := &configService{}
+	addr, stop := testutil.StartServer(service)
+
+	p, err := New(Config{
+		URL:       fmt.Sprintf("http://%s/overrides", addr),
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Cluster:   "zone1",
+	}, "tracker", tally.NoopScope)
+	require.NoError(t, err)
+
+	return &pollerFixture{p, service, key}, stop
+}
+
+func (f *pollerFixture) publish(t *testing.T, o Overrides) {
+	signed, err := Sign(f.key, o)
+	require.NoError(t, err)
+	f.service.set(signed)
+}
+
+func TestPollerAppliesChangedSections(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newPollerFixture(t)
+	defer cleanup()
+
+	var applied []string
+	f.poller.Subscribe("tracker", func(section json.RawMessage) error {
+		applied = append(applied, string(section))
+		return nil
+	})
+
+	f.publish(t, Overrides{
+		Version:  1,
+		Sections: map[string]json.RawMessage{"tracker": json.RawMessage(`{"a":1}`)},
+		Flags:    map[string]bool{"foo": true},
+	})
+	require.NoError(f.poller.Poll())
+	require.Equal([]string{`{"a":1}`}, applied)
+	require.True(f.poller.Flag("foo", false))
+	require.True(f.poller.Flag("bar", true))
+
+	// Same version is not reapplied.
+	require.NoError(f.poller.Poll())
+	require.Len(applied, 1)
+
+	// Unchanged sections are not reapplied.
+	f.publish(t, Overrides{
+		Version:  2,
+		Sections: map[string]json.RawMessage{"tracker": json.RawMessage(`{"a":1}`)},
+	})
+	require.NoError(f.poller.Poll())
+	require.Len(applied, 1)
+	require.False(f.poller.Flag("foo", false))
+
+	// Removed sections are applied as nil.
+	f.publish(t, Overrides{Version: 3})
+	require.NoError(f.poller.Poll())
+	require.Equal([]string{`{"a":1}`, ""}, applied)
+}
+
+func TestPollerRejectsInvalidSignature(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newPollerFixture(t)
+	defer cleanup()
+
+	f.poller.Subscribe("tracker", func(json.RawMessage) error {
+		require.FailNow("unexpected apply")
+		return nil
+	})
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+	signed, err := Sign(otherKey, Overrides{
+		Version:  1,
+		Sections: map[string]json.RawMessage{"tracker": json.RawMessage(`{}`)},
+	})
+	require.NoError(err)
+	f.service.set(signed)
+
+	require.Equal(ErrInvalidSignature, f.poller.Poll())
+}
+
+func TestPollerRejectsExpiredPayload(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newPollerFixture(t)
+	defer cleanup()
+
+	var applied int
+	f.poller.Subscribe("tracker", func(json.RawMessage) error {
+		applied++
+		return nil
+	})
+
+	f.publish(t, Overrides{
+		Version:   1,
+		Sections:  map[string]json.RawMessage{"tracker": json.RawMessage(`{}`)},
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	require.Equal(ErrExpired, f.poller.Poll())
+	require.Equal(0, applied)
+
+	f.publish(t, Overrides{
+		Version:   1,
+		Sections:  map[string]json.RawMessage{"tracker": json.RawMessage(`{}`)},
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(f.poller.Poll())
+	require.Equal(1, applied)
+}
+
+func TestPollerRejectsMisaddressedPayload(t *testing.T) {
+	tests := []struct {
+		desc      string
+		component string
+		cluster   string
+		expected  error
+	}{
+		{"unaddressed", "", "", nil},
+		{"addressed to poller", "tracker", "zone1", nil},
+		{"addressed to component", "tracker", "", nil},
+		{"addressed to cluster", "", "zone1", nil},
+		{"other component", "agent", "zone1", ErrMisaddressed},
+		{"other cluster", "tracker", "zone2", ErrMisaddressed},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			f, cleanup := newPollerFixture(t)
+			defer cleanup()
+
+			var applied int
+			f.poller.Subscribe("tracker", func(json.RawMessage) error {
+				applied++
+				return nil
+			})
+
+			f.publish(t, Overrides{
+				Version:   1,
+				Sections:  map[string]json.RawMessage{"tracker": json.RawMessage(`{}`)},
+				Component: test.component,
+				Cluster:   test.cluster,
+			})
+			require.Equal(test.expected, f.poller.Poll())
+			if test.expected == nil {
+				require.Equal(1, applied)
+			} else {
+				require.Equal(0, applied)
+			}
+		})
+	}
+}
+
+func TestPollerRetriesFailedSections(t *testing.T) {
+	require := require.New(t)
+
+	f, cleanup := newPollerFixture(t)
+	defer cleanup()
+
+	var calls int
+	f.poller.Subscribe("scheduler", func(json.RawMessage) error {
+		calls++
+		if calls == 1 {
+			return errors.New("some error")
+		}
+		return nil
+	})
+
+	f.publish(t, Overrides{
+		Version:  1,
+		Sections: map[string]json.RawMessage{"scheduler": json.RawMessage(`{}`)},
+	})
+	require.Error(f.poller.Poll())
+	require.NoError(f.poller.Poll())
+	require.Equal(2, calls)
+}
+
+func TestNewInvalidPublicKey(t *testing.T) {
+	_, err := New(Config{URL: "http://localhost", PublicKey: "Zm9v"}, "tracker", tally.NoopScope)
+	require.Error(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	require := require.New(t)
+
+	type config struct {
+		A int
+		B int
+	}
+	c := config{A: 1, B: 2}
+	require.NoError(Merge(json.RawMessage(`{"B": 3}`), &c))
+	require.Equal(config{A: 1, B: 3}, c)
+
+	require.NoError(Merge(nil, &c))
+	require.Equal(config{A: 1, B: 3}, c)
+}
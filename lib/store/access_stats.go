@@ -0,0 +1,183 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// AccessStatsConfig defines configuration for cache access statistics, which
+// break down cache hit ratios by blob popularity and recency.
+type AccessStatsConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxTracked bounds the number of blobs whose access history is kept in
+	// memory. The least recently accessed blobs are forgotten first.
+	MaxTracked int `yaml:"max_tracked"`
+
+	// RankInterval is how often popularity deciles are recomputed from the
+	// tracked access counts.
+	RankInterval time.Duration `yaml:"rank_interval"`
+}
+
+func (c AccessStatsConfig) applyDefaults() AccessStatsConfig {
+	if c.MaxTracked == 0 {
+		c.MaxTracked = 100000
+	}
+	if c.RankInterval == 0 {
+		c.RankInterval = 5 * time.Minute
+	}
+	return c
+}
+
+// _recencyBuckets are the upper bounds of the recency buckets, keyed by the
+// time since a blob was previously accessed.
+var _recencyBuckets = []struct {
+	tag string
+	max time.Duration
+}{
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+	{"1d", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+type accessEntry struct {
+	count int
+	last  time.Time
+}
+
+// accessTracker records cache hits and misses tagged by the popularity decile
+// and recency bucket of the accessed blob. Decile 1 holds the 10% most
+// frequently accessed blobs. Blobs accessed for the first time are tagged
+// "new" in both dimensions.
+type accessTracker struct {
+	config AccessStatsConfig
+	clk    clock.Clock
+	stats  tally.Scope
+
+	mu      sync.Mutex
+	entries map[string]*accessEntry
+	// Minimum access count of each of the top nine deciles, in descending order.
+	thresholds []int
+	ranked     time.Time
+}
+
+func newAccessTracker(config AccessStatsConfig, clk clock.Clock, stats tally.Scope) *accessTracker {
+	return &accessTracker{
+		config:  config.applyDefaults(),
+		clk:     clk,
+		stats:   stats.SubScope("access"),
+		entries: make(map[string]*accessEntry),
+		ranked:  clk.Now(),
+	}
+}
+
+// record records an access of name which was either served from the cache or
+// not.
+func (t *accessTracker) record(name string, hit bool) {
+	decile, recency := t.touch(name)
+
+	counter := "cache_misses"
+	if hit {
+		counter = "cache_hits"
+	}
+	t.stats.Tagged(map[string]string{"popularity_decile": decile}).Counter(counter).Inc(1)
+	t.stats.Tagged(map[string]string{"recency": recency}).Counter(counter).Inc(1)
+}
+
+// touch bumps the access count of name and returns the popularity decile and
+// recency bucket it belonged to before the access.
+func (t *accessTracker) touch(name string) (decile, recency string) {
+	now := t.clk.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.ranked) >= t.config.RankInterval {
+		t.rank()
+		t.ranked = now
+	}
+
+	e, ok := t.entries[name]
+	if !ok {
+		t.entries[name] = &accessEntry{count: 1, last: now}
+		return "new", "new"
+	}
+	decile = t.decile(e.count)
+	recency = recencyTag(now.Sub(e.last))
+	e.count++
+	e.last = now
+	return decile, recency
+}
+
+// rank forgets the least recently accessed entries beyond the configured limit
+// and recomputes the decile thresholds. Must be called with mu held.
+func (t *accessTracker) rank() {
+	if len(t.entries) > t.config.MaxTracked {
+		names := make([]string, 0, len(t.entries))
+		for name := range t.entries {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return t.entries[names[i]].last.After(t.entries[names[j]].last)
+		})
+		for _, name := range names[t.config.MaxTracked:] {
+			delete(t.entries, name)
+		}
+	}
+
+	counts := make([]int, 0, len(t.entries))
+	for _, e := range t.entries {
+		counts = append(counts, e.count)
+	}
+	if len(counts) == 0 {
+		t.thresholds = nil
+		return
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+	t.thresholds = make([]int, 9)
+	for i := range t.thresholds {
+		t.thresholds[i] = counts[((i+1)*len(counts)-1)/10]
+	}
+}
+
+// decile returns the popularity decile of a blob accessed count times. Must be
+// called with mu held.
+func (t *accessTracker) decile(count int) string {
+	if t.thresholds == nil {
+		return "unranked"
+	}
+	for i, min := range t.thresholds {
+		if count >= min {
+			return strconv.Itoa(i + 1)
+		}
+	}
+	return "10"
+}
+
+func recencyTag(idle time.Duration) string {
+	for _, b := range _recencyBuckets {
+		if idle < b.max {
+			return b.tag
+		}
+	}
+	return "older"
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func accessCounts(stats tally.TestScope, tag string) map[string]int64 {
+	counts := make(map[string]int64)
+	for _, c := range stats.Snapshot().Counters() {
+		if v, ok := c.Tags()[tag]; ok {
+			counts[c.Name()+"/"+v] = c.Value()
+		}
+	}
+	return counts
+}
+
+func TestAccessTrackerPopularityDeciles(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	stats := tally.NewTestScope("", nil)
+	tr := newAccessTracker(AccessStatsConfig{RankInterval: time.Minute}, clk, stats)
+
+	// Blob i is accessed i+1 times, such that blob 9 is the most popular.
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			tr.record(fmt.Sprintf("blob%d", i), false)
+		}
+	}
+
+	clk.Add(time.Minute)
+
+	tr.record("blob9", true)
+	tr.record("blob0", true)
+	tr.record("blob5", false)
+	tr.record("other", false)
+
+	counts := accessCounts(stats, "popularity_decile")
+	require.Equal(int64(1), counts["access.cache_hits/1"])
+	require.Equal(int64(1), counts["access.cache_hits/10"])
+	require.Equal(int64(1), counts["access.cache_misses/5"])
+	require.Equal(int64(11), counts["access.cache_misses/new"])
+	require.Equal(int64(45), counts["access.cache_misses/unranked"])
+}
+
+func TestAccessTrackerRecency(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	stats := tally.NewTestScope("", nil)
+	tr := newAccessTracker(AccessStatsConfig{}, clk, stats)
+
+	tr.record("a", false)
+	clk.Add(time.Minute)
+	tr.record("a", true)
+	clk.Add(2 * time.Hour)
+	tr.record("a", true)
+	clk.Add(30 * 24 * time.Hour)
+	tr.record("a", false)
+
+	counts := accessCounts(stats, "recency")
+	require.Equal(map[string]int64{
+		"access.cache_misses/new":   1,
+		"access.cache_hits/1h":      1,
+		"access.cache_hits/6h":      1,
+		"access.cache_misses/older": 1,
+	}, counts)
+}
+
+func TestAccessTrackerForgetsLeastRecentlyAccessed(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	tr := newAccessTracker(
+		AccessStatsConfig{MaxTracked: 2, RankInterval: time.Minute}, clk, tally.NoopScope)
+
+	for _, name := range []string{"a", "b", "c"} {
+		tr.record(name, false)
+		clk.Add(time.Second)
+	}
+	clk.Add(time.Minute)
+	tr.record("c", true)
+
+	require.Len(tr.entries, 2)
+	require.NotContains(tr.entries, "a")
+}
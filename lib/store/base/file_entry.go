@@ -25,6 +25,8 @@ import (
 
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/utils/stringset"
+
+	"github.com/andres-erbsen/clock"
 )
 
 // FileEntry errors.
@@ -98,11 +100,13 @@ var _ FileEntryFactory = (*casFileEntryFactory)(nil)
 var _ FileEntry = (*localFileEntry)(nil)
 
 // localFileEntryFactory initializes localFileEntry obj.
-type localFileEntryFactory struct{}
+type localFileEntryFactory struct {
+	clk clock.Clock
+}
 
 // NewLocalFileEntryFactory is the constructor for localFileEntryFactory.
-func NewLocalFileEntryFactory() FileEntryFactory {
-	return &localFileEntryFactory{}
+func NewLocalFileEntryFactory(clk clock.Clock) FileEntryFactory {
+	return &localFileEntryFactory{clk}
 }
 
 // Create initializes and returns a FileEntry object.
@@ -113,7 +117,7 @@ func (f *localFileEntryFactory) Create(name string, state FileState) (FileEntry,
 	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasPrefix(name, "../") {
 		return nil, ErrInvalidName
 	}
-	return newLocalFileEntry(state, name, f.GetRelativePath(name)), nil
+	return newLocalFileEntry(state, name, f.GetRelativePath(name), f.clk), nil
 }
 
 // GetRelativePath returns name because file entries are stored flat under state directory.
@@ -160,17 +164,19 @@ func (f *localFileEntryFactory) ListNames(state FileState) ([]string, error) {
 // casFileEntryFactory initializes localFileEntry obj.
 // It uses the first few bytes of file digest (which is also used as file name) as shard ID.
 // For every byte, one more level of directories will be created.
-type casFileEntryFactory struct{}
+type casFileEntryFactory struct {
+	clk clock.Clock
+}
 
 // NewCASFileEntryFactory is the constructor for casFileEntryFactory.
-func NewCASFileEntryFactory() FileEntryFactory {
-	return &casFileEntryFactory{}
+func NewCASFileEntryFactory(clk clock.Clock) FileEntryFactory {
+	return &casFileEntryFactory{clk}
 }
 
 // Create initializes and returns a FileEntry object.
 // TODO: verify name.
 func (f *casFileEntryFactory) Create(name string, state FileState) (FileEntry, error) {
-	return newLocalFileEntry(state, name, f.GetRelativePath(name)), nil
+	return newLocalFileEntry(state, name, f.GetRelativePath(name), f.clk), nil
 }
 
 // GetRelativePath returns content-addressable file path under state directory.
@@ -227,18 +233,21 @@ type localFileEntry struct {
 	name             string
 	relativeDataPath string        // Relative path to data file.
 	metadata         stringset.Set // Metadata is identified by suffix.
+	clk              clock.Clock   // Checks lease expiry.
 }
 
 func newLocalFileEntry(
 	state FileState,
 	name string,
 	relativeDataPath string,
+	clk clock.Clock,
 ) *localFileEntry {
 	return &localFileEntry{
 		state:            state,
 		name:             name,
 		relativeDataPath: relativeDataPath,
 		metadata:         make(stringset.Set),
+		clk:              clk,
 	}
 }
 
@@ -420,7 +429,8 @@ func (entry *localFileEntry) LinkTo(targetPath string) error {
 }
 
 // Delete removes file and all of its metedata files from disk. If persist
-// metadata is present and true, delete returns ErrFilePersisted.
+// metadata is present and true, or lease metadata is present and has not
+// expired, delete returns ErrFilePersisted.
 func (entry *localFileEntry) Delete() error {
 	var persist metadata.Persist
 	if err := entry.GetMetadata(&persist); err != nil {
@@ -432,6 +442,16 @@ func (entry *localFileEntry) Delete() error {
 			return ErrFilePersisted
 		}
 	}
+	var lease metadata.Lease
+	if err := entry.GetMetadata(&lease); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("get lease metadata: %s", err)
+		}
+	} else {
+		if entry.clk.Now().Before(lease.Deadline) {
+			return ErrFilePersisted
+		}
+	}
 
 	// Remove files.
 	return os.RemoveAll(filepath.Dir(entry.GetPath()))
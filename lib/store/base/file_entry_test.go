@@ -22,11 +22,13 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store/metadata"
 	"github.com/uber/kraken/utils/randutil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,8 +48,8 @@ func checkListNames(t *testing.T, factory FileEntryFactory, state FileState, exp
 
 func TestFileEntryFactoryListNames(t *testing.T) {
 	for _, factory := range []FileEntryFactory{
-		NewLocalFileEntryFactory(),
-		NewCASFileEntryFactory(),
+		NewLocalFileEntryFactory(clock.New()),
+		NewCASFileEntryFactory(clock.New()),
 	} {
 		fname := reflect.Indirect(reflect.ValueOf(factory)).Type().Name()
 		t.Run(fname, func(t *testing.T) {
@@ -81,7 +83,7 @@ func TestLocalFileEntryFactoryListNamesWithSlashes(t *testing.T) {
 	state, _, _, cleanup := fileStatesFixture()
 	defer cleanup()
 
-	factory := NewLocalFileEntryFactory()
+	factory := NewLocalFileEntryFactory(clock.New())
 
 	// ListNames should show all created entries.
 	var entries []FileEntry
@@ -118,7 +120,7 @@ func TestLocalFileEntryFactoryCreate(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			require := require.New(t)
-			factory := NewLocalFileEntryFactory()
+			factory := NewLocalFileEntryFactory(clock.New())
 			entry, err := factory.Create(tc.name, state)
 			require.NoError(err)
 			require.NotNil(entry)
@@ -148,7 +150,7 @@ func TestLocalFileEntryFactoryCreateError(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			require := require.New(t)
-			factory := NewLocalFileEntryFactory()
+			factory := NewLocalFileEntryFactory(clock.New())
 			_, err := factory.Create(tc.name, state)
 			require.Equal(ErrInvalidName, err)
 		})
@@ -176,6 +178,7 @@ func TestFileEntry(t *testing.T) {
 		testLinkTo,
 		testDelete,
 		testDeleteFailsForPersistedFile,
+		testDeleteFailsForLeasedFile,
 		testGetMetadataAndSetMetadata,
 		testGetMetadataFail,
 		testSetMetadataAt,
@@ -468,6 +471,20 @@ func testDeleteFailsForPersistedFile(require *require.Assertions, bundle *fileEn
 	require.NoError(fe.Delete())
 }
 
+func testDeleteFailsForLeasedFile(require *require.Assertions, bundle *fileEntryTestBundle) {
+	fe := bundle.entry
+
+	_, err := fe.SetMetadata(metadata.NewLease(bundle.clk.Now().Add(time.Hour)))
+	require.NoError(err)
+
+	require.Equal(ErrFilePersisted, fe.Delete())
+
+	// Expired leases do not protect files.
+	bundle.clk.Add(time.Hour + time.Second)
+
+	require.NoError(fe.Delete())
+}
+
 func testGetMetadataAndSetMetadata(require *require.Assertions, bundle *fileEntryTestBundle) {
 	fe := bundle.entry
 
@@ -33,6 +33,7 @@ type FileMap interface {
 	LoadForRead(name string, f func(string, FileEntry)) bool
 	LoadForPeek(name string, f func(string, FileEntry)) bool
 	Delete(name string, f func(string, FileEntry) bool) bool
+	Names() []string
 }
 
 var _ FileMap = (*lruFileMap)(nil)
@@ -371,3 +372,16 @@ func (fm *lruFileMap) Delete(name string, f func(string, FileEntry) bool) bool {
 
 	return true
 }
+
+// Names returns the names of all entries in the map, ordered from least to
+// most recently accessed.
+func (fm *lruFileMap) Names() []string {
+	fm.Lock()
+	defer fm.Unlock()
+
+	names := make([]string, 0, len(fm.elements))
+	for e := fm.queue.Back(); e != nil; e = e.Prev() {
+		names = append(names, e.Value.(*fileEntryWithAccessTime).fe.GetName())
+	}
+	return names
+}
@@ -319,7 +319,7 @@ func TestLRUFileMapSizeLimit(t *testing.T) {
 	state := bundle.state1
 
 	insert := func(name string) {
-		entry, err := NewLocalFileEntryFactory().Create(name, state)
+		entry, err := NewLocalFileEntryFactory(clock.New()).Create(name, state)
 		require.NoError(err)
 		stored := fm.TryStore(name, entry, func(name string, entry FileEntry) bool {
 			require.NoError(entry.Create(state, 0))
@@ -347,6 +347,27 @@ func TestLRUFileMapSizeLimit(t *testing.T) {
 	require.False(fm.Contains(names[0]))
 }
 
+func TestLRUFileMapNamesOrderedByAccess(t *testing.T) {
+	require := require.New(t)
+	bundle, cleanup := fileStoreLRUFixture(100)
+	defer cleanup()
+
+	fm := NewLRUFileMap(100, clock.New())
+	state := bundle.state1
+
+	names := []string{"test_file_0", "test_file_1", "test_file_2"}
+	for _, name := range names {
+		entry, err := NewLocalFileEntryFactory(clock.New()).Create(name, state)
+		require.NoError(err)
+		require.True(fm.TryStore(name, entry, func(name string, entry FileEntry) bool {
+			require.NoError(entry.Create(state, 0))
+			return true
+		}))
+	}
+
+	require.Equal(names, fm.Names())
+}
+
 func TestLRUCreateLastAccessTimeOnCreateFile(t *testing.T) {
 	require := require.New(t)
 	bundle, cleanup := fileStoreLRUFixture(100)
@@ -24,6 +24,7 @@ type FileReader interface {
 	io.ReaderAt
 	io.Seeker
 	io.Closer
+	io.WriterTo
 	Size() int64
 }
 
@@ -32,6 +33,7 @@ type FileReadWriter interface {
 	FileReader
 	io.Writer
 	io.WriterAt
+	io.ReaderFrom
 
 	Cancel() error // required by docker registry.
 	Commit() error // required by docker registry.
@@ -139,6 +141,39 @@ func (readWriter localFileReadWriter) ReadAt(p []byte, offset int64) (int, error
 	return totalBytesRead, nil
 }
 
+// ReadFrom writes the contents of r to the File until EOF. Without a write part
+// size, copies from sockets and files are handed to the kernel via
+// splice/copy_file_range instead of going through a user space buffer.
+func (readWriter localFileReadWriter) ReadFrom(r io.Reader) (int64, error) {
+	if readWriter.writePartSize == 0 {
+		return readWriter.descriptor.ReadFrom(r)
+	}
+	// Hide ReadFrom from io.CopyBuffer so it does not recurse.
+	w := struct{ io.Writer }{readWriter}
+	return io.CopyBuffer(w, r, make([]byte, readWriter.writePartSize))
+}
+
+// WriteTo writes the contents of the File to w until EOF. Without a read part
+// size, copies to sockets and files are handed to the kernel via
+// sendfile/copy_file_range instead of going through a user space buffer.
+func (readWriter localFileReadWriter) WriteTo(w io.Writer) (int64, error) {
+	if readWriter.readPartSize == 0 {
+		return io.Copy(w, readWriter.descriptor)
+	}
+	// Hide WriteTo from io.CopyBuffer so it does not recurse.
+	r := struct{ io.Reader }{readWriter}
+	return io.CopyBuffer(w, r, make([]byte, readWriter.readPartSize))
+}
+
+// File returns the underlying os.File, unless reads are split into parts, such
+// that callers can hand it to the kernel, e.g. via sendfile.
+func (readWriter localFileReadWriter) File() (*os.File, bool) {
+	if readWriter.readPartSize != 0 {
+		return nil, false
+	}
+	return readWriter.descriptor, true
+}
+
 // Seek sets the offset for the next Read or Write on file to offset,
 // interpreted according to whence:
 // 0 means relative to the origin of the file;
@@ -0,0 +1,211 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package base
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func fileEntryFixture(t testing.TB) (FileEntry, func()) {
+	state, _, _, cleanup := fileStatesFixture()
+	entry, err := NewLocalFileEntryFactory(clock.New()).Create(core.DigestFixture().Hex(), state)
+	require.NoError(t, err)
+	require.NoError(t, entry.Create(state, 0))
+	return entry, cleanup
+}
+
+func TestFileReadWriterReadFromAndWriteTo(t *testing.T) {
+	for _, partSize := range []int{0, 7} {
+		t.Run(fmt.Sprintf("part_size=%d", partSize), func(t *testing.T) {
+			require := require.New(t)
+
+			entry, cleanup := fileEntryFixture(t)
+			defer cleanup()
+
+			content := randutil.Text(1000)
+
+			w, err := entry.GetReadWriter(partSize, partSize)
+			require.NoError(err)
+			n, err := w.ReadFrom(bytes.NewReader(content))
+			require.NoError(err)
+			require.Equal(int64(len(content)), n)
+			require.NoError(w.Close())
+
+			r, err := entry.GetReader(partSize)
+			require.NoError(err)
+			defer r.Close()
+			var out bytes.Buffer
+			n, err = r.WriteTo(&out)
+			require.NoError(err)
+			require.Equal(int64(len(content)), n)
+			require.Equal(content, out.Bytes())
+		})
+	}
+}
+
+func TestFileReadWriterCopyBetweenFiles(t *testing.T) {
+	require := require.New(t)
+
+	src, cleanup := fileEntryFixture(t)
+	defer cleanup()
+	dst, cleanup := fileEntryFixture(t)
+	defer cleanup()
+
+	content := randutil.Text(1000)
+
+	w, err := src.GetReadWriter(0, 0)
+	require.NoError(err)
+	_, err = w.Write(content)
+	require.NoError(err)
+	require.NoError(w.Close())
+
+	r, err := src.GetReader(0)
+	require.NoError(err)
+	defer r.Close()
+	w, err = dst.GetReadWriter(0, 0)
+	require.NoError(err)
+	defer w.Close()
+
+	// Skip the first bytes to make sure copies start at the current offset.
+	_, err = r.Seek(10, io.SeekStart)
+	require.NoError(err)
+	n, err := io.Copy(w, r)
+	require.NoError(err)
+	require.Equal(int64(len(content)-10), n)
+
+	result, err := ioutil.ReadFile(dst.GetPath())
+	require.NoError(err)
+	require.Equal(content[10:], result)
+}
+
+func TestFileReadWriterFile(t *testing.T) {
+	require := require.New(t)
+
+	entry, cleanup := fileEntryFixture(t)
+	defer cleanup()
+
+	r, err := entry.GetReader(0)
+	require.NoError(err)
+	defer r.Close()
+	f, ok := r.(interface{ File() (*os.File, bool) }).File()
+	require.True(ok)
+	require.Equal(entry.GetPath(), f.Name())
+
+	// Files read in parts must not be handed out.
+	r, err = entry.GetReader(7)
+	require.NoError(err)
+	defer r.Close()
+	_, ok = r.(interface{ File() (*os.File, bool) }).File()
+	require.False(ok)
+}
+
+// socketPair returns both ends of a loopback TCP connection.
+func socketPair(b *testing.B) (client, server net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer l.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, err := l.Accept()
+		require.NoError(b, err)
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", l.Addr().String())
+	require.NoError(b, err)
+	return client, <-accepted
+}
+
+// benchmarkCopy measures copies of size bytes between a file and a socket,
+// with the io.ReaderFrom and io.WriterTo fast paths enabled or hidden from
+// io.Copy.
+func benchmarkCopy(
+	b *testing.B,
+	size int,
+	copy func(f FileReadWriter, local, remote net.Conn, fast bool) error) {
+
+	for _, fast := range []bool{true, false} {
+		b.Run(fmt.Sprintf("fast=%t", fast), func(b *testing.B) {
+			entry, cleanup := fileEntryFixture(b)
+			defer cleanup()
+			local, remote := socketPair(b)
+			defer local.Close()
+			defer remote.Close()
+
+			f, err := entry.GetReadWriter(0, 0)
+			require.NoError(b, err)
+			defer f.Close()
+			_, err = f.Write(randutil.Text(uint64(size)))
+			require.NoError(b, err)
+
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := f.Seek(0, io.SeekStart)
+				require.NoError(b, err)
+				require.NoError(b, copy(f, local, remote, fast))
+			}
+		})
+	}
+}
+
+func BenchmarkFileReadWriterReadFromSocket(b *testing.B) {
+	size := 16 << 20
+	content := randutil.Text(uint64(size))
+	benchmarkCopy(b, size, func(f FileReadWriter, local, remote net.Conn, fast bool) error {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := remote.Write(content)
+			errc <- err
+		}()
+		var dst io.Writer = f
+		if !fast {
+			dst = struct{ io.Writer }{f}
+		}
+		if _, err := io.CopyN(dst, local, int64(size)); err != nil {
+			return err
+		}
+		return <-errc
+	})
+}
+
+func BenchmarkFileReadWriterWriteToSocket(b *testing.B) {
+	size := 16 << 20
+	benchmarkCopy(b, size, func(f FileReadWriter, local, remote net.Conn, fast bool) error {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := io.CopyN(ioutil.Discard, remote, int64(size))
+			errc <- err
+		}()
+		var src io.Reader = f
+		if !fast {
+			src = struct{ io.Reader }{f}
+		}
+		if _, err := io.Copy(local, src); err != nil {
+			return err
+		}
+		return <-errc
+	})
+}
@@ -20,6 +20,10 @@ import (
 // FileStore manages files and their metadata. Actual operations are done through FileOp.
 type FileStore interface {
 	NewFileOp() FileOp
+
+	// ListLoadedNames returns the names of all files currently loaded in
+	// memory, ordered from least to most recently accessed.
+	ListLoadedNames() []string
 }
 
 // localFileStore manages all agent files on local disk.
@@ -32,7 +36,7 @@ type localFileStore struct {
 func NewLocalFileStore(clk clock.Clock) FileStore {
 	m := NewLATFileMap(clk)
 	return &localFileStore{
-		fileEntryFactory: NewLocalFileEntryFactory(),
+		fileEntryFactory: NewLocalFileEntryFactory(clk),
 		fileMap:          m,
 	}
 }
@@ -44,7 +48,7 @@ func NewLocalFileStore(clk clock.Clock) FileStore {
 func NewCASFileStore(clk clock.Clock) FileStore {
 	m := NewLATFileMap(clk)
 	return &localFileStore{
-		fileEntryFactory: NewCASFileEntryFactory(),
+		fileEntryFactory: NewCASFileEntryFactory(clk),
 		fileMap:          m,
 	}
 }
@@ -54,7 +58,7 @@ func NewCASFileStore(clk clock.Clock) FileStore {
 func NewLRUFileStore(size int, clk clock.Clock) FileStore {
 	m := NewLRUFileMap(size, clk)
 	return &localFileStore{
-		fileEntryFactory: NewLocalFileEntryFactory(),
+		fileEntryFactory: NewLocalFileEntryFactory(clk),
 		fileMap:          m,
 	}
 }
@@ -68,7 +72,7 @@ func NewLRUFileStore(size int, clk clock.Clock) FileStore {
 func NewCASFileStoreWithLRUMap(size int, clk clock.Clock) FileStore {
 	m := NewLRUFileMap(size, clk)
 	return &localFileStore{
-		fileEntryFactory: NewCASFileEntryFactory(),
+		fileEntryFactory: NewCASFileEntryFactory(clk),
 		fileMap:          m,
 	}
 }
@@ -77,3 +81,8 @@ func NewCASFileStoreWithLRUMap(size int, clk clock.Clock) FileStore {
 func (s *localFileStore) NewFileOp() FileOp {
 	return NewLocalFileOp(s)
 }
+
+// ListLoadedNames returns the names of all files currently loaded in memory.
+func (s *localFileStore) ListLoadedNames() []string {
+	return s.fileMap.Names()
+}
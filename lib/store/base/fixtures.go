@@ -62,6 +62,7 @@ type fileEntryTestBundle struct {
 	state2 FileState
 	state3 FileState
 
+	clk   *clock.Mock
 	entry FileEntry
 }
 
@@ -71,7 +72,8 @@ func fileEntryLocalFixture() (bundle *fileEntryTestBundle, run func()) {
 
 	state1, state2, state3, f := fileStatesFixture()
 	cleanup.Add(f)
-	entry, err := NewLocalFileEntryFactory().Create(core.DigestFixture().Hex(), state1)
+	clk := clock.NewMock()
+	entry, err := NewLocalFileEntryFactory(clk).Create(core.DigestFixture().Hex(), state1)
 	if err != nil {
 		panic(fmt.Sprintf("create test file: %s", err))
 	}
@@ -80,6 +82,7 @@ func fileEntryLocalFixture() (bundle *fileEntryTestBundle, run func()) {
 		state1: state1,
 		state2: state2,
 		state3: state3,
+		clk:    clk,
 		entry:  entry,
 	}, cleanup.Run
 }
@@ -19,17 +19,42 @@ import (
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store/base"
 	"github.com/uber/kraken/lib/store/metadata"
 )
 
+// DigestMismatchError occurs when the content of a completed download does not
+// match its digest. Fatal is set if the store is configured to fail such
+// downloads rather than download them again.
+type DigestMismatchError struct {
+	Expected core.Digest
+	Computed core.Digest
+	Fatal    bool
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf(
+		"computed digest %s doesn't match expected value %s", e.Computed, e.Expected)
+}
+
+// IsDigestMismatch returns true if err is a DigestMismatchError.
+func IsDigestMismatch(err error) bool {
+	_, ok := err.(*DigestMismatchError)
+	return ok
+}
+
 // CADownloadStore allows simultaneously downloading and uploading
 // content-adddressable files.
 type CADownloadStore struct {
+	config        CADownloadStoreConfig
+	stats         tally.Scope
 	backend       base.FileStore
 	downloadState base.FileState
 	cacheState    base.FileState
 	cleanup       *cleanupManager
+	accesses      *accessCounter
+	access        *accessTracker
 	readPartSize  int
 	writePartSize int
 }
@@ -54,20 +79,36 @@ func NewCADownloadStore(config CADownloadStoreConfig, stats tally.Scope) (*CADow
 	if err != nil {
 		return nil, fmt.Errorf("new cleanup manager: %s", err)
 	}
-	cleanup.addJob(
+	accesses := newAccessCounter(stats, config.CacheCleanup.Eviction.Policy == EvictionLFU)
+	if err := cleanup.addJob(
 		"download",
 		config.DownloadCleanup,
-		backend.NewFileOp().AcceptState(downloadState))
-	cleanup.addJob(
+		backend.NewFileOp().AcceptState(downloadState),
+		nil); err != nil {
+		return nil, err
+	}
+	if err := cleanup.addJob(
 		"cache",
 		config.CacheCleanup,
-		backend.NewFileOp().AcceptState(cacheState))
+		backend.NewFileOp().AcceptState(cacheState),
+		accesses); err != nil {
+		return nil, err
+	}
+
+	var access *accessTracker
+	if config.AccessStats.Enabled {
+		access = newAccessTracker(config.AccessStats, clock.New(), stats)
+	}
 
 	return &CADownloadStore{
+		config:        config,
+		stats:         stats,
 		backend:       backend,
 		downloadState: downloadState,
 		cacheState:    cacheState,
 		cleanup:       cleanup,
+		accesses:      accesses,
+		access:        access,
 		readPartSize:  config.ReadPartSize,
 		writePartSize: config.WritePartSize,
 	}, nil
@@ -88,11 +129,55 @@ func (s *CADownloadStore) GetDownloadFileReadWriter(name string) (FileReadWriter
 	return s.backend.NewFileOp().AcceptState(s.downloadState).GetFileReadWriter(name, s.readPartSize, s.writePartSize)
 }
 
-// MoveDownloadFileToCache moves a download file to the cache.
+// MoveDownloadFileToCache verifies that the content of download file name
+// matches its digest and moves it to the cache. Returns DigestMismatchError
+// if verification fails, in which case the file is left in the download state.
 func (s *CADownloadStore) MoveDownloadFileToCache(name string) error {
+	if !s.config.SkipHashVerification {
+		if err := s.verify(name); err != nil {
+			return err
+		}
+	}
 	return s.backend.NewFileOp().AcceptState(s.downloadState).MoveFile(name, s.cacheState)
 }
 
+// verify checks that the content of download file name matches its digest.
+func (s *CADownloadStore) verify(name string) error {
+	expected, err := core.NewDigestFromName(name)
+	if err != nil {
+		return fmt.Errorf("new digest from file name: %s", err)
+	}
+	f, err := s.Download().GetFileReader(name)
+	if err != nil {
+		// Leave reporting missing or already committed files to MoveFile.
+		return nil
+	}
+	defer f.Close()
+	digester, err := core.NewDigesterForAlgo(expected.Algo())
+	if err != nil {
+		return fmt.Errorf("new digester: %s", err)
+	}
+	computed, err := digester.FromReader(f)
+	if err != nil {
+		return fmt.Errorf("calculate digest: %s", err)
+	}
+	if computed != expected {
+		s.stats.Counter("digest_mismatch").Inc(1)
+		return &DigestMismatchError{expected, computed, s.config.FailOnDigestMismatch}
+	}
+	return nil
+}
+
+// RecordCacheAccess records whether a read of cache file name was served from
+// the cache (hit) or required a download (miss). Hit ratios are only broken
+// down by popularity and recency if access stats are enabled.
+func (s *CADownloadStore) RecordCacheAccess(name string, hit bool) {
+	s.accesses.record(name, hit)
+	if s.access != nil {
+		s.access.record(name, hit)
+	}
+}
+
 // GetCacheFileReader gets a cache file reader. Implemented for compatibility with
 // other stores.
 func (s *CADownloadStore) GetCacheFileReader(name string) (FileReader, error) {
@@ -105,6 +190,63 @@ func (s *CADownloadStore) GetCacheFileStat(name string) (os.FileInfo, error) {
 	return s.Cache().GetFileStat(name)
 }
 
+// ListCacheFiles returns the names of all cache files.
+func (s *CADownloadStore) ListCacheFiles() ([]string, error) {
+	return s.backend.NewFileOp().AcceptState(s.cacheState).ListNames()
+}
+
+// PinCacheFile protects cache file name from eviction and deletion until it is
+// unpinned. Pins are kept in persist metadata, and thus survive restarts.
+func (s *CADownloadStore) PinCacheFile(name string) error {
+	_, err := s.Cache().SetMetadata(name, metadata.NewPersist(true))
+	return err
+}
+
+// UnpinCacheFile allows cache file name to be evicted again.
+func (s *CADownloadStore) UnpinCacheFile(name string) error {
+	if _, err := s.Cache().GetFileStat(name); err != nil {
+		return err
+	}
+	err := s.backend.NewFileOp().AcceptState(s.cacheState).DeleteFileMetadata(
+		name, &metadata.Persist{})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetCacheFileMetadata sets metadata md of cache file name.
+func (s *CADownloadStore) SetCacheFileMetadata(name string, md metadata.Metadata) (bool, error) {
+	return s.Cache().SetMetadata(name, md)
+}
+
+// DeleteCacheFileMetadata deletes metadata md of cache file name.
+func (s *CADownloadStore) DeleteCacheFileMetadata(name string, md metadata.Metadata) error {
+	return s.backend.NewFileOp().AcceptState(s.cacheState).DeleteFileMetadata(name, md)
+}
+
+// ListPinnedCacheFiles returns the names of all pinned cache files.
+func (s *CADownloadStore) ListPinnedCacheFiles() ([]string, error) {
+	names, err := s.ListCacheFiles()
+	if err != nil {
+		return nil, err
+	}
+	var pinned []string
+	for _, name := range names {
+		var persist metadata.Persist
+		if err := s.Cache().GetMetadata(name, &persist); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("get persist metadata of %s: %s", name, err)
+		}
+		if persist.Value {
+			pinned = append(pinned, name)
+		}
+	}
+	return pinned, nil
+}
+
 // InCacheError returns true for errors originating from file store operations
 // which do not accept files in cache state.
 func (s *CADownloadStore) InCacheError(err error) bool {
@@ -164,6 +306,11 @@ func (a *CADownloadStoreScope) GetFileReader(name string) (FileReader, error) {
 	return a.op.GetFileReader(name, a.store.readPartSize)
 }
 
+// GetFilePath returns the path of name on disk.
+func (a *CADownloadStoreScope) GetFilePath(name string) (string, error) {
+	return a.op.GetFilePath(name)
+}
+
 // GetFileStat returns file info for name.
 func (a *CADownloadStoreScope) GetFileStat(name string) (os.FileInfo, error) {
 	return a.op.GetFileStat(name)
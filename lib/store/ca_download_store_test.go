@@ -14,13 +14,17 @@
 package store
 
 import (
+	"fmt"
 	"os"
 	"sync"
 	"testing"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func TestCADownloadStoreDownloadAndDeleteFiles(t *testing.T) {
@@ -32,13 +36,13 @@ func TestCADownloadStoreDownloadAndDeleteFiles(t *testing.T) {
 	var names []string
 	var wg sync.WaitGroup
 	for i := 0; i < 100; i++ {
-		name := core.DigestFixture().Hex()
+		blob := core.NewBlobFixture()
+		name := blob.Digest.Hex()
 		names = append(names, name)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			require.NoError(s.CreateDownloadFile(name, 1))
-			require.NoError(s.MoveDownloadFileToCache(name))
+			require.NoError(RunDownload(s, blob.Digest, blob.Content))
 			require.NoError(s.Cache().DeleteFile(name))
 		}()
 	}
@@ -49,3 +53,93 @@ func TestCADownloadStoreDownloadAndDeleteFiles(t *testing.T) {
 		require.True(os.IsNotExist(err))
 	}
 }
+
+func TestCADownloadStoreMoveDownloadFileToCacheDigestMismatch(t *testing.T) {
+	for _, fatal := range []bool{false, true} {
+		t.Run(fmt.Sprintf("fatal=%t", fatal), func(t *testing.T) {
+			require := require.New(t)
+
+			var cleanup testutil.Cleanup
+			defer cleanup.Run()
+
+			config := CADownloadStoreConfig{
+				DownloadDir:          tempdir(&cleanup, "download"),
+				CacheDir:             tempdir(&cleanup, "cache"),
+				FailOnDigestMismatch: fatal,
+			}
+			stats := tally.NewTestScope("", nil)
+			s, err := NewCADownloadStore(config, stats)
+			require.NoError(err)
+			defer s.Close()
+
+			blob := core.NewBlobFixture()
+			d := core.DigestFixture()
+
+			err = RunDownload(s, d, blob.Content)
+			require.True(IsDigestMismatch(err))
+			require.Equal(&DigestMismatchError{d, blob.Digest, fatal}, err)
+
+			_, err = s.Download().GetFileStat(d.Hex())
+			require.NoError(err)
+
+			require.Equal(
+				int64(1),
+				stats.Snapshot().Counters()["digest_mismatch+module=cadownloadstore"].Value())
+		})
+	}
+}
+
+func TestCADownloadStoreSkipHashVerification(t *testing.T) {
+	require := require.New(t)
+
+	var cleanup testutil.Cleanup
+	defer cleanup.Run()
+
+	config := CADownloadStoreConfig{
+		DownloadDir:          tempdir(&cleanup, "download"),
+		CacheDir:             tempdir(&cleanup, "cache"),
+		SkipHashVerification: true,
+	}
+	s, err := NewCADownloadStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	d := core.DigestFixture()
+	require.NoError(RunDownload(s, d, core.NewBlobFixture().Content))
+
+	_, err = s.Cache().GetFileStat(d.Hex())
+	require.NoError(err)
+}
+
+func TestCADownloadStorePinCacheFile(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CADownloadStoreFixture()
+	defer cleanup()
+
+	blob1 := core.NewBlobFixture()
+	blob2 := core.NewBlobFixture()
+	require.NoError(RunDownload(s, blob1.Digest, blob1.Content))
+	require.NoError(RunDownload(s, blob2.Digest, blob2.Content))
+
+	require.NoError(s.PinCacheFile(blob1.Digest.Hex()))
+
+	pinned, err := s.ListPinnedCacheFiles()
+	require.NoError(err)
+	require.Equal([]string{blob1.Digest.Hex()}, pinned)
+
+	require.Equal(base.ErrFilePersisted, s.Cache().DeleteFile(blob1.Digest.Hex()))
+
+	require.NoError(s.UnpinCacheFile(blob1.Digest.Hex()))
+	// Unpinning is idempotent.
+	require.NoError(s.UnpinCacheFile(blob1.Digest.Hex()))
+
+	pinned, err = s.ListPinnedCacheFiles()
+	require.NoError(err)
+	require.Empty(pinned)
+
+	require.NoError(s.Cache().DeleteFile(blob1.Digest.Hex()))
+
+	require.True(os.IsNotExist(s.PinCacheFile(blob1.Digest.Hex())))
+	require.True(os.IsNotExist(s.UnpinCacheFile(blob1.Digest.Hex())))
+}
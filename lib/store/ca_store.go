@@ -35,7 +35,9 @@ type CAStore struct {
 
 	*uploadStore
 	*cacheStore
-	cleanup *cleanupManager
+	cleanup  *cleanupManager
+	index    *cacheIndex
+	accesses *accessCounter
 }
 
 // NewCAStore creates a new CAStore.
@@ -65,15 +67,42 @@ func NewCAStore(config CAStoreConfig, stats tally.Scope) (*CAStore, error) {
 	if err != nil {
 		return nil, fmt.Errorf("new cleanup manager: %s", err)
 	}
-	cleanup.addJob("upload", config.UploadCleanup, uploadStore.newFileOp())
-	cleanup.addJob("cache", config.CacheCleanup, cacheStore.newFileOp())
+	accesses := newAccessCounter(stats, config.CacheCleanup.Eviction.Policy == EvictionLFU)
+	if err := cleanup.addJob("upload", config.UploadCleanup, uploadStore.newFileOp(), nil); err != nil {
+		return nil, err
+	}
+	if err := cleanup.addJob("cache", config.CacheCleanup, cacheStore.newFileOp(), accesses); err != nil {
+		return nil, err
+	}
+
+	var index *cacheIndex
+	if config.CacheIndex.Enabled {
+		index = newCacheIndex(
+			config.CacheIndex, config.Capacity, clock.New(), stats, cacheBackend, cacheStore.newFileOp())
+		index.start()
+	}
+
+	return &CAStore{config, uploadStore, cacheStore, cleanup, index, accesses}, nil
+}
 
-	return &CAStore{config, uploadStore, cacheStore, cleanup}, nil
+// RecordCacheAccess records whether a read of cache file name was served from
+// the cache (hit) or required a download from the backend (miss).
+func (s *CAStore) RecordCacheAccess(name string, hit bool) {
+	s.accesses.record(name, hit)
+}
+
+// SetCacheCleanupStagger extends the TTI and TTL of each cache file by the
+// duration returned by f during periodic cleanup.
+func (s *CAStore) SetCacheCleanupStagger(f StaggerFunc) {
+	s.cleanup.setStagger("cache", f)
 }
 
 // Close terminates any goroutines started by s.
 func (s *CAStore) Close() {
 	s.cleanup.stop()
+	if s.index != nil {
+		s.index.stop()
+	}
 }
 
 // MoveUploadFileToCache commits uploadName as cacheName. Clients are expected
@@ -130,17 +159,48 @@ func (s *CAStore) WriteCacheFile(name string, write func(w FileReadWriter) error
 	return nil
 }
 
-// verify verifies that name is a valid SHA256 digest, and checks if the given
+// LinkFileToCache commits the file at path, which is not managed by s, as
+// cacheName without copying it. The file is verified and then hard linked into
+// the cache, so path must be on the same filesystem as the cache and is left
+// in place.
+func (s *CAStore) LinkFileToCache(path, cacheName string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := s.verify(f, cacheName); err != nil {
+		return fmt.Errorf("verify digest: %s", err)
+	}
+	tmp := fmt.Sprintf("%s.%s", path, uuid.Generate().String())
+	if err := os.Link(path, tmp); err != nil {
+		return fmt.Errorf("link: %s", err)
+	}
+	defer os.Remove(tmp)
+
+	return s.cacheStore.newFileOp().MoveFileFrom(cacheName, s.cacheStore.state, tmp)
+}
+
+// verify verifies that name is a valid digest name, and checks if the given
 // blob content matches the digset unless explicitly skipped.
 func (s *CAStore) verify(r io.Reader, name string) error {
-	// Verify that expected name is a valid SHA256 digest.
-	expected, err := core.NewSHA256DigestFromHex(name)
+	return verifyContent(r, name, s.config.SkipHashVerification)
+}
+
+// verifyContent verifies that name is a valid digest name, and checks if the
+// given blob content matches the digest unless skipHash is set.
+func verifyContent(r io.Reader, name string, skipHash bool) error {
+	// Verify that expected name is a valid digest name.
+	expected, err := core.NewDigestFromName(name)
 	if err != nil {
 		return fmt.Errorf("new digest from file name: %s", err)
 	}
 
-	if !s.config.SkipHashVerification {
-		digester := core.NewDigester()
+	if !skipHash {
+		digester, err := core.NewDigesterForAlgo(expected.Algo())
+		if err != nil {
+			return fmt.Errorf("new digester: %s", err)
+		}
 		computed, err := digester.FromReader(r)
 		if err != nil {
 			return fmt.Errorf("calculate digest: %s", err)
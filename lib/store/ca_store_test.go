@@ -14,6 +14,7 @@
 package store
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -198,6 +199,27 @@ func TestCAStoreCreateUploadFileAndMoveToCacheFailure(t *testing.T) {
 	require.True(os.IsNotExist(err))
 }
 
+func TestCAStoreVerifiesDigestsOfAnyAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+
+	blob := core.SizedBlobFixtureForAlgo(32, 4, core.SHA512)
+	name := blob.Digest.Name()
+
+	// Blobs are sharded by the hex of their digest.
+	require.NoError(s.CreateCacheFile(name, bytes.NewReader(blob.Content)))
+	_, err = os.Stat(path.Join(config.CacheDir, name[:2], name[2:4], name))
+	require.NoError(err)
+
+	other := core.SizedBlobFixtureForAlgo(32, 4, core.SHA512)
+	require.Error(s.CreateCacheFile(other.Digest.Name(), bytes.NewReader(blob.Content)))
+}
+
 func TestCAStoreCreateCacheFile(t *testing.T) {
 	require := require.New(t)
 
@@ -216,3 +238,35 @@ func TestCAStoreCreateCacheFile(t *testing.T) {
 	b2, err := ioutil.ReadAll(r2)
 	require.Equal(s1, string(b2))
 }
+
+func TestCAStoreLinkFileToCache(t *testing.T) {
+	require := require.New(t)
+
+	s, cleanup := CAStoreFixture()
+	defer cleanup()
+
+	blob := core.NewBlobFixture()
+
+	dir, err := ioutil.TempDir(s.config.UploadDir, "link")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	p := path.Join(dir, "blob")
+	require.NoError(ioutil.WriteFile(p, blob.Content, 0644))
+
+	require.Error(s.LinkFileToCache(p, core.DigestFixture().Hex()))
+
+	require.NoError(s.LinkFileToCache(p, blob.Digest.Hex()))
+	require.True(os.IsExist(s.LinkFileToCache(p, blob.Digest.Hex())))
+
+	r, err := s.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+
+	// The source file is left in place.
+	_, err = os.Stat(p)
+	require.NoError(err)
+}
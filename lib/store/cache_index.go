@@ -0,0 +1,301 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+const _cacheIndexHeader = "kraken-cache-index v1"
+
+// CacheIndexConfig defines configuration for the persisted cache index, which
+// records the cache files loaded in memory so they can be warmed up in the
+// background after a restart.
+type CacheIndexConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Path of the index file. Defaults to "<cache_dir>.index".
+	Path string `yaml:"path"`
+
+	// QuarantineDir is where corrupted metadata files found during warm up are
+	// moved to. Defaults to "<cache_dir>.quarantine".
+	QuarantineDir string `yaml:"quarantine_dir"`
+
+	// PersistInterval is how often the index is written to disk. The index is
+	// also written when the store is closed.
+	PersistInterval time.Duration `yaml:"persist_interval"`
+}
+
+func (c CacheIndexConfig) applyDefaults(cacheDir string) CacheIndexConfig {
+	if c.Path == "" {
+		c.Path = filepath.Clean(cacheDir) + ".index"
+	}
+	if c.QuarantineDir == "" {
+		c.QuarantineDir = filepath.Clean(cacheDir) + ".quarantine"
+	}
+	if c.PersistInterval == 0 {
+		c.PersistInterval = 10 * time.Minute
+	}
+	return c
+}
+
+// cacheIndex warms up the in-memory cache file map from a persisted list of
+// names, verifying each file and its metadata in the background, and
+// periodically persists the list of loaded names.
+type cacheIndex struct {
+	config   CacheIndexConfig
+	capacity int
+	clk      clock.Clock
+	stats    tally.Scope
+	backend  base.FileStore
+	op       base.FileOp
+
+	warmed   chan struct{}
+	stopOnce sync.Once
+	stopc    chan struct{}
+	done     chan struct{}
+}
+
+func newCacheIndex(
+	config CacheIndexConfig,
+	capacity int,
+	clk clock.Clock,
+	stats tally.Scope,
+	backend base.FileStore,
+	op base.FileOp) *cacheIndex {
+
+	return &cacheIndex{
+		config:   config,
+		capacity: capacity,
+		clk:      clk,
+		stats:    stats.SubScope("cache_index"),
+		backend:  backend,
+		op:       op,
+		warmed:   make(chan struct{}),
+		stopc:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// start warms up the cache in the background, then persists the index every
+// PersistInterval until stop is called.
+func (i *cacheIndex) start() {
+	go func() {
+		defer close(i.done)
+
+		if !i.warm() {
+			return
+		}
+		close(i.warmed)
+
+		ticker := i.clk.Ticker(i.config.PersistInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := i.persist(); err != nil {
+					log.Errorf("Error persisting cache index: %s", err)
+				}
+			case <-i.stopc:
+				return
+			}
+		}
+	}()
+}
+
+// stop interrupts warm up and persists the index one last time. If warm up
+// did not finish, the index is left untouched so the next start up does not
+// lose the files which were not yet loaded.
+func (i *cacheIndex) stop() {
+	i.stopOnce.Do(func() {
+		close(i.stopc)
+		<-i.done
+		select {
+		case <-i.warmed:
+		default:
+			return
+		}
+		if err := i.persist(); err != nil {
+			log.Errorf("Error persisting cache index: %s", err)
+		}
+	})
+}
+
+// warm loads every file in the index into memory, from least to most recently
+// accessed. Falls back to listing the cache directory if the index is missing
+// or corrupted. Returns false if interrupted by stop.
+func (i *cacheIndex) warm() bool {
+	start := i.clk.Now()
+
+	names, err := i.load()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			i.stats.Counter("load_errors").Inc(1)
+			log.Errorf("Error loading cache index, falling back to directory walk: %s", err)
+		}
+		names, err = i.op.ListNames()
+		if err != nil {
+			log.Errorf("Error listing cache files: %s", err)
+			return true
+		}
+		if i.capacity > 0 && len(names) > i.capacity {
+			// Loading more files than capacity would evict them from disk.
+			names = names[:i.capacity]
+		}
+	}
+
+	var loaded int
+	for _, name := range names {
+		select {
+		case <-i.stopc:
+			return false
+		default:
+		}
+		if i.verify(name) {
+			loaded++
+		}
+	}
+	i.stats.Counter("warmed").Inc(int64(loaded))
+	i.stats.Timer("warm_time").Record(i.clk.Now().Sub(start))
+	log.Infof("Warmed up %d of %d cache files in %s", loaded, len(names), i.clk.Now().Sub(start))
+	return true
+}
+
+// verify loads name into memory and checks its metadata can be read,
+// quarantining any which cannot. Returns false if name could not be loaded.
+func (i *cacheIndex) verify(name string) bool {
+	if _, err := i.op.GetFileStat(name); err != nil {
+		if !os.IsNotExist(err) {
+			log.With("name", name).Errorf("Error loading cache file: %s", err)
+		}
+		return false
+	}
+
+	// Metadata must not be read inside RangeFileMetadata, which holds the
+	// entry lock.
+	var mds []metadata.Metadata
+	if err := i.op.RangeFileMetadata(name, func(md metadata.Metadata) error {
+		mds = append(mds, md)
+		return nil
+	}); err != nil {
+		log.With("name", name).Errorf("Error listing cache file metadata: %s", err)
+		return true
+	}
+	for _, md := range mds {
+		err := i.op.GetFileMetadata(name, md)
+		if err == nil || os.IsNotExist(err) {
+			continue
+		}
+		log.With("name", name, "metadata", md.GetSuffix()).Errorf(
+			"Quarantining corrupted metadata: %s", err)
+		if err := i.quarantine(name, md); err != nil {
+			log.With("name", name, "metadata", md.GetSuffix()).Errorf(
+				"Error quarantining metadata: %s", err)
+			continue
+		}
+		i.stats.Counter("quarantined").Inc(1)
+	}
+	return true
+}
+
+// quarantine moves the metadata file md of name into QuarantineDir and removes
+// md from the cache file.
+func (i *cacheIndex) quarantine(name string, md metadata.Metadata) error {
+	p, err := i.op.GetFilePath(name)
+	if err != nil {
+		return fmt.Errorf("get file path: %s", err)
+	}
+	dir := filepath.Join(i.config.QuarantineDir, name)
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+	src := filepath.Join(filepath.Dir(p), md.GetSuffix())
+	if err := os.Rename(src, filepath.Join(dir, md.GetSuffix())); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	if err := i.op.DeleteFileMetadata(name, md); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("delete metadata: %s", err)
+	}
+	return nil
+}
+
+// load reads the names in the index file.
+func (i *cacheIndex) load() ([]string, error) {
+	f, err := os.Open(i.config.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != _cacheIndexHeader {
+		return nil, fmt.Errorf("invalid header")
+	}
+	var names []string
+	for scanner.Scan() {
+		if name := scanner.Text(); name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %s", err)
+	}
+	return names, nil
+}
+
+// persist atomically writes the names of all loaded cache files to the index
+// file.
+func (i *cacheIndex) persist() error {
+	names := i.backend.ListLoadedNames()
+
+	if err := os.MkdirAll(filepath.Dir(i.config.Path), 0775); err != nil {
+		return fmt.Errorf("mkdir: %s", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(i.config.Path), filepath.Base(i.config.Path))
+	if err != nil {
+		return fmt.Errorf("create tmp file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintln(w, _cacheIndexHeader)
+	for _, name := range names {
+		fmt.Fprintln(w, name)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), i.config.Path); err != nil {
+		return fmt.Errorf("rename: %s", err)
+	}
+	i.stats.Gauge("persisted").Update(float64(len(names)))
+	return nil
+}
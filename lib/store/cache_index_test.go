@@ -0,0 +1,124 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+func cacheIndexConfigFixture(t *testing.T) (CAStoreConfig, func()) {
+	config, cleanup := CAStoreConfigFixture()
+	dir, err := ioutil.TempDir("", "cache_index")
+	require.NoError(t, err)
+	config.CacheIndex = CacheIndexConfig{
+		Enabled:       true,
+		Path:          filepath.Join(dir, "index"),
+		QuarantineDir: filepath.Join(dir, "quarantine"),
+	}
+	return config, func() {
+		os.RemoveAll(dir)
+		cleanup()
+	}
+}
+
+func newWarmedCAStore(t *testing.T, config CAStoreConfig) *CAStore {
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(t, err)
+	<-s.index.warmed
+	return s
+}
+
+func TestCacheIndexRestoresLoadedFiles(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := cacheIndexConfigFixture(t)
+	defer cleanup()
+
+	s := newWarmedCAStore(t, config)
+	var names []string
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+		names = append(names, blob.Digest.Hex())
+	}
+	s.Close()
+
+	b, err := ioutil.ReadFile(config.CacheIndex.Path)
+	require.NoError(err)
+	require.Contains(string(b), _cacheIndexHeader)
+
+	s = newWarmedCAStore(t, config)
+	defer s.Close()
+
+	require.ElementsMatch(names, s.cacheStore.backend.ListLoadedNames())
+}
+
+func TestCacheIndexQuarantinesCorruptedMetadata(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := cacheIndexConfigFixture(t)
+	defer cleanup()
+
+	s := newWarmedCAStore(t, config)
+	blob := core.NewBlobFixture()
+	name := blob.Digest.Hex()
+	require.NoError(s.CreateCacheFile(name, bytes.NewReader(blob.Content)))
+	_, err := s.SetCacheFileMetadata(name, metadata.NewPersist(true))
+	require.NoError(err)
+	p, err := s.cacheStore.newFileOp().GetFilePath(name)
+	require.NoError(err)
+	s.Close()
+
+	mdPath := filepath.Join(filepath.Dir(p), metadata.NewPersist(false).GetSuffix())
+	require.NoError(ioutil.WriteFile(mdPath, []byte("garbage"), 0775))
+
+	s = newWarmedCAStore(t, config)
+	defer s.Close()
+
+	_, err = s.GetCacheFileStat(name)
+	require.NoError(err)
+	require.True(os.IsNotExist(s.GetCacheFileMetadata(name, metadata.NewPersist(false))))
+
+	_, err = os.Stat(filepath.Join(
+		config.CacheIndex.QuarantineDir, name, metadata.NewPersist(false).GetSuffix()))
+	require.NoError(err)
+}
+
+func TestCacheIndexFallsBackToDirectoryWalk(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := cacheIndexConfigFixture(t)
+	defer cleanup()
+
+	s := newWarmedCAStore(t, config)
+	blob := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	s.Close()
+
+	require.NoError(ioutil.WriteFile(config.CacheIndex.Path, []byte("corrupted"), 0775))
+
+	s = newWarmedCAStore(t, config)
+	defer s.Close()
+
+	require.Equal([]string{blob.Digest.Hex()}, s.cacheStore.backend.ListLoadedNames())
+}
@@ -65,6 +65,10 @@ func (s *cacheStore) DeleteCacheFileMetadata(name string, md metadata.Metadata)
 	return s.newFileOp().DeleteFileMetadata(name, md)
 }
 
+func (s *cacheStore) RangeCacheFileMetadata(name string, f func(metadata.Metadata) error) error {
+	return s.newFileOp().RangeFileMetadata(name, f)
+}
+
 func (s *cacheStore) ListCacheFiles() ([]string, error) {
 	return s.newFileOp().ListNames()
 }
@@ -15,6 +15,7 @@ package store
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"sync"
 	"time"
@@ -36,11 +37,40 @@ type CleanupConfig struct {
 	TTL                 time.Duration `yaml:"ttl"`                  // Time to live regardless of access. If 0, disables TTL.
 	AggressiveThreshold int           `yaml:"aggressive_threshold"` // The disk util threshold to trigger aggressive cleanup. If 0, disables aggressive cleanup.
 	AggressiveTTL       time.Duration `yaml:"aggressive_ttL"`       // Time to live regardless of access if aggressive cleanup is triggered.
+
+	// ScanWindow spreads the file checks and deletions of each scan evenly
+	// over the window instead of walking all files at once. Should be less
+	// than Interval. If 0, scans are not spread.
+	ScanWindow    time.Duration `yaml:"scan_window"`
+	ScanBatchSize int           `yaml:"scan_batch_size"` // Number of files checked between pauses.
+
+	// MaxDeletesPerSecond limits the rate of deletions. If 0, deletions are
+	// not rate limited.
+	MaxDeletesPerSecond int `yaml:"max_deletes_per_second"`
+
+	// IOUtilThreshold is the disk IO utilization (percentage of time the disk
+	// is busy) at or above which scans pause between batches, for at most
+	// IOMaxBackoff per batch. If 0, disables IO-aware throttling.
+	IOUtilThreshold int           `yaml:"io_util_threshold"`
+	IODevice        string        `yaml:"io_device"` // Device to sample IO utilization of. If empty, the busiest device is used.
+	IOBackoff       time.Duration `yaml:"io_backoff"`
+	IOMaxBackoff    time.Duration `yaml:"io_max_backoff"`
+
+	// Eviction selects which files are evicted by each scan.
+	Eviction EvictionConfig `yaml:"eviction"`
 }
 
+// StaggerFunc returns the extra duration the file name must be idle or alive
+// for before it is cleaned up. Useful for spreading out the deletion of a
+// file which is replicated across multiple hosts.
+type StaggerFunc func(name string) time.Duration
+
 type (
 	// Define a func type for mocking diskSpaceUtil function.
 	diskSpaceUtilFunc func() (int, error)
+
+	// Define a func type for mocking disk IO utilization sampling.
+	ioUtilFunc func() (int, error)
 )
 
 func (c CleanupConfig) applyDefaults() CleanupConfig {
@@ -56,13 +86,26 @@ func (c CleanupConfig) applyDefaults() CleanupConfig {
 			c.AggressiveTTL = 1 * time.Hour
 		}
 	}
+	if c.ScanBatchSize == 0 {
+		c.ScanBatchSize = 100
+	}
+	if c.IOBackoff == 0 {
+		c.IOBackoff = time.Second
+	}
+	if c.IOMaxBackoff == 0 {
+		c.IOMaxBackoff = 30 * time.Second
+	}
 
 	return c
 }
 
+// _evictionIdleBuckets range from one minute to roughly three weeks.
+var _evictionIdleBuckets = tally.MustMakeExponentialDurationBuckets(time.Minute, 2, 16)
+
 type cleanupManager struct {
 	clk      clock.Clock
 	stats    tally.Scope
+	staggers sync.Map // Job tag -> StaggerFunc.
 	stopOnce sync.Once
 	stopc    chan struct{}
 }
@@ -85,12 +128,15 @@ func newCleanupManager(clk clock.Clock, stats tally.Scope) (*cleanupManager, err
 
 // addJob starts a background cleanup task which removes idle files from op based
 // on the settings in config. op must set the desired states to clean before addJob
-// is called.
-func (m *cleanupManager) addJob(tag string, config CleanupConfig, op base.FileOp) {
+// is called. accesses records accesses of the files in op, and may be nil if
+// they are not cache files.
+func (m *cleanupManager) addJob(
+	tag string, config CleanupConfig, op base.FileOp, accesses *accessCounter) error {
+
 	config = config.applyDefaults()
 	if config.Disabled {
 		log.Warnf("Cleanup disabled for %s", op)
-		return
+		return nil
 	}
 	if config.TTL == 0 {
 		log.Warnf("TTL disabled for %s", op)
@@ -100,9 +146,21 @@ func (m *cleanupManager) addJob(tag string, config CleanupConfig, op base.FileOp
 		log.Warnf("Aggressive cleanup disabled for %s", op)
 	}
 
+	policy, err := newEvictionPolicy(config.Eviction, accesses)
+	if err != nil {
+		return fmt.Errorf("%s eviction policy: %s", tag, err)
+	}
+
 	ticker := m.clk.Ticker(config.Interval)
 
-	usageGauge := m.stats.Tagged(map[string]string{"job": tag}).Gauge("disk_usage")
+	stats := m.stats.Tagged(map[string]string{"job": tag})
+	usageGauge := stats.Gauge("disk_usage")
+
+	var ioUtil ioUtilFunc
+	if config.IOUtilThreshold != 0 {
+		ioUtil = diskspaceutil.NewIOUtilSampler(config.IODevice).Sample
+	}
+	p := m.newPacer(stats, config, ioUtil)
 
 	go func() {
 		for {
@@ -110,7 +168,7 @@ func (m *cleanupManager) addJob(tag string, config CleanupConfig, op base.FileOp
 			case <-ticker.C:
 				log.Debugf("Performing cleanup of %s", op)
 				ttl := m.checkAggressiveCleanup(op, config, diskspaceutil.DiskSpaceUtil)
-				usage, err := m.scan(op, config.TTI, ttl)
+				usage, err := m.scan(op, config.TTI, ttl, m.getStagger(tag), policy, p, stats)
 				if err != nil {
 					log.Errorf("Error scanning %s: %s", op, err)
 				}
@@ -121,57 +179,140 @@ func (m *cleanupManager) addJob(tag string, config CleanupConfig, op base.FileOp
 			}
 		}
 	}()
+
+	return nil
+}
+
+// setStagger staggers the deletion of files in the job identified by tag. May be
+// called after the job has started, in which case it applies from the next
+// scan onwards.
+func (m *cleanupManager) setStagger(tag string, f StaggerFunc) {
+	m.staggers.Store(tag, f)
+}
+
+func (m *cleanupManager) getStagger(tag string) StaggerFunc {
+	f, ok := m.staggers.Load(tag)
+	if !ok {
+		return nil
+	}
+	return f.(StaggerFunc)
 }
 
 func (m *cleanupManager) stop() {
 	m.stopOnce.Do(func() { close(m.stopc) })
 }
 
-// scan scans the op for idle or expired files. Also returns the total disk usage
-// of op.
+// scan scans the op for files to evict according to policy, pacing the scan
+// with p. If stagger is non-nil, it extends tti and ttl per file. The idle time
+// of each evicted file is recorded in stats. Also returns the total disk usage
+// of op before eviction.
 func (m *cleanupManager) scan(
-	op base.FileOp, tti time.Duration, ttl time.Duration) (usage int64, err error) {
+	op base.FileOp,
+	tti time.Duration,
+	ttl time.Duration,
+	stagger StaggerFunc,
+	policy EvictionPolicy,
+	p *pacer,
+	stats tally.Scope) (usage int64, err error) {
+
+	evictionIdleTime := stats.Histogram("eviction_idle_time", _evictionIdleBuckets)
+
+	evict := func(c EvictionCandidate, reason string) (bool, error) {
+		if err := p.delete(); err != nil {
+			return false, err
+		}
+		if err := op.DeleteFile(c.Name); err != nil {
+			if err != base.ErrFilePersisted {
+				log.With("name", c.Name).Errorf("Error deleting %s file: %s", reason, err)
+			}
+			return false, nil
+		}
+		evictionIdleTime.RecordDuration(c.Idle)
+		reasonStats := stats.Tagged(map[string]string{"reason": reason})
+		reasonStats.Counter("evictions").Inc(1)
+		reasonStats.Counter("evicted_bytes").Inc(c.Size)
+		return true, nil
+	}
 
 	names, err := op.ListNames()
 	if err != nil {
 		return 0, fmt.Errorf("list names: %s", err)
 	}
-	for _, name := range names {
-		info, err := op.GetFileStat(name)
+	p.start(len(names))
+	var retained []EvictionCandidate
+	for i, name := range names {
+		if err := p.next(i); err != nil {
+			return usage, err
+		}
+		c, err := m.newEvictionCandidate(op, name, tti, ttl, stagger)
 		if err != nil {
 			log.With("name", name).Errorf("Error getting file stat: %s", err)
 			continue
 		}
-		if ready, err := m.readyForDeletion(op, name, info, tti, ttl); err != nil {
-			log.With("name", name).Errorf("Error checking if file expired: %s", err)
-		} else if ready {
-			if err := op.DeleteFile(name); err != nil && err != base.ErrFilePersisted {
-				log.With("name", name).Errorf("Error deleting expired file: %s", err)
+		usage += c.Size
+		if policy.Expired(c) {
+			if _, err := evict(c, "expired"); err != nil {
+				return usage, err
 			}
+		} else {
+			retained = append(retained, c)
+		}
+	}
+
+	ordered, excess := policy.Overflow(retained)
+	for _, c := range ordered {
+		if excess <= 0 {
+			break
+		}
+		if ok, err := evict(c, "over_capacity"); err != nil {
+			return usage, err
+		} else if ok {
+			excess -= c.Size
 		}
-		usage += info.Size()
 	}
 	return usage, nil
 }
 
-func (m *cleanupManager) readyForDeletion(
+// newEvictionCandidate describes name for eviction. Files without a last access
+// time are considered idle since they were last modified.
+func (m *cleanupManager) newEvictionCandidate(
 	op base.FileOp,
 	name string,
-	info os.FileInfo,
 	tti time.Duration,
-	ttl time.Duration) (bool, error) {
+	ttl time.Duration,
+	stagger StaggerFunc) (EvictionCandidate, error) {
 
-	if ttl > 0 && m.clk.Now().Sub(info.ModTime()) > ttl {
-		return true, nil
+	info, err := op.GetFileStat(name)
+	if err != nil {
+		return EvictionCandidate{}, err
+	}
+	if stagger != nil {
+		delay := stagger(name)
+		tti += delay
+		if ttl > 0 {
+			ttl += delay
+		}
+	}
+	now := m.clk.Now()
+	c := EvictionCandidate{
+		Name: name,
+		Size: info.Size(),
+		Age:  now.Sub(info.ModTime()),
+		TTI:  tti,
+		TTL:  ttl,
 	}
-
 	var lat metadata.LastAccessTime
 	if err := op.GetFileMetadata(name, &lat); os.IsNotExist(err) {
-		return false, nil
+		c.Idle = c.Age
 	} else if err != nil {
-		return false, fmt.Errorf("get file lat: %s", err)
+		// Only evict the file once its TTL expires.
+		log.With("name", name).Errorf("Error getting file lat: %s", err)
+		c.Idle = c.Age
+		c.TTI = math.MaxInt64
+	} else {
+		c.Idle = now.Sub(lat.Time)
 	}
-	return m.clk.Now().Sub(lat.Time) > tti, nil
+	return c, nil
 }
 
 func (m *cleanupManager) checkAggressiveCleanup(op base.FileOp, config CleanupConfig, util diskSpaceUtilFunc) time.Duration {
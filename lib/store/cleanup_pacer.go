@@ -0,0 +1,127 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+var errCleanupStopped = errors.New("cleanup manager stopped")
+
+// pacer spreads the work of a cleanup scan over time and backs off while disk
+// IO utilization is high, such that cleanup does not compete with serving
+// traffic for disk IO.
+type pacer struct {
+	clk    clock.Clock
+	stats  tally.Scope
+	config CleanupConfig
+	ioUtil ioUtilFunc
+	stopc  <-chan struct{}
+
+	batchDelay time.Duration
+	lastDelete time.Time
+}
+
+func (m *cleanupManager) newPacer(stats tally.Scope, config CleanupConfig, ioUtil ioUtilFunc) *pacer {
+	return &pacer{
+		clk:    m.clk,
+		stats:  stats,
+		config: config.applyDefaults(),
+		ioUtil: ioUtil,
+		stopc:  m.stopc,
+	}
+}
+
+// start prepares p for a scan of n files.
+func (p *pacer) start(n int) {
+	p.batchDelay = 0
+	if p.config.ScanWindow > 0 && n > 0 {
+		batches := (n + p.config.ScanBatchSize - 1) / p.config.ScanBatchSize
+		p.batchDelay = p.config.ScanWindow / time.Duration(batches)
+	}
+	if p.ioUtil != nil {
+		// Resets the utilization baseline such that samples during the scan
+		// do not include the idle time since the previous scan.
+		p.ioUtil()
+	}
+}
+
+// next blocks before the i-th file of a scan is checked, if i starts a new
+// batch.
+func (p *pacer) next(i int) error {
+	if i == 0 || i%p.config.ScanBatchSize != 0 {
+		return nil
+	}
+	if p.batchDelay > 0 {
+		if err := p.sleep(p.batchDelay); err != nil {
+			return err
+		}
+	}
+	return p.waitForIO()
+}
+
+// delete blocks until a deletion is allowed under the configured rate limit.
+func (p *pacer) delete() error {
+	if p.config.MaxDeletesPerSecond <= 0 {
+		return nil
+	}
+	next := p.lastDelete.Add(time.Second / time.Duration(p.config.MaxDeletesPerSecond))
+	if wait := next.Sub(p.clk.Now()); wait > 0 {
+		if err := p.sleep(wait); err != nil {
+			return err
+		}
+	}
+	p.lastDelete = p.clk.Now()
+	return nil
+}
+
+// waitForIO blocks while disk IO utilization is at or above the configured
+// threshold, for at most IOMaxBackoff.
+func (p *pacer) waitForIO() error {
+	if p.ioUtil == nil || p.config.IOUtilThreshold == 0 {
+		return nil
+	}
+	var waited time.Duration
+	for waited < p.config.IOMaxBackoff {
+		util, err := p.ioUtil()
+		if err != nil {
+			log.Errorf("Error sampling disk io util: %s", err)
+			return nil
+		}
+		if util < p.config.IOUtilThreshold {
+			return nil
+		}
+		p.stats.Counter("io_throttled").Inc(1)
+		if err := p.sleep(p.config.IOBackoff); err != nil {
+			return err
+		}
+		waited += p.config.IOBackoff
+	}
+	return nil
+}
+
+func (p *pacer) sleep(d time.Duration) error {
+	select {
+	case <-p.clk.After(d):
+		return nil
+	case <-p.stopc:
+		return errCleanupStopped
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestPacerSpreadsScanOverWindow(t *testing.T) {
+	require := require.New(t)
+
+	m, err := newCleanupManager(clock.New(), tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	p := m.newPacer(tally.NoopScope, CleanupConfig{
+		ScanWindow:    100 * time.Millisecond,
+		ScanBatchSize: 10,
+	}, nil)
+
+	start := time.Now()
+	p.start(50)
+	for i := 0; i < 50; i++ {
+		require.NoError(p.next(i))
+	}
+	// 5 batches pause 20ms between each other.
+	require.True(time.Since(start) >= 80*time.Millisecond)
+}
+
+func TestPacerLimitsDeletes(t *testing.T) {
+	require := require.New(t)
+
+	m, err := newCleanupManager(clock.New(), tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	p := m.newPacer(tally.NoopScope, CleanupConfig{MaxDeletesPerSecond: 100}, nil)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		require.NoError(p.delete())
+	}
+	require.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestPacerBacksOffWhileIOBusy(t *testing.T) {
+	require := require.New(t)
+
+	m, err := newCleanupManager(clock.New(), tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	utils := []int{0, 90, 85, 10}
+	ioUtil := func() (int, error) {
+		util := utils[0]
+		utils = utils[1:]
+		return util, nil
+	}
+
+	stats := tally.NewTestScope("", nil)
+	p := m.newPacer(stats, CleanupConfig{
+		ScanBatchSize:   1,
+		IOUtilThreshold: 80,
+		IOBackoff:       time.Millisecond,
+	}, ioUtil)
+
+	p.start(2)
+	require.NoError(p.next(0))
+	require.NoError(p.next(1))
+	require.Empty(utils)
+	require.Equal(int64(2), stats.Snapshot().Counters()["io_throttled+"].Value())
+}
+
+func TestPacerIOBackoffIsBounded(t *testing.T) {
+	require := require.New(t)
+
+	m, err := newCleanupManager(clock.New(), tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	var samples int
+	ioUtil := func() (int, error) {
+		samples++
+		return 100, nil
+	}
+
+	p := m.newPacer(tally.NoopScope, CleanupConfig{
+		ScanBatchSize:   1,
+		IOUtilThreshold: 80,
+		IOBackoff:       time.Millisecond,
+		IOMaxBackoff:    5 * time.Millisecond,
+	}, ioUtil)
+
+	p.start(2)
+	require.NoError(p.next(1))
+	require.Equal(6, samples)
+}
+
+func TestPacerStopped(t *testing.T) {
+	require := require.New(t)
+
+	m, err := newCleanupManager(clock.New(), tally.NoopScope)
+	require.NoError(err)
+
+	p := m.newPacer(tally.NoopScope, CleanupConfig{
+		ScanWindow:    time.Hour,
+		ScanBatchSize: 1,
+	}, nil)
+	p.start(2)
+
+	m.stop()
+	require.Equal(errCleanupStopped, p.next(1))
+}
@@ -63,7 +63,7 @@ func TestCleanupManagerAddJob(t *testing.T) {
 		Interval: time.Second,
 		TTI:      time.Second,
 	}
-	m.addJob("test_cleanup", config, op)
+	require.NoError(m.addJob("test_cleanup", config, op, nil))
 
 	name := "test_file"
 
@@ -107,7 +107,7 @@ func TestCleanupManagerDeleteIdleFiles(t *testing.T) {
 		require.NoError(op.CreateFile(name, state, 0))
 	}
 
-	_, err = m.scan(op, tti, ttl)
+	_, err = m.scan(op, tti, ttl, nil, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
 	require.NoError(err)
 
 	for _, name := range idle {
@@ -143,7 +143,7 @@ func TestCleanupManagerDeleteExpiredFiles(t *testing.T) {
 		require.NoError(op.CreateFile(name, state, 0))
 	}
 
-	_, err = m.scan(op, tti, ttl)
+	_, err = m.scan(op, tti, ttl, nil, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
 	require.NoError(err)
 
 	for _, name := range names {
@@ -153,7 +153,7 @@ func TestCleanupManagerDeleteExpiredFiles(t *testing.T) {
 
 	clk.Add(ttl + 1)
 
-	_, err = m.scan(op, tti, ttl)
+	_, err = m.scan(op, tti, ttl, nil, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
 	require.NoError(err)
 
 	for _, name := range names {
@@ -162,6 +162,52 @@ func TestCleanupManagerDeleteExpiredFiles(t *testing.T) {
 	}
 }
 
+func TestCleanupManagerStaggerDelaysDeletion(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	tti := 48 * time.Hour
+	ttl := 24 * time.Hour
+
+	m, err := newCleanupManager(clk, tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	state, op, cleanup := fileOpFixture(clk)
+	defer cleanup()
+
+	staggered := core.DigestFixture().Hex()
+	unstaggered := core.DigestFixture().Hex()
+	for _, name := range []string{staggered, unstaggered} {
+		require.NoError(op.CreateFile(name, state, 0))
+	}
+	stagger := func(name string) time.Duration {
+		if name == staggered {
+			return time.Hour
+		}
+		return 0
+	}
+
+	clk.Add(ttl + time.Minute)
+
+	_, err = m.scan(op, tti, ttl, stagger, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
+	require.NoError(err)
+
+	_, err = op.GetFileStat(unstaggered)
+	require.True(os.IsNotExist(err))
+	_, err = op.GetFileStat(staggered)
+	require.NoError(err)
+
+	clk.Add(time.Hour)
+
+	_, err = m.scan(op, tti, ttl, stagger, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
+	require.NoError(err)
+
+	_, err = op.GetFileStat(staggered)
+	require.True(os.IsNotExist(err))
+}
+
 func TestCleanupManagerSkipsPersistedFiles(t *testing.T) {
 	require := require.New(t)
 
@@ -196,7 +242,7 @@ func TestCleanupManagerSkipsPersistedFiles(t *testing.T) {
 
 	clk.Add(tti + 1)
 
-	_, err = m.scan(op, tti, ttl)
+	_, err = m.scan(op, tti, ttl, nil, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
 	require.NoError(err)
 
 	for _, name := range idle {
@@ -225,7 +271,7 @@ func TestCleanupManageDiskUsage(t *testing.T) {
 		require.NoError(op.CreateFile(core.DigestFixture().Hex(), state, 5))
 	}
 
-	usage, err := m.scan(op, time.Hour, time.Hour)
+	usage, err := m.scan(op, time.Hour, time.Hour, nil, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), tally.NoopScope)
 	require.NoError(err)
 	require.Equal(int64(500), usage)
 }
@@ -259,3 +305,40 @@ func TestCleanupManagerAggressive(t *testing.T) {
 		return 0, errors.New("fake error")
 	}), 10*time.Second)
 }
+
+func TestCleanupManagerRecordsEvictionIdleTime(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	tti := 6 * time.Hour
+
+	m, err := newCleanupManager(clk, tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	state, op, cleanup := fileOpFixture(clk)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(op.CreateFile(core.DigestFixture().Hex(), state, 0))
+	}
+
+	clk.Add(tti + time.Minute)
+
+	stats := tally.NewTestScope("", nil)
+	_, err = m.scan(op, tti, 0, nil, ttlPolicy{}, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), stats)
+	require.NoError(err)
+
+	var total int64
+	for _, h := range stats.Snapshot().Histograms() {
+		require.Equal("eviction_idle_time", h.Name())
+		for upper, n := range h.Durations() {
+			if n > 0 {
+				require.True(upper > tti)
+			}
+			total += n
+		}
+	}
+	require.Equal(int64(3), total)
+}
@@ -35,12 +35,15 @@ type CAStoreConfig struct {
 	WritePartSize int `yaml:"write_part_size"`
 
 	SkipHashVerification bool `yaml:"skip_hash_verification"`
+
+	CacheIndex CacheIndexConfig `yaml:"cache_index"`
 }
 
 func (c CAStoreConfig) applyDefaults() CAStoreConfig {
 	if c.Capacity == 0 {
 		c.Capacity = 1 << 20 // 1 million
 	}
+	c.CacheIndex = c.CacheIndex.applyDefaults(c.CacheDir)
 	return c
 }
 
@@ -67,4 +70,15 @@ type CADownloadStoreConfig struct {
 	ReadPartSize int `yaml:"read_part_size"`
 	// Part size limit for each file write. 0 means no limit.
 	WritePartSize int `yaml:"write_part_size"`
+
+	// SkipHashVerification disables verifying the digest of completed
+	// downloads before they are moved to the cache.
+	SkipHashVerification bool `yaml:"skip_hash_verification"`
+
+	// FailOnDigestMismatch fails downloads whose digest does not match,
+	// instead of discarding their pieces and downloading them again.
+	FailOnDigestMismatch bool `yaml:"fail_on_digest_mismatch"`
+
+	// AccessStats reports cache hit ratios by blob popularity and recency.
+	AccessStats AccessStatsConfig `yaml:"access_stats"`
 }
@@ -0,0 +1,268 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/uber-go/tally"
+)
+
+// Eviction policies.
+const (
+	EvictionTTL             = "ttl"
+	EvictionLRU             = "lru"
+	EvictionLFU             = "lfu"
+	EvictionSizeWeightedTTL = "size_weighted_ttl"
+)
+
+// EvictionConfig defines how cleanup selects files to evict.
+//
+// All policies evict files which were idle for longer than the TTI, or alive
+// for longer than the TTL, of the cleanup config. In addition:
+//
+//	lru                 evicts the least recently accessed files while the total
+//	                    size of files exceeds MaxSize.
+//	lfu                 evicts the least frequently accessed files while the total
+//	                    size of files exceeds MaxSize. Only supported for cache
+//	                    files.
+//	size_weighted_ttl   shortens the TTI of files larger than ReferenceSize in
+//	                    proportion to their size, down to MinTTI.
+type EvictionConfig struct {
+	// Policy defaults to ttl.
+	Policy string `yaml:"policy"`
+
+	// MaxSize is the target total size of files for lru and lfu.
+	MaxSize datasize.ByteSize `yaml:"max_size"`
+
+	ReferenceSize datasize.ByteSize `yaml:"reference_size"`
+	MinTTI        time.Duration     `yaml:"min_tti"`
+}
+
+func (c EvictionConfig) applyDefaults() EvictionConfig {
+	if c.Policy == "" {
+		c.Policy = EvictionTTL
+	}
+	if c.ReferenceSize == 0 {
+		c.ReferenceSize = 100 * datasize.MB
+	}
+	if c.MinTTI == 0 {
+		c.MinTTI = 10 * time.Minute
+	}
+	return c
+}
+
+// EvictionCandidate is a file considered for eviction during cleanup.
+type EvictionCandidate struct {
+	Name string
+	Size int64
+
+	// Age is the time since the file was last modified.
+	Age time.Duration
+
+	// Idle is the time since the file was last accessed.
+	Idle time.Duration
+
+	// TTI and TTL of the file, including stagger. A TTL of 0 disables TTL.
+	TTI time.Duration
+	TTL time.Duration
+}
+
+// EvictionPolicy selects files to evict during cleanup.
+type EvictionPolicy interface {
+	// Expired returns whether c must be evicted. Called for each file as it
+	// is scanned.
+	Expired(c EvictionCandidate) bool
+
+	// Overflow orders the files retained by a scan by eviction priority, and
+	// returns how many bytes must be evicted from them. Files are evicted in
+	// order until that many bytes were freed.
+	Overflow(retained []EvictionCandidate) (ordered []EvictionCandidate, excess int64)
+}
+
+// newEvictionPolicy creates the EvictionPolicy configured by config. accesses
+// may be nil if the files are not cache files.
+func newEvictionPolicy(config EvictionConfig, accesses *accessCounter) (EvictionPolicy, error) {
+	config = config.applyDefaults()
+
+	switch config.Policy {
+	case EvictionTTL:
+		return ttlPolicy{}, nil
+	case EvictionSizeWeightedTTL:
+		return sizeWeightedTTLPolicy{int64(config.ReferenceSize), config.MinTTI}, nil
+	case EvictionLRU, EvictionLFU:
+		if config.MaxSize == 0 {
+			return nil, fmt.Errorf("%s eviction requires max_size", config.Policy)
+		}
+		if config.Policy == EvictionLRU {
+			return lruPolicy{int64(config.MaxSize)}, nil
+		}
+		if accesses == nil || accesses.counts == nil {
+			return nil, errors.New("lfu eviction is only supported for cache files")
+		}
+		return lfuPolicy{int64(config.MaxSize), accesses}, nil
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", config.Policy)
+	}
+}
+
+// ttlPolicy evicts idle or expired files.
+type ttlPolicy struct{}
+
+func (ttlPolicy) Expired(c EvictionCandidate) bool {
+	return (c.TTL > 0 && c.Age > c.TTL) || c.Idle > c.TTI
+}
+
+func (ttlPolicy) Overflow([]EvictionCandidate) ([]EvictionCandidate, int64) {
+	return nil, 0
+}
+
+// sizeWeightedTTLPolicy evicts large files sooner, since they free more space
+// per eviction.
+type sizeWeightedTTLPolicy struct {
+	referenceSize int64
+	minTTI        time.Duration
+}
+
+func (p sizeWeightedTTLPolicy) Expired(c EvictionCandidate) bool {
+	if c.Size > p.referenceSize {
+		tti := time.Duration(float64(c.TTI) * float64(p.referenceSize) / float64(c.Size))
+		if tti < p.minTTI {
+			tti = p.minTTI
+		}
+		if tti < c.TTI {
+			c.TTI = tti
+		}
+	}
+	return ttlPolicy{}.Expired(c)
+}
+
+func (sizeWeightedTTLPolicy) Overflow([]EvictionCandidate) ([]EvictionCandidate, int64) {
+	return nil, 0
+}
+
+func excessSize(retained []EvictionCandidate, maxSize int64) int64 {
+	var total int64
+	for _, c := range retained {
+		total += c.Size
+	}
+	return total - maxSize
+}
+
+// lruPolicy evicts the least recently accessed files beyond maxSize.
+type lruPolicy struct {
+	maxSize int64
+}
+
+func (lruPolicy) Expired(c EvictionCandidate) bool {
+	return ttlPolicy{}.Expired(c)
+}
+
+func (p lruPolicy) Overflow(retained []EvictionCandidate) ([]EvictionCandidate, int64) {
+	excess := excessSize(retained, p.maxSize)
+	if excess <= 0 {
+		return nil, 0
+	}
+	ordered := append([]EvictionCandidate(nil), retained...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Idle > ordered[j].Idle
+	})
+	return ordered, excess
+}
+
+// lfuPolicy evicts the least frequently accessed files beyond maxSize. Ties
+// are broken by recency.
+type lfuPolicy struct {
+	maxSize  int64
+	accesses *accessCounter
+}
+
+func (lfuPolicy) Expired(c EvictionCandidate) bool {
+	return ttlPolicy{}.Expired(c)
+}
+
+func (p lfuPolicy) Overflow(retained []EvictionCandidate) ([]EvictionCandidate, int64) {
+	counts := p.accesses.retain(retained)
+	excess := excessSize(retained, p.maxSize)
+	if excess <= 0 {
+		return nil, 0
+	}
+	ordered := append([]EvictionCandidate(nil), retained...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ci, cj := counts[ordered[i].Name], counts[ordered[j].Name]
+		if ci != cj {
+			return ci < cj
+		}
+		return ordered[i].Idle > ordered[j].Idle
+	})
+	return ordered, excess
+}
+
+// accessCounter records accesses of cache files, emitting hit and miss
+// counters and, if enabled, counting accesses per file for lfu eviction.
+type accessCounter struct {
+	stats tally.Scope
+
+	mu     sync.Mutex
+	counts map[string]int // Nil unless counting is enabled.
+}
+
+func newAccessCounter(stats tally.Scope, count bool) *accessCounter {
+	c := &accessCounter{stats: stats}
+	if count {
+		c.counts = make(map[string]int)
+	}
+	return c
+}
+
+// record records an access of name which was either served from the cache or
+// not.
+func (c *accessCounter) record(name string, hit bool) {
+	if hit {
+		c.stats.Counter("cache_hits").Inc(1)
+	} else {
+		c.stats.Counter("cache_misses").Inc(1)
+	}
+	if c.counts == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[name]++
+}
+
+// retain forgets the access counts of all files except candidates, and returns
+// the access counts of candidates.
+func (c *accessCounter) retain(candidates []EvictionCandidate) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int, len(candidates))
+	for _, cand := range candidates {
+		if n, ok := c.counts[cand.Name]; ok {
+			counts[cand.Name] = n
+		}
+	}
+	c.counts = make(map[string]int, len(counts))
+	for name, n := range counts {
+		c.counts[name] = n
+	}
+	return counts
+}
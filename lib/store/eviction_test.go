@@ -0,0 +1,210 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func candidateNames(cs []EvictionCandidate) []string {
+	var names []string
+	for _, c := range cs {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestNewEvictionPolicyErrors(t *testing.T) {
+	tests := []struct {
+		desc     string
+		config   EvictionConfig
+		accesses *accessCounter
+	}{
+		{"unknown policy", EvictionConfig{Policy: "fifo"}, nil},
+		{"lru without max size", EvictionConfig{Policy: EvictionLRU}, nil},
+		{"lfu without accesses", EvictionConfig{Policy: EvictionLFU, MaxSize: datasize.MB}, nil},
+		{
+			"lfu without counts",
+			EvictionConfig{Policy: EvictionLFU, MaxSize: datasize.MB},
+			newAccessCounter(tally.NoopScope, false),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := newEvictionPolicy(test.config, test.accesses)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestTTLPolicyExpired(t *testing.T) {
+	tests := []struct {
+		desc     string
+		c        EvictionCandidate
+		expected bool
+	}{
+		{"active", EvictionCandidate{Age: 2 * time.Hour, Idle: time.Minute, TTI: time.Hour}, false},
+		{"idle", EvictionCandidate{Idle: 2 * time.Hour, TTI: time.Hour}, true},
+		{"expired", EvictionCandidate{Age: 2 * time.Hour, TTI: time.Hour, TTL: time.Hour}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, ttlPolicy{}.Expired(test.c))
+		})
+	}
+}
+
+func TestSizeWeightedTTLPolicyExpiresLargeFilesSooner(t *testing.T) {
+	require := require.New(t)
+
+	p, err := newEvictionPolicy(EvictionConfig{
+		Policy:        EvictionSizeWeightedTTL,
+		ReferenceSize: 100,
+		MinTTI:        time.Minute,
+	}, nil)
+	require.NoError(err)
+
+	c := EvictionCandidate{Idle: 30 * time.Minute, TTI: time.Hour}
+
+	c.Size = 100
+	require.False(p.Expired(c))
+
+	// Half the TTI for twice the reference size.
+	c.Size = 200
+	require.False(p.Expired(c))
+	c.Size = 201
+	require.True(p.Expired(c))
+
+	// TTI never drops below MinTTI.
+	c.Size = 1000000
+	c.Idle = 30 * time.Second
+	require.False(p.Expired(c))
+}
+
+func TestLRUPolicyOverflow(t *testing.T) {
+	require := require.New(t)
+
+	p, err := newEvictionPolicy(EvictionConfig{Policy: EvictionLRU, MaxSize: 25}, nil)
+	require.NoError(err)
+
+	retained := []EvictionCandidate{
+		{Name: "a", Size: 10, Idle: time.Minute},
+		{Name: "b", Size: 10, Idle: time.Hour},
+		{Name: "c", Size: 10, Idle: time.Second},
+	}
+	ordered, excess := p.Overflow(retained)
+	require.Equal(int64(5), excess)
+	require.Equal([]string{"b", "a", "c"}, candidateNames(ordered))
+
+	ordered, excess = p.Overflow(retained[:2])
+	require.Empty(ordered)
+	require.Equal(int64(0), excess)
+}
+
+func TestLFUPolicyOverflow(t *testing.T) {
+	require := require.New(t)
+
+	accesses := newAccessCounter(tally.NoopScope, true)
+	p, err := newEvictionPolicy(EvictionConfig{Policy: EvictionLFU, MaxSize: 25}, accesses)
+	require.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		accesses.record("a", true)
+	}
+	accesses.record("b", true)
+	accesses.record("deleted", true)
+
+	retained := []EvictionCandidate{
+		{Name: "a", Size: 10, Idle: time.Hour},
+		{Name: "b", Size: 10, Idle: time.Minute},
+		{Name: "c", Size: 10, Idle: time.Second},
+		{Name: "d", Size: 10, Idle: time.Minute},
+	}
+	ordered, excess := p.Overflow(retained)
+	require.Equal(int64(15), excess)
+	require.Equal([]string{"d", "c", "b", "a"}, candidateNames(ordered))
+
+	// Counts of files which are no longer retained are forgotten.
+	require.NotContains(accesses.counts, "deleted")
+}
+
+func TestAccessCounterRecordsHitsAndMisses(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	accesses := newAccessCounter(stats, false)
+
+	accesses.record("a", true)
+	accesses.record("a", true)
+	accesses.record("b", false)
+
+	counters := stats.Snapshot().Counters()
+	require.Equal(int64(2), counters["cache_hits+"].Value())
+	require.Equal(int64(1), counters["cache_misses+"].Value())
+	require.Nil(accesses.counts)
+}
+
+func TestCleanupManagerEvictsLeastRecentlyUsedFilesOverCapacity(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	m, err := newCleanupManager(clk, tally.NoopScope)
+	require.NoError(err)
+	defer m.stop()
+
+	state, op, cleanup := fileOpFixture(clk)
+	defer cleanup()
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := core.DigestFixture().Hex()
+		require.NoError(op.CreateFile(name, state, 10))
+		names = append(names, name)
+		clk.Add(time.Minute)
+	}
+
+	p, err := newEvictionPolicy(EvictionConfig{Policy: EvictionLRU, MaxSize: 25}, nil)
+	require.NoError(err)
+
+	stats := tally.NewTestScope("", nil)
+	usage, err := m.scan(
+		op, time.Hour, 0, nil, p, m.newPacer(tally.NoopScope, CleanupConfig{}, nil), stats)
+	require.NoError(err)
+	require.Equal(int64(40), usage)
+
+	// The two oldest files are evicted to bring usage under 25 bytes.
+	for _, name := range names[:2] {
+		_, err := op.GetFileStat(name)
+		require.True(os.IsNotExist(err))
+	}
+	for _, name := range names[2:] {
+		_, err := op.GetFileStat(name)
+		require.NoError(err)
+	}
+
+	counters := stats.Snapshot().Counters()
+	require.Equal(int64(2), counters["evictions+reason=over_capacity"].Value())
+	require.Equal(int64(20), counters["evicted_bytes+reason=over_capacity"].Value())
+}
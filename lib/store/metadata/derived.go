@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/uber/kraken/core"
+)
+
+const _derivedSuffix = "_derived_"
+
+func init() {
+	Register(regexp.MustCompile("^"+_derivedSuffix), &derivedFactory{})
+}
+
+type derivedFactory struct{}
+
+func (f derivedFactory) Create(suffix string) Metadata {
+	return &Derived{Transformer: strings.TrimPrefix(suffix, _derivedSuffix)}
+}
+
+// Derived maps a blob to the digest of the blob derived from it by an ingest
+// transformer.
+type Derived struct {
+	Transformer string
+	Digest      core.Digest
+}
+
+// NewDerived creates a new Derived.
+func NewDerived(transformer string, d core.Digest) *Derived {
+	return &Derived{transformer, d}
+}
+
+// GetSuffix returns a suffix keyed by transformer.
+func (m *Derived) GetSuffix() string {
+	return _derivedSuffix + m.Transformer
+}
+
+// Movable is true.
+func (m *Derived) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Derived) Serialize() ([]byte, error) {
+	return []byte(m.Digest.String()), nil
+}
+
+// Deserialize loads b into m.
+func (m *Derived) Deserialize(b []byte) error {
+	d, err := core.ParseDigest(string(b))
+	if err != nil {
+		return err
+	}
+	m.Digest = d
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"regexp"
+	"time"
+)
+
+const _leaseSuffix = "_lease"
+
+func init() {
+	Register(regexp.MustCompile(_leaseSuffix), &leaseFactory{})
+}
+
+type leaseFactory struct{}
+
+func (f leaseFactory) Create(suffix string) Metadata {
+	return &Lease{}
+}
+
+// Lease protects a blob from deletion until Deadline.
+type Lease struct {
+	Deadline time.Time
+}
+
+// NewLease creates a new Lease which expires at deadline.
+func NewLease(deadline time.Time) *Lease {
+	return &Lease{deadline}
+}
+
+// GetSuffix returns a static suffix.
+func (m *Lease) GetSuffix() string {
+	return _leaseSuffix
+}
+
+// Movable is true.
+func (m *Lease) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Lease) Serialize() ([]byte, error) {
+	return m.Deadline.UTC().MarshalText()
+}
+
+// Deserialize loads b into m.
+func (m *Lease) Deserialize(b []byte) error {
+	return m.Deadline.UnmarshalText(b)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+const _namespaceSuffix = "_namespace_"
+
+func init() {
+	Register(regexp.MustCompile("^"+_namespaceSuffix), &namespaceFactory{})
+}
+
+type namespaceFactory struct{}
+
+func (f namespaceFactory) Create(suffix string) Metadata {
+	return &Namespace{}
+}
+
+// Namespace records that a blob was written to or read from the storage
+// backend of Namespace. A blob may belong to several namespaces.
+type Namespace struct {
+	Namespace string
+}
+
+// NewNamespace creates a new Namespace.
+func NewNamespace(namespace string) *Namespace {
+	return &Namespace{namespace}
+}
+
+// GetSuffix returns a suffix keyed by the hash of the namespace, since
+// namespaces may contain characters which are not valid in file names.
+func (m *Namespace) GetSuffix() string {
+	h := sha256.Sum256([]byte(m.Namespace))
+	return _namespaceSuffix + hex.EncodeToString(h[:8])
+}
+
+// Movable is true.
+func (m *Namespace) Movable() bool {
+	return true
+}
+
+// Serialize converts m to bytes.
+func (m *Namespace) Serialize() ([]byte, error) {
+	return []byte(m.Namespace), nil
+}
+
+// Deserialize loads b into m.
+func (m *Namespace) Deserialize(b []byte) error {
+	m.Namespace = string(b)
+	return nil
+}
@@ -52,8 +52,12 @@ func NewSimpleStore(config SimpleStoreConfig, stats tally.Scope) (*SimpleStore,
 	if err != nil {
 		return nil, fmt.Errorf("new cleanup manager: %s", err)
 	}
-	cleanup.addJob("upload", config.UploadCleanup, uploadStore.newFileOp())
-	cleanup.addJob("cache", config.CacheCleanup, cacheStore.newFileOp())
+	if err := cleanup.addJob("upload", config.UploadCleanup, uploadStore.newFileOp(), nil); err != nil {
+		return nil, err
+	}
+	if err := cleanup.addJob("cache", config.CacheCleanup, cacheStore.newFileOp(), nil); err != nil {
+		return nil, err
+	}
 
 	return &SimpleStore{uploadStore, cacheStore, cleanup}, nil
 }
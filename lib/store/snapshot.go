@@ -0,0 +1,221 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/docker/distribution/uuid"
+	"github.com/uber/kraken/lib/store/base"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+// SnapshotManifestFile is the name of the manifest in a cache snapshot
+// directory.
+const SnapshotManifestFile = "manifest.json"
+
+// SnapshotManifest lists the files of a cache snapshot.
+type SnapshotManifest struct {
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a cache file of a snapshot. The data of the file is stored
+// under its name in the snapshot directory, and its metadata is stored by
+// suffix in the manifest.
+type SnapshotFile struct {
+	Name     string            `json:"name"`
+	Size     int64             `json:"size"`
+	Metadata map[string][]byte `json:"metadata,omitempty"`
+}
+
+// SnapshotImportResult summarizes an imported cache snapshot.
+type SnapshotImportResult struct {
+	Imported int
+	Existing int
+	Bytes    int64
+
+	// Failures maps the names of files which could not be imported to the
+	// reason why.
+	Failures map[string]error
+}
+
+// newSnapshotCacheStore opens the cache directory of config without starting
+// cleanup or wiping the upload directory, such that snapshots can be exported
+// while an origin is serving from the same directory.
+func newSnapshotCacheStore(config CAStoreConfig) (*cacheStore, error) {
+	config = config.applyDefaults()
+	return newCacheStore(config.CacheDir, base.NewCASFileStore(clock.New()), config.ReadPartSize)
+}
+
+// ExportCacheSnapshot hardlinks every cache file of the CAStore configured by
+// config into dir, and writes a manifest of the files and their metadata. dir
+// must be on the same filesystem as the cache directory, and the snapshot takes
+// no additional disk space until the origin deletes the linked cache files.
+// Files deleted while the snapshot is taken are skipped.
+func ExportCacheSnapshot(config CAStoreConfig, dir string) (*SnapshotManifest, error) {
+	cs, err := newSnapshotCacheStore(config)
+	if err != nil {
+		return nil, fmt.Errorf("open cache: %s", err)
+	}
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return nil, fmt.Errorf("mkdir: %s", err)
+	}
+	names, err := cs.ListCacheFiles()
+	if err != nil {
+		return nil, fmt.Errorf("list cache files: %s", err)
+	}
+	manifest := &SnapshotManifest{CreatedAt: time.Now()}
+	for _, name := range names {
+		f, err := exportCacheFile(cs, name, dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("export %s: %s", name, err)
+		}
+		manifest.Files = append(manifest.Files, *f)
+	}
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, SnapshotManifestFile), b, 0644); err != nil {
+		return nil, fmt.Errorf("write manifest: %s", err)
+	}
+	return manifest, nil
+}
+
+func exportCacheFile(cs *cacheStore, name, dir string) (*SnapshotFile, error) {
+	op := cs.newFileOp()
+	path := filepath.Join(dir, name)
+	if err := op.LinkFileTo(name, path); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// Metadata is read after ranging, since the file is locked while ranging.
+	var mds []metadata.Metadata
+	if err := op.RangeFileMetadata(name, func(md metadata.Metadata) error {
+		mds = append(mds, md)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	f := &SnapshotFile{Name: name, Size: info.Size(), Metadata: make(map[string][]byte)}
+	for _, md := range mds {
+		if err := op.GetFileMetadata(name, md); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		b, err := md.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		f.Metadata[md.GetSuffix()] = b
+	}
+	return f, nil
+}
+
+// ImportCacheSnapshot moves the files of a snapshot exported by
+// ExportCacheSnapshot into the cache directory of the CAStore configured by
+// config, restoring their metadata. Files already in the cache are skipped,
+// and files which do not match the manifest size or their digest are reported
+// as failures. The content of each file is verified unless config skips hash
+// verification. dir must be on the same filesystem as the cache directory,
+// which is expected to not be in use by a running origin.
+func ImportCacheSnapshot(config CAStoreConfig, dir string) (*SnapshotImportResult, error) {
+	config = config.applyDefaults()
+	cs, err := newSnapshotCacheStore(config)
+	if err != nil {
+		return nil, fmt.Errorf("open cache: %s", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, SnapshotManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %s", err)
+	}
+	var manifest SnapshotManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest: %s", err)
+	}
+	result := &SnapshotImportResult{Failures: make(map[string]error)}
+	for _, f := range manifest.Files {
+		if _, err := cs.GetCacheFileStat(f.Name); err == nil {
+			result.Existing++
+			continue
+		}
+		if err := importCacheFile(cs, f, dir, config.SkipHashVerification); err != nil {
+			result.Failures[f.Name] = err
+			continue
+		}
+		result.Imported++
+		result.Bytes += f.Size
+	}
+	return result, nil
+}
+
+func importCacheFile(cs *cacheStore, f SnapshotFile, dir string, skipHash bool) error {
+	src := filepath.Join(dir, f.Name)
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if info.Size() != f.Size {
+		return fmt.Errorf("size %d does not match manifest size %d", info.Size(), f.Size)
+	}
+
+	// Link the snapshot file next to the cache first, so the snapshot remains
+	// intact if the file is rejected.
+	tmp := filepath.Join(cs.state.GetDirectory(), fmt.Sprintf(".import.%s", uuid.Generate().String()))
+	if err := os.Link(src, tmp); err != nil {
+		return fmt.Errorf("link: %s", err)
+	}
+	defer os.Remove(tmp)
+
+	r, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := verifyContent(r, f.Name, skipHash); err != nil {
+		return fmt.Errorf("verify: %s", err)
+	}
+
+	op := cs.newFileOp()
+	if err := op.MoveFileFrom(f.Name, cs.state, tmp); err != nil {
+		return fmt.Errorf("move file to cache: %s", err)
+	}
+	for suffix, b := range f.Metadata {
+		md := metadata.CreateFromSuffix(suffix)
+		if md == nil {
+			continue
+		}
+		if err := md.Deserialize(b); err != nil {
+			return fmt.Errorf("deserialize metadata %s: %s", suffix, err)
+		}
+		if _, err := op.SetFileMetadata(f.Name, md); err != nil {
+			return fmt.Errorf("set metadata %s: %s", suffix, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+func TestCacheSnapshotExportAndImport(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	blob1 := core.NewBlobFixture()
+	blob2 := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(blob1.Digest.Hex(), bytes.NewReader(blob1.Content)))
+	require.NoError(s.CreateCacheFile(blob2.Digest.Hex(), bytes.NewReader(blob2.Content)))
+	_, err = s.SetCacheFileMetadata(blob1.Digest.Hex(), metadata.NewPersist(true))
+	require.NoError(err)
+
+	dir, err := ioutil.TempDir(filepath.Dir(config.CacheDir), "snapshot")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	manifest, err := ExportCacheSnapshot(config, dir)
+	require.NoError(err)
+	require.Len(manifest.Files, 2)
+
+	// The snapshot outlives the exported cache.
+	require.NoError(s.DeleteCacheFile(blob2.Digest.Hex()))
+
+	importConfig, importCleanup := CAStoreConfigFixture()
+	defer importCleanup()
+
+	result, err := ImportCacheSnapshot(importConfig, dir)
+	require.NoError(err)
+	require.Equal(2, result.Imported)
+	require.Empty(result.Failures)
+	require.Equal(int64(len(blob1.Content)+len(blob2.Content)), result.Bytes)
+
+	s2, err := NewCAStore(importConfig, tally.NoopScope)
+	require.NoError(err)
+	defer s2.Close()
+
+	for _, blob := range []*core.BlobFixture{blob1, blob2} {
+		r, err := s2.GetCacheFileReader(blob.Digest.Hex())
+		require.NoError(err)
+		b, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		require.Equal(blob.Content, b)
+		r.Close()
+	}
+	var persist metadata.Persist
+	require.NoError(s2.GetCacheFileMetadata(blob1.Digest.Hex(), &persist))
+	require.True(persist.Value)
+
+	// Importing again skips existing files.
+	result, err = ImportCacheSnapshot(importConfig, dir)
+	require.NoError(err)
+	require.Equal(0, result.Imported)
+	require.Equal(2, result.Existing)
+}
+
+func TestCacheSnapshotImportRejectsCorruptFiles(t *testing.T) {
+	require := require.New(t)
+
+	config, cleanup := CAStoreConfigFixture()
+	defer cleanup()
+
+	s, err := NewCAStore(config, tally.NoopScope)
+	require.NoError(err)
+	defer s.Close()
+
+	blob := core.NewBlobFixture()
+	require.NoError(s.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	dir, err := ioutil.TempDir(filepath.Dir(config.CacheDir), "snapshot")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = ExportCacheSnapshot(config, dir)
+	require.NoError(err)
+
+	// Replace the linked file, such that the cache file is left intact.
+	path := filepath.Join(dir, blob.Digest.Hex())
+	require.NoError(os.Remove(path))
+	corrupt := append([]byte{}, blob.Content...)
+	corrupt[0]++
+	require.NoError(ioutil.WriteFile(path, corrupt, 0644))
+
+	importConfig, importCleanup := CAStoreConfigFixture()
+	defer importCleanup()
+
+	result, err := ImportCacheSnapshot(importConfig, dir)
+	require.NoError(err)
+	require.Equal(0, result.Imported)
+	require.Contains(result.Failures, blob.Digest.Hex())
+
+	s2, err := NewCAStore(importConfig, tally.NoopScope)
+	require.NoError(err)
+	defer s2.Close()
+
+	_, err = s2.GetCacheFileStat(blob.Digest.Hex())
+	require.True(os.IsNotExist(err))
+
+	// The rejected file remains in the snapshot.
+	_, err = os.Stat(path)
+	require.NoError(err)
+}
@@ -72,15 +72,15 @@ func NewMockFileReadWriter(content []byte) (*MockFileReadWriter, func()) {
 
 // RunDownload downloads content to cads.
 func RunDownload(cads *CADownloadStore, d core.Digest, content []byte) error {
-	if err := cads.CreateDownloadFile(d.Hex(), int64(len(content))); err != nil {
+	if err := cads.CreateDownloadFile(d.Name(), int64(len(content))); err != nil {
 		return err
 	}
-	w, err := cads.GetDownloadFileReadWriter(d.Hex())
+	w, err := cads.GetDownloadFileReadWriter(d.Name())
 	if err != nil {
 		return err
 	}
 	if _, err := io.Copy(w, bytes.NewReader(content)); err != nil {
 		return err
 	}
-	return cads.MoveDownloadFileToCache(d.Hex())
+	return cads.MoveDownloadFileToCache(d.Name())
 }
@@ -17,4 +17,19 @@ package networkevent
 type Config struct {
 	LogPath string `yaml:"log_path"`
 	Enabled bool   `yaml:"enabled"`
+
+	// V2 writes events in the v2 protobuf schema to a separate log. If both
+	// logs are enabled, every event is written to both, which allows consumers
+	// to migrate to v2 before v1 is disabled.
+	V2 V2Config `yaml:"v2"`
+
+	// Exporters send events to stores such as OpenSearch or ClickHouse in
+	// batches, independent of the logs.
+	Exporters []ExporterConfig `yaml:"exporters"`
+}
+
+// V2Config defines configuration for the v2 network event log.
+type V2Config struct {
+	LogPath string `yaml:"log_path"`
+	Enabled bool   `yaml:"enabled"`
 }
@@ -0,0 +1,359 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// Exporter types.
+const (
+	OpenSearch = "opensearch"
+	ClickHouse = "clickhouse"
+	Kafka      = "kafka"
+)
+
+// Backpressure policies.
+const (
+	// BackpressureDrop drops events while the exporter queue is full.
+	BackpressureDrop = "drop"
+
+	// BackpressureBlock blocks producers while the exporter queue is full.
+	BackpressureBlock = "block"
+)
+
+// ExporterConfig defines configuration for exporting events to a store over
+// HTTP in batches.
+type ExporterConfig struct {
+	// Type is OpenSearch, ClickHouse or Kafka. OpenSearch batches are written
+	// with the bulk API, ClickHouse batches are inserted in JSONEachRow format,
+	// and Kafka batches are produced through the Kafka REST proxy.
+	Type string `yaml:"type"`
+
+	// URL of the store, e.g. http://opensearch:9200, http://clickhouse:8123
+	// or http://kafka-rest:8082.
+	URL string `yaml:"url"`
+
+	// Index is the OpenSearch index events are written to.
+	Index string `yaml:"index"`
+
+	// Table is the ClickHouse table events are inserted into.
+	Table string `yaml:"table"`
+
+	// Topic is the Kafka topic events are produced to.
+	Topic string `yaml:"topic"`
+
+	// Username and Password are used for basic authentication, if set.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// BatchSize is the max number of events per request.
+	BatchSize int `yaml:"batch_size"`
+
+	// FlushInterval is how long events are buffered before a partial batch
+	// is sent.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+
+	// QueueSize is the number of events buffered while batches are sent.
+	QueueSize int `yaml:"queue_size"`
+
+	// Backpressure is BackpressureDrop or BackpressureBlock. Defaults to
+	// BackpressureDrop, such that a slow store never slows down torrents.
+	Backpressure string `yaml:"backpressure"`
+
+	// MaxRetries is how often a failed batch is sent again before its events
+	// are dropped. Retries back off exponentially from RetryBackoff.
+	MaxRetries   int           `yaml:"max_retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// Timeout of a single request.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c ExporterConfig) applyDefaults() ExporterConfig {
+	if c.BatchSize == 0 {
+		c.BatchSize = 1000
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 10000
+	}
+	if c.Backpressure == "" {
+		c.Backpressure = BackpressureDrop
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// exporter sends records, e.g. events, to a store in batches from a
+// background goroutine. Records are encoded as JSON.
+type exporter struct {
+	config      ExporterConfig
+	stats       tally.Scope
+	url         string
+	contentType string
+	encode      func(batch []interface{}) ([]byte, error)
+
+	events chan interface{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newExporter(config ExporterConfig, stats tally.Scope) (*exporter, error) {
+	config = config.applyDefaults()
+	if config.URL == "" {
+		return nil, errors.New("no url supplied")
+	}
+	if config.Backpressure != BackpressureDrop && config.Backpressure != BackpressureBlock {
+		return nil, fmt.Errorf("unknown backpressure %q", config.Backpressure)
+	}
+
+	e := &exporter{
+		config:      config,
+		stats:       stats.Tagged(map[string]string{"exporter": config.Type}),
+		contentType: "application/x-ndjson",
+		events:      make(chan interface{}, config.QueueSize),
+		done:        make(chan struct{}),
+	}
+	base := strings.TrimSuffix(config.URL, "/")
+	switch config.Type {
+	case OpenSearch:
+		if config.Index == "" {
+			return nil, errors.New("opensearch: no index supplied")
+		}
+		e.url = base + "/_bulk"
+		e.encode = e.encodeOpenSearch
+	case ClickHouse:
+		if config.Table == "" {
+			return nil, errors.New("clickhouse: no table supplied")
+		}
+		q := url.Values{}
+		q.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", config.Table))
+		q.Set("date_time_input_format", "best_effort")
+		q.Set("input_format_skip_unknown_fields", "1")
+		e.url = base + "/?" + q.Encode()
+		e.encode = encodeClickHouse
+	case Kafka:
+		if config.Topic == "" {
+			return nil, errors.New("kafka: no topic supplied")
+		}
+		e.url = base + "/topics/" + url.PathEscape(config.Topic)
+		e.contentType = "application/vnd.kafka.json.v2+json"
+		e.encode = encodeKafka
+	default:
+		return nil, fmt.Errorf("unknown exporter type %q", config.Type)
+	}
+
+	go e.run()
+	return e, nil
+}
+
+// produce queues ev for export.
+func (e *exporter) produce(ev interface{}) {
+	if e.config.Backpressure == BackpressureBlock {
+		e.events <- ev
+		return
+	}
+	select {
+	case e.events <- ev:
+	default:
+		e.stats.Counter("dropped_events").Inc(1)
+	}
+}
+
+// close sends all queued events and stops e. Events must not be produced
+// after close.
+func (e *exporter) close() {
+	e.once.Do(func() { close(e.events) })
+	<-e.done
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]interface{}, 0, e.config.BatchSize)
+	for {
+		select {
+		case ev, ok := <-e.events:
+			if !ok {
+				e.flush(batch)
+				return
+			}
+			batch = append(batch, ev)
+			if len(batch) < e.config.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		e.flush(batch)
+		batch = batch[:0]
+		e.stats.Gauge("queue_depth").Update(float64(len(e.events)))
+	}
+}
+
+// flush sends batch, retrying failures with exponential backoff. Events of
+// batches which fail all retries are dropped.
+func (e *exporter) flush(batch []interface{}) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := e.encode(batch)
+	if err != nil {
+		log.Errorf("Error encoding network events: %s", err)
+		e.stats.Counter("dropped_events").Inc(int64(len(batch)))
+		return
+	}
+	backoff := e.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = e.send(body)
+		if err == nil {
+			e.stats.Counter("exported_events").Inc(int64(len(batch)))
+			return
+		}
+		if attempt == e.config.MaxRetries {
+			break
+		}
+		e.stats.Counter("retries").Inc(1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	log.With("exporter", e.config.Type).Errorf(
+		"Error exporting %d network events, dropping them: %s", len(batch), err)
+	e.stats.Counter("dropped_events").Inc(int64(len(batch)))
+}
+
+func (e *exporter) send(body []byte) error {
+	headers := map[string]string{"Content-Type": e.contentType}
+	if e.config.Username != "" {
+		headers["Authorization"] = basicAuth(e.config.Username, e.config.Password)
+	}
+	resp, err := httputil.Post(
+		e.url,
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendHeaders(headers),
+		httputil.SendTimeout(e.config.Timeout))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch e.config.Type {
+	case OpenSearch:
+		// The bulk API responds 200 even if some documents failed.
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("decode bulk response: %s", err)
+		}
+		if result.Errors {
+			return errors.New("bulk response has errors")
+		}
+	case Kafka:
+		// The REST proxy responds 200 even if some records failed.
+		var result struct {
+			Offsets []struct {
+				Error string `json:"error"`
+			} `json:"offsets"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("decode produce response: %s", err)
+		}
+		for _, o := range result.Offsets {
+			if o.Error != "" {
+				return fmt.Errorf("produce response has errors: %s", o.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// encodeOpenSearch encodes batch as a bulk request which indexes each event.
+func (e *exporter) encodeOpenSearch(batch []interface{}) ([]byte, error) {
+	action, err := json.Marshal(map[string]interface{}{
+		"index": map[string]string{"_index": e.config.Index},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, ev := range batch {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeClickHouse encodes batch as one JSON object per line.
+func encodeClickHouse(batch []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, ev := range batch {
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeKafka encodes batch as a REST proxy produce request with one JSON
+// record per event.
+func encodeKafka(batch []interface{}) ([]byte, error) {
+	type record struct {
+		Value interface{} `json:"value"`
+	}
+	records := make([]record, len(batch))
+	for i, ev := range batch {
+		records[i] = record{ev}
+	}
+	return json.Marshal(map[string]interface{}{"records": records})
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
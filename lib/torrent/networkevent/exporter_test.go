@@ -0,0 +1,343 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// fakeStore records the events of all requests, failing the first failures
+// requests.
+type fakeStore struct {
+	sync.Mutex
+	requests []*http.Request
+	events   []*Event
+	failures int
+}
+
+func (s *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.requests = append(s.requests, r)
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, `{"index"`) {
+			continue
+		}
+		e := new(Event)
+		if err := json.Unmarshal([]byte(line), e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.events = append(s.events, e)
+	}
+	if r.URL.Path == "/_bulk" {
+		fmt.Fprint(w, `{"errors": false}`)
+	}
+}
+
+func (s *fakeStore) getEvents() []*Event {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*Event(nil), s.events...)
+}
+
+func (s *fakeStore) getRequests() []*http.Request {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*http.Request(nil), s.requests...)
+}
+
+func pieceEventsFixture(n int) []*Event {
+	h := core.InfoHashFixture()
+	self := core.PeerIDFixture()
+	peer := core.PeerIDFixture()
+	var events []*Event
+	for i := 0; i < n; i++ {
+		events = append(events, ReceivePieceEvent(h, self, peer, i+1))
+	}
+	return events
+}
+
+func TestExporterBatchesEvents(t *testing.T) {
+	tests := []struct {
+		config ExporterConfig
+		path   string
+	}{
+		{ExporterConfig{Type: OpenSearch, Index: "netevents"}, "/_bulk"},
+		{ExporterConfig{Type: ClickHouse, Table: "kraken.netevents"}, "/"},
+	}
+	for _, test := range tests {
+		t.Run(test.config.Type, func(t *testing.T) {
+			require := require.New(t)
+
+			store := &fakeStore{}
+			server := httptest.NewServer(store)
+			defer server.Close()
+
+			config := test.config
+			config.URL = server.URL
+			config.BatchSize = 2
+			config.FlushInterval = time.Hour
+
+			p, err := NewProducer(Config{Exporters: []ExporterConfig{config}})
+			require.NoError(err)
+
+			events := pieceEventsFixture(5)
+			for _, e := range events {
+				p.Produce(e)
+			}
+			// The last partial batch is sent on close.
+			require.NoError(p.Close())
+
+			require.Equal(StripTimestamps(events), StripTimestamps(store.getEvents()))
+			requests := store.getRequests()
+			require.Len(requests, 3)
+			for _, r := range requests {
+				require.Equal(test.path, r.URL.Path)
+			}
+		})
+	}
+}
+
+func TestExporterClickHouseQuery(t *testing.T) {
+	require := require.New(t)
+
+	store := &fakeStore{}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	e, err := newExporter(ExporterConfig{
+		Type:     ClickHouse,
+		URL:      server.URL,
+		Table:    "kraken.netevents",
+		Username: "user",
+		Password: "pass",
+	}, tally.NoopScope)
+	require.NoError(err)
+	e.produce(pieceEventsFixture(1)[0])
+	e.close()
+
+	requests := store.getRequests()
+	require.Len(requests, 1)
+	require.Equal(
+		"INSERT INTO kraken.netevents FORMAT JSONEachRow", requests[0].URL.Query().Get("query"))
+	username, password, ok := requests[0].BasicAuth()
+	require.True(ok)
+	require.Equal("user", username)
+	require.Equal("pass", password)
+}
+
+func TestExporterKafkaProduceRequest(t *testing.T) {
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	var events []*Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, r)
+		var body struct {
+			Records []struct {
+				Value *Event `json:"value"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, rec := range body.Records {
+			events = append(events, rec.Value)
+		}
+		fmt.Fprint(w, `{"offsets": [{"partition": 0, "offset": 1}]}`)
+	}))
+	defer server.Close()
+
+	e, err := newExporter(ExporterConfig{
+		Type:  Kafka,
+		URL:   server.URL,
+		Topic: "netevents",
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	expected := pieceEventsFixture(3)
+	for _, ev := range expected {
+		e.produce(ev)
+	}
+	e.close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(requests, 1)
+	require.Equal("/topics/netevents", requests[0].URL.Path)
+	require.Equal("application/vnd.kafka.json.v2+json", requests[0].Header.Get("Content-Type"))
+	require.Equal(StripTimestamps(expected), StripTimestamps(events))
+}
+
+func TestExporterKafkaRetriesRecordErrors(t *testing.T) {
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var n int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		n++
+		if n == 1 {
+			fmt.Fprint(w, `{"offsets": [{"error_code": 50003, "error": "broker unavailable"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"offsets": [{"partition": 0, "offset": 1}]}`)
+	}))
+	defer server.Close()
+
+	stats := tally.NewTestScope("", nil)
+	e, err := newExporter(ExporterConfig{
+		Type:         Kafka,
+		URL:          server.URL,
+		Topic:        "netevents",
+		RetryBackoff: time.Millisecond,
+	}, stats)
+	require.NoError(err)
+
+	e.produce(pieceEventsFixture(1)[0])
+	e.close()
+
+	require.Equal(int64(1), stats.Snapshot().Counters()["retries+exporter=kafka"].Value())
+}
+
+func TestExporterRetriesFailedBatches(t *testing.T) {
+	require := require.New(t)
+
+	store := &fakeStore{failures: 2}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	stats := tally.NewTestScope("", nil)
+	e, err := newExporter(ExporterConfig{
+		Type:         OpenSearch,
+		URL:          server.URL,
+		Index:        "netevents",
+		RetryBackoff: time.Millisecond,
+	}, stats)
+	require.NoError(err)
+
+	events := pieceEventsFixture(3)
+	for _, ev := range events {
+		e.produce(ev)
+	}
+	e.close()
+
+	require.Equal(StripTimestamps(events), StripTimestamps(store.getEvents()))
+	require.Equal(int64(2), stats.Snapshot().Counters()["retries+exporter=opensearch"].Value())
+}
+
+func TestExporterDropsBatchesAfterMaxRetries(t *testing.T) {
+	require := require.New(t)
+
+	store := &fakeStore{failures: 100}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	stats := tally.NewTestScope("", nil)
+	e, err := newExporter(ExporterConfig{
+		Type:         ClickHouse,
+		URL:          server.URL,
+		Table:        "netevents",
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	}, stats)
+	require.NoError(err)
+
+	e.produce(pieceEventsFixture(1)[0])
+	e.close()
+
+	require.Len(store.getRequests(), 2)
+	require.Equal(
+		int64(1), stats.Snapshot().Counters()["dropped_events+exporter=clickhouse"].Value())
+}
+
+func TestExporterDropsEventsWhenQueueFull(t *testing.T) {
+	require := require.New(t)
+
+	// Block the exporter in its first request.
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+
+	stats := tally.NewTestScope("", nil)
+	e, err := newExporter(ExporterConfig{
+		Type:      ClickHouse,
+		URL:       server.URL,
+		Table:     "netevents",
+		BatchSize: 1,
+		QueueSize: 1,
+	}, stats)
+	require.NoError(err)
+
+	events := pieceEventsFixture(10)
+	for _, ev := range events {
+		e.produce(ev)
+	}
+	close(unblock)
+	e.close()
+
+	require.True(stats.Snapshot().Counters()["dropped_events+exporter=clickhouse"].Value() > 0)
+}
+
+func TestNewExporterInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config ExporterConfig
+	}{
+		{"unknown type", ExporterConfig{Type: "statsd", URL: "http://x"}},
+		{"no url", ExporterConfig{Type: OpenSearch, Index: "x"}},
+		{"no index", ExporterConfig{Type: OpenSearch, URL: "http://x"}},
+		{"no table", ExporterConfig{Type: ClickHouse, URL: "http://x"}},
+		{"no topic", ExporterConfig{Type: Kafka, URL: "http://x"}},
+		{"unknown backpressure", ExporterConfig{
+			Type: ClickHouse, URL: "http://x", Table: "x", Backpressure: "wait"}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := newExporter(test.config, tally.NoopScope)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uber-go/tally"
+)
+
+// Flow end reasons, as defined by the IPFIX flowEndReason information element.
+const (
+	// FlowEndActiveTimeout marks periodic summaries of active flows.
+	FlowEndActiveTimeout = 2
+
+	// FlowEndOfFlow marks the final summary of a closed flow.
+	FlowEndOfFlow = 3
+
+	// FlowEndForced marks the final summary of a flow which is closed because
+	// the scheduler stops.
+	FlowEndForced = 4
+)
+
+// Flow summarizes the traffic of a peer connection over an interval. Fields
+// are named after IPFIX information elements (RFC 7012, RFC 5103), where the
+// local peer is the source and the remote peer is the destination, so
+// octetDeltaCount counts bytes sent and reverseOctetDeltaCount bytes received.
+// Fields without an IPFIX counterpart are prefixed with kraken.
+type Flow struct {
+	FlowStartMilliseconds    int64   `json:"flowStartMilliseconds"`
+	FlowEndMilliseconds      int64   `json:"flowEndMilliseconds"`
+	FlowDurationMilliseconds int64   `json:"flowDurationMilliseconds"`
+	FlowEndReason            int     `json:"flowEndReason"`
+	SourceIPv4Address        string  `json:"sourceIPv4Address,omitempty"`
+	SourceIPv6Address        string  `json:"sourceIPv6Address,omitempty"`
+	SourceTransportPort      int     `json:"sourceTransportPort"`
+	DestinationIPv4Address   string  `json:"destinationIPv4Address,omitempty"`
+	DestinationIPv6Address   string  `json:"destinationIPv6Address,omitempty"`
+	DestinationTransportPort int     `json:"destinationTransportPort"`
+	ProtocolIdentifier       int     `json:"protocolIdentifier"`
+	BiflowDirection          int     `json:"biflowDirection"`
+	OctetDeltaCount          int64   `json:"octetDeltaCount"`
+	ReverseOctetDeltaCount   int64   `json:"reverseOctetDeltaCount"`
+	SamplingProbability      float64 `json:"samplingProbability"`
+
+	KrakenInfoHash     string `json:"krakenInfoHash"`
+	KrakenLocalPeerID  string `json:"krakenLocalPeerId"`
+	KrakenRemotePeerID string `json:"krakenRemotePeerId"`
+	KrakenLocalZone    string `json:"krakenLocalZone,omitempty"`
+	KrakenRemoteZone   string `json:"krakenRemoteZone,omitempty"`
+}
+
+// FlowExporter exports flow summaries.
+type FlowExporter interface {
+	Export(f *Flow)
+
+	// Close sends all queued flows. Flows must not be exported after Close.
+	Close()
+}
+
+type flowExporter struct {
+	exporters []*exporter
+}
+
+// NewFlowExporter creates a FlowExporter which sends flows to all configured
+// exporters.
+func NewFlowExporter(configs []ExporterConfig, stats tally.Scope) (FlowExporter, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("no exporters supplied")
+	}
+	stats = stats.Tagged(map[string]string{"module": "flowexport"})
+	e := new(flowExporter)
+	for i, c := range configs {
+		exp, err := newExporter(c, stats)
+		if err != nil {
+			e.Close()
+			return nil, fmt.Errorf("exporter %d: %s", i, err)
+		}
+		e.exporters = append(e.exporters, exp)
+	}
+	return e, nil
+}
+
+func (e *flowExporter) Export(f *Flow) {
+	for _, exp := range e.exporters {
+		exp.produce(f)
+	}
+}
+
+func (e *flowExporter) Close() {
+	for _, exp := range e.exporters {
+		exp.close()
+	}
+}
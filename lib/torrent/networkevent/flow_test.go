@@ -0,0 +1,87 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestFlowExporterSendsFlowsToAllExporters(t *testing.T) {
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var flows []*Flow
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var body struct {
+			Records []struct {
+				Value *Flow `json:"value"`
+			} `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, rec := range body.Records {
+			flows = append(flows, rec.Value)
+		}
+		w.Write([]byte(`{"offsets": []}`))
+	}))
+	defer server.Close()
+
+	e, err := NewFlowExporter([]ExporterConfig{
+		{Type: Kafka, URL: server.URL, Topic: "flows-a"},
+		{Type: Kafka, URL: server.URL, Topic: "flows-b"},
+	}, tally.NoopScope)
+	require.NoError(err)
+
+	f := &Flow{
+		FlowEndReason:          FlowEndOfFlow,
+		SourceIPv4Address:      "10.0.0.1",
+		OctetDeltaCount:        10,
+		ReverseOctetDeltaCount: 20,
+		KrakenInfoHash:         "abc",
+	}
+	e.Export(f)
+	e.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal([]*Flow{f, f}, flows)
+}
+
+func TestNewFlowExporterErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		configs []ExporterConfig
+	}{
+		{"no exporters", nil},
+		{"invalid exporter", []ExporterConfig{{Type: Kafka, URL: "http://x"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewFlowExporter(test.configs, tally.NoopScope)
+			require.Error(t, err)
+		})
+	}
+}
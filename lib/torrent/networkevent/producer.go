@@ -19,7 +19,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
 )
 
 // Producer emits events.
@@ -29,58 +32,118 @@ type Producer interface {
 }
 
 type producer struct {
-	file *os.File
+	file      *os.File
+	fileV2    *os.File
+	exporters []*exporter
+}
+
+type options struct {
+	stats tally.Scope
+}
+
+// Option allows setting optional Producer parameters.
+type Option func(*options)
+
+// WithStats configures the scope exporters emit metrics to.
+func WithStats(stats tally.Scope) Option {
+	return func(o *options) { o.stats = stats }
 }
 
 // NewProducer creates a new Producer.
-func NewProducer(config Config) (Producer, error) {
-	var f *os.File
+func NewProducer(config Config, opts ...Option) (Producer, error) {
+	o := options{stats: tally.NoopScope}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	stats := o.stats.Tagged(map[string]string{"module": "networkevent"})
+
+	p := new(producer)
 	if config.Enabled {
-		if config.LogPath == "" {
-			return nil, errors.New("no log path supplied")
+		f, err := openLog(config.LogPath)
+		if err != nil {
+			return nil, err
 		}
-		var flag int
-		if _, err := os.Stat(config.LogPath); err != nil {
-			if os.IsNotExist(err) {
-				flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
-			} else {
-				return nil, fmt.Errorf("stat: %s", err)
-			}
-		} else {
-			flag = os.O_WRONLY | os.O_APPEND
+		p.file = f
+	}
+	if config.V2.Enabled {
+		f, err := openLog(config.V2.LogPath)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("v2: %s", err)
 		}
-		var err error
-		f, err = os.OpenFile(config.LogPath, flag, 0775)
+		p.fileV2 = f
+	}
+	for i, c := range config.Exporters {
+		e, err := newExporter(c, stats)
 		if err != nil {
-			return nil, fmt.Errorf("open %d: %s", flag, err)
+			p.Close()
+			return nil, fmt.Errorf("exporter %d: %s", i, err)
 		}
-	} else {
+		p.exporters = append(p.exporters, e)
+	}
+	if p.file == nil && p.fileV2 == nil && len(p.exporters) == 0 {
 		log.Warn("Kafka network events disabled")
 	}
-	return &producer{f}, nil
+	return p, nil
 }
 
-// Produce emits a network event.
-func (p *producer) Produce(e *Event) {
-	if p.file == nil {
-		return
+// openLog opens the log at path for appending, creating it if necessary.
+func openLog(path string) (*os.File, error) {
+	if path == "" {
+		return nil, errors.New("no log path supplied")
 	}
-	b, err := json.Marshal(e)
+	var flag int
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		} else {
+			return nil, fmt.Errorf("stat: %s", err)
+		}
+	} else {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flag, 0775)
 	if err != nil {
-		log.Errorf("Error serializing network event to json: %s", err)
-		return
+		return nil, fmt.Errorf("open %d: %s", flag, err)
+	}
+	return f, nil
+}
+
+// Produce writes e to all enabled logs and queues it for all exporters.
+func (p *producer) Produce(e *Event) {
+	if p.file != nil {
+		b, err := json.Marshal(e)
+		if err != nil {
+			log.Errorf("Error serializing network event to json: %s", err)
+		} else if _, err := p.file.Write(append(b, byte('\n'))); err != nil {
+			log.Errorf("Error writing network event: %s", err)
+		}
+	}
+	if p.fileV2 != nil {
+		b, err := marshalV2(e)
+		if err != nil {
+			log.Errorf("Error serializing network event to protobuf: %s", err)
+		} else if _, err := p.fileV2.Write(b); err != nil {
+			log.Errorf("Error writing v2 network event: %s", err)
+		}
 	}
-	line := append(b, byte('\n'))
-	if _, err := p.file.Write(line); err != nil {
-		log.Errorf("Error writing network event: %s", err)
-		return
+	for _, exp := range p.exporters {
+		exp.produce(e)
 	}
 }
 
-// Close closes the producer.
 func (p *producer) Close() error {
-	if p.file == nil {
-		return nil
+	for _, e := range p.exporters {
+		e.close()
+	}
+	var errs []error
+	for _, f := range []*os.File{p.file, p.fileV2} {
+		if f == nil {
+			continue
+		}
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return p.file.Close()
+	return errutil.Join(errs)
 }
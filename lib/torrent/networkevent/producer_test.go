@@ -93,3 +93,48 @@ func TestDisabledProducerNoops(t *testing.T) {
 
 	p.Produce(ReceivePieceEvent(h, peer1, peer2, 1))
 }
+
+func TestProducerDualWrite(t *testing.T) {
+	require := require.New(t)
+
+	h := core.InfoHashFixture()
+	peer1 := core.PeerIDFixture()
+	peer2 := core.PeerIDFixture()
+
+	dir, err := ioutil.TempDir("", "")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := Config{
+		Enabled: true,
+		LogPath: filepath.Join(dir, "netevents"),
+		V2: V2Config{
+			Enabled: true,
+			LogPath: filepath.Join(dir, "netevents.v2"),
+		},
+	}
+
+	events := []*Event{
+		AddActiveConnEvent(h, peer1, peer2),
+		ReceivePieceEvent(h, peer1, peer2, 1),
+	}
+
+	p, err := NewProducer(config)
+	require.NoError(err)
+	for _, e := range events {
+		p.Produce(e)
+	}
+	require.NoError(p.Close())
+
+	for path, schema := range map[string]int{
+		config.LogPath:    SchemaV1,
+		config.V2.LogPath: SchemaV2,
+	} {
+		f, err := os.Open(path)
+		require.NoError(err)
+		results, err := ReadAll(f, schema)
+		f.Close()
+		require.NoError(err)
+		require.Equal(StripTimestamps(events), StripTimestamps(results))
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	pb "github.com/uber/kraken/gen/go/proto/networkevent"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Schema versions of network event logs.
+const (
+	// SchemaV1 events are newline delimited JSON.
+	SchemaV1 = 1
+
+	// SchemaV2 events are varint length delimited protobuf, as defined in
+	// proto/networkevent/networkevent.proto.
+	SchemaV2 = 2
+)
+
+var _namesToProto = map[Name]pb.EventName{
+	AddTorrent:       pb.EventName_ADD_TORRENT,
+	AddActiveConn:    pb.EventName_ADD_ACTIVE_CONN,
+	DropActiveConn:   pb.EventName_DROP_ACTIVE_CONN,
+	BlacklistConn:    pb.EventName_BLACKLIST_CONN,
+	RequestPiece:     pb.EventName_REQUEST_PIECE,
+	ReceivePiece:     pb.EventName_RECEIVE_PIECE,
+	TorrentComplete:  pb.EventName_TORRENT_COMPLETE,
+	TorrentCancelled: pb.EventName_TORRENT_CANCELLED,
+}
+
+var _namesFromProto = func() map[pb.EventName]Name {
+	m := make(map[pb.EventName]Name, len(_namesToProto))
+	for name, p := range _namesToProto {
+		m[p] = name
+	}
+	return m
+}()
+
+// Proto converts e to the v2 schema.
+func (e *Event) Proto() *pb.Event {
+	return &pb.Event{
+		Name:           _namesToProto[e.Name],
+		Torrent:        e.Torrent,
+		Self:           e.Self,
+		TimestampNanos: e.Time.UnixNano(),
+		Peer:           e.Peer,
+		Piece:          int32(e.Piece),
+		Bitfield:       e.Bitfield,
+		DurationMs:     e.DurationMS,
+		ConnCapacity:   int32(e.ConnCapacity),
+	}
+}
+
+// FromProto converts a v2 event to an Event. Returns false if the name of p
+// is unknown, e.g. because it was added in a newer schema.
+func FromProto(p *pb.Event) (*Event, bool) {
+	name, ok := _namesFromProto[p.Name]
+	if !ok {
+		return nil, false
+	}
+	return &Event{
+		Name:         name,
+		Torrent:      p.Torrent,
+		Self:         p.Self,
+		Time:         time.Unix(0, p.TimestampNanos),
+		Peer:         p.Peer,
+		Piece:        int(p.Piece),
+		Bitfield:     p.Bitfield,
+		DurationMS:   p.DurationMs,
+		ConnCapacity: int(p.ConnCapacity),
+	}, true
+}
+
+// marshalV2 encodes e as a length delimited v2 event.
+func marshalV2(e *Event) ([]byte, error) {
+	b, err := proto.Marshal(e.Proto())
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(b))
+	n := binary.PutUvarint(buf, uint64(len(b)))
+	return append(buf[:n], b...), nil
+}
+
+// _maxEventSize bounds the size of v2 events, which protects against
+// allocating for a corrupted length.
+const _maxEventSize = 16 * 1024 * 1024
+
+// Decoder reads network events from a log of either schema.
+type Decoder struct {
+	r      *bufio.Reader
+	schema int
+}
+
+// NewDecoder returns a Decoder which reads events of the given schema from r.
+func NewDecoder(r io.Reader, schema int) (*Decoder, error) {
+	if schema != SchemaV1 && schema != SchemaV2 {
+		return nil, fmt.Errorf("unknown schema %d", schema)
+	}
+	return &Decoder{bufio.NewReader(r), schema}, nil
+}
+
+// Decode returns the next event, or io.EOF once all events have been read.
+// Blank lines of v1 logs and v2 events with names unknown to this version of
+// the schema are skipped. After an error from a malformed event, Decode may be
+// called again to continue with the next event, unless the length of a v2
+// event was corrupted.
+func (d *Decoder) Decode() (*Event, error) {
+	for {
+		var e *Event
+		var err error
+		if d.schema == SchemaV1 {
+			e, err = d.decodeV1()
+		} else {
+			e, err = d.decodeV2()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			return e, nil
+		}
+	}
+}
+
+func (d *Decoder) decodeV1() (*Event, error) {
+	line, err := d.r.ReadBytes('\n')
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil, err
+	}
+	e := new(Event)
+	if err := json.Unmarshal(line, e); err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	return e, nil
+}
+
+func (d *Decoder) decodeV2() (*Event, error) {
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > _maxEventSize {
+		return nil, fmt.Errorf("event size %d exceeds limit", size)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	p := new(pb.Event)
+	if err := proto.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("proto: %s", err)
+	}
+	e, _ := FromProto(p)
+	return e, nil
+}
+
+// ReadAll reads all events of the given schema from r.
+func ReadAll(r io.Reader, schema int) ([]*Event, error) {
+	d, err := NewDecoder(r, schema)
+	if err != nil {
+		return nil, err
+	}
+	var events []*Event
+	for {
+		e, err := d.Decode()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package networkevent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	pb "github.com/uber/kraken/gen/go/proto/networkevent"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/require"
+	"github.com/willf/bitset"
+)
+
+func eventsFixture() []*Event {
+	h := core.InfoHashFixture()
+	self := core.PeerIDFixture()
+	peer := core.PeerIDFixture()
+	return []*Event{
+		AddTorrentEvent(h, self, bitset.New(4).Set(1), 10),
+		AddActiveConnEvent(h, self, peer),
+		BlacklistConnEvent(h, self, peer, 30*time.Second),
+		ReceivePieceEvent(h, self, peer, 3),
+		TorrentCompleteEvent(h, self),
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	for _, e := range eventsFixture() {
+		result, ok := FromProto(e.Proto())
+		require.True(ok)
+		require.True(e.Time.Equal(result.Time))
+		require.Equal(StripTimestamps([]*Event{e}), StripTimestamps([]*Event{result}))
+	}
+}
+
+func TestDecoderV2SkipsUnknownNames(t *testing.T) {
+	require := require.New(t)
+
+	events := eventsFixture()
+
+	var buf bytes.Buffer
+	b, err := marshalV2(events[0])
+	require.NoError(err)
+	buf.Write(b)
+
+	// An event added in a future version of the schema.
+	unknown, err := proto.Marshal(&pb.Event{Name: pb.EventName(100), Torrent: "foo"})
+	require.NoError(err)
+	size := make([]byte, binary.MaxVarintLen64)
+	buf.Write(size[:binary.PutUvarint(size, uint64(len(unknown)))])
+	buf.Write(unknown)
+
+	b, err = marshalV2(events[1])
+	require.NoError(err)
+	buf.Write(b)
+
+	results, err := ReadAll(&buf, SchemaV2)
+	require.NoError(err)
+	require.Equal(StripTimestamps(events[:2]), StripTimestamps(results))
+}
+
+func TestDecoderV1(t *testing.T) {
+	require := require.New(t)
+
+	events := eventsFixture()
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		buf.WriteString(e.JSON() + "\n")
+	}
+	buf.WriteString("\n")
+
+	results, err := ReadAll(&buf, SchemaV1)
+	require.NoError(err)
+	require.Equal(StripTimestamps(events), StripTimestamps(results))
+}
+
+func TestDecoderContinuesAfterMalformedEvent(t *testing.T) {
+	require := require.New(t)
+
+	e := eventsFixture()[0]
+
+	var buf bytes.Buffer
+	buf.WriteString("not json\n")
+	buf.WriteString(e.JSON())
+
+	d, err := NewDecoder(&buf, SchemaV1)
+	require.NoError(err)
+
+	_, err = d.Decode()
+	require.Error(err)
+
+	result, err := d.Decode()
+	require.NoError(err)
+	require.Equal(StripTimestamps([]*Event{e}), StripTimestamps([]*Event{result}))
+
+	_, err = d.Decode()
+	require.Equal(io.EOF, err)
+}
+
+func TestDecoderV2TruncatedEvent(t *testing.T) {
+	require := require.New(t)
+
+	b, err := marshalV2(eventsFixture()[0])
+	require.NoError(err)
+
+	_, err = ReadAll(bytes.NewReader(b[:len(b)-1]), SchemaV2)
+	require.Equal(io.ErrUnexpectedEOF, err)
+}
+
+func TestNewDecoderUnknownSchema(t *testing.T) {
+	_, err := NewDecoder(new(bytes.Buffer), 3)
+	require.Error(t, err)
+}
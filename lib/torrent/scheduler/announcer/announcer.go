@@ -84,15 +84,20 @@ func Default(
 	return New(Config{}, client, events, clk, logger)
 }
 
-// Announce announces through the underlying client and returns the resulting
-// peer handout. Updates the announce interval if it has changed.
+// Announce announces r through the underlying client using the latest announce
+// version, and returns the resulting peer handout, which will not include any
+// peers in r.Exclude, and the time to wait before announcing the torrent again.
+// A zero wait means the torrent may announce on the next tick. Updates the
+// announce interval if it has changed.
 func (a *Announcer) Announce(
-	d core.Digest, h core.InfoHash, complete bool) ([]*core.PeerInfo, error) {
+	r announceclient.AnnounceRequest) ([]*core.PeerInfo, time.Duration, error) {
 
-	peers, interval, err := a.client.Announce(d, h, complete, announceclient.V2)
+	r.Version = announceclient.V2
+	resp, err := a.client.Announce(r)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	interval := resp.Interval
 	if interval == 0 {
 		// Protect against unset intervals.
 		interval = a.config.DefaultInterval
@@ -107,7 +112,11 @@ func (a *Announcer) Announce(
 		// Note: updated interval will take effect after next tick.
 		a.logger.Infof("Announce interval updated to %s", interval)
 	}
-	return peers, nil
+	wait := resp.TorrentInterval
+	if wait > a.config.MaxInterval {
+		wait = a.config.MaxInterval
+	}
+	return resp.Peers, wait, nil
 }
 
 // Ticker emits AnnounceTick events at the current announce interval, which may be
@@ -30,7 +30,10 @@ import (
 
 // How long to wait for the Ticker goroutine to fire / not fire. Fairly large
 // to prevent flakey tests.
-const _tickerTimeout = time.Second
+const (
+	_testNamespace = "test-namespace"
+	_tickerTimeout = time.Second
+)
 
 type mockEvents struct {
 	tick chan struct{}
@@ -97,11 +100,22 @@ func TestAnnouncerAnnounceUpdatesInterval(t *testing.T) {
 	interval := 10 * time.Second
 	peers := []*core.PeerInfo{core.PeerInfoFixture()}
 
-	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(peers, interval, nil)
-
-	result, err := announcer.Announce(d, hash, false)
+	mocks.client.EXPECT().Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+		Version:   announceclient.V2,
+	}).Return(
+		&announceclient.Response{Peers: peers, Interval: interval}, nil)
+
+	result, wait, err := announcer.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+	})
 	require.NoError(err)
 	require.Equal(peers, result)
+	require.Equal(time.Duration(0), wait)
 
 	mocks.clk.Add(config.DefaultInterval)
 	mocks.events.expectTick(t)
@@ -129,8 +143,105 @@ func TestAnnouncerAnnounceErr(t *testing.T) {
 	hash := core.InfoHashFixture()
 	err := errors.New("some error")
 
-	mocks.client.EXPECT().Announce(d, hash, false, announceclient.V2).Return(nil, time.Duration(0), err)
-
-	_, aErr := announcer.Announce(d, hash, false)
+	mocks.client.EXPECT().Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+		Version:   announceclient.V2,
+	}).Return(nil, err)
+
+	_, _, aErr := announcer.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+	})
 	require.Equal(err, aErr)
 }
+
+func TestAnnouncerAnnounceReturnsTorrentInterval(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newAnnouncerMocks(t)
+	defer cleanup()
+
+	config := Config{MaxInterval: time.Minute}
+
+	announcer := mocks.newAnnouncer(config)
+
+	d := core.DigestFixture()
+	hash := core.InfoHashFixture()
+
+	mocks.client.EXPECT().Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+		Version:   announceclient.V2,
+	}).Return(
+		&announceclient.Response{TorrentInterval: 30 * time.Second}, nil)
+
+	_, wait, err := announcer.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+	})
+	require.NoError(err)
+	require.Equal(30*time.Second, wait)
+
+	// Suggestions above the max interval are capped.
+	mocks.client.EXPECT().Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+		Version:   announceclient.V2,
+	}).Return(
+		&announceclient.Response{TorrentInterval: time.Hour}, nil)
+
+	_, wait, err = announcer.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+	})
+	require.NoError(err)
+	require.Equal(config.MaxInterval, wait)
+}
+
+func TestAnnouncerIgnoresIntervalAboveMaxOverLongHorizon(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newAnnouncerMocks(t)
+	defer cleanup()
+
+	config := Config{DefaultInterval: time.Hour, MaxInterval: 6 * time.Hour}
+
+	announcer := mocks.newAnnouncer(config)
+
+	done := make(chan struct{})
+	defer close(done)
+	go announcer.Ticker(done)
+
+	d := core.DigestFixture()
+	hash := core.InfoHashFixture()
+
+	// A misconfigured tracker asks for a 48h interval, which would stop ticks
+	// for two days if it were honored.
+	mocks.client.EXPECT().Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+		Version:   announceclient.V2,
+	}).Return(
+		&announceclient.Response{Interval: 48 * time.Hour}, nil)
+
+	_, _, err := announcer.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    d,
+		InfoHash:  hash,
+	})
+	require.NoError(err)
+
+	// Ticks keep firing at the default interval for a full day.
+	for i := 0; i < 24; i++ {
+		mocks.clk.Add(config.DefaultInterval)
+		mocks.events.expectTick(t)
+	}
+}
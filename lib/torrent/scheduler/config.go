@@ -19,9 +19,14 @@ import (
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/utils/log"
 )
 
+// PeerExchangeFlag is the feature flag which enables peer exchange per
+// namespace.
+const PeerExchangeFlag = "peer_exchange"
+
 // Config is the Scheduler configuration.
 type Config struct {
 
@@ -54,12 +59,46 @@ type Config struct {
 
 	ProbeTimeout time.Duration `yaml:"probe_timeout"`
 
+	// PeerExchangeInterval is the interval in which the Scheduler shares the
+	// addresses of connected peers with the other peers of each torrent, so
+	// swarms can keep finding peers while the tracker is unavailable.
+	PeerExchangeInterval time.Duration `yaml:"peer_exchange_interval"`
+
+	// MaxExchangedPeers is the max number of peer addresses shared with a peer
+	// in a single peer exchange message.
+	MaxExchangedPeers int `yaml:"max_exchanged_peers"`
+
+	// DisablePeerExchange disables sharing and connecting to peer addresses
+	// received from other peers, regardless of PeerExchangeFlag.
+	DisablePeerExchange bool `yaml:"disable_peer_exchange"`
+
+	// DiscardIncompleteTorrents deletes the downloaded pieces of torrents
+	// which time out before completing. By default, the pieces are kept on
+	// disk and re-verified once the torrent is downloaded again.
+	DiscardIncompleteTorrents bool `yaml:"discard_incomplete_torrents"`
+
+	// SeedingPolicies override how complete torrents are seeded by namespace.
+	// The first matching policy applies, and torrents matching no policy are
+	// seeded until SeederTTI.
+	SeedingPolicies []SeedingPolicy `yaml:"seeding_policies"`
+
+	// DialOriginsFirst opens connections to origin peers before agent peers
+	// when handling announce results and exchanged peers.
+	DialOriginsFirst bool `yaml:"dial_origins_first"`
+
+	// Flows exports summaries of the traffic of peer connections.
+	Flows FlowConfig `yaml:"flows"`
+
 	ConnState connstate.Config `yaml:"connstate"`
 
 	Conn conn.Config `yaml:"conn"`
 
 	Dispatch dispatch.Config `yaml:"dispatch"`
 
+	// PieceRequestFairness shares a global limit of pending piece requests
+	// between torrents.
+	PieceRequestFairness piecerequest.AllocatorConfig `yaml:"piece_request_fairness"`
+
 	TorrentLog log.Config `yaml:"torrentlog"`
 	Log        log.Config `yaml:"log"`
 }
@@ -86,5 +125,11 @@ func (c Config) applyDefaults() Config {
 	if c.ProbeTimeout == 0 {
 		c.ProbeTimeout = 3 * time.Second
 	}
+	if c.PeerExchangeInterval == 0 {
+		c.PeerExchangeInterval = 30 * time.Second
+	}
+	if c.MaxExchangedPeers == 0 {
+		c.MaxExchangedPeers = 50
+	}
 	return c
 }
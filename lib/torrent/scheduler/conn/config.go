@@ -38,6 +38,9 @@ type Config struct {
 	ReceiverBufferSize int `yaml:"receiver_buffer_size"`
 
 	Bandwidth bandwidth.Config `yaml:"bandwidth"`
+
+	// Dial configures how peers announcing multiple addresses are dialed.
+	Dial DialConfig `yaml:"dial"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -67,6 +67,10 @@ type Conn struct {
 	// Marks whether the connection was opened by the remote peer, or the local peer.
 	openedByRemote bool
 
+	// Bytes read from and written to nc, including protocol messages.
+	bytesIn  *atomic.Int64
+	bytesOut *atomic.Int64
+
 	startOnce sync.Once
 
 	sender   chan *Message
@@ -100,6 +104,9 @@ func newConn(
 		return nil, fmt.Errorf("set deadline: %s", err)
 	}
 
+	bytesIn := atomic.NewInt64(0)
+	bytesOut := atomic.NewInt64(0)
+
 	c := &Conn{
 		peerID:         remotePeerID,
 		infoHash:       info.InfoHash(),
@@ -107,12 +114,14 @@ func newConn(
 		localPeerID:    localPeerID,
 		bandwidth:      bandwidth,
 		events:         events,
-		nc:             nc,
+		nc:             &countingConn{nc, bytesIn, bytesOut},
 		config:         config,
 		clk:            clk,
 		stats:          stats,
 		networkEvents:  networkEvents,
 		openedByRemote: openedByRemote,
+		bytesIn:        bytesIn,
+		bytesOut:       bytesOut,
 		sender:         make(chan *Message, config.SenderBufferSize),
 		receiver:       make(chan *Message, config.ReceiverBufferSize),
 		closed:         atomic.NewBool(false),
@@ -150,6 +159,31 @@ func (c *Conn) CreatedAt() time.Time {
 	return c.createdAt
 }
 
+// OpenedByRemote returns true if the remote peer opened c.
+func (c *Conn) OpenedByRemote() bool {
+	return c.openedByRemote
+}
+
+// LocalAddr returns the local network address of c.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.nc.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address of c.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.nc.RemoteAddr()
+}
+
+// BytesIn returns the number of bytes received over c since it was created.
+func (c *Conn) BytesIn() int64 {
+	return c.bytesIn.Load()
+}
+
+// BytesOut returns the number of bytes sent over c since it was created.
+func (c *Conn) BytesOut() int64 {
+	return c.bytesOut.Load()
+}
+
 func (c *Conn) String() string {
 	return fmt.Sprintf("Conn(peer=%s, hash=%s, opened_by_remote=%t)",
 		c.peerID, c.infoHash, c.openedByRemote)
@@ -312,3 +346,36 @@ func (c *Conn) log(keysAndValues ...interface{}) *zap.SugaredLogger {
 	keysAndValues = append(keysAndValues, "remote_peer", c.peerID, "hash", c.infoHash)
 	return c.logger.With(keysAndValues...)
 }
+
+// countingConn counts the bytes read from and written to a net.Conn.
+type countingConn struct {
+	net.Conn
+	in  *atomic.Int64
+	out *atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.in.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.out.Add(int64(n))
+	return n, err
+}
+
+// ReadFrom preserves the ReadFrom optimizations of the wrapped net.Conn, e.g.
+// sendfile for piece payloads read from files.
+func (c *countingConn) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	var err error
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{c.Conn}, r)
+	}
+	c.out.Add(n)
+	return n, err
+}
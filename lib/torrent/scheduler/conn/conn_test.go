@@ -16,6 +16,9 @@ package conn
 import (
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/uber/kraken/lib/torrent/storage"
 
 	"github.com/stretchr/testify/require"
 )
@@ -40,3 +43,25 @@ func TestConnClose(t *testing.T) {
 
 	require.True(c.IsClosed())
 }
+
+func TestConnCountsBytes(t *testing.T) {
+	require := require.New(t)
+
+	local, remote, cleanup := PipeFixture(Config{}, storage.TorrentInfoFixture(1, 1))
+	defer cleanup()
+
+	require.NoError(local.Send(NewAnnouncePieceMessage(0)))
+
+	select {
+	case <-remote.Receiver():
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for message")
+	}
+
+	require.True(local.BytesOut() > 0)
+	require.Equal(local.BytesOut(), remote.BytesIn())
+	require.Equal(int64(0), local.BytesIn())
+	require.Equal(int64(0), remote.BytesOut())
+	require.False(local.OpenedByRemote())
+	require.True(remote.OpenedByRemote())
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Dial strategies.
+const (
+	// DialSequential dials the addresses of a peer one after another, until
+	// one connects.
+	DialSequential = "sequential"
+
+	// DialHappyEyeballs starts dialing the next address of a peer if the
+	// previous attempt has not connected within the fallback delay, and keeps
+	// the first connection established, similar to RFC 8305.
+	DialHappyEyeballs = "happy_eyeballs"
+)
+
+// DialConfig defines how peers which announce multiple addresses are dialed.
+type DialConfig struct {
+	// Strategy is DialHappyEyeballs or DialSequential. Defaults to
+	// DialHappyEyeballs.
+	Strategy string `yaml:"strategy"`
+
+	// Prefer orders the addresses of a peer by family before dialing, either
+	// "ipv4" or "ipv6", alternating families after the first address. If
+	// empty, addresses are dialed in the order the peer announced them.
+	Prefer string `yaml:"prefer"`
+
+	// FallbackDelay is how long a happy eyeballs attempt may be pending before
+	// the next address is dialed.
+	FallbackDelay time.Duration `yaml:"fallback_delay"`
+}
+
+func (c DialConfig) applyDefaults() DialConfig {
+	if c.Strategy == "" {
+		c.Strategy = DialHappyEyeballs
+	}
+	if c.FallbackDelay == 0 {
+		c.FallbackDelay = 300 * time.Millisecond
+	}
+	return c
+}
+
+func (c DialConfig) validate() error {
+	switch c.Strategy {
+	case DialSequential, DialHappyEyeballs:
+	default:
+		return fmt.Errorf("unknown dial strategy %q", c.Strategy)
+	}
+	switch c.Prefer {
+	case "", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("unknown address family %q", c.Prefer)
+	}
+	return nil
+}
+
+type dialFunc func(network, addr string, timeout time.Duration) (net.Conn, error)
+
+// dialer connects to one of the addresses of a peer.
+type dialer struct {
+	config  DialConfig
+	timeout time.Duration
+	clk     clock.Clock
+	stats   tally.Scope
+	dial    dialFunc
+}
+
+func newDialer(
+	config DialConfig, timeout time.Duration, clk clock.Clock, stats tally.Scope) (*dialer, error) {
+
+	config = config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &dialer{config, timeout, clk, stats, net.DialTimeout}, nil
+}
+
+type dialResult struct {
+	nc    net.Conn
+	addr  string
+	index int
+	err   error
+}
+
+// Dial connects to the first reachable address of addrs.
+func (d *dialer) Dial(addrs []string) (net.Conn, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("no addresses")
+	}
+	addrs = sortAddrs(addrs, d.config.Prefer)
+
+	var r dialResult
+	if d.config.Strategy == DialSequential || len(addrs) == 1 {
+		r = d.dialSequential(addrs)
+	} else {
+		r = d.dialHappyEyeballs(addrs)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.index > 0 {
+		d.stats.Counter("dial_fallbacks").Inc(1)
+	}
+	return r.nc, nil
+}
+
+func (d *dialer) dialSequential(addrs []string) dialResult {
+	var errs []string
+	for i, addr := range addrs {
+		nc, err := d.dial("tcp", addr, d.timeout)
+		if err == nil {
+			return dialResult{nc: nc, addr: addr, index: i}
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", addr, err))
+	}
+	return dialResult{err: fmt.Errorf("dial %s", strings.Join(errs, "; "))}
+}
+
+func (d *dialer) dialHappyEyeballs(addrs []string) dialResult {
+	results := make(chan dialResult, len(addrs))
+
+	var next, pending int
+	start := func() {
+		i := next
+		next++
+		pending++
+		go func() {
+			nc, err := d.dial("tcp", addrs[i], d.timeout)
+			results <- dialResult{nc, addrs[i], i, err}
+		}()
+	}
+
+	start()
+	fallback := d.clk.After(d.config.FallbackDelay)
+
+	var errs []string
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close the connections of attempts which are still pending.
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if r := <-results; r.err == nil {
+							r.nc.Close()
+						}
+					}
+				}(pending)
+				return r
+			}
+			errs = append(errs, fmt.Sprintf("%s: %s", r.addr, r.err))
+			if next < len(addrs) {
+				// Fail fast to the next address.
+				start()
+				fallback = d.clk.After(d.config.FallbackDelay)
+			}
+		case <-fallback:
+			if next < len(addrs) {
+				start()
+				fallback = d.clk.After(d.config.FallbackDelay)
+			}
+		}
+	}
+	return dialResult{err: fmt.Errorf("dial %s", strings.Join(errs, "; "))}
+}
+
+// sortAddrs orders addrs by family, starting with the preferred family and
+// alternating families afterwards. Addresses which are not IP literals are
+// dialed last. If prefer is empty, addrs is returned as is.
+func sortAddrs(addrs []string, prefer string) []string {
+	if prefer == "" {
+		return addrs
+	}
+	var preferred, other, unknown []string
+	for _, addr := range addrs {
+		switch addrFamily(addr) {
+		case prefer:
+			preferred = append(preferred, addr)
+		case "":
+			unknown = append(unknown, addr)
+		default:
+			other = append(other, addr)
+		}
+	}
+	sorted := make([]string, 0, len(addrs))
+	for i := 0; i < len(preferred) || i < len(other); i++ {
+		if i < len(preferred) {
+			sorted = append(sorted, preferred[i])
+		}
+		if i < len(other) {
+			sorted = append(sorted, other[i])
+		}
+	}
+	return append(sorted, unknown...)
+}
+
+// addrFamily returns "ipv4" or "ipv6" for host:port addresses with an IP
+// literal host, else empty.
+func addrFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conn
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
+)
+
+// fakeDial returns a dialFunc which connects to the addresses in reachable,
+// blocks on the addresses in hanging until release is closed, and fails for
+// all other addresses. Dialed addresses are recorded in order.
+type fakeDial struct {
+	reachable map[string]bool
+	hanging   map[string]bool
+	release   chan struct{}
+
+	mu     sync.Mutex
+	dialed []string
+	opened []*fakeConn
+}
+
+type fakeConn struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+func newFakeDial() *fakeDial {
+	return &fakeDial{
+		reachable: make(map[string]bool),
+		hanging:   make(map[string]bool),
+		release:   make(chan struct{}),
+	}
+}
+
+func (f *fakeDial) dial(network, addr string, timeout time.Duration) (net.Conn, error) {
+	f.mu.Lock()
+	f.dialed = append(f.dialed, addr)
+	f.mu.Unlock()
+
+	if f.hanging[addr] {
+		<-f.release
+	} else if !f.reachable[addr] {
+		return nil, errors.New("connection refused")
+	}
+	pipe, _ := net.Pipe()
+	nc := &fakeConn{Conn: pipe}
+	f.mu.Lock()
+	f.opened = append(f.opened, nc)
+	f.mu.Unlock()
+	return nc, nil
+}
+
+func (f *fakeDial) dialedAddrs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.dialed...)
+}
+
+func newTestDialer(t *testing.T, config DialConfig, f *fakeDial) (*dialer, tally.TestScope) {
+	return newTestDialerWithClock(t, config, f, clock.New())
+}
+
+func newTestDialerWithClock(
+	t *testing.T, config DialConfig, f *fakeDial, clk clock.Clock) (*dialer, tally.TestScope) {
+
+	stats := tally.NewTestScope("", nil)
+	d, err := newDialer(config, time.Second, clk, stats)
+	require.NoError(t, err)
+	d.dial = f.dial
+	return d, stats
+}
+
+func TestDialerHappyEyeballsFallsBackAfterDelay(t *testing.T) {
+	require := require.New(t)
+
+	f := newFakeDial()
+	f.hanging["10.0.0.1:80"] = true
+	f.reachable["[fd00::1]:80"] = true
+
+	d, stats := newTestDialer(t, DialConfig{FallbackDelay: 50 * time.Millisecond}, f)
+
+	start := time.Now()
+	nc, err := d.Dial([]string{"10.0.0.1:80", "[fd00::1]:80"})
+	require.NoError(err)
+	require.NotNil(nc)
+	require.True(time.Since(start) >= 50*time.Millisecond)
+	require.Equal([]string{"10.0.0.1:80", "[fd00::1]:80"}, f.dialedAddrs())
+	require.Equal(int64(1), stats.Snapshot().Counters()["dial_fallbacks+"].Value())
+
+	// The connection of the hanging attempt is closed once established.
+	close(f.release)
+	require.Eventually(func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.opened) == 2 && f.opened[1].closed.Load()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDialerHappyEyeballsWaitsForFallbackDelay(t *testing.T) {
+	require := require.New(t)
+
+	f := newFakeDial()
+	f.hanging["10.0.0.1:80"] = true
+	f.reachable["10.0.0.2:80"] = true
+	defer close(f.release)
+
+	clk := clock.NewMock()
+	d, _ := newTestDialerWithClock(t, DialConfig{FallbackDelay: time.Hour}, f, clk)
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := d.Dial([]string{"10.0.0.1:80", "10.0.0.2:80"})
+		errc <- err
+	}()
+
+	secondDialed := func() bool { return len(f.dialedAddrs()) > 1 }
+
+	require.Eventually(func() bool {
+		return len(f.dialedAddrs()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Never(secondDialed, 100*time.Millisecond, 10*time.Millisecond)
+
+	// The second address is not dialed before the fallback delay has passed.
+	clk.Add(59 * time.Minute)
+	require.Never(secondDialed, 100*time.Millisecond, 10*time.Millisecond)
+
+	clk.Add(time.Minute)
+	select {
+	case err := <-errc:
+		require.NoError(err)
+	case <-time.After(5 * time.Second):
+		require.FailNow("timed out waiting for fallback dial")
+	}
+	require.Equal([]string{"10.0.0.1:80", "10.0.0.2:80"}, f.dialedAddrs())
+}
+
+func TestDialerHappyEyeballsFailsFastToNextAddress(t *testing.T) {
+	require := require.New(t)
+
+	f := newFakeDial()
+	f.reachable["10.0.0.2:80"] = true
+
+	d, _ := newTestDialer(t, DialConfig{FallbackDelay: time.Hour}, f)
+
+	_, err := d.Dial([]string{"10.0.0.1:80", "10.0.0.2:80"})
+	require.NoError(err)
+	require.Equal([]string{"10.0.0.1:80", "10.0.0.2:80"}, f.dialedAddrs())
+}
+
+func TestDialerAllAddressesFail(t *testing.T) {
+	for _, strategy := range []string{DialSequential, DialHappyEyeballs} {
+		t.Run(strategy, func(t *testing.T) {
+			require := require.New(t)
+
+			f := newFakeDial()
+
+			d, _ := newTestDialer(t, DialConfig{Strategy: strategy}, f)
+
+			_, err := d.Dial([]string{"10.0.0.1:80", "10.0.0.2:80"})
+			require.Error(err)
+			require.Contains(err.Error(), "10.0.0.1:80")
+			require.Contains(err.Error(), "10.0.0.2:80")
+
+			_, err = d.Dial(nil)
+			require.Error(err)
+		})
+	}
+}
+
+func TestDialerSequential(t *testing.T) {
+	require := require.New(t)
+
+	f := newFakeDial()
+	f.reachable["10.0.0.2:80"] = true
+	f.reachable["10.0.0.3:80"] = true
+
+	d, _ := newTestDialer(t, DialConfig{Strategy: DialSequential}, f)
+
+	_, err := d.Dial([]string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"})
+	require.NoError(err)
+	require.Equal([]string{"10.0.0.1:80", "10.0.0.2:80"}, f.dialedAddrs())
+}
+
+func TestSortAddrs(t *testing.T) {
+	addrs := []string{
+		"10.0.0.1:80", "10.0.0.2:80", "[fd00::1]:80", "peer.example.com:80", "[fd00::2]:80",
+	}
+	tests := []struct {
+		prefer   string
+		expected []string
+	}{
+		{"", addrs},
+		{"ipv6", []string{
+			"[fd00::1]:80", "10.0.0.1:80", "[fd00::2]:80", "10.0.0.2:80", "peer.example.com:80",
+		}},
+		{"ipv4", []string{
+			"10.0.0.1:80", "[fd00::1]:80", "10.0.0.2:80", "[fd00::2]:80", "peer.example.com:80",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.prefer, func(t *testing.T) {
+			require.Equal(t, test.expected, sortAddrs(addrs, test.prefer))
+		})
+	}
+}
+
+func TestNewDialerInvalidConfig(t *testing.T) {
+	for _, config := range []DialConfig{
+		{Strategy: "parallel"},
+		{Prefer: "ipx"},
+	} {
+		_, err := newDialer(config, time.Second, clock.New(), tally.NoopScope)
+		require.Error(t, err)
+	}
+}
@@ -45,6 +45,16 @@ func (n noopDeadline) SetWriteDeadline(t time.Time) error { return nil }
 func PipeFixture(
 	config Config, info *storage.TorrentInfo) (local *Conn, remote *Conn, cleanupFunc func()) {
 
+	return PipeFixtureWithClock(config, info, clock.New())
+}
+
+// PipeFixtureWithClock returns Conns for both sides of a live connection for
+// testing, whose creation times are taken from clk.
+func PipeFixtureWithClock(
+	config Config,
+	info *storage.TorrentInfo,
+	clk clock.Clock) (local *Conn, remote *Conn, cleanupFunc func()) {
+
 	var cleanup testutil.Cleanup
 	defer cleanup.Recover()
 
@@ -54,14 +64,14 @@ func PipeFixture(
 
 	var err error
 
-	local, err = HandshakerFixture(config).newConn(
+	local, err = handshakerFixture(config, clk).newConn(
 		noopDeadline{nc1}, core.PeerIDFixture(), info, false)
 	if err != nil {
 		panic(err)
 	}
 	local.Start()
 
-	remote, err = HandshakerFixture(config).newConn(
+	remote, err = handshakerFixture(config, clk).newConn(
 		noopDeadline{nc2}, core.PeerIDFixture(), info, true)
 	if err != nil {
 		panic(err)
@@ -80,10 +90,14 @@ func Fixture() (*Conn, func()) {
 
 // HandshakerFixture returns a Handshaker for testing.
 func HandshakerFixture(config Config) *Handshaker {
+	return handshakerFixture(config, clock.New())
+}
+
+func handshakerFixture(config Config, clk clock.Clock) *Handshaker {
 	h, err := NewHandshaker(
 		config,
 		tally.NewTestScope("", nil),
-		clock.New(),
+		clk,
 		networkevent.NewTestProducer(),
 		core.PeerIDFixture(),
 		noopEvents{},
@@ -85,7 +85,7 @@ func (h *handshake) toP2PMessage() (*p2p.Message, error) {
 		Type: p2p.Message_BITFIELD,
 		Bitfield: &p2p.BitfieldMessage{
 			PeerID:              h.peerID.String(),
-			Name:                h.digest.Hex(),
+			Name:                h.digest.Name(),
 			InfoHash:            h.infoHash.String(),
 			BitfieldBytes:       b,
 			RemoteBitfieldBytes: rb,
@@ -110,7 +110,7 @@ func handshakeFromP2PMessage(m *p2p.Message) (*handshake, error) {
 	if err != nil {
 		return nil, fmt.Errorf("info hash: %s", err)
 	}
-	d, err := core.NewSHA256DigestFromHex(bitfieldMsg.Name)
+	d, err := core.NewDigestFromName(bitfieldMsg.Name)
 	if err != nil {
 		return nil, fmt.Errorf("name: %s", err)
 	}
@@ -189,6 +189,7 @@ type Handshaker struct {
 	stats         tally.Scope
 	clk           clock.Clock
 	bandwidth     *bandwidth.Limiter
+	dialer        *dialer
 	networkEvents networkevent.Producer
 	peerID        core.PeerID
 	events        Events
@@ -215,11 +216,17 @@ func NewHandshaker(
 		return nil, fmt.Errorf("bandwidth: %s", err)
 	}
 
+	dialer, err := newDialer(config.Dial, config.HandshakeTimeout, clk, stats)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %s", err)
+	}
+
 	return &Handshaker{
 		config:        config,
 		stats:         stats,
 		clk:           clk,
 		bandwidth:     bl,
+		dialer:        dialer,
 		networkEvents: networkEvents,
 		peerID:        peerID,
 		events:        events,
@@ -256,18 +263,19 @@ func (h *Handshaker) Establish(
 }
 
 // Initialize returns a fully established Conn for the given torrent to the
-// given peer / address. Also returns the bitfield of the remote peer and
-// its connections for the torrent.
+// given peer, dialing the addresses of the peer according to the configured
+// dial strategy. Also returns the bitfield of the remote peer and its
+// connections for the torrent.
 func (h *Handshaker) Initialize(
 	peerID core.PeerID,
-	addr string,
+	addrs []string,
 	info *storage.TorrentInfo,
 	remoteBitfields RemoteBitfields,
 	namespace string) (*HandshakeResult, error) {
 
-	nc, err := net.DialTimeout("tcp", addr, h.config.HandshakeTimeout)
+	nc, err := h.dialer.Dial(addrs)
 	if err != nil {
-		return nil, fmt.Errorf("dial: %s", err)
+		return nil, err
 	}
 	r, err := h.fullHandshake(nc, peerID, info, remoteBitfields, namespace)
 	if err != nil {
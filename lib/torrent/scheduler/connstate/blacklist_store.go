@@ -0,0 +1,210 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package connstate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrBlacklistQueueFull is returned by AsyncBlacklistStore when too many
+// writes are pending.
+var ErrBlacklistQueueFull = errors.New("blacklist store queue full")
+
+const _asyncBlacklistQueueSize = 1000
+
+// BlacklistRecord is a persisted blacklist entry.
+type BlacklistRecord struct {
+	PeerID     core.PeerID
+	InfoHash   core.InfoHash
+	Expiration time.Time
+}
+
+// BlacklistStore persists blacklisted connections such that they survive
+// restarts.
+type BlacklistStore interface {
+	Put(r BlacklistRecord) error
+	Delete(peerID core.PeerID, h core.InfoHash) error
+	List() ([]BlacklistRecord, error)
+}
+
+// NoopBlacklistStore does not persist anything.
+type NoopBlacklistStore struct{}
+
+// Put no-ops.
+func (NoopBlacklistStore) Put(BlacklistRecord) error { return nil }
+
+// Delete no-ops.
+func (NoopBlacklistStore) Delete(core.PeerID, core.InfoHash) error { return nil }
+
+// List returns nothing.
+func (NoopBlacklistStore) List() ([]BlacklistRecord, error) { return nil, nil }
+
+// SQLBlacklistStore persists blacklisted connections in a local database.
+type SQLBlacklistStore struct {
+	db *sqlx.DB
+}
+
+// NewSQLBlacklistStore creates a new SQLBlacklistStore.
+func NewSQLBlacklistStore(db *sqlx.DB) *SQLBlacklistStore {
+	return &SQLBlacklistStore{db}
+}
+
+type blacklistRow struct {
+	PeerID     string    `db:"peer_id"`
+	InfoHash   string    `db:"info_hash"`
+	Expiration time.Time `db:"expiration"`
+}
+
+// Put inserts or replaces r.
+func (s *SQLBlacklistStore) Put(r BlacklistRecord) error {
+	_, err := s.db.NamedExec(`
+		INSERT OR REPLACE INTO conn_blacklist (peer_id, info_hash, expiration)
+		VALUES (:peer_id, :info_hash, :expiration)
+	`, blacklistRow{r.PeerID.String(), r.InfoHash.Hex(), r.Expiration})
+	return err
+}
+
+// Delete removes the entry for peerID/h, if present.
+func (s *SQLBlacklistStore) Delete(peerID core.PeerID, h core.InfoHash) error {
+	_, err := s.db.Exec(`
+		DELETE FROM conn_blacklist
+		WHERE peer_id=? AND info_hash=?
+	`, peerID.String(), h.Hex())
+	return err
+}
+
+// List returns all persisted entries.
+func (s *SQLBlacklistStore) List() ([]BlacklistRecord, error) {
+	var rows []blacklistRow
+	if err := s.db.Select(&rows, `
+		SELECT peer_id, info_hash, expiration
+		FROM conn_blacklist
+	`); err != nil {
+		return nil, err
+	}
+	var records []BlacklistRecord
+	for _, row := range rows {
+		peerID, err := core.NewPeerID(row.PeerID)
+		if err != nil {
+			return nil, fmt.Errorf("parse peer id: %s", err)
+		}
+		h, err := core.NewInfoHashFromHex(row.InfoHash)
+		if err != nil {
+			return nil, fmt.Errorf("parse info hash: %s", err)
+		}
+		records = append(records, BlacklistRecord{peerID, h, row.Expiration})
+	}
+	return records, nil
+}
+
+type blacklistListResult struct {
+	records []BlacklistRecord
+	err     error
+}
+
+// blacklistOp is a write to, or a list of, the underlying store of an
+// AsyncBlacklistStore.
+type blacklistOp struct {
+	record BlacklistRecord
+	delete bool
+	list   chan<- blacklistListResult
+}
+
+// AsyncBlacklistStore applies writes to an underlying BlacklistStore in a
+// background goroutine, such that blacklisting connections on the scheduler
+// event loop never waits on disk. Writes are applied in order. Writes are
+// dropped while the queue is full, since persisted entries only restore the
+// blacklist across restarts.
+type AsyncBlacklistStore struct {
+	store BlacklistStore
+	ops   chan blacklistOp
+	done  chan struct{}
+}
+
+// NewAsyncBlacklistStore creates a new AsyncBlacklistStore which writes to
+// store.
+func NewAsyncBlacklistStore(store BlacklistStore) *AsyncBlacklistStore {
+	s := &AsyncBlacklistStore{
+		store: store,
+		ops:   make(chan blacklistOp, _asyncBlacklistQueueSize),
+		done:  make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Put queues r to be inserted or replaced. Returns ErrBlacklistQueueFull if
+// the write is dropped.
+func (s *AsyncBlacklistStore) Put(r BlacklistRecord) error {
+	return s.enqueue(blacklistOp{record: r})
+}
+
+// Delete queues the entry for peerID/h to be removed. Returns
+// ErrBlacklistQueueFull if the write is dropped.
+func (s *AsyncBlacklistStore) Delete(peerID core.PeerID, h core.InfoHash) error {
+	return s.enqueue(blacklistOp{record: BlacklistRecord{PeerID: peerID, InfoHash: h}, delete: true})
+}
+
+// List returns all persisted entries once all previously queued writes have
+// been applied.
+func (s *AsyncBlacklistStore) List() ([]BlacklistRecord, error) {
+	result := make(chan blacklistListResult, 1)
+	s.ops <- blacklistOp{list: result}
+	r := <-result
+	return r.records, r.err
+}
+
+// Close applies all queued writes and stops s. s must not be used after Close.
+func (s *AsyncBlacklistStore) Close() {
+	close(s.ops)
+	<-s.done
+}
+
+func (s *AsyncBlacklistStore) enqueue(op blacklistOp) error {
+	select {
+	case s.ops <- op:
+		return nil
+	default:
+		return ErrBlacklistQueueFull
+	}
+}
+
+func (s *AsyncBlacklistStore) loop() {
+	defer close(s.done)
+
+	for op := range s.ops {
+		switch {
+		case op.list != nil:
+			records, err := s.store.List()
+			op.list <- blacklistListResult{records, err}
+		case op.delete:
+			if err := s.store.Delete(op.record.PeerID, op.record.InfoHash); err != nil {
+				log.With("peer", op.record.PeerID, "hash", op.record.InfoHash).Errorf(
+					"Error deleting persisted blacklist entry: %s", err)
+			}
+		default:
+			if err := s.store.Put(op.record); err != nil {
+				log.With("peer", op.record.PeerID, "hash", op.record.InfoHash).Errorf(
+					"Error persisting blacklist entry: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package connstate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/localdb"
+)
+
+func TestSQLBlacklistStore(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewSQLBlacklistStore(db)
+
+	r1 := BlacklistRecord{core.PeerIDFixture(), core.InfoHashFixture(), time.Now().Add(time.Minute)}
+	r2 := BlacklistRecord{core.PeerIDFixture(), core.InfoHashFixture(), time.Now().Add(time.Hour)}
+
+	require.NoError(s.Put(r1))
+	require.NoError(s.Put(r2))
+
+	// Put replaces existing entries.
+	r1.Expiration = r1.Expiration.Add(time.Minute)
+	require.NoError(s.Put(r1))
+
+	records, err := s.List()
+	require.NoError(err)
+	require.Len(records, 2)
+	for _, r := range records {
+		switch r.PeerID {
+		case r1.PeerID:
+			require.True(r1.Expiration.Equal(r.Expiration))
+		case r2.PeerID:
+			require.True(r2.Expiration.Equal(r.Expiration))
+		default:
+			t.Fatalf("unexpected record %+v", r)
+		}
+	}
+
+	require.NoError(s.Delete(r1.PeerID, r1.InfoHash))
+	records, err = s.List()
+	require.NoError(err)
+	require.Len(records, 1)
+	require.Equal(r2.PeerID, records[0].PeerID)
+	require.Equal(r2.InfoHash, records[0].InfoHash)
+}
+
+// blockingBlacklistStore blocks writes until unblocked.
+type blockingBlacklistStore struct {
+	BlacklistStore
+	unblock chan struct{}
+}
+
+func (s *blockingBlacklistStore) Put(r BlacklistRecord) error {
+	<-s.unblock
+	return s.BlacklistStore.Put(r)
+}
+
+func TestAsyncBlacklistStoreAppliesWritesInOrder(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	s := NewAsyncBlacklistStore(NewSQLBlacklistStore(db))
+	defer s.Close()
+
+	r1 := BlacklistRecord{core.PeerIDFixture(), core.InfoHashFixture(), time.Now().Add(time.Minute)}
+	r2 := BlacklistRecord{core.PeerIDFixture(), core.InfoHashFixture(), time.Now().Add(time.Hour)}
+
+	require.NoError(s.Put(r1))
+	require.NoError(s.Put(r2))
+	require.NoError(s.Delete(r1.PeerID, r1.InfoHash))
+
+	records, err := s.List()
+	require.NoError(err)
+	require.Len(records, 1)
+	require.Equal(r2.PeerID, records[0].PeerID)
+}
+
+func TestAsyncBlacklistStoreDoesNotWaitOnUnderlyingStore(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	store := &blockingBlacklistStore{NewSQLBlacklistStore(db), make(chan struct{})}
+	s := NewAsyncBlacklistStore(store)
+
+	r := BlacklistRecord{core.PeerIDFixture(), core.InfoHashFixture(), time.Now().Add(time.Minute)}
+
+	// Writes are dropped once the queue is full, instead of waiting.
+	var err error
+	for i := 0; i < _asyncBlacklistQueueSize+2 && err == nil; i++ {
+		err = s.Put(r)
+	}
+	require.Equal(ErrBlacklistQueueFull, err)
+
+	close(store.unblock)
+	s.Close()
+
+	records, err := store.List()
+	require.NoError(err)
+	require.Len(records, 1)
+}
@@ -22,6 +22,15 @@ type Config struct {
 	// Scheduler will maintain at once for each torrent.
 	MaxOpenConnectionsPerTorrent int `yaml:"max_open_conn"`
 
+	// MaxOriginConnectionsPerTorrent is the maximum number of connections to
+	// origin peers for each torrent. Defaults to MaxOpenConnectionsPerTorrent.
+	MaxOriginConnectionsPerTorrent int `yaml:"max_origin_conn"`
+
+	// ReservedOriginConnectionsPerTorrent is the number of connections of each
+	// torrent which agent peers cannot use, such that origins can always be
+	// connected to, even in swarms with many agents.
+	ReservedOriginConnectionsPerTorrent int `yaml:"reserved_origin_conn"`
+
 	// MaxMutualConnections is the maximum number of mutual connections a peer
 	// can have and still connect with us.
 	MaxMutualConnections int `yaml:"max_mutual_conn"`
@@ -38,6 +47,13 @@ func (c Config) applyDefaults() Config {
 	if c.MaxOpenConnectionsPerTorrent == 0 {
 		c.MaxOpenConnectionsPerTorrent = 10
 	}
+	if c.MaxOriginConnectionsPerTorrent == 0 ||
+		c.MaxOriginConnectionsPerTorrent > c.MaxOpenConnectionsPerTorrent {
+		c.MaxOriginConnectionsPerTorrent = c.MaxOpenConnectionsPerTorrent
+	}
+	if c.ReservedOriginConnectionsPerTorrent > c.MaxOriginConnectionsPerTorrent {
+		c.ReservedOriginConnectionsPerTorrent = c.MaxOriginConnectionsPerTorrent
+	}
 	// Defaults to no mutual connection limit.
 	if c.MaxMutualConnections == 0 {
 		c.MaxMutualConnections = c.MaxOpenConnectionsPerTorrent
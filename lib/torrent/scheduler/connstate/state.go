@@ -27,11 +27,13 @@ import (
 // State errors.
 var (
 	ErrTorrentAtCapacity       = errors.New("torrent is at capacity")
+	ErrPeerClassAtCapacity     = errors.New("torrent is at capacity for peer class")
 	ErrConnAlreadyPending      = errors.New("conn is already pending")
 	ErrConnAlreadyActive       = errors.New("conn is already active")
 	ErrConnClosed              = errors.New("conn is closed")
 	ErrInvalidActiveTransition = errors.New("conn must be pending to transition to active")
 	ErrTooManyMutualConns      = errors.New("conn has too many mutual connections")
+	ErrNotBlacklisted          = errors.New("conn is not blacklisted")
 
 	// This should NEVER happen.
 	errUnknownStatus = errors.New("invariant violation: unknown status")
@@ -50,6 +52,7 @@ const (
 type entry struct {
 	status status
 	conn   *conn.Conn
+	origin bool
 }
 
 type connKey struct {
@@ -90,6 +93,18 @@ type State struct {
 
 	// All blacklisted conns. These do not count towards conn capacity.
 	blacklist map[connKey]*blacklistEntry
+
+	// Persists blacklist across restarts.
+	blacklistStore BlacklistStore
+}
+
+// Option defines an optional State parameter.
+type Option func(*State)
+
+// WithBlacklistStore configures State to persist blacklisted connections in
+// bs, and restores any unexpired entries from bs.
+func WithBlacklistStore(bs BlacklistStore) Option {
+	return func(s *State) { s.blacklistStore = bs }
 }
 
 // New creates a new State.
@@ -98,18 +113,43 @@ func New(
 	clk clock.Clock,
 	localPeerID core.PeerID,
 	netevents networkevent.Producer,
-	logger *zap.SugaredLogger) *State {
+	logger *zap.SugaredLogger,
+	opts ...Option) *State {
 
 	config = config.applyDefaults()
 
-	return &State{
-		config:      config,
-		clk:         clk,
-		netevents:   netevents,
-		localPeerID: localPeerID,
-		logger:      logger,
-		conns:       make(map[core.InfoHash]map[core.PeerID]entry),
-		blacklist:   make(map[connKey]*blacklistEntry),
+	s := &State{
+		config:         config,
+		clk:            clk,
+		netevents:      netevents,
+		localPeerID:    localPeerID,
+		logger:         logger,
+		conns:          make(map[core.InfoHash]map[core.PeerID]entry),
+		blacklist:      make(map[connKey]*blacklistEntry),
+		blacklistStore: NoopBlacklistStore{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.restoreBlacklist()
+	return s
+}
+
+func (s *State) restoreBlacklist() {
+	records, err := s.blacklistStore.List()
+	if err != nil {
+		s.logger.Errorf("Error restoring blacklist: %s", err)
+		return
+	}
+	now := s.clk.Now()
+	for _, r := range records {
+		if !r.Expiration.After(now) {
+			if err := s.blacklistStore.Delete(r.PeerID, r.InfoHash); err != nil {
+				s.logger.Errorf("Error deleting expired blacklist entry: %s", err)
+			}
+			continue
+		}
+		s.blacklist[connKey{r.InfoHash, r.PeerID}] = &blacklistEntry{r.Expiration}
 	}
 }
 
@@ -126,6 +166,27 @@ func (s *State) ActiveConns() []*conn.Conn {
 	return active
 }
 
+// KnownPeers returns the peers which have a pending, active, or blacklisted
+// connection for h.
+func (s *State) KnownPeers(h core.InfoHash) []core.PeerID {
+	var peers []core.PeerID
+	for peerID := range s.conns[h] {
+		peers = append(peers, peerID)
+	}
+	now := s.clk.Now()
+	for k, e := range s.blacklist {
+		if k.hash == h && e.Blacklisted(now) {
+			peers = append(peers, k.peerID)
+		}
+	}
+	return peers
+}
+
+// NumConns returns the number of pending and active conns for h.
+func (s *State) NumConns(h core.InfoHash) int {
+	return len(s.conns[h])
+}
+
 // Saturated returns true if h is at capacity and all the conns are active.
 func (s *State) Saturated(h core.InfoHash) bool {
 	peers, ok := s.conns[h]
@@ -152,7 +213,11 @@ func (s *State) Blacklist(peerID core.PeerID, h core.InfoHash) error {
 	if e, ok := s.blacklist[k]; ok && e.Blacklisted(s.clk.Now()) {
 		return errors.New("conn is already blacklisted")
 	}
-	s.blacklist[k] = &blacklistEntry{s.clk.Now().Add(s.config.BlacklistDuration)}
+	expiration := s.clk.Now().Add(s.config.BlacklistDuration)
+	s.blacklist[k] = &blacklistEntry{expiration}
+	if err := s.blacklistStore.Put(BlacklistRecord{peerID, h, expiration}); err != nil {
+		s.log("peer", peerID, "hash", h).Errorf("Error persisting blacklist entry: %s", err)
+	}
 
 	s.log("peer", peerID, "hash", h).Infof(
 		"Connection blacklisted for %s", s.config.BlacklistDuration)
@@ -172,15 +237,47 @@ func (s *State) Blacklisted(peerID core.PeerID, h core.InfoHash) bool {
 func (s *State) ClearBlacklist(h core.InfoHash) {
 	for k := range s.blacklist {
 		if k.hash == h {
-			delete(s.blacklist, k)
+			s.deleteBlacklistEntry(k)
 		}
 	}
 }
 
+// Unblacklist un-blacklists peerID/h. Returns ErrNotBlacklisted if the
+// connection is not blacklisted.
+func (s *State) Unblacklist(peerID core.PeerID, h core.InfoHash) error {
+	k := connKey{h, peerID}
+	if _, ok := s.blacklist[k]; !ok {
+		return ErrNotBlacklisted
+	}
+	s.deleteBlacklistEntry(k)
+	s.log("peer", peerID, "hash", h).Info("Connection manually unblacklisted")
+	return nil
+}
+
+func (s *State) deleteBlacklistEntry(k connKey) {
+	delete(s.blacklist, k)
+	if err := s.blacklistStore.Delete(k.peerID, k.hash); err != nil {
+		s.log("peer", k.peerID, "hash", k.hash).Errorf(
+			"Error deleting persisted blacklist entry: %s", err)
+	}
+}
+
 // AddPending sets the connection for peerID/h as pending and reserves capacity
-// for it.
+// for it. The peer is assumed to be an agent, which cannot use the capacity
+// reserved for origins.
 func (s *State) AddPending(peerID core.PeerID, h core.InfoHash, neighbors []core.PeerID) error {
-	if len(s.conns[h]) == s.config.MaxOpenConnectionsPerTorrent {
+	return s.addPending(peerID, h, neighbors, false)
+}
+
+// AddPendingOrigin is AddPending for connections to origin peers.
+func (s *State) AddPendingOrigin(peerID core.PeerID, h core.InfoHash, neighbors []core.PeerID) error {
+	return s.addPending(peerID, h, neighbors, true)
+}
+
+func (s *State) addPending(
+	peerID core.PeerID, h core.InfoHash, neighbors []core.PeerID, origin bool) error {
+
+	if len(s.conns[h]) >= s.config.MaxOpenConnectionsPerTorrent {
 		return ErrTorrentAtCapacity
 	}
 	switch s.get(h, peerID).status {
@@ -188,7 +285,15 @@ func (s *State) AddPending(peerID core.PeerID, h core.InfoHash, neighbors []core
 		if s.numMutualConns(h, neighbors) > s.config.MaxMutualConnections {
 			return ErrTooManyMutualConns
 		}
-		s.put(h, peerID, entry{status: _pending})
+		origins := s.numOriginConns(h)
+		if origin && origins >= s.config.MaxOriginConnectionsPerTorrent {
+			return ErrPeerClassAtCapacity
+		}
+		agentLimit := s.config.MaxOpenConnectionsPerTorrent - s.config.ReservedOriginConnectionsPerTorrent
+		if !origin && len(s.conns[h])-origins >= agentLimit {
+			return ErrPeerClassAtCapacity
+		}
+		s.put(h, peerID, entry{status: _pending, origin: origin})
 		s.log("hash", h, "peer", peerID).Infof(
 			"Added pending conn, capacity now at %d", s.capacity(h))
 		return nil
@@ -216,10 +321,11 @@ func (s *State) MovePendingToActive(c *conn.Conn) error {
 	if c.IsClosed() {
 		return ErrConnClosed
 	}
-	if s.get(c.InfoHash(), c.PeerID()).status != _pending {
+	e := s.get(c.InfoHash(), c.PeerID())
+	if e.status != _pending {
 		return ErrInvalidActiveTransition
 	}
-	s.put(c.InfoHash(), c.PeerID(), entry{status: _active, conn: c})
+	s.put(c.InfoHash(), c.PeerID(), entry{status: _active, conn: c, origin: e.origin})
 
 	s.log("hash", c.InfoHash(), "peer", c.PeerID()).Info("Moved conn from pending to active")
 	s.netevents.Produce(networkevent.AddActiveConnEvent(c.InfoHash(), s.localPeerID, c.PeerID()))
@@ -257,6 +363,16 @@ func (s *State) numMutualConns(h core.InfoHash, neighbors []core.PeerID) int {
 	return n
 }
 
+func (s *State) numOriginConns(h core.InfoHash) int {
+	var n int
+	for _, e := range s.conns[h] {
+		if e.origin {
+			n++
+		}
+	}
+	return n
+}
+
 // BlacklistedConn represents a connection which has been blacklisted.
 type BlacklistedConn struct {
 	PeerID    core.PeerID   `json:"peer_id"`
@@ -25,6 +25,7 @@ import (
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/localdb"
 )
 
 func testState(config Config, clk clock.Clock) *State {
@@ -71,6 +72,128 @@ func TestStateBlacklistSnapshot(t *testing.T) {
 	require.Equal(expected, s.BlacklistSnapshot())
 }
 
+func TestStateUnblacklist(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{}, clock.NewMock())
+
+	p := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	require.Equal(ErrNotBlacklisted, s.Unblacklist(p, h))
+
+	require.NoError(s.Blacklist(p, h))
+	require.NoError(s.Unblacklist(p, h))
+	require.False(s.Blacklisted(p, h))
+}
+
+func TestStateKnownPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		BlacklistDuration: 30 * time.Second,
+	}
+	clk := clock.NewMock()
+	s := testState(config, clk)
+
+	h := core.InfoHashFixture()
+	pending := core.PeerIDFixture()
+	blacklisted := core.PeerIDFixture()
+
+	require.NoError(s.AddPending(pending, h, nil))
+	require.NoError(s.Blacklist(blacklisted, h))
+	require.NoError(s.AddPending(core.PeerIDFixture(), core.InfoHashFixture(), nil))
+
+	require.ElementsMatch([]core.PeerID{pending, blacklisted}, s.KnownPeers(h))
+
+	clk.Add(config.BlacklistDuration + 1)
+
+	require.Equal([]core.PeerID{pending}, s.KnownPeers(h))
+}
+
+func TestStateRestoresPersistedBlacklist(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	bs := NewSQLBlacklistStore(db)
+
+	config := Config{
+		BlacklistDuration: 30 * time.Second,
+	}
+	clk := clock.NewMock()
+	newState := func() *State {
+		return New(
+			config, clk, core.PeerIDFixture(), networkevent.NewTestProducer(),
+			zap.NewNop().Sugar(), WithBlacklistStore(bs))
+	}
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	s := newState()
+	require.NoError(s.Blacklist(p1, h))
+	require.NoError(s.Blacklist(p2, h))
+	require.NoError(s.Unblacklist(p2, h))
+
+	// Simulate restart.
+	s = newState()
+	require.True(s.Blacklisted(p1, h))
+	require.False(s.Blacklisted(p2, h))
+
+	clk.Add(config.BlacklistDuration + 1)
+
+	// Expired entries are dropped from the store on restart.
+	s = newState()
+	require.False(s.Blacklisted(p1, h))
+	records, err := bs.List()
+	require.NoError(err)
+	require.Empty(records)
+}
+
+func TestStateBlacklistDecaysOverLongDuration(t *testing.T) {
+	require := require.New(t)
+
+	db, cleanup := localdb.Fixture()
+	defer cleanup()
+
+	bs := NewSQLBlacklistStore(db)
+
+	config := Config{
+		BlacklistDuration: 24 * time.Hour,
+	}
+	clk := clock.NewMock()
+	newState := func() *State {
+		return New(
+			config, clk, core.PeerIDFixture(), networkevent.NewTestProducer(),
+			zap.NewNop().Sugar(), WithBlacklistStore(bs))
+	}
+
+	p := core.PeerIDFixture()
+	h := core.InfoHashFixture()
+
+	s := newState()
+	require.NoError(s.Blacklist(p, h))
+
+	for elapsed := time.Hour; elapsed < config.BlacklistDuration; elapsed += time.Hour {
+		clk.Add(time.Hour)
+		require.True(s.Blacklisted(p, h), "unblacklisted after %s", elapsed)
+		require.Equal(
+			[]BlacklistedConn{{p, h, config.BlacklistDuration - elapsed}}, s.BlacklistSnapshot())
+	}
+
+	// Entries restored after a restart keep their original expiration.
+	s = newState()
+	require.True(s.Blacklisted(p, h))
+
+	clk.Add(time.Hour)
+	require.False(s.Blacklisted(p, h))
+	require.Equal([]BlacklistedConn{{p, h, 0}}, s.BlacklistSnapshot())
+	require.NoError(s.Blacklist(p, h))
+}
+
 func TestStateClearBlacklist(t *testing.T) {
 	require := require.New(t)
 
@@ -122,6 +245,54 @@ func TestStateAddPendingReservesCapacity(t *testing.T) {
 	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
 }
 
+func TestStateAddPendingReservesOriginCapacity(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{
+		MaxOpenConnectionsPerTorrent:        5,
+		ReservedOriginConnectionsPerTorrent: 2,
+	}, clock.New())
+
+	h := core.InfoHashFixture()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(s.AddPending(core.PeerIDFixture(), h, nil))
+	}
+	require.Equal(ErrPeerClassAtCapacity, s.AddPending(core.PeerIDFixture(), h, nil))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(s.AddPendingOrigin(core.PeerIDFixture(), h, nil))
+	}
+	require.Equal(ErrTorrentAtCapacity, s.AddPendingOrigin(core.PeerIDFixture(), h, nil))
+}
+
+func TestStateAddPendingOriginLimit(t *testing.T) {
+	require := require.New(t)
+
+	s := testState(Config{
+		MaxOpenConnectionsPerTorrent:   5,
+		MaxOriginConnectionsPerTorrent: 1,
+	}, clock.New())
+
+	h := core.InfoHashFixture()
+
+	c, cleanup := conn.Fixture()
+	defer cleanup()
+
+	require.NoError(s.AddPendingOrigin(c.PeerID(), c.InfoHash(), nil))
+	require.NoError(s.MovePendingToActive(c))
+
+	// Active origin conns still count towards the origin limit.
+	require.Equal(ErrPeerClassAtCapacity, s.AddPendingOrigin(core.PeerIDFixture(), c.InfoHash(), nil))
+	require.NoError(s.AddPendingOrigin(core.PeerIDFixture(), h, nil))
+
+	// Agents may use the remaining capacity.
+	for i := 0; i < 4; i++ {
+		require.NoError(s.AddPending(core.PeerIDFixture(), c.InfoHash(), nil))
+	}
+	require.Equal(ErrTorrentAtCapacity, s.AddPending(core.PeerIDFixture(), c.InfoHash(), nil))
+}
+
 func TestStateDeletePendingAllowsFutureAddPending(t *testing.T) {
 	require := require.New(t)
 
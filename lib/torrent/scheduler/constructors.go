@@ -20,9 +20,11 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/blobrefresh"
 	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/pullstats"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
 	"github.com/uber/kraken/lib/torrent/storage/originstorage"
 	"github.com/uber/kraken/tracker/announceclient"
@@ -40,7 +42,9 @@ func NewAgentScheduler(
 	netevents networkevent.Producer,
 	trackers hashring.PassiveRing,
 	announceClient announceclient.Client,
-	tls *tls.Config) (ReloadableScheduler, error) {
+	blacklistStore connstate.BlacklistStore,
+	tls *tls.Config,
+	pulls *pullstats.Recorder) (ReloadableScheduler, error) {
 
 	s, err := newScheduler(
 		config,
@@ -48,7 +52,9 @@ func NewAgentScheduler(
 		stats,
 		pctx,
 		announceClient,
-		netevents)
+		netevents,
+		withBlacklistStore(blacklistStore),
+		withPullRecorder(pulls))
 	if err != nil {
 		return nil, fmt.Errorf("new scheduler: %s", err)
 	}
@@ -69,11 +75,12 @@ func NewOriginScheduler(
 	pctx core.PeerContext,
 	cas *store.CAStore,
 	netevents networkevent.Producer,
-	blobRefresher *blobrefresh.Refresher) (ReloadableScheduler, error) {
+	blobRefresher *blobrefresh.Refresher,
+	egress *originstorage.EgressCounter) (ReloadableScheduler, error) {
 
 	s, err := newScheduler(
 		config,
-		originstorage.NewTorrentArchive(cas, blobRefresher),
+		originstorage.NewTorrentArchive(cas, blobRefresher, egress),
 		stats,
 		pctx,
 		announceclient.Disabled(),
@@ -90,3 +97,39 @@ func NewOriginScheduler(
 
 	return rs, nil
 }
+
+// NewSwarmFetchScheduler creates and starts a ReloadableScheduler with which an
+// origin leeches blobs from agents into cads. Unlike agents, it only downloads
+// metainfo which trackers can serve without origin downloads, since trackers
+// would otherwise ask origins for the metainfo of the very blobs origins are
+// fetching.
+func NewSwarmFetchScheduler(
+	config Config,
+	stats tally.Scope,
+	pctx core.PeerContext,
+	cads *store.CADownloadStore,
+	netevents networkevent.Producer,
+	trackers hashring.PassiveRing,
+	announceClient announceclient.Client,
+	tls *tls.Config) (ReloadableScheduler, error) {
+
+	mic := metainfoclient.New(trackers, tls, metainfoclient.WithPeek())
+	s, err := newScheduler(
+		config,
+		agentstorage.NewTorrentArchive(stats, cads, mic),
+		stats,
+		pctx,
+		announceClient,
+		netevents)
+	if err != nil {
+		return nil, fmt.Errorf("new scheduler: %s", err)
+	}
+
+	aq := func() announcequeue.Queue { return announcequeue.New() }
+	rs := makeReloadable(s, aq)
+	if err := rs.start(aq()); err != nil {
+		return nil, fmt.Errorf("start: %s", err)
+	}
+
+	return rs, nil
+}
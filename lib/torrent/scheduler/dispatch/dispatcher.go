@@ -14,6 +14,7 @@
 package dispatch
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -26,11 +27,15 @@ import (
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/syncutil"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/uber-go/tally"
 	"github.com/willf/bitset"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
 	"go.uber.org/zap"
 	"golang.org/x/sync/syncmap"
 )
@@ -45,7 +50,9 @@ var (
 // Events defines Dispatcher events.
 type Events interface {
 	DispatcherComplete(*Dispatcher)
+	DispatcherFailed(*Dispatcher, error)
 	PeerRemoved(core.PeerID, core.InfoHash)
+	PeersExchanged(core.PeerID, core.InfoHash, []*core.PeerInfo)
 }
 
 // Messages defines a subset of conn.Conn methods which Dispatcher requires to
@@ -72,12 +79,40 @@ type Dispatcher struct {
 	netevents             networkevent.Producer
 	pieceRequestTimeout   time.Duration
 	pieceRequestManager   *piecerequest.Manager
+	allocator             *piecerequest.Allocator
 	pendingPiecesDoneOnce sync.Once
 	pendingPiecesDone     chan struct{}
 	completeOnce          sync.Once
+	bytesSent             atomic.Int64
+	failOnce              sync.Once
 	events                Events
 	logger                *zap.SugaredLogger
 	torrentlog            *torrentlog.Logger
+
+	// Trace context of the torrent download, if the torrent was incomplete
+	// when the Dispatcher was created. Piece downloads are recorded as child
+	// spans.
+	ctx  context.Context
+	span trace.Span
+}
+
+type options struct {
+	allocator *piecerequest.Allocator
+	weight    int
+}
+
+// Option allows setting optional Dispatcher parameters.
+type Option func(*options)
+
+// WithAllocator shares the pending piece requests of the Dispatcher with all
+// other torrents registered in a, where weight is the relative share of the
+// Dispatcher's torrent. The torrent is registered until it completes or the
+// Dispatcher is torn down.
+func WithAllocator(a *piecerequest.Allocator, weight int) Option {
+	return func(o *options) {
+		o.allocator = a
+		o.weight = weight
+	}
 }
 
 // New creates a new Dispatcher.
@@ -90,13 +125,23 @@ func New(
 	peerID core.PeerID,
 	t storage.Torrent,
 	logger *zap.SugaredLogger,
-	tlog *torrentlog.Logger) (*Dispatcher, error) {
+	tlog *torrentlog.Logger,
+	opts ...Option) (*Dispatcher, error) {
 
-	d, err := newDispatcher(config, stats, clk, netevents, events, peerID, t, logger, tlog)
+	d, err := newDispatcher(config, stats, clk, netevents, events, peerID, t, logger, tlog, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	if !t.Complete() {
+		d.ctx, d.span = tracing.Tracer().Start(d.ctx, "torrent.download",
+			trace.WithTimestamp(d.createdAt),
+			trace.WithAttributes(
+				attribute.String("digest", t.Digest().String()),
+				attribute.String("info_hash", t.InfoHash().String()),
+				attribute.Int64("length", t.Length())))
+	}
+
 	// Exits when d.pendingPiecesDone is closed.
 	go d.watchPendingPieceRequests()
 
@@ -117,21 +162,37 @@ func newDispatcher(
 	peerID core.PeerID,
 	t storage.Torrent,
 	logger *zap.SugaredLogger,
-	tlog *torrentlog.Logger) (*Dispatcher, error) {
+	tlog *torrentlog.Logger,
+	opts ...Option) (*Dispatcher, error) {
 
 	config = config.applyDefaults()
 
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	stats = stats.Tagged(map[string]string{
 		"module": "dispatch",
 	})
 
+	var managerOpts []piecerequest.ManagerOption
+	if o.allocator != nil {
+		managerOpts = append(managerOpts, piecerequest.WithAllocator(o.allocator, t.InfoHash()))
+	}
+
 	pieceRequestTimeout := config.calcPieceRequestTimeout(t.MaxPieceLength())
 	pieceRequestManager, err := piecerequest.NewManager(
-		clk, pieceRequestTimeout, config.PieceRequestPolicy, config.PipelineLimit)
+		clk, pieceRequestTimeout, config.PieceRequestPolicy, config.PipelineLimit,
+		managerOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("piece request manager: %s", err)
 	}
 
+	if o.allocator != nil && !t.Complete() {
+		o.allocator.Register(t.InfoHash(), o.weight)
+	}
+
 	return &Dispatcher{
 		config:              config,
 		stats:               stats,
@@ -143,10 +204,12 @@ func newDispatcher(
 		netevents:           netevents,
 		pieceRequestTimeout: pieceRequestTimeout,
 		pieceRequestManager: pieceRequestManager,
+		allocator:           o.allocator,
 		pendingPiecesDone:   make(chan struct{}),
 		events:              events,
 		logger:              logger,
 		torrentlog:          tlog,
+		ctx:                 context.Background(),
 	}, nil
 }
 
@@ -199,6 +262,35 @@ func (d *Dispatcher) LastPieceSent(peerID core.PeerID) time.Time {
 	return v.(*peer).getLastPieceSent()
 }
 
+// TakeBytesReceived returns the number of bytes of good pieces received from
+// each peer since the previous call. Peers which sent no good pieces in the
+// meantime are omitted.
+func (d *Dispatcher) TakeBytesReceived() map[core.PeerID]int64 {
+	received := make(map[core.PeerID]int64)
+	d.peerStats.Range(func(k, v interface{}) bool {
+		if n := v.(*peerStats).takeBytesReceived(); n > 0 {
+			received[k.(core.PeerID)] = n
+		}
+		return true
+	})
+	return received
+}
+
+// PeerComplete returns true if peerID is connected to d and has all pieces of
+// d's torrent.
+func (d *Dispatcher) PeerComplete(peerID core.PeerID) bool {
+	v, ok := d.peers.Load(peerID)
+	if !ok {
+		return false
+	}
+	return v.(*peer).bitfield.Complete()
+}
+
+// BytesSent returns the number of piece bytes d sent to peers.
+func (d *Dispatcher) BytesSent() int64 {
+	return d.bytesSent.Load()
+}
+
 // LastReadTime returns when d's torrent was last read from.
 func (d *Dispatcher) LastReadTime() time.Time {
 	return d.torrent.getLastReadTime()
@@ -280,6 +372,10 @@ func (d *Dispatcher) TearDown() {
 		close(d.pendingPiecesDone)
 	})
 
+	d.releaseShare()
+
+	d.endSpan()
+
 	d.peers.Range(func(k, v interface{}) bool {
 		p := v.(*peer)
 		d.log("peer", p).Info("Dispatcher teardown closing connection")
@@ -310,8 +406,12 @@ func (d *Dispatcher) String() string {
 }
 
 func (d *Dispatcher) complete() {
-	d.completeOnce.Do(func() { go d.events.DispatcherComplete(d) })
+	d.completeOnce.Do(func() {
+		d.endSpan()
+		go d.events.DispatcherComplete(d)
+	})
 	d.pendingPiecesDoneOnce.Do(func() { close(d.pendingPiecesDone) })
+	d.releaseShare()
 
 	d.peers.Range(func(k, v interface{}) bool {
 		p := v.(*peer)
@@ -354,6 +454,21 @@ func (d *Dispatcher) complete() {
 	}
 }
 
+// releaseShare returns the piece request share of d's torrent to the
+// allocator, if any. Safe to call multiple times.
+func (d *Dispatcher) releaseShare() {
+	if d.allocator != nil {
+		d.allocator.Unregister(d.torrent.InfoHash())
+	}
+}
+
+// endSpan ends the torrent download span, if any. Safe to call multiple times.
+func (d *Dispatcher) endSpan() {
+	if d.span != nil {
+		d.span.End(trace.WithTimestamp(d.clk.Now()))
+	}
+}
+
 func (d *Dispatcher) endgame() bool {
 	if d.config.DisableEndgame {
 		return false
@@ -463,6 +578,8 @@ func (d *Dispatcher) dispatch(p *peer, msg *conn.Message) error {
 		d.handleBitfield(p, msg.Message.Bitfield)
 	case p2p.Message_COMPLETE:
 		d.handleComplete(p)
+	case p2p.Message_PEER_EXCHANGE:
+		d.handlePeerExchange(p, msg.Message.PeerExchange)
 	default:
 		return fmt.Errorf("unknown message type: %d", msg.Message.Type)
 	}
@@ -516,6 +633,7 @@ func (d *Dispatcher) handlePieceRequest(p *peer, msg *p2p.PieceRequestMessage) {
 
 	p.touchLastPieceSent()
 	p.pstats.incrementPiecesSent()
+	d.bytesSent.Add(d.torrent.PieceLength(i))
 
 	// Assume that the peer successfully received the piece.
 	p.bitfield.Set(uint(i), true)
@@ -534,7 +652,10 @@ func (d *Dispatcher) handlePiecePayload(
 	}
 
 	if err := d.torrent.WritePiece(payload, i); err != nil {
-		if err != storage.ErrPieceComplete {
+		if err == storage.ErrTorrentCorrupt {
+			d.log("peer", p, "piece", i).Error("Failing corrupt torrent")
+			d.failOnce.Do(func() { go d.events.DispatcherFailed(d, err) })
+		} else if err != storage.ErrPieceComplete {
 			d.log("peer", p, "piece", i).Errorf("Error writing piece payload: %s", err)
 			d.pieceRequestManager.MarkInvalid(p.id, i)
 		} else {
@@ -546,7 +667,17 @@ func (d *Dispatcher) handlePiecePayload(
 	d.netevents.Produce(
 		networkevent.ReceivePieceEvent(d.torrent.InfoHash(), d.localPeerID, p.id, i))
 
+	if sentAt, ok := d.pieceRequestManager.SentAt(p.id, i); ok {
+		_, span := tracing.Tracer().Start(d.ctx, "piece.download",
+			trace.WithTimestamp(sentAt),
+			trace.WithAttributes(
+				attribute.Int("piece", i),
+				attribute.String("peer_id", p.id.String())))
+		span.End(trace.WithTimestamp(d.clk.Now()))
+	}
+
 	p.pstats.incrementGoodPiecesReceived()
+	p.pstats.addBytesReceived(d.torrent.PieceLength(i))
 	p.touchLastGoodPieceReceived()
 	if d.torrent.Complete() {
 		d.complete()
@@ -588,6 +719,27 @@ func (d *Dispatcher) handleComplete(p *peer) {
 	}
 }
 
+func (d *Dispatcher) handlePeerExchange(p *peer, msg *p2p.PeerExchangeMessage) {
+	var peers []*core.PeerInfo
+	for _, addr := range msg.GetPeers() {
+		peerID, err := core.NewPeerID(addr.PeerID)
+		if err != nil {
+			d.log("peer", p).Errorf("Invalid exchanged peer id: %s", err)
+			continue
+		}
+		if peerID == d.localPeerID || addr.Ip == "" || addr.Port <= 0 {
+			continue
+		}
+		peers = append(peers, core.NewPeerInfo(
+			peerID, addr.Ip, int(addr.Port), addr.Origin, addr.Complete))
+	}
+	if len(peers) == 0 {
+		return
+	}
+	d.stats.Counter("exchanged_peers_received").Inc(int64(len(peers)))
+	d.events.PeersExchanged(p.id, d.torrent.InfoHash(), peers)
+}
+
 func (d *Dispatcher) log(args ...interface{}) *zap.SugaredLogger {
 	args = append(args, "torrent", d.torrent)
 	return d.logger.With(args...)
@@ -23,6 +23,7 @@ import (
 	"github.com/uber/kraken/gen/go/proto/p2p"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
@@ -102,8 +103,12 @@ type noopEvents struct{}
 
 func (e noopEvents) DispatcherComplete(*Dispatcher) {}
 
+func (e noopEvents) DispatcherFailed(*Dispatcher, error) {}
+
 func (e noopEvents) PeerRemoved(core.PeerID, core.InfoHash) {}
 
+func (e noopEvents) PeersExchanged(core.PeerID, core.InfoHash, []*core.PeerInfo) {}
+
 func testDispatcher(config Config, clk clock.Clock, t storage.Torrent) *Dispatcher {
 	d, err := newDispatcher(
 		config,
@@ -265,6 +270,35 @@ func TestDispatcherSendErrorsMarksPieceRequestsUnsent(t *testing.T) {
 	}, numRequestsPerPiece(p2.messages))
 }
 
+func TestDispatcherAllocatorShareReleasedOnTearDown(t *testing.T) {
+	require := require.New(t)
+
+	a, err := piecerequest.NewAllocator(piecerequest.AllocatorConfig{MaxPendingRequests: 10})
+	require.NoError(err)
+
+	torrent, cleanup := agentstorage.TorrentFixture(core.SizedBlobFixture(100, 1).MetaInfo)
+	defer cleanup()
+
+	d, err := newDispatcher(
+		Config{},
+		tally.NoopScope,
+		clock.NewMock(),
+		networkevent.NewTestProducer(),
+		noopEvents{},
+		core.PeerIDFixture(),
+		torrent,
+		zap.NewNop().Sugar(),
+		torrentlog.NewNopLogger(),
+		WithAllocator(a, 1))
+	require.NoError(err)
+
+	require.Equal(10, a.Share(torrent.InfoHash()))
+
+	d.TearDown()
+
+	require.Equal(-1, a.Share(torrent.InfoHash()))
+}
+
 func TestDispatcherCalcPieceRequestTimeout(t *testing.T) {
 	config := Config{
 		PieceRequestMinTimeout:   5 * time.Second,
@@ -472,3 +506,86 @@ func TestDispatcherPeerPieceCounts(t *testing.T) {
 	require.Equal(1, d.numPeersByPiece.Get(1))
 	require.Equal(2, d.numPeersByPiece.Get(2))
 }
+
+type peerExchangeEvents struct {
+	noopEvents
+	peers chan []*core.PeerInfo
+}
+
+func (e peerExchangeEvents) PeersExchanged(
+	peerID core.PeerID, h core.InfoHash, peers []*core.PeerInfo) {
+
+	e.peers <- peers
+}
+
+func TestDispatcherHandlePeerExchange(t *testing.T) {
+	require := require.New(t)
+
+	torrent, cleanup := agentstorage.TorrentFixture(core.SizedBlobFixture(2, 1).MetaInfo)
+	defer cleanup()
+
+	localPeerID := core.PeerIDFixture()
+	events := peerExchangeEvents{peers: make(chan []*core.PeerInfo, 1)}
+	d, err := newDispatcher(
+		Config{},
+		tally.NoopScope,
+		clock.NewMock(),
+		networkevent.NewTestProducer(),
+		events,
+		localPeerID,
+		torrent,
+		zap.NewNop().Sugar(),
+		torrentlog.NewNopLogger())
+	require.NoError(err)
+
+	p, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false, false), newMockMessages())
+	require.NoError(err)
+
+	valid := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+	msg := conn.NewPeerExchangeMessage([]*core.PeerInfo{
+		valid,
+		origin,
+		core.NewPeerInfo(localPeerID, "localhost", 8080, false, false),
+		core.NewPeerInfo(core.PeerIDFixture(), "", 8080, false, false),
+	})
+	msg.Message.PeerExchange.Peers = append(
+		msg.Message.PeerExchange.Peers, &p2p.PeerAddress{PeerID: "invalid", Ip: "localhost", Port: 8080})
+
+	require.NoError(d.dispatch(p, msg))
+
+	select {
+	case peers := <-events.peers:
+		require.Equal([]*core.PeerInfo{valid, origin}, peers)
+	default:
+		require.FailNow("peers not exchanged")
+	}
+}
+
+func TestDispatcherHandlePieceRequestCountsBytesSent(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(4, 2)
+
+	torrent, cleanup := agentstorage.TorrentFixture(blob.MetaInfo)
+	defer cleanup()
+
+	for i := 0; i < torrent.NumPieces(); i++ {
+		start := int64(i) * blob.MetaInfo.PieceLength()
+		end := start + torrent.PieceLength(i)
+		require.NoError(torrent.WritePiece(piecereader.NewBuffer(blob.Content[start:end]), i))
+	}
+
+	d := testDispatcher(Config{}, clock.NewMock(), torrent)
+
+	p, err := d.addPeer(core.PeerIDFixture(), bitsetutil.FromBools(false, false), newMockMessages())
+	require.NoError(err)
+
+	require.Equal(int64(0), d.BytesSent())
+
+	require.NoError(d.dispatch(p, conn.NewPieceRequestMessage(0, 2)))
+	require.Equal(int64(2), d.BytesSent())
+
+	require.NoError(d.dispatch(p, conn.NewPieceRequestMessage(1, 2)))
+	require.Equal(int64(4), d.BytesSent())
+}
@@ -100,6 +100,10 @@ type peerStats struct {
 	goodPiecesReceived int
 	// Pieces we received from the peer that we already had.
 	duplicatePiecesReceived int
+
+	// Bytes of good pieces received from the peer which have not been taken
+	// for reporting yet.
+	unreportedBytesReceived int64
 }
 
 func (s *peerStats) getPieceRequestsSent() int {
@@ -171,3 +175,19 @@ func (s *peerStats) incrementDuplicatePiecesReceived() {
 
 	s.duplicatePiecesReceived++
 }
+
+func (s *peerStats) addBytesReceived(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unreportedBytesReceived += n
+}
+
+func (s *peerStats) takeBytesReceived() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.unreportedBytesReceived
+	s.unreportedBytesReceived = 0
+	return n
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package piecerequest
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/uber/kraken/core"
+)
+
+// AllocatorConfig defines how pending piece requests are shared between
+// torrents.
+type AllocatorConfig struct {
+
+	// MaxPendingRequests limits the total number of pending piece requests
+	// across all incomplete torrents. The limit is divided between torrents in
+	// proportion to their weight, such that large torrents cannot starve small
+	// ones of connection slots. 0 disables the limit.
+	MaxPendingRequests int `yaml:"max_pending_requests"`
+
+	// Weights assigns torrent weights by namespace. The first matching rule
+	// applies, and torrents matching no rule have weight 1.
+	Weights []WeightConfig `yaml:"weights"`
+}
+
+// WeightConfig assigns weight to torrents whose namespace matches the
+// Namespace regexp.
+type WeightConfig struct {
+	Namespace string `yaml:"namespace"`
+	Weight    int    `yaml:"weight"`
+}
+
+type weightRule struct {
+	regexp *regexp.Regexp
+	weight int
+}
+
+// Allocator divides a global limit of pending piece requests between
+// incomplete torrents using weighted fair shares. Allocator itself does not
+// track requests: each Manager is responsible for keeping its pending requests
+// under the share of its torrent.
+type Allocator struct {
+	mu      sync.Mutex
+	limit   int
+	rules   []weightRule
+	weights map[core.InfoHash]int
+	total   int
+}
+
+// NewAllocator creates a new Allocator.
+func NewAllocator(config AllocatorConfig) (*Allocator, error) {
+	var rules []weightRule
+	for _, w := range config.Weights {
+		re, err := regexp.Compile(w.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace regexp %q: %s", w.Namespace, err)
+		}
+		if w.Weight <= 0 {
+			return nil, fmt.Errorf("weight of namespace %q must be positive", w.Namespace)
+		}
+		rules = append(rules, weightRule{re, w.Weight})
+	}
+	return &Allocator{
+		limit:   config.MaxPendingRequests,
+		rules:   rules,
+		weights: make(map[core.InfoHash]int),
+	}, nil
+}
+
+// Weight returns the configured weight of torrents in namespace.
+func (a *Allocator) Weight(namespace string) int {
+	for _, r := range a.rules {
+		if r.regexp.MatchString(namespace) {
+			return r.weight
+		}
+	}
+	return 1
+}
+
+// Register adds h to the set of torrents sharing the limit.
+func (a *Allocator) Register(h core.InfoHash, weight int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if w, ok := a.weights[h]; ok {
+		a.total -= w
+	}
+	a.weights[h] = weight
+	a.total += weight
+}
+
+// Unregister removes h from the set of torrents sharing the limit, returning
+// its share to the remaining torrents. Safe to call multiple times.
+func (a *Allocator) Unregister(h core.InfoHash) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if w, ok := a.weights[h]; ok {
+		a.total -= w
+		delete(a.weights, h)
+	}
+}
+
+// Share returns the max number of pending piece requests h may have. Every
+// registered torrent is guaranteed a share of at least 1. Returns -1 if
+// requests for h are unlimited.
+func (a *Allocator) Share(h core.InfoHash) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.weights[h]
+	if a.limit <= 0 || !ok {
+		return -1
+	}
+	share := a.limit * w / a.total
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
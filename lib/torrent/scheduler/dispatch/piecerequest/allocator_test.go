@@ -0,0 +1,85 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package piecerequest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+)
+
+func TestAllocatorSharesLimitByWeight(t *testing.T) {
+	require := require.New(t)
+
+	a, err := NewAllocator(AllocatorConfig{
+		MaxPendingRequests: 12,
+		Weights:            []WeightConfig{{Namespace: "images/.*", Weight: 2}},
+	})
+	require.NoError(err)
+
+	small := core.InfoHashFixture()
+	large := core.InfoHashFixture()
+
+	a.Register(small, a.Weight("images/foo"))
+	require.Equal(12, a.Share(small))
+
+	a.Register(large, a.Weight("datasets/bar"))
+	require.Equal(8, a.Share(small))
+	require.Equal(4, a.Share(large))
+
+	a.Unregister(small)
+	a.Unregister(small)
+	require.Equal(12, a.Share(large))
+	require.Equal(-1, a.Share(small))
+}
+
+func TestAllocatorMinimumShare(t *testing.T) {
+	require := require.New(t)
+
+	a, err := NewAllocator(AllocatorConfig{MaxPendingRequests: 2})
+	require.NoError(err)
+
+	var hs []core.InfoHash
+	for i := 0; i < 5; i++ {
+		h := core.InfoHashFixture()
+		a.Register(h, 1)
+		hs = append(hs, h)
+	}
+	for _, h := range hs {
+		require.Equal(1, a.Share(h))
+	}
+}
+
+func TestAllocatorUnlimited(t *testing.T) {
+	require := require.New(t)
+
+	a, err := NewAllocator(AllocatorConfig{})
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	a.Register(h, 1)
+	require.Equal(-1, a.Share(h))
+}
+
+func TestNewAllocatorInvalidConfig(t *testing.T) {
+	for _, config := range []AllocatorConfig{
+		{Weights: []WeightConfig{{Namespace: "(", Weight: 1}}},
+		{Weights: []WeightConfig{{Namespace: ".*", Weight: 0}}},
+	} {
+		_, err := NewAllocator(config)
+		require.Error(t, err)
+	}
+}
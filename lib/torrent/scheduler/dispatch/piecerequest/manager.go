@@ -66,6 +66,23 @@ type Manager struct {
 
 	policy        pieceSelectionPolicy
 	pipelineLimit int
+
+	// allocator limits pending requests across all peers of the torrent
+	// identified by infoHash. Nil if unlimited.
+	allocator *Allocator
+	infoHash  core.InfoHash
+}
+
+// ManagerOption allows setting optional Manager parameters.
+type ManagerOption func(*Manager)
+
+// WithAllocator limits the pending requests of the Manager to the share of h
+// in a.
+func WithAllocator(a *Allocator, h core.InfoHash) ManagerOption {
+	return func(m *Manager) {
+		m.allocator = a
+		m.infoHash = h
+	}
 }
 
 // NewManager creates a new Manager.
@@ -73,7 +90,8 @@ func NewManager(
 	clk clock.Clock,
 	timeout time.Duration,
 	policy string,
-	pipelineLimit int) (*Manager, error) {
+	pipelineLimit int,
+	opts ...ManagerOption) (*Manager, error) {
 
 	m := &Manager{
 		requests:       make(map[int][]*Request),
@@ -82,6 +100,9 @@ func NewManager(
 		timeout:        timeout,
 		pipelineLimit:  pipelineLimit,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
 
 	switch policy {
 	case DefaultPolicy:
@@ -162,6 +183,18 @@ func (m *Manager) Clear(i int) {
 	}
 }
 
+// SentAt returns the time the request for piece i was sent to peerID.
+func (m *Manager) SentAt(peerID core.PeerID, i int) (time.Time, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	r, ok := m.requestsByPeer[peerID][i]
+	if !ok {
+		return time.Time{}, false
+	}
+	return r.sentAt, true
+}
+
 // PendingPieces returns the pieces for all pending requests to peerID in sorted
 // order. Intended primarily for testing purposes.
 func (m *Manager) PendingPieces(peerID core.PeerID) []int {
@@ -238,15 +271,21 @@ func (m *Manager) validRequest(peerID core.PeerID, i int, allowDuplicates bool)
 func (m *Manager) requestQuota(peerID core.PeerID) int {
 	quota := m.pipelineLimit
 	pm, ok := m.requestsByPeer[peerID]
-	if !ok {
-		return quota
+	if ok {
+		for _, r := range pm {
+			if r.Status == StatusPending && !m.expired(r) {
+				quota--
+				if quota == 0 {
+					break
+				}
+			}
+		}
 	}
 
-	for _, r := range pm {
-		if r.Status == StatusPending && !m.expired(r) {
-			quota--
-			if quota == 0 {
-				break
+	if m.allocator != nil && quota > 0 {
+		if share := m.allocator.Share(m.infoHash); share >= 0 {
+			if remaining := share - m.numPending(); remaining < quota {
+				quota = remaining
 			}
 		}
 	}
@@ -254,6 +293,19 @@ func (m *Manager) requestQuota(peerID core.PeerID) int {
 	return quota
 }
 
+// numPending returns the number of pending requests across all peers.
+func (m *Manager) numPending() int {
+	var n int
+	for _, pm := range m.requestsByPeer {
+		for _, r := range pm {
+			if r.Status == StatusPending && !m.expired(r) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
 func (m *Manager) expired(r *Request) bool {
 	expiresAt := r.sentAt.Add(m.timeout)
 	return m.clock.Now().After(expiresAt)
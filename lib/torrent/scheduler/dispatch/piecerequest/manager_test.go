@@ -406,3 +406,64 @@ func TestRarestFirstPolicy(t *testing.T) {
 	require.NoError(err)
 	require.Empty(pieces)
 }
+
+func TestManagerSentAt(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Add(time.Hour)
+
+	m := newManager(clk, 5*time.Second, DefaultPolicy, 1)
+
+	peerID := core.PeerIDFixture()
+
+	_, ok := m.SentAt(peerID, 0)
+	require.False(ok)
+
+	pieces, err := m.ReservePieces(peerID, bitsetutil.FromBools(true),
+		countsFromInts(0), false)
+	require.NoError(err)
+	require.Equal([]int{0}, pieces)
+
+	sentAt, ok := m.SentAt(peerID, 0)
+	require.True(ok)
+	require.Equal(clk.Now(), sentAt)
+
+	m.Clear(0)
+
+	_, ok = m.SentAt(peerID, 0)
+	require.False(ok)
+}
+
+func TestManagerAllocatorLimitsPendingRequestsAcrossPeers(t *testing.T) {
+	require := require.New(t)
+
+	a, err := NewAllocator(AllocatorConfig{MaxPendingRequests: 8})
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	a.Register(h, 1)
+	a.Register(core.InfoHashFixture(), 1)
+
+	m, err := NewManager(clock.NewMock(), 5*time.Second, DefaultPolicy, 3, WithAllocator(a, h))
+	require.NoError(err)
+
+	candidates := bitsetutil.FromBools(true, true, true, true, true, true)
+	numPeersByPiece := countsFromInts(0, 0, 0, 0, 0, 0)
+
+	peer1 := core.PeerIDFixture()
+	peer2 := core.PeerIDFixture()
+
+	pieces, err := m.ReservePieces(peer1, candidates, numPeersByPiece, false)
+	require.NoError(err)
+	require.Len(pieces, 3)
+
+	// Only 1 of the 4 requests in the torrent's share remain.
+	pieces, err = m.ReservePieces(peer2, candidates, numPeersByPiece, false)
+	require.NoError(err)
+	require.Len(pieces, 1)
+
+	pieces, err = m.ReservePieces(core.PeerIDFixture(), candidates, numPeersByPiece, false)
+	require.NoError(err)
+	require.Empty(pieces)
+}
@@ -16,12 +16,14 @@ package scheduler
 import (
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
 	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/memsize"
 	"github.com/uber/kraken/utils/timeutil"
 
@@ -44,12 +46,14 @@ type eventLoop interface {
 }
 
 type baseEventLoop struct {
+	clk    clock.Clock
 	events chan event
 	done   chan struct{}
 }
 
-func newEventLoop() *baseEventLoop {
+func newEventLoop(clk clock.Clock) *baseEventLoop {
 	return &baseEventLoop{
+		clk:    clk,
 		events: make(chan event),
 		done:   make(chan struct{}),
 	}
@@ -68,7 +72,7 @@ func (l *baseEventLoop) send(e event) bool {
 }
 
 func (l *baseEventLoop) sendTimeout(e event, timeout time.Duration) error {
-	timer := time.NewTimer(timeout)
+	timer := l.clk.Timer(timeout)
 	defer timer.Stop()
 	select {
 	case l.events <- e:
@@ -112,10 +116,20 @@ func (l *liftedEventLoop) DispatcherComplete(d *dispatch.Dispatcher) {
 	l.send(dispatcherCompleteEvent{d})
 }
 
+func (l *liftedEventLoop) DispatcherFailed(d *dispatch.Dispatcher, err error) {
+	l.send(dispatcherFailedEvent{d, err})
+}
+
 func (l *liftedEventLoop) PeerRemoved(peerID core.PeerID, h core.InfoHash) {
 	l.send(peerRemovedEvent{peerID, h})
 }
 
+func (l *liftedEventLoop) PeersExchanged(
+	peerID core.PeerID, h core.InfoHash, peers []*core.PeerInfo) {
+
+	l.send(peerExchangeEvent{peerID, h, peers})
+}
+
 func (l *liftedEventLoop) AnnounceTick() {
 	l.send(announceTickEvent{})
 }
@@ -128,6 +142,9 @@ type connClosedEvent struct {
 // apply ejects the conn from the scheduler's active connections.
 func (e connClosedEvent) apply(s *state) {
 	s.conns.DeleteActive(e.c)
+	if s.sched.flows != nil {
+		s.sched.flows.closed(e.c, networkevent.FlowEndOfFlow)
+	}
 	if err := s.conns.Blacklist(e.c.PeerID(), e.c.InfoHash()); err != nil {
 		s.log("conn", e.c).Infof("Cannot blacklist active conn: %s", err)
 	}
@@ -149,7 +166,12 @@ func (e incomingHandshakeEvent) apply(s *state) {
 		peerNeighbors[i] = peerID
 		i++
 	}
-	if err := s.conns.AddPending(e.pc.PeerID(), e.pc.InfoHash(), peerNeighbors); err != nil {
+	err := s.checkUploadSlots(e.pc.Namespace(), e.pc.InfoHash())
+	if err == nil {
+		err = s.addPendingConn(
+			e.pc.PeerID(), e.pc.InfoHash(), peerNeighbors, s.isOrigin(e.pc.PeerID(), e.pc.InfoHash()))
+	}
+	if err != nil {
 		s.log("peer", e.pc.PeerID(), "hash", e.pc.InfoHash()).Infof(
 			"Rejecting incoming handshake: %s", err)
 		s.sched.torrentlog.IncomingConnectionReject(e.pc.Digest(), e.pc.InfoHash(), e.pc.PeerID(), err)
@@ -204,6 +226,9 @@ func (e failedOutgoingHandshakeEvent) apply(s *state) {
 	if err := s.conns.Blacklist(e.peerID, e.infoHash); err != nil {
 		s.log("peer", e.peerID, "hash", e.infoHash).Infof("Cannot blacklist pending conn: %s", err)
 	}
+	if ctrl, ok := s.torrentControls[e.infoHash]; ok {
+		ctrl.failedPeers = append(ctrl.failedPeers, e.peerID)
+	}
 }
 
 // outgoingConnEvent occurs when a pending outgoing connection finishes handshaking.
@@ -230,6 +255,7 @@ type announceTickEvent struct{}
 // makes an announce request to the tracker.
 func (e announceTickEvent) apply(s *state) {
 	var skipped []core.InfoHash
+	now := s.sched.clock.Now()
 	for {
 		h, ok := s.announceQueue.Next()
 		if !ok {
@@ -246,8 +272,19 @@ func (e announceTickEvent) apply(s *state) {
 			s.log("hash", h).Error("Pulled unknown torrent off announce queue")
 			continue
 		}
-		go s.sched.announce(
-			ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+		if now.Before(ctrl.nextAnnounce) {
+			s.log("hash", h).Debug("Skipping announce for torrent backed off by tracker")
+			skipped = append(skipped, h)
+			continue
+		}
+		go s.sched.announce(announceclient.AnnounceRequest{
+			Namespace: ctrl.namespace,
+			Digest:    ctrl.dispatcher.Digest(),
+			InfoHash:  ctrl.dispatcher.InfoHash(),
+			Complete:  ctrl.dispatcher.Complete(),
+			Exclude:   s.conns.KnownPeers(h),
+			Feedback:  s.takeFeedback(ctrl),
+		})
 		break
 	}
 	// Re-enqueue any torrents we pulled off and ignored, else we would never
@@ -262,41 +299,24 @@ func (e announceTickEvent) apply(s *state) {
 type announceResultEvent struct {
 	infoHash core.InfoHash
 	peers    []*core.PeerInfo
+	wait     time.Duration
 }
 
 // apply selects new peers returned via an announce response to open connections to
 // if there is capacity. These connections are added to the scheduler's pending
 // connections and handshaked asynchronously.
 //
-// Also marks the dispatcher as ready to announce again.
+// Also marks the dispatcher as ready to announce again, once the wait suggested
+// by the tracker has passed.
 func (e announceResultEvent) apply(s *state) {
 	ctrl, ok := s.torrentControls[e.infoHash]
 	if !ok {
 		s.log("hash", e.infoHash).Info("Dispatcher closed after announce response received")
 		return
 	}
+	ctrl.nextAnnounce = s.sched.clock.Now().Add(e.wait)
 	s.announceQueue.Ready(e.infoHash)
-	if ctrl.dispatcher.Complete() {
-		// Torrent is already complete, don't open any new connections.
-		return
-	}
-	for _, p := range e.peers {
-		if p.PeerID == s.sched.pctx.PeerID {
-			// Tracker may return our own peer.
-			continue
-		}
-		if s.conns.Blacklisted(p.PeerID, e.infoHash) {
-			continue
-		}
-		if err := s.conns.AddPending(p.PeerID, e.infoHash, nil); err != nil {
-			if err == connstate.ErrTorrentAtCapacity {
-				break
-			}
-			continue
-		}
-		go s.sched.initializeOutgoingHandshake(
-			p, ctrl.dispatcher.Stat(), ctrl.dispatcher.RemoteBitfields(), ctrl.namespace)
-	}
+	s.addPeers(ctrl, e.peers)
 }
 
 // announceErrEvent occurs when an announce request fails.
@@ -337,7 +357,27 @@ func (e newTorrentEvent) apply(s *state) {
 	ctrl.errors = append(ctrl.errors, e.errc)
 
 	// Immediately announce new torrents.
-	go s.sched.announce(ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), ctrl.dispatcher.Complete())
+	go s.sched.announce(announceclient.AnnounceRequest{
+		Namespace: ctrl.namespace,
+		Digest:    ctrl.dispatcher.Digest(),
+		InfoHash:  ctrl.dispatcher.InfoHash(),
+		Complete:  ctrl.dispatcher.Complete(),
+		Exclude:   s.conns.KnownPeers(ctrl.dispatcher.InfoHash()),
+		Feedback:  s.takeFeedback(ctrl),
+	})
+}
+
+// dispatcherFailedEvent occurs when a dispatcher cannot finish downloading its
+// torrent.
+type dispatcherFailedEvent struct {
+	dispatcher *dispatch.Dispatcher
+	err        error
+}
+
+// apply removes the torrent, failing all pending downloads.
+func (e dispatcherFailedEvent) apply(s *state) {
+	s.log("hash", e.dispatcher.InfoHash()).Errorf("Torrent failed: %s", e.err)
+	s.removeTorrent(e.dispatcher.InfoHash(), ErrTorrentCorrupt)
 }
 
 // dispatcherCompleteEvent occurs when a dispatcher finishes downloading its torrent.
@@ -359,11 +399,15 @@ func (e dispatcherCompleteEvent) apply(s *state) {
 	for _, errc := range ctrl.errors {
 		errc <- nil
 	}
+	if ctrl.completedAt.IsZero() {
+		ctrl.completedAt = s.sched.clock.Now()
+	}
+	var downloadTime time.Duration
 	if ctrl.localRequest {
 		// Normalize the download time for all torrent sizes to a per MB value.
 		// Skip torrents that are less than a MB in size because we can't measure
 		// at that granularity.
-		downloadTime := s.sched.clock.Now().Sub(ctrl.dispatcher.CreatedAt())
+		downloadTime = s.sched.clock.Now().Sub(ctrl.dispatcher.CreatedAt())
 		lengthMB := ctrl.dispatcher.Length() / int64(memsize.MB)
 		if lengthMB > 0 {
 			s.sched.stats.Timer("download_time_per_mb").Record(downloadTime / time.Duration(lengthMB))
@@ -373,8 +417,17 @@ func (e dispatcherCompleteEvent) apply(s *state) {
 	s.log("hash", infoHash).Info("Torrent complete")
 	s.sched.netevents.Produce(networkevent.TorrentCompleteEvent(infoHash, s.sched.pctx.PeerID))
 
-	// Immediately announce completed torrents.
-	go s.sched.announce(ctrl.dispatcher.Digest(), ctrl.dispatcher.InfoHash(), true)
+	// Immediately announce completed torrents. Complete peers receive no
+	// handout, so there is nothing to exclude. The download time is only
+	// reported for torrents this peer requested.
+	go s.sched.announce(announceclient.AnnounceRequest{
+		Namespace:    ctrl.namespace,
+		Digest:       ctrl.dispatcher.Digest(),
+		InfoHash:     ctrl.dispatcher.InfoHash(),
+		Complete:     true,
+		Feedback:     s.takeFeedback(ctrl),
+		DownloadTime: downloadTime,
+	})
 }
 
 // peerRemovedEvent occurs when a dispatcher removes a peer with a closed
@@ -386,6 +439,55 @@ type peerRemovedEvent struct {
 
 func (e peerRemovedEvent) apply(s *state) {}
 
+// peerExchangeEvent occurs when a connected peer shares the addresses of its
+// own peers for a torrent.
+type peerExchangeEvent struct {
+	peerID   core.PeerID
+	infoHash core.InfoHash
+	peers    []*core.PeerInfo
+}
+
+// apply opens connections to the exchanged peers if there is capacity, the same
+// as if they had been returned by the tracker.
+func (e peerExchangeEvent) apply(s *state) {
+	ctrl, ok := s.torrentControls[e.infoHash]
+	if !ok || !s.peerExchangeEnabled(ctrl) {
+		return
+	}
+	s.log("peer", e.peerID, "hash", e.infoHash).Debugf(
+		"Received %d peers via peer exchange", len(e.peers))
+	s.addPeers(ctrl, e.peers)
+}
+
+// flowTickEvent occurs periodically to export the traffic of active conns.
+type flowTickEvent struct{}
+
+func (e flowTickEvent) apply(s *state) {
+	if s.sched.flows != nil {
+		s.sched.flows.tick(s.conns.ActiveConns())
+	}
+}
+
+// peerExchangeTickEvent occurs periodically to share the addresses of connected
+// peers with each other.
+type peerExchangeTickEvent struct{}
+
+// apply sends every active conn the addresses of the other peers connected to
+// its torrent.
+func (e peerExchangeTickEvent) apply(s *state) {
+	conns := make(map[core.InfoHash][]*conn.Conn)
+	for _, c := range s.conns.ActiveConns() {
+		conns[c.InfoHash()] = append(conns[c.InfoHash()], c)
+	}
+	for h, cs := range conns {
+		ctrl, ok := s.torrentControls[h]
+		if !ok || !s.peerExchangeEnabled(ctrl) {
+			continue
+		}
+		s.exchangePeers(ctrl, cs, cs)
+	}
+}
+
 // preemptionTickEvent occurs periodically to preempt unneeded conns and remove
 // idle torrentControls.
 type preemptionTickEvent struct{}
@@ -416,11 +518,24 @@ func (e preemptionTickEvent) apply(s *state) {
 	}
 
 	for h, ctrl := range s.torrentControls {
-		idleSeeder :=
-			ctrl.dispatcher.Complete() &&
-				s.sched.clock.Now().Sub(ctrl.dispatcher.LastReadTime()) >= s.sched.config.SeederTTI
+		var idleSeeder, seeded bool
+		if ctrl.dispatcher.Complete() && !ctrl.completedAt.IsZero() &&
+			s.sched.clock.Now().Sub(ctrl.completedAt) >= ctrl.seeding.MinSeedTime {
+
+			idleSeeder =
+				s.sched.clock.Now().Sub(ctrl.dispatcher.LastReadTime()) >= ctrl.seeding.SeederTTI
+			seeded =
+				ctrl.seeding.SeedRatio > 0 &&
+					float64(ctrl.dispatcher.BytesSent()) >=
+						ctrl.seeding.SeedRatio*float64(ctrl.dispatcher.Length())
+		}
 		if idleSeeder {
 			s.sched.torrentlog.SeedTimeout(ctrl.dispatcher.Digest(), h)
+		} else if seeded {
+			s.log("hash", h, "namespace", ctrl.namespace).Info("Removing torrent which reached seed ratio")
+			s.sched.stats.Counter("seed_ratio_reached").Inc(1)
+			s.removeTorrent(h, ErrTorrentTimeout)
+			continue
 		}
 
 		idleLeecher :=
@@ -432,7 +547,12 @@ func (e preemptionTickEvent) apply(s *state) {
 
 		if idleSeeder || idleLeecher {
 			s.log("hash", h, "inprogress", !ctrl.dispatcher.Complete()).Info("Removing idle torrent")
-			s.removeTorrent(h, ErrTorrentTimeout)
+			err := ErrTorrentTimeout
+			if idleLeecher && ctrl.dispatcher.Empty() {
+				// Distinguishes swarms nobody serves from stalled downloads.
+				err = ErrTorrentNoPeers
+			}
+			s.removeTorrent(h, err)
 		}
 	}
 }
@@ -442,6 +562,13 @@ type emitStatsEvent struct{}
 
 func (e emitStatsEvent) apply(s *state) {
 	s.sched.stats.Gauge("torrents").Update(float64(len(s.torrentControls)))
+	var blacklisted int
+	for _, c := range s.conns.BlacklistSnapshot() {
+		if c.Remaining > 0 {
+			blacklisted++
+		}
+	}
+	s.sched.stats.Gauge("blacklisted_conns").Update(float64(blacklisted))
 }
 
 type blacklistSnapshotEvent struct {
@@ -452,6 +579,18 @@ func (e blacklistSnapshotEvent) apply(s *state) {
 	e.result <- s.conns.BlacklistSnapshot()
 }
 
+// unblacklistEvent occurs when a connection is manually unblacklisted via
+// scheduler API.
+type unblacklistEvent struct {
+	peerID   core.PeerID
+	infoHash core.InfoHash
+	errc     chan error
+}
+
+func (e unblacklistEvent) apply(s *state) {
+	e.errc <- s.conns.Unblacklist(e.peerID, e.infoHash)
+}
+
 // removeTorrentEvent occurs when a torrent is manually removed via scheduler API.
 type removeTorrentEvent struct {
 	digest core.Digest
@@ -484,6 +623,9 @@ type shutdownEvent struct{}
 func (e shutdownEvent) apply(s *state) {
 	for _, c := range s.conns.ActiveConns() {
 		s.log("conn", c).Info("Closing conn to stop scheduler")
+		if s.sched.flows != nil {
+			s.sched.flows.closed(c, networkevent.FlowEndForced)
+		}
 		c.Close()
 	}
 	// Notify local clients of pending torrents that they will not complete.
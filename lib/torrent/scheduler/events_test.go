@@ -14,13 +14,16 @@
 package scheduler
 
 import (
+	"os"
 	"testing"
 	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
@@ -28,10 +31,12 @@ import (
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
+	"github.com/uber/kraken/lib/torrent/storage/piecereader"
 	mockannounceclient "github.com/uber/kraken/mocks/tracker/announceclient"
 	mockmetainfoclient "github.com/uber/kraken/mocks/tracker/metainfoclient"
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/testutil"
+	"github.com/willf/bitset"
 )
 
 const _testNamespace = "noexist"
@@ -66,6 +71,7 @@ type stateMocks struct {
 	announceQueue  announcequeue.Queue
 	torrentArchive storage.TorrentArchive
 	eventLoop      *mockEventLoop
+	clk            *clock.Mock
 }
 
 func newStateMocks(t *testing.T) (*stateMocks, func()) {
@@ -88,6 +94,7 @@ func newStateMocks(t *testing.T) (*stateMocks, func()) {
 		announceQueue:  announcequeue.New(),
 		torrentArchive: agentstorage.NewTorrentArchive(tally.NoopScope, cads, metainfoClient),
 		eventLoop:      &mockEventLoop{t, make(chan event)},
+		clk:            clock.NewMock(),
 	}
 	return mocks, cleanup.Run
 }
@@ -100,7 +107,8 @@ func (m *stateMocks) newState(config Config) *state {
 		core.PeerContextFixture(),
 		m.announceClient,
 		networkevent.NewTestProducer(),
-		withEventLoop(m.eventLoop))
+		withEventLoop(m.eventLoop),
+		withClock(m.clk))
 	if err != nil {
 		panic(err)
 	}
@@ -138,12 +146,13 @@ func TestAnnounceTickEvent(t *testing.T) {
 
 	// First torrent should announce.
 	mocks.announceClient.EXPECT().
-		Announce(
-			ctrls[0].dispatcher.Digest(),
-			ctrls[0].dispatcher.InfoHash(),
-			false,
-			announceclient.V2).
-		Return(nil, time.Second, nil)
+		Announce(announceclient.AnnounceRequest{
+			Namespace: _testNamespace,
+			Digest:    ctrls[0].dispatcher.Digest(),
+			InfoHash:  ctrls[0].dispatcher.InfoHash(),
+			Version:   announceclient.V2,
+		}).
+		Return(&announceclient.Response{Interval: time.Second}, nil)
 
 	announceTickEvent{}.apply(state)
 
@@ -152,6 +161,89 @@ func TestAnnounceTickEvent(t *testing.T) {
 	})
 }
 
+func TestAnnounceTickEventReportsFailedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	peerID := core.PeerIDFixture()
+	require.NoError(state.conns.AddPending(peerID, h, nil))
+	failedOutgoingHandshakeEvent{peerID, h}.apply(state)
+
+	mocks.announceClient.EXPECT().
+		Announce(announceclient.AnnounceRequest{
+			Namespace: _testNamespace,
+			Digest:    ctrl.dispatcher.Digest(),
+			InfoHash:  h,
+			Version:   announceclient.V2,
+			Exclude:   []core.PeerID{peerID},
+			Feedback:  []announceclient.PeerFeedback{{PeerID: peerID, Failed: true}},
+		}).
+		Return(&announceclient.Response{Interval: time.Second}, nil)
+
+	announceTickEvent{}.apply(state)
+
+	mocks.eventLoop.expect(announceResultEvent{infoHash: h})
+
+	// Failures are only reported once.
+	require.Empty(state.takeFeedback(ctrl))
+}
+
+func TestAnnounceTickEventSkipsTorrentsBackedOffByTracker(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	mocks.announceClient.EXPECT().
+		Announce(announceclient.AnnounceRequest{
+			Namespace: _testNamespace,
+			Digest:    ctrl.dispatcher.Digest(),
+			InfoHash:  h,
+			Version:   announceclient.V2,
+		}).
+		Return(&announceclient.Response{Interval: time.Second, TorrentInterval: 30 * time.Second}, nil)
+
+	announceTickEvent{}.apply(state)
+
+	result := announceResultEvent{infoHash: h, wait: 30 * time.Second}
+	mocks.eventLoop.expect(result)
+	result.apply(state)
+
+	// The torrent should not announce until the suggested wait has passed.
+	announceTickEvent{}.apply(state)
+	mocks.clk.Add(29 * time.Second)
+	announceTickEvent{}.apply(state)
+
+	mocks.clk.Add(time.Second)
+
+	mocks.announceClient.EXPECT().
+		Announce(announceclient.AnnounceRequest{
+			Namespace: _testNamespace,
+			Digest:    ctrl.dispatcher.Digest(),
+			InfoHash:  h,
+			Version:   announceclient.V2,
+		}).
+		Return(&announceclient.Response{Interval: time.Second}, nil)
+
+	announceTickEvent{}.apply(state)
+
+	mocks.eventLoop.expect(announceResultEvent{infoHash: h})
+}
+
 func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 	require := require.New(t)
 
@@ -183,12 +275,13 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 	// The first torrent is full and should be skipped, announcing the empty
 	// torrent.
 	mocks.announceClient.EXPECT().
-		Announce(
-			empty.dispatcher.Digest(),
-			empty.dispatcher.InfoHash(),
-			false,
-			announceclient.V2).
-		Return(nil, time.Second, nil)
+		Announce(announceclient.AnnounceRequest{
+			Namespace: _testNamespace,
+			Digest:    empty.dispatcher.Digest(),
+			InfoHash:  empty.dispatcher.InfoHash(),
+			Version:   announceclient.V2,
+		}).
+		Return(&announceclient.Response{Interval: time.Second}, nil)
 
 	announceTickEvent{}.apply(state)
 
@@ -214,13 +307,21 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 		infoHash: c.InfoHash(),
 	})
 
+	// The remaining active conns and the blacklisted closed conn are excluded
+	// from the handout.
+	var known []core.PeerID
+	for _, c := range state.conns.ActiveConns() {
+		known = append(known, c.PeerID())
+	}
+	known = append(known, c.PeerID())
+
+	requests := make(chan announceclient.AnnounceRequest, 1)
 	mocks.announceClient.EXPECT().
-		Announce(
-			full.dispatcher.Digest(),
-			full.dispatcher.InfoHash(),
-			false,
-			announceclient.V2).
-		Return(nil, time.Second, nil)
+		Announce(gomock.Any()).
+		DoAndReturn(func(r announceclient.AnnounceRequest) (*announceclient.Response, error) {
+			requests <- r
+			return &announceclient.Response{Interval: time.Second}, nil
+		})
 
 	announceTickEvent{}.apply(state)
 
@@ -228,4 +329,450 @@ func TestAnnounceTickEventSkipsFullTorrents(t *testing.T) {
 	mocks.eventLoop.expect(announceResultEvent{
 		infoHash: full.dispatcher.InfoHash(),
 	})
+	r := <-requests
+	require.Equal(full.dispatcher.InfoHash(), r.InfoHash)
+	require.ElementsMatch(known, r.Exclude)
+}
+
+// enablePeerExchange overrides PeerExchangeFlag until the returned function
+// is called.
+func enablePeerExchange() func() {
+	featureflag.Global().Override(PeerExchangeFlag, true)
+	return func() { featureflag.Global().ClearOverride(PeerExchangeFlag) }
+}
+
+func TestPeerExchangeEventOpensConnsToExchangedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	defer enablePeerExchange()()
+
+	state := mocks.newState(Config{})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	self := core.PeerInfoFromContext(state.sched.pctx, false)
+	p := core.NewPeerInfo(core.PeerIDFixture(), "localhost", testutil.FreePort(), false, false)
+
+	peerExchangeEvent{core.PeerIDFixture(), h, []*core.PeerInfo{self, p}}.apply(state)
+
+	require.Equal(map[core.PeerID]*core.PeerInfo{p.PeerID: p}, ctrl.peerAddrs)
+	require.ElementsMatch([]core.PeerID{p.PeerID}, state.conns.KnownPeers(h))
+
+	// Nothing listens on the exchanged address.
+	mocks.eventLoop.expect(failedOutgoingHandshakeEvent{p.PeerID, h})
+}
+
+func TestAddPeersKeepsCapacityReservedForOrigins(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		ConnState: connstate.Config{
+			MaxOpenConnectionsPerTorrent:        2,
+			ReservedOriginConnectionsPerTorrent: 1,
+		},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	var peers []*core.PeerInfo
+	for i := 0; i < 3; i++ {
+		peers = append(peers, core.NewPeerInfo(
+			core.PeerIDFixture(), "localhost", testutil.FreePort(), false, false))
+	}
+	origin := core.NewPeerInfo(core.PeerIDFixture(), "localhost", testutil.FreePort(), true, true)
+	peers = append(peers, origin)
+
+	state.addPeers(ctrl, peers)
+
+	expected := []core.PeerID{peers[0].PeerID, origin.PeerID}
+	require.ElementsMatch(expected, state.conns.KnownPeers(h))
+
+	// Nothing listens on the peer addresses.
+	var failed []core.PeerID
+	for range expected {
+		select {
+		case e := <-mocks.eventLoop.c:
+			failed = append(failed, e.(failedOutgoingHandshakeEvent).peerID)
+		case <-time.After(5 * time.Second):
+			require.FailNow("timed out waiting for failed handshakes")
+		}
+	}
+	require.ElementsMatch(expected, failed)
+}
+
+func TestPeerExchangeEventIgnoredWhenDisabled(t *testing.T) {
+	tests := []struct {
+		desc   string
+		flag   bool
+		config Config
+	}{
+		{"flag disabled", false, Config{}},
+		{"disabled in config", true, Config{DisablePeerExchange: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newStateMocks(t)
+			defer cleanup()
+
+			if test.flag {
+				defer enablePeerExchange()()
+			}
+
+			state := mocks.newState(test.config)
+
+			ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+			require.NoError(err)
+			h := ctrl.dispatcher.InfoHash()
+
+			peerExchangeEvent{
+				core.PeerIDFixture(), h, []*core.PeerInfo{core.PeerInfoFixture()},
+			}.apply(state)
+
+			require.Empty(ctrl.peerAddrs)
+			require.Empty(state.conns.KnownPeers(h))
+		})
+	}
+}
+
+func TestPeerExchangeTickEventSharesConnectedPeers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	defer enablePeerExchange()()
+
+	state := mocks.newState(Config{})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+
+	info := ctrl.dispatcher.Stat()
+
+	// Remote ends of the conns, which receive messages sent by state.
+	var remotes []*conn.Conn
+	var peers []*core.PeerInfo
+	for i := 0; i < 3; i++ {
+		remote, c, cleanup := conn.PipeFixture(conn.Config{}, info)
+		defer cleanup()
+
+		require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
+		require.NoError(state.addOutgoingConn(c, info.Bitfield(), info))
+
+		remotes = append(remotes, remote)
+		peers = append(peers, core.NewPeerInfo(c.PeerID(), "localhost", testutil.FreePort(), false, false))
+	}
+	// The address of the last peer is unknown, so it is not shared.
+	for _, p := range peers[:2] {
+		ctrl.peerAddrs[p.PeerID] = p
+	}
+
+	peerExchangeTickEvent{}.apply(state)
+
+	expected := [][]*core.PeerInfo{
+		{peers[1]},
+		{peers[0]},
+		{peers[0], peers[1]},
+	}
+	for i, remote := range remotes {
+		select {
+		case msg := <-remote.Receiver():
+			// Active conns are unordered, so neither are the shared peers.
+			require.ElementsMatch(
+				conn.NewPeerExchangeMessage(expected[i]).Message.PeerExchange.Peers,
+				msg.Message.PeerExchange.Peers)
+		case <-time.After(5 * time.Second):
+			require.FailNow("timed out waiting for peer exchange message")
+		}
+	}
+}
+
+func (m *stateMocks) newCompleteTorrent() storage.Torrent {
+	blob := core.SizedBlobFixture(2, 1)
+
+	m.metainfoClient.EXPECT().
+		Download(_testNamespace, blob.Digest).
+		Return(blob.MetaInfo, nil)
+
+	t, err := m.torrentArchive.CreateTorrent(_testNamespace, blob.Digest)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < t.NumPieces(); i++ {
+		if err := t.WritePiece(piecereader.NewBuffer(blob.Content[i:i+1]), i); err != nil {
+			panic(err)
+		}
+	}
+	return t
+}
+
+func TestPreemptionTickEventKeepsSeederForMinSeedTime(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		SeederTTI: time.Second,
+		SeedingPolicies: []SeedingPolicy{{
+			Namespace:   ".*",
+			MinSeedTime: time.Minute,
+		}},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newCompleteTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	mocks.clk.Add(30 * time.Second)
+	preemptionTickEvent{}.apply(state)
+	require.Contains(state.torrentControls, h)
+
+	mocks.clk.Add(30 * time.Second)
+	preemptionTickEvent{}.apply(state)
+	require.NotContains(state.torrentControls, h)
+}
+
+func TestPreemptionTickEventRemovesSeederAtSeedRatio(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		SeederTTI: time.Hour,
+		SeedingPolicies: []SeedingPolicy{{
+			Namespace: ".*",
+			SeedRatio: 0.5,
+		}},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newCompleteTorrent(), false)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+	info := ctrl.dispatcher.Stat()
+
+	preemptionTickEvent{}.apply(state)
+	require.Contains(state.torrentControls, h)
+
+	remote, c, cleanupConn := conn.PipeFixture(conn.Config{}, info)
+	defer cleanupConn()
+
+	require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
+	require.NoError(state.addOutgoingConn(c, bitset.New(2), info))
+
+	require.NoError(remote.Send(conn.NewPieceRequestMessage(0, 1)))
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return ctrl.dispatcher.BytesSent() > 0
+	}))
+
+	preemptionTickEvent{}.apply(state)
+	require.NotContains(state.torrentControls, h)
+}
+
+// longHorizonConfig disables or stretches the periodic scheduler timers in
+// config, so the mock clock can be advanced by days without firing thousands
+// of ticks.
+func longHorizonConfig(config Config) Config {
+	config.DisablePreemption = true
+	config.DisablePeerExchange = true
+	config.EmitStatsInterval = 24 * time.Hour
+	config.Dispatch.PieceRequestMinTimeout = 24 * time.Hour
+	return config
+}
+
+func TestFailedHandshakeBlacklistExpires(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(longHorizonConfig(Config{
+		ConnState: connstate.Config{
+			BlacklistDuration: 24 * time.Hour,
+		},
+	}))
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	peerID := core.PeerIDFixture()
+	require.NoError(state.conns.AddPending(peerID, h, nil))
+	failedOutgoingHandshakeEvent{peerID, h}.apply(state)
+
+	mocks.clk.Add(24*time.Hour - time.Second)
+	require.True(state.conns.Blacklisted(peerID, h))
+
+	mocks.clk.Add(time.Second)
+	require.False(state.conns.Blacklisted(peerID, h))
+}
+
+func TestPreemptionTickEventClosesIdleConns(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(longHorizonConfig(Config{
+		ConnTTI:    time.Hour,
+		ConnTTL:    48 * time.Hour,
+		LeecherTTI: 72 * time.Hour,
+	}))
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	info := ctrl.dispatcher.Stat()
+
+	_, c, cleanupConn := conn.PipeFixtureWithClock(conn.Config{}, info, mocks.clk)
+	defer cleanupConn()
+
+	require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
+	require.NoError(state.addOutgoingConn(c, info.Bitfield(), info))
+
+	mocks.clk.Add(time.Hour)
+	preemptionTickEvent{}.apply(state)
+	require.False(c.IsClosed())
+
+	mocks.clk.Add(time.Second)
+	preemptionTickEvent{}.apply(state)
+	require.True(c.IsClosed())
+}
+
+func TestPreemptionTickEventClosesExpiredConns(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(longHorizonConfig(Config{
+		ConnTTI:    48 * time.Hour,
+		ConnTTL:    24 * time.Hour,
+		LeecherTTI: 72 * time.Hour,
+	}))
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	info := ctrl.dispatcher.Stat()
+
+	_, c, cleanupConn := conn.PipeFixtureWithClock(conn.Config{}, info, mocks.clk)
+	defer cleanupConn()
+
+	require.NoError(state.conns.AddPending(c.PeerID(), c.InfoHash(), nil))
+	require.NoError(state.addOutgoingConn(c, info.Bitfield(), info))
+
+	for i := 0; i < 24; i++ {
+		preemptionTickEvent{}.apply(state)
+		require.False(c.IsClosed())
+		mocks.clk.Add(time.Hour)
+	}
+
+	mocks.clk.Add(time.Second)
+	preemptionTickEvent{}.apply(state)
+	require.True(c.IsClosed())
+}
+
+func TestCheckUploadSlotsRejectsWhenFull(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		SeedingPolicies: []SeedingPolicy{{
+			Namespace:      ".*",
+			MaxUploadSlots: 1,
+		}},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newCompleteTorrent(), false)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	require.NoError(state.checkUploadSlots(_testNamespace, h))
+
+	require.NoError(state.conns.AddPending(core.PeerIDFixture(), h, nil))
+
+	require.Equal(errUploadSlotsFull, state.checkUploadSlots(_testNamespace, h))
+}
+
+func TestCheckUploadSlotsIgnoresIncompleteTorrents(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newStateMocks(t)
+	defer cleanup()
+
+	state := mocks.newState(Config{
+		SeedingPolicies: []SeedingPolicy{{
+			Namespace:      ".*",
+			MaxUploadSlots: 1,
+		}},
+	})
+
+	ctrl, err := state.addTorrent(_testNamespace, mocks.newTorrent(), true)
+	require.NoError(err)
+	h := ctrl.dispatcher.InfoHash()
+
+	require.NoError(state.conns.AddPending(core.PeerIDFixture(), h, nil))
+
+	require.NoError(state.checkUploadSlots(_testNamespace, h))
+}
+
+func TestRemoveTorrentRetainsPiecesOfTimedOutTorrents(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		config   Config
+		err      error
+		retained bool
+	}{
+		{"timeout", Config{}, ErrTorrentTimeout, true},
+		{"no peers", Config{}, ErrTorrentNoPeers, true},
+		{"corrupt", Config{}, ErrTorrentCorrupt, false},
+		{"removed", Config{}, ErrTorrentRemoved, false},
+		{"discard", Config{DiscardIncompleteTorrents: true}, ErrTorrentTimeout, false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newStateMocks(t)
+			defer cleanup()
+
+			state := mocks.newState(tc.config)
+
+			blob := core.SizedBlobFixture(2, 1)
+
+			mocks.metainfoClient.EXPECT().
+				Download(_testNamespace, blob.Digest).
+				Return(blob.MetaInfo, nil)
+
+			tor, err := mocks.torrentArchive.CreateTorrent(_testNamespace, blob.Digest)
+			require.NoError(err)
+			require.NoError(tor.WritePiece(piecereader.NewBuffer(blob.Content[0:1]), 0))
+
+			ctrl, err := state.addTorrent(_testNamespace, tor, true)
+			require.NoError(err)
+
+			state.removeTorrent(ctrl.dispatcher.InfoHash(), tc.err)
+
+			info, err := mocks.torrentArchive.Stat(_testNamespace, blob.Digest)
+			if tc.retained {
+				require.NoError(err)
+				require.True(info.Bitfield().Test(0))
+			} else {
+				require.True(os.IsNotExist(err))
+			}
+		})
+	}
 }
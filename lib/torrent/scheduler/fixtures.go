@@ -0,0 +1,38 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"time"
+
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ConfigFixture returns a Config with short timeouts suitable for tests.
+func ConfigFixture() Config {
+	return Config{
+		SeederTTI:          10 * time.Second,
+		LeecherTTI:         time.Minute,
+		PreemptionInterval: 500 * time.Millisecond,
+		ConnTTI:            10 * time.Second,
+		ConnTTL:            5 * time.Minute,
+		ConnState:          connstate.Config{},
+		Conn:               conn.ConfigFixture(),
+		Dispatch:           dispatch.Config{},
+		TorrentLog:         log.Config{Disable: true},
+	}.applyDefaults()
+}
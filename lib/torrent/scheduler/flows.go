@@ -0,0 +1,242 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+)
+
+// FlowConfig defines periodic summaries of the traffic of peer connections,
+// which are exported as IPFIX-like JSON records such that network capacity
+// planning can attribute traffic between racks and zones to swarms.
+type FlowConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Interval is how often the traffic of active connections is summarized.
+	// A final summary is exported when a connection closes.
+	Interval time.Duration `yaml:"interval"`
+
+	// SampleRate is the fraction of connections whose flows are exported,
+	// between 0 and 1. Sampling is keyed by the torrent and the peer ids of
+	// both ends, so both peers of a connection make the same decision.
+	SampleRate float64 `yaml:"sample_rate"`
+
+	// Zones maps CIDRs to the zone of the peers within them, e.g. racks.
+	Zones map[string]string `yaml:"zones"`
+
+	// Exporters send flows to stores, e.g. Kafka.
+	Exporters []networkevent.ExporterConfig `yaml:"exporters"`
+}
+
+func (c FlowConfig) applyDefaults() FlowConfig {
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+	if c.SampleRate == 0 {
+		c.SampleRate = 1
+	}
+	return c
+}
+
+type zoneNet struct {
+	net  *net.IPNet
+	zone string
+}
+
+type flowState struct {
+	start time.Time
+	in    int64
+	out   int64
+}
+
+// flowReporter summarizes the traffic of connections since their previous
+// summary. It is owned by the event loop, and thus not thread-safe.
+type flowReporter struct {
+	config   FlowConfig
+	clk      clock.Clock
+	pctx     core.PeerContext
+	zones    []zoneNet
+	exporter networkevent.FlowExporter
+	flows    map[*conn.Conn]*flowState
+}
+
+func newFlowReporter(
+	config FlowConfig,
+	clk clock.Clock,
+	pctx core.PeerContext,
+	stats tally.Scope) (*flowReporter, error) {
+
+	config = config.applyDefaults()
+	if config.SampleRate < 0 || config.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate must be between 0 and 1: %v", config.SampleRate)
+	}
+	if config.Interval < 0 {
+		return nil, errors.New("interval must not be negative")
+	}
+	var zones []zoneNet
+	for cidr, zone := range config.Zones {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %s", zone, err)
+		}
+		zones = append(zones, zoneNet{n, zone})
+	}
+	exporter, err := networkevent.NewFlowExporter(config.Exporters, stats)
+	if err != nil {
+		return nil, fmt.Errorf("flow exporter: %s", err)
+	}
+	return &flowReporter{
+		config:   config,
+		clk:      clk,
+		pctx:     pctx,
+		zones:    zones,
+		exporter: exporter,
+		flows:    make(map[*conn.Conn]*flowState),
+	}, nil
+}
+
+// sampled returns true if flows of c are exported.
+func (r *flowReporter) sampled(c *conn.Conn) bool {
+	return sampleFlow(r.config.SampleRate, c.InfoHash(), r.pctx.PeerID, c.PeerID())
+}
+
+// sampleFlow decides whether the flows of a connection between peers a and b
+// for torrent h are sampled at rate, regardless of which end decides.
+func sampleFlow(rate float64, h core.InfoHash, a, b core.PeerID) bool {
+	if rate >= 1 {
+		return true
+	}
+	x, y := a.String(), b.String()
+	if y < x {
+		x, y = y, x
+	}
+	f := fnv.New64a()
+	f.Write([]byte(h.String() + x + y))
+	return float64(f.Sum64())/math.MaxUint64 < rate
+}
+
+// zone returns the configured zone of ip, and empty string if unknown.
+func (r *flowReporter) zone(ip net.IP) string {
+	for _, z := range r.zones {
+		if z.net.Contains(ip) {
+			return z.zone
+		}
+	}
+	return ""
+}
+
+// tick exports the traffic of conns since their previous summary. Conns
+// without traffic are skipped.
+func (r *flowReporter) tick(conns []*conn.Conn) {
+	for _, c := range conns {
+		r.report(c, networkevent.FlowEndActiveTimeout, false)
+	}
+}
+
+// closed exports the final summary of c.
+func (r *flowReporter) closed(c *conn.Conn, reason int) {
+	r.report(c, reason, true)
+	delete(r.flows, c)
+}
+
+// close sends all queued flows.
+func (r *flowReporter) close() {
+	r.exporter.Close()
+}
+
+func (r *flowReporter) report(c *conn.Conn, reason int, final bool) {
+	if !r.sampled(c) {
+		return
+	}
+	st, ok := r.flows[c]
+	if !ok {
+		st = &flowState{start: c.CreatedAt()}
+		r.flows[c] = st
+	}
+	in, out := c.BytesIn(), c.BytesOut()
+	if !final && in == st.in && out == st.out {
+		return
+	}
+	now := r.clk.Now()
+
+	f := &networkevent.Flow{
+		FlowStartMilliseconds:    st.start.UnixNano() / int64(time.Millisecond),
+		FlowEndMilliseconds:      now.UnixNano() / int64(time.Millisecond),
+		FlowDurationMilliseconds: int64(now.Sub(st.start) / time.Millisecond),
+		FlowEndReason:            reason,
+		ProtocolIdentifier:       6, // TCP.
+		BiflowDirection:          1, // Source is initiator.
+		OctetDeltaCount:          out - st.out,
+		ReverseOctetDeltaCount:   in - st.in,
+		SamplingProbability:      r.config.SampleRate,
+		KrakenInfoHash:           c.InfoHash().String(),
+		KrakenLocalPeerID:        r.pctx.PeerID.String(),
+		KrakenRemotePeerID:       c.PeerID().String(),
+		KrakenLocalZone:          r.pctx.Zone,
+	}
+	if c.OpenedByRemote() {
+		f.BiflowDirection = 2 // Destination is initiator.
+	}
+	if ip, port, ok := splitAddr(c.LocalAddr()); ok {
+		if ip.To4() != nil {
+			f.SourceIPv4Address = ip.String()
+		} else {
+			f.SourceIPv6Address = ip.String()
+		}
+		f.SourceTransportPort = port
+	}
+	if ip, port, ok := splitAddr(c.RemoteAddr()); ok {
+		if ip.To4() != nil {
+			f.DestinationIPv4Address = ip.String()
+		} else {
+			f.DestinationIPv6Address = ip.String()
+		}
+		f.DestinationTransportPort = port
+		f.KrakenRemoteZone = r.zone(ip)
+	}
+	r.exporter.Export(f)
+
+	st.start, st.in, st.out = now, in, out
+}
+
+// splitAddr returns the ip and port of addr, and false if addr is not an IP
+// address, e.g. for in-memory pipes.
+func splitAddr(addr net.Addr) (net.IP, int, bool) {
+	if addr == nil {
+		return nil, 0, false
+	}
+	host, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0, false
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.Atoi(portStr)
+	if ip == nil || err != nil {
+		return nil, 0, false
+	}
+	return ip, port, true
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/scheduler/conn"
+	"github.com/uber/kraken/lib/torrent/storage"
+)
+
+type fakeFlowExporter struct {
+	flows []*networkevent.Flow
+}
+
+func (e *fakeFlowExporter) Export(f *networkevent.Flow) { e.flows = append(e.flows, f) }
+
+func (e *fakeFlowExporter) Close() {}
+
+func flowReporterFixture(
+	config FlowConfig, clk clock.Clock) (*flowReporter, *fakeFlowExporter) {
+
+	config.Exporters = []networkevent.ExporterConfig{{
+		Type:  networkevent.Kafka,
+		URL:   "http://localhost:8082",
+		Topic: "flows",
+	}}
+	r, err := newFlowReporter(config, clk, core.PeerContextFixture(), tally.NoopScope)
+	if err != nil {
+		panic(err)
+	}
+	r.exporter.Close()
+	exporter := &fakeFlowExporter{}
+	r.exporter = exporter
+	return r, exporter
+}
+
+func sendAnnounce(t *testing.T, from, to *conn.Conn) {
+	require.NoError(t, from.Send(conn.NewAnnouncePieceMessage(0)))
+	select {
+	case <-to.Receiver():
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for message")
+	}
+}
+
+func TestFlowReporterExportsDeltas(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+	start := clk.Now()
+
+	r, exporter := flowReporterFixture(FlowConfig{}, clk)
+
+	local, remote, cleanup := conn.PipeFixtureWithClock(
+		conn.Config{}, storage.TorrentInfoFixture(1, 1), clk)
+	defer cleanup()
+
+	sendAnnounce(t, local, remote)
+	sent := local.BytesOut()
+
+	clk.Add(time.Minute)
+	r.tick([]*conn.Conn{local})
+	require.Len(exporter.flows, 1)
+	f := exporter.flows[0]
+	require.Equal(networkevent.FlowEndActiveTimeout, f.FlowEndReason)
+	require.Equal(sent, f.OctetDeltaCount)
+	require.Equal(int64(0), f.ReverseOctetDeltaCount)
+	require.Equal(start.UnixNano()/int64(time.Millisecond), f.FlowStartMilliseconds)
+	require.Equal(int64(60000), f.FlowDurationMilliseconds)
+	require.Equal(1, f.BiflowDirection)
+	require.Equal(local.InfoHash().String(), f.KrakenInfoHash)
+	require.Equal(r.pctx.PeerID.String(), f.KrakenLocalPeerID)
+	require.Equal(local.PeerID().String(), f.KrakenRemotePeerID)
+
+	// Conns without traffic since the last summary are skipped.
+	clk.Add(time.Minute)
+	r.tick([]*conn.Conn{local})
+	require.Len(exporter.flows, 1)
+
+	sendAnnounce(t, remote, local)
+
+	clk.Add(time.Minute)
+	r.closed(local, networkevent.FlowEndOfFlow)
+	require.Len(exporter.flows, 2)
+	f = exporter.flows[1]
+	require.Equal(networkevent.FlowEndOfFlow, f.FlowEndReason)
+	require.Equal(int64(0), f.OctetDeltaCount)
+	require.Equal(remote.BytesOut(), f.ReverseOctetDeltaCount)
+	require.Equal(int64(2*60000), f.FlowDurationMilliseconds)
+	require.Empty(r.flows)
+}
+
+func TestFlowReporterFinalSummaryWithoutTraffic(t *testing.T) {
+	require := require.New(t)
+
+	r, exporter := flowReporterFixture(FlowConfig{}, clock.NewMock())
+
+	_, remote, cleanup := conn.PipeFixture(conn.Config{}, storage.TorrentInfoFixture(1, 1))
+	defer cleanup()
+
+	r.closed(remote, networkevent.FlowEndForced)
+	require.Len(exporter.flows, 1)
+	require.Equal(networkevent.FlowEndForced, exporter.flows[0].FlowEndReason)
+	require.Equal(2, exporter.flows[0].BiflowDirection)
+}
+
+func TestSampleFlowIsSymmetric(t *testing.T) {
+	require := require.New(t)
+
+	var sampled int
+	for i := 0; i < 1000; i++ {
+		h := core.InfoHashFixture()
+		a := core.PeerIDFixture()
+		b := core.PeerIDFixture()
+		s := sampleFlow(0.5, h, a, b)
+		require.Equal(s, sampleFlow(0.5, h, b, a))
+		if s {
+			sampled++
+		}
+		require.True(sampleFlow(1, h, a, b))
+	}
+	require.InDelta(500, sampled, 100)
+}
+
+func TestFlowReporterZone(t *testing.T) {
+	require := require.New(t)
+
+	r, _ := flowReporterFixture(FlowConfig{
+		Zones: map[string]string{
+			"10.0.0.0/16": "zone1",
+			"10.1.0.0/16": "zone2",
+		},
+	}, clock.NewMock())
+
+	require.Equal("zone1", r.zone(net.ParseIP("10.0.3.4")))
+	require.Equal("zone2", r.zone(net.ParseIP("10.1.3.4")))
+	require.Equal("", r.zone(net.ParseIP("10.2.3.4")))
+}
+
+func TestNewFlowReporterInvalidConfig(t *testing.T) {
+	exporters := []networkevent.ExporterConfig{{
+		Type: networkevent.Kafka, URL: "http://localhost:8082", Topic: "flows",
+	}}
+	tests := []struct {
+		desc   string
+		config FlowConfig
+	}{
+		{"invalid sample rate", FlowConfig{SampleRate: 1.5, Exporters: exporters}},
+		{"invalid zone", FlowConfig{Zones: map[string]string{"10.0.0.0": "z"}, Exporters: exporters}},
+		{"no exporters", FlowConfig{}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := newFlowReporter(
+				test.config, clock.NewMock(), core.PeerContextFixture(), tally.NoopScope)
+			require.Error(t, err)
+		})
+	}
+}
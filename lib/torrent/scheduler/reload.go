@@ -55,7 +55,9 @@ func (rs *reloadableScheduler) reload(config Config) error {
 	s.Stop()
 
 	n, err := newScheduler(
-		config, s.torrentArchive, s.stats, s.pctx, s.announceClient, s.netevents)
+		config, s.torrentArchive, s.stats, s.pctx, s.announceClient, s.netevents,
+		withBlacklistStore(s.blacklistStore),
+		withPullRecorder(s.pulls))
 	if err != nil {
 		return fmt.Errorf("create new scheduler: %s", err)
 	}
@@ -25,11 +25,13 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/pullstats"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcer"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
+	"github.com/uber/kraken/lib/torrent/scheduler/dispatch/piecerequest"
 	"github.com/uber/kraken/lib/torrent/scheduler/torrentlog"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/tracker/announceclient"
@@ -41,7 +43,9 @@ var (
 	ErrTorrentNotFound   = errors.New("torrent not found")
 	ErrSchedulerStopped  = errors.New("scheduler has been stopped")
 	ErrTorrentTimeout    = errors.New("torrent timed out")
+	ErrTorrentNoPeers    = errors.New("torrent timed out without peers")
 	ErrTorrentRemoved    = errors.New("torrent manually removed")
+	ErrTorrentCorrupt    = errors.New("torrent failed digest verification")
 	ErrSendEventTimedOut = errors.New("event loop send timed out")
 )
 
@@ -49,7 +53,9 @@ var (
 type Scheduler interface {
 	Stop()
 	Download(namespace string, d core.Digest) error
+	PreAnnounce(namespace string, d core.Digest)
 	BlacklistSnapshot() ([]connstate.BlacklistedConn, error)
+	Unblacklist(peerID core.PeerID, h core.InfoHash) error
 	RemoveTorrent(d core.Digest) error
 	Probe() error
 }
@@ -74,8 +80,10 @@ type scheduler struct {
 
 	listener net.Listener
 
-	preemptionTick <-chan time.Time
-	emitStatsTick  <-chan time.Time
+	preemptionTick   <-chan time.Time
+	emitStatsTick    <-chan time.Time
+	peerExchangeTick <-chan time.Time
+	flowTick         <-chan time.Time
 
 	// TODO(codyg): We only need this hold on this reference for reloading the scheduler...
 	announceClient announceclient.Client
@@ -84,6 +92,18 @@ type scheduler struct {
 
 	netevents networkevent.Producer
 
+	blacklistStore connstate.BlacklistStore
+
+	allocator *piecerequest.Allocator
+
+	seeding *seedingPolicies
+
+	// pulls records pull phase timings of downloads. Nil if disabled.
+	pulls *pullstats.Recorder
+
+	// flows exports traffic summaries of conns. Nil if disabled.
+	flows *flowReporter
+
 	torrentlog *torrentlog.Logger
 
 	logger *zap.SugaredLogger
@@ -97,8 +117,10 @@ type scheduler struct {
 // schedOverrides defines scheduler fields which may be overrided for testing
 // purposes.
 type schedOverrides struct {
-	clock     clock.Clock
-	eventLoop eventLoop
+	clock          clock.Clock
+	eventLoop      eventLoop
+	blacklistStore connstate.BlacklistStore
+	pulls          *pullstats.Recorder
 }
 
 type option func(*schedOverrides)
@@ -111,6 +133,14 @@ func withEventLoop(l eventLoop) option {
 	return func(o *schedOverrides) { o.eventLoop = l }
 }
 
+func withBlacklistStore(bs connstate.BlacklistStore) option {
+	return func(o *schedOverrides) { o.blacklistStore = bs }
+}
+
+func withPullRecorder(r *pullstats.Recorder) option {
+	return func(o *schedOverrides) { o.pulls = r }
+}
+
 // newScheduler creates and starts a scheduler.
 func newScheduler(
 	config Config,
@@ -136,12 +166,15 @@ func newScheduler(
 	})
 
 	overrides := schedOverrides{
-		clock:     clock.New(),
-		eventLoop: newEventLoop(),
+		clock:          clock.New(),
+		blacklistStore: connstate.NoopBlacklistStore{},
 	}
 	for _, opt := range options {
 		opt(&overrides)
 	}
+	if overrides.eventLoop == nil {
+		overrides.eventLoop = newEventLoop(overrides.clock)
+	}
 
 	eventLoop := liftEventLoop(overrides.eventLoop)
 
@@ -150,6 +183,21 @@ func newScheduler(
 		preemptionTick = overrides.clock.Tick(config.PreemptionInterval)
 	}
 
+	var peerExchangeTick <-chan time.Time
+	if !config.DisablePeerExchange {
+		peerExchangeTick = overrides.clock.Tick(config.PeerExchangeInterval)
+	}
+
+	var flowTick <-chan time.Time
+	var flows *flowReporter
+	if config.Flows.Enabled {
+		flows, err = newFlowReporter(config.Flows, overrides.clock, pctx, stats)
+		if err != nil {
+			return nil, fmt.Errorf("flows: %s", err)
+		}
+		flowTick = overrides.clock.Tick(flows.config.Interval)
+	}
+
 	handshaker, err := conn.NewHandshaker(
 		config.Conn, stats, overrides.clock, netevents, pctx.PeerID, eventLoop, slogger)
 	if err != nil {
@@ -161,22 +209,39 @@ func newScheduler(
 		return nil, fmt.Errorf("torrentlog: %s", err)
 	}
 
+	allocator, err := piecerequest.NewAllocator(config.PieceRequestFairness)
+	if err != nil {
+		return nil, fmt.Errorf("piece request allocator: %s", err)
+	}
+
+	seeding, err := newSeedingPolicies(config)
+	if err != nil {
+		return nil, fmt.Errorf("seeding policies: %s", err)
+	}
+
 	s := &scheduler{
-		pctx:           pctx,
-		config:         config,
-		clock:          overrides.clock,
-		torrentArchive: ta,
-		stats:          stats,
-		handshaker:     handshaker,
-		eventLoop:      eventLoop,
-		preemptionTick: preemptionTick,
-		emitStatsTick:  overrides.clock.Tick(config.EmitStatsInterval),
-		announceClient: announceClient,
-		announcer:      announcer.Default(announceClient, eventLoop, overrides.clock, slogger),
-		netevents:      netevents,
-		torrentlog:     tlog,
-		logger:         slogger,
-		done:           done,
+		pctx:             pctx,
+		config:           config,
+		clock:            overrides.clock,
+		torrentArchive:   ta,
+		stats:            stats,
+		handshaker:       handshaker,
+		eventLoop:        eventLoop,
+		preemptionTick:   preemptionTick,
+		emitStatsTick:    overrides.clock.Tick(config.EmitStatsInterval),
+		peerExchangeTick: peerExchangeTick,
+		flowTick:         flowTick,
+		announceClient:   announceClient,
+		announcer:        announcer.Default(announceClient, eventLoop, overrides.clock, slogger),
+		netevents:        netevents,
+		blacklistStore:   overrides.blacklistStore,
+		allocator:        allocator,
+		seeding:          seeding,
+		pulls:            overrides.pulls,
+		flows:            flows,
+		torrentlog:       tlog,
+		logger:           slogger,
+		done:             done,
 	}
 
 	if config.DisablePreemption {
@@ -225,6 +290,9 @@ func (s *scheduler) Stop() {
 		// Waits for all loops to stop.
 		s.wg.Wait()
 
+		if s.flows != nil {
+			s.flows.close()
+		}
 		s.torrentlog.Sync()
 
 		s.log().Info("Scheduler stopped")
@@ -232,12 +300,14 @@ func (s *scheduler) Stop() {
 }
 
 func (s *scheduler) doDownload(namespace string, d core.Digest) (size int64, err error) {
+	start := s.clock.Now()
 	t, err := s.torrentArchive.CreateTorrent(namespace, d)
+	metaInfoTime := s.clock.Now().Sub(start)
 	if err != nil {
 		if err == storage.ErrNotFound {
 			return 0, ErrTorrentNotFound
 		}
-		return 0, fmt.Errorf("create torrent: %s", err)
+		return 0, fmt.Errorf("create torrent: %w", err)
 	}
 
 	// Buffer size of 1 so sends do not block.
@@ -245,13 +315,44 @@ func (s *scheduler) doDownload(namespace string, d core.Digest) (size int64, err
 	if !s.eventLoop.send(newTorrentEvent{namespace, t, errc}) {
 		return 0, ErrSchedulerStopped
 	}
-	return t.Length(), <-errc
+	err = <-errc
+	s.recordPull(namespace, t, metaInfoTime, s.clock.Now().Sub(start)-metaInfoTime, err)
+	return t.Length(), err
+}
+
+// committer is implemented by torrents which report how long it took to
+// commit their download to the cache.
+type committer interface {
+	CommitDuration() time.Duration
+}
+
+// recordPull records the phase timings of downloading t, where downloadTime
+// includes committing t to disk.
+func (s *scheduler) recordPull(
+	namespace string,
+	t storage.Torrent,
+	metaInfoTime time.Duration,
+	downloadTime time.Duration,
+	err error) {
+
+	if s.pulls == nil {
+		return
+	}
+	phases := map[pullstats.Phase]time.Duration{
+		pullstats.PhaseMetaInfoFetch: metaInfoTime,
+	}
+	if c, ok := t.(committer); ok && c.CommitDuration() > 0 {
+		phases[pullstats.PhaseDiskWrite] = c.CommitDuration()
+		downloadTime -= c.CommitDuration()
+	}
+	phases[pullstats.PhaseP2PDownload] = downloadTime
+	s.pulls.RecordBlob(namespace, phases, err)
 }
 
 // Download downloads the torrent given metainfo. Once the torrent is downloaded,
 // it will begin seeding asynchronously.
 func (s *scheduler) Download(namespace string, d core.Digest) error {
-	start := time.Now()
+	start := s.clock.Now()
 	size, err := s.doDownload(namespace, d)
 	if err != nil {
 		var errTag string
@@ -260,10 +361,14 @@ func (s *scheduler) Download(namespace string, d core.Digest) error {
 			errTag = "not_found"
 		case ErrTorrentTimeout:
 			errTag = "timeout"
+		case ErrTorrentNoPeers:
+			errTag = "no_peers"
 		case ErrSchedulerStopped:
 			errTag = "scheduler_stopped"
 		case ErrTorrentRemoved:
 			errTag = "removed"
+		case ErrTorrentCorrupt:
+			errTag = "corrupt"
 		default:
 			errTag = "unknown"
 		}
@@ -272,13 +377,39 @@ func (s *scheduler) Download(namespace string, d core.Digest) error {
 		}).Counter("download_errors").Inc(1)
 		s.torrentlog.DownloadFailure(namespace, d, size, err)
 	} else {
-		downloadTime := time.Since(start)
+		downloadTime := s.clock.Now().Sub(start)
 		recordDownloadTime(s.stats, size, downloadTime)
 		s.torrentlog.DownloadSuccess(namespace, d, size, downloadTime)
 	}
 	return err
 }
 
+// PreAnnounce starts downloading the torrent for d in the background, such
+// that its metainfo fetch and initial announce overlap with whatever the caller
+// does before requesting d. Subsequent Downloads of d wait on the in-flight
+// torrent. Errors are only logged, since Download will surface them.
+func (s *scheduler) PreAnnounce(namespace string, d core.Digest) {
+	go func() {
+		t, err := s.torrentArchive.CreateTorrent(namespace, d)
+		if err != nil {
+			s.stats.Counter("pre_announce_errors").Inc(1)
+			s.log("namespace", namespace, "digest", d).Infof("Error pre-announcing torrent: %s", err)
+			return
+		}
+		// Buffer size of 1 so sends do not block.
+		errc := make(chan error, 1)
+		if !s.eventLoop.send(newTorrentEvent{namespace, t, errc}) {
+			return
+		}
+		s.stats.Counter("pre_announces").Inc(1)
+		// Wait for the result like Download does, such that the event loop
+		// can send later errors to errc without blocking.
+		if err := <-errc; err != nil {
+			s.log("namespace", namespace, "digest", d).Infof("Pre-announced torrent failed: %s", err)
+		}
+	}()
+}
+
 // BlacklistSnapshot returns a snapshot of the current connection blacklist.
 func (s *scheduler) BlacklistSnapshot() ([]connstate.BlacklistedConn, error) {
 	result := make(chan []connstate.BlacklistedConn)
@@ -288,6 +419,17 @@ func (s *scheduler) BlacklistSnapshot() ([]connstate.BlacklistedConn, error) {
 	return <-result, nil
 }
 
+// Unblacklist removes the blacklist entry for peerID/h. Returns
+// connstate.ErrNotBlacklisted if no such entry exists.
+func (s *scheduler) Unblacklist(peerID core.PeerID, h core.InfoHash) error {
+	// Buffer size of 1 so sends do not block.
+	errc := make(chan error, 1)
+	if !s.eventLoop.send(unblacklistEvent{peerID, h, errc}) {
+		return ErrSchedulerStopped
+	}
+	return <-errc
+}
+
 // RemoveTorrent forcibly stops leeching / seeding torrent for d and removes
 // the torrent from disk.
 func (s *scheduler) RemoveTorrent(d core.Digest) error {
@@ -344,6 +486,10 @@ func (s *scheduler) tickerLoop() {
 			s.eventLoop.send(preemptionTickEvent{})
 		case <-s.emitStatsTick:
 			s.eventLoop.send(emitStatsEvent{})
+		case <-s.peerExchangeTick:
+			s.eventLoop.send(peerExchangeTickEvent{})
+		case <-s.flowTick:
+			s.eventLoop.send(flowTickEvent{})
 		case <-s.done:
 			return
 		}
@@ -357,15 +503,15 @@ func (s *scheduler) announceLoop() {
 	s.announcer.Ticker(s.done)
 }
 
-func (s *scheduler) announce(d core.Digest, h core.InfoHash, complete bool) {
-	peers, err := s.announcer.Announce(d, h, complete)
+func (s *scheduler) announce(r announceclient.AnnounceRequest) {
+	peers, wait, err := s.announcer.Announce(r)
 	if err != nil {
 		if err != announceclient.ErrDisabled {
-			s.eventLoop.send(announceErrEvent{h, err})
+			s.eventLoop.send(announceErrEvent{r.InfoHash, err})
 		}
 		return
 	}
-	s.eventLoop.send(announceResultEvent{h, peers})
+	s.eventLoop.send(announceResultEvent{r.InfoHash, peers, wait})
 }
 
 func (s *scheduler) failIncomingHandshake(pc *conn.PendingConn, err error) {
@@ -398,13 +544,13 @@ func (s *scheduler) establishIncomingHandshake(pc *conn.PendingConn, rb conn.Rem
 func (s *scheduler) initializeOutgoingHandshake(
 	p *core.PeerInfo, info *storage.TorrentInfo, rb conn.RemoteBitfields, namespace string) {
 
-	addr := fmt.Sprintf("%s:%d", p.IP, p.Port)
-	result, err := s.handshaker.Initialize(p.PeerID, addr, info, rb, namespace)
+	addrs := p.DialAddrs()
+	result, err := s.handshaker.Initialize(p.PeerID, addrs, info, rb, namespace)
 	if err != nil {
 		s.log(
 			"peer", p.PeerID,
 			"hash", info.InfoHash(),
-			"addr", addr).Infof("Error initializing outgoing handshake: %s", err)
+			"addrs", addrs).Infof("Error initializing outgoing handshake: %s", err)
 		s.eventLoop.send(failedOutgoingHandshakeEvent{p.PeerID, info.InfoHash()})
 		s.torrentlog.OutgoingConnectionReject(info.Digest(), info.InfoHash(), p.PeerID, err)
 		return
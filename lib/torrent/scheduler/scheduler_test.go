@@ -27,6 +27,7 @@ import (
 	"github.com/uber/kraken/lib/torrent/storage/piecereader"
 	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/bitsetutil"
+	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/andres-erbsen/clock"
 	"github.com/stretchr/testify/require"
@@ -38,7 +39,7 @@ func TestDownloadTorrentWithSeederAndLeecher(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 
 	seeder := mocks.newPeer(config)
 	leecher := mocks.newPeer(config)
@@ -56,13 +57,44 @@ func TestDownloadTorrentWithSeederAndLeecher(t *testing.T) {
 	leecher.checkTorrent(t, namespace, blob)
 }
 
+func TestPreAnnounceStartsDownloadWhichDownloadJoins(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newTestMocks(t)
+	defer cleanup()
+
+	config := ConfigFixture()
+
+	seeder := mocks.newPeer(config)
+	leecher := mocks.newPeer(config)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	// Leecher only fetches metainfo once, from PreAnnounce.
+	mocks.metaInfoClient.EXPECT().Download(
+		namespace, blob.Digest).Return(blob.MetaInfo, nil).Times(2)
+
+	seeder.writeTorrent(namespace, blob)
+	require.NoError(seeder.scheduler.Download(namespace, blob.Digest))
+
+	leecher.scheduler.PreAnnounce(namespace, blob.Digest)
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		_, err := leecher.torrentArchive.Stat(namespace, blob.Digest)
+		return err == nil
+	}))
+
+	require.NoError(leecher.scheduler.Download(namespace, blob.Digest))
+	leecher.checkTorrent(t, namespace, blob)
+}
+
 func TestDownloadManyTorrentsWithSeederAndLeecher(t *testing.T) {
 	require := require.New(t)
 
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	namespace := core.TagFixture()
 
 	seeder := mocks.newPeer(config)
@@ -95,7 +127,7 @@ func TestDownloadManyTorrentsWithSeederAndManyLeechers(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	namespace := core.TagFixture()
 
 	seeder := mocks.newPeer(config)
@@ -136,7 +168,7 @@ func TestDownloadTorrentWhenPeersAllHaveDifferentPiece(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	namespace := core.TagFixture()
 
 	peers := mocks.newPeers(10, config)
@@ -175,7 +207,7 @@ func TestSeederTTI(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
@@ -226,7 +258,7 @@ func TestLeecherTTI(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	clk := clock.NewMock()
 	w := newEventWatcher()
 
@@ -245,7 +277,7 @@ func TestLeecherTTI(t *testing.T) {
 
 	w.waitFor(t, preemptionTickEvent{})
 
-	require.Equal(ErrTorrentTimeout, <-errc)
+	require.Equal(ErrTorrentNoPeers, <-errc)
 
 	// Idle leecher should delete torrent file to prevent it from being revived.
 	_, err := p.torrentArchive.Stat(namespace, blob.Digest)
@@ -265,7 +297,7 @@ func TestMultipleDownloadsForSameTorrentSucceed(t *testing.T) {
 	mocks.metaInfoClient.EXPECT().Download(
 		namespace, blob.Digest).Return(blob.MetaInfo, nil).AnyTimes()
 
-	config := configFixture()
+	config := ConfigFixture()
 
 	seeder := mocks.newPeer(config)
 	seeder.writeTorrent(namespace, blob)
@@ -294,7 +326,7 @@ func TestEmitStatsEventTriggers(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	clk := clock.NewMock()
 	w := newEventWatcher()
 
@@ -310,7 +342,7 @@ func TestNetworkEvents(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	config.ConnTTI = 2 * time.Second
 	config.ConnState.BlacklistDuration = 30 * time.Second
 
@@ -370,7 +402,7 @@ func TestPullInactiveTorrent(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
@@ -386,7 +418,12 @@ func TestPullInactiveTorrent(t *testing.T) {
 	// Force announce the scheduler for this torrent to simulate a peer which
 	// is registered in tracker but does not have the torrent in memory.
 	ac := announceclient.New(seeder.pctx, hashring.NoopPassiveRing(hostlist.Fixture(mocks.trackerAddr)), nil)
-	ac.Announce(blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V1)
+	ac.Announce(announceclient.AnnounceRequest{
+		Namespace: namespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V1,
+	})
 
 	leecher := mocks.newPeer(config)
 
@@ -400,7 +437,7 @@ func TestSchedulerReload(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	namespace := core.TagFixture()
 
 	seeder := mocks.newPeer(config)
@@ -437,7 +474,7 @@ func TestSchedulerRemoveTorrent(t *testing.T) {
 
 	w := newEventWatcher()
 
-	p := mocks.newPeer(configFixture(), withEventLoop(w))
+	p := mocks.newPeer(ConfigFixture(), withEventLoop(w))
 
 	blob := core.NewBlobFixture()
 	namespace := core.TagFixture()
@@ -464,7 +501,7 @@ func TestSchedulerProbe(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	p := mocks.newPeer(configFixture())
+	p := mocks.newPeer(ConfigFixture())
 
 	require.NoError(p.scheduler.Probe())
 
@@ -487,7 +524,7 @@ func TestSchedulerProbeTimeoutsIfDeadlocked(t *testing.T) {
 	mocks, cleanup := newTestMocks(t)
 	defer cleanup()
 
-	config := configFixture()
+	config := ConfigFixture()
 	config.ProbeTimeout = 250 * time.Millisecond
 
 	p := mocks.newPeer(config)
@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var errUploadSlotsFull = errors.New("no upload slots left for seeding torrent")
+
+// SeedingPolicy defines how torrents of namespaces matching the Namespace
+// regexp are seeded once complete.
+type SeedingPolicy struct {
+	Namespace string `yaml:"namespace"`
+
+	// SeederTTI overrides Config.SeederTTI for the namespace.
+	SeederTTI time.Duration `yaml:"seeder_tti"`
+
+	// MinSeedTime is the minimum duration a torrent is seeded after it
+	// completes, even if it is idle or reached SeedRatio.
+	MinSeedTime time.Duration `yaml:"min_seed_time"`
+
+	// SeedRatio stops seeding a torrent once the bytes uploaded since it was
+	// opened reach SeedRatio times the torrent length. Zero disables the
+	// ratio, leaving only SeederTTI.
+	SeedRatio float64 `yaml:"seed_ratio"`
+
+	// MaxUploadSlots limits the number of peers a complete torrent accepts
+	// connections from. Zero falls back to the connstate limit.
+	MaxUploadSlots int `yaml:"max_upload_slots"`
+}
+
+type seedingRule struct {
+	regexp *regexp.Regexp
+	policy SeedingPolicy
+}
+
+// seedingPolicies resolves the SeedingPolicy of namespaces.
+type seedingPolicies struct {
+	rules    []seedingRule
+	fallback SeedingPolicy
+}
+
+func newSeedingPolicies(config Config) (*seedingPolicies, error) {
+	var rules []seedingRule
+	for _, p := range config.SeedingPolicies {
+		re, err := regexp.Compile(p.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace regexp %q: %s", p.Namespace, err)
+		}
+		if p.SeedRatio < 0 || p.MaxUploadSlots < 0 {
+			return nil, fmt.Errorf("seeding policy of namespace %q must not be negative", p.Namespace)
+		}
+		if p.SeederTTI == 0 {
+			p.SeederTTI = config.SeederTTI
+		}
+		rules = append(rules, seedingRule{re, p})
+	}
+	return &seedingPolicies{
+		rules:    rules,
+		fallback: SeedingPolicy{SeederTTI: config.SeederTTI},
+	}, nil
+}
+
+// get returns the policy of the first rule matching namespace, or the global
+// seeding behavior if no rule matches.
+func (p *seedingPolicies) get(namespace string) SeedingPolicy {
+	for _, r := range p.rules {
+		if r.regexp.MatchString(namespace) {
+			return r.policy
+		}
+	}
+	return p.fallback
+}
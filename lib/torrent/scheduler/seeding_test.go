@@ -0,0 +1,68 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedingPolicies(t *testing.T) {
+	require := require.New(t)
+
+	p, err := newSeedingPolicies(Config{
+		SeederTTI: 5 * time.Minute,
+		SeedingPolicies: []SeedingPolicy{{
+			Namespace:   "critical/.*",
+			MinSeedTime: time.Hour,
+		}, {
+			Namespace: "scratch/.*",
+			SeederTTI: 10 * time.Second,
+			SeedRatio: 1,
+		}, {
+			Namespace: ".*",
+			SeederTTI: time.Minute,
+		}},
+	})
+	require.NoError(err)
+
+	require.Equal(SeedingPolicy{
+		Namespace:   "critical/.*",
+		SeederTTI:   5 * time.Minute,
+		MinSeedTime: time.Hour,
+	}, p.get("critical/app"))
+	require.Equal(10*time.Second, p.get("scratch/build").SeederTTI)
+	require.Equal(time.Minute, p.get("other").SeederTTI)
+}
+
+func TestSeedingPoliciesFallback(t *testing.T) {
+	require := require.New(t)
+
+	p, err := newSeedingPolicies(Config{SeederTTI: 5 * time.Minute})
+	require.NoError(err)
+	require.Equal(SeedingPolicy{SeederTTI: 5 * time.Minute}, p.get("any"))
+}
+
+func TestSeedingPoliciesInvalid(t *testing.T) {
+	for _, policy := range []SeedingPolicy{
+		{Namespace: "foo/("},
+		{Namespace: ".*", SeedRatio: -1},
+		{Namespace: ".*", MaxUploadSlots: -1},
+	} {
+		_, err := newSeedingPolicies(Config{SeedingPolicies: []SeedingPolicy{policy}})
+		require.Error(t, err)
+	}
+}
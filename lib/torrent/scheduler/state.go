@@ -16,14 +16,19 @@ package scheduler
 import (
 	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"time"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
 	"github.com/uber/kraken/lib/torrent/scheduler/conn"
 	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
 	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
 	"github.com/uber/kraken/lib/torrent/storage"
+	"github.com/uber/kraken/tracker/announceclient"
 	"go.uber.org/zap"
 
 	"github.com/willf/bitset"
@@ -35,6 +40,21 @@ type torrentControl struct {
 	dispatcher   *dispatch.Dispatcher
 	errors       []chan error
 	localRequest bool
+
+	// Peers which failed to handshake since the previous announce.
+	failedPeers []core.PeerID
+
+	// Addresses of remote peers, as returned by the tracker or exchanged by
+	// other peers.
+	peerAddrs map[core.PeerID]*core.PeerInfo
+
+	// The torrent will not announce before nextAnnounce, as suggested by the
+	// tracker based on the health of its swarm.
+	nextAnnounce time.Time
+
+	// How the torrent is seeded once complete, and when it completed.
+	seeding     SeedingPolicy
+	completedAt time.Time
 }
 
 // state is a superset of scheduler, which includes protected state which can
@@ -59,7 +79,8 @@ func newState(s *scheduler, aq announcequeue.Queue) *state {
 		sched:           s,
 		torrentControls: make(map[core.InfoHash]*torrentControl),
 		conns: connstate.New(
-			s.config.ConnState, s.clock, s.pctx.PeerID, s.netevents, s.logger),
+			s.config.ConnState, s.clock, s.pctx.PeerID, s.netevents, s.logger,
+			connstate.WithBlacklistStore(s.blacklistStore)),
 		announceQueue: aq,
 	}
 }
@@ -78,7 +99,8 @@ func (s *state) addTorrent(
 		s.sched.pctx.PeerID,
 		t,
 		s.sched.logger,
-		s.sched.torrentlog)
+		s.sched.torrentlog,
+		dispatch.WithAllocator(s.sched.allocator, s.sched.allocator.Weight(namespace)))
 	if err != nil {
 		return nil, fmt.Errorf("new dispatcher: %s", err)
 	}
@@ -86,6 +108,11 @@ func (s *state) addTorrent(
 		namespace:    namespace,
 		dispatcher:   d,
 		localRequest: localRequest,
+		peerAddrs:    make(map[core.PeerID]*core.PeerInfo),
+		seeding:      s.sched.seeding.get(namespace),
+	}
+	if t.Complete() {
+		ctrl.completedAt = s.sched.clock.Now()
 	}
 	s.announceQueue.Add(t.InfoHash())
 	s.sched.netevents.Produce(networkevent.AddTorrentEvent(
@@ -111,11 +138,28 @@ func (s *state) removeTorrent(h core.InfoHash, err error) {
 			errc <- err
 		}
 		s.sched.netevents.Produce(networkevent.TorrentCancelledEvent(h, s.sched.pctx.PeerID))
-		s.sched.torrentArchive.DeleteTorrent(ctrl.dispatcher.Digest())
+		d := ctrl.dispatcher.Digest()
+		if s.retainable(err) {
+			if err := s.sched.torrentArchive.RetainTorrent(d); err != nil {
+				s.log("hash", h).Errorf("Error retaining incomplete torrent: %s", err)
+			}
+		} else {
+			s.sched.torrentArchive.DeleteTorrent(d)
+		}
 	}
 	delete(s.torrentControls, h)
 }
 
+// retainable returns true if the pieces of a torrent removed with err should
+// be kept for the next download of the torrent. Pieces of corrupt or manually
+// removed torrents are always deleted.
+func (s *state) retainable(err error) bool {
+	if s.sched.config.DiscardIncompleteTorrents {
+		return false
+	}
+	return err == ErrTorrentTimeout || err == ErrTorrentNoPeers
+}
+
 // addOutgoingConn adds a conn, initialized by us, to state. The conn must already
 // be in a pending state, and the torrent control must already be initialized.
 func (s *state) addOutgoingConn(c *conn.Conn, b *bitset.BitSet, info *storage.TorrentInfo) error {
@@ -130,6 +174,7 @@ func (s *state) addOutgoingConn(c *conn.Conn, b *bitset.BitSet, info *storage.To
 	if err := ctrl.dispatcher.AddPeer(c.PeerID(), b, c); err != nil {
 		return fmt.Errorf("add conn to dispatcher: %s", err)
 	}
+	s.sendKnownPeers(ctrl, c)
 	return nil
 }
 
@@ -157,9 +202,165 @@ func (s *state) addIncomingConn(
 	if err := ctrl.dispatcher.AddPeer(c.PeerID(), b, c); err != nil {
 		return fmt.Errorf("add conn to dispatcher: %s", err)
 	}
+	s.sendKnownPeers(ctrl, c)
+	return nil
+}
+
+// checkUploadSlots returns errUploadSlotsFull if h is a complete torrent which
+// has no upload slots left under its seeding policy. Torrents without a torrent
+// control are only opened by remote peers, so they are assumed to be complete.
+func (s *state) checkUploadSlots(namespace string, h core.InfoHash) error {
+	policy := s.sched.seeding.get(namespace)
+	if ctrl, ok := s.torrentControls[h]; ok {
+		if !ctrl.dispatcher.Complete() {
+			return nil
+		}
+		policy = ctrl.seeding
+	}
+	if policy.MaxUploadSlots > 0 && s.conns.NumConns(h) >= policy.MaxUploadSlots {
+		return errUploadSlotsFull
+	}
 	return nil
 }
 
+// addPeers records the addresses of peers of ctrl's torrent and opens
+// connections to them if there is capacity. These connections are added to the
+// scheduler's pending connections and handshaked asynchronously.
+func (s *state) addPeers(ctrl *torrentControl, peers []*core.PeerInfo) {
+	h := ctrl.dispatcher.InfoHash()
+	for _, p := range peers {
+		if p.PeerID != s.sched.pctx.PeerID {
+			ctrl.peerAddrs[p.PeerID] = p
+		}
+	}
+	if ctrl.dispatcher.Complete() {
+		// Torrent is already complete, don't open any new connections.
+		return
+	}
+	if s.sched.config.DialOriginsFirst {
+		peers = append([]*core.PeerInfo(nil), peers...)
+		sort.SliceStable(peers, func(i, j int) bool {
+			return peers[i].Origin && !peers[j].Origin
+		})
+	}
+	for _, p := range peers {
+		if p.PeerID == s.sched.pctx.PeerID {
+			// Tracker may return our own peer.
+			continue
+		}
+		if s.conns.Blacklisted(p.PeerID, h) {
+			continue
+		}
+		if err := s.addPendingConn(p.PeerID, h, nil, p.Origin); err != nil {
+			if err == connstate.ErrTorrentAtCapacity {
+				break
+			}
+			continue
+		}
+		go s.sched.initializeOutgoingHandshake(
+			p, ctrl.dispatcher.Stat(), ctrl.dispatcher.RemoteBitfields(), ctrl.namespace)
+	}
+}
+
+// addPendingConn adds a pending conn to peerID, using the connection capacity
+// of its peer class.
+func (s *state) addPendingConn(
+	peerID core.PeerID, h core.InfoHash, neighbors []core.PeerID, origin bool) error {
+
+	if origin {
+		return s.conns.AddPendingOrigin(peerID, h, neighbors)
+	}
+	return s.conns.AddPending(peerID, h, neighbors)
+}
+
+// isOrigin returns true if peerID is known to be an origin peer of h. Peers
+// whose address is unknown are assumed to be agents.
+func (s *state) isOrigin(peerID core.PeerID, h core.InfoHash) bool {
+	ctrl, ok := s.torrentControls[h]
+	if !ok {
+		return false
+	}
+	p, ok := ctrl.peerAddrs[peerID]
+	return ok && p.Origin
+}
+
+// sendKnownPeers sends a newly added conn the addresses of the other peers
+// connected to its torrent, so it does not have to wait for the next peer
+// exchange tick.
+func (s *state) sendKnownPeers(ctrl *torrentControl, c *conn.Conn) {
+	if !s.peerExchangeEnabled(ctrl) {
+		return
+	}
+	var active []*conn.Conn
+	for _, ac := range s.conns.ActiveConns() {
+		if ac.InfoHash() == c.InfoHash() {
+			active = append(active, ac)
+		}
+	}
+	s.exchangePeers(ctrl, []*conn.Conn{c}, active)
+}
+
+// peerExchangeEnabled returns whether peer addresses of ctrl's torrent may be
+// shared with and received from other peers.
+func (s *state) peerExchangeEnabled(ctrl *torrentControl) bool {
+	return !s.sched.config.DisablePeerExchange &&
+		featureflag.EnabledFor(PeerExchangeFlag, ctrl.namespace)
+}
+
+// exchangePeers sends each recipient the addresses of the active peers of
+// ctrl's torrent, excluding the recipient itself. Only peers with a known
+// address are shared, i.e. peers which were returned by the tracker or
+// exchanged by other peers.
+func (s *state) exchangePeers(ctrl *torrentControl, recipients, active []*conn.Conn) {
+	var known []*core.PeerInfo
+	for _, c := range active {
+		p, ok := ctrl.peerAddrs[c.PeerID()]
+		if !ok {
+			continue
+		}
+		info := *p
+		info.Complete = ctrl.dispatcher.PeerComplete(c.PeerID())
+		known = append(known, &info)
+	}
+	if len(known) == 0 {
+		return
+	}
+	for _, r := range recipients {
+		peers := make([]*core.PeerInfo, 0, len(known))
+		for _, p := range known {
+			if p.PeerID != r.PeerID() {
+				peers = append(peers, p)
+			}
+		}
+		if len(peers) == 0 {
+			continue
+		}
+		if len(peers) > s.sched.config.MaxExchangedPeers {
+			rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+			peers = peers[:s.sched.config.MaxExchangedPeers]
+		}
+		if err := r.Send(conn.NewPeerExchangeMessage(peers)); err != nil {
+			s.log("conn", r).Infof("Error sending peer exchange: %s", err)
+			continue
+		}
+		s.sched.stats.Counter("exchanged_peers_sent").Inc(int64(len(peers)))
+	}
+}
+
+// takeFeedback collects feedback on the remote peers of ctrl's torrent since
+// the previous call, to be reported in the next announce.
+func (s *state) takeFeedback(ctrl *torrentControl) []announceclient.PeerFeedback {
+	var feedback []announceclient.PeerFeedback
+	for peerID, n := range ctrl.dispatcher.TakeBytesReceived() {
+		feedback = append(feedback, announceclient.PeerFeedback{PeerID: peerID, BytesReceived: n})
+	}
+	for _, peerID := range ctrl.failedPeers {
+		feedback = append(feedback, announceclient.PeerFeedback{PeerID: peerID, Failed: true})
+	}
+	ctrl.failedPeers = nil
+	return feedback
+}
+
 func (s *state) log(args ...interface{}) *zap.SugaredLogger {
 	return s.sched.log(args...)
 }
@@ -16,15 +16,14 @@ package scheduler
 import (
 	"flag"
 	"io/ioutil"
-	"net"
 	"os"
 	"reflect"
-	"strconv"
 	"testing"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
@@ -35,9 +34,6 @@ import (
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler/announcequeue"
-	"github.com/uber/kraken/lib/torrent/scheduler/conn"
-	"github.com/uber/kraken/lib/torrent/scheduler/connstate"
-	"github.com/uber/kraken/lib/torrent/scheduler/dispatch"
 	"github.com/uber/kraken/lib/torrent/storage"
 	"github.com/uber/kraken/lib/torrent/storage/agentstorage"
 	"github.com/uber/kraken/lib/torrent/storage/piecereader"
@@ -67,20 +63,6 @@ func Init() {
 	log.ConfigureLogger(zapConfig)
 }
 
-func configFixture() Config {
-	return Config{
-		SeederTTI:          10 * time.Second,
-		LeecherTTI:         time.Minute,
-		PreemptionInterval: 500 * time.Millisecond,
-		ConnTTI:            10 * time.Second,
-		ConnTTL:            5 * time.Minute,
-		ConnState:          connstate.Config{},
-		Conn:               conn.ConfigFixture(),
-		Dispatch:           dispatch.Config{},
-		TorrentLog:         log.Config{Disable: true},
-	}.applyDefaults()
-}
-
 type testMocks struct {
 	ctrl           *gomock.Controller
 	metaInfoClient *mockmetainfoclient.MockClient
@@ -130,7 +112,7 @@ func (m *testMocks) newPeer(config Config, options ...option) *testPeer {
 		PeerID: core.PeerIDFixture(),
 		Zone:   "zone1",
 		IP:     "localhost",
-		Port:   findFreePort(),
+		Port:   testutil.FreePort(),
 	}
 	ac := announceclient.New(pctx, hashring.NoopPassiveRing(hostlist.Fixture(m.trackerAddr)), nil)
 	tp := networkevent.NewTestProducer()
@@ -193,23 +175,6 @@ func (p *testPeer) checkTorrent(t *testing.T, namespace string, blob *core.BlobF
 	require.Equal(blob.Content, result)
 }
 
-func findFreePort() int {
-	l, err := net.Listen("tcp", "localhost:0")
-	if err != nil {
-		panic(err)
-	}
-	defer l.Close()
-	_, portStr, err := net.SplitHostPort(l.Addr().String())
-	if err != nil {
-		panic(err)
-	}
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		panic(err)
-	}
-	return port
-}
-
 type hasConnEvent struct {
 	peerID   core.PeerID
 	infoHash core.InfoHash
@@ -311,7 +276,7 @@ type eventWatcher struct {
 
 func newEventWatcher() *eventWatcher {
 	return &eventWatcher{
-		l:      newEventLoop(),
+		l:      newEventLoop(clock.New()),
 		events: make(chan event),
 	}
 }
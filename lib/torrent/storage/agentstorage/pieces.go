@@ -141,7 +141,7 @@ func restorePieces(
 		pieces = append(pieces, &piece{status: _empty})
 	}
 	md := newPieceStatusMetadata(pieces)
-	if err := cads.Download().GetOrSetMetadata(d.Hex(), md); cads.InCacheError(err) {
+	if err := cads.Download().GetOrSetMetadata(d.Name(), md); cads.InCacheError(err) {
 		// File is in cache state -- initialize completed pieces.
 		for _, p := range pieces {
 			p.status = _complete
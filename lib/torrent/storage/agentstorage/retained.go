@@ -0,0 +1,118 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package agentstorage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/store/metadata"
+)
+
+const _retainedSuffix = "_retained"
+
+func init() {
+	metadata.Register(regexp.MustCompile(_retainedSuffix), retainedMetadataFactory{})
+}
+
+type retainedMetadataFactory struct{}
+
+func (m retainedMetadataFactory) Create(suffix string) metadata.Metadata {
+	return &retainedMetadata{}
+}
+
+// retainedMetadata marks a download file whose torrent was removed before it
+// completed. The complete pieces of retained downloads are re-verified before
+// they are served again.
+type retainedMetadata struct {
+	retained bool
+}
+
+func (m *retainedMetadata) GetSuffix() string {
+	return _retainedSuffix
+}
+
+func (m *retainedMetadata) Movable() bool {
+	return false
+}
+
+func (m *retainedMetadata) Serialize() ([]byte, error) {
+	if m.retained {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+func (m *retainedMetadata) Deserialize(b []byte) error {
+	m.retained = len(b) > 0 && b[0] == 1
+	return nil
+}
+
+// reverifyRetainedPieces hashes every complete piece of a retained download
+// file against mi, marking pieces which no longer match as empty so they are
+// downloaded again. Returns the number of bytes of pieces which were kept and
+// the number of pieces which were discarded. No-ops if the download file was
+// not retained.
+func reverifyRetainedPieces(
+	cads *store.CADownloadStore, mi *core.MetaInfo) (reused int64, discarded int, err error) {
+
+	name := mi.Digest().Name()
+
+	var rm retainedMetadata
+	if err := cads.Download().GetMetadata(name, &rm); err != nil {
+		if os.IsNotExist(err) || cads.InCacheError(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("get retained metadata: %s", err)
+	}
+	if !rm.retained {
+		return 0, 0, nil
+	}
+
+	var psm pieceStatusMetadata
+	if err := cads.Download().GetMetadata(name, &psm); err != nil {
+		return 0, 0, fmt.Errorf("get piece metadata: %s", err)
+	}
+	f, err := cads.Download().GetFileReader(name)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get download reader: %s", err)
+	}
+	defer f.Close()
+
+	for i, p := range psm.pieces {
+		if p.status != _complete {
+			continue
+		}
+		length := mi.GetPieceLength(i)
+		h := core.PieceHash()
+		_, err := io.Copy(h, io.NewSectionReader(f, mi.PieceLength()*int64(i), length))
+		if err == nil && h.Sum32() == mi.GetPieceSum(i) {
+			reused += length
+			continue
+		}
+		if _, err := cads.Download().SetMetadataAt(
+			name, &pieceStatusMetadata{}, []byte{byte(_empty)}, int64(i)); err != nil {
+			return 0, 0, fmt.Errorf("write piece metadata: %s", err)
+		}
+		discarded++
+	}
+	if _, err := cads.Download().SetMetadata(name, &retainedMetadata{false}); err != nil {
+		return 0, 0, fmt.Errorf("clear retained metadata: %s", err)
+	}
+	return reused, discarded, nil
+}
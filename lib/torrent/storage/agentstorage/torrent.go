@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
@@ -54,6 +55,7 @@ type Torrent struct {
 	pieces      []*piece
 	numComplete *atomic.Int32
 	committed   *atomic.Bool
+	commitTime  *atomic.Duration
 }
 
 // NewTorrent creates a new Torrent.
@@ -63,21 +65,21 @@ func NewTorrent(cads caDownloadStore, mi *core.MetaInfo) (*Torrent, error) {
 		return nil, fmt.Errorf("restore pieces: %s", err)
 	}
 
-	committed := false
-	if numComplete == len(pieces) {
-		if err := cads.MoveDownloadFileToCache(mi.Digest().Hex()); err != nil && !os.IsExist(err) {
-			return nil, fmt.Errorf("move file to cache: %s", err)
-		}
-		committed = true
-	}
-
-	return &Torrent{
+	t := &Torrent{
 		cads:        cads,
 		metaInfo:    mi,
 		pieces:      pieces,
 		numComplete: atomic.NewInt32(int32(numComplete)),
-		committed:   atomic.NewBool(committed),
-	}, nil
+		committed:   atomic.NewBool(false),
+		commitTime:  atomic.NewDuration(0),
+	}
+	if numComplete == len(pieces) {
+		// Pieces of a corrupt download are reset by commit and downloaded again.
+		if err := t.commit(); err != nil && !store.IsDigestMismatch(err) {
+			return nil, fmt.Errorf("move file to cache: %s", err)
+		}
+	}
+	return t, nil
 }
 
 // Digest returns the digest of the target blob.
@@ -143,7 +145,7 @@ func (t *Torrent) String() string {
 	downloaded := int(float64(t.BytesDownloaded()) / float64(t.metaInfo.Length()) * 100)
 	return fmt.Sprintf(
 		"torrent(name=%s, hash=%s, downloaded=%d%%)",
-		t.Digest().Hex(), t.InfoHash().Hex(), downloaded)
+		t.Digest().Name(), t.InfoHash().Hex(), downloaded)
 }
 
 func (t *Torrent) getPiece(pi int) (*piece, error) {
@@ -156,7 +158,7 @@ func (t *Torrent) getPiece(pi int) (*piece, error) {
 // markPieceComplete must only be called once per piece.
 func (t *Torrent) markPieceComplete(pi int) error {
 	updated, err := t.cads.Download().SetMetadataAt(
-		t.Digest().Hex(), &pieceStatusMetadata{}, []byte{byte(_complete)}, int64(pi))
+		t.Digest().Name(), &pieceStatusMetadata{}, []byte{byte(_complete)}, int64(pi))
 	if err != nil {
 		return fmt.Errorf("write piece metadata: %s", err)
 	}
@@ -164,7 +166,7 @@ func (t *Torrent) markPieceComplete(pi int) error {
 		// This could mean there's another thread with a Torrent instance using
 		// the same file as us.
 		log.Errorf(
-			"Invariant violation: piece marked complete twice: piece %d in %s", pi, t.Digest().Hex())
+			"Invariant violation: piece marked complete twice: piece %d in %s", pi, t.Digest().Name())
 	}
 	t.pieces[pi].markComplete()
 	t.numComplete.Inc()
@@ -173,7 +175,7 @@ func (t *Torrent) markPieceComplete(pi int) error {
 
 // writePiece writes data to piece pi. If the write succeeds, marks the piece as completed.
 func (t *Torrent) writePiece(src storage.PieceReader, pi int) error {
-	f, err := t.cads.GetDownloadFileReadWriter(t.metaInfo.Digest().Hex())
+	f, err := t.cads.GetDownloadFileReadWriter(t.metaInfo.Digest().Name())
 	if err != nil {
 		return fmt.Errorf("get download writer: %s", err)
 	}
@@ -235,16 +237,67 @@ func (t *Torrent) WritePiece(src storage.PieceReader, pi int) error {
 	}
 
 	if int(t.numComplete.Load()) == len(t.pieces) {
-		// Multiple threads may attempt to move the download file to cache, however
-		// only one will succeed while the others will receive (and ignore) file exist
-		// error.
-		err := t.cads.MoveDownloadFileToCache(t.metaInfo.Digest().Hex())
-		if err != nil && !os.IsExist(err) {
+		if err := t.commit(); err != nil {
 			return fmt.Errorf("download completed but failed to move file to cache directory: %s", err)
 		}
+	}
+
+	return nil
+}
+
+// commit moves the completed download file to cache. If the file does not match
+// its digest, all pieces are discarded so they are downloaded again, unless the
+// store is configured to fail hard, in which case ErrTorrentCorrupt is returned.
+// CommitDuration returns the time spent verifying and moving the downloaded
+// file into the cache, or 0 if t has not been committed.
+func (t *Torrent) CommitDuration() time.Duration {
+	return t.commitTime.Load()
+}
+
+func (t *Torrent) commit() error {
+	// Multiple threads may attempt to move the download file to cache, however
+	// only one will succeed while the others will receive (and ignore) file exist
+	// error.
+	start := time.Now()
+	err := t.cads.MoveDownloadFileToCache(t.metaInfo.Digest().Name())
+	if err == nil {
+		t.commitTime.Store(time.Since(start))
+	}
+	if err == nil || os.IsExist(err) {
 		t.committed.Store(true)
+		return nil
+	}
+	mismatch, ok := err.(*store.DigestMismatchError)
+	if !ok {
+		return err
+	}
+	log.With("digest", t.Digest().Name()).Errorf("Downloaded torrent is corrupt: %s", mismatch)
+	if mismatch.Fatal {
+		return storage.ErrTorrentCorrupt
 	}
+	if err := t.resetPieces(); err != nil {
+		return fmt.Errorf("reset pieces: %s", err)
+	}
+	return mismatch
+}
 
+// resetPieces marks all pieces as empty. Only one of multiple threads which
+// complete the torrent concurrently will reset its pieces.
+func (t *Torrent) resetPieces() error {
+	if !t.numComplete.CAS(int32(len(t.pieces)), 0) {
+		return nil
+	}
+	empty := make([]*piece, len(t.pieces))
+	for i := range empty {
+		empty[i] = &piece{status: _empty}
+	}
+	if _, err := t.cads.Download().SetMetadata(
+		t.Digest().Name(), newPieceStatusMetadata(empty)); err != nil {
+		return fmt.Errorf("write piece metadata: %s", err)
+	}
+	for _, p := range t.pieces {
+		p.markEmpty()
+	}
 	return nil
 }
 
@@ -253,7 +306,7 @@ type opener struct {
 }
 
 func (o *opener) Open() (store.FileReader, error) {
-	return o.torrent.cads.Any().GetFileReader(o.torrent.Digest().Hex())
+	return o.torrent.cads.Any().GetFileReader(o.torrent.Digest().Name())
 }
 
 // GetPieceReader returns a reader for piece pi.
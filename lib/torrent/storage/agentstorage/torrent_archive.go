@@ -52,11 +52,11 @@ func NewTorrentArchive(
 // file does not exist. Ignores namespace.
 func (a *TorrentArchive) Stat(namespace string, d core.Digest) (*storage.TorrentInfo, error) {
 	var tm metadata.TorrentMeta
-	if err := a.cads.Any().GetMetadata(d.Hex(), &tm); err != nil {
+	if err := a.cads.Any().GetMetadata(d.Name(), &tm); err != nil {
 		return nil, err
 	}
 	var psm pieceStatusMetadata
-	if err := a.cads.Any().GetMetadata(d.Hex(), &psm); err != nil {
+	if err := a.cads.Any().GetMetadata(d.Name(), &psm); err != nil {
 		return nil, err
 	}
 	b := bitset.New(uint(len(psm.pieces)))
@@ -73,14 +73,14 @@ func (a *TorrentArchive) Stat(namespace string, d core.Digest) (*storage.Torrent
 // if no metainfo was found.
 func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage.Torrent, error) {
 	var tm metadata.TorrentMeta
-	if err := a.cads.Any().GetMetadata(d.Hex(), &tm); os.IsNotExist(err) {
+	if err := a.cads.Any().GetMetadata(d.Name(), &tm); os.IsNotExist(err) {
 		downloadTimer := a.stats.Timer("metainfo_download").Start()
 		mi, err := a.metaInfoClient.Download(namespace, d)
 		if err != nil {
 			if err == metainfoclient.ErrNotFound {
 				return nil, storage.ErrNotFound
 			}
-			return nil, fmt.Errorf("download metainfo: %s", err)
+			return nil, fmt.Errorf("download metainfo: %w", err)
 		}
 		downloadTimer.Stop()
 
@@ -89,41 +89,80 @@ func (a *TorrentArchive) CreateTorrent(namespace string, d core.Digest) (storage
 		// because someone else beats us to it. However, we catch a lucky break
 		// because the only piece of metainfo we use is file length -- which digest
 		// is derived from, so it's "okay".
-		createErr := a.cads.CreateDownloadFile(mi.Digest().Hex(), mi.Length())
+		createErr := a.cads.CreateDownloadFile(mi.Digest().Name(), mi.Length())
 		if createErr != nil &&
 			!(a.cads.InDownloadError(createErr) || a.cads.InCacheError(createErr)) {
 			return nil, fmt.Errorf("create download file: %s", createErr)
 		}
 		tm.MetaInfo = mi
-		if err := a.cads.Any().GetOrSetMetadata(d.Hex(), &tm); err != nil {
+		if err := a.cads.Any().GetOrSetMetadata(d.Name(), &tm); err != nil {
 			return nil, fmt.Errorf("get or set metainfo: %s", err)
 		}
 	} else if err != nil {
 		return nil, fmt.Errorf("get metainfo: %s", err)
 	}
-	t, err := NewTorrent(a.cads, tm.MetaInfo)
-	if err != nil {
-		return nil, fmt.Errorf("initialize torrent: %s", err)
-	}
-	return t, nil
+	return a.newTorrent(tm.MetaInfo)
 }
 
 // GetTorrent returns a Torrent for an existing metainfo / file on disk. Ignores namespace.
 func (a *TorrentArchive) GetTorrent(namespace string, d core.Digest) (storage.Torrent, error) {
 	var tm metadata.TorrentMeta
-	if err := a.cads.Any().GetMetadata(d.Hex(), &tm); err != nil {
+	if err := a.cads.Any().GetMetadata(d.Name(), &tm); err != nil {
 		return nil, fmt.Errorf("get metainfo: %s", err)
 	}
-	t, err := NewTorrent(a.cads, tm.MetaInfo)
+	return a.newTorrent(tm.MetaInfo)
+}
+
+// newTorrent initializes a Torrent for mi, re-verifying the pieces of retained
+// downloads first.
+func (a *TorrentArchive) newTorrent(mi *core.MetaInfo) (*Torrent, error) {
+	reused, discarded, err := reverifyRetainedPieces(a.cads, mi)
+	if err != nil {
+		return nil, fmt.Errorf("reverify retained pieces: %s", err)
+	}
+	if reused > 0 || discarded > 0 {
+		a.stats.Counter("retained_bytes_reused").Inc(reused)
+		a.stats.Counter("retained_pieces_discarded").Inc(int64(discarded))
+	}
+	t, err := NewTorrent(a.cads, mi)
 	if err != nil {
 		return nil, fmt.Errorf("initialize torrent: %s", err)
 	}
 	return t, nil
 }
 
+// RetainTorrent keeps the download file of an incomplete torrent on disk, such
+// that its complete pieces are re-verified and reused instead of downloaded
+// again once the torrent is created again. Downloads without any complete
+// pieces are deleted. Retained downloads are removed by the download store's
+// cleanup like any other download file.
+func (a *TorrentArchive) RetainTorrent(d core.Digest) error {
+	var psm pieceStatusMetadata
+	if err := a.cads.Download().GetMetadata(d.Name(), &psm); err != nil {
+		if os.IsNotExist(err) || a.cads.InCacheError(err) {
+			return nil
+		}
+		return fmt.Errorf("get piece metadata: %s", err)
+	}
+	var complete bool
+	for _, p := range psm.pieces {
+		if p.status == _complete {
+			complete = true
+			break
+		}
+	}
+	if !complete {
+		return a.DeleteTorrent(d)
+	}
+	if _, err := a.cads.Download().SetMetadata(d.Name(), &retainedMetadata{true}); err != nil {
+		return fmt.Errorf("set retained metadata: %s", err)
+	}
+	return nil
+}
+
 // DeleteTorrent deletes a torrent from disk.
 func (a *TorrentArchive) DeleteTorrent(d core.Digest) error {
-	if err := a.cads.Any().DeleteFile(d.Hex()); err != nil && !os.IsNotExist(err) {
+	if err := a.cads.Any().DeleteFile(d.Name()); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
@@ -218,3 +218,98 @@ func TestTorrentArchiveGetTorrent(t *testing.T) {
 	require.NoError(err)
 	require.NotNil(tor)
 }
+
+func TestTorrentArchiveRetainTorrentReusesVerifiedPieces(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newArchiveMocks(t)
+	defer cleanup()
+
+	stats := tally.NewTestScope("", nil)
+	archive := NewTorrentArchive(stats, mocks.cads, mocks.metaInfoClient)
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(4, 1)
+	mi := blob.MetaInfo
+
+	mocks.metaInfoClient.EXPECT().Download(namespace, mi.Digest()).Return(mi, nil).Times(1)
+
+	tor, err := archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+
+	require.NoError(tor.WritePiece(piecereader.NewBuffer(blob.Content[0:1]), 0))
+	require.NoError(tor.WritePiece(piecereader.NewBuffer(blob.Content[2:3]), 2))
+
+	require.NoError(archive.RetainTorrent(mi.Digest()))
+
+	// Corrupt piece 2 on disk.
+	f, err := mocks.cads.GetDownloadFileReadWriter(mi.Digest().Hex())
+	require.NoError(err)
+	_, err = f.WriteAt([]byte{blob.Content[2] + 1}, 2)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	tor, err = archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(bitsetutil.FromBools(true, false, false, false), tor.Bitfield())
+
+	counters := stats.Snapshot().Counters()
+	require.Equal(int64(1), counters["retained_bytes_reused+module=agenttorrentarchive"].Value())
+	require.Equal(int64(1), counters["retained_pieces_discarded+module=agenttorrentarchive"].Value())
+
+	// Pieces are only re-verified once.
+	_, err = archive.GetTorrent(namespace, mi.Digest())
+	require.NoError(err)
+	counters = stats.Snapshot().Counters()
+	require.Equal(int64(1), counters["retained_bytes_reused+module=agenttorrentarchive"].Value())
+}
+
+func TestTorrentArchiveRetainTorrentDeletesEmptyDownloads(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newArchiveMocks(t)
+	defer cleanup()
+
+	archive := mocks.new()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.metaInfoClient.EXPECT().Download(namespace, mi.Digest()).Return(mi, nil).Times(1)
+
+	_, err := archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+
+	require.NoError(archive.RetainTorrent(mi.Digest()))
+
+	_, err = mocks.cads.Any().GetFileStat(mi.Digest().Hex())
+	require.True(os.IsNotExist(err))
+}
+
+func TestTorrentArchiveRetainTorrentNoopsOnCompleteTorrents(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newArchiveMocks(t)
+	defer cleanup()
+
+	archive := mocks.new()
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(2, 1)
+	mi := blob.MetaInfo
+
+	mocks.metaInfoClient.EXPECT().Download(namespace, mi.Digest()).Return(mi, nil).Times(1)
+
+	tor, err := archive.CreateTorrent(namespace, mi.Digest())
+	require.NoError(err)
+	for i := 0; i < 2; i++ {
+		require.NoError(tor.WritePiece(piecereader.NewBuffer(blob.Content[i:i+1]), i))
+	}
+	require.True(tor.Complete())
+
+	require.NoError(archive.RetainTorrent(mi.Digest()))
+	require.NoError(archive.RetainTorrent(core.DigestFixture()))
+
+	_, err = mocks.cads.Cache().GetFileStat(mi.Digest().Hex())
+	require.NoError(err)
+}
@@ -14,8 +14,10 @@
 package agentstorage
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"sync"
@@ -43,6 +45,19 @@ func prepareStore(cads *store.CADownloadStore, mi *core.MetaInfo) {
 	}
 }
 
+// fillDownloadFile writes content to the download file of mi. Used by tests
+// which intercept piece writes, so the committed file still matches its digest.
+func fillDownloadFile(cads *store.CADownloadStore, mi *core.MetaInfo, content []byte) {
+	f, err := cads.GetDownloadFileReadWriter(mi.Digest().Hex())
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		panic(err)
+	}
+}
+
 func TestTorrentCreate(t *testing.T) {
 	require := require.New(t)
 
@@ -251,6 +266,11 @@ func (w *coordinatedWriter) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// ReadFrom routes io.Copy through the blocking Write.
+func (w *coordinatedWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
 func TestTorrentWritePieceConflictsDoNotBlock(t *testing.T) {
 	require := require.New(t)
 
@@ -265,6 +285,7 @@ func TestTorrentWritePieceConflictsDoNotBlock(t *testing.T) {
 	defer cleanup()
 
 	prepareStore(cads, blob.MetaInfo)
+	fillDownloadFile(cads, blob.MetaInfo, blob.Content)
 
 	mockCADS := &mockGetDownloadFileReadWriterStore{cads, w}
 
@@ -302,18 +323,23 @@ func TestTorrentWritePieceFailuresRemoveDirtyStatus(t *testing.T) {
 	blob := core.SizedBlobFixture(1, 1)
 
 	prepareStore(cads, blob.MetaInfo)
+	fillDownloadFile(cads, blob.MetaInfo, blob.Content)
 
 	mockCADS := &mockGetDownloadFileReadWriterStore{cads, w}
 
 	gomock.InOrder(
 		// First write fails.
 		w.EXPECT().Seek(int64(0), 0).Return(int64(0), nil),
-		w.EXPECT().Write(blob.Content).Return(0, errors.New("first write error")),
+		w.EXPECT().ReadFrom(gomock.Any()).Return(int64(0), errors.New("first write error")),
 		w.EXPECT().Close().Return(nil),
 
 		// Second write succeeds.
 		w.EXPECT().Seek(int64(0), 0).Return(int64(0), nil),
-		w.EXPECT().Write(blob.Content).Return(len(blob.Content), nil),
+		w.EXPECT().ReadFrom(gomock.Any()).DoAndReturn(func(r io.Reader) (int64, error) {
+			b, err := ioutil.ReadAll(r)
+			require.Equal(blob.Content, b)
+			return int64(len(b)), err
+		}),
 		w.EXPECT().Close().Return(nil),
 	)
 
@@ -351,6 +377,38 @@ func TestTorrentRestoreCompletedTorrent(t *testing.T) {
 	require.True(tor.Complete())
 }
 
+func TestTorrentDigestMismatchResetsPieces(t *testing.T) {
+	require := require.New(t)
+
+	cads, cleanup := store.CADownloadStoreFixture()
+	defer cleanup()
+
+	blob := core.SizedBlobFixture(4, 1)
+
+	// Piece sums match the content, but the digest does not.
+	mi, err := core.NewMetaInfo(core.DigestFixture(), bytes.NewReader(blob.Content), 1)
+	require.NoError(err)
+
+	prepareStore(cads, mi)
+
+	tor, err := NewTorrent(cads, mi)
+	require.NoError(err)
+
+	for i, b := range blob.Content[:3] {
+		require.NoError(tor.WritePiece(piecereader.NewBuffer([]byte{b}), i))
+	}
+	err = tor.WritePiece(piecereader.NewBuffer(blob.Content[3:]), 3)
+	require.Error(err)
+
+	require.False(tor.Complete())
+	require.Equal([]int{0, 1, 2, 3}, tor.MissingPieces())
+
+	// Reset pieces are persisted.
+	tor, err = NewTorrent(cads, mi)
+	require.NoError(err)
+	require.Equal([]int{0, 1, 2, 3}, tor.MissingPieces())
+}
+
 func TestTorrentRestoreInProgressTorrent(t *testing.T) {
 	require := require.New(t)
 
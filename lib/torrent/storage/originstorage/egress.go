@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package originstorage
+
+import "go.uber.org/atomic"
+
+// EgressStats is a snapshot of the bytes an origin has served since startup.
+type EgressStats struct {
+	P2PBytes  int64 `json:"p2p_bytes"`
+	HTTPBytes int64 `json:"http_bytes"`
+}
+
+// Total returns the total bytes served over both p2p and http.
+func (s EgressStats) Total() int64 {
+	return s.P2PBytes + s.HTTPBytes
+}
+
+// Sub returns the bytes served between snapshot o and s.
+func (s EgressStats) Sub(o EgressStats) EgressStats {
+	return EgressStats{
+		P2PBytes:  s.P2PBytes - o.P2PBytes,
+		HTTPBytes: s.HTTPBytes - o.HTTPBytes,
+	}
+}
+
+// EgressCounter accumulates bytes served by an origin. Piece payloads are
+// counted when handed out to peers, and blob downloads are counted as they
+// are written to the client.
+type EgressCounter struct {
+	p2p  *atomic.Int64
+	http *atomic.Int64
+}
+
+// NewEgressCounter creates a new EgressCounter.
+func NewEgressCounter() *EgressCounter {
+	return &EgressCounter{atomic.NewInt64(0), atomic.NewInt64(0)}
+}
+
+// AddP2P records n bytes served to a peer.
+func (c *EgressCounter) AddP2P(n int64) {
+	c.p2p.Add(n)
+}
+
+// AddHTTP records n bytes served over http.
+func (c *EgressCounter) AddHTTP(n int64) {
+	c.http.Add(n)
+}
+
+// Stats returns a snapshot of the current counts.
+func (c *EgressCounter) Stats() EgressStats {
+	return EgressStats{
+		P2PBytes:  c.p2p.Load(),
+		HTTPBytes: c.http.Load(),
+	}
+}
@@ -37,14 +37,17 @@ type Torrent struct {
 	metaInfo    *core.MetaInfo
 	cas         *store.CAStore
 	numComplete *atomic.Int32
+	egress      *EgressCounter
 }
 
-// NewTorrent creates a new Torrent.
-func NewTorrent(cas *store.CAStore, mi *core.MetaInfo) (*Torrent, error) {
+// NewTorrent creates a new Torrent. Pieces read from the Torrent are recorded
+// in egress.
+func NewTorrent(cas *store.CAStore, mi *core.MetaInfo, egress *EgressCounter) (*Torrent, error) {
 	return &Torrent{
 		cas:         cas,
 		metaInfo:    mi,
 		numComplete: atomic.NewInt32(int32(mi.NumPieces())),
+		egress:      egress,
 	}, nil
 }
 
@@ -113,7 +116,7 @@ type opener struct {
 }
 
 func (o *opener) Open() (store.FileReader, error) {
-	return o.torrent.cas.GetCacheFileReader(o.torrent.Digest().Hex())
+	return o.torrent.cas.GetCacheFileReader(o.torrent.Digest().Name())
 }
 
 // GetPieceReader returns a reader for piece pi.
@@ -121,6 +124,7 @@ func (t *Torrent) GetPieceReader(pi int) (storage.PieceReader, error) {
 	if pi >= t.NumPieces() {
 		return nil, fmt.Errorf("invalid piece index %d: num pieces = %d", pi, t.NumPieces())
 	}
+	t.egress.AddP2P(t.PieceLength(pi))
 	return piecereader.NewFileReader(t.getFileOffset(pi), t.PieceLength(pi), &opener{t}), nil
 }
 
@@ -14,6 +14,7 @@
 package originstorage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -32,20 +33,24 @@ import (
 type TorrentArchive struct {
 	cas           *store.CAStore
 	blobRefresher *blobrefresh.Refresher
+	egress        *EgressCounter
 }
 
-// NewTorrentArchive creates a new TorrentArchive.
+// NewTorrentArchive creates a new TorrentArchive. Pieces served from torrents
+// returned by the archive are recorded in egress.
 func NewTorrentArchive(
-	cas *store.CAStore, blobRefresher *blobrefresh.Refresher) *TorrentArchive {
+	cas *store.CAStore,
+	blobRefresher *blobrefresh.Refresher,
+	egress *EgressCounter) *TorrentArchive {
 
-	return &TorrentArchive{cas, blobRefresher}
+	return &TorrentArchive{cas, blobRefresher, egress}
 }
 
 func (a *TorrentArchive) getMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
 	var tm metadata.TorrentMeta
-	if err := a.cas.GetCacheFileMetadata(d.Hex(), &tm); err != nil {
+	if err := a.cas.GetCacheFileMetadata(d.Name(), &tm); err != nil {
 		if os.IsNotExist(err) {
-			refreshErr := a.blobRefresher.Refresh(namespace, d)
+			refreshErr := a.blobRefresher.Refresh(context.Background(), namespace, d)
 			if refreshErr != nil {
 				return nil, fmt.Errorf("blob refresh: %s", refreshErr)
 			}
@@ -81,16 +86,21 @@ func (a *TorrentArchive) GetTorrent(namespace string, d core.Digest) (storage.To
 	if err != nil {
 		return nil, err
 	}
-	t, err := NewTorrent(a.cas, mi)
+	t, err := NewTorrent(a.cas, mi, a.egress)
 	if err != nil {
 		return nil, fmt.Errorf("initialize torrent: %s", err)
 	}
 	return t, nil
 }
 
+// RetainTorrent is a no-op, since origin torrents are always complete.
+func (a *TorrentArchive) RetainTorrent(d core.Digest) error {
+	return nil
+}
+
 // DeleteTorrent moves a torrent to the trash.
 func (a *TorrentArchive) DeleteTorrent(d core.Digest) error {
-	if err := a.cas.DeleteCacheFile(d.Hex()); err != nil && !os.IsNotExist(err) {
+	if err := a.cas.DeleteCacheFile(d.Name()); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
@@ -54,14 +54,17 @@ func newArchiveMocks(t *testing.T, namespace string) (*archiveMocks, func()) {
 	backends := backend.ManagerFixture()
 	backends.Register(namespace, backendClient, false)
 
-	blobRefresher := blobrefresh.New(
+	blobRefresher, err := blobrefresh.New(
 		blobrefresh.Config{}, tally.NoopScope, cas, backends, metainfogen.Fixture(cas, pieceLength))
+	if err != nil {
+		panic(err)
+	}
 
 	return &archiveMocks{cas, backendClient, blobRefresher}, cleanup.Run
 }
 
 func (m *archiveMocks) new() *TorrentArchive {
-	return NewTorrentArchive(m.cas, m.blobRefresher)
+	return NewTorrentArchive(m.cas, m.blobRefresher, NewEgressCounter())
 }
 
 func TestTorrentArchiveStatNoExistTriggersRefresh(t *testing.T) {
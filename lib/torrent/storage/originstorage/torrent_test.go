@@ -38,7 +38,7 @@ func TestTorrentCreate(t *testing.T) {
 
 	cas.CreateCacheFile(mi.Digest().Hex(), bytes.NewReader(blob.Content))
 
-	tor, err := NewTorrent(cas, mi)
+	tor, err := NewTorrent(cas, mi, NewEgressCounter())
 	require.NoError(err)
 
 	// New torrent
@@ -66,7 +66,8 @@ func TestTorrentGetPieceReaderConcurrent(t *testing.T) {
 
 	cas.CreateCacheFile(mi.Digest().Hex(), bytes.NewReader(blob.Content))
 
-	tor, err := NewTorrent(cas, mi)
+	egress := NewEgressCounter()
+	tor, err := NewTorrent(cas, mi, egress)
 	require.NoError(err)
 
 	wg := sync.WaitGroup{}
@@ -86,6 +87,8 @@ func TestTorrentGetPieceReaderConcurrent(t *testing.T) {
 	}
 
 	wg.Wait()
+
+	require.Equal(EgressStats{P2PBytes: tor.Length()}, egress.Stats())
 }
 
 func TestTorrentWritePieceError(t *testing.T) {
@@ -99,7 +102,7 @@ func TestTorrentWritePieceError(t *testing.T) {
 
 	cas.CreateCacheFile(mi.Digest().Hex(), bytes.NewReader(blob.Content))
 
-	tor, err := NewTorrent(cas, mi)
+	tor, err := NewTorrent(cas, mi, NewEgressCounter())
 	require.NoError(err)
 
 	err = tor.WritePiece(piecereader.NewBuffer([]byte{}), 0)
@@ -29,6 +29,10 @@ var ErrNotFound = errors.New("torrent not found")
 // complete.
 var ErrPieceComplete = errors.New("piece is already complete")
 
+// ErrTorrentCorrupt occurs when a completed torrent does not match its digest
+// and will not be downloaded again.
+var ErrTorrentCorrupt = errors.New("torrent content does not match digest")
+
 // PieceReader defines operations for lazy piece reading.
 type PieceReader interface {
 	io.ReadCloser
@@ -62,4 +66,8 @@ type TorrentArchive interface {
 	CreateTorrent(namespace string, d core.Digest) (Torrent, error)
 	GetTorrent(namespace string, d core.Digest) (Torrent, error)
 	DeleteTorrent(d core.Digest) error
+
+	// RetainTorrent keeps the pieces of an incomplete torrent on disk, such
+	// that they are reused once the torrent is created again.
+	RetainTorrent(d core.Digest) error
 }
@@ -0,0 +1,57 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package swarmfetch
+
+import (
+	"time"
+
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/upstream"
+	"github.com/uber/kraken/tracker/announceclient"
+)
+
+// Config defines Fetcher configuration.
+type Config struct {
+	// Enabled makes origins download missing blobs from the peer swarm of
+	// agents before falling back to the backend.
+	Enabled bool `yaml:"enabled"`
+
+	// Timeout bounds how long a swarm download may take before the origin
+	// gives up and downloads the blob from the backend.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// MinSeeders is the minimum number of seeders the tracker must report for
+	// a blob before the origin joins its swarm.
+	MinSeeders int `yaml:"min_seeders"`
+
+	// PeerPort is the port the leeching scheduler listens on. It must differ
+	// from the port of the seeding scheduler of the origin.
+	PeerPort int `yaml:"peer_port"`
+
+	Tracker         upstream.PassiveHashRingConfig `yaml:"tracker"`
+	AnnounceClient  announceclient.Config          `yaml:"announce_client"`
+	Scheduler       scheduler.Config               `yaml:"scheduler"`
+	CADownloadStore store.CADownloadStoreConfig    `yaml:"cadownloadstore"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 2 * time.Minute
+	}
+	if c.MinSeeders == 0 {
+		c.MinSeeders = 1
+	}
+	return c
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package swarmfetch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Fetcher errors.
+var (
+	ErrNoSeeders  = errors.New("swarm has too few seeders")
+	ErrNoMetaInfo = errors.New("metainfo neither cached by trackers nor held by origins")
+	ErrTimeout    = errors.New("swarm download timed out")
+)
+
+// Fetcher downloads blobs by joining their swarm as a leecher. Implements
+// blobrefresh.SwarmFetcher.
+type Fetcher struct {
+	config   Config
+	stats    tally.Scope
+	clk      clock.Clock
+	announce announceclient.Client
+	sched    scheduler.Scheduler
+	cads     *store.CADownloadStore
+	cas      *store.CAStore
+}
+
+// Option allows setting optional Fetcher parameters.
+type Option func(*Fetcher)
+
+// WithClock sets the clock used to time out swarm downloads.
+func WithClock(clk clock.Clock) Option {
+	return func(f *Fetcher) { f.clk = clk }
+}
+
+// New creates a new Fetcher which checks the swarm of blobs through announce,
+// downloads them with sched into cads and commits them to cas. sched must only
+// download cached metainfo, see scheduler.NewSwarmFetchScheduler.
+func New(
+	config Config,
+	stats tally.Scope,
+	announce announceclient.Client,
+	sched scheduler.Scheduler,
+	cads *store.CADownloadStore,
+	cas *store.CAStore,
+	opts ...Option) *Fetcher {
+
+	stats = stats.Tagged(map[string]string{
+		"module": "swarmfetch",
+	})
+	f := &Fetcher{
+		config:   config.applyDefaults(),
+		stats:    stats,
+		clk:      clock.New(),
+		announce: announce,
+		sched:    sched,
+		cads:     cads,
+		cas:      cas,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Fetch downloads d into the cache of the CAStore, if the tracker reports
+// enough seeders for d and the download finishes within the configured
+// timeout. Fails with ErrNoMetaInfo if trackers neither cache the metainfo of
+// d nor can get it from an origin holding d. The downloaded blob is removed
+// from the download store afterwards.
+func (f *Fetcher) Fetch(namespace string, d core.Digest) error {
+	stats, err := f.announce.Scrape(namespace, []core.Digest{d})
+	if err != nil {
+		return fmt.Errorf("scrape: %s", err)
+	}
+	if len(stats) == 0 || stats[0].Error != "" || stats[0].Seeders < f.config.MinSeeders {
+		f.stats.Counter("no_seeders").Inc(1)
+		return ErrNoSeeders
+	}
+
+	defer func() {
+		if err := f.sched.RemoveTorrent(d); err != nil {
+			log.With("digest", d).Errorf("Error removing swarm fetched torrent: %s", err)
+		}
+	}()
+
+	// Buffer size of 1 so the download does not leak if it times out.
+	errc := make(chan error, 1)
+	go func() { errc <- f.sched.Download(namespace, d) }()
+
+	timer := f.clk.Timer(f.config.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		if err == scheduler.ErrTorrentNotFound {
+			f.stats.Counter("no_metainfo").Inc(1)
+			return ErrNoMetaInfo
+		} else if err != nil {
+			f.stats.Counter("download_errors").Inc(1)
+			return fmt.Errorf("download: %s", err)
+		}
+	case <-timer.C:
+		f.stats.Counter("timeouts").Inc(1)
+		return ErrTimeout
+	}
+
+	if err := f.commit(d); err != nil {
+		return fmt.Errorf("commit: %s", err)
+	}
+	f.stats.Counter("downloads").Inc(1)
+	return nil
+}
+
+// commit links the downloaded blob into the CAStore, and only copies it if
+// the stores are on different filesystems.
+func (f *Fetcher) commit(d core.Digest) error {
+	p, err := f.cads.Cache().GetFilePath(d.Name())
+	if err != nil {
+		return fmt.Errorf("get cache file path: %s", err)
+	}
+	err = f.cas.LinkFileToCache(p, d.Name())
+	if err == nil || os.IsExist(err) {
+		return nil
+	}
+	log.With("digest", d).Infof("Copying swarm fetched blob: %s", err)
+	f.stats.Counter("copies").Inc(1)
+
+	r, err := f.cads.Cache().GetFileReader(d.Name())
+	if err != nil {
+		return fmt.Errorf("get cache file reader: %s", err)
+	}
+	defer r.Close()
+	return f.cas.CreateCacheFile(d.Name(), r)
+}
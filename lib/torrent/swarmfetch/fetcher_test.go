@@ -0,0 +1,230 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package swarmfetch
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/scheduler"
+	mockscheduler "github.com/uber/kraken/mocks/lib/torrent/scheduler"
+	mockannounceclient "github.com/uber/kraken/mocks/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+const _testNamespace = "test-namespace"
+
+type fetcherMocks struct {
+	announce *mockannounceclient.MockClient
+	sched    *mockscheduler.MockScheduler
+	cads     *store.CADownloadStore
+	cas      *store.CAStore
+	clk      *clock.Mock
+}
+
+func newFetcherMocks(t *testing.T) (*fetcherMocks, func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	cads, c := store.CADownloadStoreFixture()
+	cleanup.Add(c)
+
+	cas, c := store.CAStoreFixture()
+	cleanup.Add(c)
+
+	return &fetcherMocks{
+		announce: mockannounceclient.NewMockClient(ctrl),
+		sched:    mockscheduler.NewMockScheduler(ctrl),
+		cads:     cads,
+		cas:      cas,
+		clk:      clock.NewMock(),
+	}, cleanup.Run
+}
+
+func (m *fetcherMocks) new(config Config) *Fetcher {
+	return New(config, tally.NoopScope, m.announce, m.sched, m.cads, m.cas, WithClock(m.clk))
+}
+
+// writeCacheFile simulates a completed torrent download into m.cads.
+func (m *fetcherMocks) writeCacheFile(blob *core.BlobFixture) error {
+	name := blob.Digest.Hex()
+	if err := m.cads.CreateDownloadFile(name, int64(len(blob.Content))); err != nil {
+		return err
+	}
+	w, err := m.cads.GetDownloadFileReadWriter(name)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err := w.Write(blob.Content); err != nil {
+		return err
+	}
+	return m.cads.MoveDownloadFileToCache(name)
+}
+
+func (m *fetcherMocks) expectScrape(blob *core.BlobFixture, seeders int) {
+	m.announce.EXPECT().Scrape(_testNamespace, []core.Digest{blob.Digest}).Return(
+		[]*announceclient.SwarmStats{{Digest: blob.Digest, Seeders: seeders}}, nil)
+}
+
+func TestFetch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newFetcherMocks(t)
+	defer cleanup()
+
+	fetcher := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	mocks.expectScrape(blob, 3)
+	gomock.InOrder(
+		mocks.sched.EXPECT().Download(_testNamespace, blob.Digest).DoAndReturn(
+			func(namespace string, d core.Digest) error {
+				return mocks.writeCacheFile(blob)
+			}),
+		mocks.sched.EXPECT().RemoveTorrent(blob.Digest).Return(nil),
+	)
+
+	require.NoError(fetcher.Fetch(_testNamespace, blob.Digest))
+
+	r, err := mocks.cas.GetCacheFileReader(blob.Digest.Hex())
+	require.NoError(err)
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.Equal(blob.Content, b)
+}
+
+func TestFetchNoSeeders(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newFetcherMocks(t)
+	defer cleanup()
+
+	fetcher := mocks.new(Config{MinSeeders: 2})
+
+	blob := core.NewBlobFixture()
+
+	mocks.expectScrape(blob, 1)
+
+	require.Equal(ErrNoSeeders, fetcher.Fetch(_testNamespace, blob.Digest))
+}
+
+func TestFetchScrapeError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newFetcherMocks(t)
+	defer cleanup()
+
+	fetcher := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	mocks.announce.EXPECT().Scrape(_testNamespace, []core.Digest{blob.Digest}).Return(
+		nil, errors.New("some error"))
+
+	require.Error(fetcher.Fetch(_testNamespace, blob.Digest))
+}
+
+func TestFetchDownloadError(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newFetcherMocks(t)
+	defer cleanup()
+
+	fetcher := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	mocks.expectScrape(blob, 1)
+	mocks.sched.EXPECT().Download(_testNamespace, blob.Digest).Return(scheduler.ErrTorrentNoPeers)
+	mocks.sched.EXPECT().RemoveTorrent(blob.Digest).Return(nil)
+
+	require.Error(fetcher.Fetch(_testNamespace, blob.Digest))
+}
+
+func TestFetchNoMetaInfo(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newFetcherMocks(t)
+	defer cleanup()
+
+	fetcher := mocks.new(Config{})
+
+	blob := core.NewBlobFixture()
+
+	mocks.expectScrape(blob, 1)
+	mocks.sched.EXPECT().Download(_testNamespace, blob.Digest).Return(scheduler.ErrTorrentNotFound)
+	mocks.sched.EXPECT().RemoveTorrent(blob.Digest).Return(nil)
+
+	require.Equal(ErrNoMetaInfo, fetcher.Fetch(_testNamespace, blob.Digest))
+}
+
+func TestFetchTimeout(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newFetcherMocks(t)
+	defer cleanup()
+
+	config := Config{Timeout: time.Minute}
+	fetcher := mocks.new(config)
+
+	blob := core.NewBlobFixture()
+
+	removed := make(chan struct{})
+
+	mocks.expectScrape(blob, 1)
+	mocks.sched.EXPECT().Download(_testNamespace, blob.Digest).DoAndReturn(
+		func(namespace string, d core.Digest) error {
+			<-removed
+			return scheduler.ErrTorrentRemoved
+		})
+	mocks.sched.EXPECT().RemoveTorrent(blob.Digest).DoAndReturn(
+		func(d core.Digest) error {
+			close(removed)
+			return nil
+		})
+
+	errc := make(chan error)
+	go func() {
+		errc <- fetcher.Fetch(_testNamespace, blob.Digest)
+	}()
+
+	// Advance the clock until the fetch gives up, since the timer may not be
+	// armed yet on the first advance.
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		mocks.clk.Add(config.Timeout)
+		select {
+		case err := <-errc:
+			require.Equal(ErrTimeout, err)
+			return true
+		default:
+			return false
+		}
+	}))
+}
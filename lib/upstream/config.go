@@ -14,12 +14,15 @@
 package upstream
 
 import (
+	"fmt"
+
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
 )
 
 // ActiveConfig composes host configuration for an upstream service with an
@@ -28,7 +31,20 @@ type ActiveConfig struct {
 	Hosts       hostlist.Config         `yaml:"hosts"`
 	HealthCheck ActiveHealthCheckConfig `yaml:"healthcheck"`
 
-	checker healthcheck.Checker
+	// Zones maps addresses or hostnames of hosts to the zone they run in.
+	// Clients which know their own zone (see WithLocalZone) prefer hosts in
+	// it, falling back to hosts in other zones.
+	Zones hashring.Zones `yaml:"zones"`
+
+	// Weights overrides the weight of individual hosts, keyed by address or
+	// hostname. Within a zone, the chance of a host being tried first is
+	// proportional to its weight, where hosts default to weight 100. Hosts with
+	// weight 0 are only tried after all other hosts.
+	Weights map[string]int `yaml:"weights"`
+
+	checker   healthcheck.Checker
+	stats     tally.Scope
+	localZone string
 }
 
 // ActiveHealthCheckConfig wraps health check configuration.
@@ -46,23 +62,42 @@ func WithHealthCheck(checker healthcheck.Checker) ActiveOption {
 	return func(c *ActiveConfig) { c.checker = checker }
 }
 
-// Build creates a healthcheck.List with built-in active health checks.
+// WithStats configures ActiveConfig to count host state changes in stats.
+func WithStats(stats tally.Scope) ActiveOption {
+	return func(c *ActiveConfig) { c.stats = stats }
+}
+
+// WithLocalZone sets the zone the client runs in, such that hosts in zone are
+// sampled before hosts in other zones.
+func WithLocalZone(zone string) ActiveOption {
+	return func(c *ActiveConfig) { c.localZone = zone }
+}
+
+// Build creates a healthcheck.List with built-in active health checks. The
+// list implements hostlist.Sampler if hosts are weighted or zone-aware.
 func (c ActiveConfig) Build(opts ...ActiveOption) (healthcheck.List, error) {
 	hosts, err := hostlist.New(c.Hosts)
 	if err != nil {
 		return nil, err
 	}
-	if c.HealthCheck.Disabled {
-		log.With("hosts", c.Hosts).Warn("Health checks disabled")
-		return healthcheck.NoopFailed(hosts), nil
-	}
 	c.checker = healthcheck.Default(nil)
+	c.stats = tally.NoopScope
 	for _, opt := range opts {
 		opt(&c)
 	}
-	filter := healthcheck.NewFilter(c.HealthCheck.Filter, c.checker)
-	monitor := healthcheck.NewMonitor(c.HealthCheck.Monitor, hosts, filter)
-	return healthcheck.NoopFailed(monitor), nil
+	selection := selectionConfig{c.Weights, c.Zones, c.localZone}
+	if err := selection.validate(); err != nil {
+		return nil, fmt.Errorf("invalid weights: %s", err)
+	}
+	if c.HealthCheck.Disabled {
+		log.With("hosts", c.Hosts).Warn("Health checks disabled")
+		return newSelectList(healthcheck.NoopFailed(hosts), selection), nil
+	}
+	filter := healthcheck.NewFilter(
+		c.HealthCheck.Filter,
+		c.checker,
+		healthcheck.WithStateChangeHook(healthcheck.LogStateChanges(c.stats)))
+	return newSelectList(healthcheck.NewMonitor(c.HealthCheck.Monitor, hosts, filter), selection), nil
 }
 
 // StableAddr returns a stable address that can be advertised as the address
@@ -88,16 +123,39 @@ func (c ActiveConfig) StableAddr() (string, error) {
 type PassiveConfig struct {
 	Hosts       hostlist.Config                 `yaml:"hosts"`
 	HealthCheck healthcheck.PassiveFilterConfig `yaml:"healthcheck"`
+
+	// Zones and Weights behave the same as in ActiveConfig.
+	Zones   hashring.Zones `yaml:"zones"`
+	Weights map[string]int `yaml:"weights"`
+
+	localZone string
 }
 
-// Build creates healthcheck.List enabled with passive health checks.
-func (c PassiveConfig) Build() (healthcheck.List, error) {
+// PassiveOption allows setting optional PassiveConfig parameters.
+type PassiveOption func(*PassiveConfig)
+
+// WithPassiveLocalZone sets the zone the client runs in, such that hosts in
+// zone are sampled before hosts in other zones.
+func WithPassiveLocalZone(zone string) PassiveOption {
+	return func(c *PassiveConfig) { c.localZone = zone }
+}
+
+// Build creates healthcheck.List enabled with passive health checks. The list
+// implements hostlist.Sampler if hosts are weighted or zone-aware.
+func (c PassiveConfig) Build(opts ...PassiveOption) (healthcheck.List, error) {
 	hosts, err := hostlist.New(c.Hosts)
 	if err != nil {
 		return nil, err
 	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	selection := selectionConfig{c.Weights, c.Zones, c.localZone}
+	if err := selection.validate(); err != nil {
+		return nil, fmt.Errorf("invalid weights: %s", err)
+	}
 	f := healthcheck.NewPassiveFilter(c.HealthCheck, clock.New())
-	return healthcheck.NewPassive(hosts, f), nil
+	return newSelectList(healthcheck.NewPassive(hosts, f), selection), nil
 }
 
 // PassiveRingConfig composes host configuration for an upstream service with
@@ -109,11 +167,11 @@ type PassiveHashRingConfig struct {
 }
 
 // Build creates a hashring.PassiveRing.
-func (c PassiveHashRingConfig) Build() (hashring.PassiveRing, error) {
+func (c PassiveHashRingConfig) Build(opts ...hashring.Option) (hashring.PassiveRing, error) {
 	hosts, err := hostlist.New(c.Hosts)
 	if err != nil {
 		return nil, err
 	}
 	f := healthcheck.NewPassiveFilter(c.HealthCheck, clock.New())
-	return hashring.NewPassive(c.HashRing, hosts, f), nil
+	return hashring.NewPassive(c.HashRing, hosts, f, opts...), nil
 }
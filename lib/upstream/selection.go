@@ -0,0 +1,121 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package upstream
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+)
+
+// defaultWeight is the weight of hosts which have no entry in the configured
+// weights.
+const defaultWeight = 100
+
+// selectionConfig defines the order in which clients try hosts of an upstream
+// service.
+type selectionConfig struct {
+	weights   map[string]int
+	zones     hashring.Zones
+	localZone string
+}
+
+func (c selectionConfig) validate() error {
+	for host, w := range c.weights {
+		if w < 0 {
+			return fmt.Errorf("weight of %s must not be negative: %d", host, w)
+		}
+	}
+	return nil
+}
+
+// enabled returns true if c deviates from picking hosts uniformly at random.
+func (c selectionConfig) enabled() bool {
+	return len(c.weights) > 0 || (c.localZone != "" && len(c.zones) > 0)
+}
+
+// weight returns the configured weight of addr, looked up by address first and
+// hostname second.
+func (c selectionConfig) weight(addr string) int {
+	if w, ok := c.weights[addr]; ok {
+		return w
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if w, ok := c.weights[host]; ok {
+			return w
+		}
+	}
+	return defaultWeight
+}
+
+// selectList is a healthcheck.List which samples healthy hosts in the local
+// zone before hosts in other zones, and in weighted random order within each
+// zone group.
+type selectList struct {
+	healthcheck.List
+	config selectionConfig
+}
+
+func newSelectList(l healthcheck.List, config selectionConfig) healthcheck.List {
+	if !config.enabled() {
+		return l
+	}
+	return &selectList{l, config}
+}
+
+// Sample returns up to n healthy hosts, most preferred first.
+func (l *selectList) Sample(n int) []string {
+	var local, remote []string
+	for addr := range l.Resolve() {
+		if l.config.localZone != "" && l.config.zones.Of(addr) == l.config.localZone {
+			local = append(local, addr)
+		} else {
+			remote = append(remote, addr)
+		}
+	}
+	addrs := append(l.shuffle(local), l.shuffle(remote)...)
+	if n < len(addrs) {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// shuffle orders addrs randomly such that the chance of a host coming first is
+// proportional to its weight. Hosts with weight 0 are only tried after all other
+// hosts.
+func (l *selectList) shuffle(addrs []string) []string {
+	keys := make(map[string]float64, len(addrs))
+	for _, addr := range addrs {
+		w := l.config.weight(addr)
+		if w == 0 {
+			keys[addr] = math.Inf(1)
+		} else {
+			// Exponentially distributed keys with rate w, which makes the
+			// smallest key belong to each host with probability w / sum(w).
+			keys[addr] = rand.ExpFloat64() / float64(w)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		if keys[addrs[i]] == keys[addrs[j]] {
+			return addrs[i] < addrs[j]
+		}
+		return keys[addrs[i]] < keys[addrs[j]]
+	})
+	return addrs
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package upstream
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/hostlist"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectListDisabledReturnsOriginalList(t *testing.T) {
+	l := healthcheck.NoopFailed(hostlist.Fixture("a:80", "b:80"))
+
+	require.Equal(t, l, newSelectList(l, selectionConfig{}))
+	require.Equal(t, l, newSelectList(l, selectionConfig{localZone: "z1"}))
+}
+
+func TestSelectListPrefersLocalZone(t *testing.T) {
+	require := require.New(t)
+
+	l := newSelectList(
+		healthcheck.NoopFailed(hostlist.Fixture("a:80", "b:80", "c:80", "d:80")),
+		selectionConfig{
+			zones:     hashring.Zones{"a": "z1", "b": "z2", "c:80": "z1", "d": "z2"},
+			localZone: "z1",
+		})
+
+	for i := 0; i < 50; i++ {
+		addrs := hostlist.Sample(l, 3)
+		require.Len(addrs, 3)
+		require.ElementsMatch([]string{"a:80", "c:80"}, addrs[:2])
+		require.Contains([]string{"b:80", "d:80"}, addrs[2])
+	}
+}
+
+func TestSelectListFallsBackToRemoteZones(t *testing.T) {
+	require := require.New(t)
+
+	l := newSelectList(
+		healthcheck.NoopFailed(hostlist.Fixture("a:80", "b:80")),
+		selectionConfig{
+			zones:     hashring.Zones{"a": "z2", "b": "z3"},
+			localZone: "z1",
+		})
+
+	require.ElementsMatch([]string{"a:80", "b:80"}, hostlist.Sample(l, 3))
+}
+
+func TestSelectListWeights(t *testing.T) {
+	require := require.New(t)
+
+	l := newSelectList(
+		healthcheck.NoopFailed(hostlist.Fixture("a:80", "b:80", "c:80")),
+		selectionConfig{weights: map[string]int{"a": 300, "c:80": 0}})
+
+	first := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		addrs := hostlist.Sample(l, 3)
+		require.Len(addrs, 3)
+		require.Equal("c:80", addrs[2])
+		first[addrs[0]]++
+	}
+	require.Equal(0, first["c:80"])
+	// a:80 has weight 300 against 100 of b:80, so it comes first 75% of the time.
+	require.InDelta(750, first["a:80"], 100)
+}
+
+func TestSelectionConfigRejectsNegativeWeights(t *testing.T) {
+	_, err := ActiveConfig{
+		Hosts:   hostlist.Config{Static: []string{"a:80"}},
+		Weights: map[string]int{"a": -1},
+	}.Build()
+	require.Error(t, err)
+
+	_, err = PassiveConfig{
+		Hosts:   hostlist.Config{Static: []string{"a:80"}},
+		Weights: map[string]int{"a": -1},
+	}.Build()
+	require.Error(t, err)
+}
+
+func TestActiveConfigBuildSampler(t *testing.T) {
+	require := require.New(t)
+
+	l, err := ActiveConfig{
+		Hosts:       hostlist.Config{Static: []string{"a:80", "b:80"}},
+		HealthCheck: ActiveHealthCheckConfig{Disabled: true},
+		Zones:       hashring.Zones{"a": "z2", "b": "z1"},
+	}.Build(WithLocalZone("z1"))
+	require.NoError(err)
+
+	require.Equal([]string{"b:80", "a:80"}, hostlist.Sample(l, 2))
+	require.Equal([]string{"b:80"}, hostlist.Sample(l, 1))
+}
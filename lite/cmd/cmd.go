@@ -0,0 +1,138 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"syscall"
+
+	buildindexcmd "github.com/uber/kraken/build-index/cmd"
+	"github.com/uber/kraken/lib/backend/testfs"
+	"github.com/uber/kraken/metrics"
+	origincmd "github.com/uber/kraken/origin/cmd"
+	proxycmd "github.com/uber/kraken/proxy/cmd"
+	trackercmd "github.com/uber/kraken/tracker/cmd"
+	"github.com/uber/kraken/utils/configutil"
+	"github.com/uber/kraken/utils/flagutil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Flags defines kraken-lite CLI flags.
+type Flags struct {
+	ConfigFile        string
+	KrakenCluster     string
+	SecretsFile       string
+	ConfigOverlayFile string
+}
+
+// ParseFlags parses kraken-lite CLI flags.
+func ParseFlags() *Flags {
+	var flags Flags
+	flag.StringVar(
+		&flags.ConfigFile, "config", "", "configuration file path")
+	flag.StringVar(
+		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
+	flag.StringVar(
+		&flags.SecretsFile, "secrets", "", "path to a secrets YAML file to load into configuration")
+	flag.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file, e.g. with per-cluster settings, to merge on top of configuration")
+	flag.Parse()
+	return &flags
+}
+
+// Run runs origin, tracker, build-index and proxy, plus an optional testfs
+// storage backend, in a single process. Intended for development and small
+// sites; components are not replicated.
+func Run(flags *Flags) {
+	var config Config
+	if err := configutil.Load(
+		flags.ConfigFile, &config,
+		configutil.WithOverlay(flags.ConfigOverlayFile),
+		configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
+		panic(err)
+	}
+	if flags.SecretsFile != "" {
+		if err := configutil.Load(
+			flags.SecretsFile, &config,
+			configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
+			panic(err)
+		}
+	}
+	config = config.applyDefaults().wire()
+
+	zlog := log.ConfigureLogger(config.ZapLogging)
+	defer zlog.Sync()
+
+	stats, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+	if err != nil {
+		log.Fatalf("Failed to init metrics: %s", err)
+	}
+	flusher := metrics.NewFlusher(stats, closer)
+	defer flusher.Flush(metrics.ShutdownExit)
+	// SIGTERM gracefully shuts down the origin.
+	flusher.FlushOnSignals(syscall.SIGINT)
+
+	if !config.TestFS.Disabled {
+		server := testfs.NewServer()
+		defer server.Cleanup()
+
+		addr := fmt.Sprintf(":%d", config.Ports.TestFS)
+		log.Infof("Starting testfs server on %s", addr)
+		go func() { flusher.Fatal(http.ListenAndServe(addr, server.Handler())) }()
+	}
+
+	logger := zlog.Desugar()
+
+	go origincmd.Run(
+		&origincmd.Flags{
+			PeerPort:           config.Ports.OriginPeer,
+			BlobServerHostName: config.Hostname,
+			BlobServerPort:     config.Ports.Origin,
+			KrakenCluster:      flags.KrakenCluster,
+		},
+		origincmd.WithConfig(config.Origin),
+		origincmd.WithMetrics(stats),
+		origincmd.WithLogger(logger))
+
+	go trackercmd.Run(
+		&trackercmd.Flags{
+			Port:          config.Ports.Tracker,
+			KrakenCluster: flags.KrakenCluster,
+		},
+		trackercmd.WithConfig(config.Tracker),
+		trackercmd.WithMetrics(stats),
+		trackercmd.WithLogger(logger))
+
+	go buildindexcmd.Run(
+		&buildindexcmd.Flags{
+			Port:          config.Ports.BuildIndex,
+			KrakenCluster: flags.KrakenCluster,
+		},
+		buildindexcmd.WithConfig(config.BuildIndex),
+		buildindexcmd.WithMetrics(stats),
+		buildindexcmd.WithLogger(logger))
+
+	proxycmd.Run(
+		&proxycmd.Flags{
+			Ports:         flagutil.Ints{config.Ports.Proxy},
+			ServerPort:    config.Ports.ProxyServer,
+			KrakenCluster: flags.KrakenCluster,
+		},
+		proxycmd.WithConfig(config.Proxy),
+		proxycmd.WithMetrics(stats),
+		proxycmd.WithLogger(logger))
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	buildindexcmd "github.com/uber/kraken/build-index/cmd"
+	"github.com/uber/kraken/build-index/tagtype"
+	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/metrics"
+	origincmd "github.com/uber/kraken/origin/cmd"
+	proxycmd "github.com/uber/kraken/proxy/cmd"
+	trackercmd "github.com/uber/kraken/tracker/cmd"
+)
+
+// Config defines kraken-lite configuration. Each component is configured as it
+// would be when running standalone, except that logging and metrics are shared
+// and addresses of other components are filled in automatically.
+type Config struct {
+	ZapLogging zap.Config     `yaml:"zap"`
+	Metrics    metrics.Config `yaml:"metrics"`
+
+	// Hostname is the host components use to reach each other.
+	Hostname string `yaml:"hostname"`
+
+	Ports  PortsConfig  `yaml:"ports"`
+	TestFS TestFSConfig `yaml:"testfs"`
+
+	Origin     origincmd.Config     `yaml:"origin"`
+	Tracker    trackercmd.Config    `yaml:"tracker"`
+	BuildIndex buildindexcmd.Config `yaml:"build_index"`
+	Proxy      proxycmd.Config      `yaml:"proxy"`
+}
+
+// PortsConfig defines the ports each component listens on. Defaults match
+// the devcluster herd container.
+type PortsConfig struct {
+	TestFS      int `yaml:"testfs"`
+	Proxy       int `yaml:"proxy"`
+	OriginPeer  int `yaml:"origin_peer"`
+	Origin      int `yaml:"origin"`
+	Tracker     int `yaml:"tracker"`
+	BuildIndex  int `yaml:"build_index"`
+	ProxyServer int `yaml:"proxy_server"`
+}
+
+// TestFSConfig defines the in-process testfs storage backend, which origin
+// and build-index fall back to when no backends are configured. Blobs and
+// tags stored in testfs are lost on restart.
+type TestFSConfig struct {
+	Disabled bool `yaml:"disabled"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Hostname == "" {
+		c.Hostname = "localhost"
+	}
+	if c.Ports.TestFS == 0 {
+		c.Ports.TestFS = 14000
+	}
+	if c.Ports.Proxy == 0 {
+		c.Ports.Proxy = 15000
+	}
+	if c.Ports.OriginPeer == 0 {
+		c.Ports.OriginPeer = 15001
+	}
+	if c.Ports.Origin == 0 {
+		c.Ports.Origin = 15002
+	}
+	if c.Ports.Tracker == 0 {
+		c.Ports.Tracker = 15003
+	}
+	if c.Ports.BuildIndex == 0 {
+		c.Ports.BuildIndex = 15004
+	}
+	if c.Ports.ProxyServer == 0 {
+		c.Ports.ProxyServer = 15005
+	}
+	return c
+}
+
+func (c Config) addr(port int) string {
+	return fmt.Sprintf("%s:%d", c.Hostname, port)
+}
+
+// wire points each component at the others, unless explicitly configured
+// otherwise.
+func (c Config) wire() Config {
+	origin := c.addr(c.Ports.Origin)
+	buildIndex := c.addr(c.Ports.BuildIndex)
+
+	if c.Origin.Cluster.DNS == "" && len(c.Origin.Cluster.Static) == 0 {
+		c.Origin.Cluster.Static = []string{origin}
+	}
+	if c.Tracker.Origin.Hosts.DNS == "" && len(c.Tracker.Origin.Hosts.Static) == 0 {
+		c.Tracker.Origin.Hosts.Static = []string{origin}
+	}
+	if c.BuildIndex.Origin.Hosts.DNS == "" && len(c.BuildIndex.Origin.Hosts.Static) == 0 {
+		c.BuildIndex.Origin.Hosts.Static = []string{origin}
+	}
+	if c.BuildIndex.Cluster.Hosts.DNS == "" && len(c.BuildIndex.Cluster.Hosts.Static) == 0 {
+		c.BuildIndex.Cluster.Hosts.Static = []string{buildIndex}
+	}
+	if c.Proxy.Origin.Hosts.DNS == "" && len(c.Proxy.Origin.Hosts.Static) == 0 {
+		c.Proxy.Origin.Hosts.Static = []string{origin}
+	}
+	if c.Proxy.BuildIndex.Hosts.DNS == "" && len(c.Proxy.BuildIndex.Hosts.Static) == 0 {
+		c.Proxy.BuildIndex.Hosts.Static = []string{buildIndex}
+	}
+
+	if !c.TestFS.Disabled {
+		testfs := c.addr(c.Ports.TestFS)
+		if len(c.Origin.Backends) == 0 {
+			c.Origin.Backends = []backend.Config{{
+				Namespace: ".*",
+				Backend: map[string]interface{}{"testfs": map[string]interface{}{
+					"addr":      testfs,
+					"root":      "blobs",
+					"name_path": "identity",
+				}},
+			}}
+		}
+		if len(c.BuildIndex.Backends) == 0 {
+			c.BuildIndex.Backends = []backend.Config{{
+				Namespace: ".*",
+				Backend: map[string]interface{}{"testfs": map[string]interface{}{
+					"addr":      testfs,
+					"root":      "tags",
+					"name_path": "docker_tag",
+				}},
+			}}
+		}
+	}
+	if len(c.BuildIndex.TagTypes) == 0 {
+		c.BuildIndex.TagTypes = []tagtype.Config{{Namespace: ".*", Type: "docker"}}
+	}
+	return c
+}
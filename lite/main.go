@@ -0,0 +1,32 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"github.com/uber/kraken/lite/cmd"
+
+	// Import all backend client packages to register them with backend manager.
+	_ "github.com/uber/kraken/lib/backend/gcsbackend"
+	_ "github.com/uber/kraken/lib/backend/hdfsbackend"
+	_ "github.com/uber/kraken/lib/backend/httpbackend"
+	_ "github.com/uber/kraken/lib/backend/registrybackend"
+	_ "github.com/uber/kraken/lib/backend/s3backend"
+	_ "github.com/uber/kraken/lib/backend/shadowbackend"
+	_ "github.com/uber/kraken/lib/backend/sqlbackend"
+	_ "github.com/uber/kraken/lib/backend/testfs"
+)
+
+func main() {
+	cmd.Run(cmd.ParseFlags())
+}
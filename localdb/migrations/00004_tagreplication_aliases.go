@@ -0,0 +1,55 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(up00004, down00004)
+}
+
+func up00004(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE replicate_tag_task ADD COLUMN aliases blob NOT NULL DEFAULT '[]';
+	`)
+	return err
+}
+
+func down00004(tx *sql.Tx) error {
+	// SQLite cannot drop columns, so the table is recreated without aliases.
+	_, err := tx.Exec(`
+		CREATE TABLE replicate_tag_task_00004 (
+			tag          text      NOT NULL,
+			digest       blob      NOT NULL,
+			dependencies blob      NOT NULL,
+			destination  text      NOT NULL,
+			created_at   timestamp DEFAULT CURRENT_TIMESTAMP,
+			last_attempt timestamp NOT NULL,
+			status       text      NOT NULL,
+			failures     integer   NOT NULL,
+			delay        integer   NOT NULL,
+			PRIMARY KEY(tag, destination)
+		);
+		INSERT INTO replicate_tag_task_00004
+			SELECT tag, digest, dependencies, destination, created_at, last_attempt, status, failures, delay
+			FROM replicate_tag_task;
+		DROP TABLE replicate_tag_task;
+		ALTER TABLE replicate_tag_task_00004 RENAME TO replicate_tag_task;
+	`)
+	return err
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose"
+)
+
+func init() {
+	goose.AddMigration(up00005, down00005)
+}
+
+func up00005(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_digest (
+			tag    text NOT NULL,
+			digest text NOT NULL,
+			PRIMARY KEY(tag)
+		);
+		CREATE INDEX IF NOT EXISTS tag_digest_digest ON tag_digest (digest);
+	`)
+	return err
+}
+
+func down00005(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE tag_digest;`)
+	return err
+}
@@ -13,11 +13,28 @@
 // limitations under the License.
 package metrics
 
+import "time"
+
 // Config defines metrics configuration.
 type Config struct {
 	Backend string       `yaml:"backend"`
 	Statsd  StatsdConfig `yaml:"statsd"`
 	M3      M3Config     `yaml:"m3"`
+
+	// FlushInterval is how often metrics are reported to the backend and its
+	// buffers are flushed. Metrics are also flushed when the closer returned
+	// by New is closed.
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Backend == "" {
+		c.Backend = "disabled"
+	}
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+	return c
 }
 
 // StatsdConfig defines statsd configuration.
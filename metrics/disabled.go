@@ -20,10 +20,10 @@ import (
 	"github.com/uber-go/tally"
 )
 
-func newDisabledScope(Config, string) (tally.Scope, io.Closer, error) {
+func newDisabledScope(config Config, cluster string) (tally.Scope, io.Closer, error) {
 	s, c := tally.NewRootScope(tally.ScopeOptions{
 		Reporter: disabledReporter{},
-	}, time.Second)
+	}, config.FlushInterval)
 	return s, c, nil
 }
 
@@ -0,0 +1,112 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/uber-go/tally"
+)
+
+// Reasons for a component shutting down, other than signals.
+const (
+	ShutdownExit  = "exit"
+	ShutdownFatal = "fatal"
+)
+
+// Flusher emits a final shutdown_reason metric and flushes buffered metrics
+// when a component exits, such that the last metrics of short-lived processes
+// are not lost.
+type Flusher struct {
+	stats  tally.Scope
+	closer io.Closer
+	once   sync.Once
+}
+
+// NewFlusher creates a new Flusher of the metrics which closer flushes. If
+// closer is nil, metrics are owned and flushed by another component of the
+// process, e.g. when running all components in one process.
+func NewFlusher(stats tally.Scope, closer io.Closer) *Flusher {
+	return &Flusher{stats: stats, closer: closer}
+}
+
+// Flush emits shutdown_reason tagged with reason and flushes all metrics. Only
+// the first call has any effect. Metrics emitted after Flush may be lost.
+func (f *Flusher) Flush(reason string) {
+	f.once.Do(func() {
+		f.stats.Tagged(map[string]string{"reason": reason}).Counter("shutdown_reason").Inc(1)
+		if f.closer == nil {
+			return
+		}
+		if err := f.closer.Close(); err != nil {
+			log.Errorf("Error flushing metrics: %s", err)
+		}
+	})
+}
+
+// Fatal flushes metrics, then logs args and exits.
+func (f *Flusher) Fatal(args ...interface{}) {
+	f.Flush(ShutdownFatal)
+	log.Fatal(args...)
+}
+
+// FlushOnSignals flushes metrics when the process receives any of sigs, then
+// raises the signal again such that the process exits as it would have without
+// the handler. Does nothing if the Flusher does not own the metrics.
+func (f *Flusher) FlushOnSignals(sigs ...os.Signal) {
+	if f.closer == nil {
+		return
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	go func() {
+		sig := <-c
+		log.Infof("Received %s, flushing metrics", sig)
+		f.Flush(signalReason(sig))
+		signal.Reset(sig)
+		if err := raise(sig); err != nil {
+			log.Fatalf("Error raising %s: %s", sig, err)
+		}
+	}()
+}
+
+func signalReason(sig os.Signal) string {
+	switch sig {
+	case syscall.SIGTERM:
+		return "sigterm"
+	case syscall.SIGINT:
+		return "sigint"
+	case syscall.SIGHUP:
+		return "sighup"
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		return fmt.Sprintf("signal_%d", int(s))
+	}
+	return "signal"
+}
+
+func raise(sig os.Signal) error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type countingCloser struct {
+	closed int
+}
+
+func (c *countingCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestFlusherEmitsShutdownReasonOnce(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	closer := &countingCloser{}
+
+	f := NewFlusher(stats, closer)
+	f.Flush(signalReason(syscall.SIGTERM))
+	f.Flush(ShutdownExit)
+
+	require.Equal(1, closer.closed)
+
+	counters := stats.Snapshot().Counters()
+	require.Len(counters, 1)
+	for _, c := range counters {
+		require.Equal("shutdown_reason", c.Name())
+		require.Equal(map[string]string{"reason": "sigterm"}, c.Tags())
+		require.Equal(int64(1), c.Value())
+	}
+}
+
+func TestFlusherWithoutCloserOnlyEmitsShutdownReason(t *testing.T) {
+	stats := tally.NewTestScope("", nil)
+
+	NewFlusher(stats, nil).Flush(ShutdownFatal)
+
+	require.Len(t, stats.Snapshot().Counters(), 1)
+}
+
+func TestStatsdCloserFlushesBufferedMetrics(t *testing.T) {
+	require := require.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	defer conn.Close()
+
+	stats, closer, err := New(Config{
+		Backend: "statsd",
+		Statsd:  StatsdConfig{HostPort: conn.LocalAddr().String(), Prefix: "kraken"},
+		// Metrics are only reported on close.
+		FlushInterval: time.Hour,
+	}, "")
+	require.NoError(err)
+
+	NewFlusher(stats, closer).Flush(ShutdownExit)
+
+	require.NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(err)
+	require.True(strings.HasPrefix(string(buf[:n]), "kraken.shutdown_reason"), string(buf[:n]))
+}
@@ -16,7 +16,6 @@ package metrics
 import (
 	"fmt"
 	"io"
-	"time"
 
 	"github.com/uber-go/tally"
 	"github.com/uber-go/tally/m3"
@@ -47,6 +46,6 @@ func newM3Scope(config Config, cluster string) (tally.Scope, io.Closer, error) {
 	}
 	s, c := tally.NewRootScope(tally.ScopeOptions{
 		CachedReporter: r,
-	}, time.Second)
+	}, config.FlushInterval)
 	return s, c, nil
 }
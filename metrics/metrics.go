@@ -43,11 +43,10 @@ func register(name string, f scopeFactory) {
 }
 
 // New creates a new metrics Scope from config. If no backend is configured, metrics
-// are disabled.
+// are disabled. Closing the returned closer reports all metrics and flushes them
+// to the backend.
 func New(config Config, cluster string) (tally.Scope, io.Closer, error) {
-	if config.Backend == "" {
-		config.Backend = "disabled"
-	}
+	config = config.applyDefaults()
 	f, ok := _scopeFactories[config.Backend]
 	if !ok || f == nil {
 		return nil, nil, fmt.Errorf("metrics backend %q not registered", config.Backend)
@@ -39,6 +39,20 @@ func newStatsdScope(config Config, cluster string) (tally.Scope, io.Closer, erro
 	})
 	s, c := tally.NewRootScope(tally.ScopeOptions{
 		Reporter: r,
-	}, time.Second)
-	return s, c, nil
+	}, config.FlushInterval)
+	return s, statsdCloser{c, statter}, nil
+}
+
+// statsdCloser reports the final values of metrics before flushing them out of
+// the statsd client buffer.
+type statsdCloser struct {
+	scope   io.Closer
+	statter statsd.Statter
+}
+
+func (c statsdCloser) Close() error {
+	if err := c.scope.Close(); err != nil {
+		return err
+	}
+	return c.statter.Close()
 }
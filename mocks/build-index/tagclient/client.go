@@ -57,6 +57,21 @@ func (mr *MockClientMockRecorder) CheckReadiness() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckReadiness", reflect.TypeOf((*MockClient)(nil).CheckReadiness))
 }
 
+// DistributionStatus mocks base method.
+func (m *MockClient) DistributionStatus(tag string) (tagmodels.DistributionStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DistributionStatus", tag)
+	ret0, _ := ret[0].(tagmodels.DistributionStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DistributionStatus indicates an expected call of DistributionStatus.
+func (mr *MockClientMockRecorder) DistributionStatus(tag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DistributionStatus", reflect.TypeOf((*MockClient)(nil).DistributionStatus), tag)
+}
+
 // DuplicatePut mocks base method.
 func (m *MockClient) DuplicatePut(tag string, d core.Digest, delay time.Duration) error {
 	m.ctrl.T.Helper()
@@ -71,6 +86,20 @@ func (mr *MockClientMockRecorder) DuplicatePut(tag, d, delay interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicatePut", reflect.TypeOf((*MockClient)(nil).DuplicatePut), tag, d, delay)
 }
 
+// DuplicatePutGroup mocks base method.
+func (m *MockClient) DuplicatePutGroup(arg0 []string, arg1 core.Digest, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicatePutGroup", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicatePutGroup indicates an expected call of DuplicatePutGroup.
+func (mr *MockClientMockRecorder) DuplicatePutGroup(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicatePutGroup", reflect.TypeOf((*MockClient)(nil).DuplicatePutGroup), arg0, arg1, arg2)
+}
+
 // DuplicateReplicate mocks base method.
 func (m *MockClient) DuplicateReplicate(tag string, d core.Digest, dependencies core.DigestList, delay time.Duration) error {
 	m.ctrl.T.Helper()
@@ -85,6 +114,34 @@ func (mr *MockClientMockRecorder) DuplicateReplicate(tag, d, dependencies, delay
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateReplicate", reflect.TypeOf((*MockClient)(nil).DuplicateReplicate), tag, d, dependencies, delay)
 }
 
+// DuplicateReplicateGroup mocks base method.
+func (m *MockClient) DuplicateReplicateGroup(arg0 []string, arg1 core.Digest, arg2 core.DigestList, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicateReplicateGroup", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicateReplicateGroup indicates an expected call of DuplicateReplicateGroup.
+func (mr *MockClientMockRecorder) DuplicateReplicateGroup(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateReplicateGroup", reflect.TypeOf((*MockClient)(nil).DuplicateReplicateGroup), arg0, arg1, arg2, arg3)
+}
+
+// DuplicateReportInventory mocks base method.
+func (m *MockClient) DuplicateReportInventory(agent string, summary tagmodels.InventorySummary) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DuplicateReportInventory", agent, summary)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DuplicateReportInventory indicates an expected call of DuplicateReportInventory.
+func (mr *MockClientMockRecorder) DuplicateReportInventory(agent, summary interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DuplicateReportInventory", reflect.TypeOf((*MockClient)(nil).DuplicateReportInventory), agent, summary)
+}
+
 // Get mocks base method.
 func (m *MockClient) Get(tag string) (core.Digest, error) {
 	m.ctrl.T.Helper()
@@ -115,6 +172,20 @@ func (mr *MockClientMockRecorder) Has(tag interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Has", reflect.TypeOf((*MockClient)(nil).Has), tag)
 }
 
+// InvalidateCache mocks base method.
+func (m *MockClient) InvalidateCache(tag string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InvalidateCache", tag)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InvalidateCache indicates an expected call of InvalidateCache.
+func (mr *MockClientMockRecorder) InvalidateCache(tag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InvalidateCache", reflect.TypeOf((*MockClient)(nil).InvalidateCache), tag)
+}
+
 // List mocks base method.
 func (m *MockClient) List(prefix string) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -218,6 +289,62 @@ func (mr *MockClientMockRecorder) PutAndReplicate(tag, d interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAndReplicate", reflect.TypeOf((*MockClient)(nil).PutAndReplicate), tag, d)
 }
 
+// PutGroup mocks base method.
+func (m *MockClient) PutGroup(arg0 []string, arg1 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutGroup", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutGroup indicates an expected call of PutGroup.
+func (mr *MockClientMockRecorder) PutGroup(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutGroup", reflect.TypeOf((*MockClient)(nil).PutGroup), arg0, arg1)
+}
+
+// PutGroupAndReplicate mocks base method.
+func (m *MockClient) PutGroupAndReplicate(arg0 []string, arg1 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutGroupAndReplicate", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutGroupAndReplicate indicates an expected call of PutGroupAndReplicate.
+func (mr *MockClientMockRecorder) PutGroupAndReplicate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutGroupAndReplicate", reflect.TypeOf((*MockClient)(nil).PutGroupAndReplicate), arg0, arg1)
+}
+
+// ConditionalPut mocks base method
+func (m *MockClient) ConditionalPut(arg0 string, arg1 core.Digest, arg2 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConditionalPut", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConditionalPut indicates an expected call of ConditionalPut
+func (mr *MockClientMockRecorder) ConditionalPut(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConditionalPut", reflect.TypeOf((*MockClient)(nil).ConditionalPut), arg0, arg1, arg2)
+}
+
+// PutIfMatch mocks base method
+func (m *MockClient) PutIfMatch(arg0 string, arg1 core.Digest, arg2 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutIfMatch", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutIfMatch indicates an expected call of PutIfMatch
+func (mr *MockClientMockRecorder) PutIfMatch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutIfMatch", reflect.TypeOf((*MockClient)(nil).PutIfMatch), arg0, arg1, arg2)
+}
+
 // Replicate mocks base method.
 func (m *MockClient) Replicate(tag string) error {
 	m.ctrl.T.Helper()
@@ -231,3 +358,32 @@ func (mr *MockClientMockRecorder) Replicate(tag interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replicate", reflect.TypeOf((*MockClient)(nil).Replicate), tag)
 }
+
+// ReplicationStatus mocks base method.
+func (m *MockClient) ReplicationStatus(tag string) (tagmodels.ReplicationStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplicationStatus", tag)
+	ret0, _ := ret[0].(tagmodels.ReplicationStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReplicationStatus indicates an expected call of ReplicationStatus.
+func (mr *MockClientMockRecorder) ReplicationStatus(tag interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplicationStatus", reflect.TypeOf((*MockClient)(nil).ReplicationStatus), tag)
+}
+
+// ReportInventory mocks base method.
+func (m *MockClient) ReportInventory(agent string, summary tagmodels.InventorySummary) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReportInventory", agent, summary)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReportInventory indicates an expected call of ReportInventory.
+func (mr *MockClientMockRecorder) ReportInventory(agent, summary interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportInventory", reflect.TypeOf((*MockClient)(nil).ReportInventory), agent, summary)
+}
@@ -49,6 +49,33 @@ func (mr *MockStoreMockRecorder) Get(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStore)(nil).Get), arg0)
 }
 
+// Invalidate mocks base method
+func (m *MockStore) Invalidate(arg0 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Invalidate", arg0)
+}
+
+// Invalidate indicates an expected call of Invalidate
+func (mr *MockStoreMockRecorder) Invalidate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Invalidate", reflect.TypeOf((*MockStore)(nil).Invalidate), arg0)
+}
+
+// ListByDigest mocks base method
+func (m *MockStore) ListByDigest(arg0 core.Digest) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListByDigest", arg0)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListByDigest indicates an expected call of ListByDigest
+func (mr *MockStoreMockRecorder) ListByDigest(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByDigest", reflect.TypeOf((*MockStore)(nil).ListByDigest), arg0)
+}
+
 // Put mocks base method
 func (m *MockStore) Put(arg0 string, arg1 core.Digest, arg2 time.Duration) error {
 	m.ctrl.T.Helper()
@@ -62,3 +89,46 @@ func (mr *MockStoreMockRecorder) Put(arg0, arg1, arg2 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockStore)(nil).Put), arg0, arg1, arg2)
 }
+
+// PutGroup mocks base method
+func (m *MockStore) PutGroup(arg0 []string, arg1 core.Digest, arg2 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutGroup", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutGroup indicates an expected call of PutGroup
+func (mr *MockStoreMockRecorder) PutGroup(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutGroup", reflect.TypeOf((*MockStore)(nil).PutGroup), arg0, arg1, arg2)
+}
+
+// PutIfMatch mocks base method
+func (m *MockStore) PutIfMatch(arg0 string, arg1 core.Digest, arg2 core.Digest, arg3 time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutIfMatch", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutIfMatch indicates an expected call of PutIfMatch
+func (mr *MockStoreMockRecorder) PutIfMatch(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutIfMatch", reflect.TypeOf((*MockStore)(nil).PutIfMatch), arg0, arg1, arg2, arg3)
+}
+
+// Reindex mocks base method
+func (m *MockStore) Reindex(arg0 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reindex", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reindex indicates an expected call of Reindex
+func (mr *MockStoreMockRecorder) Reindex(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reindex", reflect.TypeOf((*MockStore)(nil).Reindex), arg0)
+}
@@ -79,6 +79,20 @@ func (mr *MockImageTransfererMockRecorder) ListTags(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTags", reflect.TypeOf((*MockImageTransferer)(nil).ListTags), arg0)
 }
 
+// Mount mocks base method
+func (m *MockImageTransferer) Mount(arg0 string, arg1 string, arg2 core.Digest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Mount", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Mount indicates an expected call of Mount
+func (mr *MockImageTransfererMockRecorder) Mount(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mount", reflect.TypeOf((*MockImageTransferer)(nil).Mount), arg0, arg1, arg2)
+}
+
 // PutTag mocks base method
 func (m *MockImageTransferer) PutTag(arg0 string, arg1 core.Digest) error {
 	m.ctrl.T.Helper()
@@ -7,6 +7,7 @@ package mockhashring
 import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	hrw "github.com/uber/kraken/lib/hrw"
 	reflect "reflect"
 )
 
@@ -73,6 +74,34 @@ func (mr *MockRingMockRecorder) Monitor(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Monitor", reflect.TypeOf((*MockRing)(nil).Monitor), arg0)
 }
 
+// Ownership mocks base method
+func (m *MockRing) Ownership() map[string]hrw.Ownership {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ownership")
+	ret0, _ := ret[0].(map[string]hrw.Ownership)
+	return ret0
+}
+
+// Ownership indicates an expected call of Ownership
+func (mr *MockRingMockRecorder) Ownership() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ownership", reflect.TypeOf((*MockRing)(nil).Ownership))
+}
+
+// ReadLocations mocks base method
+func (m *MockRing) ReadLocations(arg0 core.Digest) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadLocations", arg0)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// ReadLocations indicates an expected call of ReadLocations
+func (mr *MockRingMockRecorder) ReadLocations(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadLocations", reflect.TypeOf((*MockRing)(nil).ReadLocations), arg0)
+}
+
 // Refresh mocks base method
 func (m *MockRing) Refresh() {
 	m.ctrl.T.Helper()
@@ -5,6 +5,7 @@
 package mockpersistedretry
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	persistedretry "github.com/uber/kraken/lib/persistedretry"
 	reflect "reflect"
@@ -74,6 +75,44 @@ func (mr *MockManagerMockRecorder) Find(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockManager)(nil).Find), arg0)
 }
 
+// Flush mocks base method
+func (m *MockManager) Flush(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Flush", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Flush indicates an expected call of Flush
+func (mr *MockManagerMockRecorder) Flush(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Flush", reflect.TypeOf((*MockManager)(nil).Flush), arg0)
+}
+
+// Pause mocks base method
+func (m *MockManager) Pause() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Pause")
+}
+
+// Pause indicates an expected call of Pause
+func (mr *MockManagerMockRecorder) Pause() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Pause", reflect.TypeOf((*MockManager)(nil).Pause))
+}
+
+// Resume mocks base method
+func (m *MockManager) Resume() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Resume")
+}
+
+// Resume indicates an expected call of Resume
+func (mr *MockManagerMockRecorder) Resume() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Resume", reflect.TypeOf((*MockManager)(nil).Resume))
+}
+
 // SyncExec mocks base method
 func (m *MockManager) SyncExec(arg0 persistedretry.Task) error {
 	m.ctrl.T.Helper()
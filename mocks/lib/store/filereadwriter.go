@@ -6,6 +6,7 @@ package mockstore
 
 import (
 	gomock "github.com/golang/mock/gomock"
+	io "io"
 	reflect "reflect"
 )
 
@@ -104,6 +105,21 @@ func (mr *MockFileReadWriterMockRecorder) ReadAt(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadAt", reflect.TypeOf((*MockFileReadWriter)(nil).ReadAt), arg0, arg1)
 }
 
+// ReadFrom mocks base method
+func (m *MockFileReadWriter) ReadFrom(arg0 io.Reader) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadFrom", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadFrom indicates an expected call of ReadFrom
+func (mr *MockFileReadWriterMockRecorder) ReadFrom(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFrom", reflect.TypeOf((*MockFileReadWriter)(nil).ReadFrom), arg0)
+}
+
 // Seek mocks base method
 func (m *MockFileReadWriter) Seek(arg0 int64, arg1 int) (int64, error) {
 	m.ctrl.T.Helper()
@@ -162,3 +178,18 @@ func (mr *MockFileReadWriterMockRecorder) WriteAt(arg0, arg1 interface{}) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteAt", reflect.TypeOf((*MockFileReadWriter)(nil).WriteAt), arg0, arg1)
 }
+
+// WriteTo mocks base method
+func (m *MockFileReadWriter) WriteTo(arg0 io.Writer) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteTo", arg0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteTo indicates an expected call of WriteTo
+func (mr *MockFileReadWriterMockRecorder) WriteTo(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteTo", reflect.TypeOf((*MockFileReadWriter)(nil).WriteTo), arg0)
+}
@@ -64,6 +64,18 @@ func (mr *MockReloadableSchedulerMockRecorder) Download(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockReloadableScheduler)(nil).Download), arg0, arg1)
 }
 
+// PreAnnounce mocks base method
+func (m *MockReloadableScheduler) PreAnnounce(arg0 string, arg1 core.Digest) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PreAnnounce", arg0, arg1)
+}
+
+// PreAnnounce indicates an expected call of PreAnnounce
+func (mr *MockReloadableSchedulerMockRecorder) PreAnnounce(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreAnnounce", reflect.TypeOf((*MockReloadableScheduler)(nil).PreAnnounce), arg0, arg1)
+}
+
 // Probe mocks base method
 func (m *MockReloadableScheduler) Probe() error {
 	m.ctrl.T.Helper()
@@ -115,3 +127,17 @@ func (mr *MockReloadableSchedulerMockRecorder) Stop() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockReloadableScheduler)(nil).Stop))
 }
+
+// Unblacklist mocks base method
+func (m *MockReloadableScheduler) Unblacklist(arg0 core.PeerID, arg1 core.InfoHash) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unblacklist", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unblacklist indicates an expected call of Unblacklist
+func (mr *MockReloadableSchedulerMockRecorder) Unblacklist(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unblacklist", reflect.TypeOf((*MockReloadableScheduler)(nil).Unblacklist), arg0, arg1)
+}
@@ -63,6 +63,18 @@ func (mr *MockSchedulerMockRecorder) Download(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockScheduler)(nil).Download), arg0, arg1)
 }
 
+// PreAnnounce mocks base method
+func (m *MockScheduler) PreAnnounce(arg0 string, arg1 core.Digest) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PreAnnounce", arg0, arg1)
+}
+
+// PreAnnounce indicates an expected call of PreAnnounce
+func (mr *MockSchedulerMockRecorder) PreAnnounce(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreAnnounce", reflect.TypeOf((*MockScheduler)(nil).PreAnnounce), arg0, arg1)
+}
+
 // Probe mocks base method
 func (m *MockScheduler) Probe() error {
 	m.ctrl.T.Helper()
@@ -102,3 +114,17 @@ func (mr *MockSchedulerMockRecorder) Stop() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockScheduler)(nil).Stop))
 }
+
+// Unblacklist mocks base method
+func (m *MockScheduler) Unblacklist(arg0 core.PeerID, arg1 core.InfoHash) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unblacklist", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unblacklist indicates an expected call of Unblacklist
+func (mr *MockSchedulerMockRecorder) Unblacklist(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unblacklist", reflect.TypeOf((*MockScheduler)(nil).Unblacklist), arg0, arg1)
+}
@@ -10,11 +10,13 @@
 package mockblobclient
 
 import (
+	"context"
 	gomock "github.com/golang/mock/gomock"
 	io "io"
 	reflect "reflect"
 	time "time"
 	core "github.com/uber/kraken/core"
+	blobclient "github.com/uber/kraken/origin/blobclient"
 )
 
 // MockClient is a mock of Client interface.
@@ -125,19 +127,34 @@ func (mr *MockClientMockRecorder) ForceCleanup(ttl interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceCleanup", reflect.TypeOf((*MockClient)(nil).ForceCleanup), ttl)
 }
 
+// GetLocalMetaInfo mocks base method.
+func (m *MockClient) GetLocalMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLocalMetaInfo", namespace, d)
+	ret0, _ := ret[0].(*core.MetaInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLocalMetaInfo indicates an expected call of GetLocalMetaInfo.
+func (mr *MockClientMockRecorder) GetLocalMetaInfo(namespace, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLocalMetaInfo", reflect.TypeOf((*MockClient)(nil).GetLocalMetaInfo), namespace, d)
+}
+
 // GetMetaInfo mocks base method.
-func (m *MockClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+func (m *MockClient) GetMetaInfo(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMetaInfo", namespace, d)
+	ret := m.ctrl.Call(m, "GetMetaInfo", ctx, namespace, d)
 	ret0, _ := ret[0].(*core.MetaInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMetaInfo indicates an expected call of GetMetaInfo.
-func (mr *MockClientMockRecorder) GetMetaInfo(namespace, d interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetMetaInfo(ctx, namespace, d interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetaInfo", reflect.TypeOf((*MockClient)(nil).GetMetaInfo), namespace, d)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetaInfo", reflect.TypeOf((*MockClient)(nil).GetMetaInfo), ctx, namespace, d)
 }
 
 // GetPeerContext mocks base method.
@@ -155,6 +172,21 @@ func (mr *MockClientMockRecorder) GetPeerContext() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeerContext", reflect.TypeOf((*MockClient)(nil).GetPeerContext))
 }
 
+// GetWriteBackState mocks base method.
+func (m *MockClient) GetWriteBackState(namespace string, d core.Digest) (blobclient.WriteBackState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWriteBackState", namespace, d)
+	ret0, _ := ret[0].(blobclient.WriteBackState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWriteBackState indicates an expected call of GetWriteBackState.
+func (mr *MockClientMockRecorder) GetWriteBackState(namespace, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWriteBackState", reflect.TypeOf((*MockClient)(nil).GetWriteBackState), namespace, d)
+}
+
 // Locations mocks base method.
 func (m *MockClient) Locations(d core.Digest) ([]string, error) {
 	m.ctrl.T.Helper()
@@ -184,6 +216,21 @@ func (mr *MockClientMockRecorder) OverwriteMetaInfo(d, pieceLength interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OverwriteMetaInfo", reflect.TypeOf((*MockClient)(nil).OverwriteMetaInfo), d, pieceLength)
 }
 
+// Prefetch mocks base method
+func (m *MockClient) Prefetch(arg0 string, arg1 []core.Digest) ([]blobclient.PrefetchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Prefetch", arg0, arg1)
+	ret0, _ := ret[0].([]blobclient.PrefetchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Prefetch indicates an expected call of Prefetch
+func (mr *MockClientMockRecorder) Prefetch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Prefetch", reflect.TypeOf((*MockClient)(nil).Prefetch), arg0, arg1)
+}
+
 // ReplicateToRemote mocks base method.
 func (m *MockClient) ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error {
 	m.ctrl.T.Helper()
@@ -255,3 +302,17 @@ func (mr *MockClientMockRecorder) UploadBlob(namespace, d, blob interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBlob", reflect.TypeOf((*MockClient)(nil).UploadBlob), namespace, d, blob)
 }
+
+// UploadBlobStream mocks base method
+func (m *MockClient) UploadBlobStream(arg0 string, arg1 core.Digest, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadBlobStream", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadBlobStream indicates an expected call of UploadBlobStream
+func (mr *MockClientMockRecorder) UploadBlobStream(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBlobStream", reflect.TypeOf((*MockClient)(nil).UploadBlobStream), arg0, arg1, arg2)
+}
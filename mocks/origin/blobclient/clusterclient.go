@@ -10,10 +10,12 @@
 package mockblobclient
 
 import (
+	"context"
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
 	io "io"
 	reflect "reflect"
+	blobclient "github.com/uber/kraken/origin/blobclient"
 )
 
 // MockClusterClient is a mock of ClusterClient interface.
@@ -68,19 +70,49 @@ func (mr *MockClusterClientMockRecorder) DownloadBlob(namespace, d, dst interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadBlob", reflect.TypeOf((*MockClusterClient)(nil).DownloadBlob), namespace, d, dst)
 }
 
+// GetLocalMetaInfo mocks base method.
+func (m *MockClusterClient) GetLocalMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLocalMetaInfo", namespace, d)
+	ret0, _ := ret[0].(*core.MetaInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLocalMetaInfo indicates an expected call of GetLocalMetaInfo.
+func (mr *MockClusterClientMockRecorder) GetLocalMetaInfo(namespace, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLocalMetaInfo", reflect.TypeOf((*MockClusterClient)(nil).GetLocalMetaInfo), namespace, d)
+}
+
 // GetMetaInfo mocks base method.
-func (m *MockClusterClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+func (m *MockClusterClient) GetMetaInfo(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetMetaInfo", namespace, d)
+	ret := m.ctrl.Call(m, "GetMetaInfo", ctx, namespace, d)
 	ret0, _ := ret[0].(*core.MetaInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetMetaInfo indicates an expected call of GetMetaInfo.
-func (mr *MockClusterClientMockRecorder) GetMetaInfo(namespace, d interface{}) *gomock.Call {
+func (mr *MockClusterClientMockRecorder) GetMetaInfo(ctx, namespace, d interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetaInfo", reflect.TypeOf((*MockClusterClient)(nil).GetMetaInfo), namespace, d)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetaInfo", reflect.TypeOf((*MockClusterClient)(nil).GetMetaInfo), ctx, namespace, d)
+}
+
+// GetWriteBackState mocks base method.
+func (m *MockClusterClient) GetWriteBackState(namespace string, d core.Digest) (blobclient.WriteBackState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWriteBackState", namespace, d)
+	ret0, _ := ret[0].(blobclient.WriteBackState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWriteBackState indicates an expected call of GetWriteBackState.
+func (mr *MockClusterClientMockRecorder) GetWriteBackState(namespace, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWriteBackState", reflect.TypeOf((*MockClusterClient)(nil).GetWriteBackState), namespace, d)
 }
 
 // OverwriteMetaInfo mocks base method.
@@ -154,3 +186,17 @@ func (mr *MockClusterClientMockRecorder) UploadBlob(namespace, d, blob interface
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBlob", reflect.TypeOf((*MockClusterClient)(nil).UploadBlob), namespace, d, blob)
 }
+
+// UploadBlobStream mocks base method
+func (m *MockClusterClient) UploadBlobStream(arg0 string, arg1 core.Digest, arg2 io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UploadBlobStream", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UploadBlobStream indicates an expected call of UploadBlobStream
+func (mr *MockClusterClientMockRecorder) UploadBlobStream(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadBlobStream", reflect.TypeOf((*MockClusterClient)(nil).UploadBlobStream), arg0, arg1, arg2)
+}
@@ -12,8 +12,8 @@ package mockannounceclient
 import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	announceclient "github.com/uber/kraken/tracker/announceclient"
 	reflect "reflect"
-	time "time"
 )
 
 // MockClient is a mock of Client interface.
@@ -40,19 +40,18 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 }
 
 // Announce mocks base method.
-func (m *MockClient) Announce(d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
+func (m *MockClient) Announce(r announceclient.AnnounceRequest) (*announceclient.Response, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Announce", d, h, complete, version)
-	ret0, _ := ret[0].([]*core.PeerInfo)
-	ret1, _ := ret[1].(time.Duration)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret := m.ctrl.Call(m, "Announce", r)
+	ret0, _ := ret[0].(*announceclient.Response)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Announce indicates an expected call of Announce.
-func (mr *MockClientMockRecorder) Announce(d, h, complete, version interface{}) *MockClientAnnounceCall {
+func (mr *MockClientMockRecorder) Announce(r interface{}) *MockClientAnnounceCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Announce", reflect.TypeOf((*MockClient)(nil).Announce), d, h, complete, version)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Announce", reflect.TypeOf((*MockClient)(nil).Announce), r)
 	return &MockClientAnnounceCall{Call: call}
 }
 
@@ -62,19 +61,19 @@ type MockClientAnnounceCall struct {
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockClientAnnounceCall) Return(arg0 []*core.PeerInfo, arg1 time.Duration, arg2 error) *MockClientAnnounceCall {
-	c.Call = c.Call.Return(arg0, arg1, arg2)
+func (c *MockClientAnnounceCall) Return(arg0 *announceclient.Response, arg1 error) *MockClientAnnounceCall {
+	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockClientAnnounceCall) Do(f func(core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error)) *MockClientAnnounceCall {
+func (c *MockClientAnnounceCall) Do(f func(announceclient.AnnounceRequest) (*announceclient.Response, error)) *MockClientAnnounceCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockClientAnnounceCall) DoAndReturn(f func(core.Digest, core.InfoHash, bool, int) ([]*core.PeerInfo, time.Duration, error)) *MockClientAnnounceCall {
+func (c *MockClientAnnounceCall) DoAndReturn(f func(announceclient.AnnounceRequest) (*announceclient.Response, error)) *MockClientAnnounceCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -116,3 +115,18 @@ func (c *MockClientCheckReadinessCall) DoAndReturn(f func() error) *MockClientCh
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
+
+// Scrape mocks base method
+func (m *MockClient) Scrape(arg0 string, arg1 []core.Digest) ([]*announceclient.SwarmStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Scrape", arg0, arg1)
+	ret0, _ := ret[0].([]*announceclient.SwarmStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Scrape indicates an expected call of Scrape
+func (mr *MockClientMockRecorder) Scrape(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scrape", reflect.TypeOf((*MockClient)(nil).Scrape), arg0, arg1)
+}
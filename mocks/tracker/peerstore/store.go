@@ -7,6 +7,7 @@ package mockpeerstore
 import (
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
+	peerstore "github.com/uber/kraken/tracker/peerstore"
 	reflect "reflect"
 )
 
@@ -45,6 +46,36 @@ func (mr *MockStoreMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close))
 }
 
+// Export mocks base method
+func (m *MockStore) Export() (*peerstore.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export")
+	ret0, _ := ret[0].(*peerstore.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Export indicates an expected call of Export
+func (mr *MockStoreMockRecorder) Export() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockStore)(nil).Export))
+}
+
+// GetPeerStats mocks base method
+func (m *MockStore) GetPeerStats(arg0 []core.PeerID) (map[core.PeerID]*peerstore.PeerStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPeerStats", arg0)
+	ret0, _ := ret[0].(map[core.PeerID]*peerstore.PeerStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPeerStats indicates an expected call of GetPeerStats
+func (mr *MockStoreMockRecorder) GetPeerStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeerStats", reflect.TypeOf((*MockStore)(nil).GetPeerStats), arg0)
+}
+
 // GetPeers mocks base method
 func (m *MockStore) GetPeers(arg0 core.InfoHash, arg1 int) ([]*core.PeerInfo, error) {
 	m.ctrl.T.Helper()
@@ -60,6 +91,35 @@ func (mr *MockStoreMockRecorder) GetPeers(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeers", reflect.TypeOf((*MockStore)(nil).GetPeers), arg0, arg1)
 }
 
+// GetSwarmStats mocks base method
+func (m *MockStore) GetSwarmStats(arg0 core.InfoHash) (*peerstore.SwarmStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSwarmStats", arg0)
+	ret0, _ := ret[0].(*peerstore.SwarmStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSwarmStats indicates an expected call of GetSwarmStats
+func (mr *MockStoreMockRecorder) GetSwarmStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSwarmStats", reflect.TypeOf((*MockStore)(nil).GetSwarmStats), arg0)
+}
+
+// Import mocks base method
+func (m *MockStore) Import(arg0 *peerstore.Snapshot) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Import", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Import indicates an expected call of Import
+func (mr *MockStoreMockRecorder) Import(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockStore)(nil).Import), arg0)
+}
+
 // UpdatePeer mocks base method
 func (m *MockStore) UpdatePeer(arg0 core.InfoHash, arg1 *core.PeerInfo) error {
 	m.ctrl.T.Helper()
@@ -73,3 +133,17 @@ func (mr *MockStoreMockRecorder) UpdatePeer(arg0, arg1 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePeer", reflect.TypeOf((*MockStore)(nil).UpdatePeer), arg0, arg1)
 }
+
+// UpdatePeerStats mocks base method
+func (m *MockStore) UpdatePeerStats(arg0 []*peerstore.PeerStats) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePeerStats", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePeerStats indicates an expected call of UpdatePeerStats
+func (mr *MockStoreMockRecorder) UpdatePeerStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePeerStats", reflect.TypeOf((*MockStore)(nil).UpdatePeerStats), arg0)
+}
@@ -25,7 +25,14 @@ upstream agent-server {
 }
 
 server {
-  listen {{.port}};
+  {{if .http3_enabled}}
+    listen {{.port}} ssl;
+    listen {{.port}} quic reuseport;
+    http3 on;
+    add_header Alt-Svc 'h3=":{{.port}}"; ma={{.alt_svc_max_age}}' always;
+  {{else}}
+    listen {{.port}};
+  {{end}}
 
   {{range .allowed_cidrs}}
     allow {{.}};
@@ -40,7 +47,7 @@ server {
   gzip on;
   gzip_types text/plain test/csv application/json;
 
-  location ~ ^/(health|readiness)$ {
+  location ~ ^/(health|readiness|version)$ {
     proxy_pass http://agent-server;
   }
 
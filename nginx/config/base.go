@@ -52,6 +52,14 @@ http {
   proxy_set_header  X-Forwarded-Proto $http_x_forwarded_proto;
   proxy_set_header  X-Real-IP         $remote_addr;
   proxy_set_header  X-Original-URI    $request_uri;
+  # Passes the verified client certificate to upstream servers, which may
+  # authorize requests by its identity. Always overwrites any value sent by
+  # the client, and strips it without TLS.
+  {{if .ssl_enabled}}
+    proxy_set_header  X-SSL-Client-Cert $ssl_client_escaped_cert;
+  {{else}}
+    proxy_set_header  X-SSL-Client-Cert "";
+  {{end}}
 
   # Overwrites http with $scheme if Location header is set to http by upstream.
   proxy_redirect ~^http://[^:]+:\d+(/.+)$ $1;
@@ -61,7 +69,10 @@ http {
   ##
 
   {{if .ssl_enabled}}
-    ssl on;
+    {{if not .http3_enabled}}
+      # With http3, TLS is enabled per listen directive instead.
+      ssl on;
+    {{end}}
     ssl_certificate {{.ssl_certificate}};
     ssl_certificate_key {{.ssl_certificate_key}};
     {{if .ssl_password_file}}
@@ -73,7 +84,7 @@ http {
     ssl_verify_client on;
     ssl_client_certificate {{.ssl_client_certificate}};
   {{end}}
-  ssl_protocols TLSv1.2; # Dropping SSLv3, ref: POODLE
+  ssl_protocols TLSv1.2{{if .http3_enabled}} TLSv1.3{{end}}; # Dropping SSLv3, ref: POODLE
   ssl_prefer_server_ciphers on;
   ssl_ciphers ECDH+AES256:ECDH+AES128:!ADH:!AECDH:!MD5:!SHA1:!aNULL:!eNULL@SECLEVEL=2;
 
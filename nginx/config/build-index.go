@@ -19,6 +19,12 @@ proxy_cache_path {{.cache_dir}}/tags keys_zone=tags:20m;
 proxy_cache_path {{.cache_dir}}/repositories keys_zone=repositories:20m;
 proxy_cache_path {{.cache_dir}}/list keys_zone=list:20m;
 
+# Streamed list responses are neither cached nor served from cache.
+map $http_accept $list_stream {
+  default                 0;
+  ~application/x-ndjson   1;
+}
+
 upstream build-index {
   server {{.server}};
 }
@@ -52,6 +58,8 @@ server {
     proxy_cache_methods GET;
     proxy_cache_valid   any 1s;
     proxy_cache_lock    on;
+    proxy_cache_bypass  $list_stream;
+    proxy_no_cache      $list_stream;
   }
 
   location /list {
@@ -62,6 +70,8 @@ server {
     proxy_cache_valid   200 30s;
     proxy_cache_valid   any 1s;
     proxy_cache_lock    on;
+    proxy_cache_bypass  $list_stream;
+    proxy_no_cache      $list_stream;
 
     proxy_read_timeout 2m;
   }
@@ -26,6 +26,18 @@ var _nameToDefaultTemplate = map[string]string{
 	"kraken-proxy":       ProxyTemplate,
 }
 
+// _http3Templates are the default templates which serve HTTP/3 when enabled.
+var _http3Templates = map[string]bool{
+	"kraken-agent": true,
+	"kraken-proxy": true,
+}
+
+// SupportsHTTP3 returns whether the default template for name can serve
+// HTTP/3.
+func SupportsHTTP3(name string) bool {
+	return _http3Templates[name]
+}
+
 // DefaultClientVerification is the default nginx configuration for
 // client verification in the server block.
 const DefaultClientVerification = `
@@ -23,9 +23,22 @@ upstream registry-override {
   server {{.registry_override_server}};
 }
 
+{{if .push_jobs_server}}
+upstream push-jobs {
+  server {{.push_jobs_server}};
+}
+{{end}}
+
 {{range .ports}}
 server {
-  listen {{.}};
+  {{if $.http3_enabled}}
+    listen {{.}} ssl;
+    listen {{.}} quic reuseport;
+    http3 on;
+    add_header Alt-Svc 'h3=":{{.}}"; ma={{$.alt_svc_max_age}}' always;
+  {{else}}
+    listen {{.}};
+  {{end}}
 
   {{$.client_verification}}
 
@@ -59,6 +72,29 @@ server {
     proxy_set_header Host $hostheader:{{.}};
   }
 
+  {{if $.push_jobs_server}}
+  # Manifest pushes are acknowledged asynchronously with a push job.
+  location ~ ^/v2/(.+/manifests/|_kraken/jobs/) {
+    proxy_pass http://push-jobs;
+
+    set $hostheader $hostname;
+    if ( $host = "localhost" ) {
+      set $hostheader "localhost";
+    }
+    if ( $host = "127.0.0.1" ) {
+      set $hostheader "127.0.0.1";
+    }
+    if ( $host = "192.168.65.1" ) {
+      set $hostheader "192.168.65.1";
+    }
+    if ( $host = "host.docker.internal" ) {
+      set $hostheader "host.docker.internal";
+    }
+    proxy_set_header Host $hostheader:{{.}};
+  }
+
+  {{end}}
+
   location / {
     proxy_pass http://registry;
 
@@ -0,0 +1,544 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nginx
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uber/kraken/proxy/pushjobs"
+	"github.com/uber/kraken/utils/flagutil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// Modes in which Run serves a component's ingress.
+const (
+	// ModeNginx renders the component's template and runs the nginx binary.
+	ModeNginx = "nginx"
+
+	// ModeNative serves the component's routes with an in-process reverse
+	// proxy, so no nginx binary is required.
+	ModeNative = "native"
+)
+
+const (
+	_defaultMaxBodySize = 1 << 20
+	_largeMaxBodySize   = 10 << 30
+	_defaultReadTimeout = time.Minute
+)
+
+// _redirectRegexp mirrors proxy_redirect in the base template, which strips
+// the scheme and host from upstream redirects.
+var _redirectRegexp = regexp.MustCompile(`^http://[^:]+:\d+(/.+)$`)
+
+// _localHosts are Host header values the proxy template forwards unchanged
+// instead of replacing them with the hostname.
+var _localHosts = map[string]bool{
+	"localhost":            true,
+	"127.0.0.1":            true,
+	"192.168.65.1":         true,
+	"host.docker.internal": true,
+}
+
+var errNextUpstream = errors.New("next upstream")
+
+type originalRequestKey struct{}
+
+// runNative serves the routes of the default template for config.Name using
+// net/http. Response caching and gzip from the templates are not replicated.
+func runNative(config Config, params map[string]interface{}) error {
+	if config.TemplatePath != "" {
+		return errors.New("invalid config: template_path not supported in native mode")
+	}
+	if config.HTTP3.Enabled {
+		return errors.New("invalid config: http3 not supported in native mode")
+	}
+	if _, ok := params["client_verification"]; ok {
+		return errors.New("invalid params: client_verification not supported in native mode")
+	}
+	tlsConfig, err := config.tls.BuildServer()
+	if err != nil {
+		return fmt.Errorf("build server tls: %s", err)
+	}
+	handlers, err := buildNativeHandlers(config.Name, params)
+	if err != nil {
+		return fmt.Errorf("build handlers: %s", err)
+	}
+
+	accessLog, err := os.OpenFile(config.AccessLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open access log: %s", err)
+	}
+	defer accessLog.Close()
+	errorLog, err := os.OpenFile(config.ErrorLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open error log: %s", err)
+	}
+	defer errorLog.Close()
+
+	if tlsConfig == nil {
+		log.Warn("Server TLS is disabled")
+	}
+
+	errc := make(chan error, len(handlers))
+	for port, h := range handlers {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			return fmt.Errorf("listen: %s", err)
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		h = verifyClient(h, tlsConfig != nil)
+		h = logAccess(h, accessLog, port)
+		s := &http.Server{
+			Handler:  h,
+			ErrorLog: stdlog.New(errorLog, "", stdlog.LstdFlags),
+		}
+		log.Infof("Serving %s natively on port %d", config.Name, port)
+		go func() { errc <- s.Serve(l) }()
+	}
+	return <-errc
+}
+
+// buildNativeHandlers returns the handler for each port the component listens
+// on, following the routes of its default template.
+func buildNativeHandlers(
+	name string, params map[string]interface{}) (map[int]http.Handler, error) {
+
+	switch name {
+	case "kraken-agent":
+		return buildAgentHandlers(params)
+	case "kraken-origin":
+		return buildSingleUpstreamHandlers(params, "", _largeMaxBodySize, nil)
+	case "kraken-build-index":
+		return buildSingleUpstreamHandlers(
+			params, "build-index", _defaultMaxBodySize, map[string]time.Duration{"/list": 2 * time.Minute})
+	case "kraken-tracker":
+		return buildSingleUpstreamHandlers(params, "tracker", _defaultMaxBodySize, nil)
+	case "kraken-proxy":
+		return buildProxyHandlers(params)
+	default:
+		return nil, fmt.Errorf("name %q not supported in native mode", name)
+	}
+}
+
+// buildSingleUpstreamHandlers serves all requests from params["server"]. An
+// empty host forwards the upstream address as the Host header. Paths in
+// timeouts use the given read timeout instead of the default.
+func buildSingleUpstreamHandlers(
+	params map[string]interface{},
+	host string,
+	maxBodySize int64,
+	timeouts map[string]time.Duration) (map[int]http.Handler, error) {
+
+	port, err := intParam(params, "port")
+	if err != nil {
+		return nil, err
+	}
+	server, err := stringParam(params, "server")
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = server
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", newReverseProxy(server, fixedHost(host), _defaultReadTimeout))
+	for path, timeout := range timeouts {
+		mux.Handle(path, newReverseProxy(server, fixedHost(host), timeout))
+	}
+	return map[int]http.Handler{port: limitBody(mux, maxBodySize)}, nil
+}
+
+func buildAgentHandlers(params map[string]interface{}) (map[int]http.Handler, error) {
+	port, err := intParam(params, "port")
+	if err != nil {
+		return nil, err
+	}
+	registry, err := stringParam(params, "registry_server")
+	if err != nil {
+		return nil, err
+	}
+	agent, err := stringParam(params, "agent_server")
+	if err != nil {
+		return nil, err
+	}
+	backup, _ := params["registry_backup"].(string)
+	cidrs, _ := params["allowed_cidrs"].([]string)
+	allowed, err := parseAllowed(cidrs)
+	if err != nil {
+		return nil, fmt.Errorf("allowed_cidrs: %s", err)
+	}
+
+	var registryHandler http.Handler
+	primary := newReverseProxy(registry, fixedHost("registry-backend"), _defaultReadTimeout)
+	if backup == "" {
+		registryHandler = primary
+	} else {
+		registryHandler = newFailover(
+			primary, newReverseProxy(backup, fixedHost("registry-backend"), _defaultReadTimeout))
+	}
+	agentHandler := newReverseProxy(agent, fixedHost("agent-server"), _defaultReadTimeout)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || r.URL.Path == "/readiness" {
+			agentHandler.ServeHTTP(w, r)
+			return
+		}
+		registryHandler.ServeHTTP(w, r)
+	})
+	return map[int]http.Handler{
+		port: allowCIDRs(limitBody(h, _defaultMaxBodySize), allowed),
+	}, nil
+}
+
+func buildProxyHandlers(params map[string]interface{}) (map[int]http.Handler, error) {
+	var ports []int
+	switch p := params["ports"].(type) {
+	case flagutil.Ints:
+		ports = p
+	case []int:
+		ports = p
+	default:
+		return nil, errors.New("invalid params: ports must be a list of ints")
+	}
+	registry, err := stringParam(params, "registry_server")
+	if err != nil {
+		return nil, err
+	}
+	override, err := stringParam(params, "registry_override_server")
+	if err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("hostname: %s", err)
+	}
+	// Committing large blobs might take a while.
+	timeout := 3 * time.Minute
+
+	// Optional, only set if asynchronous pushes are enabled.
+	pushJobs, _ := params["push_jobs_server"].(string)
+
+	handlers := make(map[int]http.Handler)
+	for _, port := range ports {
+		host := proxyHost(hostname, port)
+		mux := http.NewServeMux()
+		mux.Handle("/", newReverseProxy(registry, host, timeout))
+		mux.Handle("/v2/_catalog", newReverseProxy(override, host, timeout))
+		var h http.Handler = mux
+		if pushJobs != "" {
+			h = routePushJobs(mux, newReverseProxy(pushJobs, host, timeout))
+		}
+		handlers[port] = limitBody(h, _largeMaxBodySize)
+	}
+	return handlers, nil
+}
+
+// routePushJobs sends manifest and push job requests to pushJobs, mirroring
+// the regex location of the proxy template.
+func routePushJobs(next, pushJobs http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pushjobs.IsPushJobPath(r.URL.Path) {
+			pushJobs.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fixedHost returns a function which sets the upstream Host header to host.
+func fixedHost(host string) func(*http.Request) string {
+	return func(*http.Request) string { return host }
+}
+
+// proxyHost returns a function which sets the upstream Host header to
+// hostname:port, unless the client addressed a local host.
+func proxyHost(hostname string, port int) func(*http.Request) string {
+	return func(r *http.Request) string {
+		h := r.Host
+		if host, _, err := net.SplitHostPort(h); err == nil {
+			h = host
+		}
+		if !_localHosts[h] {
+			h = hostname
+		}
+		return fmt.Sprintf("%s:%d", h, port)
+	}
+}
+
+// newReverseProxy returns a proxy to server, which is either host:port or a
+// unix socket in the form returned by GetServer.
+func newReverseProxy(
+	server string, host func(*http.Request) string, timeout time.Duration) *httputil.ReverseProxy {
+
+	dialer := &net.Dialer{Timeout: _defaultReadTimeout}
+	network, addr := "tcp", server
+	if strings.HasPrefix(server, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(server, "unix:")
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConnsPerHost:   64,
+	}
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = "upstream"
+			r.Host = host(r)
+			r.Header.Set("X-Real-IP", remoteIP(r))
+			r.Header.Set("X-Original-URI", r.RequestURI)
+			// Always overwrite any value sent by the client.
+			r.Header.Del("X-SSL-Client-Cert")
+			if cert := verifiedClientCert(r); cert != "" {
+				r.Header.Set("X-SSL-Client-Cert", cert)
+			}
+		},
+		Transport: transport,
+		ModifyResponse: func(resp *http.Response) error {
+			if loc := resp.Header.Get("Location"); loc != "" {
+				resp.Header.Set("Location", _redirectRegexp.ReplaceAllString(loc, "$1"))
+			}
+			return nil
+		},
+		ErrorLog: stdlog.New(ioutil.Discard, "", 0),
+	}
+}
+
+// newFailover retries idempotent requests which fail on primary with an error,
+// 404 or 500 against backup, mirroring proxy_next_upstream.
+func newFailover(primary *httputil.ReverseProxy, backup http.Handler) http.Handler {
+	modify := primary.ModifyResponse
+	primary.ModifyResponse = func(resp *http.Response) error {
+		if idempotent(resp.Request.Method) &&
+			(resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusInternalServerError) {
+			resp.Body.Close()
+			return errNextUpstream
+		}
+		return modify(resp)
+	}
+	primary.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if !idempotent(r.Method) {
+			log.With("url", r.URL).Errorf("Error proxying request: %s", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		backup.ServeHTTP(w, r.Context().Value(originalRequestKey{}).(*http.Request))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), originalRequestKey{}, r)))
+	})
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// verifiedClientCert returns the url-escaped PEM of the client certificate if
+// it was verified, matching $ssl_client_escaped_cert.
+func verifiedClientCert(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.TLS.PeerCertificates[0].Raw})
+	return url.QueryEscape(string(b))
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// verifyClient mirrors config.DefaultClientVerification: when TLS is enabled,
+// requests other than GET and HEAD must present a verified client certificate
+// unless they come from localhost.
+func verifyClient(h http.Handler, tlsEnabled bool) http.Handler {
+	if !tlsEnabled {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead &&
+			remoteIP(r) != "127.0.0.1" && verifiedClientCert(r) == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// limitBody mirrors client_max_body_size.
+func limitBody(h http.Handler, n int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > n {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// parseAllowed parses the values of nginx allow directives, which may be IPs,
+// CIDRs or "all".
+func parseAllowed(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range values {
+		if v == "all" {
+			nets = append(nets,
+				&net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+				&net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)})
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			v = fmt.Sprintf("%s/%d", v, bits)
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// allowCIDRs mirrors allow/deny all, rejecting clients outside of nets.
+func allowCIDRs(h http.Handler, nets []*net.IPNet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(remoteIP(r))
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusForbidden)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush allows streamed responses such as blob downloads to pass through.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logAccess writes a subset of the json log_format of the base template to w.
+func logAccess(h http.Handler, w io.Writer, port int) http.Handler {
+	enc := json.NewEncoder(w)
+	logs := make(chan map[string]interface{}, 1024)
+	go func() {
+		for entry := range logs {
+			enc.Encode(entry)
+		}
+	}()
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: rw}
+		h.ServeHTTP(rec, r)
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		entry := map[string]interface{}{
+			"verb":                       r.Method,
+			"path":                       r.RequestURI,
+			"request_scheme":             scheme,
+			"request_port":               port,
+			"request_host":               r.Host,
+			"clientip":                   remoteIP(r),
+			"agent":                      r.UserAgent(),
+			"response_redirect_location": rec.Header().Get("Location"),
+			"response_body_length":       rec.bytes,
+			"responseStatusCode":         fmt.Sprint(rec.status),
+			"responseTime":               time.Since(start).Seconds(),
+			"@timestamp":                 start.Format(time.RFC3339),
+			"service_name":               "kraken",
+		}
+		select {
+		case logs <- entry:
+		default:
+			// Drop entries rather than blocking requests on a slow disk.
+		}
+	})
+}
+
+func stringParam(params map[string]interface{}, key string) (string, error) {
+	v, ok := params[key].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("invalid params: %s required", key)
+	}
+	return v, nil
+}
+
+func intParam(params map[string]interface{}, key string) (int, error) {
+	v, ok := params[key].(int)
+	if !ok || v == 0 {
+		return 0, fmt.Errorf("invalid params: %s required", key)
+	}
+	return v, nil
+}
@@ -0,0 +1,323 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nginx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// upstream is a server which reports its name and the Host header of requests
+// it receives.
+type upstream struct {
+	*httptest.Server
+	name string
+}
+
+func newUpstream(name string, status int) *upstream {
+	return &upstream{
+		Server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Upstream", name)
+			w.Header().Set("X-Upstream-Host", r.Host)
+			w.Header().Set("X-Upstream-Cert", r.Header.Get("X-SSL-Client-Cert"))
+			w.WriteHeader(status)
+		})),
+		name: name,
+	}
+}
+
+func (u *upstream) addr() string {
+	return strings.TrimPrefix(u.URL, "http://")
+}
+
+func serve(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	r.Host = "localhost"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestBuildNativeHandlersSingleUpstream(t *testing.T) {
+	server := newUpstream("server", http.StatusOK)
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name string
+		host string
+	}{
+		{"kraken-origin", server.addr()},
+		{"kraken-build-index", "build-index"},
+		{"kraken-tracker", "tracker"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			handlers, err := buildNativeHandlers(tc.name, map[string]interface{}{
+				"port":   8080,
+				"server": server.addr(),
+			})
+			require.NoError(err)
+			require.Len(handlers, 1)
+
+			w := serve(handlers[8080], http.MethodGet, "/health")
+			require.Equal(http.StatusOK, w.Code)
+			require.Equal("server", w.Header().Get("X-Upstream"))
+			require.Equal(tc.host, w.Header().Get("X-Upstream-Host"))
+		})
+	}
+}
+
+func TestBuildNativeHandlersAgent(t *testing.T) {
+	require := require.New(t)
+
+	registry := newUpstream("registry", http.StatusOK)
+	defer registry.Close()
+	agent := newUpstream("agent", http.StatusOK)
+	defer agent.Close()
+
+	handlers, err := buildNativeHandlers("kraken-agent", map[string]interface{}{
+		"port":            8080,
+		"registry_server": registry.addr(),
+		"agent_server":    agent.addr(),
+		"allowed_cidrs":   []string{"all"},
+	})
+	require.NoError(err)
+	h := handlers[8080]
+
+	for path, expected := range map[string]string{
+		"/health":                   "agent",
+		"/readiness":                "agent",
+		"/v2/":                      "registry",
+		"/v2/repo/manifests/latest": "registry",
+	} {
+		w := serve(h, http.MethodGet, path)
+		require.Equal(http.StatusOK, w.Code, path)
+		require.Equal(expected, w.Header().Get("X-Upstream"), path)
+	}
+}
+
+func TestBuildNativeHandlersAgentRejectsClientsOutsideAllowedCIDRs(t *testing.T) {
+	require := require.New(t)
+
+	registry := newUpstream("registry", http.StatusOK)
+	defer registry.Close()
+
+	handlers, err := buildNativeHandlers("kraken-agent", map[string]interface{}{
+		"port":            8080,
+		"registry_server": registry.addr(),
+		"agent_server":    registry.addr(),
+		"allowed_cidrs":   []string{"127.0.0.1"},
+	})
+	require.NoError(err)
+
+	// httptest requests come from 192.0.2.1.
+	require.Equal(http.StatusForbidden, serve(handlers[8080], http.MethodGet, "/v2/").Code)
+}
+
+func TestBuildNativeHandlersProxy(t *testing.T) {
+	require := require.New(t)
+
+	registry := newUpstream("registry", http.StatusOK)
+	defer registry.Close()
+	override := newUpstream("override", http.StatusOK)
+	defer override.Close()
+	pushJobs := newUpstream("pushjobs", http.StatusOK)
+	defer pushJobs.Close()
+
+	handlers, err := buildNativeHandlers("kraken-proxy", map[string]interface{}{
+		"ports":                    []int{5000, 5001},
+		"registry_server":          registry.addr(),
+		"registry_override_server": override.addr(),
+		"push_jobs_server":         pushJobs.addr(),
+	})
+	require.NoError(err)
+	require.Len(handlers, 2)
+
+	for path, expected := range map[string]string{
+		"/v2/":                         "registry",
+		"/v2/repo/blobs/uploads/":      "registry",
+		"/v2/_catalog":                 "override",
+		"/v2/repo/manifests/latest":    "pushjobs",
+		"/v2/_kraken/jobs/some-job-id": "pushjobs",
+	} {
+		w := serve(handlers[5001], http.MethodGet, path)
+		require.Equal(http.StatusOK, w.Code, path)
+		require.Equal(expected, w.Header().Get("X-Upstream"), path)
+		require.Equal("localhost:5001", w.Header().Get("X-Upstream-Host"), path)
+	}
+}
+
+func TestBuildNativeHandlersInvalidParams(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		name   string
+		params map[string]interface{}
+	}{
+		{"unknown component", "kraken-foo", map[string]interface{}{}},
+		{"missing server", "kraken-origin", map[string]interface{}{"port": 8080}},
+		{"invalid ports", "kraken-proxy", map[string]interface{}{"ports": "5000"}},
+		{"invalid cidr", "kraken-agent", map[string]interface{}{
+			"port":            8080,
+			"registry_server": "localhost:1",
+			"agent_server":    "localhost:2",
+			"allowed_cidrs":   []string{"foo"},
+		}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := buildNativeHandlers(tc.name, tc.params)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestFailoverRetriesIdempotentRequestsOnBackup(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			require := require.New(t)
+
+			primary := newUpstream("primary", status)
+			defer primary.Close()
+			backup := newUpstream("backup", http.StatusOK)
+			defer backup.Close()
+
+			h := newFailover(
+				newReverseProxy(primary.addr(), fixedHost("registry-backend"), _defaultReadTimeout),
+				newReverseProxy(backup.addr(), fixedHost("registry-backend"), _defaultReadTimeout))
+
+			w := serve(h, http.MethodGet, "/v2/repo/blobs/sha256:foo")
+			require.Equal(http.StatusOK, w.Code)
+			require.Equal("backup", w.Header().Get("X-Upstream"))
+
+			// Non-idempotent requests are never retried.
+			w = serve(h, http.MethodPost, "/v2/repo/blobs/uploads/")
+			require.Equal(status, w.Code)
+			require.Equal("primary", w.Header().Get("X-Upstream"))
+		})
+	}
+}
+
+func TestFailoverRetriesOnBackupWhenPrimaryUnavailable(t *testing.T) {
+	require := require.New(t)
+
+	primary := newUpstream("primary", http.StatusOK)
+	primary.Close()
+	backup := newUpstream("backup", http.StatusOK)
+	defer backup.Close()
+
+	h := newFailover(
+		newReverseProxy(primary.addr(), fixedHost("registry-backend"), _defaultReadTimeout),
+		newReverseProxy(backup.addr(), fixedHost("registry-backend"), _defaultReadTimeout))
+
+	w := serve(h, http.MethodGet, "/v2/")
+	require.Equal(http.StatusOK, w.Code)
+	require.Equal("backup", w.Header().Get("X-Upstream"))
+
+	require.Equal(http.StatusBadGateway, serve(h, http.MethodPut, "/v2/").Code)
+}
+
+func TestReverseProxyRewritesRedirects(t *testing.T) {
+	for _, tc := range []struct {
+		location string
+		expected string
+	}{
+		{"http://origin-host:15002/namespace/foo/blobs/bar", "/namespace/foo/blobs/bar"},
+		{"http://10.0.0.1:80/v2/", "/v2/"},
+		// Only absolute http locations with ports are rewritten.
+		{"https://origin-host:15002/foo", "https://origin-host:15002/foo"},
+		{"http://origin-host/foo", "http://origin-host/foo"},
+		{"/foo", "/foo"},
+	} {
+		t.Run(tc.location, func(t *testing.T) {
+			require := require.New(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, tc.location, http.StatusTemporaryRedirect)
+			}))
+			defer server.Close()
+
+			h := newReverseProxy(
+				strings.TrimPrefix(server.URL, "http://"), fixedHost("origin"), _defaultReadTimeout)
+
+			w := serve(h, http.MethodGet, "/")
+			require.Equal(http.StatusTemporaryRedirect, w.Code)
+			require.Equal(tc.expected, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestReverseProxyOverwritesClientCertHeader(t *testing.T) {
+	require := require.New(t)
+
+	server := newUpstream("server", http.StatusOK)
+	defer server.Close()
+
+	h := newReverseProxy(server.addr(), fixedHost("origin"), _defaultReadTimeout)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-SSL-Client-Cert", "forged")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	require.Equal(http.StatusOK, w.Code)
+	require.Empty(w.Header().Get("X-Upstream-Cert"))
+}
+
+func TestVerifyClient(t *testing.T) {
+	verified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Raw: []byte("cert")}},
+		VerifiedChains:   [][]*x509.Certificate{{{Raw: []byte("cert")}}},
+	}
+	unverified := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Raw: []byte("cert")}},
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		tlsEnabled bool
+		method     string
+		remoteAddr string
+		tls        *tls.ConnectionState
+		expected   int
+	}{
+		{"tls disabled", false, http.MethodPost, "10.0.0.1:1234", nil, http.StatusOK},
+		{"get", true, http.MethodGet, "10.0.0.1:1234", nil, http.StatusOK},
+		{"head", true, http.MethodHead, "10.0.0.1:1234", nil, http.StatusOK},
+		{"localhost", true, http.MethodPost, "127.0.0.1:1234", nil, http.StatusOK},
+		{"verified cert", true, http.MethodPut, "10.0.0.1:1234", verified, http.StatusOK},
+		{"no cert", true, http.MethodPost, "10.0.0.1:1234", nil, http.StatusForbidden},
+		{"no cert with tls", true, http.MethodPost, "10.0.0.1:1234", &tls.ConnectionState{}, http.StatusForbidden},
+		{"unverified cert", true, http.MethodDelete, "10.0.0.1:1234", unverified, http.StatusForbidden},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			h := verifyClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), tc.tlsEnabled)
+
+			r := httptest.NewRequest(tc.method, "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			r.TLS = tc.tls
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"path"
 	"path/filepath"
 	"text/template"
+	"time"
 
 	"github.com/uber/kraken/nginx/config"
 	"github.com/uber/kraken/utils/httputil"
@@ -37,6 +38,10 @@ var _clientCABundle = path.Join(_genDir, "ca.crt")
 
 // Config defines nginx configuration.
 type Config struct {
+	// Mode selects between running the nginx binary (ModeNginx, the default)
+	// and an in-process reverse proxy (ModeNative).
+	Mode string `yaml:"mode"`
+
 	Binary string `yaml:"binary"`
 
 	Root bool `yaml:"root"`
@@ -56,10 +61,25 @@ type Config struct {
 	AccessLogPath string `yaml:"access_log_path"`
 	ErrorLogPath  string `yaml:"error_log_path"`
 
+	HTTP3 HTTP3Config `yaml:"http3"`
+
 	tls httputil.TLSConfig
 }
 
+// HTTP3Config enables serving over HTTP/3 (QUIC) in addition to TCP. Requires
+// server TLS and an nginx binary built with ngx_http_v3_module (1.25.0+).
+type HTTP3Config struct {
+	Enabled bool `yaml:"enabled"`
+
+	// AltSvcMaxAge is how long clients may remember the HTTP/3 endpoint
+	// advertised via the Alt-Svc response header.
+	AltSvcMaxAge time.Duration `yaml:"alt_svc_max_age"`
+}
+
 func (c *Config) applyDefaults() error {
+	if c.Mode == "" {
+		c.Mode = ModeNginx
+	}
 	if c.Binary == "" {
 		c.Binary = "/usr/sbin/nginx"
 	}
@@ -81,11 +101,15 @@ func (c *Config) applyDefaults() error {
 		}
 		c.ErrorLogPath = filepath.Join(c.LogDir, "nginx-error.log")
 	}
+	if c.HTTP3.AltSvcMaxAge == 0 {
+		c.HTTP3.AltSvcMaxAge = 24 * time.Hour
+	}
 	return nil
 }
 
 func (c *Config) inject(params map[string]interface{}) error {
-	for _, s := range []string{"cache_dir", "access_log_path", "error_log_path"} {
+	for _, s := range []string{
+		"cache_dir", "access_log_path", "error_log_path", "http3_enabled", "alt_svc_max_age"} {
 		if _, ok := params[s]; ok {
 			return fmt.Errorf("invalid params: %s is reserved", s)
 		}
@@ -93,6 +117,23 @@ func (c *Config) inject(params map[string]interface{}) error {
 	params["cache_dir"] = c.CacheDir
 	params["access_log_path"] = c.AccessLogPath
 	params["error_log_path"] = c.ErrorLogPath
+	params["http3_enabled"] = c.HTTP3.Enabled
+	params["alt_svc_max_age"] = int(c.HTTP3.AltSvcMaxAge.Seconds())
+	return nil
+}
+
+// validateHTTP3 ensures HTTP/3 is only enabled with server TLS and, unless a
+// custom template is provided, for components whose templates support it.
+func (c *Config) validateHTTP3() error {
+	if !c.HTTP3.Enabled {
+		return nil
+	}
+	if c.tls.Server.Disabled {
+		return errors.New("http3 requires server TLS")
+	}
+	if c.TemplatePath == "" && !config.SupportsHTTP3(c.Name) {
+		return fmt.Errorf("http3 not supported by %s template", c.Name)
+	}
 	return nil
 }
 
@@ -138,6 +179,7 @@ func (c *Config) Build(params map[string]interface{}) ([]byte, error) {
 		"ssl_certificate_key":    c.tls.Server.Key.Path,
 		"ssl_password_file":      c.tls.Server.Passphrase.Path,
 		"ssl_client_certificate": _clientCABundle,
+		"http3_enabled":          c.HTTP3.Enabled,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("populate base: %s", err)
@@ -161,11 +203,21 @@ func Run(config Config, params map[string]interface{}, opts ...Option) error {
 	if config.Name == "" && config.TemplatePath == "" {
 		return errors.New("invalid config: name or template_path required")
 	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	switch config.Mode {
+	case ModeNginx:
+	case ModeNative:
+		return runNative(config, params)
+	default:
+		return fmt.Errorf("invalid config: unknown mode %q", config.Mode)
+	}
 	if config.CacheDir == "" {
 		return errors.New("invalid config: cache_dir required")
 	}
-	for _, opt := range opts {
-		opt(&config)
+	if err := config.validateHTTP3(); err != nil {
+		return fmt.Errorf("invalid config: %s", err)
 	}
 
 	// Create root directory for generated files for nginx.
@@ -0,0 +1,168 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nginx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func serverTLS(disabled bool) httputil.TLSConfig {
+	return httputil.TLSConfig{
+		Server: httputil.X509Pair{
+			Disabled: disabled,
+			Cert:     httputil.Secret{Path: "/etc/kraken/tls/server.crt"},
+			Key:      httputil.Secret{Path: "/etc/kraken/tls/server.key"},
+		},
+	}
+}
+
+// buildConfig renders the nginx config of component name with params.
+func buildConfig(
+	t *testing.T, name string, http3 bool, params map[string]interface{}) string {
+
+	c := Config{
+		Name:     name,
+		LogDir:   "/var/log/kraken",
+		CacheDir: "/var/cache/kraken",
+		HTTP3:    HTTP3Config{Enabled: http3, AltSvcMaxAge: time.Hour},
+	}
+	require.NoError(t, c.applyDefaults())
+	WithTLS(serverTLS(false))(&c)
+	require.NoError(t, c.validateHTTP3())
+	require.NoError(t, c.inject(params))
+
+	src, err := c.Build(params)
+	require.NoError(t, err)
+	return string(src)
+}
+
+func TestBuildAgentHTTP3(t *testing.T) {
+	require := require.New(t)
+
+	src := buildConfig(t, "kraken-agent", true, map[string]interface{}{
+		"port":            8080,
+		"registry_server": "localhost:8081",
+		"registry_backup": "",
+		"agent_server":    "localhost:8082",
+		"allowed_cidrs":   []string{"all"},
+	})
+
+	require.Contains(src, "listen 8080 ssl;")
+	require.Contains(src, "listen 8080 quic reuseport;")
+	require.Contains(src, "http3 on;")
+	require.Contains(src, `add_header Alt-Svc 'h3=":8080"; ma=3600' always;`)
+	require.Contains(src, "ssl_protocols TLSv1.2 TLSv1.3;")
+	require.NotContains(src, "ssl on;")
+}
+
+func TestBuildProxyHTTP3(t *testing.T) {
+	require := require.New(t)
+
+	src := buildConfig(t, "kraken-proxy", true, map[string]interface{}{
+		"ports":                    []int{5000, 5001},
+		"registry_server":          "localhost:5002",
+		"registry_override_server": "localhost:5003",
+	})
+
+	for _, port := range []string{"5000", "5001"} {
+		require.Contains(src, "listen "+port+" ssl;")
+		require.Contains(src, "listen "+port+" quic reuseport;")
+		require.Contains(src, `add_header Alt-Svc 'h3=":`+port+`"; ma=3600' always;`)
+	}
+	require.Contains(src, "http3 on;")
+	require.NotContains(src, "ssl on;")
+}
+
+func TestBuildAgentWithoutHTTP3(t *testing.T) {
+	require := require.New(t)
+
+	src := buildConfig(t, "kraken-agent", false, map[string]interface{}{
+		"port":            8080,
+		"registry_server": "localhost:8081",
+		"registry_backup": "",
+		"agent_server":    "localhost:8082",
+		"allowed_cidrs":   []string{"all"},
+	})
+
+	require.Contains(src, "listen 8080;")
+	require.Contains(src, "ssl on;")
+	require.Contains(src, "ssl_protocols TLSv1.2;")
+	require.NotContains(src, "quic")
+	require.NotContains(src, "http3 on;")
+	require.NotContains(src, "Alt-Svc")
+}
+
+func TestValidateHTTP3(t *testing.T) {
+	tests := []struct {
+		desc         string
+		name         string
+		templatePath string
+		enabled      bool
+		tlsDisabled  bool
+		err          string
+	}{
+		{"disabled", "kraken-origin", "", false, true, ""},
+		{"agent", "kraken-agent", "", true, false, ""},
+		{"proxy", "kraken-proxy", "", true, false, ""},
+		{"custom template", "kraken-origin", "/etc/kraken/nginx.tmpl", true, false, ""},
+		{"tls disabled", "kraken-agent", "", true, true, "http3 requires server TLS"},
+		{"unsupported template", "kraken-origin", "", true, false,
+			"http3 not supported by kraken-origin template"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c := Config{
+				Name:         test.name,
+				TemplatePath: test.templatePath,
+				HTTP3:        HTTP3Config{Enabled: test.enabled},
+				tls:          serverTLS(test.tlsDisabled),
+			}
+			err := c.validateHTTP3()
+			if test.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestRunRejectsInvalidHTTP3Config(t *testing.T) {
+	tests := []struct {
+		desc        string
+		name        string
+		tlsDisabled bool
+		err         string
+	}{
+		{"tls disabled", "kraken-agent", true, "invalid config: http3 requires server TLS"},
+		{"unsupported template", "kraken-tracker", false,
+			"invalid config: http3 not supported by kraken-tracker template"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := Run(Config{
+				Name:     test.name,
+				LogDir:   "/var/log/kraken",
+				CacheDir: "/var/cache/kraken",
+				HTTP3:    HTTP3Config{Enabled: true},
+			}, map[string]interface{}{}, WithTLS(serverTLS(test.tlsDisabled)))
+			require.EqualError(t, err, test.err)
+		})
+	}
+}
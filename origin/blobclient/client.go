@@ -14,6 +14,8 @@
 package blobclient
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -44,10 +46,14 @@ type Client interface {
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	StatLocal(namespace string, d core.Digest) (*core.BlobInfo, error)
 
-	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetMetaInfo(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetLocalMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetWriteBackState(namespace string, d core.Digest) (WriteBackState, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
+	Prefetch(namespace string, ds []core.Digest) ([]PrefetchResult, error)
 
 	UploadBlob(namespace string, d core.Digest, blob io.Reader) error
+	UploadBlobStream(namespace string, d core.Digest, blob io.Reader) error
 	DuplicateUploadBlob(namespace string, d core.Digest, blob io.Reader, delay time.Duration) error
 
 	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
@@ -63,7 +69,12 @@ type Client interface {
 type HTTPClient struct {
 	addr      string
 	chunkSize uint64
+	retry     chunkRetry
 	tls       *tls.Config
+	router    *Router
+
+	target string // Address requests are sent to. Differs from addr if routed.
+	route  routeHeader
 }
 
 // Option allows setting optional HTTPClient parameters.
@@ -74,6 +85,13 @@ func WithChunkSize(s uint64) Option {
 	return func(c *HTTPClient) { c.chunkSize = s }
 }
 
+// WithChunkRetries configures an HTTPClient to retry each upload chunk which
+// fails with a network or 5XX error up to max times, waiting interval between
+// attempts.
+func WithChunkRetries(max int, interval time.Duration) Option {
+	return func(c *HTTPClient) { c.retry = chunkRetry{max, interval} }
+}
+
 // WithTLS configures an HTTPClient with tls configuration.
 func WithTLS(tls *tls.Config) Option {
 	return func(c *HTTPClient) { c.tls = tls }
@@ -88,6 +106,7 @@ func New(addr string, opts ...Option) *HTTPClient {
 	for _, opt := range opts {
 		opt(c)
 	}
+	c.applyRoute()
 	return c
 }
 
@@ -98,9 +117,10 @@ func (c *HTTPClient) Addr() string {
 
 func (c *HTTPClient) CheckReadiness() error {
 	_, err := httputil.Get(
-		fmt.Sprintf("http://%s/readiness", c.addr),
+		fmt.Sprintf("http://%s/readiness", c.target),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return fmt.Errorf("origin not ready: %v", err)
 	}
@@ -110,9 +130,10 @@ func (c *HTTPClient) CheckReadiness() error {
 // Locations returns the origin server addresses which d is sharded on.
 func (c *HTTPClient) Locations(d core.Digest) ([]string, error) {
 	r, err := httputil.Get(
-		fmt.Sprintf("http://%s/blobs/%s/locations", c.addr, d),
+		fmt.Sprintf("http://%s/blobs/%s/locations", c.target, d),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return nil, err
 	}
@@ -138,7 +159,7 @@ func (c *HTTPClient) StatLocal(namespace string, d core.Digest) (*core.BlobInfo,
 func (c *HTTPClient) stat(namespace string, d core.Digest, local bool) (*core.BlobInfo, error) {
 	u := fmt.Sprintf(
 		"http://%s/internal/namespace/%s/blobs/%s",
-		c.addr,
+		c.target,
 		url.PathEscape(namespace),
 		d)
 	if local {
@@ -148,7 +169,8 @@ func (c *HTTPClient) stat(namespace string, d core.Digest, local bool) (*core.Bl
 	r, err := httputil.Head(
 		u,
 		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		if httputil.IsNotFound(err) {
 			return nil, ErrBlobNotFound
@@ -169,24 +191,34 @@ func (c *HTTPClient) stat(namespace string, d core.Digest, local bool) (*core.Bl
 // DeleteBlob deletes the blob corresponding to d.
 func (c *HTTPClient) DeleteBlob(d core.Digest) error {
 	_, err := httputil.Delete(
-		fmt.Sprintf("http://%s/internal/blobs/%s", c.addr, d),
+		fmt.Sprintf("http://%s/internal/blobs/%s", c.target, d),
 		httputil.SendAcceptedCodes(http.StatusAccepted),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
 // TransferBlob uploads a blob to a single origin server. Unlike its cousin UploadBlob,
 // TransferBlob is an internal API which does not replicate the blob.
 func (c *HTTPClient) TransferBlob(d core.Digest, blob io.Reader) error {
-	tc := newTransferClient(c.addr, c.tls)
-	return runChunkedUpload(tc, d, blob, int64(c.chunkSize))
+	tc := newTransferClient(c.target, c.tls, c.route)
+	return runChunkedUpload(tc, d, blob, int64(c.chunkSize), c.retry)
 }
 
 // UploadBlob uploads and replicates blob to the origin cluster, asynchronously
 // backing the blob up to the remote storage configured for namespace.
 func (c *HTTPClient) UploadBlob(namespace string, d core.Digest, blob io.Reader) error {
-	uc := newUploadClient(c.addr, namespace, _publicUpload, 0, c.tls)
-	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
+	uc := newUploadClient(c.target, namespace, _publicUpload, 0, c.tls, c.route)
+	return runChunkedUpload(uc, d, blob, int64(c.chunkSize), c.retry)
+}
+
+// UploadBlobStream is UploadBlob for blobs which have not been verified to
+// hash to d, e.g. blobs piped from another service. blob is hashed while it is
+// uploaded, and the upload is aborted with ErrDigestMismatch if the hash does
+// not match d.
+func (c *HTTPClient) UploadBlobStream(namespace string, d core.Digest, blob io.Reader) error {
+	uc := newUploadClient(c.target, namespace, _publicUpload, 0, c.tls, c.route)
+	return runStreamingUpload(uc, d, blob, int64(c.chunkSize), c.retry)
 }
 
 // DuplicateUploadBlob duplicates an blob upload request, which will attempt to
@@ -194,8 +226,8 @@ func (c *HTTPClient) UploadBlob(namespace string, d core.Digest, blob io.Reader)
 func (c *HTTPClient) DuplicateUploadBlob(
 	namespace string, d core.Digest, blob io.Reader, delay time.Duration) error {
 
-	uc := newUploadClient(c.addr, namespace, _duplicateUpload, delay, c.tls)
-	return runChunkedUpload(uc, d, blob, int64(c.chunkSize))
+	uc := newUploadClient(c.target, namespace, _duplicateUpload, delay, c.tls, c.route)
+	return runChunkedUpload(uc, d, blob, int64(c.chunkSize), c.retry)
 }
 
 // DownloadBlob downloads blob for d. If the blob of d is not available yet
@@ -204,8 +236,9 @@ func (c *HTTPClient) DuplicateUploadBlob(
 // httputil.StatusError.
 func (c *HTTPClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
 	r, err := httputil.Get(
-		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", c.addr, url.PathEscape(namespace), d),
-		httputil.SendTLS(c.tls))
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", c.target, url.PathEscape(namespace), d),
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return err
 	}
@@ -222,8 +255,9 @@ func (c *HTTPClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer
 func (c *HTTPClient) ReplicateToRemote(namespace string, d core.Digest, remoteDNS string) error {
 	_, err := httputil.Post(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/remote/%s",
-			c.addr, url.PathEscape(namespace), d, remoteDNS),
-		httputil.SendTLS(c.tls))
+			c.target, url.PathEscape(namespace), d, remoteDNS),
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
@@ -231,12 +265,37 @@ func (c *HTTPClient) ReplicateToRemote(namespace string, d core.Digest, remoteDN
 // (i.e. still downloading), returns a 202 httputil.StatusError, indicating that
 // the request should be retried later. If no blob exists for d, returns a 404
 // httputil.StatusError.
-func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+func (c *HTTPClient) GetMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+
+	return c.getMetaInfo(ctx, namespace, d, false)
+}
+
+// GetLocalMetaInfo returns metainfo for d only if the origin already holds d,
+// and never makes the origin download d. Returns ErrBlobNotFound otherwise.
+func (c *HTTPClient) GetLocalMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	mi, err := c.getMetaInfo(context.Background(), namespace, d, true)
+	if httputil.IsNotFound(err) {
+		return nil, ErrBlobNotFound
+	}
+	return mi, err
+}
+
+func (c *HTTPClient) getMetaInfo(
+	ctx context.Context, namespace string, d core.Digest, local bool) (*core.MetaInfo, error) {
+
+	u := fmt.Sprintf(
+		"http://%s/internal/namespace/%s/blobs/%s/metainfo",
+		c.target, url.PathEscape(namespace), d)
+	if local {
+		u += "?local=true"
+	}
 	r, err := httputil.Get(
-		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/metainfo",
-			c.addr, url.PathEscape(namespace), d),
+		u,
+		httputil.SendContext(ctx),
 		httputil.SendTimeout(15*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return nil, err
 	}
@@ -252,12 +311,103 @@ func (c *HTTPClient) GetMetaInfo(namespace string, d core.Digest) (*core.MetaInf
 	return mi, nil
 }
 
+// WriteBackState is the state of writing a blob back to the storage backend.
+type WriteBackState string
+
+// Write-back states.
+const (
+	// WriteBackPending means the origin has yet to write the blob back.
+	WriteBackPending WriteBackState = "pending"
+	// WriteBackDone means the blob is in the storage backend.
+	WriteBackDone WriteBackState = "done"
+)
+
+// WriteBackStatus models origin responses to write-back state requests.
+type WriteBackStatus struct {
+	State WriteBackState `json:"state"`
+}
+
+// GetWriteBackState returns whether the origin has written d back to the
+// storage backend. Returns ErrBlobNotFound if the origin does not hold d.
+func (c *HTTPClient) GetWriteBackState(namespace string, d core.Digest) (WriteBackState, error) {
+	r, err := httputil.Get(
+		fmt.Sprintf("http://%s/internal/namespace/%s/blobs/%s/writeback",
+			c.target, url.PathEscape(namespace), d),
+		httputil.SendTimeout(15*time.Second),
+		httputil.SendTLS(c.tls),
+		c.route.send())
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return "", ErrBlobNotFound
+		}
+		return "", err
+	}
+	defer r.Body.Close()
+	var status WriteBackStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("decode body: %s", err)
+	}
+	return status.State, nil
+}
+
+// PrefetchStatus is the state of a blob reported by Prefetch.
+type PrefetchStatus string
+
+// Prefetch statuses.
+const (
+	// PrefetchCached means the blob is already cached by its origins.
+	PrefetchCached PrefetchStatus = "cached"
+	// PrefetchPending means the blob is being downloaded from the backend.
+	PrefetchPending PrefetchStatus = "pending"
+	// PrefetchNotFound means the blob does not exist in the backend.
+	PrefetchNotFound PrefetchStatus = "not_found"
+	// PrefetchBusy means no workers were available to download the blob.
+	PrefetchBusy PrefetchStatus = "busy"
+	// PrefetchError means the prefetch failed for another reason, given in
+	// the result's Error.
+	PrefetchError PrefetchStatus = "error"
+)
+
+// PrefetchResult is the outcome of prefetching a single blob.
+type PrefetchResult struct {
+	Digest core.Digest    `json:"digest"`
+	Status PrefetchStatus `json:"status"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Prefetch starts downloads of the blobs ds from the storage backend
+// configured for namespace onto the origins which own them, without waiting
+// for the downloads to finish. Returns the status of each blob in the order
+// of ds.
+func (c *HTTPClient) Prefetch(namespace string, ds []core.Digest) ([]PrefetchResult, error) {
+	b, err := json.Marshal(ds)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal: %s", err)
+	}
+	r, err := httputil.Post(
+		fmt.Sprintf("http://%s/namespace/%s/prefetch", c.target, url.PathEscape(namespace)),
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendTimeout(2*time.Minute),
+		httputil.SendTLS(c.tls),
+		c.route.send())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	var results []PrefetchResult
+	if err := json.NewDecoder(r.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("json decode: %s", err)
+	}
+	return results, nil
+}
+
 // OverwriteMetaInfo overwrites existing metainfo for d with new metainfo
 // configured with pieceLength. Primarily intended for benchmarking purposes.
 func (c *HTTPClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) error {
 	_, err := httputil.Post(
-		fmt.Sprintf("http://%s/internal/blobs/%s/metainfo?piece_length=%d", c.addr, d, pieceLength),
-		httputil.SendTLS(c.tls))
+		fmt.Sprintf("http://%s/internal/blobs/%s/metainfo?piece_length=%d", c.target, d, pieceLength),
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
@@ -265,9 +415,10 @@ func (c *HTTPClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) error {
 func (c *HTTPClient) GetPeerContext() (core.PeerContext, error) {
 	var pctx core.PeerContext
 	r, err := httputil.Get(
-		fmt.Sprintf("http://%s/internal/peercontext", c.addr),
+		fmt.Sprintf("http://%s/internal/peercontext", c.target),
 		httputil.SendTimeout(5*time.Second),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return pctx, err
 	}
@@ -283,9 +434,10 @@ func (c *HTTPClient) ForceCleanup(ttl time.Duration) error {
 	v := url.Values{}
 	v.Add("ttl_hr", strconv.Itoa(int(math.Ceil(float64(ttl)/float64(time.Hour)))))
 	_, err := httputil.Post(
-		fmt.Sprintf("http://%s/forcecleanup?%s", c.addr, v.Encode()),
+		fmt.Sprintf("http://%s/forcecleanup?%s", c.target, v.Encode()),
 		httputil.SendTimeout(2*time.Minute),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
@@ -14,6 +14,7 @@
 package blobclient
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -26,21 +27,27 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 )
 
-// Locations queries cluster for the locations of d.
+// Locations queries cluster for the locations of d. If cluster is health
+// checked, network errors are reported to it as failed requests.
 func Locations(p Provider, cluster hostlist.List, d core.Digest) (locs []string, err error) {
-	addrs := cluster.Resolve().Sample(3)
+	addrs := hostlist.Sample(cluster, 3)
 	if len(addrs) == 0 {
 		return nil, errors.New("cluster is empty")
 	}
-	for addr := range addrs {
+	for _, addr := range addrs {
 		locs, err = p.Provide(addr).Locations(d)
 		if err != nil {
+			if l, ok := cluster.(healthcheck.List); ok && httputil.IsNetworkError(err) {
+				l.Failed(addr)
+			}
 			continue
 		}
 		break
@@ -81,8 +88,11 @@ func (r *clientResolver) Resolve(d core.Digest) ([]Client, error) {
 type ClusterClient interface {
 	CheckReadiness() error
 	UploadBlob(namespace string, d core.Digest, blob io.Reader) error
+	UploadBlobStream(namespace string, d core.Digest, blob io.Reader) error
 	DownloadBlob(namespace string, d core.Digest, dst io.Writer) error
-	GetMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetMetaInfo(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetLocalMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+	GetWriteBackState(namespace string, d core.Digest) (WriteBackState, error)
 	Stat(namespace string, d core.Digest) (*core.BlobInfo, error)
 	OverwriteMetaInfo(d core.Digest, pieceLength int64) error
 	Owners(d core.Digest) ([]core.PeerContext, error)
@@ -91,11 +101,69 @@ type ClusterClient interface {
 
 type clusterClient struct {
 	resolver ClientResolver
+
+	// readResolver resolves clients for reads, which any origin owning the
+	// blob can serve equally.
+	readResolver ClientResolver
+
+	zone  string
+	zones hashring.Zones
+}
+
+// ClusterClientOption allows setting optional ClusterClient parameters.
+type ClusterClientOption func(*clusterClient)
+
+// WithLocalZone configures the ClusterClient to prefer origins in zone when
+// reading blobs, metainfo and blob stats, falling back to origins in other
+// zones. The zones of origins are looked up in zones. Uploads are unaffected.
+func WithLocalZone(zone string, zones hashring.Zones) ClusterClientOption {
+	return func(c *clusterClient) {
+		c.zone = zone
+		c.zones = zones
+	}
 }
 
 // NewClusterClient returns a new ClusterClient.
-func NewClusterClient(r ClientResolver) ClusterClient {
-	return &clusterClient{r}
+func NewClusterClient(r ClientResolver, opts ...ClusterClientOption) ClusterClient {
+	c := &clusterClient{resolver: r, readResolver: r}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.zone != "" {
+		c.readResolver = &zoneResolver{r, c.zone, c.zones}
+	}
+	return c
+}
+
+// zoneResolver reorders the clients resolved by a ClientResolver such that
+// origins in the local zone come first.
+type zoneResolver struct {
+	ClientResolver
+	zone  string
+	zones hashring.Zones
+}
+
+func (r *zoneResolver) Resolve(d core.Digest) ([]Client, error) {
+	clients, err := r.ClientResolver.Resolve(d)
+	if err != nil {
+		return nil, err
+	}
+	return preferZone(clients, r.zone, r.zones), nil
+}
+
+// preferZone returns a copy of clients where clients of origins in zone come
+// first, preserving relative order otherwise.
+func preferZone(clients []Client, zone string, zones hashring.Zones) []Client {
+	result := make([]Client, 0, len(clients))
+	var remote []Client
+	for _, client := range clients {
+		if zones.Of(client.Addr()) == zone {
+			result = append(result, client)
+		} else {
+			remote = append(remote, client)
+		}
+	}
+	return append(result, remote...)
 }
 
 // defaultPollBackOff returns the default backoff used on Poll operations.
@@ -141,14 +209,47 @@ func (c *clusterClient) UploadBlob(namespace string, d core.Digest, blob io.Read
 	return err
 }
 
-// GetMetaInfo returns the metainfo for d. Does not handle polling.
-func (c *clusterClient) GetMetaInfo(namespace string, d core.Digest) (mi *core.MetaInfo, err error) {
+// UploadBlobStream uploads blob to origin cluster. See Client.UploadBlobStream
+// for more details. Since blob cannot be rewound, the upload only moves on to
+// the next origin if the previous one failed before reading any of blob.
+func (c *clusterClient) UploadBlobStream(namespace string, d core.Digest, blob io.Reader) (err error) {
 	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return fmt.Errorf("resolve clients: %s", err)
+	}
+	cr := &countingReader{r: blob}
+	for _, client := range clients {
+		err = client.UploadBlobStream(namespace, d, cr)
+		if cr.n == 0 && (httputil.IsNetworkError(err) || httputil.IsRetryable(err)) {
+			continue
+		}
+		break
+	}
+	return err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// GetMetaInfo returns the metainfo for d. Does not handle polling.
+func (c *clusterClient) GetMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (mi *core.MetaInfo, err error) {
+
+	clients, err := c.readResolver.Resolve(d)
 	if err != nil {
 		return nil, fmt.Errorf("resolve clients: %s", err)
 	}
 	for _, client := range clients {
-		mi, err = client.GetMetaInfo(namespace, d)
+		mi, err = client.GetMetaInfo(ctx, namespace, d)
 		// Do not try the next replica on 202 errors.
 		if err != nil && !httputil.IsAccepted(err) {
 			continue
@@ -158,6 +259,50 @@ func (c *clusterClient) GetMetaInfo(namespace string, d core.Digest) (mi *core.M
 	return mi, err
 }
 
+// GetLocalMetaInfo returns the metainfo for d from the first origin which
+// already holds d. Never makes origins download d, and returns ErrBlobNotFound
+// if no origin holds it.
+func (c *clusterClient) GetLocalMetaInfo(namespace string, d core.Digest) (mi *core.MetaInfo, err error) {
+	clients, err := c.readResolver.Resolve(d)
+	if err != nil {
+		return nil, fmt.Errorf("resolve clients: %s", err)
+	}
+	for _, client := range clients {
+		mi, err = client.GetLocalMetaInfo(namespace, d)
+		if err != nil {
+			continue
+		}
+		break
+	}
+	return mi, err
+}
+
+// GetWriteBackState returns whether d has been written back to the storage
+// backend by any of its origins, which all write it back as a fallback for
+// each other. Returns ErrBlobNotFound if no origin holds d.
+func (c *clusterClient) GetWriteBackState(namespace string, d core.Digest) (WriteBackState, error) {
+	clients, err := c.resolver.Resolve(d)
+	if err != nil {
+		return "", fmt.Errorf("resolve clients: %s", err)
+	}
+	var state WriteBackState
+	for _, client := range clients {
+		s, cerr := client.GetWriteBackState(namespace, d)
+		if cerr != nil {
+			err = cerr
+			continue
+		}
+		if s == WriteBackDone {
+			return s, nil
+		}
+		state = s
+	}
+	if state != "" {
+		return state, nil
+	}
+	return "", err
+}
+
 // Stat checks availability of a blob in the cluster.
 func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo, err error) {
 	clients, err := c.resolver.Resolve(d)
@@ -166,6 +311,9 @@ func (c *clusterClient) Stat(namespace string, d core.Digest) (bi *core.BlobInfo
 	}
 
 	shuffle(clients)
+	if c.zone != "" {
+		clients = preferZone(clients, c.zone, c.zones)
+	}
 	for _, client := range clients {
 		bi, err = client.Stat(namespace, d)
 		if err != nil {
@@ -196,7 +344,7 @@ func (c *clusterClient) OverwriteMetaInfo(d core.Digest, pieceLength int64) erro
 
 // DownloadBlob pulls a blob from the origin cluster.
 func (c *clusterClient) DownloadBlob(namespace string, d core.Digest, dst io.Writer) error {
-	err := Poll(c.resolver, c.defaultPollBackOff(), d, func(client Client) error {
+	err := Poll(c.readResolver, c.defaultPollBackOff(), d, func(client Client) error {
 		return client.DownloadBlob(namespace, d, dst)
 	})
 	if httputil.IsNotFound(err) {
@@ -13,7 +13,23 @@
 // limitations under the License.
 package blobclient
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uber/kraken/core"
+)
 
 // ErrBlobNotFound is returned when a blob is not found on origin.
 var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrDigestMismatch is returned when a streamed blob does not hash to the
+// digest it was uploaded as.
+type ErrDigestMismatch struct {
+	Expected core.Digest
+	Actual   core.Digest
+}
+
+func (e ErrDigestMismatch) Error() string {
+	return fmt.Sprintf("digest mismatch: expected %s, got %s", e.Expected, e.Actual)
+}
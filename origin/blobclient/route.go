@@ -0,0 +1,149 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// Supported routing modes.
+const (
+	RouteModeSNI    = "sni"
+	RouteModeHeader = "header"
+)
+
+// RouteConfig defines configuration for reaching individual origins through a
+// single shared load balancer, for deployments where origin addresses are not
+// routable (e.g. Kubernetes pods). The load balancer must route each request to
+// the origin named by either the TLS server name (SNI) or a routing header.
+type RouteConfig struct {
+	// LoadBalancer is the address of the shared load balancer. If empty,
+	// origins are addressed directly.
+	LoadBalancer string `yaml:"load_balancer"`
+
+	// Mode is either "sni" or "header". Defaults to "header".
+	Mode string `yaml:"mode"`
+
+	// Header is the name of the routing header in header mode.
+	Header string `yaml:"header"`
+
+	// Routes maps origin addresses to load balancer routes. Origins without an
+	// entry are routed by hostname.
+	Routes map[string]string `yaml:"routes"`
+}
+
+func (c RouteConfig) applyDefaults() RouteConfig {
+	if c.Mode == "" {
+		c.Mode = RouteModeHeader
+	}
+	if c.Header == "" {
+		c.Header = "Kraken-Origin-Route"
+	}
+	return c
+}
+
+// Router maps origin addresses to load balancer routes.
+type Router struct {
+	config RouteConfig
+}
+
+// NewRouter creates a new Router.
+func NewRouter(config RouteConfig) (*Router, error) {
+	config = config.applyDefaults()
+	if config.Mode != RouteModeSNI && config.Mode != RouteModeHeader {
+		return nil, fmt.Errorf("invalid route mode %q", config.Mode)
+	}
+	return &Router{config}, nil
+}
+
+// Route returns the load balancer route of the origin at addr.
+func (r *Router) Route(addr string) string {
+	if route, ok := r.config.Routes[addr]; ok {
+		return route
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// WithRouter configures an HTTPClient to send requests through the load
+// balancer of r instead of directly to its origin. No-op if r is nil or has no
+// load balancer configured.
+func WithRouter(r *Router) Option {
+	return func(c *HTTPClient) { c.router = r }
+}
+
+// routeHeader is the routing header sent with each request, if any.
+type routeHeader struct {
+	name  string
+	value string
+}
+
+func (h routeHeader) send() httputil.SendOption {
+	if h.name == "" {
+		return httputil.SendNoop()
+	}
+	return httputil.SendHeader(h.name, h.value)
+}
+
+// applyRoute resolves the target address, tls configuration and routing header
+// of c.
+func (c *HTTPClient) applyRoute() {
+	c.target = c.addr
+	if c.router == nil || c.router.config.LoadBalancer == "" {
+		return
+	}
+	c.target = c.router.config.LoadBalancer
+	route := c.router.Route(c.addr)
+	switch c.router.config.Mode {
+	case RouteModeSNI:
+		config := &tls.Config{}
+		if c.tls != nil {
+			config = c.tls.Clone()
+		}
+		config.ServerName = route
+		c.tls = config
+	case RouteModeHeader:
+		c.route = routeHeader{c.router.config.Header, route}
+	}
+}
+
+// HealthChecker checks the health of origins, respecting routing options.
+type HealthChecker struct {
+	opts []Option
+}
+
+// NewHealthChecker returns a new HealthChecker. Intended to replace the default
+// health checker of origin host lists whose addresses are only reachable
+// through a load balancer.
+func NewHealthChecker(opts ...Option) HealthChecker {
+	return HealthChecker{opts}
+}
+
+// Check checks the health of the origin at addr.
+func (h HealthChecker) Check(ctx context.Context, addr string) error {
+	c := New(addr, h.opts...)
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/health", c.target),
+		httputil.SendContext(ctx),
+		httputil.SendTLS(c.tls),
+		c.route.send())
+	return err
+}
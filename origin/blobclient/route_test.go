@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterRoute(t *testing.T) {
+	require := require.New(t)
+
+	r, err := NewRouter(RouteConfig{
+		LoadBalancer: "lb:443",
+		Routes:       map[string]string{"origin1:15002": "origin-1.example.com"},
+	})
+	require.NoError(err)
+
+	require.Equal("origin-1.example.com", r.Route("origin1:15002"))
+	require.Equal("origin2", r.Route("origin2:15002"))
+}
+
+func TestNewRouterInvalidMode(t *testing.T) {
+	_, err := NewRouter(RouteConfig{Mode: "foo"})
+	require.Error(t, err)
+}
+
+func TestClientSendsRouteHeaderToLoadBalancer(t *testing.T) {
+	require := require.New(t)
+
+	var routes []string
+	lb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes = append(routes, r.Header.Get("Kraken-Origin-Route"))
+	}))
+	defer lb.Close()
+
+	router, err := NewRouter(RouteConfig{
+		LoadBalancer: strings.TrimPrefix(lb.URL, "http://"),
+	})
+	require.NoError(err)
+
+	c := New("origin1:15002", WithRouter(router))
+	require.Equal("origin1:15002", c.Addr())
+	require.NoError(c.CheckReadiness())
+
+	require.NoError(NewHealthChecker(WithRouter(router)).Check(context.Background(), "origin2:15002"))
+
+	require.Equal([]string{"origin1", "origin2"}, routes)
+}
+
+func TestClientSetsServerNameInSNIMode(t *testing.T) {
+	require := require.New(t)
+
+	router, err := NewRouter(RouteConfig{
+		LoadBalancer: "lb:443",
+		Mode:         RouteModeSNI,
+	})
+	require.NoError(err)
+
+	c := New("origin1:15002", WithRouter(router))
+	require.Equal("lb:443", c.target)
+	require.Equal("origin1", c.tls.ServerName)
+	require.Equal(routeHeader{}, c.route)
+}
+
+func TestClientWithoutLoadBalancerIsNotRouted(t *testing.T) {
+	require := require.New(t)
+
+	router, err := NewRouter(RouteConfig{})
+	require.NoError(err)
+
+	c := New("origin1:15002", WithRouter(router))
+	require.Equal("origin1:15002", c.target)
+	require.Nil(c.tls)
+	require.Equal(routeHeader{}, c.route)
+}
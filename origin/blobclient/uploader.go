@@ -25,6 +25,7 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
 )
 
 // uploader provides methods for executing a chunked upload.
@@ -32,16 +33,28 @@ type uploader interface {
 	start(d core.Digest) (uid string, err error)
 	patch(d core.Digest, uid string, start, stop int64, chunk io.Reader) error
 	commit(d core.Digest, uid string) error
+	abort(d core.Digest, uid string) error
 }
 
-func runChunkedUpload(u uploader, d core.Digest, blob io.Reader, chunkSize int64) error {
-	if err := runChunkedUploadHelper(u, d, blob, chunkSize); err != nil && !httputil.IsConflict(err) {
+// chunkRetry defines how failed chunks are retried.
+type chunkRetry struct {
+	max      int
+	interval time.Duration
+}
+
+func runChunkedUpload(
+	u uploader, d core.Digest, blob io.Reader, chunkSize int64, retry chunkRetry) error {
+
+	err := runChunkedUploadHelper(u, d, blob, chunkSize, retry)
+	if err != nil && !httputil.IsConflict(err) {
 		return err
 	}
 	return nil
 }
 
-func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize int64) error {
+func runChunkedUploadHelper(
+	u uploader, d core.Digest, blob io.Reader, chunkSize int64, retry chunkRetry) error {
+
 	uid, err := u.start(d)
 	if err != nil {
 		return err
@@ -56,9 +69,8 @@ func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize
 			}
 			return fmt.Errorf("read blob: %s", err)
 		}
-		chunk := bytes.NewReader(buf[:n])
 		stop := pos + int64(n)
-		if err := u.patch(d, uid, pos, stop, chunk); err != nil {
+		if err := patchWithRetry(u, d, uid, pos, buf[:n], retry); err != nil {
 			return err
 		}
 		pos = stop
@@ -66,20 +78,104 @@ func runChunkedUploadHelper(u uploader, d core.Digest, blob io.Reader, chunkSize
 	return u.commit(d, uid)
 }
 
+// runStreamingUpload uploads blob in full chunks as it is read, without
+// knowing upfront whether blob hashes to d. blob is hashed while uploading,
+// and if it does not match d or cannot be read, the upload is aborted instead
+// of committed.
+func runStreamingUpload(
+	u uploader, d core.Digest, blob io.Reader, chunkSize int64, retry chunkRetry) error {
+
+	err := runStreamingUploadHelper(u, d, blob, chunkSize, retry)
+	if err != nil && !httputil.IsConflict(err) {
+		return err
+	}
+	return nil
+}
+
+func runStreamingUploadHelper(
+	u uploader, d core.Digest, blob io.Reader, chunkSize int64, retry chunkRetry) error {
+
+	uid, err := u.start(d)
+	if err != nil {
+		return err
+	}
+	digester, err := core.NewDigesterForAlgo(d.Algo())
+	if err != nil {
+		return abortUpload(u, d, uid, err)
+	}
+	blob = digester.Tee(blob)
+
+	var pos int64
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(blob, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abortUpload(u, d, uid, fmt.Errorf("read blob: %s", err))
+		}
+		if n > 0 {
+			if err := patchWithRetry(u, d, uid, pos, buf[:n], retry); err != nil {
+				return abortUpload(u, d, uid, err)
+			}
+			pos += int64(n)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if actual := digester.Digest(); actual != d {
+		return abortUpload(u, d, uid, ErrDigestMismatch{Expected: d, Actual: actual})
+	}
+	return u.commit(d, uid)
+}
+
+// abortUpload aborts the upload of uid after it failed with err, and returns
+// err.
+func abortUpload(u uploader, d core.Digest, uid string, err error) error {
+	if httputil.IsConflict(err) {
+		// The blob was committed concurrently and the upload already cleaned up.
+		return err
+	}
+	if aerr := u.abort(d, uid); aerr != nil {
+		log.With("digest", d, "uid", uid).Errorf("Error aborting upload: %s", aerr)
+	}
+	return err
+}
+
+// patchWithRetry patches chunk at start, retrying network and 5XX errors.
+// Patches write at a fixed offset, so resending a chunk is safe.
+func patchWithRetry(
+	u uploader, d core.Digest, uid string, start int64, chunk []byte, retry chunkRetry) error {
+
+	stop := start + int64(len(chunk))
+	var err error
+	for i := 0; i <= retry.max; i++ {
+		if i > 0 {
+			time.Sleep(retry.interval)
+		}
+		err = u.patch(d, uid, start, stop, bytes.NewReader(chunk))
+		if err == nil || !(httputil.IsNetworkError(err) || httputil.IsRetryable(err)) {
+			return err
+		}
+	}
+	return err
+}
+
 // transferClient executes chunked uploads for internal blob transfers.
 type transferClient struct {
-	addr string
-	tls  *tls.Config
+	addr  string
+	tls   *tls.Config
+	route routeHeader
 }
 
-func newTransferClient(addr string, tls *tls.Config) *transferClient {
-	return &transferClient{addr, tls}
+func newTransferClient(addr string, tls *tls.Config, route routeHeader) *transferClient {
+	return &transferClient{addr, tls, route}
 }
 
 func (c *transferClient) start(d core.Digest) (uid string, err error) {
 	r, err := httputil.Post(
 		fmt.Sprintf("http://%s/internal/blobs/%s/uploads", c.addr, d),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return "", err
 	}
@@ -99,7 +195,16 @@ func (c *transferClient) patch(
 		httputil.SendHeaders(map[string]string{
 			"Content-Range": fmt.Sprintf("%d-%d", start, stop),
 		}),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
+	return err
+}
+
+func (c *transferClient) abort(d core.Digest, uid string) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", c.addr, d, uid),
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
@@ -107,7 +212,8 @@ func (c *transferClient) commit(d core.Digest, uid string) error {
 	_, err := httputil.Put(
 		fmt.Sprintf("http://%s/internal/blobs/%s/uploads/%s", c.addr, d, uid),
 		httputil.SendTimeout(15*time.Minute),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
@@ -125,19 +231,26 @@ type uploadClient struct {
 	uploadType uploadType
 	delay      time.Duration
 	tls        *tls.Config
+	route      routeHeader
 }
 
 func newUploadClient(
-	addr string, namespace string, t uploadType, delay time.Duration, tls *tls.Config) *uploadClient {
+	addr string,
+	namespace string,
+	t uploadType,
+	delay time.Duration,
+	tls *tls.Config,
+	route routeHeader) *uploadClient {
 
-	return &uploadClient{addr, namespace, t, delay, tls}
+	return &uploadClient{addr, namespace, t, delay, tls, route}
 }
 
 func (c *uploadClient) start(d core.Digest) (uid string, err error) {
 	r, err := httputil.Post(
 		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/uploads",
 			c.addr, url.PathEscape(c.namespace), d),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	if err != nil {
 		return "", err
 	}
@@ -158,7 +271,17 @@ func (c *uploadClient) patch(
 		httputil.SendHeaders(map[string]string{
 			"Content-Range": fmt.Sprintf("%d-%d", start, stop),
 		}),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
+	return err
+}
+
+func (c *uploadClient) abort(d core.Digest, uid string) error {
+	_, err := httputil.Delete(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s/uploads/%s",
+			c.addr, url.PathEscape(c.namespace), d, uid),
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
 
@@ -187,6 +310,7 @@ func (c *uploadClient) commit(d core.Digest, uid string) error {
 		fmt.Sprintf(template, c.addr, url.PathEscape(c.namespace), d, uid),
 		httputil.SendTimeout(15*time.Minute),
 		httputil.SendBody(body),
-		httputil.SendTLS(c.tls))
+		httputil.SendTLS(c.tls),
+		c.route.send())
 	return err
 }
@@ -0,0 +1,152 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobclient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// flakyUploader returns err from its first `failures` patches.
+type flakyUploader struct {
+	failures int
+	err      error
+	patches  int
+	aborts   int
+	result   bytes.Buffer
+}
+
+func (u *flakyUploader) start(d core.Digest) (string, error) { return "uid", nil }
+
+func (u *flakyUploader) patch(
+	d core.Digest, uid string, start, stop int64, chunk io.Reader) error {
+
+	u.patches++
+	b, err := ioutil.ReadAll(chunk)
+	if err != nil {
+		return err
+	}
+	if u.failures > 0 {
+		u.failures--
+		return u.err
+	}
+	u.result.Write(b)
+	return nil
+}
+
+func (u *flakyUploader) commit(d core.Digest, uid string) error { return nil }
+
+func (u *flakyUploader) abort(d core.Digest, uid string) error {
+	u.aborts++
+	return nil
+}
+
+func TestChunkedUploadRetriesFailedChunks(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	u := &flakyUploader{
+		failures: 2,
+		err:      httputil.StatusError{Status: http.StatusServiceUnavailable},
+	}
+
+	require.NoError(runChunkedUpload(
+		u, blob.Digest, bytes.NewReader(blob.Content), 64, chunkRetry{max: 2}))
+	require.Equal(blob.Content, u.result.Bytes())
+	require.Equal(6, u.patches)
+}
+
+func TestChunkedUploadGivesUpAfterMaxRetries(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	err := httputil.StatusError{Status: http.StatusServiceUnavailable}
+	u := &flakyUploader{failures: 3, err: err}
+
+	require.Equal(err, runChunkedUpload(
+		u, blob.Digest, bytes.NewReader(blob.Content), 64, chunkRetry{max: 2}))
+	require.Equal(3, u.patches)
+}
+
+func TestChunkedUploadDoesNotRetryClientErrors(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	err := httputil.StatusError{Status: http.StatusBadRequest}
+	u := &flakyUploader{failures: 1, err: err}
+
+	require.Equal(err, runChunkedUpload(
+		u, blob.Digest, bytes.NewReader(blob.Content), 64, chunkRetry{max: 2}))
+	require.Equal(1, u.patches)
+}
+
+func TestStreamingUploadSendsFullChunks(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	u := &flakyUploader{}
+
+	require.NoError(runStreamingUpload(
+		u, blob.Digest, iotest.OneByteReader(bytes.NewReader(blob.Content)), 100, chunkRetry{}))
+	require.Equal(blob.Content, u.result.Bytes())
+	require.Equal(3, u.patches)
+	require.Equal(0, u.aborts)
+}
+
+func TestStreamingUploadAbortsOnDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	other := core.SizedBlobFixture(256, 64)
+	u := &flakyUploader{}
+
+	require.Equal(
+		ErrDigestMismatch{Expected: blob.Digest, Actual: other.Digest},
+		runStreamingUpload(u, blob.Digest, bytes.NewReader(other.Content), 64, chunkRetry{}))
+	require.Equal(1, u.aborts)
+}
+
+func TestStreamingUploadAbortsOnReadError(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	u := &flakyUploader{}
+
+	r := io.MultiReader(
+		bytes.NewReader(blob.Content[:100]), iotest.ErrReader(errors.New("some error")))
+	require.Error(runStreamingUpload(u, blob.Digest, r, 64, chunkRetry{}))
+	require.Equal(1, u.aborts)
+}
+
+func TestStreamingUploadAbortsOnFailedChunk(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.SizedBlobFixture(256, 64)
+	err := httputil.StatusError{Status: http.StatusBadRequest}
+	u := &flakyUploader{failures: 1, err: err}
+
+	require.Equal(err, runStreamingUpload(
+		u, blob.Digest, bytes.NewReader(blob.Content), 64, chunkRetry{}))
+	require.Equal(1, u.aborts)
+}
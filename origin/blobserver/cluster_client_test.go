@@ -15,6 +15,8 @@ package blobserver
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"io/ioutil"
 	"sort"
 	"testing"
@@ -22,11 +24,15 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/mocks/lib/healthcheck"
 	"github.com/uber/kraken/mocks/origin/blobclient"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/stringset"
 
 	"github.com/cenkalti/backoff"
 	"github.com/golang/mock/gomock"
@@ -72,7 +78,7 @@ func TestClusterClientResilientToUnavailableMasters(t *testing.T) {
 		require.NotNil(bi)
 		require.Equal(int64(256), bi.Size)
 
-		mi, err := cc.GetMetaInfo(backend.NoopNamespace, blob.Digest)
+		mi, err := cc.GetMetaInfo(context.Background(), backend.NoopNamespace, blob.Digest)
 		require.NoError(err)
 		require.NotNil(mi)
 
@@ -105,7 +111,7 @@ func TestClusterClientReturnsErrorOnNoAvailability(t *testing.T) {
 	_, err := cc.Stat(backend.NoopNamespace, blob.Digest)
 	require.Error(err)
 
-	_, err = cc.GetMetaInfo(backend.NoopNamespace, blob.Digest)
+	_, err = cc.GetMetaInfo(context.Background(), backend.NoopNamespace, blob.Digest)
 	require.Error(err)
 
 	require.Error(cc.DownloadBlob(backend.NoopNamespace, blob.Digest, ioutil.Discard))
@@ -114,6 +120,27 @@ func TestClusterClientReturnsErrorOnNoAvailability(t *testing.T) {
 	require.Error(err)
 }
 
+func TestClientResolverReportsNetworkErrorsToHealthCheck(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	filter := mockhealthcheck.NewMockPassiveFilter(ctrl)
+
+	cp := newTestClientProvider()
+	cp.register(master1, blobclient.New("localhost:0"))
+
+	r := blobclient.NewClientResolver(
+		cp, healthcheck.NewPassive(hostlist.Fixture(master1), filter))
+
+	filter.EXPECT().Run(stringset.New(master1)).Return(stringset.New(master1))
+	filter.EXPECT().Failed(master1)
+
+	_, err := r.Resolve(core.DigestFixture())
+	require.Error(err)
+}
+
 func TestPollSkipsOriginOnTimeout(t *testing.T) {
 	require := require.New(t)
 
@@ -193,6 +220,43 @@ func TestPollSkipsOriginOnRetryableError(t *testing.T) {
 	require.NoError(cc.UploadBlob(namespace, blob.Digest, nil))
 }
 
+func TestClusterClientUploadBlobStreamOnlyRetriesUnreadBlobs(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+	cc := blobclient.NewClusterClient(mockResolver)
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	clients := []blobclient.Client{mockClient1, mockClient2}
+
+	// Unread blobs are retried on the next origin.
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(clients, nil)
+	mockClient1.EXPECT().UploadBlobStream(namespace, blob.Digest, gomock.Any()).Return(
+		httputil.StatusError{Status: 503})
+	mockClient2.EXPECT().UploadBlobStream(namespace, blob.Digest, gomock.Any()).Return(nil)
+
+	require.NoError(cc.UploadBlobStream(namespace, blob.Digest, bytes.NewReader(blob.Content)))
+
+	// Partially read blobs are not.
+	mockResolver.EXPECT().Resolve(blob.Digest).Return(clients, nil)
+	mockClient1.EXPECT().UploadBlobStream(namespace, blob.Digest, gomock.Any()).DoAndReturn(
+		func(namespace string, d core.Digest, r io.Reader) error {
+			_, err := r.Read(make([]byte, 1))
+			require.NoError(err)
+			return httputil.StatusError{Status: 503}
+		})
+
+	err := cc.UploadBlobStream(namespace, blob.Digest, bytes.NewReader(blob.Content))
+	require.True(httputil.IsStatus(err, 503))
+}
+
 func TestClusterClientReturnsErrorOnNoAvailableOrigins(t *testing.T) {
 	require := require.New(t)
 
@@ -210,10 +274,10 @@ func TestClusterClientReturnsErrorOnNoAvailableOrigins(t *testing.T) {
 	mockClient2 := mockblobclient.NewMockClient(ctrl)
 	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{mockClient1, mockClient2}, nil)
 
-	mockClient1.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(nil, httputil.NetworkError{})
-	mockClient2.EXPECT().GetMetaInfo(namespace, blob.Digest).Return(nil, httputil.NetworkError{})
+	mockClient1.EXPECT().GetMetaInfo(gomock.Any(), namespace, blob.Digest).Return(nil, httputil.NetworkError{})
+	mockClient2.EXPECT().GetMetaInfo(gomock.Any(), namespace, blob.Digest).Return(nil, httputil.NetworkError{})
 
-	_, err := cc.GetMetaInfo(namespace, blob.Digest)
+	_, err := cc.GetMetaInfo(context.Background(), namespace, blob.Digest)
 	require.Error(err)
 }
 
@@ -267,3 +331,94 @@ func TestClusterClientStatContinueWhenNotFound(t *testing.T) {
 	require.NotNil(bi)
 	require.Equal(int64(256), bi.Size)
 }
+
+func TestClusterClientDownloadBlobPrefersLocalZone(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver, blobclient.WithLocalZone("zone2", hashring.Zones{
+			"origin1": "zone1",
+			"origin2": "zone2",
+		}))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{mockClient1, mockClient2}, nil)
+
+	mockClient1.EXPECT().Addr().Return("origin1").AnyTimes()
+	mockClient2.EXPECT().Addr().Return("origin2").AnyTimes()
+
+	// Only the origin in the local zone is read from.
+	mockClient2.EXPECT().DownloadBlob(namespace, blob.Digest, nil).Return(nil)
+
+	require.NoError(cc.DownloadBlob(namespace, blob.Digest, nil))
+}
+
+func TestClusterClientGetMetaInfoFallsBackToRemoteZone(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver, blobclient.WithLocalZone("zone2", hashring.Zones{
+			"origin1": "zone1",
+			"origin2": "zone2",
+		}))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{mockClient1, mockClient2}, nil)
+
+	mockClient1.EXPECT().Addr().Return("origin1").AnyTimes()
+	mockClient2.EXPECT().Addr().Return("origin2").AnyTimes()
+
+	gomock.InOrder(
+		mockClient2.EXPECT().GetMetaInfo(gomock.Any(), namespace, blob.Digest).Return(nil, httputil.NetworkError{}),
+		mockClient1.EXPECT().GetMetaInfo(gomock.Any(), namespace, blob.Digest).Return(blob.MetaInfo, nil),
+	)
+
+	mi, err := cc.GetMetaInfo(context.Background(), namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestClusterClientUploadBlobIgnoresLocalZone(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockResolver := mockblobclient.NewMockClientResolver(ctrl)
+
+	cc := blobclient.NewClusterClient(
+		mockResolver, blobclient.WithLocalZone("zone2", hashring.Zones{
+			"origin1": "zone1",
+			"origin2": "zone2",
+		}))
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	mockClient1 := mockblobclient.NewMockClient(ctrl)
+	mockClient2 := mockblobclient.NewMockClient(ctrl)
+	mockResolver.EXPECT().Resolve(blob.Digest).Return([]blobclient.Client{mockClient1, mockClient2}, nil)
+
+	// Uploads always prefer the origin with the highest hashing score.
+	mockClient1.EXPECT().UploadBlob(namespace, blob.Digest, nil).Return(nil)
+
+	require.NoError(cc.UploadBlob(namespace, blob.Digest, nil))
+}
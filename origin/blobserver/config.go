@@ -16,6 +16,8 @@ package blobserver
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/ingest"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/utils/listener"
 )
 
@@ -23,11 +25,79 @@ import (
 type Config struct {
 	Listener                  listener.Config `yaml:"listener"`
 	DuplicateWriteBackStagger time.Duration   `yaml:"duplicate_write_back_stagger"`
+
+	// CleanupStagger delays cleanup of a blob on each of its owners by a
+	// multiple of CleanupStagger, based on the owner's position in the hash
+	// ring, such that the last replica is deleted after the others. Applies to
+	// both periodic cache cleanup and force cleanup. If 0, owners clean up
+	// blobs independently.
+	CleanupStagger time.Duration `yaml:"cleanup_stagger"`
+
+	// Ingest configures hooks which transform uploaded blobs into derived
+	// blobs, e.g. normalized gzip layers.
+	Ingest ingest.Config `yaml:"ingest"`
+
+	// IngestConcurrency is the number of uploaded blobs which ingest hooks
+	// transform in parallel.
+	IngestConcurrency int `yaml:"ingest_concurrency"`
+
+	// IngestQueueSize is the number of uploaded blobs which may wait for
+	// ingest hooks. Blobs committed while the queue is full are not
+	// transformed.
+	IngestQueueSize int `yaml:"ingest_queue_size"`
+
+	// WriteThroughNamespaces are regular expressions of namespaces whose
+	// uploads are written to the storage backend before the upload commit
+	// returns, rather than asynchronously via write-back. Trades upload
+	// latency for durability.
+	WriteThroughNamespaces []string `yaml:"write_through_namespaces"`
+
+	// CleanupBackendDeleteNamespaces are regular expressions of namespaces
+	// whose expired blobs force cleanup may also delete from the storage
+	// backend, if requested with the namespace query arg. The backend of the
+	// namespace must also set allow_delete.
+	CleanupBackendDeleteNamespaces []string `yaml:"cleanup_backend_delete_namespaces"`
+
+	// PrefetchConcurrency is the number of blobs of a prefetch request
+	// processed in parallel.
+	PrefetchConcurrency int `yaml:"prefetch_concurrency"`
+
+	// PrefetchMaxDigests is the maximum number of digests accepted by a
+	// single prefetch request.
+	PrefetchMaxDigests int `yaml:"prefetch_max_digests"`
+
+	// EgressLimits limits the bandwidth of blob downloads per namespace, such
+	// that bulk reads of some namespaces cannot saturate the network. The first
+	// matching rule applies.
+	EgressLimits []EgressLimitConfig `yaml:"egress_limits"`
+
+	// DigestAlgorithms configures the digest algorithms which uploads to each
+	// namespace may use. The first matching rule applies, and namespaces
+	// without a matching rule only allow sha256.
+	DigestAlgorithms []DigestAlgorithmConfig `yaml:"digest_algorithms"`
+
+	// Uploads limits the number of concurrent upload sessions.
+	Uploads UploadLimitsConfig `yaml:"uploads"`
+
+	// Authz restricts endpoints, e.g. /internal/, to client identities.
+	Authz middleware.AuthzConfig `yaml:"authz"`
 }
 
 func (c Config) applyDefaults() Config {
 	if c.DuplicateWriteBackStagger == 0 {
 		c.DuplicateWriteBackStagger = 30 * time.Minute
 	}
+	if c.IngestConcurrency == 0 {
+		c.IngestConcurrency = 2
+	}
+	if c.IngestQueueSize == 0 {
+		c.IngestQueueSize = 1000
+	}
+	if c.PrefetchConcurrency == 0 {
+		c.PrefetchConcurrency = 16
+	}
+	if c.PrefetchMaxDigests == 0 {
+		c.PrefetchMaxDigests = 1000
+	}
 	return c
 }
@@ -0,0 +1,96 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// DigestAlgorithmConfig allows uploads of blobs digested with the given
+// algorithms to namespaces matching a regular expression.
+type DigestAlgorithmConfig struct {
+	Namespace  string   `yaml:"namespace"`
+	Algorithms []string `yaml:"algorithms"`
+}
+
+type digestAlgorithmRule struct {
+	namespace *regexp.Regexp
+	algos     []string
+}
+
+// digestAlgorithms maps namespaces to the digest algorithms their uploads may
+// use. Namespaces without a matching rule only allow sha256.
+type digestAlgorithms []digestAlgorithmRule
+
+func newDigestAlgorithms(configs []DigestAlgorithmConfig) (digestAlgorithms, error) {
+	var rules digestAlgorithms
+	for _, c := range configs {
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", c.Namespace, err)
+		}
+		if len(c.Algorithms) == 0 {
+			return nil, fmt.Errorf("namespace %s: no algorithms", c.Namespace)
+		}
+		for _, algo := range c.Algorithms {
+			if _, err := core.NewDigesterForAlgo(algo); err != nil {
+				return nil, fmt.Errorf("namespace %s: %s", c.Namespace, err)
+			}
+		}
+		rules = append(rules, digestAlgorithmRule{re, c.Algorithms})
+	}
+	return rules, nil
+}
+
+// allowed returns the digest algorithms of the first rule matching namespace.
+func (a digestAlgorithms) allowed(namespace string) []string {
+	for _, rule := range a {
+		if rule.namespace.MatchString(namespace) {
+			return rule.algos
+		}
+	}
+	return []string{core.SHA256}
+}
+
+// algorithm returns preferred if namespace allows it, and otherwise the first
+// algorithm namespace allows.
+func (a digestAlgorithms) algorithm(namespace string, preferred string) string {
+	allowed := a.allowed(namespace)
+	for _, algo := range allowed {
+		if algo == preferred {
+			return algo
+		}
+	}
+	return allowed[0]
+}
+
+// check returns 400 if blobs of namespace may not be digested with the
+// algorithm of d.
+func (a digestAlgorithms) check(namespace string, d core.Digest) error {
+	allowed := a.allowed(namespace)
+	for _, algo := range allowed {
+		if d.Algo() == algo {
+			return nil
+		}
+	}
+	return handler.Errorf(
+		"digest algorithm %s not allowed in namespace %s, expected one of: %s",
+		d.Algo(), namespace, strings.Join(allowed, ", ")).Status(http.StatusBadRequest)
+}
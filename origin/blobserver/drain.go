@@ -0,0 +1,70 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+)
+
+// _drainPollInterval is how often Drain checks for in-flight work.
+const _drainPollInterval = 100 * time.Millisecond
+
+// StartLameDuck puts s into lame-duck mode, in preparation for shutdown.
+// Health and readiness checks fail, such that hash ring consumers stop routing
+// to s, and new uploads are rejected with 503. In-flight requests and uploads
+// which have already started are unaffected.
+func (s *Server) StartLameDuck() {
+	if s.lameDuck.Swap(true) {
+		return
+	}
+	s.uploader.close()
+	s.stats.Gauge("lame_duck").Update(1)
+	log.Info("Entered lame-duck mode")
+}
+
+// Drain blocks until all in-flight requests have finished and all started
+// uploads have been committed, or until ctx is done. Uploads which clients
+// abandoned before commit keep s from draining until ctx is done.
+func (s *Server) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(_drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		requests, uploads := s.inflight.Load(), s.uploader.numPending()
+		if requests == 0 && uploads == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(
+				"%d requests and %d uploads in flight: %s", requests, uploads, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackInflight counts in-flight requests for Drain.
+func (s *Server) trackInflight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inflight.Inc()
+		defer s.inflight.Dec()
+
+		next.ServeHTTP(w, r)
+	})
+}
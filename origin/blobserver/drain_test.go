@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func TestLameDuckFailsHealthChecksAndRejectsUploads(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/health", s.addr))
+	require.NoError(err)
+
+	s.server.StartLameDuck()
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/health", s.addr))
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+
+	blob := core.SizedBlobFixture(256, 8)
+	err = cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+}
+
+func TestDrainWaitsForPendingUploads(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	uid, err := s.server.uploader.start("", blob.Digest)
+	require.NoError(err)
+	require.NoError(s.server.uploader.patch(
+		blob.Digest, uid, bytes.NewReader(blob.Content), 0, int64(len(blob.Content))))
+
+	s.server.StartLameDuck()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.Error(s.server.Drain(ctx))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.server.uploader.commit(blob.Digest, uid)
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(s.server.Drain(ctx))
+}
+
+func TestDrainNoInflightWork(t *testing.T) {
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	s.server.StartLameDuck()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.server.Drain(ctx))
+}
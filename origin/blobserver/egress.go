@@ -0,0 +1,114 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+	"golang.org/x/time/rate"
+)
+
+// EgressLimitConfig limits the bandwidth of blob downloads from namespaces
+// matching a regular expression.
+type EgressLimitConfig struct {
+	Namespace string `yaml:"namespace"`
+
+	EgressBitsPerSec uint64 `yaml:"egress_bits_per_sec"`
+
+	// Burst is the amount of data which may be sent at once after downloads
+	// have been idle. Defaults to one second of egress.
+	Burst datasize.ByteSize `yaml:"burst"`
+}
+
+type egressLimit struct {
+	namespace *regexp.Regexp
+	limiter   *rate.Limiter
+}
+
+// egressLimits maps namespaces to token buckets. Each bucket is shared by all
+// downloads of the namespaces matching its rule.
+type egressLimits []egressLimit
+
+func newEgressLimits(configs []EgressLimitConfig) (egressLimits, error) {
+	var limits egressLimits
+	for _, c := range configs {
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", c.Namespace, err)
+		}
+		if c.EgressBitsPerSec < 8 {
+			return nil, fmt.Errorf("namespace %s: egress_bits_per_sec must be at least 8", c.Namespace)
+		}
+		bps := c.EgressBitsPerSec / 8
+		burst := uint64(c.Burst)
+		if burst == 0 {
+			burst = bps
+		}
+		limits = append(limits, egressLimit{re, rate.NewLimiter(rate.Limit(bps), int(burst))})
+	}
+	return limits, nil
+}
+
+// match returns the first limit matching namespace. Returns false if
+// downloads from namespace are not limited.
+func (l egressLimits) match(namespace string) (egressLimit, bool) {
+	for _, limit := range l {
+		if limit.namespace.MatchString(namespace) {
+			return limit, true
+		}
+	}
+	return egressLimit{}, false
+}
+
+// rateLimitedWriter delays writes to w until limiter grants enough tokens,
+// one token per byte.
+type rateLimitedWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *rate.Limiter
+	waited  time.Duration
+}
+
+func newRateLimitedWriter(
+	ctx context.Context, w io.Writer, limiter *rate.Limiter) *rateLimitedWriter {
+
+	return &rateLimitedWriter{ctx: ctx, w: w, limiter: limiter}
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := len(p)
+		if burst := w.limiter.Burst(); chunk > burst {
+			chunk = burst
+		}
+		start := time.Now()
+		if err := w.limiter.WaitN(w.ctx, chunk); err != nil {
+			return n, fmt.Errorf("wait for egress: %s", err)
+		}
+		w.waited += time.Since(start)
+		m, err := w.w.Write(p[:chunk])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
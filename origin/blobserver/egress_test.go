@@ -0,0 +1,141 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/randutil"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedWriterDelaysWrites(t *testing.T) {
+	require := require.New(t)
+
+	limiter := rate.NewLimiter(rate.Limit(1000), 100)
+
+	var buf bytes.Buffer
+	w := newRateLimitedWriter(context.Background(), &buf, limiter)
+
+	data := randutil.Text(300)
+	start := time.Now()
+	n, err := w.Write(data)
+	require.NoError(err)
+	require.Equal(len(data), n)
+	require.Equal(data, buf.Bytes())
+
+	// The burst is sent immediately, the rest at 1000 bytes/sec.
+	require.True(time.Since(start) >= 150*time.Millisecond)
+	require.True(w.waited >= 150*time.Millisecond)
+}
+
+func TestRateLimitedWriterStopsOnContextCancel(t *testing.T) {
+	require := require.New(t)
+
+	limiter := rate.NewLimiter(rate.Limit(1), 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	w := newRateLimitedWriter(ctx, &buf, limiter)
+
+	_, err := w.Write(randutil.Text(100))
+	require.Error(err)
+}
+
+func TestNewEgressLimits(t *testing.T) {
+	require := require.New(t)
+
+	limits, err := newEgressLimits([]EgressLimitConfig{
+		{Namespace: "datasets/.*", EgressBitsPerSec: 8000},
+		{Namespace: ".*", EgressBitsPerSec: 80000, Burst: 100},
+	})
+	require.NoError(err)
+
+	limit, ok := limits.match("datasets/foo")
+	require.True(ok)
+	require.Equal(rate.Limit(1000), limit.limiter.Limit())
+	require.Equal(1000, limit.limiter.Burst())
+
+	limit, ok = limits.match("images/foo")
+	require.True(ok)
+	require.Equal(100, limit.limiter.Burst())
+
+	_, ok = egressLimits(nil).match("images/foo")
+	require.False(ok)
+}
+
+func TestNewEgressLimitsErrors(t *testing.T) {
+	for _, c := range []EgressLimitConfig{
+		{Namespace: "(", EgressBitsPerSec: 8000},
+		{Namespace: ".*"},
+	} {
+		_, err := newEgressLimits([]EgressLimitConfig{c})
+		require.Error(t, err)
+	}
+}
+
+func TestDownloadBlobWithEgressLimit(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{EgressLimits: []EgressLimitConfig{{
+		Namespace:        "datasets/.*",
+		EgressBitsPerSec: 8 * 1024,
+		Burst:            16,
+	}}}
+	s := newTestServerWithConfig(t, config, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(64, 4)
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	ensureHasBlob(t, cp.Provide(master1), "datasets/foo", blob)
+	ensureHasBlob(t, cp.Provide(master1), "images/foo", blob)
+}
+
+func TestReloadEgressLimits(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	_, ok := s.server.getEgressLimits().match("datasets/foo")
+	require.False(ok)
+
+	require.NoError(s.server.Reload(Config{EgressLimits: []EgressLimitConfig{{
+		Namespace:        "datasets/.*",
+		EgressBitsPerSec: 8 * 1024,
+	}}}))
+
+	limit, ok := s.server.getEgressLimits().match("datasets/foo")
+	require.True(ok)
+	require.Equal(rate.Limit(1024), limit.limiter.Limit())
+
+	require.Error(s.server.Reload(Config{EgressLimits: []EgressLimitConfig{{
+		Namespace: "datasets/.*",
+	}}}))
+	_, ok = s.server.getEgressLimits().match("datasets/foo")
+	require.True(ok)
+}
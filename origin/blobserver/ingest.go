@@ -0,0 +1,176 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/docker/distribution/uuid"
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/ingest"
+	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ingestJob is a committed blob waiting for ingest hooks.
+type ingestJob struct {
+	namespace string
+	d         core.Digest
+}
+
+// enqueueIngest queues blob d for the ingest hooks configured for namespace.
+// Blobs are dropped if the queue is full, such that bursts of uploads cannot
+// pile up unbounded transforms.
+func (s *Server) enqueueIngest(namespace string, d core.Digest) {
+	if len(s.ingestHooks.Match(namespace)) == 0 ||
+		!featureflag.EnabledFor(ingest.HooksFlag, namespace) {
+		return
+	}
+	select {
+	case s.ingestQueue <- ingestJob{namespace, d}:
+	default:
+		s.stats.Counter("ingest_dropped").Inc(1)
+		log.With("namespace", namespace, "digest", d).Warn("Ingest queue full, skipping ingest hooks")
+	}
+}
+
+// ingestLoop runs ingest hooks for queued blobs. IngestConcurrency loops run
+// for the lifetime of the Server.
+func (s *Server) ingestLoop() {
+	for job := range s.ingestQueue {
+		s.runIngestHooks(job.namespace, job.d)
+	}
+}
+
+// runIngestHooks applies all ingest hooks configured for namespace to blob d,
+// committing and writing back each derived blob and recording its digest.
+func (s *Server) runIngestHooks(namespace string, d core.Digest) {
+	for _, hook := range s.ingestHooks.Match(namespace) {
+		stats := s.stats.Tagged(map[string]string{"transformer": hook.Name})
+		derived, err := s.transform(hook, namespace, d)
+		if err == ingest.ErrSkip {
+			stats.Counter("ingest_skipped").Inc(1)
+			continue
+		}
+		if err != nil {
+			stats.Counter("ingest_errors").Inc(1)
+			log.With("namespace", namespace, "digest", d, "transformer", hook.Name).Errorf(
+				"Error transforming blob: %s", err)
+			continue
+		}
+		if err := s.writeBack(namespace, derived, 0); err != nil {
+			stats.Counter("ingest_errors").Inc(1)
+			log.With("namespace", namespace, "digest", derived).Errorf(
+				"Error writing back derived blob: %s", err)
+			continue
+		}
+		md := metadata.NewDerived(hook.Name, derived)
+		if _, err := s.cas.SetCacheFileMetadata(d.Name(), md); err != nil {
+			stats.Counter("ingest_errors").Inc(1)
+			log.With("digest", d).Errorf("Error setting derived metadata: %s", err)
+			continue
+		}
+		if s.tags != nil {
+			if err := s.tags.Put(ingest.DerivedTag(hook.Name, d), derived); err != nil {
+				stats.Counter("ingest_errors").Inc(1)
+				log.With("digest", d, "transformer", hook.Name).Errorf(
+					"Error recording derived digest in build-index: %s", err)
+				continue
+			}
+		}
+		stats.Counter("ingest_success").Inc(1)
+	}
+}
+
+// transform writes the result of hook applied to blob d into the cache and
+// returns the derived digest, digested with an algorithm namespace allows.
+func (s *Server) transform(hook ingest.Hook, namespace string, d core.Digest) (core.Digest, error) {
+	src, err := s.cas.GetCacheFileReader(d.Name())
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("get cache file: %s", err)
+	}
+	defer src.Close()
+
+	uid := uuid.Generate().String()
+	if err := s.cas.CreateUploadFile(uid, 0); err != nil {
+		return core.Digest{}, fmt.Errorf("create upload file: %s", err)
+	}
+	defer s.cas.DeleteUploadFile(uid)
+
+	dst, err := s.cas.GetUploadFileReadWriter(uid)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("get upload file: %s", err)
+	}
+	defer dst.Close()
+
+	if err := hook.Transformer.Transform(src, dst); err != nil {
+		return core.Digest{}, err
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return core.Digest{}, fmt.Errorf("seek: %s", err)
+	}
+	digester, err := core.NewDigesterForAlgo(s.digestAlgorithms.algorithm(namespace, d.Algo()))
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("new digester: %s", err)
+	}
+	derived, err := digester.FromReader(dst)
+	if err != nil {
+		return core.Digest{}, fmt.Errorf("compute digest: %s", err)
+	}
+	if err := s.cas.MoveUploadFileToCache(uid, derived.Name()); err != nil && !os.IsExist(err) {
+		return core.Digest{}, fmt.Errorf("move upload file to cache: %s", err)
+	}
+	return derived, nil
+}
+
+// getDerivedHandler returns the digest of the blob derived from the given
+// digest by the given transformer. Derived digests recorded by other origins
+// are looked up in build-index.
+func (s *Server) getDerivedHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	transformer, err := httputil.ParseParam(r, "transformer")
+	if err != nil {
+		return err
+	}
+	md := metadata.NewDerived(transformer, core.Digest{})
+	err = s.cas.GetCacheFileMetadata(d.Name(), md)
+	if err == nil {
+		fmt.Fprint(w, md.Digest.String())
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return handler.Errorf("get derived metadata: %s", err)
+	}
+	if s.tags == nil {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	derived, err := s.tags.Get(ingest.DerivedTag(transformer, d))
+	if err == tagclient.ErrTagNotFound {
+		return handler.ErrorStatus(http.StatusNotFound)
+	} else if err != nil {
+		return handler.Errorf("get derived tag: %s", err)
+	}
+	fmt.Fprint(w, derived.String())
+	return nil
+}
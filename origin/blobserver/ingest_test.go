@@ -0,0 +1,292 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/ingest"
+	mocktagclient "github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/randutil"
+	"github.com/uber/kraken/utils/testutil"
+)
+
+// gzipBlobForHost generates a random gzip blob which shards to host.
+func gzipBlobForHost(t *testing.T, ring hashring.Ring, host string) ([]byte, core.Digest) {
+	return gzipBlobForHostWithAlgo(t, ring, core.SHA256, host)
+}
+
+// gzipBlobForHostWithAlgo generates a random gzip blob digested with algo which
+// shards to host.
+func gzipBlobForHostWithAlgo(
+	t *testing.T, ring hashring.Ring, algo string, host string) ([]byte, core.Digest) {
+
+	for {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.ModTime = time.Now()
+		_, err := zw.Write(randutil.Text(256))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		digester, err := core.NewDigesterForAlgo(algo)
+		require.NoError(t, err)
+		d, err := digester.FromBytes(b.Bytes())
+		require.NoError(t, err)
+		if ring.Locations(d)[0] == host {
+			return b.Bytes(), d
+		}
+	}
+}
+
+func getDerived(addr, namespace string, d core.Digest, transformer string) (string, error) {
+	resp, err := httputil.Get(fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s/derived/%s", addr, url.PathEscape(namespace), d, transformer))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestUploadBlobRunsIngestHooks(t *testing.T) {
+	require := require.New(t)
+
+	featureflag.Global().Override(ingest.HooksFlag, true)
+	defer featureflag.Global().ClearOverride(ingest.HooksFlag)
+
+	ring := hashRingNoReplica()
+	namespace := "gzip/repo"
+
+	cp := newTestClientProvider()
+
+	config := Config{Ingest: ingest.Config{Rules: []ingest.RuleConfig{{
+		Namespace:    "gzip/.*",
+		Transformers: []string{"gzip_normalize"},
+	}}}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	content, d := gzipBlobForHost(t, ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil).Times(2)
+
+	require.NoError(cp.Provide(s.host).UploadBlob(namespace, d, bytes.NewReader(content)))
+
+	var derived string
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		var err error
+		derived, err = getDerived(s.addr, namespace, d, "gzip_normalize")
+		return err == nil
+	}))
+	derivedDigest, err := core.ParseSHA256Digest(derived)
+	require.NoError(err)
+	require.NotEqual(d, derivedDigest)
+
+	var out bytes.Buffer
+	require.NoError(cp.Provide(s.host).DownloadBlob(namespace, derivedDigest, &out))
+
+	var expected bytes.Buffer
+	zr, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+	require.NoError(err)
+	result, err := ioutil.ReadAll(zr)
+	require.NoError(err)
+	zr, err = gzip.NewReader(bytes.NewReader(content))
+	require.NoError(err)
+	_, err = expected.ReadFrom(zr)
+	require.NoError(err)
+	require.Equal(expected.Bytes(), result)
+}
+
+func TestUploadBlobDigestsDerivedBlobWithAllowedAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	featureflag.Global().Override(ingest.HooksFlag, true)
+	defer featureflag.Global().ClearOverride(ingest.HooksFlag)
+
+	ring := hashRingNoReplica()
+	namespace := "gzip/repo"
+
+	cp := newTestClientProvider()
+
+	config := Config{
+		Ingest: ingest.Config{Rules: []ingest.RuleConfig{{
+			Namespace:    "gzip/.*",
+			Transformers: []string{"gzip_normalize"},
+		}}},
+		DigestAlgorithms: []DigestAlgorithmConfig{{
+			Namespace:  "gzip/.*",
+			Algorithms: []string{core.SHA512},
+		}},
+	}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	content, d := gzipBlobForHostWithAlgo(t, ring, core.SHA512, s.host)
+
+	s.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil).Times(2)
+
+	require.NoError(cp.Provide(s.host).UploadBlob(namespace, d, bytes.NewReader(content)))
+
+	var derived string
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		var err error
+		derived, err = getDerived(s.addr, namespace, d, "gzip_normalize")
+		return err == nil
+	}))
+	derivedDigest, err := core.ParseDigest(derived)
+	require.NoError(err)
+	require.Equal(core.SHA512, derivedDigest.Algo())
+
+	var out bytes.Buffer
+	require.NoError(cp.Provide(s.host).DownloadBlob(namespace, derivedDigest, &out))
+}
+
+func TestUploadBlobSkipsIngestHooksForOtherNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	featureflag.Global().Override(ingest.HooksFlag, true)
+	defer featureflag.Global().ClearOverride(ingest.HooksFlag)
+
+	ring := hashRingNoReplica()
+	namespace := "other/repo"
+
+	cp := newTestClientProvider()
+
+	config := Config{Ingest: ingest.Config{Rules: []ingest.RuleConfig{{
+		Namespace:    "gzip/.*",
+		Transformers: []string{"gzip_normalize"},
+	}}}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	content, d := gzipBlobForHost(t, ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+
+	require.NoError(cp.Provide(s.host).UploadBlob(namespace, d, bytes.NewReader(content)))
+
+	_, err := getDerived(s.addr, namespace, d, "gzip_normalize")
+	require.True(httputil.IsStatus(err, http.StatusNotFound))
+}
+
+func TestUploadBlobSkipsIngestHooksUnlessFlagEnabled(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := "gzip/repo"
+
+	cp := newTestClientProvider()
+
+	config := Config{Ingest: ingest.Config{Rules: []ingest.RuleConfig{{
+		Namespace:    "gzip/.*",
+		Transformers: []string{"gzip_normalize"},
+	}}}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	content, d := gzipBlobForHost(t, ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil)
+
+	require.NoError(cp.Provide(s.host).UploadBlob(namespace, d, bytes.NewReader(content)))
+
+	_, err := getDerived(s.addr, namespace, d, "gzip_normalize")
+	require.True(httputil.IsStatus(err, http.StatusNotFound))
+}
+
+func TestUploadBlobRecordsDerivedDigestInBuildIndex(t *testing.T) {
+	require := require.New(t)
+
+	featureflag.Global().Override(ingest.HooksFlag, true)
+	defer featureflag.Global().ClearOverride(ingest.HooksFlag)
+
+	ring := hashRingNoReplica()
+	namespace := "gzip/repo"
+
+	cp := newTestClientProvider()
+
+	config := Config{Ingest: ingest.Config{Rules: []ingest.RuleConfig{{
+		Namespace:    "gzip/.*",
+		Transformers: []string{"gzip_to_zstd"},
+	}}}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	tags := mocktagclient.NewMockClient(s.ctrl)
+	s.server.tags = tags
+
+	content, d := gzipBlobForHost(t, ring, s.host)
+
+	recorded := make(chan core.Digest, 1)
+	s.writeBackManager.EXPECT().Add(gomock.Any()).Return(nil).Times(2)
+	tags.EXPECT().Put(ingest.DerivedTag("gzip_to_zstd", d), gomock.Any()).DoAndReturn(
+		func(tag string, derived core.Digest) error {
+			recorded <- derived
+			return nil
+		})
+
+	require.NoError(cp.Provide(s.host).UploadBlob(namespace, d, bytes.NewReader(content)))
+
+	select {
+	case derived := <-recorded:
+		require.NotEqual(d, derived)
+		_, err := s.cas.GetCacheFileStat(derived.Name())
+		require.NoError(err)
+	case <-time.After(5 * time.Second):
+		require.FailNow("derived digest not recorded in build-index")
+	}
+}
+
+func TestGetDerivedFallsBackToBuildIndex(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := "gzip/repo"
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	tags := mocktagclient.NewMockClient(s.ctrl)
+	s.server.tags = tags
+
+	d := core.DigestFixture()
+	derived := core.DigestFixture()
+
+	tags.EXPECT().Get(ingest.DerivedTag("gzip_to_zstd", d)).Return(derived, nil)
+	result, err := getDerived(s.addr, namespace, d, "gzip_to_zstd")
+	require.NoError(err)
+	require.Equal(derived.String(), result)
+
+	tags.EXPECT().Get(ingest.DerivedTag("gzip_normalize", d)).Return(core.Digest{}, tagclient.ErrTagNotFound)
+	_, err = getDerived(s.addr, namespace, d, "gzip_normalize")
+	require.True(httputil.IsNotFound(err))
+}
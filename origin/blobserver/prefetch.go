@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+)
+
+// prefetchHandler starts downloads of a JSON list of digests from the storage
+// backend of namespace onto their owning origins, and returns the status of
+// each digest as JSON. Digests owned by other origins are forwarded to them.
+func (s *Server) prefetchHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	var ds []core.Digest
+	if err := json.NewDecoder(r.Body).Decode(&ds); err != nil {
+		return handler.Errorf("decode body: %s", err).Status(http.StatusBadRequest)
+	}
+	if len(ds) > s.config.PrefetchMaxDigests {
+		return handler.Errorf(
+			"%d digests exceed limit of %d", len(ds), s.config.PrefetchMaxDigests).Status(http.StatusBadRequest)
+	}
+	results := s.prefetch(r.Context(), namespace, ds)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// prefetch prefetches ds with at most PrefetchConcurrency digests in flight.
+func (s *Server) prefetch(
+	ctx context.Context, namespace string, ds []core.Digest) []blobclient.PrefetchResult {
+
+	results := make([]blobclient.PrefetchResult, len(ds))
+	sem := make(chan struct{}, s.config.PrefetchConcurrency)
+	var wg sync.WaitGroup
+	for i, d := range ds {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, d core.Digest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = s.prefetchBlob(ctx, namespace, d)
+		}(i, d)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		s.stats.Tagged(map[string]string{"status": string(r.Status)}).Counter("prefetch").Inc(1)
+	}
+	return results
+}
+
+// prefetchBlob starts a download of d if this origin owns d, else forwards the
+// prefetch to the first owner of d.
+func (s *Server) prefetchBlob(
+	ctx context.Context, namespace string, d core.Digest) blobclient.PrefetchResult {
+
+	var err error
+	locs := s.hashRing.Locations(d)
+	if s.owns(locs) {
+		_, err = s.getMetaInfo(ctx, namespace, d, false)
+	} else {
+		_, err = s.clientProvider.Provide(locs[0]).GetMetaInfo(ctx, namespace, d)
+	}
+
+	result := blobclient.PrefetchResult{Digest: d}
+	switch prefetchErrorStatus(err) {
+	case http.StatusOK:
+		result.Status = blobclient.PrefetchCached
+	case http.StatusAccepted:
+		result.Status = blobclient.PrefetchPending
+	case http.StatusNotFound:
+		result.Status = blobclient.PrefetchNotFound
+	case http.StatusServiceUnavailable:
+		result.Status = blobclient.PrefetchBusy
+	default:
+		result.Status = blobclient.PrefetchError
+		result.Error = err.Error()
+		log.With("namespace", namespace, "digest", d).Errorf("Error prefetching blob: %s", err)
+	}
+	return result
+}
+
+// owns returns true if locs contains this origin.
+func (s *Server) owns(locs []string) bool {
+	for _, loc := range locs {
+		if loc == s.addr {
+			return true
+		}
+	}
+	return false
+}
+
+// prefetchErrorStatus returns the HTTP status of err, which is either returned
+// by a local handler or a remote origin.
+func prefetchErrorStatus(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return http.StatusOK
+	case *handler.Error:
+		return e.GetStatus()
+	case httputil.StatusError:
+		return e.Status
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/mockutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	s1 := newTestServer(t, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServer(t, master2, ring, cp)
+	defer s2.cleanup()
+
+	local := computeBlobForHosts(ring, s1.host)
+	remote := computeBlobForHosts(ring, s2.host)
+	missing := computeBlobForHosts(ring, s1.host)
+
+	for _, s := range []*testServer{s1, s2} {
+		backendClient := s.backendClient(namespace, false)
+		for _, blob := range []*core.BlobFixture{local, remote} {
+			backendClient.EXPECT().Stat(namespace, blob.Digest.Hex()).Return(
+				core.NewBlobInfo(int64(len(blob.Content))), nil).AnyTimes()
+			backendClient.EXPECT().Download(
+				namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil).MaxTimes(1)
+		}
+		backendClient.EXPECT().Stat(namespace, missing.Digest.Hex()).Return(
+			nil, backenderrors.ErrBlobNotFound).AnyTimes()
+	}
+
+	ds := []core.Digest{local.Digest, remote.Digest, missing.Digest}
+
+	results, err := cp.Provide(master1).Prefetch(namespace, ds)
+	require.NoError(err)
+	require.Equal([]blobclient.PrefetchResult{
+		{Digest: local.Digest, Status: blobclient.PrefetchPending},
+		{Digest: remote.Digest, Status: blobclient.PrefetchPending},
+		{Digest: missing.Digest, Status: blobclient.PrefetchNotFound},
+	}, results)
+
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		results, err := cp.Provide(master1).Prefetch(namespace, ds[:2])
+		require.NoError(err)
+		for _, r := range results {
+			if r.Status != blobclient.PrefetchCached {
+				return false
+			}
+		}
+		return true
+	}))
+
+	ensureHasBlob(t, cp.Provide(master1), namespace, local)
+	ensureHasBlob(t, cp.Provide(master2), namespace, remote)
+}
+
+func TestPrefetchTooManyDigests(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServerWithConfig(
+		t, Config{PrefetchMaxDigests: 1}, master1, hashRingNoReplica(), cp)
+	defer s.cleanup()
+
+	_, err := cp.Provide(master1).Prefetch(
+		core.TagFixture(), []core.Digest{core.DigestFixture(), core.DigestFixture()})
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
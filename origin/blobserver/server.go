@@ -14,29 +14,38 @@
 package blobserver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/buildinfo"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/ingest"
+	"github.com/uber/kraken/lib/lease"
+	"github.com/uber/kraken/lib/maintenance"
 	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/lib/torrent/storage/originstorage"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
@@ -48,6 +57,7 @@ import (
 	"github.com/andres-erbsen/clock"
 	"github.com/go-chi/chi"
 	"github.com/uber-go/tally"
+	"go.uber.org/atomic"
 )
 
 const _uploadChunkSize = 16 * memsize.MB
@@ -67,6 +77,21 @@ type Server struct {
 	metaInfoGenerator *metainfogen.Generator
 	uploader          *uploader
 	writeBackManager  persistedretry.Manager
+	ingestHooks       *ingest.Hooks
+	ingestQueue       chan ingestJob
+	tags              tagclient.Client
+	writeThroughRules []*regexp.Regexp
+	backendDeletes    []*regexp.Regexp
+	limitsMu          sync.RWMutex // Protects egressLimits against Reload.
+	egressLimits      egressLimits
+	digestAlgorithms  digestAlgorithms
+	egress            *originstorage.EgressCounter
+	maintenance       *maintenance.Mode
+	leases            *lease.Manager
+
+	// For draining before shutdown.
+	lameDuck atomic.Bool
+	inflight atomic.Int64
 
 	// This is an unfortunate coupling between the p2p client and the blob server.
 	// Tracker queries the origin cluster to discover which origins can seed
@@ -75,6 +100,27 @@ type Server struct {
 	pctx core.PeerContext
 }
 
+// Option defines an optional Server parameter.
+type Option func(*Server)
+
+// WithMaintenance configures a Server to reject writes while m is in read-only
+// mode. By default, read-only mode can only be toggled through the admin
+// endpoint and pauses no background work.
+func WithMaintenance(m *maintenance.Mode) Option {
+	return func(s *Server) { s.maintenance = m }
+}
+
+// WithTagClient records the digests of blobs derived by ingest hooks in
+// build-index through tags, such that all origins and clients can look them up.
+func WithTagClient(tags tagclient.Client) Option {
+	return func(s *Server) { s.tags = tags }
+}
+
+// WithLeases exposes m under /leases.
+func WithLeases(m *lease.Manager) Option {
+	return func(s *Server) { s.leases = m }
+}
+
 // New initializes a new Server.
 func New(
 	config Config,
@@ -89,7 +135,9 @@ func New(
 	backends *backend.Manager,
 	blobRefresher *blobrefresh.Refresher,
 	metaInfoGenerator *metainfogen.Generator,
-	writeBackManager persistedretry.Manager) (*Server, error) {
+	writeBackManager persistedretry.Manager,
+	egress *originstorage.EgressCounter,
+	opts ...Option) (*Server, error) {
 
 	config = config.applyDefaults()
 
@@ -97,7 +145,45 @@ func New(
 		"module": "blobserver",
 	})
 
-	return &Server{
+	ingestHooks, err := ingest.New(config.Ingest)
+	if err != nil {
+		return nil, fmt.Errorf("ingest hooks: %s", err)
+	}
+
+	var writeThrough []*regexp.Regexp
+	for _, ns := range config.WriteThroughNamespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			return nil, fmt.Errorf("write-through namespace %s: %s", ns, err)
+		}
+		writeThrough = append(writeThrough, re)
+	}
+
+	var backendDeletes []*regexp.Regexp
+	for _, ns := range config.CleanupBackendDeleteNamespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			return nil, fmt.Errorf("cleanup backend delete namespace %s: %s", ns, err)
+		}
+		backendDeletes = append(backendDeletes, re)
+	}
+
+	egressLimits, err := newEgressLimits(config.EgressLimits)
+	if err != nil {
+		return nil, fmt.Errorf("egress limits: %s", err)
+	}
+
+	digestAlgorithms, err := newDigestAlgorithms(config.DigestAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("digest algorithms: %s", err)
+	}
+
+	uploader, err := newUploader(config.Uploads, cas, clk, stats)
+	if err != nil {
+		return nil, fmt.Errorf("upload limits: %s", err)
+	}
+
+	s := &Server{
 		config:            config,
 		stats:             stats,
 		clk:               clk,
@@ -109,10 +195,28 @@ func New(
 		backends:          backends,
 		blobRefresher:     blobRefresher,
 		metaInfoGenerator: metaInfoGenerator,
-		uploader:          newUploader(cas),
+		uploader:          uploader,
 		writeBackManager:  writeBackManager,
+		ingestHooks:       ingestHooks,
+		ingestQueue:       make(chan ingestJob, config.IngestQueueSize),
+		writeThroughRules: writeThrough,
+		backendDeletes:    backendDeletes,
+		egressLimits:      egressLimits,
+		digestAlgorithms:  digestAlgorithms,
+		egress:            egress,
+		maintenance:       maintenance.Disabled(),
 		pctx:              pctx,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if config.CleanupStagger > 0 {
+		cas.SetCacheCleanupStagger(s.cleanupStagger)
+	}
+	for i := 0; i < config.IngestConcurrency; i++ {
+		go s.ingestLoop()
+	}
+	return s, nil
 }
 
 // Addr returns the address the blob server is configured on.
@@ -120,25 +224,64 @@ func (s *Server) Addr() string {
 	return s.addr
 }
 
+// Reload applies the egress and upload limits of config. Other configuration
+// cannot be reloaded and is ignored. Downloads which are already running keep
+// their previous egress limit.
+func (s *Server) Reload(config Config) error {
+	egressLimits, err := newEgressLimits(config.EgressLimits)
+	if err != nil {
+		return fmt.Errorf("egress limits: %s", err)
+	}
+	if err := s.uploader.reload(config.Uploads); err != nil {
+		return fmt.Errorf("upload limits: %s", err)
+	}
+
+	s.limitsMu.Lock()
+	defer s.limitsMu.Unlock()
+
+	s.egressLimits = egressLimits
+	return nil
+}
+
+func (s *Server) getEgressLimits() egressLimits {
+	s.limitsMu.RLock()
+	defer s.limitsMu.RUnlock()
+
+	return s.egressLimits
+}
+
 // Handler returns an http handler for the blob server.
 func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
 
+	r.Use(s.trackInflight)
 	r.Use(middleware.StatusCounter(s.stats))
 	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Recovery(s.stats))
+	// Flag overrides are restricted to identities allowed by authz rules.
+	r.Use(middleware.Authorize(s.config.Authz, s.stats, "/x/config/flags/"))
+	r.Use(s.maintenance.Middleware)
 
 	// Public endpoints:
 
 	r.Get("/health", handler.Wrap(s.healthCheckHandler))
 	r.Get("/readiness", handler.Wrap(s.readinessCheckHandler))
+	r.Get("/version", buildinfo.Handler(buildinfo.Origin))
 
 	r.Get("/blobs/{digest}/locations", handler.Wrap(s.getLocationsHandler))
+	r.Get("/ring/ownership", handler.Wrap(s.getRingOwnershipHandler))
+	r.Get("/stats/egress", handler.Wrap(s.getEgressStatsHandler))
 
 	r.Post("/namespace/{namespace}/blobs/{digest}/uploads", handler.Wrap(s.startClusterUploadHandler))
 	r.Patch("/namespace/{namespace}/blobs/{digest}/uploads/{uid}", handler.Wrap(s.patchClusterUploadHandler))
 	r.Put("/namespace/{namespace}/blobs/{digest}/uploads/{uid}", handler.Wrap(s.commitClusterUploadHandler))
+	r.Delete("/namespace/{namespace}/blobs/{digest}/uploads/{uid}", handler.Wrap(s.abortUploadHandler))
 
 	r.Get("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
+	r.Head("/namespace/{namespace}/blobs/{digest}", handler.Wrap(s.downloadBlobHandler))
+	r.Get("/namespace/{namespace}/blobs/{digest}/derived/{transformer}", handler.Wrap(s.getDerivedHandler))
+	r.Post("/namespace/{namespace}/prefetch", handler.Wrap(s.prefetchHandler))
 
 	r.Post("/namespace/{namespace}/blobs/{digest}/remote/{remote}", handler.Wrap(s.replicateToRemoteHandler))
 
@@ -146,9 +289,11 @@ func (s *Server) Handler() http.Handler {
 
 	// Internal endpoints:
 
+	r.Get("/internal/uploads", handler.Wrap(s.getUploadsHandler))
 	r.Post("/internal/blobs/{digest}/uploads", handler.Wrap(s.startTransferHandler))
 	r.Patch("/internal/blobs/{digest}/uploads/{uid}", handler.Wrap(s.patchTransferHandler))
 	r.Put("/internal/blobs/{digest}/uploads/{uid}", handler.Wrap(s.commitTransferHandler))
+	r.Delete("/internal/blobs/{digest}/uploads/{uid}", handler.Wrap(s.abortUploadHandler))
 
 	r.Delete("/internal/blobs/{digest}", handler.Wrap(s.deleteBlobHandler))
 
@@ -160,11 +305,19 @@ func (s *Server) Handler() http.Handler {
 
 	r.Get("/internal/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
 
+	r.Get("/internal/namespace/{namespace}/blobs/{digest}/writeback", handler.Wrap(s.getWriteBackStateHandler))
+
 	r.Put(
 		"/internal/duplicate/namespace/{namespace}/blobs/{digest}/uploads/{uid}",
 		handler.Wrap(s.duplicateCommitClusterUploadHandler))
 
-	r.Mount("/", http.DefaultServeMux) // Serves /debug/pprof endpoints.
+	r.Mount("/x/config/flags", featureflag.Handler())
+	r.Mount("/x/config/tracing", tracing.Handler())
+	r.Mount(maintenance.Path, s.maintenance.Handler())
+
+	if s.leases != nil {
+		r.Mount("/leases", s.leases.Handler())
+	}
 
 	return r
 }
@@ -176,11 +329,17 @@ func (s *Server) ListenAndServe(h http.Handler) error {
 }
 
 func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.lameDuck.Load() {
+		return handler.Errorf("lame duck").Status(http.StatusServiceUnavailable)
+	}
 	fmt.Fprintln(w, "OK")
 	return nil
 }
 
 func (s *Server) readinessCheckHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.lameDuck.Load() {
+		return handler.Errorf("lame duck").Status(http.StatusServiceUnavailable)
+	}
 	err := s.backends.CheckReadiness()
 	if err != nil {
 		return handler.Errorf("not ready to serve traffic: %s", err).Status(http.StatusServiceUnavailable)
@@ -211,12 +370,36 @@ func (s *Server) statHandler(w http.ResponseWriter, r *http.Request) error {
 		return fmt.Errorf("stat: %s", err)
 	}
 	w.Header().Set("Content-Length", strconv.FormatInt(bi.Size, 10))
-	log.Debugf("successfully check blob %s exists", d.Hex())
+	log.Debugf("successfully check blob %s exists", d.Name())
 	return nil
 }
 
+// getWriteBackStateHandler reports whether the blob has been written back to
+// the storage backend yet. Returns 404 if this origin does not hold the blob.
+func (s *Server) getWriteBackStateHandler(w http.ResponseWriter, r *http.Request) error {
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return err
+	}
+	if _, err := s.cas.GetCacheFileStat(d.Name()); os.IsNotExist(err) {
+		return handler.ErrorStatus(http.StatusNotFound)
+	} else if err != nil {
+		return handler.Errorf("stat cache file: %s", err)
+	}
+	// Persist metadata is removed once write-back succeeded. Blobs without it
+	// were either written back already or downloaded from the backend.
+	state := blobclient.WriteBackDone
+	var pm metadata.Persist
+	if err := s.cas.GetCacheFileMetadata(d.Name(), &pm); err == nil && pm.Value {
+		state = blobclient.WriteBackPending
+	} else if err != nil && !os.IsNotExist(err) {
+		return handler.Errorf("get persist metadata: %s", err)
+	}
+	return json.NewEncoder(w).Encode(blobclient.WriteBackStatus{State: state})
+}
+
 func (s *Server) stat(namespace string, d core.Digest, checkLocal bool) (*core.BlobInfo, error) {
-	fi, err := s.cas.GetCacheFileStat(d.Hex())
+	fi, err := s.cas.GetCacheFileStat(d.Name())
 	if err == nil {
 		return core.NewBlobInfo(fi.Size()), nil
 	} else if os.IsNotExist(err) {
@@ -225,7 +408,7 @@ func (s *Server) stat(namespace string, d core.Digest, checkLocal bool) (*core.B
 			if err != nil {
 				return nil, fmt.Errorf("get backend client: %s", err)
 			}
-			if bi, err := client.Stat(namespace, d.Hex()); err == nil {
+			if bi, err := client.Stat(namespace, d.Name()); err == nil {
 				return bi, nil
 			} else if err == backenderrors.ErrBlobNotFound {
 				return nil, os.ErrNotExist
@@ -248,11 +431,20 @@ func (s *Server) downloadBlobHandler(w http.ResponseWriter, r *http.Request) err
 	if err != nil {
 		return err
 	}
-	if err := s.downloadBlob(namespace, d, w); err != nil {
-		return err
+	if limit, ok := s.getEgressLimits().match(namespace); ok && r.Method != http.MethodHead {
+		lw := newRateLimitedWriter(r.Context(), w, limit.limiter)
+		defer func() {
+			s.stats.Tagged(map[string]string{
+				"egress_limit": limit.namespace.String(),
+			}).Timer("egress_limit_wait").Record(lw.waited)
+		}()
+		if err := s.downloadBlob(r.Context(), namespace, d, lw); err != nil {
+			return err
+		}
+		setOctetStreamContentType(w)
+		return nil
 	}
-	setOctetStreamContentType(w)
-	return nil
+	return s.serveBlob(w, r, namespace, d)
 }
 
 func (s *Server) replicateToRemoteHandler(w http.ResponseWriter, r *http.Request) error {
@@ -268,14 +460,16 @@ func (s *Server) replicateToRemoteHandler(w http.ResponseWriter, r *http.Request
 	if err != nil {
 		return err
 	}
-	return s.replicateToRemote(namespace, d, remote)
+	return s.replicateToRemote(r.Context(), namespace, d, remote)
 }
 
-func (s *Server) replicateToRemote(namespace string, d core.Digest, remoteDNS string) error {
-	f, err := s.cas.GetCacheFileReader(d.Hex())
+func (s *Server) replicateToRemote(
+	ctx context.Context, namespace string, d core.Digest, remoteDNS string) error {
+
+	f, err := s.cas.GetCacheFileReader(d.Name())
 	if err != nil {
 		if os.IsNotExist(err) {
-			return s.startRemoteBlobDownload(namespace, d, false)
+			return s.startRemoteBlobDownload(ctx, namespace, d, false)
 		}
 		return handler.Errorf("file store: %s", err)
 	}
@@ -299,7 +493,7 @@ func (s *Server) deleteBlobHandler(w http.ResponseWriter, r *http.Request) error
 	}
 	setContentLength(w, 0)
 	w.WriteHeader(http.StatusAccepted)
-	log.Debugf("successfully delete blob %s", d.Hex())
+	log.Debugf("successfully delete blob %s", d.Name())
 	return nil
 }
 
@@ -314,6 +508,32 @@ func (s *Server) getLocationsHandler(w http.ResponseWriter, r *http.Request) err
 	return nil
 }
 
+// getRingOwnershipHandler returns the share of blobs owned by each origin in
+// the hash ring as JSON.
+func (s *Server) getRingOwnershipHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.hashRing.Ownership()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getEgressStatsHandler returns the bytes served by the origin since startup.
+func (s *Server) getEgressStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.egress.Stats()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// getUploadsHandler returns the uncommitted uploads, oldest first, as JSON.
+// Useful for debugging stuck pushes.
+func (s *Server) getUploadsHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := json.NewEncoder(w).Encode(s.uploader.sessions()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
 // getPeerContextHandler returns the Server's peer context as JSON.
 func (s *Server) getPeerContextHandler(w http.ResponseWriter, r *http.Request) error {
 	if err := json.NewEncoder(w).Encode(s.pctx); err != nil {
@@ -331,7 +551,11 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	if err != nil {
 		return err
 	}
-	raw, err := s.getMetaInfo(namespace, d)
+	local, err := strconv.ParseBool(httputil.GetQueryArg(r, "local", "false"))
+	if err != nil {
+		return handler.Errorf("parse arg `local` as bool: %s", err).Status(http.StatusBadRequest)
+	}
+	raw, err := s.getMetaInfo(r.Context(), namespace, d, local)
 	if err != nil {
 		return err
 	}
@@ -352,19 +576,11 @@ func (s *Server) overwriteMetaInfoHandler(w http.ResponseWriter, r *http.Request
 }
 
 // overwriteMetaInfo generates metainfo configured with pieceLength for d and
-// writes it to disk, overwriting any existing metainfo. Primarily intended for
-// benchmarking purposes.
+// writes it to disk, overwriting any existing metainfo. Used for benchmarking
+// and to propagate regenerated metainfo to replicas.
 func (s *Server) overwriteMetaInfo(d core.Digest, pieceLength int64) error {
-	f, err := s.cas.GetCacheFileReader(d.Hex())
-	if err != nil {
-		return handler.Errorf("get cache file: %s", err)
-	}
-	mi, err := core.NewMetaInfo(d, f, pieceLength)
-	if err != nil {
-		return handler.Errorf("create metainfo: %s", err)
-	}
-	if _, err := s.cas.SetCacheFileMetadata(d.Hex(), metadata.NewTorrentMeta(mi)); err != nil {
-		return handler.Errorf("set metainfo: %s", err)
+	if err := s.metaInfoGenerator.GenerateWithPieceLength(d, pieceLength); err != nil {
+		return handler.Errorf("generate metainfo: %s", err)
 	}
 	return nil
 }
@@ -372,40 +588,90 @@ func (s *Server) overwriteMetaInfo(d core.Digest, pieceLength int64) error {
 // getMetaInfo returns metainfo for d. If no blob exists under d, a download of
 // the blob from the storage backend configured for namespace will be initiated.
 // This download is asynchronous and getMetaInfo will immediately return a
-// "202 Accepted" server error.
-func (s *Server) getMetaInfo(namespace string, d core.Digest) ([]byte, error) {
+// "202 Accepted" server error. If local is set, getMetaInfo instead returns a
+// "404 Not Found" error, such that trackers can look up metainfo on behalf of
+// an origin which is itself fetching d without recursing into it.
+func (s *Server) getMetaInfo(
+	ctx context.Context, namespace string, d core.Digest, local bool) ([]byte, error) {
 	var tm metadata.TorrentMeta
-	if err := s.cas.GetCacheFileMetadata(d.Hex(), &tm); os.IsNotExist(err) {
-		return nil, s.startRemoteBlobDownload(namespace, d, true)
+	if err := s.cas.GetCacheFileMetadata(d.Name(), &tm); os.IsNotExist(err) {
+		s.cas.RecordCacheAccess(d.Name(), false)
+		if local {
+			return nil, handler.ErrorStatus(http.StatusNotFound)
+		}
+		return nil, s.startRemoteBlobDownload(ctx, namespace, d, true)
 	} else if err != nil {
 		return nil, handler.Errorf("get cache metadata: %s", err)
 	}
+	s.cas.RecordCacheAccess(d.Name(), true)
+	if s.metaInfoGenerator.Stale(namespace, tm.MetaInfo) {
+		if err := s.regenerateMetaInfo(namespace, d, tm.MetaInfo.Length()); err != nil {
+			return nil, err
+		}
+		if err := s.cas.GetCacheFileMetadata(d.Name(), &tm); err != nil {
+			return nil, handler.Errorf("get cache metadata: %s", err)
+		}
+	}
 	return tm.Serialize()
 }
 
+// regenerateMetaInfo regenerates the metainfo of d with the piece length
+// configured for namespace, and overwrites the metainfo of its replicas such
+// that all origins seed the same torrent.
+func (s *Server) regenerateMetaInfo(namespace string, d core.Digest, size int64) error {
+	pieceLength := s.metaInfoGenerator.PieceLength(namespace, size)
+	if err := s.metaInfoGenerator.GenerateWithPieceLength(d, pieceLength); err != nil {
+		return handler.Errorf("regenerate metainfo: %s", err)
+	}
+	s.stats.Counter("metainfo_regenerated").Inc(1)
+	log.With("namespace", namespace, "digest", d, "piece_length", pieceLength).Info(
+		"Regenerated stale metainfo")
+	err := s.applyToReplicas(d, func(i int, client blobclient.Client) error {
+		return client.OverwriteMetaInfo(d, pieceLength)
+	})
+	if err != nil {
+		// Replicas regenerate their own metainfo when it is requested from
+		// them, so failures here are not fatal.
+		s.stats.Counter("metainfo_regenerate_replica_errors").Inc(1)
+		log.With("digest", d).Errorf("Error overwriting metainfo of replicas: %s", err)
+	}
+	return nil
+}
+
 type localReplicationHook struct {
-	server *Server
+	server    *Server
+	namespace string
 }
 
 func (h *localReplicationHook) Run(d core.Digest) {
 	timer := h.server.stats.Timer("replicate_blob").Start()
-	if err := h.server.replicateBlobLocally(d); err != nil {
+	if err := h.server.replicateBlobLocally(h.namespace, d); err != nil {
 		// Don't return error here as we only want to cache storage backend errors.
-		log.With("blob", d.Hex()).Errorf("Error replicating remote blob: %s", err)
+		log.With("blob", d.Name()).Errorf("Error replicating remote blob: %s", err)
 		h.server.stats.Counter("replicate_blob_errors").Inc(1)
 		return
 	}
 	timer.Stop()
 }
 
+// namespaceHook records the namespace a blob was downloaded from.
+type namespaceHook struct {
+	server    *Server
+	namespace string
+}
+
+func (h *namespaceHook) Run(d core.Digest) {
+	h.server.recordReadNamespace(h.namespace, d)
+}
+
 func (s *Server) startRemoteBlobDownload(
-	namespace string, d core.Digest, replicateLocally bool) error {
+	ctx context.Context, namespace string, d core.Digest, replicateLocally bool) error {
 
-	var hooks []blobrefresh.PostHook
+	hooks := []blobrefresh.PostHook{&namespaceHook{s, namespace}}
 	if replicateLocally {
-		hooks = append(hooks, &localReplicationHook{s})
+		hooks = append(hooks, &localReplicationHook{s, namespace})
 	}
-	err := s.blobRefresher.Refresh(namespace, d, hooks...)
+	err := s.blobRefresher.Refresh(ctx, namespace, d, hooks...)
 	switch err {
 	case blobrefresh.ErrPending, nil:
 		return handler.ErrorStatus(http.StatusAccepted)
@@ -418,15 +684,30 @@ func (s *Server) startRemoteBlobDownload(
 	}
 }
 
-func (s *Server) replicateBlobLocally(d core.Digest) error {
+// replicateBlobLocally transfers blob d of namespace to its replicas.
+func (s *Server) replicateBlobLocally(namespace string, d core.Digest) error {
+	info, err := s.cas.GetCacheFileStat(d.Name())
+	if err != nil {
+		return fmt.Errorf("cache stat: %s", err)
+	}
+	// Replicas generate metainfo without knowing namespace.
+	pieceLength := s.metaInfoGenerator.PieceLength(namespace, info.Size())
+	overwrite := pieceLength != s.metaInfoGenerator.PieceLength("", info.Size())
+
 	return s.applyToReplicas(d, func(i int, client blobclient.Client) error {
-		f, err := s.cas.GetCacheFileReader(d.Hex())
+		f, err := s.cas.GetCacheFileReader(d.Name())
 		if err != nil {
 			return fmt.Errorf("get cache reader: %s", err)
 		}
+		defer f.Close()
 		if err := client.TransferBlob(d, f); err != nil {
 			return fmt.Errorf("transfer blob: %s", err)
 		}
+		if overwrite {
+			if err := client.OverwriteMetaInfo(d, pieceLength); err != nil {
+				return fmt.Errorf("overwrite metainfo: %s", err)
+			}
+		}
 		return nil
 	})
 }
@@ -463,23 +744,66 @@ func (s *Server) applyToReplicas(d core.Digest, f func(i int, c blobclient.Clien
 // download of the blob from the storage backend configured for namespace will
 // be initiated. This download is asynchronous and downloadBlob will immediately
 // return a "202 Accepted" handler error.
-func (s *Server) downloadBlob(namespace string, d core.Digest, dst io.Writer) error {
-	f, err := s.cas.GetCacheFileReader(d.Hex())
+func (s *Server) downloadBlob(
+	ctx context.Context, namespace string, d core.Digest, dst io.Writer) error {
+
+	f, err := s.cas.GetCacheFileReader(d.Name())
 	if os.IsNotExist(err) {
-		return s.startRemoteBlobDownload(namespace, d, true)
+		s.cas.RecordCacheAccess(d.Name(), false)
+		return s.startRemoteBlobDownload(ctx, namespace, d, true)
 	} else if err != nil {
 		return handler.Errorf("get cache file: %s", err)
 	}
 	defer f.Close()
+	s.cas.RecordCacheAccess(d.Name(), true)
+	s.recordReadNamespace(namespace, d)
 
-	if _, err := io.Copy(dst, f); err != nil {
+	n, err := io.Copy(dst, f)
+	s.egress.AddHTTP(n)
+	if err != nil {
 		return handler.Errorf("copy blob: %s", err)
 	}
 	return nil
 }
 
+// serveBlob serves the cached blob d with http.ServeContent, which supports
+// HEAD and range requests. Cache files backed by an os.File are handed to the
+// kernel via sendfile rather than copied through user space.
+func (s *Server) serveBlob(
+	w http.ResponseWriter, r *http.Request, namespace string, d core.Digest) error {
+
+	f, err := s.cas.GetCacheFileReader(d.Name())
+	if os.IsNotExist(err) {
+		s.cas.RecordCacheAccess(d.Name(), false)
+		return s.startRemoteBlobDownload(r.Context(), namespace, d, true)
+	} else if err != nil {
+		return handler.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+	if r.Method != http.MethodHead {
+		s.cas.RecordCacheAccess(d.Name(), true)
+		s.recordReadNamespace(namespace, d)
+	}
+
+	var content io.ReadSeeker = f
+	var modTime time.Time
+	if of, ok := f.(osFile); ok {
+		if file, ok := of.File(); ok {
+			content = file
+			if fi, err := file.Stat(); err == nil {
+				modTime = fi.ModTime()
+			}
+		}
+	}
+	cw := &countingResponseWriter{ResponseWriter: w}
+	setOctetStreamContentType(w)
+	http.ServeContent(cw, r, "", modTime, content)
+	s.egress.AddHTTP(cw.n)
+	return nil
+}
+
 func (s *Server) deleteBlob(d core.Digest) error {
-	if err := s.cas.DeleteCacheFile(d.Hex()); err != nil {
+	if err := s.cas.DeleteCacheFile(d.Name()); err != nil {
 		if os.IsNotExist(err) {
 			return handler.ErrorStatus(http.StatusNotFound)
 		}
@@ -499,7 +823,7 @@ func (s *Server) startTransferHandler(w http.ResponseWriter, r *http.Request) er
 	} else if ok {
 		return handler.ErrorStatus(http.StatusConflict)
 	}
-	uid, err := s.uploader.start(d)
+	uid, err := s.uploader.start("", d)
 	if err != nil {
 		return err
 	}
@@ -539,19 +863,31 @@ func (s *Server) commitTransferHandler(w http.ResponseWriter, r *http.Request) e
 	if err := s.uploader.commit(d, uid); err != nil {
 		return err
 	}
-	if err := s.metaInfoGenerator.Generate(d); err != nil {
+	// The namespace of internal transfers is unknown, so the sender overwrites
+	// the metainfo if the namespace configures another piece length.
+	if err := s.metaInfoGenerator.Generate("", d); err != nil {
 		return handler.Errorf("generate metainfo: %s", err)
 	}
 	return nil
 }
 
+// abortUploadHandler discards an uncommitted upload, e.g. after the client
+// found that the uploaded blob does not match its digest.
+func (s *Server) abortUploadHandler(w http.ResponseWriter, r *http.Request) error {
+	uid, err := httputil.ParseParam(r, "uid")
+	if err != nil {
+		return err
+	}
+	return s.uploader.abort(uid)
+}
+
 func (s *Server) handleUploadConflict(err error, namespace string, d core.Digest) error {
 	if herr, ok := err.(*handler.Error); ok && herr.GetStatus() == http.StatusConflict {
 		// Even if the blob was already uploaded and committed to cache, it's
 		// still possible that adding the write-back task failed. Clients short
 		// circuit on conflict and return success, so we must make sure that if we
 		// tell a client to stop before commit, the blob has been written back.
-		if err := s.writeBack(namespace, d, 0); err != nil {
+		if err := s.persist(namespace, d); err != nil {
 			return err
 		}
 	}
@@ -568,7 +904,10 @@ func (s *Server) startClusterUploadHandler(w http.ResponseWriter, r *http.Reques
 	if err != nil {
 		return err
 	}
-	uid, err := s.uploader.start(d)
+	if err := s.digestAlgorithms.check(namespace, d); err != nil {
+		return err
+	}
+	uid, err := s.uploader.start(namespace, d)
 	if err != nil {
 		return s.handleUploadConflict(err, namespace, d)
 	}
@@ -601,9 +940,9 @@ func (s *Server) patchClusterUploadHandler(w http.ResponseWriter, r *http.Reques
 	return nil
 }
 
-// commitClusterUploadHandler commits an external blob upload asynchronously,
-// meaning the blob will be written back to remote storage in a non-blocking
-// fashion.
+// commitClusterUploadHandler commits an external blob upload. Unless namespace
+// is configured for write-through, the blob will be written back to remote
+// storage in a non-blocking fashion.
 func (s *Server) commitClusterUploadHandler(w http.ResponseWriter, r *http.Request) error {
 	d, err := httputil.ParseDigest(r, "digest")
 	if err != nil {
@@ -621,12 +960,12 @@ func (s *Server) commitClusterUploadHandler(w http.ResponseWriter, r *http.Reque
 	if err := s.uploader.commit(d, uid); err != nil {
 		return s.handleUploadConflict(err, namespace, d)
 	}
-	if err := s.writeBack(namespace, d, 0); err != nil {
+	if err := s.persist(namespace, d); err != nil {
 		return err
 	}
 	err = s.applyToReplicas(d, func(i int, client blobclient.Client) error {
 		delay := s.config.DuplicateWriteBackStagger * time.Duration(i+1)
-		f, err := s.cas.GetCacheFileReader(d.Hex())
+		f, err := s.cas.GetCacheFileReader(d.Name())
 		if err != nil {
 			return fmt.Errorf("get cache file: %s", err)
 		}
@@ -639,6 +978,7 @@ func (s *Server) commitClusterUploadHandler(w http.ResponseWriter, r *http.Reque
 		s.stats.Counter("duplicate_write_back_errors").Inc(1)
 		log.Errorf("Error duplicating write-back task to replicas: %s", err)
 	}
+	s.enqueueIngest(namespace, d)
 	return nil
 }
 
@@ -670,15 +1010,82 @@ func (s *Server) duplicateCommitClusterUploadHandler(w http.ResponseWriter, r *h
 	return s.writeBack(namespace, d, delay)
 }
 
+// persist ensures blob d is eventually stored in the storage backend of
+// namespace, either by writing it through immediately or by scheduling a
+// write-back.
+func (s *Server) persist(namespace string, d core.Digest) error {
+	if !s.isWriteThrough(namespace) {
+		return s.writeBack(namespace, d, 0)
+	}
+	if err := s.writeThrough(namespace, d); err != nil {
+		s.stats.Counter("write_through_errors").Inc(1)
+		// Fall back to write-back so the blob is still persisted eventually, but
+		// fail the request since durability was not guaranteed.
+		if err := s.writeBack(namespace, d, 0); err != nil {
+			log.With("namespace", namespace, "digest", d).Errorf(
+				"Error adding write-back fallback for write-through: %s", err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Server) isWriteThrough(namespace string) bool {
+	for _, re := range s.writeThroughRules {
+		if re.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeThrough synchronously uploads blob d to the storage backend of
+// namespace.
+func (s *Server) writeThrough(namespace string, d core.Digest) error {
+	start := s.clk.Now()
+	client, err := s.backends.GetClient(namespace)
+	if err != nil {
+		return handler.Errorf("get backend client: %s", err)
+	}
+	if _, err := s.cas.SetCacheFileMetadata(d.Name(), metadata.NewNamespace(namespace)); err != nil {
+		return handler.Errorf("set namespace metadata: %s", err)
+	}
+	f, err := s.cas.GetCacheFileReader(d.Name())
+	if err != nil {
+		return handler.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+	if err := client.Upload(namespace, d.Name(), f); err != nil {
+		return handler.Errorf("write-through upload: %s", err)
+	}
+	s.stats.Timer("write_through").Record(s.clk.Now().Sub(start))
+	if err := s.metaInfoGenerator.Generate(namespace, d); err != nil {
+		return handler.Errorf("generate metainfo: %s", err)
+	}
+	return nil
+}
+
+// recordReadNamespace records that d was read through namespace. Errors are
+// only logged, since they do not fail the read.
+func (s *Server) recordReadNamespace(namespace string, d core.Digest) {
+	if _, err := s.cas.SetCacheFileMetadata(d.Name(), metadata.NewNamespace(namespace)); err != nil {
+		s.stats.Counter("namespace_metadata_errors").Inc(1)
+		log.With("namespace", namespace, "blob", d.Name()).Errorf("Error recording namespace: %s", err)
+	}
+}
+
 func (s *Server) writeBack(namespace string, d core.Digest, delay time.Duration) error {
-	if _, err := s.cas.SetCacheFileMetadata(d.Hex(), metadata.NewPersist(true)); err != nil {
+	if _, err := s.cas.SetCacheFileMetadata(d.Name(), metadata.NewNamespace(namespace)); err != nil {
+		return handler.Errorf("set namespace metadata: %s", err)
+	}
+	if _, err := s.cas.SetCacheFileMetadata(d.Name(), metadata.NewPersist(true)); err != nil {
 		return handler.Errorf("set persist metadata: %s", err)
 	}
-	task := writeback.NewTask(namespace, d.Hex(), delay)
+	task := writeback.NewTask(namespace, d.Name(), delay)
 	if err := s.writeBackManager.Add(task); err != nil {
 		return handler.Errorf("add write-back task: %s", err)
 	}
-	if err := s.metaInfoGenerator.Generate(d); err != nil {
+	if err := s.metaInfoGenerator.Generate(namespace, d); err != nil {
 		return handler.Errorf("generate metainfo: %s", err)
 	}
 	return nil
@@ -699,13 +1106,28 @@ func (s *Server) forceCleanupHandler(w http.ResponseWriter, r *http.Request) err
 	}
 	ttl := time.Duration(ttlHr) * time.Hour
 
+	// If namespace is set, expired blobs are also deleted from the storage
+	// backend of namespace. Only namespaces opted in through
+	// cleanup_backend_delete_namespaces may propagate deletes, and their
+	// backends must additionally have allow_delete enabled.
+	namespace := r.URL.Query().Get("namespace")
+	if namespace != "" {
+		if !s.allowsBackendDelete(namespace) {
+			return handler.Errorf(
+				"backend deletes not enabled for namespace %s", namespace).Status(http.StatusBadRequest)
+		}
+		if _, err := s.backends.GetClient(namespace); err != nil {
+			return handler.Errorf("backend manager: %s", err).Status(http.StatusBadRequest)
+		}
+	}
+
 	names, err := s.cas.ListCacheFiles()
 	if err != nil {
 		return err
 	}
 	var errs, deleted []string
 	for _, name := range names {
-		if ok, err := s.maybeDelete(name, ttl); err != nil {
+		if ok, err := s.maybeDelete(name, ttl, namespace); err != nil {
 			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
 		} else if ok {
 			deleted = append(deleted, name)
@@ -717,8 +1139,67 @@ func (s *Server) forceCleanupHandler(w http.ResponseWriter, r *http.Request) err
 	})
 }
 
-func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err error) {
-	d, err := core.NewSHA256DigestFromHex(name)
+// cleanupStagger returns how much longer than its peers this origin keeps the
+// blob name before cleaning it up, such that owners of a blob do not delete
+// their replicas at the same time. The first owner keeps the blob the longest,
+// and non-owners are not delayed.
+func (s *Server) cleanupStagger(name string) time.Duration {
+	if s.config.CleanupStagger == 0 {
+		return 0
+	}
+	d, err := core.NewDigestFromName(name)
+	if err != nil {
+		return 0
+	}
+	locs := s.hashRing.Locations(d)
+	for i, loc := range locs {
+		if loc == s.addr {
+			return time.Duration(len(locs)-1-i) * s.config.CleanupStagger
+		}
+	}
+	return 0
+}
+
+func (s *Server) allowsBackendDelete(namespace string) bool {
+	for _, re := range s.backendDeletes {
+		if re.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyNamespace returns true if namespace is the only namespace which blob name
+// was written to or read from. Backends are often shared between namespaces, so
+// deleting a blob any other namespace uses could break that namespace.
+func (s *Server) onlyNamespace(name string, namespace string) (bool, error) {
+	if err := s.cas.GetCacheFileMetadata(name, metadata.NewNamespace(namespace)); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	// Ranged metadata is not loaded, so only the number of namespaces is known.
+	var n int
+	err := s.cas.RangeCacheFileMetadata(name, func(md metadata.Metadata) error {
+		if _, ok := md.(*metadata.Namespace); ok {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// maybeDelete deletes name from the cache if it expired or is not owned by s.
+// Expired blobs are also deleted from the backend of namespace, unless
+// namespace is empty, the blob was pinned, or the blob was also written to or
+// read from other namespaces. Blobs which are only deleted because s does not
+// own them are kept in the backend. Leased blobs are never deleted.
+func (s *Server) maybeDelete(name string, ttl time.Duration, namespace string) (deleted bool, err error) {
+	d, err := core.NewDigestFromName(name)
 	if err != nil {
 		return false, fmt.Errorf("parse digest: %s", err)
 	}
@@ -726,9 +1207,17 @@ func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err
 	if err != nil {
 		return false, fmt.Errorf("store: %s", err)
 	}
-	expired := s.clk.Now().Sub(info.ModTime()) > ttl
+	expired := s.clk.Now().Sub(info.ModTime()) > ttl+s.cleanupStagger(name)
 	owns := stringset.FromSlice(s.hashRing.Locations(d)).Has(s.addr)
 	if expired || !owns {
+		var lm metadata.Lease
+		if err := s.cas.GetCacheFileMetadata(name, &lm); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("store: %s", err)
+		}
+		if lm.Deadline.After(s.clk.Now()) {
+			// Leased blobs are kept both in the cache and in the backend.
+			return false, nil
+		}
 		// Ensure file is backed up properly before deleting.
 		var pm metadata.Persist
 		if err := s.cas.GetCacheFileMetadata(name, &pm); err != nil && !os.IsNotExist(err) {
@@ -751,6 +1240,29 @@ func (s *Server) maybeDelete(name string, ttl time.Duration) (deleted bool, err
 				return false, fmt.Errorf("delete persist: %s", err)
 			}
 		}
+		if expired && namespace != "" {
+			// Pinned blobs were just written back, and are never deleted from
+			// the backend.
+			propagate := !pm.Value
+			if propagate {
+				propagate, err = s.onlyNamespace(name, namespace)
+				if err != nil {
+					return false, fmt.Errorf("namespaces: %s", err)
+				}
+			}
+			if propagate {
+				client, err := s.backends.GetClient(namespace)
+				if err != nil {
+					return false, fmt.Errorf("backend manager: %s", err)
+				}
+				if err := client.Delete(namespace, name); err != nil {
+					return false, fmt.Errorf("backend delete: %s", err)
+				}
+				s.stats.Counter("backend_deletes").Inc(1)
+			} else {
+				s.stats.Counter("backend_deletes_skipped").Inc(1)
+			}
+		}
 		if err := s.cas.DeleteCacheFile(name); err != nil {
 			return false, fmt.Errorf("delete: %s", err)
 		}
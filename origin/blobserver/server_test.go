@@ -15,23 +15,33 @@ package blobserver
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
+	"github.com/c2h5oh/datasize"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/backend/backenderrors"
+	"github.com/uber/kraken/lib/buildinfo"
+	"github.com/uber/kraken/lib/hrw"
+	"github.com/uber/kraken/lib/maintenance"
+	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
 	"github.com/uber/kraken/lib/store/metadata"
+	"github.com/uber/kraken/lib/torrent/storage/originstorage"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/mockutil"
@@ -55,6 +65,23 @@ func TestHealth(t *testing.T) {
 	require.Equal("OK\n", string(b))
 }
 
+func TestVersion(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/version", s.addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var info buildinfo.Info
+	require.NoError(json.NewDecoder(resp.Body).Decode(&info))
+	require.Equal(buildinfo.Get(buildinfo.Origin), info)
+}
+
 func TestReadiness(t *testing.T) {
 	for _, tc := range []struct {
 		name           string
@@ -245,6 +272,50 @@ func TestDownloadBlobNotFound(t *testing.T) {
 	require.Equal(http.StatusNotFound, err.(httputil.StatusError).Status)
 }
 
+func TestDownloadBlobHead(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	resp, err := httputil.Head(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", s.addr, url.PathEscape(namespace), blob.Digest))
+	require.NoError(err)
+	require.Equal("256", resp.Header.Get("Content-Length"))
+	require.Equal("application/octet-stream-v1", resp.Header.Get("Content-Type"))
+}
+
+func TestDownloadBlobRange(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.SizedBlobFixture(256, 8)
+	namespace := core.TagFixture()
+
+	require.NoError(cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", s.addr, url.PathEscape(namespace), blob.Digest),
+		httputil.SendHeaders(map[string]string{"Range": "bytes=16-31"}),
+		httputil.SendAcceptedCodes(http.StatusPartialContent))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal(blob.Content[16:32], b)
+}
+
 func TestDeleteBlob(t *testing.T) {
 	require := require.New(t)
 
@@ -297,6 +368,51 @@ func TestGetLocationsOK(t *testing.T) {
 	require.ElementsMatch([]string{master1, master2}, locs)
 }
 
+func TestGetRingOwnership(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+	ring := hashRingSomeReplica()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/ring/ownership", s.addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var ownership map[string]hrw.Ownership
+	require.NoError(json.NewDecoder(resp.Body).Decode(&ownership))
+	require.Equal(ring.Ownership(), ownership)
+}
+
+func TestGetEgressStats(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+
+	blob := core.NewBlobFixture()
+	namespace := core.TagFixture()
+
+	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	var buf bytes.Buffer
+	require.NoError(client.DownloadBlob(namespace, blob.Digest, &buf))
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/stats/egress", s.addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var stats originstorage.EgressStats
+	require.NoError(json.NewDecoder(resp.Body).Decode(&stats))
+	require.Equal(originstorage.EgressStats{HTTPBytes: int64(len(blob.Content))}, stats)
+}
+
 func TestGetPeerContextOK(t *testing.T) {
 	require := require.New(t)
 
@@ -330,16 +446,16 @@ func TestGetMetaInfoDownloadsBlobAndReplicates(t *testing.T) {
 		blob.Digest.Hex()).Return(core.NewBlobInfo(int64(len(blob.Content))), nil).AnyTimes()
 	backendClient.EXPECT().Download(namespace, blob.Digest.Hex(), mockutil.MatchWriter(blob.Content)).Return(nil)
 
-	mi, err := cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+	mi, err := cp.Provide(master1).GetMetaInfo(context.Background(), namespace, blob.Digest)
 	require.True(httputil.IsAccepted(err))
 	require.Nil(mi)
 
 	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
-		_, err := cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+		_, err := cp.Provide(master1).GetMetaInfo(context.Background(), namespace, blob.Digest)
 		return !httputil.IsAccepted(err)
 	}))
 
-	mi, err = cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+	mi, err = cp.Provide(master1).GetMetaInfo(context.Background(), namespace, blob.Digest)
 	require.NoError(err)
 	require.NotNil(mi)
 	require.Equal(len(blob.Content), int(mi.Length()))
@@ -365,11 +481,75 @@ func TestGetMetaInfoBlobNotFound(t *testing.T) {
 	backendClient := s.backendClient(namespace, false)
 	backendClient.EXPECT().Stat(namespace, d.Hex()).Return(nil, backenderrors.ErrBlobNotFound)
 
-	mi, err := cp.Provide(master1).GetMetaInfo(namespace, d)
+	mi, err := cp.Provide(master1).GetMetaInfo(context.Background(), namespace, d)
 	require.True(httputil.IsNotFound(err))
 	require.Nil(mi)
 }
 
+func TestGetLocalMetaInfoNeverDownloadsBlob(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	cp := newTestClientProvider()
+	namespace := core.TagFixture()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	// Any backend call fails the test, since none is expected.
+	s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	_, err := cp.Provide(master1).GetLocalMetaInfo(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	require.NoError(s.server.metaInfoGenerator.Generate(namespace, blob.Digest))
+
+	mi, err := cp.Provide(master1).GetLocalMetaInfo(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(len(blob.Content), int(mi.Length()))
+}
+
+func TestGetMetaInfoRegeneratesStaleMetaInfoOnReplicas(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingSomeReplica()
+	cp := newTestClientProvider()
+	namespace := "models/bert"
+
+	mgConfig := metainfogen.Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 4},
+		Namespaces: []metainfogen.NamespaceConfig{{
+			Namespace:    "models/.*",
+			PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 8},
+		}},
+		RegenerateStale: true,
+	}
+
+	s1 := newTestServerWithMetaInfoGenConfig(t, Config{}, mgConfig, master1, ring, cp)
+	defer s1.cleanup()
+
+	s2 := newTestServerWithMetaInfoGenConfig(t, Config{}, mgConfig, master2, ring, cp)
+	defer s2.cleanup()
+
+	blob := computeBlobForHosts(ring, s1.host, s2.host)
+
+	// Internal transfers generate metainfo with the default piece length.
+	for _, s := range []*testServer{s1, s2} {
+		require.NoError(cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+	}
+
+	mi, err := cp.Provide(master1).GetMetaInfo(context.Background(), namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(int64(8), mi.PieceLength())
+
+	var tm metadata.TorrentMeta
+	require.NoError(s2.cas.GetCacheFileMetadata(blob.Digest.Hex(), &tm))
+	require.Equal(mi, tm.MetaInfo)
+}
+
 func TestGetMetaInfoInvalidParam(t *testing.T) {
 	digest := core.DigestFixture()
 
@@ -548,14 +728,14 @@ func TestOverwriteMetainfo(t *testing.T) {
 	err := cp.Provide(master1).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
 	require.NoError(err)
 
-	mi, err := cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+	mi, err := cp.Provide(master1).GetMetaInfo(context.Background(), namespace, blob.Digest)
 	require.NoError(err)
 	require.Equal(int64(4), mi.PieceLength())
 
 	err = cp.Provide(master1).OverwriteMetaInfo(blob.Digest, 16)
 	require.NoError(err)
 
-	mi, err = cp.Provide(master1).GetMetaInfo(namespace, blob.Digest)
+	mi, err = cp.Provide(master1).GetMetaInfo(context.Background(), namespace, blob.Digest)
 	require.NoError(err)
 	require.Equal(int64(16), mi.PieceLength())
 }
@@ -676,6 +856,85 @@ func TestUploadBlobDuplicatesWriteBackTaskToReplicas(t *testing.T) {
 	require.Error(cp.Provide(s2.host).DeleteBlob(blob.Digest))
 }
 
+func TestUploadBlobStream(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	client := blobclient.New(s.addr, blobclient.WithChunkSize(13))
+	err := client.UploadBlobStream(
+		namespace, blob.Digest, iotest.OneByteReader(bytes.NewReader(blob.Content)))
+	require.NoError(err)
+	ensureHasBlob(t, client, namespace, blob)
+}
+
+func TestGetWriteBackState(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	client := cp.Provide(s.host)
+
+	_, err := client.GetWriteBackState(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+	require.NoError(client.UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content)))
+
+	state, err := client.GetWriteBackState(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blobclient.WriteBackPending, state)
+
+	// The write-back executor removes persist metadata once it succeeded.
+	require.NoError(s.cas.DeleteCacheFileMetadata(blob.Digest.Hex(), &metadata.Persist{}))
+
+	state, err = client.GetWriteBackState(namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blobclient.WriteBackDone, state)
+}
+
+func TestUploadBlobStreamAbortsOnDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	blob := core.NewBlobFixture()
+	other := core.NewBlobFixture()
+
+	client := cp.Provide(s.host)
+	err := client.UploadBlobStream(namespace, blob.Digest, bytes.NewReader(other.Content))
+	require.Equal(blobclient.ErrDigestMismatch{Expected: blob.Digest, Actual: other.Digest}, err)
+
+	_, err = client.StatLocal(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+	require.Equal(0, s.server.uploader.numPending())
+}
+
 func TestUploadBlobRetriesWriteBackFailure(t *testing.T) {
 	require := require.New(t)
 
@@ -771,6 +1030,170 @@ func TestForceCleanupTTL(t *testing.T) {
 	require.Equal(blobclient.ErrBlobNotFound, err)
 }
 
+func TestForceCleanupRejectsBackendDeleteUnlessEnabled(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+
+	// Any backend Delete call fails the test, since none is expected.
+	s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	s.clk.Add(14 * time.Hour)
+
+	_, err := httputil.Post(fmt.Sprintf(
+		"http://%s/forcecleanup?ttl_hr=12&namespace=%s", s.addr, url.QueryEscape(namespace)))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	ensureHasBlob(t, client, namespace, blob)
+}
+
+func TestForceCleanupDeletesExpiredBlobsFromBackend(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{CleanupBackendDeleteNamespaces: []string{".*"}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+	backendClient := s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	_, err := s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace(namespace))
+	require.NoError(err)
+
+	s.clk.Add(14 * time.Hour)
+
+	backendClient.EXPECT().Delete(namespace, blob.Digest.Hex()).Return(nil)
+
+	_, err = httputil.Post(fmt.Sprintf(
+		"http://%s/forcecleanup?ttl_hr=12&namespace=%s", s.addr, url.QueryEscape(namespace)))
+	require.NoError(err)
+
+	_, err = client.StatLocal(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+}
+
+func TestForceCleanupKeepsBlobIfBackendDeleteFails(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{CleanupBackendDeleteNamespaces: []string{".*"}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+	backendClient := s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+
+	_, err := s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace(namespace))
+	require.NoError(err)
+
+	s.clk.Add(14 * time.Hour)
+
+	// Backends without allow_delete refuse deletes.
+	backendClient.EXPECT().Delete(namespace, blob.Digest.Hex()).Return(backend.ErrDeleteDisabled)
+
+	_, err = httputil.Post(fmt.Sprintf(
+		"http://%s/forcecleanup?ttl_hr=12&namespace=%s", s.addr, url.QueryEscape(namespace)))
+	require.NoError(err)
+
+	ensureHasBlob(t, client, namespace, blob)
+}
+
+func TestForceCleanupKeepsBlobsSharedWithOtherNamespacesInBackend(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+	other := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{CleanupBackendDeleteNamespaces: []string{".*"}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+
+	// Any backend Delete call fails the test, since none is expected.
+	s.backendClient(namespace, false)
+	s.backendClient(other, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	for _, ns := range []string{namespace, other} {
+		_, err := s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace(ns))
+		require.NoError(err)
+	}
+
+	s.clk.Add(14 * time.Hour)
+
+	_, err := httputil.Post(fmt.Sprintf(
+		"http://%s/forcecleanup?ttl_hr=12&namespace=%s", s.addr, url.QueryEscape(namespace)))
+	require.NoError(err)
+
+	_, err = client.StatLocal(namespace, blob.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+}
+
+func TestForceCleanupKeepsLeasedBlobs(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{CleanupBackendDeleteNamespaces: []string{".*"}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+
+	// Any backend Delete call fails the test, since none is expected.
+	s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+	require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	_, err := s.cas.SetCacheFileMetadata(blob.Digest.Hex(), metadata.NewNamespace(namespace))
+	require.NoError(err)
+
+	s.clk.Add(14 * time.Hour)
+
+	_, err = s.cas.SetCacheFileMetadata(
+		blob.Digest.Hex(), metadata.NewLease(s.clk.Now().Add(time.Hour)))
+	require.NoError(err)
+
+	_, err = httputil.Post(fmt.Sprintf(
+		"http://%s/forcecleanup?ttl_hr=12&namespace=%s", s.addr, url.QueryEscape(namespace)))
+	require.NoError(err)
+
+	ensureHasBlob(t, client, namespace, blob)
+}
+
 func TestForceCleanupNonOwner(t *testing.T) {
 	require := require.New(t)
 
@@ -810,6 +1233,49 @@ func TestForceCleanupNonOwner(t *testing.T) {
 	require.Equal(blobclient.ErrBlobNotFound, err)
 }
 
+func TestForceCleanupStaggeredByOwnerIndex(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingSomeReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServerWithConfig(t, Config{CleanupStagger: 4 * time.Hour}, master1, ring, cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+
+	// Find blobs for which s is the first and second owner respectively.
+	var first, second *core.BlobFixture
+	for first == nil || second == nil {
+		blob := computeBlobForHosts(ring, master1, master2)
+		if ring.Locations(blob.Digest)[0] == master1 {
+			first = blob
+		} else {
+			second = blob
+		}
+	}
+	for _, blob := range []*core.BlobFixture{first, second} {
+		require.NoError(s.cas.CreateCacheFile(blob.Digest.Hex(), bytes.NewReader(blob.Content)))
+	}
+
+	s.clk.Add(14 * time.Hour)
+
+	require.NoError(client.ForceCleanup(12 * time.Hour))
+
+	ensureHasBlob(t, client, namespace, first)
+	_, err := client.StatLocal(namespace, second.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+
+	s.clk.Add(4 * time.Hour)
+
+	require.NoError(client.ForceCleanup(12 * time.Hour))
+
+	_, err = client.StatLocal(namespace, first.Digest)
+	require.Equal(blobclient.ErrBlobNotFound, err)
+}
+
 func TestForceCleanupWriteBackFailures(t *testing.T) {
 	require := require.New(t)
 
@@ -846,3 +1312,133 @@ func TestForceCleanupWriteBackFailures(t *testing.T) {
 
 	ensureHasBlob(t, client, namespace, blob)
 }
+
+func TestUploadBlobWriteThrough(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{WriteThroughNamespaces: []string{".*"}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	backendClient := s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	backendClient.EXPECT().Upload(namespace, blob.Digest.Hex(), gomock.Any()).Return(nil)
+
+	err := cp.Provide(s.host).UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content))
+	require.NoError(err)
+
+	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
+}
+
+func TestUploadBlobWriteThroughFailureFallsBackToWriteBack(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{WriteThroughNamespaces: []string{".*"}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	backendClient := s.backendClient(namespace, false)
+
+	blob := computeBlobForHosts(ring, s.host)
+
+	backendClient.EXPECT().Upload(
+		namespace, blob.Digest.Hex(), gomock.Any()).Return(errors.New("some error"))
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Hex(), 0))).Return(nil)
+
+	err := cp.Provide(s.host).UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content))
+	require.Error(err)
+
+	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
+
+	// Shouldn't be able to delete blob since it is still being written back.
+	require.Error(cp.Provide(s.host).DeleteBlob(blob.Digest))
+}
+
+func TestReadOnlyModeRejectsWrites(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	client := cp.Provide(s.host)
+	namespace := core.TagFixture()
+
+	blob := core.SizedBlobFixture(256, 8)
+	require.NoError(client.TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+
+	_, err := httputil.Put(fmt.Sprintf("http://%s%s?read_only=true", s.addr, maintenance.Path))
+	require.NoError(err)
+
+	other := core.SizedBlobFixture(256, 8)
+	err = client.TransferBlob(other.Digest, bytes.NewReader(other.Content))
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+
+	ensureHasBlob(t, client, namespace, blob)
+
+	_, err = httputil.Put(fmt.Sprintf("http://%s%s?read_only=false", s.addr, maintenance.Path))
+	require.NoError(err)
+
+	require.NoError(client.TransferBlob(other.Digest, bytes.NewReader(other.Content)))
+}
+
+func TestUploadBlobWithAllowedDigestAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	config := Config{DigestAlgorithms: []DigestAlgorithmConfig{{
+		Namespace:  ".*",
+		Algorithms: []string{core.SHA256, core.SHA512},
+	}}}
+	s := newTestServerWithConfig(t, config, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHostsWithAlgo(ring, core.SHA512, s.host)
+
+	s.writeBackManager.EXPECT().Add(
+		writeback.MatchTask(writeback.NewTask(namespace, blob.Digest.Name(), 0))).Return(nil)
+
+	err := cp.Provide(s.host).UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content))
+	require.NoError(err)
+
+	ensureHasBlob(t, cp.Provide(s.host), namespace, blob)
+
+	mi, err := cp.Provide(s.host).GetMetaInfo(context.Background(), namespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.Digest, mi.Digest())
+}
+
+func TestUploadBlobRejectsDisallowedDigestAlgorithm(t *testing.T) {
+	require := require.New(t)
+
+	ring := hashRingNoReplica()
+	namespace := core.TagFixture()
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, ring, cp)
+	defer s.cleanup()
+
+	blob := computeBlobForHostsWithAlgo(ring, core.SHA512, s.host)
+
+	err := cp.Provide(s.host).UploadBlob(namespace, blob.Digest, bytes.NewReader(blob.Content))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
@@ -21,18 +21,19 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/andres-erbsen/clock"
+	"github.com/c2h5oh/datasize"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/krakentest"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
 	"github.com/uber/kraken/lib/hashring"
-	"github.com/uber/kraken/lib/healthcheck"
-	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/lib/metainfogen"
 	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/lib/torrent/storage/originstorage"
 	"github.com/uber/kraken/mocks/lib/backend"
 	"github.com/uber/kraken/mocks/lib/persistedretry"
 	"github.com/uber/kraken/mocks/origin/blobclient"
@@ -55,10 +56,7 @@ func init() {
 }
 
 func newHashRing(maxReplica int) hashring.Ring {
-	return hashring.New(
-		hashring.Config{MaxReplica: maxReplica},
-		hostlist.Fixture(master1, master2, master3),
-		healthcheck.IdentityFilter{})
+	return krakentest.HashRing(maxReplica, master1, master2, master3)
 }
 
 func hashRingNoReplica() hashring.Ring   { return newHashRing(1) }
@@ -91,6 +89,7 @@ func (p *testClientProvider) Provide(host string) blobclient.Client {
 // testServer is a convenience wrapper around the underlying components of a
 // Server and faciliates restarting Servers with new configuration.
 type testServer struct {
+	server           *Server
 	ctrl             *gomock.Controller
 	host             string
 	addr             string
@@ -107,6 +106,30 @@ type testServer struct {
 func newTestServer(
 	t *testing.T, host string, ring hashring.Ring, cp *testClientProvider) *testServer {
 
+	return newTestServerWithConfig(t, Config{}, host, ring, cp)
+}
+
+func newTestServerWithConfig(
+	t *testing.T,
+	config Config,
+	host string,
+	ring hashring.Ring,
+	cp *testClientProvider) *testServer {
+
+	mgConfig := metainfogen.Config{
+		PieceLengths: map[datasize.ByteSize]datasize.ByteSize{0: 4},
+	}
+	return newTestServerWithMetaInfoGenConfig(t, config, mgConfig, host, ring, cp)
+}
+
+func newTestServerWithMetaInfoGenConfig(
+	t *testing.T,
+	config Config,
+	mgConfig metainfogen.Config,
+	host string,
+	ring hashring.Ring,
+	cp *testClientProvider) *testServer {
+
 	var cleanup testutil.Cleanup
 	defer cleanup.Recover()
 
@@ -124,16 +147,22 @@ func newTestServer(
 
 	writeBackManager := mockpersistedretry.NewMockManager(ctrl)
 
-	mg := metainfogen.Fixture(cas, 4)
+	mg, err := metainfogen.New(mgConfig, cas)
+	if err != nil {
+		panic(err)
+	}
 
-	br := blobrefresh.New(blobrefresh.Config{}, tally.NoopScope, cas, bm, mg)
+	br, err := blobrefresh.New(blobrefresh.Config{}, tally.NoopScope, cas, bm, mg)
+	if err != nil {
+		panic(err)
+	}
 
 	clk := clock.NewMock()
 	clk.Set(time.Now())
 
 	s, err := New(
-		Config{}, tally.NoopScope, clk, host, ring, cas, cp, clusterProvider, pctx,
-		bm, br, mg, writeBackManager)
+		config, tally.NoopScope, clk, host, ring, cas, cp, clusterProvider, pctx,
+		bm, br, mg, writeBackManager, originstorage.NewEgressCounter())
 	if err != nil {
 		panic(err)
 	}
@@ -144,6 +173,7 @@ func newTestServer(
 	cp.register(host, blobclient.New(addr, blobclient.WithChunkSize(16)))
 
 	return &testServer{
+		server:           s,
 		ctrl:             ctrl,
 		host:             host,
 		addr:             addr,
@@ -174,9 +204,17 @@ func (s *testServer) expectRemoteCluster(dns string) *mockblobclient.MockCluster
 
 // computeBlobForHosts generates a random digest / content which shards to hosts.
 func computeBlobForHosts(ring hashring.Ring, hosts ...string) *core.BlobFixture {
+	return computeBlobForHostsWithAlgo(ring, core.SHA256, hosts...)
+}
+
+// computeBlobForHostsWithAlgo generates a random digest of algo / content which
+// shards to hosts.
+func computeBlobForHostsWithAlgo(
+	ring hashring.Ring, algo string, hosts ...string) *core.BlobFixture {
+
 	want := stringset.New(hosts...)
 	for {
-		blob := core.SizedBlobFixture(32, 4)
+		blob := core.SizedBlobFixtureForAlgo(32, 4, algo)
 		got := stringset.New(ring.Locations(blob.Digest)...)
 		if stringset.Equal(want, got) {
 			return blob
@@ -14,38 +14,305 @@
 package blobserver
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/docker/distribution/uuid"
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/utils/handler"
 )
 
+// UploadLimitsConfig limits the number of concurrent upload sessions, such
+// that a burst of large uploads cannot exhaust the disk or file handles of an
+// origin.
+type UploadLimitsConfig struct {
+	// MaxSessions limits the concurrent uploads of all namespaces, including
+	// internal transfers between origins. If 0, uploads are not limited.
+	MaxSessions int `yaml:"max_sessions"`
+
+	// Namespaces limits the concurrent uploads to namespaces matching a
+	// regular expression. The first matching rule applies.
+	Namespaces []NamespaceUploadLimitConfig `yaml:"namespaces"`
+
+	// SessionTTI is the time after which a session which received no chunks
+	// no longer counts towards the limits, e.g. because its client is gone.
+	SessionTTI time.Duration `yaml:"session_tti"`
+}
+
+func (c UploadLimitsConfig) applyDefaults() UploadLimitsConfig {
+	if c.SessionTTI == 0 {
+		c.SessionTTI = time.Hour
+	}
+	return c
+}
+
+// NamespaceUploadLimitConfig limits the concurrent uploads to namespaces
+// matching a regular expression.
+type NamespaceUploadLimitConfig struct {
+	Namespace   string `yaml:"namespace"`
+	MaxSessions int    `yaml:"max_sessions"`
+}
+
+type namespaceUploadLimit struct {
+	namespace   *regexp.Regexp
+	maxSessions int
+}
+
+// uploadSession is an upload which was started but not committed.
+type uploadSession struct {
+	uid           string
+	namespace     string
+	digest        core.Digest
+	bytesReceived int64
+	started       time.Time
+	lastActive    time.Time
+
+	// rule is the index of the namespace limit matching namespace, or -1.
+	rule int
+}
+
+// uploadSessionInfo is the JSON representation of an upload session.
+type uploadSessionInfo struct {
+	UID           string      `json:"uid"`
+	Namespace     string      `json:"namespace"`
+	Digest        core.Digest `json:"digest"`
+	BytesReceived int64       `json:"bytes_received"`
+	Age           string      `json:"age"`
+	Idle          string      `json:"idle"`
+}
+
 // uploader executes a chunked upload.
 type uploader struct {
-	cas *store.CAStore
+	cas    *store.CAStore
+	clk    clock.Clock
+	stats  tally.Scope
+	config UploadLimitsConfig
+	limits []namespaceUploadLimit
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[string]*uploadSession // Uploads which were started but not committed.
+}
+
+func newUploader(
+	config UploadLimitsConfig,
+	cas *store.CAStore,
+	clk clock.Clock,
+	stats tally.Scope) (*uploader, error) {
+
+	config = config.applyDefaults()
+
+	limits, err := newNamespaceUploadLimits(config.Namespaces)
+	if err != nil {
+		return nil, err
+	}
+	return &uploader{
+		cas:     cas,
+		clk:     clk,
+		stats:   stats,
+		config:  config,
+		limits:  limits,
+		pending: make(map[string]*uploadSession),
+	}, nil
+}
+
+func newNamespaceUploadLimits(configs []NamespaceUploadLimitConfig) ([]namespaceUploadLimit, error) {
+	var limits []namespaceUploadLimit
+	for _, c := range configs {
+		re, err := regexp.Compile(c.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %s", c.Namespace, err)
+		}
+		if c.MaxSessions <= 0 {
+			return nil, fmt.Errorf("namespace %s: max_sessions must be positive", c.Namespace)
+		}
+		limits = append(limits, namespaceUploadLimit{re, c.MaxSessions})
+	}
+	return limits, nil
+}
+
+// reload replaces the limits of u. Pending sessions are kept and count
+// towards the new limits, which only reject new uploads.
+func (u *uploader) reload(config UploadLimitsConfig) error {
+	config = config.applyDefaults()
+
+	limits, err := newNamespaceUploadLimits(config.Namespaces)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.config = config
+	u.limits = limits
+	for _, s := range u.pending {
+		s.rule = u.matchLimit(s.namespace)
+	}
+	return nil
 }
 
-func newUploader(cas *store.CAStore) *uploader {
-	return &uploader{cas}
+// close rejects all uploads started after close with 503.
+func (u *uploader) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.closed = true
 }
 
-func (u *uploader) start(d core.Digest) (uid string, err error) {
+// numPending returns the number of uploads which have not been committed.
+func (u *uploader) numPending() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expireIdleLocked()
+	return len(u.pending)
+}
+
+// sessions returns the pending uploads, oldest first.
+func (u *uploader) sessions() []uploadSessionInfo {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expireIdleLocked()
+	now := u.clk.Now()
+	sessions := make([]*uploadSession, 0, len(u.pending))
+	for _, s := range u.pending {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].started.Before(sessions[j].started)
+	})
+	infos := make([]uploadSessionInfo, len(sessions))
+	for i, s := range sessions {
+		infos[i] = uploadSessionInfo{
+			UID:           s.uid,
+			Namespace:     s.namespace,
+			Digest:        s.digest,
+			BytesReceived: s.bytesReceived,
+			Age:           now.Sub(s.started).String(),
+			Idle:          now.Sub(s.lastActive).String(),
+		}
+	}
+	return infos
+}
+
+// expireIdleLocked stops tracking sessions which have been idle for longer than
+// SessionTTI. Their upload files are removed by upload cleanup.
+func (u *uploader) expireIdleLocked() {
+	now := u.clk.Now()
+	for uid, s := range u.pending {
+		if now.Sub(s.lastActive) > u.config.SessionTTI {
+			delete(u.pending, uid)
+			u.stats.Counter("upload_sessions_expired").Inc(1)
+		}
+	}
+}
+
+// matchLimit returns the index of the first namespace limit matching
+// namespace, or -1 if uploads to namespace are not limited. Internal transfers,
+// which have no namespace, only count towards MaxSessions.
+func (u *uploader) matchLimit(namespace string) int {
+	if namespace == "" {
+		return -1
+	}
+	for i, l := range u.limits {
+		if l.namespace.MatchString(namespace) {
+			return i
+		}
+	}
+	return -1
+}
+
+// reserve adds a session for uid. Returns 503 after close, and 429 if the
+// origin or namespace has reached its limit of concurrent uploads.
+func (u *uploader) reserve(uid, namespace string, d core.Digest) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.closed {
+		return handler.Errorf("shutting down").Status(http.StatusServiceUnavailable)
+	}
+	u.expireIdleLocked()
+	if u.config.MaxSessions > 0 && len(u.pending) >= u.config.MaxSessions {
+		u.stats.Counter("upload_sessions_rejected").Inc(1)
+		return handler.Errorf(
+			"origin has reached its limit of %d concurrent uploads", u.config.MaxSessions).
+			Status(http.StatusTooManyRequests)
+	}
+	rule := u.matchLimit(namespace)
+	if rule >= 0 {
+		var n int
+		for _, s := range u.pending {
+			if s.rule == rule {
+				n++
+			}
+		}
+		if limit := u.limits[rule].maxSessions; n >= limit {
+			u.stats.Tagged(map[string]string{"namespace": namespace}).
+				Counter("upload_sessions_rejected").Inc(1)
+			return handler.Errorf(
+				"namespace %s has reached its limit of %d concurrent uploads", namespace, limit).
+				Status(http.StatusTooManyRequests)
+		}
+	}
+	now := u.clk.Now()
+	u.pending[uid] = &uploadSession{
+		uid:        uid,
+		namespace:  namespace,
+		digest:     d,
+		started:    now,
+		lastActive: now,
+		rule:       rule,
+	}
+	return nil
+}
+
+func (u *uploader) release(uid string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	delete(u.pending, uid)
+}
+
+// received records that n bytes of upload uid were received.
+func (u *uploader) received(uid string, n int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if s, ok := u.pending[uid]; ok {
+		s.bytesReceived += n
+		s.lastActive = u.clk.Now()
+	}
+}
+
+// start starts an upload of d to namespace. namespace is empty for internal
+// transfers.
+func (u *uploader) start(namespace string, d core.Digest) (uid string, err error) {
 	if ok, err := blobExists(u.cas, d); err != nil {
 		return "", err
 	} else if ok {
 		return "", handler.ErrorStatus(http.StatusConflict)
 	}
 	uid = uuid.Generate().String()
+	if err := u.reserve(uid, namespace, d); err != nil {
+		return "", err
+	}
 	if err := u.cas.CreateUploadFile(uid, 0); err != nil {
+		u.release(uid)
 		return "", handler.Errorf("create upload file: %s", err)
 	}
 	return uid, nil
 }
-
 func (u *uploader) patch(
 	d core.Digest, uid string, chunk io.Reader, start, end int64) error {
 
@@ -65,14 +332,18 @@ func (u *uploader) patch(
 	if _, err := f.Seek(start, 0); err != nil {
 		return handler.Errorf("seek offset %d: %s", start, err).Status(http.StatusBadRequest)
 	}
-	if _, err := io.CopyN(f, chunk, end-start); err != nil {
+	n, err := io.CopyN(f, chunk, end-start)
+	u.received(uid, n)
+	if err != nil {
 		return handler.Errorf("copy: %s", err)
 	}
 	return nil
 }
 
 func (u *uploader) commit(d core.Digest, uid string) error {
-	if err := u.cas.MoveUploadFileToCache(uid, d.Hex()); err != nil {
+	u.release(uid)
+
+	if err := u.cas.MoveUploadFileToCache(uid, d.Name()); err != nil {
 		if os.IsNotExist(err) {
 			return handler.ErrorStatus(http.StatusNotFound)
 		}
@@ -83,3 +354,15 @@ func (u *uploader) commit(d core.Digest, uid string) error {
 	}
 	return nil
 }
+
+func (u *uploader) abort(uid string) error {
+	u.release(uid)
+
+	if err := u.cas.DeleteUploadFile(uid); err != nil {
+		if os.IsNotExist(err) {
+			return handler.ErrorStatus(http.StatusNotFound)
+		}
+		return handler.Errorf("delete upload file: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package blobserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func startClusterUpload(addr, namespace string, d core.Digest) error {
+	_, err := httputil.Post(fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s/uploads", addr, url.PathEscape(namespace), d))
+	return err
+}
+
+func getUploads(t *testing.T, addr string) []uploadSessionInfo {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/internal/uploads", addr))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var sessions []uploadSessionInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sessions))
+	return sessions
+}
+
+func TestUploadsRejectedOverOriginLimit(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{Uploads: UploadLimitsConfig{MaxSessions: 2}}
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	_, err := s.server.uploader.start("", core.DigestFixture())
+	require.NoError(err)
+	uid, err := s.server.uploader.start(namespace, core.DigestFixture())
+	require.NoError(err)
+
+	err = startClusterUpload(s.addr, namespace, core.DigestFixture())
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	// Internal transfers count towards the origin limit too.
+	blob := core.NewBlobFixture()
+	err = cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content))
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	require.NoError(s.server.uploader.abort(uid))
+
+	require.NoError(startClusterUpload(s.addr, namespace, core.DigestFixture()))
+}
+
+func TestUploadsRejectedOverNamespaceLimit(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{Uploads: UploadLimitsConfig{
+		Namespaces: []NamespaceUploadLimitConfig{{Namespace: "bulk/.*", MaxSessions: 1}},
+	}}
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	require.NoError(startClusterUpload(s.addr, "bulk/a", core.DigestFixture()))
+
+	err := startClusterUpload(s.addr, "bulk/b", core.DigestFixture())
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	// Other namespaces and internal transfers are not limited.
+	require.NoError(startClusterUpload(s.addr, "other/a", core.DigestFixture()))
+	blob := core.NewBlobFixture()
+	require.NoError(cp.Provide(s.host).TransferBlob(blob.Digest, bytes.NewReader(blob.Content)))
+}
+
+func TestIdleUploadSessionsExpire(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{Uploads: UploadLimitsConfig{MaxSessions: 1, SessionTTI: time.Minute}}
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	namespace := core.TagFixture()
+
+	require.NoError(startClusterUpload(s.addr, namespace, core.DigestFixture()))
+	err := startClusterUpload(s.addr, namespace, core.DigestFixture())
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	s.clk.Add(2 * time.Minute)
+
+	require.NoError(startClusterUpload(s.addr, namespace, core.DigestFixture()))
+	require.Len(getUploads(t, s.addr), 1)
+}
+
+func TestGetUploads(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	s := newTestServer(t, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	require.Empty(getUploads(t, s.addr))
+
+	namespace := core.TagFixture()
+	blob := core.SizedBlobFixture(256, 8)
+
+	uid, err := s.server.uploader.start(namespace, blob.Digest)
+	require.NoError(err)
+
+	s.clk.Add(time.Minute)
+
+	require.NoError(s.server.uploader.patch(
+		blob.Digest, uid, bytes.NewReader(blob.Content[:100]), 0, 100))
+
+	s.clk.Add(time.Second)
+
+	require.Equal([]uploadSessionInfo{{
+		UID:           uid,
+		Namespace:     namespace,
+		Digest:        blob.Digest,
+		BytesReceived: 100,
+		Age:           "1m1s",
+		Idle:          "1s",
+	}}, getUploads(t, s.addr))
+
+	require.NoError(s.server.uploader.abort(uid))
+	require.Empty(getUploads(t, s.addr))
+}
+
+func TestInvalidUploadLimits(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config UploadLimitsConfig
+	}{
+		{
+			"invalid regexp",
+			UploadLimitsConfig{
+				Namespaces: []NamespaceUploadLimitConfig{{Namespace: "(", MaxSessions: 1}},
+			},
+		}, {
+			"zero max sessions",
+			UploadLimitsConfig{
+				Namespaces: []NamespaceUploadLimitConfig{{Namespace: ".*"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := newUploader(test.config, nil, nil, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestReloadUploadLimits(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{Uploads: UploadLimitsConfig{
+		Namespaces: []NamespaceUploadLimitConfig{{Namespace: "bulk/.*", MaxSessions: 2}},
+	}}
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	require.NoError(startClusterUpload(s.addr, "bulk/a", core.DigestFixture()))
+
+	config.Uploads.Namespaces[0].MaxSessions = 1
+	require.NoError(s.server.Reload(config))
+
+	// Pending sessions count towards the reloaded limit.
+	err := startClusterUpload(s.addr, "bulk/b", core.DigestFixture())
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	require.NoError(s.server.Reload(Config{}))
+
+	require.NoError(startClusterUpload(s.addr, "bulk/b", core.DigestFixture()))
+}
+
+func TestReloadInvalidUploadLimitsKeepsLimits(t *testing.T) {
+	require := require.New(t)
+
+	cp := newTestClientProvider()
+
+	config := Config{Uploads: UploadLimitsConfig{MaxSessions: 1}}
+	s := newTestServerWithConfig(t, config, master1, hashRingMaxReplica(), cp)
+	defer s.cleanup()
+
+	require.Error(s.server.Reload(Config{Uploads: UploadLimitsConfig{
+		Namespaces: []NamespaceUploadLimitConfig{{Namespace: "bulk/.*", MaxSessions: 0}},
+	}}))
+
+	namespace := core.TagFixture()
+	require.NoError(startClusterUpload(s.addr, namespace, core.DigestFixture()))
+	err := startClusterUpload(s.addr, namespace, core.DigestFixture())
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+}
@@ -14,6 +14,7 @@
 package blobserver
 
 import (
+	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -55,7 +56,7 @@ func parseContentRange(h http.Header) (start, end int64, err error) {
 
 // blobExists returns true if cas has a cached blob for d.
 func blobExists(cas *store.CAStore, d core.Digest) (bool, error) {
-	if _, err := cas.GetCacheFileStat(d.Hex()); err != nil {
+	if _, err := cas.GetCacheFileStat(d.Name()); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
@@ -75,3 +76,29 @@ func setContentLength(w http.ResponseWriter, n int) {
 func setOctetStreamContentType(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/octet-stream-v1")
 }
+
+// osFile is implemented by cache file readers backed by an os.File which can
+// be served with sendfile.
+type osFile interface {
+	File() (*os.File, bool)
+}
+
+// countingResponseWriter counts the body bytes written to a response. It
+// forwards io.ReaderFrom to the underlying response, such that copies from
+// files still use sendfile.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.n += n
+	return n, err
+}
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//	http://www.apache.org/licenses/LICENSE-2.0
+//     http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -14,29 +14,47 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/debugserver"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/lease"
+	"github.com/uber/kraken/lib/maintenance"
 	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
 	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/lib/remoteconfig"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/storage/originstorage"
+	"github.com/uber/kraken/lib/torrent/swarmfetch"
+	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/log"
@@ -58,6 +76,7 @@ type Flags struct {
 	Zone               string
 	KrakenCluster      string
 	SecretsFile        string
+	ConfigOverlayFile  string
 }
 
 // ParseFlags parses origin CLI flags.
@@ -79,6 +98,9 @@ func ParseFlags() *Flags {
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
 		&flags.SecretsFile, "secrets", "", "path to a secrets YAML file to load into configuration")
+	flag.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file, e.g. with per-cluster settings, to merge on top of configuration")
 	flag.Parse()
 	return &flags
 }
@@ -126,11 +148,16 @@ func Run(flags *Flags, opts ...Option) {
 	if overrides.config != nil {
 		config = *overrides.config
 	} else {
-		if err := configutil.Load(flags.ConfigFile, &config); err != nil {
+		if err := configutil.Load(
+			flags.ConfigFile, &config,
+			configutil.WithOverlay(flags.ConfigOverlayFile),
+			configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 			panic(err)
 		}
 		if flags.SecretsFile != "" {
-			if err := configutil.Load(flags.SecretsFile, &config); err != nil {
+			if err := configutil.Load(
+				flags.SecretsFile, &config,
+				configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 				panic(err)
 			}
 		}
@@ -144,17 +171,43 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var closer io.Closer
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		var err error
+		stats, closer, err = metrics.New(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
-		stats = s
-		defer closer.Close()
 	}
+	flusher := metrics.NewFlusher(stats, closer)
+	defer flusher.Flush(metrics.ShutdownExit)
+	flusher.FlushOnSignals(syscall.SIGINT)
 
 	go metrics.EmitVersion(stats)
 
+	debugServer, err := debugserver.New(config.Debug, stats)
+	if err != nil {
+		log.Fatalf("Failed to init debug server: %s", err)
+	}
+	go debugServer.EmitWatermarks()
+	if config.Debug.Addr != "" {
+		go func() { flusher.Fatal(debugServer.ListenAndServe()) }()
+	}
+
+	tracingCloser, err := tracing.Init(config.Tracing, "kraken-origin")
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %s", err)
+	}
+	defer tracingCloser.Close()
+
+	if err := middleware.InitRecovery(config.Recovery, "kraken-origin"); err != nil {
+		log.Fatalf("Failed to init recovery: %s", err)
+	}
+
+	if err := featureflag.Init(config.FeatureFlags, "kraken-origin"); err != nil {
+		log.Fatalf("Failed to init feature flags: %s", err)
+	}
+
 	var hostname string
 	if flags.BlobServerHostName == "" {
 		var err error
@@ -196,11 +249,17 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating local db: %s", err)
 	}
 
+	writeBackExecutor, err := writeback.NewExecutor(
+		config.WriteBackExecutor, stats, cas, backendManager)
+	if err != nil {
+		log.Fatalf("Error creating write-back executor: %s", err)
+	}
+
 	writeBackManager, err := persistedretry.NewManager(
 		config.WriteBack,
 		stats,
 		writeback.NewStore(localDB),
-		writeback.NewExecutor(stats, cas, backendManager))
+		writeBackExecutor)
 	if err != nil {
 		log.Fatalf("Error creating write-back manager: %s", err)
 	}
@@ -210,30 +269,73 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error creating metainfo generator: %s", err)
 	}
 
-	blobRefresher := blobrefresh.New(config.BlobRefresh, stats, cas, backendManager, metaInfoGenerator)
-
-	netevents, err := networkevent.NewProducer(config.NetworkEvent)
+	netevents, err := networkevent.NewProducer(config.NetworkEvent, networkevent.WithStats(stats))
 	if err != nil {
 		log.Fatalf("Error creating network event producer: %s", err)
 	}
 
+	tls, err := config.TLS.BuildClient()
+	if err != nil {
+		log.Fatalf("Error building client tls config: %s", err)
+	}
+
+	var refresherOpts []blobrefresh.Option
+	if config.SwarmFetch.Enabled {
+		fetcher, err := newSwarmFetcher(config, flags, stats, netevents, tls, cas)
+		if err != nil {
+			log.Fatalf("Error creating swarm fetcher: %s", err)
+		}
+		refresherOpts = append(refresherOpts, blobrefresh.WithSwarmFetcher(fetcher))
+	}
+
+	blobRefresher, err := blobrefresh.New(
+		config.BlobRefresh, stats, cas, backendManager, metaInfoGenerator, refresherOpts...)
+	if err != nil {
+		log.Fatalf("Error creating blob refresher: %s", err)
+	}
+
+	egress := originstorage.NewEgressCounter()
+
 	sched, err := scheduler.NewOriginScheduler(
-		config.Scheduler, stats, pctx, cas, netevents, blobRefresher)
+		config.Scheduler, stats, pctx, cas, netevents, blobRefresher, egress)
 	if err != nil {
 		log.Fatalf("Error creating scheduler: %s", err)
 	}
 
+	var poller *remoteconfig.Poller
+	if config.RemoteConfig.URL != "" {
+		poller, err = remoteconfig.New(config.RemoteConfig, "origin", stats)
+		if err != nil {
+			log.Fatalf("Error creating remote config poller: %s", err)
+		}
+		featureflag.Global().SetRemote(poller)
+		poller.Subscribe("scheduler", func(section json.RawMessage) error {
+			c := config.Scheduler
+			if err := remoteconfig.Merge(section, &c); err != nil {
+				return err
+			}
+			sched.Reload(c)
+			return nil
+		})
+		poller.Subscribe("tracing", tracing.GlobalSampling().ApplyRemote)
+	}
+
 	cluster, err := hostlist.New(config.Cluster)
 	if err != nil {
 		log.Fatalf("Error creating cluster host list: %s", err)
 	}
 
-	tls, err := config.TLS.BuildClient()
+	originRouter, err := blobclient.NewRouter(config.OriginRoute)
 	if err != nil {
-		log.Fatalf("Error building client tls config: %s", err)
+		log.Fatalf("Error creating origin router: %s", err)
 	}
+	originOpts := []blobclient.Option{blobclient.WithTLS(tls), blobclient.WithRouter(originRouter)}
 
-	healthCheckFilter := healthcheck.NewFilter(config.HealthCheck, healthcheck.Default(tls))
+	healthCheckFilter := healthcheck.NewFilter(
+		config.HealthCheck,
+		blobclient.NewHealthChecker(originOpts...),
+		healthcheck.WithStateChangeHook(
+			healthcheck.LogStateChanges(stats.SubScope("cluster"))))
 
 	hashRing := hashring.New(
 		config.HashRing,
@@ -258,6 +360,31 @@ func Run(flags *Flags, opts ...Option) {
 		}
 	}
 
+	leases, err := lease.NewManager(
+		config.Leases, stats, cas, leaseFetcher(cas, blobRefresher))
+	if err != nil {
+		log.Fatalf("Error creating lease manager: %s", err)
+	}
+
+	serverOpts := []blobserver.Option{
+		blobserver.WithMaintenance(
+			maintenance.New(config.Maintenance, stats, writeBackManager)),
+		blobserver.WithLeases(leases),
+	}
+	if len(config.BlobServer.Ingest.Rules) > 0 {
+		// Derived digests are recorded in build-index, such that replicas and
+		// clients can look them up.
+		buildIndexes, err := config.BuildIndex.Build(
+			upstream.WithHealthCheck(healthcheck.Default(tls)),
+			upstream.WithStats(stats.SubScope("build_index")),
+			upstream.WithLocalZone(flags.Zone))
+		if err != nil {
+			log.Fatalf("Error building build-index host list for ingest hooks: %s", err)
+		}
+		serverOpts = append(
+			serverOpts, blobserver.WithTagClient(tagclient.NewClusterClient(buildIndexes, tls)))
+	}
+
 	server, err := blobserver.New(
 		config.BlobServer,
 		stats,
@@ -265,29 +392,57 @@ func Run(flags *Flags, opts ...Option) {
 		addr,
 		hashRing,
 		cas,
-		blobclient.NewProvider(blobclient.WithTLS(tls)),
-		blobclient.NewClusterProvider(blobclient.WithTLS(tls)),
+		blobclient.NewProvider(originOpts...),
+		blobclient.NewClusterProvider(originOpts...),
 		pctx,
 		backendManager,
 		blobRefresher,
 		metaInfoGenerator,
-		writeBackManager)
+		writeBackManager,
+		egress,
+		serverOpts...)
 	if err != nil {
 		log.Fatalf("Error initializing blob server: %s", err)
 	}
 
-	h := addTorrentDebugEndpoints(server.Handler(), sched)
+	if poller != nil {
+		poller.Subscribe("blobserver", func(section json.RawMessage) error {
+			c := config.BlobServer
+			if err := remoteconfig.Merge(section, &c); err != nil {
+				return err
+			}
+			return server.Reload(c)
+		})
+		go poller.Run()
+	}
 
-	go func() { log.Fatal(server.ListenAndServe(h)) }()
+	h := addTorrentDebugEndpoints(server.Handler(), sched)
 
-	log.Info("Starting nginx...")
-	log.Fatal(nginx.Run(
-		config.Nginx,
-		map[string]interface{}{
-			"port":   flags.BlobServerPort,
-			"server": nginx.GetServer(config.BlobServer.Listener.Net, config.BlobServer.Listener.Addr),
-		},
-		nginx.WithTLS(config.TLS)))
+	go func() { flusher.Fatal(server.ListenAndServe(h)) }()
+
+	nginxErr := make(chan error, 1)
+	go func() {
+		log.Info("Starting nginx...")
+		nginxErr <- nginx.Run(
+			config.Nginx,
+			map[string]interface{}{
+				"port":   flags.BlobServerPort,
+				"server": nginx.GetServer(config.BlobServer.Listener.Net, config.BlobServer.Listener.Addr),
+			},
+			nginx.WithTLS(config.TLS))
+	}()
+
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM)
+
+	select {
+	case err := <-nginxErr:
+		flusher.Fatal(err)
+	case <-sigterm:
+		log.Info("Received SIGTERM, shutting down...")
+		shutdown(config.Shutdown, server, writeBackManager)
+		flusher.Flush("sigterm")
+	}
 }
 
 // addTorrentDebugEndpoints mounts experimental debugging endpoints which are
@@ -308,3 +463,62 @@ func addTorrentDebugEndpoints(h http.Handler, sched scheduler.ReloadableSchedule
 
 	return r
 }
+
+// newSwarmFetcher creates a swarmfetch.Fetcher which leeches blobs from agents
+// into cas through a dedicated scheduler. The scheduler listens on its own port
+// and announces as a regular peer, so agents treat it like any other leecher.
+func newSwarmFetcher(
+	config Config,
+	flags *Flags,
+	stats tally.Scope,
+	netevents networkevent.Producer,
+	tls *tls.Config,
+	cas *store.CAStore) (*swarmfetch.Fetcher, error) {
+
+	if config.SwarmFetch.PeerPort == 0 {
+		return nil, errors.New("peer_port required")
+	}
+	if config.SwarmFetch.PeerPort == flags.PeerPort {
+		return nil, errors.New("peer_port must differ from the origin peer port")
+	}
+	pctx, err := core.NewPeerContext(
+		config.PeerIDFactory, flags.Zone, flags.KrakenCluster, flags.PeerIP,
+		config.SwarmFetch.PeerPort, false)
+	if err != nil {
+		return nil, fmt.Errorf("peer context: %s", err)
+	}
+	cads, err := store.NewCADownloadStore(config.SwarmFetch.CADownloadStore, stats)
+	if err != nil {
+		return nil, fmt.Errorf("download store: %s", err)
+	}
+	trackers, err := config.SwarmFetch.Tracker.Build(hashring.WithLocalZone(pctx.Zone))
+	if err != nil {
+		return nil, fmt.Errorf("tracker upstream: %s", err)
+	}
+	go trackers.Monitor(nil)
+
+	announceClient := announceclient.New(
+		pctx, trackers, tls, announceclient.WithConfig(config.SwarmFetch.AnnounceClient))
+	sched, err := scheduler.NewSwarmFetchScheduler(
+		config.SwarmFetch.Scheduler, stats.SubScope("swarm_fetch"), pctx, cads, netevents,
+		trackers, announceClient, tls)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: %s", err)
+	}
+	return swarmfetch.New(config.SwarmFetch, stats, announceClient, sched, cads, cas), nil
+}
+
+// leaseFetcher downloads leased blobs which are not cached from the storage
+// backend. Fetches return blobrefresh.ErrPending until the download finished,
+// and are retried by the lease manager.
+func leaseFetcher(cas *store.CAStore, blobRefresher *blobrefresh.Refresher) lease.FetchFunc {
+	return func(namespace string, d core.Digest) error {
+		if _, err := cas.GetCacheFileStat(d.Name()); err == nil {
+			return nil
+		}
+		if err := blobRefresher.Refresh(context.Background(), namespace, d); err != nil {
+			return err
+		}
+		return blobrefresh.ErrPending
+	}
+}
@@ -17,18 +17,29 @@ import (
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/blobrefresh"
+	"github.com/uber/kraken/lib/debugserver"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/healthcheck"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/lib/lease"
+	"github.com/uber/kraken/lib/maintenance"
 	"github.com/uber/kraken/lib/metainfogen"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/lib/persistedretry/writeback"
+	"github.com/uber/kraken/lib/remoteconfig"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/torrent/networkevent"
 	"github.com/uber/kraken/lib/torrent/scheduler"
+	"github.com/uber/kraken/lib/torrent/swarmfetch"
+	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/localdb"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -48,6 +59,7 @@ type Config struct {
 	NetworkEvent   networkevent.Config      `yaml:"network_event"`
 	PeerIDFactory  core.PeerIDFactory       `yaml:"peer_id_factory"`
 	Metrics        metrics.Config           `yaml:"metrics"`
+	Tracing        tracing.Config           `yaml:"tracing"`
 	MetaInfoGen    metainfogen.Config       `yaml:"metainfogen"`
 	BackendManager backend.ManagerConfig    `yaml:"backend_manager"`
 	Backends       []backend.Config         `yaml:"backends"`
@@ -57,4 +69,38 @@ type Config struct {
 	WriteBack      persistedretry.Config    `yaml:"writeback"`
 	Nginx          nginx.Config             `yaml:"nginx"`
 	TLS            httputil.TLSConfig       `yaml:"tls"`
+	OriginRoute    blobclient.RouteConfig   `yaml:"origin_route"`
+	RemoteConfig   remoteconfig.Config      `yaml:"remote_config"`
+
+	// WriteBackExecutor configures throttling and coalescing of write-back
+	// uploads to the storage backend.
+	WriteBackExecutor writeback.Config `yaml:"writeback_executor"`
+
+	// Recovery configures crash bundles written when a handler panics.
+	Recovery middleware.RecoveryConfig `yaml:"recovery"`
+
+	// FeatureFlags configures flags gating new behaviors. Flags can be
+	// overridden at runtime through /x/config/flags.
+	FeatureFlags featureflag.Config `yaml:"feature_flags"`
+
+	// Maintenance configures read-only mode, which can be toggled at runtime
+	// through /x/maintenance.
+	Maintenance maintenance.Config `yaml:"maintenance"`
+
+	// Shutdown configures graceful shutdown on SIGTERM.
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+
+	// Debug configures the localhost-only listener serving pprof and expvar.
+	Debug debugserver.Config `yaml:"debug"`
+
+	// Leases configures leases, which keep blobs available until a deadline.
+	Leases lease.Config `yaml:"leases"`
+
+	// BuildIndex configures the build-indexes in which ingest hooks record
+	// the digests of derived blobs. Required if ingest hooks are configured.
+	BuildIndex upstream.ActiveConfig `yaml:"build_index"`
+
+	// SwarmFetch configures downloading missing blobs from the peer swarm of
+	// agents before falling back to the backend.
+	SwarmFetch swarmfetch.Config `yaml:"swarm_fetch"`
 }
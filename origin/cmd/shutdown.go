@@ -0,0 +1,82 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/uber/kraken/lib/persistedretry"
+	"github.com/uber/kraken/origin/blobserver"
+	"github.com/uber/kraken/utils/log"
+)
+
+// ShutdownConfig defines graceful shutdown configuration. On SIGTERM, the
+// origin enters lame-duck mode, drains in-flight transfers, and flushes queued
+// write-back tasks before exiting.
+type ShutdownConfig struct {
+	// LameDuckPeriod is how long health checks fail before draining starts,
+	// such that hash ring consumers stop routing to the origin. Should be at
+	// least the hash ring refresh interval times the health check fails
+	// threshold of consumers.
+	LameDuckPeriod time.Duration `yaml:"lame_duck_period"`
+
+	// DrainTimeout bounds waiting for in-flight requests and uploads.
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+
+	// WriteBackFlushTimeout bounds waiting for queued write-back tasks.
+	// Unfinished tasks are retried after restart.
+	WriteBackFlushTimeout time.Duration `yaml:"writeback_flush_timeout"`
+}
+
+func (c ShutdownConfig) applyDefaults() ShutdownConfig {
+	if c.LameDuckPeriod == 0 {
+		c.LameDuckPeriod = 30 * time.Second
+	}
+	if c.DrainTimeout == 0 {
+		c.DrainTimeout = time.Minute
+	}
+	if c.WriteBackFlushTimeout == 0 {
+		c.WriteBackFlushTimeout = 2 * time.Minute
+	}
+	return c
+}
+
+// shutdown gracefully stops server and writeBackManager.
+func shutdown(
+	config ShutdownConfig, server *blobserver.Server, writeBackManager persistedretry.Manager) {
+
+	config = config.applyDefaults()
+
+	server.StartLameDuck()
+	log.Infof("Waiting %s for hash ring consumers to stop routing to origin", config.LameDuckPeriod)
+	time.Sleep(config.LameDuckPeriod)
+
+	log.Info("Draining in-flight transfers...")
+	ctx, cancel := context.WithTimeout(context.Background(), config.DrainTimeout)
+	if err := server.Drain(ctx); err != nil {
+		log.Errorf("Error draining blob server: %s", err)
+	}
+	cancel()
+
+	log.Info("Flushing write-back tasks...")
+	ctx, cancel = context.WithTimeout(context.Background(), config.WriteBackFlushTimeout)
+	if err := writeBackManager.Flush(ctx); err != nil {
+		log.Errorf("Error flushing write-back tasks: %s", err)
+	}
+	cancel()
+
+	writeBackManager.Close()
+	log.Info("Shutdown complete")
+}
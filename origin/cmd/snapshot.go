@@ -0,0 +1,106 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/utils/configutil"
+)
+
+// Cache snapshot commands.
+const (
+	ExportCacheCommand = "export-cache"
+	ImportCacheCommand = "import-cache"
+)
+
+// SnapshotFlags defines origin cache snapshot CLI flags.
+type SnapshotFlags struct {
+	ConfigFile        string
+	ConfigOverlayFile string
+	Dir               string
+}
+
+// ParseSnapshotFlags parses the flags of a cache snapshot command from args.
+func ParseSnapshotFlags(command string, args []string) *SnapshotFlags {
+	var flags SnapshotFlags
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(
+		&flags.ConfigFile, "config", "", "configuration file path")
+	fs.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file to merge on top of configuration")
+	fs.StringVar(
+		&flags.Dir, "dir", "",
+		"snapshot directory, which must be on the same filesystem as the cache directory")
+	fs.Parse(args)
+	return &flags
+}
+
+// RunSnapshot runs a cache snapshot command, exiting non-zero on failure.
+// export-cache hardlinks the cache of an origin, which may be running, into a
+// snapshot directory. import-cache moves a snapshot into the cache of an origin
+// which is not running yet, such that replacement origins start pre-warmed.
+func RunSnapshot(command string, flags *SnapshotFlags) {
+	if flags.Dir == "" {
+		panic("must specify -dir")
+	}
+	var config Config
+	if err := configutil.Load(
+		flags.ConfigFile, &config,
+		configutil.WithOverlay(flags.ConfigOverlayFile),
+		configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
+		panic(err)
+	}
+
+	switch command {
+	case ExportCacheCommand:
+		manifest, err := store.ExportCacheSnapshot(config.CAStore, flags.Dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting cache: %s\n", err)
+			os.Exit(1)
+		}
+		var size int64
+		for _, f := range manifest.Files {
+			size += f.Size
+		}
+		fmt.Printf("Exported %d files (%d bytes) to %s\n", len(manifest.Files), size, flags.Dir)
+	case ImportCacheCommand:
+		result, err := store.ImportCacheSnapshot(config.CAStore, flags.Dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error importing cache: %s\n", err)
+			os.Exit(1)
+		}
+		var failed []string
+		for name := range result.Failures {
+			failed = append(failed, name)
+		}
+		sort.Strings(failed)
+		for _, name := range failed {
+			fmt.Fprintf(os.Stderr, "Failed to import %s: %s\n", name, result.Failures[name])
+		}
+		fmt.Printf(
+			"Imported %d files (%d bytes), skipped %d existing files, %d failed\n",
+			result.Imported, result.Bytes, result.Existing, len(failed))
+		if len(failed) > 0 {
+			os.Exit(1)
+		}
+	default:
+		panic(fmt.Sprintf("unknown command %q", command))
+	}
+}
@@ -14,6 +14,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/uber/kraken/origin/cmd"
 
 	// Import all backend client packages to register them with backend manager.
@@ -26,5 +28,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch command := os.Args[1]; command {
+		case cmd.ExportCacheCommand, cmd.ImportCacheCommand:
+			cmd.RunSnapshot(command, cmd.ParseSnapshotFlags(command, os.Args[2:]))
+			return
+		}
+	}
 	cmd.Run(cmd.ParseFlags())
 }
@@ -17,20 +17,28 @@ import (
 	"flag"
 
 	"fmt"
+	"io"
 	"net/http"
+	"syscall"
 
 	"github.com/uber/kraken/build-index/tagclient"
 	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/encryption"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/proxy/proxyserver"
+	"github.com/uber/kraken/proxy/pushjobs"
 	"github.com/uber/kraken/proxy/registryoverride"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/configutil"
 	"github.com/uber/kraken/utils/flagutil"
+	"github.com/uber/kraken/utils/listener"
 	"github.com/uber/kraken/utils/log"
 
 	"github.com/uber-go/tally"
@@ -39,11 +47,13 @@ import (
 
 // Flags defines proxy CLI flags.
 type Flags struct {
-	Ports         flagutil.Ints
-	ServerPort    int
-	ConfigFile    string
-	KrakenCluster string
-	SecretsFile   string
+	Ports             flagutil.Ints
+	ServerPort        int
+	ConfigFile        string
+	Zone              string
+	KrakenCluster     string
+	SecretsFile       string
+	ConfigOverlayFile string
 }
 
 // ParseFlags parses proxy CLI flags.
@@ -55,10 +65,15 @@ func ParseFlags() *Flags {
 		&flags.ServerPort, "server-port", 0, "http server port to listen on")
 	flag.StringVar(
 		&flags.ConfigFile, "config", "", "configuration file path")
+	flag.StringVar(
+		&flags.Zone, "zone", "", "zone/datacenter name")
 	flag.StringVar(
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
 		&flags.SecretsFile, "secrets", "", "path to a secrets YAML file to load into configuration")
+	flag.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file, e.g. with per-cluster settings, to merge on top of configuration")
 	flag.Parse()
 	return &flags
 }
@@ -103,11 +118,16 @@ func Run(flags *Flags, opts ...Option) {
 	if overrides.config != nil {
 		config = *overrides.config
 	} else {
-		if err := configutil.Load(flags.ConfigFile, &config); err != nil {
+		if err := configutil.Load(
+			flags.ConfigFile, &config,
+			configutil.WithOverlay(flags.ConfigOverlayFile),
+			configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 			panic(err)
 		}
 		if flags.SecretsFile != "" {
-			if err := configutil.Load(flags.SecretsFile, &config); err != nil {
+			if err := configutil.Load(
+				flags.SecretsFile, &config,
+				configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 				panic(err)
 			}
 		}
@@ -121,17 +141,34 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var closer io.Closer
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		var err error
+		stats, closer, err = metrics.New(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
-		stats = s
-		defer closer.Close()
 	}
+	flusher := metrics.NewFlusher(stats, closer)
+	defer flusher.Flush(metrics.ShutdownExit)
+	flusher.FlushOnSignals(syscall.SIGTERM, syscall.SIGINT)
 
 	go metrics.EmitVersion(stats)
 
+	tracingCloser, err := tracing.Init(config.Tracing, "kraken-proxy")
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %s", err)
+	}
+	defer tracingCloser.Close()
+
+	if err := middleware.InitRecovery(config.Recovery, "kraken-proxy"); err != nil {
+		log.Fatalf("Failed to init recovery: %s", err)
+	}
+
+	if err := featureflag.Init(config.FeatureFlags, "kraken-proxy"); err != nil {
+		log.Fatalf("Failed to init feature flags: %s", err)
+	}
+
 	cas, err := store.NewCAStore(config.CAStore, stats)
 	if err != nil {
 		log.Fatalf("Failed to create store: %s", err)
@@ -142,53 +179,129 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building client tls config: %s", err)
 	}
 
-	origins, err := config.Origin.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
+	originRouter, err := blobclient.NewRouter(config.OriginRoute)
+	if err != nil {
+		log.Fatalf("Error creating origin router: %s", err)
+	}
+	originOpts := []blobclient.Option{blobclient.WithTLS(tls), blobclient.WithRouter(originRouter)}
+
+	origins, err := config.Origin.Build(
+		upstream.WithHealthCheck(blobclient.NewHealthChecker(originOpts...)),
+		upstream.WithStats(stats.SubScope("origin")),
+		upstream.WithLocalZone(flags.Zone))
 	if err != nil {
 		log.Fatalf("Error building origin host list: %s", err)
 	}
 
-	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originCluster := blobclient.NewClusterClient(r)
+	r := blobclient.NewClientResolver(blobclient.NewProvider(originOpts...), origins)
+	originCluster := blobclient.NewClusterClient(
+		r, blobclient.WithLocalZone(flags.Zone, config.Origin.Zones))
 
-	buildIndexes, err := config.BuildIndex.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
+	buildIndexes, err := config.BuildIndex.Build(
+		upstream.WithHealthCheck(healthcheck.Default(tls)),
+		upstream.WithStats(stats.SubScope("build_index")),
+		upstream.WithLocalZone(flags.Zone))
 	if err != nil {
 		log.Fatalf("Error building build-index host list: %s", err)
 	}
 
 	tagClient := tagclient.NewClusterClient(buildIndexes, tls)
 
-	transferer := transfer.NewReadWriteTransferer(stats, tagClient, originCluster, cas)
+	var transferer transfer.ImageTransferer = transfer.NewReadWriteTransferer(
+		stats, tagClient, originCluster, cas)
+
+	if config.Encryption.Enabled() {
+		keys, err := encryption.NewKeyring(config.Encryption)
+		if err != nil {
+			log.Fatalf("Error creating encryption keyring: %s", err)
+		}
+		transferer = transfer.NewEncryptingTransferer(transferer, stats, keys)
+	}
 
 	// Open preheat function only if server-port was defined.
 	if flags.ServerPort != 0 {
-		server := proxyserver.New(stats, originCluster)
+		server := proxyserver.New(config.ProxyServer, stats, originCluster)
 		addr := fmt.Sprintf(":%d", flags.ServerPort)
 		log.Infof("Starting http server on %s", addr)
 		go func() {
-			log.Fatal(http.ListenAndServe(addr, server.Handler()))
+			flusher.Fatal(http.ListenAndServe(addr, server.Handler()))
 		}()
 	}
 
-	registry, err := config.Registry.Build(config.Registry.ReadWriteParameters(transferer, cas, stats))
-	if err != nil {
-		log.Fatalf("Error creating registry: %s", err)
+	var pushJobs *pushjobs.Manager
+	if config.PushJobs.Enabled {
+		pushJobs = pushjobs.NewManager(config.PushJobs, stats, transferer, cas)
+		transferer = pushJobs
 	}
-	go func() {
-		log.Info("Starting registry...")
-		log.Fatal(registry.ListenAndServe())
-	}()
 
-	ros := registryoverride.NewServer(config.RegistryOverride, tagClient)
-	go func() {
-		log.Fatal(ros.ListenAndServe())
-	}()
+	registryParams := config.Registry.ReadWriteParameters(transferer, cas, stats)
+
+	var nginxParams map[string]interface{}
+	if config.RegistryOverride.FullAPI {
+		// The registry, push jobs and overrides are all served by the registry
+		// override server.
+		registry, err := config.Registry.BuildServer(registryParams)
+		if err != nil {
+			log.Fatalf("Error creating registry: %s", err)
+		}
+		h := registry.Handler()
+		if pushJobs != nil {
+			h = pushjobs.NewLocalServer(config.PushJobs, stats, pushJobs, h).Handler()
+		}
+		ros, err := registryoverride.NewServer(
+			config.RegistryOverride, stats, tagClient, registryoverride.WithRegistry(h))
+		if err != nil {
+			log.Fatalf("Error creating registry override server: %s", err)
+		}
+		go func() {
+			flusher.Fatal(ros.ListenAndServe())
+		}()
+
+		server := nginx.GetServer(
+			config.RegistryOverride.Listener.Net, config.RegistryOverride.Listener.Addr)
+		nginxParams = map[string]interface{}{
+			"ports":                    flags.Ports,
+			"registry_server":          server,
+			"registry_override_server": server,
+		}
+	} else {
+		registry, err := config.Registry.Build(registryParams)
+		if err != nil {
+			log.Fatalf("Error creating registry: %s", err)
+		}
+		go func() {
+			log.Info("Starting registry...")
+			flusher.Fatal(registry.ListenAndServe())
+		}()
+
+		ros, err := registryoverride.NewServer(config.RegistryOverride, stats, tagClient)
+		if err != nil {
+			log.Fatalf("Error creating registry override server: %s", err)
+		}
+		go func() {
+			flusher.Fatal(ros.ListenAndServe())
+		}()
+
+		nginxParams = map[string]interface{}{
+			"ports": flags.Ports,
+			"registry_server": nginx.GetServer(
+				config.Registry.Docker.HTTP.Net, config.Registry.Docker.HTTP.Addr),
+			"registry_override_server": nginx.GetServer(
+				config.RegistryOverride.Listener.Net, config.RegistryOverride.Listener.Addr),
+		}
+		if pushJobs != nil {
+			pjs := pushjobs.NewServer(config.PushJobs, stats, pushJobs, listener.Config{
+				Net:  config.Registry.Docker.HTTP.Net,
+				Addr: config.Registry.Docker.HTTP.Addr,
+			})
+			go func() {
+				flusher.Fatal(pjs.ListenAndServe())
+			}()
+			nginxParams["push_jobs_server"] = nginx.GetServer(
+				config.PushJobs.Listener.Net, config.PushJobs.Listener.Addr)
+		}
+	}
 
 	log.Info("Starting nginx...")
-	log.Fatal(nginx.Run(config.Nginx, map[string]interface{}{
-		"ports": flags.Ports,
-		"registry_server": nginx.GetServer(
-			config.Registry.Docker.HTTP.Net, config.Registry.Docker.HTTP.Addr),
-		"registry_override_server": nginx.GetServer(
-			config.RegistryOverride.Listener.Net, config.RegistryOverride.Listener.Addr)},
-		nginx.WithTLS(config.TLS)))
+	flusher.Fatal(nginx.Run(config.Nginx, nginxParams, nginx.WithTLS(config.TLS)))
 }
@@ -15,11 +15,18 @@ package cmd
 
 import (
 	"github.com/uber/kraken/lib/dockerregistry"
+	"github.com/uber/kraken/lib/encryption"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/lib/store"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/proxy/proxyserver"
+	"github.com/uber/kraken/proxy/pushjobs"
 	"github.com/uber/kraken/proxy/registryoverride"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/httputil"
 
 	"go.uber.org/zap"
@@ -31,9 +38,25 @@ type Config struct {
 	Registry         dockerregistry.Config   `yaml:"registry"`
 	BuildIndex       upstream.ActiveConfig   `yaml:"build_index"`
 	Origin           upstream.ActiveConfig   `yaml:"origin"`
+	OriginRoute      blobclient.RouteConfig  `yaml:"origin_route"`
 	ZapLogging       zap.Config              `yaml:"zap"`
 	Metrics          metrics.Config          `yaml:"metrics"`
+	Tracing          tracing.Config          `yaml:"tracing"`
 	RegistryOverride registryoverride.Config `yaml:"registryoverride"`
 	Nginx            nginx.Config            `yaml:"nginx"`
 	TLS              httputil.TLSConfig      `yaml:"tls"`
+	ProxyServer      proxyserver.Config      `yaml:"proxyserver"`
+
+	// Recovery configures crash bundles written when a handler panics.
+	Recovery middleware.RecoveryConfig `yaml:"recovery"`
+
+	// FeatureFlags configures flags gating new behaviors. Flags can be
+	// overridden at runtime through /x/config/flags.
+	FeatureFlags featureflag.Config `yaml:"feature_flags"`
+
+	// PushJobs configures asynchronous acknowledgement of pushes.
+	PushJobs pushjobs.Config `yaml:"push_jobs"`
+
+	// Encryption configures namespaces whose blobs are encrypted on push.
+	Encryption encryption.Config `yaml:"encryption"`
 }
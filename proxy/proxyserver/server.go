@@ -20,23 +20,35 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/uber-go/tally"
+	"github.com/uber/kraken/lib/buildinfo"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/handler"
 )
 
+// Config defines Server configuration.
+type Config struct {
+	// Authz restricts endpoints, e.g. /x/config/flags/, to client identities.
+	Authz middleware.AuthzConfig `yaml:"authz"`
+}
+
 // Server defines the proxy HTTP server.
 type Server struct {
+	config         Config
 	stats          tally.Scope
 	preheatHandler *PreheatHandler
 }
 
 // New creates a new Server.
 func New(
+	config Config,
 	stats tally.Scope,
 	client blobclient.ClusterClient) *Server {
 
 	return &Server{
+		config,
 		stats.Tagged(map[string]string{"module": "proxyserver"}),
 		NewPreheatHandler(client)}
 }
@@ -47,11 +59,19 @@ func (s *Server) Handler() http.Handler {
 
 	r.Use(middleware.StatusCounter(s.stats))
 	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Recovery(s.stats))
+	// Flag overrides are restricted to identities allowed by authz rules.
+	r.Use(middleware.Authorize(s.config.Authz, s.stats, "/x/config/flags/"))
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
+	r.Get("/version", buildinfo.Handler(buildinfo.Proxy))
 
 	r.Post("/registry/notifications", handler.Wrap(s.preheatHandler.Handle))
 
+	r.Mount("/x/config/flags", featureflag.Handler())
+	r.Mount("/x/config/tracing", tracing.Handler())
+
 	// Serves /debug/pprof endpoints.
 	r.Mount("/", http.DefaultServeMux)
 
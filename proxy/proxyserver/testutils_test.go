@@ -44,7 +44,7 @@ func newServerMocks(t *testing.T) (*serverMocks, func()) {
 }
 
 func (m *serverMocks) startServer() string {
-	s := New(tally.NoopScope, m.originClient)
+	s := New(Config{}, tally.NoopScope, m.originClient)
 	addr, stop := testutil.StartServer(s.Handler())
 	m.cleanup.Add(stop)
 	return addr
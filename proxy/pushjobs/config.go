@@ -0,0 +1,48 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pushjobs
+
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/listener"
+)
+
+// Config defines asynchronous push configuration.
+type Config struct {
+	// Enabled acknowledges manifest pushes with 202 and a job ID before the
+	// image reaches origins, instead of blocking until all blobs are uploaded
+	// and the tag is replicated.
+	Enabled bool `yaml:"enabled"`
+
+	// Listener is where the push job server listens. Nginx routes manifest
+	// and job status requests to it.
+	Listener listener.Config `yaml:"listener"`
+
+	// Workers is the number of blobs uploaded to origins in parallel.
+	Workers int `yaml:"workers"`
+
+	// Retention is how long finished jobs and uploads are remembered.
+	Retention time.Duration `yaml:"retention"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Workers == 0 {
+		c.Workers = 16
+	}
+	if c.Retention == 0 {
+		c.Retention = time.Hour
+	}
+	return c
+}
@@ -0,0 +1,500 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pushjobs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/store"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/docker/distribution/uuid"
+	"github.com/uber-go/tally"
+)
+
+// Job and blob states.
+const (
+	StatePending = "pending"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateFailed  = "failed"
+	StateSkipped = "skipped"
+	StateUnknown = "unknown"
+)
+
+// BlobStatus reports the progress of a single blob of a push job.
+type BlobStatus struct {
+	Digest core.Digest `json:"digest"`
+
+	// Upload is the state of the upload to origins. Blobs which were not
+	// uploaded through this proxy recently, e.g. because Docker found them
+	// already present, are skipped, and the job fails unless origins have
+	// them.
+	Upload string `json:"upload"`
+
+	// WriteBack is the state of origins persisting the blob to the storage
+	// backend. It is pending until the blob is on origins.
+	WriteBack string `json:"write_back,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Status reports the progress of a push job.
+type Status struct {
+	ID     string      `json:"id"`
+	Tag    string      `json:"tag"`
+	Digest core.Digest `json:"digest"`
+	State  string      `json:"state"`
+
+	// Layers covers every blob of the image: its layers, its config and the
+	// manifest itself.
+	Layers []BlobStatus `json:"layers"`
+
+	// TagPut is the state of putting the tag to build-index.
+	TagPut string `json:"tag_put"`
+
+	// Replication is the state of replicating the tag to remote clusters,
+	// which build-index starts once the tag is put. Remotes reports each
+	// remote cluster.
+	Replication string                              `json:"replication"`
+	Remotes     []tagmodels.RemoteReplicationStatus `json:"remotes,omitempty"`
+
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type upload struct {
+	namespace string
+	state     string
+	err       error
+	finished  time.Time
+	done      chan struct{}
+}
+
+type jobBlob struct {
+	digest core.Digest
+
+	// upload is nil if the blob was not uploaded through m.
+	upload *upload
+
+	// err is set if upload is nil and origins do not have the blob.
+	err error
+
+	// writtenBack is set once origins reported the blob as persisted, such
+	// that they are not asked again.
+	writtenBack bool
+}
+
+type job struct {
+	id       string
+	tag      string
+	digest   core.Digest
+	blobs    []jobBlob
+	state    string
+	tagPut   string
+	err      error
+	created  time.Time
+	finished time.Time
+}
+
+// Manager is an ImageTransferer which uploads blobs to origins in the
+// background and puts tags once all blobs of their manifest are on origins,
+// tracking each tag put as a job. Jobs are kept in memory and are lost if the
+// proxy restarts.
+type Manager struct {
+	transfer.ImageTransferer
+
+	config Config
+	stats  tally.Scope
+	cas    *store.CAStore
+	clk    clock.Clock
+	sem    chan struct{}
+
+	// originStat checks whether origins have blobs which were not uploaded
+	// through m.
+	originStat func(namespace string, d core.Digest) (*core.BlobInfo, error)
+
+	// writeBackState and replicationStatus are nil if the wrapped
+	// ImageTransferer cannot report write-back and replication.
+	writeBackState    func(namespace string, d core.Digest) (blobclient.WriteBackState, error)
+	replicationStatus func(tag string) (tagmodels.ReplicationStatus, error)
+
+	mu      sync.Mutex
+	uploads map[string]*upload // Keyed by uploadKey.
+	jobs    map[string]*job
+	claims  map[string]string
+}
+
+// Option allows setting optional Manager parameters.
+type Option func(*Manager)
+
+// WithClock configures a Manager with a custom clock.
+func WithClock(clk clock.Clock) Option {
+	return func(m *Manager) { m.clk = clk }
+}
+
+// NewManager creates a new Manager which wraps transferer. Uploaded blobs are
+// read from the cache of cas.
+func NewManager(
+	config Config,
+	stats tally.Scope,
+	transferer transfer.ImageTransferer,
+	cas *store.CAStore,
+	opts ...Option) *Manager {
+
+	config = config.applyDefaults()
+	stats = stats.Tagged(map[string]string{"module": "pushjobs"})
+
+	m := &Manager{
+		ImageTransferer: transferer,
+		config:          config,
+		stats:           stats,
+		cas:             cas,
+		clk:             clock.New(),
+		sem:             make(chan struct{}, config.Workers),
+		uploads:         make(map[string]*upload),
+		jobs:            make(map[string]*job),
+		claims:          make(map[string]string),
+	}
+	m.originStat = transferer.Stat
+	if s, ok := transferer.(transfer.OriginStater); ok {
+		m.originStat = s.OriginStat
+	}
+	if s, ok := transferer.(transfer.WriteBackStater); ok {
+		m.writeBackState = s.WriteBackState
+	}
+	if s, ok := transferer.(transfer.ReplicationStater); ok {
+		m.replicationStatus = s.ReplicationStatus
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Upload starts uploading d to origins in the background. The blob must be in
+// the cache of m's CAStore, from which it is read again, so blob is unused.
+func (m *Manager) Upload(namespace string, d core.Digest, blob store.FileReader) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.startUpload(namespace, d)
+	return nil
+}
+
+// uploadKey keys uploads by namespace as well as digest, since the same blob
+// pushed to two repos must be uploaded to origins under both namespaces.
+func uploadKey(namespace string, d core.Digest) string {
+	return namespace + ":" + d.Name()
+}
+
+// startUpload must be called with mu held.
+func (m *Manager) startUpload(namespace string, d core.Digest) *upload {
+	key := uploadKey(namespace, d)
+	if u, ok := m.uploads[key]; ok && u.state != StateFailed {
+		return u
+	}
+	u := &upload{namespace: namespace, state: StatePending, done: make(chan struct{})}
+	m.uploads[key] = u
+	go m.runUpload(d, u)
+	return u
+}
+
+func (m *Manager) runUpload(d core.Digest, u *upload) {
+	m.sem <- struct{}{}
+	defer func() { <-m.sem }()
+
+	m.mu.Lock()
+	u.state = StateRunning
+	m.mu.Unlock()
+
+	err := m.uploadFromCache(u.namespace, d)
+
+	m.mu.Lock()
+	if err != nil {
+		log.With("digest", d).Errorf("Error uploading blob: %s", err)
+		m.stats.Counter("upload_error").Inc(1)
+		u.state = StateFailed
+		u.err = err
+	} else {
+		u.state = StateDone
+	}
+	u.finished = m.clk.Now()
+	m.mu.Unlock()
+	close(u.done)
+}
+
+func (m *Manager) uploadFromCache(namespace string, d core.Digest) error {
+	f, err := m.cas.GetCacheFileReader(d.Name())
+	if err != nil {
+		return fmt.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+	return m.ImageTransferer.Upload(namespace, d, f)
+}
+
+// PutTag creates a job which puts tag once all blobs referenced by manifest d
+// are uploaded. Blobs whose previous upload failed are uploaded again, since
+// Docker skips pushing blobs which are already in the cache. Blobs which were
+// not uploaded through m must already be on origins.
+func (m *Manager) PutTag(tag string, d core.Digest) error {
+	refs, err := m.references(d)
+	if err != nil {
+		return fmt.Errorf("get manifest references: %s", err)
+	}
+
+	j := &job{
+		id:      uuid.Generate().String(),
+		tag:     tag,
+		digest:  d,
+		state:   StateRunning,
+		tagPut:  StatePending,
+		created: m.clk.Now(),
+	}
+
+	repo := repository(tag)
+
+	m.mu.Lock()
+	m.prune()
+	for _, ref := range append(refs, d) {
+		u, ok := m.uploads[uploadKey(repo, ref)]
+		if ok && u.state == StateFailed {
+			u = m.startUpload(u.namespace, ref)
+		}
+		j.blobs = append(j.blobs, jobBlob{digest: ref, upload: u})
+	}
+	m.jobs[j.id] = j
+	m.claims[tag] = j.id
+	m.mu.Unlock()
+
+	go m.runJob(j)
+
+	return nil
+}
+
+func (m *Manager) references(d core.Digest) ([]core.Digest, error) {
+	f, err := m.cas.GetCacheFileReader(d.Name())
+	if err != nil {
+		return nil, fmt.Errorf("get cache file: %s", err)
+	}
+	defer f.Close()
+	manifest, _, err := dockerutil.ParseManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse manifest: %s", err)
+	}
+	return dockerutil.GetManifestReferences(manifest)
+}
+
+func (m *Manager) runJob(j *job) {
+	repo := repository(j.tag)
+	for i := range j.blobs {
+		b := &j.blobs[i]
+		if b.upload == nil {
+			// Never put a tag whose blobs only exist in this proxy's cache.
+			if _, err := m.originStat(repo, b.digest); err != nil {
+				err = fmt.Errorf("stat %s on origins: %s", b.digest, err)
+				m.mu.Lock()
+				b.err = err
+				m.mu.Unlock()
+				m.finish(j, err)
+				return
+			}
+			continue
+		}
+		<-b.upload.done
+		if b.upload.err != nil {
+			m.finish(j, fmt.Errorf("upload %s: %s", b.digest, b.upload.err))
+			return
+		}
+	}
+
+	m.mu.Lock()
+	j.tagPut = StateRunning
+	m.mu.Unlock()
+
+	err := m.ImageTransferer.PutTag(j.tag, j.digest)
+
+	m.mu.Lock()
+	if err != nil {
+		j.tagPut = StateFailed
+	} else {
+		j.tagPut = StateDone
+	}
+	m.mu.Unlock()
+
+	m.finish(j, err)
+}
+
+func (m *Manager) finish(j *job, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		log.With("tag", j.tag, "job", j.id).Errorf("Push job failed: %s", err)
+		m.stats.Counter("job_failed").Inc(1)
+		j.state = StateFailed
+		j.err = err
+	} else {
+		m.stats.Counter("job_succeeded").Inc(1)
+		j.state = StateDone
+	}
+	j.finished = m.clk.Now()
+	m.stats.Timer("job_duration").Record(j.finished.Sub(j.created))
+}
+
+// prune forgets jobs and uploads which finished before the retention period.
+// Must be called with mu held.
+func (m *Manager) prune() {
+	cutoff := m.clk.Now().Add(-m.config.Retention)
+	for id, j := range m.jobs {
+		if !j.finished.IsZero() && j.finished.Before(cutoff) {
+			delete(m.jobs, id)
+			if m.claims[j.tag] == id {
+				delete(m.claims, j.tag)
+			}
+		}
+	}
+	for key, u := range m.uploads {
+		if !u.finished.IsZero() && u.finished.Before(cutoff) {
+			delete(m.uploads, key)
+		}
+	}
+}
+
+// Claim returns the ID of the most recent job for tag, such that it can be
+// returned to the client which pushed the manifest. Each job is claimed at
+// most once.
+func (m *Manager) Claim(tag string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.claims[tag]
+	delete(m.claims, tag)
+	return id, ok
+}
+
+// Status returns the status of job id. Write-back and replication are
+// queried from origins and build-index on each call.
+func (m *Manager) Status(id string) (*Status, bool) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return nil, false
+	}
+	s := &Status{
+		ID:          j.id,
+		Tag:         j.tag,
+		Digest:      j.digest,
+		State:       j.state,
+		TagPut:      j.tagPut,
+		Replication: StatePending,
+		CreatedAt:   j.created,
+	}
+	if j.err != nil {
+		s.Error = j.err.Error()
+	}
+	// onOrigins holds the indices of layers which origins have, but did not
+	// report as persisted yet.
+	var onOrigins []int
+	for i, b := range j.blobs {
+		bs := BlobStatus{Digest: b.digest, Upload: StateSkipped}
+		if b.upload != nil {
+			bs.Upload = b.upload.state
+			if b.upload.state == StateFailed {
+				bs.Error = b.upload.err.Error()
+			}
+		} else if b.err != nil {
+			bs.Error = b.err.Error()
+		}
+		if m.writeBackState != nil {
+			bs.WriteBack = StatePending
+			if b.writtenBack {
+				bs.WriteBack = StateDone
+			} else if bs.Upload == StateDone || (bs.Upload == StateSkipped && bs.Error == "") {
+				onOrigins = append(onOrigins, i)
+			}
+		}
+		s.Layers = append(s.Layers, bs)
+	}
+	m.mu.Unlock()
+
+	repo := repository(j.tag)
+	for _, i := range onOrigins {
+		s.Layers[i].WriteBack = m.layerWriteBack(j, i, repo)
+	}
+
+	switch s.TagPut {
+	case StateFailed:
+		s.Replication = StateFailed
+	case StateDone:
+		s.Replication, s.Remotes = m.replication(j)
+	}
+	return s, true
+}
+
+// layerWriteBack returns the write-back state of the i-th blob of j.
+func (m *Manager) layerWriteBack(j *job, i int, repo string) string {
+	d := j.blobs[i].digest
+	state, err := m.writeBackState(repo, d)
+	if err != nil {
+		log.With("digest", d).Errorf("Error getting write-back state: %s", err)
+		return StateUnknown
+	}
+	if state != blobclient.WriteBackDone {
+		return StateRunning
+	}
+	m.mu.Lock()
+	j.blobs[i].writtenBack = true
+	m.mu.Unlock()
+	return StateDone
+}
+
+// replication returns the replication state of the tag put by j.
+func (m *Manager) replication(j *job) (string, []tagmodels.RemoteReplicationStatus) {
+	if m.replicationStatus == nil {
+		return StateUnknown, nil
+	}
+	status, err := m.replicationStatus(j.tag)
+	if err != nil {
+		log.With("tag", j.tag).Errorf("Error getting replication status: %s", err)
+		return StateUnknown, nil
+	}
+	if status.Digest != j.digest {
+		// The tag has since been moved by a later push.
+		return StateUnknown, nil
+	}
+	if !status.Done() {
+		return StateRunning, status.Remotes
+	}
+	return StateDone, status.Remotes
+}
+
+// repository returns the repository of tag, which is the namespace of its
+// blobs.
+func repository(tag string) string {
+	if i := strings.LastIndex(tag, ":"); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
@@ -0,0 +1,428 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pushjobs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/lib/store"
+	mocktransfer "github.com/uber/kraken/mocks/lib/dockerregistry/transfer"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/utils/dockerutil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type imageFixture struct {
+	tag      string
+	manifest core.Digest
+	blobs    []core.Digest
+}
+
+// newImageFixture writes the blobs and manifest of a new image into cas.
+func newImageFixture(t *testing.T, cas *store.CAStore) imageFixture {
+	config := core.NewBlobFixture()
+	layer1 := core.NewBlobFixture()
+	layer2 := core.NewBlobFixture()
+	manifest, raw := dockerutil.ManifestFixture(config.Digest, layer1.Digest, layer2.Digest)
+
+	for _, b := range []*core.BlobFixture{config, layer1, layer2} {
+		require.NoError(t, cas.CreateCacheFile(b.Digest.Hex(), bytes.NewReader(b.Content)))
+	}
+	require.NoError(t, cas.CreateCacheFile(manifest.Hex(), bytes.NewReader(raw)))
+
+	return imageFixture{
+		tag:      "repo:tag",
+		manifest: manifest,
+		blobs:    []core.Digest{config.Digest, layer1.Digest, layer2.Digest, manifest},
+	}
+}
+
+func newManagerFixture(
+	t *testing.T, opts ...Option) (*Manager, *mocktransfer.MockImageTransferer, *store.CAStore, func()) {
+
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	ctrl := gomock.NewController(t)
+	cleanup.Add(ctrl.Finish)
+
+	transferer := mocktransfer.NewMockImageTransferer(ctrl)
+
+	cas, c := store.CAStoreFixture()
+	cleanup.Add(c)
+
+	m := NewManager(Config{}, tally.NoopScope, transferer, cas, opts...)
+
+	return m, transferer, cas, cleanup.Run
+}
+
+func waitForJob(t *testing.T, m *Manager, id string) *Status {
+	var status *Status
+	require.NoError(t, testutil.PollUntilTrue(5*time.Second, func() bool {
+		s, ok := m.Status(id)
+		require.True(t, ok)
+		status = s
+		return s.State != StateRunning
+	}))
+	return status
+}
+
+func TestManagerPutsTagOnceBlobsAreUploaded(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	release := make(chan struct{})
+	for i, d := range img.blobs {
+		call := transferer.EXPECT().Upload("repo", d, gomock.Any()).Return(nil)
+		if i == 1 {
+			call.Do(func(string, core.Digest, store.FileReader) { <-release })
+		}
+	}
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	for _, d := range img.blobs {
+		require.NoError(m.Upload("repo", d, nil))
+	}
+	require.NoError(m.PutTag(img.tag, img.manifest))
+
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+	_, ok = m.Claim(img.tag)
+	require.False(ok)
+
+	status, ok := m.Status(id)
+	require.True(ok)
+	require.Equal(StateRunning, status.State)
+	require.Equal(StatePending, status.TagPut)
+	require.Equal(StatePending, status.Replication)
+	require.Len(status.Layers, len(img.blobs))
+	require.Equal(img.blobs[1], status.Layers[1].Digest)
+	require.NotEqual(StateDone, status.Layers[1].Upload)
+
+	close(release)
+
+	status = waitForJob(t, m, id)
+	require.Equal(StateDone, status.State)
+	require.Equal(StateDone, status.TagPut)
+	require.Empty(status.Error)
+	for _, l := range status.Layers {
+		require.Equal(StateDone, l.Upload)
+	}
+}
+
+func TestManagerRetriesFailedUploadsOnNextPush(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	failed := img.blobs[2]
+	for _, d := range img.blobs {
+		var err error
+		if d == failed {
+			err = errors.New("some error")
+		}
+		transferer.EXPECT().Upload("repo", d, gomock.Any()).Return(err)
+	}
+
+	for _, d := range img.blobs {
+		require.NoError(m.Upload("repo", d, nil))
+	}
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+
+	status := waitForJob(t, m, id)
+	require.Equal(StateFailed, status.State)
+	require.Equal(StatePending, status.Replication)
+	require.Contains(status.Error, "some error")
+	require.Equal(StateFailed, status.Layers[2].Upload)
+	require.Contains(status.Layers[2].Error, "some error")
+
+	// Docker skips blobs in the cache when pushing again, so only the manifest
+	// is put.
+	transferer.EXPECT().Upload("repo", failed, gomock.Any()).Return(nil)
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok = m.Claim(img.tag)
+	require.True(ok)
+
+	status = waitForJob(t, m, id)
+	require.Equal(StateDone, status.State)
+	require.Equal(StateDone, status.Layers[2].Upload)
+}
+
+func TestManagerUploadsBlobsPushedToTwoReposToBoth(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+	other := "other:tag"
+
+	for _, repo := range []string{"repo", "other"} {
+		for _, d := range img.blobs {
+			transferer.EXPECT().Upload(repo, d, gomock.Any()).Return(nil)
+		}
+	}
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+	transferer.EXPECT().PutTag(other, img.manifest).Return(nil)
+
+	for _, repo := range []string{"repo", "other"} {
+		for _, d := range img.blobs {
+			require.NoError(m.Upload(repo, d, nil))
+		}
+	}
+	for _, tag := range []string{img.tag, other} {
+		require.NoError(m.PutTag(tag, img.manifest))
+		id, ok := m.Claim(tag)
+		require.True(ok)
+
+		status := waitForJob(t, m, id)
+		require.Equal(StateDone, status.State)
+		for _, l := range status.Layers {
+			require.Equal(StateDone, l.Upload)
+		}
+	}
+}
+
+func TestManagerSkipsBlobsNotUploadedThroughIt(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	for _, d := range img.blobs {
+		transferer.EXPECT().Stat("repo", d).Return(core.NewBlobInfo(1), nil)
+	}
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+
+	status := waitForJob(t, m, id)
+	require.Equal(StateDone, status.State)
+	for _, l := range status.Layers {
+		require.Equal(StateSkipped, l.Upload)
+		require.Empty(l.Error)
+	}
+}
+
+func TestManagerFailsJobWhenSkippedBlobNotOnOrigins(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	missing := img.blobs[1]
+	transferer.EXPECT().Stat("repo", img.blobs[0]).Return(core.NewBlobInfo(1), nil)
+	transferer.EXPECT().Stat("repo", missing).Return(nil, transfer.ErrBlobNotFound)
+
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+
+	status := waitForJob(t, m, id)
+	require.Equal(StateFailed, status.State)
+	require.Equal(StatePending, status.Replication)
+	require.Equal(StateSkipped, status.Layers[1].Upload)
+	require.Contains(status.Layers[1].Error, missing.String())
+}
+
+func TestManagerJobFailsWhenPutTagFails(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	transferer.EXPECT().Stat("repo", gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(errors.New("some error"))
+
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+
+	status := waitForJob(t, m, id)
+	require.Equal(StateFailed, status.State)
+	require.Equal(StateFailed, status.TagPut)
+	require.Equal(StateFailed, status.Replication)
+}
+
+func TestManagerReportsWriteBackAndReplication(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	var mu sync.Mutex
+	writeBack := make(map[core.Digest]blobclient.WriteBackState)
+	m.writeBackState = func(namespace string, d core.Digest) (blobclient.WriteBackState, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal("repo", namespace)
+		if s, ok := writeBack[d]; ok {
+			return s, nil
+		}
+		return blobclient.WriteBackPending, nil
+	}
+	remote := tagmodels.RemoteReplicationStatus{
+		Remote: "remote-build-index",
+		State:  tagmodels.ReplicationPending,
+	}
+	m.replicationStatus = func(tag string) (tagmodels.ReplicationStatus, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return tagmodels.ReplicationStatus{
+			Tag:     tag,
+			Digest:  img.manifest,
+			Remotes: []tagmodels.RemoteReplicationStatus{remote},
+		}, nil
+	}
+
+	transferer.EXPECT().Stat("repo", gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+
+	status := waitForJob(t, m, id)
+	require.Equal(StateDone, status.State)
+	require.Equal(StateDone, status.TagPut)
+	require.Equal(StateRunning, status.Replication)
+	require.Equal([]tagmodels.RemoteReplicationStatus{remote}, status.Remotes)
+	for _, l := range status.Layers {
+		require.Equal(StateRunning, l.WriteBack)
+	}
+
+	mu.Lock()
+	writeBack[img.blobs[0]] = blobclient.WriteBackDone
+	remote.State = tagmodels.ReplicationDone
+	mu.Unlock()
+
+	status, ok = m.Status(id)
+	require.True(ok)
+	require.Equal(StateDone, status.Replication)
+	require.Equal(StateDone, status.Layers[0].WriteBack)
+	require.Equal(StateRunning, status.Layers[1].WriteBack)
+}
+
+func TestManagerReportsWriteBackPendingUntilUploaded(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	m.writeBackState = func(string, core.Digest) (blobclient.WriteBackState, error) {
+		return blobclient.WriteBackDone, nil
+	}
+
+	img := newImageFixture(t, cas)
+
+	release := make(chan struct{})
+	transferer.EXPECT().Upload("repo", img.blobs[0], gomock.Any()).DoAndReturn(
+		func(string, core.Digest, store.FileReader) error {
+			<-release
+			return nil
+		})
+	transferer.EXPECT().Stat("repo", gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	require.NoError(m.Upload("repo", img.blobs[0], nil))
+	require.NoError(m.PutTag(img.tag, img.manifest))
+	id, ok := m.Claim(img.tag)
+	require.True(ok)
+
+	status, ok := m.Status(id)
+	require.True(ok)
+	require.Equal(StatePending, status.Layers[0].WriteBack)
+
+	close(release)
+
+	status = waitForJob(t, m, id)
+	require.Equal(StateDone, status.Layers[0].WriteBack)
+}
+
+func TestManagerPutTagErrorsWhenManifestNotCached(t *testing.T) {
+	require := require.New(t)
+
+	m, _, _, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	require.Error(m.PutTag("repo:tag", core.DigestFixture()))
+	_, ok := m.Claim("repo:tag")
+	require.False(ok)
+}
+
+func TestManagerForgetsFinishedJobsAfterRetention(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	m, transferer, cas, cleanup := newManagerFixture(t, WithClock(clk))
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+
+	transferer.EXPECT().Stat("repo", gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil).Times(2)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		require.NoError(m.PutTag(img.tag, img.manifest))
+		id, ok := m.Claim(img.tag)
+		require.True(ok, fmt.Sprintf("job %d", i))
+		waitForJob(t, m, id)
+		ids = append(ids, id)
+
+		clk.Add(m.config.Retention + time.Second)
+	}
+
+	// Jobs are pruned when new jobs are created.
+	_, ok := m.Status(ids[0])
+	require.False(ok)
+	_, ok = m.Status(ids[1])
+	require.True(ok)
+}
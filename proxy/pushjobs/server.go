@@ -0,0 +1,261 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pushjobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/listener"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/go-chi/chi"
+	"github.com/uber-go/tally"
+)
+
+// JobHeader is the response header carrying the push job ID of an
+// acknowledged manifest push.
+const JobHeader = "Kraken-Push-Job"
+
+// Server sits in front of the registry for manifest requests, acknowledging
+// manifest pushes with their job ID, and serves job status.
+type Server struct {
+	config   Config
+	stats    tally.Scope
+	jobs     *Manager
+	registry *httputil.ReverseProxy
+
+	// local is the in-process registry, if any.
+	local http.Handler
+}
+
+// NewServer creates a new Server which forwards requests to the registry
+// listening on registry.
+func NewServer(
+	config Config, stats tally.Scope, jobs *Manager, registry listener.Config) *Server {
+
+	config = config.applyDefaults()
+	stats = stats.Tagged(map[string]string{"module": "pushjobs"})
+
+	s := &Server{config: config, stats: stats, jobs: jobs}
+	s.registry = newReverseProxy(registry, s.acknowledge)
+	return s
+}
+
+// NewLocalServer creates a new Server which serves the whole registry API of
+// the in-process registry. Manifest requests are acknowledged as in NewServer,
+// and all other requests are passed to registry directly.
+func NewLocalServer(
+	config Config, stats tally.Scope, jobs *Manager, registry http.Handler) *Server {
+
+	config = config.applyDefaults()
+	stats = stats.Tagged(map[string]string{"module": "pushjobs"})
+
+	s := &Server{config: config, stats: stats, jobs: jobs, local: registry}
+	s.registry = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = "registry"
+		},
+		Transport:      handlerTransport{registry},
+		ModifyResponse: s.acknowledge,
+	}
+	return s
+}
+
+// Handler returns a handler for s.
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Recovery(s.stats))
+	r.Get("/v2/_kraken/jobs/{id}", handler.Wrap(s.getJobHandler))
+	r.Handle("/*", s.registry)
+	if s.local == nil {
+		return r
+	}
+	// Only manifest and job requests, which are small, go through the
+	// buffering handlerTransport.
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if IsPushJobPath(req.URL.Path) {
+			r.ServeHTTP(w, req)
+			return
+		}
+		s.local.ServeHTTP(w, req)
+	})
+}
+
+// IsPushJobPath returns true if p is a manifest or push job request, which
+// must be routed through a Server.
+func IsPushJobPath(p string) bool {
+	return strings.HasPrefix(p, "/v2/") &&
+		(strings.Contains(p[len("/v2/"):], "/manifests/") ||
+			strings.HasPrefix(p, "/v2/_kraken/jobs/"))
+}
+
+// ListenAndServe is a blocking call which runs s.
+func (s *Server) ListenAndServe() error {
+	log.Infof("Starting push job server on %s", s.config.Listener)
+	return listener.Serve(s.config.Listener, s.Handler())
+}
+
+func (s *Server) getJobHandler(w http.ResponseWriter, r *http.Request) error {
+	id := chi.URLParam(r, "id")
+	status, ok := s.jobs.Status(id)
+	if !ok {
+		return handler.Errorf("job %s not found", id).Status(http.StatusNotFound)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+type acknowledgement struct {
+	ID string `json:"id"`
+}
+
+// acknowledge replaces the 201 response of a manifest push which created a
+// job with 202 and the job ID.
+func (s *Server) acknowledge(resp *http.Response) error {
+	r := resp.Request
+	if r.Method != http.MethodPut || resp.StatusCode != http.StatusCreated {
+		return nil
+	}
+	repo, ref, ok := parseManifestPath(r.URL.Path)
+	if !ok {
+		return nil
+	}
+	// Pushes by digest do not put a tag, and thus have no job.
+	id, ok := s.jobs.Claim(fmt.Sprintf("%s:%s", repo, ref))
+	if !ok {
+		return nil
+	}
+	b, err := json.Marshal(acknowledgement{id})
+	if err != nil {
+		return fmt.Errorf("json marshal: %s", err)
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	resp.StatusCode = http.StatusAccepted
+	resp.Status = fmt.Sprintf("%d %s", http.StatusAccepted, http.StatusText(http.StatusAccepted))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set(JobHeader, id)
+	return nil
+}
+
+// parseManifestPath parses /v2/<repo>/manifests/<reference>.
+func parseManifestPath(p string) (repo, ref string, ok bool) {
+	if !strings.HasPrefix(p, "/v2/") {
+		return "", "", false
+	}
+	i := strings.LastIndex(p, "/manifests/")
+	if i < len("/v2/") {
+		return "", "", false
+	}
+	repo = p[len("/v2/"):i]
+	ref = p[i+len("/manifests/"):]
+	if repo == "" || ref == "" || strings.Contains(ref, "/") {
+		return "", "", false
+	}
+	return repo, ref, true
+}
+
+func newReverseProxy(
+	registry listener.Config, modify func(*http.Response) error) *httputil.ReverseProxy {
+
+	network := registry.Net
+	if network == "" {
+		network = "tcp"
+	}
+	var dialer net.Dialer
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = "registry"
+		},
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, registry.Addr)
+			},
+		},
+		ModifyResponse: modify,
+	}
+}
+
+// handlerTransport round trips requests through an in-process handler. The
+// response is buffered in memory.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Turn the outgoing request into an incoming one.
+	in := r.Clone(r.Context())
+	if in.Body == nil {
+		in.Body = http.NoBody
+	}
+	in.RequestURI = r.URL.RequestURI()
+
+	w := &bufferedResponseWriter{header: make(http.Header)}
+	t.handler.ServeHTTP(w, in)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.status, http.StatusText(w.status)),
+		StatusCode:    w.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          ioutil.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+		Request:       r,
+	}, nil
+}
+
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
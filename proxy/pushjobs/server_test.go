@@ -0,0 +1,253 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pushjobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/listener"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// startServer starts a Server in front of a fake registry which accepts every
+// manifest push.
+func startServer(m *Manager) (addr string, stop func()) {
+	var cleanup testutil.Cleanup
+	defer cleanup.Recover()
+
+	registry, stopRegistry := testutil.StartServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+			fmt.Fprint(w, "registry")
+		}))
+	cleanup.Add(stopRegistry)
+
+	s := NewServer(Config{}, tally.NoopScope, m, listener.Config{Net: "tcp", Addr: registry})
+	addr, stopServer := testutil.StartServer(s.Handler())
+	cleanup.Add(stopServer)
+
+	return addr, cleanup.Run
+}
+
+func TestServerAcknowledgesManifestPushWithJob(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+	transferer.EXPECT().Stat("repo", gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	addr, stop := startServer(m)
+	defer stop()
+
+	// The registry driver puts the tag before the registry responds.
+	require.NoError(m.PutTag(img.tag, img.manifest))
+
+	resp, err := httputil.Put(
+		fmt.Sprintf("http://%s/v2/repo/manifests/tag", addr),
+		httputil.SendAcceptedCodes(http.StatusAccepted))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusAccepted, resp.StatusCode)
+
+	var ack acknowledgement
+	require.NoError(json.NewDecoder(resp.Body).Decode(&ack))
+	require.NotEmpty(ack.ID)
+	require.Equal(ack.ID, resp.Header.Get(JobHeader))
+
+	waitForJob(t, m, ack.ID)
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/v2/_kraken/jobs/%s", addr, ack.ID))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var status Status
+	require.NoError(json.NewDecoder(resp.Body).Decode(&status))
+	require.Equal(ack.ID, status.ID)
+	require.Equal(img.tag, status.Tag)
+	require.Equal(img.manifest, status.Digest)
+	require.Equal(StateDone, status.State)
+	require.Len(status.Layers, len(img.blobs))
+}
+
+func TestServerPassesThroughPushesWithoutJob(t *testing.T) {
+	require := require.New(t)
+
+	m, _, _, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	addr, stop := startServer(m)
+	defer stop()
+
+	// Pushes by digest do not put a tag.
+	resp, err := httputil.Put(
+		fmt.Sprintf("http://%s/v2/repo/manifests/sha256:abc", addr),
+		httputil.SendAcceptedCodes(http.StatusCreated))
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusCreated, resp.StatusCode)
+	require.Empty(resp.Header.Get(JobHeader))
+
+	resp, err = httputil.Get(fmt.Sprintf("http://%s/v2/repo/manifests/tag", addr))
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestServerGetJobNotFound(t *testing.T) {
+	require := require.New(t)
+
+	m, _, _, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	addr, stop := startServer(m)
+	defer stop()
+
+	_, err := httputil.Get(fmt.Sprintf("http://%s/v2/_kraken/jobs/unknown", addr))
+	require.True(httputil.IsNotFound(err))
+}
+
+func TestServerForwardsToUnixRegistry(t *testing.T) {
+	require := require.New(t)
+
+	m, _, _, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "pushjobs")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "registry.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(err)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "registry")
+	}))
+	defer l.Close()
+
+	s := NewServer(Config{}, tally.NoopScope, m, listener.Config{Net: "unix", Addr: sock})
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/v2/repo/manifests/tag", addr))
+	require.NoError(err)
+	resp.Body.Close()
+}
+
+func TestLocalServerServesRegistry(t *testing.T) {
+	require := require.New(t)
+
+	m, transferer, cas, cleanup := newManagerFixture(t)
+	defer cleanup()
+
+	img := newImageFixture(t, cas)
+	transferer.EXPECT().Stat("repo", gomock.Any()).Return(core.NewBlobInfo(1), nil).AnyTimes()
+	transferer.EXPECT().PutTag(img.tag, img.manifest).Return(nil)
+
+	registry := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		fmt.Fprintf(w, "registry %s", r.URL.Path)
+	})
+	s := NewLocalServer(Config{}, tally.NoopScope, m, registry)
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	require.NoError(m.PutTag(img.tag, img.manifest))
+
+	resp, err := httputil.Put(
+		fmt.Sprintf("http://%s/v2/repo/manifests/tag", addr),
+		httputil.SendAcceptedCodes(http.StatusAccepted))
+	require.NoError(err)
+	resp.Body.Close()
+	id := resp.Header.Get(JobHeader)
+	require.NotEmpty(id)
+	waitForJob(t, m, id)
+
+	for _, p := range []string{"/v2/repo/manifests/tag", "/v2/repo/blobs/sha256:abc"} {
+		resp, err := httputil.Get(fmt.Sprintf("http://%s%s", addr, p))
+		require.NoError(err)
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(err)
+		require.Equal("registry "+p, string(b))
+	}
+}
+
+func TestParseManifestPath(t *testing.T) {
+	tests := []struct {
+		path string
+		repo string
+		ref  string
+		ok   bool
+	}{
+		{"/v2/repo/manifests/tag", "repo", "tag", true},
+		{"/v2/a/b/c/manifests/tag", "a/b/c", "tag", true},
+		{"/v2/repo/manifests/sha256:abc", "repo", "sha256:abc", true},
+		{"/v2/repo/blobs/sha256:abc", "", "", false},
+		{"/v2/manifests/tag", "", "", false},
+		{"/v2/repo/manifests/", "", "", false},
+		{"/v3/repo/manifests/tag", "", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			require := require.New(t)
+
+			repo, ref, ok := parseManifestPath(test.path)
+			require.Equal(test.ok, ok)
+			require.Equal(test.repo, repo)
+			require.Equal(test.ref, ref)
+		})
+	}
+}
+
+func TestIsPushJobPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/v2/repo/manifests/tag", true},
+		{"/v2/a/b/manifests/sha256:abc", true},
+		{"/v2/_kraken/jobs/123", true},
+		{"/v2/repo/blobs/sha256:abc", false},
+		{"/v2/repo/blobs/uploads/", false},
+		{"/v2/", false},
+		{"/v3/repo/manifests/tag", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			require.Equal(t, test.expected, IsPushJobPath(test.path))
+		})
+	}
+}
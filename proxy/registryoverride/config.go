@@ -13,9 +13,53 @@
 // limitations under the License.
 package registryoverride
 
-import "github.com/uber/kraken/utils/listener"
+import (
+	"time"
+
+	"github.com/uber/kraken/utils/listener"
+)
 
 // Config defines Server configuration.
 type Config struct {
 	Listener listener.Config `yaml:"listener"`
+	Catalog  CatalogConfig   `yaml:"catalog"`
+
+	// FullAPI serves the whole Docker registry API on Listener, passing
+	// requests which are not overridden to the in-process registry, such that
+	// the registry and push job servers do not need listeners of their own.
+	FullAPI bool `yaml:"full_api"`
+}
+
+// CatalogConfig defines /v2/_catalog configuration.
+type CatalogConfig struct {
+	// CacheTTL is how long the repositories listed from build-index are reused
+	// across catalog requests, such that paging through the catalog does not
+	// list all tags for every page.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// ListLimit is the number of tags listed from build-index per request.
+	ListLimit int `yaml:"list_limit"`
+
+	// MaxEntries caps the `n` query arg of catalog requests. Requests without
+	// `n` are paginated by MaxEntries as well.
+	MaxEntries int `yaml:"max_entries"`
+
+	// Include and Exclude filter the repositories in the catalog by regular
+	// expression. If Include is set, repositories must match at least one of
+	// its entries. Repositories matching any entry of Exclude are omitted.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+func (c CatalogConfig) applyDefaults() CatalogConfig {
+	if c.CacheTTL == 0 {
+		c.CacheTTL = time.Minute
+	}
+	if c.ListLimit == 0 {
+		c.ListLimit = 1000
+	}
+	if c.MaxEntries == 0 {
+		c.MaxEntries = 1000
+	}
+	return c
 }
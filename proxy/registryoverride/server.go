@@ -15,15 +15,23 @@ package registryoverride
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/go-chi/chi"
+	"github.com/uber-go/tally"
 	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/listener"
 	"github.com/uber/kraken/utils/log"
@@ -33,19 +41,89 @@ import (
 // Server overrides Docker registry endpoints.
 type Server struct {
 	config    Config
+	stats     tally.Scope
 	tagClient tagclient.Client
+	clk       clock.Clock
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+
+	// registry serves requests which are not overridden, if FullAPI is set.
+	registry http.Handler
+
+	// Sorted repositories listed from build-index, cached until reposExpire.
+	mu          sync.Mutex
+	repos       []string
+	reposExpire time.Time
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithRegistry configures the registry which serves all requests which are
+// not overridden. Required if FullAPI is set.
+func WithRegistry(registry http.Handler) Option {
+	return func(s *Server) { s.registry = registry }
 }
 
 // NewServer creates a new Server.
-func NewServer(config Config, tagClient tagclient.Client) *Server {
-	return &Server{config, tagClient}
+func NewServer(
+	config Config, stats tally.Scope, tagClient tagclient.Client, opts ...Option) (*Server, error) {
+
+	config.Catalog = config.Catalog.applyDefaults()
+	include, err := compileAll(config.Catalog.Include)
+	if err != nil {
+		return nil, fmt.Errorf("catalog include: %s", err)
+	}
+	exclude, err := compileAll(config.Catalog.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("catalog exclude: %s", err)
+	}
+	stats = stats.Tagged(map[string]string{"module": "registryoverride"})
+	s := &Server{
+		config:    config,
+		stats:     stats,
+		tagClient: tagClient,
+		clk:       clock.New(),
+		include:   include,
+		exclude:   exclude,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if config.FullAPI && s.registry == nil {
+		return nil, errors.New("full_api requires a registry")
+	}
+	return s, nil
+}
+
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	var result []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %q: %s", expr, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
 }
 
 // Handler returns a handler for s.
 func (s *Server) Handler() http.Handler {
 	r := chi.NewRouter()
+	r.Use(middleware.Recovery(s.stats))
 	r.Get("/v2/_catalog", handler.Wrap(s.catalogHandler))
-	return r
+	if !s.config.FullAPI {
+		return r
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v2/_catalog" {
+			r.ServeHTTP(w, req)
+			return
+		}
+		s.registry.ServeHTTP(w, req)
+	})
 }
 
 // ListenAndServe is a blocking call which runs s.
@@ -58,83 +136,136 @@ type catalogResponse struct {
 	Repositories []string `json:"repositories"`
 }
 
-// catalogHandler handles catalog request.
-// https://docs.docker.com/registry/spec/api/#pagination for more reference.
+// catalogHandler handles catalog request. Repositories are returned in lexical
+// order, starting after the `last` query arg and limited to the `n` query arg.
+// The `prefix` query arg further restricts repositories to those starting with
+// it. See https://docs.docker.com/registry/spec/api/#pagination for more
+// reference.
 func (s *Server) catalogHandler(w http.ResponseWriter, r *http.Request) error {
-	limitQ := "n"
-	offsetQ := "last"
-
-	// Build request for ListWithPagination.
-	var filter tagclient.ListFilter
-	u := r.URL
-	q := u.Query()
-	for k, v := range q {
+	limit := s.config.Catalog.MaxEntries
+	var last, prefix string
+	for k, v := range r.URL.Query() {
 		if len(v) != 1 {
 			return handler.Errorf(
 				"invalid query %s:%s", k, v).Status(http.StatusBadRequest)
 		}
 		switch k {
-		case limitQ:
-			limitCount, err := strconv.Atoi(v[0])
-			if err != nil {
-				return handler.Errorf(
-					"invalid limit %s: %s", v, err).Status(http.StatusBadRequest)
+		case "n":
+			n, err := strconv.Atoi(v[0])
+			if err != nil || n <= 0 {
+				return handler.Errorf("invalid n %s", v[0]).Status(http.StatusBadRequest)
 			}
-			if limitCount == 0 {
-				return handler.Errorf(
-					"invalid limit %d", limitCount).Status(http.StatusBadRequest)
+			if n < limit {
+				limit = n
 			}
-			filter.Limit = limitCount
-		case offsetQ:
-			filter.Offset = v[0]
+		case "last":
+			last = v[0]
+		case "prefix":
+			prefix = v[0]
 		default:
 			return handler.Errorf("invalid query %s", k).Status(http.StatusBadRequest)
 		}
 	}
 
-	// List with pagination.
-	listResp, err := s.tagClient.ListWithPagination("", filter)
+	repos, err := s.listRepos()
 	if err != nil {
-		return handler.Errorf("list: %s", err)
-	}
-	repos := stringset.New()
-	for _, tag := range listResp.Result {
-		parts := strings.Split(tag, ":")
-		if len(parts) != 2 {
-			log.With("tag", tag).Errorf("Invalid tag format, expected repo:tag")
-			continue
-		}
-		repos.Add(parts[0])
+		return err
 	}
 
-	// Build Link for response.
-	offset, err := listResp.GetOffset()
-	if err != nil && err != io.EOF {
-		return handler.Errorf("invalid offset %s", err)
+	// Repositories are sorted, so the page starts at the first repository
+	// after both last and prefix.
+	start := sort.SearchStrings(repos, prefix)
+	if last != "" {
+		if i := sort.Search(len(repos), func(i int) bool { return repos[i] > last }); i > start {
+			start = i
+		}
 	}
-	if offset != "" {
-		nextUrl, err := url.Parse(u.String())
-		if err != nil {
-			return handler.Errorf(
-				"invalid url string: %s", err).Status(http.StatusBadRequest)
+	page := make([]string, 0, limit)
+	more := false
+	for _, repo := range repos[start:] {
+		if !strings.HasPrefix(repo, prefix) {
+			break
 		}
-		val, err := url.ParseQuery(nextUrl.RawQuery)
-		if err != nil {
-			return handler.Errorf(
-				"invalid url string: %s", err).Status(http.StatusBadRequest)
+		if len(page) == limit {
+			more = true
+			break
 		}
-		val.Set(offsetQ, offset)
-		nextUrl.RawQuery = val.Encode()
+		page = append(page, repo)
+	}
 
-		// Set header (https://docs.docker.com/registry/spec/api/#pagination),
-		// except the host and scheme.
-		// Link: <<url>?n=2&last=b>; rel="next"
-		w.Header().Set("Link", fmt.Sprintf("%s; rel=\"next\"", nextUrl.String()))
+	if more {
+		// Link: </v2/_catalog?last=b&n=2>; rel="next"
+		q := r.URL.Query()
+		q.Set("n", strconv.Itoa(limit))
+		q.Set("last", page[len(page)-1])
+		next := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
 	}
 
-	resp := catalogResponse{Repositories: repos.ToSlice()}
+	resp := catalogResponse{Repositories: page}
 	if err := json.NewEncoder(w).Encode(&resp); err != nil {
 		return handler.Errorf("json encode: %s", err)
 	}
 	return nil
 }
+
+// listRepos returns the sorted repositories of all tags in build-index which
+// pass the configured filters. Results are cached for the configured TTL.
+func (s *Server) listRepos() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.clk.Now().Before(s.reposExpire) {
+		return s.repos, nil
+	}
+
+	repos := stringset.New()
+	filter := tagclient.ListFilter{Limit: s.config.Catalog.ListLimit}
+	for {
+		resp, err := s.tagClient.ListWithPagination("", filter)
+		if err != nil {
+			return nil, handler.Errorf("list: %s", err)
+		}
+		for _, tag := range resp.Result {
+			i := strings.LastIndex(tag, ":")
+			if i <= 0 {
+				log.With("tag", tag).Errorf("Invalid tag format, expected repo:tag")
+				continue
+			}
+			repo := tag[:i]
+			if s.allowed(repo) {
+				repos.Add(repo)
+			}
+		}
+		offset, err := resp.GetOffset()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, handler.Errorf("invalid offset: %s", err)
+		}
+		filter.Offset = offset
+	}
+	s.repos = repos.ToSlice()
+	sort.Strings(s.repos)
+	s.reposExpire = s.clk.Now().Add(s.config.Catalog.CacheTTL)
+	s.stats.Gauge("catalog_repositories").Update(float64(len(s.repos)))
+	return s.repos, nil
+}
+
+func (s *Server) allowed(repo string) bool {
+	for _, re := range s.exclude {
+		if re.MatchString(repo) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, re := range s.include {
+		if re.MatchString(repo) {
+			return true
+		}
+	}
+	return false
+}
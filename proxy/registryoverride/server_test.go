@@ -0,0 +1,222 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package registryoverride
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/build-index/tagclient"
+	"github.com/uber/kraken/build-index/tagmodels"
+	"github.com/uber/kraken/mocks/build-index/tagclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func listResponse(next string, tags ...string) tagmodels.ListResponse {
+	resp := tagmodels.ListResponse{Size: len(tags), Result: tags}
+	if next != "" {
+		resp.Links.Next = "http://build-index/list/?offset=" + next
+	}
+	return resp
+}
+
+type serverMocks struct {
+	ctrl      *gomock.Controller
+	tagClient *mocktagclient.MockClient
+	clk       *clock.Mock
+}
+
+func newServerMocks(t *testing.T) (*serverMocks, func()) {
+	ctrl := gomock.NewController(t)
+	return &serverMocks{
+		ctrl:      ctrl,
+		tagClient: mocktagclient.NewMockClient(ctrl),
+		clk:       clock.NewMock(),
+	}, ctrl.Finish
+}
+
+func (m *serverMocks) startServer(t *testing.T, config Config) (addr string, stop func()) {
+	s, err := NewServer(config, tally.NoopScope, m.tagClient)
+	require.NoError(t, err)
+	s.clk = m.clk
+	return testutil.StartServer(s.Handler())
+}
+
+func getCatalog(t *testing.T, addr, query string) ([]string, string) {
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/v2/_catalog%s", addr, query))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var catalog catalogResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&catalog))
+	return catalog.Repositories, resp.Header.Get("Link")
+}
+
+func TestCatalogPagination(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := mocks.startServer(t, Config{})
+	defer stop()
+
+	// All tags are listed once and repositories are cached across pages.
+	mocks.tagClient.EXPECT().ListWithPagination("", tagclient.ListFilter{Limit: 1000}).Return(
+		listResponse("tok", "c:1", "a:1", "a:2"), nil)
+	mocks.tagClient.EXPECT().ListWithPagination(
+		"", tagclient.ListFilter{Limit: 1000, Offset: "tok"}).Return(
+		listResponse("", "localhost:5000/d:1", "b:1", "c:2"), nil)
+
+	repos, link := getCatalog(t, addr, "?n=2")
+	require.Equal([]string{"a", "b"}, repos)
+	require.Equal(`</v2/_catalog?last=b&n=2>; rel="next"`, link)
+
+	repos, link = getCatalog(t, addr, "?n=2&last=b")
+	require.Equal([]string{"c", "localhost:5000/d"}, repos)
+	require.Empty(link)
+
+	repos, link = getCatalog(t, addr, "")
+	require.Equal([]string{"a", "b", "c", "localhost:5000/d"}, repos)
+	require.Empty(link)
+
+	repos, _ = getCatalog(t, addr, "?last=localhost:5000/d")
+	require.Empty(repos)
+}
+
+func TestCatalogCacheExpires(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := mocks.startServer(t, Config{Catalog: CatalogConfig{CacheTTL: time.Minute}})
+	defer stop()
+
+	mocks.tagClient.EXPECT().ListWithPagination("", gomock.Any()).Return(
+		listResponse("", "a:1"), nil)
+
+	repos, _ := getCatalog(t, addr, "")
+	require.Equal([]string{"a"}, repos)
+
+	mocks.clk.Add(2 * time.Minute)
+
+	mocks.tagClient.EXPECT().ListWithPagination("", gomock.Any()).Return(
+		listResponse("", "a:1", "b:1"), nil)
+
+	repos, _ = getCatalog(t, addr, "")
+	require.Equal([]string{"a", "b"}, repos)
+}
+
+func TestCatalogFilters(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := mocks.startServer(t, Config{Catalog: CatalogConfig{
+		Include: []string{"^team-a/", "^team-b/"},
+		Exclude: []string{"/internal-"},
+	}})
+	defer stop()
+
+	mocks.tagClient.EXPECT().ListWithPagination("", gomock.Any()).Return(
+		listResponse("",
+			"team-a/x:1", "team-a/internal-y:1", "team-b/z:1", "team-c/w:1"), nil)
+
+	repos, _ := getCatalog(t, addr, "")
+	require.Equal([]string{"team-a/x", "team-b/z"}, repos)
+
+	repos, _ = getCatalog(t, addr, "?prefix=team-b/")
+	require.Equal([]string{"team-b/z"}, repos)
+}
+
+func TestCatalogMaxEntries(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := mocks.startServer(t, Config{Catalog: CatalogConfig{MaxEntries: 1}})
+	defer stop()
+
+	mocks.tagClient.EXPECT().ListWithPagination("", gomock.Any()).Return(
+		listResponse("", "a:1", "b:1"), nil)
+
+	repos, link := getCatalog(t, addr, "?n=5")
+	require.Equal([]string{"a"}, repos)
+	require.Equal(`</v2/_catalog?last=a&n=1>; rel="next"`, link)
+}
+
+func TestCatalogInvalidQuery(t *testing.T) {
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	addr, stop := mocks.startServer(t, Config{})
+	defer stop()
+
+	for _, query := range []string{"?n=0", "?n=foo", "?foo=bar", "?n=1&n=2"} {
+		_, err := httputil.Get(fmt.Sprintf("http://%s/v2/_catalog%s", addr, query))
+		require.True(t, httputil.IsStatus(err, http.StatusBadRequest), query)
+	}
+}
+
+func TestNewServerInvalidFilters(t *testing.T) {
+	_, err := NewServer(
+		Config{Catalog: CatalogConfig{Include: []string{"("}}}, tally.NoopScope, nil)
+	require.Error(t, err)
+}
+
+func TestFullAPIPassesThroughToRegistry(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t)
+	defer cleanup()
+
+	registry := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "registry %s %s", r.Method, r.URL.Path)
+	})
+	s, err := NewServer(
+		Config{FullAPI: true}, tally.NoopScope, mocks.tagClient, WithRegistry(registry))
+	require.NoError(err)
+	addr, stop := testutil.StartServer(s.Handler())
+	defer stop()
+
+	mocks.tagClient.EXPECT().ListWithPagination("", gomock.Any()).Return(
+		listResponse("", "a:1"), nil)
+
+	repos, _ := getCatalog(t, addr, "")
+	require.Equal([]string{"a"}, repos)
+
+	resp, err := httputil.Put(fmt.Sprintf("http://%s/v2/a/manifests/1", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(err)
+	require.Equal("registry PUT /v2/a/manifests/1", string(b))
+}
+
+func TestNewServerFullAPIRequiresRegistry(t *testing.T) {
+	_, err := NewServer(Config{FullAPI: true}, tally.NoopScope, nil)
+	require.Error(t, err)
+}
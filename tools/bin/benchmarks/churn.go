@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tools/lib/benchmark"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/randutil"
+)
+
+func splitAddrs(s string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(s, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
+// churn uploads new random blobs to origins at a fixed rate, and has every
+// agent pull each blob once uploaded.
+type churn struct {
+	origins   blobclient.ClusterClient
+	agents    []string
+	namespace string
+	size      uint64
+	window    *benchmark.Window
+	wg        sync.WaitGroup
+}
+
+func (c *churn) uploadAndPull() {
+	defer c.wg.Done()
+
+	blob := randutil.Blob(c.size)
+	d, err := core.NewDigester().FromBytes(blob)
+	if err != nil {
+		fatalf("digest blob: %s", err)
+	}
+	if err := c.origins.UploadBlob(c.namespace, d, bytes.NewReader(blob)); err != nil {
+		fmt.Fprintf(os.Stderr, "upload %s failed: %s\n", d, err)
+		c.window.Failure()
+		return
+	}
+	c.window.Upload()
+
+	var wg sync.WaitGroup
+	for _, agent := range c.agents {
+		wg.Add(1)
+		go func(agent string) {
+			defer wg.Done()
+			if latency, err := c.pull(agent, d); err != nil {
+				fmt.Fprintf(os.Stderr, "pull %s from %s failed: %s\n", d, agent, err)
+				c.window.Failure()
+			} else {
+				c.window.Pull(latency)
+			}
+		}(agent)
+	}
+	wg.Wait()
+}
+
+func (c *churn) pull(agent string, d core.Digest) (time.Duration, error) {
+	start := time.Now()
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/namespace/%s/blobs/%s", agent, url.PathEscape(c.namespace), d),
+		httputil.SendTimeout(15*time.Minute))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// sampler computes the origin egress and tracker requests served between
+// consecutive samples.
+type sampler struct {
+	origins  []string
+	trackers []string
+
+	last         time.Time
+	lastEgress   int64
+	lastRequests int64
+}
+
+func (s *sampler) counters() (egress, requests int64) {
+	stats, err := benchmark.OriginEgress(s.origins)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sample origin egress: %s\n", err)
+	}
+	egress = stats.Total()
+	if len(s.trackers) > 0 {
+		requests, err = benchmark.TrackerRequests(s.trackers)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sample tracker requests: %s\n", err)
+		}
+	}
+	return egress, requests
+}
+
+func (s *sampler) start() {
+	s.last = time.Now()
+	s.lastEgress, s.lastRequests = s.counters()
+}
+
+func (s *sampler) sample(w *benchmark.Window) benchmark.Sample {
+	now := time.Now()
+	egress, requests := s.counters()
+	sample := w.Flush(now, now.Sub(s.last), egress-s.lastEgress, requests-s.lastRequests)
+	s.last, s.lastEgress, s.lastRequests = now, egress, requests
+	return sample
+}
+
+// runChurn measures steady-state distribution performance while new blobs
+// are continuously uploaded and pulled.
+func runChurn(args []string) {
+	flags := flag.NewFlagSet("churn", flag.ExitOnError)
+	origins := flags.String("origins", "", "comma separated origin addresses")
+	agents := flags.String("agents", "", "comma separated agent server addresses")
+	trackers := flags.String("trackers", "", "comma separated tracker addresses, used to measure tracker qps")
+	namespace := flags.String("namespace", "", "namespace of uploaded blobs")
+	rate := flags.Float64("rate", 0.2, "blobs uploaded per second")
+	size := flags.String("size", "16MB", "size of uploaded blobs")
+	duration := flags.Duration("duration", 10*time.Minute, "duration of the benchmark")
+	interval := flags.Duration("interval", 10*time.Second, "interval between samples")
+	format := flags.String("format", "tsv", "report format, tsv or json")
+	output := flags.String("output", "", "report file, defaults to stdout")
+	flags.Parse(args)
+
+	originAddrs := splitAddrs(*origins)
+	agentAddrs := splitAddrs(*agents)
+	if len(originAddrs) == 0 || len(agentAddrs) == 0 || *namespace == "" {
+		fatalf("-origins, -agents and -namespace are required")
+	}
+	if *rate <= 0 {
+		fatalf("-rate must be positive")
+	}
+	if *format != "tsv" && *format != "json" {
+		fatalf("unknown format %q", *format)
+	}
+	var blobSize datasize.ByteSize
+	if err := blobSize.UnmarshalText([]byte(*size)); err != nil {
+		fatalf("parse size: %s", err)
+	}
+	hosts, err := hostlist.New(hostlist.Config{Static: originAddrs})
+	if err != nil {
+		fatalf("origin hosts: %s", err)
+	}
+	out := os.Stdout
+	if *output != "" {
+		out, err = os.Create(*output)
+		if err != nil {
+			fatalf("create output: %s", err)
+		}
+		defer out.Close()
+	}
+
+	c := &churn{
+		origins: blobclient.NewClusterClient(
+			blobclient.NewClientResolver(blobclient.NewProvider(), hosts)),
+		agents:    agentAddrs,
+		namespace: *namespace,
+		size:      blobSize.Bytes(),
+		window:    &benchmark.Window{},
+	}
+	s := &sampler{origins: originAddrs, trackers: splitAddrs(*trackers)}
+	s.start()
+
+	uploads := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+	defer uploads.Stop()
+	samples := time.NewTicker(*interval)
+	defer samples.Stop()
+	done := time.After(*duration)
+
+	var results []benchmark.Sample
+LOOP:
+	for {
+		select {
+		case <-uploads.C:
+			c.wg.Add(1)
+			go c.uploadAndPull()
+		case <-samples.C:
+			sample := s.sample(c.window)
+			fmt.Fprintf(os.Stderr, "%s uploads=%d pulls=%d failures=%d p50=%s p99=%s\n",
+				sample.Time.Format(time.RFC3339), sample.Uploads, sample.Pulls,
+				sample.Failures, sample.P50, sample.P99)
+			results = append(results, sample)
+		case <-done:
+			break LOOP
+		}
+	}
+
+	// Let in-flight pulls finish so they are included in the final sample.
+	c.wg.Wait()
+	results = append(results, s.sample(c.window))
+
+	if *format == "json" {
+		err = benchmark.WriteJSON(out, results)
+	} else {
+		err = benchmark.WriteTSV(out, results)
+	}
+	if err != nil {
+		fatalf("write report: %s", err)
+	}
+}
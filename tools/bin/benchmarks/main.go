@@ -0,0 +1,52 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// benchmarks measures the performance of a Kraken cluster. Commands:
+//
+// serve measures how fast an origin serves a cached blob to concurrent
+// clients, e.g. to compare blob serving changes:
+//
+//	benchmarks serve -origin localhost:15002 -namespace testfs -digest sha256:... -c 16 -n 1000
+//
+// churn continuously uploads new blobs while agents pull them, and reports
+// steady-state pull latency, origin egress and tracker request rates over
+// time:
+//
+//	benchmarks churn -origins localhost:15002 -agents localhost:16000 -trackers localhost:15003 \
+//	    -namespace testfs -rate 0.5 -size 64MB -duration 30m -interval 30s -format tsv
+//
+// For backwards compatibility, serve is run if no command is given.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	cmd := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "serve":
+		runServe(args)
+	case "churn":
+		runChurn(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected serve or churn\n", cmd)
+		os.Exit(1)
+	}
+}
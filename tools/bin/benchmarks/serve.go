@@ -0,0 +1,133 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/memsize"
+)
+
+type result struct {
+	latency time.Duration
+	bytes   int64
+	err     error
+}
+
+func download(u string, method string, transport http.RoundTripper) result {
+	start := time.Now()
+	resp, err := httputil.Send(
+		method, u, httputil.SendTransport(transport), httputil.SendTimeout(5*time.Minute))
+	if err != nil {
+		return result{err: err}
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	return result{time.Since(start), n, err}
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	return latencies[int(float64(len(latencies)-1)*p)]
+}
+
+// runServe measures how fast an origin serves a cached blob to concurrent
+// clients.
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	origin := flags.String("origin", "", "origin address")
+	namespace := flags.String("namespace", "", "blob namespace")
+	digest := flags.String("digest", "", "digest of a blob cached on the origin")
+	concurrency := flags.Int("c", 8, "number of concurrent clients")
+	requests := flags.Int("n", 100, "total number of requests")
+	method := flags.String("method", http.MethodGet, "GET or HEAD")
+	pooled := flags.Bool("pooled", true, "reuse connections between requests")
+	flags.Parse(args)
+
+	if *origin == "" || *namespace == "" || *digest == "" {
+		fmt.Fprintln(os.Stderr, "-origin, -namespace and -digest are required")
+		os.Exit(1)
+	}
+	d, err := core.ParseSHA256Digest(*digest)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "parse digest: %s\n", err)
+		os.Exit(1)
+	}
+	u := fmt.Sprintf(
+		"http://%s/namespace/%s/blobs/%s", *origin, url.PathEscape(*namespace), d)
+
+	var transport http.RoundTripper = httputil.NewPooledTransport(*concurrency)
+	if !*pooled {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DisableKeepAlives = true
+		transport = t
+	}
+
+	jobs := make(chan struct{}, *requests)
+	for i := 0; i < *requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	results := make(chan result, *requests)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				results <- download(u, *method, transport)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(results)
+
+	var latencies []time.Duration
+	var total int64
+	var failures int
+	for r := range results {
+		if r.err != nil {
+			failures++
+			fmt.Fprintf(os.Stderr, "request failed: %s\n", r.err)
+			continue
+		}
+		latencies = append(latencies, r.latency)
+		total += r.bytes
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("requests:   %d (%d failed)\n", *requests, failures)
+	fmt.Printf("elapsed:    %s\n", elapsed)
+	fmt.Printf("throughput: %.2f MB/s, %.2f req/s\n",
+		float64(total)/float64(memsize.MB)/elapsed.Seconds(),
+		float64(len(latencies))/elapsed.Seconds())
+	fmt.Printf("latency:    p50 %s, p90 %s, p99 %s\n",
+		percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99))
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// versioncheck queries the /version endpoint of every component in a cluster
+// and flags component combinations which are incompatible, e.g. agents which
+// were upgraded before the trackers they announce to.
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/lib/buildinfo"
+	"github.com/uber/kraken/tools/lib"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+type instance struct {
+	component string
+	addr      string
+}
+
+func (i instance) String() string {
+	return fmt.Sprintf("%s %s", i.component, i.addr)
+}
+
+func fetch(i instance, config *tls.Config) (buildinfo.Info, error) {
+	var info buildinfo.Info
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/version", i.addr),
+		httputil.SendTLS(config),
+		httputil.SendTimeout(5*time.Second))
+	if err != nil {
+		if httputil.IsNotFound(err) {
+			return info, fmt.Errorf("%s: no /version endpoint, build predates version reporting", i)
+		}
+		return info, fmt.Errorf("%s: %s", i, err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return info, fmt.Errorf("%s: decode version: %s", i, err)
+	}
+	if info.Component != i.component {
+		return info, fmt.Errorf("%s: address serves %s", i, info.Component)
+	}
+	return info, nil
+}
+
+func main() {
+	addrs := map[string]*string{
+		buildinfo.Agent:      flag.String("agents", "", "comma-separated agent server addresses"),
+		buildinfo.Origin:     flag.String("origins", "", "comma-separated origin server addresses"),
+		buildinfo.Tracker:    flag.String("trackers", "", "comma-separated tracker server addresses"),
+		buildinfo.BuildIndex: flag.String("build-indexes", "", "comma-separated build-index server addresses"),
+		buildinfo.Proxy:      flag.String("proxies", "", "comma-separated proxy server addresses"),
+	}
+	tlsFile := flag.String("tls", "", "optional tls client config file")
+	flag.Parse()
+
+	var config *tls.Config
+	if *tlsFile != "" {
+		var err error
+		config, err = lib.ReadTLSFile(tlsFile)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var instances []instance
+	for component, s := range addrs {
+		if *s == "" {
+			continue
+		}
+		for _, addr := range strings.Split(*s, ",") {
+			instances = append(instances, instance{component, addr})
+		}
+	}
+	if len(instances) == 0 {
+		panic("must set at least one of -agents, -origins, -trackers, -build-indexes, -proxies")
+	}
+
+	var mu sync.Mutex
+	infos := make(map[string]buildinfo.Info)
+	var errs []string
+	var wg sync.WaitGroup
+	for _, i := range instances {
+		wg.Add(1)
+		go func(i instance) {
+			defer wg.Done()
+			info, err := fetch(i, config)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err.Error())
+				return
+			}
+			infos[i.String()] = info
+		}(i)
+	}
+	wg.Wait()
+
+	var labels []string
+	for label := range infos {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		info := infos[label]
+		fmt.Printf("%s\t%s\t%s\t%s\n", label, info.Version, info.GitSHA, info.GoVersion)
+	}
+
+	sort.Strings(errs)
+	for _, err := range errs {
+		fmt.Printf("ERROR: %s\n", err)
+	}
+	incompatible := buildinfo.Check(infos)
+	for _, i := range incompatible {
+		fmt.Printf("INCOMPATIBLE: %s\n", i)
+	}
+	if len(errs) > 0 || len(incompatible) > 0 {
+		os.Exit(1)
+	}
+}
@@ -23,10 +23,14 @@ import (
 
 func main() {
 	eventFile := kingpin.Arg("events", "Network event file").Required().File()
+	schema := kingpin.Flag("schema", "Network event schema version").Default("1").Int()
 	port := kingpin.Flag("port", "listening port").Default("3000").Int()
 	kingpin.Parse()
 
-	s := newServer(*eventFile)
+	s, err := newServer(*eventFile, *schema)
+	if err != nil {
+		log.Fatalf("Error reading events: %s", err)
+	}
 	addr := fmt.Sprintf("localhost:%d", *port)
 	log.Printf("Listening on %s ...", addr)
 	log.Fatal(http.ListenAndServe(addr, s.handler()))
@@ -14,9 +14,9 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -30,18 +30,22 @@ type server struct {
 	events []*networkevent.Event
 }
 
-func newServer(eventFile *os.File) *server {
+func newServer(eventFile *os.File, schema int) (*server, error) {
+	d, err := networkevent.NewDecoder(eventFile, schema)
+	if err != nil {
+		return nil, err
+	}
 	var events []*networkevent.Event
-
-	scanner := bufio.NewScanner(eventFile)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		var event networkevent.Event
-		if err := json.Unmarshal(line, &event); err != nil {
-			log.Printf("Error unmarshalling event: %s\n", err)
+	for {
+		event, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Error decoding event: %s\n", err)
 			continue
 		}
-		events = append(events, &event)
+		events = append(events, event)
 	}
 	events = networkevent.Filter(
 		events,
@@ -54,7 +58,7 @@ func newServer(eventFile *os.File) *server {
 		networkevent.TorrentCancelled)
 	networkevent.Sort(events)
 
-	return &server{events}
+	return &server{events}, nil
 }
 
 func (s *server) handler() http.Handler {
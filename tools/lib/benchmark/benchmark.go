@@ -0,0 +1,182 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package benchmark
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/uber/kraken/lib/torrent/networkevent"
+	"github.com/uber/kraken/lib/torrent/storage/originstorage"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/stringset"
+)
+
+// OriginEgress sums the egress stats of all origins in addrs.
+func OriginEgress(addrs []string) (originstorage.EgressStats, error) {
+	var total originstorage.EgressStats
+	for _, addr := range addrs {
+		resp, err := httputil.Get(fmt.Sprintf("http://%s/stats/egress", addr))
+		if err != nil {
+			return originstorage.EgressStats{}, fmt.Errorf("get %s egress: %s", addr, err)
+		}
+		var stats originstorage.EgressStats
+		err = json.NewDecoder(resp.Body).Decode(&stats)
+		resp.Body.Close()
+		if err != nil {
+			return originstorage.EgressStats{}, fmt.Errorf("decode %s egress: %s", addr, err)
+		}
+		total.P2PBytes += stats.P2PBytes
+		total.HTTPBytes += stats.HTTPBytes
+	}
+	return total, nil
+}
+
+// ReadNetworkEvents parses newline delimited network events, as written by
+// the networkevent producer and consumed from kafka.
+func ReadNetworkEvents(r io.Reader) ([]*networkevent.Event, error) {
+	var events []*networkevent.Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := new(networkevent.Event)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("unmarshal event: %s", err)
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan: %s", err)
+	}
+	return events, nil
+}
+
+// Run is the result of a single benchmark run.
+type Run struct {
+	// Latencies of every torrent download, from add to completion.
+	Latencies []time.Duration
+
+	// Pieces received by agents from origins and from other agents.
+	OriginPieces int
+	PeerPieces   int
+
+	// OriginEgress is the bytes served by origins during the run.
+	OriginEgress originstorage.EgressStats
+}
+
+// NewRun builds a Run from the network events emitted during the run and the
+// origin egress sampled before and after the run. Origins are identified by
+// peer id.
+func NewRun(
+	events []*networkevent.Event,
+	origins stringset.Set,
+	before, after originstorage.EgressStats) Run {
+
+	type download struct {
+		torrent string
+		self    string
+	}
+	added := make(map[download]time.Time)
+	run := Run{OriginEgress: after.Sub(before)}
+	for _, e := range events {
+		if origins.Has(e.Self) {
+			continue
+		}
+		k := download{e.Torrent, e.Self}
+		switch e.Name {
+		case networkevent.AddTorrent:
+			added[k] = e.Time
+		case networkevent.TorrentComplete:
+			if start, ok := added[k]; ok {
+				run.Latencies = append(run.Latencies, e.Time.Sub(start))
+				delete(added, k)
+			}
+		case networkevent.ReceivePiece:
+			if origins.Has(e.Peer) {
+				run.OriginPieces++
+			} else {
+				run.PeerPieces++
+			}
+		}
+	}
+	return run
+}
+
+// OffloadRatio returns the fraction of pieces which agents received from
+// other agents instead of origins.
+func (r Run) OffloadRatio() float64 {
+	total := r.OriginPieces + r.PeerPieces
+	if total == 0 {
+		return 0
+	}
+	return float64(r.PeerPieces) / float64(total)
+}
+
+// Report summarizes a set of benchmark runs.
+type Report struct {
+	Runs         int           `json:"runs"`
+	P50          time.Duration `json:"p50"`
+	P90          time.Duration `json:"p90"`
+	P99          time.Duration `json:"p99"`
+	OriginEgress int64         `json:"origin_egress_bytes"`
+	OffloadRatio float64       `json:"offload_ratio"`
+}
+
+// NewReport aggregates runs into a Report. The offload ratio is computed over
+// all pieces received across runs.
+func NewReport(runs []Run) Report {
+	var latencies []time.Duration
+	var total Run
+	for _, r := range runs {
+		latencies = append(latencies, r.Latencies...)
+		total.OriginPieces += r.OriginPieces
+		total.PeerPieces += r.PeerPieces
+		total.OriginEgress.P2PBytes += r.OriginEgress.P2PBytes
+		total.OriginEgress.HTTPBytes += r.OriginEgress.HTTPBytes
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return Report{
+		Runs:         len(runs),
+		P50:          percentile(latencies, 50),
+		P90:          percentile(latencies, 90),
+		P99:          percentile(latencies, 99),
+		OriginEgress: total.OriginEgress.Total(),
+		OffloadRatio: total.OffloadRatio(),
+	}
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"runs=%d p50=%s p90=%s p99=%s origin_egress=%dB offload=%.1f%%",
+		r.Runs, r.P50, r.P90, r.P99, r.OriginEgress, r.OffloadRatio*100)
+}
+
+// percentile returns the nearest-rank percentile p of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// TrackerRequests sums the requests served by all trackers in addrs since
+// startup.
+func TrackerRequests(addrs []string) (int64, error) {
+	var total int64
+	for _, addr := range addrs {
+		resp, err := httputil.Get(fmt.Sprintf("http://%s/x/stats/requests", addr))
+		if err != nil {
+			return 0, fmt.Errorf("get %s requests: %s", addr, err)
+		}
+		var routes map[string]int64
+		err = json.NewDecoder(resp.Body).Decode(&routes)
+		resp.Body.Close()
+		if err != nil {
+			return 0, fmt.Errorf("decode %s requests: %s", addr, err)
+		}
+		for _, n := range routes {
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// Sample summarizes one interval of a churn benchmark.
+type Sample struct {
+	Time             time.Time     `json:"time"`
+	Uploads          int           `json:"uploads"`
+	Pulls            int           `json:"pulls"`
+	Failures         int           `json:"failures"`
+	P50              time.Duration `json:"p50"`
+	P99              time.Duration `json:"p99"`
+	OriginEgressRate float64       `json:"origin_egress_bytes_per_sec"`
+	TrackerQPS       float64       `json:"tracker_qps"`
+}
+
+// Window accumulates the uploads and pulls of the current sampling interval.
+// It is safe for concurrent use.
+type Window struct {
+	mu        sync.Mutex
+	uploads   int
+	failures  int
+	latencies []time.Duration
+}
+
+// Upload records a successful upload.
+func (w *Window) Upload() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.uploads++
+}
+
+// Pull records a successful pull which took latency.
+func (w *Window) Pull(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.latencies = append(w.latencies, latency)
+}
+
+// Failure records a failed upload or pull.
+func (w *Window) Failure() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failures++
+}
+
+// Flush returns a Sample of the current interval, which lasted elapsed and
+// during which origins served egress bytes and trackers served requests, and
+// resets the window.
+func (w *Window) Flush(now time.Time, elapsed time.Duration, egress, requests int64) Sample {
+	w.mu.Lock()
+	latencies := w.latencies
+	s := Sample{
+		Time:     now,
+		Uploads:  w.uploads,
+		Pulls:    len(latencies),
+		Failures: w.failures,
+	}
+	w.uploads, w.failures, w.latencies = 0, 0, nil
+	w.mu.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.P50 = percentile(latencies, 50)
+	s.P99 = percentile(latencies, 99)
+	if elapsed > 0 {
+		s.OriginEgressRate = float64(egress) / elapsed.Seconds()
+		s.TrackerQPS = float64(requests) / elapsed.Seconds()
+	}
+	return s
+}
+
+// WriteTSV writes samples as tab separated values with a header row.
+func WriteTSV(w io.Writer, samples []Sample) error {
+	if _, err := fmt.Fprintln(w, "time\tuploads\tpulls\tfailures\tp50\tp99\torigin_egress_bytes_per_sec\ttracker_qps"); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		_, err := fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%.0f\t%.2f\n",
+			s.Time.Format(time.RFC3339), s.Uploads, s.Pulls, s.Failures,
+			s.P50, s.P99, s.OriginEgressRate, s.TrackerQPS)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes samples as a JSON array.
+func WriteJSON(w io.Writer, samples []Sample) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(samples)
+}
@@ -15,11 +15,10 @@ package image
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -39,8 +38,25 @@ func run(name string, args ...string) error {
 	return nil
 }
 
-// Generate creates a random image.
+// Generate creates an image of random content with numLayers layers of equal
+// size.
 func Generate(size uint64, numLayers int) (name string, err error) {
+	p := RandomProfile
+	p.Seed = time.Now().UnixNano()
+	return GenerateWithProfile(size, numLayers, p)
+}
+
+// GenerateWithProfile creates an image with numLayers layers whose sizes and
+// content follow p.
+func GenerateWithProfile(size uint64, numLayers int, p Profile) (name string, err error) {
+	if numLayers <= 0 {
+		return "", errors.New("number of layers must be positive")
+	}
+	if err := p.validate(); err != nil {
+		return "", fmt.Errorf("invalid profile: %s", err)
+	}
+	g := newContentGenerator(p.applyDefaults())
+
 	dir, err := ioutil.TempDir("", "")
 	if err != nil {
 		return "", fmt.Errorf("temp dir: %s", err)
@@ -53,21 +69,22 @@ func Generate(size uint64, numLayers int) (name string, err error) {
 	if err != nil {
 		return "", fmt.Errorf("create dockerfile: %s", err)
 	}
+	defer dockerfile.Close()
 	log.Printf("Generating dockerfile %s", dockerfile.Name())
 
 	if _, err := fmt.Fprintln(dockerfile, "FROM scratch"); err != nil {
 		return "", fmt.Errorf("fprint dockerfile: %s", err)
 	}
 
-	layerSize := size / uint64(numLayers)
-	for i := 0; i < numLayers; i++ {
+	for i, layerSize := range g.layerSizes(size, numLayers) {
 		f, err := os.Create(fmt.Sprintf("%s/file_%d", dir, i))
 		if err != nil {
 			return "", fmt.Errorf("create file: %s", err)
 		}
-		r := io.LimitReader(rand.New(rand.NewSource(time.Now().Unix())), int64(layerSize))
-		if _, err := io.Copy(f, r); err != nil {
-			return "", fmt.Errorf("copy rand: %s", err)
+		err = g.writeLayer(f, layerSize)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("write layer: %s", err)
 		}
 		layerName := filepath.Base(f.Name())
 		if _, err := fmt.Fprintf(dockerfile, "COPY %s /\n", layerName); err != nil {
@@ -0,0 +1,212 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	"github.com/uber/kraken/utils/memsize"
+)
+
+// Profile describes the content of generated layers. Layers of uniformly
+// random data are incompressible and never repeat, which overstates the cost
+// of distributing real images, whose layers are mostly text and binaries and
+// often share content.
+type Profile struct {
+	// Compressibility is the fraction of layer content which is text-like and
+	// compresses well. The rest is random data which does not compress.
+	Compressibility float64
+
+	// DuplicateRatio is the fraction of chunks which repeat a chunk generated
+	// earlier in the same image, possibly in another layer.
+	DuplicateRatio float64
+
+	// ChunkSize is the granularity at which content is compressible or
+	// duplicated. Defaults to 64KB.
+	ChunkSize uint64
+
+	// LayerSizes is the distribution layer sizes are sampled from. Sampled
+	// sizes are scaled such that layers add up to the image size. Layers are
+	// of equal size if empty.
+	LayerSizes []LayerSizeBucket
+
+	// Seed seeds the generated content. Images generated with the same profile
+	// and seed are identical.
+	Seed int64
+}
+
+// LayerSizeBucket is a bucket of a layer size histogram. Layer sizes are
+// sampled uniformly within a bucket, and buckets are picked by weight.
+type LayerSizeBucket struct {
+	Weight float64
+	Min    uint64
+	Max    uint64
+}
+
+// RandomProfile generates layers of equal size and random content.
+var RandomProfile = Profile{}
+
+// TypicalProfile approximates layers of images built by CI pipelines: about
+// half of the content compresses well, a fifth of chunks are duplicates (e.g.
+// the same files copied into several layers), and most layers are small
+// while a few large layers (base images, dependencies) hold most bytes.
+var TypicalProfile = Profile{
+	Compressibility: 0.5,
+	DuplicateRatio:  0.2,
+	LayerSizes: []LayerSizeBucket{
+		{Weight: 0.45, Min: 1 * memsize.KB, Max: 1 * memsize.MB},
+		{Weight: 0.30, Min: 1 * memsize.MB, Max: 10 * memsize.MB},
+		{Weight: 0.20, Min: 10 * memsize.MB, Max: 100 * memsize.MB},
+		{Weight: 0.05, Min: 100 * memsize.MB, Max: 500 * memsize.MB},
+	},
+}
+
+func (p Profile) applyDefaults() Profile {
+	if p.ChunkSize == 0 {
+		p.ChunkSize = 64 * memsize.KB
+	}
+	return p
+}
+
+func (p Profile) validate() error {
+	if p.Compressibility < 0 || p.Compressibility > 1 {
+		return fmt.Errorf("compressibility must be within [0, 1]: %f", p.Compressibility)
+	}
+	if p.DuplicateRatio < 0 || p.DuplicateRatio > 1 {
+		return fmt.Errorf("duplicate ratio must be within [0, 1]: %f", p.DuplicateRatio)
+	}
+	for _, b := range p.LayerSizes {
+		if b.Weight < 0 || b.Min > b.Max {
+			return fmt.Errorf("invalid layer size bucket: %+v", b)
+		}
+	}
+	return nil
+}
+
+// _vocabulary is the set of words text-like chunks are made of.
+var _vocabulary = strings.Fields(`
+	the of and to in is for on with as by at from that this be are or an it
+	main func return if else for range var const type struct interface package
+	import error nil string int bool byte true false lib usr bin etc share local
+	include define static void char unsigned long config json yaml xml http
+	server client request response version build release debug info warn`)
+
+// contentGenerator generates chunks of layer content according to a Profile.
+type contentGenerator struct {
+	profile Profile
+	rand    *rand.Rand
+	chunks  [][]byte // Previously generated chunks, candidates for duplicates.
+}
+
+// _maxChunks bounds the memory used to remember chunks for duplicates.
+const _maxChunks = 256
+
+func newContentGenerator(p Profile) *contentGenerator {
+	return &contentGenerator{profile: p, rand: rand.New(rand.NewSource(p.Seed))}
+}
+
+// layerSizes samples numLayers layer sizes which add up to size.
+func (g *contentGenerator) layerSizes(size uint64, numLayers int) []uint64 {
+	sizes := make([]uint64, numLayers)
+	if len(g.profile.LayerSizes) == 0 {
+		for i := range sizes {
+			sizes[i] = size / uint64(numLayers)
+		}
+		return sizes
+	}
+	var totalWeight float64
+	for _, b := range g.profile.LayerSizes {
+		totalWeight += b.Weight
+	}
+	samples := make([]float64, numLayers)
+	var sum float64
+	for i := range samples {
+		r := g.rand.Float64() * totalWeight
+		b := g.profile.LayerSizes[len(g.profile.LayerSizes)-1]
+		for _, candidate := range g.profile.LayerSizes {
+			if r < candidate.Weight {
+				b = candidate
+				break
+			}
+			r -= candidate.Weight
+		}
+		samples[i] = float64(b.Min) + g.rand.Float64()*float64(b.Max-b.Min)
+		sum += samples[i]
+	}
+	for i := range sizes {
+		if sum > 0 {
+			sizes[i] = uint64(samples[i] / sum * float64(size))
+		} else {
+			sizes[i] = size / uint64(numLayers)
+		}
+	}
+	return sizes
+}
+
+// chunk returns the next chunk of content, of length n.
+func (g *contentGenerator) chunk(n uint64) []byte {
+	if len(g.chunks) > 0 && g.rand.Float64() < g.profile.DuplicateRatio {
+		c := g.chunks[g.rand.Intn(len(g.chunks))]
+		if uint64(len(c)) >= n {
+			return c[:n]
+		}
+	}
+	var c []byte
+	if g.rand.Float64() < g.profile.Compressibility {
+		c = g.text(n)
+	} else {
+		c = make([]byte, n)
+		g.rand.Read(c)
+	}
+	if len(g.chunks) < _maxChunks {
+		g.chunks = append(g.chunks, c)
+	} else {
+		g.chunks[g.rand.Intn(_maxChunks)] = c
+	}
+	return c
+}
+
+// text returns n bytes of text-like content.
+func (g *contentGenerator) text(n uint64) []byte {
+	var b bytes.Buffer
+	b.Grow(int(n) + 16)
+	for uint64(b.Len()) < n {
+		b.WriteString(_vocabulary[g.rand.Intn(len(_vocabulary))])
+		if g.rand.Intn(12) == 0 {
+			b.WriteByte('\n')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.Bytes()[:n]
+}
+
+// writeLayer writes size bytes of content to w.
+func (g *contentGenerator) writeLayer(w io.Writer, size uint64) error {
+	for size > 0 {
+		n := g.profile.ChunkSize
+		if n > size {
+			n = size
+		}
+		if _, err := w.Write(g.chunk(n)); err != nil {
+			return err
+		}
+		size -= n
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import "time"
+
+// Config defines tracing configuration.
+type Config struct {
+	Exporter string       `yaml:"exporter"`
+	Stdout   StdoutConfig `yaml:"stdout"`
+	OTLP     OTLPConfig   `yaml:"otlp"`
+
+	// SampleRatio is the fraction of root traces which are sampled. Child
+	// spans follow the sampling decision of their parent. Defaults to 1.
+	SampleRatio float64 `yaml:"sample_ratio"`
+
+	// Rules override SampleRatio for matching spans. The first matching rule
+	// applies. Rules can also be set remotely and overridden at runtime
+	// through /x/config/tracing.
+	Rules []SamplingRule `yaml:"rules"`
+}
+
+// SamplingRule defines the sample ratio of spans matching all of its non-empty
+// regular expressions.
+type SamplingRule struct {
+	// Component restricts the rule to a component, e.g. kraken-origin.
+	Component string `yaml:"component" json:"component,omitempty"`
+
+	// Span is matched against the span name.
+	Span string `yaml:"span" json:"span,omitempty"`
+
+	// Route is matched against the request path of server spans.
+	Route string `yaml:"route" json:"route,omitempty"`
+
+	// Namespace is matched against the namespace of spans which carry one.
+	Namespace string `yaml:"namespace" json:"namespace,omitempty"`
+
+	// Ratio is the fraction of matching traces which are sampled.
+	Ratio float64 `yaml:"ratio" json:"ratio"`
+}
+
+// StdoutConfig defines stdout exporter configuration.
+type StdoutConfig struct {
+	// Path is the file spans are appended to. Defaults to stdout.
+	Path string `yaml:"path"`
+}
+
+// OTLPConfig configures exporting spans to an OpenTelemetry collector over
+// OTLP/HTTP.
+type OTLPConfig struct {
+	// Endpoint is the host:port of the collector. Defaults to localhost:4318.
+	Endpoint string `yaml:"endpoint"`
+
+	// URLPath is the path spans are posted to. Defaults to /v1/traces.
+	URLPath string `yaml:"url_path"`
+
+	// Insecure disables TLS.
+	Insecure bool `yaml:"insecure"`
+
+	// Headers are added to every export request, e.g. for authentication.
+	Headers map[string]string `yaml:"headers"`
+
+	// Gzip compresses export requests.
+	Gzip bool `yaml:"gzip"`
+
+	// Timeout bounds each export request. Defaults to 10s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.SampleRatio == 0 {
+		c.SampleRatio = 1
+	}
+	if c.OTLP.Endpoint == "" {
+		c.OTLP.Endpoint = "localhost:4318"
+	}
+	if c.OTLP.URLPath == "" {
+		c.OTLP.URLPath = "/v1/traces"
+	}
+	if c.OTLP.Timeout == 0 {
+		c.OTLP.Timeout = 10 * time.Second
+	}
+	return c
+}
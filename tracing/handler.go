@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+
+	"github.com/go-chi/chi"
+)
+
+const _defaultOverrideTTL = 15 * time.Minute
+
+// Handler returns an http.Handler which exposes the global Sampling:
+//
+//	GET    /   returns the sampling state.
+//	PUT    /   overrides the sampling rules with the JSON rules in the body,
+//	           for the duration of the `ttl` query arg (defaults to 15m).
+//	DELETE /   clears the override of the sampling rules.
+func Handler() http.Handler {
+	return newHandler(GlobalSampling)
+}
+
+func newHandler(sampling func() *Sampling) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		if err := json.NewEncoder(w).Encode(sampling().State()); err != nil {
+			return handler.Errorf("json encode: %s", err)
+		}
+		return nil
+	}))
+
+	r.Put("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		ttl, err := time.ParseDuration(
+			httputil.GetQueryArg(r, "ttl", _defaultOverrideTTL.String()))
+		if err != nil || ttl <= 0 {
+			return handler.Errorf("invalid query arg `ttl`").Status(http.StatusBadRequest)
+		}
+		var rules []SamplingRule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+		}
+		if err := sampling().Override(rules, ttl); err != nil {
+			return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+		}
+		return nil
+	}))
+
+	r.Delete("/", handler.Wrap(func(w http.ResponseWriter, r *http.Request) error {
+		sampling().ClearOverride()
+		return nil
+	}))
+
+	return r
+}
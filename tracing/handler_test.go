@@ -0,0 +1,89 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	require := require.New(t)
+
+	s, err := newSampling(Config{SampleRatio: 0.1}, "test", clock.New())
+	require.NoError(err)
+
+	addr, stop := testutil.StartServer(newHandler(func() *Sampling { return s }))
+	defer stop()
+
+	getState := func() SamplingState {
+		resp, err := httputil.Get(fmt.Sprintf("http://%s/", addr))
+		require.NoError(err)
+		defer resp.Body.Close()
+		var state SamplingState
+		require.NoError(json.NewDecoder(resp.Body).Decode(&state))
+		return state
+	}
+
+	require.Empty(getState().Overrides)
+
+	rules := []SamplingRule{{Namespace: "foo", Ratio: 1}}
+	b, err := json.Marshal(rules)
+	require.NoError(err)
+
+	_, err = httputil.Put(
+		fmt.Sprintf("http://%s/?ttl=5m", addr), httputil.SendBody(bytes.NewReader(b)))
+	require.NoError(err)
+
+	require.Equal(rules, getState().Overrides)
+
+	_, err = httputil.Delete(fmt.Sprintf("http://%s/", addr))
+	require.NoError(err)
+
+	require.Empty(getState().Overrides)
+}
+
+func TestHandlerRejectsInvalidOverrides(t *testing.T) {
+	require := require.New(t)
+
+	s, err := newSampling(Config{}, "test", clock.New())
+	require.NoError(err)
+
+	addr, stop := testutil.StartServer(newHandler(func() *Sampling { return s }))
+	defer stop()
+
+	for _, test := range []struct {
+		query string
+		body  string
+	}{
+		{"", `[{"namespace": "(", "ratio": 1}]`},
+		{"", `not json`},
+		{"?ttl=-1m", `[]`},
+		{"?ttl=foo", `[]`},
+	} {
+		_, err := httputil.Put(
+			fmt.Sprintf("http://%s/%s", addr, test.query),
+			httputil.SendBody(bytes.NewReader([]byte(test.body))))
+		require.True(httputil.IsStatus(err, http.StatusBadRequest), "%s %s: %s", test.query, test.body, err)
+	}
+}
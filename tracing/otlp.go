@@ -0,0 +1,47 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func newOTLPExporter(config Config) (sdktrace.SpanExporter, io.Closer, error) {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(config.OTLP.Endpoint),
+		otlptracehttp.WithURLPath(config.OTLP.URLPath),
+		otlptracehttp.WithTimeout(config.OTLP.Timeout),
+	}
+	if config.OTLP.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(config.OTLP.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(config.OTLP.Headers))
+	}
+	if config.OTLP.Gzip {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
+	// Does not connect to the collector until spans are exported, so an
+	// unavailable collector does not prevent startup.
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The tracer provider shuts down the exporter.
+	return exporter, nopCloser{}, nil
+}
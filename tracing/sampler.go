@@ -0,0 +1,293 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// NamespaceKey is the attribute key of the namespace of a span, which
+// namespace sampling rules are matched against.
+const NamespaceKey = attribute.Key("namespace")
+
+type samplingRule struct {
+	config    SamplingRule
+	span      *regexp.Regexp
+	route     *regexp.Regexp
+	namespace *regexp.Regexp
+	sampler   sdktrace.Sampler
+}
+
+func compileRules(rules []SamplingRule) ([]samplingRule, error) {
+	compile := func(expr string) (*regexp.Regexp, error) {
+		if expr == "" {
+			return nil, nil
+		}
+		return regexp.Compile(expr)
+	}
+	var result []samplingRule
+	for i, rc := range rules {
+		if rc.Ratio < 0 || rc.Ratio > 1 {
+			return nil, fmt.Errorf("rule %d: ratio %v not in [0, 1]", i, rc.Ratio)
+		}
+		r := samplingRule{config: rc, sampler: sdktrace.TraceIDRatioBased(rc.Ratio)}
+		var err error
+		if r.span, err = compile(rc.Span); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid span: %s", i, err)
+		}
+		if r.route, err = compile(rc.Route); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid route: %s", i, err)
+		}
+		if r.namespace, err = compile(rc.Namespace); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid namespace: %s", i, err)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func matchAttribute(re *regexp.Regexp, attrs []attribute.KeyValue, key attribute.Key) bool {
+	if re == nil {
+		return true
+	}
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return re.MatchString(kv.Value.Emit())
+		}
+	}
+	return false
+}
+
+func (r samplingRule) matches(component string, p sdktrace.SamplingParameters) bool {
+	if r.config.Component != "" && r.config.Component != component {
+		return false
+	}
+	if r.span != nil && !r.span.MatchString(p.Name) {
+		return false
+	}
+	return matchAttribute(r.route, p.Attributes, semconv.HTTPTargetKey) &&
+		matchAttribute(r.namespace, p.Attributes, NamespaceKey)
+}
+
+// Sampling decides which traces are sampled. Sampling rules are looked up, in
+// order of precedence, in runtime overrides, remote rules and configured rules.
+// Spans matching no rule are sampled by the configured ratio.
+//
+// Spans continuing a sampled remote trace are always sampled. Spans continuing
+// an unsampled remote trace are only sampled if they match a rule, such that
+// sampling can be turned up on a single component.
+type Sampling struct {
+	component string
+	ratio     float64
+	clk       clock.Clock
+
+	mu              sync.RWMutex
+	rules           []samplingRule
+	remote          []samplingRule
+	overrides       []samplingRule
+	overridesExpire time.Time
+	defaultSampler  sdktrace.Sampler
+}
+
+func newSampling(config Config, component string, clk clock.Clock) (*Sampling, error) {
+	config = config.applyDefaults()
+	rules, err := compileRules(config.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Sampling{
+		component:      component,
+		ratio:          config.SampleRatio,
+		clk:            clk,
+		rules:          rules,
+		defaultSampler: sdktrace.TraceIDRatioBased(config.SampleRatio),
+	}, nil
+}
+
+// SetRemote replaces the remote rules of s. Nil rules clear the remote rules.
+func (s *Sampling) SetRemote(rules []SamplingRule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remote = compiled
+	return nil
+}
+
+// ApplyRemote sets the remote rules of s from a remote config section of the
+// form {"rules": [...]}. A nil section clears the remote rules.
+func (s *Sampling) ApplyRemote(section json.RawMessage) error {
+	var remote struct {
+		Rules []SamplingRule `json:"rules"`
+	}
+	if section != nil {
+		if err := json.Unmarshal(section, &remote); err != nil {
+			return err
+		}
+	}
+	return s.SetRemote(remote.Rules)
+}
+
+// Override replaces the runtime overrides of s with rules until ttl elapses.
+func (s *Sampling) Override(rules []SamplingRule, ttl time.Duration) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides = compiled
+	s.overridesExpire = s.clk.Now().Add(ttl)
+	return nil
+}
+
+// ClearOverride clears the runtime overrides of s.
+func (s *Sampling) ClearOverride() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.overrides = nil
+}
+
+// match returns the first rule matching p, if any.
+func (s *Sampling) match(p sdktrace.SamplingParameters) (samplingRule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var layers [][]samplingRule
+	if s.clk.Now().Before(s.overridesExpire) {
+		layers = append(layers, s.overrides)
+	}
+	layers = append(layers, s.remote, s.rules)
+	for _, rules := range layers {
+		for _, r := range rules {
+			if r.matches(s.component, p) {
+				return r, true
+			}
+		}
+	}
+	return samplingRule{}, false
+}
+
+// sampler returns the sdktrace.Sampler backed by s.
+func (s *Sampling) sampler() sdktrace.Sampler {
+	return sdktrace.ParentBased(
+		rootSampler{s},
+		sdktrace.WithRemoteParentNotSampled(unsampledParentSampler{s}))
+}
+
+type rootSampler struct {
+	s *Sampling
+}
+
+func (r rootSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if rule, ok := r.s.match(p); ok {
+		return rule.sampler.ShouldSample(p)
+	}
+	return r.s.defaultSampler.ShouldSample(p)
+}
+
+func (r rootSampler) Description() string {
+	return "KrakenRootSampler"
+}
+
+type unsampledParentSampler struct {
+	s *Sampling
+}
+
+func (u unsampledParentSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if rule, ok := u.s.match(p); ok {
+		return rule.sampler.ShouldSample(p)
+	}
+	return sdktrace.NeverSample().ShouldSample(p)
+}
+
+func (u unsampledParentSampler) Description() string {
+	return "KrakenUnsampledParentSampler"
+}
+
+// SamplingState is the state of Sampling returned by the tracing handler.
+type SamplingState struct {
+	Component   string         `json:"component"`
+	SampleRatio float64        `json:"sample_ratio"`
+	Rules       []SamplingRule `json:"rules"`
+	Remote      []SamplingRule `json:"remote"`
+
+	// Overrides are the runtime overrides, which apply until OverridesExpire.
+	Overrides       []SamplingRule `json:"overrides,omitempty"`
+	OverridesExpire *time.Time     `json:"overrides_expire,omitempty"`
+}
+
+// State returns the current state of s.
+func (s *Sampling) State() SamplingState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	configs := func(rules []samplingRule) []SamplingRule {
+		result := make([]SamplingRule, 0, len(rules))
+		for _, r := range rules {
+			result = append(result, r.config)
+		}
+		return result
+	}
+	state := SamplingState{
+		Component:   s.component,
+		SampleRatio: s.ratio,
+		Rules:       configs(s.rules),
+		Remote:      configs(s.remote),
+	}
+	if len(s.overrides) > 0 && s.clk.Now().Before(s.overridesExpire) {
+		expire := s.overridesExpire
+		state.Overrides = configs(s.overrides)
+		state.OverridesExpire = &expire
+	}
+	return state
+}
+
+var (
+	_globalSamplingMu sync.RWMutex
+	_globalSampling   = &Sampling{
+		ratio:          1,
+		clk:            clock.New(),
+		defaultSampler: sdktrace.AlwaysSample(),
+	}
+)
+
+// GlobalSampling returns the Sampling installed by Init.
+func GlobalSampling() *Sampling {
+	_globalSamplingMu.RLock()
+	defer _globalSamplingMu.RUnlock()
+
+	return _globalSampling
+}
+
+func setGlobalSampling(s *Sampling) {
+	_globalSamplingMu.Lock()
+	defer _globalSamplingMu.Unlock()
+
+	_globalSampling = s
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func sampled(s *Sampling, name string, attrs ...attribute.KeyValue) bool {
+	return sampledWithParent(s, context.Background(), name, attrs...)
+}
+
+func sampledWithParent(
+	s *Sampling, ctx context.Context, name string, attrs ...attribute.KeyValue) bool {
+
+	result := s.sampler().ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: ctx,
+		TraceID:       trace.TraceID{1},
+		Name:          name,
+		Attributes:    attrs,
+	})
+	return result.Decision == sdktrace.RecordAndSample
+}
+
+func TestSamplingRules(t *testing.T) {
+	require := require.New(t)
+
+	s, err := newSampling(Config{
+		SampleRatio: 0.0000001,
+		Rules: []SamplingRule{
+			{Component: "kraken-agent", Ratio: 1},
+			{Namespace: "^debug/", Ratio: 1},
+			{Span: "^GET", Route: "^/namespace/.*/metainfo$", Ratio: 1},
+		},
+	}, "kraken-origin", clock.NewMock())
+	require.NoError(err)
+
+	require.False(sampled(s, "announce"))
+	require.True(sampled(s, "blobrefresh.refresh", NamespaceKey.String("debug/foo")))
+	require.False(sampled(s, "blobrefresh.refresh", NamespaceKey.String("prod/foo")))
+	require.True(sampled(s, "GET",
+		semconv.HTTPTargetKey.String("/namespace/foo/blobs/abc/metainfo")))
+	require.False(sampled(s, "GET", semconv.HTTPTargetKey.String("/namespace/foo/blobs/abc")))
+	require.False(sampled(s, "PUT",
+		semconv.HTTPTargetKey.String("/namespace/foo/blobs/abc/metainfo")))
+}
+
+func TestSamplingRulesRejectInvalidConfig(t *testing.T) {
+	for _, rule := range []SamplingRule{
+		{Namespace: "(", Ratio: 1},
+		{Span: "(", Ratio: 1},
+		{Route: "(", Ratio: 1},
+		{Ratio: 2},
+	} {
+		_, err := newSampling(Config{Rules: []SamplingRule{rule}}, "test", clock.NewMock())
+		require.Error(t, err)
+	}
+}
+
+func TestSamplingPrecedence(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+
+	s, err := newSampling(Config{
+		SampleRatio: 0.0000001,
+		Rules:       []SamplingRule{{Namespace: "foo", Ratio: 1}},
+	}, "test", clk)
+	require.NoError(err)
+
+	foo := NamespaceKey.String("foo")
+
+	require.True(sampled(s, "x", foo))
+
+	require.NoError(s.ApplyRemote([]byte(`{"rules": [{"namespace": "foo", "ratio": 0}]}`)))
+	require.False(sampled(s, "x", foo))
+
+	require.NoError(s.Override([]SamplingRule{{Namespace: "foo", Ratio: 1}}, time.Minute))
+	require.True(sampled(s, "x", foo))
+
+	// Overrides expire.
+	clk.Add(2 * time.Minute)
+	require.False(sampled(s, "x", foo))
+
+	require.NoError(s.Override([]SamplingRule{{Namespace: "foo", Ratio: 1}}, time.Minute))
+	require.True(sampled(s, "x", foo))
+	s.ClearOverride()
+	require.False(sampled(s, "x", foo))
+
+	require.NoError(s.ApplyRemote(nil))
+	require.True(sampled(s, "x", foo))
+}
+
+func TestSamplingUnsampledRemoteParent(t *testing.T) {
+	require := require.New(t)
+
+	s, err := newSampling(Config{
+		Rules: []SamplingRule{{Namespace: "foo", Ratio: 1}},
+	}, "test", clock.NewMock())
+	require.NoError(err)
+
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{1},
+			SpanID:  trace.SpanID{1},
+			Remote:  true,
+		}))
+
+	// Unsampled remote traces are only sampled if a rule matches, regardless
+	// of the default ratio.
+	require.True(sampledWithParent(s, ctx, "x", NamespaceKey.String("foo")))
+	require.False(sampledWithParent(s, ctx, "x", NamespaceKey.String("bar")))
+}
+
+func TestSamplingState(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+
+	rules := []SamplingRule{{Namespace: "foo", Ratio: 1}}
+
+	s, err := newSampling(Config{SampleRatio: 0.5, Rules: rules}, "test", clk)
+	require.NoError(err)
+
+	require.NoError(s.Override(rules, time.Minute))
+
+	expire := clk.Now().Add(time.Minute)
+	require.Equal(SamplingState{
+		Component:       "test",
+		SampleRatio:     0.5,
+		Rules:           rules,
+		Remote:          []SamplingRule{},
+		Overrides:       rules,
+		OverridesExpire: &expire,
+	}, s.State())
+}
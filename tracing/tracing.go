@@ -0,0 +1,125 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package tracing configures OpenTelemetry tracing for Kraken components.
+//
+// Spans are started via Tracer, and trace context is propagated between
+// components over HTTP by utils/httputil (inject) and lib/middleware
+// (extract). If tracing is disabled, all spans are no-ops.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const _instrumentationName = "github.com/uber/kraken"
+
+func init() {
+	register("stdout", newStdoutExporter)
+	register("otlp", newOTLPExporter)
+}
+
+var _exporterFactories = make(map[string]exporterFactory)
+
+type exporterFactory func(config Config) (sdktrace.SpanExporter, io.Closer, error)
+
+func register(name string, f exporterFactory) {
+	if _, ok := _exporterFactories[name]; ok {
+		log.Fatalf("Tracing exporter factory %q is already registered", name)
+	}
+	_exporterFactories[name] = f
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+type providerCloser struct {
+	provider *sdktrace.TracerProvider
+	exporter io.Closer
+}
+
+func (c providerCloser) Close() error {
+	if err := c.provider.Shutdown(context.Background()); err != nil {
+		return fmt.Errorf("shutdown tracer provider: %s", err)
+	}
+	return c.exporter.Close()
+}
+
+// Init installs a global tracer provider for service from config. If no
+// exporter is configured, tracing is disabled. The returned Closer flushes
+// any buffered spans.
+func Init(config Config, service string) (io.Closer, error) {
+	sampling, err := newSampling(config, service, clock.New())
+	if err != nil {
+		return nil, fmt.Errorf("sampling rules: %s", err)
+	}
+	setGlobalSampling(sampling)
+
+	if config.Exporter == "" || config.Exporter == "disabled" {
+		return nopCloser{}, nil
+	}
+	config = config.applyDefaults()
+
+	f, ok := _exporterFactories[config.Exporter]
+	if !ok {
+		return nil, fmt.Errorf("tracing exporter %q not registered", config.Exporter)
+	}
+	exporter, closer, err := f(config)
+	if err != nil {
+		return nil, fmt.Errorf("new %s exporter: %s", config.Exporter, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sampling.sampler()),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL, semconv.ServiceNameKey.String(service))))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return providerCloser{provider, closer}, nil
+}
+
+// Tracer returns the Kraken tracer from the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(_instrumentationName)
+}
+
+// Detach returns a context carrying the span of ctx, if any, but none of its
+// deadline or cancellation. Used to parent work which outlives a request.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
+
+// EndSpan records err on span, if non-nil, and ends span.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
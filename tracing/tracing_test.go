@@ -0,0 +1,93 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tracing
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitDisabled(t *testing.T) {
+	require := require.New(t)
+
+	closer, err := Init(Config{}, "test")
+	require.NoError(err)
+	require.NoError(closer.Close())
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	_, err := Init(Config{Exporter: "unknown"}, "test")
+	require.Error(t, err)
+}
+
+func TestInitStdoutExportsSpans(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "tracing")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans")
+
+	closer, err := Init(Config{
+		Exporter: "stdout",
+		Stdout:   StdoutConfig{Path: path},
+	}, "test")
+	require.NoError(err)
+
+	_, span := Tracer().Start(context.Background(), "test_span")
+	EndSpan(span, nil)
+
+	require.NoError(closer.Close())
+
+	b, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.Contains(string(b), "test_span")
+}
+
+func TestInitOTLPExportsSpans(t *testing.T) {
+	require := require.New(t)
+
+	requests := make(chan *http.Request, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+	}))
+	defer collector.Close()
+
+	closer, err := Init(Config{
+		Exporter: "otlp",
+		OTLP: OTLPConfig{
+			Endpoint: strings.TrimPrefix(collector.URL, "http://"),
+			Insecure: true,
+			Headers:  map[string]string{"X-Token": "secret"},
+		},
+	}, "test")
+	require.NoError(err)
+
+	_, span := Tracer().Start(context.Background(), "test_span")
+	EndSpan(span, nil)
+
+	require.NoError(closer.Close())
+
+	r := <-requests
+	require.Equal("/v1/traces", r.URL.Path)
+	require.Equal("secret", r.Header.Get("X-Token"))
+}
@@ -15,17 +15,23 @@ package announceclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"sync"
 	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/backend"
 	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrDisabled is returned when announce is disabled.
@@ -37,6 +43,38 @@ type Request struct {
 	Digest   *core.Digest   `json:"digest"` // Optional (for now).
 	InfoHash core.InfoHash  `json:"info_hash"`
 	Peer     *core.PeerInfo `json:"peer"`
+
+	// Namespace is the namespace of the announced blob. Trackers match it against
+	// per-namespace announce hooks. Empty if unknown.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Exclude lists peers which the announcing peer already knows about,
+	// e.g. because it is already connected to or has blacklisted them. The
+	// tracker omits these from the handout.
+	Exclude []core.PeerID `json:"exclude,omitempty"`
+
+	// Feedback reports how remote peers behaved towards the announcing peer
+	// since its previous announce of the torrent. Trackers aggregate feedback
+	// into per-peer stats which inform the peer handout policy.
+	Feedback []PeerFeedback `json:"feedback,omitempty"`
+
+	// DownloadTime is set on the announce which completes a torrent the
+	// announcing peer downloaded, and reports how long the download took.
+	// Trackers use it to compare the outcomes of peer handout policies.
+	DownloadTime time.Duration `json:"download_time,omitempty"`
+}
+
+// PeerFeedback describes what the announcing peer observed of a remote peer.
+type PeerFeedback struct {
+	PeerID core.PeerID `json:"peer_id"`
+
+	// BytesReceived is the number of verified piece bytes received from the
+	// remote peer.
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+
+	// Failed is set if a connection to the remote peer could not be
+	// established.
+	Failed bool `json:"failed,omitempty"`
 }
 
 // GetDigest is a backwards compatible accessor of the request digest.
@@ -53,29 +91,80 @@ func (r *Request) GetDigest() (core.Digest, error) {
 
 // Response defines an announce response.
 type Response struct {
-	Peers    []*core.PeerInfo `json:"peers"`
-	Interval time.Duration    `json:"interval"`
+	Peers []*core.PeerInfo `json:"peers"`
+
+	// Interval is the interval at which peers should announce.
+	Interval time.Duration `json:"interval"`
+
+	// TorrentInterval, if non-zero, is the suggested minimum time before the
+	// announced torrent announces again, based on the health of its swarm.
+	TorrentInterval time.Duration `json:"torrent_interval,omitempty"`
+}
+
+// AnnounceRequest defines the parameters of an announce sent by Client.
+type AnnounceRequest struct {
+	Namespace string
+	Digest    core.Digest
+	InfoHash  core.InfoHash
+	Complete  bool
+	Version   int
+
+	// Exclude, Feedback and DownloadTime are optional, and forwarded to the
+	// trackers as described in Request.
+	Exclude      []core.PeerID
+	Feedback     []PeerFeedback
+	DownloadTime time.Duration
 }
 
 // Client defines a client for announcing and getting peers.
 type Client interface {
 	CheckReadiness() error
-	Announce(
-		d core.Digest,
-		h core.InfoHash,
-		complete bool,
-		version int) ([]*core.PeerInfo, time.Duration, error)
+	Announce(r AnnounceRequest) (*Response, error)
+	Scrape(namespace string, ds []core.Digest) ([]*SwarmStats, error)
+}
+
+// Config defines Client configuration.
+type Config struct {
+	// Fanout is the number of trackers each announce is sent to. Trackers are
+	// selected in hash ring order for the blob, so every agent announcing a
+	// given blob reaches the same trackers, and responses are merged. This
+	// allows trackers to run with local, shared-nothing peer stores. Fanout
+	// is bounded by the max replica setting of the tracker hash ring.
+	Fanout int `yaml:"fanout"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Fanout == 0 {
+		c.Fanout = 1
+	}
+	return c
 }
 
 type client struct {
-	pctx core.PeerContext
-	ring hashring.PassiveRing
-	tls  *tls.Config
+	config Config
+	pctx   core.PeerContext
+	ring   hashring.PassiveRing
+	tls    *tls.Config
+}
+
+// Option defines an optional New parameter.
+type Option func(*client)
+
+// WithConfig configures the client with config.
+func WithConfig(config Config) Option {
+	return func(c *client) { c.config = config }
 }
 
 // New creates a new client.
-func New(pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config) Client {
-	return &client{pctx, ring, tls}
+func New(
+	pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config, opts ...Option) Client {
+
+	c := &client{pctx: pctx, ring: ring, tls: tls}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.config = c.config.applyDefaults()
+	return c
 }
 
 // Announce versionss.
@@ -103,48 +192,145 @@ func (c *client) CheckReadiness() error {
 	return nil
 }
 
-// Announce announces the torrent identified by (d, h) with the number of
-// downloaded bytes. Returns a list of all other peers announcing for said torrent,
-// sorted by priority, and the interval for the next announce.
-func (c *client) Announce(
-	d core.Digest,
-	h core.InfoHash,
-	complete bool,
-	version int) (peers []*core.PeerInfo, interval time.Duration, err error) {
+// Announce announces the torrent identified by (r.Digest, r.InfoHash). Returns
+// a list of all other peers announcing for said torrent, excluding peers in
+// r.Exclude, sorted by priority, and the intervals for the next announce.
+func (c *client) Announce(r AnnounceRequest) (result *Response, err error) {
+	d, h := r.Digest, r.InfoHash
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "announce", trace.WithAttributes(
+		tracing.NamespaceKey.String(r.Namespace),
+		attribute.String("digest", d.String()),
+		attribute.String("info_hash", h.String()),
+		attribute.Bool("complete", r.Complete)))
+	defer func() { tracing.EndSpan(span, err) }()
 
 	body, err := json.Marshal(&Request{
 		Name:     d.Hex(), // For backwards compatability. TODO(codyg): Remove.
 		Digest:   &d,
 		InfoHash: h,
-		Peer:     core.PeerInfoFromContext(c.pctx, complete),
+		Peer:     core.PeerInfoFromContext(c.pctx, r.Complete),
+		Exclude:  r.Exclude,
+		Feedback: r.Feedback,
+
+		Namespace:    r.Namespace,
+		DownloadTime: r.DownloadTime,
 	})
 	if err != nil {
-		return nil, 0, fmt.Errorf("marshal request: %s", err)
+		return nil, fmt.Errorf("marshal request: %s", err)
+	}
+	locs := c.ring.Locations(d)
+	n := c.config.Fanout
+	if n > len(locs) {
+		n = len(locs)
 	}
-	var httpResp *http.Response
-	for _, addr := range c.ring.Locations(d) {
-		method, url := getEndpoint(version, addr, h)
-		httpResp, err = httputil.Send(
-			method,
-			url,
-			httputil.SendBody(bytes.NewReader(body)),
-			httputil.SendTimeout(10*time.Second),
-			httputil.SendTLS(c.tls))
-		if err != nil {
-			if httputil.IsNetworkError(err) {
-				c.ring.Failed(addr)
-				continue
+	// Trackers which fail are replaced by the next spare tracker in ring order.
+	spares := make(chan string, len(locs)-n)
+	for _, addr := range locs[n:] {
+		spares <- addr
+	}
+	close(spares)
+
+	resps := make([]*Response, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resps[i], errs[i] = c.announceTo(ctx, r.Version, locs[i], spares, h, body)
+		}(i)
+	}
+	wg.Wait()
+
+	// Responses are merged in ring order, such that peers keep the priority
+	// of the first trackers.
+	result = &Response{}
+	var successes int
+	seen := make(map[core.PeerID]bool)
+	for i, resp := range resps {
+		if errs[i] != nil {
+			err = errs[i]
+			continue
+		}
+		successes++
+		for _, p := range resp.Peers {
+			if !seen[p.PeerID] {
+				seen[p.PeerID] = true
+				result.Peers = append(result.Peers, p)
 			}
-			return nil, 0, err
 		}
-		defer httpResp.Body.Close()
-		var resp Response
-		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
-			return nil, 0, fmt.Errorf("decode response: %s", err)
+		if resp.Interval > result.Interval {
+			result.Interval = resp.Interval
 		}
-		return resp.Peers, resp.Interval, nil
+		// Each tracker may only see part of the swarm, so follow the tracker
+		// which wants to hear back soonest.
+		if resp.TorrentInterval > 0 &&
+			(result.TorrentInterval == 0 || resp.TorrentInterval < result.TorrentInterval) {
+			result.TorrentInterval = resp.TorrentInterval
+		}
+	}
+	if successes == 0 {
+		return nil, err
 	}
-	return nil, 0, err
+	return result, nil
+}
+
+// announceTo sends an announce to addr, failing over to the next tracker in
+// spares until one responds. Non-network errors are only failed over if
+// announces fan out, since a single tracker is expected to handle them.
+func (c *client) announceTo(
+	ctx context.Context,
+	version int,
+	addr string,
+	spares <-chan string,
+	h core.InfoHash,
+	body []byte) (*Response, error) {
+
+	for {
+		resp, err := c.send(ctx, version, addr, h, body)
+		if err == nil {
+			return resp, nil
+		}
+		if httputil.IsNetworkError(err) {
+			c.ring.Failed(addr)
+		} else if c.config.Fanout == 1 {
+			return nil, err
+		} else {
+			log.With("tracker", addr, "hash", h).Errorf("Error announcing: %s", err)
+		}
+		next, ok := <-spares
+		if !ok {
+			return nil, err
+		}
+		addr = next
+	}
+}
+
+func (c *client) send(
+	ctx context.Context,
+	version int,
+	addr string,
+	h core.InfoHash,
+	body []byte) (*Response, error) {
+
+	method, url := getEndpoint(version, addr, h)
+	httpResp, err := httputil.Send(
+		method,
+		url,
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls),
+		httputil.SendContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response: %s", err)
+	}
+	return &resp, nil
 }
 
 // DisabledClient rejects all announces. Suitable for origin peers which should
@@ -161,8 +347,11 @@ func (c DisabledClient) CheckReadiness() error {
 }
 
 // Announce always returns error.
-func (c DisabledClient) Announce(
-	d core.Digest, h core.InfoHash, complete bool, version int) ([]*core.PeerInfo, time.Duration, error) {
+func (c DisabledClient) Announce(r AnnounceRequest) (*Response, error) {
+	return nil, ErrDisabled
+}
 
-	return nil, 0, ErrDisabled
+// Scrape always returns error.
+func (c DisabledClient) Scrape(namespace string, ds []core.Digest) ([]*SwarmStats, error) {
+	return nil, ErrDisabled
 }
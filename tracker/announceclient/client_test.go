@@ -0,0 +1,257 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+)
+
+const _testNamespace = "test-namespace"
+
+func startTracker(resp Response) (addr string, stop func()) {
+	r := chi.NewRouter()
+	r.Post("/announce/{infohash}", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(&resp)
+	})
+	return testutil.StartServer(r)
+}
+
+func TestAnnounceFanoutMergesPeers(t *testing.T) {
+	require := require.New(t)
+
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	p3 := core.PeerInfoFixture()
+
+	addr1, stop := startTracker(Response{Peers: []*core.PeerInfo{p1, p2}, Interval: time.Second})
+	defer stop()
+	addr2, stop := startTracker(Response{Peers: []*core.PeerInfo{p2, p3}, Interval: 2 * time.Second})
+	defer stop()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr1, addr2))
+	client := New(core.PeerContextFixture(), ring, nil, WithConfig(Config{Fanout: 2}))
+
+	blob := core.NewBlobFixture()
+	resp, err := client.Announce(AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   V2,
+	})
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2, p3}, resp.Peers)
+	require.Equal(2*time.Second, resp.Interval)
+}
+
+func TestAnnounceDefaultFanoutUsesSingleTracker(t *testing.T) {
+	require := require.New(t)
+
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	addr1, stop := startTracker(Response{Peers: []*core.PeerInfo{p1}})
+	defer stop()
+	addr2, stop := startTracker(Response{Peers: []*core.PeerInfo{p2}})
+	defer stop()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr1, addr2))
+	client := New(core.PeerContextFixture(), ring, nil)
+
+	blob := core.NewBlobFixture()
+	resp, err := client.Announce(AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   V2,
+	})
+	require.NoError(err)
+	require.Len(resp.Peers, 1)
+}
+
+func TestAnnounceFanoutSkipsUnavailableTracker(t *testing.T) {
+	require := require.New(t)
+
+	p1 := core.PeerInfoFixture()
+
+	addr1, stop := startTracker(Response{Peers: []*core.PeerInfo{p1}})
+	defer stop()
+	addr2, stop := startTracker(Response{})
+	stop()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr1, addr2))
+	client := New(core.PeerContextFixture(), ring, nil, WithConfig(Config{Fanout: 2}))
+
+	blob := core.NewBlobFixture()
+	resp, err := client.Announce(AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   V2,
+	})
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p1}, resp.Peers)
+}
+
+func TestAnnounceFanoutSendsConcurrently(t *testing.T) {
+	require := require.New(t)
+
+	// Each tracker only responds once both trackers received the announce.
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+	start := func(p *core.PeerInfo) (string, func()) {
+		r := chi.NewRouter()
+		r.Post("/announce/{infohash}", func(w http.ResponseWriter, req *http.Request) {
+			arrived.Done()
+			done := make(chan struct{})
+			go func() {
+				arrived.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			json.NewEncoder(w).Encode(&Response{Peers: []*core.PeerInfo{p}})
+		})
+		return testutil.StartServer(r)
+	}
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	addr1, stop := start(p1)
+	defer stop()
+	addr2, stop := start(p2)
+	defer stop()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr1, addr2))
+	client := New(core.PeerContextFixture(), ring, nil, WithConfig(Config{Fanout: 2}))
+
+	blob := core.NewBlobFixture()
+	resp, err := client.Announce(AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   V2,
+	})
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, resp.Peers)
+}
+
+func TestAnnounceFanoutReplacesUnavailableTrackerWithSpare(t *testing.T) {
+	require := require.New(t)
+
+	peers := make(map[string]*core.PeerInfo)
+	stops := make(map[string]func())
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		p := core.PeerInfoFixture()
+		addr, stop := startTracker(Response{Peers: []*core.PeerInfo{p}})
+		defer stop()
+		peers[addr] = p
+		stops[addr] = stop
+		addrs = append(addrs, addr)
+	}
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addrs...))
+	client := New(core.PeerContextFixture(), ring, nil, WithConfig(Config{Fanout: 2}))
+
+	blob := core.NewBlobFixture()
+	locs := ring.Locations(blob.Digest)
+	stops[locs[0]]()
+
+	resp, err := client.Announce(AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   V2,
+	})
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{peers[locs[1]], peers[locs[2]]}, resp.Peers)
+}
+
+func startScrapeTracker(resp ScrapeResponse) (addr string, stop func()) {
+	r := chi.NewRouter()
+	r.Get("/scrape", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(&resp)
+	})
+	return testutil.StartServer(r)
+}
+
+func TestScrapeFanoutKeepsLargestCounts(t *testing.T) {
+	require := require.New(t)
+
+	d := core.DigestFixture()
+
+	addr1, stop := startScrapeTracker(ScrapeResponse{Swarms: []*SwarmStats{
+		{Digest: d, Seeders: 4, Leechers: 1},
+	}})
+	defer stop()
+	addr2, stop := startScrapeTracker(ScrapeResponse{Swarms: []*SwarmStats{
+		{Digest: d, Seeders: 2, Leechers: 3},
+	}})
+	defer stop()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr1, addr2))
+	client := New(core.PeerContextFixture(), ring, nil, WithConfig(Config{Fanout: 2}))
+
+	result, err := client.Scrape("namespace", []core.Digest{d})
+	require.NoError(err)
+	require.Equal([]*SwarmStats{{Digest: d, Seeders: 4, Leechers: 3}}, result)
+}
+
+func TestScrapeErrorsWhenNoTrackerResponds(t *testing.T) {
+	ring := hashring.NoopPassiveRing(hostlist.Fixture("localhost:0"))
+	client := New(core.PeerContextFixture(), ring, nil)
+
+	_, err := client.Scrape("namespace", []core.Digest{core.DigestFixture()})
+	require.Error(t, err)
+}
+
+func TestAnnounceFanoutKeepsShortestTorrentInterval(t *testing.T) {
+	require := require.New(t)
+
+	addr1, stop := startTracker(Response{TorrentInterval: 10 * time.Second})
+	defer stop()
+	addr2, stop := startTracker(Response{TorrentInterval: 5 * time.Second})
+	defer stop()
+	addr3, stop := startTracker(Response{})
+	defer stop()
+
+	ring := hashring.NoopPassiveRing(hostlist.Fixture(addr1, addr2, addr3))
+	client := New(core.PeerContextFixture(), ring, nil, WithConfig(Config{Fanout: 3}))
+
+	blob := core.NewBlobFixture()
+	resp, err := client.Announce(AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   V2,
+	})
+	require.NoError(err)
+	require.Equal(5*time.Second, resp.TorrentInterval)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/errutil"
+	"github.com/uber/kraken/utils/httputil"
+)
+
+// MaxScrapeDigests is the default limit on the number of digests trackers
+// accept in a single scrape request.
+const MaxScrapeDigests = 100
+
+// SwarmStats describes the swarm of a blob.
+type SwarmStats struct {
+	Digest   core.Digest `json:"digest"`
+	InfoHash string      `json:"info_hash,omitempty"`
+	Seeders  int         `json:"seeders"`
+	Leechers int         `json:"leechers"`
+
+	// Error is set if the tracker could not resolve the swarm of the blob.
+	Error string `json:"error,omitempty"`
+}
+
+// ScrapeResponse defines a scrape response.
+type ScrapeResponse struct {
+	Swarms []*SwarmStats `json:"swarms"`
+}
+
+// Scrape returns the number of seeders and leechers of each of ds, in order.
+// Each digest is scraped from the same trackers it is announced to. When
+// announces fan out to multiple trackers, the largest counts are kept, since
+// each tracker sees a subset of the same swarm.
+func (c *client) Scrape(namespace string, ds []core.Digest) ([]*SwarmStats, error) {
+	batches := make(map[string][]core.Digest)
+	for _, d := range ds {
+		addrs := c.ring.Locations(d)
+		if len(addrs) > c.config.Fanout {
+			addrs = addrs[:c.config.Fanout]
+		}
+		for _, addr := range addrs {
+			batches[addr] = append(batches[addr], d)
+		}
+	}
+	merged := make(map[core.Digest]*SwarmStats)
+	var errs []error
+	for addr, batch := range batches {
+		for len(batch) > 0 {
+			n := len(batch)
+			if n > MaxScrapeDigests {
+				n = MaxScrapeDigests
+			}
+			swarms, err := c.scrape(addr, namespace, batch[:n])
+			batch = batch[n:]
+			if err != nil {
+				if httputil.IsNetworkError(err) {
+					c.ring.Failed(addr)
+				}
+				errs = append(errs, fmt.Errorf("tracker %s: %s", addr, err))
+				continue
+			}
+			for _, s := range swarms {
+				mergeSwarmStats(merged, s)
+			}
+		}
+	}
+	result := make([]*SwarmStats, len(ds))
+	for i, d := range ds {
+		s, ok := merged[d]
+		if !ok {
+			return nil, fmt.Errorf("scrape %s: %s", d, errutil.Join(errs))
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// mergeSwarmStats merges s into the stats of the same digest in merged.
+// Successful results take precedence over errors.
+func mergeSwarmStats(merged map[core.Digest]*SwarmStats, s *SwarmStats) {
+	cur, ok := merged[s.Digest]
+	if !ok || (cur.Error != "" && s.Error == "") {
+		merged[s.Digest] = s
+		return
+	}
+	if s.Error != "" {
+		return
+	}
+	if s.Seeders > cur.Seeders {
+		cur.Seeders = s.Seeders
+	}
+	if s.Leechers > cur.Leechers {
+		cur.Leechers = s.Leechers
+	}
+}
+
+func (c *client) scrape(addr, namespace string, ds []core.Digest) ([]*SwarmStats, error) {
+	query := url.Values{"namespace": {namespace}}
+	for _, d := range ds {
+		query.Add("digest", d.String())
+	}
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/scrape?%s", addr, query.Encode()),
+		httputil.SendTimeout(10*time.Second),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var sr ScrapeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, fmt.Errorf("decode response: %s", err)
+	}
+	return sr.Swarms, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcehook
+
+import "time"
+
+// Config defines announce hook configuration.
+type Config struct {
+	Rules []RuleConfig `yaml:"rules"`
+
+	// Timeout bounds each invocation of a hook.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// QueueSize is the number of announces buffered before new announces
+	// skip their hooks.
+	QueueSize int `yaml:"queue_size"`
+
+	// Workers is the number of goroutines invoking hooks.
+	Workers int `yaml:"workers"`
+
+	// QuarantineTTL is how long a peer stays quarantined after a hook last
+	// vetoed it. Quarantined peers keep announcing, so peers which are still
+	// vetoed stay quarantined.
+	QuarantineTTL time.Duration `yaml:"quarantine_ttl"`
+}
+
+// RuleConfig enables hooks for namespaces matching a regexp. Only the first
+// rule matching the namespace of an announce applies.
+type RuleConfig struct {
+	Namespace string `yaml:"namespace"`
+
+	// Hooks are the names of hooks added with Register.
+	Hooks []string `yaml:"hooks"`
+
+	// Webhooks are URLs which announce events are posted to.
+	Webhooks []string `yaml:"webhooks"`
+
+	// Policies are URLs of policy engines, e.g. the OPA data API, which
+	// decide whether announcing peers are quarantined.
+	Policies []string `yaml:"policies"`
+}
+
+func (c Config) applyDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = time.Second
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = 1000
+	}
+	if c.Workers == 0 {
+		c.Workers = 4
+	}
+	if c.QuarantineTTL == 0 {
+		c.QuarantineTTL = 5 * time.Minute
+	}
+	return c
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcehook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/uber-go/tally"
+)
+
+// Event describes an announce received by a tracker.
+type Event struct {
+	Namespace string         `json:"namespace"`
+	Digest    core.Digest    `json:"digest"`
+	InfoHash  core.InfoHash  `json:"info_hash"`
+	Peer      *core.PeerInfo `json:"peer"`
+	Time      time.Time      `json:"time"`
+}
+
+// Verdict is the decision of a hook on an announcing peer.
+type Verdict int
+
+// Verdicts.
+const (
+	// Allow leaves the announcing peer in its swarms.
+	Allow Verdict = iota
+
+	// Quarantine removes the announcing peer from all swarms: it is left out
+	// of peer handouts, and receives no handouts itself.
+	Quarantine
+)
+
+// Hook handles announce events. Hooks which only forward events to external
+// systems always return Allow. Hooks must return once ctx is done.
+type Hook interface {
+	Handle(ctx context.Context, e Event) (Verdict, error)
+}
+
+var _hooks = make(map[string]Hook)
+
+// Register registers a Hook under name. Hooks registered in init functions
+// may be referenced from Config.
+func Register(name string, h Hook) {
+	_hooks[name] = h
+}
+
+func getHook(name string) (Hook, error) {
+	h, ok := _hooks[name]
+	if !ok {
+		return nil, fmt.Errorf("no announce hook defined with name %s", name)
+	}
+	return h, nil
+}
+
+// Hooks invokes hooks on announce events and tracks the peers they
+// quarantine.
+type Hooks interface {
+	// Notify enqueues e for the hooks matching its namespace. Hooks are
+	// invoked asynchronously, such that a slow hook never delays announces.
+	Notify(e Event)
+
+	// Quarantined returns true if a hook has recently quarantined peer.
+	Quarantined(peer core.PeerID) bool
+}
+
+type namedHook struct {
+	name string
+	hook Hook
+}
+
+type rule struct {
+	regexp *regexp.Regexp
+	hooks  []namedHook
+}
+
+type hooks struct {
+	config Config
+	stats  tally.Scope
+	clk    clock.Clock
+	rules  []rule
+	events chan Event
+
+	mu          sync.Mutex
+	quarantined map[core.PeerID]time.Time // Expiry of quarantined peers.
+}
+
+// New creates a new Hooks which invokes the hooks configured in config.
+// Announces are skipped if the queue is full.
+func New(config Config, stats tally.Scope, clk clock.Clock) (Hooks, error) {
+	config = config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "announcehook",
+	})
+
+	var rules []rule
+	for _, rc := range config.Rules {
+		re, err := regexp.Compile(rc.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("regexp %s: %s", rc.Namespace, err)
+		}
+		var hs []namedHook
+		for _, name := range rc.Hooks {
+			h, err := getHook(name)
+			if err != nil {
+				return nil, err
+			}
+			hs = append(hs, namedHook{name, h})
+		}
+		for _, url := range rc.Webhooks {
+			if url == "" {
+				return nil, errors.New("webhook url required")
+			}
+			hs = append(hs, namedHook{"webhook", newWebhookHook(url)})
+		}
+		for _, url := range rc.Policies {
+			if url == "" {
+				return nil, errors.New("policy url required")
+			}
+			hs = append(hs, namedHook{"policy", newPolicyHook(url)})
+		}
+		rules = append(rules, rule{re, hs})
+	}
+	if len(rules) == 0 {
+		return NoopHooks{}, nil
+	}
+	h := newHooks(config, stats, clk, rules)
+	for i := 0; i < config.Workers; i++ {
+		go h.loop()
+	}
+	return h, nil
+}
+
+func newHooks(config Config, stats tally.Scope, clk clock.Clock, rules []rule) *hooks {
+	return &hooks{
+		config:      config,
+		stats:       stats,
+		clk:         clk,
+		rules:       rules,
+		events:      make(chan Event, config.QueueSize),
+		quarantined: make(map[core.PeerID]time.Time),
+	}
+}
+
+func (h *hooks) Notify(e Event) {
+	select {
+	case h.events <- e:
+	default:
+		h.stats.Counter("dropped").Inc(1)
+	}
+}
+
+func (h *hooks) Quarantined(peer core.PeerID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	expiry, ok := h.quarantined[peer]
+	if !ok {
+		return false
+	}
+	if !h.clk.Now().Before(expiry) {
+		delete(h.quarantined, peer)
+		return false
+	}
+	return true
+}
+
+func (h *hooks) quarantine(peer core.PeerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.quarantined[peer] = h.clk.Now().Add(h.config.QuarantineTTL)
+}
+
+// match returns the hooks of the first rule matching namespace.
+func (h *hooks) match(namespace string) []namedHook {
+	for _, r := range h.rules {
+		if r.regexp.MatchString(namespace) {
+			return r.hooks
+		}
+	}
+	return nil
+}
+
+func (h *hooks) loop() {
+	for e := range h.events {
+		h.handle(e)
+	}
+}
+
+// handle invokes the hooks matching e. Hooks which fail or time out allow
+// the announcing peer, such that an unavailable policy engine does not
+// disrupt distribution.
+func (h *hooks) handle(e Event) {
+	for _, nh := range h.match(e.Namespace) {
+		stats := h.stats.Tagged(map[string]string{"hook": nh.name})
+		ctx, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+		v, err := nh.hook.Handle(ctx, e)
+		cancel()
+		if err != nil {
+			stats.Counter("errors").Inc(1)
+			log.With("hook", nh.name, "peer_id", e.Peer.PeerID).Errorf(
+				"Error invoking announce hook: %s", err)
+			continue
+		}
+		if v == Quarantine {
+			stats.Counter("quarantined").Inc(1)
+			h.quarantine(e.Peer.PeerID)
+		}
+	}
+}
+
+// NoopHooks invokes no hooks and quarantines no peers.
+type NoopHooks struct{}
+
+// Notify is a no-op.
+func (NoopHooks) Notify(Event) {}
+
+// Quarantined always returns false.
+func (NoopHooks) Quarantined(core.PeerID) bool { return false }
@@ -0,0 +1,163 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcehook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+type verdictHook struct {
+	verdict Verdict
+	err     error
+}
+
+func (h verdictHook) Handle(ctx context.Context, e Event) (Verdict, error) {
+	return h.verdict, h.err
+}
+
+// slowHook blocks until its context is done.
+type slowHook struct{}
+
+func (slowHook) Handle(ctx context.Context, e Event) (Verdict, error) {
+	<-ctx.Done()
+	return Quarantine, ctx.Err()
+}
+
+func init() {
+	Register("allow", verdictHook{verdict: Allow})
+	Register("quarantine", verdictHook{verdict: Quarantine})
+	Register("error", verdictHook{verdict: Quarantine, err: errors.New("some error")})
+	Register("slow", slowHook{})
+}
+
+func eventFixture(namespace string) Event {
+	return Event{
+		Namespace: namespace,
+		Digest:    core.DigestFixture(),
+		InfoHash:  core.InfoHashFixture(),
+		Peer:      core.PeerInfoFixture(),
+		Time:      time.Now(),
+	}
+}
+
+func newTestHooks(t *testing.T, config Config, clk clock.Clock) *hooks {
+	h, err := New(config, tally.NoopScope, clk)
+	require.NoError(t, err)
+	return h.(*hooks)
+}
+
+func TestNewWithoutRulesReturnsNoop(t *testing.T) {
+	h, err := New(Config{}, tally.NoopScope, clock.New())
+	require.NoError(t, err)
+	require.Equal(t, NoopHooks{}, h)
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	for _, config := range []Config{
+		{Rules: []RuleConfig{{Namespace: "("}}},
+		{Rules: []RuleConfig{{Namespace: ".*", Hooks: []string{"unknown"}}}},
+		{Rules: []RuleConfig{{Namespace: ".*", Webhooks: []string{""}}}},
+		{Rules: []RuleConfig{{Namespace: ".*", Policies: []string{""}}}},
+	} {
+		_, err := New(config, tally.NoopScope, clock.New())
+		require.Error(t, err)
+	}
+}
+
+func TestHandleQuarantinesVetoedPeers(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	h := newTestHooks(t, Config{
+		Rules:         []RuleConfig{{Namespace: "secure/.*", Hooks: []string{"allow", "quarantine"}}},
+		QuarantineTTL: time.Minute,
+	}, clk)
+
+	e := eventFixture("secure/repo")
+	h.handle(e)
+	require.True(h.Quarantined(e.Peer.PeerID))
+
+	clk.Add(time.Minute)
+	require.False(h.Quarantined(e.Peer.PeerID))
+}
+
+func TestHandleAppliesFirstMatchingRule(t *testing.T) {
+	require := require.New(t)
+
+	h := newTestHooks(t, Config{
+		Rules: []RuleConfig{
+			{Namespace: "public/.*", Hooks: []string{"allow"}},
+			{Namespace: ".*", Hooks: []string{"quarantine"}},
+		},
+	}, clock.New())
+
+	e1 := eventFixture("public/repo")
+	h.handle(e1)
+	require.False(h.Quarantined(e1.Peer.PeerID))
+
+	e2 := eventFixture("secure/repo")
+	h.handle(e2)
+	require.True(h.Quarantined(e2.Peer.PeerID))
+}
+
+func TestHandleFailedHooksAllowPeers(t *testing.T) {
+	require := require.New(t)
+
+	h := newTestHooks(t, Config{
+		Rules:   []RuleConfig{{Namespace: ".*", Hooks: []string{"error", "slow"}}},
+		Timeout: 10 * time.Millisecond,
+	}, clock.New())
+
+	e := eventFixture("secure/repo")
+	h.handle(e)
+	require.False(h.Quarantined(e.Peer.PeerID))
+}
+
+func TestNotifyInvokesHooksAsynchronously(t *testing.T) {
+	require := require.New(t)
+
+	h := newTestHooks(t, Config{
+		Rules: []RuleConfig{{Namespace: ".*", Hooks: []string{"quarantine"}}},
+	}, clock.New())
+
+	e := eventFixture("secure/repo")
+	h.Notify(e)
+	require.NoError(testutil.PollUntilTrue(5*time.Second, func() bool {
+		return h.Quarantined(e.Peer.PeerID)
+	}))
+}
+
+func TestNotifyDropsEventsWhenQueueFull(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	h := newHooks(Config{QueueSize: 1}, stats, clock.New(), nil)
+
+	e := eventFixture("secure/repo")
+	h.Notify(e)
+	h.Notify(e)
+
+	require.Len(h.events, 1)
+	require.Equal(int64(1), stats.Snapshot().Counters()["dropped+"].Value())
+}
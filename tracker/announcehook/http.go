@@ -0,0 +1,97 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcehook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/uber/kraken/utils/httputil"
+)
+
+func post(ctx context.Context, url string, body interface{}) ([]byte, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("json: %s", err)
+	}
+	resp, err := httputil.Post(
+		url,
+		httputil.SendBody(bytes.NewReader(b)),
+		httputil.SendHeader("Content-Type", "application/json"),
+		httputil.SendContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, fmt.Errorf("read body: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// webhookHook forwards announce events to an external system.
+type webhookHook struct {
+	url string
+}
+
+func newWebhookHook(url string) *webhookHook {
+	return &webhookHook{url}
+}
+
+func (h *webhookHook) Handle(ctx context.Context, e Event) (Verdict, error) {
+	_, err := post(ctx, h.url, e)
+	return Allow, err
+}
+
+type policyInput struct {
+	Input Event `json:"input"`
+}
+
+type policyDecision struct {
+	Quarantine bool `json:"quarantine"`
+}
+
+type policyResult struct {
+	// Result is nil if the policy is undefined for the input.
+	Result *policyDecision `json:"result"`
+}
+
+// policyHook asks a policy engine whether announcing peers are quarantined.
+// Requests and responses follow the OPA data API: the event is posted as
+// {"input": <event>}, and the policy replies {"result": {"quarantine": bool}}.
+type policyHook struct {
+	url string
+}
+
+func newPolicyHook(url string) *policyHook {
+	return &policyHook{url}
+}
+
+func (h *policyHook) Handle(ctx context.Context, e Event) (Verdict, error) {
+	b, err := post(ctx, h.url, policyInput{e})
+	if err != nil {
+		return Allow, err
+	}
+	var result policyResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		return Allow, fmt.Errorf("decode policy result: %s", err)
+	}
+	if result.Result != nil && result.Result.Quarantine {
+		return Quarantine, nil
+	}
+	return Allow, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announcehook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// startPolicyServer starts a server which records request bodies and replies
+// with resp.
+func startPolicyServer(resp string) (*httptest.Server, chan []byte) {
+	bodies := make(chan []byte, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- b
+		w.Write([]byte(resp))
+	}))
+	return s, bodies
+}
+
+func TestWebhookHookForwardsEvents(t *testing.T) {
+	require := require.New(t)
+
+	s, bodies := startPolicyServer("")
+	defer s.Close()
+
+	e := eventFixture("secure/repo")
+	v, err := newWebhookHook(s.URL).Handle(context.Background(), e)
+	require.NoError(err)
+	require.Equal(Allow, v)
+
+	var result Event
+	require.NoError(json.Unmarshal(<-bodies, &result))
+	require.Equal(e.Namespace, result.Namespace)
+	require.Equal(e.Digest, result.Digest)
+	require.Equal(e.Peer.PeerID, result.Peer.PeerID)
+}
+
+func TestPolicyHookVerdicts(t *testing.T) {
+	tests := []struct {
+		desc     string
+		resp     string
+		expected Verdict
+	}{
+		{"quarantine", `{"result": {"quarantine": true}}`, Quarantine},
+		{"allow", `{"result": {"quarantine": false}}`, Allow},
+		{"undefined policy", `{}`, Allow},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			s, bodies := startPolicyServer(test.resp)
+			defer s.Close()
+
+			e := eventFixture("secure/repo")
+			v, err := newPolicyHook(s.URL).Handle(context.Background(), e)
+			require.NoError(err)
+			require.Equal(test.expected, v)
+
+			var input policyInput
+			require.NoError(json.Unmarshal(<-bodies, &input))
+			require.Equal(e.Peer.PeerID, input.Input.Peer.PeerID)
+		})
+	}
+}
+
+func TestPolicyHookInvalidResult(t *testing.T) {
+	s, _ := startPolicyServer("not json")
+	defer s.Close()
+
+	_, err := newPolicyHook(s.URL).Handle(context.Background(), eventFixture("secure/repo"))
+	require.Error(t, err)
+}
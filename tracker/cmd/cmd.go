@@ -14,13 +14,20 @@
 package cmd
 
 import (
+	"encoding/json"
 	"flag"
+	"io"
+	"syscall"
 
-	"github.com/uber/kraken/lib/healthcheck"
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/lib/remoteconfig"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/tracker/announcehook"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -35,10 +42,12 @@ import (
 
 // Flags define tracker CLI flags.
 type Flags struct {
-	Port          int
-	ConfigFile    string
-	KrakenCluster string
-	SecretsFile   string
+	Port              int
+	ConfigFile        string
+	Zone              string
+	KrakenCluster     string
+	SecretsFile       string
+	ConfigOverlayFile string
 }
 
 // ParseFlags parses tracker CLI flags.
@@ -48,10 +57,15 @@ func ParseFlags() *Flags {
 		&flags.Port, "port", 0, "port to listen on")
 	flag.StringVar(
 		&flags.ConfigFile, "config", "", "configuration file path")
+	flag.StringVar(
+		&flags.Zone, "zone", "", "zone/datacenter name")
 	flag.StringVar(
 		&flags.KrakenCluster, "cluster", "", "cluster name (e.g. prod01-zone1)")
 	flag.StringVar(
 		&flags.SecretsFile, "secrets", "", "path to a secrets YAML file to load into configuration")
+	flag.StringVar(
+		&flags.ConfigOverlayFile, "config-overlay", "",
+		"optional path to a YAML file, e.g. with per-cluster settings, to merge on top of configuration")
 	flag.Parse()
 	return &flags
 }
@@ -92,11 +106,16 @@ func Run(flags *Flags, opts ...Option) {
 	if overrides.config != nil {
 		config = *overrides.config
 	} else {
-		if err := configutil.Load(flags.ConfigFile, &config); err != nil {
+		if err := configutil.Load(
+			flags.ConfigFile, &config,
+			configutil.WithOverlay(flags.ConfigOverlayFile),
+			configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 			panic(err)
 		}
 		if flags.SecretsFile != "" {
-			if err := configutil.Load(flags.SecretsFile, &config); err != nil {
+			if err := configutil.Load(
+				flags.SecretsFile, &config,
+				configutil.WithEnvOverrides(configutil.EnvPrefix)); err != nil {
 				panic(err)
 			}
 		}
@@ -110,17 +129,34 @@ func Run(flags *Flags, opts ...Option) {
 	}
 
 	stats := overrides.metrics
+	var closer io.Closer
 	if stats == nil {
-		s, closer, err := metrics.New(config.Metrics, flags.KrakenCluster)
+		var err error
+		stats, closer, err = metrics.New(config.Metrics, flags.KrakenCluster)
 		if err != nil {
 			log.Fatalf("Failed to init metrics: %s", err)
 		}
-		stats = s
-		defer closer.Close()
 	}
+	flusher := metrics.NewFlusher(stats, closer)
+	defer flusher.Flush(metrics.ShutdownExit)
+	flusher.FlushOnSignals(syscall.SIGTERM, syscall.SIGINT)
 
 	go metrics.EmitVersion(stats)
 
+	tracingCloser, err := tracing.Init(config.Tracing, "kraken-tracker")
+	if err != nil {
+		log.Fatalf("Failed to init tracing: %s", err)
+	}
+	defer tracingCloser.Close()
+
+	if err := middleware.InitRecovery(config.Recovery, "kraken-tracker"); err != nil {
+		log.Fatalf("Failed to init recovery: %s", err)
+	}
+
+	if err := featureflag.Init(config.FeatureFlags, "kraken-tracker"); err != nil {
+		log.Fatalf("Failed to init feature flags: %s", err)
+	}
+
 	peerStore, err := peerstore.New(config.PeerStore)
 	if err != nil {
 		log.Fatalf("Could not create PeerStore: %s", err)
@@ -132,30 +168,81 @@ func Run(flags *Flags, opts ...Option) {
 		log.Fatalf("Error building client tls config: %s", err)
 	}
 
-	origins, err := config.Origin.Build(upstream.WithHealthCheck(healthcheck.Default(tls)))
+	originRouter, err := blobclient.NewRouter(config.OriginRoute)
+	if err != nil {
+		log.Fatalf("Error creating origin router: %s", err)
+	}
+	originOpts := []blobclient.Option{blobclient.WithTLS(tls), blobclient.WithRouter(originRouter)}
+
+	origins, err := config.Origin.Build(
+		upstream.WithHealthCheck(blobclient.NewHealthChecker(originOpts...)),
+		upstream.WithStats(stats.SubScope("origin")),
+		upstream.WithLocalZone(flags.Zone))
 	if err != nil {
 		log.Fatalf("Error building origin host list: %s", err)
 	}
 
 	originStore := originstore.New(
-		config.OriginStore, clock.New(), origins, blobclient.NewProvider(blobclient.WithTLS(tls)))
+		config.OriginStore, clock.New(), origins, blobclient.NewProvider(originOpts...))
 
-	policy, err := peerhandoutpolicy.NewPriorityPolicy(stats, config.PeerHandoutPolicy.Priority)
+	policy, err := peerhandoutpolicy.NewPriorityPolicy(
+		stats,
+		config.PeerHandoutPolicy.Priority,
+		peerhandoutpolicy.WithReputation(config.PeerHandoutPolicy.Reputation),
+		peerhandoutpolicy.WithExperiment(config.PeerHandoutPolicy.Experiment))
 	if err != nil {
 		log.Fatalf("Could not load peer handout policy: %s", err)
 	}
 
-	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
-	originCluster := blobclient.NewClusterClient(r)
+	r := blobclient.NewClientResolver(blobclient.NewProvider(originOpts...), origins)
+	originCluster := blobclient.NewClusterClient(
+		r, blobclient.WithLocalZone(flags.Zone, config.Origin.Zones))
+
+	metaInfoStore, err := originstore.NewMetaInfoStore(
+		config.OriginStore.MetaInfoCache, stats, clock.New(), originCluster)
+	if err != nil {
+		log.Fatalf("Could not create MetaInfoStore: %s", err)
+	}
+
+	publishedMetaInfo, err := originstore.NewPublishedMetaInfoStore(
+		config.OriginStore.PublishedMetaInfo, clock.New())
+	if err != nil {
+		log.Fatalf("Could not create PublishedMetaInfoStore: %s", err)
+	}
+
+	hooks, err := announcehook.New(config.AnnounceHooks, stats, clock.New())
+	if err != nil {
+		log.Fatalf("Could not create announce hooks: %s", err)
+	}
 
 	server := trackerserver.New(
-		config.TrackerServer, stats, policy, peerStore, originStore, originCluster)
+		config.TrackerServer, stats, policy, peerStore, originStore, originCluster, metaInfoStore,
+		trackerserver.WithPublishedMetaInfoStore(publishedMetaInfo),
+		trackerserver.WithAnnounceHooks(hooks))
 	go func() {
-		log.Fatal(server.ListenAndServe())
+		flusher.Fatal(server.ListenAndServe())
 	}()
 
+	if config.RemoteConfig.URL != "" {
+		poller, err := remoteconfig.New(config.RemoteConfig, "tracker", stats)
+		if err != nil {
+			log.Fatalf("Error creating remote config poller: %s", err)
+		}
+		featureflag.Global().SetRemote(poller)
+		poller.Subscribe("trackerserver", func(section json.RawMessage) error {
+			c := config.TrackerServer
+			if err := remoteconfig.Merge(section, &c); err != nil {
+				return err
+			}
+			server.Reload(c)
+			return nil
+		})
+		poller.Subscribe("tracing", tracing.GlobalSampling().ApplyRemote)
+		go poller.Run()
+	}
+
 	log.Info("Starting nginx...")
-	log.Fatal(nginx.Run(config.Nginx, map[string]interface{}{
+	flusher.Fatal(nginx.Run(config.Nginx, map[string]interface{}{
 		"port": flags.Port,
 		"server": nginx.GetServer(
 			config.TrackerServer.Listener.Net, config.TrackerServer.Listener.Addr)},
@@ -16,9 +16,15 @@ package cmd
 import (
 	"go.uber.org/zap"
 
+	"github.com/uber/kraken/lib/featureflag"
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/lib/remoteconfig"
 	"github.com/uber/kraken/lib/upstream"
 	"github.com/uber/kraken/metrics"
 	"github.com/uber/kraken/nginx"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/tracker/announcehook"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -34,7 +40,21 @@ type Config struct {
 	TrackerServer     trackerserver.Config     `yaml:"trackerserver"`
 	PeerHandoutPolicy peerhandoutpolicy.Config `yaml:"peerhandoutpolicy"`
 	Origin            upstream.ActiveConfig    `yaml:"origin"`
+	OriginRoute       blobclient.RouteConfig   `yaml:"origin_route"`
 	Metrics           metrics.Config           `yaml:"metrics"`
+	Tracing           tracing.Config           `yaml:"tracing"`
 	Nginx             nginx.Config             `yaml:"nginx"`
 	TLS               httputil.TLSConfig       `yaml:"tls"`
+	RemoteConfig      remoteconfig.Config      `yaml:"remote_config"`
+
+	// Recovery configures crash bundles written when a handler panics.
+	Recovery middleware.RecoveryConfig `yaml:"recovery"`
+
+	// FeatureFlags configures flags gating new behaviors. Flags can be
+	// overridden at runtime through /x/config/flags.
+	FeatureFlags featureflag.Config `yaml:"feature_flags"`
+
+	// AnnounceHooks configures hooks invoked on each announce, which forward
+	// announces to external systems or quarantine peers.
+	AnnounceHooks announcehook.Config `yaml:"announce_hooks"`
 }
@@ -14,6 +14,8 @@
 package metainfoclient
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -26,39 +28,80 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/tracing"
 	"github.com/uber/kraken/utils/httputil"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client errors.
 var (
 	ErrNotFound = errors.New("metainfo not found")
+
+	// ErrTrackersUnavailable is returned when none of the trackers responsible
+	// for a digest could be reached.
+	ErrTrackersUnavailable = errors.New("trackers unavailable")
+
+	// ErrMetaInfoTimeout is returned when origins did not finish generating
+	// metainfo before polling gave up.
+	ErrMetaInfoTimeout = errors.New("timed out waiting for metainfo generation")
 )
 
 // Client defines operations on torrent metainfo.
 type Client interface {
 	Download(namespace string, d core.Digest) (*core.MetaInfo, error)
+	Publish(namespace string, mi *core.MetaInfo) error
 }
 
 type client struct {
 	ring hashring.PassiveRing
 	tls  *tls.Config
+	peek bool
+}
+
+// Option allows setting optional Client parameters.
+type Option func(*client)
+
+// WithPeek configures a Client to only download metainfo which trackers have
+// cached or can get from origins already holding the blob, such that origins
+// are never asked to download the blob. Used by origins, which would otherwise
+// be asked for metainfo of blobs they are fetching.
+func WithPeek() Option {
+	return func(c *client) { c.peek = true }
 }
 
 // New returns a new Client.
-func New(ring hashring.PassiveRing, tls *tls.Config) Client {
-	return &client{ring, tls}
+func New(ring hashring.PassiveRing, tls *tls.Config, opts ...Option) Client {
+	c := &client{ring: ring, tls: tls}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // Download returns the MetaInfo associated with name. Returns ErrNotFound if
-// no torrent exists under name.
-func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, error) {
+// no torrent exists under name, ErrMetaInfoTimeout if origins are still
+// generating its metainfo after polling gives up, and ErrTrackersUnavailable
+// if no tracker could be reached.
+func (c *client) Download(namespace string, d core.Digest) (mi *core.MetaInfo, err error) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "metainfo.download", trace.WithAttributes(
+		attribute.String("namespace", namespace),
+		attribute.String("digest", d.String())))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var query string
+	if c.peek {
+		query = "?peek=true"
+	}
+
+	// Any tracker can serve metainfo, so prefer trackers in the local zone.
 	var resp *http.Response
-	var err error
-	for _, addr := range c.ring.Locations(d) {
+	for _, addr := range c.ring.ReadLocations(d) {
 		resp, err = httputil.PollAccepted(
 			fmt.Sprintf(
-				"http://%s/namespace/%s/blobs/%s/metainfo",
-				addr, url.PathEscape(namespace), d),
+				"http://%s/namespace/%s/blobs/%s/metainfo%s",
+				addr, url.PathEscape(namespace), d, query),
 			&backoff.ExponentialBackOff{
 				InitialInterval:     time.Second,
 				RandomizationFactor: 0.05,
@@ -68,7 +111,8 @@ func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, erro
 				Clock:               backoff.SystemClock,
 			},
 			httputil.SendTimeout(10*time.Second),
-			httputil.SendTLS(c.tls))
+			httputil.SendTLS(c.tls),
+			httputil.SendContext(ctx))
 		if err != nil {
 			if httputil.IsNetworkError(err) {
 				c.ring.Failed(addr)
@@ -77,6 +121,9 @@ func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, erro
 			if httputil.IsNotFound(err) {
 				return nil, ErrNotFound
 			}
+			if err == httputil.ErrAcceptedTimeout {
+				return nil, ErrMetaInfoTimeout
+			}
 			return nil, err
 		}
 		defer resp.Body.Close()
@@ -84,11 +131,53 @@ func (c *client) Download(namespace string, d core.Digest) (*core.MetaInfo, erro
 		if err != nil {
 			return nil, fmt.Errorf("read body: %s", err)
 		}
-		mi, err := core.DeserializeMetaInfo(b)
+		mi, err = core.DeserializeMetaInfo(b)
 		if err != nil {
 			return nil, fmt.Errorf("deserialize metainfo: %s", err)
 		}
 		return mi, nil
 	}
-	return nil, err
+	if err == nil {
+		return nil, ErrTrackersUnavailable
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTrackersUnavailable, err)
+}
+
+// Publish publishes mi, generated by the agent which produced its blob, to
+// the trackers responsible for it. Only accepted by trackers for namespaces
+// which are distributed by agents only.
+func (c *client) Publish(namespace string, mi *core.MetaInfo) (err error) {
+	ctx, span := tracing.Tracer().Start(context.Background(), "metainfo.publish", trace.WithAttributes(
+		attribute.String("namespace", namespace),
+		attribute.String("digest", mi.Digest().String())))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	b, err := mi.Serialize()
+	if err != nil {
+		return fmt.Errorf("serialize metainfo: %s", err)
+	}
+	published := false
+	err = errors.New("no trackers available")
+	for _, addr := range c.ring.Locations(mi.Digest()) {
+		_, err = httputil.Post(
+			fmt.Sprintf(
+				"http://%s/namespace/%s/blobs/%s/metainfo",
+				addr, url.PathEscape(namespace), mi.Digest()),
+			httputil.SendBody(bytes.NewReader(b)),
+			httputil.SendTimeout(10*time.Second),
+			httputil.SendTLS(c.tls),
+			httputil.SendContext(ctx))
+		if err != nil {
+			if httputil.IsNetworkError(err) {
+				c.ring.Failed(addr)
+				continue
+			}
+			return err
+		}
+		published = true
+	}
+	if !published {
+		return err
+	}
+	return nil
 }
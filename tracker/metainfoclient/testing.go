@@ -53,3 +53,12 @@ func (c *TestClient) Download(namespace string, d core.Digest) (*core.MetaInfo,
 	}
 	return mi, nil
 }
+
+// Publish stores mi such that it can be subsequently downloaded. Ignores
+// namespace.
+func (c *TestClient) Publish(namespace string, mi *core.MetaInfo) error {
+	c.Lock()
+	defer c.Unlock()
+	c.m[mi.Digest()] = mi
+	return nil
+}
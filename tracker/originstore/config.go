@@ -21,6 +21,12 @@ type Config struct {
 	LocationsErrorTTL    time.Duration `yaml:"locations_error_ttl"`
 	OriginContextTTL     time.Duration `yaml:"origin_context_ttl"`
 	OriginUnavailableTTL time.Duration `yaml:"origin_unavailable_ttl"`
+
+	MetaInfoCache MetaInfoCacheConfig `yaml:"metainfo_cache"`
+
+	// PublishedMetaInfo configures the storage of metainfo published by agents
+	// for namespaces which are distributed without origins.
+	PublishedMetaInfo PublishedMetaInfoConfig `yaml:"published_metainfo"`
 }
 
 func (c *Config) applyDefaults() {
@@ -37,3 +43,76 @@ func (c *Config) applyDefaults() {
 		c.OriginUnavailableTTL = time.Minute
 	}
 }
+
+// MetaInfoCacheConfig defines MetaInfoStore cache configuration.
+//
+// NOTE: Metainfo is cached in memory unless Redis.Addr is set, in which case
+// the cache is shared by all trackers using the same Redis.
+type MetaInfoCacheConfig struct {
+	Enabled         bool                `yaml:"enabled"`
+	TTL             time.Duration       `yaml:"ttl"`
+	MaxLocalEntries int                 `yaml:"max_local_entries"`
+	Redis           MetaInfoRedisConfig `yaml:"redis"`
+}
+
+// MetaInfoRedisConfig defines Redis configuration for the metainfo cache.
+type MetaInfoRedisConfig struct {
+	Addr            string        `yaml:"addr"`
+	DialTimeout     time.Duration `yaml:"dial_timeout"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	MaxActiveConns  int           `yaml:"max_active_conns"`
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+}
+
+func (c *MetaInfoCacheConfig) applyDefaults() {
+	if c.TTL == 0 {
+		c.TTL = 5 * time.Minute
+	}
+	if c.MaxLocalEntries == 0 {
+		c.MaxLocalEntries = 10000
+	}
+	if c.Redis.DialTimeout == 0 {
+		c.Redis.DialTimeout = 5 * time.Second
+	}
+	if c.Redis.ReadTimeout == 0 {
+		c.Redis.ReadTimeout = 5 * time.Second
+	}
+	if c.Redis.WriteTimeout == 0 {
+		c.Redis.WriteTimeout = 5 * time.Second
+	}
+	if c.Redis.MaxIdleConns == 0 {
+		c.Redis.MaxIdleConns = 10
+	}
+	if c.Redis.MaxActiveConns == 0 {
+		c.Redis.MaxActiveConns = 500
+	}
+	if c.Redis.IdleConnTimeout == 0 {
+		c.Redis.IdleConnTimeout = 60 * time.Second
+	}
+}
+
+// PublishedMetaInfoConfig defines PublishedMetaInfoStore configuration.
+type PublishedMetaInfoConfig struct {
+	// TTL is how long published metainfo is kept. Blobs can no longer be
+	// downloaded by agents which do not have them once it expires.
+	TTL             time.Duration       `yaml:"ttl"`
+	MaxLocalEntries int                 `yaml:"max_local_entries"`
+	Redis           MetaInfoRedisConfig `yaml:"redis"`
+}
+
+// cacheConfig converts c into the configuration of the underlying cache.
+func (c PublishedMetaInfoConfig) cacheConfig() MetaInfoCacheConfig {
+	if c.TTL == 0 {
+		c.TTL = 24 * time.Hour
+	}
+	mc := MetaInfoCacheConfig{
+		Enabled:         true,
+		TTL:             c.TTL,
+		MaxLocalEntries: c.MaxLocalEntries,
+		Redis:           c.Redis,
+	}
+	mc.applyDefaults()
+	return mc
+}
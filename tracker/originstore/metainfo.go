@@ -0,0 +1,307 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package originstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/garyburd/redigo/redis"
+	"github.com/uber-go/tally"
+	"golang.org/x/sync/singleflight"
+)
+
+// MetaInfoStore fetches metainfo from the origin cluster. Concurrent requests
+// for the same digest are deduplicated into a single origin request, and
+// results are optionally cached, such that a herd of agents requesting
+// metainfo for a new blob does not overload origins.
+type MetaInfoStore interface {
+	GetMetaInfo(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error)
+
+	// PeekMetaInfo returns metainfo only if it is cached or an origin already
+	// holds the blob, and never makes origins download the blob. Returns
+	// ErrMetaInfoUnavailable otherwise.
+	PeekMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error)
+}
+
+// ErrMetaInfoUnavailable is returned by PeekMetaInfo if metainfo is neither
+// cached nor held by any origin.
+var ErrMetaInfoUnavailable = errors.New("metainfo unavailable without origin download")
+
+// metaInfoCache stores serialized metainfo.
+type metaInfoCache interface {
+	get(d core.Digest) (b []byte, ok bool, err error)
+	set(d core.Digest, b []byte) error
+}
+
+type metaInfoStore struct {
+	stats   tally.Scope
+	cluster blobclient.ClusterClient
+	cache   metaInfoCache // Nil if caching is disabled.
+	group   singleflight.Group
+}
+
+// NewMetaInfoStore creates a new MetaInfoStore which fetches metainfo from
+// cluster.
+func NewMetaInfoStore(
+	config MetaInfoCacheConfig,
+	stats tally.Scope,
+	clk clock.Clock,
+	cluster blobclient.ClusterClient) (MetaInfoStore, error) {
+
+	config.applyDefaults()
+
+	stats = stats.Tagged(map[string]string{
+		"module": "metainfostore",
+	})
+
+	s := &metaInfoStore{
+		stats:   stats,
+		cluster: cluster,
+	}
+	if config.Enabled {
+		if config.Redis.Addr != "" {
+			c, err := newRedisMetaInfoCache(config, _metaInfoPrefix)
+			if err != nil {
+				return nil, fmt.Errorf("new redis metainfo cache: %s", err)
+			}
+			s.cache = c
+		} else {
+			s.cache = newLocalMetaInfoCache(config, clk)
+		}
+	}
+	return s, nil
+}
+
+func (s *metaInfoStore) GetMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+
+	v, err, shared := s.group.Do(d.Name(), func() (interface{}, error) {
+		// Callers sharing the result must not be failed by the leader's
+		// request being cancelled.
+		return s.getMetaInfo(tracing.Detach(ctx), namespace, d)
+	})
+	if shared {
+		s.stats.Counter("deduplicated").Inc(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*core.MetaInfo), nil
+}
+
+func (s *metaInfoStore) PeekMetaInfo(namespace string, d core.Digest) (*core.MetaInfo, error) {
+	if mi, ok := s.cached(d); ok {
+		return mi, nil
+	}
+	mi, err := s.cluster.GetLocalMetaInfo(namespace, d)
+	if err == blobclient.ErrBlobNotFound {
+		return nil, ErrMetaInfoUnavailable
+	} else if err != nil {
+		return nil, err
+	}
+	s.cacheMetaInfo(d, mi)
+	return mi, nil
+}
+
+// cached returns the cached metainfo of d, if any.
+func (s *metaInfoStore) cached(d core.Digest) (*core.MetaInfo, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+	b, ok, err := s.cache.get(d)
+	if err != nil {
+		s.stats.Counter("cache_errors").Inc(1)
+		log.With("digest", d).Errorf("Error getting cached metainfo: %s", err)
+	} else if ok {
+		mi, err := core.DeserializeMetaInfo(b)
+		if err == nil {
+			s.stats.Counter("cache_hits").Inc(1)
+			return mi, true
+		}
+		log.With("digest", d).Errorf("Error deserializing cached metainfo: %s", err)
+	}
+	s.stats.Counter("cache_misses").Inc(1)
+	return nil, false
+}
+
+func (s *metaInfoStore) getMetaInfo(
+	ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+
+	if mi, ok := s.cached(d); ok {
+		return mi, nil
+	}
+
+	// Errors are not cached, since origins return 202 while metainfo is
+	// still being generated.
+	mi, err := s.cluster.GetMetaInfo(ctx, namespace, d)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheMetaInfo(d, mi)
+	return mi, nil
+}
+
+// cacheMetaInfo caches mi, if caching is enabled. Errors are only logged,
+// since metainfo can always be fetched from origins again.
+func (s *metaInfoStore) cacheMetaInfo(d core.Digest, mi *core.MetaInfo) {
+	if s.cache == nil {
+		return
+	}
+	b, err := mi.Serialize()
+	if err != nil {
+		s.stats.Counter("cache_errors").Inc(1)
+		log.With("digest", d).Errorf("Error serializing metainfo: %s", err)
+		return
+	}
+	if err := s.cache.set(d, b); err != nil {
+		s.stats.Counter("cache_errors").Inc(1)
+		log.With("digest", d).Errorf("Error caching metainfo: %s", err)
+	}
+}
+
+type localMetaInfoEntry struct {
+	b         []byte
+	expiresAt time.Time
+}
+
+// localMetaInfoCache caches metainfo in memory.
+type localMetaInfoCache struct {
+	config MetaInfoCacheConfig
+	clk    clock.Clock
+
+	mu      sync.Mutex
+	entries map[core.Digest]localMetaInfoEntry
+}
+
+func newLocalMetaInfoCache(config MetaInfoCacheConfig, clk clock.Clock) *localMetaInfoCache {
+	return &localMetaInfoCache{
+		config:  config,
+		clk:     clk,
+		entries: make(map[core.Digest]localMetaInfoEntry),
+	}
+}
+
+func (c *localMetaInfoCache) get(d core.Digest) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[d]
+	if !ok {
+		return nil, false, nil
+	}
+	if c.clk.Now().After(e.expiresAt) {
+		delete(c.entries, d)
+		return nil, false, nil
+	}
+	return e.b, true, nil
+}
+
+func (c *localMetaInfoCache) set(d core.Digest, b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clk.Now()
+	if len(c.entries) >= c.config.MaxLocalEntries {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.config.MaxLocalEntries {
+			return errors.New("local cache full")
+		}
+	}
+	c.entries[d] = localMetaInfoEntry{b, now.Add(c.config.TTL)}
+	return nil
+}
+
+// Key prefixes of redisMetaInfoCache.
+const (
+	_metaInfoPrefix          = "metainfo"
+	_publishedMetaInfoPrefix = "published_metainfo"
+)
+
+// redisMetaInfoCache caches metainfo in Redis, such that the cache is shared
+// by all trackers.
+type redisMetaInfoCache struct {
+	config MetaInfoCacheConfig
+	prefix string
+	pool   *redis.Pool
+}
+
+func newRedisMetaInfoCache(config MetaInfoCacheConfig, prefix string) (*redisMetaInfoCache, error) {
+	rc := config.Redis
+	c := &redisMetaInfoCache{
+		config: config,
+		prefix: prefix,
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial(
+					"tcp",
+					rc.Addr,
+					redis.DialConnectTimeout(rc.DialTimeout),
+					redis.DialReadTimeout(rc.ReadTimeout),
+					redis.DialWriteTimeout(rc.WriteTimeout))
+			},
+			MaxIdle:     rc.MaxIdleConns,
+			MaxActive:   rc.MaxActiveConns,
+			IdleTimeout: rc.IdleConnTimeout,
+			Wait:        true,
+		},
+	}
+
+	// Ensure we can connect to Redis.
+	conn, err := c.pool.Dial()
+	if err != nil {
+		return nil, fmt.Errorf("dial redis: %s", err)
+	}
+	conn.Close()
+
+	return c, nil
+}
+
+func (c *redisMetaInfoCache) key(d core.Digest) string {
+	return fmt.Sprintf("%s:%s", c.prefix, d.Name())
+}
+
+func (c *redisMetaInfoCache) get(d core.Digest) ([]byte, bool, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	b, err := redis.Bytes(conn.Do("GET", c.key(d)))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (c *redisMetaInfoCache) set(d core.Digest, b []byte) error {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", c.key(d), b, "EX", int64(c.config.TTL.Seconds()))
+	return err
+}
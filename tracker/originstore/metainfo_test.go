@@ -0,0 +1,239 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package originstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/mocks/origin/blobclient"
+	"github.com/uber/kraken/origin/blobclient"
+
+	"github.com/alicebob/miniredis"
+	"github.com/andres-erbsen/clock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const _testNamespace = "test-namespace"
+
+func TestMetaInfoStoreCachesInMemory(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cluster := mockblobclient.NewMockClusterClient(ctrl)
+
+	clk := clock.NewMock()
+	config := MetaInfoCacheConfig{Enabled: true, TTL: time.Minute}
+
+	s, err := NewMetaInfoStore(config, tally.NoopScope, clk, cluster)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	for i := 0; i < 2; i++ {
+		mi, err := s.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+		require.NoError(err)
+		require.Equal(blob.MetaInfo, mi)
+	}
+
+	clk.Add(time.Minute + 1)
+
+	cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	mi, err := s.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestMetaInfoStorePeekMetaInfoNeverMakesOriginsDownload(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cluster := mockblobclient.NewMockClusterClient(ctrl)
+
+	config := MetaInfoCacheConfig{Enabled: true, TTL: time.Minute}
+
+	s, err := NewMetaInfoStore(config, tally.NoopScope, clock.NewMock(), cluster)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	cluster.EXPECT().GetLocalMetaInfo(_testNamespace, blob.Digest).Return(nil, blobclient.ErrBlobNotFound)
+
+	_, err = s.PeekMetaInfo(_testNamespace, blob.Digest)
+	require.Equal(ErrMetaInfoUnavailable, err)
+
+	cluster.EXPECT().GetLocalMetaInfo(_testNamespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	mi, err := s.PeekMetaInfo(_testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+
+	// Served from the cache.
+	mi, err = s.PeekMetaInfo(_testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestMetaInfoStoreCachesInRedis(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cluster := mockblobclient.NewMockClusterClient(ctrl)
+
+	redis, err := miniredis.Run()
+	require.NoError(err)
+	defer redis.Close()
+
+	config := MetaInfoCacheConfig{
+		Enabled: true,
+		Redis:   MetaInfoRedisConfig{Addr: redis.Addr()},
+	}
+
+	// Trackers sharing the same Redis share cached metainfo.
+	s1, err := NewMetaInfoStore(config, tally.NoopScope, clock.New(), cluster)
+	require.NoError(err)
+	s2, err := NewMetaInfoStore(config, tally.NoopScope, clock.New(), cluster)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	mi, err := s1.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+
+	mi, err = s2.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+
+	redis.FastForward(5*time.Minute + 1)
+
+	cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).Return(blob.MetaInfo, nil)
+
+	_, err = s2.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+	require.NoError(err)
+}
+
+func TestMetaInfoStoreDoesNotCacheErrors(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cluster := mockblobclient.NewMockClusterClient(ctrl)
+
+	config := MetaInfoCacheConfig{Enabled: true}
+
+	s, err := NewMetaInfoStore(config, tally.NoopScope, clock.New(), cluster)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	gomock.InOrder(
+		cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).Return(nil, errors.New("some error")),
+		cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).Return(blob.MetaInfo, nil),
+	)
+
+	_, err = s.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+	require.Error(err)
+
+	mi, err := s.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
+
+func TestMetaInfoStoreDeduplicatesConcurrentRequests(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cluster := mockblobclient.NewMockClusterClient(ctrl)
+
+	s, err := NewMetaInfoStore(MetaInfoCacheConfig{}, tally.NoopScope, clock.New(), cluster)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	release := make(chan struct{})
+	cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).DoAndReturn(
+		func(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+			<-release
+			return blob.MetaInfo, nil
+		})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mi, err := s.GetMetaInfo(context.Background(), _testNamespace, blob.Digest)
+			require.NoError(err)
+			require.Equal(blob.MetaInfo, mi)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
+
+func TestMetaInfoStorePassesSpanButNotCancellationToOrigins(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cluster := mockblobclient.NewMockClusterClient(ctrl)
+
+	s, err := NewMetaInfoStore(MetaInfoCacheConfig{}, tally.NoopScope, clock.New(), cluster)
+	require.NoError(err)
+
+	blob := core.NewBlobFixture()
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), sc))
+	cancel()
+
+	cluster.EXPECT().GetMetaInfo(gomock.Any(), _testNamespace, blob.Digest).DoAndReturn(
+		func(ctx context.Context, namespace string, d core.Digest) (*core.MetaInfo, error) {
+			require.Equal(sc, trace.SpanContextFromContext(ctx))
+			require.NoError(ctx.Err())
+			return blob.MetaInfo, nil
+		})
+
+	mi, err := s.GetMetaInfo(ctx, _testNamespace, blob.Digest)
+	require.NoError(err)
+	require.Equal(blob.MetaInfo, mi)
+}
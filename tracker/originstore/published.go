@@ -0,0 +1,77 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package originstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/andres-erbsen/clock"
+)
+
+// ErrMetaInfoNotPublished is returned when no metainfo was published for a
+// digest.
+var ErrMetaInfoNotPublished = errors.New("metainfo not published")
+
+// PublishedMetaInfoStore stores metainfo published by agents for blobs which
+// are distributed by agents only, and thus never reach origins.
+type PublishedMetaInfoStore interface {
+	Put(mi *core.MetaInfo) error
+	Get(d core.Digest) (*core.MetaInfo, error)
+}
+
+type publishedMetaInfoStore struct {
+	cache metaInfoCache
+}
+
+// NewPublishedMetaInfoStore creates a new PublishedMetaInfoStore. Metainfo is
+// stored in memory unless config.Redis.Addr is set, in which case it is shared
+// by all trackers using the same Redis.
+func NewPublishedMetaInfoStore(
+	config PublishedMetaInfoConfig, clk clock.Clock) (PublishedMetaInfoStore, error) {
+
+	c := config.cacheConfig()
+	if c.Redis.Addr != "" {
+		cache, err := newRedisMetaInfoCache(c, _publishedMetaInfoPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("new redis metainfo cache: %s", err)
+		}
+		return &publishedMetaInfoStore{cache}, nil
+	}
+	return &publishedMetaInfoStore{newLocalMetaInfoCache(c, clk)}, nil
+}
+
+// Put stores mi, replacing any metainfo previously published for its digest.
+func (s *publishedMetaInfoStore) Put(mi *core.MetaInfo) error {
+	b, err := mi.Serialize()
+	if err != nil {
+		return fmt.Errorf("serialize metainfo: %s", err)
+	}
+	return s.cache.set(mi.Digest(), b)
+}
+
+// Get returns the metainfo published for d. Returns ErrMetaInfoNotPublished if
+// none was published or it expired.
+func (s *publishedMetaInfoStore) Get(d core.Digest) (*core.MetaInfo, error) {
+	b, ok, err := s.cache.get(d)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMetaInfoNotPublished
+	}
+	return core.DeserializeMetaInfo(b)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package originstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/alicebob/miniredis"
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishedMetaInfoStoreInMemory(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+
+	s, err := NewPublishedMetaInfoStore(PublishedMetaInfoConfig{TTL: time.Hour}, clk)
+	require.NoError(err)
+
+	mi := core.MetaInfoFixture()
+
+	_, err = s.Get(mi.Digest())
+	require.Equal(ErrMetaInfoNotPublished, err)
+
+	require.NoError(s.Put(mi))
+
+	result, err := s.Get(mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+
+	clk.Add(time.Hour + 1)
+
+	_, err = s.Get(mi.Digest())
+	require.Equal(ErrMetaInfoNotPublished, err)
+}
+
+func TestPublishedMetaInfoStoreInRedis(t *testing.T) {
+	require := require.New(t)
+
+	redis, err := miniredis.Run()
+	require.NoError(err)
+	defer redis.Close()
+
+	config := PublishedMetaInfoConfig{
+		TTL:   time.Hour,
+		Redis: MetaInfoRedisConfig{Addr: redis.Addr()},
+	}
+
+	s, err := NewPublishedMetaInfoStore(config, clock.New())
+	require.NoError(err)
+
+	mi := core.MetaInfoFixture()
+
+	_, err = s.Get(mi.Digest())
+	require.Equal(ErrMetaInfoNotPublished, err)
+
+	require.NoError(s.Put(mi))
+
+	result, err := s.Get(mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+
+	// Published metainfo is kept apart from the origin metainfo cache.
+	require.True(redis.Exists(_publishedMetaInfoPrefix + ":" + mi.Digest().Hex()))
+	require.False(redis.Exists(_metaInfoPrefix + ":" + mi.Digest().Hex()))
+}
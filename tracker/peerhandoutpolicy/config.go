@@ -15,5 +15,47 @@ package peerhandoutpolicy
 
 // Config defines configuration for the peer handout policy.
 type Config struct {
-	Priority string `yaml:"priority"`
+	Priority   string           `yaml:"priority"`
+	Reputation ReputationConfig `yaml:"reputation"`
+
+	// Experiment optionally hands out peers to a share of announcing peers
+	// using a candidate policy, so that it can be compared against the
+	// policy above before rolling it out.
+	Experiment ExperimentConfig `yaml:"experiment"`
+}
+
+// ExperimentConfig defines a candidate peer handout policy.
+type ExperimentConfig struct {
+	// Percent is the percentage of announcing peers, between 0 and 100, which
+	// receive handouts from the candidate policy. Peers are assigned by peer
+	// id, so each peer consistently receives handouts from the same policy.
+	// The experiment is disabled if zero.
+	Percent int `yaml:"percent"`
+
+	Priority   string           `yaml:"priority"`
+	Reputation ReputationConfig `yaml:"reputation"`
+}
+
+// ReputationConfig defines how the historical stats of peers affect the order
+// of peer handouts.
+type ReputationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinHandouts is the number of handouts required before a peer is judged
+	// as leech-only or unreliable.
+	MinHandouts int64 `yaml:"min_handouts"`
+
+	// MaxFailureRate is the ratio of failed connections to handouts above
+	// which a peer is considered unreliable.
+	MaxFailureRate float64 `yaml:"max_failure_rate"`
+}
+
+func (c ReputationConfig) applyDefaults() ReputationConfig {
+	if c.MinHandouts == 0 {
+		c.MinHandouts = 20
+	}
+	if c.MaxFailureRate == 0 {
+		c.MaxFailureRate = 0.5
+	}
+	return c
 }
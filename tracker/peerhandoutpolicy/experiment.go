@@ -0,0 +1,66 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+)
+
+// WithExperiment configures the PriorityPolicy to sort peers for a percentage
+// of announcing peers with a candidate policy, if enabled in config.
+func WithExperiment(config ExperimentConfig) Option {
+	return func(p *PriorityPolicy) { p.experiment = config }
+}
+
+// startExperiment initializes the candidate policy. Metrics of both policies
+// are tagged by experiment arm.
+func (p *PriorityPolicy) startExperiment(stats tally.Scope) error {
+	if p.experiment.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100, got %d", p.experiment.Percent)
+	}
+	candidate, err := NewPriorityPolicy(
+		stats, p.experiment.Priority, WithReputation(p.experiment.Reputation))
+	if err != nil {
+		return fmt.Errorf("candidate: %s", err)
+	}
+	candidate.stats = candidate.stats.Tagged(map[string]string{"arm": "candidate"})
+	p.stats = p.stats.Tagged(map[string]string{"arm": "control"})
+	p.candidate = candidate
+	return nil
+}
+
+// assign returns the policy which sorts peers for peerID.
+func (p *PriorityPolicy) assign(peerID core.PeerID) *PriorityPolicy {
+	if p.candidate == nil {
+		return p
+	}
+	h := fnv.New32a()
+	h.Write(peerID[:])
+	if int(h.Sum32()%100) < p.experiment.Percent {
+		return p.candidate
+	}
+	return p
+}
+
+// RecordDownload records the time peerID took to download a torrent under the
+// policy it is assigned to, so the outcomes of experiment arms can be compared.
+func (p *PriorityPolicy) RecordDownload(peerID core.PeerID, t time.Duration) {
+	p.assign(peerID).stats.Timer("download_time").Record(t)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestExperimentAssignsPeersConsistently(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(tally.NoopScope, _defaultPolicy, WithExperiment(
+		ExperimentConfig{Percent: 30, Priority: _completenessPolicy}))
+	require.NoError(err)
+
+	var candidates int
+	for i := 0; i < 1000; i++ {
+		peerID := core.PeerIDFixture()
+		a := policy.assign(peerID)
+		require.Equal(a, policy.assign(peerID))
+		if a == policy.candidate {
+			candidates++
+		}
+	}
+	require.InDelta(300, candidates, 75)
+}
+
+func TestExperimentSortsPeersWithAssignedPolicy(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(tally.NoopScope, _defaultPolicy, WithExperiment(
+		ExperimentConfig{Percent: 100, Priority: _completenessPolicy}))
+	require.NoError(err)
+
+	incomplete := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+
+	sorted := policy.SortPeers(
+		core.PeerInfoFixture(), []*core.PeerInfo{incomplete, origin, seeder}, nil)
+	require.Equal([]*core.PeerInfo{seeder, origin, incomplete}, sorted)
+}
+
+func TestExperimentUsesReputationOfCandidate(t *testing.T) {
+	policy, err := NewPriorityPolicy(tally.NoopScope, _defaultPolicy, WithExperiment(
+		ExperimentConfig{
+			Percent:    10,
+			Priority:   _defaultPolicy,
+			Reputation: ReputationConfig{Enabled: true},
+		}))
+	require.NoError(t, err)
+	require.True(t, policy.UsesReputation())
+}
+
+func TestExperimentInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config ExperimentConfig
+	}{
+		{"percent too high", ExperimentConfig{Percent: 101, Priority: _defaultPolicy}},
+		{"unknown priority", ExperimentConfig{Percent: 10, Priority: "unknown"}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewPriorityPolicy(tally.NoopScope, _defaultPolicy, WithExperiment(test.config))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRecordDownloadTagsExperimentArm(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	policy, err := NewPriorityPolicy(stats, _defaultPolicy, WithExperiment(
+		ExperimentConfig{Percent: 50, Priority: _completenessPolicy}))
+	require.NoError(err)
+
+	expected := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		peerID := core.PeerIDFixture()
+		if policy.assign(peerID) == policy.candidate {
+			expected["candidate"]++
+		} else {
+			expected["control"]++
+		}
+		policy.RecordDownload(peerID, time.Second)
+	}
+
+	result := make(map[string]int)
+	for _, timer := range stats.Snapshot().Timers() {
+		if timer.Name() == "download_time" {
+			result[timer.Tags()["arm"]] += len(timer.Values())
+		}
+	}
+	require.Equal(expected, result)
+}
@@ -20,12 +20,14 @@ import (
 	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
 )
 
 type peerPriorityInfo struct {
-	peer     *core.PeerInfo
-	priority int
-	label    string
+	peer       *core.PeerInfo
+	priority   int
+	label      string
+	reputation int
 }
 
 // assignmentPolicy defines the policy for assigning priority to peers.
@@ -35,18 +37,38 @@ type assignmentPolicy interface {
 
 // PriorityPolicy wraps an assignmentPolicy and uses it to sort lists of peers.
 type PriorityPolicy struct {
-	stats  tally.Scope
-	policy assignmentPolicy
+	stats      tally.Scope
+	policy     assignmentPolicy
+	reputation ReputationConfig
+	experiment ExperimentConfig
+
+	// candidate sorts peers for the share of announcing peers assigned to the
+	// experiment, if any.
+	candidate *PriorityPolicy
+}
+
+// Option defines an optional NewPriorityPolicy parameter.
+type Option func(*PriorityPolicy)
+
+// WithReputation configures the PriorityPolicy to order peers by their
+// historical stats, if enabled in config.
+func WithReputation(config ReputationConfig) Option {
+	return func(p *PriorityPolicy) { p.reputation = config.applyDefaults() }
 }
 
 // NewPriorityPolicy returns a PriorityPolicy that assigns priorities using the given priority policy.
-func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolicy, error) {
+func NewPriorityPolicy(
+	stats tally.Scope, priorityPolicy string, opts ...Option) (*PriorityPolicy, error) {
+
 	p := &PriorityPolicy{
 		stats: stats.Tagged(map[string]string{
 			"module":   "peerhandoutpolicy",
 			"priority": priorityPolicy,
 		}),
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	switch priorityPolicy {
 	case _defaultPolicy:
@@ -57,27 +79,62 @@ func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolic
 		return nil, fmt.Errorf("priority policy %q not found", priorityPolicy)
 	}
 
+	if p.experiment.Percent > 0 {
+		if err := p.startExperiment(stats); err != nil {
+			return nil, fmt.Errorf("experiment: %s", err)
+		}
+	}
+
 	return p, nil
 }
 
+// UsesReputation returns true if SortPeers takes the historical stats of peers
+// into account.
+func (p *PriorityPolicy) UsesReputation() bool {
+	return p.reputation.Enabled || (p.candidate != nil && p.candidate.UsesReputation())
+}
+
 // SortPeers returns the given list of peers sorted by the priority assigned to them
-// by the priorityPolicy. Excludes the source peer from the list.
-func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo) []*core.PeerInfo {
+// by the priorityPolicy. Excludes the source peer from the list. If reputation is
+// enabled, leech-only and unreliable peers are sorted last, and peers of equal
+// priority are sorted by reputation according to peerStats. Origins are exempt
+// from reputation. If an experiment is running, peers are sorted by the policy
+// source is assigned to.
+func (p *PriorityPolicy) SortPeers(
+	source *core.PeerInfo,
+	peers []*core.PeerInfo,
+	peerStats map[core.PeerID]*peerstore.PeerStats) []*core.PeerInfo {
+
+	if a := p.assign(source.PeerID); a != p {
+		return a.SortPeers(source, peers, peerStats)
+	}
 
 	peerPriorities := make([]*peerPriorityInfo, 0, len(peers))
 	for k := 0; k < len(peers); k++ {
 		if peers[k] != source {
 			priority, label := p.policy.assignPriority(peers[k])
+			reputation := _unknown
+			if p.reputation.Enabled && !peers[k].Origin {
+				reputation = p.reputation.reputation(peerStats[peers[k].PeerID])
+			}
 			peerPriorities = append(peerPriorities,
-				&peerPriorityInfo{peers[k], priority, label})
+				&peerPriorityInfo{peers[k], priority, label, reputation})
 		}
 	}
 
 	sort.Slice(peerPriorities, func(i, j int) bool {
-		return peerPriorities[i].priority < peerPriorities[j].priority
+		a, b := peerPriorities[i], peerPriorities[j]
+		if penalized(a.reputation) != penalized(b.reputation) {
+			return !penalized(a.reputation)
+		}
+		if a.priority != b.priority {
+			return a.priority < b.priority
+		}
+		return a.reputation < b.reputation
 	})
 
 	priorityCounts := make(map[string]int)
+	reputationCounts := make(map[string]int)
 	for k := 0; k < len(peerPriorities); k++ {
 		p := peerPriorities[k]
 		peers[k] = p.peer
@@ -86,6 +143,7 @@ func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo
 		} else {
 			priorityCounts[p.label] = 1
 		}
+		reputationCounts[_reputationLabels[p.reputation]]++
 	}
 	peers = peers[:len(peerPriorities)]
 
@@ -94,6 +152,13 @@ func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo
 			"label": label,
 		}).Gauge("count").Update(float64(count))
 	}
+	if p.reputation.Enabled {
+		for label, count := range reputationCounts {
+			p.stats.Tagged(map[string]string{
+				"reputation": label,
+			}).Gauge("reputation_count").Update(float64(count))
+		}
+	}
 
 	return peers
 }
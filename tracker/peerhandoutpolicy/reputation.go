@@ -0,0 +1,58 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import "github.com/uber/kraken/tracker/peerstore"
+
+// Reputation ranks, from most to least preferred.
+const (
+	_reliable = iota
+	_unknown
+	_leech
+	_unreliable
+)
+
+var _reputationLabels = map[int]string{
+	_reliable:   "reliable",
+	_unknown:    "unknown",
+	_leech:      "leech",
+	_unreliable: "unreliable",
+}
+
+// reputation ranks a peer by its historical stats. Peers which have seeded
+// bytes without failing too often are reliable. Once a peer has been handed out
+// MinHandouts times, it is unreliable if connections to it fail too often, or
+// a leech if it never seeded any bytes. All other peers are unknown.
+func (c ReputationConfig) reputation(stats *peerstore.PeerStats) int {
+	if stats == nil {
+		return _unknown
+	}
+	judged := stats.Handouts >= c.MinHandouts
+	if judged && stats.FailureRate() > c.MaxFailureRate {
+		return _unreliable
+	}
+	if stats.BytesSeeded > 0 {
+		return _reliable
+	}
+	if judged {
+		return _leech
+	}
+	return _unknown
+}
+
+// penalized returns true if peers of the given reputation are handed out after
+// all other peers, regardless of their priority.
+func penalized(reputation int) bool {
+	return reputation >= _leech
+}
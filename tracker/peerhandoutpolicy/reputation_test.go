@@ -0,0 +1,75 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerhandoutpolicy
+
+import (
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestReputation(t *testing.T) {
+	config := ReputationConfig{}.applyDefaults()
+
+	tests := []struct {
+		desc     string
+		stats    *peerstore.PeerStats
+		expected int
+	}{
+		{"no stats", nil, _unknown},
+		{"few handouts", &peerstore.PeerStats{Handouts: 5}, _unknown},
+		{"seeded", &peerstore.PeerStats{Handouts: 5, BytesSeeded: 1}, _reliable},
+		{"never seeded", &peerstore.PeerStats{Handouts: 50}, _leech},
+		{"flapping", &peerstore.PeerStats{Handouts: 50, BytesSeeded: 1, Failures: 40}, _unreliable},
+		{"few failures", &peerstore.PeerStats{Handouts: 50, BytesSeeded: 1, Failures: 5}, _reliable},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require.Equal(t, test.expected, config.reputation(test.stats))
+		})
+	}
+}
+
+func TestPriorityPolicySortsByReputation(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := NewPriorityPolicy(
+		tally.NoopScope, _completenessPolicy, WithReputation(ReputationConfig{Enabled: true}))
+	require.NoError(err)
+
+	reliableSeeder := core.PeerInfoFixture()
+	reliableSeeder.Complete = true
+	leechSeeder := core.PeerInfoFixture()
+	leechSeeder.Complete = true
+	unknownSeeder := core.PeerInfoFixture()
+	unknownSeeder.Complete = true
+	origin := core.OriginPeerInfoFixture()
+	incomplete := core.PeerInfoFixture()
+
+	stats := map[core.PeerID]*peerstore.PeerStats{
+		reliableSeeder.PeerID: {Handouts: 50, BytesSeeded: 1024},
+		leechSeeder.PeerID:    {Handouts: 50},
+		origin.PeerID:         {Handouts: 50},
+	}
+
+	peers := []*core.PeerInfo{leechSeeder, incomplete, origin, unknownSeeder, reliableSeeder}
+	sorted := policy.SortPeers(core.PeerInfoFixture(), peers, stats)
+	require.Equal([]*core.PeerInfo{
+		reliableSeeder, unknownSeeder, origin, incomplete, leechSeeder,
+	}, sorted)
+}
@@ -29,19 +29,47 @@ type Config struct {
 // LocalConfig defines LocalStore configuration.
 type LocalConfig struct {
 	TTL time.Duration `yaml:"ttl"`
+
+	// PeerStatsTTL is how long the stats of a peer are kept after their last
+	// update.
+	PeerStatsTTL time.Duration `yaml:"peer_stats_ttl"`
 }
 
 func (c *LocalConfig) applyDefaults() {
 	if c.TTL == 0 {
 		c.TTL = 5 * time.Hour
 	}
+	if c.PeerStatsTTL == 0 {
+		c.PeerStatsTTL = 7 * 24 * time.Hour
+	}
 }
 
+// Redis topologies.
+const (
+	RedisStandalone = "standalone"
+	RedisSentinel   = "sentinel"
+	RedisCluster    = "cluster"
+)
+
 // RedisConfig defines RedisStore configuration.
 // TODO(evelynl94): rename
 type RedisConfig struct {
-	Enabled           bool          `yaml:"enabled"`
-	Addr              string        `yaml:"addr"`
+	Enabled bool `yaml:"enabled"`
+
+	// Mode is the topology of the Redis deployment: standalone (default),
+	// sentinel or cluster.
+	Mode string `yaml:"mode"`
+
+	// Addr is the address of the standalone Redis server.
+	Addr string `yaml:"addr"`
+
+	Sentinel RedisSentinelConfig `yaml:"sentinel"`
+	Cluster  RedisClusterConfig  `yaml:"cluster"`
+
+	// ReadFromReplicas serves reads from replicas, which may lag behind the
+	// master, in sentinel and cluster mode.
+	ReadFromReplicas bool `yaml:"read_from_replicas"`
+
 	DialTimeout       time.Duration `yaml:"dial_timeout"`
 	ReadTimeout       time.Duration `yaml:"read_timeout"`
 	WriteTimeout      time.Duration `yaml:"write_timeout"`
@@ -50,9 +78,41 @@ type RedisConfig struct {
 	MaxIdleConns      int           `yaml:"max_idle_conns"`
 	MaxActiveConns    int           `yaml:"max_active_conns"`
 	IdleConnTimeout   time.Duration `yaml:"idle_conn_timeout"`
+
+	// PeerStatsTTL is how long the stats of a peer are kept after their last
+	// update.
+	PeerStatsTTL time.Duration `yaml:"peer_stats_ttl"`
+}
+
+// RedisSentinelConfig defines how to find the master and replicas of a Redis
+// deployment managed by Sentinel.
+type RedisSentinelConfig struct {
+	// MasterName is the name under which the sentinels monitor the master.
+	MasterName string `yaml:"master_name"`
+
+	// Addrs are the addresses of the sentinels.
+	Addrs []string `yaml:"addrs"`
+
+	// CheckInterval is how often pooled connections are checked against the
+	// current master, such that connections to a demoted master are dropped
+	// after a failover.
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+// RedisClusterConfig defines how to discover the nodes of a Redis Cluster.
+type RedisClusterConfig struct {
+	// Addrs are the addresses of nodes which are queried for the slots served
+	// by each node. Need not include every node of the cluster.
+	Addrs []string `yaml:"addrs"`
 }
 
 func (c *RedisConfig) applyDefaults() {
+	if c.Mode == "" {
+		c.Mode = RedisStandalone
+	}
+	if c.Sentinel.CheckInterval == 0 {
+		c.Sentinel.CheckInterval = 5 * time.Second
+	}
 	if c.DialTimeout == 0 {
 		c.DialTimeout = 5 * time.Second
 	}
@@ -77,4 +137,7 @@ func (c *RedisConfig) applyDefaults() {
 	if c.IdleConnTimeout == 0 {
 		c.IdleConnTimeout = 60 * time.Second
 	}
+	if c.PeerStatsTTL == 0 {
+		c.PeerStatsTTL = 7 * 24 * time.Hour
+	}
 }
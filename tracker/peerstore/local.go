@@ -40,6 +40,9 @@ type LocalStore struct {
 
 	mu         sync.RWMutex
 	peerGroups map[core.InfoHash]*peerGroup
+
+	statsMu   sync.Mutex
+	peerStats map[core.PeerID]*peerStatsEntry
 }
 
 type peerGroup struct {
@@ -57,10 +60,22 @@ type peerEntry struct {
 	id        core.PeerID
 	ip        string
 	port      int
+	addrs     []string
 	complete  bool
 	expiresAt time.Time
 }
 
+func (e *peerEntry) peerInfo() *core.PeerInfo {
+	p := core.NewPeerInfo(e.id, e.ip, e.port, false /* origin */, e.complete)
+	p.Addrs = e.addrs
+	return p
+}
+
+type peerStatsEntry struct {
+	stats     PeerStats
+	expiresAt time.Time
+}
+
 // NewLocalStore creates a new LocalStore.
 func NewLocalStore(config LocalConfig, clk clock.Clock) *LocalStore {
 	config.applyDefaults()
@@ -71,6 +86,7 @@ func NewLocalStore(config LocalConfig, clk clock.Clock) *LocalStore {
 		cleanupExpiredPeerGroupsTicker:  time.NewTicker(_cleanupExpiredPeerGroupsInterval),
 		stop:                            make(chan struct{}),
 		peerGroups:                      make(map[core.InfoHash]*peerGroup),
+		peerStats:                       make(map[core.PeerID]*peerStatsEntry),
 	}
 	go s.cleanupTask()
 	return s
@@ -110,7 +126,7 @@ func (s *LocalStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 		// Note, we elect to return slightly expired entries rather than iterate
 		// until we find n valid entries.
 		e := g.peerList[i]
-		result = append(result, core.NewPeerInfo(e.id, e.ip, e.port, false /* origin */, e.complete))
+		result = append(result, e.peerInfo())
 	}
 	return result, nil
 }
@@ -129,6 +145,7 @@ func (s *LocalStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 	e.id = p.PeerID
 	e.ip = p.IP
 	e.port = p.Port
+	e.addrs = p.Addrs
 	e.complete = p.Complete
 	e.expiresAt = s.clk.Now().Add(s.config.TTL)
 
@@ -139,6 +156,131 @@ func (s *LocalStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 	return nil
 }
 
+// UpdatePeerStats implements Store.
+func (s *LocalStore) UpdatePeerStats(deltas []*PeerStats) error {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	for _, d := range deltas {
+		e, ok := s.peerStats[d.PeerID]
+		if !ok {
+			e = &peerStatsEntry{stats: PeerStats{PeerID: d.PeerID}}
+			s.peerStats[d.PeerID] = e
+		}
+		e.stats.add(d)
+		e.expiresAt = s.clk.Now().Add(s.config.PeerStatsTTL)
+	}
+	return nil
+}
+
+// GetPeerStats implements Store.
+func (s *LocalStore) GetPeerStats(peerIDs []core.PeerID) (map[core.PeerID]*PeerStats, error) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	result := make(map[core.PeerID]*PeerStats)
+	for _, id := range peerIDs {
+		if e, ok := s.peerStats[id]; ok {
+			stats := e.stats
+			result[id] = &stats
+		}
+	}
+	return result, nil
+}
+
+// GetSwarmStats implements Store.
+func (s *LocalStore) GetSwarmStats(h core.InfoHash) (*SwarmStats, error) {
+	s.mu.RLock()
+	g, ok := s.peerGroups[h]
+	s.mu.RUnlock()
+
+	stats := &SwarmStats{}
+	if !ok {
+		return stats, nil
+	}
+
+	now := s.clk.Now()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	for _, e := range g.peerList {
+		if now.Before(e.expiresAt) {
+			stats.add(e.complete)
+		}
+	}
+	return stats, nil
+}
+
+// Export implements Store.
+func (s *LocalStore) Export() (*Snapshot, error) {
+	s.mu.RLock()
+	groups := make(map[core.InfoHash]*peerGroup, len(s.peerGroups))
+	for h, g := range s.peerGroups {
+		groups[h] = g
+	}
+	s.mu.RUnlock()
+
+	now := s.clk.Now()
+	snapshot := &Snapshot{}
+	for h, g := range groups {
+		swarm := SwarmSnapshot{InfoHash: h.Hex()}
+		g.mu.RLock()
+		for _, e := range g.peerList {
+			if !now.Before(e.expiresAt) {
+				continue
+			}
+			swarm.Peers = append(swarm.Peers, newPeerSnapshot(e.peerInfo(), e.expiresAt.Sub(now)))
+		}
+		g.mu.RUnlock()
+		if len(swarm.Peers) > 0 {
+			snapshot.Swarms = append(snapshot.Swarms, swarm)
+		}
+	}
+	return snapshot, nil
+}
+
+// Import implements Store.
+func (s *LocalStore) Import(snapshot *Snapshot) error {
+	hashes, peers, err := snapshot.parse()
+	if err != nil {
+		return err
+	}
+	now := s.clk.Now()
+	for i, h := range hashes {
+		g := s.getOrInitLockedPeerGroup(h)
+		for j, p := range peers[i] {
+			ttl := snapshot.Swarms[i].Peers[j].TTL
+			if ttl <= 0 {
+				continue
+			}
+			if ttl > s.config.TTL {
+				ttl = s.config.TTL
+			}
+			e, ok := g.peerMap[p.PeerID]
+			if !ok {
+				e = &peerEntry{}
+				g.peerList = append(g.peerList, e)
+				g.peerMap[p.PeerID] = e
+			} else if e.expiresAt.After(now.Add(ttl)) {
+				// Keep fresher announces received since the export.
+				continue
+			}
+			e.id = p.PeerID
+			e.ip = p.IP
+			e.port = p.Port
+			e.addrs = p.Addrs
+			e.complete = p.Complete
+			e.expiresAt = now.Add(ttl)
+			if e.expiresAt.After(g.lastExpiresAt) {
+				g.lastExpiresAt = e.expiresAt
+			}
+		}
+		g.mu.Unlock()
+	}
+	return nil
+}
+
 func (s *LocalStore) getOrInitLockedPeerGroup(h core.InfoHash) *peerGroup {
 	// We must take care to handle a race condition against
 	// cleanupExpiredPeerGroups. Consider two goroutines, A and B, where A
@@ -179,6 +321,7 @@ func (s *LocalStore) cleanupTask() {
 		select {
 		case <-s.cleanupExpiredPeerEntriesTicker.C:
 			s.cleanupExpiredPeerEntries()
+			s.cleanupExpiredPeerStats()
 		case <-s.cleanupExpiredPeerGroupsTicker.C:
 			s.cleanupExpiredPeerGroups()
 		case <-s.stop:
@@ -266,3 +409,14 @@ func (s *LocalStore) cleanupExpiredPeerGroups() {
 		g.mu.Unlock()
 	}
 }
+
+func (s *LocalStore) cleanupExpiredPeerStats() {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	for id, e := range s.peerStats {
+		if s.clk.Now().After(e.expiresAt) {
+			delete(s.peerStats, id)
+		}
+	}
+}
@@ -111,6 +111,42 @@ func TestLocalStoreExpiration(t *testing.T) {
 	require.NotContains(t, s.peerGroups, h1)
 }
 
+func TestLocalStoreGetSwarmStats(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	s := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+
+	stats, err := s.GetSwarmStats(h)
+	require.NoError(err)
+	require.Equal(&SwarmStats{}, stats)
+
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	require.NoError(s.UpdatePeer(h, seeder))
+
+	clk.Add(5 * time.Minute)
+
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+	require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+
+	stats, err = s.GetSwarmStats(h)
+	require.NoError(err)
+	require.Equal(&SwarmStats{Seeders: 1, Leechers: 2}, stats)
+
+	// Expired peers are not counted, even before they are cleaned up.
+	clk.Add(6 * time.Minute)
+
+	stats, err = s.GetSwarmStats(h)
+	require.NoError(err)
+	require.Equal(&SwarmStats{Seeders: 0, Leechers: 2}, stats)
+}
+
 func TestLocalStoreConcurrency(t *testing.T) {
 	s := NewLocalStore(LocalConfig{TTL: time.Millisecond}, clock.New())
 	defer s.Close()
@@ -143,3 +179,126 @@ func TestLocalStoreConcurrency(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestLocalStorePeerStats(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	s := NewLocalStore(LocalConfig{PeerStatsTTL: time.Hour}, clk)
+	defer s.Close()
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	require.NoError(s.UpdatePeerStats([]*PeerStats{
+		{PeerID: p1, Handouts: 1},
+		{PeerID: p1, BytesSeeded: 100},
+		{PeerID: p2, Failures: 1},
+	}))
+	require.NoError(s.UpdatePeerStats([]*PeerStats{{PeerID: p1, Handouts: 1}}))
+
+	result, err := s.GetPeerStats([]core.PeerID{p1, p2, core.PeerIDFixture()})
+	require.NoError(err)
+	require.Equal(map[core.PeerID]*PeerStats{
+		p1: {PeerID: p1, Handouts: 2, BytesSeeded: 100},
+		p2: {PeerID: p2, Failures: 1},
+	}, result)
+
+	clk.Add(30 * time.Minute)
+	require.NoError(s.UpdatePeerStats([]*PeerStats{{PeerID: p1, Handouts: 1}}))
+	clk.Add(45 * time.Minute)
+	s.cleanupExpiredPeerStats()
+
+	result, err = s.GetPeerStats([]core.PeerID{p1, p2})
+	require.NoError(err)
+	require.Equal(map[core.PeerID]*PeerStats{
+		p1: {PeerID: p1, Handouts: 3, BytesSeeded: 100},
+	}, result)
+}
+
+func TestLocalStoreExportImportPreservesTTL(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	src := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer src.Close()
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	p2.Complete = true
+
+	require.NoError(src.UpdatePeer(h, p1))
+	clk.Add(5 * time.Minute)
+	require.NoError(src.UpdatePeer(h, p2))
+
+	snapshot, err := src.Export()
+	require.NoError(err)
+	require.Len(snapshot.Swarms, 1)
+
+	dst := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer dst.Close()
+	require.NoError(dst.Import(snapshot))
+
+	peers, err := dst.GetPeers(h, 2)
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, peers)
+
+	// p1 had 5 minutes left when exported.
+	clk.Add(5*time.Minute + 1)
+	dst.cleanupExpiredPeerEntries()
+
+	peers, err = dst.GetPeers(h, 2)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p2}, peers)
+}
+
+func TestLocalStoreExportImportPreservesAddrs(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	src := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer src.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	p.Addrs = []string{"[fd00::1]:8000"}
+
+	require.NoError(src.UpdatePeer(h, p))
+
+	peers, err := src.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+
+	snapshot, err := src.Export()
+	require.NoError(err)
+
+	dst := NewLocalStore(LocalConfig{TTL: 10 * time.Minute}, clk)
+	defer dst.Close()
+	require.NoError(dst.Import(snapshot))
+
+	peers, err = dst.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestLocalStoreImportMalformedSnapshotImportsNothing(t *testing.T) {
+	require := require.New(t)
+
+	s := NewLocalStore(LocalConfig{}, clock.NewMock())
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	snapshot := &Snapshot{Swarms: []SwarmSnapshot{{
+		InfoHash: h.Hex(),
+		Peers:    []PeerSnapshot{newPeerSnapshot(p, time.Minute)},
+	}, {
+		InfoHash: "bad",
+	}}}
+	require.Error(s.Import(snapshot))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Empty(peers)
+}
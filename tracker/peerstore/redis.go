@@ -14,10 +14,10 @@
 package peerstore
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/log"
@@ -31,24 +31,43 @@ func peerSetKey(h core.InfoHash, window int64) string {
 	return fmt.Sprintf("peerset:%s:%d", h.String(), window)
 }
 
+func peerStatsKey(peerID core.PeerID) string {
+	return fmt.Sprintf("peerstats:%s", peerID.String())
+}
+
 func serializePeer(p *core.PeerInfo) string {
 	var completeBit int
 	if p.Complete {
 		completeBit = 1
 	}
-	return fmt.Sprintf("%s:%s:%d:%d", p.PeerID.String(), p.IP, p.Port, completeBit)
+	s := fmt.Sprintf("%s:%s:%d:%d", p.PeerID.String(), p.IP, p.Port, completeBit)
+	if len(p.Addrs) > 0 {
+		// Addresses contain colons, hence they must come last.
+		s += ":" + strings.Join(p.Addrs, ",")
+	}
+	return s
 }
 
 type peerIdentity struct {
 	peerID core.PeerID
 	ip     string
 	port   int
+	addrs  string // Comma separated.
+}
+
+func (id peerIdentity) peerInfo(complete bool) *core.PeerInfo {
+	p := core.NewPeerInfo(id.peerID, id.ip, id.port, false /* origin */, complete)
+	if id.addrs != "" {
+		p.Addrs = strings.Split(id.addrs, ",")
+	}
+	return p
 }
 
 func deserializePeer(s string) (id peerIdentity, complete bool, err error) {
-	parts := strings.Split(s, ":")
-	if len(parts) != 4 {
-		return id, false, fmt.Errorf("invalid peer encoding: expected 'pid:ip:port:complete'")
+	parts := strings.SplitN(s, ":", 5)
+	if len(parts) < 4 {
+		return id, false, fmt.Errorf(
+			"invalid peer encoding: expected 'pid:ip:port:complete[:addrs]'")
 	}
 	peerID, err := core.NewPeerID(parts[0])
 	if err != nil {
@@ -59,7 +78,10 @@ func deserializePeer(s string) (id peerIdentity, complete bool, err error) {
 	if err != nil {
 		return id, false, fmt.Errorf("parse port: %s", err)
 	}
-	id = peerIdentity{peerID, ip, port}
+	id = peerIdentity{peerID: peerID, ip: ip, port: port}
+	if len(parts) == 5 {
+		id.addrs = parts[4]
+	}
 	complete = parts[3] == "1"
 	return id, complete, nil
 }
@@ -67,7 +89,7 @@ func deserializePeer(s string) (id peerIdentity, complete bool, err error) {
 // RedisStore is a Store backed by Redis.
 type RedisStore struct {
 	config RedisConfig
-	pool   *redis.Pool
+	nodes  redisNodes
 	clk    clock.Clock
 }
 
@@ -75,42 +97,130 @@ type RedisStore struct {
 func NewRedisStore(config RedisConfig, clk clock.Clock) (*RedisStore, error) {
 	config.applyDefaults()
 
-	if config.Addr == "" {
-		return nil, errors.New("invalid config: missing addr")
+	nodes, err := newRedisNodes(config, clk)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
 	}
-
 	s := &RedisStore{
 		config: config,
-		pool: &redis.Pool{
-			Dial: func() (redis.Conn, error) {
-				// TODO Add options
-				return redis.Dial(
-					"tcp",
-					config.Addr,
-					redis.DialConnectTimeout(config.DialTimeout),
-					redis.DialReadTimeout(config.ReadTimeout),
-					redis.DialWriteTimeout(config.WriteTimeout))
-			},
-			MaxIdle:     config.MaxIdleConns,
-			MaxActive:   config.MaxActiveConns,
-			IdleTimeout: config.IdleConnTimeout,
-			Wait:        true,
-		},
-		clk: clk,
+		nodes:  nodes,
+		clk:    clk,
 	}
 
 	// Ensure we can connect to Redis.
-	c, err := s.pool.Dial()
+	masters, err := nodes.masters()
 	if err != nil {
-		return nil, fmt.Errorf("dial redis: %s", err)
+		return nil, fmt.Errorf("masters: %s", err)
+	}
+	for _, node := range masters {
+		c := nodes.conn(node)
+		_, err := c.Do("PING")
+		c.Close()
+		if err != nil {
+			nodes.close()
+			return nil, fmt.Errorf("dial redis: %s", err)
+		}
 	}
-	c.Close()
 
 	return s, nil
 }
 
 // Close implements Store.
-func (s *RedisStore) Close() {}
+func (s *RedisStore) Close() {
+	s.nodes.close()
+}
+
+// redisCmd is a Redis command whose first argument is its key.
+type redisCmd struct {
+	name string
+	args []interface{}
+}
+
+func newRedisCmd(name, key string, args ...interface{}) redisCmd {
+	return redisCmd{name, append([]interface{}{key}, args...)}
+}
+
+func (c redisCmd) key() string {
+	return c.args[0].(string)
+}
+
+type redisReply struct {
+	value interface{}
+	err   error
+}
+
+// pipeline runs cmds on the nodes serving their keys, pipelining the commands
+// sent to each node. Commands which are redirected to another node are retried
+// there once. If readOnly, cmds may run on replicas.
+func (s *RedisStore) pipeline(readOnly bool, cmds []redisCmd) ([]redisReply, error) {
+	var nodes []string
+	groups := make(map[string][]int)
+	for i, cmd := range cmds {
+		node, err := s.nodes.node(cmd.key(), readOnly)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := groups[node]; !ok {
+			nodes = append(nodes, node)
+		}
+		groups[node] = append(groups[node], i)
+	}
+	replies := make([]redisReply, len(cmds))
+	for _, node := range nodes {
+		if err := s.send(node, cmds, groups[node], replies); err != nil {
+			return nil, err
+		}
+	}
+	for i, r := range replies {
+		if node, ask, ok := s.nodes.redirect(r.err); ok {
+			replies[i] = s.retry(node, ask, cmds[i])
+		}
+	}
+	return replies, nil
+}
+
+// send pipelines the commands of cmds at indexes idx to node, and stores their
+// replies at the same indexes of replies.
+func (s *RedisStore) send(node string, cmds []redisCmd, idx []int, replies []redisReply) error {
+	c := s.nodes.conn(node)
+	defer c.Close()
+
+	for _, i := range idx {
+		if err := c.Send(cmds[i].name, cmds[i].args...); err != nil {
+			return fmt.Errorf("send %s: %s", cmds[i].name, err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return fmt.Errorf("flush: %s", err)
+	}
+	for _, i := range idx {
+		v, err := c.Receive()
+		replies[i] = redisReply{v, err}
+	}
+	return nil
+}
+
+func (s *RedisStore) retry(node string, ask bool, cmd redisCmd) redisReply {
+	c := s.nodes.conn(node)
+	defer c.Close()
+
+	if ask {
+		if err := c.Send("ASKING"); err != nil {
+			return redisReply{err: fmt.Errorf("send ASKING: %s", err)}
+		}
+	}
+	v, err := c.Do(cmd.name, cmd.args...)
+	return redisReply{v, err}
+}
+
+// do runs a single command on the node serving its key.
+func (s *RedisStore) do(readOnly bool, cmd redisCmd) (interface{}, error) {
+	replies, err := s.pipeline(readOnly, []redisCmd{cmd})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0].value, replies[0].err
+}
 
 func (s *RedisStore) curPeerSetWindow() int64 {
 	t := s.clk.Now().Unix()
@@ -128,28 +238,23 @@ func (s *RedisStore) peerSetWindows() []int64 {
 
 // UpdatePeer writes p to Redis with a TTL.
 func (s *RedisStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
-	c := s.pool.Get()
-	defer c.Close()
-
 	w := s.curPeerSetWindow()
 	expireAt := w + int64(s.config.PeerSetWindowSize.Seconds())*int64(s.config.MaxPeerSetWindows)
 
 	// Add p to the current window.
 	k := peerSetKey(h, w)
 
-	if err := c.Send("SADD", k, serializePeer(p)); err != nil {
-		return fmt.Errorf("send SADD: %s", err)
-	}
-	if err := c.Send("EXPIREAT", k, expireAt); err != nil {
-		return fmt.Errorf("send EXPIREAT: %s", err)
-	}
-	if err := c.Flush(); err != nil {
-		return fmt.Errorf("flush: %s", err)
+	replies, err := s.pipeline(false, []redisCmd{
+		newRedisCmd("SADD", k, serializePeer(p)),
+		newRedisCmd("EXPIREAT", k, expireAt),
+	})
+	if err != nil {
+		return err
 	}
-	if _, err := c.Receive(); err != nil {
+	if err := replies[0].err; err != nil {
 		return fmt.Errorf("SADD: %s", err)
 	}
-	if _, err := c.Receive(); err != nil {
+	if err := replies[1].err; err != nil {
 		return fmt.Errorf("EXPIREAT: %s", err)
 	}
 	return nil
@@ -157,9 +262,6 @@ func (s *RedisStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 
 // GetPeers returns at most n PeerInfos associated with h.
 func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
-	c := s.pool.Get()
-	defer c.Close()
-
 	// Try to sample n peers from each window in randomized order until we have
 	// collected n distinct peers. This achieves random sampling across multiple
 	// windows.
@@ -174,7 +276,7 @@ func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 
 	for i := 0; len(selected) < n && i < len(windows); i++ {
 		k := peerSetKey(h, windows[i])
-		result, err := redis.Strings(c.Do("SRANDMEMBER", k, n-len(selected)))
+		result, err := redis.Strings(s.do(true, newRedisCmd("SRANDMEMBER", k, n-len(selected))))
 		if err == redis.ErrNil {
 			continue
 		} else if err != nil {
@@ -192,8 +294,264 @@ func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 
 	var peers []*core.PeerInfo
 	for id, complete := range selected {
-		p := core.NewPeerInfo(id.peerID, id.ip, id.port, false, complete)
-		peers = append(peers, p)
+		peers = append(peers, id.peerInfo(complete))
 	}
 	return peers, nil
 }
+
+// UpdatePeerStats increments the stats of each peer in deltas and refreshes
+// their TTL.
+func (s *RedisStore) UpdatePeerStats(deltas []*PeerStats) error {
+	var cmds []redisCmd
+	for _, d := range deltas {
+		k := peerStatsKey(d.PeerID)
+		for field, v := range map[string]int64{
+			"handouts":     d.Handouts,
+			"bytes_seeded": d.BytesSeeded,
+			"failures":     d.Failures,
+		} {
+			if v == 0 {
+				continue
+			}
+			cmds = append(cmds, newRedisCmd("HINCRBY", k, field, v))
+		}
+		cmds = append(cmds, newRedisCmd("EXPIRE", k, int64(s.config.PeerStatsTTL.Seconds())))
+	}
+	replies, err := s.pipeline(false, cmds)
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		if r.err != nil {
+			return fmt.Errorf("update peer stats: %s", r.err)
+		}
+	}
+	return nil
+}
+
+// GetPeerStats returns the stats of each of peerIDs which has any.
+func (s *RedisStore) GetPeerStats(peerIDs []core.PeerID) (map[core.PeerID]*PeerStats, error) {
+	cmds := make([]redisCmd, len(peerIDs))
+	for i, id := range peerIDs {
+		cmds[i] = newRedisCmd("HGETALL", peerStatsKey(id))
+	}
+	replies, err := s.pipeline(true, cmds)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[core.PeerID]*PeerStats)
+	for i, id := range peerIDs {
+		fields, err := redis.Int64Map(replies[i].value, replies[i].err)
+		if err != nil {
+			return nil, fmt.Errorf("HGETALL: %s", err)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		result[id] = &PeerStats{
+			PeerID:      id,
+			Handouts:    fields["handouts"],
+			BytesSeeded: fields["bytes_seeded"],
+			Failures:    fields["failures"],
+		}
+	}
+	return result, nil
+}
+
+// GetSwarmStats counts the distinct peers across all windows of h. A peer is
+// counted as a seeder if any of its windows marks it complete.
+func (s *RedisStore) GetSwarmStats(h core.InfoHash) (*SwarmStats, error) {
+	windows := s.peerSetWindows()
+	cmds := make([]redisCmd, len(windows))
+	for i, w := range windows {
+		cmds[i] = newRedisCmd("SMEMBERS", peerSetKey(h, w))
+	}
+	replies, err := s.pipeline(true, cmds)
+	if err != nil {
+		return nil, err
+	}
+	peers := make(map[peerIdentity]bool)
+	for _, r := range replies {
+		result, err := redis.Strings(r.value, r.err)
+		if err != nil {
+			return nil, fmt.Errorf("SMEMBERS: %s", err)
+		}
+		for _, s := range result {
+			id, complete, err := deserializePeer(s)
+			if err != nil {
+				log.Errorf("Error deserializing peer %q: %s", s, err)
+				continue
+			}
+			peers[id] = peers[id] || complete
+		}
+	}
+	stats := &SwarmStats{}
+	for _, complete := range peers {
+		stats.add(complete)
+	}
+	return stats, nil
+}
+
+// peerSetExpireAt returns the unix time at which the peer set of window w
+// expires.
+func (s *RedisStore) peerSetExpireAt(w int64) int64 {
+	return w + int64(s.config.PeerSetWindowSize.Seconds())*int64(s.config.MaxPeerSetWindows)
+}
+
+// parsePeerSetKey is the inverse of peerSetKey.
+func parsePeerSetKey(k string) (h core.InfoHash, window int64, err error) {
+	parts := strings.Split(k, ":")
+	if len(parts) != 3 || parts[0] != "peerset" {
+		return h, 0, fmt.Errorf("invalid peer set key: expected 'peerset:infohash:window'")
+	}
+	h, err = core.NewInfoHashFromHex(parts[1])
+	if err != nil {
+		return h, 0, fmt.Errorf("parse infohash: %s", err)
+	}
+	window, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return h, 0, fmt.Errorf("parse window: %s", err)
+	}
+	return h, window, nil
+}
+
+// redisPeerState is the state of a peer collapsed across all windows.
+type redisPeerState struct {
+	complete bool
+	expireAt int64
+}
+
+// Export returns a snapshot of all peer sets in Redis. Peers present in
+// multiple windows are collapsed, keeping the latest expiry.
+func (s *RedisStore) Export() (*Snapshot, error) {
+	masters, err := s.nodes.masters()
+	if err != nil {
+		return nil, fmt.Errorf("masters: %s", err)
+	}
+	swarms := make(map[core.InfoHash]map[peerIdentity]*redisPeerState)
+	for _, node := range masters {
+		if err := s.exportNode(node, swarms); err != nil {
+			return nil, err
+		}
+	}
+
+	now := s.clk.Now().Unix()
+	snapshot := &Snapshot{}
+	for h, peers := range swarms {
+		swarm := SwarmSnapshot{InfoHash: h.Hex()}
+		for id, p := range peers {
+			if p.expireAt <= now {
+				continue
+			}
+			info := id.peerInfo(p.complete)
+			ttl := time.Duration(p.expireAt-now) * time.Second
+			swarm.Peers = append(swarm.Peers, newPeerSnapshot(info, ttl))
+		}
+		if len(swarm.Peers) > 0 {
+			snapshot.Swarms = append(snapshot.Swarms, swarm)
+		}
+	}
+	return snapshot, nil
+}
+
+// exportNode adds the peer sets stored on node to swarms.
+func (s *RedisStore) exportNode(
+	node string, swarms map[core.InfoHash]map[peerIdentity]*redisPeerState) error {
+
+	c := s.nodes.conn(node)
+	defer c.Close()
+
+	cursor := 0
+	for {
+		values, err := redis.Values(c.Do("SCAN", cursor, "MATCH", "peerset:*", "COUNT", 1000))
+		if err != nil {
+			return fmt.Errorf("SCAN: %s", err)
+		}
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return fmt.Errorf("scan reply: %s", err)
+		}
+		for _, k := range keys {
+			h, w, err := parsePeerSetKey(k)
+			if err != nil {
+				log.Errorf("Error parsing peer set key %q: %s", k, err)
+				continue
+			}
+			members, err := redis.Strings(c.Do("SMEMBERS", k))
+			if err != nil {
+				return fmt.Errorf("SMEMBERS: %s", err)
+			}
+			peers, ok := swarms[h]
+			if !ok {
+				peers = make(map[peerIdentity]*redisPeerState)
+				swarms[h] = peers
+			}
+			expireAt := s.peerSetExpireAt(w)
+			for _, m := range members {
+				id, complete, err := deserializePeer(m)
+				if err != nil {
+					log.Errorf("Error deserializing peer %q: %s", m, err)
+					continue
+				}
+				p, ok := peers[id]
+				if !ok {
+					p = &redisPeerState{}
+					peers[id] = p
+				}
+				p.complete = p.complete || complete
+				if expireAt > p.expireAt {
+					p.expireAt = expireAt
+				}
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// Import adds the peers of snapshot to Redis. Each peer is added to the
+// window whose expiry is closest to, but not after, the TTL of the peer.
+func (s *RedisStore) Import(snapshot *Snapshot) error {
+	hashes, peers, err := snapshot.parse()
+	if err != nil {
+		return err
+	}
+
+	size := int64(s.config.PeerSetWindowSize.Seconds())
+	cur := s.curPeerSetWindow()
+	oldest := cur - int64(s.config.MaxPeerSetWindows-1)*size
+	now := s.clk.Now().Unix()
+
+	var cmds []redisCmd
+	for i, h := range hashes {
+		for j, p := range peers[i] {
+			ttl := int64(snapshot.Swarms[i].Peers[j].TTL.Seconds())
+			if ttl <= 0 {
+				continue
+			}
+			// Latest window which expires before the peer does.
+			w := now + ttl - size*int64(s.config.MaxPeerSetWindows)
+			w -= w % size
+			if w < oldest {
+				w = oldest
+			} else if w > cur {
+				w = cur
+			}
+			k := peerSetKey(h, w)
+			cmds = append(cmds,
+				newRedisCmd("SADD", k, serializePeer(p)),
+				newRedisCmd("EXPIREAT", k, s.peerSetExpireAt(w)))
+		}
+	}
+	replies, err := s.pipeline(false, cmds)
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		if r.err != nil {
+			return fmt.Errorf("import peers: %s", r.err)
+		}
+	}
+	return nil
+}
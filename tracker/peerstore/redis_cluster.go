@@ -0,0 +1,292 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber/kraken/utils/log"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const _clusterSlots = 16384
+
+// keySlot returns the Redis Cluster hash slot of key. If key contains a
+// non-empty hash tag, i.e. a substring between the first { and the following },
+// only the hash tag is hashed.
+func keySlot(key string) int {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			key = key[i+1 : i+1+j]
+		}
+	}
+	return int(crc16(key) % _clusterSlots)
+}
+
+// crc16 implements CRC-16/XMODEM, which Redis Cluster hashes keys with.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+type clusterSlot struct {
+	master   string
+	replicas []string
+}
+
+// clusterNodes routes commands to the nodes of a Redis Cluster by the hash slot
+// of their key. Nodes are identified by their address.
+type clusterNodes struct {
+	config RedisConfig
+
+	mu         sync.Mutex
+	slots      []clusterSlot
+	replicas   map[string]bool
+	pools      map[string]*redis.Pool
+	refreshing bool
+}
+
+func newClusterNodes(config RedisConfig) (*clusterNodes, error) {
+	n := &clusterNodes{
+		config: config,
+		slots:  make([]clusterSlot, _clusterSlots),
+		pools:  make(map[string]*redis.Pool),
+	}
+	if err := n.refresh(); err != nil {
+		return nil, fmt.Errorf("refresh slots: %s", err)
+	}
+	return n, nil
+}
+
+// refresh reloads the slots served by each node from the first node which
+// replies, trying known masters before the configured addresses.
+func (n *clusterNodes) refresh() error {
+	addrs, _ := n.masters()
+	addrs = append(addrs, n.config.Cluster.Addrs...)
+
+	var errs []error
+	for _, addr := range addrs {
+		slots, err := n.querySlots(addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", addr, err))
+			continue
+		}
+		replicas := make(map[string]bool)
+		for _, s := range slots {
+			for _, r := range s.replicas {
+				replicas[r] = true
+			}
+		}
+		n.mu.Lock()
+		n.slots = slots
+		n.replicas = replicas
+		n.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("all nodes failed: %v", errs)
+}
+
+// refreshAsync refreshes the slots in the background, unless a refresh is
+// already running.
+func (n *clusterNodes) refreshAsync() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.refreshing {
+		return
+	}
+	n.refreshing = true
+	go func() {
+		if err := n.refresh(); err != nil {
+			log.Errorf("Error refreshing redis cluster slots: %s", err)
+		}
+		n.mu.Lock()
+		n.refreshing = false
+		n.mu.Unlock()
+	}()
+}
+
+func (n *clusterNodes) querySlots(addr string) ([]clusterSlot, error) {
+	c, err := dialRedis(n.config, addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %s", err)
+	}
+	defer c.Close()
+
+	ranges, err := redis.Values(c.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, fmt.Errorf("CLUSTER SLOTS: %s", err)
+	}
+	slots := make([]clusterSlot, _clusterSlots)
+	for _, r := range ranges {
+		fields, err := redis.Values(r, nil)
+		if err != nil {
+			return nil, fmt.Errorf("parse slot range: %s", err)
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("slot range has no master")
+		}
+		start, err := redis.Int(fields[0], nil)
+		if err != nil {
+			return nil, fmt.Errorf("parse start slot: %s", err)
+		}
+		end, err := redis.Int(fields[1], nil)
+		if err != nil {
+			return nil, fmt.Errorf("parse end slot: %s", err)
+		}
+		if start < 0 || start > end || end >= _clusterSlots {
+			return nil, fmt.Errorf("invalid slot range %d-%d", start, end)
+		}
+		var nodes []string
+		for _, f := range fields[2:] {
+			node, err := redis.Values(f, nil)
+			if err != nil || len(node) < 2 {
+				return nil, fmt.Errorf("invalid node of slot range %d-%d", start, end)
+			}
+			host, err := redis.String(node[0], nil)
+			if err != nil {
+				return nil, fmt.Errorf("parse host: %s", err)
+			}
+			port, err := redis.Int(node[1], nil)
+			if err != nil {
+				return nil, fmt.Errorf("parse port: %s", err)
+			}
+			if host == "" {
+				// Nodes which do not know their own IP report an empty host.
+				host, _, _ = net.SplitHostPort(addr)
+			}
+			nodes = append(nodes, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+		for i := start; i <= end; i++ {
+			slots[i] = clusterSlot{master: nodes[0], replicas: nodes[1:]}
+		}
+	}
+	return slots, nil
+}
+
+func (n *clusterNodes) node(key string, readOnly bool) (string, error) {
+	slot := keySlot(key)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := n.slots[slot]
+	if s.master == "" {
+		return "", fmt.Errorf("slot %d is not served by any node", slot)
+	}
+	if readOnly && n.config.ReadFromReplicas && len(s.replicas) > 0 {
+		return s.replicas[rand.Intn(len(s.replicas))], nil
+	}
+	return s.master, nil
+}
+
+func (n *clusterNodes) conn(node string) redis.Conn {
+	n.mu.Lock()
+	p, ok := n.pools[node]
+	if !ok {
+		p = newRedisPool(n.config, func() (redis.Conn, error) {
+			return n.dial(node)
+		})
+		n.pools[node] = p
+	}
+	n.mu.Unlock()
+
+	return p.Get()
+}
+
+// dial connects to addr, enabling reads if addr is a replica.
+func (n *clusterNodes) dial(addr string) (redis.Conn, error) {
+	c, err := dialRedis(n.config, addr)
+	if err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	replica := n.replicas[addr]
+	n.mu.Unlock()
+	if replica {
+		if _, err := c.Do("READONLY"); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("READONLY: %s", err)
+		}
+	}
+	return c, nil
+}
+
+func (n *clusterNodes) masters() ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var masters []string
+	for _, s := range n.slots {
+		if s.master != "" && !seen[s.master] {
+			seen[s.master] = true
+			masters = append(masters, s.master)
+		}
+	}
+	sort.Strings(masters)
+	return masters, nil
+}
+
+// redirect handles MOVED and ASK errors. MOVED means the slot has migrated to
+// another node, hence the slots are refreshed.
+func (n *clusterNodes) redirect(err error) (string, bool, bool) {
+	rerr, ok := err.(redis.Error)
+	if !ok {
+		return "", false, false
+	}
+	parts := strings.Fields(string(rerr))
+	if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+		return "", false, false
+	}
+	slot, err := strconv.Atoi(parts[1])
+	if err != nil || slot < 0 || slot >= _clusterSlots {
+		return "", false, false
+	}
+	addr := parts[2]
+	if parts[0] == "ASK" {
+		return addr, true, true
+	}
+	n.mu.Lock()
+	n.slots[slot] = clusterSlot{master: addr}
+	n.mu.Unlock()
+	n.refreshAsync()
+	return addr, false, true
+}
+
+func (n *clusterNodes) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, p := range n.pools {
+		p.Close()
+	}
+}
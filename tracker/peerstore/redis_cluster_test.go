@@ -0,0 +1,190 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/alicebob/miniredis"
+	"github.com/alicebob/miniredis/server"
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+type slotRangeFixture struct {
+	start, end int
+	master     string
+}
+
+// startFakeRedis starts a Redis server which only supports cmds.
+func startFakeRedis(cmds map[string]server.Cmd) *server.Server {
+	s, err := server.NewServer("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	for name, cmd := range cmds {
+		if err := s.Register(name, cmd); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// clusterSlotsCmd replies to CLUSTER SLOTS with ranges.
+func clusterSlotsCmd(ranges ...slotRangeFixture) server.Cmd {
+	return func(c *server.Peer, cmd string, args []string) {
+		c.WriteLen(len(ranges))
+		for _, r := range ranges {
+			host, port, err := net.SplitHostPort(r.master)
+			if err != nil {
+				panic(err)
+			}
+			p, _ := strconv.Atoi(port)
+			c.WriteLen(3)
+			c.WriteInt(r.start)
+			c.WriteInt(r.end)
+			c.WriteLen(2)
+			c.WriteBulk(host)
+			c.WriteInt(p)
+		}
+	}
+}
+
+func clusterConfigFixture(seeds ...string) RedisConfig {
+	return RedisConfig{
+		Mode:              RedisCluster,
+		Cluster:           RedisClusterConfig{Addrs: seeds},
+		PeerSetWindowSize: 30 * time.Second,
+		MaxPeerSetWindows: 4,
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(uint16(0x31C3), crc16("123456789"))
+	require.Equal(12182, keySlot("foo"))
+	require.Equal(5061, keySlot("bar"))
+	require.Equal(keySlot("user1000"), keySlot("{user1000}.following"))
+	require.Equal(keySlot("bar"), keySlot("foo{bar}{zap}"))
+	require.Equal(crc16("foo{}{bar}")%_clusterSlots, uint16(keySlot("foo{}{bar}")))
+}
+
+func TestRedisClusterStoreRoutesKeysBySlot(t *testing.T) {
+	require := require.New(t)
+
+	a, err := miniredis.Run()
+	require.NoError(err)
+	defer a.Close()
+	b, err := miniredis.Run()
+	require.NoError(err)
+	defer b.Close()
+
+	seed := startFakeRedis(map[string]server.Cmd{
+		"CLUSTER": clusterSlotsCmd(
+			slotRangeFixture{0, 8191, a.Addr()},
+			slotRangeFixture{8192, 16383, b.Addr()}),
+	})
+	defer seed.Close()
+
+	s, err := NewRedisStore(clusterConfigFixture(seed.Addr().String()), clock.New())
+	require.NoError(err)
+	defer s.Close()
+
+	var hashes []core.InfoHash
+	var ids []core.PeerID
+	for i := 0; i < 20; i++ {
+		h := core.InfoHashFixture()
+		p := core.PeerInfoFixture()
+		require.NoError(s.UpdatePeer(h, p))
+
+		peers, err := s.GetPeers(h, 1)
+		require.NoError(err)
+		require.Equal([]*core.PeerInfo{p}, peers)
+
+		require.NoError(s.UpdatePeerStats([]*PeerStats{{PeerID: p.PeerID, Handouts: 1}}))
+
+		hashes = append(hashes, h)
+		ids = append(ids, p.PeerID)
+	}
+
+	require.NotEmpty(a.Keys())
+	for _, k := range a.Keys() {
+		require.True(keySlot(k) <= 8191, k)
+	}
+	require.NotEmpty(b.Keys())
+	for _, k := range b.Keys() {
+		require.True(keySlot(k) >= 8192, k)
+	}
+
+	stats, err := s.GetPeerStats(ids)
+	require.NoError(err)
+	require.Len(stats, len(ids))
+
+	snapshot, err := s.Export()
+	require.NoError(err)
+	require.Len(snapshot.Swarms, len(hashes))
+}
+
+func TestRedisClusterStoreFollowsMovedRedirects(t *testing.T) {
+	require := require.New(t)
+
+	a, err := miniredis.Run()
+	require.NoError(err)
+	defer a.Close()
+
+	// stale claims all slots, but redirects every command to a.
+	moved := func(c *server.Peer, cmd string, args []string) {
+		c.WriteError(fmt.Sprintf("MOVED %d %s", keySlot(args[0]), a.Addr()))
+	}
+	stale := startFakeRedis(map[string]server.Cmd{
+		"PING":        func(c *server.Peer, cmd string, args []string) { c.WriteInline("PONG") },
+		"SADD":        moved,
+		"EXPIREAT":    moved,
+		"SRANDMEMBER": moved,
+	})
+	defer stale.Close()
+
+	seed := startFakeRedis(map[string]server.Cmd{
+		"CLUSTER": clusterSlotsCmd(slotRangeFixture{0, 16383, stale.Addr().String()}),
+	})
+	defer seed.Close()
+
+	s, err := NewRedisStore(clusterConfigFixture(seed.Addr().String()), clock.New())
+	require.NoError(err)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+	require.NotEmpty(a.Keys())
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestRedisClusterStoreFailsWithoutReachableNodes(t *testing.T) {
+	seed := startFakeRedis(nil)
+	seed.Close()
+
+	_, err := NewRedisStore(clusterConfigFixture(seed.Addr().String()), clock.New())
+	require.Error(t, err)
+}
@@ -0,0 +1,300 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/garyburd/redigo/redis"
+)
+
+// redisNodes routes commands to the Redis nodes serving their keys. Nodes are
+// identified by opaque names, which are only meaningful to the redisNodes which
+// returned them.
+type redisNodes interface {
+	// node returns the node serving key. If readOnly, the node may be a
+	// replica.
+	node(key string, readOnly bool) (string, error)
+
+	// conn returns a connection to node.
+	conn(node string) redis.Conn
+
+	// masters returns every master node, e.g. to scan all keys.
+	masters() ([]string, error)
+
+	// redirect returns the node which a command must be retried on if err
+	// redirects it to another node, and whether the retry must be preceded by
+	// ASKING.
+	redirect(err error) (node string, ask bool, ok bool)
+
+	close()
+}
+
+func newRedisNodes(config RedisConfig, clk clock.Clock) (redisNodes, error) {
+	switch config.Mode {
+	case RedisStandalone:
+		if config.Addr == "" {
+			return nil, errors.New("missing addr")
+		}
+		if config.ReadFromReplicas {
+			return nil, errors.New("read_from_replicas requires sentinel or cluster mode")
+		}
+		return newStandaloneNodes(config), nil
+	case RedisSentinel:
+		if config.Sentinel.MasterName == "" {
+			return nil, errors.New("missing sentinel master_name")
+		}
+		if len(config.Sentinel.Addrs) == 0 {
+			return nil, errors.New("missing sentinel addrs")
+		}
+		return newSentinelNodes(config, clk), nil
+	case RedisCluster:
+		if len(config.Cluster.Addrs) == 0 {
+			return nil, errors.New("missing cluster addrs")
+		}
+		return newClusterNodes(config)
+	default:
+		return nil, fmt.Errorf("unknown mode %q", config.Mode)
+	}
+}
+
+func dialRedis(config RedisConfig, addr string) (redis.Conn, error) {
+	return redis.Dial(
+		"tcp",
+		addr,
+		redis.DialConnectTimeout(config.DialTimeout),
+		redis.DialReadTimeout(config.ReadTimeout),
+		redis.DialWriteTimeout(config.WriteTimeout))
+}
+
+func newRedisPool(config RedisConfig, dial func() (redis.Conn, error)) *redis.Pool {
+	return &redis.Pool{
+		Dial:        dial,
+		MaxIdle:     config.MaxIdleConns,
+		MaxActive:   config.MaxActiveConns,
+		IdleTimeout: config.IdleConnTimeout,
+		Wait:        true,
+	}
+}
+
+// standaloneNodes is a single Redis server.
+type standaloneNodes struct {
+	addr string
+	pool *redis.Pool
+}
+
+func newStandaloneNodes(config RedisConfig) *standaloneNodes {
+	return &standaloneNodes{
+		addr: config.Addr,
+		pool: newRedisPool(config, func() (redis.Conn, error) {
+			return dialRedis(config, config.Addr)
+		}),
+	}
+}
+
+func (n *standaloneNodes) node(key string, readOnly bool) (string, error) { return n.addr, nil }
+
+func (n *standaloneNodes) conn(node string) redis.Conn { return n.pool.Get() }
+
+func (n *standaloneNodes) masters() ([]string, error) { return []string{n.addr}, nil }
+
+func (n *standaloneNodes) redirect(err error) (string, bool, bool) { return "", false, false }
+
+func (n *standaloneNodes) close() { n.pool.Close() }
+
+// Nodes of a Sentinel-managed deployment.
+const (
+	_sentinelMaster  = "master"
+	_sentinelReplica = "replica"
+)
+
+// sentinelConn is a connection to the Redis server at addr.
+type sentinelConn struct {
+	redis.Conn
+	addr string
+}
+
+// sentinelNodes is a master and its replicas, which are discovered through
+// Sentinel on every dial such that new connections follow failovers.
+type sentinelNodes struct {
+	config   RedisConfig
+	clk      clock.Clock
+	master   *redis.Pool
+	replicas *redis.Pool
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	curMaster string
+}
+
+func newSentinelNodes(config RedisConfig, clk clock.Clock) *sentinelNodes {
+	n := &sentinelNodes{config: config, clk: clk}
+	n.master = newRedisPool(config, n.dialMaster)
+	n.master.TestOnBorrow = n.testMaster
+	n.replicas = newRedisPool(config, n.dialReplica)
+	return n
+}
+
+func (n *sentinelNodes) node(key string, readOnly bool) (string, error) {
+	if readOnly && n.config.ReadFromReplicas {
+		return _sentinelReplica, nil
+	}
+	return _sentinelMaster, nil
+}
+
+func (n *sentinelNodes) conn(node string) redis.Conn {
+	if node == _sentinelReplica {
+		return n.replicas.Get()
+	}
+	return n.master.Get()
+}
+
+func (n *sentinelNodes) masters() ([]string, error) { return []string{_sentinelMaster}, nil }
+
+func (n *sentinelNodes) redirect(err error) (string, bool, bool) { return "", false, false }
+
+func (n *sentinelNodes) close() {
+	n.master.Close()
+	n.replicas.Close()
+}
+
+// querySentinels runs a SENTINEL command against each sentinel until one
+// replies.
+func (n *sentinelNodes) querySentinels(args ...interface{}) (interface{}, error) {
+	var errs []error
+	for _, addr := range n.config.Sentinel.Addrs {
+		c, err := dialRedis(n.config, addr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dial sentinel %s: %s", addr, err))
+			continue
+		}
+		reply, err := c.Do("SENTINEL", args...)
+		c.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sentinel %s: %s", addr, err))
+			continue
+		}
+		return reply, nil
+	}
+	return nil, fmt.Errorf("all sentinels failed: %v", errs)
+}
+
+func (n *sentinelNodes) resolveMaster() (string, error) {
+	hostport, err := redis.Strings(n.querySentinels("get-master-addr-by-name", n.config.Sentinel.MasterName))
+	if err == redis.ErrNil {
+		return "", fmt.Errorf("unknown master %s", n.config.Sentinel.MasterName)
+	} else if err != nil {
+		return "", err
+	}
+	if len(hostport) != 2 {
+		return "", fmt.Errorf("invalid master address %v", hostport)
+	}
+	addr := net.JoinHostPort(hostport[0], hostport[1])
+
+	n.mu.Lock()
+	n.curMaster = addr
+	n.lastCheck = n.clk.Now()
+	n.mu.Unlock()
+
+	return addr, nil
+}
+
+// resolveReplicas returns the addresses of the replicas which the sentinels
+// consider healthy.
+func (n *sentinelNodes) resolveReplicas() ([]string, error) {
+	replies, err := redis.Values(n.querySentinels("slaves", n.config.Sentinel.MasterName))
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, r := range replies {
+		fields, err := redis.StringMap(r, nil)
+		if err != nil {
+			return nil, fmt.Errorf("parse replica: %s", err)
+		}
+		if !replicaHealthy(fields["flags"]) {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(fields["ip"], fields["port"]))
+	}
+	return addrs, nil
+}
+
+func replicaHealthy(flags string) bool {
+	for _, f := range strings.Split(flags, ",") {
+		switch f {
+		case "s_down", "o_down", "disconnected":
+			return false
+		}
+	}
+	return true
+}
+
+func (n *sentinelNodes) dialMaster() (redis.Conn, error) {
+	addr, err := n.resolveMaster()
+	if err != nil {
+		return nil, fmt.Errorf("resolve master: %s", err)
+	}
+	c, err := dialRedis(n.config, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &sentinelConn{c, addr}, nil
+}
+
+// dialReplica dials a random healthy replica, or the master if there are none.
+func (n *sentinelNodes) dialReplica() (redis.Conn, error) {
+	addrs, err := n.resolveReplicas()
+	if err != nil {
+		return nil, fmt.Errorf("resolve replicas: %s", err)
+	}
+	if len(addrs) == 0 {
+		return n.dialMaster()
+	}
+	addr := addrs[rand.Intn(len(addrs))]
+	c, err := dialRedis(n.config, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &sentinelConn{c, addr}, nil
+}
+
+// testMaster rejects pooled connections to a server which is no longer the
+// master. The master is resolved at most once per CheckInterval.
+func (n *sentinelNodes) testMaster(c redis.Conn, t time.Time) error {
+	n.mu.Lock()
+	stale := n.clk.Now().Sub(n.lastCheck) >= n.config.Sentinel.CheckInterval
+	master := n.curMaster
+	n.mu.Unlock()
+
+	if stale {
+		addr, err := n.resolveMaster()
+		if err != nil {
+			// Keep using the connection while the sentinels are unavailable.
+			return nil
+		}
+		master = addr
+	}
+	if sc, ok := c.(*sentinelConn); ok && sc.addr != master {
+		return fmt.Errorf("%s is no longer the master", sc.addr)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+
+	"github.com/alicebob/miniredis"
+	"github.com/alicebob/miniredis/server"
+	"github.com/andres-erbsen/clock"
+	"github.com/stretchr/testify/require"
+)
+
+type replicaFixture struct {
+	addr  string
+	flags string
+}
+
+// fakeSentinel is a sentinel monitoring a single master named "mymaster".
+type fakeSentinel struct {
+	*server.Server
+
+	mu       sync.Mutex
+	master   string
+	replicas []replicaFixture
+}
+
+func startFakeSentinel(master string, replicas ...replicaFixture) *fakeSentinel {
+	f := &fakeSentinel{master: master, replicas: replicas}
+	f.Server = startFakeRedis(map[string]server.Cmd{"SENTINEL": f.sentinel})
+	return f
+}
+
+func (f *fakeSentinel) failover(master string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.master = master
+}
+
+func (f *fakeSentinel) sentinel(c *server.Peer, cmd string, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(args) != 2 || args[1] != "mymaster" {
+		c.WriteNull()
+		return
+	}
+	switch args[0] {
+	case "get-master-addr-by-name":
+		host, port, _ := net.SplitHostPort(f.master)
+		c.WriteLen(2)
+		c.WriteBulk(host)
+		c.WriteBulk(port)
+	case "slaves":
+		c.WriteLen(len(f.replicas))
+		for _, r := range f.replicas {
+			host, port, _ := net.SplitHostPort(r.addr)
+			c.WriteLen(6)
+			for _, s := range []string{"ip", host, "port", port, "flags", r.flags} {
+				c.WriteBulk(s)
+			}
+		}
+	default:
+		c.WriteError("ERR unknown subcommand")
+	}
+}
+
+func sentinelConfigFixture(sentinel string) RedisConfig {
+	return RedisConfig{
+		Mode: RedisSentinel,
+		Sentinel: RedisSentinelConfig{
+			MasterName: "mymaster",
+			Addrs:      []string{"127.0.0.1:1", sentinel}, // First sentinel is down.
+		},
+		PeerSetWindowSize: 30 * time.Second,
+		MaxPeerSetWindows: 4,
+	}
+}
+
+// replicate copies all sets of src to dst.
+func replicate(src, dst *miniredis.Miniredis) {
+	for _, k := range src.Keys() {
+		members, err := src.Members(k)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := dst.SetAdd(k, members...); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func TestRedisSentinelStoreFollowsFailover(t *testing.T) {
+	require := require.New(t)
+
+	m1, err := miniredis.Run()
+	require.NoError(err)
+	defer m1.Close()
+	m2, err := miniredis.Run()
+	require.NoError(err)
+	defer m2.Close()
+
+	sentinel := startFakeSentinel(m1.Addr())
+	defer sentinel.Close()
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	config := sentinelConfigFixture(sentinel.Addr().String())
+	config.Sentinel.CheckInterval = time.Minute
+
+	s, err := NewRedisStore(config, clk)
+	require.NoError(err)
+	defer s.Close()
+
+	h1 := core.InfoHashFixture()
+	require.NoError(s.UpdatePeer(h1, core.PeerInfoFixture()))
+	require.NotEmpty(m1.Keys())
+
+	sentinel.failover(m2.Addr())
+	clk.Add(time.Minute)
+
+	h2 := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h2, p))
+	require.Len(m1.Keys(), 1)
+	require.Len(m2.Keys(), 1)
+
+	peers, err := s.GetPeers(h2, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestRedisSentinelStoreReadsFromReplicas(t *testing.T) {
+	require := require.New(t)
+
+	master, err := miniredis.Run()
+	require.NoError(err)
+	defer master.Close()
+	replica, err := miniredis.Run()
+	require.NoError(err)
+	defer replica.Close()
+
+	sentinel := startFakeSentinel(master.Addr(), replicaFixture{replica.Addr(), "slave"})
+	defer sentinel.Close()
+
+	config := sentinelConfigFixture(sentinel.Addr().String())
+	config.ReadFromReplicas = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+	require.Empty(replica.Keys())
+
+	// Writes have not been replicated yet.
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Empty(peers)
+
+	replicate(master, replica)
+
+	peers, err = s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestRedisSentinelStoreSkipsUnhealthyReplicas(t *testing.T) {
+	require := require.New(t)
+
+	master, err := miniredis.Run()
+	require.NoError(err)
+	defer master.Close()
+	replica, err := miniredis.Run()
+	require.NoError(err)
+	defer replica.Close()
+
+	sentinel := startFakeSentinel(master.Addr(), replicaFixture{replica.Addr(), "slave,s_down"})
+	defer sentinel.Close()
+
+	config := sentinelConfigFixture(sentinel.Addr().String())
+	config.ReadFromReplicas = true
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+	defer s.Close()
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, p))
+
+	// Reads fall back to the master.
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
+
+func TestNewRedisStoreInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config RedisConfig
+	}{
+		{"unknown mode", RedisConfig{Mode: "ring", Addr: "localhost:6379"}},
+		{"standalone without addr", RedisConfig{}},
+		{"standalone read from replicas", RedisConfig{Addr: "localhost:6379", ReadFromReplicas: true}},
+		{"sentinel without master name", RedisConfig{
+			Mode: RedisSentinel, Sentinel: RedisSentinelConfig{Addrs: []string{"localhost:26379"}}}},
+		{"sentinel without addrs", RedisConfig{
+			Mode: RedisSentinel, Sentinel: RedisSentinelConfig{MasterName: "mymaster"}}},
+		{"cluster without addrs", RedisConfig{Mode: RedisCluster}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := NewRedisStore(test.config, clock.New())
+			require.Error(t, err)
+		})
+	}
+}
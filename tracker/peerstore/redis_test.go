@@ -56,6 +56,26 @@ func TestRedisStoreGetPeersPopulatesPeerInfoFields(t *testing.T) {
 	require.Equal(peers, []*core.PeerInfo{p})
 }
 
+func TestRedisStoreGetPeersPreservesAddrs(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	p.Addrs = []string{"[fd00::1]:8000", "192.168.0.1:8000"}
+
+	require.NoError(s.UpdatePeer(h, p))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal(peers, []*core.PeerInfo{p})
+}
+
 func TestRedisStoreGetPeersFromMultipleWindows(t *testing.T) {
 	require := require.New(t)
 
@@ -154,6 +174,42 @@ func TestRedisStoreGetPeersCollapsesCompleteBits(t *testing.T) {
 	require.True(peers[0].Complete)
 }
 
+func TestRedisStoreGetSwarmStatsAcrossWindows(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.PeerSetWindowSize = 10 * time.Second
+	config.MaxPeerSetWindows = 3
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	s, err := NewRedisStore(config, clk)
+	require.NoError(err)
+
+	clk.Set(time.Unix(s.curPeerSetWindow(), 0))
+
+	h := core.InfoHashFixture()
+
+	seeder := core.PeerInfoFixture()
+	leecher := core.PeerInfoFixture()
+	require.NoError(s.UpdatePeer(h, seeder))
+	require.NoError(s.UpdatePeer(h, leecher))
+
+	// The seeder completes in the next window, and should only be counted once.
+	clk.Add(config.PeerSetWindowSize)
+	seeder.Complete = true
+	require.NoError(s.UpdatePeer(h, seeder))
+
+	stats, err := s.GetSwarmStats(h)
+	require.NoError(err)
+	require.Equal(&SwarmStats{Seeders: 1, Leechers: 1}, stats)
+
+	stats, err = s.GetSwarmStats(core.InfoHashFixture())
+	require.NoError(err)
+	require.Equal(&SwarmStats{}, stats)
+}
+
 func TestRedisStorePeerExpiration(t *testing.T) {
 	require := require.New(t)
 
@@ -179,3 +235,90 @@ func TestRedisStorePeerExpiration(t *testing.T) {
 	require.NoError(err)
 	require.Empty(result)
 }
+
+func TestRedisStorePeerStats(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewRedisStore(redisConfigFixture(), clock.New())
+	require.NoError(err)
+
+	p1 := core.PeerIDFixture()
+	p2 := core.PeerIDFixture()
+
+	require.NoError(s.UpdatePeerStats([]*PeerStats{
+		{PeerID: p1, Handouts: 1},
+		{PeerID: p1, BytesSeeded: 100},
+		{PeerID: p2, Failures: 1},
+	}))
+	require.NoError(s.UpdatePeerStats([]*PeerStats{{PeerID: p1, Handouts: 1}}))
+
+	result, err := s.GetPeerStats([]core.PeerID{p1, p2, core.PeerIDFixture()})
+	require.NoError(err)
+	require.Equal(map[core.PeerID]*PeerStats{
+		p1: {PeerID: p1, Handouts: 2, BytesSeeded: 100},
+		p2: {PeerID: p2, Failures: 1},
+	}, result)
+}
+
+func TestRedisStoreExportImportToLocalStore(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	src, err := NewRedisStore(config, clk)
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+
+	require.NoError(src.UpdatePeer(h, p1))
+	clk.Add(config.PeerSetWindowSize)
+	p1.Complete = true
+	require.NoError(src.UpdatePeer(h, p1))
+	require.NoError(src.UpdatePeer(h, p2))
+
+	snapshot, err := src.Export()
+	require.NoError(err)
+	require.Len(snapshot.Swarms, 1)
+	require.Len(snapshot.Swarms[0].Peers, 2)
+	for _, p := range snapshot.Swarms[0].Peers {
+		require.True(p.TTL > 0)
+		require.True(p.TTL <= config.PeerSetWindowSize*time.Duration(config.MaxPeerSetWindows))
+	}
+
+	dst := NewLocalStore(LocalConfig{}, clk)
+	defer dst.Close()
+	require.NoError(dst.Import(snapshot))
+
+	peers, err := dst.GetPeers(h, 2)
+	require.NoError(err)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, peers)
+}
+
+func TestRedisStoreImport(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	clk := clock.NewMock()
+	clk.Set(time.Now())
+
+	s, err := NewRedisStore(config, clk)
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+	p := core.PeerInfoFixture()
+
+	require.NoError(s.Import(&Snapshot{Swarms: []SwarmSnapshot{{
+		InfoHash: h.Hex(),
+		Peers:    []PeerSnapshot{newPeerSnapshot(p, time.Minute)},
+	}}}))
+
+	peers, err := s.GetPeers(h, 1)
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{p}, peers)
+}
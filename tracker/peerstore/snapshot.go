@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber/kraken/core"
+)
+
+// Snapshot is a point-in-time copy of all swarms in a Store, used to migrate
+// swarms between stores without forcing every peer to re-announce.
+type Snapshot struct {
+	Swarms []SwarmSnapshot `json:"swarms"`
+}
+
+// SwarmSnapshot is a snapshot of the peers announcing for a torrent.
+type SwarmSnapshot struct {
+	InfoHash string         `json:"infohash"`
+	Peers    []PeerSnapshot `json:"peers"`
+}
+
+// PeerSnapshot is a snapshot of a single peer. TTL is the time remaining
+// until the peer expires when the snapshot was taken, such that snapshots are
+// independent of the clocks of the exporting and importing trackers.
+type PeerSnapshot struct {
+	PeerID   string        `json:"peer_id"`
+	IP       string        `json:"ip"`
+	Port     int           `json:"port"`
+	Addrs    []string      `json:"addrs,omitempty"`
+	Complete bool          `json:"complete"`
+	TTL      time.Duration `json:"ttl"`
+}
+
+func newPeerSnapshot(p *core.PeerInfo, ttl time.Duration) PeerSnapshot {
+	return PeerSnapshot{
+		PeerID:   p.PeerID.String(),
+		IP:       p.IP,
+		Port:     p.Port,
+		Addrs:    p.Addrs,
+		Complete: p.Complete,
+		TTL:      ttl,
+	}
+}
+
+// parse returns the info hash and peers of each swarm in s.
+func (s *Snapshot) parse() ([]core.InfoHash, [][]*core.PeerInfo, error) {
+	hashes := make([]core.InfoHash, len(s.Swarms))
+	peers := make([][]*core.PeerInfo, len(s.Swarms))
+	for i, swarm := range s.Swarms {
+		var err error
+		hashes[i], peers[i], err = swarm.parse()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return hashes, peers, nil
+}
+
+// parse returns the info hash and peers of s.
+func (s SwarmSnapshot) parse() (core.InfoHash, []*core.PeerInfo, error) {
+	h, err := core.NewInfoHashFromHex(s.InfoHash)
+	if err != nil {
+		return core.InfoHash{}, nil, fmt.Errorf("parse infohash %q: %s", s.InfoHash, err)
+	}
+	peers := make([]*core.PeerInfo, len(s.Peers))
+	for i, p := range s.Peers {
+		id, err := core.NewPeerID(p.PeerID)
+		if err != nil {
+			return core.InfoHash{}, nil, fmt.Errorf("parse peer id %q: %s", p.PeerID, err)
+		}
+		peers[i] = core.NewPeerInfo(id, p.IP, p.Port, false /* origin */, p.Complete)
+		peers[i].Addrs = p.Addrs
+	}
+	return h, peers, nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import "github.com/uber/kraken/core"
+
+// PeerStats records the historical contribution of a peer across all torrents.
+// All counts are accumulated from the peer's handouts and the feedback of the
+// peers it was handed out to.
+type PeerStats struct {
+	PeerID core.PeerID `json:"peer_id"`
+
+	// Handouts is the number of times the peer was handed out to other peers.
+	Handouts int64 `json:"handouts"`
+
+	// BytesSeeded is the number of verified bytes other peers received from the
+	// peer.
+	BytesSeeded int64 `json:"bytes_seeded"`
+
+	// Failures is the number of times other peers failed to connect to the
+	// peer.
+	Failures int64 `json:"failures"`
+}
+
+// FailureRate returns the ratio of failed connections to handouts.
+func (s *PeerStats) FailureRate() float64 {
+	if s.Handouts == 0 {
+		return 0
+	}
+	return float64(s.Failures) / float64(s.Handouts)
+}
+
+func (s *PeerStats) add(delta *PeerStats) {
+	s.Handouts += delta.Handouts
+	s.BytesSeeded += delta.BytesSeeded
+	s.Failures += delta.Failures
+}
+
+// SwarmStats counts the peers announcing for a torrent.
+type SwarmStats struct {
+	// Seeders is the number of peers which have completed the torrent.
+	Seeders int `json:"seeders"`
+
+	// Leechers is the number of peers still downloading the torrent.
+	Leechers int `json:"leechers"`
+}
+
+func (s *SwarmStats) add(complete bool) {
+	if complete {
+		s.Seeders++
+	} else {
+		s.Leechers++
+	}
+}
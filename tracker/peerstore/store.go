@@ -31,6 +31,26 @@ type Store interface {
 
 	// UpdatePeer updates peer fields.
 	UpdatePeer(h core.InfoHash, peer *core.PeerInfo) error
+
+	// UpdatePeerStats adds the counts in each of deltas to the stats of its
+	// peer.
+	UpdatePeerStats(deltas []*PeerStats) error
+
+	// GetPeerStats returns the stats of each of peerIDs. Peers without stats
+	// are omitted.
+	GetPeerStats(peerIDs []core.PeerID) (map[core.PeerID]*PeerStats, error)
+
+	// GetSwarmStats returns the number of unexpired seeders and leechers
+	// announcing for h.
+	GetSwarmStats(h core.InfoHash) (*SwarmStats, error)
+
+	// Export returns a snapshot of all unexpired peers in the store.
+	Export() (*Snapshot, error)
+
+	// Import adds the peers of snapshot to the store. Each peer expires after
+	// its snapshot TTL, bounded by the TTL of the store. Nothing is imported
+	// if snapshot is malformed.
+	Import(snapshot *Snapshot) error
 }
 
 // New creates a new Store implementation based on config.
@@ -23,12 +23,14 @@ import (
 type testStore struct {
 	sync.Mutex
 	torrents map[core.InfoHash][]core.PeerInfo
+	stats    map[core.PeerID]PeerStats
 }
 
 // TestStore returns a thread-safe, in-memory peer store for testing purposes.
 func NewTestStore() Store {
 	return &testStore{
 		torrents: make(map[core.InfoHash][]core.PeerInfo),
+		stats:    make(map[core.PeerID]PeerStats),
 	}
 }
 
@@ -68,3 +70,71 @@ func (s *testStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
 	}
 	return copies, nil
 }
+
+func (s *testStore) UpdatePeerStats(deltas []*PeerStats) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, d := range deltas {
+		stats := s.stats[d.PeerID]
+		stats.PeerID = d.PeerID
+		stats.add(d)
+		s.stats[d.PeerID] = stats
+	}
+	return nil
+}
+
+func (s *testStore) GetPeerStats(peerIDs []core.PeerID) (map[core.PeerID]*PeerStats, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	result := make(map[core.PeerID]*PeerStats)
+	for _, id := range peerIDs {
+		if stats, ok := s.stats[id]; ok {
+			result[id] = &stats
+		}
+	}
+	return result, nil
+}
+
+func (s *testStore) GetSwarmStats(h core.InfoHash) (*SwarmStats, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	stats := &SwarmStats{}
+	for _, p := range s.torrents[h] {
+		stats.add(p.Complete)
+	}
+	return stats, nil
+}
+
+func (s *testStore) Export() (*Snapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	snapshot := &Snapshot{}
+	for h, peers := range s.torrents {
+		swarm := SwarmSnapshot{InfoHash: h.Hex()}
+		for i := range peers {
+			// Peers never expire in testStore.
+			swarm.Peers = append(swarm.Peers, newPeerSnapshot(&peers[i], 0))
+		}
+		snapshot.Swarms = append(snapshot.Swarms, swarm)
+	}
+	return snapshot, nil
+}
+
+func (s *testStore) Import(snapshot *Snapshot) error {
+	hashes, peers, err := snapshot.parse()
+	if err != nil {
+		return err
+	}
+	for i, h := range hashes {
+		for _, p := range peers[i] {
+			if err := s.UpdatePeer(h, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
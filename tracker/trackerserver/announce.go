@@ -17,9 +17,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcehook"
+	"github.com/uber/kraken/tracker/peerstore"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
@@ -35,7 +38,7 @@ func (s *Server) announceHandlerV1(w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return handler.Errorf("get request digest: %s", err)
 	}
-	resp, err := s.announce(d, req.InfoHash, req.Peer)
+	resp, err := s.announce(req.Namespace, d, req.InfoHash, req.Peer, req.Exclude, req.Feedback, req.DownloadTime)
 	if err != nil {
 		return err
 	}
@@ -62,7 +65,7 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return handler.Errorf("get request digest: %s", err)
 	}
-	resp, err := s.announce(d, h, req.Peer)
+	resp, err := s.announce(req.Namespace, d, h, req.Peer, req.Exclude, req.Feedback, req.DownloadTime)
 	if err != nil {
 		return err
 	}
@@ -73,43 +76,220 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 }
 
 func (s *Server) announce(
-	d core.Digest, h core.InfoHash, peer *core.PeerInfo) (*announceclient.Response, error) {
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	exclude []core.PeerID,
+	feedback []announceclient.PeerFeedback,
+	downloadTime time.Duration) (*announceclient.Response, error) {
 
 	if err := s.peerStore.UpdatePeer(h, peer); err != nil {
 		log.With(
 			"hash", h,
 			"peer_id", peer.PeerID).Errorf("Error updating peer: %s", err)
 	}
-	peers, err := s.getPeerHandout(d, h, peer)
+	s.hooks.Notify(announcehook.Event{
+		Namespace: namespace,
+		Digest:    d,
+		InfoHash:  h,
+		Peer:      peer,
+		Time:      time.Now(),
+	})
+	if peer.Complete && downloadTime > 0 {
+		s.policy.RecordDownload(peer.PeerID, downloadTime)
+	}
+	if s.policy.UsesReputation() && len(feedback) > 0 {
+		s.recordFeedback(feedback)
+	}
+	peers, err := s.getPeerHandout(namespace, d, h, peer, exclude)
 	if err != nil {
 		return nil, err
 	}
+	if s.policy.UsesReputation() {
+		s.recordHandouts(peers)
+	}
+	config := s.getConfig()
 	return &announceclient.Response{
-		Peers:    peers,
-		Interval: s.config.AnnounceInterval,
+		Peers:           peers,
+		Interval:        config.AnnounceInterval,
+		TorrentInterval: s.getTorrentInterval(config.AdaptiveInterval, h, peer),
 	}, nil
 }
 
+// getTorrentInterval suggests how long peer should wait before announcing h
+// again. Seeders do not need handouts and can wait the longest, while leechers
+// wait longer as the ratio of seeders to leechers grows. Returns zero, i.e. no
+// suggestion, if disabled or the swarm is unknown.
+func (s *Server) getTorrentInterval(
+	config AdaptiveIntervalConfig, h core.InfoHash, peer *core.PeerInfo) time.Duration {
+
+	if !config.Enabled {
+		return 0
+	}
+	if peer.Complete {
+		return config.MaxInterval
+	}
+	stats, err := s.peerStore.GetSwarmStats(h)
+	if err != nil {
+		log.With("hash", h).Errorf("Error getting swarm stats: %s", err)
+		return 0
+	}
+	leechers := stats.Leechers
+	if leechers == 0 {
+		// The announcing peer is a leecher.
+		leechers = 1
+	}
+	r := float64(stats.Seeders) / float64(leechers) / config.SaturatedRatio
+	if r > 1 {
+		r = 1
+	}
+	return config.MinInterval + time.Duration(r*float64(config.MaxInterval-config.MinInterval))
+}
+
 func (s *Server) getPeerHandout(
-	d core.Digest, h core.InfoHash, peer *core.PeerInfo) ([]*core.PeerInfo, error) {
+	namespace string,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	exclude []core.PeerID) ([]*core.PeerInfo, error) {
 
 	if peer.Complete {
 		// If the peer is announcing as complete, don't return a peer handout since
 		// the peer does not need it.
 		return nil, nil
 	}
+	if s.hooks.Quarantined(peer.PeerID) {
+		s.stats.Counter("quarantined_announces").Inc(1)
+		return nil, nil
+	}
+	config := s.getConfig()
+	if len(exclude) > config.MaxExcludedPeers {
+		exclude = exclude[:config.MaxExcludedPeers]
+	}
+	excluded := make(map[core.PeerID]bool, len(exclude))
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+
 	var errs []error
-	peers, err := s.peerStore.GetPeers(h, s.config.PeerHandoutLimit)
+	// Over-fetch so that excluded peers do not eat into the handout limit.
+	peers, err := s.peerStore.GetPeers(h, config.PeerHandoutLimit+len(excluded))
 	if err != nil {
 		errs = append(errs, fmt.Errorf("peer store: %s", err))
 	}
-	origins, err := s.originStore.GetOrigins(d)
-	if err != nil {
-		errs = append(errs, fmt.Errorf("origin store: %s", err))
+	var origins []*core.PeerInfo
+	// Origins never have blobs of agent-only namespaces.
+	if !s.isAgentOnly(namespace) {
+		origins, err = s.originStore.GetOrigins(d)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("origin store: %s", err))
+		}
 	}
-	peers = append(peers, origins...)
-	if len(peers) == 0 {
+	peers = s.removeQuarantined(peers)
+	if len(peers) == 0 && len(origins) == 0 {
 		return nil, handler.Errorf("no peers available: %s", errutil.Join(errs))
 	}
-	return s.policy.SortPeers(peer, peers), nil
+	peers = filterPeers(peers, excluded, config.PeerHandoutLimit)
+	peers = append(peers, filterPeers(origins, excluded, len(origins))...)
+
+	var peerStats map[core.PeerID]*peerstore.PeerStats
+	if s.policy.UsesReputation() {
+		ids := make([]core.PeerID, 0, len(peers))
+		for _, p := range peers {
+			if !p.Origin {
+				ids = append(ids, p.PeerID)
+			}
+		}
+		peerStats, err = s.peerStore.GetPeerStats(ids)
+		if err != nil {
+			log.With("hash", h).Errorf("Error getting peer stats: %s", err)
+		}
+	}
+	return s.policy.SortPeers(peer, peers, peerStats), nil
+}
+
+// recordFeedback adds the feedback of an announcing peer to the stats of the
+// remote peers it describes.
+func (s *Server) recordFeedback(feedback []announceclient.PeerFeedback) {
+	deltas := make([]*peerstore.PeerStats, 0, len(feedback))
+	for _, f := range feedback {
+		delta := &peerstore.PeerStats{PeerID: f.PeerID, BytesSeeded: f.BytesReceived}
+		if f.Failed {
+			delta.Failures = 1
+		}
+		deltas = append(deltas, delta)
+	}
+	if err := s.peerStore.UpdatePeerStats(deltas); err != nil {
+		log.Errorf("Error recording peer feedback: %s", err)
+	}
+}
+
+// recordHandouts counts a handout for each non-origin peer in peers.
+func (s *Server) recordHandouts(peers []*core.PeerInfo) {
+	deltas := make([]*peerstore.PeerStats, 0, len(peers))
+	for _, p := range peers {
+		if !p.Origin {
+			deltas = append(deltas, &peerstore.PeerStats{PeerID: p.PeerID, Handouts: 1})
+		}
+	}
+	if len(deltas) == 0 {
+		return
+	}
+	if err := s.peerStore.UpdatePeerStats(deltas); err != nil {
+		log.Errorf("Error recording peer handouts: %s", err)
+	}
+}
+
+// getPeerStatsHandler returns the historical stats of a peer.
+func (s *Server) getPeerStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	param, err := httputil.ParseParam(r, "peerid")
+	if err != nil {
+		return err
+	}
+	peerID, err := core.NewPeerID(param)
+	if err != nil {
+		return handler.Errorf("parse peer id: %s", err).Status(http.StatusBadRequest)
+	}
+	result, err := s.peerStore.GetPeerStats([]core.PeerID{peerID})
+	if err != nil {
+		return handler.Errorf("get peer stats: %s", err)
+	}
+	stats, ok := result[peerID]
+	if !ok {
+		return handler.ErrorStatus(http.StatusNotFound)
+	}
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// removeQuarantined returns the peers which announce hooks have not
+// quarantined. Origins cannot be quarantined.
+func (s *Server) removeQuarantined(peers []*core.PeerInfo) []*core.PeerInfo {
+	result := make([]*core.PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		if !p.Origin && s.hooks.Quarantined(p.PeerID) {
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// filterPeers returns up to limit peers which are not excluded.
+func filterPeers(
+	peers []*core.PeerInfo, excluded map[core.PeerID]bool, limit int) []*core.PeerInfo {
+
+	result := make([]*core.PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		if len(result) == limit {
+			break
+		}
+		if !excluded[p.PeerID] {
+			result = append(result, p)
+		}
+	}
+	return result
 }
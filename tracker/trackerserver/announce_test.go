@@ -14,9 +14,11 @@
 package trackerserver
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,10 +26,15 @@ import (
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/announcehook"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func newAnnounceClient(pctx core.PeerContext, addr string) announceclient.Client {
@@ -101,15 +108,65 @@ func TestAnnounceSinglePeerResponse(t *testing.T) {
 			mocks.peerStore.EXPECT().UpdatePeer(
 				blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
 
-			result, interval, err := client.Announce(
-				blob.Digest, blob.MetaInfo.InfoHash(), false, version)
+			resp, err := client.Announce(announceclient.AnnounceRequest{
+				Namespace: _testNamespace,
+				Digest:    blob.Digest,
+				InfoHash:  blob.MetaInfo.InfoHash(),
+				Version:   version,
+			})
 			require.NoError(err)
-			require.Equal(peers, result)
-			require.Equal(config.AnnounceInterval, interval)
+			require.Equal(peers, resp.Peers)
+			require.Equal(config.AnnounceInterval, resp.Interval)
+			require.Equal(time.Duration(0), resp.TorrentInterval)
 		})
 	}
 }
 
+func TestAnnounceIntervalReload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AnnounceInterval: 5 * time.Second})
+	defer cleanup()
+
+	server := mocks.server()
+
+	addr, stop := testutil.StartServer(server.Handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(2)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil).Times(2)
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil).Times(2)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	require.Equal(5*time.Second, resp.Interval)
+
+	server.Reload(Config{AnnounceInterval: 10 * time.Second})
+
+	resp, err = client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	require.Equal(10*time.Second, resp.Interval)
+}
+
 func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 	require := require.New(t)
 
@@ -133,10 +190,14 @@ func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 		blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil, storeErr)
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
 
-	result, _, err := client.Announce(
-		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
 	require.NoError(err)
-	require.Equal(origins, result)
+	require.Equal(origins, resp.Peers)
 }
 
 func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
@@ -161,10 +222,178 @@ func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, errors.New("some error"))
 
-	result, _, err := client.Announce(
-		blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	require.Equal(peers, resp.Peers)
+}
+
+func TestAnnounceExcludesClientSuppliedPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{PeerHandoutLimit: 2}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	known := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+	p1 := core.PeerInfoFixture()
+	p2 := core.PeerInfoFixture()
+	p3 := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	// The handout limit is raised by the number of excluded peers.
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), 4).Return([]*core.PeerInfo{p1, known, p2, p3}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+		Exclude:   []core.PeerID{known.PeerID, origin.PeerID},
+	})
 	require.NoError(err)
-	require.Equal(peers, result)
+	require.ElementsMatch([]*core.PeerInfo{p1, p2}, resp.Peers)
+}
+
+func TestAnnounceAllPeersExcludedReturnsEmptyHandout(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	p := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return([]*core.PeerInfo{p}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+		Exclude:   []core.PeerID{p.PeerID},
+	})
+	require.NoError(err)
+	require.Empty(resp.Peers)
+}
+
+func TestAnnounceRecordsPeerStatsAndSortsByReputation(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	policy, err := peerhandoutpolicy.NewPriorityPolicy(
+		tally.NoopScope, "default",
+		peerhandoutpolicy.WithReputation(peerhandoutpolicy.ReputationConfig{Enabled: true}))
+	require.NoError(err)
+	mocks.policy = policy
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	leech := core.PeerInfoFixture()
+	seeder := core.PeerInfoFixture()
+	failed := core.PeerIDFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().UpdatePeerStats([]*peerstore.PeerStats{
+		{PeerID: seeder.PeerID, BytesSeeded: 1024},
+		{PeerID: failed, Failures: 1},
+	}).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return([]*core.PeerInfo{leech, seeder}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+	mocks.peerStore.EXPECT().GetPeerStats(
+		gomock.InAnyOrder([]core.PeerID{leech.PeerID, seeder.PeerID})).Return(
+		map[core.PeerID]*peerstore.PeerStats{
+			leech.PeerID:  {PeerID: leech.PeerID, Handouts: 100},
+			seeder.PeerID: {PeerID: seeder.PeerID, Handouts: 100, BytesSeeded: 1024},
+		}, nil)
+	mocks.peerStore.EXPECT().UpdatePeerStats([]*peerstore.PeerStats{
+		{PeerID: seeder.PeerID, Handouts: 1},
+		{PeerID: leech.PeerID, Handouts: 1},
+	}).Return(nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+		Feedback: []announceclient.PeerFeedback{
+			{PeerID: seeder.PeerID, BytesReceived: 1024},
+			{PeerID: failed, Failed: true},
+		},
+	})
+	require.NoError(err)
+	require.Equal([]*core.PeerInfo{seeder, leech}, resp.Peers)
+}
+
+func TestGetPeerStatsHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	stats := &peerstore.PeerStats{
+		PeerID:      core.PeerIDFixture(),
+		Handouts:    10,
+		BytesSeeded: 2048,
+		Failures:    1,
+	}
+	mocks.peerStore.EXPECT().GetPeerStats([]core.PeerID{stats.PeerID}).Return(
+		map[core.PeerID]*peerstore.PeerStats{stats.PeerID: stats}, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/peerstats/%s", addr, stats.PeerID))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var result peerstore.PeerStats
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(*stats, result)
+
+	missing := core.PeerIDFixture()
+	mocks.peerStore.EXPECT().GetPeerStats([]core.PeerID{missing}).Return(
+		map[core.PeerID]*peerstore.PeerStats{}, nil)
+
+	_, err = httputil.Get(fmt.Sprintf("http://%s/x/peerstats/%s", addr, missing))
+	require.True(httputil.IsNotFound(err))
 }
 
 func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
@@ -210,3 +439,276 @@ func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestAnnounceCompleteRecordsDownloadTime(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	stats := tally.NewTestScope("", nil)
+	policy, err := peerhandoutpolicy.NewPriorityPolicy(stats, "default")
+	require.NoError(err)
+	mocks.policy = policy
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, true)).Return(nil)
+
+	_, err = client.Announce(announceclient.AnnounceRequest{
+		Namespace:    _testNamespace,
+		Digest:       blob.Digest,
+		InfoHash:     blob.MetaInfo.InfoHash(),
+		Complete:     true,
+		Version:      announceclient.V2,
+		DownloadTime: 3 * time.Second,
+	})
+	require.NoError(err)
+
+	var recorded []time.Duration
+	for _, timer := range stats.Snapshot().Timers() {
+		if timer.Name() == "download_time" {
+			recorded = append(recorded, timer.Values()...)
+		}
+	}
+	require.Equal([]time.Duration{3 * time.Second}, recorded)
+}
+
+func TestAnnounceAdaptiveTorrentInterval(t *testing.T) {
+	config := Config{
+		AdaptiveInterval: AdaptiveIntervalConfig{
+			Enabled:     true,
+			MinInterval: 2 * time.Second,
+			MaxInterval: 22 * time.Second,
+		},
+	}
+	tests := []struct {
+		desc     string
+		stats    *peerstore.SwarmStats
+		expected time.Duration
+	}{
+		{"no seeders", &peerstore.SwarmStats{Seeders: 0, Leechers: 5}, 2 * time.Second},
+		{"few seeders", &peerstore.SwarmStats{Seeders: 1, Leechers: 4}, 7 * time.Second},
+		{"saturated", &peerstore.SwarmStats{Seeders: 10, Leechers: 5}, 22 * time.Second},
+		{"unregistered leecher", &peerstore.SwarmStats{Seeders: 1}, 22 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, config)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			pctx := core.PeerContextFixture()
+			h := blob.MetaInfo.InfoHash()
+
+			client := newAnnounceClient(pctx, addr)
+
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+			mocks.peerStore.EXPECT().GetPeers(h, gomock.Any()).Return(
+				[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+			mocks.peerStore.EXPECT().UpdatePeer(h, core.PeerInfoFromContext(pctx, false)).Return(nil)
+			mocks.peerStore.EXPECT().GetSwarmStats(h).Return(test.stats, nil)
+
+			resp, err := client.Announce(announceclient.AnnounceRequest{
+				Namespace: _testNamespace,
+				Digest:    blob.Digest,
+				InfoHash:  h,
+				Version:   announceclient.V2,
+			})
+			require.NoError(err)
+			require.Equal(test.expected, resp.TorrentInterval)
+		})
+	}
+}
+
+func TestAnnounceAdaptiveTorrentIntervalForSeeders(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{AdaptiveInterval: AdaptiveIntervalConfig{Enabled: true}}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	pctx := core.PeerContextFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, true)).Return(nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Complete:  true,
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	require.Equal(30*time.Second, resp.TorrentInterval)
+}
+
+func TestAnnounceSkipsOriginsForAgentOnlyNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AgentOnlyNamespaces: []string{"^scratch/.*"}})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: "scratch/cache",
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	require.Equal(peers, resp.Peers)
+}
+
+// quarantineHooks records announce events and quarantines a fixed set of
+// peers.
+type quarantineHooks struct {
+	sync.Mutex
+	events      []announcehook.Event
+	quarantined map[core.PeerID]bool
+}
+
+func (h *quarantineHooks) Notify(e announcehook.Event) {
+	h.Lock()
+	defer h.Unlock()
+	h.events = append(h.events, e)
+}
+
+func (h *quarantineHooks) Quarantined(peer core.PeerID) bool { return h.quarantined[peer] }
+
+func TestAnnounceNotifiesHooks(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	hooks := &quarantineHooks{}
+	addr, stop := testutil.StartServer(mocks.server(WithAnnounceHooks(hooks)).Handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, true)).Return(nil)
+
+	_, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Complete:  true,
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+
+	hooks.Lock()
+	defer hooks.Unlock()
+	require.Len(hooks.events, 1)
+	e := hooks.events[0]
+	require.Equal(_testNamespace, e.Namespace)
+	require.Equal(blob.Digest, e.Digest)
+	require.Equal(blob.MetaInfo.InfoHash(), e.InfoHash)
+	require.Equal(pctx.PeerID, e.Peer.PeerID)
+}
+
+func TestAnnounceLeavesQuarantinedPeersOutOfHandout(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	quarantined := core.PeerInfoFixture()
+	p1 := core.PeerInfoFixture()
+	origin := core.OriginPeerInfoFixture()
+
+	hooks := &quarantineHooks{quarantined: map[core.PeerID]bool{
+		quarantined.PeerID: true,
+		origin.PeerID:      true,
+	}}
+	addr, stop := testutil.StartServer(mocks.server(WithAnnounceHooks(hooks)).Handler())
+	defer stop()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		blob.MetaInfo.InfoHash(), gomock.Any()).Return([]*core.PeerInfo{quarantined, p1}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	// Origins cannot be quarantined.
+	require.ElementsMatch([]*core.PeerInfo{p1, origin}, resp.Peers)
+}
+
+func TestAnnounceQuarantinedPeerReceivesNoHandout(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	pctx := core.PeerContextFixture()
+	blob := core.NewBlobFixture()
+
+	hooks := &quarantineHooks{quarantined: map[core.PeerID]bool{pctx.PeerID: true}}
+	addr, stop := testutil.StartServer(mocks.server(WithAnnounceHooks(hooks)).Handler())
+	defer stop()
+
+	client := newAnnounceClient(pctx, addr)
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+
+	resp, err := client.Announce(announceclient.AnnounceRequest{
+		Namespace: _testNamespace,
+		Digest:    blob.Digest,
+		InfoHash:  blob.MetaInfo.InfoHash(),
+		Version:   announceclient.V2,
+	})
+	require.NoError(err)
+	require.Empty(resp.Peers)
+}
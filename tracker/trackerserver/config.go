@@ -16,6 +16,8 @@ package trackerserver
 import (
 	"time"
 
+	"github.com/uber/kraken/lib/middleware"
+	"github.com/uber/kraken/tracker/announceclient"
 	"github.com/uber/kraken/utils/listener"
 )
 
@@ -27,9 +29,30 @@ type Config struct {
 	// Limits the number of peers returned on each announce.
 	PeerHandoutLimit int `yaml:"announce_limit"`
 
+	// Limits the number of client-supplied peers excluded from each handout.
+	// Further exclusions are ignored.
+	MaxExcludedPeers int `yaml:"max_excluded_peers"`
+
 	AnnounceInterval time.Duration `yaml:"announce_interval"`
 
+	// AdaptiveInterval suggests per torrent announce intervals based on the
+	// health of each swarm.
+	AdaptiveInterval AdaptiveIntervalConfig `yaml:"adaptive_interval"`
+
+	// AgentOnlyNamespaces are regular expressions of namespaces whose blobs
+	// are distributed by agents only, e.g. ephemeral build caches which never
+	// need backend durability. Agents publish the metainfo of such blobs to
+	// trackers, which never fetch it from origins nor hand out origins for the
+	// blobs.
+	AgentOnlyNamespaces []string `yaml:"agent_only_namespaces"`
+
+	// Limits the number of digests in each scrape request.
+	ScrapeLimit int `yaml:"scrape_limit"`
+
 	Listener listener.Config `yaml:"listener"`
+
+	// Authz restricts endpoints, e.g. /internal/, to client identities.
+	Authz middleware.AuthzConfig `yaml:"authz"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -39,8 +62,49 @@ func (c Config) applyDefaults() Config {
 	if c.PeerHandoutLimit == 0 {
 		c.PeerHandoutLimit = 50
 	}
+	if c.MaxExcludedPeers == 0 {
+		c.MaxExcludedPeers = 200
+	}
 	if c.AnnounceInterval == 0 {
 		c.AnnounceInterval = 3 * time.Second
 	}
+	if c.ScrapeLimit == 0 {
+		c.ScrapeLimit = announceclient.MaxScrapeDigests
+	}
+	c.AdaptiveInterval = c.AdaptiveInterval.applyDefaults(c.AnnounceInterval)
+	return c
+}
+
+// AdaptiveIntervalConfig defines how torrents back off from announcing as
+// their swarms become healthy.
+type AdaptiveIntervalConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MinInterval is suggested to leechers of swarms without seeders.
+	// Defaults to the announce interval.
+	MinInterval time.Duration `yaml:"min_interval"`
+
+	// MaxInterval is suggested to seeders, and to leechers of saturated
+	// swarms. Agents cap suggestions at the max interval of their announcer.
+	MaxInterval time.Duration `yaml:"max_interval"`
+
+	// SaturatedRatio is the ratio of seeders to leechers at which a swarm is
+	// saturated. Suggested intervals grow linearly with the ratio up to it.
+	SaturatedRatio float64 `yaml:"saturated_ratio"`
+}
+
+func (c AdaptiveIntervalConfig) applyDefaults(announceInterval time.Duration) AdaptiveIntervalConfig {
+	if c.MinInterval == 0 {
+		c.MinInterval = announceInterval
+	}
+	if c.MaxInterval == 0 {
+		c.MaxInterval = 30 * time.Second
+	}
+	if c.MaxInterval < c.MinInterval {
+		c.MaxInterval = c.MinInterval
+	}
+	if c.SaturatedRatio == 0 {
+		c.SaturatedRatio = 1
+	}
 	return c
 }
@@ -31,5 +31,5 @@ func Fixture() *Server {
 	}
 	return New(
 		config, tally.NoopScope, policy,
-		peerstore.NewTestStore(), originstore.NewNoopStore(), nil)
+		peerstore.NewTestStore(), originstore.NewNoopStore(), nil, nil)
 }
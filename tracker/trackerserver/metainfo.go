@@ -15,10 +15,14 @@ package trackerserver
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
 )
 
 func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) error {
@@ -31,8 +35,32 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
 	}
 
+	if s.isAgentOnly(namespace) {
+		// Blobs of agent-only namespaces never reach origins.
+		mi, err := s.publishedMetaInfo.Get(d)
+		if err == originstore.ErrMetaInfoNotPublished {
+			return handler.ErrorStatus(http.StatusNotFound)
+		} else if err != nil {
+			return handler.Errorf("get published metainfo: %s", err)
+		}
+		return writeMetaInfo(w, mi)
+	}
+
+	if r.URL.Query().Get("peek") == "true" {
+		// Origins which fetch blobs from agents only accept metainfo which
+		// needs no origin download, since the download could recurse into the
+		// origin itself.
+		mi, err := s.metaInfoStore.PeekMetaInfo(namespace, d)
+		if err == originstore.ErrMetaInfoUnavailable {
+			return handler.ErrorStatus(http.StatusNotFound)
+		} else if err != nil {
+			return handler.Errorf("peek metainfo: %s", err)
+		}
+		return writeMetaInfo(w, mi)
+	}
+
 	timer := s.stats.Timer("get_metainfo").Start()
-	mi, err := s.originCluster.GetMetaInfo(namespace, d)
+	mi, err := s.metaInfoStore.GetMetaInfo(r.Context(), namespace, d)
 	if err != nil {
 		if serr, ok := err.(httputil.StatusError); ok {
 			// Propagate errors received from origin.
@@ -42,6 +70,46 @@ func (s *Server) getMetaInfoHandler(w http.ResponseWriter, r *http.Request) erro
 	}
 	timer.Stop()
 
+	return writeMetaInfo(w, mi)
+}
+
+// publishMetaInfoHandler stores metainfo generated by the agent which produced
+// its blob. Only accepted for agent-only namespaces, and only from identities
+// allowed by an authz rule covering the endpoint.
+func (s *Server) publishMetaInfoHandler(w http.ResponseWriter, r *http.Request) error {
+	namespace, err := httputil.ParseParam(r, "namespace")
+	if err != nil {
+		return err
+	}
+	d, err := httputil.ParseDigest(r, "digest")
+	if err != nil {
+		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
+	}
+	if !s.isAgentOnly(namespace) {
+		return handler.Errorf(
+			"namespace %s is not agent-only", namespace).Status(http.StatusForbidden)
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return handler.Errorf("read body: %s", err)
+	}
+	mi, err := core.DeserializeMetaInfo(b)
+	if err != nil {
+		return handler.Errorf("deserialize metainfo: %s", err).Status(http.StatusBadRequest)
+	}
+	if mi.Digest() != d {
+		return handler.Errorf(
+			"metainfo digest %s does not match %s", mi.Digest(), d).Status(http.StatusBadRequest)
+	}
+	if err := s.publishedMetaInfo.Put(mi); err != nil {
+		return handler.Errorf("put published metainfo: %s", err)
+	}
+	s.stats.Counter("metainfo_published").Inc(1)
+	log.With("namespace", namespace, "digest", d).Info("Agent published metainfo")
+	return nil
+}
+
+func writeMetaInfo(w http.ResponseWriter, mi *core.MetaInfo) error {
 	b, err := mi.Serialize()
 	if err != nil {
 		return fmt.Errorf("serialize metainfo: %s", err)
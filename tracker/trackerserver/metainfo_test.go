@@ -14,15 +14,21 @@
 package trackerserver
 
 import (
+	"bytes"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/origin/blobclient"
 	"github.com/uber/kraken/tracker/metainfoclient"
+	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/testutil"
 
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
 
@@ -42,7 +48,7 @@ func TestGetMetaInfoHandlerFetchesFromOrigin(t *testing.T) {
 	namespace := core.TagFixture()
 	mi := core.MetaInfoFixture()
 
-	mocks.originCluster.EXPECT().GetMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+	mocks.originCluster.EXPECT().GetMetaInfo(gomock.Any(), namespace, mi.Digest()).Return(mi, nil)
 
 	client := newMetaInfoClient(addr)
 
@@ -51,6 +57,62 @@ func TestGetMetaInfoHandlerFetchesFromOrigin(t *testing.T) {
 	require.Equal(mi, result)
 }
 
+func TestGetMetaInfoHandlerPeek(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	peekClient := metainfoclient.New(
+		hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil, metainfoclient.WithPeek())
+
+	// Origins are never asked to download blobs for peeks.
+	mocks.originCluster.EXPECT().GetLocalMetaInfo(namespace, mi.Digest()).Return(
+		nil, blobclient.ErrBlobNotFound)
+
+	_, err := peekClient.Download(namespace, mi.Digest())
+	require.Equal(metainfoclient.ErrNotFound, err)
+
+	mocks.originCluster.EXPECT().GetLocalMetaInfo(namespace, mi.Digest()).Return(mi, nil)
+
+	result, err := peekClient.Download(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
+func TestGetMetaInfoHandlerPeekServesCachedMetaInfo(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	mocks.metaInfoCache = originstore.MetaInfoCacheConfig{Enabled: true}
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(gomock.Any(), namespace, mi.Digest()).Return(mi, nil)
+
+	_, err := newMetaInfoClient(addr).Download(namespace, mi.Digest())
+	require.NoError(err)
+
+	peekClient := metainfoclient.New(
+		hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil, metainfoclient.WithPeek())
+
+	result, err := peekClient.Download(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
 func TestGetMetaInfoHandlerPropagatesOriginError(t *testing.T) {
 	require := require.New(t)
 
@@ -63,8 +125,7 @@ func TestGetMetaInfoHandlerPropagatesOriginError(t *testing.T) {
 	namespace := core.TagFixture()
 	mi := core.MetaInfoFixture()
 
-	mocks.originCluster.EXPECT().GetMetaInfo(
-		namespace, mi.Digest()).Return(nil, httputil.StatusError{Status: 599}).MinTimes(1)
+	mocks.originCluster.EXPECT().GetMetaInfo(gomock.Any(), namespace, mi.Digest()).Return(nil, httputil.StatusError{Status: 599}).MinTimes(1)
 
 	client := newMetaInfoClient(addr)
 
@@ -72,3 +133,100 @@ func TestGetMetaInfoHandlerPropagatesOriginError(t *testing.T) {
 	require.Error(err)
 	require.True(httputil.IsStatus(err, 599))
 }
+
+func TestPublishMetaInfoForAgentOnlyNamespace(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AgentOnlyNamespaces: []string{"^scratch/.*"}})
+	defer cleanup()
+
+	h, cleanupAuthz := mocks.agentHandler()
+	defer cleanupAuthz()
+
+	addr, stop := testutil.StartServer(h)
+	defer stop()
+
+	namespace := "scratch/cache"
+	mi := core.MetaInfoFixture()
+
+	client := newMetaInfoClient(addr)
+
+	// Metainfo of agent-only namespaces is never fetched from origins.
+	_, err := client.Download(namespace, mi.Digest())
+	require.Equal(metainfoclient.ErrNotFound, err)
+
+	require.NoError(client.Publish(namespace, mi))
+
+	result, err := client.Download(namespace, mi.Digest())
+	require.NoError(err)
+	require.Equal(mi, result)
+}
+
+func TestPublishMetaInfoRejectsOtherNamespaces(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AgentOnlyNamespaces: []string{"^scratch/.*"}})
+	defer cleanup()
+
+	h, cleanupAuthz := mocks.agentHandler()
+	defer cleanupAuthz()
+
+	addr, stop := testutil.StartServer(h)
+	defer stop()
+
+	client := newMetaInfoClient(addr)
+
+	err := client.Publish(core.TagFixture(), core.MetaInfoFixture())
+	require.True(httputil.IsForbidden(err))
+}
+
+func TestPublishMetaInfoRejectsDigestMismatch(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AgentOnlyNamespaces: []string{".*"}})
+	defer cleanup()
+
+	h, cleanupAuthz := mocks.agentHandler()
+	defer cleanupAuthz()
+
+	addr, stop := testutil.StartServer(h)
+	defer stop()
+
+	b, err := core.MetaInfoFixture().Serialize()
+	require.NoError(err)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/namespace/ns/blobs/%s/metainfo", addr, core.DigestFixture()),
+		httputil.SendBody(bytes.NewReader(b)))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestPublishMetaInfoRequiresAuthz(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{AgentOnlyNamespaces: []string{"^scratch/.*"}})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	client := newMetaInfoClient(addr)
+
+	err := client.Publish("scratch/cache", core.MetaInfoFixture())
+	require.True(httputil.IsForbidden(err))
+}
+
+func TestAgentOnlyNamespacesReload(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	server := mocks.server()
+	require.False(server.isAgentOnly("scratch/cache"))
+
+	// Invalid expressions are ignored.
+	server.Reload(Config{AgentOnlyNamespaces: []string{"^scratch/.*", "("}})
+	require.True(server.isAgentOnly("scratch/cache"))
+	require.False(server.isAgentOnly("repo"))
+}
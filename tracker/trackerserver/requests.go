@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi"
+
+	"github.com/uber/kraken/utils/handler"
+)
+
+// requestCounter counts the requests served by a tracker per route since
+// startup, such that clients (e.g. benchmarks) can compute request rates by
+// sampling the counts.
+type requestCounter struct {
+	mu     sync.Mutex
+	routes map[string]int64
+}
+
+func newRequestCounter() *requestCounter {
+	return &requestCounter{routes: make(map[string]int64)}
+}
+
+// middleware counts requests by their route pattern once served.
+func (c *requestCounter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		c.mu.Lock()
+		c.routes[route]++
+		c.mu.Unlock()
+	})
+}
+
+func (c *requestCounter) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make(map[string]int64, len(c.routes))
+	for route, n := range c.routes {
+		result[route] = n
+	}
+	return result
+}
+
+// getRequestStatsHandler returns the number of requests served per route
+// since startup.
+func (s *Server) getRequestStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.requests.snapshot()); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
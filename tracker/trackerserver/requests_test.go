@@ -0,0 +1,54 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestStatsHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	for i := 0; i < 2; i++ {
+		_, err := httputil.Get(fmt.Sprintf("http://%s/health", addr))
+		require.NoError(err)
+	}
+	// Failed requests are counted too.
+	_, err := httputil.Get(fmt.Sprintf("http://%s/x/peerstats/invalid", addr))
+	require.Error(err)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/stats/requests", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var counts map[string]int64
+	require.NoError(json.NewDecoder(resp.Body).Decode(&counts))
+	require.Equal(map[string]int64{
+		"/health":               2,
+		"/x/peerstats/{peerid}": 1,
+	}, counts)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// scrapeHandler returns the number of seeders and leechers of each digest
+// query argument.
+func (s *Server) scrapeHandler(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	namespace := query.Get("namespace")
+	if namespace == "" {
+		return handler.Errorf("namespace required").Status(http.StatusBadRequest)
+	}
+	digests := query["digest"]
+	if len(digests) == 0 {
+		return handler.Errorf("digest required").Status(http.StatusBadRequest)
+	}
+	if limit := s.getConfig().ScrapeLimit; len(digests) > limit {
+		return handler.Errorf(
+			"too many digests: %d exceeds limit of %d", len(digests), limit).Status(http.StatusBadRequest)
+	}
+	ds := make([]core.Digest, len(digests))
+	for i, raw := range digests {
+		d, err := core.ParseDigest(raw)
+		if err != nil {
+			return handler.Errorf("parse digest %q: %s", raw, err).Status(http.StatusBadRequest)
+		}
+		ds[i] = d
+	}
+
+	s.stats.Counter("scraped_digests").Inc(int64(len(ds)))
+
+	resp := announceclient.ScrapeResponse{Swarms: make([]*announceclient.SwarmStats, len(ds))}
+	for i, d := range ds {
+		resp.Swarms[i] = s.scrape(r.Context(), namespace, d)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) scrape(
+	ctx context.Context, namespace string, d core.Digest) *announceclient.SwarmStats {
+
+	result := &announceclient.SwarmStats{Digest: d}
+	mi, err := s.metaInfoStore.GetMetaInfo(ctx, namespace, d)
+	if err != nil {
+		result.Error = "get metainfo: " + err.Error()
+		return result
+	}
+	h := mi.InfoHash()
+	result.InfoHash = h.Hex()
+	stats, err := s.peerStore.GetSwarmStats(h)
+	if err != nil {
+		result.Error = "get swarm stats: " + err.Error()
+		return result
+	}
+	result.Seeders = stats.Seeders
+	result.Leechers = stats.Leechers
+	return result
+}
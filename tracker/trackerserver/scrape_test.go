@@ -0,0 +1,88 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeHandler(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	namespace := core.TagFixture()
+	mi := core.MetaInfoFixture()
+	missing := core.DigestFixture()
+
+	mocks.originCluster.EXPECT().GetMetaInfo(gomock.Any(), namespace, mi.Digest()).Return(mi, nil)
+	mocks.originCluster.EXPECT().GetMetaInfo(gomock.Any(), namespace, missing).Return(nil, httputil.StatusError{Status: http.StatusNotFound}).MinTimes(1)
+	mocks.peerStore.EXPECT().GetSwarmStats(mi.InfoHash()).Return(
+		&peerstore.SwarmStats{Seeders: 3, Leechers: 5}, nil)
+
+	client := announceclient.New(
+		core.PeerContextFixture(), hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil)
+
+	result, err := client.Scrape(namespace, []core.Digest{mi.Digest(), missing})
+	require.NoError(err)
+	require.Len(result, 2)
+	require.Equal(&announceclient.SwarmStats{
+		Digest:   mi.Digest(),
+		InfoHash: mi.InfoHash().Hex(),
+		Seeders:  3,
+		Leechers: 5,
+	}, result[0])
+	require.Equal(missing, result[1].Digest)
+	require.NotEmpty(result[1].Error)
+}
+
+func TestScrapeHandlerBadRequests(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{ScrapeLimit: 1})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	d1 := core.DigestFixture()
+	d2 := core.DigestFixture()
+
+	for _, query := range []string{
+		"digest=" + d1.String(),
+		"namespace=foo",
+		"namespace=foo&digest=invalid",
+		fmt.Sprintf("namespace=foo&digest=%s&digest=%s", d1, d2),
+	} {
+		t.Run(query, func(t *testing.T) {
+			_, err := httputil.Get(fmt.Sprintf("http://%s/scrape?%s", addr, query))
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
@@ -17,13 +17,20 @@ import (
 	"fmt"
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
+	"regexp"
+	"sync"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/go-chi/chi"
 	chimiddleware "github.com/go-chi/chi/middleware"
 	"github.com/uber-go/tally"
 
+	"github.com/uber/kraken/lib/buildinfo"
+	"github.com/uber/kraken/lib/featureflag"
 	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/origin/blobclient"
+	"github.com/uber/kraken/tracing"
+	"github.com/uber/kraken/tracker/announcehook"
 	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/tracker/peerstore"
@@ -34,14 +41,39 @@ import (
 
 // Server serves Tracker endpoints.
 type Server struct {
-	config Config
-	stats  tally.Scope
+	configMu  sync.RWMutex // Protects config and agentOnly against Reload.
+	config    Config
+	agentOnly []*regexp.Regexp
+	stats     tally.Scope
 
 	peerStore   peerstore.Store
 	originStore originstore.Store
 	policy      *peerhandoutpolicy.PriorityPolicy
 
 	originCluster blobclient.ClusterClient
+	metaInfoStore originstore.MetaInfoStore
+
+	publishedMetaInfo originstore.PublishedMetaInfoStore
+
+	hooks announcehook.Hooks
+
+	requests *requestCounter
+}
+
+// Option allows setting optional Server parameters.
+type Option func(*Server)
+
+// WithPublishedMetaInfoStore configures a Server to store the metainfo
+// published by agents in s. Defaults to an in-memory store, which is not
+// shared with other trackers.
+func WithPublishedMetaInfoStore(s originstore.PublishedMetaInfoStore) Option {
+	return func(server *Server) { server.publishedMetaInfo = s }
+}
+
+// WithAnnounceHooks configures a Server to invoke hooks on each announce, and
+// to leave peers quarantined by hooks out of its swarms. Defaults to no hooks.
+func WithAnnounceHooks(hooks announcehook.Hooks) Option {
+	return func(server *Server) { server.hooks = hooks }
 }
 
 // New creates a new Server.
@@ -51,7 +83,9 @@ func New(
 	policy *peerhandoutpolicy.PriorityPolicy,
 	peerStore peerstore.Store,
 	originStore originstore.Store,
-	originCluster blobclient.ClusterClient) *Server {
+	originCluster blobclient.ClusterClient,
+	metaInfoStore originstore.MetaInfoStore,
+	opts ...Option) *Server {
 
 	config = config.applyDefaults()
 
@@ -59,14 +93,42 @@ func New(
 		"module": "trackerserver",
 	})
 
-	return &Server{
+	s := &Server{
 		config:        config,
+		agentOnly:     compileNamespaces(config.AgentOnlyNamespaces),
 		stats:         stats,
 		peerStore:     peerStore,
 		originStore:   originStore,
 		policy:        policy,
 		originCluster: originCluster,
+		metaInfoStore: metaInfoStore,
+		hooks:         announcehook.NoopHooks{},
+		requests:      newRequestCounter(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.publishedMetaInfo == nil {
+		// In-memory stores cannot fail to be created.
+		s.publishedMetaInfo, _ = originstore.NewPublishedMetaInfoStore(
+			originstore.PublishedMetaInfoConfig{}, clock.New())
+	}
+	return s
+}
+
+// compileNamespaces compiles namespace regular expressions, skipping invalid
+// ones such that a bad reload cannot take trackers down.
+func compileNamespaces(namespaces []string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	for _, ns := range namespaces {
+		re, err := regexp.Compile(ns)
+		if err != nil {
+			log.Errorf("Ignoring invalid namespace %q: %s", ns, err)
+			continue
+		}
+		res = append(res, re)
 	}
+	return res
 }
 
 // Handler an http handler for s.
@@ -75,19 +137,69 @@ func (s *Server) Handler() http.Handler {
 
 	r.Use(middleware.StatusCounter(s.stats))
 	r.Use(middleware.LatencyTimer(s.stats))
+	r.Use(middleware.Tracing())
+	r.Use(middleware.Recovery(s.stats))
+	// Publishing metainfo and flag overrides are restricted to identities
+	// allowed by authz rules.
+	r.Use(middleware.Authorize(s.config.Authz, s.stats, "/namespace/", "/x/config/flags/"))
+	r.Use(s.requests.middleware)
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
 	r.Get("/readiness", handler.Wrap(s.readinessCheckHandler))
+	r.Get("/version", buildinfo.Handler(buildinfo.Tracker))
 
 	r.Get("/announce", handler.Wrap(s.announceHandlerV1))
 	r.Post("/announce/{infohash}", handler.Wrap(s.announceHandlerV2))
+	r.Get("/scrape", handler.Wrap(s.scrapeHandler))
 	r.Get("/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.getMetaInfoHandler))
+	r.Post("/namespace/{namespace}/blobs/{digest}/metainfo", handler.Wrap(s.publishMetaInfoHandler))
+
+	r.Get("/x/peerstats/{peerid}", handler.Wrap(s.getPeerStatsHandler))
+	r.Get("/x/stats/requests", handler.Wrap(s.getRequestStatsHandler))
+
+	r.Get("/x/peerstore/export", handler.Wrap(s.exportPeerStoreHandler))
+	r.Post("/x/peerstore/import", handler.Wrap(s.importPeerStoreHandler))
+
+	r.Mount("/x/config/flags", featureflag.Handler())
+	r.Mount("/x/config/tracing", tracing.Handler())
 
 	r.Mount("/debug", chimiddleware.Profiler())
 
 	return r
 }
 
+// Reload replaces the configuration of s. Listener configuration cannot be
+// reloaded and is ignored.
+func (s *Server) Reload(config Config) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	config.Listener = s.config.Listener
+	s.config = config.applyDefaults()
+	s.agentOnly = compileNamespaces(s.config.AgentOnlyNamespaces)
+}
+
+func (s *Server) getConfig() Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.config
+}
+
+// isAgentOnly returns true if blobs of namespace are distributed by agents
+// only.
+func (s *Server) isAgentOnly(namespace string) bool {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	for _, re := range s.agentOnly {
+		if re.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
 // ListenAndServe is a blocking call which runs s.
 func (s *Server) ListenAndServe() error {
 	log.Infof("Starting tracker server on %s", s.config.Listener)
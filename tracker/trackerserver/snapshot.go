@@ -0,0 +1,51 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// exportPeerStoreHandler writes a JSON snapshot of all swarms in the peer
+// store.
+func (s *Server) exportPeerStoreHandler(w http.ResponseWriter, r *http.Request) error {
+	snapshot, err := s.peerStore.Export()
+	if err != nil {
+		return handler.Errorf("export peer store: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return handler.Errorf("json encode: %s", err)
+	}
+	return nil
+}
+
+// importPeerStoreHandler adds the swarms of a JSON snapshot, as written by
+// exportPeerStoreHandler, to the peer store.
+func (s *Server) importPeerStoreHandler(w http.ResponseWriter, r *http.Request) error {
+	var snapshot peerstore.Snapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		return handler.Errorf("json decode: %s", err).Status(http.StatusBadRequest)
+	}
+	if err := s.peerStore.Import(&snapshot); err != nil {
+		return handler.Errorf("import peer store: %s", err)
+	}
+	log.Infof("Imported %d swarms into peer store", len(snapshot.Swarms))
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerstore"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportPeerStoreHandlers(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	snapshot := &peerstore.Snapshot{Swarms: []peerstore.SwarmSnapshot{{
+		InfoHash: core.InfoHashFixture().Hex(),
+		Peers: []peerstore.PeerSnapshot{{
+			PeerID:   core.PeerIDFixture().String(),
+			IP:       "10.0.0.1",
+			Port:     8080,
+			Complete: true,
+			TTL:      time.Minute,
+		}},
+	}}}
+	mocks.peerStore.EXPECT().Export().Return(snapshot, nil)
+
+	resp, err := httputil.Get(fmt.Sprintf("http://%s/x/peerstore/export", addr))
+	require.NoError(err)
+	defer resp.Body.Close()
+	var exported peerstore.Snapshot
+	require.NoError(json.NewDecoder(resp.Body).Decode(&exported))
+	require.Equal(*snapshot, exported)
+
+	b, err := json.Marshal(exported)
+	require.NoError(err)
+
+	mocks.peerStore.EXPECT().Import(snapshot).Return(nil)
+
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/x/peerstore/import", addr),
+		httputil.SendBody(bytes.NewReader(b)))
+	require.NoError(err)
+}
+
+func TestImportPeerStoreHandlerRejectsMalformedBody(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Post(
+		fmt.Sprintf("http://%s/x/peerstore/import", addr),
+		httputil.SendBody(bytes.NewReader([]byte("not json"))))
+	require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+}
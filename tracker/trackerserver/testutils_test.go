@@ -17,28 +17,38 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/uber/kraken/lib/middleware"
 	"github.com/uber/kraken/mocks/origin/blobclient"
 	"github.com/uber/kraken/mocks/tracker/originstore"
 	"github.com/uber/kraken/mocks/tracker/peerstore"
+	"github.com/uber/kraken/tracker/originstore"
 	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/utils/httputil"
 
+	"github.com/andres-erbsen/clock"
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
 	"github.com/uber-go/tally"
 )
 
+const _testNamespace = "test-namespace"
+
 type serverMocks struct {
+	t             *testing.T
 	config        Config
 	policy        *peerhandoutpolicy.PriorityPolicy
 	ctrl          *gomock.Controller
 	peerStore     *mockpeerstore.MockStore
 	originStore   *mockoriginstore.MockStore
 	originCluster *mockblobclient.MockClusterClient
+	metaInfoCache originstore.MetaInfoCacheConfig
 	stats         tally.Scope
 }
 
 func newServerMocks(t *testing.T, config Config) (*serverMocks, func()) {
 	ctrl := gomock.NewController(t)
 	return &serverMocks{
+		t:             t,
 		config:        config,
 		policy:        peerhandoutpolicy.DefaultPriorityPolicyFixture(),
 		peerStore:     mockpeerstore.NewMockStore(ctrl),
@@ -48,12 +58,41 @@ func newServerMocks(t *testing.T, config Config) (*serverMocks, func()) {
 	}, ctrl.Finish
 }
 
-func (m *serverMocks) handler() http.Handler {
+func (m *serverMocks) server(opts ...Option) *Server {
+	metaInfoStore, err := originstore.NewMetaInfoStore(
+		m.metaInfoCache, m.stats, clock.New(), m.originCluster)
+	require.NoError(m.t, err)
 	return New(
 		m.config,
 		m.stats,
 		m.policy,
 		m.peerStore,
 		m.originStore,
-		m.originCluster).Handler()
+		m.originCluster,
+		metaInfoStore,
+		opts...)
+}
+
+func (m *serverMocks) handler() http.Handler {
+	return m.server().Handler()
+}
+
+// agentHandler returns a handler for m which allows an agent identity to
+// publish metainfo, and authenticates every request as that agent.
+func (m *serverMocks) agentHandler() (http.Handler, func()) {
+	ca := httputil.NewCAFixture()
+	identity, cleanup := ca.IdentityConfig()
+	m.config.Authz = middleware.AuthzConfig{
+		Rules: []middleware.AuthzRule{{
+			PathPrefix: "/namespace/",
+			Allow:      []string{"spiffe://kraken/agent"},
+		}},
+		Identity: identity,
+	}
+	header := httputil.EncodeClientCertHeader(ca.ClientCert("spiffe://kraken/agent"))
+	h := m.handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set(httputil.ClientCertHeader, header)
+		h.ServeHTTP(w, r)
+	}), cleanup
 }
@@ -51,6 +51,10 @@
 //           football: true
 //           basketball: true
 //
+// An overlay file, e.g. holding per-cluster settings, can be merged on top of
+// the loaded configuration with WithOverlay, and individual values can be
+// overridden by environment variables with WithEnvOverrides.
+//
 package configutil
 
 import (
@@ -58,6 +62,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 
@@ -99,15 +104,50 @@ func (e ValidationError) Error() string {
 	return w.String()
 }
 
+// Option configures Load.
+type Option func(*loadOptions)
+
+type loadOptions struct {
+	overlays  []string
+	envPrefix string
+}
+
+// WithOverlay deep merges filename on top of the loaded configuration, after
+// all files it extends. Empty filenames are ignored, such that optional
+// overlay flags can be passed through.
+func WithOverlay(filename string) Option {
+	return func(o *loadOptions) {
+		if filename != "" {
+			o.overlays = append(o.overlays, filename)
+		}
+	}
+}
+
+// WithEnvOverrides overrides configuration values with environment variables
+// named prefix, followed by the YAML keys leading to the value. Keys are
+// upper-cased, stripped of underscores and joined by underscores. For example,
+// with prefix KRAKEN, KRAKEN_SCHEDULER_CONNTTL=5m sets scheduler.conn_ttl.
+// Values are parsed as YAML, so lists can be set as [a, b]. Environment
+// overrides are applied after all files, and variables with prefix which do
+// not name a configuration value fail the load.
+func WithEnvOverrides(prefix string) Option {
+	return func(o *loadOptions) { o.envPrefix = prefix }
+}
+
 // Load loads configuration based on config file name. It will
 // follow extends directives and do a deep merge of those config
 // files.
-func Load(filename string, config interface{}) error {
+func Load(filename string, config interface{}, opts ...Option) error {
+	var o loadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	filenames, err := resolveExtends(filename, readExtend)
 	if err != nil {
 		return err
 	}
-	return loadFiles(config, filenames)
+	filenames = append(filenames, o.overlays...)
+	return loadFiles(config, filenames, o.envPrefix)
 }
 
 type getExtend func(filename string) (extends string, err error)
@@ -157,8 +197,9 @@ func readExtend(configFile string) (string, error) {
 	return cfg.Extends, nil
 }
 
-// loadFiles loads a list of files, deep-merging values.
-func loadFiles(config interface{}, fnames []string) error {
+// loadFiles loads a list of files, deep-merging values, and applies
+// environment overrides with envPrefix if set.
+func loadFiles(config interface{}, fnames []string, envPrefix string) error {
 	for _, fname := range fnames {
 		data, err := ioutil.ReadFile(fname)
 		if err != nil {
@@ -170,6 +211,12 @@ func loadFiles(config interface{}, fnames []string) error {
 		}
 	}
 
+	if envPrefix != "" {
+		if err := applyEnvOverrides(config, envPrefix, os.Environ()); err != nil {
+			return err
+		}
+	}
+
 	// Validate on the merged config at the end.
 	if err := validator.Validate(config); err != nil {
 		return ValidationError{
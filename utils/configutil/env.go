@@ -0,0 +1,108 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configutil
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is the prefix of environment variables overriding configuration
+// of Kraken components.
+const EnvPrefix = "KRAKEN"
+
+// applyEnvOverrides sets the values of config named by the environment
+// variables in environ, given as KEY=VALUE, which start with prefix.
+func applyEnvOverrides(config interface{}, prefix string, environ []string) error {
+	prefix += "_"
+	sort.Strings(environ)
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv, prefix) {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+		segments := strings.Split(strings.TrimPrefix(name, prefix), "_")
+		v := reflect.ValueOf(config)
+		if err := setEnvOverride(v, segments, value); err != nil {
+			return fmt.Errorf("env %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnvOverride unmarshals value into the field of v addressed by segments.
+func setEnvOverride(v reflect.Value, segments []string, value string) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(segments) == 0 {
+		if err := yaml.Unmarshal([]byte(value), v.Addr().Interface()); err != nil {
+			return fmt.Errorf("parse %q as %s: %s", value, v.Type(), err)
+		}
+		return nil
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("%s is not a struct: cannot set %s", v.Type(), segments[0])
+	}
+	f, ok := findField(v, segments[0])
+	if !ok {
+		return fmt.Errorf("%s has no field %s", v.Type(), segments[0])
+	}
+	return setEnvOverride(f, segments[1:], value)
+}
+
+// findField returns the field of struct v whose YAML key, upper-cased and
+// stripped of underscores, equals segment. Inlined structs are searched too.
+func findField(v reflect.Value, segment string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		tag := strings.Split(sf.Tag.Get("yaml"), ",")
+		key := tag[0]
+		if key == "-" {
+			continue
+		}
+		inline := false
+		for _, flag := range tag[1:] {
+			if flag == "inline" {
+				inline = true
+			}
+		}
+		if inline && sf.Type.Kind() == reflect.Struct {
+			if f, ok := findField(v.Field(i), segment); ok {
+				return f, true
+			}
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(sf.Name)
+		}
+		if strings.ToUpper(strings.Replace(key, "_", "", -1)) == segment {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configutil
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type envConfig struct {
+	ConnTTL time.Duration `yaml:"conn_ttl"`
+	Servers []string
+	Nested  *struct {
+		Enabled bool `yaml:"enabled"`
+	} `yaml:"nested"`
+	Inlined envInlined `yaml:",inline"`
+	Ignored string     `yaml:"-"`
+}
+
+type envInlined struct {
+	Name string `yaml:"name"`
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	require := require.New(t)
+
+	var cfg envConfig
+	require.NoError(applyEnvOverrides(&cfg, "KRAKEN", []string{
+		"KRAKEN_CONNTTL=5m",
+		"KRAKEN_SERVERS=[a:80, b:80]",
+		"KRAKEN_NESTED_ENABLED=true",
+		"KRAKEN_NAME=foo",
+		"OTHER_CONNTTL=1m",
+	}))
+	require.Equal(5*time.Minute, cfg.ConnTTL)
+	require.Equal([]string{"a:80", "b:80"}, cfg.Servers)
+	require.True(cfg.Nested.Enabled)
+	require.Equal("foo", cfg.Inlined.Name)
+}
+
+func TestApplyEnvOverridesErrors(t *testing.T) {
+	tests := []struct {
+		desc string
+		env  string
+	}{
+		{"unknown field", "KRAKEN_UNKNOWN=1"},
+		{"ignored field", "KRAKEN_IGNORED=1"},
+		{"not a struct", "KRAKEN_CONNTTL_FOO=1"},
+		{"invalid value", "KRAKEN_CONNTTL=abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			var cfg envConfig
+			err := applyEnvOverrides(&cfg, "KRAKEN", []string{test.env})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), strings.SplitN(test.env, "=", 2)[0])
+		})
+	}
+}
+
+func TestLoadWithOverlayAndEnvOverrides(t *testing.T) {
+	require := require.New(t)
+
+	fname := writeFile(t, goodConfig)
+	defer os.Remove(fname)
+
+	overlay := writeFile(t, "buffer_space: 512\nlisten_address: localhost:5000")
+	defer os.Remove(overlay)
+
+	os.Setenv("CONFIGUTILTEST_LISTENADDRESS", "localhost:6000")
+	defer os.Unsetenv("CONFIGUTILTEST_LISTENADDRESS")
+
+	var cfg configuration
+	require.NoError(Load(
+		fname, &cfg, WithOverlay(overlay), WithOverlay(""), WithEnvOverrides("CONFIGUTILTEST")))
+	require.Equal(512, cfg.BufferSpace)
+	require.Equal("localhost:6000", cfg.ListenAddress)
+	require.Equal("val1", cfg.X.Y.V)
+}
+
+func TestLoadEnvOverridesAreValidated(t *testing.T) {
+	require := require.New(t)
+
+	fname := writeFile(t, goodConfig)
+	defer os.Remove(fname)
+
+	os.Setenv("CONFIGUTILTEST_BUFFERSPACE", "1")
+	defer os.Unsetenv("CONFIGUTILTEST_BUFFERSPACE")
+
+	var cfg configuration
+	err := Load(fname, &cfg, WithEnvOverrides("CONFIGUTILTEST"))
+	require.Error(err)
+	_, ok := err.(ValidationError)
+	require.True(ok)
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diskspaceutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diskStatsPath = "/proc/diskstats"
+
+	// Samples taken closer together than minSampleInterval are too noisy to be
+	// useful, so the previous utilization is returned instead.
+	minSampleInterval = 100 * time.Millisecond
+)
+
+// IOUtilSampler measures disk IO utilization, i.e. the percentage of time a
+// device was busy doing IO, between consecutive calls to Sample.
+type IOUtilSampler struct {
+	device string
+	now    func() time.Time
+	open   func() (io.ReadCloser, error)
+
+	mu       sync.Mutex
+	lastTime time.Time
+	lastBusy map[string]uint64
+	lastUtil int
+}
+
+// NewIOUtilSampler creates a new IOUtilSampler for device. If device is empty,
+// the busiest device is sampled.
+func NewIOUtilSampler(device string) *IOUtilSampler {
+	return &IOUtilSampler{
+		device: device,
+		now:    time.Now,
+		open:   func() (io.ReadCloser, error) { return os.Open(diskStatsPath) },
+	}
+}
+
+// Sample returns the IO utilization since the previous call to Sample. The
+// first call always returns 0.
+func (s *IOUtilSampler) Sample() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.lastBusy != nil && now.Sub(s.lastTime) < minSampleInterval {
+		return s.lastUtil, nil
+	}
+
+	f, err := s.open()
+	if err != nil {
+		return 0, fmt.Errorf("open diskstats: %s", err)
+	}
+	defer f.Close()
+
+	busy, err := parseDiskStats(f)
+	if err != nil {
+		return 0, err
+	}
+
+	var util int
+	if s.lastBusy != nil {
+		elapsed := uint64(now.Sub(s.lastTime) / time.Millisecond)
+		for device, ms := range busy {
+			if s.device != "" && device != s.device {
+				continue
+			}
+			last, ok := s.lastBusy[device]
+			if !ok || ms < last {
+				continue
+			}
+			if u := int((ms - last) * 100 / elapsed); u > util {
+				util = u
+			}
+		}
+	}
+	if util > 100 {
+		util = 100
+	}
+	s.lastTime = now
+	s.lastBusy = busy
+	s.lastUtil = util
+	return util, nil
+}
+
+// parseDiskStats returns the milliseconds spent doing IO per device.
+func parseDiskStats(r io.Reader) (map[string]uint64, error) {
+	busy := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		device := fields[2]
+		if strings.HasPrefix(device, "loop") || strings.HasPrefix(device, "ram") {
+			continue
+		}
+		ms, err := strconv.ParseUint(fields[12], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse io ticks of %s: %s", device, err)
+		}
+		busy[device] = ms
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan diskstats: %s", err)
+	}
+	return busy, nil
+}
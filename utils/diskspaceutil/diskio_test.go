@@ -0,0 +1,71 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package diskspaceutil
+
+import (
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func diskStatsFixture(sda, sdb int) string {
+	return strings.Join([]string{
+		"   7       0 loop0 0 0 0 0 0 0 0 0 0 0 99999 0 0 0 0 0 0",
+		"   8       0 sda 10 0 80 5 10 0 80 5 0 " + strconv.Itoa(sda) + " 10 0 0 0 0 0 0",
+		"   8      16 sdb 10 0 80 5 10 0 80 5 0 " + strconv.Itoa(sdb) + " 10 0 0 0 0 0 0",
+	}, "\n")
+}
+
+func TestIOUtilSamplerComputesBusiestDevice(t *testing.T) {
+	require := require.New(t)
+
+	var stats string
+	now := time.Unix(0, 0)
+
+	s := NewIOUtilSampler("")
+	s.now = func() time.Time { return now }
+	s.open = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(stats)), nil
+	}
+
+	stats = diskStatsFixture(1000, 1000)
+	util, err := s.Sample()
+	require.NoError(err)
+	require.Equal(0, util)
+
+	// sda busy for 250ms and sdb busy for 800ms over one second.
+	stats = diskStatsFixture(1250, 1800)
+	now = now.Add(time.Second)
+	util, err = s.Sample()
+	require.NoError(err)
+	require.Equal(80, util)
+
+	// Samples taken too close together return the previous utilization.
+	now = now.Add(time.Millisecond)
+	util, err = s.Sample()
+	require.NoError(err)
+	require.Equal(80, util)
+
+	s.device = "sda"
+	stats = diskStatsFixture(1750, 2800)
+	now = now.Add(time.Second - time.Millisecond)
+	util, err = s.Sample()
+	require.NoError(err)
+	require.Equal(50, util)
+}
@@ -15,3 +15,17 @@ func TestParseManifestV2List(t *testing.T) {
 	require.Equal(t, true, util > 0)
 	require.Equal(t, true, util < 100)
 }
+
+func TestIOUtilSampler(t *testing.T) {
+	require := require.New(t)
+
+	s := diskspaceutil.NewIOUtilSampler("")
+
+	util, err := s.Sample()
+	require.NoError(err)
+	require.Equal(0, util)
+
+	util, err = s.Sample()
+	require.NoError(err)
+	require.True(util >= 0 && util <= 100)
+}
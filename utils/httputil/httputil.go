@@ -29,6 +29,9 @@ import (
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/utils/handler"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 var retryableCodes = map[int]struct{}{
@@ -38,6 +41,10 @@ var retryableCodes = map[int]struct{}{
 	http.StatusGatewayTimeout:     {},
 }
 
+// ErrAcceptedTimeout is returned by PollAccepted if the endpoint still responds
+// with 202 once the backoff gives up.
+var ErrAcceptedTimeout = errors.New("backoff timed out on 202 responses")
+
 // RoundTripper is an alias of the http.RoundTripper for mocking purposes.
 type RoundTripper = http.RoundTripper
 
@@ -95,6 +102,12 @@ func IsConflict(err error) bool {
 	return IsStatus(err, http.StatusConflict)
 }
 
+// IsPreconditionFailed returns true if err is a "precondition failed"
+// StatusError.
+func IsPreconditionFailed(err error) bool {
+	return IsStatus(err, http.StatusPreconditionFailed)
+}
+
 // IsAccepted returns true if err is a "status accepted" StatusError.
 func IsAccepted(err error) bool {
 	return IsStatus(err, http.StatusAccepted)
@@ -183,6 +196,19 @@ func SendHeaders(headers map[string]string) SendOption {
 	return func(o *sendOptions) { o.headers = headers }
 }
 
+// SendHeader adds a single header to the http request, in addition to any
+// headers set by prior options.
+func SendHeader(key, value string) SendOption {
+	return func(o *sendOptions) {
+		headers := make(map[string]string, len(o.headers)+1)
+		for k, v := range o.headers {
+			headers[k] = v
+		}
+		headers[key] = value
+		o.headers = headers
+	}
+}
+
 // SendAcceptedCodes specifies accepted codes for http request
 func SendAcceptedCodes(codes ...int) SendOption {
 	m := make(map[int]bool)
@@ -279,6 +305,18 @@ func SendContext(ctx context.Context) SendOption {
 	return func(o *sendOptions) { o.ctx = ctx }
 }
 
+// NewPooledTransport returns a transport which keeps up to maxIdleConnsPerHost
+// idle connections per host for reuse. http.DefaultTransport only keeps 2, so
+// concurrent requests to the same host keep dialing new connections.
+func NewPooledTransport(maxIdleConnsPerHost int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if t.MaxIdleConns < maxIdleConnsPerHost {
+		t.MaxIdleConns = maxIdleConnsPerHost
+	}
+	return t
+}
+
 // Send sends an HTTP request. May return NetworkError or StatusError (see above).
 func Send(method, rawurl string, options ...SendOption) (*http.Response, error) {
 	u, err := url.Parse(rawurl)
@@ -400,7 +438,7 @@ func PollAccepted(
 		}
 		return resp, nil
 	}
-	return nil, errors.New("backoff timed out on 202 responses")
+	return nil, ErrAcceptedTimeout
 }
 
 // GetQueryArg gets an argument from http.Request by name.
@@ -434,19 +472,27 @@ func ParseDigest(r *http.Request, name string) (core.Digest, error) {
 		return core.Digest{}, err
 	}
 
-	d, err := core.ParseSHA256Digest(raw)
+	d, err := core.ParseDigest(raw)
 	if err != nil {
 		return core.Digest{}, handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
 	}
 	return d, nil
 }
 
+// ExtractContext returns the context of r, including any trace context
+// propagated by the sender.
+func ExtractContext(r *http.Request) context.Context {
+	return otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+}
+
 func newRequest(method string, opts *sendOptions) (*http.Request, error) {
 	req, err := http.NewRequest(method, opts.url.String(), opts.body)
 	if err != nil {
 		return nil, fmt.Errorf("new request: %s", err)
 	}
 	req = req.WithContext(opts.ctx)
+	// Propagate trace context, if any, to the receiving server.
+	otel.GetTextMapPropagator().Inject(opts.ctx, propagation.HeaderCarrier(req.Header))
 	if opts.body == nil {
 		req.ContentLength = 0
 	}
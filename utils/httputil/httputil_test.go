@@ -66,6 +66,31 @@ func TestSendOptions(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestSendHeader(t *testing.T) {
+	require := require.New(t)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	transport := mockhttputil.NewMockRoundTripper(ctrl)
+
+	headers := map[string]string{"a": "1"}
+
+	transport.EXPECT().RoundTrip(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+		require.Equal("1", req.Header.Get("a"))
+		require.Equal("2", req.Header.Get("b"))
+		return newResponse(200), nil
+	})
+
+	_, err := Get(
+		_testURL,
+		SendTransport(transport),
+		SendHeaders(headers),
+		SendHeader("b", "2"))
+	require.NoError(err)
+	require.Equal(map[string]string{"a": "1"}, headers)
+}
+
 func TestSendRetry(t *testing.T) {
 	require := require.New(t)
 
@@ -0,0 +1,180 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// ClientCertHeader is the header nginx uses to pass the verified client
+// certificate of a request, as url-escaped PEM, to upstream servers. nginx
+// always overwrites this header, but clients which reach servers directly may
+// set it to anything, so it is only read from trusted proxies.
+const ClientCertHeader = "X-SSL-Client-Cert"
+
+// Identity errors.
+var (
+	ErrNoPeerCertificate = errors.New("no peer certificate")
+	ErrUntrustedProxy    = errors.New("client cert header from untrusted address")
+)
+
+// IdentityConfig defines how client certificates of requests are verified.
+type IdentityConfig struct {
+	// TrustedProxies lists the IPs or CIDRs of proxies, e.g. nginx, which may
+	// pass client certificates in ClientCertHeader. "unix" trusts requests
+	// over unix sockets. The header is rejected on requests from any other
+	// address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// CAs verify client certificates which were not verified by the TLS
+	// handshake, including all certificates passed in ClientCertHeader.
+	CAs []Secret `yaml:"cas"`
+}
+
+// IdentityVerifier extracts verified client certificates from requests.
+type IdentityVerifier struct {
+	proxies []*net.IPNet
+	unix    bool
+	roots   *x509.CertPool
+}
+
+// NewIdentityVerifier creates a new IdentityVerifier.
+func NewIdentityVerifier(config IdentityConfig) (*IdentityVerifier, error) {
+	v := &IdentityVerifier{}
+	for _, p := range config.TrustedProxies {
+		if p == "unix" {
+			v.unix = true
+			continue
+		}
+		if ip := net.ParseIP(p); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			v.proxies = append(v.proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", p)
+		}
+		v.proxies = append(v.proxies, n)
+	}
+	if len(config.CAs) > 0 {
+		pems, err := concatSecrets(config.CAs)
+		if err != nil {
+			return nil, fmt.Errorf("concat cas: %s", err)
+		}
+		v.roots = x509.NewCertPool()
+		if !v.roots.AppendCertsFromPEM(pems) {
+			return nil, errors.New("cannot append cas")
+		}
+	}
+	return v, nil
+}
+
+// trusted returns true if r was sent by a trusted proxy.
+func (v *IdentityVerifier) trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// Requests over unix sockets have no remote address.
+		return v.unix && (r.RemoteAddr == "" || r.RemoteAddr == "@")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range v.proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify returns an error unless cert chains to the configured CAs.
+func (v *IdentityVerifier) verify(cert *x509.Certificate) error {
+	if v.roots == nil {
+		return errors.New("no cas configured to verify client certificate")
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:     v.roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("verify client certificate: %s", err)
+	}
+	return nil
+}
+
+// PeerCertificate returns the verified client certificate of r. If r was
+// served over TLS, the certificate is read from the connection, and must have
+// been verified by the handshake or chain to the configured CAs. Otherwise it
+// is read from ClientCertHeader, which is only accepted from trusted proxies
+// and must chain to the configured CAs.
+func (v *IdentityVerifier) PeerCertificate(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert := r.TLS.PeerCertificates[0]
+		if len(r.TLS.VerifiedChains) > 0 {
+			return cert, nil
+		}
+		if err := v.verify(cert); err != nil {
+			return nil, err
+		}
+		return cert, nil
+	}
+	h := r.Header.Get(ClientCertHeader)
+	if h == "" {
+		return nil, ErrNoPeerCertificate
+	}
+	if !v.trusted(r) {
+		return nil, ErrUntrustedProxy
+	}
+	raw, err := url.QueryUnescape(h)
+	if err != nil {
+		return nil, fmt.Errorf("unescape header: %s", err)
+	}
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("header is not a pem certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate: %s", err)
+	}
+	if err := v.verify(cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// PeerIdentities returns the URI SANs, e.g. SPIFFE IDs, of the verified client
+// certificate of r.
+func (v *IdentityVerifier) PeerIdentities(r *http.Request) ([]string, error) {
+	cert, err := v.PeerCertificate(r)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids, nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package httputil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerIdentitiesFromHeader(t *testing.T) {
+	ca := NewCAFixture()
+	config, cleanup := ca.IdentityConfig()
+	defer cleanup()
+
+	trusted := config
+	trusted.TrustedProxies = []string{"10.0.0.0/8", "unix"}
+
+	tests := []struct {
+		desc       string
+		config     IdentityConfig
+		remoteAddr string
+		cert       *x509.Certificate
+		expected   []string
+	}{
+		{"trusted proxy", trusted, "10.1.2.3:5000", ca.ClientCert("spiffe://a"), []string{"spiffe://a"}},
+		{"unix socket", trusted, "@", ca.ClientCert("spiffe://a"), []string{"spiffe://a"}},
+		{"untrusted proxy", trusted, "192.168.0.1:5000", ca.ClientCert("spiffe://a"), nil},
+		{"no trusted proxies", IdentityConfig{CAs: config.CAs}, "10.1.2.3:5000", ca.ClientCert("spiffe://a"), nil},
+		{"unknown ca", trusted, "10.1.2.3:5000", NewCAFixture().ClientCert("spiffe://a"), nil},
+		{"no cas", IdentityConfig{TrustedProxies: []string{"10.0.0.0/8"}}, "10.1.2.3:5000", ca.ClientCert("spiffe://a"), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			v, err := NewIdentityVerifier(test.config)
+			require.NoError(err)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			r.Header.Set(ClientCertHeader, EncodeClientCertHeader(test.cert))
+
+			ids, err := v.PeerIdentities(r)
+			if test.expected == nil {
+				require.Error(err)
+			} else {
+				require.NoError(err)
+				require.Equal(test.expected, ids)
+			}
+		})
+	}
+}
+
+func TestPeerIdentitiesFromTLS(t *testing.T) {
+	require := require.New(t)
+
+	ca := NewCAFixture()
+	config, cleanup := ca.IdentityConfig()
+	defer cleanup()
+
+	noCAs, err := NewIdentityVerifier(IdentityConfig{})
+	require.NoError(err)
+	withCAs, err := NewIdentityVerifier(config)
+	require.NoError(err)
+
+	cert := ca.ClientCert("spiffe://a")
+
+	// Certificates verified by the handshake are accepted as is.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	ids, err := noCAs.PeerIdentities(r)
+	require.NoError(err)
+	require.Equal([]string{"spiffe://a"}, ids)
+
+	// Unverified certificates must chain to the configured CAs.
+	r.TLS.VerifiedChains = nil
+	_, err = noCAs.PeerIdentities(r)
+	require.Error(err)
+	ids, err = withCAs.PeerIdentities(r)
+	require.NoError(err)
+	require.Equal([]string{"spiffe://a"}, ids)
+
+	// The header is ignored on TLS connections with client certificates.
+	r.TLS.PeerCertificates = []*x509.Certificate{NewCAFixture().ClientCert("spiffe://b")}
+	r.Header.Set(ClientCertHeader, EncodeClientCertHeader(cert))
+	_, err = withCAs.PeerIdentities(r)
+	require.Error(err)
+}
+
+func TestNewIdentityVerifierInvalidProxy(t *testing.T) {
+	_, err := NewIdentityVerifier(IdentityConfig{TrustedProxies: []string{"not-an-ip"}})
+	require.Error(t, err)
+}
+
+func TestPeerIdentitiesNoCertificate(t *testing.T) {
+	v, err := NewIdentityVerifier(IdentityConfig{})
+	require.NoError(t, err)
+	_, err = v.PeerIdentities(httptest.NewRequest("GET", "/", nil))
+	require.Equal(t, ErrNoPeerCertificate, err)
+}
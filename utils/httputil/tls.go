@@ -98,6 +98,40 @@ func (c *TLSConfig) BuildClient() (*tls.Config, error) {
 	return c.tls, nil
 }
 
+// BuildServer builds tls.Config for http servers. Client certificates are
+// verified against CAs if clients present them, but are not required.
+func (c *TLSConfig) BuildServer() (*tls.Config, error) {
+	if c.Server.Disabled {
+		return nil, nil
+	}
+	certPEM, err := parseCert(c.Server.Cert.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse server cert: %s", err)
+	}
+	keyPEM, err := parseKey(c.Server.Key.Path, c.Server.Passphrase.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parse server key: %s", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("load server x509 key pair: %s", err)
+	}
+	pems, err := concatSecrets(c.CAs)
+	if err != nil {
+		return nil, fmt.Errorf("concat secrets: %s", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if len(pems) > 0 && !clientCAs.AppendCertsFromPEM(pems) {
+		return nil, errors.New("cannot append client ca")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
 // WriteCABundle writes a list of CA to a writer.
 func (c *TLSConfig) WriteCABundle(w io.Writer) error {
 	pems, err := concatSecrets(c.CAs)
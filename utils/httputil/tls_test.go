@@ -253,3 +253,36 @@ func TestTLSClientFallbackError(t *testing.T) {
 	_, err = Get("https://some-non-existent-addr/", SendTLS(tls))
 	require.Error(err)
 }
+
+func TestTLSServerDisabled(t *testing.T) {
+	require := require.New(t)
+	c := TLSConfig{}
+	c.Server.Disabled = true
+	tls, err := c.BuildServer()
+	require.NoError(err)
+	require.Nil(tls)
+}
+
+func TestTLSServerVerifiesClientCerts(t *testing.T) {
+	require := require.New(t)
+
+	c, cleanup := genCerts(t)
+	defer cleanup()
+
+	certPEM, keyPEM, passphrase := genKeyPair(t, nil, nil, nil)
+	certPath, rm := testutil.TempFile(certPEM)
+	defer rm()
+	keyPath, rm := testutil.TempFile(keyPEM)
+	defer rm()
+	passphrasePath, rm := testutil.TempFile(passphrase)
+	defer rm()
+	c.Server.Cert.Path = certPath
+	c.Server.Key.Path = keyPath
+	c.Server.Passphrase.Path = passphrasePath
+
+	config, err := c.BuildServer()
+	require.NoError(err)
+	require.Len(config.Certificates, 1)
+	require.Equal(tls.VerifyClientCertIfGiven, config.ClientAuth)
+	require.NotNil(config.ClientCAs)
+}
@@ -19,6 +19,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -89,6 +90,24 @@ func StartServer(h http.Handler) (addr string, stop func()) {
 	return l.Addr().String(), func() { s.Close() }
 }
 
+// FreePort returns a localhost TCP port which is not currently in use.
+func FreePort() int {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+	_, portStr, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		panic(err)
+	}
+	return port
+}
+
 // TempFile creates a temporary file. Returns its name and cleanup function.
 func TempFile(data []byte) (string, func()) {
 	var cleanup Cleanup